@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/etherealiy/fastflow"
+)
+
+const usage = `Usage:
+  fastflow serve --dev [--dags DIR] [--addr ADDR] [--worker-key KEY]
+
+Commands:
+  serve   run fastflow worker
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	switch os.Args[1] {
+	case "serve":
+		if err := serve(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	case "-h", "--help", "help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command: %s\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+}
+
+func serve(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	dev := fs.Bool("dev", false, "run in standalone mode with embedded store and keeper, all data will be lost after exited")
+	dagDir := fs.String("dags", "./dags", "the directory of yaml dags")
+	addr := fs.String("addr", ":9090", "the listen address of management api and metrics")
+	workerKey := fs.String("worker-key", "standalone-1", "the key of worker")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if !*dev {
+		return fmt.Errorf("only dev mode is supported by this binary, " +
+			"production deployment should embed fastflow and register your actions")
+	}
+	if _, err := os.Stat(*dagDir); err != nil {
+		return fmt.Errorf("read dag directory failed: %w", err)
+	}
+
+	return fastflow.StartDev(&fastflow.DevOption{
+		DagDir:    *dagDir,
+		Addr:      *addr,
+		WorkerKey: *workerKey,
+	})
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"text/tabwriter"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/api"
+	"github.com/etherealiy/fastflow/pkg/mod"
+	"github.com/spf13/cobra"
+)
+
+type runBackfillOption struct {
+	apiOption
+	id            string
+	dateVar       string
+	dateFormat    string
+	start         string
+	end           string
+	schedule      string
+	vars          []string
+	labels        []string
+	parallelism   int
+	order         string
+	stopOnFailure bool
+	dryRun        bool
+	output        string
+}
+
+func newRunBackfillCmd() *cobra.Command {
+	opt := &runBackfillOption{}
+	cmd := &cobra.Command{
+		Use:   "backfill DAG_ID",
+		Short: "Run a dag for each data interval in a date range",
+		Example: `  # run the daily partitions of january, two of them at a time
+  fastflowctl run backfill my-dag --date-var ds --start 2023-01-01 --end 2023-02-01 --parallelism 2
+
+  # show the status of backfill
+  fastflowctl run backfill --id my-dag-1672531200-1675209600`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return showBackfill(cmd.OutOrStdout(), opt)
+			}
+			return startBackfill(cmd.OutOrStdout(), args[0], opt)
+		},
+	}
+	addAPIFlags(cmd, &opt.apiOption)
+	cmd.Flags().StringVar(&opt.id, "id", "", "the id of backfill, the same backfill is resumed when it is started again, "+
+		"only the status is shown when dag id is not specified")
+	cmd.Flags().StringVar(&opt.dateVar, "date-var", "", "the variable of dag which is set to the logical date of each run")
+	cmd.Flags().StringVar(&opt.dateFormat, "date-format", "", "the go layout of date variable, default is 2006-01-02")
+	cmd.Flags().StringVar(&opt.start, "start", "", "the start of date range, such as 2022-01-01 or 2022-01-01T00:00:00Z")
+	cmd.Flags().StringVar(&opt.end, "end", "", "the end of date range which is excluded")
+	cmd.Flags().StringVar(&opt.schedule, "schedule", "", "the cron expression splitting the range, default is the cron of dag or daily")
+	cmd.Flags().StringArrayVar(&opt.vars, "var", nil, "the variables of dag, such as k=v, can be specified multiple times")
+	cmd.Flags().StringArrayVar(&opt.labels, "label", nil, "the labels of dag instances, such as k=v, can be specified multiple times")
+	cmd.Flags().IntVar(&opt.parallelism, "parallelism", 1, "the max count of unfinished runs")
+	cmd.Flags().StringVar(&opt.order, "order", "", "oldestFirst or newestFirst, default is oldestFirst")
+	cmd.Flags().BoolVar(&opt.stopOnFailure, "stop-on-failure", false, "stop creating runs once a run failed")
+	cmd.Flags().BoolVar(&opt.dryRun, "dry-run", false, "only print the planned runs")
+	cmd.Flags().StringVarP(&opt.output, "output", "o", "", "output format, empty means table, or json")
+	return cmd
+}
+
+func startBackfill(out io.Writer, dagID string, opt *runBackfillOption) error {
+	vars, err := parseVars(opt.vars)
+	if err != nil {
+		return err
+	}
+	labels, err := parseVars(opt.labels)
+	if err != nil {
+		return err
+	}
+	start, err := parseLogicalDate(opt.start)
+	if err != nil {
+		return err
+	}
+	end, err := parseLogicalDate(opt.end)
+	if err != nil {
+		return err
+	}
+	input := &api.StartBackfillInput{
+		BackfillInput: mod.BackfillInput{
+			ID:            opt.id,
+			DateVar:       opt.dateVar,
+			DateFormat:    opt.dateFormat,
+			Start:         start,
+			End:           end,
+			Schedule:      opt.schedule,
+			Vars:          vars,
+			Labels:        labels,
+			Parallelism:   opt.parallelism,
+			Order:         mod.BackfillOrder(opt.order),
+			StopOnFailure: opt.stopOnFailure,
+		},
+		DryRun: opt.dryRun,
+	}
+	sts := &mod.BackfillStatus{}
+	if err := opt.call(http.MethodPost, "dags/"+url.PathEscape(dagID)+"/backfills", input, sts); err != nil {
+		return err
+	}
+	return printBackfill(out, sts, opt.output)
+}
+
+func showBackfill(out io.Writer, opt *runBackfillOption) error {
+	if opt.id == "" {
+		return fmt.Errorf("dag id or backfill id must be specified")
+	}
+	sts := &mod.BackfillStatus{}
+	if err := opt.call(http.MethodGet, "backfills/"+url.PathEscape(opt.id), nil, sts); err != nil {
+		return err
+	}
+	return printBackfill(out, sts, opt.output)
+}
+
+func printBackfill(out io.Writer, sts *mod.BackfillStatus, output string) error {
+	switch output {
+	case "json":
+		return printJSON(out, sts)
+	case "":
+	default:
+		return fmt.Errorf("unsupported output format %q", output)
+	}
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "LOGICAL DATE\tDATA INTERVAL END\tDAG INSTANCE\tSTATUS")
+	for _, r := range sts.Runs {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.LogicalDate.Format(time.RFC3339), r.DataIntervalEnd.Format(time.RFC3339),
+			orDash(r.DagInsID), orDash(string(r.Status)))
+	}
+	w.Flush()
+
+	if sts.State == "" {
+		fmt.Fprintf(out, "\nbackfill %s planned %d runs\n", sts.Input.ID, len(sts.Runs))
+		return nil
+	}
+	fmt.Fprintf(out, "\nbackfill %s %s", sts.Input.ID, sts.State)
+	if sts.Reason != "" {
+		fmt.Fprintf(out, ": %s", sts.Reason)
+	}
+	fmt.Fprintln(out)
+	return nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// apiOption is the options of commands calling the management api
+type apiOption struct {
+	server  string
+	timeout time.Duration
+	token   string
+}
+
+func addAPIFlags(cmd *cobra.Command, opt *apiOption) {
+	cmd.Flags().StringVar(&opt.server, "server", "http://127.0.0.1:9090", "the address of management api")
+	cmd.Flags().DurationVar(&opt.timeout, "timeout", 10*time.Second, "the timeout of request")
+	cmd.Flags().StringVar(&opt.token, "token", os.Getenv("FASTFLOW_TOKEN"),
+		"the Authorization header of request, default is env FASTFLOW_TOKEN")
+}
+
+// call send the body as json to the management api and decode the response into ret if it is not nil
+func (o *apiOption) call(method, path string, body, ret interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		bs, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("encode request failed: %w", err)
+		}
+		reader = bytes.NewReader(bs)
+	}
+	req, err := http.NewRequest(method, strings.TrimSuffix(o.server, "/")+"/api/v1/"+path, reader)
+	if err != nil {
+		return fmt.Errorf("build request failed: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if o.token != "" {
+		req.Header.Set("Authorization", o.token)
+	}
+
+	client := &http.Client{Timeout: o.timeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request management api failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("read response failed: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s %s failed, status: %d, body: %s", method, path, resp.StatusCode, respBody)
+	}
+	if ret == nil {
+		return nil
+	}
+	if err := json.Unmarshal(respBody, ret); err != nil {
+		return fmt.Errorf("decode response failed: %w", err)
+	}
+	return nil
+}
+
+// printJSON is used by the commands with "-o json"
+func printJSON(out io.Writer, v interface{}) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/spf13/cobra"
+)
+
+type clusterOption struct {
+	server  string
+	timeout time.Duration
+}
+
+func newClusterCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cluster",
+		Short: "Manage cluster",
+	}
+	cmd.AddCommand(newClusterPromoteCmd())
+	return cmd
+}
+
+func newClusterPromoteCmd() *cobra.Command {
+	opt := &clusterOption{}
+	cmd := &cobra.Command{
+		Use:   "promote",
+		Short: "Promote the standby cluster to active",
+		Long: `Promote the standby cluster to active, all workers of it leave standby mode in next config sync interval,
+then the leader takes over the schedules and in-flight dag instances of primary cluster.`,
+		Example: `  # fail over to the standby cluster
+  fastflowctl cluster promote --server http://standby:9090`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return promoteCluster(cmd.OutOrStdout(), opt)
+		},
+	}
+	cmd.Flags().StringVar(&opt.server, "server", "http://127.0.0.1:9090", "the address of management api")
+	cmd.Flags().DurationVar(&opt.timeout, "timeout", 10*time.Second, "the timeout of request")
+	return cmd
+}
+
+func promoteCluster(out io.Writer, opt *clusterOption) error {
+	client := &http.Client{Timeout: opt.timeout}
+	resp, err := client.Post(strings.TrimSuffix(opt.server, "/")+"/api/v1/admin/promote", "application/json", nil)
+	if err != nil {
+		return fmt.Errorf("request management api failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("read response failed: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("promote cluster failed, status: %d, body: %s", resp.StatusCode, body)
+	}
+	cfg := &entity.ClusterConfig{}
+	if err := json.Unmarshal(body, cfg); err != nil {
+		return fmt.Errorf("decode cluster config failed: %w", err)
+	}
+	fmt.Fprintf(out, "cluster promoted at %s\n", time.Unix(cfg.PromotedAt, 0).Format(time.RFC3339))
+	return nil
+}
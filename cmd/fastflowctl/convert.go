@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/etherealiy/fastflow"
+	"github.com/etherealiy/fastflow/pkg/convert"
+	"github.com/spf13/cobra"
+)
+
+type convertOption struct {
+	file           string
+	output         string
+	fallbackAction string
+	// export convert fastflow dag to other engines
+	export bool
+}
+
+func newConvertCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "convert",
+		Short: "Convert dags of other workflow engines to fastflow yaml",
+	}
+	cmd.AddCommand(newConvertAirflowCmd())
+	cmd.AddCommand(newConvertArgoCmd())
+	return cmd
+}
+
+func newConvertAirflowCmd() *cobra.Command {
+	opt := &convertOption{}
+	cmd := &cobra.Command{
+		Use:   "airflow",
+		Short: "Convert airflow dag metadata to fastflow yaml",
+		Example: `  # the input is the response of airflow REST API "GET /dags/{dag_id}/details" with "tasks" field
+  fastflowctl convert airflow -f dag.json -o dag.yaml`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return convertAirflow(cmd.OutOrStdout(), cmd.ErrOrStderr(), opt)
+		},
+	}
+	cmd.Flags().StringVarP(&opt.file, "file", "f", "", "the json or yaml file of airflow dag metadata")
+	cmd.Flags().StringVarP(&opt.output, "output", "o", "", "the output yaml file, default is stdout")
+	cmd.Flags().StringVar(&opt.fallbackAction, "fallback-action", "", "the action used by unsupported operators, empty means reporting an error")
+	return cmd
+}
+
+func newConvertArgoCmd() *cobra.Command {
+	opt := &convertOption{}
+	cmd := &cobra.Command{
+		Use:   "argo",
+		Short: "Convert between argo workflow and fastflow yaml",
+		Example: `  # import argo workflow, container steps are mapped to the container action
+  fastflowctl convert argo -f workflow.yaml -o dag.yaml
+
+  # export fastflow dag to argo workflow
+  fastflowctl convert argo --export -f dag.yaml -o workflow.yaml`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return convertArgo(cmd.OutOrStdout(), cmd.ErrOrStderr(), opt)
+		},
+	}
+	cmd.Flags().StringVarP(&opt.file, "file", "f", "", "the yaml file of argo workflow, or fastflow dag when exporting")
+	cmd.Flags().StringVarP(&opt.output, "output", "o", "", "the output yaml file, default is stdout")
+	cmd.Flags().BoolVar(&opt.export, "export", false, "convert fastflow dag to argo workflow")
+	return cmd
+}
+
+func convertArgo(out, errOut io.Writer, opt *convertOption) error {
+	if opt.file == "" {
+		return fmt.Errorf("input file cannot be empty, please specify -f")
+	}
+	if opt.export {
+		dag, err := fastflow.ReadDagFile(opt.file)
+		if err != nil {
+			return err
+		}
+		wf, err := convert.ToArgo(dag, nil)
+		if err != nil {
+			return err
+		}
+		bs, err := convert.MarshalArgoWorkflow(wf)
+		if err != nil {
+			return fmt.Errorf("marshal argo workflow failed: %w", err)
+		}
+		return writeOutput(out, opt.output, bs)
+	}
+
+	bs, err := ioutil.ReadFile(opt.file)
+	if err != nil {
+		return fmt.Errorf("read %s failed: %w", opt.file, err)
+	}
+	wf, err := convert.ParseArgoWorkflow(bs)
+	if err != nil {
+		return err
+	}
+	ret, err := convert.FromArgo(wf, nil)
+	if err != nil {
+		return err
+	}
+	return writeConvertResult(out, errOut, opt.output, ret)
+}
+
+func convertAirflow(out, errOut io.Writer, opt *convertOption) error {
+	if opt.file == "" {
+		return fmt.Errorf("airflow dag file cannot be empty, please specify -f")
+	}
+	bs, err := ioutil.ReadFile(opt.file)
+	if err != nil {
+		return fmt.Errorf("read %s failed: %w", opt.file, err)
+	}
+	af, err := convert.ParseAirflowDag(bs)
+	if err != nil {
+		return err
+	}
+	ret, err := convert.FromAirflow(af, &convert.AirflowOption{FallbackAction: opt.fallbackAction})
+	if err != nil {
+		return err
+	}
+	return writeConvertResult(out, errOut, opt.output, ret)
+}
+
+func writeConvertResult(out, errOut io.Writer, output string, ret *convert.ConvertResult) error {
+	for _, w := range ret.Warnings {
+		fmt.Fprintf(errOut, "WARNING: %s\n", w)
+	}
+	bs, err := convert.MarshalDag(ret.Dag)
+	if err != nil {
+		return fmt.Errorf("marshal dag failed: %w", err)
+	}
+	return writeOutput(out, output, bs)
+}
+
+func writeOutput(out io.Writer, output string, bs []byte) error {
+	if output == "" {
+		_, err := out.Write(bs)
+		return err
+	}
+	return ioutil.WriteFile(output, bs, 0644)
+}
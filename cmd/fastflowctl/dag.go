@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"text/tabwriter"
+	"time"
+
+	"github.com/etherealiy/fastflow"
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/mod"
+	"github.com/spf13/cobra"
+)
+
+type dagListOption struct {
+	apiOption
+	prefix string
+	output string
+}
+
+func newDagCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "dag",
+		Short: "Manage dags",
+	}
+	cmd.AddCommand(newDagListCmd())
+	cmd.AddCommand(newDagValidateCmd())
+	return cmd
+}
+
+func newDagListCmd() *cobra.Command {
+	opt := &dagListOption{}
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List dags, the store of cluster must support listing dags",
+		Example: `  # list the dags of a team
+  fastflowctl dag list --prefix team-a-`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return listDags(cmd.OutOrStdout(), opt)
+		},
+	}
+	addAPIFlags(cmd, &opt.apiOption)
+	cmd.Flags().StringVar(&opt.prefix, "prefix", "", "only list the dags which id has the prefix")
+	cmd.Flags().StringVarP(&opt.output, "output", "o", "", "output format, empty means table, or json")
+	return cmd
+}
+
+func listDags(out io.Writer, opt *dagListOption) error {
+	path := "dags"
+	if opt.prefix != "" {
+		path += "?idPrefix=" + url.QueryEscape(opt.prefix)
+	}
+	var dags []*entity.Dag
+	if err := opt.call(http.MethodGet, path, nil, &dags); err != nil {
+		return err
+	}
+
+	switch opt.output {
+	case "json":
+		return printJSON(out, dags)
+	case "":
+		w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tSTATUS\tCRON\tTASKS\tUPDATED AT")
+		for _, d := range dags {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\n", d.ID, orDash(d.Name), orDash(string(d.Status)), orDash(d.Cron),
+				len(d.Tasks), time.Unix(d.UpdatedAt, 0).Format(time.RFC3339))
+		}
+		return w.Flush()
+	default:
+		return fmt.Errorf("unsupported output format %q", opt.output)
+	}
+}
+
+func newDagValidateCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "validate FILE...",
+		Short: "Validate dag files before submitting them",
+		Long: `Validate dag files, all problems such as cycles and missing depends are reported.
+The actions are registered in the processes of workers, so they are not checked.`,
+		Example: `  # validate dags in CI
+  fastflowctl dag validate dags/*.yaml`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return validateDags(cmd.OutOrStdout(), args)
+		},
+	}
+}
+
+func validateDags(out io.Writer, files []string) error {
+	invalid := false
+	for _, file := range files {
+		dag, err := fastflow.ReadDagFile(file)
+		if err != nil {
+			invalid = true
+			fmt.Fprintln(out, err)
+			continue
+		}
+		var violations []mod.DagViolation
+		for _, v := range mod.ValidateDag(dag) {
+			if v.Type != mod.DagViolationUndefinedAction {
+				violations = append(violations, v)
+			}
+		}
+		if len(violations) == 0 {
+			fmt.Fprintf(out, "%s: ok\n", file)
+			continue
+		}
+		invalid = true
+		for _, v := range violations {
+			fmt.Fprintf(out, "%s: %s\n", file, v)
+		}
+	}
+	if invalid {
+		return &exitError{code: 1}
+	}
+	return nil
+}
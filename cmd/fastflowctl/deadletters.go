@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/spf13/cobra"
+)
+
+type deadLettersOption struct {
+	server  string
+	timeout time.Duration
+	dagID   string
+	output  string
+}
+
+func newDeadLettersCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "dead-letters",
+		Short: "Manage dag instances which failed after their retry budgets are exhausted",
+	}
+	cmd.AddCommand(newDeadLettersListCmd())
+	cmd.AddCommand(newDeadLettersRequeueCmd())
+	return cmd
+}
+
+func newDeadLettersListCmd() *cobra.Command {
+	opt := &deadLettersOption{}
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List dead letter dag instances",
+		Example: `  # show the runs which need human attention
+  fastflowctl dead-letters list --dag my-dag`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return listDeadLetters(cmd.OutOrStdout(), opt)
+		},
+	}
+	addDeadLettersFlags(cmd, opt)
+	cmd.Flags().StringVar(&opt.dagID, "dag", "", "only list the dead letters of the dag")
+	cmd.Flags().StringVarP(&opt.output, "output", "o", "", "output format, empty means table, or json")
+	return cmd
+}
+
+func newDeadLettersRequeueCmd() *cobra.Command {
+	opt := &deadLettersOption{}
+	cmd := &cobra.Command{
+		Use:   "requeue DAG_INSTANCE_ID",
+		Short: "Retry the failed tasks of dead letter dag instance with a new retry budget",
+		Example: `  # requeue the run after the underlying issue is fixed
+  fastflowctl dead-letters requeue 1234`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return requeueDeadLetter(cmd.OutOrStdout(), args[0], opt)
+		},
+	}
+	addDeadLettersFlags(cmd, opt)
+	return cmd
+}
+
+func addDeadLettersFlags(cmd *cobra.Command, opt *deadLettersOption) {
+	cmd.Flags().StringVar(&opt.server, "server", "http://127.0.0.1:9090", "the address of management api")
+	cmd.Flags().DurationVar(&opt.timeout, "timeout", 10*time.Second, "the timeout of request")
+}
+
+func listDeadLetters(out io.Writer, opt *deadLettersOption) error {
+	u := strings.TrimSuffix(opt.server, "/") + "/api/v1/dead-letters"
+	if opt.dagID != "" {
+		u += "?dagId=" + url.QueryEscape(opt.dagID)
+	}
+	client := &http.Client{Timeout: opt.timeout}
+	resp, err := client.Get(u)
+	if err != nil {
+		return fmt.Errorf("request management api failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("read response failed: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("list dead letters failed, status: %d, body: %s", resp.StatusCode, body)
+	}
+	var dagIns []*entity.DagInstance
+	if err := json.Unmarshal(body, &dagIns); err != nil {
+		return fmt.Errorf("decode dead letters failed: %w", err)
+	}
+
+	switch opt.output {
+	case "json":
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(dagIns)
+	case "":
+		w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tDAG\tRETRIES\tDEAD AT\tREASON")
+		for _, d := range dagIns {
+			fmt.Fprintf(w, "%s\t%s\t%d/%d\t%s\t%s\n", d.ID, d.DagID, d.RetryCount, d.RetryBudget,
+				time.Unix(d.DeadLetter.CreatedAt, 0).Format(time.RFC3339), d.DeadLetter.Reason)
+		}
+		return w.Flush()
+	default:
+		return fmt.Errorf("unsupported output format %q", opt.output)
+	}
+}
+
+func requeueDeadLetter(out io.Writer, dagInsID string, opt *deadLettersOption) error {
+	client := &http.Client{Timeout: opt.timeout}
+	resp, err := client.Post(fmt.Sprintf("%s/api/v1/dead-letters/%s/requeue", strings.TrimSuffix(opt.server, "/"),
+		url.PathEscape(dagInsID)), "application/json", nil)
+	if err != nil {
+		return fmt.Errorf("request management api failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("read response failed: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("requeue dead letter failed, status: %d, body: %s", resp.StatusCode, body)
+	}
+	fmt.Fprintf(out, "dag instance %s requeued\n", dagInsID)
+	return nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+func main() {
+	if err := newRootCmd().Execute(); err != nil {
+		if exitErr, ok := err.(*exitError); ok {
+			os.Exit(exitErr.code)
+		}
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func newRootCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:           "fastflowctl",
+		Short:         "fastflowctl controls fastflow dags and runs",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	}
+	cmd.AddCommand(newDagCmd())
+	cmd.AddCommand(newRunCmd())
+	cmd.AddCommand(newTaskCmd())
+	cmd.AddCommand(newConvertCmd())
+	cmd.AddCommand(newOpenAPICmd())
+	cmd.AddCommand(newWorkersCmd())
+	cmd.AddCommand(newClusterCmd())
+	cmd.AddCommand(newDeadLettersCmd())
+	return cmd
+}
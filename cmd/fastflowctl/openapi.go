@@ -0,0 +1,28 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/etherealiy/fastflow/pkg/api"
+	"github.com/spf13/cobra"
+)
+
+func newOpenAPICmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "openapi",
+		Short: "Print the OpenAPI document of management api",
+		Example: `  # generate go client by oapi-codegen
+  fastflowctl openapi > openapi.json
+  oapi-codegen -generate types,client -package client openapi.json > client.go`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return printOpenAPI(cmd.OutOrStdout())
+		},
+	}
+}
+
+func printOpenAPI(out io.Writer) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(api.NewHandler().OpenAPI())
+}
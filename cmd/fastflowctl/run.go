@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/etherealiy/fastflow"
+	"github.com/spf13/cobra"
+)
+
+// exitError make process exit with the code and without printing anything
+type exitError struct {
+	code int
+}
+
+// Error
+func (e *exitError) Error() string {
+	return fmt.Sprintf("exit with code %d", e.code)
+}
+
+type runOption struct {
+	local   bool
+	file    string
+	vars    []string
+	timeout time.Duration
+	verbose bool
+	// logicalDate is in format "2006-01-02" or RFC3339
+	logicalDate string
+}
+
+func newRunCmd() *cobra.Command {
+	opt := &runOption{}
+	cmd := &cobra.Command{
+		Use:   "run",
+		Short: "Run a dag",
+		Example: `  # run a dag file to completion in standalone mode
+  fastflowctl run --local -f dag.yaml --var k=v
+
+  # run a dag in cluster and wait for it
+  fastflowctl run trigger my-dag --var k=v --watch`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runDag(cmd.OutOrStdout(), opt)
+		},
+	}
+	cmd.AddCommand(newRunTriggerCmd())
+	cmd.AddCommand(newRunStatusCmd())
+	cmd.AddCommand(newRunBackfillCmd())
+	cmd.Flags().BoolVar(&opt.local, "local", false, "run the dag in standalone mode with embedded store and keeper")
+	cmd.Flags().StringVarP(&opt.file, "file", "f", "", "the yaml file of dag")
+	cmd.Flags().StringArrayVar(&opt.vars, "var", nil, "the variables of dag, such as k=v, can be specified multiple times")
+	cmd.Flags().DurationVar(&opt.timeout, "timeout", 0, "the timeout of the whole run, 0 means no limit")
+	cmd.Flags().BoolVarP(&opt.verbose, "verbose", "v", false, "print engine logs")
+	cmd.Flags().StringVar(&opt.logicalDate, "logical-date", "", "the logical date of run, such as 2022-01-01 or 2022-01-01T00:00:00Z, default is now")
+	return cmd
+}
+
+func runDag(out io.Writer, opt *runOption) error {
+	if !opt.local {
+		return fmt.Errorf("please specify --local to run a dag file, or use \"run trigger\" to run a dag in cluster")
+	}
+	if opt.file == "" {
+		return fmt.Errorf("dag file cannot be empty, please specify -f")
+	}
+	vars, err := parseVars(opt.vars)
+	if err != nil {
+		return err
+	}
+	logicalDate, err := parseLogicalDate(opt.logicalDate)
+	if err != nil {
+		return err
+	}
+	dag, err := fastflow.ReadDagFile(opt.file)
+	if err != nil {
+		return err
+	}
+
+	if !opt.verbose {
+		log.SetOutput(ioutil.Discard)
+	}
+	ret, runErr := fastflow.RunLocal(&fastflow.LocalRunOption{
+		Dag:         dag,
+		Vars:        vars,
+		Timeout:     opt.timeout,
+		LogicalDate: logicalDate,
+	})
+	if ret != nil {
+		printResult(out, ret)
+	}
+	if runErr != nil {
+		return runErr
+	}
+	if !ret.Succeed() {
+		return &exitError{code: 1}
+	}
+	return nil
+}
+
+func parseVars(kvs []string) (map[string]string, error) {
+	vars := map[string]string{}
+	for _, kv := range kvs {
+		pair := strings.SplitN(kv, "=", 2)
+		if len(pair) != 2 || pair[0] == "" {
+			return nil, fmt.Errorf("invalid var %q, it should be like k=v", kv)
+		}
+		vars[pair[0]] = pair[1]
+	}
+	return vars, nil
+}
+
+func parseLogicalDate(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid logical date %q, it should be like 2006-01-02 or RFC3339", s)
+	}
+	return t, nil
+}
+
+func printResult(out io.Writer, ret *fastflow.LocalRunResult) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TASK\tACTION\tSTATUS\tTIME USED\tREASON")
+	for _, t := range ret.TaskIns {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", t.TaskID, t.ActionName, t.Status, t.TimeUsed, t.Reason)
+	}
+	w.Flush()
+
+	status := "succeed"
+	if !ret.Succeed() {
+		status = "failed"
+	}
+	fmt.Fprintf(out, "\ndag instance %s %s\n", ret.DagIns.ID, status)
+}
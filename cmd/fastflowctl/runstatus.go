@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"text/tabwriter"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/api"
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/mod"
+	"github.com/spf13/cobra"
+)
+
+type runStatusOption struct {
+	apiOption
+	watch    bool
+	interval time.Duration
+	output   string
+}
+
+type runTriggerOption struct {
+	runStatusOption
+	vars           []string
+	labels         []string
+	idempotencyKey string
+}
+
+func newRunTriggerCmd() *cobra.Command {
+	opt := &runTriggerOption{}
+	cmd := &cobra.Command{
+		Use:   "trigger DAG_ID",
+		Short: "Run a dag in cluster by management api",
+		Example: `  # run a dag with variables and labels
+  fastflowctl run trigger my-dag --var k=v --label team=data`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return triggerRun(cmd.OutOrStdout(), args[0], opt)
+		},
+	}
+	addRunStatusFlags(cmd, &opt.runStatusOption)
+	cmd.Flags().StringArrayVar(&opt.vars, "var", nil, "the variables of dag, such as k=v, can be specified multiple times")
+	cmd.Flags().StringArrayVar(&opt.labels, "label", nil, "the labels of dag instance, such as k=v, can be specified multiple times")
+	cmd.Flags().StringVar(&opt.idempotencyKey, "idempotency-key", "", "the runs with the same key return the existing dag instance")
+	return cmd
+}
+
+func newRunStatusCmd() *cobra.Command {
+	opt := &runStatusOption{}
+	cmd := &cobra.Command{
+		Use:   "status DAG_INSTANCE_ID",
+		Short: "Show status of dag instance and its tasks",
+		Example: `  # wait for the run and exit with code 1 if it failed
+  fastflowctl run status 1234 --watch`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return showRunStatus(cmd.OutOrStdout(), args[0], opt)
+		},
+	}
+	addRunStatusFlags(cmd, opt)
+	return cmd
+}
+
+func addRunStatusFlags(cmd *cobra.Command, opt *runStatusOption) {
+	addAPIFlags(cmd, &opt.apiOption)
+	cmd.Flags().BoolVarP(&opt.watch, "watch", "w", false, "print status when it changes until the dag instance finished")
+	cmd.Flags().DurationVar(&opt.interval, "interval", 2*time.Second, "the interval of polling status when watching")
+	cmd.Flags().StringVarP(&opt.output, "output", "o", "", "output format, empty means table, or json")
+}
+
+func triggerRun(out io.Writer, dagID string, opt *runTriggerOption) error {
+	vars, err := parseVars(opt.vars)
+	if err != nil {
+		return err
+	}
+	labels, err := parseVars(opt.labels)
+	if err != nil {
+		return err
+	}
+	dagIns := &entity.DagInstance{}
+	if err := opt.call(http.MethodPost, "dags/"+url.PathEscape(dagID)+"/run", &api.RunDagInput{
+		Vars:           vars,
+		Labels:         labels,
+		IdempotencyKey: opt.idempotencyKey,
+	}, dagIns); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "dag instance %s created\n", dagIns.ID)
+	if !opt.watch {
+		return nil
+	}
+	return showRunStatus(out, dagIns.ID, &opt.runStatusOption)
+}
+
+func showRunStatus(out io.Writer, dagInsID string, opt *runStatusOption) error {
+	if opt.output != "" && opt.output != "json" {
+		return fmt.Errorf("unsupported output format %q", opt.output)
+	}
+	var last []byte
+	for {
+		sts := &mod.DagInsStatus{}
+		if err := opt.call(http.MethodGet, "dag-instances/"+url.PathEscape(dagInsID)+"/status", nil, sts); err != nil {
+			return err
+		}
+
+		buf := &bytes.Buffer{}
+		if opt.output == "json" {
+			if err := printJSON(buf, sts); err != nil {
+				return err
+			}
+		} else {
+			printRunStatus(buf, sts)
+		}
+		// only the changed status is printed when watching
+		if !bytes.Equal(buf.Bytes(), last) {
+			if last != nil && opt.output == "" {
+				fmt.Fprintln(out)
+			}
+			if _, err := out.Write(buf.Bytes()); err != nil {
+				return err
+			}
+			last = buf.Bytes()
+		}
+
+		if !opt.watch {
+			return nil
+		}
+		switch sts.Status {
+		case entity.DagInstanceStatusSuccess:
+			return nil
+		case entity.DagInstanceStatusFailed:
+			return &exitError{code: 1}
+		}
+		time.Sleep(opt.interval)
+	}
+}
+
+func printRunStatus(out io.Writer, sts *mod.DagInsStatus) {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TASK INSTANCE\tTASK\tSTATUS\tREASON")
+	for _, t := range sts.Tasks {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", t.ID, t.TaskID, t.Status, orDash(t.Reason))
+	}
+	w.Flush()
+
+	fmt.Fprintf(out, "\ndag instance %s %s", sts.DagInsID, sts.Status)
+	if sts.Reason != "" {
+		fmt.Fprintf(out, ": %s", sts.Reason)
+	}
+	fmt.Fprintln(out)
+}
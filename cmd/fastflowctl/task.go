@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/spf13/cobra"
+)
+
+type taskLogsOption struct {
+	apiOption
+	follow   bool
+	interval time.Duration
+}
+
+func newTaskCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "task",
+		Short: "Manage task instances",
+	}
+	cmd.AddCommand(newTaskRetryCmd())
+	cmd.AddCommand(newTaskLogsCmd())
+	return cmd
+}
+
+func newTaskRetryCmd() *cobra.Command {
+	opt := &apiOption{}
+	cmd := &cobra.Command{
+		Use:   "retry TASK_INSTANCE_ID",
+		Short: "Retry the failed or canceled task instance",
+		Example: `  # retry the task and watch the run
+  fastflowctl task retry 5678 && fastflowctl run status 1234 --watch`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return retryTask(cmd.OutOrStdout(), args[0], opt)
+		},
+	}
+	addAPIFlags(cmd, opt)
+	return cmd
+}
+
+func retryTask(out io.Writer, taskInsID string, opt *apiOption) error {
+	dagIns := &entity.DagInstance{}
+	if err := opt.call(http.MethodPost, "task-instances/"+url.PathEscape(taskInsID)+"/retry", nil, dagIns); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "task instance %s of dag instance %s is retrying\n", taskInsID, dagIns.ID)
+	return nil
+}
+
+func newTaskLogsCmd() *cobra.Command {
+	opt := &taskLogsOption{}
+	cmd := &cobra.Command{
+		Use:   "logs TASK_INSTANCE_ID",
+		Short: "Print logs of task instance",
+		Example: `  # stream the logs like "tail -f"
+  fastflowctl task logs 5678 -f`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return printTaskLogs(cmd.OutOrStdout(), args[0], opt)
+		},
+	}
+	addAPIFlags(cmd, &opt.apiOption)
+	cmd.Flags().BoolVarP(&opt.follow, "follow", "f", false, "keep polling the new logs until interrupted")
+	cmd.Flags().DurationVar(&opt.interval, "interval", time.Second, "the interval of polling logs when following")
+	return cmd
+}
+
+func printTaskLogs(out io.Writer, taskInsID string, opt *taskLogsOption) error {
+	var cursor int64
+	for {
+		var logs []*entity.TaskLog
+		if err := opt.call(http.MethodGet, fmt.Sprintf("task-instances/%s/logs?cursor=%d",
+			url.PathEscape(taskInsID), cursor), nil, &logs); err != nil {
+			return err
+		}
+		for _, l := range logs {
+			fmt.Fprintln(out, formatTaskLog(l))
+			cursor = l.Seq
+		}
+		// there may be more logs than a page, so read until no new logs
+		if len(logs) > 0 {
+			continue
+		}
+		if !opt.follow {
+			return nil
+		}
+		time.Sleep(opt.interval)
+	}
+}
+
+func formatTaskLog(l *entity.TaskLog) string {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "%s %-5s %s", time.UnixMilli(l.Time).Format("2006-01-02T15:04:05.000Z07:00"),
+		strings.ToUpper(string(l.Level)), l.Message)
+	keys := make([]string, 0, len(l.Fields))
+	for k := range l.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(b, " %s=%s", k, l.Fields[k])
+	}
+	return b.String()
+}
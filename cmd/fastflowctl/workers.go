@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/spf13/cobra"
+)
+
+type workersOption struct {
+	server  string
+	timeout time.Duration
+	output  string
+}
+
+func newWorkersCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "workers",
+		Short: "Manage workers of cluster",
+	}
+	cmd.AddCommand(newWorkersListCmd())
+	return cmd
+}
+
+func newWorkersListCmd() *cobra.Command {
+	opt := &workersOption{}
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List workers with their runtime info",
+		Example: `  # show cluster health at a glance
+  fastflowctl workers list --server http://127.0.0.1:9090`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return listWorkers(cmd.OutOrStdout(), opt)
+		},
+	}
+	cmd.Flags().StringVar(&opt.server, "server", "http://127.0.0.1:9090", "the address of management api")
+	cmd.Flags().DurationVar(&opt.timeout, "timeout", 10*time.Second, "the timeout of request")
+	cmd.Flags().StringVarP(&opt.output, "output", "o", "", "output format, empty means table, or json")
+	return cmd
+}
+
+func listWorkers(out io.Writer, opt *workersOption) error {
+	client := &http.Client{Timeout: opt.timeout}
+	resp, err := client.Get(strings.TrimSuffix(opt.server, "/") + "/api/v1/workers")
+	if err != nil {
+		return fmt.Errorf("request management api failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("read response failed: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("list workers failed, status: %d, body: %s", resp.StatusCode, body)
+	}
+	var workers []*entity.WorkerInfo
+	if err := json.Unmarshal(body, &workers); err != nil {
+		return fmt.Errorf("decode workers failed: %w", err)
+	}
+
+	switch opt.output {
+	case "json":
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(workers)
+	case "":
+		printWorkers(out, workers, time.Now())
+		return nil
+	default:
+		return fmt.Errorf("unsupported output format %q", opt.output)
+	}
+}
+
+func printWorkers(out io.Writer, workers []*entity.WorkerInfo, now time.Time) {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tALIVE\tVERSION\tUPTIME\tCAPACITY\tRUNNING\tQUEUED\tDAG INSTANCES\tLONGEST TASK\tLABELS")
+	for _, info := range workers {
+		uptime := "-"
+		if info.StartedAt > 0 {
+			uptime = now.Sub(time.Unix(info.StartedAt, 0)).Truncate(time.Second).String()
+		}
+		longest := "-"
+		var maxElapsed int64 = -1
+		for _, t := range info.RunningTasks {
+			if t.ElapsedMs > maxElapsed {
+				maxElapsed = t.ElapsedMs
+				longest = (time.Duration(t.ElapsedMs) * time.Millisecond).Truncate(time.Second).String()
+			}
+		}
+		fmt.Fprintf(w, "%s\t%t\t%s\t%s\t%d\t%d\t%d\t%d\t%s\t%s\n",
+			info.Key, info.Alive, orDash(info.Version), uptime, info.Capacity, len(info.RunningTasks),
+			info.ParserQueueLen+info.ExecutorQueueLen, len(info.OwnedDagInsIDs), longest, formatLabels(info.Labels))
+	}
+	w.Flush()
+}
+
+func formatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return "-"
+	}
+	var kvs []string
+	for k, v := range labels {
+		kvs = append(kvs, k+"="+v)
+	}
+	sort.Strings(kvs)
+	return strings.Join(kvs, ",")
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,58 @@
+package fastflow
+
+import (
+	"fmt"
+	"net/http"
+
+	memoryKeeper "github.com/etherealiy/fastflow/keeper/memory"
+	"github.com/etherealiy/fastflow/pkg/api"
+	"github.com/etherealiy/fastflow/pkg/dashboard"
+	"github.com/etherealiy/fastflow/pkg/exporter"
+	memoryStore "github.com/etherealiy/fastflow/store/memory"
+)
+
+// DevOption
+type DevOption struct {
+	// DagDir is the directory of yaml dags, it will be loaded when start
+	DagDir string
+	// Addr is the listen address of management api and metrics, default ":9090"
+	Addr string
+	// WorkerKey default "standalone-1"
+	WorkerKey string
+}
+
+// StartDev run fastflow in standalone mode, it use memory keeper and store,
+// so you can iterate on your pipelines without any infrastructure.
+// it will block until accept system signal, same as "Start".
+// IMPORTANT: all data will be lost after process exited, DO NOT use it in production.
+func StartDev(opt *DevOption, afterInit ...func() error) error {
+	if opt.Addr == "" {
+		opt.Addr = ":9090"
+	}
+
+	keeper := memoryKeeper.NewKeeper(opt.WorkerKey)
+	if err := keeper.Init(); err != nil {
+		return fmt.Errorf("init keeper failed: %w", err)
+	}
+	st := memoryStore.NewStore()
+	if err := st.Init(); err != nil {
+		return fmt.Errorf("init store failed: %w", err)
+	}
+
+	afterInit = append(afterInit, func() error {
+		return serveDevHttp(opt.Addr)
+	})
+	return Start(&InitialOption{
+		Keeper:         keeper,
+		Store:          st,
+		ReadDagFromDir: opt.DagDir,
+	}, afterInit...)
+}
+
+func serveDevHttp(addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle(api.PathPrefix, api.NewHandler())
+	mux.Handle(dashboard.PathPrefix, dashboard.NewHandler())
+	mux.Handle("/metrics", exporter.HttpHandler())
+	return serveHttp("dev", addr, &http.Server{Handler: mux})
+}
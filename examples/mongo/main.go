@@ -142,7 +142,7 @@ func main() {
 
 	// create a dag as template
 	if err := ensureDagCreated(); err != nil {
-		log.Fatalf(err.Error())
+		log.Fatal(err.Error())
 	}
 	// run dag interval
 	go runInstance()
@@ -84,7 +84,7 @@ func createDagAndInstance() {
 		},
 	}
 	if err := ensureDagCreated(dag); err != nil {
-		log.Fatalf(err.Error())
+		log.Fatal(err.Error())
 	}
 
 	// run some dag instance
@@ -2,26 +2,24 @@ package fastflow
 
 import (
 	"context"
-	"errors"
 	"fmt"
-	"log"
 	"os"
 	"os/signal"
-	"path/filepath"
-	"strings"
 	"sync"
 	"syscall"
 	"time"
 
 	"github.com/etherealiy/fastflow/pkg/actions"
+	"github.com/etherealiy/fastflow/pkg/api"
 	"github.com/etherealiy/fastflow/pkg/entity"
 	"github.com/etherealiy/fastflow/pkg/entity/run"
 	"github.com/etherealiy/fastflow/pkg/event"
+	"github.com/etherealiy/fastflow/pkg/journal"
+	"github.com/etherealiy/fastflow/pkg/log"
 	"github.com/etherealiy/fastflow/pkg/mod"
-	"github.com/etherealiy/fastflow/pkg/utils"
-	"github.com/etherealiy/fastflow/pkg/utils/data"
+	"github.com/etherealiy/fastflow/pkg/render"
 	"github.com/shiningrush/goevent"
-	"gopkg.in/yaml.v3"
+	"google.golang.org/grpc"
 )
 
 var closers []mod.Closer
@@ -33,6 +31,12 @@ func RegisterAction(acts []run.Action) {
 	}
 }
 
+// RegisterTypedAction register a function as action, the params of task are decoded to T and validated
+// when T implements run.ParamsValidator, so the function does not need to assert them
+func RegisterTypedAction[T any](name string, fn func(ctx run.ExecuteContext, params *T) error) {
+	RegisterAction([]run.Action{run.NewTypedAction(name, fn)})
+}
+
 // GetAction
 func GetAction(name string) (run.Action, bool) {
 	act, ok := mod.ActionMap[name]
@@ -46,6 +50,9 @@ type InitialOption struct {
 
 	// ParserWorkersCnt default 100
 	ParserWorkersCnt int
+	// StatusWalkWorkers is the count of goroutines walking the task tree when computing the status of
+	// a dag instance, default 0 walks sequentially, set it such as runtime.NumCPU() for huge dags
+	StatusWalkWorkers int
 	// ExecutorWorkerCnt default 1000
 	ExecutorWorkerCnt int
 	// ExecutorTimeout default 30s
@@ -54,11 +61,101 @@ type InitialOption struct {
 	DagScheduleTimeout time.Duration
 
 	// Read dag define from directory
-	// each file will be pared to a dag, so you CAN'T define all dag in one file
+	// each yaml or json file will be pared to a dag, so you CAN'T define all dag in one file,
+	// the dags are validated and all actions used by them must be registered, see DagLoader
 	ReadDagFromDir string
+	// WatchDagDirInterval is the interval of checking ReadDagFromDir and applying the changed dags,
+	// 0 means only reading it when starting
+	WatchDagDirInterval time.Duration
+
+	// Workspace allocate scratch workspace for each dag instance, nil means disabled
+	Workspace mod.Workspace
+	// WorkspaceCleanupInterval default 10m
+	WorkspaceCleanupInterval time.Duration
+
+	// TaskLogMaxLines default 10000, only the latest logs of each task instance are kept,
+	// negative means not persisting the logs written by actions
+	TaskLogMaxLines int
+	// TaskLogMaxLineBytes default 4096, the longer log is truncated, negative means no limit
+	TaskLogMaxLineBytes int
+
+	// ArtifactRetention is the default retention of task artifacts, 0 means keep forever
+	ArtifactRetention time.Duration
+	// ArtifactCollectInterval default 10m
+	ArtifactCollectInterval time.Duration
+
+	// RebalanceInterval default 10s
+	RebalanceInterval time.Duration
+	// RebalanceMaxMoves is the max count of dag instances moved between workers in each interval, default 10,
+	// negative means disable rebalancing
+	RebalanceMaxMoves int
+	// StallTimeout default 10m, the running dag instances which have executable tasks but no progress for it
+	// are reassigned from their unresponsive workers, negative means disable it
+	StallTimeout time.Duration
+	// OrphanTimeout default 1m, the running tasks whose worker is not alive and which are not updated for it
+	// are recovered by OrphanPolicy and their dag instances continue, negative means disable it
+	OrphanTimeout time.Duration
+	// OrphanPolicy default mod.OrphanPolicyRetry
+	OrphanPolicy mod.OrphanPolicy
+	// RepairEndingTimeout default 30m, the tasks which are ending for it are failed by the repair pass
+	// when worker starts or leader is elected, negative means do not repair them, see mod.Repair
+	RepairEndingTimeout time.Duration
+
+	// CronInterval default 10s, it is the interval of evaluating the cron of dags, negative means disable
+	// cron scheduling. The dags are sharded across workers, which is only supported when the store
+	// implements mod.DagPruneStore
+	CronInterval time.Duration
+	// CronCatchUp default 5m, the fires in it which may be missed are caught up when a worker takes over a dag,
+	// it should be longer than the time of detecting a dead worker
+	CronCatchUp time.Duration
+
+	// ClusterConfigSyncInterval default 10s, it is the interval of observing runtime cluster config,
+	// which is only supported when the store implements mod.ClusterConfigStore
+	ClusterConfigSyncInterval time.Duration
+
+	// WorkerVersion is reported as the version of worker, default is the version of fastflow module
+	WorkerVersion string
+	// WorkerLabels is reported as the labels of worker, it is used to tell workers apart when viewing them,
+	// and to match the selector of tasks when the keeper does not implement mod.LabeledKeeper
+	WorkerLabels map[string]string
+	// WorkerReportInterval default 10s, it is the interval of reporting worker runtime info,
+	// which is only supported when the store implements mod.WorkerInfoStore
+	WorkerReportInterval time.Duration
+
+	// Standby start the cluster as standby, it follows the state of primary cluster read-only and takes over
+	// schedules and in-flight dag instances after promoted, see mod.Promote
+	Standby bool
+	// StandbyJournal is the journal of primary cluster which is replayed to the store of standby cluster,
+	// nil means the store is replicated from primary cluster by itself, such as a mongo secondary
+	StandbyJournal journal.Journal
+	// StandbyFollowInterval default 1s, it is the interval of replaying StandbyJournal
+	StandbyFollowInterval time.Duration
+
+	// SnapshotShareData record share data before and after each task executed, it is used to debug
+	SnapshotShareData bool
+	// ParamRenderMode decide how to render the variables which are not found in task params, default is strict
+	ParamRenderMode render.MissingKeyMode
+	// DrainTimeout is the max time of draining worker before closing when SIGINT or SIGTERM is received,
+	// 0 means closing immediately, see mod.Drain
+	DrainTimeout time.Duration
+	// LifecycleHookTimeout is the max duration of each call of the hooks registered by mod.RegisterLifecycleHooks,
+	// default mod.DefaultLifecycleHookTimeout
+	LifecycleHookTimeout time.Duration
+
+	// APIAddr is the listen address of embedded management api, such as ":9090", empty means not serving it,
+	// see pkg/api
+	APIAddr string
+	// GRPCAddr is the listen address of gRPC control plane, empty means not serving it, see pkg/grpcapi
+	GRPCAddr string
+	// GRPCServerOptions are applied to the gRPC server, such as TLS credentials and interceptors
+	GRPCServerOptions []grpc.ServerOption
+	// APIAuthenticator authenticate the requests of management api and gRPC control plane,
+	// such as checking the token of SSO, nil means no authentication
+	APIAuthenticator api.Authenticator
 }
 
-// Start will block until accept system signal, if you don't want block, plz check "Init"
+// Start will block until accept system signal, if you don't want block, plz check "Init".
+// SIGHUP reloads components instead of closing them, see mod.Reload
 func Start(opt *InitialOption, afterInit ...func() error) error {
 	if err := Init(opt); err != nil {
 		return err
@@ -69,31 +166,92 @@ func Start(opt *InitialOption, afterInit ...func() error) error {
 		}
 	}
 
-	log.Println("fastflow start success")
+	log.Info("fastflow start success")
 	c := make(chan os.Signal)
 	signal.Notify(c, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
-	sig := <-c
-	log.Println(fmt.Sprintf("get sig: %s, ready to close component", sig))
+	waitForExit(opt, c)
 	Close()
-	log.Println("close completed")
+	log.Info("close completed")
 	return nil
 }
 
+// waitForExit block until a signal to exit is received or the worker is drained
+func waitForExit(opt *InitialOption, c <-chan os.Signal) {
+	for {
+		select {
+		case <-mod.Drained():
+			log.Info("worker is drained, ready to close component")
+			return
+		case sig := <-c:
+			// SIGHUP reload the config of components, such as rotated credentials of store and keeper
+			if sig == syscall.SIGHUP {
+				log.Info("get sig: hangup, ready to reload component")
+				if _, err := mod.Reload(); err != nil {
+					log.Errorf("reload component failed: %s", err)
+				}
+				continue
+			}
+			if opt.DrainTimeout > 0 && (sig == syscall.SIGINT || sig == syscall.SIGTERM) {
+				log.Infof("get sig: %s, ready to drain worker", sig)
+				ctx, cancel := context.WithTimeout(context.Background(), opt.DrainTimeout)
+				if err := mod.Drain(ctx); err != nil {
+					log.Errorf("drain worker failed: %s", err)
+				}
+				cancel()
+			}
+			log.Infof("get sig: %s, ready to close component", sig)
+			return
+		}
+	}
+}
+
 // Init will not block, but you need to close fastflow after application closing
 func Init(opt *InitialOption) error {
 	if err := checkOption(opt); err != nil {
 		return err
 	}
 
+	if opt.Standby {
+		mod.SetStandby(true)
+	}
 	initCommonComponent(opt)
 	initLeaderChangedHandler(opt)
 
 	RegisterAction([]run.Action{
 		&actions.Waiting{},
+		&actions.TriggerDagRun{},
+		&actions.Shell{},
+		&actions.HTTP{},
+		&actions.Docker{},
+		&actions.SQL{},
+		&actions.External{},
+		&actions.TimeSensor{},
+		&actions.FileSensor{},
+		&actions.HTTPSensor{},
+		&actions.SQLSensor{},
 	})
 
+	if opt.APIAddr != "" {
+		if err := serveApi(opt); err != nil {
+			return err
+		}
+	}
+	if opt.GRPCAddr != "" {
+		if err := serveGrpc(opt); err != nil {
+			return err
+		}
+	}
+
 	if opt.ReadDagFromDir != "" {
-		return readDagFromDir(opt.ReadDagFromDir)
+		loader := NewDagLoader(opt.ReadDagFromDir)
+		if _, err := loader.Load(); err != nil {
+			return err
+		}
+		if opt.WatchDagDirInterval > 0 {
+			loader.Watch(opt.WatchDagDirInterval)
+			// it applies dags to store, so it must be closed before store
+			closers = append([]mod.Closer{loader}, closers...)
+		}
 	}
 	return nil
 }
@@ -103,7 +261,7 @@ func initLeaderChangedHandler(opt *InitialOption) {
 		opt: opt,
 	}
 	if err := goevent.Subscribe(h); err != nil {
-		log.Fatalln(err)
+		log.Fatalf("subscribe leader changed event failed: %s", err)
 	}
 	closers = append(closers, h)
 
@@ -134,27 +292,56 @@ type LeaderChangedHandler struct {
 
 // Topic
 func (l *LeaderChangedHandler) Topic() []string {
-	return []string{event.KeyLeaderChanged}
+	return []string{event.KeyLeaderChanged, event.KeyStandbyChanged}
 }
 
 // Handle
 func (l *LeaderChangedHandler) Handle(cxt context.Context, e goevent.Event) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	// leader components are not started in standby mode, the leader starts them when promoted
+	if sbEvent, ok := e.(*event.StandbyChanged); ok {
+		if !sbEvent.Standby && l.opt.Keeper.IsLeader() && len(l.leaderCloser) == 0 {
+			l.initLeader()
+		}
+		return
+	}
+
 	lcEvent := e.(*event.LeaderChanged)
 	// changed to leader
-	if lcEvent.IsLeader && len(l.leaderCloser) == 0 {
-		wg := mod.NewDefWatchDog(l.opt.DagScheduleTimeout)
-		wg.Init()
-		l.leaderCloser = append(l.leaderCloser, wg)
-
-		dis := mod.NewDefDispatcher()
-		dis.Init()
-		l.leaderCloser = append(l.leaderCloser, dis)
-		log.Println("leader initial")
-	}
-	// continue leader failed
-	if !lcEvent.IsLeader && len(l.leaderCloser) == 0 {
+	if lcEvent.IsLeader && len(l.leaderCloser) == 0 && !mod.IsStandby() {
+		l.initLeader()
+		mod.CallLeaderChangeHooks(true)
+	}
+	// continue leader failed or released by draining
+	if !lcEvent.IsLeader && len(l.leaderCloser) > 0 {
 		l.Close()
+		mod.CallLeaderChangeHooks(false)
+	}
+}
+
+func (l *LeaderChangedHandler) initLeader() {
+	if _, err := mod.Repair(&mod.RepairOption{EndingTimeout: l.opt.RepairEndingTimeout}); err != nil {
+		log.Errorf("repair dag instances of cluster failed: %s", err)
 	}
+
+	wg := mod.NewDefWatchDog(l.opt.DagScheduleTimeout, l.opt.OrphanTimeout, l.opt.OrphanPolicy)
+	wg.Init()
+	l.leaderCloser = append(l.leaderCloser, wg)
+
+	dis := mod.NewDefDispatcher()
+	dis.Init()
+	l.leaderCloser = append(l.leaderCloser, dis)
+
+	ac := mod.NewDefArtifactCollector(l.opt.ArtifactRetention, l.opt.ArtifactCollectInterval)
+	ac.Init()
+	l.leaderCloser = append(l.leaderCloser, ac)
+
+	rb := mod.NewDefRebalancer(l.opt.RebalanceInterval, l.opt.RebalanceMaxMoves, l.opt.StallTimeout)
+	rb.Init()
+	l.leaderCloser = append(l.leaderCloser, rb)
+	log.Info("leader initial")
 }
 
 // Close leader component
@@ -193,6 +380,42 @@ func checkOption(opt *InitialOption) error {
 	if opt.ParserWorkersCnt == 0 {
 		opt.ParserWorkersCnt = 100
 	}
+	if opt.WorkspaceCleanupInterval == 0 {
+		opt.WorkspaceCleanupInterval = 10 * time.Minute
+	}
+	if opt.ArtifactCollectInterval == 0 {
+		opt.ArtifactCollectInterval = 10 * time.Minute
+	}
+	if opt.RebalanceInterval == 0 {
+		opt.RebalanceInterval = 10 * time.Second
+	}
+	if opt.RebalanceMaxMoves == 0 {
+		opt.RebalanceMaxMoves = 10
+	}
+	if opt.StallTimeout == 0 {
+		opt.StallTimeout = 10 * time.Minute
+	}
+	if opt.OrphanTimeout == 0 {
+		opt.OrphanTimeout = time.Minute
+	}
+	if opt.CronInterval == 0 {
+		opt.CronInterval = 10 * time.Second
+	}
+	if opt.CronCatchUp == 0 {
+		opt.CronCatchUp = 5 * time.Minute
+	}
+	if opt.ClusterConfigSyncInterval == 0 {
+		opt.ClusterConfigSyncInterval = 10 * time.Second
+	}
+	if opt.WorkerReportInterval == 0 {
+		opt.WorkerReportInterval = 10 * time.Second
+	}
+	if opt.RepairEndingTimeout == 0 {
+		opt.RepairEndingTimeout = 30 * time.Minute
+	}
+	if opt.StandbyFollowInterval == 0 {
+		opt.StandbyFollowInterval = time.Second
+	}
 	return nil
 }
 
@@ -204,62 +427,78 @@ func initCommonComponent(opt *InitialOption) {
 
 	// Executor must init before parse otherwise will cause a error
 	exe := mod.NewDefExecutor(opt.ExecutorTimeout, opt.ExecutorWorkerCnt)
+	if opt.SnapshotShareData {
+		exe.EnableShareDataSnapshot()
+	}
+	if opt.ParamRenderMode != "" {
+		exe.SetParamRenderMode(opt.ParamRenderMode)
+	}
+	exe.SetTaskLogLimits(opt.TaskLogMaxLines, opt.TaskLogMaxLineBytes)
 	mod.SetExecutor(exe)
+	mod.SetStatusWalkWorkers(opt.StatusWalkWorkers)
+	mod.SetLifecycleHookTimeout(opt.LifecycleHookTimeout)
 	p := mod.NewDefParser(opt.ParserWorkersCnt, opt.ExecutorTimeout)
 	mod.SetParser(p)
 
+	// repair the states left by previous process before parser loads the running dag instances
+	if !mod.IsStandby() {
+		if _, err := mod.Repair(&mod.RepairOption{
+			Worker:        opt.Keeper.WorkerKey(),
+			EndingTimeout: opt.RepairEndingTimeout,
+		}); err != nil {
+			log.Errorf("repair dag instances of worker failed: %s", err)
+		}
+	}
+
 	exe.Init()
 	closers = append(closers, exe)
 	p.Init()
 	closers = append(closers, p)
 
+	if _, ok := mod.StoreAs[mod.ClusterConfigStore](opt.Store); ok {
+		watcher := mod.NewDefClusterConfigWatcher(opt.ClusterConfigSyncInterval)
+		watcher.Init()
+		closers = append(closers, watcher)
+	}
+	if _, ok := mod.StoreAs[mod.WorkerInfoStore](opt.Store); ok {
+		reporter := mod.NewDefWorkerReporter(opt.WorkerReportInterval, opt.WorkerVersion, opt.WorkerLabels)
+		reporter.Init()
+		closers = append(closers, reporter)
+	}
+	if _, ok := mod.StoreAs[mod.DagPruneStore](opt.Store); ok && opt.CronInterval > 0 {
+		cs := mod.NewDefCronScheduler(opt.CronInterval, opt.CronCatchUp)
+		cs.Init()
+		closers = append(closers, cs)
+	}
+	if opt.Standby && opt.StandbyJournal != nil {
+		follower := journal.NewFollower(opt.StandbyJournal, opt.Store, opt.StandbyFollowInterval)
+		follower.Init()
+		closers = append(closers, follower)
+	}
+
+	// rate limits are shared by all workers only when the store supports it
+	rs, ok := mod.StoreAs[mod.RateLimitStore](opt.Store)
+	if !ok {
+		log.Warn("store does not support rate limit, the rate limits of tasks only apply to each worker")
+	}
+	mod.SetRateLimiter(mod.NewDefRateLimiter(rs))
+
 	comm := &mod.DefCommander{}
 	mod.SetCommander(comm)
 
+	mod.SetWorkspace(opt.Workspace)
+	if opt.Workspace != nil {
+		cleaner := mod.NewDefWorkspaceCleaner(opt.WorkspaceCleanupInterval)
+		cleaner.Init()
+		closers = append(closers, cleaner)
+	}
+
 	// keeper and store must close latest
 	closers = append(closers, opt.Store)
 	closers = append(closers, opt.Keeper)
 }
 
 func readDagFromDir(dir string) error {
-	paths, err := utils.DefaultReader.ReadPathsFromDir(dir)
-	if err != nil {
-		return err
-	}
-
-	for _, path := range paths {
-		bs, err := utils.DefaultReader.ReadDag(path)
-		if err != nil {
-			return fmt.Errorf("read %s failed: %w", path, err)
-		}
-
-		dag := entity.Dag{
-			Status: entity.DagStatusNormal,
-		}
-		err = yaml.Unmarshal(bs, &dag)
-		if err != nil {
-			return fmt.Errorf("unmarshal %s failed: %w", path, err)
-		}
-
-		if dag.ID == "" {
-			dag.ID = strings.TrimSuffix(strings.TrimSuffix(filepath.Base(path), ".yaml"), ".yml")
-		}
-
-		if err := ensureDagLatest(&dag); err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
-func ensureDagLatest(dag *entity.Dag) error {
-	oDag, err := mod.GetStore().GetDag(dag.ID)
-	if err != nil && !errors.Is(err, data.ErrDataNotFound) {
-		return err
-	}
-	if oDag != nil {
-		return mod.GetStore().UpdateDag(dag)
-	}
-
-	return mod.GetStore().CreateDag(dag)
+	_, err := NewDagLoader(dir).Load()
+	return err
 }
@@ -0,0 +1,51 @@
+package fastflow
+
+import (
+	"testing"
+
+	"github.com/etherealiy/fastflow/pkg/mod"
+)
+
+func FuzzParseDag(f *testing.F) {
+	f.Add([]byte(`
+id: "test-dag"
+name: "test"
+vars:
+  fileName:
+    defaultValue: "test.txt"
+tasks:
+- id: "task1"
+  actionName: "PrintAction"
+- id: "task2"
+  actionName: "PrintAction"
+  dependOn: ["task1"]
+  preCheck:
+    skip:
+      act: "skip"
+      conditions:
+      - source: "vars"
+        key: "fileName"
+        op: "in"
+        values: ["test.txt"]
+`))
+	f.Add([]byte(`tasks: [{id: "task1", dependOn: ["task1"]}]`))
+	f.Add([]byte(`tasks: [{id: "task1"}, {id: "task1"}]`))
+	f.Add([]byte(`tasks: [{id: "task1", dependOn: "task2"}]`))
+	f.Add([]byte(`tasks: [{id: "task1", dependOn: [["task2"]]}]`))
+	f.Add([]byte(`tasks: [{dependOn: [""]}, {id: ""}]`))
+	f.Add([]byte(`tasks: null`))
+
+	f.Fuzz(func(t *testing.T, bs []byte) {
+		dag, err := parseDag(bs)
+		if err != nil {
+			return
+		}
+		root, err := mod.BuildRootNode(mod.MapTasksToGetter(dag.Tasks))
+		if err != nil {
+			return
+		}
+		if len(dag.Tasks) == 0 || root == nil {
+			t.Fatalf("valid dag should have tasks")
+		}
+	})
+}
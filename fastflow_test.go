@@ -6,8 +6,10 @@ import (
 	"time"
 
 	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/entity/run"
 	"github.com/etherealiy/fastflow/pkg/mod"
 	"github.com/etherealiy/fastflow/pkg/utils"
+	"github.com/etherealiy/fastflow/pkg/utils/data"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"gopkg.in/yaml.v3"
@@ -31,6 +33,20 @@ func Test_checkOption(t *testing.T) {
 				ExecutorWorkerCnt:  1000,
 				ExecutorTimeout:    time.Second * 30,
 				DagScheduleTimeout: time.Second * 15,
+
+				WorkspaceCleanupInterval: time.Minute * 10,
+				ArtifactCollectInterval:  time.Minute * 10,
+				RebalanceInterval:        time.Second * 10,
+				RebalanceMaxMoves:        10,
+				StallTimeout:             time.Minute * 10,
+				OrphanTimeout:            time.Minute,
+				RepairEndingTimeout:      time.Minute * 30,
+				CronInterval:             time.Second * 10,
+				CronCatchUp:              time.Minute * 5,
+
+				ClusterConfigSyncInterval: time.Second * 10,
+				WorkerReportInterval:      time.Second * 10,
+				StandbyFollowInterval:     time.Second,
 			},
 		},
 		{
@@ -78,8 +94,8 @@ func Test_readDagFromDir(t *testing.T) {
 			givePathDagMap: map[string][]byte{
 				"dag1": {},
 			},
-			wantErr:       fmt.Errorf("read dag2 failed: %w", fmt.Errorf("not found")),
-			calledEnsured: []bool{true},
+			// dags are applied after all of them are read, so nothing should be written
+			wantErr: fmt.Errorf("read dag2 failed: %w", fmt.Errorf("not found")),
 		},
 		{
 			caseDesc:  "unmarshal dag failed",
@@ -89,6 +105,39 @@ func Test_readDagFromDir(t *testing.T) {
 			},
 			wantErr: fmt.Errorf("unmarshal dag1 failed: %w", &yaml.TypeError{Errors: []string{"line 1: cannot unmarshal !!int `123` into []entity.Task"}}),
 		},
+		{
+			caseDesc:  "unknown field",
+			givePaths: []string{"dag1"},
+			givePathDagMap: map[string][]byte{
+				"dag1": []byte(`tasks: [{id: task-1, actionName: action, dependsOn: [task-2]}]`),
+			},
+			wantErr: fmt.Errorf("unmarshal dag1 failed: %w", &yaml.TypeError{Errors: []string{"line 1: field dependsOn not found in type entity.Task"}}),
+		},
+		{
+			caseDesc:  "undefined action",
+			givePaths: []string{"dag1"},
+			givePathDagMap: map[string][]byte{
+				"dag1": []byte(`tasks: [{id: task-1, actionName: undefined}]`),
+			},
+			wantErr: fmt.Errorf("dags are invalid, dag[dag1] undefinedAction: action[undefined] of task[task-1] is not registered: %w",
+				data.ErrDataInvalid),
+		},
+		{
+			caseDesc:  "json",
+			givePaths: []string{"/test/dag.json"},
+			givePathDagMap: map[string][]byte{
+				"/test/dag.json": []byte(`{"name": "dag-name", "tasks": [{"id": "task-1", "actionName": "action"}]}`),
+			},
+			calledEnsured: []bool{true},
+			wantDag: &entity.Dag{
+				BaseInfo: entity.BaseInfo{
+					ID: "dag",
+				},
+				Name:   "dag-name",
+				Status: entity.DagStatusNormal,
+				Tasks:  []entity.Task{{ID: "task-1", ActionName: "action"}},
+			},
+		},
 		{
 			caseDesc:  "normal",
 			givePaths: []string{"dag1"},
@@ -128,7 +177,7 @@ tasks:
 			caseDesc:  "no id",
 			givePaths: []string{"/test/filename.yaml"},
 			givePathDagMap: map[string][]byte{
-				"/test/filename.yaml": []byte(``),
+				"/test/filename.yaml": []byte(`tasks: [{id: task-1, actionName: action}]`),
 			},
 			calledEnsured: []bool{true},
 			wantDag: &entity.Dag{
@@ -136,13 +185,41 @@ tasks:
 					ID: "filename",
 				},
 				Status: entity.DagStatusNormal,
+				Tasks:  []entity.Task{{ID: "task-1", ActionName: "action"}},
+			},
+		},
+		{
+			caseDesc:  "matrix",
+			givePaths: []string{"/test/matrix.yaml"},
+			givePathDagMap: map[string][]byte{
+				"/test/matrix.yaml": []byte(`
+tasks:
+  - id: "sync"
+    actionName: "action"
+    matrix: {region: [us, eu], shard: [0..1]}
+    join: {actionName: "merge"}
+`),
+			},
+			calledEnsured: []bool{true},
+			wantDag: &entity.Dag{
+				BaseInfo: entity.BaseInfo{
+					ID: "matrix",
+				},
+				Status: entity.DagStatusNormal,
+				Tasks: []entity.Task{
+					{ID: "sync-us-0", ActionName: "action"},
+					{ID: "sync-us-1", ActionName: "action"},
+					{ID: "sync-eu-0", ActionName: "action"},
+					{ID: "sync-eu-1", ActionName: "action"},
+					{ID: "sync-join", ActionName: "merge", DependOn: []string{"sync-us-0", "sync-us-1", "sync-eu-0", "sync-eu-1"}},
+				},
 			},
 		},
 		{
 			caseDesc:  "no id(yml)",
 			givePaths: []string{"c:/test/dag2.yaml"},
 			givePathDagMap: map[string][]byte{
-				"c:/test/dag2.yaml": []byte(``),
+				"c:/test/dag2.yaml": []byte(`tasks: [{id: task-1, actionName: action}]`),
 			},
 			calledEnsured: []bool{true},
 			wantDag: &entity.Dag{
@@ -150,10 +227,17 @@ tasks:
 					ID: "dag2",
 				},
 				Status: entity.DagStatusNormal,
+				Tasks:  []entity.Task{{ID: "task-1", ActionName: "action"}},
 			},
 		},
 	}
 
+	// the dags are validated, so their actions must be registered
+	oldActionMap := mod.ActionMap
+	act := &run.MockAction{}
+	act.On("ParameterNew").Return(nil)
+	mod.ActionMap = map[string]run.Action{"action": act, "merge": act}
+	defer func() { mod.ActionMap = oldActionMap }()
 	for _, tc := range tests {
 		t.Run(tc.caseDesc, func(t *testing.T) {
 			mReader := &utils.MockDagReader{}
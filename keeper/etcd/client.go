@@ -0,0 +1,255 @@
+package etcd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// client is a minimal client of the json gateway of etcd v3, which avoids introducing the grpc dependencies
+type client struct {
+	endpoints []string
+	http      *http.Client
+	username  string
+	password  string
+
+	// cur is the index of endpoint used currently, it moves to next one when request failed
+	cur   uint32
+	token atomic.Value
+}
+
+// int64Str is the int64 encoded as string by json gateway
+type int64Str int64
+
+// MarshalJSON
+func (i int64Str) MarshalJSON() ([]byte, error) {
+	return json.Marshal(strconv.FormatInt(int64(i), 10))
+}
+
+// UnmarshalJSON
+func (i *int64Str) UnmarshalJSON(bs []byte) error {
+	s := strings.Trim(string(bs), `"`)
+	if s == "" || s == "null" {
+		*i = 0
+		return nil
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return err
+	}
+	*i = int64Str(v)
+	return nil
+}
+
+type keyValue struct {
+	Key            []byte   `json:"key"`
+	Value          []byte   `json:"value"`
+	CreateRevision int64Str `json:"create_revision,omitempty"`
+	Lease          int64Str `json:"lease,omitempty"`
+}
+
+type rangeRequest struct {
+	Key      []byte `json:"key"`
+	RangeEnd []byte `json:"range_end,omitempty"`
+}
+
+type rangeResponse struct {
+	Kvs []keyValue `json:"kvs"`
+}
+
+type putRequest struct {
+	Key   []byte   `json:"key"`
+	Value []byte   `json:"value"`
+	Lease int64Str `json:"lease,omitempty"`
+}
+
+type deleteRequest struct {
+	Key []byte `json:"key"`
+}
+
+type compare struct {
+	Key            []byte    `json:"key"`
+	Target         string    `json:"target"`
+	Result         string    `json:"result"`
+	CreateRevision *int64Str `json:"create_revision,omitempty"`
+	Value          []byte    `json:"value,omitempty"`
+}
+
+type requestOp struct {
+	RequestRange  *rangeRequest  `json:"request_range,omitempty"`
+	RequestPut    *putRequest    `json:"request_put,omitempty"`
+	RequestDelete *deleteRequest `json:"request_delete_range,omitempty"`
+}
+
+type txnRequest struct {
+	Compare []compare   `json:"compare"`
+	Success []requestOp `json:"success"`
+	Failure []requestOp `json:"failure"`
+}
+
+type txnResponse struct {
+	Succeeded bool `json:"succeeded"`
+	Responses []struct {
+		ResponseRange *rangeResponse `json:"response_range"`
+	} `json:"responses"`
+}
+
+type leaseResponse struct {
+	ID  int64Str `json:"ID"`
+	TTL int64Str `json:"TTL"`
+}
+
+// notExisted compare if the key is not created
+func notExisted(key string) compare {
+	zero := int64Str(0)
+	return compare{Key: []byte(key), Target: "CREATE", Result: "EQUAL", CreateRevision: &zero}
+}
+
+// valueEqual compare if the value of key is equal to val
+func valueEqual(key, val string) compare {
+	return compare{Key: []byte(key), Target: "VALUE", Result: "EQUAL", Value: []byte(val)}
+}
+
+// prefixEnd return the range end to get all keys with the prefix
+func prefixEnd(prefix string) []byte {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	// all bytes are 0xff, means all keys
+	return []byte{0}
+}
+
+func (c *client) grant(ttlSecs int64) (int64, error) {
+	resp := leaseResponse{}
+	if err := c.call("/v3/lease/grant", map[string]interface{}{"TTL": int64Str(ttlSecs)}, &resp); err != nil {
+		return 0, err
+	}
+	return int64(resp.ID), nil
+}
+
+// keepAlive renew lease once, it returns false when the lease is expired
+func (c *client) keepAlive(lease int64) (bool, error) {
+	resp := struct {
+		Result leaseResponse `json:"result"`
+	}{}
+	if err := c.call("/v3/lease/keepalive", map[string]interface{}{"ID": int64Str(lease)}, &resp); err != nil {
+		return false, err
+	}
+	return resp.Result.TTL > 0, nil
+}
+
+func (c *client) revoke(lease int64) error {
+	return c.call("/v3/lease/revoke", map[string]interface{}{"ID": int64Str(lease)}, nil)
+}
+
+func (c *client) put(key, val string, lease int64) error {
+	return c.call("/v3/kv/put", &putRequest{Key: []byte(key), Value: []byte(val), Lease: int64Str(lease)}, nil)
+}
+
+func (c *client) get(key string) (*keyValue, error) {
+	resp := rangeResponse{}
+	if err := c.call("/v3/kv/range", &rangeRequest{Key: []byte(key)}, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, nil
+	}
+	return &resp.Kvs[0], nil
+}
+
+func (c *client) list(prefix string) ([]keyValue, error) {
+	resp := rangeResponse{}
+	if err := c.call("/v3/kv/range", &rangeRequest{Key: []byte(prefix), RangeEnd: prefixEnd(prefix)}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Kvs, nil
+}
+
+func (c *client) txn(req *txnRequest) (*txnResponse, error) {
+	resp := txnResponse{}
+	if err := c.call("/v3/kv/txn", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *client) authenticate(endpoint string) error {
+	if c.username == "" {
+		return nil
+	}
+	resp := struct {
+		Token string `json:"token"`
+	}{}
+	err := c.do(endpoint, "/v3/auth/authenticate",
+		map[string]string{"name": c.username, "password": c.password}, &resp)
+	if err != nil {
+		return fmt.Errorf("authenticate failed: %w", err)
+	}
+	c.token.Store(resp.Token)
+	return nil
+}
+
+// call request the endpoints in turn until one of them succeeds
+func (c *client) call(path string, req, resp interface{}) (err error) {
+	for i := 0; i < len(c.endpoints); i++ {
+		idx := atomic.LoadUint32(&c.cur) % uint32(len(c.endpoints))
+		endpoint := c.endpoints[idx]
+		err = c.do(endpoint, path, req, resp)
+		if err == errUnauthenticated {
+			// the token may be expired
+			if err = c.authenticate(endpoint); err == nil {
+				err = c.do(endpoint, path, req, resp)
+			}
+		}
+		if err == nil {
+			return nil
+		}
+		atomic.CompareAndSwapUint32(&c.cur, idx, idx+1)
+	}
+	return err
+}
+
+var errUnauthenticated = fmt.Errorf("unauthenticated")
+
+func (c *client) do(endpoint, path string, req, resp interface{}) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	httpReq, err := http.NewRequest(http.MethodPost, strings.TrimRight(endpoint, "/")+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if token, ok := c.token.Load().(string); ok && token != "" {
+		httpReq.Header.Set("Authorization", token)
+	}
+	httpResp, err := c.http.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer httpResp.Body.Close()
+	bs, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return err
+	}
+	if httpResp.StatusCode == http.StatusUnauthorized && c.username != "" && path != "/v3/auth/authenticate" {
+		return errUnauthenticated
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		return fmt.Errorf("request %s failed: status code %d, body: %s", path, httpResp.StatusCode, bs)
+	}
+	if resp == nil {
+		return nil
+	}
+	return json.Unmarshal(bs, resp)
+}
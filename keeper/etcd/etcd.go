@@ -0,0 +1,441 @@
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/etherealiy/fastflow/keeper"
+	"github.com/etherealiy/fastflow/pkg/event"
+	"github.com/etherealiy/fastflow/pkg/log"
+	"github.com/etherealiy/fastflow/pkg/mod"
+	"github.com/etherealiy/fastflow/pkg/utils/data"
+	"github.com/etherealiy/fastflow/store"
+	"github.com/shiningrush/goevent"
+)
+
+const (
+	LeaderKey       = "leader"
+	HeartbeatPrefix = "heartbeat/"
+	DrainingPrefix  = "draining/"
+	MutexPrefix     = "mutex/"
+)
+
+var (
+	_ mod.Keeper          = (*Keeper)(nil)
+	_ mod.LabeledKeeper   = (*Keeper)(nil)
+	_ mod.DrainableKeeper = (*Keeper)(nil)
+)
+
+// Keeper implement leader election and worker liveness by etcd, the heartbeat and leader keys
+// are attached to the lease of worker, so they are deleted by etcd once the worker is unhealthy.
+// It talks to the json gateway of etcd v3, which is enabled by default since etcd 3.4.
+type Keeper struct {
+	opt       *KeeperOption
+	cli       *client
+	keyNumber int
+
+	lease      int64
+	leaderFlag atomic.Value
+	mutexSeq   uint64
+	// electLock make sure the leader key is not put again after draining
+	electLock sync.Mutex
+	draining  bool
+
+	wg      sync.WaitGroup
+	closeCh chan struct{}
+}
+
+// KeeperOption
+type KeeperOption struct {
+	// Key the work key, must be the format like "xxxx-{{number}}", number is the code of worker
+	Key string
+	// Endpoints of etcd cluster, such as "http://127.0.0.1:2379"
+	Endpoints []string
+	// Username and Password are used when the authentication of etcd is enabled
+	Username string
+	Password string
+	// Labels is registered as the value of heartbeat key, they are matched by the selector of tasks
+	Labels map[string]string
+	// Prefix of all keys, default is "/fastflow/"
+	Prefix string
+	// UnhealthyTime default 5s, it is rounded up to seconds as the ttl of lease, campaign and heartbeat time will be half of it
+	UnhealthyTime time.Duration
+	// Timeout of each request, default 2s
+	Timeout time.Duration
+	// Client is used to request etcd, such as the one configured with tls
+	Client *http.Client
+}
+
+// NewKeeper
+func NewKeeper(opt *KeeperOption) *Keeper {
+	k := &Keeper{
+		opt:     opt,
+		closeCh: make(chan struct{}),
+	}
+	k.leaderFlag.Store(false)
+	return k
+}
+
+// Init
+func (k *Keeper) Init() error {
+	if k.opt.Key == "" || len(k.opt.Endpoints) == 0 {
+		return fmt.Errorf("worker key or endpoints can not be empty")
+	}
+	number, err := keeper.CheckWorkerKey(k.opt.Key)
+	if err != nil {
+		return err
+	}
+	k.keyNumber = number
+	if k.opt.Prefix == "" {
+		k.opt.Prefix = "/fastflow/"
+	}
+	if k.opt.UnhealthyTime == 0 {
+		k.opt.UnhealthyTime = time.Second * 5
+	}
+	if k.opt.Timeout == 0 {
+		k.opt.Timeout = time.Second * 2
+	}
+	httpCli := k.opt.Client
+	if httpCli == nil {
+		httpCli = &http.Client{Timeout: k.opt.Timeout}
+	}
+	k.cli = &client{
+		endpoints: k.opt.Endpoints,
+		http:      httpCli,
+		username:  k.opt.Username,
+		password:  k.opt.Password,
+	}
+	store.InitFlakeGenerator()
+
+	if err := k.heartBeat(); err != nil {
+		return err
+	}
+	k.campaign()
+
+	k.wg.Add(1)
+	go k.goLoop()
+	return nil
+}
+
+func (k *Keeper) goLoop() {
+	defer k.wg.Done()
+	ticker := time.NewTicker(k.opt.UnhealthyTime / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-k.closeCh:
+			return
+		case <-ticker.C:
+			if err := k.heartBeat(); err != nil {
+				log.Errorf("heart beat failed: %s", err)
+			}
+			k.campaign()
+		}
+	}
+}
+
+func (k *Keeper) key(key string) string {
+	return k.opt.Prefix + key
+}
+
+func ttlSecs(d time.Duration) int64 {
+	return int64(math.Ceil(d.Seconds()))
+}
+
+// heartBeat keep the lease of worker alive, a new lease is granted when the old one is expired
+func (k *Keeper) heartBeat() error {
+	if lease := atomic.LoadInt64(&k.lease); lease != 0 {
+		ok, err := k.cli.keepAlive(lease)
+		if err != nil {
+			return fmt.Errorf("keep lease alive failed: %w", err)
+		}
+		if ok {
+			return nil
+		}
+		log.Warnf("lease of worker[%s] is expired, grant a new one", k.opt.Key)
+	}
+
+	lease, err := k.cli.grant(ttlSecs(k.opt.UnhealthyTime))
+	if err != nil {
+		return fmt.Errorf("grant lease failed: %w", err)
+	}
+	labels, err := json.Marshal(k.opt.Labels)
+	if err != nil {
+		return fmt.Errorf("encode labels failed: %w", err)
+	}
+	if err := k.cli.put(k.key(HeartbeatPrefix+k.opt.Key), string(labels), lease); err != nil {
+		return fmt.Errorf("put heartbeat failed: %w", err)
+	}
+	k.electLock.Lock()
+	draining := k.draining
+	k.electLock.Unlock()
+	if draining {
+		if err := k.cli.put(k.key(DrainingPrefix+k.opt.Key), k.opt.Key, lease); err != nil {
+			return fmt.Errorf("put draining failed: %w", err)
+		}
+	}
+	atomic.StoreInt64(&k.lease, lease)
+	return nil
+}
+
+// campaign put the leader key with the lease of worker if it does not exist,
+// otherwise check if the current leader is this worker
+func (k *Keeper) campaign() {
+	k.electLock.Lock()
+	defer k.electLock.Unlock()
+	if k.draining {
+		return
+	}
+	isLeader, err := k.tryLeader()
+	if err != nil {
+		// the lease may expire before next renewal, so leader should step down
+		log.Errorf("campaign leader failed: %s", err)
+		isLeader = false
+	}
+	if isLeader != k.IsLeader() {
+		k.setLeaderFlag(isLeader)
+	}
+}
+
+func (k *Keeper) tryLeader() (bool, error) {
+	lease := atomic.LoadInt64(&k.lease)
+	if lease == 0 {
+		return false, fmt.Errorf("worker has no lease")
+	}
+	key := k.key(LeaderKey)
+	resp, err := k.cli.txn(&txnRequest{
+		Compare: []compare{notExisted(key)},
+		Success: []requestOp{{RequestPut: &putRequest{Key: []byte(key), Value: []byte(k.opt.Key), Lease: int64Str(lease)}}},
+		Failure: []requestOp{{RequestRange: &rangeRequest{Key: []byte(key)}}},
+	})
+	if err != nil {
+		return false, err
+	}
+	if resp.Succeeded {
+		return true, nil
+	}
+	for _, r := range resp.Responses {
+		if r.ResponseRange == nil {
+			continue
+		}
+		for _, kv := range r.ResponseRange.Kvs {
+			// the leader key must be attached to current lease, otherwise it will not be deleted when worker is unhealthy
+			return string(kv.Value) == k.opt.Key && int64(kv.Lease) == lease, nil
+		}
+	}
+	return false, nil
+}
+
+func (k *Keeper) setLeaderFlag(isLeader bool) {
+	k.leaderFlag.Store(isLeader)
+	goevent.Publish(&event.LeaderChanged{
+		IsLeader:  isLeader,
+		WorkerKey: k.WorkerKey(),
+	})
+}
+
+// IsLeader indicate the component if is leader node
+func (k *Keeper) IsLeader() bool {
+	return k.leaderFlag.Load().(bool)
+}
+
+// Drain mark the worker as draining and delete the leader key if it is held by current worker
+func (k *Keeper) Drain() error {
+	k.electLock.Lock()
+	defer k.electLock.Unlock()
+	if k.draining {
+		return nil
+	}
+	lease := atomic.LoadInt64(&k.lease)
+	if err := k.cli.put(k.key(DrainingPrefix+k.opt.Key), k.opt.Key, lease); err != nil {
+		return fmt.Errorf("put draining failed: %w", err)
+	}
+	k.draining = true
+	if k.IsLeader() {
+		key := k.key(LeaderKey)
+		_, err := k.cli.txn(&txnRequest{
+			Compare: []compare{valueEqual(key, k.opt.Key)},
+			Success: []requestOp{{RequestDelete: &deleteRequest{Key: []byte(key)}}},
+		})
+		if err != nil {
+			log.Errorf("delete leader key failed: %s", err)
+		}
+		k.setLeaderFlag(false)
+	}
+	return nil
+}
+
+// DrainingNodes get the alive nodes which are draining
+func (k *Keeper) DrainingNodes() ([]string, error) {
+	prefix := k.key(DrainingPrefix)
+	kvs, err := k.cli.list(prefix)
+	if err != nil {
+		return nil, err
+	}
+	var nodes []string
+	for _, kv := range kvs {
+		nodes = append(nodes, strings.TrimPrefix(string(kv.Key), prefix))
+	}
+	return nodes, nil
+}
+
+// IsAlive check if a worker still alive
+func (k *Keeper) IsAlive(workerKey string) (bool, error) {
+	kv, err := k.cli.get(k.key(HeartbeatPrefix + workerKey))
+	if err != nil {
+		return false, err
+	}
+	return kv != nil, nil
+}
+
+// AliveNodes get all alive nodes
+func (k *Keeper) AliveNodes() ([]string, error) {
+	prefix := k.key(HeartbeatPrefix)
+	kvs, err := k.cli.list(prefix)
+	if err != nil {
+		return nil, err
+	}
+	var nodes []string
+	for _, kv := range kvs {
+		nodes = append(nodes, strings.TrimPrefix(string(kv.Key), prefix))
+	}
+	return nodes, nil
+}
+
+// AliveNodeLabels get the labels of all alive nodes
+func (k *Keeper) AliveNodeLabels() (map[string]map[string]string, error) {
+	prefix := k.key(HeartbeatPrefix)
+	kvs, err := k.cli.list(prefix)
+	if err != nil {
+		return nil, err
+	}
+	ret := map[string]map[string]string{}
+	for _, kv := range kvs {
+		var labels map[string]string
+		if err := json.Unmarshal(kv.Value, &labels); err != nil {
+			log.Warnf("decode labels of worker[%s] failed: %s", kv.Key, err)
+		}
+		ret[strings.TrimPrefix(string(kv.Key), prefix)] = labels
+	}
+	return ret, nil
+}
+
+// WorkerKey
+func (k *Keeper) WorkerKey() string {
+	return k.opt.Key
+}
+
+// WorkerNumber get the the key number of Worker key, if here is a WorkKey like `worker-1`, then it will return "1"
+func (k *Keeper) WorkerNumber() int {
+	return k.keyNumber
+}
+
+// NewMutex create a new distributed mutex
+func (k *Keeper) NewMutex(key string) mod.DistributedMutex {
+	return &Mutex{
+		key:    k.key(MutexPrefix + key),
+		keeper: k,
+	}
+}
+
+// Close component, the heartbeat and leader keys are deleted by revoking the lease
+func (k *Keeper) Close() {
+	close(k.closeCh)
+	k.wg.Wait()
+
+	if lease := atomic.LoadInt64(&k.lease); lease != 0 {
+		if err := k.cli.revoke(lease); err != nil {
+			log.Errorf("revoke lease failed: %s", err)
+		}
+	}
+}
+
+// Mutex is an etcd implement of mod.DistributedMutex, the key is attached to a lease with the ttl of lock
+type Mutex struct {
+	key    string
+	keeper *Keeper
+	holder string
+	lease  int64
+}
+
+// Lock
+func (m *Mutex) Lock(ctx context.Context, ops ...mod.LockOptionOp) error {
+	opt := mod.NewLockOption(ops)
+	holder := opt.ReentrantIdentity
+	if holder == "" {
+		// each locking is a different holder, so it is not reentrant
+		holder = fmt.Sprintf("%s#%d", m.keeper.opt.Key, atomic.AddUint64(&m.keeper.mutexSeq, 1))
+	}
+
+	ticker := time.NewTicker(opt.SpinInterval)
+	defer ticker.Stop()
+	for {
+		ok, err := m.tryLock(holder, opt.TTL, opt.ReentrantIdentity != "")
+		if err != nil {
+			return fmt.Errorf("acquire mutex failed: %w", err)
+		}
+		if ok {
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (m *Mutex) tryLock(holder string, ttl time.Duration, reentrant bool) (bool, error) {
+	cli := m.keeper.cli
+	lease, err := cli.grant(ttlSecs(ttl))
+	if err != nil {
+		return false, err
+	}
+	put := []requestOp{{RequestPut: &putRequest{Key: []byte(m.key), Value: []byte(holder), Lease: int64Str(lease)}}}
+	resp, err := cli.txn(&txnRequest{Compare: []compare{notExisted(m.key)}, Success: put})
+	if err == nil && !resp.Succeeded && reentrant {
+		// the reentrant holder renews the lock with new lease
+		resp, err = cli.txn(&txnRequest{Compare: []compare{valueEqual(m.key, holder)}, Success: put})
+	}
+	if err != nil || !resp.Succeeded {
+		if rErr := cli.revoke(lease); rErr != nil {
+			log.Warnf("revoke unused lease of mutex[%s] failed: %s", m.key, rErr)
+		}
+		return false, err
+	}
+	m.holder, m.lease = holder, lease
+	return true, nil
+}
+
+// Unlock
+func (m *Mutex) Unlock(ctx context.Context) error {
+	if m.holder == "" {
+		return fmt.Errorf("the mutex is not locked")
+	}
+	holder, lease := m.holder, m.lease
+	m.holder, m.lease = "", 0
+
+	cli := m.keeper.cli
+	resp, err := cli.txn(&txnRequest{
+		Compare: []compare{valueEqual(m.key, holder)},
+		Success: []requestOp{{RequestDelete: &deleteRequest{Key: []byte(m.key)}}},
+	})
+	if err != nil {
+		return fmt.Errorf("release mutex failed: %w", err)
+	}
+	if err := cli.revoke(lease); err != nil {
+		log.Warnf("revoke lease of mutex[%s] failed: %s", m.key, err)
+	}
+	if !resp.Succeeded {
+		return data.ErrMutexAlreadyUnlock
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package etcd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/mod"
+	"github.com/etherealiy/fastflow/pkg/utils/data"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeEtcd implement the json gateway apis used by keeper in memory
+type fakeEtcd struct {
+	lock     sync.Mutex
+	rev      int64
+	leaseSeq int64
+	leases   map[int64]time.Time
+	ttls     map[int64]time.Duration
+	kvs      map[string]keyValue
+}
+
+func newFakeEtcd() *httptest.Server {
+	f := &fakeEtcd{leases: map[int64]time.Time{}, ttls: map[int64]time.Duration{}, kvs: map[string]keyValue{}}
+	return httptest.NewServer(f)
+}
+
+func (f *fakeEtcd) expire() {
+	for id, at := range f.leases {
+		if time.Now().After(at) {
+			f.revoke(id)
+		}
+	}
+}
+
+func (f *fakeEtcd) revoke(id int64) {
+	delete(f.leases, id)
+	for k, kv := range f.kvs {
+		if int64(kv.Lease) == id {
+			delete(f.kvs, k)
+		}
+	}
+}
+
+func (f *fakeEtcd) put(req *putRequest) {
+	f.rev++
+	kv := keyValue{Key: req.Key, Value: req.Value, Lease: req.Lease, CreateRevision: int64Str(f.rev)}
+	if old, ok := f.kvs[string(req.Key)]; ok {
+		kv.CreateRevision = old.CreateRevision
+	}
+	f.kvs[string(req.Key)] = kv
+}
+
+func (f *fakeEtcd) rangeKvs(req *rangeRequest) *rangeResponse {
+	resp := &rangeResponse{}
+	for k, kv := range f.kvs {
+		if k == string(req.Key) || (req.RangeEnd != nil && k >= string(req.Key) && k < string(req.RangeEnd)) {
+			resp.Kvs = append(resp.Kvs, kv)
+		}
+	}
+	sort.Slice(resp.Kvs, func(i, j int) bool { return string(resp.Kvs[i].Key) < string(resp.Kvs[j].Key) })
+	return resp
+}
+
+func (f *fakeEtcd) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.expire()
+
+	var resp interface{} = map[string]interface{}{}
+	dec := json.NewDecoder(r.Body)
+	switch r.URL.Path {
+	case "/v3/lease/grant":
+		req := struct{ TTL int64Str }{}
+		_ = dec.Decode(&req)
+		f.leaseSeq++
+		f.ttls[f.leaseSeq] = time.Duration(req.TTL) * time.Second
+		f.leases[f.leaseSeq] = time.Now().Add(f.ttls[f.leaseSeq])
+		resp = leaseResponse{ID: int64Str(f.leaseSeq), TTL: req.TTL}
+	case "/v3/lease/keepalive":
+		req := struct{ ID int64Str }{}
+		_ = dec.Decode(&req)
+		ret := leaseResponse{ID: req.ID}
+		if _, ok := f.leases[int64(req.ID)]; ok {
+			f.leases[int64(req.ID)] = time.Now().Add(f.ttls[int64(req.ID)])
+			ret.TTL = int64Str(f.ttls[int64(req.ID)] / time.Second)
+		}
+		resp = map[string]interface{}{"result": ret}
+	case "/v3/lease/revoke":
+		req := struct{ ID int64Str }{}
+		_ = dec.Decode(&req)
+		if _, ok := f.leases[int64(req.ID)]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		f.revoke(int64(req.ID))
+	case "/v3/kv/put":
+		req := putRequest{}
+		_ = dec.Decode(&req)
+		f.put(&req)
+	case "/v3/kv/range":
+		req := rangeRequest{}
+		_ = dec.Decode(&req)
+		resp = f.rangeKvs(&req)
+	case "/v3/kv/txn":
+		req := txnRequest{}
+		_ = dec.Decode(&req)
+		ret := txnResponse{Succeeded: true}
+		for _, c := range req.Compare {
+			kv, ok := f.kvs[string(c.Key)]
+			switch c.Target {
+			case "CREATE":
+				ret.Succeeded = ret.Succeeded && !ok
+			case "VALUE":
+				ret.Succeeded = ret.Succeeded && ok && bytes.Equal(kv.Value, c.Value)
+			}
+		}
+		ops := req.Success
+		if !ret.Succeeded {
+			ops = req.Failure
+		}
+		for _, op := range ops {
+			item := struct {
+				ResponseRange *rangeResponse `json:"response_range"`
+			}{}
+			switch {
+			case op.RequestPut != nil:
+				f.put(op.RequestPut)
+			case op.RequestDelete != nil:
+				delete(f.kvs, string(op.RequestDelete.Key))
+			case op.RequestRange != nil:
+				item.ResponseRange = f.rangeKvs(op.RequestRange)
+			}
+			ret.Responses = append(ret.Responses, item)
+		}
+		resp = ret
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func TestKeeper(t *testing.T) {
+	srv := newFakeEtcd()
+	defer srv.Close()
+
+	k1 := NewKeeper(&KeeperOption{Key: "worker-1", Endpoints: []string{srv.URL}, UnhealthyTime: time.Second,
+		Labels: map[string]string{"gpu": "a100"}})
+	k2 := NewKeeper(&KeeperOption{Key: "worker-2", Endpoints: []string{"http://127.0.0.1:1", srv.URL}, UnhealthyTime: time.Second})
+	assert.NoError(t, k1.Init())
+	assert.NoError(t, k2.Init(), "unavailable endpoint should be skipped")
+	defer k2.Close()
+
+	assert.True(t, k1.IsLeader())
+	assert.False(t, k2.IsLeader())
+	assert.Equal(t, 2, k2.WorkerNumber())
+	nodes, err := k2.AliveNodes()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"worker-1", "worker-2"}, nodes)
+	labels, err := k2.AliveNodeLabels()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]map[string]string{"worker-1": {"gpu": "a100"}, "worker-2": nil}, labels)
+
+	assert.Error(t, NewKeeper(&KeeperOption{Key: "worker", Endpoints: []string{srv.URL}}).Init(), "invalid worker key")
+
+	k1.Close()
+	alive, err := k2.IsAlive("worker-1")
+	assert.NoError(t, err)
+	assert.False(t, alive)
+	time.Sleep(600 * time.Millisecond)
+	assert.True(t, k2.IsLeader(), "leader should be taken over after leader left")
+}
+
+func TestMutex(t *testing.T) {
+	srv := newFakeEtcd()
+	defer srv.Close()
+
+	k := NewKeeper(&KeeperOption{Key: "worker-1", Endpoints: []string{srv.URL}})
+	assert.NoError(t, k.Init())
+	defer k.Close()
+
+	m1, m2 := k.NewMutex("key"), k.NewMutex("key")
+	assert.NoError(t, m1.Lock(context.Background()))
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, m2.Lock(ctx))
+	assert.NoError(t, m1.Unlock(context.Background()))
+	assert.NoError(t, m2.Lock(context.Background()))
+	assert.NoError(t, m2.Unlock(context.Background()))
+	assert.Error(t, m2.Unlock(context.Background()), "unlock not locked mutex")
+
+	assert.NoError(t, m1.Lock(context.Background(), mod.LockTTL(time.Second)))
+	time.Sleep(1100 * time.Millisecond)
+	assert.Equal(t, data.ErrMutexAlreadyUnlock, m1.Unlock(context.Background()))
+
+	assert.NoError(t, m1.Lock(context.Background(), mod.Reentrant("id")))
+	assert.NoError(t, m2.Lock(context.Background(), mod.Reentrant("id")))
+}
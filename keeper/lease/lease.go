@@ -0,0 +1,313 @@
+package lease
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/etherealiy/fastflow/keeper"
+	"github.com/etherealiy/fastflow/pkg/event"
+	"github.com/etherealiy/fastflow/pkg/log"
+	"github.com/etherealiy/fastflow/pkg/mod"
+	"github.com/etherealiy/fastflow/pkg/utils/data"
+	"github.com/etherealiy/fastflow/store"
+	"github.com/shiningrush/goevent"
+)
+
+const (
+	LeaderKey       = "leader"
+	HeartbeatPrefix = "heartbeat/"
+	DrainingPrefix  = "draining/"
+	MutexPrefix     = "mutex/"
+)
+
+var (
+	_ mod.Keeper          = (*Keeper)(nil)
+	_ mod.DrainableKeeper = (*Keeper)(nil)
+)
+
+// Keeper implement leader election and worker liveness by the leases of store,
+// so the deployments which only have the database do not need other keeper backends.
+// The expiry of leases depends on the clocks of workers, so they should be synchronized.
+type Keeper struct {
+	opt       *KeeperOption
+	keyNumber int
+
+	leaderFlag atomic.Value
+	mutexSeq   uint64
+	// electLock make sure the leader lease is not acquired again after draining
+	electLock sync.Mutex
+	draining  bool
+
+	wg      sync.WaitGroup
+	closeCh chan struct{}
+}
+
+// KeeperOption
+type KeeperOption struct {
+	// Key the work key, must be the format like "xxxx-{{number}}", number is the code of worker
+	Key string
+	// Store is usually the same store used by fastflow, such as memory or mongo store
+	Store mod.LeaseStore
+	// UnhealthyTime default 5s, campaign and heartbeat time will be half of it
+	UnhealthyTime time.Duration
+}
+
+// NewKeeper
+func NewKeeper(opt *KeeperOption) *Keeper {
+	k := &Keeper{
+		opt:     opt,
+		closeCh: make(chan struct{}),
+	}
+	k.leaderFlag.Store(false)
+	return k
+}
+
+// Init
+func (k *Keeper) Init() error {
+	if k.opt.Key == "" || k.opt.Store == nil {
+		return fmt.Errorf("worker key or store can not be empty")
+	}
+	number, err := keeper.CheckWorkerKey(k.opt.Key)
+	if err != nil {
+		return err
+	}
+	k.keyNumber = number
+	if k.opt.UnhealthyTime == 0 {
+		k.opt.UnhealthyTime = time.Second * 5
+	}
+	store.InitFlakeGenerator()
+
+	if err := k.heartBeat(); err != nil {
+		return err
+	}
+	k.elect()
+
+	k.wg.Add(1)
+	go k.goLoop()
+	return nil
+}
+
+func (k *Keeper) goLoop() {
+	defer k.wg.Done()
+	ticker := time.NewTicker(k.opt.UnhealthyTime / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-k.closeCh:
+			return
+		case <-ticker.C:
+			if err := k.heartBeat(); err != nil {
+				log.Errorf("heart beat failed: %s", err)
+			}
+			k.elect()
+		}
+	}
+}
+
+func (k *Keeper) heartBeat() error {
+	ok, err := k.opt.Store.AcquireLease(HeartbeatPrefix+k.opt.Key, k.opt.Key, k.opt.UnhealthyTime)
+	if err != nil {
+		return fmt.Errorf("renew heartbeat lease failed: %w", err)
+	}
+	if !ok {
+		return fmt.Errorf("heartbeat lease of worker[%s] is held by others", k.opt.Key)
+	}
+
+	k.electLock.Lock()
+	draining := k.draining
+	k.electLock.Unlock()
+	if draining {
+		if _, err := k.opt.Store.AcquireLease(DrainingPrefix+k.opt.Key, k.opt.Key, k.opt.UnhealthyTime); err != nil {
+			return fmt.Errorf("renew draining lease failed: %w", err)
+		}
+	}
+	return nil
+}
+
+func (k *Keeper) elect() {
+	k.electLock.Lock()
+	defer k.electLock.Unlock()
+	if k.draining {
+		return
+	}
+	ok, err := k.opt.Store.AcquireLease(LeaderKey, k.opt.Key, k.opt.UnhealthyTime)
+	if err != nil {
+		// the lease may expire before next renewal, so leader should step down
+		log.Errorf("acquire leader lease failed: %s", err)
+		ok = false
+	}
+	if ok != k.IsLeader() {
+		k.setLeaderFlag(ok)
+	}
+}
+
+func (k *Keeper) setLeaderFlag(isLeader bool) {
+	k.leaderFlag.Store(isLeader)
+	goevent.Publish(&event.LeaderChanged{
+		IsLeader:  isLeader,
+		WorkerKey: k.WorkerKey(),
+	})
+}
+
+// IsLeader indicate the component if is leader node
+func (k *Keeper) IsLeader() bool {
+	return k.leaderFlag.Load().(bool)
+}
+
+// Drain mark the worker as draining and release the leader lease
+func (k *Keeper) Drain() error {
+	k.electLock.Lock()
+	defer k.electLock.Unlock()
+	if k.draining {
+		return nil
+	}
+	if _, err := k.opt.Store.AcquireLease(DrainingPrefix+k.opt.Key, k.opt.Key, k.opt.UnhealthyTime); err != nil {
+		return fmt.Errorf("acquire draining lease failed: %w", err)
+	}
+	k.draining = true
+	if k.IsLeader() {
+		if _, err := k.opt.Store.ReleaseLease(LeaderKey, k.opt.Key); err != nil {
+			log.Errorf("release leader lease failed: %s", err)
+		}
+		k.setLeaderFlag(false)
+	}
+	return nil
+}
+
+// DrainingNodes get the alive nodes which are draining
+func (k *Keeper) DrainingNodes() ([]string, error) {
+	leases, err := k.opt.Store.ListLease(DrainingPrefix)
+	if err != nil {
+		return nil, err
+	}
+	var nodes []string
+	for _, l := range leases {
+		nodes = append(nodes, strings.TrimPrefix(l.Key, DrainingPrefix))
+	}
+	return nodes, nil
+}
+
+// IsAlive check if a worker still alive
+func (k *Keeper) IsAlive(workerKey string) (bool, error) {
+	leases, err := k.opt.Store.ListLease(HeartbeatPrefix + workerKey)
+	if err != nil {
+		return false, err
+	}
+	for _, l := range leases {
+		if l.Key == HeartbeatPrefix+workerKey {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// AliveNodes get all alive nodes
+func (k *Keeper) AliveNodes() ([]string, error) {
+	leases, err := k.opt.Store.ListLease(HeartbeatPrefix)
+	if err != nil {
+		return nil, err
+	}
+	var nodes []string
+	for _, l := range leases {
+		nodes = append(nodes, strings.TrimPrefix(l.Key, HeartbeatPrefix))
+	}
+	return nodes, nil
+}
+
+// WorkerKey
+func (k *Keeper) WorkerKey() string {
+	return k.opt.Key
+}
+
+// WorkerNumber get the the key number of Worker key, if here is a WorkKey like `worker-1`, then it will return "1"
+func (k *Keeper) WorkerNumber() int {
+	return k.keyNumber
+}
+
+// NewMutex create a new distributed mutex
+func (k *Keeper) NewMutex(key string) mod.DistributedMutex {
+	return &Mutex{
+		key:    MutexPrefix + key,
+		keeper: k,
+	}
+}
+
+// Close component
+func (k *Keeper) Close() {
+	close(k.closeCh)
+	k.wg.Wait()
+
+	if k.IsLeader() {
+		if _, err := k.opt.Store.ReleaseLease(LeaderKey, k.opt.Key); err != nil {
+			log.Errorf("release leader lease failed: %s", err)
+		}
+	}
+	if _, err := k.opt.Store.ReleaseLease(HeartbeatPrefix+k.opt.Key, k.opt.Key); err != nil {
+		log.Errorf("release heartbeat lease failed: %s", err)
+	}
+	k.electLock.Lock()
+	draining := k.draining
+	k.electLock.Unlock()
+	if draining {
+		if _, err := k.opt.Store.ReleaseLease(DrainingPrefix+k.opt.Key, k.opt.Key); err != nil {
+			log.Errorf("release draining lease failed: %s", err)
+		}
+	}
+}
+
+// Mutex is a lease implement of mod.DistributedMutex
+type Mutex struct {
+	key    string
+	keeper *Keeper
+	holder string
+}
+
+// Lock
+func (m *Mutex) Lock(ctx context.Context, ops ...mod.LockOptionOp) error {
+	opt := mod.NewLockOption(ops)
+	holder := opt.ReentrantIdentity
+	if holder == "" {
+		// each locking is a different holder, so it is not reentrant
+		holder = fmt.Sprintf("%s#%d", m.keeper.opt.Key, atomic.AddUint64(&m.keeper.mutexSeq, 1))
+	}
+
+	ticker := time.NewTicker(opt.SpinInterval)
+	defer ticker.Stop()
+	for {
+		ok, err := m.keeper.opt.Store.AcquireLease(m.key, holder, opt.TTL)
+		if err != nil {
+			return fmt.Errorf("acquire mutex lease failed: %w", err)
+		}
+		if ok {
+			m.holder = holder
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Unlock
+func (m *Mutex) Unlock(ctx context.Context) error {
+	if m.holder == "" {
+		return fmt.Errorf("the mutex is not locked")
+	}
+	holder := m.holder
+	m.holder = ""
+	ok, err := m.keeper.opt.Store.ReleaseLease(m.key, holder)
+	if err != nil {
+		return fmt.Errorf("release mutex lease failed: %w", err)
+	}
+	if !ok {
+		return data.ErrMutexAlreadyUnlock
+	}
+	return nil
+}
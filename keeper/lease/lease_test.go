@@ -0,0 +1,88 @@
+package lease
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/mod"
+	"github.com/etherealiy/fastflow/pkg/utils/data"
+	"github.com/etherealiy/fastflow/store/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeeper(t *testing.T) {
+	st := memory.NewStore()
+	k1 := NewKeeper(&KeeperOption{Key: "worker-1", Store: st, UnhealthyTime: 200 * time.Millisecond})
+	k2 := NewKeeper(&KeeperOption{Key: "worker-2", Store: st, UnhealthyTime: 200 * time.Millisecond})
+	assert.NoError(t, k1.Init())
+	assert.NoError(t, k2.Init())
+	defer k2.Close()
+
+	assert.True(t, k1.IsLeader())
+	assert.False(t, k2.IsLeader())
+	assert.Equal(t, 2, k2.WorkerNumber())
+	nodes, err := k2.AliveNodes()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"worker-1", "worker-2"}, nodes)
+
+	assert.Error(t, NewKeeper(&KeeperOption{Key: "worker", Store: st}).Init(), "invalid worker key")
+
+	k1.Close()
+	alive, err := k2.IsAlive("worker-1")
+	assert.NoError(t, err)
+	assert.False(t, alive)
+	time.Sleep(300 * time.Millisecond)
+	assert.True(t, k2.IsLeader(), "leader should be taken over after leader left")
+}
+
+func TestMutex(t *testing.T) {
+	st := memory.NewStore()
+	k := NewKeeper(&KeeperOption{Key: "worker-1", Store: st})
+	assert.NoError(t, k.Init())
+	defer k.Close()
+
+	m1, m2 := k.NewMutex("key"), k.NewMutex("key")
+	assert.NoError(t, m1.Lock(context.Background()))
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, m2.Lock(ctx))
+	assert.NoError(t, m1.Unlock(context.Background()))
+	assert.NoError(t, m2.Lock(context.Background()))
+	assert.NoError(t, m2.Unlock(context.Background()))
+	assert.Error(t, m2.Unlock(context.Background()), "unlock not locked mutex")
+
+	assert.NoError(t, m1.Lock(context.Background(), mod.LockTTL(time.Millisecond)))
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, data.ErrMutexAlreadyUnlock, m1.Unlock(context.Background()))
+
+	assert.NoError(t, m1.Lock(context.Background(), mod.Reentrant("id")))
+	assert.NoError(t, m2.Lock(context.Background(), mod.Reentrant("id")))
+}
+
+func TestKeeper_Drain(t *testing.T) {
+	st := memory.NewStore()
+	k1 := NewKeeper(&KeeperOption{Key: "worker-1", Store: st, UnhealthyTime: 200 * time.Millisecond})
+	k2 := NewKeeper(&KeeperOption{Key: "worker-2", Store: st, UnhealthyTime: 200 * time.Millisecond})
+	assert.NoError(t, k1.Init())
+	assert.NoError(t, k2.Init())
+	defer k1.Close()
+	defer k2.Close()
+
+	assert.True(t, k1.IsLeader())
+	assert.NoError(t, k1.Drain())
+	assert.False(t, k1.IsLeader(), "draining worker should release leadership")
+	nodes, err := k2.DrainingNodes()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"worker-1"}, nodes)
+
+	time.Sleep(300 * time.Millisecond)
+	assert.True(t, k2.IsLeader(), "leader should be taken over after leader drained")
+	assert.False(t, k1.IsLeader(), "draining worker should never campaign")
+	alive, err := k2.IsAlive("worker-1")
+	assert.NoError(t, err)
+	assert.True(t, alive, "draining worker is still alive")
+	nodes, err = k2.DrainingNodes()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"worker-1"}, nodes, "draining state should be renewed")
+}
@@ -0,0 +1,189 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/event"
+	"github.com/etherealiy/fastflow/pkg/mod"
+	"github.com/etherealiy/fastflow/pkg/utils/data"
+	"github.com/etherealiy/fastflow/store"
+	"github.com/shiningrush/goevent"
+)
+
+var (
+	_ mod.Keeper          = (*Keeper)(nil)
+	_ mod.DrainableKeeper = (*Keeper)(nil)
+)
+
+// Keeper is a standalone keeper, the only worker is always leader and alive.
+// it is used by standalone mode and tests, so you can run fastflow without any backend
+type Keeper struct {
+	key      string
+	draining bool
+
+	locks map[string]*lockDetail
+	mutex sync.Mutex
+}
+
+type lockDetail struct {
+	expiredAt time.Time
+	identity  string
+}
+
+// NewKeeper
+func NewKeeper(key string) *Keeper {
+	if key == "" {
+		key = "standalone-1"
+	}
+	return &Keeper{
+		key:   key,
+		locks: map[string]*lockDetail{},
+	}
+}
+
+// Init
+func (k *Keeper) Init() error {
+	store.InitFlakeGenerator()
+	goevent.Publish(&event.LeaderChanged{
+		IsLeader:  true,
+		WorkerKey: k.key,
+	})
+	return nil
+}
+
+// IsLeader standalone worker is always leader until it is draining
+func (k *Keeper) IsLeader() bool {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	return !k.draining
+}
+
+// Drain mark the worker as draining and step down
+func (k *Keeper) Drain() error {
+	k.mutex.Lock()
+	if k.draining {
+		k.mutex.Unlock()
+		return nil
+	}
+	k.draining = true
+	k.mutex.Unlock()
+
+	goevent.Publish(&event.LeaderChanged{
+		IsLeader:  false,
+		WorkerKey: k.key,
+	})
+	return nil
+}
+
+// DrainingNodes
+func (k *Keeper) DrainingNodes() ([]string, error) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	if k.draining {
+		return []string{k.key}, nil
+	}
+	return nil, nil
+}
+
+// IsAlive check if a worker still alive
+func (k *Keeper) IsAlive(workerKey string) (bool, error) {
+	return workerKey == k.key, nil
+}
+
+// AliveNodes get all alive nodes
+func (k *Keeper) AliveNodes() ([]string, error) {
+	return []string{k.key}, nil
+}
+
+// WorkerKey
+func (k *Keeper) WorkerKey() string {
+	return k.key
+}
+
+// WorkerNumber
+func (k *Keeper) WorkerNumber() int {
+	return 0
+}
+
+// NewMutex create a new process-local mutex
+func (k *Keeper) NewMutex(key string) mod.DistributedMutex {
+	return &Mutex{
+		key:    key,
+		keeper: k,
+	}
+}
+
+// Close component
+func (k *Keeper) Close() {
+}
+
+// Mutex is a process-local implement of mod.DistributedMutex
+type Mutex struct {
+	key    string
+	keeper *Keeper
+	detail *lockDetail
+}
+
+// Lock
+func (m *Mutex) Lock(ctx context.Context, ops ...mod.LockOptionOp) error {
+	opt := mod.NewLockOption(ops)
+	if m.tryLock(opt) {
+		return nil
+	}
+
+	ticker := time.NewTicker(opt.SpinInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if m.tryLock(opt) {
+				return nil
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (m *Mutex) tryLock(opt *mod.LockOption) bool {
+	m.keeper.mutex.Lock()
+	defer m.keeper.mutex.Unlock()
+
+	d, ok := m.keeper.locks[m.key]
+	if ok && d.expiredAt.After(time.Now()) {
+		// lock existed, we should check it is reentrant
+		if opt.ReentrantIdentity == "" || d.identity != opt.ReentrantIdentity {
+			return false
+		}
+	}
+
+	d = &lockDetail{
+		expiredAt: time.Now().Add(opt.TTL),
+		identity:  opt.ReentrantIdentity,
+	}
+	m.keeper.locks[m.key] = d
+	m.detail = d
+	return true
+}
+
+// Unlock
+func (m *Mutex) Unlock(ctx context.Context) error {
+	if m.detail == nil {
+		return fmt.Errorf("the mutex is not locked")
+	}
+
+	m.keeper.mutex.Lock()
+	defer m.keeper.mutex.Unlock()
+	d, ok := m.keeper.locks[m.key]
+	held := m.detail
+	m.detail = nil
+	// lock is expired or already keep by others
+	if !ok || d != held || d.expiredAt.Before(time.Now()) {
+		return data.ErrMutexAlreadyUnlock
+	}
+	delete(m.keeper.locks, m.key)
+	return nil
+}
@@ -22,6 +22,8 @@ import (
 
 const LeaderKey = "leader"
 
+var _ mod.DrainableKeeper = (*Keeper)(nil)
+
 // Keeper mongo implement
 type Keeper struct {
 	opt              *KeeperOption
@@ -30,8 +32,13 @@ type Keeper struct {
 	mutexClsName     string
 
 	leaderFlag atomic.Value
+	// electLock make sure the leader is not campaigned again after draining
+	electLock sync.Mutex
+	draining  bool
 	// 单实例版不使用keyNumber
-	keyNumber   int
+	keyNumber int
+	// connLock protect the client which is replaced when reloading
+	connLock    sync.RWMutex
 	mongoClient *mongo.Client
 	mongoDb     *mongo.Database
 
@@ -50,10 +57,15 @@ type KeeperOption struct {
 	Database string
 	// the prefix will append to the database
 	Prefix string
+	// Labels is saved with heartbeat, they are matched by the selector of tasks
+	Labels map[string]string
 	// UnhealthyTime default 5s, campaign and heartbeat time will be half of it
 	UnhealthyTime time.Duration
 	// Timeout default 2s
 	Timeout time.Duration
+	// LoadConnStr is called in Init and Reload to get the latest connection string, it takes precedence over ConnStr,
+	// so the rotated credentials can be used without restarting
+	LoadConnStr func() (string, error)
 }
 
 // NewKeeper
@@ -77,16 +89,9 @@ func (k *Keeper) Init() error {
 
 	ctx, cancel := context.WithTimeout(context.Background(), k.opt.Timeout)
 	defer cancel()
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(k.opt.ConnStr))
-	if err != nil {
-		return fmt.Errorf("connect client failed: %w", err)
-	}
-	err = client.Ping(ctx, readpref.Primary())
-	if err != nil {
-		return fmt.Errorf("ping client failed: %w", err)
+	if err := k.connect(ctx); err != nil {
+		return err
 	}
-	k.mongoClient = client
-	k.mongoDb = k.mongoClient.Database(k.opt.Database)
 	if err := k.ensureTtlIndex(ctx, k.leaderClsName, "updatedAt", int32(k.opt.UnhealthyTime.Seconds())); err != nil {
 		return err
 	}
@@ -109,6 +114,59 @@ func (k *Keeper) Init() error {
 	return nil
 }
 
+// connect to mongo and replace the current client
+func (k *Keeper) connect(ctx context.Context) error {
+	connStr := k.opt.ConnStr
+	if k.opt.LoadConnStr != nil {
+		var err error
+		if connStr, err = k.opt.LoadConnStr(); err != nil {
+			return fmt.Errorf("load connection string failed: %w", err)
+		}
+	}
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(connStr))
+	if err != nil {
+		return fmt.Errorf("connect client failed: %w", err)
+	}
+	err = client.Ping(ctx, readpref.Primary())
+	if err != nil {
+		_ = client.Disconnect(ctx)
+		return fmt.Errorf("ping client failed: %w", err)
+	}
+
+	k.connLock.Lock()
+	k.mongoClient, k.mongoDb = client, client.Database(k.opt.Database)
+	k.connLock.Unlock()
+	return nil
+}
+
+// Reload reconnect to mongo with the connection string returned by LoadConnStr,
+// election and heartbeat continue with the new client
+func (k *Keeper) Reload() error {
+	ctx, cancel := context.WithTimeout(context.Background(), k.opt.Timeout)
+	defer cancel()
+
+	old := k.client()
+	if err := k.connect(ctx); err != nil {
+		return err
+	}
+	if err := old.Disconnect(ctx); err != nil {
+		log.Errorf("close old keeper client failed: %s", err)
+	}
+	return nil
+}
+
+func (k *Keeper) client() *mongo.Client {
+	k.connLock.RLock()
+	defer k.connLock.RUnlock()
+	return k.mongoClient
+}
+
+func (k *Keeper) db() *mongo.Database {
+	k.connLock.RLock()
+	defer k.connLock.RUnlock()
+	return k.mongoDb
+}
+
 func (k *Keeper) setLeaderFlag(isLeader bool) {
 	k.leaderFlag.Store(isLeader)
 	goevent.Publish(&event.LeaderChanged{
@@ -118,7 +176,7 @@ func (k *Keeper) setLeaderFlag(isLeader bool) {
 }
 
 func (k *Keeper) ensureTtlIndex(ctx context.Context, clsName, field string, ttl int32) error {
-	if _, err := k.mongoDb.Collection(clsName).Indexes().CreateOne(ctx, mongo.IndexModel{
+	if _, err := k.db().Collection(clsName).Indexes().CreateOne(ctx, mongo.IndexModel{
 		Keys: bson.M{
 			field: 1,
 		},
@@ -137,7 +195,7 @@ func (k *Keeper) ensureTtlIndex(ctx context.Context, clsName, field string, ttl
 			return fmt.Errorf("create index failed: %w", err)
 		}
 
-		_, err := k.mongoDb.Collection(clsName).Indexes().DropAll(ctx)
+		_, err := k.db().Collection(clsName).Indexes().DropAll(ctx)
 		if err != nil {
 			return fmt.Errorf("drop all index failed: %w", err)
 		}
@@ -147,7 +205,7 @@ func (k *Keeper) ensureTtlIndex(ctx context.Context, clsName, field string, ttl
 }
 
 func (k *Keeper) readOpt() error {
-	if k.opt.Key == "" || k.opt.ConnStr == "" {
+	if k.opt.Key == "" || (k.opt.ConnStr == "" && k.opt.LoadConnStr == nil) {
 		return fmt.Errorf("worker key or connection string can not be empty")
 	}
 
@@ -189,7 +247,7 @@ func (k *Keeper) AliveNodes() ([]string, error) {
 	ctx, cancel := context.WithTimeout(context.TODO(), k.opt.Timeout)
 	defer cancel()
 	// mongodb background worker delete expired date every 60s, so can not believe it
-	cur, err := k.mongoDb.Collection(k.heartbeatClsName).Find(ctx, bson.M{
+	cur, err := k.db().Collection(k.heartbeatClsName).Find(ctx, bson.M{
 		"updatedAt": bson.M{
 			"$gt": time.Now().Add(-1 * k.opt.UnhealthyTime),
 		},
@@ -210,6 +268,90 @@ func (k *Keeper) AliveNodes() ([]string, error) {
 	return aliveNodes, nil
 }
 
+func (k *Keeper) isDraining() bool {
+	k.electLock.Lock()
+	defer k.electLock.Unlock()
+	return k.draining
+}
+
+// Drain mark the worker as draining in heartbeat and deregister leader if it is held by current worker
+func (k *Keeper) Drain() error {
+	k.electLock.Lock()
+	if k.draining {
+		k.electLock.Unlock()
+		return nil
+	}
+	k.draining = true
+	k.electLock.Unlock()
+
+	if err := k.heartBeat(); err != nil {
+		return err
+	}
+	if !k.IsLeader() {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.TODO(), k.opt.Timeout)
+	defer cancel()
+	_, err := k.db().Collection(k.leaderClsName).DeleteOne(ctx, bson.M{
+		"_id":       LeaderKey,
+		"workerKey": k.opt.Key,
+	})
+	if err != nil {
+		log.Errorf("deregister leader failed: %s", err)
+	}
+	k.setLeaderFlag(false)
+	return nil
+}
+
+// DrainingNodes get the alive nodes which are draining
+func (k *Keeper) DrainingNodes() ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.TODO(), k.opt.Timeout)
+	defer cancel()
+	cur, err := k.db().Collection(k.heartbeatClsName).Find(ctx, bson.M{
+		"draining": true,
+		"updatedAt": bson.M{
+			"$gt": time.Now().Add(-1 * k.opt.UnhealthyTime),
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("find result failed: %w", err)
+	}
+
+	var ret []Payload
+	if err := cur.All(ctx, &ret); err != nil {
+		return nil, fmt.Errorf("decode failed: %w", err)
+	}
+	var nodes []string
+	for i := range ret {
+		nodes = append(nodes, ret[i].WorkerKey)
+	}
+	return nodes, nil
+}
+
+// AliveNodeLabels get the labels of all alive nodes
+func (k *Keeper) AliveNodeLabels() (map[string]map[string]string, error) {
+	ctx, cancel := context.WithTimeout(context.TODO(), k.opt.Timeout)
+	defer cancel()
+	cur, err := k.db().Collection(k.heartbeatClsName).Find(ctx, bson.M{
+		"updatedAt": bson.M{
+			"$gt": time.Now().Add(-1 * k.opt.UnhealthyTime),
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("find result failed: %w", err)
+	}
+
+	var payloads []Payload
+	if err := cur.All(ctx, &payloads); err != nil {
+		return nil, fmt.Errorf("decode failed: %w", err)
+	}
+	ret := map[string]map[string]string{}
+	for i := range payloads {
+		ret[payloads[i].WorkerKey] = payloads[i].Labels
+	}
+	return ret, nil
+}
+
 // IsAlive check if a worker still alive
 func (k *Keeper) IsAlive(workerKey string) (bool, error) {
 	ctx, cancel := context.WithTimeout(context.TODO(), k.opt.Timeout)
@@ -217,7 +359,7 @@ func (k *Keeper) IsAlive(workerKey string) (bool, error) {
 
 	var p Payload
 	// mongodb background worker delete expired date every 60s, so can not believe it
-	err := k.mongoDb.Collection(k.heartbeatClsName).FindOne(ctx, bson.M{
+	err := k.db().Collection(k.heartbeatClsName).FindOne(ctx, bson.M{
 		"_id": workerKey,
 		"updatedAt": bson.M{
 			"$gt": time.Now().Add(-1 * k.opt.UnhealthyTime),
@@ -247,7 +389,7 @@ func (k *Keeper) NewMutex(key string) mod.DistributedMutex {
 	return &MongoMutex{
 		key:     key,
 		clsName: k.mutexClsName,
-		mongoDb: k.mongoDb,
+		db:      k.db,
 	}
 }
 
@@ -259,7 +401,7 @@ func (k *Keeper) Close() {
 	ctx, cancel := context.WithTimeout(context.TODO(), k.opt.Timeout)
 	defer cancel()
 	if k.leaderFlag.Load().(bool) {
-		_, err := k.mongoDb.Collection(k.leaderClsName).DeleteOne(ctx, bson.M{
+		_, err := k.db().Collection(k.leaderClsName).DeleteOne(ctx, bson.M{
 			"_id": LeaderKey,
 		})
 		if err != nil {
@@ -267,14 +409,14 @@ func (k *Keeper) Close() {
 		}
 	}
 
-	_, err := k.mongoDb.Collection(k.heartbeatClsName).DeleteOne(ctx, bson.M{
+	_, err := k.db().Collection(k.heartbeatClsName).DeleteOne(ctx, bson.M{
 		"_id": k.opt.Key,
 	})
 	if err != nil {
 		log.Errorf("deregister heart beat failed: %s", err)
 	}
 
-	err = k.mongoClient.Disconnect(ctx)
+	err = k.client().Disconnect(ctx)
 	if err != nil {
 		log.Errorf("close keeper client failed: %s", err)
 	}
@@ -288,8 +430,10 @@ func (k *Keeper) forceClose() {
 
 // Payload header beat dto
 type Payload struct {
-	WorkerKey string    `bson:"_id"`
-	UpdatedAt time.Time `bson:"updatedAt"`
+	WorkerKey string            `bson:"_id"`
+	UpdatedAt time.Time         `bson:"updatedAt"`
+	Labels    map[string]string `bson:"labels,omitempty"`
+	Draining  bool              `bson:"draining,omitempty"`
 }
 
 // LeaderPayload leader election dto
@@ -314,6 +458,11 @@ func (k *Keeper) goElect() {
 }
 
 func (k *Keeper) elect() {
+	k.electLock.Lock()
+	defer k.electLock.Unlock()
+	if k.draining {
+		return
+	}
 	if k.leaderFlag.Load().(bool) {
 		if err := k.continueLeader(); err != nil {
 			log.Errorf("continue leader failed: %s", err)
@@ -335,7 +484,7 @@ func (k *Keeper) elect() {
 func (k *Keeper) campaign() error {
 	ctx, cancel := context.WithTimeout(context.TODO(), k.opt.Timeout)
 	defer cancel()
-	cur, err := k.mongoDb.Collection(k.leaderClsName).Find(ctx, bson.D{})
+	cur, err := k.db().Collection(k.leaderClsName).Find(ctx, bson.D{})
 	if err != nil {
 		return fmt.Errorf("find data failed: %w", err)
 	}
@@ -350,7 +499,7 @@ func (k *Keeper) campaign() error {
 			return nil
 		}
 		if ret[0].UpdatedAt.Before(time.Now().Add(-1 * k.opt.UnhealthyTime)) {
-			ret, err := k.mongoDb.Collection(k.leaderClsName).UpdateOne(ctx,
+			ret, err := k.db().Collection(k.leaderClsName).UpdateOne(ctx,
 				bson.M{
 					"_id":       LeaderKey,
 					"workerKey": ret[0].WorkerKey,
@@ -371,7 +520,7 @@ func (k *Keeper) campaign() error {
 		}
 	}
 	if len(ret) == 0 {
-		_, err := k.mongoDb.Collection(k.leaderClsName).InsertOne(ctx,
+		_, err := k.db().Collection(k.leaderClsName).InsertOne(ctx,
 			LeaderPayload{
 				ID:        LeaderKey,
 				WorkerKey: k.opt.Key,
@@ -393,7 +542,7 @@ func (k *Keeper) campaign() error {
 func (k *Keeper) continueLeader() error {
 	ctx, cancel := context.WithTimeout(context.TODO(), k.opt.Timeout)
 	defer cancel()
-	ret, err := k.mongoDb.Collection(k.leaderClsName).UpdateOne(ctx, bson.M{
+	ret, err := k.db().Collection(k.leaderClsName).UpdateOne(ctx, bson.M{
 		"_id":       LeaderKey,
 		"workerKey": k.opt.Key,
 	},
@@ -435,13 +584,15 @@ func (k *Keeper) goHeartBeat() {
 func (k *Keeper) heartBeat() error {
 	ctx, cancel := context.WithTimeout(context.TODO(), k.opt.Timeout)
 	defer cancel()
-	_, err := k.mongoDb.Collection(k.heartbeatClsName).UpdateOne(ctx,
+	_, err := k.db().Collection(k.heartbeatClsName).UpdateOne(ctx,
 		bson.M{
 			"_id": k.opt.Key,
 		},
 		bson.M{
 			"$set": bson.M{
 				"updatedAt": time.Now(),
+				"labels":    k.opt.Labels,
+				"draining":  k.isDraining(),
 			},
 		},
 		&options.UpdateOptions{
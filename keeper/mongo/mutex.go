@@ -20,8 +20,9 @@ type LockDetail struct {
 type MongoMutex struct {
 	key string
 
-	clsName    string
-	mongoDb    *mongo.Database
+	clsName string
+	// db return the database of current client, the client may be replaced when keeper reloading
+	db         func() *mongo.Database
 	lockDetail *LockDetail
 }
 
@@ -56,7 +57,7 @@ func (m *MongoMutex) Lock(ctx context.Context, ops ...mod.LockOptionOp) error {
 
 func (m *MongoMutex) spinLock(ctx context.Context, opt *mod.LockOption) error {
 	detail := LockDetail{}
-	err := m.mongoDb.Collection(m.clsName).FindOne(ctx, bson.M{"_id": m.key}).Decode(&detail)
+	err := m.db().Collection(m.clsName).FindOne(ctx, bson.M{"_id": m.key}).Decode(&detail)
 	if err != nil && err != mongo.ErrNoDocuments {
 		return fmt.Errorf("get lock detail failed: %w", err)
 	}
@@ -68,7 +69,7 @@ func (m *MongoMutex) spinLock(ctx context.Context, opt *mod.LockOption) error {
 			ExpiredAt: time.Now().Add(opt.TTL),
 			Identity:  opt.ReentrantIdentity,
 		}
-		_, err := m.mongoDb.Collection(m.clsName).InsertOne(ctx, d)
+		_, err := m.db().Collection(m.clsName).InsertOne(ctx, d)
 		if err != nil {
 			if mongo.IsDuplicateKeyError(err) {
 				// race lock failed, ready to get lock next time
@@ -83,7 +84,7 @@ func (m *MongoMutex) spinLock(ctx context.Context, opt *mod.LockOption) error {
 	// lock existed, we should check it is expired
 	if detail.ExpiredAt.Before(time.Now()) {
 		exp := time.Now().Add(opt.TTL)
-		ret, err := m.mongoDb.Collection(m.clsName).UpdateOne(ctx, bson.M{"_id": m.key, "expiredAt": detail.ExpiredAt}, bson.M{
+		ret, err := m.db().Collection(m.clsName).UpdateOne(ctx, bson.M{"_id": m.key, "expiredAt": detail.ExpiredAt}, bson.M{
 			"$set": bson.M{
 				"expiredAt": time.Now().Add(opt.TTL),
 				"identity":  opt.ReentrantIdentity,
@@ -116,7 +117,7 @@ func (m *MongoMutex) Unlock(ctx context.Context) error {
 		return fmt.Errorf("the mutex is not locked")
 	}
 
-	ret, err := m.mongoDb.Collection(m.clsName).DeleteOne(ctx, bson.M{"_id": m.key, "expiredAt": m.lockDetail.ExpiredAt})
+	ret, err := m.db().Collection(m.clsName).DeleteOne(ctx, bson.M{"_id": m.key, "expiredAt": m.lockDetail.ExpiredAt})
 	if err != nil {
 		return fmt.Errorf("delete lock detail failed: %w", err)
 	}
@@ -0,0 +1,179 @@
+package fastflow
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/log"
+	"github.com/etherealiy/fastflow/pkg/mod"
+	"github.com/etherealiy/fastflow/pkg/utils"
+	"gopkg.in/yaml.v3"
+)
+
+// DagLoader read dags from the yaml and json files of a directory, validate and apply them to store.
+// The files are decoded strictly, so the misspelled fields are reported instead of being ignored,
+// and the dags are checked by mod.ValidateDag, so all actions must be registered before loading.
+type DagLoader struct {
+	dir string
+
+	// seen is the contents of files loaded last time, the directory is loaded again only when it is changed
+	seen    map[string][]byte
+	closeCh chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewDagLoader
+func NewDagLoader(dir string) *DagLoader {
+	return &DagLoader{
+		dir:     dir,
+		closeCh: make(chan struct{}),
+	}
+}
+
+// Load apply all dags of the directory, nothing is applied if any of them is invalid
+func (l *DagLoader) Load() (*mod.ApplyResult, error) {
+	paths, files, err := l.readFiles()
+	if err != nil {
+		return nil, err
+	}
+	l.seen = files
+	return applyDagFiles(paths, files)
+}
+
+// Watch check the directory in each interval and load it again when the files are changed until closed,
+// the errors are logged. The dags whose files are removed are kept in store.
+func (l *DagLoader) Watch(interval time.Duration) {
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-l.closeCh:
+				return
+			case <-ticker.C:
+				l.reload()
+			}
+		}
+	}()
+}
+
+// Close stop watching
+func (l *DagLoader) Close() {
+	close(l.closeCh)
+	l.wg.Wait()
+}
+
+func (l *DagLoader) reload() {
+	paths, files, err := l.readFiles()
+	if err != nil {
+		log.Errorf("read dags from %s failed: %s", l.dir, err)
+		return
+	}
+	if reflect.DeepEqual(files, l.seen) {
+		return
+	}
+	// the invalid files are reported once until they are changed again
+	l.seen = files
+	ret, err := applyDagFiles(paths, files)
+	if err != nil {
+		log.Errorf("load dags from %s failed: %s", l.dir, err)
+		return
+	}
+	for _, r := range ret.Dags {
+		if r.Action != mod.ApplyActionUnchanged {
+			log.Infof("dag[%s] is %s from %s", r.DagID, r.Action, l.dir)
+		}
+	}
+}
+
+func (l *DagLoader) readFiles() ([]string, map[string][]byte, error) {
+	paths, err := utils.DefaultReader.ReadPathsFromDir(l.dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	files := make(map[string][]byte, len(paths))
+	for _, path := range paths {
+		bs, err := utils.DefaultReader.ReadDag(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("read %s failed: %w", path, err)
+		}
+		files[path] = bs
+	}
+	return paths, files, nil
+}
+
+func applyDagFiles(paths []string, files map[string][]byte) (*mod.ApplyResult, error) {
+	var dags []*entity.Dag
+	for _, path := range paths {
+		dag, err := decodeDagFile(path, files[path])
+		if err != nil {
+			return nil, err
+		}
+		dags = append(dags, dag)
+	}
+	return mod.ApplyDags(dags, &mod.ApplyOption{Validate: true})
+}
+
+// decodeDagFile decode dag by the extension of file, the file name will be dag's id if it is not specified
+func decodeDagFile(path string, bs []byte) (*entity.Dag, error) {
+	var dag *entity.Dag
+	var err error
+	if filepath.Ext(path) == ".json" {
+		dag, err = parseDagJSON(bs)
+	} else {
+		dag, err = parseDag(bs)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal %s failed: %w", path, err)
+	}
+	if dag.ID == "" {
+		dag.ID = dagIDFromPath(path)
+	}
+	return dag, nil
+}
+
+// parseDag decode dag from yaml, the status is normal by default and the unknown fields are not allowed
+func parseDag(bs []byte) (*entity.Dag, error) {
+	dag := &entity.Dag{
+		Status: entity.DagStatusNormal,
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(bs))
+	dec.KnownFields(true)
+	if err := dec.Decode(dag); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return dag, nil
+}
+
+// parseDagJSON is the same as parseDag except that it decodes json
+func parseDagJSON(bs []byte) (*entity.Dag, error) {
+	dag := &entity.Dag{
+		Status: entity.DagStatusNormal,
+	}
+	dec := json.NewDecoder(bytes.NewReader(bs))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(dag); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return dag, nil
+}
+
+func dagIDFromPath(path string) string {
+	name := filepath.Base(path)
+	switch ext := filepath.Ext(name); ext {
+	case ".yaml", ".yml", ".json":
+		return strings.TrimSuffix(name, ext)
+	}
+	return name
+}
@@ -0,0 +1,58 @@
+package fastflow
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity/run"
+	"github.com/etherealiy/fastflow/pkg/mod"
+	"github.com/etherealiy/fastflow/pkg/utils"
+	"github.com/etherealiy/fastflow/store/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDagLoader_Watch(t *testing.T) {
+	oldActionMap := mod.ActionMap
+	act := &run.MockAction{}
+	act.On("ParameterNew").Return(nil)
+	mod.ActionMap = map[string]run.Action{"action": act}
+	defer func() { mod.ActionMap = oldActionMap }()
+	utils.DefaultReader = &utils.FileDagReader{}
+	st := memory.NewStore()
+	mod.SetStore(st)
+
+	dir := t.TempDir()
+	write := func(name, content string) {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+	dagName := func(id string) string {
+		dag, err := st.GetDag(id)
+		if err != nil {
+			return ""
+		}
+		return dag.Name
+	}
+
+	write("dag1.yaml", "name: v1\ntasks: [{id: task1, actionName: action}]\n")
+	l := NewDagLoader(dir)
+	ret, err := l.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, []mod.DagApplyResult{{DagID: "dag1", Action: mod.ApplyActionCreated}}, ret.Dags)
+
+	l.Watch(10 * time.Millisecond)
+	defer l.Close()
+	write("dag2.json", `{"name": "v1", "tasks": [{"id": "task1", "actionName": "action"}]}`)
+	write("dag1.yaml", "name: v2\ntasks: [{id: task1, actionName: action}]\n")
+	assert.Eventually(t, func() bool {
+		return dagName("dag1") == "v2" && dagName("dag2") == "v1"
+	}, time.Second, 10*time.Millisecond)
+
+	// nothing is applied when any file is invalid
+	write("dag2.json", `{"name": "v2", "tasks": [{"id": "task1", "actionName": "undefined"}]}`)
+	write("dag1.yaml", "name: v3\ntasks: [{id: task1, actionName: action}]\n")
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, "v2", dagName("dag1"))
+	assert.Equal(t, "v1", dagName("dag2"))
+}
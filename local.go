@@ -0,0 +1,152 @@
+package fastflow
+
+import (
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	memoryKeeper "github.com/etherealiy/fastflow/keeper/memory"
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/mod"
+	memoryStore "github.com/etherealiy/fastflow/store/memory"
+)
+
+// LocalRunOption
+type LocalRunOption struct {
+	// Dag to run, all actions used by it must be registered
+	Dag *entity.Dag
+	// Vars will overwrite dag's default vars
+	Vars map[string]string
+	// Timeout of the whole run, 0 means no limit
+	Timeout time.Duration
+	// PollInterval is the interval of checking run status, default 200ms
+	PollInterval time.Duration
+	// LogicalDate of the run, it is useful to backfill a specified partition, default is now
+	LogicalDate time.Time
+}
+
+// LocalRunResult
+type LocalRunResult struct {
+	DagIns  *entity.DagInstance
+	TaskIns []*entity.TaskInstance
+}
+
+// Succeed indicate if all tasks are succeed or skipped
+func (r *LocalRunResult) Succeed() bool {
+	if r.DagIns == nil || len(r.TaskIns) == 0 {
+		return false
+	}
+	for i := range r.TaskIns {
+		if r.TaskIns[i].Status != entity.TaskInstanceStatusSuccess &&
+			r.TaskIns[i].Status != entity.TaskInstanceStatusSkipped {
+			return false
+		}
+	}
+	return true
+}
+
+// RunLocal run a dag to completion in standalone mode, it blocks until all tasks finished or timeout.
+// It is used to execute pipelines ad-hoc or from CI scripts.
+// IMPORTANT: fastflow will be closed after it returned, so DO NOT call it when fastflow has been initialized.
+func RunLocal(opt *LocalRunOption) (*LocalRunResult, error) {
+	if opt.Dag == nil {
+		return nil, fmt.Errorf("dag cannot be nil")
+	}
+	if opt.PollInterval == 0 {
+		opt.PollInterval = 200 * time.Millisecond
+	}
+
+	keeper := memoryKeeper.NewKeeper("")
+	if err := keeper.Init(); err != nil {
+		return nil, fmt.Errorf("init keeper failed: %w", err)
+	}
+	st := memoryStore.NewStore()
+	if err := st.Init(); err != nil {
+		return nil, fmt.Errorf("init store failed: %w", err)
+	}
+	if err := Init(&InitialOption{
+		Keeper: keeper,
+		Store:  st,
+	}); err != nil {
+		return nil, err
+	}
+	defer Close()
+
+	if opt.Dag.Status == "" {
+		opt.Dag.Status = entity.DagStatusNormal
+	}
+	if err := st.CreateDag(opt.Dag); err != nil {
+		return nil, fmt.Errorf("create dag failed: %w", err)
+	}
+	dagIns, err := mod.GetCommander().RunDag(opt.Dag.ID, opt.Vars, mod.RunDagLogicalDate(opt.LogicalDate))
+	if err != nil {
+		return nil, fmt.Errorf("run dag failed: %w", err)
+	}
+
+	var timeoutCh <-chan time.Time
+	if opt.Timeout > 0 {
+		timeoutCh = time.After(opt.Timeout)
+	}
+	ticker := time.NewTicker(opt.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-timeoutCh:
+			ret, err := getLocalRunResult(st, dagIns.ID)
+			if err != nil {
+				return nil, err
+			}
+			return ret, fmt.Errorf("run dag timeout after %s", opt.Timeout)
+		case <-ticker.C:
+			ret, err := getLocalRunResult(st, dagIns.ID)
+			if err != nil {
+				return nil, err
+			}
+			if isLocalRunCompleted(ret) {
+				return ret, nil
+			}
+		}
+	}
+}
+
+func getLocalRunResult(st mod.Store, dagInsId string) (*LocalRunResult, error) {
+	dagIns, err := st.GetDagInstance(dagInsId)
+	if err != nil {
+		return nil, fmt.Errorf("get dag instance failed: %w", err)
+	}
+	taskIns, err := st.ListTaskInstance(&mod.ListTaskInstanceInput{DagInsID: dagInsId})
+	if err != nil {
+		return nil, fmt.Errorf("list task instance failed: %w", err)
+	}
+	return &LocalRunResult{DagIns: dagIns, TaskIns: taskIns}, nil
+}
+
+// isLocalRunCompleted check tasks rather than dag instance,
+// because dag instance only success when it has a "END" task
+func isLocalRunCompleted(ret *LocalRunResult) bool {
+	switch ret.DagIns.Status {
+	case entity.DagInstanceStatusSuccess, entity.DagInstanceStatusFailed, entity.DagInstanceStatusBlocked:
+		return true
+	}
+	if len(ret.TaskIns) == 0 {
+		return false
+	}
+	for i := range ret.TaskIns {
+		switch ret.TaskIns[i].Status {
+		case entity.TaskInstanceStatusSuccess, entity.TaskInstanceStatusSkipped, entity.TaskInstanceStatusFailed,
+			entity.TaskInstanceStatusInvalidParams, entity.TaskInstanceStatusCanceled, entity.TaskInstanceStatusBlocked:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// ReadDagFile read dag from a yaml or json file, the file name will be dag's id if it is not specified
+func ReadDagFile(path string) (*entity.Dag, error) {
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read %s failed: %w", path, err)
+	}
+	return decodeDagFile(path, bs)
+}
@@ -0,0 +1,89 @@
+package fastflow
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/entity/run"
+	"github.com/stretchr/testify/assert"
+)
+
+type localTestAction struct {
+}
+
+func (a *localTestAction) Name() string {
+	return "local-test"
+}
+
+func (a *localTestAction) Run(ctx run.ExecuteContext, params interface{}) error {
+	if v, _ := ctx.GetVar("fail"); v == "true" {
+		return fmt.Errorf("failed by var")
+	}
+	return nil
+}
+
+// RunLocal close fastflow after returned, so we can only run it once
+func TestRunLocal(t *testing.T) {
+	RegisterAction([]run.Action{&localTestAction{}})
+	ret, err := RunLocal(&LocalRunOption{
+		Dag: &entity.Dag{
+			BaseInfo: entity.BaseInfo{ID: "local"},
+			Vars:     entity.DagVars{"fail": {DefaultValue: "false"}},
+			Tasks: []entity.Task{
+				{ID: "task1", ActionName: "local-test"},
+				{ID: "task2", ActionName: "local-test", DependOn: []string{"task1"}},
+			},
+		},
+		Vars:         map[string]string{"fail": "true"},
+		Timeout:      10 * time.Second,
+		PollInterval: 10 * time.Millisecond,
+	})
+	assert.NoError(t, err)
+	assert.False(t, ret.Succeed())
+	assert.Equal(t, entity.DagInstanceStatusFailed, ret.DagIns.Status)
+	if assert.Len(t, ret.TaskIns, 2) {
+		assert.Equal(t, entity.TaskInstanceStatusFailed, ret.TaskIns[0].Status)
+		assert.Equal(t, entity.TaskInstanceStatusInit, ret.TaskIns[1].Status)
+	}
+}
+
+func TestLocalRunResult_Succeed(t *testing.T) {
+	tests := []struct {
+		caseDesc string
+		giveRet  *LocalRunResult
+		wantRet  bool
+	}{
+		{
+			caseDesc: "no tasks",
+			giveRet:  &LocalRunResult{DagIns: &entity.DagInstance{}},
+		},
+		{
+			caseDesc: "succeed",
+			giveRet: &LocalRunResult{
+				DagIns: &entity.DagInstance{},
+				TaskIns: []*entity.TaskInstance{
+					{Status: entity.TaskInstanceStatusSuccess},
+					{Status: entity.TaskInstanceStatusSkipped},
+				},
+			},
+			wantRet: true,
+		},
+		{
+			caseDesc: "failed",
+			giveRet: &LocalRunResult{
+				DagIns: &entity.DagInstance{},
+				TaskIns: []*entity.TaskInstance{
+					{Status: entity.TaskInstanceStatusSuccess},
+					{Status: entity.TaskInstanceStatusCanceled},
+				},
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			assert.Equal(t, tc.wantRet, tc.giveRet.Succeed())
+		})
+	}
+}
@@ -0,0 +1,449 @@
+package actions
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/entity/run"
+)
+
+const (
+	ActionKeyDocker = "ff-docker"
+
+	// DockerOutputExitCode is the output key of exit code
+	DockerOutputExitCode = "exitCode"
+	// DockerOutputStdout is the output key of stdout, it is set only when "outputStdout" is true
+	DockerOutputStdout = "stdout"
+
+	DockerPullMissing = "missing"
+	DockerPullAlways  = "always"
+	DockerPullNever   = "never"
+
+	// DefaultDockerHost is used when neither Docker.Host nor env DOCKER_HOST is set
+	DefaultDockerHost = "unix:///var/run/docker.sock"
+
+	// dockerAPIVersion is supported since docker 20.10
+	dockerAPIVersion = "v1.41"
+)
+
+// dockerCleanupTimeout is the max duration of stopping and removing container after the task instance is canceled
+var dockerCleanupTimeout = 30 * time.Second
+
+// DockerParams, the params are rendered with vars and outputs before running like other actions
+type DockerParams struct {
+	Image string `json:"image"`
+	// Pull is "missing", "always" or "never", default is "missing"
+	Pull       string   `json:"pull"`
+	Entrypoint []string `json:"entrypoint"`
+	Cmd        []string `json:"cmd"`
+	// Env is added to the environment of container after the env of task
+	Env     map[string]string `json:"env"`
+	WorkDir string            `json:"workDir"`
+	// Mounts are bind mounts in "{hostPath}:{containerPath}[:ro]" form
+	Mounts  []string `json:"mounts"`
+	Network string   `json:"network"`
+	// Memory is the memory limit such as "512m" or "2g", empty means no limit
+	Memory string `json:"memory"`
+	// CPUs is the cpu limit such as 1.5, zero means no limit
+	CPUs float64 `json:"cpus"`
+	// Timeout support "d|h|m|s|ms", empty means only the timeout of task
+	Timeout string `json:"timeout"`
+	// KillGracePeriod is the time between SIGTERM and SIGKILL when the container is timed out or canceled,
+	// support "d|h|m|s|ms", default is 10s
+	KillGracePeriod string `json:"killGracePeriod"`
+	// KeepContainer does not remove the container after it exited
+	KeepContainer bool `json:"keepContainer"`
+	// OutputStdout set the stdout to output "stdout", at most MaxStdoutBytes(default 64KB) are kept
+	OutputStdout   bool `json:"outputStdout"`
+	MaxStdoutBytes int  `json:"maxStdoutBytes"`
+}
+
+// Docker action run a container by docker engine api, its stdout and stderr are written to the logs of task instance,
+// and its exit code is set to output "exitCode"
+type Docker struct {
+	// Host is the address of docker daemon such as "unix:///var/run/docker.sock" or "tcp://127.0.0.1:2375",
+	// default is env DOCKER_HOST or DefaultDockerHost
+	Host string
+}
+
+// Name
+func (s *Docker) Name() string {
+	return ActionKeyDocker
+}
+
+// ParameterNew
+func (s *Docker) ParameterNew() interface{} {
+	return &DockerParams{}
+}
+
+// Run
+func (s *Docker) Run(ctx run.ExecuteContext, params interface{}) error {
+	p := params.(*DockerParams)
+	if p.Image == "" {
+		return fmt.Errorf("image cannot be empty")
+	}
+	grace := 10 * time.Second
+	var err error
+	if p.KillGracePeriod != "" {
+		if grace, err = ParseDuration(p.KillGracePeriod); err != nil {
+			return err
+		}
+	}
+	runCtx := ctx.Context()
+	var timeout time.Duration
+	if p.Timeout != "" {
+		if timeout, err = ParseDuration(p.Timeout); err != nil {
+			return err
+		}
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(runCtx, timeout)
+		defer cancel()
+	}
+	client, err := newDockerClient(s.Host)
+	if err != nil {
+		return err
+	}
+	body, err := p.createBody(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := client.pull(runCtx, p.Image, p.Pull); err != nil {
+		return err
+	}
+	var created struct {
+		ID string `json:"Id"`
+	}
+	if err := client.call(runCtx, http.MethodPost, "/containers/create", nil, body, &created); err != nil {
+		return fmt.Errorf("create container failed: %w", err)
+	}
+	id := created.ID
+	if !p.KeepContainer {
+		defer client.cleanup(ctx, id, "remove", func(c context.Context) error {
+			return client.call(c, http.MethodDelete, "/containers/"+id, url.Values{"force": {"1"}}, nil, nil)
+		})
+	}
+	if err := client.call(runCtx, http.MethodPost, "/containers/"+id+"/start", nil, nil, nil); err != nil {
+		return fmt.Errorf("start container failed: %w", err)
+	}
+	ctx.Logger().Infof("started container %s of image %s", shortID(id), p.Image)
+
+	stdout := &limitedBuffer{max: p.MaxStdoutBytes}
+	if stdout.max <= 0 {
+		stdout.max = 64 << 10
+	}
+	logsDone := make(chan struct{})
+	go func() {
+		defer close(logsDone)
+		if err := client.logs(runCtx, id, io.MultiWriter(run.LogWriter(ctx), stdout), run.LogWriter(ctx)); err != nil && runCtx.Err() == nil {
+			ctx.Logger().Warnf("follow logs of container %s failed: %s", shortID(id), err)
+		}
+	}()
+
+	var waited struct {
+		StatusCode int `json:"StatusCode"`
+	}
+	err = client.call(runCtx, http.MethodPost, "/containers/"+id+"/wait", nil, nil, &waited)
+	if runCtx.Err() != nil {
+		client.cleanup(ctx, id, "stop", func(c context.Context) error {
+			t := strconv.Itoa(int(grace / time.Second))
+			return client.call(c, http.MethodPost, "/containers/"+id+"/stop", url.Values{"t": {t}}, nil, nil)
+		})
+		<-logsDone
+		if ctx.Context().Err() != nil {
+			return fmt.Errorf("container is interrupted: %w", ctx.Context().Err())
+		}
+		// it is retried by the retry policy on "timeout" like the timeout of task
+		return fmt.Errorf("container timed out after %s: %w", timeout, context.DeadlineExceeded)
+	}
+	if err != nil {
+		return fmt.Errorf("wait container failed: %w", err)
+	}
+	<-logsDone
+
+	if err := ctx.SetOutput(DockerOutputExitCode, waited.StatusCode); err != nil {
+		ctx.Logger().Warnf("set exit code to output failed: %s", err)
+	}
+	if p.OutputStdout {
+		if stdout.truncated {
+			ctx.Logger().Warnf("stdout exceeds %d bytes, it is truncated", stdout.max)
+		}
+		if err := ctx.SetOutput(DockerOutputStdout, strings.TrimSpace(stdout.String())); err != nil {
+			ctx.Logger().Warnf("set stdout to output failed: %s", err)
+		}
+	}
+	if waited.StatusCode != 0 {
+		return fmt.Errorf("container exited with code %d", waited.StatusCode)
+	}
+	return nil
+}
+
+func (p *DockerParams) createBody(ctx run.ExecuteContext) (map[string]interface{}, error) {
+	hostConfig := map[string]interface{}{}
+	if len(p.Mounts) > 0 {
+		hostConfig["Binds"] = p.Mounts
+	}
+	if p.Network != "" {
+		hostConfig["NetworkMode"] = p.Network
+	}
+	if p.Memory != "" {
+		mem, err := parseByteSize(p.Memory)
+		if err != nil {
+			return nil, err
+		}
+		hostConfig["Memory"] = mem
+	}
+	if p.CPUs > 0 {
+		hostConfig["NanoCpus"] = int64(p.CPUs * 1e9)
+	}
+	body := map[string]interface{}{
+		"Image":      p.Image,
+		"Env":        append(run.EnvList(ctx), envList(p.Env)...),
+		"HostConfig": hostConfig,
+	}
+	if len(p.Entrypoint) > 0 {
+		body["Entrypoint"] = p.Entrypoint
+	}
+	if len(p.Cmd) > 0 {
+		body["Cmd"] = p.Cmd
+	}
+	if p.WorkDir != "" {
+		body["WorkingDir"] = p.WorkDir
+	}
+	if taskIns, ok := entity.CtxRunningTaskIns(ctx.Context()); ok {
+		body["Labels"] = map[string]string{
+			"fastflow.dag-ins-id": taskIns.DagInsID,
+			"fastflow.task-id":    taskIns.TaskID,
+		}
+	}
+	return body, nil
+}
+
+type dockerClient struct {
+	client *http.Client
+	base   string
+}
+
+func newDockerClient(host string) (*dockerClient, error) {
+	if host == "" {
+		host = os.Getenv("DOCKER_HOST")
+	}
+	if host == "" {
+		host = DefaultDockerHost
+	}
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("parse docker host failed: %w", err)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	base := "http://" + u.Host
+	switch u.Scheme {
+	case "unix":
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", u.Path)
+		}
+		base = "http://docker"
+	case "tcp", "http":
+	default:
+		return nil, fmt.Errorf("unsupported docker host: %s", host)
+	}
+	return &dockerClient{client: &http.Client{Transport: transport}, base: base + "/" + dockerAPIVersion}, nil
+}
+
+func (c *dockerClient) do(ctx context.Context, method, path string, query url.Values, body interface{}) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		bs, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("marshal body failed: %w", err)
+		}
+		reader = bytes.NewReader(bs)
+	}
+	u := c.base + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		var msg struct {
+			Message string `json:"message"`
+		}
+		bs, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if json.Unmarshal(bs, &msg) != nil || msg.Message == "" {
+			msg.Message = strings.TrimSpace(string(bs))
+		}
+		return nil, &dockerError{code: resp.StatusCode, msg: msg.Message}
+	}
+	return resp, nil
+}
+
+// call send the request and decode the response to ret when it is not nil
+func (c *dockerClient) call(ctx context.Context, method, path string, query url.Values, body, ret interface{}) error {
+	resp, err := c.do(ctx, method, path, query, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if ret == nil {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(ret)
+}
+
+func (c *dockerClient) pull(ctx context.Context, image, policy string) error {
+	switch policy {
+	case "", DockerPullMissing:
+		err := c.call(ctx, http.MethodGet, "/images/"+image+"/json", nil, nil, nil)
+		if err == nil {
+			return nil
+		}
+		var de *dockerError
+		if !errors.As(err, &de) || de.code != http.StatusNotFound {
+			return fmt.Errorf("inspect image failed: %w", err)
+		}
+	case DockerPullAlways:
+	case DockerPullNever:
+		return nil
+	default:
+		return fmt.Errorf("pull must be %s, %s or %s", DockerPullMissing, DockerPullAlways, DockerPullNever)
+	}
+
+	resp, err := c.do(ctx, http.MethodPost, "/images/create", url.Values{"fromImage": {image}}, nil)
+	if err != nil {
+		return fmt.Errorf("pull image failed: %w", err)
+	}
+	defer resp.Body.Close()
+	// the progress is a stream of json messages, the error is reported by one of them
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var msg struct {
+			Error string `json:"error"`
+		}
+		if err := dec.Decode(&msg); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("pull image failed: %w", err)
+		}
+		if msg.Error != "" {
+			return fmt.Errorf("pull image failed: %s", msg.Error)
+		}
+	}
+}
+
+// logs follow the logs until the container exited, the stream is multiplexed because the container has no tty,
+// each frame has a header of 8 bytes: [stream type, 0, 0, 0, size(4 bytes big endian)]
+func (c *dockerClient) logs(ctx context.Context, id string, stdout, stderr io.Writer) error {
+	resp, err := c.do(ctx, http.MethodGet, "/containers/"+id+"/logs",
+		url.Values{"follow": {"1"}, "stdout": {"1"}, "stderr": {"1"}}, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	r := bufio.NewReader(resp.Body)
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, header); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		w := stdout
+		if header[0] == 2 {
+			w = stderr
+		}
+		if _, err := io.CopyN(w, r, int64(binary.BigEndian.Uint32(header[4:]))); err != nil {
+			return err
+		}
+	}
+}
+
+// cleanup use a new context, because the context of task is done when it is canceled or timed out
+func (c *dockerClient) cleanup(ctx run.ExecuteContext, id, op string, fn func(c context.Context) error) {
+	cleanCtx, cancel := context.WithTimeout(context.Background(), dockerCleanupTimeout)
+	defer cancel()
+	if err := fn(cleanCtx); err != nil {
+		ctx.Logger().Warnf("%s container %s failed: %s", op, shortID(id), err)
+	}
+}
+
+type dockerError struct {
+	code int
+	msg  string
+}
+
+func (e *dockerError) Error() string {
+	return fmt.Sprintf("docker responded %d: %s", e.code, e.msg)
+}
+
+// limitedBuffer keep the first max bytes written to it
+type limitedBuffer struct {
+	bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if left := b.max - b.Len(); left < len(p) {
+		b.truncated = true
+		if left > 0 {
+			b.Buffer.Write(p[:left])
+		}
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
+
+// parseByteSize parse size such as "512m", "1.5g" or "1024", the units are "b|k|m|g" and their "kb|mb|gb" forms
+func parseByteSize(s string) (int64, error) {
+	str := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(s)), "b")
+	unit := int64(1)
+	switch {
+	case strings.HasSuffix(str, "k"):
+		unit = 1 << 10
+	case strings.HasSuffix(str, "m"):
+		unit = 1 << 20
+	case strings.HasSuffix(str, "g"):
+		unit = 1 << 30
+	}
+	if unit > 1 {
+		str = str[:len(str)-1]
+	}
+	v, err := strconv.ParseFloat(str, 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid size: %s", s)
+	}
+	return int64(v * float64(unit)), nil
+}
+
+func shortID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
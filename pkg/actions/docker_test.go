@@ -0,0 +1,268 @@
+package actions
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/entity/run"
+	"github.com/etherealiy/fastflow/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDocker implement the docker engine api used by Docker action
+type fakeDocker struct {
+	images   []string
+	stdout   string
+	stderr   string
+	exitCode int
+	// hang makes the container never exit
+	hang bool
+
+	mutex   sync.Mutex
+	calls   []string
+	created map[string]interface{}
+}
+
+func (d *fakeDocker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/"+dockerAPIVersion)
+	d.mutex.Lock()
+	d.calls = append(d.calls, r.Method+" "+path)
+	d.mutex.Unlock()
+
+	switch {
+	case strings.HasPrefix(path, "/images/") && strings.HasSuffix(path, "/json"):
+		image := strings.TrimSuffix(strings.TrimPrefix(path, "/images/"), "/json")
+		if !containsString(d.images, image) {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"message":"No such image: ` + image + `"}`))
+		}
+	case path == "/images/create":
+		_, _ = w.Write([]byte("{\"status\":\"Pulling\"}\n"))
+		if r.URL.Query().Get("fromImage") == "unknown" {
+			_, _ = w.Write([]byte(`{"error":"manifest unknown"}`))
+		}
+	case path == "/containers/create":
+		d.mutex.Lock()
+		_ = json.NewDecoder(r.Body).Decode(&d.created)
+		d.mutex.Unlock()
+		_, _ = w.Write([]byte(`{"Id":"0123456789abcdef"}`))
+	case strings.HasSuffix(path, "/logs"):
+		for _, f := range []struct {
+			stream byte
+			text   string
+		}{{1, d.stdout}, {2, d.stderr}} {
+			if f.text == "" {
+				continue
+			}
+			header := make([]byte, 8)
+			header[0] = f.stream
+			binary.BigEndian.PutUint32(header[4:], uint32(len(f.text)))
+			_, _ = w.Write(append(header, f.text...))
+		}
+		if d.hang {
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		}
+	case strings.HasSuffix(path, "/wait"):
+		if d.hang {
+			<-r.Context().Done()
+			return
+		}
+		_, _ = fmt.Fprintf(w, `{"StatusCode":%d}`, d.exitCode)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (d *fakeDocker) recorded() []string {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return append([]string{}, d.calls...)
+}
+
+func containsString(s []string, v string) bool {
+	for _, i := range s {
+		if i == v {
+			return true
+		}
+	}
+	return false
+}
+
+func TestDocker_Run(t *testing.T) {
+	tests := []struct {
+		caseDesc    string
+		giveParams  *DockerParams
+		giveDocker  *fakeDocker
+		wantLines   []string
+		wantOutputs map[string]interface{}
+		wantCalls   []string
+		wantCreated map[string]interface{}
+		wantErr     string
+	}{
+		{
+			caseDesc: "succeeded",
+			giveParams: &DockerParams{
+				Image:        "alpine:3",
+				Cmd:          []string{"sh", "-c", "echo hello"},
+				Env:          map[string]string{"MODE": "full"},
+				WorkDir:      "/work",
+				Mounts:       []string{"/data:/data:ro"},
+				Memory:       "512m",
+				CPUs:         1.5,
+				OutputStdout: true,
+			},
+			giveDocker:  &fakeDocker{images: []string{"alpine:3"}, stdout: "hello\n", stderr: "oops\n"},
+			wantLines:   []string{"hello", "oops"},
+			wantOutputs: map[string]interface{}{DockerOutputExitCode: 0, DockerOutputStdout: "hello"},
+			wantCalls: []string{
+				"GET /images/alpine:3/json",
+				"POST /containers/create",
+				"POST /containers/0123456789abcdef/start",
+				"GET /containers/0123456789abcdef/logs",
+				"POST /containers/0123456789abcdef/wait",
+				"DELETE /containers/0123456789abcdef",
+			},
+			wantCreated: map[string]interface{}{
+				"Image":      "alpine:3",
+				"Cmd":        []interface{}{"sh", "-c", "echo hello"},
+				"Env":        []interface{}{"TASK_ENV=task", "MODE=full"},
+				"WorkingDir": "/work",
+				"HostConfig": map[string]interface{}{
+					"Binds":    []interface{}{"/data:/data:ro"},
+					"Memory":   float64(512 << 20),
+					"NanoCpus": float64(1.5e9),
+				},
+				"Labels": map[string]interface{}{"fastflow.dag-ins-id": "dag-ins", "fastflow.task-id": "task"},
+			},
+		},
+		{
+			caseDesc:    "pull missing image and keep container",
+			giveParams:  &DockerParams{Image: "busybox", KeepContainer: true},
+			giveDocker:  &fakeDocker{exitCode: 2},
+			wantOutputs: map[string]interface{}{DockerOutputExitCode: 2},
+			wantCalls: []string{
+				"GET /images/busybox/json",
+				"POST /images/create",
+				"POST /containers/create",
+				"POST /containers/0123456789abcdef/start",
+				"GET /containers/0123456789abcdef/logs",
+				"POST /containers/0123456789abcdef/wait",
+			},
+			wantErr: "container exited with code 2",
+		},
+		{
+			caseDesc:    "pull failed",
+			giveParams:  &DockerParams{Image: "unknown", Pull: DockerPullAlways},
+			giveDocker:  &fakeDocker{},
+			wantOutputs: map[string]interface{}{},
+			wantCalls:   []string{"POST /images/create"},
+			wantErr:     "pull image failed: manifest unknown",
+		},
+		{
+			caseDesc:    "timeout",
+			giveParams:  &DockerParams{Image: "alpine:3", Pull: DockerPullNever, Timeout: "50ms", KillGracePeriod: "1s"},
+			giveDocker:  &fakeDocker{hang: true, stdout: "working\n"},
+			wantLines:   []string{"working"},
+			wantOutputs: map[string]interface{}{},
+			wantCalls: []string{
+				"POST /containers/create",
+				"POST /containers/0123456789abcdef/start",
+				"GET /containers/0123456789abcdef/logs",
+				"POST /containers/0123456789abcdef/wait",
+				"POST /containers/0123456789abcdef/stop",
+				"DELETE /containers/0123456789abcdef",
+			},
+			wantErr: "container timed out after 50ms: context deadline exceeded",
+		},
+		{
+			caseDesc:    "invalid memory",
+			giveParams:  &DockerParams{Image: "alpine:3", Memory: "lots"},
+			giveDocker:  &fakeDocker{},
+			wantOutputs: map[string]interface{}{},
+			wantErr:     "invalid size: lots",
+		},
+		{
+			caseDesc:    "empty image",
+			giveParams:  &DockerParams{},
+			giveDocker:  &fakeDocker{},
+			wantOutputs: map[string]interface{}{},
+			wantErr:     "image cannot be empty",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			// serve on unix socket like the docker daemon
+			sock := filepath.Join(t.TempDir(), "docker.sock")
+			l, err := net.Listen("unix", sock)
+			require.NoError(t, err)
+			srv := httptest.NewUnstartedServer(tc.giveDocker)
+			srv.Listener = l
+			srv.Start()
+			defer srv.Close()
+
+			logger := &writerLogger{Logger: log.GetLogger()}
+			outputs := map[string]interface{}{}
+			taskIns := &entity.TaskInstance{TaskID: "task", DagInsID: "dag-ins"}
+			ctx := run.NewDefExecuteContext(entity.CtxWithRunningTaskIns(context.Background(), taskIns),
+				nil, func(msg string, opt ...run.TraceOp) {}, nil, nil)
+			ctx.SetLogger(logger)
+			ctx.SetEnv(map[string]string{"TASK_ENV": "task"})
+			ctx.SetOutputFunc(func(key string, value interface{}) error {
+				outputs[key] = value
+				return nil
+			})
+
+			begin := time.Now()
+			err = (&Docker{Host: "unix://" + sock}).Run(ctx, tc.giveParams)
+			assert.Less(t, int64(time.Since(begin)), int64(5*time.Second))
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.ElementsMatch(t, tc.wantLines, logger.lines)
+			assert.Equal(t, tc.wantOutputs, outputs)
+			// logs are followed concurrently with waiting
+			assert.ElementsMatch(t, tc.wantCalls, tc.giveDocker.recorded())
+			if tc.wantCreated != nil {
+				assert.Equal(t, tc.wantCreated, tc.giveDocker.created)
+			}
+		})
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		give    string
+		want    int64
+		wantErr bool
+	}{
+		{give: "1024", want: 1024},
+		{give: "512m", want: 512 << 20},
+		{give: "1.5GB", want: 3 << 29},
+		{give: "64k", want: 64 << 10},
+		{give: "-1m", wantErr: true},
+		{give: "m", wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.give, func(t *testing.T) {
+			got, err := parseByteSize(tc.give)
+			assert.Equal(t, tc.wantErr, err != nil)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
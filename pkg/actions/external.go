@@ -0,0 +1,139 @@
+package actions
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/entity/run"
+)
+
+const (
+	ActionKeyExternal = "ff-external"
+
+	// ExternalOutputCallbackToken is the output key of the token which is used to complete the task,
+	// such as "POST /v1/callbacks/<token>"
+	ExternalOutputCallbackToken = "callbackToken"
+)
+
+// ExternalParams, the params are rendered with vars and outputs before running like other actions
+type ExternalParams struct {
+	// Timeout is how long the callback can be completed, support "d|h|m|s|ms", empty means never expires
+	Timeout string `json:"timeout"`
+	// NotifyURL receives a POST of ExternalNotification when the task starts waiting, it is optional
+	NotifyURL string `json:"notifyUrl"`
+	// Message is sent to NotifyURL, such as "approve the deployment of v1.2.0"
+	Message string `json:"message"`
+}
+
+// ExternalNotification is the body sent to ExternalParams.NotifyURL
+type ExternalNotification struct {
+	Token     string `json:"token"`
+	DagInsID  string `json:"dagInsId"`
+	TaskID    string `json:"taskId"`
+	TaskInsID string `json:"taskInsId"`
+	Message   string `json:"message,omitempty"`
+	ExpiresAt int64  `json:"expiresAt,omitempty"`
+}
+
+// External action blocks the task until an external system or approver completes it with the callback token,
+// the task succeeds or fails by the result of callback, see mod.CompleteCallback
+type External struct {
+	// Client is used to notify, default is http.DefaultClient
+	Client *http.Client
+}
+
+// Name
+func (s *External) Name() string {
+	return ActionKeyExternal
+}
+
+// ParameterNew
+func (s *External) ParameterNew() interface{} {
+	return &ExternalParams{}
+}
+
+// Run
+func (s *External) Run(ctx run.ExecuteContext, params interface{}) error {
+	p := params.(*ExternalParams)
+	taskIns, ok := entity.CtxRunningTaskIns(ctx.Context())
+	if !ok {
+		return fmt.Errorf("external action must run in a task instance")
+	}
+
+	// the task is continued, check the callback of current attempt
+	if cb := taskIns.Callback; cb != nil && cb.Attempt == len(taskIns.Attempts) {
+		switch {
+		case cb.Result == entity.TaskInstanceStatusSuccess:
+			ctx.Tracef("callback is completed by %s", cb.Operator)
+			return nil
+		case cb.Result != "":
+			return fmt.Errorf("callback is failed by %s, reason: %s", cb.Operator, cb.Reason)
+		case cb.Expired(time.Now()):
+			return fmt.Errorf("callback expired at %s", time.Unix(cb.ExpiresAt, 0).Format(time.RFC3339))
+		}
+		ctx.Tracef("callback is not completed yet")
+		return fmt.Errorf("waiting for callback: %w", run.ErrBlocked)
+	}
+
+	var ttl time.Duration
+	if p.Timeout != "" {
+		d, err := ParseDuration(p.Timeout)
+		if err != nil {
+			return err
+		}
+		ttl = d
+	}
+	cb, token, err := entity.NewExternalCallback(taskIns, ttl)
+	if err != nil {
+		return err
+	}
+	if err := taskIns.SetCallback(cb); err != nil {
+		return fmt.Errorf("save callback failed: %w", err)
+	}
+	if err := ctx.SetOutput(ExternalOutputCallbackToken, token); err != nil {
+		return fmt.Errorf("set callback token to output failed: %w", err)
+	}
+	if p.NotifyURL != "" {
+		if err := s.notify(ctx, p.NotifyURL, &ExternalNotification{
+			Token:     token,
+			DagInsID:  taskIns.DagInsID,
+			TaskID:    taskIns.TaskID,
+			TaskInsID: taskIns.ID,
+			Message:   p.Message,
+			ExpiresAt: cb.ExpiresAt,
+		}); err != nil {
+			return err
+		}
+	}
+	ctx.Tracef("waiting for callback")
+	return fmt.Errorf("waiting for callback: %w", run.ErrBlocked)
+}
+
+func (s *External) notify(ctx run.ExecuteContext, url string, n *ExternalNotification) error {
+	bs, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx.Context(), http.MethodPost, url, bytes.NewReader(bs))
+	if err != nil {
+		return fmt.Errorf("build notify request failed: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("notify failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("notify failed: status code %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package actions
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/entity/run"
+	"github.com/etherealiy/fastflow/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExternal_Run(t *testing.T) {
+	var notified *ExternalNotification
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		notified = &ExternalNotification{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(notified))
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		caseDesc     string
+		giveParams   *ExternalParams
+		giveCallback *entity.ExternalCallback
+		wantBlocked  bool
+		wantToken    bool
+		wantNotified bool
+		wantErr      string
+	}{
+		{
+			caseDesc:     "start waiting",
+			giveParams:   &ExternalParams{Timeout: "1h", NotifyURL: srv.URL, Message: "approve it"},
+			wantBlocked:  true,
+			wantToken:    true,
+			wantNotified: true,
+			wantErr:      "waiting for callback: task is blocked",
+		},
+		{
+			caseDesc:     "approved",
+			giveParams:   &ExternalParams{},
+			giveCallback: &entity.ExternalCallback{Attempt: 1, Result: entity.TaskInstanceStatusSuccess, Operator: "ops"},
+		},
+		{
+			caseDesc:     "rejected",
+			giveParams:   &ExternalParams{},
+			giveCallback: &entity.ExternalCallback{Attempt: 1, Result: entity.TaskInstanceStatusFailed, Operator: "ops", Reason: "not now"},
+			wantErr:      "callback is failed by ops, reason: not now",
+		},
+		{
+			caseDesc:     "continued before completed",
+			giveParams:   &ExternalParams{},
+			giveCallback: &entity.ExternalCallback{Attempt: 1},
+			wantBlocked:  true,
+			wantErr:      "waiting for callback: task is blocked",
+		},
+		{
+			caseDesc:     "expired",
+			giveParams:   &ExternalParams{},
+			giveCallback: &entity.ExternalCallback{Attempt: 1, ExpiresAt: 1},
+			wantErr:      "callback expired at " + time.Unix(1, 0).Format(time.RFC3339),
+		},
+		{
+			caseDesc:     "callback of previous attempt",
+			giveParams:   &ExternalParams{},
+			giveCallback: &entity.ExternalCallback{Attempt: 0, Result: entity.TaskInstanceStatusFailed},
+			wantBlocked:  true,
+			wantToken:    true,
+			wantErr:      "waiting for callback: task is blocked",
+		},
+		{
+			caseDesc:   "notify failed",
+			giveParams: &ExternalParams{NotifyURL: srv.URL + "/fail"},
+			wantToken:  true,
+			wantErr:    "notify failed: status code 500",
+		},
+		{
+			caseDesc:   "invalid timeout",
+			giveParams: &ExternalParams{Timeout: "soon"},
+			wantErr:    `not a valid duration string: "soon"`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			notified = nil
+			outputs := map[string]interface{}{}
+			taskIns := &entity.TaskInstance{
+				BaseInfo: entity.BaseInfo{ID: "task-ins1"},
+				TaskID:   "approval",
+				DagInsID: "dag-ins",
+				Attempts: []entity.TaskAttempt{{Attempt: 1, Status: entity.TaskInstanceStatusFailed}},
+				Callback: tc.giveCallback,
+			}
+			ctx := run.NewDefExecuteContext(entity.CtxWithRunningTaskIns(context.Background(), taskIns),
+				nil, func(msg string, opt ...run.TraceOp) {}, nil, nil)
+			ctx.SetLogger(log.GetLogger())
+			ctx.SetOutputFunc(func(key string, value interface{}) error {
+				outputs[key] = value
+				return nil
+			})
+
+			err := (&External{}).Run(ctx, tc.giveParams)
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.wantBlocked, errors.Is(err, run.ErrBlocked))
+			if !tc.wantToken {
+				assert.Empty(t, outputs)
+				return
+			}
+			token, _ := outputs[ExternalOutputCallbackToken].(string)
+			if assert.NotNil(t, taskIns.Callback) {
+				assert.True(t, taskIns.Callback.Verify(token))
+				assert.Equal(t, 1, taskIns.Callback.Attempt)
+				assert.Empty(t, taskIns.Callback.Result)
+			}
+			if tc.wantNotified && assert.NotNil(t, notified) {
+				assert.Equal(t, &ExternalNotification{
+					Token:     token,
+					DagInsID:  "dag-ins",
+					TaskID:    "approval",
+					TaskInsID: "task-ins1",
+					Message:   "approve it",
+					ExpiresAt: taskIns.Callback.ExpiresAt,
+				}, notified)
+				assert.NotZero(t, notified.ExpiresAt)
+			}
+		})
+	}
+}
@@ -0,0 +1,307 @@
+package actions
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity/run"
+	"github.com/etherealiy/fastflow/pkg/utils/data"
+)
+
+const (
+	ActionKeyHTTP = "ff-http"
+
+	// HTTPOutputStatusCode is the output key of status code
+	HTTPOutputStatusCode = "statusCode"
+	// HTTPOutputBody is the output key of response body, it is the decoded value when the body is json,
+	// so downstream tasks can use such as "{{ .outputs.<task id>.body.id }}"
+	HTTPOutputBody = "body"
+)
+
+// HTTPParams, the params are rendered with vars and outputs before running like other actions
+type HTTPParams struct {
+	// Method default is GET
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+	// Body is sent as it is when it is a string, otherwise it is encoded to json
+	// and the content type is "application/json" by default
+	Body interface{}    `json:"body"`
+	TLS  *HTTPTLSParams `json:"tls"`
+	// Timeout of each request, support "d|h|m|s|ms", default is 30s
+	Timeout string `json:"timeout"`
+
+	// Retries is the max count of retries when the request failed or the status code is 5xx
+	Retries int `json:"retries"`
+	// RetryInterval support "d|h|m|s|ms", default is 1s
+	RetryInterval string `json:"retryInterval"`
+
+	// ExpectStatus is the status codes of success, default is any 2xx
+	ExpectStatus []int `json:"expectStatus"`
+	// Assertions check the json body, the task fails when any of them fails
+	Assertions []HTTPAssertion `json:"assertions"`
+	// MaxResponseBytes default is 1MB, the task fails when the body is larger
+	MaxResponseBytes int64 `json:"maxResponseBytes"`
+}
+
+// HTTPTLSParams, the certificates and key are in PEM
+type HTTPTLSParams struct {
+	InsecureSkipVerify bool   `json:"insecureSkipVerify"`
+	ServerName         string `json:"serverName"`
+	CACert             string `json:"caCert"`
+	ClientCert         string `json:"clientCert"`
+	ClientKey          string `json:"clientKey"`
+}
+
+// HTTPAssertion check the value of json path such as "$.data.items[0].status" or "data.items.0.status",
+// it only checks the path exists when Equals is nil
+type HTTPAssertion struct {
+	Path   string      `json:"path"`
+	Equals interface{} `json:"equals"`
+}
+
+// HTTP action send a request and check its response, the status code and body are set to outputs
+type HTTP struct {
+	// Client default is a client of the default transport, or a new transport when tls is specified
+	Client *http.Client
+}
+
+// Name
+func (s *HTTP) Name() string {
+	return ActionKeyHTTP
+}
+
+// ParameterNew
+func (s *HTTP) ParameterNew() interface{} {
+	return &HTTPParams{}
+}
+
+// Run
+func (s *HTTP) Run(ctx run.ExecuteContext, params interface{}) error {
+	p := params.(*HTTPParams)
+	if p.URL == "" {
+		return fmt.Errorf("url cannot be empty")
+	}
+	client, err := s.client(p)
+	if err != nil {
+		return err
+	}
+	interval := time.Second
+	if p.RetryInterval != "" {
+		if interval, err = ParseDuration(p.RetryInterval); err != nil {
+			return err
+		}
+	}
+	maxBytes := p.MaxResponseBytes
+	if maxBytes <= 0 {
+		maxBytes = 1 << 20
+	}
+
+	var code int
+	var body []byte
+	for i := 0; ; i++ {
+		code, body, err = s.do(ctx, client, p, maxBytes)
+		if err == nil && code < http.StatusInternalServerError {
+			break
+		}
+		if err == nil {
+			err = data.Transient(fmt.Errorf("server responded %d", code))
+		}
+		if i >= p.Retries {
+			return err
+		}
+		ctx.Logger().Warnf("request %s failed, retry in %s: %s", p.URL, interval, err)
+		select {
+		case <-time.After(interval):
+		case <-ctx.Context().Done():
+			return fmt.Errorf("request is interrupted: %w", ctx.Context().Err())
+		}
+	}
+	ctx.Tracef("%s %s responded %d", p.method(), p.URL, code)
+
+	var value interface{} = string(body)
+	var decoded interface{}
+	if json.Unmarshal(body, &decoded) == nil {
+		value = decoded
+	}
+	for key, v := range map[string]interface{}{HTTPOutputStatusCode: code, HTTPOutputBody: value} {
+		if err := ctx.SetOutput(key, v); err != nil {
+			ctx.Logger().Warnf("set %s to output failed: %s", key, err)
+		}
+	}
+	return p.check(code, body, decoded)
+}
+
+func (s *HTTP) do(ctx run.ExecuteContext, client *http.Client, p *HTTPParams, maxBytes int64) (int, []byte, error) {
+	body, contentType, err := p.body()
+	if err != nil {
+		return 0, nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx.Context(), p.method(), p.URL, body)
+	if err != nil {
+		return 0, nil, fmt.Errorf("new request failed: %w", err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	for k, v := range p.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, nil, data.Transient(fmt.Errorf("send request failed: %w", err))
+	}
+	defer resp.Body.Close()
+	bs, err := io.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
+	if err != nil {
+		return 0, nil, data.Transient(fmt.Errorf("read response failed: %w", err))
+	}
+	if int64(len(bs)) > maxBytes {
+		return 0, nil, fmt.Errorf("response body exceeds %d bytes", maxBytes)
+	}
+	return resp.StatusCode, bs, nil
+}
+
+func (s *HTTP) client(p *HTTPParams) (*http.Client, error) {
+	timeout := 30 * time.Second
+	if p.Timeout != "" {
+		var err error
+		if timeout, err = ParseDuration(p.Timeout); err != nil {
+			return nil, err
+		}
+	}
+	client := &http.Client{Timeout: timeout}
+	if s.Client != nil {
+		*client = *s.Client
+		client.Timeout = timeout
+	}
+	if p.TLS == nil {
+		return client, nil
+	}
+
+	cfg, err := p.TLS.config()
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if t, ok := client.Transport.(*http.Transport); ok {
+		transport = t.Clone()
+	}
+	transport.TLSClientConfig = cfg
+	client.Transport = transport
+	return client, nil
+}
+
+func (p *HTTPParams) method() string {
+	if p.Method == "" {
+		return http.MethodGet
+	}
+	return strings.ToUpper(p.Method)
+}
+
+// body return a new reader each time, so the request can be retried
+func (p *HTTPParams) body() (io.Reader, string, error) {
+	switch b := p.Body.(type) {
+	case nil:
+		return nil, "", nil
+	case string:
+		return strings.NewReader(b), "", nil
+	default:
+		bs, err := json.Marshal(b)
+		if err != nil {
+			return nil, "", fmt.Errorf("marshal body failed: %w", err)
+		}
+		return bytes.NewReader(bs), "application/json", nil
+	}
+}
+
+func (p *HTTPParams) check(code int, body []byte, decoded interface{}) error {
+	if len(p.ExpectStatus) == 0 {
+		if code < 200 || code >= 300 {
+			return fmt.Errorf("unexpected status code %d, body: %s", code, truncate(body, 256))
+		}
+	} else if !containsInt(p.ExpectStatus, code) {
+		return fmt.Errorf("unexpected status code %d, body: %s", code, truncate(body, 256))
+	}
+
+	if len(p.Assertions) > 0 && decoded == nil {
+		return fmt.Errorf("response body is not json, it cannot be asserted")
+	}
+	for _, a := range p.Assertions {
+		v, ok := lookupJSONPath(decoded, a.Path)
+		if !ok {
+			return fmt.Errorf("assertion failed, path %s is not found", a.Path)
+		}
+		if a.Equals != nil && !reflect.DeepEqual(a.Equals, v) {
+			return fmt.Errorf("assertion failed, %s is %v instead of %v", a.Path, v, a.Equals)
+		}
+	}
+	return nil
+}
+
+func (t *HTTPTLSParams) config() (*tls.Config, error) {
+	cfg := &tls.Config{
+		InsecureSkipVerify: t.InsecureSkipVerify,
+		ServerName:         t.ServerName,
+	}
+	if t.CACert != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(t.CACert)) {
+			return nil, fmt.Errorf("ca cert is invalid")
+		}
+		cfg.RootCAs = pool
+	}
+	if t.ClientCert != "" || t.ClientKey != "" {
+		cert, err := tls.X509KeyPair([]byte(t.ClientCert), []byte(t.ClientKey))
+		if err != nil {
+			return nil, fmt.Errorf("client cert or key is invalid: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// lookupJSONPath get the value by the path separated by dots, the index of array can be "items[0]" or "items.0",
+// the leading "$" is optional
+func lookupJSONPath(v interface{}, path string) (interface{}, bool) {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	path = strings.NewReplacer("[", ".", "]", "").Replace(path)
+	if path == "" {
+		return v, true
+	}
+	for _, key := range strings.Split(path, ".") {
+		switch cur := v.(type) {
+		case map[string]interface{}:
+			next, ok := cur[key]
+			if !ok {
+				return nil, false
+			}
+			v = next
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(cur) {
+				return nil, false
+			}
+			v = cur[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+func truncate(bs []byte, n int) string {
+	if len(bs) <= n {
+		return string(bs)
+	}
+	return string(bs[:n]) + "..."
+}
@@ -0,0 +1,198 @@
+package actions
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/etherealiy/fastflow/pkg/entity/run"
+	"github.com/etherealiy/fastflow/pkg/log"
+	"github.com/etherealiy/fastflow/pkg/utils/data"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTP_Run(t *testing.T) {
+	var calls int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/echo", func(w http.ResponseWriter, r *http.Request) {
+		bs, _ := io.ReadAll(r.Body)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"method":      r.Method,
+			"token":       r.Header.Get("X-Token"),
+			"contentType": r.Header.Get("Content-Type"),
+			"body":        string(bs),
+			"items":       []interface{}{map[string]interface{}{"id": 1}},
+		})
+	})
+	mux.HandleFunc("/text", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("/created", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})
+	mux.HandleFunc("/flaky", func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1)%2 == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	})
+	mux.HandleFunc("/down", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	mux.HandleFunc("/missing", func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	tlsSrv := httptest.NewTLSServer(mux)
+	defer tlsSrv.Close()
+	caCert := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tlsSrv.Certificate().Raw}))
+	getEchoBody := map[string]interface{}{
+		"method":      "GET",
+		"token":       "",
+		"contentType": "",
+		"body":        "",
+		"items":       []interface{}{map[string]interface{}{"id": float64(1)}},
+	}
+
+	tests := []struct {
+		caseDesc      string
+		giveParams    *HTTPParams
+		wantStatus    interface{}
+		wantBody      interface{}
+		wantErr       string
+		wantTransient bool
+	}{
+		{
+			caseDesc: "json body and assertions",
+			giveParams: &HTTPParams{
+				Method:  "post",
+				URL:     srv.URL + "/echo",
+				Headers: map[string]string{"X-Token": "secret"},
+				Body:    map[string]interface{}{"a": 1},
+				Assertions: []HTTPAssertion{
+					{Path: "$.method", Equals: "POST"},
+					{Path: "token", Equals: "secret"},
+					{Path: "$.items[0].id", Equals: float64(1)},
+					{Path: "items.0.id"},
+				},
+			},
+			wantStatus: 200,
+			wantBody: map[string]interface{}{
+				"method":      "POST",
+				"token":       "secret",
+				"contentType": "application/json",
+				"body":        `{"a":1}`,
+				"items":       []interface{}{map[string]interface{}{"id": float64(1)}},
+			},
+		},
+		{
+			caseDesc:   "text body",
+			giveParams: &HTTPParams{URL: srv.URL + "/text"},
+			wantStatus: 200,
+			wantBody:   "ok",
+		},
+		{
+			caseDesc:   "assertion not equal",
+			giveParams: &HTTPParams{URL: srv.URL + "/echo", Assertions: []HTTPAssertion{{Path: "$.method", Equals: "POST"}}},
+			wantStatus: 200,
+			wantBody:   getEchoBody,
+			wantErr:    "assertion failed, $.method is GET instead of POST",
+		},
+		{
+			caseDesc:   "assertion path not found",
+			giveParams: &HTTPParams{URL: srv.URL + "/echo", Assertions: []HTTPAssertion{{Path: "$.items[1].id"}}},
+			wantStatus: 200,
+			wantBody:   getEchoBody,
+			wantErr:    "assertion failed, path $.items[1].id is not found",
+		},
+		{
+			caseDesc:   "assert text body",
+			giveParams: &HTTPParams{URL: srv.URL + "/text", Assertions: []HTTPAssertion{{Path: "$"}}},
+			wantStatus: 200,
+			wantBody:   "ok",
+			wantErr:    "response body is not json, it cannot be asserted",
+		},
+		{
+			caseDesc:   "expect status",
+			giveParams: &HTTPParams{Method: http.MethodPut, URL: srv.URL + "/created", ExpectStatus: []int{201}},
+			wantStatus: 201,
+			wantBody:   "",
+		},
+		{
+			caseDesc:   "unexpected status",
+			giveParams: &HTTPParams{URL: srv.URL + "/missing"},
+			wantStatus: 404,
+			wantBody:   "404 page not found\n",
+			wantErr:    "unexpected status code 404, body: 404 page not found\n",
+		},
+		{
+			caseDesc:   "retry on 5xx",
+			giveParams: &HTTPParams{URL: srv.URL + "/flaky", Retries: 1, RetryInterval: "1ms"},
+			wantStatus: 200,
+			wantBody:   map[string]interface{}{"ok": true},
+		},
+		{
+			caseDesc:      "retries exhausted",
+			giveParams:    &HTTPParams{URL: srv.URL + "/down", Retries: 2, RetryInterval: "1ms"},
+			wantErr:       "server responded 503",
+			wantTransient: true,
+		},
+		{
+			caseDesc:   "response too large",
+			giveParams: &HTTPParams{URL: srv.URL + "/echo", MaxResponseBytes: 10},
+			wantErr:    "response body exceeds 10 bytes",
+		},
+		{
+			caseDesc:   "tls with ca cert",
+			giveParams: &HTTPParams{URL: tlsSrv.URL + "/text", TLS: &HTTPTLSParams{CACert: caCert}},
+			wantStatus: 200,
+			wantBody:   "ok",
+		},
+		{
+			caseDesc:   "tls insecure skip verify",
+			giveParams: &HTTPParams{URL: tlsSrv.URL + "/text", TLS: &HTTPTLSParams{InsecureSkipVerify: true}},
+			wantStatus: 200,
+			wantBody:   "ok",
+		},
+		{
+			caseDesc:   "invalid ca cert",
+			giveParams: &HTTPParams{URL: tlsSrv.URL + "/text", TLS: &HTTPTLSParams{CACert: "invalid"}},
+			wantErr:    "ca cert is invalid",
+		},
+		{
+			caseDesc:   "empty url",
+			giveParams: &HTTPParams{},
+			wantErr:    "url cannot be empty",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			outputs := map[string]interface{}{}
+			ctx := run.NewDefExecuteContext(context.Background(), nil, func(msg string, opt ...run.TraceOp) {}, nil, nil)
+			ctx.SetLogger(log.GetLogger())
+			ctx.SetOutputFunc(func(key string, value interface{}) error {
+				outputs[key] = value
+				return nil
+			})
+
+			err := (&HTTP{}).Run(ctx, tc.giveParams)
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.wantTransient, errors.Is(err, data.ErrDataTransient))
+			assert.Equal(t, tc.wantStatus, outputs[HTTPOutputStatusCode])
+			assert.Equal(t, tc.wantBody, outputs[HTTPOutputBody])
+		})
+	}
+}
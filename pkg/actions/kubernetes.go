@@ -0,0 +1,298 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/entity/run"
+)
+
+const (
+	ActionKeyKubernetes = "ff-kubernetes"
+
+	// KubernetesOutputName is the output key of the name of created job or pod
+	KubernetesOutputName = "name"
+	// KubernetesOutputExitCode is the output key of exit code, it is the first non-zero exit code of containers,
+	// or 0 when all of them succeeded
+	KubernetesOutputExitCode = "exitCode"
+
+	KubernetesKindJob = "Job"
+	KubernetesKindPod = "Pod"
+
+	KubernetesPhasePending   = "Pending"
+	KubernetesPhaseRunning   = "Running"
+	KubernetesPhaseSucceeded = "Succeeded"
+	KubernetesPhaseFailed    = "Failed"
+
+	// KubernetesLabelDagInsID and KubernetesLabelTaskID are added to the labels of created job or pod
+	KubernetesLabelDagInsID = "fastflow/dag-ins-id"
+	KubernetesLabelTaskID   = "fastflow/task-id"
+)
+
+// kubernetesCleanupTimeout is the max duration of deleting job or pod after the task instance is canceled
+var kubernetesCleanupTimeout = 30 * time.Second
+
+// KubernetesClient is the subset of kubernetes api used by Kubernetes action,
+// fastflow does not depend on client-go, so you need to adapt "k8s.io/client-go/kubernetes.Interface" to it
+type KubernetesClient interface {
+	// Create create the job or pod from the manifest, it returns the name because the manifest
+	// may use "metadata.generateName"
+	Create(ctx context.Context, namespace string, manifest map[string]interface{}) (name string, err error)
+	// Get return the status of job or pod, including its pods
+	Get(ctx context.Context, namespace, kind, name string) (*KubernetesStatus, error)
+	// StreamLogs follow the logs of container from the beginning until it terminates
+	StreamLogs(ctx context.Context, namespace, pod, container string) (io.ReadCloser, error)
+	// Delete delete the job or pod, the pods of job should be deleted too(propagation policy "Background")
+	Delete(ctx context.Context, namespace, kind, name string) error
+}
+
+// KubernetesStatus
+type KubernetesStatus struct {
+	// Phase is one of KubernetesPhase*, job is succeeded or failed when it has the condition "Complete" or "Failed"
+	Phase string
+	// Reason of failure, such as "BackoffLimitExceeded"
+	Reason string
+	Pods   []KubernetesPod
+}
+
+// KubernetesPod
+type KubernetesPod struct {
+	Name       string
+	Containers []KubernetesContainer
+}
+
+// KubernetesContainer
+type KubernetesContainer struct {
+	Name string
+	// Started is true when the container is running or terminated, its logs can be streamed then
+	Started bool
+	// ExitCode is nil until the container is terminated
+	ExitCode *int
+}
+
+// KubernetesParams, the manifest is rendered with vars and outputs before running like other params
+type KubernetesParams struct {
+	// Namespace default is the namespace of manifest, or "default"
+	Namespace string `json:"namespace"`
+	// Manifest is a Job or Pod, when both of "metadata.name" and "metadata.generateName" are empty,
+	// "metadata.generateName" is "ff-{taskId}-"
+	Manifest map[string]interface{} `json:"manifest"`
+	// PollInterval is the interval of getting status, support "d|h|m|s|ms", default is 2s
+	PollInterval string `json:"pollInterval"`
+	// DeleteOnFinish delete the job or pod after it finished, they are always deleted when the task is canceled or timed out
+	DeleteOnFinish bool `json:"deleteOnFinish"`
+}
+
+// Kubernetes action create a job or pod and wait for it finished, the logs of containers are written to the logs
+// of task instance. It is not registered by default because it needs a client.
+//
+//	fastflow.RegisterAction([]run.Action{&actions.Kubernetes{Client: myKubernetesClient}})
+type Kubernetes struct {
+	Client KubernetesClient
+}
+
+// Name
+func (s *Kubernetes) Name() string {
+	return ActionKeyKubernetes
+}
+
+// ParameterNew
+func (s *Kubernetes) ParameterNew() interface{} {
+	return &KubernetesParams{}
+}
+
+// Run
+func (s *Kubernetes) Run(ctx run.ExecuteContext, params interface{}) error {
+	if s.Client == nil {
+		return fmt.Errorf("kubernetes client cannot be nil")
+	}
+	p := params.(*KubernetesParams)
+	kind, _ := p.Manifest["kind"].(string)
+	if kind != KubernetesKindJob && kind != KubernetesKindPod {
+		return fmt.Errorf("kind of manifest must be %s or %s", KubernetesKindJob, KubernetesKindPod)
+	}
+	interval := 2 * time.Second
+	if p.PollInterval != "" {
+		var err error
+		if interval, err = ParseDuration(p.PollInterval); err != nil {
+			return err
+		}
+	}
+	namespace := p.namespace()
+	p.label(ctx)
+
+	name, err := s.Client.Create(ctx.Context(), namespace, p.Manifest)
+	if err != nil {
+		return fmt.Errorf("create %s failed: %w", strings.ToLower(kind), err)
+	}
+	if err := ctx.SetOutput(KubernetesOutputName, name); err != nil {
+		ctx.Logger().Warnf("set name to output failed: %s", err)
+	}
+	ctx.Tracef("created %s %s/%s", strings.ToLower(kind), namespace, name)
+
+	logs := &kubernetesLogs{client: s.Client, namespace: namespace, streamed: map[string]bool{}}
+	status, err := s.wait(ctx, logs, namespace, kind, name, interval)
+	if err != nil {
+		logs.stop()
+		s.delete(ctx, namespace, kind, name)
+		return err
+	}
+	logs.drain(ctx, status)
+	if p.DeleteOnFinish {
+		s.delete(ctx, namespace, kind, name)
+	}
+
+	code := status.exitCode()
+	if err := ctx.SetOutput(KubernetesOutputExitCode, code); err != nil {
+		ctx.Logger().Warnf("set exit code to output failed: %s", err)
+	}
+	if status.Phase == KubernetesPhaseFailed {
+		return fmt.Errorf("%s %s failed, reason: %s, exit code: %d", strings.ToLower(kind), name, status.Reason, code)
+	}
+	return nil
+}
+
+// wait poll the status until the job or pod finished, it streams the logs of containers once they started
+func (s *Kubernetes) wait(ctx run.ExecuteContext, logs *kubernetesLogs, namespace, kind, name string,
+	interval time.Duration) (*KubernetesStatus, error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		status, err := s.Client.Get(ctx.Context(), namespace, kind, name)
+		if err != nil && ctx.Context().Err() == nil {
+			ctx.Logger().Warnf("get %s %s failed: %s", strings.ToLower(kind), name, err)
+		}
+		if err == nil {
+			logs.follow(ctx, status)
+			if status.Phase == KubernetesPhaseSucceeded || status.Phase == KubernetesPhaseFailed {
+				return status, nil
+			}
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Context().Done():
+			return nil, fmt.Errorf("%s %s is interrupted: %w", strings.ToLower(kind), name, ctx.Context().Err())
+		}
+	}
+}
+
+// delete use a new context, because the context of task is done when it is canceled
+func (s *Kubernetes) delete(ctx run.ExecuteContext, namespace, kind, name string) {
+	delCtx, cancel := context.WithTimeout(context.Background(), kubernetesCleanupTimeout)
+	defer cancel()
+	if err := s.Client.Delete(delCtx, namespace, kind, name); err != nil {
+		ctx.Logger().Warnf("delete %s %s failed: %s", strings.ToLower(kind), name, err)
+		return
+	}
+	ctx.Tracef("deleted %s %s/%s", strings.ToLower(kind), namespace, name)
+}
+
+func (p *KubernetesParams) namespace() string {
+	if p.Namespace != "" {
+		return p.Namespace
+	}
+	if meta, ok := p.Manifest["metadata"].(map[string]interface{}); ok {
+		if ns, ok := meta["namespace"].(string); ok && ns != "" {
+			return ns
+		}
+	}
+	return "default"
+}
+
+// label add the labels of task instance and the default generate name to manifest
+func (p *KubernetesParams) label(ctx run.ExecuteContext) {
+	taskIns, ok := entity.CtxRunningTaskIns(ctx.Context())
+	if !ok {
+		return
+	}
+	meta, ok := p.Manifest["metadata"].(map[string]interface{})
+	if !ok {
+		meta = map[string]interface{}{}
+		p.Manifest["metadata"] = meta
+	}
+	labels, ok := meta["labels"].(map[string]interface{})
+	if !ok {
+		labels = map[string]interface{}{}
+		meta["labels"] = labels
+	}
+	labels[KubernetesLabelDagInsID] = taskIns.DagInsID
+	labels[KubernetesLabelTaskID] = taskIns.TaskID
+	if meta["name"] == nil && meta["generateName"] == nil {
+		meta["generateName"] = "ff-" + strings.ToLower(taskIns.TaskID) + "-"
+	}
+}
+
+func (s *KubernetesStatus) exitCode() int {
+	for _, pod := range s.Pods {
+		for _, c := range pod.Containers {
+			if c.ExitCode != nil && *c.ExitCode != 0 {
+				return *c.ExitCode
+			}
+		}
+	}
+	return 0
+}
+
+// kubernetesDrainTimeout is the max duration of waiting for the logs after the job or pod finished
+var kubernetesDrainTimeout = 10 * time.Second
+
+// kubernetesLogs stream the logs of each container once
+type kubernetesLogs struct {
+	client    KubernetesClient
+	namespace string
+	streamed  map[string]bool
+	cancels   []context.CancelFunc
+	wg        sync.WaitGroup
+}
+
+func (l *kubernetesLogs) follow(ctx run.ExecuteContext, status *KubernetesStatus) {
+	for _, pod := range status.Pods {
+		for _, c := range pod.Containers {
+			key := pod.Name + "/" + c.Name
+			if !c.Started || l.streamed[key] {
+				continue
+			}
+			l.streamed[key] = true
+			streamCtx, cancel := context.WithCancel(ctx.Context())
+			l.cancels = append(l.cancels, cancel)
+			l.wg.Add(1)
+			go func(pod, container string) {
+				defer l.wg.Done()
+				rc, err := l.client.StreamLogs(streamCtx, l.namespace, pod, container)
+				if err != nil {
+					ctx.Logger().Warnf("stream logs of %s/%s failed: %s", pod, container, err)
+					return
+				}
+				defer rc.Close()
+				_, _ = io.Copy(run.LogWriter(ctx), rc)
+			}(pod.Name, c.Name)
+		}
+	}
+}
+
+// drain follow the containers which finished between two polls, then wait for all logs are copied
+func (l *kubernetesLogs) drain(ctx run.ExecuteContext, status *KubernetesStatus) {
+	l.follow(ctx, status)
+	done := make(chan struct{})
+	go func() {
+		l.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(kubernetesDrainTimeout):
+		ctx.Logger().Warnf("logs are not finished in %s", kubernetesDrainTimeout)
+	}
+	l.stop()
+}
+
+func (l *kubernetesLogs) stop() {
+	for _, cancel := range l.cancels {
+		cancel()
+	}
+}
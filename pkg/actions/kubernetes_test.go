@@ -0,0 +1,182 @@
+package actions
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/entity/run"
+	"github.com/etherealiy/fastflow/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeKubernetesClient struct {
+	// statuses are returned one by one, the last one is returned repeatedly
+	statuses  []*KubernetesStatus
+	logs      map[string]string
+	createErr error
+
+	mutex   sync.Mutex
+	created map[string]interface{}
+	gets    int
+	deleted []string
+}
+
+func (c *fakeKubernetesClient) Create(ctx context.Context, namespace string, manifest map[string]interface{}) (string, error) {
+	if c.createErr != nil {
+		return "", c.createErr
+	}
+	c.created = manifest
+	return "job-1", nil
+}
+
+func (c *fakeKubernetesClient) Get(ctx context.Context, namespace, kind, name string) (*KubernetesStatus, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	i := c.gets
+	if i >= len(c.statuses) {
+		i = len(c.statuses) - 1
+	}
+	c.gets++
+	return c.statuses[i], nil
+}
+
+func (c *fakeKubernetesClient) StreamLogs(ctx context.Context, namespace, pod, container string) (io.ReadCloser, error) {
+	return io.NopCloser(strings.NewReader(c.logs[pod+"/"+container])), nil
+}
+
+func (c *fakeKubernetesClient) Delete(ctx context.Context, namespace, kind, name string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.deleted = append(c.deleted, namespace+"/"+kind+"/"+name)
+	return ctx.Err()
+}
+
+func TestKubernetes_Run(t *testing.T) {
+	zero, one := 0, 1
+	running := &KubernetesStatus{Phase: KubernetesPhaseRunning, Pods: []KubernetesPod{
+		{Name: "pod-1", Containers: []KubernetesContainer{{Name: "main", Started: true}, {Name: "sidecar"}}},
+	}}
+	succeeded := &KubernetesStatus{Phase: KubernetesPhaseSucceeded, Pods: []KubernetesPod{
+		{Name: "pod-1", Containers: []KubernetesContainer{{Name: "main", Started: true, ExitCode: &zero}, {Name: "sidecar", Started: true, ExitCode: &zero}}},
+	}}
+	failed := &KubernetesStatus{Phase: KubernetesPhaseFailed, Reason: "BackoffLimitExceeded", Pods: []KubernetesPod{
+		{Name: "pod-1", Containers: []KubernetesContainer{{Name: "main", Started: true, ExitCode: &one}}},
+	}}
+	job := func() map[string]interface{} {
+		return map[string]interface{}{"kind": "Job", "metadata": map[string]interface{}{"namespace": "batch"}}
+	}
+
+	tests := []struct {
+		caseDesc     string
+		giveParams   *KubernetesParams
+		giveClient   *fakeKubernetesClient
+		giveCancel   bool
+		wantLines    []string
+		wantOutputs  map[string]interface{}
+		wantMetadata map[string]interface{}
+		wantDeleted  []string
+		wantErr      string
+	}{
+		{
+			caseDesc:   "succeeded",
+			giveParams: &KubernetesParams{Manifest: job(), PollInterval: "1ms", DeleteOnFinish: true},
+			giveClient: &fakeKubernetesClient{
+				statuses: []*KubernetesStatus{{Phase: KubernetesPhasePending}, running, succeeded},
+				logs:     map[string]string{"pod-1/main": "hello\n", "pod-1/sidecar": "ready\n"},
+			},
+			wantLines:   []string{"hello", "ready"},
+			wantOutputs: map[string]interface{}{KubernetesOutputName: "job-1", KubernetesOutputExitCode: 0},
+			wantMetadata: map[string]interface{}{
+				"namespace":    "batch",
+				"generateName": "ff-task-",
+				"labels":       map[string]interface{}{KubernetesLabelDagInsID: "dag-ins", KubernetesLabelTaskID: "Task"},
+			},
+			wantDeleted: []string{"batch/Job/job-1"},
+		},
+		{
+			caseDesc: "failed",
+			giveParams: &KubernetesParams{
+				Namespace:    "ns",
+				Manifest:     map[string]interface{}{"kind": "Pod", "metadata": map[string]interface{}{"name": "pod"}},
+				PollInterval: "1ms",
+			},
+			giveClient: &fakeKubernetesClient{
+				statuses: []*KubernetesStatus{failed},
+				logs:     map[string]string{"pod-1/main": "oops\n"},
+			},
+			wantLines:   []string{"oops"},
+			wantOutputs: map[string]interface{}{KubernetesOutputName: "job-1", KubernetesOutputExitCode: 1},
+			wantMetadata: map[string]interface{}{
+				"name":   "pod",
+				"labels": map[string]interface{}{KubernetesLabelDagInsID: "dag-ins", KubernetesLabelTaskID: "Task"},
+			},
+			wantErr: "pod job-1 failed, reason: BackoffLimitExceeded, exit code: 1",
+		},
+		{
+			caseDesc:    "canceled",
+			giveParams:  &KubernetesParams{Manifest: job(), PollInterval: "1ms"},
+			giveClient:  &fakeKubernetesClient{statuses: []*KubernetesStatus{{Phase: KubernetesPhasePending}}},
+			giveCancel:  true,
+			wantOutputs: map[string]interface{}{KubernetesOutputName: "job-1"},
+			wantMetadata: map[string]interface{}{
+				"namespace":    "batch",
+				"generateName": "ff-task-",
+				"labels":       map[string]interface{}{KubernetesLabelDagInsID: "dag-ins", KubernetesLabelTaskID: "Task"},
+			},
+			wantDeleted: []string{"batch/Job/job-1"},
+			wantErr:     "job job-1 is interrupted: context canceled",
+		},
+		{
+			caseDesc:    "create failed",
+			giveParams:  &KubernetesParams{Manifest: job()},
+			giveClient:  &fakeKubernetesClient{createErr: errors.New("forbidden")},
+			wantOutputs: map[string]interface{}{},
+			wantErr:     "create job failed: forbidden",
+		},
+		{
+			caseDesc:    "invalid kind",
+			giveParams:  &KubernetesParams{Manifest: map[string]interface{}{"kind": "Deployment"}},
+			giveClient:  &fakeKubernetesClient{},
+			wantOutputs: map[string]interface{}{},
+			wantErr:     "kind of manifest must be Job or Pod",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			logger := &writerLogger{Logger: log.GetLogger()}
+			outputs := map[string]interface{}{}
+			taskIns := &entity.TaskInstance{TaskID: "Task", DagInsID: "dag-ins"}
+			c, cancel := context.WithCancel(entity.CtxWithRunningTaskIns(context.Background(), taskIns))
+			defer cancel()
+			ctx := run.NewDefExecuteContext(c, nil, func(msg string, opt ...run.TraceOp) {}, nil, nil)
+			ctx.SetLogger(logger)
+			ctx.SetOutputFunc(func(key string, value interface{}) error {
+				outputs[key] = value
+				if tc.giveCancel {
+					cancel()
+				}
+				return nil
+			})
+
+			err := (&Kubernetes{Client: tc.giveClient}).Run(ctx, tc.giveParams)
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.ElementsMatch(t, tc.wantLines, logger.lines)
+			assert.Equal(t, tc.wantOutputs, outputs)
+			if tc.wantMetadata != nil {
+				assert.Equal(t, tc.wantMetadata, tc.giveClient.created["metadata"])
+			}
+			// deleting uses a new context, so it works after the task is canceled
+			assert.Equal(t, tc.wantDeleted, tc.giveClient.deleted)
+		})
+	}
+}
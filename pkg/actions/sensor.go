@@ -0,0 +1,340 @@
+package actions
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/entity/run"
+)
+
+const (
+	ActionKeyTimeSensor = "ff-time-sensor"
+	ActionKeyFileSensor = "ff-file-sensor"
+	ActionKeyS3Sensor   = "ff-s3-sensor"
+	ActionKeyHTTPSensor = "ff-http-sensor"
+	ActionKeySQLSensor  = "ff-sql-sensor"
+
+	// FileSensorOutputFiles is the output key of the files matched by FileSensor
+	FileSensorOutputFiles = "files"
+
+	defaultPokeInterval = 30 * time.Second
+)
+
+// SensorParams is shared by all sensors, the task instance is rescheduled between pokes,
+// so the worker is not occupied while waiting
+type SensorParams struct {
+	// PokeInterval support "d|h|m|s|ms", default is 30s
+	PokeInterval string `json:"pokeInterval"`
+	// Timeout is how long the sensor waits since its first poke, support "d|h|m|s|ms", empty means never
+	Timeout string `json:"timeout"`
+}
+
+// sensorPoke check the condition once, wait is the suggested duration before next poke, zero means the poke interval
+type sensorPoke func(ctx context.Context) (met bool, wait time.Duration, err error)
+
+// sense poke once, it returns nil when the condition is met, otherwise the task instance is rescheduled
+// until the timeout
+func sense(ctx run.ExecuteContext, p *SensorParams, poke sensorPoke) error {
+	interval := defaultPokeInterval
+	if p.PokeInterval != "" {
+		d, err := ParseDuration(p.PokeInterval)
+		if err != nil {
+			return err
+		}
+		interval = d
+	}
+	var timeout time.Duration
+	if p.Timeout != "" {
+		d, err := ParseDuration(p.Timeout)
+		if err != nil {
+			return err
+		}
+		timeout = d
+	}
+	taskIns, ok := entity.CtxRunningTaskIns(ctx.Context())
+	if !ok {
+		return fmt.Errorf("sensor must run in a task instance")
+	}
+
+	now := time.Now()
+	state := taskIns.Sensor
+	if state == nil || state.Attempt != len(taskIns.Attempts) {
+		state = &entity.SensorState{Attempt: len(taskIns.Attempts), StartedAt: now.Unix()}
+	}
+	state.Pokes++
+	state.LastPokedAt = now.Unix()
+
+	met, wait, err := poke(ctx.Context())
+	if err != nil {
+		return err
+	}
+	if met {
+		ctx.Tracef("condition is met after %d pokes", state.Pokes)
+		return nil
+	}
+	elapsed := now.Sub(time.Unix(state.StartedAt, 0))
+	if timeout > 0 && elapsed >= timeout {
+		return fmt.Errorf("sensor timed out after %s, pokes: %d", timeout, state.Pokes)
+	}
+
+	if wait > 0 && (p.PokeInterval == "" || wait < interval) {
+		interval = wait
+	}
+	if timeout > 0 && elapsed+interval > timeout {
+		interval = timeout - elapsed
+	}
+	if err := taskIns.SetSensor(state); err != nil {
+		return fmt.Errorf("save sensor state failed: %w", err)
+	}
+	ctx.Logger().Infof("condition is not met, poke again in %s", interval)
+	return run.Reschedule(interval)
+}
+
+// TimeSensorParams
+type TimeSensorParams struct {
+	SensorParams `json:",squash"`
+	// Time in RFC3339 such as "2022-01-02T06:00:00+08:00", it is usually rendered from logical date,
+	// the next poke is at the time when PokeInterval is not specified
+	Time string `json:"time"`
+}
+
+// TimeSensor wait until the time is reached
+type TimeSensor struct {
+}
+
+// Name
+func (s *TimeSensor) Name() string {
+	return ActionKeyTimeSensor
+}
+
+// ParameterNew
+func (s *TimeSensor) ParameterNew() interface{} {
+	return &TimeSensorParams{}
+}
+
+// Run
+func (s *TimeSensor) Run(ctx run.ExecuteContext, params interface{}) error {
+	p := params.(*TimeSensorParams)
+	target, err := time.Parse(time.RFC3339, p.Time)
+	if err != nil {
+		return fmt.Errorf("time is invalid: %w", err)
+	}
+	return sense(ctx, &p.SensorParams, func(context.Context) (bool, time.Duration, error) {
+		wait := time.Until(target)
+		return wait <= 0, wait, nil
+	})
+}
+
+// FileSensorParams
+type FileSensorParams struct {
+	SensorParams `json:",squash"`
+	// Path support the patterns of filepath.Match, such as "/data/{{ .ds }}/*.csv"
+	Path string `json:"path"`
+}
+
+// FileSensor wait until any file matches the path on the worker, the matched files are set to output "files"
+type FileSensor struct {
+}
+
+// Name
+func (s *FileSensor) Name() string {
+	return ActionKeyFileSensor
+}
+
+// ParameterNew
+func (s *FileSensor) ParameterNew() interface{} {
+	return &FileSensorParams{}
+}
+
+// Run
+func (s *FileSensor) Run(ctx run.ExecuteContext, params interface{}) error {
+	p := params.(*FileSensorParams)
+	if p.Path == "" {
+		return fmt.Errorf("path cannot be empty")
+	}
+	return sense(ctx, &p.SensorParams, func(context.Context) (bool, time.Duration, error) {
+		files, err := filepath.Glob(p.Path)
+		if err != nil {
+			return false, 0, fmt.Errorf("path is invalid: %w", err)
+		}
+		if len(files) == 0 {
+			return false, 0, nil
+		}
+		if err := ctx.SetOutput(FileSensorOutputFiles, files); err != nil {
+			ctx.Logger().Warnf("set %s to output failed: %s", FileSensorOutputFiles, err)
+		}
+		return true, 0, nil
+	})
+}
+
+// S3Client is used by S3Sensor, fastflow does not depend on aws sdk, so you need to adapt such as
+// "HeadObject" of "github.com/aws/aws-sdk-go-v2/service/s3" to it
+type S3Client interface {
+	// ObjectExists return false without error when the object is not found
+	ObjectExists(ctx context.Context, bucket, key string) (bool, error)
+}
+
+// S3SensorParams
+type S3SensorParams struct {
+	SensorParams `json:",squash"`
+	Bucket       string `json:"bucket"`
+	Key          string `json:"key"`
+}
+
+// S3Sensor wait until the object exists, it is not registered by default because it needs a client
+type S3Sensor struct {
+	Client S3Client
+}
+
+// Name
+func (s *S3Sensor) Name() string {
+	return ActionKeyS3Sensor
+}
+
+// ParameterNew
+func (s *S3Sensor) ParameterNew() interface{} {
+	return &S3SensorParams{}
+}
+
+// Run
+func (s *S3Sensor) Run(ctx run.ExecuteContext, params interface{}) error {
+	p := params.(*S3SensorParams)
+	if s.Client == nil {
+		return fmt.Errorf("client of s3 sensor is not set")
+	}
+	if p.Bucket == "" || p.Key == "" {
+		return fmt.Errorf("bucket and key cannot be empty")
+	}
+	return sense(ctx, &p.SensorParams, func(c context.Context) (bool, time.Duration, error) {
+		ok, err := s.Client.ObjectExists(c, p.Bucket, p.Key)
+		if err != nil {
+			return false, 0, fmt.Errorf("check object s3://%s/%s failed: %w", p.Bucket, p.Key, err)
+		}
+		return ok, 0, nil
+	})
+}
+
+// HTTPSensorParams
+type HTTPSensorParams struct {
+	SensorParams `json:",squash"`
+	// Request is the same as the params of HTTP action except retries, the condition is met when
+	// the response is expected and passes the assertions, its status code and body are set to outputs
+	Request HTTPParams `json:"request"`
+}
+
+// HTTPSensor poll an endpoint until it responds as expected, such as 200
+type HTTPSensor struct {
+	HTTP
+}
+
+// Name
+func (s *HTTPSensor) Name() string {
+	return ActionKeyHTTPSensor
+}
+
+// ParameterNew
+func (s *HTTPSensor) ParameterNew() interface{} {
+	return &HTTPSensorParams{}
+}
+
+// Run
+func (s *HTTPSensor) Run(ctx run.ExecuteContext, params interface{}) error {
+	p := params.(*HTTPSensorParams)
+	if p.Request.URL == "" {
+		return fmt.Errorf("url cannot be empty")
+	}
+	client, err := s.client(&p.Request)
+	if err != nil {
+		return err
+	}
+	maxBytes := p.Request.MaxResponseBytes
+	if maxBytes <= 0 {
+		maxBytes = 1 << 20
+	}
+	return sense(ctx, &p.SensorParams, func(context.Context) (bool, time.Duration, error) {
+		code, body, err := s.do(ctx, client, &p.Request, maxBytes)
+		if err != nil {
+			// the endpoint may be not ready yet
+			ctx.Logger().Infof("request %s failed: %s", p.Request.URL, err)
+			return false, 0, nil
+		}
+		var decoded interface{}
+		_ = json.Unmarshal(body, &decoded)
+		if err := p.Request.check(code, body, decoded); err != nil {
+			ctx.Logger().Infof("%s %s responded %d: %s", p.Request.method(), p.Request.URL, code, err)
+			return false, 0, nil
+		}
+		var value interface{} = string(body)
+		if decoded != nil {
+			value = decoded
+		}
+		for key, v := range map[string]interface{}{HTTPOutputStatusCode: code, HTTPOutputBody: value} {
+			if err := ctx.SetOutput(key, v); err != nil {
+				ctx.Logger().Warnf("set %s to output failed: %s", key, err)
+			}
+		}
+		return true, 0, nil
+	})
+}
+
+// SQLSensorParams
+type SQLSensorParams struct {
+	SensorParams `json:",squash"`
+	// DSN is the same as SQL action
+	DSN string `json:"dsn"`
+	// SQL is a query, the condition is met when it returns any row, the first row is set to output "firstRow"
+	SQL    string                 `json:"sql"`
+	Params map[string]interface{} `json:"params"`
+}
+
+// SQLSensor poll a query until it returns rows, the connections are pooled like SQL action
+type SQLSensor struct {
+	SQL
+}
+
+// Name
+func (s *SQLSensor) Name() string {
+	return ActionKeySQLSensor
+}
+
+// ParameterNew
+func (s *SQLSensor) ParameterNew() interface{} {
+	return &SQLSensorParams{}
+}
+
+// Run
+func (s *SQLSensor) Run(ctx run.ExecuteContext, params interface{}) error {
+	p := params.(*SQLSensorParams)
+	driver, dsn, err := s.driver(p.DSN)
+	if err != nil {
+		return err
+	}
+	stmts, err := parseSQL(p.SQL, p.Params, driver != "mysql")
+	if err != nil {
+		return err
+	}
+	if len(stmts) != 1 {
+		return fmt.Errorf("sql of sensor must be one query")
+	}
+	db, err := s.db(driver, dsn)
+	if err != nil {
+		return err
+	}
+	return sense(ctx, &p.SensorParams, func(c context.Context) (bool, time.Duration, error) {
+		result := &sqlResult{}
+		if err := result.run(c, db, stmts[0]); err != nil {
+			return false, 0, fmt.Errorf("query failed: %w", err)
+		}
+		if result.rowCount == 0 {
+			return false, 0, nil
+		}
+		if err := ctx.SetOutput(SQLOutputFirstRow, result.firstRow); err != nil {
+			ctx.Logger().Warnf("set %s to output failed: %s", SQLOutputFirstRow, err)
+		}
+		return true, 0, nil
+	})
+}
@@ -0,0 +1,303 @@
+package actions
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/entity/run"
+	"github.com/etherealiy/fastflow/pkg/log"
+	"github.com/mitchellh/mapstructure"
+	"github.com/stretchr/testify/assert"
+)
+
+// newSensorContext return the context of a task instance which has one attempt, and the outputs set by action
+func newSensorContext(state *entity.SensorState) (run.ExecuteContext, *entity.TaskInstance, map[string]interface{}) {
+	outputs := map[string]interface{}{}
+	taskIns := &entity.TaskInstance{
+		BaseInfo: entity.BaseInfo{ID: "task-ins1"},
+		Attempts: []entity.TaskAttempt{{Attempt: 1, Status: entity.TaskInstanceStatusFailed}},
+		Sensor:   state,
+	}
+	ctx := run.NewDefExecuteContext(entity.CtxWithRunningTaskIns(context.Background(), taskIns),
+		nil, func(msg string, opt ...run.TraceOp) {}, nil, nil)
+	ctx.SetLogger(log.GetLogger())
+	ctx.SetOutputFunc(func(key string, value interface{}) error {
+		outputs[key] = value
+		return nil
+	})
+	return ctx, taskIns, outputs
+}
+
+// rescheduledAfter return the duration of reschedule error, or -1 when err is not
+func rescheduledAfter(err error) time.Duration {
+	var re *run.RescheduleError
+	if !errors.As(err, &re) {
+		return -1
+	}
+	return re.After
+}
+
+func TestSense(t *testing.T) {
+	tests := []struct {
+		caseDesc   string
+		giveParams *SensorParams
+		giveState  *entity.SensorState
+		giveMet    bool
+		giveWait   time.Duration
+		giveErr    error
+		wantAfter  time.Duration
+		wantPokes  int
+		wantErr    string
+	}{
+		{
+			caseDesc:   "met",
+			giveParams: &SensorParams{},
+			giveMet:    true,
+			wantAfter:  -1,
+		},
+		{
+			caseDesc:   "default poke interval",
+			giveParams: &SensorParams{},
+			wantAfter:  30 * time.Second,
+			wantPokes:  1,
+		},
+		{
+			caseDesc:   "limited by timeout",
+			giveParams: &SensorParams{PokeInterval: "1m", Timeout: "1m"},
+			giveState:  &entity.SensorState{Attempt: 1, StartedAt: time.Now().Add(-10 * time.Second).Unix(), Pokes: 2},
+			wantAfter:  50 * time.Second,
+			wantPokes:  3,
+		},
+		{
+			caseDesc:   "timed out",
+			giveParams: &SensorParams{Timeout: "1m"},
+			giveState:  &entity.SensorState{Attempt: 1, StartedAt: time.Now().Add(-2 * time.Minute).Unix(), Pokes: 2},
+			wantAfter:  -1,
+			wantErr:    "sensor timed out after 1m0s, pokes: 3",
+		},
+		{
+			caseDesc:   "state of previous attempt",
+			giveParams: &SensorParams{Timeout: "1m"},
+			giveState:  &entity.SensorState{Attempt: 0, StartedAt: time.Now().Add(-2 * time.Minute).Unix(), Pokes: 2},
+			wantAfter:  30 * time.Second,
+			wantPokes:  1,
+		},
+		{
+			caseDesc:   "suggested wait",
+			giveParams: &SensorParams{},
+			giveWait:   5 * time.Second,
+			wantAfter:  5 * time.Second,
+			wantPokes:  1,
+		},
+		{
+			caseDesc:   "poke interval is shorter than suggested wait",
+			giveParams: &SensorParams{PokeInterval: "1s"},
+			giveWait:   5 * time.Second,
+			wantAfter:  time.Second,
+			wantPokes:  1,
+		},
+		{
+			caseDesc:   "poke failed",
+			giveParams: &SensorParams{},
+			giveErr:    errors.New("connection refused"),
+			wantAfter:  -1,
+			wantErr:    "connection refused",
+		},
+		{
+			caseDesc:   "invalid poke interval",
+			giveParams: &SensorParams{PokeInterval: "often"},
+			wantAfter:  -1,
+			wantErr:    `not a valid duration string: "often"`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			ctx, taskIns, _ := newSensorContext(tc.giveState)
+			err := sense(ctx, tc.giveParams, func(context.Context) (bool, time.Duration, error) {
+				return tc.giveMet, tc.giveWait, tc.giveErr
+			})
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+			}
+			assert.InDelta(t, tc.wantAfter, rescheduledAfter(err), float64(time.Second))
+			if tc.wantPokes > 0 && assert.NotNil(t, taskIns.Sensor) {
+				assert.Equal(t, tc.wantPokes, taskIns.Sensor.Pokes)
+				assert.Equal(t, 1, taskIns.Sensor.Attempt)
+			}
+		})
+	}
+}
+
+func TestSensorParams_decode(t *testing.T) {
+	p := &HTTPSensorParams{}
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{WeaklyTypedInput: true, Result: p, TagName: "json"})
+	assert.NoError(t, err)
+	assert.NoError(t, decoder.Decode(map[string]interface{}{
+		"pokeInterval": "10s",
+		"timeout":      "1h",
+		"request":      map[string]interface{}{"url": "http://127.0.0.1/health", "timeout": "5s"},
+	}))
+	assert.Equal(t, &HTTPSensorParams{
+		SensorParams: SensorParams{PokeInterval: "10s", Timeout: "1h"},
+		Request:      HTTPParams{URL: "http://127.0.0.1/health", Timeout: "5s"},
+	}, p)
+}
+
+type fakeS3Client map[string]bool
+
+func (c fakeS3Client) ObjectExists(ctx context.Context, bucket, key string) (bool, error) {
+	if bucket == "forbidden" {
+		return false, errors.New("access denied")
+	}
+	return c[bucket+"/"+key], nil
+}
+
+func TestSensors_Run(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "a.csv"), []byte("a"), 0644))
+
+	var healthy int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&healthy) == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"status":"ok"}`))
+	}))
+	defer srv.Close()
+
+	sqlSensor := &SQLSensor{SQL: SQL{Drivers: map[string]string{"fake": "ff-fake-sql"}}}
+	defer sqlSensor.Close()
+
+	tests := []struct {
+		caseDesc    string
+		giveAction  run.Action
+		giveParams  interface{}
+		giveBefore  func()
+		wantAfter   time.Duration
+		wantOutputs map[string]interface{}
+		wantErr     string
+	}{
+		{
+			caseDesc:    "time reached",
+			giveAction:  &TimeSensor{},
+			giveParams:  &TimeSensorParams{Time: time.Now().Add(-time.Minute).Format(time.RFC3339)},
+			wantAfter:   -1,
+			wantOutputs: map[string]interface{}{},
+		},
+		{
+			caseDesc:    "time not reached",
+			giveAction:  &TimeSensor{},
+			giveParams:  &TimeSensorParams{Time: time.Now().Add(time.Hour).Format(time.RFC3339)},
+			wantAfter:   time.Hour,
+			wantOutputs: map[string]interface{}{},
+		},
+		{
+			caseDesc:    "invalid time",
+			giveAction:  &TimeSensor{},
+			giveParams:  &TimeSensorParams{Time: "tomorrow"},
+			wantAfter:   -1,
+			wantOutputs: map[string]interface{}{},
+			wantErr:     `time is invalid: parsing time "tomorrow" as "2006-01-02T15:04:05Z07:00": cannot parse "tomorrow" as "2006"`,
+		},
+		{
+			caseDesc:    "file found",
+			giveAction:  &FileSensor{},
+			giveParams:  &FileSensorParams{Path: filepath.Join(dir, "*.csv")},
+			wantAfter:   -1,
+			wantOutputs: map[string]interface{}{FileSensorOutputFiles: []string{filepath.Join(dir, "a.csv")}},
+		},
+		{
+			caseDesc:    "file not found",
+			giveAction:  &FileSensor{},
+			giveParams:  &FileSensorParams{SensorParams: SensorParams{PokeInterval: "1m"}, Path: filepath.Join(dir, "*.json")},
+			wantAfter:   time.Minute,
+			wantOutputs: map[string]interface{}{},
+		},
+		{
+			caseDesc:    "s3 object exists",
+			giveAction:  &S3Sensor{Client: fakeS3Client{"bucket/2022/_SUCCESS": true}},
+			giveParams:  &S3SensorParams{Bucket: "bucket", Key: "2022/_SUCCESS"},
+			wantAfter:   -1,
+			wantOutputs: map[string]interface{}{},
+		},
+		{
+			caseDesc:    "s3 object not exists",
+			giveAction:  &S3Sensor{Client: fakeS3Client{}},
+			giveParams:  &S3SensorParams{Bucket: "bucket", Key: "2022/_SUCCESS"},
+			wantAfter:   30 * time.Second,
+			wantOutputs: map[string]interface{}{},
+		},
+		{
+			caseDesc:    "s3 check failed",
+			giveAction:  &S3Sensor{Client: fakeS3Client{}},
+			giveParams:  &S3SensorParams{Bucket: "forbidden", Key: "key"},
+			wantAfter:   -1,
+			wantOutputs: map[string]interface{}{},
+			wantErr:     "check object s3://forbidden/key failed: access denied",
+		},
+		{
+			caseDesc:    "endpoint not ready",
+			giveAction:  &HTTPSensor{},
+			giveParams:  &HTTPSensorParams{SensorParams: SensorParams{PokeInterval: "10s"}, Request: HTTPParams{URL: srv.URL}},
+			wantAfter:   10 * time.Second,
+			wantOutputs: map[string]interface{}{},
+		},
+		{
+			caseDesc:    "endpoint ready",
+			giveAction:  &HTTPSensor{},
+			giveParams:  &HTTPSensorParams{Request: HTTPParams{URL: srv.URL, Assertions: []HTTPAssertion{{Path: "status", Equals: "ok"}}}},
+			giveBefore:  func() { atomic.StoreInt32(&healthy, 1) },
+			wantAfter:   -1,
+			wantOutputs: map[string]interface{}{HTTPOutputStatusCode: 200, HTTPOutputBody: map[string]interface{}{"status": "ok"}},
+		},
+		{
+			caseDesc:    "query returns rows",
+			giveAction:  sqlSensor,
+			giveParams:  &SQLSensorParams{DSN: "fake://db", SQL: "SELECT id, name FROM partitions WHERE ds = :ds", Params: map[string]interface{}{"ds": "2022-01-01"}},
+			wantAfter:   -1,
+			wantOutputs: map[string]interface{}{SQLOutputFirstRow: map[string]interface{}{"id": int64(1), "name": "a"}},
+		},
+		{
+			caseDesc:    "query returns no row",
+			giveAction:  sqlSensor,
+			giveParams:  &SQLSensorParams{DSN: "fake://db", SQL: "SELECT id FROM none"},
+			wantAfter:   30 * time.Second,
+			wantOutputs: map[string]interface{}{},
+		},
+		{
+			caseDesc:    "more than one query",
+			giveAction:  sqlSensor,
+			giveParams:  &SQLSensorParams{DSN: "fake://db", SQL: "SELECT 1; SELECT 2"},
+			wantAfter:   -1,
+			wantOutputs: map[string]interface{}{},
+			wantErr:     "sql of sensor must be one query",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			if tc.giveBefore != nil {
+				tc.giveBefore()
+			}
+			ctx, _, outputs := newSensorContext(nil)
+			err := tc.giveAction.Run(ctx, tc.giveParams)
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+			} else if tc.wantAfter < 0 {
+				assert.NoError(t, err)
+			}
+			assert.InDelta(t, tc.wantAfter, rescheduledAfter(err), float64(time.Second))
+			assert.Equal(t, tc.wantOutputs, outputs)
+		})
+	}
+}
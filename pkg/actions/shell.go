@@ -0,0 +1,188 @@
+package actions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity/run"
+	"github.com/etherealiy/fastflow/pkg/utils/data"
+)
+
+const (
+	ActionKeyShell = "ff-shell"
+
+	// ShellOutputExitCode is the output key of exit code, so downstream tasks can use "{{ .outputs.<task id>.exitCode }}"
+	ShellOutputExitCode = "exitCode"
+)
+
+// ShellParams, the params are rendered with vars and outputs before running like other actions
+type ShellParams struct {
+	// Command is run by Shell, such as "./export.sh {{ .ds }}", it cannot be used with Args
+	Command string `json:"command"`
+	// Args is the program and its args which run without shell, so they are neither split nor expanded
+	Args []string `json:"args"`
+	// Shell runs Command by "{Shell} -c {Command}", default is "sh"
+	Shell string `json:"shell"`
+	// Env is added to the environment of process after the env of task
+	Env map[string]string `json:"env"`
+	// Dir is the working directory, default is the workspace of dag instance when it is enabled
+	Dir string `json:"dir"`
+	// Timeout support "d|h|m|s|ms", empty means only the timeout of task
+	Timeout string `json:"timeout"`
+	// KillGracePeriod is the time between SIGTERM and SIGKILL when the process is timed out or canceled,
+	// support "d|h|m|s|ms", default is 10s
+	KillGracePeriod string `json:"killGracePeriod"`
+	// SuccessExitCodes default is [0]
+	SuccessExitCodes []int `json:"successExitCodes"`
+	// RetryableExitCodes fail the task transiently, so they are retried by the retry policy on "transient"
+	RetryableExitCodes []int `json:"retryableExitCodes"`
+}
+
+// DefaultShellInheritEnv are the environment variables of worker passed to the process by default,
+// the others such as credentials of store and secrets are not exposed to the dag authors
+var DefaultShellInheritEnv = []string{"PATH", "HOME", "USER", "LANG", "TZ", "TMPDIR"}
+
+// Shell action run a command, its stdout and stderr are written to the logs of task instance,
+// and its exit code is set to output "exitCode"
+type Shell struct {
+	// InheritEnv are the names of worker environment variables passed to the process,
+	// default is DefaultShellInheritEnv
+	InheritEnv []string
+}
+
+// Name
+func (s *Shell) Name() string {
+	return ActionKeyShell
+}
+
+// ParameterNew
+func (s *Shell) ParameterNew() interface{} {
+	return &ShellParams{}
+}
+
+// Run
+func (s *Shell) Run(ctx run.ExecuteContext, params interface{}) error {
+	p := params.(*ShellParams)
+	args, err := p.args()
+	if err != nil {
+		return err
+	}
+	grace := 10 * time.Second
+	if p.KillGracePeriod != "" {
+		if grace, err = ParseDuration(p.KillGracePeriod); err != nil {
+			return err
+		}
+	}
+	runCtx := ctx.Context()
+	var timeout time.Duration
+	if p.Timeout != "" {
+		if timeout, err = ParseDuration(p.Timeout); err != nil {
+			return err
+		}
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(runCtx, timeout)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(runCtx, args[0], args[1:]...)
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(syscall.SIGTERM)
+	}
+	cmd.WaitDelay = grace
+	cmd.Env = append(append(s.inheritedEnv(), run.EnvList(ctx)...), envList(p.Env)...)
+	cmd.Dir = p.Dir
+	if cmd.Dir == "" {
+		cmd.Dir = ctx.Workspace()
+	}
+	cmd.Stdout, cmd.Stderr = run.LogWriter(ctx), run.LogWriter(ctx)
+
+	ctx.Logger().Infof("run command: %s", strings.Join(args, " "))
+	err = cmd.Run()
+	if ctx.Context().Err() != nil {
+		return fmt.Errorf("command is interrupted: %w", ctx.Context().Err())
+	}
+	if runCtx.Err() != nil {
+		// it is retried by the retry policy on "timeout" like the timeout of task
+		return fmt.Errorf("command timed out after %s: %w", timeout, context.DeadlineExceeded)
+	}
+	code := 0
+	if err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return fmt.Errorf("run command failed: %w", err)
+		}
+		code = exitErr.ExitCode()
+	}
+	if err := ctx.SetOutput(ShellOutputExitCode, code); err != nil {
+		ctx.Logger().Warnf("set exit code to output failed: %s", err)
+	}
+
+	successCodes := p.SuccessExitCodes
+	if len(successCodes) == 0 {
+		successCodes = []int{0}
+	}
+	if containsInt(successCodes, code) {
+		return nil
+	}
+	err = fmt.Errorf("command exited with code %d", code)
+	if containsInt(p.RetryableExitCodes, code) {
+		return data.Transient(err)
+	}
+	return err
+}
+
+func (p *ShellParams) args() ([]string, error) {
+	switch {
+	case p.Command != "" && len(p.Args) > 0:
+		return nil, fmt.Errorf("command and args cannot be used together")
+	case len(p.Args) > 0:
+		return p.Args, nil
+	case p.Command != "":
+		shell := p.Shell
+		if shell == "" {
+			shell = "sh"
+		}
+		return []string{shell, "-c", p.Command}, nil
+	}
+	return nil, fmt.Errorf("command or args must be specified")
+}
+
+// envList return the env in "key=value" form and sorted by key
+func (s *Shell) inheritedEnv() []string {
+	keys := s.InheritEnv
+	if keys == nil {
+		keys = DefaultShellInheritEnv
+	}
+	var ret []string
+	for _, k := range keys {
+		if v, ok := os.LookupEnv(k); ok {
+			ret = append(ret, k+"="+v)
+		}
+	}
+	return ret
+}
+
+func envList(env map[string]string) []string {
+	var ret []string
+	for k, v := range env {
+		ret = append(ret, k+"="+v)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func containsInt(s []int, v int) bool {
+	for _, i := range s {
+		if i == v {
+			return true
+		}
+	}
+	return false
+}
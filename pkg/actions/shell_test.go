@@ -0,0 +1,132 @@
+package actions
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity/run"
+	"github.com/etherealiy/fastflow/pkg/log"
+	"github.com/etherealiy/fastflow/pkg/utils/data"
+	"github.com/stretchr/testify/assert"
+)
+
+// writerLogger record the output written to it like the logger of task instance
+type writerLogger struct {
+	log.Logger
+	lines []string
+	mutex sync.Mutex
+}
+
+func (l *writerLogger) Write(p []byte) (int, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.lines = append(l.lines, strings.Split(strings.TrimSuffix(string(p), "\n"), "\n")...)
+	return len(p), nil
+}
+
+func TestShell_Run(t *testing.T) {
+	t.Setenv("FASTFLOW_SECRET_DB", "p@ssw0rd")
+	tests := []struct {
+		caseDesc      string
+		giveShell     *Shell
+		giveParams    *ShellParams
+		wantLines     []string
+		wantExitCode  interface{}
+		wantErr       string
+		wantTransient bool
+	}{
+		{
+			caseDesc:     "command with env",
+			giveParams:   &ShellParams{Command: `echo "$GREETING, $TASK_ENV" && echo oops >&2`, Env: map[string]string{"GREETING": "hello"}},
+			wantLines:    []string{"hello, task", "oops"},
+			wantExitCode: 0,
+		},
+		{
+			caseDesc:     "worker env is not inherited",
+			giveParams:   &ShellParams{Command: `[ -n "$PATH" ] && echo "secret:$FASTFLOW_SECRET_DB"`},
+			wantLines:    []string{"secret:"},
+			wantExitCode: 0,
+		},
+		{
+			caseDesc:     "inherit env",
+			giveShell:    &Shell{InheritEnv: []string{"PATH", "FASTFLOW_SECRET_DB"}},
+			giveParams:   &ShellParams{Command: `echo "secret:$FASTFLOW_SECRET_DB"`},
+			wantLines:    []string{"secret:p@ssw0rd"},
+			wantExitCode: 0,
+		},
+		{
+			caseDesc:     "args without shell",
+			giveParams:   &ShellParams{Args: []string{"echo", "$GREETING", "a b"}},
+			wantLines:    []string{"$GREETING a b"},
+			wantExitCode: 0,
+		},
+		{
+			caseDesc:     "failed",
+			giveParams:   &ShellParams{Command: "exit 3", RetryableExitCodes: []int{75}},
+			wantExitCode: 3,
+			wantErr:      "command exited with code 3",
+		},
+		{
+			caseDesc:      "retryable",
+			giveParams:    &ShellParams{Command: "exit 75", RetryableExitCodes: []int{75}},
+			wantExitCode:  75,
+			wantErr:       "command exited with code 75",
+			wantTransient: true,
+		},
+		{
+			caseDesc:     "success exit codes",
+			giveParams:   &ShellParams{Command: "exit 1", SuccessExitCodes: []int{0, 1}},
+			wantExitCode: 1,
+		},
+		{
+			caseDesc:   "timeout",
+			giveParams: &ShellParams{Command: "sleep 10", Timeout: "50ms", KillGracePeriod: "50ms"},
+			wantErr:    "command timed out after 50ms: context deadline exceeded",
+		},
+		{
+			caseDesc:   "command and args",
+			giveParams: &ShellParams{Command: "echo", Args: []string{"echo"}},
+			wantErr:    "command and args cannot be used together",
+		},
+		{
+			caseDesc:   "nothing to run",
+			giveParams: &ShellParams{},
+			wantErr:    "command or args must be specified",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			logger := &writerLogger{Logger: log.GetLogger()}
+			outputs := map[string]interface{}{}
+			ctx := run.NewDefExecuteContext(context.Background(), nil, func(msg string, opt ...run.TraceOp) {}, nil, nil)
+			ctx.SetLogger(logger)
+			ctx.SetEnv(map[string]string{"TASK_ENV": "task"})
+			ctx.SetOutputFunc(func(key string, value interface{}) error {
+				outputs[key] = value
+				return nil
+			})
+
+			shell := tc.giveShell
+			if shell == nil {
+				shell = &Shell{}
+			}
+			begin := time.Now()
+			err := shell.Run(ctx, tc.giveParams)
+			assert.Less(t, int64(time.Since(begin)), int64(5*time.Second))
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.wantTransient, errors.Is(err, data.ErrDataTransient))
+			// stdout and stderr are copied concurrently
+			assert.ElementsMatch(t, tc.wantLines, logger.lines)
+			assert.Equal(t, tc.wantExitCode, outputs[ShellOutputExitCode])
+		})
+	}
+}
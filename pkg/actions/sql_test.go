@@ -0,0 +1,260 @@
+package actions
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/etherealiy/fastflow/pkg/entity/run"
+	"github.com/etherealiy/fastflow/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSQLDriver record the statements, the statements containing "fail" return error,
+// queries return two rows except the ones containing "none", and others affect two rows
+type fakeSQLDriver struct {
+	mutex    sync.Mutex
+	executed []string
+}
+
+func (d *fakeSQLDriver) Open(name string) (driver.Conn, error) {
+	return &fakeSQLConn{driver: d}, nil
+}
+
+func (d *fakeSQLDriver) record(s string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.executed = append(d.executed, s)
+}
+
+func (d *fakeSQLDriver) reset() []string {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	ret := d.executed
+	d.executed = nil
+	return ret
+}
+
+type fakeSQLConn struct {
+	driver *fakeSQLDriver
+}
+
+func (c *fakeSQLConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeSQLStmt{driver: c.driver, query: query}, nil
+}
+
+func (c *fakeSQLConn) Close() error {
+	return nil
+}
+
+func (c *fakeSQLConn) Begin() (driver.Tx, error) {
+	c.driver.record("BEGIN")
+	return c, nil
+}
+
+func (c *fakeSQLConn) Commit() error {
+	c.driver.record("COMMIT")
+	return nil
+}
+
+func (c *fakeSQLConn) Rollback() error {
+	c.driver.record("ROLLBACK")
+	return nil
+}
+
+type fakeSQLStmt struct {
+	driver *fakeSQLDriver
+	query  string
+}
+
+func (s *fakeSQLStmt) Close() error {
+	return nil
+}
+
+func (s *fakeSQLStmt) NumInput() int {
+	return -1
+}
+
+func (s *fakeSQLStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.driver.record(fmt.Sprint(s.query, args))
+	if strings.Contains(s.query, "fail") {
+		return nil, errors.New("syntax error")
+	}
+	return driver.RowsAffected(2), nil
+}
+
+func (s *fakeSQLStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.driver.record(fmt.Sprint(s.query, args))
+	if strings.Contains(s.query, "none") {
+		return &fakeSQLRows{}, nil
+	}
+	return &fakeSQLRows{rows: [][]driver.Value{{int64(1), []byte("a")}, {int64(2), []byte("b")}}}, nil
+}
+
+type fakeSQLRows struct {
+	rows [][]driver.Value
+}
+
+func (r *fakeSQLRows) Columns() []string {
+	return []string{"id", "name"}
+}
+
+func (r *fakeSQLRows) Close() error {
+	return nil
+}
+
+func (r *fakeSQLRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+var testSQLDriver = &fakeSQLDriver{}
+
+func init() {
+	sql.Register("ff-fake-sql", testSQLDriver)
+}
+
+func TestSQL_Run(t *testing.T) {
+	tests := []struct {
+		caseDesc     string
+		giveParams   *SQLParams
+		wantExecuted []string
+		wantOutputs  map[string]interface{}
+		wantErr      string
+	}{
+		{
+			caseDesc: "script with params",
+			giveParams: &SQLParams{
+				DSN: "fake://db",
+				SQL: `DELETE FROM report WHERE ds = :ds;
+					-- insert the report of :ds
+					INSERT INTO report SELECT * FROM staging WHERE ds = :ds AND note != 'a;b:c';
+					SELECT id, name::text FROM report WHERE ds = :ds`,
+				Params: map[string]interface{}{"ds": "2022-01-01"},
+			},
+			wantExecuted: []string{
+				"DELETE FROM report WHERE ds = $1[2022-01-01]",
+				"INSERT INTO report SELECT * FROM staging WHERE ds = $1 AND note != 'a;b:c'[2022-01-01]",
+				"SELECT id, name::text FROM report WHERE ds = $1[2022-01-01]",
+			},
+			wantOutputs: map[string]interface{}{
+				SQLOutputRowsAffected: int64(4),
+				SQLOutputRowCount:     int64(2),
+				SQLOutputFirstRow:     map[string]interface{}{"id": int64(1), "name": "a"},
+			},
+		},
+		{
+			caseDesc:     "transaction",
+			giveParams:   &SQLParams{DSN: "fake://db", SQL: "UPDATE t SET a = 1; UPDATE t SET b = 2;", Transaction: true},
+			wantExecuted: []string{"BEGIN", "UPDATE t SET a = 1[]", "UPDATE t SET b = 2[]", "COMMIT"},
+			wantOutputs:  map[string]interface{}{SQLOutputRowsAffected: int64(4)},
+		},
+		{
+			caseDesc:     "rolled back",
+			giveParams:   &SQLParams{DSN: "fake://db", SQL: "UPDATE t SET a = 1; fail", Transaction: true},
+			wantExecuted: []string{"BEGIN", "UPDATE t SET a = 1[]", "fail[]", "ROLLBACK"},
+			wantOutputs:  map[string]interface{}{},
+			wantErr:      "statement 2 failed: syntax error",
+		},
+		{
+			caseDesc:    "missing param",
+			giveParams:  &SQLParams{DSN: "fake://db", SQL: "SELECT :id"},
+			wantOutputs: map[string]interface{}{},
+			wantErr:     "param id is not found",
+		},
+		{
+			caseDesc:    "unknown scheme",
+			giveParams:  &SQLParams{DSN: "oracle://db", SQL: "SELECT 1"},
+			wantOutputs: map[string]interface{}{},
+			wantErr:     "no driver for scheme oracle",
+		},
+	}
+
+	action := &SQL{Drivers: map[string]string{"fake": "ff-fake-sql"}}
+	defer action.Close()
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			testSQLDriver.reset()
+			outputs := map[string]interface{}{}
+			ctx := run.NewDefExecuteContext(context.Background(), nil, func(msg string, opt ...run.TraceOp) {}, nil, nil)
+			ctx.SetLogger(log.GetLogger())
+			ctx.SetOutputFunc(func(key string, value interface{}) error {
+				outputs[key] = value
+				return nil
+			})
+
+			err := action.Run(ctx, tc.giveParams)
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.wantExecuted, testSQLDriver.reset())
+			assert.Equal(t, tc.wantOutputs, outputs)
+		})
+	}
+}
+
+func TestParseSQL(t *testing.T) {
+	tests := []struct {
+		caseDesc   string
+		giveScript string
+		giveDollar bool
+		wantStmts  []*sqlStatement
+		wantErr    string
+	}{
+		{
+			caseDesc:   "question mark placeholders",
+			giveScript: "INSERT INTO t VALUES (:a, :b, :a); SET @x := 1",
+			wantStmts: []*sqlStatement{
+				{query: "INSERT INTO t VALUES (?, ?, ?)", args: []interface{}{1, "b", 1}},
+				{query: "SET @x := 1"},
+			},
+		},
+		{
+			caseDesc:   "quotes and comments",
+			giveScript: "SELECT `a:b`, \"c;d\", ':e' /* :f; */ FROM t;;",
+			wantStmts:  []*sqlStatement{{query: "SELECT `a:b`, \"c;d\", ':e'   FROM t"}},
+		},
+		{
+			caseDesc:   "dollar quoted body",
+			giveScript: "CREATE FUNCTION f() RETURNS int AS $fn$ SELECT 1; $fn$ LANGUAGE sql; SELECT f(:a)",
+			giveDollar: true,
+			wantStmts: []*sqlStatement{
+				{query: "CREATE FUNCTION f() RETURNS int AS $fn$ SELECT 1; $fn$ LANGUAGE sql"},
+				{query: "SELECT f($1)", args: []interface{}{1}},
+			},
+		},
+		{
+			caseDesc:   "quote not closed",
+			giveScript: "SELECT 'a",
+			wantErr:    "quote ' is not closed",
+		},
+		{
+			caseDesc:   "no statement",
+			giveScript: " ; -- nothing",
+			wantErr:    "sql has no statement",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			stmts, err := parseSQL(tc.giveScript, map[string]interface{}{"a": 1, "b": "b"}, tc.giveDollar)
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantStmts, stmts)
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package actions
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/entity/run"
+)
+
+const (
+	ActionKeyTemporal = "ff-temporal"
+)
+
+// TemporalClient is the subset of temporal client used by Temporal action,
+// fastflow does not depend on temporal sdk, so you need to adapt "go.temporal.io/sdk/client.Client" to it
+type TemporalClient interface {
+	// ExecuteWorkflow start a workflow and return its run id
+	ExecuteWorkflow(ctx context.Context, opt TemporalStartOption, args ...interface{}) (runID string, err error)
+	// SignalWorkflow send signal to a running workflow, run id can be empty which means the latest run
+	SignalWorkflow(ctx context.Context, workflowID, runID, signalName string, arg interface{}) error
+	// GetWorkflowResult block until workflow completed and decode its result to valuePtr
+	GetWorkflowResult(ctx context.Context, workflowID, runID string, valuePtr interface{}) error
+}
+
+// TemporalStartOption
+type TemporalStartOption struct {
+	ID               string
+	WorkflowType     string
+	TaskQueue        string
+	ExecutionTimeout time.Duration
+}
+
+// TemporalParams
+type TemporalParams struct {
+	WorkflowType string        `json:"workflowType"`
+	TaskQueue    string        `json:"taskQueue"`
+	Args         []interface{} `json:"args"`
+	// WorkflowID default is "{dagInsId}-{taskId}", so retrying task will not start duplicated workflow
+	WorkflowID string `json:"workflowId"`
+	RunID      string `json:"runId"`
+	// ExecutionTimeout support "d|h|m|s|ms", empty means no limit
+	ExecutionTimeout string `json:"executionTimeout"`
+
+	// Signal send the signal to workflow instead of starting it
+	Signal    string      `json:"signal"`
+	SignalArg interface{} `json:"signalArg"`
+
+	// Wait for workflow completed, it failed when the workflow failed
+	Wait bool `json:"wait"`
+	// ResultKey is the key of share data which the whole result in json is saved to
+	ResultKey string `json:"resultKey"`
+	// Outputs map the fields of result to share data, key is share data key and value is the field name of result
+	Outputs map[string]string `json:"outputs"`
+}
+
+// Temporal action start or signal a temporal workflow, it is not registered by default because it needs a client.
+//
+//	fastflow.RegisterAction([]run.Action{&actions.Temporal{Client: myTemporalClient}})
+type Temporal struct {
+	Client TemporalClient
+}
+
+// Name
+func (s *Temporal) Name() string {
+	return ActionKeyTemporal
+}
+
+// ParameterNew
+func (s *Temporal) ParameterNew() interface{} {
+	return &TemporalParams{}
+}
+
+// Run
+func (s *Temporal) Run(ctx run.ExecuteContext, params interface{}) error {
+	if s.Client == nil {
+		return fmt.Errorf("temporal client cannot be nil")
+	}
+	p := params.(*TemporalParams)
+	if p.WorkflowID == "" {
+		taskIns, ok := entity.CtxRunningTaskIns(ctx.Context())
+		if !ok {
+			return fmt.Errorf("workflowId cannot be empty")
+		}
+		p.WorkflowID = fmt.Sprintf("%s-%s", taskIns.DagInsID, taskIns.TaskID)
+	}
+
+	runID := p.RunID
+	if p.Signal != "" {
+		if err := s.Client.SignalWorkflow(ctx.Context(), p.WorkflowID, p.RunID, p.Signal, p.SignalArg); err != nil {
+			return fmt.Errorf("signal workflow %s failed: %w", p.WorkflowID, err)
+		}
+		ctx.Tracef("sent signal %s to workflow %s", p.Signal, p.WorkflowID)
+	} else {
+		if p.WorkflowType == "" || p.TaskQueue == "" {
+			return fmt.Errorf("workflowType and taskQueue cannot be empty")
+		}
+		opt := TemporalStartOption{
+			ID:           p.WorkflowID,
+			WorkflowType: p.WorkflowType,
+			TaskQueue:    p.TaskQueue,
+		}
+		if p.ExecutionTimeout != "" {
+			d, err := ParseDuration(p.ExecutionTimeout)
+			if err != nil {
+				return err
+			}
+			opt.ExecutionTimeout = d
+		}
+		id, err := s.Client.ExecuteWorkflow(ctx.Context(), opt, p.Args...)
+		if err != nil {
+			return fmt.Errorf("start workflow %s failed: %w", p.WorkflowID, err)
+		}
+		runID = id
+		ctx.Tracef("started workflow %s, run id: %s", p.WorkflowID, runID)
+	}
+	if !p.Wait {
+		return nil
+	}
+
+	var result interface{}
+	if err := s.Client.GetWorkflowResult(ctx.Context(), p.WorkflowID, runID, &result); err != nil {
+		return fmt.Errorf("workflow %s failed: %w", p.WorkflowID, err)
+	}
+	return saveTemporalResult(ctx, p, result)
+}
+
+func saveTemporalResult(ctx run.ExecuteContext, p *TemporalParams, result interface{}) error {
+	if p.ResultKey != "" {
+		bs, err := json.Marshal(result)
+		if err != nil {
+			return fmt.Errorf("marshal result failed: %w", err)
+		}
+		ctx.ShareData().Set(p.ResultKey, string(bs))
+	}
+	if len(p.Outputs) == 0 {
+		return nil
+	}
+	fields, ok := result.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("result of workflow %s is not an object, it cannot be mapped to outputs", p.WorkflowID)
+	}
+	for key, field := range p.Outputs {
+		v, ok := fields[field]
+		if !ok {
+			return fmt.Errorf("result of workflow %s has no field %s", p.WorkflowID, field)
+		}
+		if s, ok := v.(string); ok {
+			ctx.ShareData().Set(key, s)
+			continue
+		}
+		bs, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("marshal field %s failed: %w", field, err)
+		}
+		ctx.ShareData().Set(key, string(bs))
+	}
+	return nil
+}
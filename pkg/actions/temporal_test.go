@@ -0,0 +1,102 @@
+package actions
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/entity/run"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeTemporalClient struct {
+	started   *TemporalStartOption
+	signaled  string
+	result    string
+	resultErr error
+}
+
+func (c *fakeTemporalClient) ExecuteWorkflow(ctx context.Context, opt TemporalStartOption, args ...interface{}) (string, error) {
+	c.started = &opt
+	return "run-1", nil
+}
+
+func (c *fakeTemporalClient) SignalWorkflow(ctx context.Context, workflowID, runID, signalName string, arg interface{}) error {
+	c.signaled = signalName
+	return nil
+}
+
+func (c *fakeTemporalClient) GetWorkflowResult(ctx context.Context, workflowID, runID string, valuePtr interface{}) error {
+	if c.resultErr != nil {
+		return c.resultErr
+	}
+	return json.Unmarshal([]byte(c.result), valuePtr)
+}
+
+func TestTemporal_Run(t *testing.T) {
+	tests := []struct {
+		caseDesc      string
+		giveParams    *TemporalParams
+		giveClient    *fakeTemporalClient
+		wantStartedID string
+		wantSignaled  string
+		wantShareData map[string]string
+		wantErr       bool
+	}{
+		{
+			caseDesc:      "start and wait",
+			giveParams:    &TemporalParams{WorkflowType: "wf", TaskQueue: "q", Wait: true, ResultKey: "ret", Outputs: map[string]string{"count": "count", "name": "name"}},
+			giveClient:    &fakeTemporalClient{result: `{"count": 2, "name": "n"}`},
+			wantStartedID: "dag-ins-task",
+			wantShareData: map[string]string{"ret": `{"count":2,"name":"n"}`, "count": "2", "name": "n"},
+		},
+		{
+			caseDesc:      "start without wait",
+			giveParams:    &TemporalParams{WorkflowID: "wf-id", WorkflowType: "wf", TaskQueue: "q"},
+			giveClient:    &fakeTemporalClient{},
+			wantStartedID: "wf-id",
+			wantShareData: map[string]string{},
+		},
+		{
+			caseDesc:      "signal",
+			giveParams:    &TemporalParams{WorkflowID: "wf-id", Signal: "approve"},
+			giveClient:    &fakeTemporalClient{},
+			wantSignaled:  "approve",
+			wantShareData: map[string]string{},
+		},
+		{
+			caseDesc:   "workflow failed",
+			giveParams: &TemporalParams{WorkflowType: "wf", TaskQueue: "q", Wait: true},
+			giveClient: &fakeTemporalClient{resultErr: errors.New("failed")},
+			wantErr:    true,
+		},
+		{
+			caseDesc:   "missing output field",
+			giveParams: &TemporalParams{WorkflowType: "wf", TaskQueue: "q", Wait: true, Outputs: map[string]string{"k": "missing"}},
+			giveClient: &fakeTemporalClient{result: `{}`},
+			wantErr:    true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			shareData := &entity.ShareData{Dict: map[string]string{}}
+			c := entity.CtxWithRunningTaskIns(context.Background(), &entity.TaskInstance{DagInsID: "dag-ins", TaskID: "task"})
+			ctx := run.NewDefExecuteContext(c, shareData, func(msg string, opt ...run.TraceOp) {}, nil, nil)
+
+			err := (&Temporal{Client: tc.giveClient}).Run(ctx, tc.giveParams)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			if tc.wantStartedID != "" && assert.NotNil(t, tc.giveClient.started) {
+				assert.Equal(t, tc.wantStartedID, tc.giveClient.started.ID)
+			}
+			assert.Equal(t, tc.wantSignaled, tc.giveClient.signaled)
+			assert.Equal(t, tc.wantShareData, shareData.Dict)
+		})
+	}
+}
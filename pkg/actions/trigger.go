@@ -0,0 +1,90 @@
+package actions
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/entity/run"
+	"github.com/etherealiy/fastflow/pkg/mod"
+)
+
+const (
+	ActionKeyTriggerDagRun = "ff-trigger-dag-run"
+)
+
+// TriggerDagRunParams
+type TriggerDagRunParams struct {
+	DagID  string            `json:"dagId"`
+	Vars   map[string]string `json:"vars"`
+	Labels map[string]string `json:"labels"`
+	// Wait for the triggered dag instance completed, it failed when the dag instance failed
+	Wait bool `json:"wait"`
+	// PollInterval is used when wait, support "d|h|m|s|ms", default is 1s
+	PollInterval string `json:"pollInterval"`
+}
+
+// TriggerDagRun action run another dag, the new dag instance will be linked as child of current one
+type TriggerDagRun struct {
+}
+
+// Name
+func (s *TriggerDagRun) Name() string {
+	return ActionKeyTriggerDagRun
+}
+
+// ParameterNew
+func (s *TriggerDagRun) ParameterNew() interface{} {
+	return &TriggerDagRunParams{}
+}
+
+// Run
+func (s *TriggerDagRun) Run(ctx run.ExecuteContext, params interface{}) error {
+	p := params.(*TriggerDagRunParams)
+	if p.DagID == "" {
+		return fmt.Errorf("dagId cannot be empty")
+	}
+	interval := time.Second
+	if p.PollInterval != "" {
+		d, err := ParseDuration(p.PollInterval)
+		if err != nil {
+			return err
+		}
+		interval = d
+	}
+
+	ops := []mod.RunDagOptSetter{mod.RunDagLabels(p.Labels)}
+	if taskIns, ok := entity.CtxRunningTaskIns(ctx.Context()); ok && taskIns.RelatedDagInstance != nil {
+		ops = append(ops,
+			mod.RunDagTrigger(entity.TriggerUpstream, &entity.TriggerMeta{UpstreamDagInsID: taskIns.DagInsID}),
+			mod.RunDagParent(taskIns.RelatedDagInstance))
+	}
+	dagIns, err := mod.GetCommander().RunDag(p.DagID, p.Vars, ops...)
+	if err != nil {
+		return fmt.Errorf("run dag %s failed: %w", p.DagID, err)
+	}
+	ctx.Tracef("triggered dag instance %s", dagIns.ID)
+	if !p.Wait {
+		return nil
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Context().Done():
+			return fmt.Errorf("context deadlined")
+		case <-ticker.C:
+			ret, err := mod.GetStore().GetDagInstance(dagIns.ID)
+			if err != nil {
+				return fmt.Errorf("get dag instance %s failed: %w", dagIns.ID, err)
+			}
+			switch ret.Status {
+			case entity.DagInstanceStatusSuccess:
+				return nil
+			case entity.DagInstanceStatusFailed:
+				return fmt.Errorf("dag instance %s failed: %s", dagIns.ID, ret.Reason)
+			}
+		}
+	}
+}
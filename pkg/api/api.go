@@ -0,0 +1,951 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/entity/run"
+	"github.com/etherealiy/fastflow/pkg/journal"
+	"github.com/etherealiy/fastflow/pkg/log"
+	"github.com/etherealiy/fastflow/pkg/mod"
+	"github.com/etherealiy/fastflow/pkg/utils/data"
+)
+
+const (
+	// PathPrefix is the prefix of all management api
+	PathPrefix = "/api/v1/"
+)
+
+// Handler expose the management api of fastflow over http
+// it depend on the components of mod, so you should mount it after fastflow init
+//
+//	http.Handle(api.PathPrefix, api.NewHandler())
+type Handler struct {
+	routes []route
+	auth   Authenticator
+}
+
+type route struct {
+	method string
+	// segments of path, the segment begin with ":" is a path parameter
+	segments []string
+	handle   func(r *Request) (interface{}, error)
+	doc      *RouteDoc
+}
+
+// Request wrap http request and path parameters, User is returned by Authenticator
+type Request struct {
+	*http.Request
+	Params map[string]string
+	User   string
+}
+
+// NewHandler
+func NewHandler() *Handler {
+	h := &Handler{}
+	h.Register(http.MethodGet, "dags", listDags, &RouteDoc{
+		Summary: "list dags, the store must support listing dags",
+		Query: []QueryParam{
+			{Name: "idPrefix"},
+		},
+		Response: []*entity.Dag{},
+	})
+	h.Register(http.MethodGet, "dags/:dagId", getDag, &RouteDoc{
+		Summary:  "get dag",
+		Response: entity.Dag{},
+	})
+	h.Register(http.MethodGet, "dags/:dagId/vars", getDagVars, &RouteDoc{
+		Summary:  "get schema of dag vars which are checked when running dag, they are sorted by name",
+		Response: []DagVarSchema{},
+	})
+	h.Register(http.MethodPost, "dags/:dagId/run", runDag, &RouteDoc{
+		Summary:  "run dag",
+		Body:     RunDagInput{},
+		Response: entity.DagInstance{},
+	})
+	h.Register(http.MethodPost, "dags/:dagId/backfills", startBackfill, &RouteDoc{
+		Summary: "run dag for each data interval in the date range, the backfill is driven by the worker " +
+			"which receives the request, start it again with the same id to resume it",
+		Body:     StartBackfillInput{},
+		Response: mod.BackfillStatus{},
+	})
+	h.Register(http.MethodGet, "backfills/:backfillId", getBackfill, &RouteDoc{
+		Summary:  "get backfill started by the worker which receives the request",
+		Response: mod.BackfillStatus{},
+	})
+	h.Register(http.MethodPost, "backfills/:backfillId/cancel", cancelBackfill, &RouteDoc{
+		Summary:  "stop creating the runs of backfill, the created runs are not canceled",
+		Response: mod.BackfillStatus{},
+	})
+	h.Register(http.MethodPost, "dags/apply", applyDags, &RouteDoc{
+		Summary:  "create or update dags declaratively, the unchanged dags will not be written",
+		Body:     ApplyDagsInput{},
+		Response: mod.ApplyResult{},
+	})
+	h.Register(http.MethodGet, "dag-instances", listDagIns, &RouteDoc{
+		Summary: "list dag instances",
+		Query: []QueryParam{
+			{Name: "dagId"},
+			{Name: "worker"},
+			{Name: "status", Desc: "separated by comma"},
+			{Name: "trigger"},
+			{Name: "triggerSource"},
+			{Name: "idempotencyKey"},
+			{Name: "labels", Desc: "in form of k1=v1,k2=v2"},
+			{Name: "limit", Type: "integer"},
+			{Name: "offset", Type: "integer"},
+		},
+		Response: []*entity.DagInstance{},
+	})
+	h.Register(http.MethodGet, "dag-instances/:dagInsId", getDagIns, &RouteDoc{
+		Summary:  "get dag instance",
+		Response: entity.DagInstance{},
+	})
+	h.Register(http.MethodGet, "dag-instances/:dagInsId/status", getDagInsStatus, &RouteDoc{
+		Summary:  "get status of dag instance and the status computed from its task tree",
+		Response: mod.DagInsStatus{},
+	})
+	h.Register(http.MethodGet, "dag-instances/:dagInsId/graph", getDagInsGraph, &RouteDoc{
+		Summary:  "get task tree of dag instance as a graph with live task statuses, it is used by dashboard",
+		Response: mod.DagInsGraph{},
+	})
+	h.Register(http.MethodGet, "dag-instances/:dagInsId/task-instances", listTaskIns, &RouteDoc{
+		Summary:  "list task instances of dag instance",
+		Response: []*entity.TaskInstance{},
+	})
+	h.Register(http.MethodGet, "dag-instances/:dagInsId/run-tree", getRunTree, &RouteDoc{
+		Summary:  "get the run tree which dag instance belongs to",
+		Response: mod.RunTreeNode{},
+	})
+	h.Register(http.MethodGet, "dag-instances/:dagInsId/queue-position", getQueuePosition, &RouteDoc{
+		Summary:  "get the position of dag instance among the waiting dag instances ordered by effective priority",
+		Response: mod.QueuePosition{},
+	})
+	h.Register(http.MethodGet, "dag-instances/:dagInsId/snapshot", getDagInsSnapshot, &RouteDoc{
+		Summary: "reconstruct the state of dag instance at a point in time from journal, the store must be journaled",
+		Query: []QueryParam{
+			{Name: "at", Desc: "unix timestamp in milliseconds, default is now", Type: "integer"},
+		},
+		Response: journal.Snapshot{},
+	})
+	h.Register(http.MethodGet, "task-instances/:taskInsId/attempts", listTaskAttempts, &RouteDoc{
+		Summary:  "list attempts of task instance",
+		Response: []entity.TaskAttempt{},
+	})
+	h.Register(http.MethodGet, "task-instances/:taskInsId/logs", listTaskLogs, &RouteDoc{
+		Summary: "list logs of task instance after cursor, the seq of the last log is the cursor of next polling",
+		Query: []QueryParam{
+			{Name: "cursor", Type: "integer"},
+			{Name: "limit", Type: "integer"},
+		},
+		Response: []*entity.TaskLog{},
+	})
+	h.Register(http.MethodGet, "task-instances/:taskInsId/artifacts", listTaskArtifacts, &RouteDoc{
+		Summary:  "list artifacts of task instance",
+		Response: []run.Artifact{},
+	})
+	h.Register(http.MethodGet, "task-instances/:taskInsId/artifacts/:name", downloadTaskArtifact, &RouteDoc{
+		Summary:             "download artifact, it redirects to the uri when artifact is not local",
+		ResponseContentType: "application/octet-stream",
+	})
+	h.Register(http.MethodPost, "dag-instances/:dagInsId/retry-from-failed", retryFromFailed, &RouteDoc{
+		Summary:  "retry the failed tasks of failed dag instance and rerun their downstream tasks",
+		Response: entity.DagInstance{},
+	})
+	h.Register(http.MethodPost, "task-instances/:taskInsId/retry", retryTask, &RouteDoc{
+		Summary:  "retry the failed or canceled task instance",
+		Response: entity.DagInstance{},
+	})
+	h.Register(http.MethodPost, "task-instances/:taskInsId/cancel", cancelTask, &RouteDoc{
+		Summary:  "cancel the running task instance",
+		Response: entity.DagInstance{},
+	})
+	h.Register(http.MethodPost, "task-instances/:taskInsId/skip", skipTask, &RouteDoc{
+		Summary:  "skip the blocked or failed task instance manually, so its downstream tasks can proceed",
+		Body:     SkipTaskInput{},
+		Response: entity.DagInstance{},
+	})
+	h.Register(http.MethodPost, "callbacks/:token", completeCallback, &RouteDoc{
+		Summary:  "complete the task instance waiting for external callback with success or failure",
+		Body:     CompleteCallbackInput{},
+		Response: entity.DagInstance{},
+	})
+	h.Register(http.MethodPost, "dag-instances/:dagInsId/notes", addNote, &RouteDoc{
+		Summary:  "add note to dag instance",
+		Body:     AddNoteInput{},
+		Response: entity.DagInstance{},
+	})
+	h.Register(http.MethodPatch, "dag-instances/:dagInsId/annotations", annotate, &RouteDoc{
+		Summary:  "merge annotations of dag instance",
+		Body:     AnnotateInput{},
+		Response: entity.DagInstance{},
+	})
+	h.Register(http.MethodGet, "dead-letters", listDeadLetters, &RouteDoc{
+		Summary: "list dag instances which failed after their retry budgets are exhausted",
+		Query: []QueryParam{
+			{Name: "dagId"},
+			{Name: "limit", Type: "integer"},
+			{Name: "offset", Type: "integer"},
+		},
+		Response: []*entity.DagInstance{},
+	})
+	h.Register(http.MethodGet, "sla-misses", listSLAMisses, &RouteDoc{
+		Summary:  "list unfinished dag instances which missed any sla",
+		Query:    []QueryParam{{Name: "dagId"}},
+		Response: []*entity.DagInstance{},
+	})
+	h.Register(http.MethodGet, "dead-letters/:dagInsId", getDeadLetter, &RouteDoc{
+		Summary:  "get dead letter dag instance with its task instances",
+		Response: DeadLetterDetail{},
+	})
+	h.Register(http.MethodPost, "dead-letters/:dagInsId/requeue", requeueDeadLetter, &RouteDoc{
+		Summary:  "retry the failed tasks of dead letter dag instance with a new retry budget",
+		Response: entity.DagInstance{},
+	})
+	h.Register(http.MethodGet, "dags/:dagId/stats", getDagStats, &RouteDoc{
+		Summary: "get success rate and duration percentiles of completed dag instances",
+		Query: []QueryParam{
+			{Name: "from", Desc: "unix timestamp in milliseconds, default is 24 hours before to", Type: "integer"},
+			{Name: "to", Desc: "unix timestamp in milliseconds, default is now", Type: "integer"},
+			{Name: "interval", Desc: "split stats into buckets, such as 1h"},
+		},
+		Response: DagStats{},
+	})
+	h.Register(http.MethodGet, "grafana/annotations", listGrafanaAnnotations, &RouteDoc{
+		Summary: "list dag instances as grafana annotations",
+		Query: []QueryParam{
+			{Name: "dagId"},
+			{Name: "from", Desc: "unix timestamp in milliseconds, default is 24 hours before to", Type: "integer"},
+			{Name: "to", Desc: "unix timestamp in milliseconds, default is now", Type: "integer"},
+			{Name: "limit", Type: "integer"},
+		},
+		Response: []GrafanaAnnotation{},
+	})
+	h.Register(http.MethodGet, "cluster/config", getClusterConfig, &RouteDoc{
+		Summary:  "get runtime cluster config, zero fields mean using the startup options",
+		Response: entity.ClusterConfig{},
+	})
+	h.Register(http.MethodPut, "cluster/config", updateClusterConfig, &RouteDoc{
+		Summary:  "replace runtime cluster config, it is observed by all workers in next sync interval",
+		Body:     entity.ClusterConfig{},
+		Response: entity.ClusterConfig{},
+	})
+	h.Register(http.MethodGet, "workers", listWorkers, &RouteDoc{
+		Summary:  "list runtime info of workers",
+		Response: []entity.WorkerInfo{},
+	})
+	h.Register(http.MethodPost, "admin/reload", reload, &RouteDoc{
+		Summary:  "reload config of components, such as rotated credentials of store and keeper",
+		Response: ReloadOutput{},
+	})
+	h.Register(http.MethodPost, "admin/drain", drain, &RouteDoc{
+		Summary:  "drain current worker, it finishes running task instances, refuses new work and releases leadership",
+		Response: DrainOutput{},
+	})
+	h.Register(http.MethodPost, "admin/promote", promote, &RouteDoc{
+		Summary:  "promote the standby cluster to active, it takes over schedules and in-flight dag instances",
+		Response: entity.ClusterConfig{},
+	})
+	h.Register(http.MethodPost, "graphql", queryGraphQL, &RouteDoc{
+		Summary:  "query dags, dag instances and task instances as a graph, fetch the nested data in one request",
+		Body:     GraphQLRequest{},
+		Response: GraphQLResponse{},
+	})
+	h.Register(http.MethodGet, "openapi.json", getOpenAPI(h), &RouteDoc{
+		Summary:  "get OpenAPI document of management api",
+		Response: OpenAPIDoc{},
+	})
+	return h
+}
+
+// SetAuthenticator authenticate all requests by auth, nil means no authentication
+func (h *Handler) SetAuthenticator(auth Authenticator) {
+	h.auth = auth
+}
+
+// Register a route, the path is relative to PathPrefix, e.g. "dags/:dagId",
+// the doc is optional and used to generate OpenAPI document
+func (h *Handler) Register(method, path string, handle func(r *Request) (interface{}, error), doc ...*RouteDoc) {
+	rt := route{
+		method:   method,
+		segments: strings.Split(strings.Trim(path, "/"), "/"),
+		handle:   handle,
+	}
+	if len(doc) > 0 {
+		rt.doc = doc[0]
+	}
+	h.routes = append(h.routes, rt)
+}
+
+// ServeHTTP
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var user string
+	if h.auth != nil {
+		var err error
+		if user, err = h.auth.Authenticate(r); err != nil {
+			writeError(w, err)
+			return
+		}
+	}
+
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, PathPrefix), "/")
+	segments := strings.Split(path, "/")
+
+	methodNotAllowed := false
+	for _, rt := range h.routes {
+		params, ok := rt.match(segments)
+		if !ok {
+			continue
+		}
+		if rt.method != r.Method {
+			methodNotAllowed = true
+			continue
+		}
+
+		ret, err := rt.handle(&Request{Request: r, Params: params, User: user})
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		// the handler which need write raw response such as downloading can return a http.Handler
+		if hd, ok := ret.(http.Handler); ok {
+			hd.ServeHTTP(w, r)
+			return
+		}
+		writeJSON(w, http.StatusOK, ret)
+		return
+	}
+
+	if methodNotAllowed {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Message: "method not allowed"})
+		return
+	}
+	writeJSON(w, http.StatusNotFound, ErrorResponse{Message: "route not found"})
+}
+
+func (rt route) match(segments []string) (map[string]string, bool) {
+	if len(rt.segments) != len(segments) {
+		return nil, false
+	}
+	params := map[string]string{}
+	for i := range rt.segments {
+		if strings.HasPrefix(rt.segments[i], ":") {
+			if segments[i] == "" {
+				return nil, false
+			}
+			params[rt.segments[i][1:]] = segments[i]
+			continue
+		}
+		if rt.segments[i] != segments[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// ErrorResponse
+type ErrorResponse struct {
+	Message string `json:"message"`
+}
+
+// BadRequestError means the input of client is invalid
+type BadRequestError struct {
+	Err error
+}
+
+// Error
+func (e *BadRequestError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap
+func (e *BadRequestError) Unwrap() error {
+	return e.Err
+}
+
+func badRequest(format string, args ...interface{}) error {
+	return &BadRequestError{Err: fmt.Errorf(format, args...)}
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	var badReq *BadRequestError
+	switch {
+	case errors.As(err, &badReq), errors.Is(err, data.ErrDataInvalid):
+		code = http.StatusBadRequest
+	case errors.Is(err, ErrUnauthorized):
+		code = http.StatusUnauthorized
+	case errors.Is(err, ErrForbidden):
+		code = http.StatusForbidden
+	case errors.Is(err, data.ErrDataNotFound):
+		code = http.StatusNotFound
+	case errors.Is(err, data.ErrDataConflicted):
+		code = http.StatusConflict
+	case errors.Is(err, data.ErrStandby):
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, ErrorResponse{Message: err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, code int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	// the secret values may be contained in vars, share data, reasons or traces written by actions
+	if err := json.NewEncoder(w).Encode(redactBody(body)); err != nil {
+		log.Errorf("write response failed: %s", err)
+	}
+}
+
+func decodeBody(r *Request, ptr interface{}) error {
+	if r.Body == nil || r.ContentLength == 0 {
+		return nil
+	}
+	if err := json.NewDecoder(r.Body).Decode(ptr); err != nil {
+		return badRequest("decode body failed: %s", err)
+	}
+	return nil
+}
+
+func queryInt64(r *Request, key string) (int64, error) {
+	v := r.URL.Query().Get(key)
+	if v == "" {
+		return 0, nil
+	}
+	i, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, badRequest("query %s is not a valid integer: %s", key, v)
+	}
+	return i, nil
+}
+
+func querySlice(r *Request, key string) []string {
+	v := r.URL.Query().Get(key)
+	if v == "" {
+		return nil
+	}
+	return strings.Split(v, ",")
+}
+
+func listDags(r *Request) (interface{}, error) {
+	st, ok := mod.StoreAs[mod.DagPruneStore](mod.GetStore())
+	if !ok {
+		return nil, badRequest("store does not support listing dags")
+	}
+	ret, err := st.ListDag(&mod.ListDagInput{IDPrefix: r.URL.Query().Get("idPrefix")})
+	if err != nil {
+		return nil, err
+	}
+	if ret == nil {
+		ret = []*entity.Dag{}
+	}
+	return ret, nil
+}
+
+func getDag(r *Request) (interface{}, error) {
+	return mod.GetStore().GetDag(r.Params["dagId"])
+}
+
+// DagVarSchema
+type DagVarSchema struct {
+	Name string `json:"name"`
+	entity.DagVar
+}
+
+func getDagVars(r *Request) (interface{}, error) {
+	dag, err := mod.GetStore().GetDag(r.Params["dagId"])
+	if err != nil {
+		return nil, err
+	}
+	ret := []DagVarSchema{}
+	for name, v := range dag.Vars {
+		ret = append(ret, DagVarSchema{Name: name, DagVar: v})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Name < ret[j].Name
+	})
+	return ret, nil
+}
+
+// ApplyDagsInput
+type ApplyDagsInput struct {
+	Dags []*entity.Dag `json:"dags"`
+	// Prune delete the dags which id has PrunePrefix but are not in Dags
+	Prune       bool   `json:"prune,omitempty"`
+	PrunePrefix string `json:"prunePrefix,omitempty"`
+	DryRun      bool   `json:"dryRun,omitempty"`
+}
+
+func applyDags(r *Request) (interface{}, error) {
+	input := &ApplyDagsInput{}
+	if err := decodeBody(r, input); err != nil {
+		return nil, err
+	}
+	return mod.ApplyDags(input.Dags, &mod.ApplyOption{
+		Prune:       input.Prune,
+		PrunePrefix: input.PrunePrefix,
+		DryRun:      input.DryRun,
+	})
+}
+
+// RunDagInput
+type RunDagInput struct {
+	Vars map[string]string `json:"vars,omitempty"`
+	// Trigger default is "manually"
+	Trigger     entity.Trigger      `json:"trigger,omitempty"`
+	TriggerMeta *entity.TriggerMeta `json:"triggerMeta,omitempty"`
+	Labels      map[string]string   `json:"labels,omitempty"`
+	// LogicalDate and data interval are in RFC3339 format, such as "2022-01-01T00:00:00Z"
+	LogicalDate       time.Time `json:"logicalDate,omitempty"`
+	DataIntervalStart time.Time `json:"dataIntervalStart,omitempty"`
+	DataIntervalEnd   time.Time `json:"dataIntervalEnd,omitempty"`
+	// IdempotencyKey make the runs with the same key return the existing dag instance,
+	// IdempotencyWindowSecs limits how long the key is kept, zero means forever
+	IdempotencyKey        string `json:"idempotencyKey,omitempty"`
+	IdempotencyWindowSecs int64  `json:"idempotencyWindowSecs,omitempty"`
+}
+
+func runDag(r *Request) (interface{}, error) {
+	input := &RunDagInput{}
+	if err := decodeBody(r, input); err != nil {
+		return nil, err
+	}
+	if input.Trigger == "" {
+		input.Trigger = entity.TriggerManually
+	}
+	if !input.DataIntervalStart.IsZero() && !input.DataIntervalEnd.IsZero() &&
+		input.DataIntervalEnd.Before(input.DataIntervalStart) {
+		return nil, badRequest("dataIntervalEnd cannot be before dataIntervalStart")
+	}
+	if input.IdempotencyWindowSecs < 0 {
+		return nil, badRequest("idempotencyWindowSecs cannot be negative")
+	}
+	return mod.GetCommander().RunDag(r.Params["dagId"], input.Vars,
+		mod.RunDagTrigger(input.Trigger, input.TriggerMeta),
+		mod.RunDagLabels(input.Labels),
+		mod.RunDagLogicalDate(input.LogicalDate),
+		mod.RunDagDataInterval(input.DataIntervalStart, input.DataIntervalEnd),
+		mod.RunDagIdempotencyKey(input.IdempotencyKey, time.Duration(input.IdempotencyWindowSecs)*time.Second))
+}
+
+// StartBackfillInput
+type StartBackfillInput struct {
+	mod.BackfillInput
+	// DryRun only return the planned runs without creating them
+	DryRun bool `json:"dryRun,omitempty"`
+}
+
+func startBackfill(r *Request) (interface{}, error) {
+	input := &StartBackfillInput{}
+	if err := decodeBody(r, input); err != nil {
+		return nil, err
+	}
+	input.DagID = r.Params["dagId"]
+	if !input.DryRun {
+		return mod.StartBackfill(&input.BackfillInput)
+	}
+	runs, err := mod.PlanBackfill(&input.BackfillInput)
+	if err != nil {
+		return nil, err
+	}
+	return &mod.BackfillStatus{Input: input.BackfillInput, Runs: runs}, nil
+}
+
+func getBackfill(r *Request) (interface{}, error) {
+	return mod.GetBackfill(r.Params["backfillId"])
+}
+
+func cancelBackfill(r *Request) (interface{}, error) {
+	return mod.CancelBackfill(r.Params["backfillId"])
+}
+
+func listDagIns(r *Request) (interface{}, error) {
+	input := &mod.ListDagInstanceInput{
+		DagID:          r.URL.Query().Get("dagId"),
+		Worker:         r.URL.Query().Get("worker"),
+		Trigger:        entity.Trigger(r.URL.Query().Get("trigger")),
+		TriggerSource:  r.URL.Query().Get("triggerSource"),
+		IdempotencyKey: r.URL.Query().Get("idempotencyKey"),
+	}
+	for _, s := range querySlice(r, "status") {
+		input.Status = append(input.Status, entity.DagInstanceStatus(s))
+	}
+	// labels is in form of "k1=v1,k2=v2"
+	for _, s := range querySlice(r, "labels") {
+		kv := strings.SplitN(s, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, badRequest("query labels is invalid: %s", s)
+		}
+		if input.Labels == nil {
+			input.Labels = map[string]string{}
+		}
+		input.Labels[kv[0]] = kv[1]
+	}
+
+	var err error
+	if input.Limit, err = queryInt64(r, "limit"); err != nil {
+		return nil, err
+	}
+	if input.Offset, err = queryInt64(r, "offset"); err != nil {
+		return nil, err
+	}
+	ret, err := mod.GetStore().ListDagInstance(input)
+	if err != nil {
+		return nil, err
+	}
+	if ret == nil {
+		ret = []*entity.DagInstance{}
+	}
+	return ret, nil
+}
+
+func getDagIns(r *Request) (interface{}, error) {
+	return mod.GetStore().GetDagInstance(r.Params["dagInsId"])
+}
+
+func getDagInsStatus(r *Request) (interface{}, error) {
+	return mod.GetDagInsStatus(r.Params["dagInsId"])
+}
+
+func getDagInsGraph(r *Request) (interface{}, error) {
+	return mod.GetDagInsGraph(r.Params["dagInsId"])
+}
+
+func getRunTree(r *Request) (interface{}, error) {
+	return mod.GetRunTree(r.Params["dagInsId"])
+}
+
+func getQueuePosition(r *Request) (interface{}, error) {
+	return mod.GetQueuePosition(r.Params["dagInsId"])
+}
+
+func listTaskIns(r *Request) (interface{}, error) {
+	ret, err := mod.GetStore().ListTaskInstance(&mod.ListTaskInstanceInput{
+		DagInsID: r.Params["dagInsId"],
+	})
+	if err != nil {
+		return nil, err
+	}
+	if ret == nil {
+		ret = []*entity.TaskInstance{}
+	}
+	return ret, nil
+}
+
+func getDagInsSnapshot(r *Request) (interface{}, error) {
+	js, ok := mod.GetStore().(*journal.Store)
+	if !ok {
+		return nil, badRequest("store is not journaled, the history of dag instance cannot be reconstructed")
+	}
+	at, err := queryInt64(r, "at")
+	if err != nil {
+		return nil, err
+	}
+	if at == 0 {
+		at = time.Now().UnixMilli()
+	}
+	return journal.Reconstruct(js.Journal(), r.Params["dagInsId"], time.UnixMilli(at))
+}
+
+func listTaskAttempts(r *Request) (interface{}, error) {
+	taskIns, err := mod.GetStore().GetTaskIns(r.Params["taskInsId"])
+	if err != nil {
+		return nil, err
+	}
+	if taskIns.Attempts == nil {
+		return []entity.TaskAttempt{}, nil
+	}
+	return taskIns.Attempts, nil
+}
+
+func listTaskLogs(r *Request) (interface{}, error) {
+	cursor, err := queryInt64(r, "cursor")
+	if err != nil {
+		return nil, err
+	}
+	limit, err := queryInt64(r, "limit")
+	if err != nil {
+		return nil, err
+	}
+	return mod.GetTaskLogs(r.Params["taskInsId"], cursor, int(limit))
+}
+
+func listTaskArtifacts(r *Request) (interface{}, error) {
+	taskIns, err := mod.GetStore().GetTaskIns(r.Params["taskInsId"])
+	if err != nil {
+		return nil, err
+	}
+	if taskIns.Artifacts == nil {
+		return []run.Artifact{}, nil
+	}
+	return taskIns.Artifacts, nil
+}
+
+func downloadTaskArtifact(r *Request) (interface{}, error) {
+	taskIns, err := mod.GetStore().GetTaskIns(r.Params["taskInsId"])
+	if err != nil {
+		return nil, err
+	}
+	artifact, ok := taskIns.GetArtifact(r.Params["name"])
+	if !ok {
+		return nil, fmt.Errorf("artifact %s: %w", r.Params["name"], data.ErrDataNotFound)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if artifact.Deleted {
+			writeJSON(w, http.StatusGone, ErrorResponse{Message: "artifact is deleted because it is out of retention"})
+			return
+		}
+		path, isLocal := mod.LocalArtifactPath(artifact)
+		if !isLocal {
+			http.Redirect(w, req, artifact.URI, http.StatusFound)
+			return
+		}
+		if artifact.ContentType != "" {
+			w.Header().Set("Content-Type", artifact.ContentType)
+		}
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filepath.Base(path)))
+		http.ServeFile(w, req, path)
+	}), nil
+}
+
+// AddNoteInput
+type AddNoteInput struct {
+	Content string `json:"content"`
+	Author  string `json:"author,omitempty"`
+}
+
+// SkipTaskInput
+type SkipTaskInput struct {
+	// Operator default is the user returned by Authenticator
+	Operator string `json:"operator"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+func skipTask(r *Request) (interface{}, error) {
+	input := &SkipTaskInput{}
+	if err := decodeBody(r, input); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(input.Operator) == "" {
+		input.Operator = r.User
+	}
+	if strings.TrimSpace(input.Operator) == "" {
+		return nil, badRequest("operator cannot be empty")
+	}
+	taskIns, err := mod.GetStore().GetTaskIns(r.Params["taskInsId"])
+	if err != nil {
+		return nil, err
+	}
+	if err := mod.GetCommander().SkipTask([]string{taskIns.ID}, input.Operator, input.Reason); err != nil {
+		return nil, err
+	}
+	return mod.GetStore().GetDagInstance(taskIns.DagInsID)
+}
+
+// CompleteCallbackInput
+type CompleteCallbackInput struct {
+	// Status is success or failed
+	Status entity.TaskInstanceStatus `json:"status"`
+	Reason string                    `json:"reason,omitempty"`
+	// Operator default is the user returned by Authenticator
+	Operator string                 `json:"operator,omitempty"`
+	Outputs  map[string]interface{} `json:"outputs,omitempty"`
+}
+
+func completeCallback(r *Request) (interface{}, error) {
+	input := &CompleteCallbackInput{}
+	if err := decodeBody(r, input); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(input.Operator) == "" {
+		input.Operator = r.User
+	}
+	taskIns, err := mod.CompleteCallback(r.Params["token"], &mod.CallbackInput{
+		Status:   input.Status,
+		Reason:   input.Reason,
+		Operator: input.Operator,
+		Outputs:  input.Outputs,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return mod.GetStore().GetDagInstance(taskIns.DagInsID)
+}
+
+func retryTask(r *Request) (interface{}, error) {
+	taskIns, err := mod.GetStore().GetTaskIns(r.Params["taskInsId"])
+	if err != nil {
+		return nil, err
+	}
+	if err := mod.GetCommander().RetryTask([]string{taskIns.ID}); err != nil {
+		return nil, err
+	}
+	return mod.GetStore().GetDagInstance(taskIns.DagInsID)
+}
+
+func cancelTask(r *Request) (interface{}, error) {
+	taskIns, err := mod.GetStore().GetTaskIns(r.Params["taskInsId"])
+	if err != nil {
+		return nil, err
+	}
+	if err := mod.GetCommander().CancelTask([]string{taskIns.ID}); err != nil {
+		return nil, err
+	}
+	return mod.GetStore().GetDagInstance(taskIns.DagInsID)
+}
+
+func retryFromFailed(r *Request) (interface{}, error) {
+	if err := mod.GetCommander().RetryFromFailed(r.Params["dagInsId"]); err != nil {
+		return nil, err
+	}
+	return mod.GetStore().GetDagInstance(r.Params["dagInsId"])
+}
+
+func addNote(r *Request) (interface{}, error) {
+	input := &AddNoteInput{}
+	if err := decodeBody(r, input); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(input.Content) == "" {
+		return nil, badRequest("note content cannot be empty")
+	}
+	return mod.GetCommander().AddNote(r.Params["dagInsId"], input.Content, input.Author)
+}
+
+// AnnotateInput
+type AnnotateInput struct {
+	// Annotations will be merged, the key with empty value will be removed
+	Annotations map[string]string `json:"annotations"`
+}
+
+func annotate(r *Request) (interface{}, error) {
+	input := &AnnotateInput{}
+	if err := decodeBody(r, input); err != nil {
+		return nil, err
+	}
+	if len(input.Annotations) == 0 {
+		return nil, badRequest("annotations cannot be empty")
+	}
+	return mod.GetCommander().Annotate(r.Params["dagInsId"], input.Annotations)
+}
+
+func listDeadLetters(r *Request) (interface{}, error) {
+	input := &mod.ListDagInstanceInput{
+		DagID:      r.URL.Query().Get("dagId"),
+		DeadLetter: true,
+	}
+	var err error
+	if input.Limit, err = queryInt64(r, "limit"); err != nil {
+		return nil, err
+	}
+	if input.Offset, err = queryInt64(r, "offset"); err != nil {
+		return nil, err
+	}
+	ret, err := mod.GetStore().ListDagInstance(input)
+	if err != nil {
+		return nil, err
+	}
+	if ret == nil {
+		ret = []*entity.DagInstance{}
+	}
+	return ret, nil
+}
+
+func listSLAMisses(r *Request) (interface{}, error) {
+	ret, err := mod.ListSLAMissedDagIns(r.URL.Query().Get("dagId"))
+	if err != nil {
+		return nil, err
+	}
+	if ret == nil {
+		ret = []*entity.DagInstance{}
+	}
+	return ret, nil
+}
+
+// DeadLetterDetail is the full context of dead letter
+type DeadLetterDetail struct {
+	DagInstance   *entity.DagInstance    `json:"dagInstance"`
+	TaskInstances []*entity.TaskInstance `json:"taskInstances"`
+}
+
+func getDeadLetter(r *Request) (interface{}, error) {
+	dagIns, err := mod.GetStore().GetDagInstance(r.Params["dagInsId"])
+	if err != nil {
+		return nil, err
+	}
+	if dagIns.DeadLetter == nil {
+		return nil, fmt.Errorf("dead letter %s: %w", dagIns.ID, data.ErrDataNotFound)
+	}
+	tasks, err := mod.GetStore().ListTaskInstance(&mod.ListTaskInstanceInput{DagInsID: dagIns.ID})
+	if err != nil {
+		return nil, err
+	}
+	if tasks == nil {
+		tasks = []*entity.TaskInstance{}
+	}
+	return &DeadLetterDetail{DagInstance: dagIns, TaskInstances: tasks}, nil
+}
+
+func requeueDeadLetter(r *Request) (interface{}, error) {
+	if err := mod.GetCommander().Requeue(r.Params["dagInsId"]); err != nil {
+		return nil, err
+	}
+	return mod.GetStore().GetDagInstance(r.Params["dagInsId"])
+}
+
+func listWorkers(r *Request) (interface{}, error) {
+	return mod.ListWorkerInfo()
+}
+
+func getClusterConfig(r *Request) (interface{}, error) {
+	return mod.LoadClusterConfig()
+}
+
+func updateClusterConfig(r *Request) (interface{}, error) {
+	input := &entity.ClusterConfig{}
+	if err := decodeBody(r, input); err != nil {
+		return nil, err
+	}
+	return mod.UpdateClusterConfig(input)
+}
+
+// ReloadOutput
+type ReloadOutput struct {
+	Reloaded []string `json:"reloaded"`
+}
+
+func reload(r *Request) (interface{}, error) {
+	reloaded, err := mod.Reload()
+	if err != nil {
+		return nil, err
+	}
+	return &ReloadOutput{Reloaded: reloaded}, nil
+}
+
+// DrainOutput
+type DrainOutput struct {
+	WorkerKey string `json:"workerKey"`
+	Draining  bool   `json:"draining"`
+}
+
+// drain does not wait for the running task instances, the worker exits after drained when started by fastflow.Start
+func drain(r *Request) (interface{}, error) {
+	go func() {
+		if err := mod.Drain(context.Background()); err != nil {
+			log.Errorf("drain worker failed: %s", err)
+		}
+	}()
+	return &DrainOutput{WorkerKey: mod.GetKeeper().WorkerKey(), Draining: true}, nil
+}
+
+func promote(r *Request) (interface{}, error) {
+	return mod.Promote()
+}
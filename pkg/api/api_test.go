@@ -0,0 +1,751 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/entity/run"
+	"github.com/etherealiy/fastflow/pkg/journal"
+	"github.com/etherealiy/fastflow/pkg/log"
+	"github.com/etherealiy/fastflow/pkg/mod"
+	"github.com/etherealiy/fastflow/store/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandler_ServeHTTP(t *testing.T) {
+	st := memory.NewStore()
+	mod.SetStore(st)
+	mod.SetCommander(&mod.DefCommander{})
+	defer mod.SetClusterConfig(&entity.ClusterConfig{})
+	mKeeper := &mod.MockKeeper{}
+	mKeeper.On("AliveNodes").Return([]string{"worker-1", "worker-2"}, nil)
+	mKeeper.On("IsAlive", "worker-1").Return(true, nil)
+	mod.SetKeeper(mKeeper)
+	assert.NoError(t, st.SaveWorkerInfo(&entity.WorkerInfo{Key: "worker-1", Version: "v1.0.0", Capacity: 10}))
+	assert.NoError(t, st.CreateDag(&entity.Dag{
+		BaseInfo: entity.BaseInfo{ID: "dag1"},
+		Status:   entity.DagStatusNormal,
+		Vars: entity.DagVars{
+			"key":  {DefaultValue: "def"},
+			"size": {DefaultValue: "1", Type: entity.DagVarTypeInt},
+		},
+		Tasks: []entity.Task{{ID: "task1", ActionName: "act"}},
+	}))
+
+	assert.NoError(t, st.BatchCreatTaskIns([]*entity.TaskInstance{{
+		BaseInfo: entity.BaseInfo{ID: "task-ins1"},
+		TaskID:   "task1",
+		Status:   entity.TaskInstanceStatusFailed,
+		Attempts: []entity.TaskAttempt{
+			{Attempt: 1, Worker: "worker-1", StartedAt: 1, EndedAt: 2, Status: entity.TaskInstanceStatusFailed, Reason: "timeout"},
+		},
+		Artifacts: []run.Artifact{{Name: "report", URI: "s3://bucket/report.html", CreatedAt: 1}},
+	}}))
+	assert.NoError(t, st.AppendTaskLogs("task-ins1", []*entity.TaskLog{
+		{Seq: 1, Time: 1, Level: entity.TaskLogLevelInfo, Message: "started"},
+		{Seq: 2, Time: 2, Level: entity.TaskLogLevelStdout, Message: "done"},
+	}, 10))
+
+	assert.NoError(t, st.CreateDagIns(&entity.DagInstance{
+		BaseInfo:    entity.BaseInfo{ID: "dead1"},
+		DagID:       "dag1",
+		Worker:      "worker-1",
+		Status:      entity.DagInstanceStatusFailed,
+		RetryBudget: 1,
+		RetryCount:  1,
+		DeadLetter:  &entity.DeadLetter{Reason: "task[task1] failed or canceled", CreatedAt: 1},
+	}))
+	assert.NoError(t, st.BatchCreatTaskIns([]*entity.TaskInstance{{
+		BaseInfo: entity.BaseInfo{ID: "dead-task-ins1"},
+		DagInsID: "dead1",
+		TaskID:   "task1",
+		Status:   entity.TaskInstanceStatusFailed,
+	}}))
+
+	assert.NoError(t, st.CreateDagIns(&entity.DagInstance{
+		BaseInfo:    entity.BaseInfo{ID: "running1"},
+		DagID:       "dag1",
+		Worker:      "worker-1",
+		Status:      entity.DagInstanceStatusRunning,
+		SLAs:        []entity.SLA{{Deadline: 1, MissedAt: 1}},
+		SLAMissedAt: 1,
+	}))
+	assert.NoError(t, st.BatchCreatTaskIns([]*entity.TaskInstance{
+		{
+			BaseInfo: entity.BaseInfo{ID: "running-task-ins1"},
+			DagInsID: "running1",
+			TaskID:   "task1",
+			Status:   entity.TaskInstanceStatusRunning,
+		},
+		{
+			BaseInfo: entity.BaseInfo{ID: "running-task-ins2"},
+			DagInsID: "running1",
+			TaskID:   "task2",
+			DependOn: []string{"task1"},
+			Status:   entity.TaskInstanceStatusFailed,
+		},
+	}))
+
+	assert.NoError(t, st.CreateDagIns(&entity.DagInstance{
+		BaseInfo: entity.BaseInfo{ID: "blocked1"},
+		DagID:    "dag1",
+		Worker:   "worker-1",
+		Status:   entity.DagInstanceStatusBlocked,
+	}))
+	approval := &entity.TaskInstance{
+		BaseInfo: entity.BaseInfo{ID: "approval-task-ins1"},
+		DagInsID: "blocked1",
+		TaskID:   "approval",
+		Status:   entity.TaskInstanceStatusBlocked,
+	}
+	cb, cbToken, err := entity.NewExternalCallback(approval, 0)
+	assert.NoError(t, err)
+	approval.Callback = cb
+	assert.NoError(t, st.BatchCreatTaskIns([]*entity.TaskInstance{approval}))
+
+	assert.NoError(t, st.CreateDagIns(&entity.DagInstance{
+		BaseInfo:       entity.BaseInfo{ID: "child1"},
+		DagID:          "dag2",
+		ParentDagInsID: "1",
+		RootDagInsID:   "1",
+	}))
+
+	tests := []struct {
+		caseDesc string
+		giveReq  *http.Request
+		wantCode int
+		wantBody string
+	}{
+		{
+			caseDesc: "list dags",
+			giveReq:  httptest.NewRequest(http.MethodGet, "/api/v1/dags?idPrefix=dag", nil),
+			wantCode: http.StatusOK,
+			wantBody: `[{"id":"dag1"`,
+		},
+		{
+			caseDesc: "list dags by not matched prefix",
+			giveReq:  httptest.NewRequest(http.MethodGet, "/api/v1/dags?idPrefix=none", nil),
+			wantCode: http.StatusOK,
+			wantBody: `[]`,
+		},
+		{
+			caseDesc: "get dag",
+			giveReq:  httptest.NewRequest(http.MethodGet, "/api/v1/dags/dag1", nil),
+			wantCode: http.StatusOK,
+			wantBody: `"id":"dag1"`,
+		},
+		{
+			caseDesc: "dag not found",
+			giveReq:  httptest.NewRequest(http.MethodGet, "/api/v1/dags/dag2", nil),
+			wantCode: http.StatusNotFound,
+		},
+		{
+			caseDesc: "run dag",
+			giveReq:  httptest.NewRequest(http.MethodPost, "/api/v1/dags/dag1/run", strings.NewReader(`{"vars":{"key":"v1"}}`)),
+			wantCode: http.StatusOK,
+			wantBody: `"vars":{"key":{"value":"v1"},"size":{"value":"1"}}`,
+		},
+		{
+			caseDesc: "run dag with invalid var",
+			giveReq:  httptest.NewRequest(http.MethodPost, "/api/v1/dags/dag1/run", strings.NewReader(`{"vars":{"size":"one"}}`)),
+			wantCode: http.StatusBadRequest,
+			wantBody: `var[size] is invalid, \"one\" is not an int`,
+		},
+		{
+			caseDesc: "get dag vars",
+			giveReq:  httptest.NewRequest(http.MethodGet, "/api/v1/dags/dag1/vars", nil),
+			wantCode: http.StatusOK,
+			wantBody: `[{"name":"key","defaultValue":"def"},{"name":"size","defaultValue":"1","type":"int"}]`,
+		},
+		{
+			caseDesc: "run dag with bad body",
+			giveReq:  httptest.NewRequest(http.MethodPost, "/api/v1/dags/dag1/run", strings.NewReader(`{`)),
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			caseDesc: "method not allowed",
+			giveReq:  httptest.NewRequest(http.MethodDelete, "/api/v1/dags/dag1", nil),
+			wantCode: http.StatusMethodNotAllowed,
+		},
+		{
+			caseDesc: "list dag instances",
+			giveReq:  httptest.NewRequest(http.MethodGet, "/api/v1/dag-instances?dagId=dag1&status=init", nil),
+			wantCode: http.StatusOK,
+			wantBody: `"dagId":"dag1"`,
+		},
+		{
+			caseDesc: "get queue position",
+			giveReq:  httptest.NewRequest(http.MethodGet, "/api/v1/dag-instances/1/queue-position", nil),
+			wantCode: http.StatusOK,
+			wantBody: `{"dagInsId":"1","position":1,"total":1,"effectivePriority":0}`,
+		},
+		{
+			caseDesc: "add note",
+			giveReq:  httptest.NewRequest(http.MethodPost, "/api/v1/dag-instances/1/notes", strings.NewReader(`{"content":"retried after fixing credentials","author":"ops"}`)),
+			wantCode: http.StatusOK,
+			wantBody: `"notes":[{"content":"retried after fixing credentials","author":"ops"`,
+		},
+		{
+			caseDesc: "add empty note",
+			giveReq:  httptest.NewRequest(http.MethodPost, "/api/v1/dag-instances/1/notes", strings.NewReader(`{"content":" "}`)),
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			caseDesc: "annotate",
+			giveReq:  httptest.NewRequest(http.MethodPatch, "/api/v1/dag-instances/1/annotations", strings.NewReader(`{"annotations":{"ticket":"OPS-123"}}`)),
+			wantCode: http.StatusOK,
+			wantBody: `"annotations":{"ticket":"OPS-123"}`,
+		},
+		{
+			caseDesc: "list dag instances with notes",
+			giveReq:  httptest.NewRequest(http.MethodGet, "/api/v1/dag-instances?dagId=dag1", nil),
+			wantCode: http.StatusOK,
+			wantBody: `"annotations":{"ticket":"OPS-123"}`,
+		},
+		{
+			caseDesc: "annotate not existed dag instance",
+			giveReq:  httptest.NewRequest(http.MethodPatch, "/api/v1/dag-instances/999/annotations", strings.NewReader(`{"annotations":{"ticket":"OPS-123"}}`)),
+			wantCode: http.StatusNotFound,
+		},
+		{
+			caseDesc: "get dag instance status",
+			giveReq:  httptest.NewRequest(http.MethodGet, "/api/v1/dag-instances/running1/status", nil),
+			wantCode: http.StatusOK,
+			wantBody: `"status":"running","treeStatus":"running"`,
+		},
+		{
+			caseDesc: "get dag instance graph",
+			giveReq:  httptest.NewRequest(http.MethodGet, "/api/v1/dag-instances/running1/graph", nil),
+			wantCode: http.StatusOK,
+			wantBody: `{"id":"running-task-ins2","taskId":"task2","status":"failed","level":1}],"edges":[{"from":"running-task-ins1","to":"running-task-ins2"}]`,
+		},
+		{
+			caseDesc: "get status of not existed dag instance",
+			giveReq:  httptest.NewRequest(http.MethodGet, "/api/v1/dag-instances/none/status", nil),
+			wantCode: http.StatusNotFound,
+		},
+		{
+			caseDesc: "retry task",
+			giveReq:  httptest.NewRequest(http.MethodPost, "/api/v1/task-instances/running-task-ins2/retry", nil),
+			wantCode: http.StatusOK,
+			wantBody: `"cmd":{"Name":"retry","TargetTaskInsIDs":["running-task-ins2"]`,
+		},
+		{
+			caseDesc: "cancel task when dag instance has incomplete command",
+			giveReq:  httptest.NewRequest(http.MethodPost, "/api/v1/task-instances/running-task-ins1/cancel", nil),
+			wantCode: http.StatusInternalServerError,
+			wantBody: `incomplete command`,
+		},
+		{
+			caseDesc: "cancel not existed task",
+			giveReq:  httptest.NewRequest(http.MethodPost, "/api/v1/task-instances/none/cancel", nil),
+			wantCode: http.StatusNotFound,
+		},
+		{
+			caseDesc: "complete callback with invalid status",
+			giveReq:  httptest.NewRequest(http.MethodPost, "/api/v1/callbacks/"+cbToken, strings.NewReader(`{"status":"skipped"}`)),
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			caseDesc: "complete callback",
+			giveReq:  httptest.NewRequest(http.MethodPost, "/api/v1/callbacks/"+cbToken, strings.NewReader(`{"status":"success","operator":"ops","outputs":{"ticket":"OPS-1"}}`)),
+			wantCode: http.StatusOK,
+			wantBody: `"cmd":{"Name":"continue","TargetTaskInsIDs":["approval-task-ins1"]`,
+		},
+		{
+			caseDesc: "complete callback again",
+			giveReq:  httptest.NewRequest(http.MethodPost, "/api/v1/callbacks/"+cbToken, strings.NewReader(`{"status":"failed"}`)),
+			wantCode: http.StatusConflict,
+			wantBody: "callback is already completed by ops",
+		},
+		{
+			caseDesc: "complete callback with invalid token",
+			giveReq:  httptest.NewRequest(http.MethodPost, "/api/v1/callbacks/approval-task-ins1.secret", strings.NewReader(`{"status":"success"}`)),
+			wantCode: http.StatusNotFound,
+		},
+		{
+			caseDesc: "get run tree",
+			giveReq:  httptest.NewRequest(http.MethodGet, "/api/v1/dag-instances/child1/run-tree", nil),
+			wantCode: http.StatusOK,
+			wantBody: `"children":[{"dagIns":{"id":"child1"`,
+		},
+		{
+			caseDesc: "get run tree of not existed dag instance",
+			giveReq:  httptest.NewRequest(http.MethodGet, "/api/v1/dag-instances/999/run-tree", nil),
+			wantCode: http.StatusNotFound,
+		},
+		{
+			caseDesc: "snapshot without journal",
+			giveReq:  httptest.NewRequest(http.MethodGet, "/api/v1/dag-instances/1/snapshot", nil),
+			wantCode: http.StatusBadRequest,
+			wantBody: `store is not journaled`,
+		},
+		{
+			caseDesc: "list task attempts",
+			giveReq:  httptest.NewRequest(http.MethodGet, "/api/v1/task-instances/task-ins1/attempts", nil),
+			wantCode: http.StatusOK,
+			wantBody: `[{"attempt":1,"worker":"worker-1","startedAt":1,"endedAt":2,"status":"failed","reason":"timeout"}]`,
+		},
+		{
+			caseDesc: "list task artifacts",
+			giveReq:  httptest.NewRequest(http.MethodGet, "/api/v1/task-instances/task-ins1/artifacts", nil),
+			wantCode: http.StatusOK,
+			wantBody: `[{"name":"report","uri":"s3://bucket/report.html","createdAt":1}]`,
+		},
+		{
+			caseDesc: "list task logs after cursor",
+			giveReq:  httptest.NewRequest(http.MethodGet, "/api/v1/task-instances/task-ins1/logs?cursor=1&limit=10", nil),
+			wantCode: http.StatusOK,
+			wantBody: `[{"seq":2,"time":2,"level":"stdout","message":"done"}]`,
+		},
+		{
+			caseDesc: "list task logs with invalid cursor",
+			giveReq:  httptest.NewRequest(http.MethodGet, "/api/v1/task-instances/task-ins1/logs?cursor=a", nil),
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			caseDesc: "list attempts of not existed task",
+			giveReq:  httptest.NewRequest(http.MethodGet, "/api/v1/task-instances/task-ins2/attempts", nil),
+			wantCode: http.StatusNotFound,
+		},
+		{
+			caseDesc: "run dag by webhook",
+			giveReq: httptest.NewRequest(http.MethodPost, "/api/v1/dags/dag1/run",
+				strings.NewReader(`{"trigger":"webhook","triggerMeta":{"source":"github"},"labels":{"team":"infra"}}`)),
+			wantCode: http.StatusOK,
+			wantBody: `"trigger":"webhook"`,
+		},
+		{
+			caseDesc: "list dag instances by trigger source and labels",
+			giveReq:  httptest.NewRequest(http.MethodGet, "/api/v1/dag-instances?trigger=webhook&triggerSource=github&labels=team=infra", nil),
+			wantCode: http.StatusOK,
+			wantBody: `"triggerMeta":{"source":"github"},"labels":{"team":"infra"}`,
+		},
+		{
+			caseDesc: "list dag instances by not matched labels",
+			giveReq:  httptest.NewRequest(http.MethodGet, "/api/v1/dag-instances?labels=team=ops", nil),
+			wantCode: http.StatusOK,
+			wantBody: `[]`,
+		},
+		{
+			caseDesc: "run dag with data interval",
+			giveReq: httptest.NewRequest(http.MethodPost, "/api/v1/dags/dag1/run",
+				strings.NewReader(`{"dataIntervalStart":"2022-01-01T00:00:00Z","dataIntervalEnd":"2022-01-02T00:00:00Z"}`)),
+			wantCode: http.StatusOK,
+			wantBody: `"logicalDate":1640995200,"dataIntervalStart":1640995200,"dataIntervalEnd":1641081600`,
+		},
+		{
+			caseDesc: "run dag with invalid data interval",
+			giveReq: httptest.NewRequest(http.MethodPost, "/api/v1/dags/dag1/run",
+				strings.NewReader(`{"dataIntervalStart":"2022-01-02T00:00:00Z","dataIntervalEnd":"2022-01-01T00:00:00Z"}`)),
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			caseDesc: "invalid labels",
+			giveReq:  httptest.NewRequest(http.MethodGet, "/api/v1/dag-instances?labels=team", nil),
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			caseDesc: "invalid limit",
+			giveReq:  httptest.NewRequest(http.MethodGet, "/api/v1/dag-instances?limit=abc", nil),
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			caseDesc: "apply dags",
+			giveReq: httptest.NewRequest(http.MethodPost, "/api/v1/dags/apply",
+				strings.NewReader(`{"dags":[{"id":"applied","tasks":[{"id":"t1","actionName":"act"}]}],"prune":true,"prunePrefix":"applied"}`)),
+			wantCode: http.StatusOK,
+			wantBody: `"dags":[{"dagId":"applied","action":"created"}]`,
+		},
+		{
+			caseDesc: "apply invalid dags",
+			giveReq:  httptest.NewRequest(http.MethodPost, "/api/v1/dags/apply", strings.NewReader(`{"dags":[{"id":"applied"}]}`)),
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			caseDesc: "plan backfill",
+			giveReq: httptest.NewRequest(http.MethodPost, "/api/v1/dags/dag1/backfills", strings.NewReader(
+				`{"dateVar":"key","start":"2023-01-01T00:00:00Z","end":"2023-01-03T00:00:00Z","dryRun":true}`)),
+			wantCode: http.StatusOK,
+			wantBody: `"runs":[{"logicalDate":"2023-01-01T00:00:00Z","dataIntervalEnd":"2023-01-02T00:00:00Z"},` +
+				`{"logicalDate":"2023-01-02T00:00:00Z","dataIntervalEnd":"2023-01-03T00:00:00Z"}]`,
+		},
+		{
+			caseDesc: "start backfill",
+			giveReq: httptest.NewRequest(http.MethodPost, "/api/v1/dags/dag1/backfills", strings.NewReader(
+				`{"id":"bf1","dateVar":"key","start":"2023-01-01T00:00:00Z","end":"2023-01-03T00:00:00Z"}`)),
+			wantCode: http.StatusOK,
+			wantBody: `"dagInsId":"backfill-bf1-1672531200","status":"init"},{"logicalDate":"2023-01-02T00:00:00Z",` +
+				`"dataIntervalEnd":"2023-01-03T00:00:00Z"}]`,
+		},
+		{
+			caseDesc: "start backfill with undeclared var",
+			giveReq: httptest.NewRequest(http.MethodPost, "/api/v1/dags/dag1/backfills", strings.NewReader(
+				`{"dateVar":"ds","start":"2023-01-01T00:00:00Z","end":"2023-01-03T00:00:00Z"}`)),
+			wantCode: http.StatusBadRequest,
+			wantBody: "var[ds] is not declared by dag[dag1]",
+		},
+		{
+			caseDesc: "get backfill",
+			giveReq:  httptest.NewRequest(http.MethodGet, "/api/v1/backfills/bf1", nil),
+			wantCode: http.StatusOK,
+			wantBody: `"state":"running"`,
+		},
+		{
+			caseDesc: "cancel backfill",
+			giveReq:  httptest.NewRequest(http.MethodPost, "/api/v1/backfills/bf1/cancel", nil),
+			wantCode: http.StatusOK,
+			wantBody: `"state":"canceled"`,
+		},
+		{
+			caseDesc: "get not existed backfill",
+			giveReq:  httptest.NewRequest(http.MethodGet, "/api/v1/backfills/bf2", nil),
+			wantCode: http.StatusNotFound,
+		},
+		{
+			caseDesc: "list dead letters",
+			giveReq:  httptest.NewRequest(http.MethodGet, "/api/v1/dead-letters?dagId=dag1", nil),
+			wantCode: http.StatusOK,
+			wantBody: `"deadLetter":{"reason":"task[task1] failed or canceled","createdAt":1}`,
+		},
+		{
+			caseDesc: "list sla misses",
+			giveReq:  httptest.NewRequest(http.MethodGet, "/api/v1/sla-misses?dagId=dag1", nil),
+			wantCode: http.StatusOK,
+			wantBody: `[{"id":"running1"`,
+		},
+		{
+			caseDesc: "get dead letter",
+			giveReq:  httptest.NewRequest(http.MethodGet, "/api/v1/dead-letters/dead1", nil),
+			wantCode: http.StatusOK,
+			wantBody: `"taskInstances":[{"id":"dead-task-ins1"`,
+		},
+		{
+			caseDesc: "get dag instance which is not dead letter",
+			giveReq:  httptest.NewRequest(http.MethodGet, "/api/v1/dead-letters/child1", nil),
+			wantCode: http.StatusNotFound,
+		},
+		{
+			caseDesc: "requeue dead letter",
+			giveReq:  httptest.NewRequest(http.MethodPost, "/api/v1/dead-letters/dead1/requeue", nil),
+			wantCode: http.StatusOK,
+			wantBody: `"retryBudget":1,"retryCount":1}`,
+		},
+		{
+			caseDesc: "requeue dag instance which is not dead letter",
+			giveReq:  httptest.NewRequest(http.MethodPost, "/api/v1/dead-letters/dead1/requeue", nil),
+			wantCode: http.StatusConflict,
+			wantBody: `dag instance is not in dead letter`,
+		},
+		{
+			caseDesc: "list workers",
+			giveReq:  httptest.NewRequest(http.MethodGet, "/api/v1/workers", nil),
+			wantCode: http.StatusOK,
+			wantBody: `[{"key":"worker-1","version":"v1.0.0","startedAt":0,"capacity":10,"parserQueueLen":0,"executorQueueLen":0,"reportedAt":0,"alive":true},{"key":"worker-2"`,
+		},
+		{
+			caseDesc: "update cluster config",
+			giveReq:  httptest.NewRequest(http.MethodPut, "/api/v1/cluster/config", strings.NewReader(`{"dispatchBatchSize":50}`)),
+			wantCode: http.StatusOK,
+			wantBody: `"dispatchBatchSize":50`,
+		},
+		{
+			caseDesc: "get cluster config",
+			giveReq:  httptest.NewRequest(http.MethodGet, "/api/v1/cluster/config", nil),
+			wantCode: http.StatusOK,
+			wantBody: `"dispatchBatchSize":50`,
+		},
+		{
+			caseDesc: "update invalid cluster config",
+			giveReq:  httptest.NewRequest(http.MethodPut, "/api/v1/cluster/config", strings.NewReader(`{"executorWorkerCnt":-1}`)),
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			caseDesc: "reload",
+			giveReq:  httptest.NewRequest(http.MethodPost, "/api/v1/admin/reload", nil),
+			wantCode: http.StatusOK,
+			wantBody: `"reloaded"`,
+		},
+		{
+			caseDesc: "promote active cluster",
+			giveReq:  httptest.NewRequest(http.MethodPost, "/api/v1/admin/promote", nil),
+			wantCode: http.StatusConflict,
+			wantBody: `worker is not standby`,
+		},
+		{
+			caseDesc: "get openapi document",
+			giveReq:  httptest.NewRequest(http.MethodGet, "/api/v1/openapi.json", nil),
+			wantCode: http.StatusOK,
+			wantBody: `"openapi":"3.0.3"`,
+		},
+		{
+			caseDesc: "route not found",
+			giveReq:  httptest.NewRequest(http.MethodGet, "/api/v1/unknown", nil),
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	h := NewHandler()
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, tc.giveReq)
+			assert.Equal(t, tc.wantCode, w.Code)
+			assert.True(t, json.Valid(w.Body.Bytes()))
+			assert.Contains(t, w.Body.String(), tc.wantBody)
+		})
+	}
+}
+
+func TestHandler_downloadTaskArtifact(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "report.txt")
+	assert.NoError(t, os.WriteFile(file, []byte("report content"), 0644))
+
+	st := memory.NewStore()
+	mod.SetStore(st)
+	assert.NoError(t, st.BatchCreatTaskIns([]*entity.TaskInstance{{
+		BaseInfo: entity.BaseInfo{ID: "task-ins1"},
+		Artifacts: []run.Artifact{
+			{Name: "local", URI: "file://" + file, ContentType: "text/plain"},
+			{Name: "remote", URI: "https://example.com/report.html"},
+			{Name: "deleted", URI: "https://example.com/deleted.html", Deleted: true},
+		},
+	}}))
+
+	tests := []struct {
+		caseDesc   string
+		giveName   string
+		wantCode   int
+		wantBody   string
+		wantHeader map[string]string
+	}{
+		{
+			caseDesc: "local file",
+			giveName: "local",
+			wantCode: http.StatusOK,
+			wantBody: "report content",
+			wantHeader: map[string]string{
+				"Content-Type":        "text/plain",
+				"Content-Disposition": `attachment; filename="report.txt"`,
+			},
+		},
+		{
+			caseDesc:   "remote",
+			giveName:   "remote",
+			wantCode:   http.StatusFound,
+			wantHeader: map[string]string{"Location": "https://example.com/report.html"},
+		},
+		{
+			caseDesc: "deleted",
+			giveName: "deleted",
+			wantCode: http.StatusGone,
+		},
+		{
+			caseDesc: "not found",
+			giveName: "not-existed",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	h := NewHandler()
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/task-instances/task-ins1/artifacts/"+tc.giveName, nil))
+			assert.Equal(t, tc.wantCode, w.Code)
+			assert.Contains(t, w.Body.String(), tc.wantBody)
+			for k, v := range tc.wantHeader {
+				assert.Equal(t, v, w.Header().Get(k))
+			}
+		})
+	}
+}
+
+func TestHandler_getDagInsSnapshot(t *testing.T) {
+	j, err := journal.NewFileJournal(&journal.FileOption{Path: filepath.Join(t.TempDir(), "journal")})
+	assert.NoError(t, err)
+	defer j.Close()
+	mKeeper := &mod.MockKeeper{}
+	mKeeper.On("WorkerKey").Return("worker-1")
+	mod.SetKeeper(mKeeper)
+	st := journal.WrapStore(memory.NewStore(), j)
+	mod.SetStore(st)
+	assert.NoError(t, st.CreateDagIns(&entity.DagInstance{BaseInfo: entity.BaseInfo{ID: "dag-ins1"}, Status: entity.DagInstanceStatusRunning}))
+	assert.NoError(t, st.BatchCreatTaskIns([]*entity.TaskInstance{
+		{BaseInfo: entity.BaseInfo{ID: "task-ins1"}, DagInsID: "dag-ins1", TaskID: "task1", Status: entity.TaskInstanceStatusRunning},
+	}))
+
+	tests := []struct {
+		caseDesc string
+		giveURL  string
+		wantCode int
+		wantBody string
+	}{
+		{
+			caseDesc: "now",
+			giveURL:  "/api/v1/dag-instances/dag-ins1/snapshot",
+			wantCode: http.StatusOK,
+			wantBody: `"running":["task-ins1"]`,
+		},
+		{
+			caseDesc: "before created",
+			giveURL:  "/api/v1/dag-instances/dag-ins1/snapshot?at=1",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			caseDesc: "invalid time",
+			giveURL:  "/api/v1/dag-instances/dag-ins1/snapshot?at=03:12",
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	h := NewHandler()
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.giveURL, nil))
+			assert.Equal(t, tc.wantCode, w.Code)
+			assert.Contains(t, w.Body.String(), tc.wantBody)
+		})
+	}
+}
+
+func TestHandler_redact(t *testing.T) {
+	st := memory.NewStore()
+	mod.SetStore(st)
+	secret := `pa"ss<w&rd`
+	log.RegisterSecret("dag-ins1", secret)
+	log.RegisterSecret("dag-ins1", "1")
+	defer log.ForgetSecrets("dag-ins1")
+	assert.NoError(t, st.CreateDagIns(&entity.DagInstance{
+		BaseInfo:  entity.BaseInfo{ID: "dag-ins1"},
+		Status:    entity.DagInstanceStatusFailed,
+		Reason:    "login with " + secret + " failed",
+		Vars:      entity.DagInstanceVars{"password": {Value: secret}},
+		ShareData: &entity.ShareData{Dict: map[string]string{"token": secret}},
+	}))
+	assert.NoError(t, st.BatchCreatTaskIns([]*entity.TaskInstance{{
+		BaseInfo: entity.BaseInfo{ID: "task-ins1"},
+		DagInsID: "dag-ins1",
+		TaskID:   "task1",
+		Status:   entity.TaskInstanceStatusFailed,
+		Traces:   []entity.TraceInfo{{Time: 1, Message: "use " + secret}},
+		Attempts: []entity.TaskAttempt{{Attempt: 1, Status: entity.TaskInstanceStatusFailed, Reason: secret}},
+	}}))
+
+	tests := []struct {
+		caseDesc string
+		giveURL  string
+		wantBody []string
+	}{
+		{
+			caseDesc: "dag instance",
+			giveURL:  "/api/v1/dag-instances/dag-ins1",
+			wantBody: []string{
+				`"id":"dag-ins1"`,
+				`"vars":{"password":{"value":"******"}}`,
+				`"shareData":{"token":"******"}`,
+				`"reason":"login with ****** failed"`,
+			},
+		},
+		{
+			caseDesc: "task instances",
+			giveURL:  "/api/v1/dag-instances/dag-ins1/task-instances",
+			wantBody: []string{
+				`"id":"task-ins1"`,
+				`"traces":[{"time":1,"message":"use ******"}]`,
+				`"attempts":[{"attempt":1,"startedAt":0,"endedAt":0,"status":"failed","reason":"******"}]`,
+			},
+		},
+	}
+
+	h := NewHandler()
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.giveURL, nil))
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.True(t, json.Valid(w.Body.Bytes()))
+			assert.NotContains(t, w.Body.String(), `pa\"ss\u003cw\u0026rd`)
+			for _, b := range tc.wantBody {
+				assert.Contains(t, w.Body.String(), b)
+			}
+		})
+	}
+
+	// the values in store are not changed
+	dagIns, err := st.GetDagInstance("dag-ins1")
+	assert.NoError(t, err)
+	assert.Equal(t, secret, dagIns.Vars["password"].Value)
+}
+
+func TestHandler_authenticate(t *testing.T) {
+	st := memory.NewStore()
+	mod.SetStore(st)
+	assert.NoError(t, st.CreateDag(&entity.Dag{
+		BaseInfo: entity.BaseInfo{ID: "dag1"},
+		Tasks:    []entity.Task{{ID: "task1", ActionName: "act"}},
+	}))
+
+	h := NewHandler()
+	h.SetAuthenticator(AuthenticatorFunc(func(r *http.Request) (string, error) {
+		switch r.Header.Get("Authorization") {
+		case "":
+			return "", ErrUnauthorized
+		case "Bearer admin":
+			return "admin", nil
+		}
+		if r.Method != http.MethodGet {
+			return "", ErrForbidden
+		}
+		return "viewer", nil
+	}))
+
+	tests := []struct {
+		caseDesc   string
+		giveMethod string
+		giveToken  string
+		wantCode   int
+	}{
+		{
+			caseDesc:   "no token",
+			giveMethod: http.MethodGet,
+			wantCode:   http.StatusUnauthorized,
+		},
+		{
+			caseDesc:   "viewer read",
+			giveMethod: http.MethodGet,
+			giveToken:  "Bearer viewer",
+			wantCode:   http.StatusOK,
+		},
+		{
+			caseDesc:   "viewer write",
+			giveMethod: http.MethodPost,
+			giveToken:  "Bearer viewer",
+			wantCode:   http.StatusForbidden,
+		},
+		{
+			caseDesc:   "admin",
+			giveMethod: http.MethodGet,
+			giveToken:  "Bearer admin",
+			wantCode:   http.StatusOK,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			req := httptest.NewRequest(tc.giveMethod, "/api/v1/dags/dag1", nil)
+			if tc.giveToken != "" {
+				req.Header.Set("Authorization", tc.giveToken)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			assert.Equal(t, tc.wantCode, w.Code)
+		})
+	}
+}
@@ -0,0 +1,28 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+)
+
+var (
+	// ErrUnauthorized is returned by Authenticator when the caller is not authenticated, responds 401
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrForbidden is returned by Authenticator when the caller cannot access the route, responds 403
+	ErrForbidden = errors.New("forbidden")
+)
+
+// Authenticator authenticate the requests of management api before routing, so it can be plugged into SSO.
+// It returns the user of request, which is the default operator of commands, and it can reject the
+// request by ErrUnauthorized or ErrForbidden, other errors respond 500
+type Authenticator interface {
+	Authenticate(r *http.Request) (user string, err error)
+}
+
+// AuthenticatorFunc
+type AuthenticatorFunc func(r *http.Request) (string, error)
+
+// Authenticate
+func (f AuthenticatorFunc) Authenticate(r *http.Request) (string, error) {
+	return f(r)
+}
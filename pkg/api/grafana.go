@@ -0,0 +1,203 @@
+package api
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/mod"
+)
+
+const (
+	defaultStatsRange   = 24 * time.Hour
+	maxStatsBuckets     = 1000
+	defaultAnnotationsN = 1000
+)
+
+// GrafanaAnnotation is the annotation format of grafana json datasource,
+// time and timeEnd are unix timestamps in milliseconds, it is a region when timeEnd is set
+type GrafanaAnnotation struct {
+	Time    int64    `json:"time"`
+	TimeEnd int64    `json:"timeEnd,omitempty"`
+	Title   string   `json:"title"`
+	Text    string   `json:"text"`
+	Tags    []string `json:"tags"`
+}
+
+// DagStats is the aggregated stats of the completed dag instances
+type DagStats struct {
+	DagID string `json:"dagId"`
+	// From and To are unix timestamps in milliseconds
+	From int64 `json:"from"`
+	To   int64 `json:"to"`
+	DagStatsBucket
+	// Buckets is split by the interval of query, it is empty when interval is not specified
+	Buckets []DagStatsBucket `json:"buckets,omitempty"`
+}
+
+// DagStatsBucket
+type DagStatsBucket struct {
+	// Time is the begin of bucket in milliseconds
+	Time        int64   `json:"time"`
+	Total       int     `json:"total"`
+	Success     int     `json:"success"`
+	Failed      int     `json:"failed"`
+	SuccessRate float64 `json:"successRate"`
+	DurationP50 int64   `json:"durationP50Ms"`
+	DurationP90 int64   `json:"durationP90Ms"`
+	DurationP99 int64   `json:"durationP99Ms"`
+
+	durations []int64
+}
+
+func (b *DagStatsBucket) add(dagIns *entity.DagInstance) {
+	b.Total++
+	if dagIns.Status == entity.DagInstanceStatusSuccess {
+		b.Success++
+	} else {
+		b.Failed++
+	}
+	b.durations = append(b.durations, dagInsDurationMs(dagIns))
+}
+
+func (b *DagStatsBucket) complete() {
+	if b.Total == 0 {
+		return
+	}
+	b.SuccessRate = float64(b.Success) / float64(b.Total)
+	sort.Slice(b.durations, func(i, j int) bool { return b.durations[i] < b.durations[j] })
+	b.DurationP50 = percentile(b.durations, 50)
+	b.DurationP90 = percentile(b.durations, 90)
+	b.DurationP99 = percentile(b.durations, 99)
+}
+
+// percentile use nearest-rank method, the values must be sorted
+func percentile(sorted []int64, p int) int64 {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func dagInsDurationMs(dagIns *entity.DagInstance) int64 {
+	if dagIns.Summary != nil {
+		return dagIns.Summary.TotalDurationMs
+	}
+	return (dagIns.UpdatedAt - dagIns.CreatedAt) * 1000
+}
+
+func dagInsCompleted(dagIns *entity.DagInstance) bool {
+	return dagIns.Status == entity.DagInstanceStatusSuccess || dagIns.Status == entity.DagInstanceStatusFailed
+}
+
+// queryTimeRange parse "from" and "to" in milliseconds which are the same as grafana, default is the last 24 hours
+func queryTimeRange(r *Request) (from, to int64, err error) {
+	if to, err = queryInt64(r, "to"); err != nil {
+		return
+	}
+	if to == 0 {
+		to = time.Now().UnixNano() / int64(time.Millisecond)
+	}
+	if from, err = queryInt64(r, "from"); err != nil {
+		return
+	}
+	if from == 0 {
+		from = to - defaultStatsRange.Milliseconds()
+	}
+	if from > to {
+		err = badRequest("from cannot be after to")
+	}
+	return
+}
+
+func listDagInsInRange(dagID string, from, to, limit int64) ([]*entity.DagInstance, error) {
+	return mod.GetStore().ListDagInstance(&mod.ListDagInstanceInput{
+		DagID:        dagID,
+		CreatedBegin: from / 1000,
+		CreatedEnd:   to / 1000,
+		Limit:        limit,
+	})
+}
+
+func listGrafanaAnnotations(r *Request) (interface{}, error) {
+	from, to, err := queryTimeRange(r)
+	if err != nil {
+		return nil, err
+	}
+	limit, err := queryInt64(r, "limit")
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = defaultAnnotationsN
+	}
+	dagIns, err := listDagInsInRange(r.URL.Query().Get("dagId"), from, to, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []GrafanaAnnotation{}
+	for _, ins := range dagIns {
+		anno := GrafanaAnnotation{
+			Time:  ins.CreatedAt * 1000,
+			Title: fmt.Sprintf("%s %s", ins.DagID, ins.Status),
+			Text:  fmt.Sprintf("dag instance %s is %s", ins.ID, ins.Status),
+			Tags:  []string{"fastflow", ins.DagID, string(ins.Status)},
+		}
+		if dagInsCompleted(ins) {
+			anno.TimeEnd = anno.Time + dagInsDurationMs(ins)
+		}
+		if ins.Reason != "" {
+			anno.Text += ": " + ins.Reason
+		}
+		ret = append(ret, anno)
+	}
+	return ret, nil
+}
+
+func getDagStats(r *Request) (interface{}, error) {
+	from, to, err := queryTimeRange(r)
+	if err != nil {
+		return nil, err
+	}
+	var interval time.Duration
+	if v := r.URL.Query().Get("interval"); v != "" {
+		if interval, err = time.ParseDuration(v); err != nil || interval <= 0 {
+			return nil, badRequest("query interval is invalid: %s", v)
+		}
+		if (to-from)/interval.Milliseconds() >= maxStatsBuckets {
+			return nil, badRequest("interval is too small, buckets cannot be more than %d", maxStatsBuckets)
+		}
+	}
+	dagIns, err := listDagInsInRange(r.Params["dagId"], from, to, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &DagStats{DagID: r.Params["dagId"], From: from, To: to}
+	stats.Time = from
+	if interval > 0 {
+		for t := from; t < to; t += interval.Milliseconds() {
+			stats.Buckets = append(stats.Buckets, DagStatsBucket{Time: t})
+		}
+	}
+	for _, ins := range dagIns {
+		if !dagInsCompleted(ins) {
+			continue
+		}
+		stats.add(ins)
+		if interval > 0 {
+			idx := (ins.CreatedAt*1000 - from) / interval.Milliseconds()
+			if idx >= 0 && idx < int64(len(stats.Buckets)) {
+				stats.Buckets[idx].add(ins)
+			}
+		}
+	}
+	stats.complete()
+	for i := range stats.Buckets {
+		stats.Buckets[i].complete()
+	}
+	return stats, nil
+}
@@ -0,0 +1,105 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/mod"
+	"github.com/etherealiy/fastflow/store/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandler_Grafana(t *testing.T) {
+	st := memory.NewStore()
+	mod.SetStore(st)
+	for _, ins := range []*entity.DagInstance{
+		{DagID: "dag1", Status: entity.DagInstanceStatusSuccess, Summary: &entity.DagInstanceSummary{TotalDurationMs: 3000}},
+		{DagID: "dag1", Status: entity.DagInstanceStatusSuccess, Summary: &entity.DagInstanceSummary{TotalDurationMs: 1000}},
+		{DagID: "dag1", Status: entity.DagInstanceStatusFailed, Reason: "task failed", Summary: &entity.DagInstanceSummary{TotalDurationMs: 4000}},
+		{DagID: "dag1", Status: entity.DagInstanceStatusSuccess, Summary: &entity.DagInstanceSummary{TotalDurationMs: 2000}},
+		{DagID: "dag1", Status: entity.DagInstanceStatusRunning},
+		{DagID: "dag2", Status: entity.DagInstanceStatusSuccess},
+	} {
+		assert.NoError(t, st.CreateDagIns(ins))
+	}
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	h := NewHandler()
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/dags/dag1/stats", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	stats := &DagStats{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), stats))
+	assert.Equal(t, 4, stats.Total)
+	assert.Equal(t, 3, stats.Success)
+	assert.Equal(t, 1, stats.Failed)
+	assert.Equal(t, 0.75, stats.SuccessRate)
+	assert.Equal(t, int64(2000), stats.DurationP50)
+	assert.Equal(t, int64(4000), stats.DurationP90)
+	assert.Equal(t, int64(4000), stats.DurationP99)
+	assert.Empty(t, stats.Buckets)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet,
+		fmt.Sprintf("/api/v1/dags/dag1/stats?from=%d&to=%d&interval=1h", now-2*time.Hour.Milliseconds(), now+1000), nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	stats = &DagStats{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), stats))
+	if assert.Len(t, stats.Buckets, 3) {
+		assert.Equal(t, 0, stats.Buckets[0].Total)
+		assert.Equal(t, 4, stats.Buckets[1].Total+stats.Buckets[2].Total)
+	}
+
+	tests := []struct {
+		caseDesc string
+		givePath string
+		wantCode int
+		wantBody string
+	}{
+		{
+			caseDesc: "interval too small",
+			givePath: "/api/v1/dags/dag1/stats?interval=1s",
+			wantCode: http.StatusBadRequest,
+			wantBody: "interval is too small",
+		},
+		{
+			caseDesc: "invalid range",
+			givePath: "/api/v1/dags/dag1/stats?from=2&to=1",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			caseDesc: "annotations",
+			givePath: "/api/v1/grafana/annotations?dagId=dag1&limit=3",
+			wantCode: http.StatusOK,
+			wantBody: `"title":"dag1 failed","text":"dag instance 3 is failed: task failed","tags":["fastflow","dag1","failed"]`,
+		},
+		{
+			caseDesc: "annotations out of range",
+			givePath: fmt.Sprintf("/api/v1/grafana/annotations?from=%d&to=%d", now-2000*1000, now-1000*1000),
+			wantCode: http.StatusOK,
+			wantBody: `[]`,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.givePath, nil))
+			assert.Equal(t, tc.wantCode, w.Code)
+			assert.Contains(t, w.Body.String(), tc.wantBody)
+		})
+	}
+
+	annos := []GrafanaAnnotation{}
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/grafana/annotations?dagId=dag1", nil))
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &annos))
+	if assert.Len(t, annos, 5) {
+		assert.Equal(t, annos[0].Time+3000, annos[0].TimeEnd)
+		assert.Zero(t, annos[4].TimeEnd, "running dag instance has no end")
+	}
+}
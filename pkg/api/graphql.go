@@ -0,0 +1,949 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/log"
+	"github.com/etherealiy/fastflow/pkg/mod"
+	"github.com/etherealiy/fastflow/pkg/utils/data"
+)
+
+// GraphQLRequest is a query over dags, dag instances and task instances, such as
+//
+//	{ dagInstances(dagId: "my-dag", status: [failed], limit: 10) { id status taskInstances { taskId status attempts { reason } } } }
+//
+// only the query operation is supported, fragments are not supported yet
+type GraphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+}
+
+// GraphQLResponse
+type GraphQLResponse struct {
+	Data   interface{}    `json:"data"`
+	Errors []GraphQLError `json:"errors,omitempty"`
+}
+
+// GraphQLError
+type GraphQLError struct {
+	Message string        `json:"message"`
+	Path    []interface{} `json:"path,omitempty"`
+}
+
+func queryGraphQL(r *Request) (interface{}, error) {
+	input := &GraphQLRequest{}
+	if err := decodeBody(r, input); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(input.Query) == "" {
+		return nil, badRequest("query cannot be empty")
+	}
+	op, err := parseGraphQL(input.Query, input.OperationName)
+	if err != nil {
+		return &GraphQLResponse{Errors: []GraphQLError{{Message: err.Error()}}}, nil
+	}
+
+	e := &gqlExecutor{vars: map[string]interface{}{}}
+	for k, v := range op.defaults {
+		e.vars[k] = v
+	}
+	for k, v := range input.Variables {
+		e.vars[k] = v
+	}
+	return &GraphQLResponse{Data: e.selectFields(gqlQuery, nil, op.selections, nil), Errors: e.errors}, nil
+}
+
+// gqlType is an object type of schema, the fields which are not declared are read from the json of object
+type gqlType struct {
+	name   string
+	fields map[string]*gqlFieldDef
+	// jsonFields is the json names of entity, it is used to validate the undeclared fields
+	jsonFields map[string]bool
+}
+
+type gqlFieldDef struct {
+	typ     *gqlType
+	args    []string
+	resolve func(parent interface{}, args gqlArgs) (interface{}, error)
+}
+
+var (
+	gqlQuery        = &gqlType{name: "Query"}
+	gqlDag          = &gqlType{name: "Dag"}
+	gqlDagInstance  = &gqlType{name: "DagInstance"}
+	gqlTaskInstance = &gqlType{name: "TaskInstance"}
+)
+
+func init() {
+	gqlQuery.fields = map[string]*gqlFieldDef{
+		"dag": {typ: gqlDag, args: []string{"id"}, resolve: func(_ interface{}, args gqlArgs) (interface{}, error) {
+			id, err := args.requiredString("id")
+			if err != nil {
+				return nil, err
+			}
+			return ignoreNotFound(mod.GetStore().GetDag(id))
+		}},
+		"dags": {typ: gqlDag, args: []string{"idPrefix"}, resolve: func(_ interface{}, args gqlArgs) (interface{}, error) {
+			st, ok := mod.StoreAs[mod.DagPruneStore](mod.GetStore())
+			if !ok {
+				return nil, fmt.Errorf("store does not support listing dags")
+			}
+			prefix, err := args.string("idPrefix")
+			if err != nil {
+				return nil, err
+			}
+			return st.ListDag(&mod.ListDagInput{IDPrefix: prefix})
+		}},
+		"dagInstance": {typ: gqlDagInstance, args: []string{"id"}, resolve: func(_ interface{}, args gqlArgs) (interface{}, error) {
+			id, err := args.requiredString("id")
+			if err != nil {
+				return nil, err
+			}
+			return ignoreNotFound(mod.GetStore().GetDagInstance(id))
+		}},
+		"dagInstances": {
+			typ:  gqlDagInstance,
+			args: []string{"dagId", "worker", "status", "trigger", "deadLetter", "limit", "offset"},
+			resolve: func(_ interface{}, args gqlArgs) (interface{}, error) {
+				dagID, err := args.string("dagId")
+				if err != nil {
+					return nil, err
+				}
+				return listGraphQLDagIns(dagID, args)
+			},
+		},
+		"taskInstance": {typ: gqlTaskInstance, args: []string{"id"}, resolve: func(_ interface{}, args gqlArgs) (interface{}, error) {
+			id, err := args.requiredString("id")
+			if err != nil {
+				return nil, err
+			}
+			return ignoreNotFound(mod.GetStore().GetTaskIns(id))
+		}},
+	}
+	gqlDag.fields = map[string]*gqlFieldDef{
+		"instances": {
+			typ:  gqlDagInstance,
+			args: []string{"worker", "status", "trigger", "deadLetter", "limit", "offset"},
+			resolve: func(parent interface{}, args gqlArgs) (interface{}, error) {
+				return listGraphQLDagIns(parent.(*entity.Dag).ID, args)
+			},
+		},
+	}
+	gqlDagInstance.fields = map[string]*gqlFieldDef{
+		"dag": {typ: gqlDag, resolve: func(parent interface{}, _ gqlArgs) (interface{}, error) {
+			return ignoreNotFound(mod.GetStore().GetDag(parent.(*entity.DagInstance).DagID))
+		}},
+		"taskInstances": {typ: gqlTaskInstance, args: []string{"status"}, resolve: func(parent interface{}, args gqlArgs) (interface{}, error) {
+			status, err := args.strings("status")
+			if err != nil {
+				return nil, err
+			}
+			input := &mod.ListTaskInstanceInput{DagInsID: parent.(*entity.DagInstance).ID}
+			for _, s := range status {
+				input.Status = append(input.Status, entity.TaskInstanceStatus(s))
+			}
+			return mod.GetStore().ListTaskInstance(input)
+		}},
+	}
+	gqlTaskInstance.fields = map[string]*gqlFieldDef{
+		"dagInstance": {typ: gqlDagInstance, resolve: func(parent interface{}, _ gqlArgs) (interface{}, error) {
+			return ignoreNotFound(mod.GetStore().GetDagInstance(parent.(*entity.TaskInstance).DagInsID))
+		}},
+	}
+
+	gqlDag.jsonFields = jsonFieldNames(reflect.TypeOf(entity.Dag{}))
+	gqlDagInstance.jsonFields = jsonFieldNames(reflect.TypeOf(entity.DagInstance{}))
+	gqlTaskInstance.jsonFields = jsonFieldNames(reflect.TypeOf(entity.TaskInstance{}))
+}
+
+func listGraphQLDagIns(dagID string, args gqlArgs) (interface{}, error) {
+	input := &mod.ListDagInstanceInput{DagID: dagID}
+	var err error
+	if input.Worker, err = args.string("worker"); err != nil {
+		return nil, err
+	}
+	trigger, err := args.string("trigger")
+	if err != nil {
+		return nil, err
+	}
+	input.Trigger = entity.Trigger(trigger)
+	status, err := args.strings("status")
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range status {
+		input.Status = append(input.Status, entity.DagInstanceStatus(s))
+	}
+	if input.DeadLetter, err = args.bool("deadLetter"); err != nil {
+		return nil, err
+	}
+	if input.Limit, err = args.int64("limit"); err != nil {
+		return nil, err
+	}
+	if input.Offset, err = args.int64("offset"); err != nil {
+		return nil, err
+	}
+	return mod.GetStore().ListDagInstance(input)
+}
+
+// ignoreNotFound make the missing object null as graphql does
+func ignoreNotFound(obj interface{}, err error) (interface{}, error) {
+	if errors.Is(err, data.ErrDataNotFound) {
+		return nil, nil
+	}
+	return obj, err
+}
+
+// jsonFieldNames follow the rules of encoding/json, the fields of embedded struct are promoted
+func jsonFieldNames(t reflect.Type) map[string]bool {
+	names := map[string]bool{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" || (f.PkgPath != "" && !f.Anonymous) {
+			continue
+		}
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			for n := range jsonFieldNames(f.Type) {
+				names[n] = true
+			}
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		names[name] = true
+	}
+	return names
+}
+
+type gqlExecutor struct {
+	vars   map[string]interface{}
+	errors []GraphQLError
+}
+
+// gqlObject keep the fields in the order of selection
+type gqlObject []gqlObjectField
+
+type gqlObjectField struct {
+	key   string
+	value interface{}
+}
+
+// MarshalJSON
+func (o gqlObject) MarshalJSON() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	buf.WriteByte('{')
+	for i, f := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(f.key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(f.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func (e *gqlExecutor) selectFields(typ *gqlType, parent interface{}, selections []*gqlField, path []interface{}) gqlObject {
+	obj := gqlObject{}
+	var jsonObj map[string]interface{}
+	for _, f := range selections {
+		included, err := e.included(f)
+		if err != nil {
+			e.addError(err, path)
+			continue
+		}
+		if !included {
+			continue
+		}
+		fieldPath := append(append([]interface{}{}, path...), f.key())
+		value, err := e.resolveField(typ, parent, f, fieldPath, &jsonObj)
+		if err != nil {
+			e.addError(err, fieldPath)
+			value = nil
+		}
+		obj = append(obj, gqlObjectField{key: f.key(), value: value})
+	}
+	return obj
+}
+
+func (e *gqlExecutor) resolveField(typ *gqlType, parent interface{}, f *gqlField, path []interface{},
+	jsonObj *map[string]interface{}) (interface{}, error) {
+	if f.name == "__typename" {
+		return typ.name, nil
+	}
+	if def, ok := typ.fields[f.name]; ok {
+		args, err := e.args(f, def.args)
+		if err != nil {
+			return nil, err
+		}
+		value, err := def.resolve(parent, args)
+		if err != nil {
+			return nil, err
+		}
+		return e.complete(def.typ, value, f, path)
+	}
+	if !typ.jsonFields[f.name] {
+		return nil, fmt.Errorf("cannot query field %q on type %q", f.name, typ.name)
+	}
+	if len(f.args) > 0 {
+		return nil, fmt.Errorf("field %q of type %q has no arguments", f.name, typ.name)
+	}
+	if *jsonObj == nil {
+		m, err := toJSONObject(parent)
+		if err != nil {
+			return nil, err
+		}
+		*jsonObj = m
+	}
+	return e.completeJSON((*jsonObj)[f.name], f.selections)
+}
+
+// complete select the fields of object, or each object of list
+func (e *gqlExecutor) complete(typ *gqlType, value interface{}, f *gqlField, path []interface{}) (interface{}, error) {
+	rv := reflect.ValueOf(value)
+	if !rv.IsValid() || (rv.Kind() == reflect.Ptr && rv.IsNil()) {
+		return nil, nil
+	}
+	if len(f.selections) == 0 {
+		return nil, fmt.Errorf("field %q of type %q must have a selection of subfields", f.name, typ.name)
+	}
+	if rv.Kind() == reflect.Slice {
+		list := make([]interface{}, rv.Len())
+		for i := range list {
+			item, err := e.complete(typ, rv.Index(i).Interface(), f, append(append([]interface{}{}, path...), i))
+			if err != nil {
+				return nil, err
+			}
+			list[i] = item
+		}
+		return list, nil
+	}
+	return e.selectFields(typ, redactBody(value), f.selections, path), nil
+}
+
+// completeJSON select the keys of nested json objects, the missing keys are null
+func (e *gqlExecutor) completeJSON(value interface{}, selections []*gqlField) (interface{}, error) {
+	if len(selections) == 0 {
+		return value, nil
+	}
+	switch v := value.(type) {
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i := range v {
+			item, err := e.completeJSON(v[i], selections)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = item
+		}
+		return list, nil
+	case map[string]interface{}:
+		obj := gqlObject{}
+		for _, f := range selections {
+			included, err := e.included(f)
+			if err != nil {
+				return nil, err
+			}
+			if !included {
+				continue
+			}
+			item, err := e.completeJSON(v[f.name], f.selections)
+			if err != nil {
+				return nil, err
+			}
+			obj = append(obj, gqlObjectField{key: f.key(), value: item})
+		}
+		return obj, nil
+	}
+	return value, nil
+}
+
+func (e *gqlExecutor) addError(err error, path []interface{}) {
+	e.errors = append(e.errors, GraphQLError{Message: log.Redact(err.Error()), Path: path})
+}
+
+// included evaluate @include and @skip directives
+func (e *gqlExecutor) included(f *gqlField) (bool, error) {
+	for _, d := range f.directives {
+		if d.name != "include" && d.name != "skip" {
+			return false, fmt.Errorf("unknown directive @%s", d.name)
+		}
+		cond, ok := e.value(d.args["if"]).(bool)
+		if !ok {
+			return false, fmt.Errorf("argument \"if\" of directive @%s must be a boolean", d.name)
+		}
+		if cond == (d.name == "skip") {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (e *gqlExecutor) args(f *gqlField, declared []string) (gqlArgs, error) {
+	args := gqlArgs{}
+	for name, v := range f.args {
+		found := false
+		for _, d := range declared {
+			found = found || d == name
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown argument %q on field %q", name, f.name)
+		}
+		args[name] = e.value(v)
+	}
+	return args, nil
+}
+
+// value replace the variables in the value
+func (e *gqlExecutor) value(v interface{}) interface{} {
+	switch val := v.(type) {
+	case gqlVariable:
+		return e.vars[string(val)]
+	case []interface{}:
+		list := make([]interface{}, len(val))
+		for i := range val {
+			list[i] = e.value(val[i])
+		}
+		return list
+	case map[string]interface{}:
+		obj := map[string]interface{}{}
+		for k := range val {
+			obj[k] = e.value(val[k])
+		}
+		return obj
+	}
+	return v
+}
+
+func toJSONObject(obj interface{}) (map[string]interface{}, error) {
+	bs, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	m := map[string]interface{}{}
+	dec := json.NewDecoder(bytes.NewReader(bs))
+	// keep the precision of int64
+	dec.UseNumber()
+	if err := dec.Decode(&m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+type gqlArgs map[string]interface{}
+
+func (a gqlArgs) string(name string) (string, error) {
+	switch v := a[name].(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	}
+	return "", fmt.Errorf("argument %q must be a string", name)
+}
+
+func (a gqlArgs) requiredString(name string) (string, error) {
+	s, err := a.string(name)
+	if err == nil && s == "" {
+		return "", fmt.Errorf("argument %q is required", name)
+	}
+	return s, err
+}
+
+// strings accept a single string as a list of one item
+func (a gqlArgs) strings(name string) ([]string, error) {
+	switch v := a[name].(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{v}, nil
+	case []interface{}:
+		var ret []string
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("argument %q must be a list of string", name)
+			}
+			ret = append(ret, s)
+		}
+		return ret, nil
+	}
+	return nil, fmt.Errorf("argument %q must be a list of string", name)
+}
+
+func (a gqlArgs) bool(name string) (bool, error) {
+	switch v := a[name].(type) {
+	case nil:
+		return false, nil
+	case bool:
+		return v, nil
+	}
+	return false, fmt.Errorf("argument %q must be a boolean", name)
+}
+
+func (a gqlArgs) int64(name string) (int64, error) {
+	switch v := a[name].(type) {
+	case nil:
+		return 0, nil
+	case int64:
+		return v, nil
+	case float64:
+		// the numbers of variables are decoded as float64
+		if v == float64(int64(v)) {
+			return int64(v), nil
+		}
+	}
+	return 0, fmt.Errorf("argument %q must be an integer", name)
+}
+
+type gqlOperation struct {
+	name       string
+	defaults   map[string]interface{}
+	selections []*gqlField
+}
+
+type gqlField struct {
+	alias      string
+	name       string
+	args       map[string]interface{}
+	directives []*gqlDirective
+	selections []*gqlField
+}
+
+func (f *gqlField) key() string {
+	if f.alias != "" {
+		return f.alias
+	}
+	return f.name
+}
+
+type gqlDirective struct {
+	name string
+	args map[string]interface{}
+}
+
+// gqlVariable is a reference to variable in the values of arguments
+type gqlVariable string
+
+const (
+	gqlTokenEOF byte = iota
+	gqlTokenPunct
+	gqlTokenName
+	gqlTokenInt
+	gqlTokenFloat
+	gqlTokenString
+)
+
+type gqlToken struct {
+	kind byte
+	val  string
+}
+
+type gqlParser struct {
+	src string
+	pos int
+	tok gqlToken
+}
+
+// parseGraphQL parse the document and return the operation to execute,
+// operationName is required when there are multiple operations
+func parseGraphQL(query, operationName string) (*gqlOperation, error) {
+	p := &gqlParser{src: query}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	var ops []*gqlOperation
+	for p.tok.kind != gqlTokenEOF {
+		op, err := p.parseOperation()
+		if err != nil {
+			return nil, err
+		}
+		ops = append(ops, op)
+	}
+
+	if operationName == "" {
+		if len(ops) != 1 {
+			return nil, fmt.Errorf("operationName is required when the document has %d operations", len(ops))
+		}
+		return ops[0], nil
+	}
+	for _, op := range ops {
+		if op.name == operationName {
+			return op, nil
+		}
+	}
+	return nil, fmt.Errorf("operation %q is not found", operationName)
+}
+
+func (p *gqlParser) parseOperation() (*gqlOperation, error) {
+	op := &gqlOperation{defaults: map[string]interface{}{}}
+	if p.is(gqlTokenPunct, "{") {
+		return op, p.parseSelectionSet(&op.selections)
+	}
+	if p.tok.kind != gqlTokenName {
+		return nil, p.unexpected()
+	}
+	switch p.tok.val {
+	case "query":
+	case "mutation", "subscription":
+		return nil, fmt.Errorf("%s operation is not supported", p.tok.val)
+	case "fragment":
+		return nil, fmt.Errorf("fragments are not supported")
+	default:
+		return nil, p.unexpected()
+	}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	if p.tok.kind == gqlTokenName {
+		op.name = p.tok.val
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	}
+	if p.is(gqlTokenPunct, "(") {
+		if err := p.parseVariableDefinitions(op.defaults); err != nil {
+			return nil, err
+		}
+	}
+	return op, p.parseSelectionSet(&op.selections)
+}
+
+func (p *gqlParser) parseVariableDefinitions(defaults map[string]interface{}) error {
+	if err := p.expect(gqlTokenPunct, "("); err != nil {
+		return err
+	}
+	for !p.is(gqlTokenPunct, ")") {
+		if err := p.expect(gqlTokenPunct, "$"); err != nil {
+			return err
+		}
+		name, err := p.expectName()
+		if err != nil {
+			return err
+		}
+		if err := p.expect(gqlTokenPunct, ":"); err != nil {
+			return err
+		}
+		if err := p.parseType(); err != nil {
+			return err
+		}
+		if p.is(gqlTokenPunct, "=") {
+			if err := p.advance(); err != nil {
+				return err
+			}
+			v, err := p.parseValue()
+			if err != nil {
+				return err
+			}
+			defaults[name] = v
+		}
+	}
+	return p.advance()
+}
+
+// parseType skip the type of variable, the arguments are checked when they are used
+func (p *gqlParser) parseType() error {
+	if p.is(gqlTokenPunct, "[") {
+		if err := p.advance(); err != nil {
+			return err
+		}
+		if err := p.parseType(); err != nil {
+			return err
+		}
+		if err := p.expect(gqlTokenPunct, "]"); err != nil {
+			return err
+		}
+	} else if _, err := p.expectName(); err != nil {
+		return err
+	}
+	if p.is(gqlTokenPunct, "!") {
+		return p.advance()
+	}
+	return nil
+}
+
+func (p *gqlParser) parseSelectionSet(selections *[]*gqlField) error {
+	if err := p.expect(gqlTokenPunct, "{"); err != nil {
+		return err
+	}
+	for !p.is(gqlTokenPunct, "}") {
+		if p.is(gqlTokenPunct, "...") {
+			return fmt.Errorf("fragments are not supported")
+		}
+		f, err := p.parseField()
+		if err != nil {
+			return err
+		}
+		*selections = append(*selections, f)
+	}
+	if len(*selections) == 0 {
+		return fmt.Errorf("selection set cannot be empty")
+	}
+	return p.advance()
+}
+
+func (p *gqlParser) parseField() (*gqlField, error) {
+	name, err := p.expectName()
+	if err != nil {
+		return nil, err
+	}
+	f := &gqlField{name: name}
+	if p.is(gqlTokenPunct, ":") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		f.alias = name
+		if f.name, err = p.expectName(); err != nil {
+			return nil, err
+		}
+	}
+	if p.is(gqlTokenPunct, "(") {
+		if f.args, err = p.parseArguments(); err != nil {
+			return nil, err
+		}
+	}
+	for p.is(gqlTokenPunct, "@") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		d := &gqlDirective{}
+		if d.name, err = p.expectName(); err != nil {
+			return nil, err
+		}
+		if p.is(gqlTokenPunct, "(") {
+			if d.args, err = p.parseArguments(); err != nil {
+				return nil, err
+			}
+		}
+		f.directives = append(f.directives, d)
+	}
+	if p.is(gqlTokenPunct, "{") {
+		if err := p.parseSelectionSet(&f.selections); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+func (p *gqlParser) parseArguments() (map[string]interface{}, error) {
+	if err := p.expect(gqlTokenPunct, "("); err != nil {
+		return nil, err
+	}
+	args := map[string]interface{}{}
+	for !p.is(gqlTokenPunct, ")") {
+		name, err := p.expectName()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(gqlTokenPunct, ":"); err != nil {
+			return nil, err
+		}
+		if args[name], err = p.parseValue(); err != nil {
+			return nil, err
+		}
+	}
+	return args, p.advance()
+}
+
+func (p *gqlParser) parseValue() (interface{}, error) {
+	tok := p.tok
+	switch {
+	case p.is(gqlTokenPunct, "$"):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		name, err := p.expectName()
+		return gqlVariable(name), err
+	case p.is(gqlTokenPunct, "["):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		list := []interface{}{}
+		for !p.is(gqlTokenPunct, "]") {
+			v, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return list, p.advance()
+	case p.is(gqlTokenPunct, "{"):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		obj := map[string]interface{}{}
+		for !p.is(gqlTokenPunct, "}") {
+			name, err := p.expectName()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(gqlTokenPunct, ":"); err != nil {
+				return nil, err
+			}
+			if obj[name], err = p.parseValue(); err != nil {
+				return nil, err
+			}
+		}
+		return obj, p.advance()
+	case tok.kind == gqlTokenInt:
+		i, err := strconv.ParseInt(tok.val, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid integer %s", tok.val)
+		}
+		return i, p.advance()
+	case tok.kind == gqlTokenFloat:
+		f, err := strconv.ParseFloat(tok.val, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid float %s", tok.val)
+		}
+		return f, p.advance()
+	case tok.kind == gqlTokenString:
+		return tok.val, p.advance()
+	case tok.kind == gqlTokenName:
+		var v interface{}
+		switch tok.val {
+		case "true":
+			v = true
+		case "false":
+			v = false
+		case "null":
+		default:
+			// enum values are used as strings, such as the status
+			v = tok.val
+		}
+		return v, p.advance()
+	}
+	return nil, p.unexpected()
+}
+
+func (p *gqlParser) is(kind byte, val string) bool {
+	return p.tok.kind == kind && p.tok.val == val
+}
+
+func (p *gqlParser) expect(kind byte, val string) error {
+	if !p.is(kind, val) {
+		return p.unexpected()
+	}
+	return p.advance()
+}
+
+func (p *gqlParser) expectName() (string, error) {
+	if p.tok.kind != gqlTokenName {
+		return "", p.unexpected()
+	}
+	name := p.tok.val
+	return name, p.advance()
+}
+
+func (p *gqlParser) unexpected() error {
+	if p.tok.kind == gqlTokenEOF {
+		return fmt.Errorf("syntax error: unexpected end of document")
+	}
+	return fmt.Errorf("syntax error: unexpected %q before position %d", p.tok.val, p.pos)
+}
+
+// advance read next token, the white spaces, commas and comments are ignored
+func (p *gqlParser) advance() error {
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if c == '#' {
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+			continue
+		}
+		if c != ' ' && c != '\t' && c != '\n' && c != '\r' && c != ',' {
+			break
+		}
+		p.pos++
+	}
+	if p.pos >= len(p.src) {
+		p.tok = gqlToken{kind: gqlTokenEOF}
+		return nil
+	}
+
+	start := p.pos
+	c := p.src[p.pos]
+	switch {
+	case strings.HasPrefix(p.src[p.pos:], "..."):
+		p.pos += 3
+		p.tok = gqlToken{kind: gqlTokenPunct, val: "..."}
+	case strings.IndexByte("{}()[]:!$=@", c) >= 0:
+		p.pos++
+		p.tok = gqlToken{kind: gqlTokenPunct, val: string(c)}
+	case isGraphQLNameStart(c):
+		for p.pos < len(p.src) && (isGraphQLNameStart(p.src[p.pos]) || isDigit(p.src[p.pos])) {
+			p.pos++
+		}
+		p.tok = gqlToken{kind: gqlTokenName, val: p.src[start:p.pos]}
+	case c == '-' || isDigit(c):
+		kind := gqlTokenInt
+		p.pos++
+		for p.pos < len(p.src) {
+			ch := p.src[p.pos]
+			if ch == '.' || ch == 'e' || ch == 'E' ||
+				((ch == '+' || ch == '-') && (p.src[p.pos-1] == 'e' || p.src[p.pos-1] == 'E')) {
+				kind = gqlTokenFloat
+			} else if !isDigit(ch) {
+				break
+			}
+			p.pos++
+		}
+		p.tok = gqlToken{kind: kind, val: p.src[start:p.pos]}
+	case strings.HasPrefix(p.src[p.pos:], `"""`):
+		end := strings.Index(p.src[p.pos+3:], `"""`)
+		if end < 0 {
+			return fmt.Errorf("syntax error: unterminated string at position %d", start)
+		}
+		p.pos += end + 6
+		p.tok = gqlToken{kind: gqlTokenString, val: p.src[start+3 : p.pos-3]}
+	case c == '"':
+		p.pos++
+		for p.pos < len(p.src) && p.src[p.pos] != '"' && p.src[p.pos] != '\n' {
+			if p.src[p.pos] == '\\' {
+				p.pos++
+			}
+			p.pos++
+		}
+		if p.pos >= len(p.src) || p.src[p.pos] != '"' {
+			return fmt.Errorf("syntax error: unterminated string at position %d", start)
+		}
+		p.pos++
+		// the escapes of graphql string are the same as json
+		var s string
+		if err := json.Unmarshal([]byte(p.src[start:p.pos]), &s); err != nil {
+			return fmt.Errorf("syntax error: invalid string at position %d: %s", start, err)
+		}
+		p.tok = gqlToken{kind: gqlTokenString, val: s}
+	default:
+		return fmt.Errorf("syntax error: unexpected character %q at position %d", c, start)
+	}
+	return nil
+}
+
+func isGraphQLNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
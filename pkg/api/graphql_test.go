@@ -0,0 +1,127 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/mod"
+	"github.com/etherealiy/fastflow/store/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandler_GraphQL(t *testing.T) {
+	st := memory.NewStore()
+	mod.SetStore(st)
+	assert.NoError(t, st.CreateDag(&entity.Dag{
+		BaseInfo: entity.BaseInfo{ID: "dag1"},
+		Name:     "first",
+		Status:   entity.DagStatusNormal,
+		Tasks:    []entity.Task{{ID: "task1", ActionName: "act"}},
+	}))
+	assert.NoError(t, st.CreateDagIns(&entity.DagInstance{
+		BaseInfo: entity.BaseInfo{ID: "ins1"},
+		DagID:    "dag1",
+		Status:   entity.DagInstanceStatusFailed,
+	}))
+	assert.NoError(t, st.CreateDagIns(&entity.DagInstance{
+		BaseInfo: entity.BaseInfo{ID: "ins2"},
+		DagID:    "dag1",
+		Status:   entity.DagInstanceStatusSuccess,
+	}))
+	assert.NoError(t, st.BatchCreatTaskIns([]*entity.TaskInstance{{
+		BaseInfo: entity.BaseInfo{ID: "task-ins1"},
+		DagInsID: "ins1",
+		TaskID:   "task1",
+		Status:   entity.TaskInstanceStatusFailed,
+		Attempts: []entity.TaskAttempt{{Attempt: 1, Worker: "worker-1", Status: entity.TaskInstanceStatusFailed, Reason: "timeout"}},
+	}}))
+	h := NewHandler()
+
+	tests := []struct {
+		caseDesc string
+		giveReq  GraphQLRequest
+		wantCode int
+		wantBody string
+	}{
+		{
+			caseDesc: "nested query",
+			giveReq: GraphQLRequest{Query: `{
+				dag(id: "dag1") {
+					name
+					instances(status: failed) { id taskInstances { taskId attempts { reason } } }
+				}
+			}`},
+			wantCode: http.StatusOK,
+			wantBody: `{"data":{"dag":{"name":"first","instances":[{"id":"ins1","taskInstances":[{"taskId":"task1","attempts":[{"reason":"timeout"}]}]}]}}}`,
+		},
+		{
+			caseDesc: "alias, variables and directives",
+			giveReq: GraphQLRequest{
+				Query: `query Runs($status: [String!], $withDag: Boolean = false) {
+					runs: dagInstances(dagId: "dag1", status: $status) { id dag @include(if: $withDag) { id } __typename }
+				}`,
+				OperationName: "Runs",
+				Variables:     map[string]interface{}{"status": []string{"success"}},
+			},
+			wantCode: http.StatusOK,
+			wantBody: `{"data":{"runs":[{"id":"ins2","__typename":"DagInstance"}]}}`,
+		},
+		{
+			caseDesc: "from task instance to dag",
+			giveReq:  GraphQLRequest{Query: `{ taskInstance(id: "task-ins1") { status dagInstance { dag { id } } } }`},
+			wantCode: http.StatusOK,
+			wantBody: `{"data":{"taskInstance":{"status":"failed","dagInstance":{"dag":{"id":"dag1"}}}}}`,
+		},
+		{
+			caseDesc: "not found is null",
+			giveReq:  GraphQLRequest{Query: `{ dagInstance(id: "not-existed") { id } }`},
+			wantCode: http.StatusOK,
+			wantBody: `{"data":{"dagInstance":null}}`,
+		},
+		{
+			caseDesc: "unknown field",
+			giveReq:  GraphQLRequest{Query: `{ dag(id: "dag1") { id notExisted } }`},
+			wantCode: http.StatusOK,
+			wantBody: `{"data":{"dag":{"id":"dag1","notExisted":null}},"errors":[{"message":"cannot query field \"notExisted\" on type \"Dag\"","path":["dag","notExisted"]}]}`,
+		},
+		{
+			caseDesc: "missing selection",
+			giveReq:  GraphQLRequest{Query: `{ dag(id: "dag1") }`},
+			wantCode: http.StatusOK,
+			wantBody: `{"data":{"dag":null},"errors":[{"message":"field \"dag\" of type \"Dag\" must have a selection of subfields","path":["dag"]}]}`,
+		},
+		{
+			caseDesc: "mutation",
+			giveReq:  GraphQLRequest{Query: `mutation { runDag(id: "dag1") { id } }`},
+			wantCode: http.StatusOK,
+			wantBody: `{"data":null,"errors":[{"message":"mutation operation is not supported"}]}`,
+		},
+		{
+			caseDesc: "syntax error",
+			giveReq:  GraphQLRequest{Query: `{ dag(id: "dag1") { id }`},
+			wantCode: http.StatusOK,
+			wantBody: `{"data":null,"errors":[{"message":"syntax error: unexpected end of document"}]}`,
+		},
+		{
+			caseDesc: "empty query",
+			giveReq:  GraphQLRequest{},
+			wantCode: http.StatusBadRequest,
+			wantBody: `{"message":"query cannot be empty"}`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			body, err := json.Marshal(tc.giveReq)
+			assert.NoError(t, err)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/graphql", bytes.NewReader(body)))
+			assert.Equal(t, tc.wantCode, w.Code)
+			assert.JSONEq(t, tc.wantBody, w.Body.String())
+		})
+	}
+}
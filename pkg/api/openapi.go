@@ -0,0 +1,284 @@
+package api
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const (
+	openAPIVersion = "3.0.3"
+	// APIVersion is the version of management api
+	APIVersion = "v1"
+)
+
+// RouteDoc describe a route, it is used to generate OpenAPI document
+type RouteDoc struct {
+	Summary string
+	Query   []QueryParam
+	// Body is a sample of request body such as RunDagInput{}, nil means no body
+	Body interface{}
+	// Response is a sample of response such as []*entity.DagInstance{}, nil means no content
+	Response interface{}
+	// ResponseContentType is used when response is not json, such as downloading files
+	ResponseContentType string
+}
+
+// QueryParam
+type QueryParam struct {
+	Name string
+	Desc string
+	// Type default is "string"
+	Type string
+}
+
+// OpenAPIDoc is the subset of OpenAPI 3 document
+type OpenAPIDoc struct {
+	OpenAPI    string                                  `json:"openapi"`
+	Info       OpenAPIInfo                             `json:"info"`
+	Servers    []OpenAPIServer                         `json:"servers"`
+	Paths      map[string]map[string]*OpenAPIOperation `json:"paths"`
+	Components OpenAPIComponents                       `json:"components"`
+}
+
+// OpenAPIInfo
+type OpenAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+// OpenAPIServer
+type OpenAPIServer struct {
+	URL string `json:"url"`
+}
+
+// OpenAPIComponents
+type OpenAPIComponents struct {
+	Schemas map[string]*Schema `json:"schemas"`
+}
+
+// OpenAPIOperation
+type OpenAPIOperation struct {
+	OperationID string                      `json:"operationId"`
+	Summary     string                      `json:"summary,omitempty"`
+	Parameters  []OpenAPIParameter          `json:"parameters,omitempty"`
+	RequestBody *OpenAPIBody                `json:"requestBody,omitempty"`
+	Responses   map[string]*OpenAPIResponse `json:"responses"`
+}
+
+// OpenAPIParameter
+type OpenAPIParameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// OpenAPIBody
+type OpenAPIBody struct {
+	Required bool                         `json:"required,omitempty"`
+	Content  map[string]*OpenAPIMediaType `json:"content"`
+}
+
+// OpenAPIResponse
+type OpenAPIResponse struct {
+	Description string                       `json:"description"`
+	Content     map[string]*OpenAPIMediaType `json:"content,omitempty"`
+}
+
+// OpenAPIMediaType
+type OpenAPIMediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Schema is the subset of json schema used by OpenAPI
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+// OpenAPI generate OpenAPI document from the registered routes
+func (h *Handler) OpenAPI() *OpenAPIDoc {
+	doc := &OpenAPIDoc{
+		OpenAPI: openAPIVersion,
+		Info:    OpenAPIInfo{Title: "fastflow management api", Version: APIVersion},
+		Servers: []OpenAPIServer{{URL: strings.TrimSuffix(PathPrefix, "/")}},
+		Paths:   map[string]map[string]*OpenAPIOperation{},
+		Components: OpenAPIComponents{Schemas: map[string]*Schema{
+			"ErrorResponse": {Type: "object", Properties: map[string]*Schema{"message": {Type: "string"}}},
+		}},
+	}
+	g := &schemaGenerator{schemas: doc.Components.Schemas}
+
+	for _, rt := range h.routes {
+		var path []string
+		op := &OpenAPIOperation{
+			Responses: map[string]*OpenAPIResponse{
+				"default": {Description: "error", Content: jsonContent(&Schema{Ref: "#/components/schemas/ErrorResponse"})},
+			},
+		}
+		for _, seg := range rt.segments {
+			if strings.HasPrefix(seg, ":") {
+				path = append(path, "{"+seg[1:]+"}")
+				op.Parameters = append(op.Parameters, OpenAPIParameter{
+					Name: seg[1:], In: "path", Required: true, Schema: &Schema{Type: "string"},
+				})
+				continue
+			}
+			path = append(path, seg)
+		}
+		op.OperationID = operationID(rt.method, rt.segments)
+
+		success := &OpenAPIResponse{Description: "success"}
+		if rt.doc != nil {
+			op.Summary = rt.doc.Summary
+			for _, q := range rt.doc.Query {
+				typ := q.Type
+				if typ == "" {
+					typ = "string"
+				}
+				op.Parameters = append(op.Parameters, OpenAPIParameter{
+					Name: q.Name, In: "query", Description: q.Desc, Schema: &Schema{Type: typ},
+				})
+			}
+			if rt.doc.Body != nil {
+				op.RequestBody = &OpenAPIBody{Required: true, Content: jsonContent(g.schemaOf(reflect.TypeOf(rt.doc.Body)))}
+			}
+			switch {
+			case rt.doc.ResponseContentType != "":
+				success.Content = map[string]*OpenAPIMediaType{
+					rt.doc.ResponseContentType: {Schema: &Schema{Type: "string", Format: "binary"}},
+				}
+			case rt.doc.Response != nil:
+				success.Content = jsonContent(g.schemaOf(reflect.TypeOf(rt.doc.Response)))
+			}
+		}
+		op.Responses["200"] = success
+
+		p := "/" + strings.Join(path, "/")
+		if doc.Paths[p] == nil {
+			doc.Paths[p] = map[string]*OpenAPIOperation{}
+		}
+		doc.Paths[p][strings.ToLower(rt.method)] = op
+	}
+	return doc
+}
+
+func getOpenAPI(h *Handler) func(r *Request) (interface{}, error) {
+	return func(r *Request) (interface{}, error) {
+		return h.OpenAPI(), nil
+	}
+}
+
+func jsonContent(s *Schema) map[string]*OpenAPIMediaType {
+	return map[string]*OpenAPIMediaType{"application/json": {Schema: s}}
+}
+
+// operationID is like "getDagInstancesTaskInstances"
+func operationID(method string, segments []string) string {
+	b := strings.Builder{}
+	b.WriteString(strings.ToLower(method))
+	for _, seg := range segments {
+		if strings.HasPrefix(seg, ":") {
+			continue
+		}
+		for _, word := range strings.FieldsFunc(seg, func(r rune) bool { return r == '-' || r == '.' }) {
+			b.WriteString(strings.ToUpper(word[:1]) + word[1:])
+		}
+	}
+	return b.String()
+}
+
+type schemaGenerator struct {
+	schemas map[string]*Schema
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+func (g *schemaGenerator) schemaOf(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case rawMessageType:
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Uint:
+		return &Schema{Type: "integer"}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: g.schemaOf(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.schemaOf(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		if _, ok := g.schemas[t.Name()]; !ok {
+			// placeholder prevent infinite recursion of self-referenced types
+			g.schemas[t.Name()] = &Schema{}
+			*g.schemas[t.Name()] = *g.structSchema(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + t.Name()}
+	default:
+		// interface and others can be any value
+		return &Schema{}
+	}
+}
+
+func (g *schemaGenerator) structSchema(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	g.fillProperties(t, s)
+	return s
+}
+
+// fillProperties follow the rules of encoding/json, the fields of embedded struct are promoted
+func (g *schemaGenerator) fillProperties(t reflect.Type, s *Schema) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				g.fillProperties(ft, s)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		s.Properties[name] = g.schemaOf(f.Type)
+	}
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"encoding/json"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandler_OpenAPI(t *testing.T) {
+	doc := NewHandler().OpenAPI()
+
+	assert.Equal(t, "/api/v1", doc.Servers[0].URL)
+	runDag := doc.Paths["/dags/{dagId}/run"]["post"]
+	if assert.NotNil(t, runDag) {
+		assert.Equal(t, "postDagsRun", runDag.OperationID)
+		assert.Equal(t, []OpenAPIParameter{{Name: "dagId", In: "path", Required: true, Schema: &Schema{Type: "string"}}}, runDag.Parameters)
+		assert.Equal(t, "#/components/schemas/RunDagInput", runDag.RequestBody.Content["application/json"].Schema.Ref)
+		assert.Equal(t, "#/components/schemas/DagInstance", runDag.Responses["200"].Content["application/json"].Schema.Ref)
+	}
+	download := doc.Paths["/task-instances/{taskInsId}/artifacts/{name}"]["get"]
+	if assert.NotNil(t, download) {
+		assert.Len(t, download.Parameters, 2)
+		assert.Contains(t, download.Responses["200"].Content, "application/octet-stream")
+	}
+
+	dagIns := doc.Components.Schemas["DagInstance"]
+	if assert.NotNil(t, dagIns) {
+		assert.Equal(t, &Schema{Type: "string"}, dagIns.Properties["id"], "fields of embedded struct should be promoted")
+		assert.Equal(t, &Schema{Type: "integer", Format: "int64"}, dagIns.Properties["createdAt"])
+		assert.Equal(t, "#/components/schemas/DagInstanceSummary", dagIns.Properties["summary"].Ref)
+	}
+	assert.Equal(t, &Schema{Type: "string", Format: "date-time"}, doc.Components.Schemas["RunDagInput"].Properties["logicalDate"])
+
+	// all references must be defined
+	bs, err := json.Marshal(doc)
+	assert.NoError(t, err)
+	for _, m := range regexp.MustCompile(`"\$ref":"#/components/schemas/(\w+)"`).FindAllStringSubmatch(string(bs), -1) {
+		assert.Contains(t, doc.Components.Schemas, m[1])
+	}
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/log"
+)
+
+// redactBody return a copy of response body whose vars, share data, reasons, traces and logs are redacted,
+// the values got from store are not changed since they may be shared by memory store
+func redactBody(body interface{}) interface{} {
+	switch v := body.(type) {
+	case ErrorResponse:
+		v.Message = log.Redact(v.Message)
+		return v
+	case *entity.DagInstance:
+		return redactDagIns(v)
+	case []*entity.DagInstance:
+		ret := make([]*entity.DagInstance, len(v))
+		for i := range v {
+			ret[i] = redactDagIns(v[i])
+		}
+		return ret
+	case *entity.TaskInstance:
+		return redactTaskIns(v)
+	case []*entity.TaskInstance:
+		ret := make([]*entity.TaskInstance, len(v))
+		for i := range v {
+			ret[i] = redactTaskIns(v[i])
+		}
+		return ret
+	case []entity.TaskAttempt:
+		return redactAttempts(v)
+	case []*entity.TaskLog:
+		ret := make([]*entity.TaskLog, len(v))
+		for i := range v {
+			ret[i] = redactTaskLog(v[i])
+		}
+		return ret
+	}
+	return body
+}
+
+func redactDagIns(dagIns *entity.DagInstance) *entity.DagInstance {
+	if dagIns == nil {
+		return nil
+	}
+	ret := *dagIns
+	ret.Reason = log.Redact(dagIns.Reason)
+	if dagIns.Vars != nil {
+		ret.Vars = make(entity.DagInstanceVars, len(dagIns.Vars))
+		for k, v := range dagIns.Vars {
+			ret.Vars[k] = entity.DagInstanceVar{Value: log.Redact(v.Value)}
+		}
+	}
+	if dagIns.ShareData != nil {
+		ret.ShareData = &entity.ShareData{Dict: redactDict(dagIns.ShareData.Dict)}
+	}
+	return &ret
+}
+
+func redactTaskIns(taskIns *entity.TaskInstance) *entity.TaskInstance {
+	if taskIns == nil {
+		return nil
+	}
+	ret := *taskIns
+	ret.Reason = log.Redact(taskIns.Reason)
+	ret.Traces = redactTraces(taskIns.Traces)
+	ret.Attempts = redactAttempts(taskIns.Attempts)
+	return &ret
+}
+
+func redactAttempts(attempts []entity.TaskAttempt) []entity.TaskAttempt {
+	if attempts == nil {
+		return nil
+	}
+	ret := make([]entity.TaskAttempt, len(attempts))
+	for i, a := range attempts {
+		a.Reason = log.Redact(a.Reason)
+		a.Traces = redactTraces(a.Traces)
+		ret[i] = a
+	}
+	return ret
+}
+
+func redactTraces(traces []entity.TraceInfo) []entity.TraceInfo {
+	if traces == nil {
+		return nil
+	}
+	ret := make([]entity.TraceInfo, len(traces))
+	for i, t := range traces {
+		t.Message = log.Redact(t.Message)
+		ret[i] = t
+	}
+	return ret
+}
+
+func redactTaskLog(l *entity.TaskLog) *entity.TaskLog {
+	if l == nil {
+		return nil
+	}
+	ret := *l
+	ret.Message = log.Redact(l.Message)
+	ret.Fields = redactDict(l.Fields)
+	return &ret
+}
+
+func redactDict(dict map[string]string) map[string]string {
+	if dict == nil {
+		return nil
+	}
+	ret := make(map[string]string, len(dict))
+	for k, v := range dict {
+		ret[k] = log.Redact(v)
+	}
+	return ret
+}
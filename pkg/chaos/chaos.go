@@ -0,0 +1,123 @@
+package chaos
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/mod"
+)
+
+var (
+	// ErrInjected is returned by the store operations which are failed by injector
+	ErrInjected = errors.New("fault injected")
+)
+
+var _ mod.FaultInjector = (*Injector)(nil)
+
+// Option configure what faults will be injected, all rates are in range 0~1
+type Option struct {
+	// StoreFailRate is the percentage of store operations which will return ErrInjected
+	StoreFailRate float64
+	// StoreDelayRate is the percentage of store operations which will be delayed
+	StoreDelayRate float64
+	// StoreDelay is the delay of store operations
+	StoreDelay time.Duration
+	// StoreOps restrict the faults to these operations such as "PatchTaskIns", empty means all
+	StoreOps []string
+
+	// DropDispatchRate is the percentage of dispatching which will be dropped
+	DropDispatchRate float64
+
+	// KillTaskRate is the percentage of task instances which will be killed when running
+	KillTaskRate float64
+	// KillTaskAfter is the time from task instance begin to be killed, default 100ms
+	KillTaskAfter time.Duration
+
+	// Seed of random, 0 means using current time
+	Seed int64
+}
+
+// Injector used to inject faults for chaos testing, so you can verify your pipelines and the engine recover correctly.
+// IMPORTANT: it is only used for testing, DO NOT use it in production
+//
+//	inj := chaos.NewInjector(&chaos.Option{StoreFailRate: 0.1, KillTaskRate: 0.05})
+//	inj.Enable()
+//	defer inj.Disable()
+//	fastflow.Init(&fastflow.InitialOption{Store: inj.WrapStore(st), ...})
+type Injector struct {
+	opt *Option
+
+	rand  *rand.Rand
+	mutex sync.Mutex
+}
+
+// NewInjector
+func NewInjector(opt *Option) *Injector {
+	if opt.KillTaskAfter == 0 {
+		opt.KillTaskAfter = 100 * time.Millisecond
+	}
+	seed := opt.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &Injector{
+		opt:  opt,
+		rand: rand.New(rand.NewSource(seed)),
+	}
+}
+
+// Enable set injector to engine, so dispatcher and executor will be affected
+func (i *Injector) Enable() {
+	mod.SetFaultInjector(i)
+}
+
+// Disable remove injector from engine
+func (i *Injector) Disable() {
+	mod.SetFaultInjector(nil)
+}
+
+func (i *Injector) hit(rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	return i.rand.Float64() < rate
+}
+
+// DropDispatch
+func (i *Injector) DropDispatch(dagIns *entity.DagInstance) bool {
+	return i.hit(i.opt.DropDispatchRate)
+}
+
+// KillTask
+func (i *Injector) KillTask(taskIns *entity.TaskInstance) (time.Duration, bool) {
+	return i.opt.KillTaskAfter, i.hit(i.opt.KillTaskRate)
+}
+
+// beforeStoreOp delay or fail the store operation
+func (i *Injector) beforeStoreOp(op string) error {
+	if len(i.opt.StoreOps) > 0 && !containStr(i.opt.StoreOps, op) {
+		return nil
+	}
+	if i.hit(i.opt.StoreDelayRate) {
+		time.Sleep(i.opt.StoreDelay)
+	}
+	if i.hit(i.opt.StoreFailRate) {
+		return fmt.Errorf("store operation %s failed: %w", op, ErrInjected)
+	}
+	return nil
+}
+
+func containStr(strs []string, str string) bool {
+	for i := range strs {
+		if strs[i] == str {
+			return true
+		}
+	}
+	return false
+}
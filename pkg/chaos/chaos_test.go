@@ -0,0 +1,133 @@
+package chaos
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/mod"
+	"github.com/etherealiy/fastflow/store/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInjector_WrapStore(t *testing.T) {
+	tests := []struct {
+		caseDesc string
+		giveOpt  *Option
+		wantErr  bool
+	}{
+		{
+			caseDesc: "no fault",
+			giveOpt:  &Option{},
+		},
+		{
+			caseDesc: "always failed",
+			giveOpt:  &Option{StoreFailRate: 1},
+			wantErr:  true,
+		},
+		{
+			caseDesc: "other operation failed",
+			giveOpt:  &Option{StoreFailRate: 1, StoreOps: []string{"PatchTaskIns"}},
+		},
+		{
+			caseDesc: "delayed",
+			giveOpt:  &Option{StoreDelayRate: 1, StoreDelay: 10 * time.Millisecond},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			st := NewInjector(tc.giveOpt).WrapStore(memory.NewStore())
+			begin := time.Now()
+			err := st.CreateDagIns(&entity.DagInstance{DagID: "dag"})
+			if tc.wantErr {
+				assert.True(t, errors.Is(err, ErrInjected))
+				return
+			}
+			assert.NoError(t, err)
+			assert.True(t, time.Since(begin) >= tc.giveOpt.StoreDelay)
+
+			ret, err := st.ListDagInstance(&mod.ListDagInstanceInput{})
+			assert.NoError(t, err)
+			assert.Len(t, ret, 1)
+		})
+	}
+}
+
+func TestInjector_WrapStoreOptionalOps(t *testing.T) {
+	st := NewInjector(&Option{StoreFailRate: 1}).WrapStore(memory.NewStore())
+	_, err := st.ListDag(&mod.ListDagInput{})
+	assert.True(t, errors.Is(err, ErrInjected))
+	assert.True(t, errors.Is(st.BatchDeleteDag([]string{"dag"}), ErrInjected))
+	assert.True(t, errors.Is(st.BatchDeleteDagIns([]string{"dag-ins"}), ErrInjected))
+	assert.True(t, errors.Is(st.WithTx(func(mod.Store) error { return nil }), ErrInjected))
+	_, err = st.ClaimTaskIns("task-ins", "worker", time.Minute)
+	assert.True(t, errors.Is(err, ErrInjected))
+	_, err = st.AcquireLease("lease", "worker", time.Minute)
+	assert.True(t, errors.Is(err, ErrInjected))
+	_, err = st.IncrRateLimitCounter("key", time.Now(), time.Minute)
+	assert.True(t, errors.Is(err, ErrInjected))
+	assert.True(t, errors.Is(st.SaveWorkerInfo(&entity.WorkerInfo{}), ErrInjected))
+	assert.True(t, errors.Is(st.SaveClusterConfig(&entity.ClusterConfig{}), ErrInjected))
+	assert.True(t, errors.Is(st.AppendTaskLogs("task-ins", nil, 0), ErrInjected))
+
+	st = NewInjector(&Option{}).WrapStore(memory.NewStore())
+	assert.NoError(t, st.WithTx(func(tx mod.Store) error {
+		_, ok := tx.(*Store)
+		assert.True(t, ok, "operations in transaction should be wrapped")
+		return tx.CreateDagIns(&entity.DagInstance{BaseInfo: entity.BaseInfo{ID: "dag-ins"}})
+	}))
+	_, err = st.GetDagInstance("dag-ins")
+	assert.NoError(t, err)
+	assert.NoError(t, st.CreateDag(&entity.Dag{BaseInfo: entity.BaseInfo{ID: "dag"}, Tasks: []entity.Task{{ID: "task", ActionName: "act"}}}))
+	dags, err := st.ListDag(&mod.ListDagInput{})
+	assert.NoError(t, err)
+	assert.Len(t, dags, 1)
+	assert.NoError(t, st.BatchDeleteDag([]string{"dag"}))
+	assert.NoError(t, st.BatchDeleteDagIns([]string{"dag-ins"}))
+}
+
+func TestInjector_WrapStoreCapabilities(t *testing.T) {
+	tests := []struct {
+		caseDesc  string
+		giveStore mod.Store
+		wantOk    bool
+	}{
+		{
+			caseDesc:  "forwarded",
+			giveStore: memory.NewStore(),
+			wantOk:    true,
+		},
+		{
+			caseDesc:  "hidden when the wrapped store does not have it",
+			giveStore: struct{ mod.Store }{memory.NewStore()},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			st := NewInjector(&Option{}).WrapStore(tc.giveStore)
+			_, ok := mod.StoreAs[mod.TaskInsClaimStore](st)
+			assert.Equal(t, tc.wantOk, ok)
+			_, ok = mod.StoreAs[mod.RetryCountStore](st)
+			assert.Equal(t, tc.wantOk, ok)
+			_, ok = mod.StoreAs[mod.TxStore](st)
+			assert.Equal(t, tc.wantOk, ok)
+			_, ok = mod.StoreAs[mod.LeaseStore](st)
+			assert.Equal(t, tc.wantOk, ok)
+		})
+	}
+}
+
+func TestInjector_Enable(t *testing.T) {
+	inj := NewInjector(&Option{DropDispatchRate: 1, KillTaskRate: 1, KillTaskAfter: time.Second})
+	inj.Enable()
+	assert.Equal(t, inj, mod.GetFaultInjector())
+	assert.True(t, mod.GetFaultInjector().DropDispatch(&entity.DagInstance{}))
+	after, kill := mod.GetFaultInjector().KillTask(&entity.TaskInstance{})
+	assert.True(t, kill)
+	assert.Equal(t, time.Second, after)
+
+	inj.Disable()
+	assert.Nil(t, mod.GetFaultInjector())
+}
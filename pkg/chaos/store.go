@@ -0,0 +1,356 @@
+package chaos
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/mod"
+)
+
+var (
+	_ mod.Store              = (*Store)(nil)
+	_ mod.StoreWrapper       = (*Store)(nil)
+	_ mod.DagPruneStore      = (*Store)(nil)
+	_ mod.TaskInsClaimStore  = (*Store)(nil)
+	_ mod.RetryCountStore    = (*Store)(nil)
+	_ mod.TxStore            = (*Store)(nil)
+	_ mod.LeaseStore         = (*Store)(nil)
+	_ mod.ClusterConfigStore = (*Store)(nil)
+	_ mod.WorkerInfoStore    = (*Store)(nil)
+	_ mod.RateLimitStore     = (*Store)(nil)
+	_ mod.TaskLogStore       = (*Store)(nil)
+)
+
+// Store wrap a store and inject faults before each operation
+type Store struct {
+	mod.Store
+	injector *Injector
+}
+
+// WrapStore
+func (i *Injector) WrapStore(st mod.Store) *Store {
+	return &Store{
+		Store:    st,
+		injector: i,
+	}
+}
+
+// CreateDag
+func (s *Store) CreateDag(dag *entity.Dag) error {
+	if err := s.injector.beforeStoreOp("CreateDag"); err != nil {
+		return err
+	}
+	return s.Store.CreateDag(dag)
+}
+
+// CreateDagIns
+func (s *Store) CreateDagIns(dagIns *entity.DagInstance) error {
+	if err := s.injector.beforeStoreOp("CreateDagIns"); err != nil {
+		return err
+	}
+	return s.Store.CreateDagIns(dagIns)
+}
+
+// BatchCreatTaskIns
+func (s *Store) BatchCreatTaskIns(taskIns []*entity.TaskInstance) error {
+	if err := s.injector.beforeStoreOp("BatchCreatTaskIns"); err != nil {
+		return err
+	}
+	return s.Store.BatchCreatTaskIns(taskIns)
+}
+
+// PatchTaskIns
+func (s *Store) PatchTaskIns(taskIns *entity.TaskInstance) error {
+	if err := s.injector.beforeStoreOp("PatchTaskIns"); err != nil {
+		return err
+	}
+	return s.Store.PatchTaskIns(taskIns)
+}
+
+// PatchDagIns
+func (s *Store) PatchDagIns(dagIns *entity.DagInstance, mustsPatchFields ...string) error {
+	if err := s.injector.beforeStoreOp("PatchDagIns"); err != nil {
+		return err
+	}
+	return s.Store.PatchDagIns(dagIns, mustsPatchFields...)
+}
+
+// UpdateDag
+func (s *Store) UpdateDag(dag *entity.Dag) error {
+	if err := s.injector.beforeStoreOp("UpdateDag"); err != nil {
+		return err
+	}
+	return s.Store.UpdateDag(dag)
+}
+
+// UpdateDagIns
+func (s *Store) UpdateDagIns(dagIns *entity.DagInstance) error {
+	if err := s.injector.beforeStoreOp("UpdateDagIns"); err != nil {
+		return err
+	}
+	return s.Store.UpdateDagIns(dagIns)
+}
+
+// UpdateTaskIns
+func (s *Store) UpdateTaskIns(taskIns *entity.TaskInstance) error {
+	if err := s.injector.beforeStoreOp("UpdateTaskIns"); err != nil {
+		return err
+	}
+	return s.Store.UpdateTaskIns(taskIns)
+}
+
+// BatchUpdateDagIns
+func (s *Store) BatchUpdateDagIns(dagIns []*entity.DagInstance) error {
+	if err := s.injector.beforeStoreOp("BatchUpdateDagIns"); err != nil {
+		return err
+	}
+	return s.Store.BatchUpdateDagIns(dagIns)
+}
+
+// BatchUpdateTaskIns
+func (s *Store) BatchUpdateTaskIns(taskIns []*entity.TaskInstance) error {
+	if err := s.injector.beforeStoreOp("BatchUpdateTaskIns"); err != nil {
+		return err
+	}
+	return s.Store.BatchUpdateTaskIns(taskIns)
+}
+
+// GetTaskIns
+func (s *Store) GetTaskIns(taskInsId string) (*entity.TaskInstance, error) {
+	if err := s.injector.beforeStoreOp("GetTaskIns"); err != nil {
+		return nil, err
+	}
+	return s.Store.GetTaskIns(taskInsId)
+}
+
+// GetDag
+func (s *Store) GetDag(dagId string) (*entity.Dag, error) {
+	if err := s.injector.beforeStoreOp("GetDag"); err != nil {
+		return nil, err
+	}
+	return s.Store.GetDag(dagId)
+}
+
+// GetDagInstance
+func (s *Store) GetDagInstance(dagInsId string) (*entity.DagInstance, error) {
+	if err := s.injector.beforeStoreOp("GetDagInstance"); err != nil {
+		return nil, err
+	}
+	return s.Store.GetDagInstance(dagInsId)
+}
+
+// ListDagInstance
+func (s *Store) ListDagInstance(input *mod.ListDagInstanceInput) ([]*entity.DagInstance, error) {
+	if err := s.injector.beforeStoreOp("ListDagInstance"); err != nil {
+		return nil, err
+	}
+	return s.Store.ListDagInstance(input)
+}
+
+// ListTaskInstance
+func (s *Store) ListTaskInstance(input *mod.ListTaskInstanceInput) ([]*entity.TaskInstance, error) {
+	if err := s.injector.beforeStoreOp("ListTaskInstance"); err != nil {
+		return nil, err
+	}
+	return s.Store.ListTaskInstance(input)
+}
+
+// Unwrap
+func (s *Store) Unwrap() mod.Store {
+	return s.Store
+}
+
+// ListDag
+func (s *Store) ListDag(input *mod.ListDagInput) ([]*entity.Dag, error) {
+	ps, ok := s.Store.(mod.DagPruneStore)
+	if !ok {
+		return nil, fmt.Errorf("store does not support pruning dags")
+	}
+	if err := s.injector.beforeStoreOp("ListDag"); err != nil {
+		return nil, err
+	}
+	return ps.ListDag(input)
+}
+
+// BatchDeleteDag
+func (s *Store) BatchDeleteDag(ids []string) error {
+	ps, ok := s.Store.(mod.DagPruneStore)
+	if !ok {
+		return fmt.Errorf("store does not support pruning dags")
+	}
+	if err := s.injector.beforeStoreOp("BatchDeleteDag"); err != nil {
+		return err
+	}
+	return ps.BatchDeleteDag(ids)
+}
+
+// BatchDeleteDagIns
+func (s *Store) BatchDeleteDagIns(ids []string) error {
+	ds, ok := s.Store.(interface{ BatchDeleteDagIns(ids []string) error })
+	if !ok {
+		return fmt.Errorf("store does not support deleting dag instances")
+	}
+	if err := s.injector.beforeStoreOp("BatchDeleteDagIns"); err != nil {
+		return err
+	}
+	return ds.BatchDeleteDagIns(ids)
+}
+
+// ClaimTaskIns
+func (s *Store) ClaimTaskIns(taskInsID, worker string, ttl time.Duration) (bool, error) {
+	cs, ok := s.Store.(mod.TaskInsClaimStore)
+	if !ok {
+		return false, fmt.Errorf("store does not support claiming task instances")
+	}
+	if err := s.injector.beforeStoreOp("ClaimTaskIns"); err != nil {
+		return false, err
+	}
+	return cs.ClaimTaskIns(taskInsID, worker, ttl)
+}
+
+// SwapRetryCount
+func (s *Store) SwapRetryCount(dagInsID string, oldCount, newCount int) (bool, error) {
+	rs, ok := s.Store.(mod.RetryCountStore)
+	if !ok {
+		return false, fmt.Errorf("store does not support swapping retry count")
+	}
+	if err := s.injector.beforeStoreOp("SwapRetryCount"); err != nil {
+		return false, err
+	}
+	return rs.SwapRetryCount(dagInsID, oldCount, newCount)
+}
+
+// WithTx inject faults into the operations of transaction too
+func (s *Store) WithTx(fn func(st mod.Store) error) error {
+	ts, ok := s.Store.(mod.TxStore)
+	if !ok {
+		return fmt.Errorf("store does not support transactions")
+	}
+	if err := s.injector.beforeStoreOp("WithTx"); err != nil {
+		return err
+	}
+	return ts.WithTx(func(st mod.Store) error {
+		return fn(s.injector.WrapStore(st))
+	})
+}
+
+// AcquireLease
+func (s *Store) AcquireLease(key, holder string, ttl time.Duration) (bool, error) {
+	ls, ok := s.Store.(mod.LeaseStore)
+	if !ok {
+		return false, fmt.Errorf("store does not support leases")
+	}
+	if err := s.injector.beforeStoreOp("AcquireLease"); err != nil {
+		return false, err
+	}
+	return ls.AcquireLease(key, holder, ttl)
+}
+
+// ReleaseLease
+func (s *Store) ReleaseLease(key, holder string) (bool, error) {
+	ls, ok := s.Store.(mod.LeaseStore)
+	if !ok {
+		return false, fmt.Errorf("store does not support leases")
+	}
+	if err := s.injector.beforeStoreOp("ReleaseLease"); err != nil {
+		return false, err
+	}
+	return ls.ReleaseLease(key, holder)
+}
+
+// ListLease
+func (s *Store) ListLease(prefix string) ([]*mod.Lease, error) {
+	ls, ok := s.Store.(mod.LeaseStore)
+	if !ok {
+		return nil, fmt.Errorf("store does not support leases")
+	}
+	if err := s.injector.beforeStoreOp("ListLease"); err != nil {
+		return nil, err
+	}
+	return ls.ListLease(prefix)
+}
+
+// GetClusterConfig
+func (s *Store) GetClusterConfig() (*entity.ClusterConfig, error) {
+	cs, ok := s.Store.(mod.ClusterConfigStore)
+	if !ok {
+		return nil, fmt.Errorf("store does not support cluster config")
+	}
+	if err := s.injector.beforeStoreOp("GetClusterConfig"); err != nil {
+		return nil, err
+	}
+	return cs.GetClusterConfig()
+}
+
+// SaveClusterConfig
+func (s *Store) SaveClusterConfig(cfg *entity.ClusterConfig) error {
+	cs, ok := s.Store.(mod.ClusterConfigStore)
+	if !ok {
+		return fmt.Errorf("store does not support cluster config")
+	}
+	if err := s.injector.beforeStoreOp("SaveClusterConfig"); err != nil {
+		return err
+	}
+	return cs.SaveClusterConfig(cfg)
+}
+
+// SaveWorkerInfo
+func (s *Store) SaveWorkerInfo(info *entity.WorkerInfo) error {
+	ws, ok := s.Store.(mod.WorkerInfoStore)
+	if !ok {
+		return fmt.Errorf("store does not support worker info")
+	}
+	if err := s.injector.beforeStoreOp("SaveWorkerInfo"); err != nil {
+		return err
+	}
+	return ws.SaveWorkerInfo(info)
+}
+
+// ListWorkerInfo
+func (s *Store) ListWorkerInfo() ([]*entity.WorkerInfo, error) {
+	ws, ok := s.Store.(mod.WorkerInfoStore)
+	if !ok {
+		return nil, fmt.Errorf("store does not support worker info")
+	}
+	if err := s.injector.beforeStoreOp("ListWorkerInfo"); err != nil {
+		return nil, err
+	}
+	return ws.ListWorkerInfo()
+}
+
+// IncrRateLimitCounter
+func (s *Store) IncrRateLimitCounter(key string, windowStart time.Time, window time.Duration) (int, error) {
+	rs, ok := s.Store.(mod.RateLimitStore)
+	if !ok {
+		return 0, fmt.Errorf("store does not support rate limit counters")
+	}
+	if err := s.injector.beforeStoreOp("IncrRateLimitCounter"); err != nil {
+		return 0, err
+	}
+	return rs.IncrRateLimitCounter(key, windowStart, window)
+}
+
+// AppendTaskLogs
+func (s *Store) AppendTaskLogs(taskInsID string, logs []*entity.TaskLog, maxLines int) error {
+	ls, ok := s.Store.(mod.TaskLogStore)
+	if !ok {
+		return fmt.Errorf("store does not support task logs")
+	}
+	if err := s.injector.beforeStoreOp("AppendTaskLogs"); err != nil {
+		return err
+	}
+	return ls.AppendTaskLogs(taskInsID, logs, maxLines)
+}
+
+// GetTaskLogs
+func (s *Store) GetTaskLogs(taskInsID string, cursor int64, limit int) ([]*entity.TaskLog, error) {
+	ls, ok := s.Store.(mod.TaskLogStore)
+	if !ok {
+		return nil, fmt.Errorf("store does not support task logs")
+	}
+	if err := s.injector.beforeStoreOp("GetTaskLogs"); err != nil {
+		return nil, err
+	}
+	return ls.GetTaskLogs(taskInsID, cursor, limit)
+}
@@ -0,0 +1,138 @@
+package cloudevent
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/event"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeSink struct {
+	events []*Event
+	mutex  sync.Mutex
+}
+
+func (s *fakeSink) Send(ctx context.Context, e *Event) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.events = append(s.events, e)
+	return nil
+}
+
+func TestEmitter_Handle(t *testing.T) {
+	sink := &fakeSink{}
+	e := NewEmitter(&Option{Source: "test", Sinks: []Sink{sink}})
+	e.wg.Add(1)
+	go e.goSend()
+
+	taskIns := &entity.TaskInstance{BaseInfo: entity.BaseInfo{ID: "task-ins"}, TaskID: "task", DagInsID: "dag-ins", Status: entity.TaskInstanceStatusInit}
+	e.Handle(context.Background(), &event.DagInstancePatched{Payload: &entity.DagInstance{BaseInfo: entity.BaseInfo{ID: "dag-ins"}, Status: entity.DagInstanceStatusRunning}})
+	e.Handle(context.Background(), &event.DagInstanceUpdated{Payload: &entity.DagInstance{BaseInfo: entity.BaseInfo{ID: "dag-ins"}, Status: entity.DagInstanceStatusRunning}})
+	e.Handle(context.Background(), &event.TaskBegin{TaskIns: taskIns})
+	taskIns.Status = entity.TaskInstanceStatusSuccess
+	e.Handle(context.Background(), &event.TaskCompleted{TaskIns: taskIns})
+	e.Handle(context.Background(), &event.DagInstancePatched{Payload: &entity.DagInstance{BaseInfo: entity.BaseInfo{ID: "dag-ins"}}})
+	e.Handle(context.Background(), &event.DagInstancePatched{Payload: &entity.DagInstance{BaseInfo: entity.BaseInfo{ID: "dag-ins"}, Status: entity.DagInstanceStatusSuccess}})
+	e.Close()
+	// events after closed are ignored
+	e.Handle(context.Background(), &event.TaskCompleted{TaskIns: taskIns})
+
+	var types []string
+	for _, ev := range sink.events {
+		types = append(types, ev.Type)
+		assert.Equal(t, "test", ev.Source)
+		assert.Equal(t, SpecVersion, ev.SpecVersion)
+	}
+	assert.Equal(t, []string{
+		"io.fastflow.daginstance.running",
+		"io.fastflow.taskinstance.running",
+		"io.fastflow.taskinstance.success",
+		"io.fastflow.daginstance.success",
+	}, types)
+	assert.Equal(t, "task-instances/task-ins", sink.events[1].Subject)
+	assert.Equal(t, &TaskInstanceData{TaskInsID: "task-ins", TaskID: "task", DagInsID: "dag-ins", Status: entity.TaskInstanceStatusSuccess}, sink.events[2].Data)
+}
+
+func TestHTTPSink_Send(t *testing.T) {
+	tests := []struct {
+		caseDesc        string
+		giveBinary      bool
+		wantContentType string
+		wantBody        string
+		wantHeader      map[string]string
+	}{
+		{
+			caseDesc:        "structured",
+			wantContentType: "application/cloudevents+json",
+			wantBody:        `"specversion":"1.0","id":"id1","source":"src","type":"io.fastflow.daginstance.failed","subject":"dag-instances/d1"`,
+		},
+		{
+			caseDesc:        "binary",
+			giveBinary:      true,
+			wantContentType: "application/json",
+			wantBody:        `{"dagInsId":"d1","status":"failed"}`,
+			wantHeader:      map[string]string{"ce-id": "id1", "ce-type": "io.fastflow.daginstance.failed", "ce-source": "src", "X-Token": "token"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			var gotReq *http.Request
+			var gotBody []byte
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotReq = r
+				gotBody, _ = ioutil.ReadAll(r.Body)
+				w.WriteHeader(http.StatusAccepted)
+			}))
+			defer srv.Close()
+
+			ev := NewDagInstanceEvent("src", &entity.DagInstance{BaseInfo: entity.BaseInfo{ID: "d1"}, Status: entity.DagInstanceStatusFailed})
+			ev.ID = "id1"
+			sink := &HTTPSink{URL: srv.URL, Binary: tc.giveBinary, Header: http.Header{"X-Token": []string{"token"}}}
+			assert.NoError(t, sink.Send(context.Background(), ev))
+			assert.Equal(t, tc.wantContentType, gotReq.Header.Get("Content-Type"))
+			assert.Contains(t, string(gotBody), tc.wantBody)
+			for k, v := range tc.wantHeader {
+				assert.Equal(t, v, gotReq.Header.Get(k))
+			}
+		})
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+	assert.Error(t, (&HTTPSink{URL: srv.URL}).Send(context.Background(), NewDagInstanceEvent("src", &entity.DagInstance{})))
+}
+
+type fakeProducer struct {
+	topic   string
+	key     []byte
+	value   []byte
+	headers map[string]string
+}
+
+func (p *fakeProducer) Produce(ctx context.Context, topic string, key, value []byte, headers map[string]string) error {
+	p.topic, p.key, p.value, p.headers = topic, key, value, headers
+	return nil
+}
+
+func TestKafkaSink_Send(t *testing.T) {
+	p := &fakeProducer{}
+	ev := NewTaskInstanceEvent("src", &entity.TaskInstance{BaseInfo: entity.BaseInfo{ID: "t1"}, Status: entity.TaskInstanceStatusFailed})
+	assert.NoError(t, (&KafkaSink{Producer: p, Topic: "events"}).Send(context.Background(), ev))
+	assert.Equal(t, "events", p.topic)
+	assert.Equal(t, "task-instances/t1", string(p.key))
+	data := &TaskInstanceData{}
+	assert.NoError(t, json.Unmarshal(p.value, data))
+	assert.Equal(t, entity.TaskInstanceStatusFailed, data.Status)
+	assert.Equal(t, "io.fastflow.taskinstance.failed", p.headers["ce_type"])
+	assert.Equal(t, "application/json", p.headers["content-type"])
+}
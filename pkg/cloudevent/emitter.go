@@ -0,0 +1,162 @@
+package cloudevent
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/event"
+	"github.com/etherealiy/fastflow/pkg/log"
+	"github.com/shiningrush/goevent"
+)
+
+// Option
+type Option struct {
+	// Source is the "source" attribute of events, default is DefaultSource
+	Source string
+	Sinks  []Sink
+	// BufferSize is the size of queue, events will be dropped when it is full, default is 1000
+	BufferSize int
+	// SendTimeout is the timeout of each sending, default is 10s
+	SendTimeout time.Duration
+}
+
+// Emitter convert the state changes of dag and task instances to CloudEvents and send them to sinks.
+// Events are sent asynchronously, so it will not slow down the engine, the order is kept in one emitter.
+//
+//	emitter := cloudevent.NewEmitter(&cloudevent.Option{Sinks: []cloudevent.Sink{&cloudevent.HTTPSink{URL: brokerURL}}})
+//	if err := emitter.Start(); err != nil { ... }
+//	defer emitter.Close()
+type Emitter struct {
+	opt *Option
+
+	queue     chan *Event
+	closeCh   chan struct{}
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+
+	// dagStatus record the last emitted status, so the same status will not be emitted repeatedly
+	dagStatus     map[string]entity.DagInstanceStatus
+	dagStatusLock sync.Mutex
+}
+
+// NewEmitter
+func NewEmitter(opt *Option) *Emitter {
+	if opt.Source == "" {
+		opt.Source = DefaultSource
+	}
+	if opt.BufferSize == 0 {
+		opt.BufferSize = 1000
+	}
+	if opt.SendTimeout == 0 {
+		opt.SendTimeout = 10 * time.Second
+	}
+	return &Emitter{
+		opt:       opt,
+		queue:     make(chan *Event, opt.BufferSize),
+		closeCh:   make(chan struct{}),
+		dagStatus: map[string]entity.DagInstanceStatus{},
+	}
+}
+
+// Start subscribe the events of engine, you should call it before fastflow start
+func (e *Emitter) Start() error {
+	if err := goevent.Subscribe(e); err != nil {
+		return err
+	}
+	e.wg.Add(1)
+	go e.goSend()
+	return nil
+}
+
+// Close stop emitting and wait for the queued events sent
+func (e *Emitter) Close() {
+	e.closeOnce.Do(func() {
+		close(e.closeCh)
+		e.wg.Wait()
+	})
+}
+
+// Topic is goevent's topic
+func (e *Emitter) Topic() []string {
+	return []string{event.KeyDagInstancePatched, event.KeyDagInstanceUpdated, event.KeyTaskBegin, event.KeyTaskCompleted}
+}
+
+// Handle is goevent's handler
+func (e *Emitter) Handle(ctx context.Context, ev goevent.Event) {
+	switch v := ev.(type) {
+	case *event.DagInstancePatched:
+		e.emitDagIns(v.Payload)
+	case *event.DagInstanceUpdated:
+		e.emitDagIns(v.Payload)
+	case *event.TaskBegin:
+		taskIns := *v.TaskIns
+		taskIns.Status = entity.TaskInstanceStatusRunning
+		e.enqueue(NewTaskInstanceEvent(e.opt.Source, &taskIns))
+	case *event.TaskCompleted:
+		e.enqueue(NewTaskInstanceEvent(e.opt.Source, v.TaskIns))
+	}
+}
+
+func (e *Emitter) emitDagIns(dagIns *entity.DagInstance) {
+	if dagIns == nil || dagIns.Status == "" {
+		return
+	}
+	e.dagStatusLock.Lock()
+	if e.dagStatus[dagIns.ID] == dagIns.Status {
+		e.dagStatusLock.Unlock()
+		return
+	}
+	switch dagIns.Status {
+	case entity.DagInstanceStatusSuccess, entity.DagInstanceStatusFailed:
+		delete(e.dagStatus, dagIns.ID)
+	default:
+		e.dagStatus[dagIns.ID] = dagIns.Status
+	}
+	e.dagStatusLock.Unlock()
+	e.enqueue(NewDagInstanceEvent(e.opt.Source, dagIns))
+}
+
+func (e *Emitter) enqueue(ev *Event) {
+	select {
+	case <-e.closeCh:
+		return
+	default:
+	}
+	select {
+	case e.queue <- ev:
+	default:
+		log.Warnf("cloud event queue is full, drop event %s of %s", ev.Type, ev.Subject)
+	}
+}
+
+func (e *Emitter) goSend() {
+	defer e.wg.Done()
+	for {
+		select {
+		case ev := <-e.queue:
+			e.send(ev)
+		case <-e.closeCh:
+			// drain the queued events
+			for {
+				select {
+				case ev := <-e.queue:
+					e.send(ev)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (e *Emitter) send(ev *Event) {
+	for _, sink := range e.opt.Sinks {
+		ctx, cancel := context.WithTimeout(context.Background(), e.opt.SendTimeout)
+		if err := sink.Send(ctx, ev); err != nil {
+			log.Errorf("send cloud event %s of %s failed: %s", ev.Type, ev.Subject, err)
+		}
+		cancel()
+	}
+}
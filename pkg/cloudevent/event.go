@@ -0,0 +1,104 @@
+package cloudevent
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+)
+
+const (
+	// SpecVersion is the version of CloudEvents spec
+	SpecVersion = "1.0"
+	// DefaultSource is used when Option.Source is empty
+	DefaultSource = "fastflow"
+
+	typePrefixDagInstance  = "io.fastflow.daginstance."
+	typePrefixTaskInstance = "io.fastflow.taskinstance."
+	contentTypeJSON        = "application/json"
+)
+
+// Event is a CloudEvents in structured json format
+type Event struct {
+	SpecVersion     string      `json:"specversion"`
+	ID              string      `json:"id"`
+	Source          string      `json:"source"`
+	Type            string      `json:"type"`
+	Subject         string      `json:"subject,omitempty"`
+	Time            time.Time   `json:"time"`
+	DataContentType string      `json:"datacontenttype,omitempty"`
+	Data            interface{} `json:"data,omitempty"`
+}
+
+// DagInstanceData is the data of dag instance events
+type DagInstanceData struct {
+	DagInsID string                   `json:"dagInsId"`
+	DagID    string                   `json:"dagId,omitempty"`
+	Status   entity.DagInstanceStatus `json:"status"`
+	Reason   string                   `json:"reason,omitempty"`
+}
+
+// TaskInstanceData is the data of task instance events
+type TaskInstanceData struct {
+	TaskInsID  string                    `json:"taskInsId"`
+	TaskID     string                    `json:"taskId"`
+	DagInsID   string                    `json:"dagInsId"`
+	ActionName string                    `json:"actionName"`
+	Status     entity.TaskInstanceStatus `json:"status"`
+	Reason     string                    `json:"reason,omitempty"`
+}
+
+// DagInstanceType return the event type of dag instance status, such as "io.fastflow.daginstance.success"
+func DagInstanceType(status entity.DagInstanceStatus) string {
+	return typePrefixDagInstance + string(status)
+}
+
+// TaskInstanceType return the event type of task instance status, such as "io.fastflow.taskinstance.failed"
+func TaskInstanceType(status entity.TaskInstanceStatus) string {
+	return typePrefixTaskInstance + string(status)
+}
+
+// NewDagInstanceEvent
+func NewDagInstanceEvent(source string, dagIns *entity.DagInstance) *Event {
+	return newEvent(source, DagInstanceType(dagIns.Status), "dag-instances/"+dagIns.ID, &DagInstanceData{
+		DagInsID: dagIns.ID,
+		DagID:    dagIns.DagID,
+		Status:   dagIns.Status,
+		Reason:   dagIns.Reason,
+	})
+}
+
+// NewTaskInstanceEvent
+func NewTaskInstanceEvent(source string, taskIns *entity.TaskInstance) *Event {
+	return newEvent(source, TaskInstanceType(taskIns.Status), "task-instances/"+taskIns.ID, &TaskInstanceData{
+		TaskInsID:  taskIns.ID,
+		TaskID:     taskIns.TaskID,
+		DagInsID:   taskIns.DagInsID,
+		ActionName: taskIns.ActionName,
+		Status:     taskIns.Status,
+		Reason:     taskIns.Reason,
+	})
+}
+
+func newEvent(source, typ, subject string, data interface{}) *Event {
+	return &Event{
+		SpecVersion:     SpecVersion,
+		ID:              newID(),
+		Source:          source,
+		Type:            typ,
+		Subject:         subject,
+		Time:            time.Now().UTC(),
+		DataContentType: contentTypeJSON,
+		Data:            data,
+	}
+}
+
+func newID() string {
+	bs := make([]byte, 16)
+	if _, err := rand.Read(bs); err != nil {
+		return fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(bs)
+}
@@ -0,0 +1,110 @@
+package cloudevent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Sink deliver events to somewhere
+type Sink interface {
+	Send(ctx context.Context, e *Event) error
+}
+
+// HTTPSink post events to an endpoint such as knative broker
+type HTTPSink struct {
+	URL string
+	// Binary use binary content mode which puts attributes to "ce-" headers, default is structured mode
+	Binary bool
+	Header http.Header
+	// Client default is a client with 10s timeout
+	Client *http.Client
+}
+
+var defHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// Send
+func (s *HTTPSink) Send(ctx context.Context, e *Event) error {
+	var body interface{} = e
+	contentType := "application/cloudevents+json"
+	if s.Binary {
+		body = e.Data
+		contentType = e.DataContentType
+	}
+	bs, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("marshal event failed: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(bs))
+	if err != nil {
+		return err
+	}
+	for k, vs := range s.Header {
+		for _, v := range vs {
+			req.Header.Add(k, v)
+		}
+	}
+	req.Header.Set("Content-Type", contentType)
+	if s.Binary {
+		for k, v := range binaryAttributes(e) {
+			req.Header.Set("ce-"+k, v)
+		}
+	}
+
+	client := s.Client
+	if client == nil {
+		client = defHTTPClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("post event failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("post event failed, status code: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// KafkaProducer is the subset of kafka producer used by KafkaSink,
+// fastflow does not depend on any kafka client, so you need to adapt your client to it
+type KafkaProducer interface {
+	Produce(ctx context.Context, topic string, key, value []byte, headers map[string]string) error
+}
+
+// KafkaSink produce events to a kafka topic in binary content mode, the key is the subject of event,
+// so events of the same instance are in order
+type KafkaSink struct {
+	Producer KafkaProducer
+	Topic    string
+}
+
+// Send
+func (s *KafkaSink) Send(ctx context.Context, e *Event) error {
+	bs, err := json.Marshal(e.Data)
+	if err != nil {
+		return fmt.Errorf("marshal event data failed: %w", err)
+	}
+	headers := map[string]string{"content-type": e.DataContentType}
+	for k, v := range binaryAttributes(e) {
+		headers["ce_"+k] = v
+	}
+	return s.Producer.Produce(ctx, s.Topic, []byte(e.Subject), bs, headers)
+}
+
+func binaryAttributes(e *Event) map[string]string {
+	attrs := map[string]string{
+		"specversion": e.SpecVersion,
+		"id":          e.ID,
+		"source":      e.Source,
+		"type":        e.Type,
+		"time":        e.Time.Format(time.RFC3339Nano),
+	}
+	if e.Subject != "" {
+		attrs["subject"] = e.Subject
+	}
+	return attrs
+}
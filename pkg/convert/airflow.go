@@ -0,0 +1,269 @@
+package convert
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/etherealiy/fastflow/pkg/actions"
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"gopkg.in/yaml.v3"
+)
+
+// AirflowDag is the metadata of an airflow dag, it is compatible with the response of airflow REST API
+// "GET /dags/{dag_id}/details" which field "tasks" is the response of "GET /dags/{dag_id}/tasks".
+// Only a constrained subset is supported, the python source of dag is never parsed.
+type AirflowDag struct {
+	DagID            string                   `yaml:"dag_id" json:"dag_id"`
+	Description      string                   `yaml:"description" json:"description"`
+	ScheduleInterval *AirflowScheduleInterval `yaml:"schedule_interval" json:"schedule_interval"`
+	Params           map[string]interface{}   `yaml:"params" json:"params"`
+	Tasks            []AirflowTask            `yaml:"tasks" json:"tasks"`
+}
+
+// AirflowScheduleInterval is a cron expression or preset such as "@daily", time delta is not supported
+type AirflowScheduleInterval struct {
+	Type  string `yaml:"__type" json:"__type"`
+	Value string `yaml:"value" json:"value"`
+}
+
+// UnmarshalYAML support both plain string and object
+func (s *AirflowScheduleInterval) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		s.Type = "CronExpression"
+		return value.Decode(&s.Value)
+	}
+	type plain AirflowScheduleInterval
+	return value.Decode((*plain)(s))
+}
+
+// AirflowTask
+type AirflowTask struct {
+	TaskID            string            `yaml:"task_id" json:"task_id"`
+	OperatorName      string            `yaml:"operator_name" json:"operator_name"`
+	ClassRef          *AirflowClassRef  `yaml:"class_ref" json:"class_ref"`
+	DownstreamTaskIDs []string          `yaml:"downstream_task_ids" json:"downstream_task_ids"`
+	Retries           int               `yaml:"retries" json:"retries"`
+	ExecutionTimeout  *AirflowTimeDelta `yaml:"execution_timeout" json:"execution_timeout"`
+	// Args is the keyword arguments of operator, airflow REST API does not return it,
+	// so you need to add it by yourself if the operator need it
+	Args map[string]interface{} `yaml:"args" json:"args"`
+}
+
+// Operator return the class name of operator
+func (t *AirflowTask) Operator() string {
+	if t.ClassRef != nil && t.ClassRef.ClassName != "" {
+		return t.ClassRef.ClassName
+	}
+	return t.OperatorName
+}
+
+// AirflowClassRef
+type AirflowClassRef struct {
+	ModulePath string `yaml:"module_path" json:"module_path"`
+	ClassName  string `yaml:"class_name" json:"class_name"`
+}
+
+// AirflowTimeDelta
+type AirflowTimeDelta struct {
+	Days         int `yaml:"days" json:"days"`
+	Seconds      int `yaml:"seconds" json:"seconds"`
+	Microseconds int `yaml:"microseconds" json:"microseconds"`
+}
+
+// TotalSeconds
+func (d *AirflowTimeDelta) TotalSeconds() int {
+	return d.Days*24*3600 + d.Seconds
+}
+
+// OperatorConverter convert the operator of airflow task to fastflow action and params
+type OperatorConverter func(task *AirflowTask) (actionName string, params map[string]interface{}, err error)
+
+// AirflowOption
+type AirflowOption struct {
+	// Operators is used to convert operators besides built-in ones, the key is class name such as "BashOperator"
+	Operators map[string]OperatorConverter
+	// FallbackAction is used when operator is unknown, empty means reporting an error
+	FallbackAction string
+}
+
+// ConvertResult
+type ConvertResult struct {
+	Dag *entity.Dag
+	// Warnings contain the settings which are ignored when converting
+	Warnings []string
+}
+
+var airflowSchedulePresets = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+}
+
+var airflowBuiltinOperators = map[string]OperatorConverter{
+	"EmptyOperator": convertEmptyOperator,
+	"DummyOperator": convertEmptyOperator,
+	"TimeDeltaSensor": func(task *AirflowTask) (string, map[string]interface{}, error) {
+		secs, ok := task.Args["delta"].(int)
+		if !ok {
+			return "", nil, fmt.Errorf("arg delta of TimeDeltaSensor must be seconds in integer")
+		}
+		return actions.ActionKeyWait, map[string]interface{}{"waitingTime": fmt.Sprintf("%ds", secs)}, nil
+	},
+	"TriggerDagRunOperator": func(task *AirflowTask) (string, map[string]interface{}, error) {
+		dagID, ok := task.Args["trigger_dag_id"].(string)
+		if !ok || dagID == "" {
+			return "", nil, fmt.Errorf("arg trigger_dag_id of TriggerDagRunOperator cannot be empty")
+		}
+		params := map[string]interface{}{"dagId": dagID}
+		if wait, ok := task.Args["wait_for_completion"].(bool); ok {
+			params["wait"] = wait
+		}
+		return actions.ActionKeyTriggerDagRun, params, nil
+	},
+	"BashOperator": func(task *AirflowTask) (string, map[string]interface{}, error) {
+		cmd, ok := task.Args["bash_command"].(string)
+		if !ok || cmd == "" {
+			return "", nil, fmt.Errorf("arg bash_command of BashOperator cannot be empty")
+		}
+		params := map[string]interface{}{"command": cmd, "shell": "bash"}
+		if env, ok := task.Args["env"].(map[string]interface{}); ok {
+			params["env"] = env
+		}
+		if cwd, ok := task.Args["cwd"].(string); ok {
+			params["dir"] = cwd
+		}
+		return actions.ActionKeyShell, params, nil
+	},
+}
+
+func convertEmptyOperator(task *AirflowTask) (string, map[string]interface{}, error) {
+	return actions.ActionKeyWait, map[string]interface{}{"waitingTime": "0s"}, nil
+}
+
+// ParseAirflowDag parse airflow dag metadata from json or yaml
+func ParseAirflowDag(bs []byte) (*AirflowDag, error) {
+	dag := &AirflowDag{}
+	if err := yaml.Unmarshal(bs, dag); err != nil {
+		return nil, fmt.Errorf("unmarshal airflow dag failed: %w", err)
+	}
+	return dag, nil
+}
+
+// FromAirflow convert airflow dag to fastflow dag
+func FromAirflow(af *AirflowDag, opt *AirflowOption) (*ConvertResult, error) {
+	if opt == nil {
+		opt = &AirflowOption{}
+	}
+	if af.DagID == "" {
+		return nil, fmt.Errorf("dag_id cannot be empty")
+	}
+
+	ret := &ConvertResult{Dag: entity.NewDag()}
+	ret.Dag.ID = af.DagID
+	ret.Dag.Name = af.DagID
+	ret.Dag.Desc = af.Description
+	if err := convertAirflowSchedule(af.ScheduleInterval, ret); err != nil {
+		return nil, err
+	}
+	if len(af.Params) > 0 {
+		ret.Dag.Vars = entity.DagVars{}
+		for k, v := range af.Params {
+			ret.Dag.Vars[k] = entity.DagVar{DefaultValue: fmt.Sprint(v)}
+		}
+	}
+
+	upstream := map[string][]string{}
+	taskIDs := map[string]bool{}
+	for _, t := range af.Tasks {
+		if taskIDs[t.TaskID] {
+			return nil, fmt.Errorf("task id[%s] is duplicated", t.TaskID)
+		}
+		taskIDs[t.TaskID] = true
+		for _, down := range t.DownstreamTaskIDs {
+			upstream[down] = append(upstream[down], t.TaskID)
+		}
+	}
+
+	for i := range af.Tasks {
+		t := &af.Tasks[i]
+		if t.TaskID == "" {
+			return nil, fmt.Errorf("task_id cannot be empty")
+		}
+		for _, down := range t.DownstreamTaskIDs {
+			if !taskIDs[down] {
+				return nil, fmt.Errorf("downstream task[%s] of task[%s] does not exist", down, t.TaskID)
+			}
+		}
+
+		actionName, params, err := convertAirflowOperator(t, opt, ret)
+		if err != nil {
+			return nil, fmt.Errorf("convert task[%s] failed: %w", t.TaskID, err)
+		}
+		task := entity.Task{
+			ID:         t.TaskID,
+			Name:       t.TaskID,
+			ActionName: actionName,
+			Params:     params,
+			DependOn:   upstream[t.TaskID],
+		}
+		sort.Strings(task.DependOn)
+		if t.ExecutionTimeout != nil {
+			task.TimeoutSecs = t.ExecutionTimeout.TotalSeconds()
+		}
+		if t.Retries > 0 {
+			ret.Warnings = append(ret.Warnings,
+				fmt.Sprintf("task[%s]: retries(%d) is ignored, fastflow does not retry task automatically", t.TaskID, t.Retries))
+		}
+		ret.Dag.Tasks = append(ret.Dag.Tasks, task)
+	}
+	return ret, nil
+}
+
+func convertAirflowSchedule(s *AirflowScheduleInterval, ret *ConvertResult) error {
+	if s == nil {
+		return nil
+	}
+	switch s.Type {
+	case "CronExpression", "":
+		if s.Value == "" || s.Value == "@once" {
+			return nil
+		}
+		if cron, ok := airflowSchedulePresets[s.Value]; ok {
+			ret.Dag.Cron = cron
+			return nil
+		}
+		if strings.HasPrefix(s.Value, "@") {
+			return fmt.Errorf("schedule preset %s is not supported", s.Value)
+		}
+		ret.Dag.Cron = s.Value
+	default:
+		ret.Warnings = append(ret.Warnings, fmt.Sprintf("schedule interval of type %s is ignored, only cron is supported", s.Type))
+	}
+	return nil
+}
+
+func convertAirflowOperator(t *AirflowTask, opt *AirflowOption, ret *ConvertResult) (string, map[string]interface{}, error) {
+	op := t.Operator()
+	if conv, ok := opt.Operators[op]; ok {
+		return conv(t)
+	}
+	if conv, ok := airflowBuiltinOperators[op]; ok {
+		return conv(t)
+	}
+	if opt.FallbackAction == "" {
+		return "", nil, fmt.Errorf("operator %q is not supported", op)
+	}
+	ret.Warnings = append(ret.Warnings,
+		fmt.Sprintf("task[%s]: operator %q is converted to fallback action %s", t.TaskID, op, opt.FallbackAction))
+	return opt.FallbackAction, t.Args, nil
+}
+
+// MarshalDag marshal dag to yaml which can be read by fastflow
+func MarshalDag(dag *entity.Dag) ([]byte, error) {
+	return yaml.Marshal(dag)
+}
@@ -0,0 +1,140 @@
+package convert
+
+import (
+	"testing"
+
+	"github.com/etherealiy/fastflow/pkg/actions"
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFromAirflow(t *testing.T) {
+	tests := []struct {
+		caseDesc     string
+		giveMeta     string
+		giveOpt      *AirflowOption
+		wantDag      *entity.Dag
+		wantWarnings int
+		wantErr      bool
+	}{
+		{
+			caseDesc: "normal",
+			giveMeta: `{
+  "dag_id": "etl",
+  "description": "daily etl",
+  "schedule_interval": {"__type": "CronExpression", "value": "@daily"},
+  "params": {"region": "us"},
+  "tasks": [
+    {"task_id": "start", "class_ref": {"class_name": "EmptyOperator"}, "downstream_task_ids": ["wait", "trigger"]},
+    {"task_id": "wait", "operator_name": "TimeDeltaSensor", "args": {"delta": 60}, "downstream_task_ids": ["end"],
+     "execution_timeout": {"__type": "TimeDelta", "days": 0, "seconds": 120}},
+    {"task_id": "trigger", "operator_name": "TriggerDagRunOperator", "retries": 3,
+     "args": {"trigger_dag_id": "report", "wait_for_completion": true}, "downstream_task_ids": ["end"]},
+    {"task_id": "end", "operator_name": "DummyOperator"}
+  ]
+}`,
+			wantDag: &entity.Dag{
+				BaseInfo: entity.BaseInfo{ID: "etl"},
+				Name:     "etl",
+				Desc:     "daily etl",
+				Cron:     "0 0 * * *",
+				Status:   entity.DagStatusNormal,
+				Vars:     entity.DagVars{"region": {DefaultValue: "us"}},
+				Tasks: []entity.Task{
+					{ID: "start", Name: "start", ActionName: actions.ActionKeyWait, Params: map[string]interface{}{"waitingTime": "0s"}},
+					{ID: "wait", Name: "wait", ActionName: actions.ActionKeyWait, DependOn: []string{"start"}, TimeoutSecs: 120,
+						Params: map[string]interface{}{"waitingTime": "60s"}},
+					{ID: "trigger", Name: "trigger", ActionName: actions.ActionKeyTriggerDagRun, DependOn: []string{"start"},
+						Params: map[string]interface{}{"dagId": "report", "wait": true}},
+					{ID: "end", Name: "end", ActionName: actions.ActionKeyWait, DependOn: []string{"trigger", "wait"},
+						Params: map[string]interface{}{"waitingTime": "0s"}},
+				},
+			},
+			wantWarnings: 1,
+		},
+		{
+			caseDesc: "custom operator and fallback",
+			giveMeta: `
+dag_id: custom
+schedule_interval: "*/5 * * * *"
+tasks:
+  - task_id: bash
+    operator_name: BashOperator
+    args:
+      bash_command: echo hi
+    downstream_task_ids: [py]
+  - task_id: py
+    operator_name: PythonOperator
+`,
+			giveOpt: &AirflowOption{
+				Operators: map[string]OperatorConverter{
+					"BashOperator": func(task *AirflowTask) (string, map[string]interface{}, error) {
+						return "shell", map[string]interface{}{"command": task.Args["bash_command"]}, nil
+					},
+				},
+				FallbackAction: "noop",
+			},
+			wantDag: &entity.Dag{
+				BaseInfo: entity.BaseInfo{ID: "custom"},
+				Name:     "custom",
+				Cron:     "*/5 * * * *",
+				Status:   entity.DagStatusNormal,
+				Tasks: []entity.Task{
+					{ID: "bash", Name: "bash", ActionName: "shell", Params: map[string]interface{}{"command": "echo hi"}},
+					{ID: "py", Name: "py", ActionName: "noop", DependOn: []string{"bash"}},
+				},
+			},
+			wantWarnings: 1,
+		},
+		{
+			caseDesc: "bash operator",
+			giveMeta: `{"dag_id": "d", "tasks": [{"task_id": "bash", "operator_name": "BashOperator",
+  "args": {"bash_command": "./run.sh", "env": {"MODE": "full"}, "cwd": "/opt"}}]}`,
+			wantDag: &entity.Dag{
+				BaseInfo: entity.BaseInfo{ID: "d"},
+				Name:     "d",
+				Status:   entity.DagStatusNormal,
+				Tasks: []entity.Task{
+					{ID: "bash", Name: "bash", ActionName: actions.ActionKeyShell, Params: map[string]interface{}{
+						"command": "./run.sh", "shell": "bash", "env": map[string]interface{}{"MODE": "full"}, "dir": "/opt"}},
+				},
+			},
+			wantWarnings: 0,
+		},
+		{
+			caseDesc: "unsupported operator",
+			giveMeta: `{"dag_id": "d", "tasks": [{"task_id": "py", "operator_name": "PythonOperator"}]}`,
+			wantErr:  true,
+		},
+		{
+			caseDesc: "unknown downstream",
+			giveMeta: `{"dag_id": "d", "tasks": [{"task_id": "a", "operator_name": "EmptyOperator", "downstream_task_ids": ["b"]}]}`,
+			wantErr:  true,
+		},
+		{
+			caseDesc: "time delta schedule",
+			giveMeta: `{"dag_id": "d", "schedule_interval": {"__type": "TimeDelta", "days": 1}}`,
+			wantDag: &entity.Dag{
+				BaseInfo: entity.BaseInfo{ID: "d"},
+				Name:     "d",
+				Status:   entity.DagStatusNormal,
+			},
+			wantWarnings: 1,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			af, err := ParseAirflowDag([]byte(tc.giveMeta))
+			assert.NoError(t, err)
+			ret, err := FromAirflow(af, tc.giveOpt)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantDag, ret.Dag)
+			assert.Len(t, ret.Warnings, tc.wantWarnings)
+		})
+	}
+}
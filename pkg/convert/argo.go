@@ -0,0 +1,316 @@
+package convert
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// DefaultContainerAction is the action which container steps are mapped to
+	DefaultContainerAction = "ff-container"
+
+	argoAPIVersion   = "argoproj.io/v1alpha1"
+	argoKindWorkflow = "Workflow"
+	argoEntrypoint   = "main"
+	// argoDescAnnotation is the annotation which argo ui shows as description
+	argoDescAnnotation = "workflows.argoproj.io/description"
+)
+
+// ArgoWorkflow is the subset of argo Workflow or WorkflowTemplate
+type ArgoWorkflow struct {
+	APIVersion string           `yaml:"apiVersion" json:"apiVersion"`
+	Kind       string           `yaml:"kind" json:"kind"`
+	Metadata   ArgoMetadata     `yaml:"metadata" json:"metadata"`
+	Spec       ArgoWorkflowSpec `yaml:"spec" json:"spec"`
+}
+
+// ArgoMetadata
+type ArgoMetadata struct {
+	Name         string            `yaml:"name,omitempty" json:"name,omitempty"`
+	GenerateName string            `yaml:"generateName,omitempty" json:"generateName,omitempty"`
+	Annotations  map[string]string `yaml:"annotations,omitempty" json:"annotations,omitempty"`
+}
+
+// ArgoWorkflowSpec
+type ArgoWorkflowSpec struct {
+	Entrypoint string         `yaml:"entrypoint" json:"entrypoint"`
+	Arguments  ArgoArguments  `yaml:"arguments,omitempty" json:"arguments,omitempty"`
+	Templates  []ArgoTemplate `yaml:"templates" json:"templates"`
+}
+
+// ArgoArguments
+type ArgoArguments struct {
+	Parameters []ArgoParameter `yaml:"parameters,omitempty" json:"parameters,omitempty"`
+}
+
+// ArgoParameter
+type ArgoParameter struct {
+	Name        string `yaml:"name" json:"name"`
+	Value       string `yaml:"value,omitempty" json:"value,omitempty"`
+	Description string `yaml:"description,omitempty" json:"description,omitempty"`
+}
+
+// ArgoTemplate only supports dag and container template
+type ArgoTemplate struct {
+	Name                  string           `yaml:"name" json:"name"`
+	Inputs                *ArgoArguments   `yaml:"inputs,omitempty" json:"inputs,omitempty"`
+	DAG                   *ArgoDAGTemplate `yaml:"dag,omitempty" json:"dag,omitempty"`
+	Container             *ArgoContainer   `yaml:"container,omitempty" json:"container,omitempty"`
+	ActiveDeadlineSeconds int              `yaml:"activeDeadlineSeconds,omitempty" json:"activeDeadlineSeconds,omitempty"`
+}
+
+// ArgoDAGTemplate
+type ArgoDAGTemplate struct {
+	Tasks []ArgoDAGTask `yaml:"tasks" json:"tasks"`
+}
+
+// ArgoDAGTask
+type ArgoDAGTask struct {
+	Name         string        `yaml:"name" json:"name"`
+	Template     string        `yaml:"template" json:"template"`
+	Dependencies []string      `yaml:"dependencies,omitempty" json:"dependencies,omitempty"`
+	Arguments    ArgoArguments `yaml:"arguments,omitempty" json:"arguments,omitempty"`
+}
+
+// ArgoContainer
+type ArgoContainer struct {
+	Image   string       `yaml:"image" json:"image"`
+	Command []string     `yaml:"command,omitempty" json:"command,omitempty"`
+	Args    []string     `yaml:"args,omitempty" json:"args,omitempty"`
+	Env     []ArgoEnvVar `yaml:"env,omitempty" json:"env,omitempty"`
+}
+
+// ArgoEnvVar
+type ArgoEnvVar struct {
+	Name  string `yaml:"name" json:"name"`
+	Value string `yaml:"value,omitempty" json:"value,omitempty"`
+}
+
+// ArgoOption
+type ArgoOption struct {
+	// ContainerAction is the action of container steps, default is DefaultContainerAction
+	ContainerAction string
+}
+
+func (o *ArgoOption) containerAction() string {
+	if o == nil || o.ContainerAction == "" {
+		return DefaultContainerAction
+	}
+	return o.ContainerAction
+}
+
+var (
+	argoWorkflowParamRE = regexp.MustCompile(`{{\s*workflow\.parameters\.([\w.-]+)\s*}}`)
+	argoInputParamRE    = regexp.MustCompile(`{{\s*inputs\.parameters\.([\w.-]+)\s*}}`)
+	fastflowVarRE       = regexp.MustCompile(`{{\s*([\w.-]+)\s*}}`)
+)
+
+// ParseArgoWorkflow parse argo workflow from yaml
+func ParseArgoWorkflow(bs []byte) (*ArgoWorkflow, error) {
+	wf := &ArgoWorkflow{}
+	if err := yaml.Unmarshal(bs, wf); err != nil {
+		return nil, fmt.Errorf("unmarshal argo workflow failed: %w", err)
+	}
+	return wf, nil
+}
+
+// FromArgo convert the dag template of entrypoint to fastflow dag, each task must reference a container template
+func FromArgo(wf *ArgoWorkflow, opt *ArgoOption) (*ConvertResult, error) {
+	name := wf.Metadata.Name
+	if name == "" {
+		name = strings.TrimSuffix(wf.Metadata.GenerateName, "-")
+	}
+	if name == "" {
+		return nil, fmt.Errorf("metadata name cannot be empty")
+	}
+	templates := map[string]*ArgoTemplate{}
+	for i := range wf.Spec.Templates {
+		templates[wf.Spec.Templates[i].Name] = &wf.Spec.Templates[i]
+	}
+	entry, ok := templates[wf.Spec.Entrypoint]
+	if !ok {
+		return nil, fmt.Errorf("entrypoint template[%s] does not exist", wf.Spec.Entrypoint)
+	}
+	if entry.DAG == nil {
+		return nil, fmt.Errorf("entrypoint template[%s] must be a dag template", entry.Name)
+	}
+
+	ret := &ConvertResult{Dag: entity.NewDag()}
+	ret.Dag.ID = name
+	ret.Dag.Name = name
+	ret.Dag.Desc = wf.Metadata.Annotations[argoDescAnnotation]
+	if len(wf.Spec.Arguments.Parameters) > 0 {
+		ret.Dag.Vars = entity.DagVars{}
+		for _, p := range wf.Spec.Arguments.Parameters {
+			ret.Dag.Vars[p.Name] = entity.DagVar{Desc: p.Description, DefaultValue: p.Value}
+		}
+	}
+
+	for _, t := range entry.DAG.Tasks {
+		tpl, ok := templates[t.Template]
+		if !ok {
+			return nil, fmt.Errorf("template[%s] of task[%s] does not exist", t.Template, t.Name)
+		}
+		if tpl.Container == nil {
+			return nil, fmt.Errorf("template[%s] of task[%s] is not supported, only container template can be converted", t.Template, t.Name)
+		}
+
+		inputs := map[string]string{}
+		if tpl.Inputs != nil {
+			for _, p := range tpl.Inputs.Parameters {
+				inputs[p.Name] = p.Value
+			}
+		}
+		for _, p := range t.Arguments.Parameters {
+			inputs[p.Name] = p.Value
+		}
+		render := func(s string) string {
+			s = argoInputParamRE.ReplaceAllStringFunc(s, func(m string) string {
+				key := argoInputParamRE.FindStringSubmatch(m)[1]
+				if v, ok := inputs[key]; ok {
+					return v
+				}
+				ret.Warnings = append(ret.Warnings, fmt.Sprintf("task[%s]: input parameter %s is not provided", t.Name, key))
+				return m
+			})
+			return argoWorkflowParamRE.ReplaceAllString(s, "{{$1}}")
+		}
+
+		task := entity.Task{
+			ID:          t.Name,
+			Name:        t.Name,
+			ActionName:  opt.containerAction(),
+			DependOn:    t.Dependencies,
+			TimeoutSecs: tpl.ActiveDeadlineSeconds,
+			Params:      map[string]interface{}{"image": render(tpl.Container.Image)},
+		}
+		if len(tpl.Container.Command) > 0 {
+			task.Params["command"] = renderStrings(tpl.Container.Command, render)
+		}
+		if len(tpl.Container.Args) > 0 {
+			task.Params["args"] = renderStrings(tpl.Container.Args, render)
+		}
+		for _, e := range tpl.Container.Env {
+			task.Env = append(task.Env, entity.EnvVar{Name: e.Name, Value: render(e.Value)})
+		}
+		ret.Dag.Tasks = append(ret.Dag.Tasks, task)
+	}
+	return ret, nil
+}
+
+// ToArgo convert fastflow dag to argo workflow, all tasks must use the container action
+func ToArgo(dag *entity.Dag, opt *ArgoOption) (*ArgoWorkflow, error) {
+	wf := &ArgoWorkflow{
+		APIVersion: argoAPIVersion,
+		Kind:       argoKindWorkflow,
+		Metadata:   ArgoMetadata{Name: dag.ID},
+		Spec: ArgoWorkflowSpec{
+			Entrypoint: argoEntrypoint,
+		},
+	}
+	if dag.Desc != "" {
+		wf.Metadata.Annotations = map[string]string{argoDescAnnotation: dag.Desc}
+	}
+	var varNames []string
+	for k := range dag.Vars {
+		varNames = append(varNames, k)
+	}
+	sort.Strings(varNames)
+	for _, k := range varNames {
+		wf.Spec.Arguments.Parameters = append(wf.Spec.Arguments.Parameters, ArgoParameter{
+			Name:        k,
+			Value:       dag.Vars[k].DefaultValue,
+			Description: dag.Vars[k].Desc,
+		})
+	}
+
+	render := func(s string) string {
+		return fastflowVarRE.ReplaceAllString(s, "{{workflow.parameters.$1}}")
+	}
+	entry := ArgoTemplate{Name: argoEntrypoint, DAG: &ArgoDAGTemplate{}}
+	var templates []ArgoTemplate
+	for _, t := range dag.Tasks {
+		if t.ActionName != opt.containerAction() {
+			return nil, fmt.Errorf("action[%s] of task[%s] is not supported, only %s can be converted",
+				t.ActionName, t.ID, opt.containerAction())
+		}
+		image, ok := t.Params["image"].(string)
+		if !ok || image == "" {
+			return nil, fmt.Errorf("param image of task[%s] cannot be empty", t.ID)
+		}
+		command, err := paramStrings(t.Params, "command")
+		if err != nil {
+			return nil, fmt.Errorf("task[%s]: %w", t.ID, err)
+		}
+		args, err := paramStrings(t.Params, "args")
+		if err != nil {
+			return nil, fmt.Errorf("task[%s]: %w", t.ID, err)
+		}
+		container := &ArgoContainer{
+			Image:   render(image),
+			Command: renderStrings(command, render),
+			Args:    renderStrings(args, render),
+		}
+		for _, e := range t.Env {
+			if e.SecretRef != "" {
+				return nil, fmt.Errorf("env[%s] of task[%s] references secret which cannot be converted", e.Name, t.ID)
+			}
+			container.Env = append(container.Env, ArgoEnvVar{Name: e.Name, Value: render(e.Value)})
+		}
+
+		templates = append(templates, ArgoTemplate{
+			Name:                  t.ID,
+			Container:             container,
+			ActiveDeadlineSeconds: t.TimeoutSecs,
+		})
+		entry.DAG.Tasks = append(entry.DAG.Tasks, ArgoDAGTask{
+			Name:         t.ID,
+			Template:     t.ID,
+			Dependencies: t.DependOn,
+		})
+	}
+	wf.Spec.Templates = append([]ArgoTemplate{entry}, templates...)
+	return wf, nil
+}
+
+// MarshalArgoWorkflow
+func MarshalArgoWorkflow(wf *ArgoWorkflow) ([]byte, error) {
+	return yaml.Marshal(wf)
+}
+
+func renderStrings(strs []string, render func(string) string) []string {
+	if len(strs) == 0 {
+		return nil
+	}
+	ret := make([]string, 0, len(strs))
+	for _, s := range strs {
+		ret = append(ret, render(s))
+	}
+	return ret
+}
+
+func paramStrings(params map[string]interface{}, key string) ([]string, error) {
+	switch v := params[key].(type) {
+	case nil:
+		return nil, nil
+	case []string:
+		return v, nil
+	case []interface{}:
+		strs := make([]string, 0, len(v))
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("param %s must be a string list", key)
+			}
+			strs = append(strs, s)
+		}
+		return strs, nil
+	default:
+		return nil, fmt.Errorf("param %s must be a string list", key)
+	}
+}
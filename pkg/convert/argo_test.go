@@ -0,0 +1,170 @@
+package convert
+
+import (
+	"testing"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFromArgo(t *testing.T) {
+	tests := []struct {
+		caseDesc string
+		giveWf   string
+		wantDag  *entity.Dag
+		wantErr  bool
+	}{
+		{
+			caseDesc: "normal",
+			giveWf: `
+apiVersion: argoproj.io/v1alpha1
+kind: Workflow
+metadata:
+  generateName: hello-
+spec:
+  entrypoint: main
+  arguments:
+    parameters:
+      - name: who
+        value: world
+  templates:
+    - name: main
+      dag:
+        tasks:
+          - name: a
+            template: echo
+            arguments:
+              parameters:
+                - name: msg
+                  value: "hello {{workflow.parameters.who}}"
+          - name: b
+            template: echo
+            dependencies: [a]
+    - name: echo
+      activeDeadlineSeconds: 60
+      inputs:
+        parameters:
+          - name: msg
+            value: default
+      container:
+        image: alpine:3.7
+        command: [echo, "{{inputs.parameters.msg}}"]
+        env:
+          - name: WHO
+            value: "{{workflow.parameters.who}}"
+`,
+			wantDag: &entity.Dag{
+				BaseInfo: entity.BaseInfo{ID: "hello"},
+				Name:     "hello",
+				Status:   entity.DagStatusNormal,
+				Vars:     entity.DagVars{"who": {DefaultValue: "world"}},
+				Tasks: []entity.Task{
+					{
+						ID: "a", Name: "a", ActionName: DefaultContainerAction, TimeoutSecs: 60,
+						Params: map[string]interface{}{"image": "alpine:3.7", "command": []string{"echo", "hello {{who}}"}},
+						Env:    []entity.EnvVar{{Name: "WHO", Value: "{{who}}"}},
+					},
+					{
+						ID: "b", Name: "b", ActionName: DefaultContainerAction, TimeoutSecs: 60, DependOn: []string{"a"},
+						Params: map[string]interface{}{"image": "alpine:3.7", "command": []string{"echo", "default"}},
+						Env:    []entity.EnvVar{{Name: "WHO", Value: "{{who}}"}},
+					},
+				},
+			},
+		},
+		{
+			caseDesc: "entrypoint is not dag",
+			giveWf: `
+metadata: {name: steps}
+spec:
+  entrypoint: main
+  templates:
+    - name: main
+      container: {image: alpine}
+`,
+			wantErr: true,
+		},
+		{
+			caseDesc: "script template",
+			giveWf: `
+metadata: {name: script}
+spec:
+  entrypoint: main
+  templates:
+    - name: main
+      dag:
+        tasks:
+          - {name: a, template: py}
+    - name: py
+      script: {image: python, source: "print(1)"}
+`,
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			wf, err := ParseArgoWorkflow([]byte(tc.giveWf))
+			assert.NoError(t, err)
+			ret, err := FromArgo(wf, nil)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantDag, ret.Dag)
+		})
+	}
+}
+
+func TestToArgo(t *testing.T) {
+	dag := &entity.Dag{
+		BaseInfo: entity.BaseInfo{ID: "hello"},
+		Desc:     "say hello",
+		Vars:     entity.DagVars{"who": {DefaultValue: "world"}},
+		Tasks: []entity.Task{
+			{
+				ID: "a", ActionName: DefaultContainerAction, TimeoutSecs: 60,
+				Params: map[string]interface{}{"image": "alpine:3.7", "command": []interface{}{"echo", "hello {{who}}"}},
+				Env:    []entity.EnvVar{{Name: "WHO", Value: "{{who}}"}},
+			},
+			{
+				ID: "b", ActionName: DefaultContainerAction, DependOn: []string{"a"},
+				Params: map[string]interface{}{"image": "alpine:3.7"},
+			},
+		},
+	}
+
+	wf, err := ToArgo(dag, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, &ArgoWorkflow{
+		APIVersion: argoAPIVersion,
+		Kind:       argoKindWorkflow,
+		Metadata:   ArgoMetadata{Name: "hello", Annotations: map[string]string{argoDescAnnotation: "say hello"}},
+		Spec: ArgoWorkflowSpec{
+			Entrypoint: argoEntrypoint,
+			Arguments:  ArgoArguments{Parameters: []ArgoParameter{{Name: "who", Value: "world"}}},
+			Templates: []ArgoTemplate{
+				{Name: argoEntrypoint, DAG: &ArgoDAGTemplate{Tasks: []ArgoDAGTask{
+					{Name: "a", Template: "a"},
+					{Name: "b", Template: "b", Dependencies: []string{"a"}},
+				}}},
+				{Name: "a", ActiveDeadlineSeconds: 60, Container: &ArgoContainer{
+					Image:   "alpine:3.7",
+					Command: []string{"echo", "hello {{workflow.parameters.who}}"},
+					Env:     []ArgoEnvVar{{Name: "WHO", Value: "{{workflow.parameters.who}}"}},
+				}},
+				{Name: "b", Container: &ArgoContainer{Image: "alpine:3.7"}},
+			},
+		},
+	}, wf)
+
+	// round trip
+	ret, err := FromArgo(wf, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "say hello", ret.Dag.Desc)
+	assert.Equal(t, []string{"echo", "hello {{who}}"}, ret.Dag.Tasks[0].Params["command"])
+
+	_, err = ToArgo(&entity.Dag{Tasks: []entity.Task{{ID: "w", ActionName: "ff-waiting"}}}, nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,29 @@
+package dashboard
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+const (
+	// PathPrefix is the prefix of dashboard, it calls the management api at "../api/v1/",
+	// so it should be mounted beside api.PathPrefix
+	PathPrefix = "/ui/"
+)
+
+//go:embed static
+var static embed.FS
+
+// NewHandler serve the single page dashboard which renders the task tree of dag instances with live
+// statuses, operates the tasks and shows their logs by the management api
+//
+//	http.Handle(api.PathPrefix, api.NewHandler())
+//	http.Handle(dashboard.PathPrefix, dashboard.NewHandler())
+func NewHandler() http.Handler {
+	sub, err := fs.Sub(static, "static")
+	if err != nil {
+		panic(err)
+	}
+	return http.StripPrefix(PathPrefix, http.FileServer(http.FS(sub)))
+}
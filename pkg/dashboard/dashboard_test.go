@@ -0,0 +1,45 @@
+package dashboard
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewHandler(t *testing.T) {
+	tests := []struct {
+		caseDesc        string
+		givePath        string
+		wantCode        int
+		wantContentType string
+		wantBody        string
+	}{
+		{
+			caseDesc:        "index",
+			givePath:        PathPrefix,
+			wantCode:        http.StatusOK,
+			wantContentType: "text/html; charset=utf-8",
+			wantBody:        "dag-instances/",
+		},
+		{
+			caseDesc: "not found",
+			givePath: PathPrefix + "none.js",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	h := NewHandler()
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.givePath, nil))
+			assert.Equal(t, tc.wantCode, w.Code)
+			if tc.wantBody != "" {
+				assert.Equal(t, tc.wantContentType, w.Header().Get("Content-Type"))
+				assert.Contains(t, w.Body.String(), tc.wantBody)
+			}
+		})
+	}
+}
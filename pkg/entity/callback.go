@@ -0,0 +1,87 @@
+package entity
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ExternalCallback is the state of task instance which waits for an external system or approver to complete it,
+// only the hash of token is kept, the token is "{taskInsId}.{secret}"
+type ExternalCallback struct {
+	TokenHash string `json:"tokenHash,omitempty" bson:"tokenHash,omitempty"`
+	// Attempt is the count of attempts when the callback is created, the callback belongs to the next attempt only
+	Attempt int `json:"attempt" bson:"attempt"`
+	// ExpiresAt is the unix time after which the callback cannot be completed, zero means never
+	ExpiresAt int64 `json:"expiresAt,omitempty" bson:"expiresAt,omitempty"`
+
+	// Result is empty until the callback is completed, it is success or failed
+	Result      TaskInstanceStatus `json:"result,omitempty" bson:"result,omitempty"`
+	Reason      string             `json:"reason,omitempty" bson:"reason,omitempty"`
+	Operator    string             `json:"operator,omitempty" bson:"operator,omitempty"`
+	CompletedAt int64              `json:"completedAt,omitempty" bson:"completedAt,omitempty"`
+}
+
+// NewExternalCallback create the callback of task instance for its next attempt and return the token
+func NewExternalCallback(taskIns *TaskInstance, ttl time.Duration) (*ExternalCallback, string, error) {
+	bs := make([]byte, 24)
+	if _, err := rand.Read(bs); err != nil {
+		return nil, "", fmt.Errorf("generate callback token failed: %w", err)
+	}
+	secret := hex.EncodeToString(bs)
+	cb := &ExternalCallback{
+		TokenHash: hashCallbackSecret(secret),
+		Attempt:   len(taskIns.Attempts),
+	}
+	if ttl > 0 {
+		cb.ExpiresAt = time.Now().Add(ttl).Unix()
+	}
+	return cb, taskIns.ID + "." + secret, nil
+}
+
+// ParseCallbackToken return the task instance id of token
+func ParseCallbackToken(token string) (taskInsID string, ok bool) {
+	i := strings.LastIndex(token, ".")
+	if i <= 0 || i == len(token)-1 {
+		return "", false
+	}
+	return token[:i], true
+}
+
+// Verify check whether the token belongs to the callback
+func (c *ExternalCallback) Verify(token string) bool {
+	i := strings.LastIndex(token, ".")
+	if i < 0 {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(hashCallbackSecret(token[i+1:])), []byte(c.TokenHash)) == 1
+}
+
+// Expired return whether the callback cannot be completed at now
+func (c *ExternalCallback) Expired(now time.Time) bool {
+	return c.ExpiresAt > 0 && now.Unix() > c.ExpiresAt
+}
+
+// Complete record the result, it is only allowed once
+func (c *ExternalCallback) Complete(success bool, operator, reason string) error {
+	if c.Result != "" {
+		return fmt.Errorf("callback is already completed by %s", c.Operator)
+	}
+	c.Result = TaskInstanceStatusFailed
+	if success {
+		c.Result = TaskInstanceStatusSuccess
+	}
+	c.Operator = operator
+	c.Reason = reason
+	c.CompletedAt = time.Now().Unix()
+	return nil
+}
+
+func hashCallbackSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
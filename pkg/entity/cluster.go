@@ -0,0 +1,83 @@
+package entity
+
+import (
+	"fmt"
+)
+
+// ClusterConfig is the runtime config observed by all workers, it is used to tune scheduling without restarting.
+// Zero value of each field means using the option of startup.
+type ClusterConfig struct {
+	// WatchDogIntervalSecs is the interval of checking expired tasks and left-behind dag instances
+	WatchDogIntervalSecs int `json:"watchDogIntervalSecs,omitempty" bson:"watchDogIntervalSecs,omitempty"`
+	// DagScheduleTimeoutSecs is the threshold of scheduled dag instances which are not parsed by their worker
+	DagScheduleTimeoutSecs int `json:"dagScheduleTimeoutSecs,omitempty" bson:"dagScheduleTimeoutSecs,omitempty"`
+	// StallTimeoutSecs is the threshold of unresponsive workers, negative means disable it
+	StallTimeoutSecs int `json:"stallTimeoutSecs,omitempty" bson:"stallTimeoutSecs,omitempty"`
+	// OrphanTimeoutSecs is the threshold of running tasks whose worker is not alive, negative means disable it
+	OrphanTimeoutSecs int `json:"orphanTimeoutSecs,omitempty" bson:"orphanTimeoutSecs,omitempty"`
+	// DispatchIntervalSecs and DispatchBatchSize control how leader dispatches init dag instances
+	DispatchIntervalSecs int `json:"dispatchIntervalSecs,omitempty" bson:"dispatchIntervalSecs,omitempty"`
+	DispatchBatchSize    int `json:"dispatchBatchSize,omitempty" bson:"dispatchBatchSize,omitempty"`
+	// RebalanceMaxMoves negative means disable rebalancing
+	RebalanceMaxMoves int `json:"rebalanceMaxMoves,omitempty" bson:"rebalanceMaxMoves,omitempty"`
+	// ExecutorWorkerCnt is the concurrency of executor on each worker
+	ExecutorWorkerCnt int `json:"executorWorkerCnt,omitempty" bson:"executorWorkerCnt,omitempty"`
+	// PriorityAgingSecs is the waiting time which raises the effective priority of dag instance by 1
+	PriorityAgingSecs int `json:"priorityAgingSecs,omitempty" bson:"priorityAgingSecs,omitempty"`
+	// PromotedAt is the unix time when the standby cluster is promoted to active, the standby workers started
+	// before it leave standby mode when observing it
+	PromotedAt int64 `json:"promotedAt,omitempty" bson:"promotedAt,omitempty"`
+	UpdatedAt  int64 `json:"updatedAt,omitempty" bson:"updatedAt,omitempty"`
+}
+
+// Validate
+func (c *ClusterConfig) Validate() error {
+	fields := []struct {
+		name string
+		v    int
+	}{
+		{"watchDogIntervalSecs", c.WatchDogIntervalSecs},
+		{"dagScheduleTimeoutSecs", c.DagScheduleTimeoutSecs},
+		{"dispatchIntervalSecs", c.DispatchIntervalSecs},
+		{"dispatchBatchSize", c.DispatchBatchSize},
+		{"executorWorkerCnt", c.ExecutorWorkerCnt},
+		{"priorityAgingSecs", c.PriorityAgingSecs},
+	}
+	for _, f := range fields {
+		if f.v < 0 {
+			return fmt.Errorf("%s cannot be negative", f.name)
+		}
+	}
+	return nil
+}
+
+// WorkerInfo is the runtime info reported by each worker periodically
+type WorkerInfo struct {
+	Key       string            `json:"key" bson:"_id"`
+	Version   string            `json:"version,omitempty" bson:"version,omitempty"`
+	StartedAt int64             `json:"startedAt" bson:"startedAt"`
+	Labels    map[string]string `json:"labels,omitempty" bson:"labels,omitempty"`
+	// Capacity is the concurrency of executor
+	Capacity int `json:"capacity" bson:"capacity"`
+	// OwnedDagInsIDs is the running dag instances which are held by the parser of worker
+	OwnedDagInsIDs []string      `json:"ownedDagInsIds,omitempty" bson:"ownedDagInsIds,omitempty"`
+	RunningTasks   []RunningTask `json:"runningTasks,omitempty" bson:"runningTasks,omitempty"`
+	// ParserQueueLen is the count of task instances waiting for parsing
+	ParserQueueLen int `json:"parserQueueLen" bson:"parserQueueLen"`
+	// ExecutorQueueLen is the count of task instances waiting for an idle executor worker
+	ExecutorQueueLen int `json:"executorQueueLen" bson:"executorQueueLen"`
+	// PoolUsage is the count of running tasks in each resource pool
+	PoolUsage  map[string]int `json:"poolUsage,omitempty" bson:"poolUsage,omitempty"`
+	ReportedAt int64          `json:"reportedAt" bson:"reportedAt"`
+	// Alive is filled by keeper when listing, it is not persisted
+	Alive bool `json:"alive" bson:"-"`
+}
+
+// RunningTask
+type RunningTask struct {
+	TaskInsID string `json:"taskInsId" bson:"taskInsId"`
+	DagInsID  string `json:"dagInsId" bson:"dagInsId"`
+	TaskID    string `json:"taskId" bson:"taskId"`
+	StartedAt int64  `json:"startedAt" bson:"startedAt"`
+	ElapsedMs int64  `json:"elapsedMs" bson:"elapsedMs"`
+}
@@ -2,14 +2,20 @@ package entity
 
 import (
 	"context"
+	"os"
 	"testing"
 
 	"github.com/etherealiy/fastflow/store"
 	"github.com/stretchr/testify/assert"
 )
 
+func TestMain(m *testing.M) {
+	// the default machine id comes from private ip, which may be missing where tests run
+	store.InitFlakeGeneratorWithMachineID(100)
+	os.Exit(m.Run())
+}
+
 func TestBaseInfo_Initial(t *testing.T) {
-	store.InitFlakeGenerator(100)
 	bi := &BaseInfo{}
 	bi.Initial()
 	assert.NotEmpty(t, bi.ID)
@@ -3,11 +3,15 @@ package entity
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/etherealiy/fastflow/pkg/log"
 	"github.com/etherealiy/fastflow/pkg/utils"
+	"github.com/etherealiy/fastflow/pkg/utils/data"
 	"github.com/etherealiy/fastflow/pkg/utils/value"
 )
 
@@ -30,6 +34,183 @@ type Dag struct {
 	BntID           string    `yaml:"bntId,omitempty" json:"bntId,omitempty" bson:"bntId,omitempty"`
 	ResourceVersion string    `yaml:"resourceVersion,omitempty" json:"resourceVersion,omitempty" bson:"resourceVersion,omitempty"`
 	ValidVersionSeq uint64    `yaml:"validVersionSeq" json:"validVersionSeq" bson:"validVersionSeq"`
+	// RetryBudget is the max count of task retries in each run, the retries are rejected after it is exhausted,
+	// so a systemic outage does not turn into a lot of pointless retries. 0 means unlimited
+	RetryBudget int `yaml:"retryBudget,omitempty" json:"retryBudget,omitempty" bson:"retryBudget,omitempty"`
+	// TimeoutSecs is the max duration of each run, the dag instance fails and its remaining tasks are canceled
+	// when it is exceeded. 0 means no timeout
+	TimeoutSecs int `yaml:"timeoutSecs,omitempty" json:"timeoutSecs,omitempty" bson:"timeoutSecs,omitempty"`
+	// SLASecs is the expected duration of each run, the run is reported as SLA missed by leader when it is
+	// not finished in time, but it keeps running. 0 means no SLA, the tasks can declare their own SLAs too
+	SLASecs int `yaml:"slaSecs,omitempty" json:"slaSecs,omitempty" bson:"slaSecs,omitempty"`
+	// Priority decide which dag instances run first when workers are busy, the higher runs first. 0 is default
+	Priority int `yaml:"priority,omitempty" json:"priority,omitempty" bson:"priority,omitempty"`
+	// RerunPolicy rerun the recent failed runs against the new version when dag is updated, nil means disabled
+	RerunPolicy *RerunPolicy `yaml:"rerunPolicy,omitempty" json:"rerunPolicy,omitempty" bson:"rerunPolicy,omitempty"`
+	// TaskDefaults is inherited by all tasks when dag is applied, see "ApplyTaskDefaults"
+	TaskDefaults *TaskDefaults `yaml:"taskDefaults,omitempty" json:"taskDefaults,omitempty" bson:"taskDefaults,omitempty"`
+	// Template dag is only used to be extended by other dags, it cannot be run
+	Template bool `yaml:"template,omitempty" json:"template,omitempty" bson:"template,omitempty"`
+	// Extends is the id of base dag, its tasks, vars and settings are inherited when dag is applied, see "Inherit"
+	Extends string      `yaml:"extends,omitempty" json:"extends,omitempty" bson:"extends,omitempty"`
+	Remove  *DagRemoval `yaml:"remove,omitempty" json:"remove,omitempty" bson:"remove,omitempty"`
+	// Hooks is the tasks which run once when the dag instance is terminated, see "DagHooks"
+	Hooks *DagHooks `yaml:"hooks,omitempty" json:"hooks,omitempty" bson:"hooks,omitempty"`
+	// Notifications send messages when the dag instances fail, succeed, are blocked or miss SLAs
+	Notifications []Notification `yaml:"notifications,omitempty" json:"notifications,omitempty" bson:"notifications,omitempty"`
+}
+
+// TaskDefaults is the task settings which are shared by the tasks of dag
+type TaskDefaults struct {
+	TimeoutSecs int        `yaml:"timeoutSecs,omitempty" json:"timeoutSecs,omitempty" bson:"timeoutSecs,omitempty"`
+	PreChecks   PreChecks  `yaml:"preCheck,omitempty" json:"preCheck,omitempty" bson:"preCheck,omitempty"`
+	Env         []EnvVar   `yaml:"env,omitempty" json:"env,omitempty" bson:"env,omitempty"`
+	RateLimit   *RateLimit `yaml:"rateLimit,omitempty" json:"rateLimit,omitempty" bson:"rateLimit,omitempty"`
+}
+
+// ApplyTaskDefaults let each task inherit the task defaults, the settings of task override the defaults
+// and env are merged by name, see "Task.Inherit". It is idempotent.
+func (d *Dag) ApplyTaskDefaults() {
+	if d.TaskDefaults == nil {
+		return
+	}
+	base := Task{
+		TimeoutSecs: d.TaskDefaults.TimeoutSecs,
+		PreChecks:   d.TaskDefaults.PreChecks,
+		Env:         d.TaskDefaults.Env,
+		RateLimit:   d.TaskDefaults.RateLimit,
+	}
+	for i := range d.Tasks {
+		d.Tasks[i] = d.Tasks[i].Inherit(base)
+	}
+	if d.Hooks != nil {
+		d.Hooks.applyTaskDefaults(base)
+	}
+}
+
+// RerunPolicy
+type RerunPolicy struct {
+	// Limit is the max count of the most recent failed runs to rerun, default is 1
+	Limit int `yaml:"limit,omitempty" json:"limit,omitempty" bson:"limit,omitempty"`
+	// Within only rerun the failed runs which are created in the duration, such as "24h", empty means no limit
+	Within string `yaml:"within,omitempty" json:"within,omitempty" bson:"within,omitempty"`
+}
+
+// Validate
+func (p *RerunPolicy) Validate() error {
+	if p.Limit < 0 {
+		return fmt.Errorf("rerun limit cannot be negative")
+	}
+	if p.Within != "" {
+		if d, err := time.ParseDuration(p.Within); err != nil || d <= 0 {
+			return fmt.Errorf("rerun within %s is invalid", p.Within)
+		}
+	}
+	return nil
+}
+
+// DagRemoval is the tasks and vars which are inherited from base dag but removed
+type DagRemoval struct {
+	Tasks []string `yaml:"tasks,omitempty" json:"tasks,omitempty" bson:"tasks,omitempty"`
+	Vars  []string `yaml:"vars,omitempty" json:"vars,omitempty" bson:"vars,omitempty"`
+}
+
+// Inherit merge the base dag into current dag by these rules:
+//   - name, desc, cron, retry budget, rerun policy, task defaults and hooks are inherited when they are empty
+//   - vars are merged by key, the vars in current dag override the base ones
+//   - tasks are merged by id, the base order is kept and new tasks are appended, see "Task.Inherit"
+//   - the tasks and vars listed in "remove" are dropped, no task can depend on the removed tasks
+//
+// Status and template are never inherited. Inheriting a merged dag again is idempotent.
+func (d *Dag) Inherit(base *Dag) error {
+	removedTasks, removedVars := map[string]bool{}, map[string]bool{}
+	if d.Remove != nil {
+		for _, id := range d.Remove.Tasks {
+			removedTasks[id] = true
+		}
+		for _, key := range d.Remove.Vars {
+			removedVars[key] = true
+		}
+	}
+
+	if d.Name == "" {
+		d.Name = base.Name
+	}
+	if d.Desc == "" {
+		d.Desc = base.Desc
+	}
+	if d.Cron == "" {
+		d.Cron = base.Cron
+	}
+	if d.RetryBudget == 0 {
+		d.RetryBudget = base.RetryBudget
+	}
+	if d.TimeoutSecs == 0 {
+		d.TimeoutSecs = base.TimeoutSecs
+	}
+	if d.SLASecs == 0 {
+		d.SLASecs = base.SLASecs
+	}
+	if d.Priority == 0 {
+		d.Priority = base.Priority
+	}
+	if d.RerunPolicy == nil {
+		d.RerunPolicy = base.RerunPolicy
+	}
+	if d.TaskDefaults == nil {
+		d.TaskDefaults = base.TaskDefaults
+	}
+	if d.Hooks == nil {
+		d.Hooks = base.Hooks
+	}
+	if d.Notifications == nil {
+		d.Notifications = base.Notifications
+	}
+
+	vars := DagVars{}
+	for k, v := range base.Vars {
+		vars[k] = v
+	}
+	for k, v := range d.Vars {
+		vars[k] = v
+	}
+	for k := range removedVars {
+		delete(vars, k)
+	}
+	d.Vars = nil
+	if len(vars) > 0 {
+		d.Vars = vars
+	}
+
+	overrides := map[string]*Task{}
+	for i := range d.Tasks {
+		overrides[d.Tasks[i].ID] = &d.Tasks[i]
+	}
+	var tasks []Task
+	for _, t := range base.Tasks {
+		if removedTasks[t.ID] {
+			continue
+		}
+		if o, ok := overrides[t.ID]; ok {
+			t = o.Inherit(t)
+			delete(overrides, t.ID)
+		}
+		tasks = append(tasks, t)
+	}
+	for _, t := range d.Tasks {
+		if _, ok := overrides[t.ID]; ok && !removedTasks[t.ID] {
+			tasks = append(tasks, t)
+		}
+	}
+	for _, t := range tasks {
+		for _, dep := range t.DependOn {
+			if removedTasks[dep] {
+				return fmt.Errorf("task[%s] depends on removed task[%s]", t.ID, dep)
+			}
+		}
+	}
+	d.Tasks = tasks
+	return nil
 }
 
 // SpecifiedVar
@@ -43,33 +224,192 @@ func (d *Dag) Run(trigger Trigger, specVars map[string]string) (*DagInstance, er
 	if d.Status != DagStatusNormal {
 		return nil, fmt.Errorf("you cannot run a stopeed dag")
 	}
+	if d.Template {
+		return nil, fmt.Errorf("you cannot run a template dag")
+	}
 
-	dagInsVars := DagInstanceVars{}
-	for key, value := range d.Vars {
-		v := value.DefaultValue
-		if specVars != nil && specVars[key] != "" {
-			v = specVars[key]
-		}
-		dagInsVars[key] = DagInstanceVar{
-			Value: v,
-		}
+	dagInsVars, err := d.Vars.Resolve(specVars)
+	if err != nil {
+		return nil, err
 	}
 
+	selector, err := d.Selector()
+	if err != nil {
+		return nil, err
+	}
+	slas := d.SLAs(time.Now())
 	return &DagInstance{
-		DagID:     d.ID,
-		Trigger:   trigger,
-		Vars:      dagInsVars,
-		ShareData: &ShareData{},
-		Status:    DagInstanceStatusInit,
+		DagID:       d.ID,
+		Trigger:     trigger,
+		Vars:        dagInsVars,
+		ShareData:   &ShareData{},
+		Status:      DagInstanceStatusInit,
+		RetryBudget: d.RetryBudget,
+		TimeoutSecs: d.TimeoutSecs,
+		Priority:    d.Priority,
+		Selector:    selector,
+		SLAs:        slas,
+		SLADeadline: NextSLADeadline(slas, 0),
 	}, nil
 }
 
+// SLAs return the SLAs of dag and its tasks for the run created at now, they are sorted by deadline
+func (d *Dag) SLAs(now time.Time) []SLA {
+	var slas []SLA
+	if d.SLASecs > 0 {
+		slas = append(slas, SLA{Deadline: now.Unix() + int64(d.SLASecs)})
+	}
+	for _, t := range d.Tasks {
+		if t.SLASecs > 0 {
+			slas = append(slas, SLA{TaskID: t.ID, Deadline: now.Unix() + int64(t.SLASecs)})
+		}
+	}
+	sort.SliceStable(slas, func(i, j int) bool {
+		return slas[i].Deadline < slas[j].Deadline
+	})
+	return slas
+}
+
+// Selector merge the selectors of tasks and hook tasks, because all of them run on the same worker,
+// it fails when two tasks require different values of the same label
+func (d *Dag) Selector() (map[string]string, error) {
+	tasks := d.Tasks
+	for _, hook := range []DagHook{DagHookSuccess, DagHookFailure, DagHookCancel} {
+		tasks = append(tasks[:len(tasks):len(tasks)], d.Hooks.Tasks(hook)...)
+	}
+
+	var ret map[string]string
+	for _, t := range tasks {
+		for k, v := range t.Selector {
+			if ret == nil {
+				ret = map[string]string{}
+			}
+			old, ok := ret[k]
+			if ok && old != "" && v != "" && old != v {
+				return nil, fmt.Errorf("selector of task[%s] requires %s=%s, but other task requires %s=%s", t.ID, k, v, k, old)
+			}
+			if !ok || old == "" {
+				ret[k] = v
+			}
+		}
+	}
+	return ret, nil
+}
+
 type DagVars map[string]DagVar
 
+// Validate check the declaration of vars, the default values must match their types
+func (vs DagVars) Validate() error {
+	for _, name := range vs.sortedNames() {
+		v := vs[name]
+		switch v.Type {
+		case "", DagVarTypeString, DagVarTypeInt, DagVarTypeBool, DagVarTypeSecret:
+			if len(v.Enum) > 0 {
+				return fmt.Errorf("var[%s] is not enum but has enum values", name)
+			}
+		case DagVarTypeEnum:
+			if len(v.Enum) == 0 {
+				return fmt.Errorf("enum var[%s] has no enum values", name)
+			}
+		default:
+			return fmt.Errorf("type %q of var[%s] is invalid, it should be one of %s, %s, %s, %s or %s", v.Type, name,
+				DagVarTypeString, DagVarTypeInt, DagVarTypeBool, DagVarTypeEnum, DagVarTypeSecret)
+		}
+		if v.DefaultValue != "" {
+			if err := v.Check(v.DefaultValue); err != nil {
+				return fmt.Errorf("default value of var[%s] is invalid, %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Resolve merge the specified values into default values and check them, the specified empty value
+// means using the default value, and the vars which are not declared are ignored
+func (vs DagVars) Resolve(specVars map[string]string) (DagInstanceVars, error) {
+	ret := DagInstanceVars{}
+	for _, name := range vs.sortedNames() {
+		v := vs[name].DefaultValue
+		if specVars[name] != "" {
+			v = specVars[name]
+		}
+		if v == "" {
+			if vs[name].Required {
+				return nil, fmt.Errorf("var[%s] is required: %w", name, data.ErrDataInvalid)
+			}
+		} else if err := vs[name].Check(v); err != nil {
+			return nil, fmt.Errorf("var[%s] is invalid, %s: %w", name, err, data.ErrDataInvalid)
+		}
+		ret[name] = DagInstanceVar{
+			Value: v,
+		}
+	}
+	return ret, nil
+}
+
+// sortedNames make the error of the first invalid var stable
+func (vs DagVars) sortedNames() []string {
+	names := make([]string, 0, len(vs))
+	for name := range vs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DagVarType
+type DagVarType string
+
+const (
+	DagVarTypeString DagVarType = "string"
+	DagVarTypeInt    DagVarType = "int"
+	DagVarTypeBool   DagVarType = "bool"
+	DagVarTypeEnum   DagVarType = "enum"
+	// DagVarTypeSecret var must reference a secret like "secret://path#key" instead of plaintext, so the
+	// plaintext is not persisted, the reference is resolved when it is rendered into task params
+	DagVarTypeSecret DagVarType = "secret"
+)
+
+// SecretRefPrefix is the prefix of the value which references a secret, such as "secret://db/prod#password"
+const SecretRefPrefix = "secret://"
+
 // DagVar
 type DagVar struct {
 	Desc         string `yaml:"desc,omitempty" json:"desc,omitempty" bson:"desc,omitempty"`
 	DefaultValue string `yaml:"defaultValue,omitempty" json:"defaultValue,omitempty" bson:"defaultValue,omitempty"`
+	// Type default is string
+	Type DagVarType `yaml:"type,omitempty" json:"type,omitempty" bson:"type,omitempty"`
+	// Required var must be specified when running if it has no default value
+	Required bool `yaml:"required,omitempty" json:"required,omitempty" bson:"required,omitempty"`
+	// Enum is the allowed values of enum var
+	Enum []string `yaml:"enum,omitempty" json:"enum,omitempty" bson:"enum,omitempty"`
+}
+
+// Check return error if the value does not match the type of var
+func (v DagVar) Check(val string) error {
+	switch v.Type {
+	case DagVarTypeInt:
+		if _, err := strconv.ParseInt(val, 10, 64); err != nil {
+			return fmt.Errorf("%q is not an int", val)
+		}
+	case DagVarTypeBool:
+		if _, err := strconv.ParseBool(val); err != nil {
+			return fmt.Errorf("%q is not a bool", val)
+		}
+	case DagVarTypeEnum:
+		for _, e := range v.Enum {
+			if val == e {
+				return nil
+			}
+		}
+		return fmt.Errorf("%q is not one of %s", val, strings.Join(v.Enum, ", "))
+	case DagVarTypeSecret:
+		// the value is not printed, because it may be a plaintext secret
+		if !strings.HasPrefix(val, SecretRefPrefix) {
+			return fmt.Errorf("secret var should be a reference like \"%spath#key\"", SecretRefPrefix)
+		}
+	}
+	return nil
 }
 
 // DagInstanceVar
@@ -96,6 +436,226 @@ type DagInstance struct {
 	Status    DagInstanceStatus `json:"status,omitempty" bson:"status,omitempty"`
 	Reason    string            `json:"reason,omitempty" bson:"reason,omitempty"`
 	Cmd       *Command          `json:"cmd,omitempty" bson:"cmd,omitempty"`
+	// Notes and Annotations are attached by operators, they help to review what happened
+	Notes       []Note            `json:"notes,omitempty" bson:"notes,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty" bson:"annotations,omitempty"`
+	// TriggerMeta record how the dag instance was created, Labels are free-form and filterable
+	TriggerMeta *TriggerMeta      `json:"triggerMeta,omitempty" bson:"triggerMeta,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty" bson:"labels,omitempty"`
+	// IdempotencyKey is unique among the dag instances of the same dag, stores reject creating a duplicated
+	// one by data.ErrIdempotencyKeyConflicted, see mod.RunDagIdempotencyKey
+	IdempotencyKey string `json:"idempotencyKey,omitempty" bson:"idempotencyKey,omitempty"`
+	// ParentDagInsID is the dag instance which created it, such as sub-dag or "ff-trigger-dag-run" action,
+	// RootDagInsID is the top of the run tree, they are empty when it is a root
+	ParentDagInsID string `json:"parentDagInsId,omitempty" bson:"parentDagInsId,omitempty"`
+	RootDagInsID   string `json:"rootDagInsId,omitempty" bson:"rootDagInsId,omitempty"`
+	// LogicalDate is the date which the run is processing rather than when it runs,
+	// DataInterval is the range of data it should process, they are unix timestamps in seconds
+	LogicalDate       int64 `json:"logicalDate,omitempty" bson:"logicalDate,omitempty"`
+	DataIntervalStart int64 `json:"dataIntervalStart,omitempty" bson:"dataIntervalStart,omitempty"`
+	DataIntervalEnd   int64 `json:"dataIntervalEnd,omitempty" bson:"dataIntervalEnd,omitempty"`
+	// Summary is computed when dag instance completed, so it need not aggregate task instances when listing
+	Summary *DagInstanceSummary `json:"summary,omitempty" bson:"summary,omitempty"`
+	// RetryBudget is copied from dag when it runs, RetryCount is the count of task retries which are used
+	RetryBudget int `json:"retryBudget,omitempty" bson:"retryBudget,omitempty"`
+	RetryCount  int `json:"retryCount,omitempty" bson:"retryCount,omitempty"`
+	// TimeoutSecs is copied from dag when it runs, Deadline is the unix seconds when it times out,
+	// it is set when the dag instance starts or restarts after failed
+	TimeoutSecs int   `json:"timeoutSecs,omitempty" bson:"timeoutSecs,omitempty"`
+	Deadline    int64 `json:"deadline,omitempty" bson:"deadline,omitempty"`
+	// SLAs is copied from dag and its tasks when it runs, SLADeadline is the earliest deadline of them which is
+	// not checked yet, it is zero after all of them are checked. SLAMissedAt is when the first SLA is missed
+	SLAs        []SLA `json:"slas,omitempty" bson:"slas,omitempty"`
+	SLADeadline int64 `json:"slaDeadline,omitempty" bson:"slaDeadline,omitempty"`
+	SLAMissedAt int64 `json:"slaMissedAt,omitempty" bson:"slaMissedAt,omitempty"`
+	// Priority is copied from dag when it runs
+	Priority int `json:"priority,omitempty" bson:"priority,omitempty"`
+	// Selector is merged from the tasks of dag when it runs, dispatcher only dispatches it to the matched worker
+	Selector map[string]string `json:"selector,omitempty" bson:"selector,omitempty"`
+	// DeadLetter is set when the dag instance failed after its retry budget is exhausted,
+	// it needs human attention and can be requeued after the issue is fixed
+	DeadLetter *DeadLetter `json:"deadLetter,omitempty" bson:"deadLetter,omitempty"`
+	// Revision is increased by the stores which support optimistic locking, such as postgres store,
+	// updating a dag instance with a stale revision fails with data.ErrDataConflicted
+	Revision int64 `json:"revision,omitempty" bson:"revision,omitempty"`
+}
+
+// DeadLetter
+type DeadLetter struct {
+	Reason    string `json:"reason" bson:"reason"`
+	CreatedAt int64  `json:"createdAt" bson:"createdAt"`
+}
+
+// DagInstanceSummary
+type DagInstanceSummary struct {
+	StatusCounts map[TaskInstanceStatus]int `json:"statusCounts" bson:"statusCounts"`
+	// TotalDurationMs is from dag instance created to completed
+	TotalDurationMs int64 `json:"totalDurationMs" bson:"totalDurationMs"`
+	// CriticalPathDurationMs is the longest duration of dependency chains
+	CriticalPathDurationMs int64             `json:"criticalPathDurationMs" bson:"criticalPathDurationMs"`
+	FailedTasks            []FailedTaskBrief `json:"failedTasks,omitempty" bson:"failedTasks,omitempty"`
+	RetryCount             int               `json:"retryCount" bson:"retryCount"`
+}
+
+// FailedTaskBrief
+type FailedTaskBrief struct {
+	TaskID    string             `json:"taskId" bson:"taskId"`
+	TaskInsID string             `json:"taskInsId" bson:"taskInsId"`
+	Status    TaskInstanceStatus `json:"status" bson:"status"`
+	Reason    string             `json:"reason,omitempty" bson:"reason,omitempty"`
+}
+
+// NewDagInstanceSummary compute summary of dag instance by its task instances
+func NewDagInstanceSummary(dagIns *DagInstance, tasks []*TaskInstance, completedAt time.Time) *DagInstanceSummary {
+	summary := &DagInstanceSummary{
+		StatusCounts: map[TaskInstanceStatus]int{},
+	}
+	if dagIns.CreatedAt > 0 {
+		summary.TotalDurationMs = completedAt.Sub(time.Unix(dagIns.CreatedAt, 0)).Milliseconds()
+	}
+
+	durations := map[string]time.Duration{}
+	dependOn := map[string][]string{}
+	for _, t := range tasks {
+		summary.StatusCounts[t.Status]++
+		switch t.Status {
+		case TaskInstanceStatusFailed, TaskInstanceStatusInvalidParams, TaskInstanceStatusCanceled:
+			summary.FailedTasks = append(summary.FailedTasks, FailedTaskBrief{
+				TaskID:    t.TaskID,
+				TaskInsID: t.ID,
+				Status:    t.Status,
+				Reason:    t.Reason,
+			})
+		}
+		if len(t.Attempts) > 1 {
+			summary.RetryCount += len(t.Attempts) - 1
+		}
+		durations[t.TaskID] = t.Duration()
+		dependOn[t.TaskID] = t.DependOn
+	}
+
+	// longest path ending at each task, the dependencies are guaranteed acyclic by task tree
+	memo := map[string]time.Duration{}
+	var longest func(taskID string, depth int) time.Duration
+	longest = func(taskID string, depth int) time.Duration {
+		if d, ok := memo[taskID]; ok {
+			return d
+		}
+		var maxDep time.Duration
+		if depth <= len(tasks) {
+			for _, dep := range dependOn[taskID] {
+				if d := longest(dep, depth+1); d > maxDep {
+					maxDep = d
+				}
+			}
+		}
+		memo[taskID] = maxDep + durations[taskID]
+		return memo[taskID]
+	}
+	var critical time.Duration
+	for _, t := range tasks {
+		if d := longest(t.TaskID, 0); d > critical {
+			critical = d
+		}
+	}
+	summary.CriticalPathDurationMs = critical.Milliseconds()
+	return summary
+}
+
+// SetLogicalDate set logical date and data interval, the logical date is the start of interval when it is zero,
+// and the interval is [logicalDate, logicalDate] when it is not specified
+func (dagIns *DagInstance) SetLogicalDate(logicalDate, intervalStart, intervalEnd time.Time) error {
+	if !intervalStart.IsZero() && !intervalEnd.IsZero() && intervalEnd.Before(intervalStart) {
+		return fmt.Errorf("data interval end[%s] cannot be before start[%s]", intervalEnd, intervalStart)
+	}
+	if logicalDate.IsZero() {
+		logicalDate = intervalStart
+	}
+	if logicalDate.IsZero() {
+		logicalDate = time.Now()
+	}
+	if intervalStart.IsZero() {
+		intervalStart = logicalDate
+	}
+	if intervalEnd.IsZero() {
+		intervalEnd = logicalDate
+	}
+	dagIns.LogicalDate = logicalDate.Unix()
+	dagIns.DataIntervalStart = intervalStart.Unix()
+	dagIns.DataIntervalEnd = intervalEnd.Unix()
+	return nil
+}
+
+// LogicalTime
+func (dagIns *DagInstance) LogicalTime() time.Time {
+	return time.Unix(dagIns.LogicalDate, 0)
+}
+
+// DataInterval
+func (dagIns *DagInstance) DataInterval() (start, end time.Time) {
+	return time.Unix(dagIns.DataIntervalStart, 0), time.Unix(dagIns.DataIntervalEnd, 0)
+}
+
+// SetParent link dag instance to its parent
+func (dagIns *DagInstance) SetParent(parent *DagInstance) {
+	dagIns.ParentDagInsID = parent.ID
+	dagIns.RootDagInsID = parent.RootDagInsID
+	if dagIns.RootDagInsID == "" {
+		dagIns.RootDagInsID = parent.ID
+	}
+}
+
+// TriggerMeta is the structured metadata of trigger
+type TriggerMeta struct {
+	// Cron is the cron expression when triggered by cron
+	Cron string `json:"cron,omitempty" bson:"cron,omitempty"`
+	// User is who triggered it manually
+	User string `json:"user,omitempty" bson:"user,omitempty"`
+	// Source is the identity of external system, such as webhook source id or event source id
+	Source string `json:"source,omitempty" bson:"source,omitempty"`
+	// UpstreamDagInsID is the dag instance which triggered it
+	UpstreamDagInsID string `json:"upstreamDagInsId,omitempty" bson:"upstreamDagInsId,omitempty"`
+	// RerunDagInsID is the failed dag instance which is rerun
+	RerunDagInsID string `json:"rerunDagInsId,omitempty" bson:"rerunDagInsId,omitempty"`
+	// BackfillID is the backfill which created it
+	BackfillID string `json:"backfillId,omitempty" bson:"backfillId,omitempty"`
+}
+
+// SLA is the time by which the dag instance or its task should be finished
+type SLA struct {
+	// TaskID is empty for the SLA of dag
+	TaskID   string `json:"taskId,omitempty" bson:"taskId,omitempty"`
+	Deadline int64  `json:"deadline" bson:"deadline"`
+	// MissedAt is set when the SLA is found missed
+	MissedAt int64 `json:"missedAt,omitempty" bson:"missedAt,omitempty"`
+}
+
+// NextSLADeadline return the earliest deadline of SLAs which is after the time, 0 means none
+func NextSLADeadline(slas []SLA, after int64) int64 {
+	var next int64
+	for _, sla := range slas {
+		if sla.Deadline > after && (next == 0 || sla.Deadline < next) {
+			next = sla.Deadline
+		}
+	}
+	return next
+}
+
+// MatchLabels check if the dag instance has all the labels
+func (dagIns *DagInstance) MatchLabels(labels map[string]string) bool {
+	for k, v := range labels {
+		if val, ok := dagIns.Labels[k]; !ok || val != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Note is a free-text attached to dag instance, such as "retried after fixing credentials"
+type Note struct {
+	Content   string `json:"content" bson:"content"`
+	Author    string `json:"author,omitempty" bson:"author,omitempty"`
+	CreatedAt int64  `json:"createdAt" bson:"createdAt"`
 }
 
 var (
@@ -128,6 +688,10 @@ func (d *ShareData) UnmarshalBSON(data []byte) error {
 
 // MarshalJSON used by json
 func (d *ShareData) MarshalJSON() ([]byte, error) {
+	// keep it as object, otherwise "null" will be decoded to a nil ShareData
+	if d.Dict == nil {
+		return []byte("{}"), nil
+	}
 	return json.Marshal(d.Dict)
 }
 
@@ -141,7 +705,7 @@ func (d *ShareData) UnmarshalJSON(data []byte) error {
 
 // Get value from share data, it is thread-safe.
 func (d *ShareData) Get(key string) (string, bool) {
-	if d.Dict == nil {
+	if d == nil || d.Dict == nil {
 		return "", false
 	}
 	d.mutex.Lock()
@@ -151,6 +715,20 @@ func (d *ShareData) Get(key string) (string, bool) {
 	return v, ok
 }
 
+// Snapshot return a copy of share data, it is thread-safe.
+func (d *ShareData) Snapshot() map[string]string {
+	ret := map[string]string{}
+	if d == nil {
+		return ret
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	for k, v := range d.Dict {
+		ret[k] = v
+	}
+	return ret
+}
+
 // Set value to share data, it is thread-safe.
 func (d *ShareData) Set(key string, val string) {
 	d.mutex.Lock()
@@ -185,6 +763,33 @@ func (dagIns *DagInstance) Cancel(taskInsIds []string) error {
 	return nil
 }
 
+// AddNote append a note to dag instance
+func (dagIns *DagInstance) AddNote(content, author string) error {
+	if strings.TrimSpace(content) == "" {
+		return fmt.Errorf("note content cannot be empty")
+	}
+	dagIns.Notes = append(dagIns.Notes, Note{
+		Content:   content,
+		Author:    author,
+		CreatedAt: time.Now().Unix(),
+	})
+	return nil
+}
+
+// Annotate merge annotations to dag instance, the key with empty value will be removed
+func (dagIns *DagInstance) Annotate(annotations map[string]string) {
+	if dagIns.Annotations == nil {
+		dagIns.Annotations = map[string]string{}
+	}
+	for k, v := range annotations {
+		if v == "" {
+			delete(dagIns.Annotations, k)
+			continue
+		}
+		dagIns.Annotations[k] = v
+	}
+}
+
 var (
 	HookDagInstance DagInstanceLifecycleHook
 )
@@ -220,9 +825,26 @@ func (dagIns *DagInstance) VarsIterator() utils.KeyValueIterator {
 	}
 }
 
+// EffectivePriority is the priority raised by 1 for each aging duration since it was created,
+// so the low priority dag instances run eventually
+func (dagIns *DagInstance) EffectivePriority(now time.Time, aging time.Duration) int {
+	if aging <= 0 || dagIns.CreatedAt == 0 {
+		return dagIns.Priority
+	}
+	waited := now.Sub(time.Unix(dagIns.CreatedAt, 0))
+	if waited <= 0 {
+		return dagIns.Priority
+	}
+	return dagIns.Priority + int(waited/aging)
+}
+
 // Run the dag instance
 func (dagIns *DagInstance) Run() {
 	dagIns.executeHook(HookDagInstance.BeforeRun)
+	// the blocked dag instance is continued, so it keeps the deadline
+	if dagIns.TimeoutSecs > 0 && dagIns.Status != DagInstanceStatusRunning && dagIns.Status != DagInstanceStatusBlocked {
+		dagIns.Deadline = time.Now().Unix() + int64(dagIns.TimeoutSecs)
+	}
 	dagIns.Status = DagInstanceStatusRunning
 	dagIns.Reason = ""
 }
@@ -234,11 +856,25 @@ func (dagIns *DagInstance) Success() {
 	dagIns.Reason = ""
 }
 
-// Fail the dag instance
+// Fail the dag instance, it is moved to dead letter when the retry budget is exhausted
 func (dagIns *DagInstance) Fail(reason string) {
 	dagIns.Reason = reason
 	dagIns.executeHook(HookDagInstance.BeforeFail)
 	dagIns.Status = DagInstanceStatusFailed
+	if dagIns.RetryBudget > 0 && dagIns.RetryCount >= dagIns.RetryBudget {
+		dagIns.DeadLetter = &DeadLetter{Reason: reason, CreatedAt: time.Now().Unix()}
+	}
+}
+
+// Requeue take the dag instance out of dead letter and reset its retry budget,
+// the failed tasks should be retried after it
+func (dagIns *DagInstance) Requeue() error {
+	if dagIns.DeadLetter == nil {
+		return fmt.Errorf("dag instance is not in dead letter: %w", data.ErrDataConflicted)
+	}
+	dagIns.DeadLetter = nil
+	dagIns.RetryCount = 0
+	return nil
 }
 
 // Block the dag instance
@@ -247,9 +883,32 @@ func (dagIns *DagInstance) Block(reason string) {
 	dagIns.Status = DagInstanceStatusBlocked
 }
 
-// Retry tasks, it is just set a command, command will execute by Parser
+// Retry tasks, it is just set a command, command will execute by Parser.
+// Each task consumes one retry of the budget, the command is rejected when budget is not enough.
 func (dagIns *DagInstance) Retry(taskInsIds []string) error {
-	return dagIns.genCmd(taskInsIds, CommandNameRetry)
+	return dagIns.retry(taskInsIds, CommandNameRetry)
+}
+
+// RetryFromFailed retry the failed tasks of a failed dag instance and rerun their downstream tasks,
+// the succeeded upstream tasks are kept. It consumes the retry budget like Retry.
+func (dagIns *DagInstance) RetryFromFailed(taskInsIds []string) error {
+	if dagIns.Status != DagInstanceStatusFailed {
+		return fmt.Errorf("dag instance is %s, only the failed one can retry from failed tasks: %w",
+			dagIns.Status, data.ErrDataConflicted)
+	}
+	return dagIns.retry(taskInsIds, CommandNameRetryFromFailed)
+}
+
+func (dagIns *DagInstance) retry(taskInsIds []string, cmdName CommandName) error {
+	if dagIns.RetryBudget > 0 && dagIns.RetryCount+len(taskInsIds) > dagIns.RetryBudget {
+		return fmt.Errorf("retry budget is exhausted, %d of %d retries are used: %w",
+			dagIns.RetryCount, dagIns.RetryBudget, data.ErrDataConflicted)
+	}
+	if err := dagIns.genCmd(taskInsIds, cmdName); err != nil {
+		return err
+	}
+	dagIns.RetryCount += len(taskInsIds)
+	return nil
 }
 
 // Continue tasks, it is just set a command, command will execute by Parser
@@ -257,13 +916,27 @@ func (dagIns *DagInstance) Continue(taskInsIds []string) error {
 	return dagIns.genCmd(taskInsIds, CommandNameContinue)
 }
 
+// Skip the blocked or failed tasks manually, it is just set a command, command will execute by Parser.
+// The operator and reason are recorded in the skipped tasks.
+func (dagIns *DagInstance) Skip(taskInsIds []string, operator, reason string) error {
+	if operator == "" {
+		return fmt.Errorf("operator of skipping tasks cannot be empty")
+	}
+	if err := dagIns.genCmd(taskInsIds, CommandNameSkip); err != nil {
+		return err
+	}
+	dagIns.Cmd.Operator = operator
+	dagIns.Cmd.Reason = reason
+	return nil
+}
+
 func (dagIns *DagInstance) genCmd(taskInsIds []string, cmdName CommandName) error {
 	if dagIns.Cmd != nil {
 		return fmt.Errorf("dag instance have a incomplete command")
 	}
 
 	switch cmdName {
-	case CommandNameRetry:
+	case CommandNameRetry, CommandNameRetryFromFailed:
 		dagIns.executeHook(HookDagInstance.BeforeRetry)
 	case CommandNameContinue:
 		dagIns.executeHook(HookDagInstance.BeforeContinue)
@@ -299,10 +972,28 @@ func (vars DagInstanceVars) Render(p map[string]interface{}) (map[string]interfa
 	return p, err
 }
 
+// RenderEnv render value of env vars, it returns a new slice
+func (vars DagInstanceVars) RenderEnv(env []EnvVar) []EnvVar {
+	if env == nil {
+		return nil
+	}
+	ret := make([]EnvVar, len(env))
+	for i := range env {
+		ret[i] = env[i]
+		for varKey, varValue := range vars {
+			ret[i].Value = strings.ReplaceAll(ret[i].Value, fmt.Sprintf("{{%s}}", varKey), varValue.Value)
+		}
+	}
+	return ret
+}
+
 // Command
 type Command struct {
 	Name             CommandName
 	TargetTaskInsIDs []string
+	// Operator and Reason are recorded by the commands which need audit, such as skip
+	Operator string
+	Reason   string
 }
 
 // CommandName
@@ -312,6 +1003,13 @@ const (
 	CommandNameRetry    = "retry"
 	CommandNameCancel   = "cancel"
 	CommandNameContinue = "continue"
+	// CommandNameRetryFromFailed retry the target tasks and reset their downstream tasks to init
+	CommandNameRetryFromFailed = "retryFromFailed"
+	// CommandNameSkip mark the target tasks as skipped, so their downstream tasks can proceed
+	CommandNameSkip = "skip"
+	// CommandNameCancelDagIns fail the dag instance for Reason and cancel its unfinished tasks, it is handled by
+	// the owner worker, so the hooks and summary are handled like the dag instance is failed by its tasks
+	CommandNameCancelDagIns = "cancelDagIns"
 )
 
 // DagInstanceStatus
@@ -332,4 +1030,9 @@ type Trigger string
 const (
 	TriggerManually Trigger = "manually"
 	TriggerCron     Trigger = "cron"
+	TriggerWebhook  Trigger = "webhook"
+	TriggerUpstream Trigger = "upstream"
+	TriggerRerun    Trigger = "rerun"
+	TriggerEvent    Trigger = "event"
+	TriggerBackfill Trigger = "backfill"
 )
@@ -1,10 +1,15 @@
 package entity
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"testing"
+	"time"
 
+	"github.com/etherealiy/fastflow/pkg/utils/data"
 	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
 )
 
 func TestDagInstance_VarsIterator(t *testing.T) {
@@ -93,6 +98,77 @@ func TestDagInstance_Run(t *testing.T) {
 	})
 }
 
+func TestDagInstance_RunDeadline(t *testing.T) {
+	tests := []struct {
+		caseDesc     string
+		giveIns      *DagInstance
+		wantDeadline bool
+	}{
+		{
+			caseDesc: "no timeout",
+			giveIns:  &DagInstance{Status: DagInstanceStatusScheduled},
+		},
+		{
+			caseDesc:     "start",
+			giveIns:      &DagInstance{Status: DagInstanceStatusScheduled, TimeoutSecs: 10},
+			wantDeadline: true,
+		},
+		{
+			caseDesc:     "restart after failed",
+			giveIns:      &DagInstance{Status: DagInstanceStatusFailed, TimeoutSecs: 10, Deadline: 1},
+			wantDeadline: true,
+		},
+		{
+			caseDesc: "continue blocked",
+			giveIns:  &DagInstance{Status: DagInstanceStatusBlocked, TimeoutSecs: 10, Deadline: 1},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			old := tc.giveIns.Deadline
+			tc.giveIns.Run()
+			if tc.wantDeadline {
+				assert.InDelta(t, time.Now().Unix()+10, tc.giveIns.Deadline, 1)
+			} else {
+				assert.Equal(t, old, tc.giveIns.Deadline)
+			}
+		})
+	}
+}
+
+func TestDagInstance_EffectivePriority(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		caseDesc  string
+		giveIns   *DagInstance
+		giveAging time.Duration
+		want      int
+	}{
+		{
+			caseDesc:  "just created",
+			giveIns:   &DagInstance{BaseInfo: BaseInfo{CreatedAt: now.Unix()}, Priority: 1},
+			giveAging: time.Minute,
+			want:      1,
+		},
+		{
+			caseDesc:  "aged",
+			giveIns:   &DagInstance{BaseInfo: BaseInfo{CreatedAt: now.Add(-150 * time.Second).Unix()}, Priority: -1},
+			giveAging: time.Minute,
+			want:      1,
+		},
+		{
+			caseDesc: "aging disabled",
+			giveIns:  &DagInstance{BaseInfo: BaseInfo{CreatedAt: now.Add(-time.Hour).Unix()}, Priority: 1},
+			want:     1,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			assert.Equal(t, tc.want, tc.giveIns.EffectivePriority(now, tc.giveAging))
+		})
+	}
+}
+
 func TestDagInstance_Retry(t *testing.T) {
 	dagIns := &DagInstance{
 		Status: DagInstanceStatusFailed,
@@ -102,6 +178,139 @@ func TestDagInstance_Retry(t *testing.T) {
 	})
 }
 
+func TestDagInstance_Skip(t *testing.T) {
+	dagIns := &DagInstance{Status: DagInstanceStatusBlocked}
+	assert.Equal(t, fmt.Errorf("operator of skipping tasks cannot be empty"), dagIns.Skip([]string{"a"}, "", "flaky"))
+	assert.Nil(t, dagIns.Cmd)
+	assert.NoError(t, dagIns.Skip([]string{"a"}, "alice", "flaky"))
+	assert.Equal(t, &Command{Name: CommandNameSkip, TargetTaskInsIDs: []string{"a"}, Operator: "alice", Reason: "flaky"}, dagIns.Cmd)
+}
+
+func TestDagInstance_RetryFromFailed(t *testing.T) {
+	tests := []struct {
+		caseDesc   string
+		giveStatus DagInstanceStatus
+		giveBudget int
+		wantErr    error
+		wantCmd    *Command
+	}{
+		{
+			caseDesc:   "failed",
+			giveStatus: DagInstanceStatusFailed,
+			wantCmd:    &Command{Name: CommandNameRetryFromFailed, TargetTaskInsIDs: []string{"a", "b"}},
+		},
+		{
+			caseDesc:   "running",
+			giveStatus: DagInstanceStatusRunning,
+			wantErr: fmt.Errorf("dag instance is running, only the failed one can retry from failed tasks: %w",
+				data.ErrDataConflicted),
+		},
+		{
+			caseDesc:   "budget exhausted",
+			giveStatus: DagInstanceStatusFailed,
+			giveBudget: 1,
+			wantErr:    fmt.Errorf("retry budget is exhausted, 0 of 1 retries are used: %w", data.ErrDataConflicted),
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			dagIns := &DagInstance{Status: tc.giveStatus, RetryBudget: tc.giveBudget}
+			err := dagIns.RetryFromFailed([]string{"a", "b"})
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantCmd, dagIns.Cmd)
+		})
+	}
+}
+
+func TestDagInstance_RetryBudget(t *testing.T) {
+	tests := []struct {
+		caseDesc   string
+		giveBudget int
+		giveCount  int
+		giveIds    []string
+		wantErr    error
+		wantCount  int
+	}{
+		{
+			caseDesc:  "unlimited",
+			giveCount: 10,
+			giveIds:   []string{"a", "b"},
+			wantCount: 12,
+		},
+		{
+			caseDesc:   "within budget",
+			giveBudget: 3,
+			giveCount:  1,
+			giveIds:    []string{"a", "b"},
+			wantCount:  3,
+		},
+		{
+			caseDesc:   "exhausted",
+			giveBudget: 3,
+			giveCount:  2,
+			giveIds:    []string{"a", "b"},
+			wantErr:    fmt.Errorf("retry budget is exhausted, 2 of 3 retries are used: %w", data.ErrDataConflicted),
+			wantCount:  2,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			dagIns := &DagInstance{Status: DagInstanceStatusFailed, RetryBudget: tc.giveBudget, RetryCount: tc.giveCount}
+			err := dagIns.Retry(tc.giveIds)
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantCount, dagIns.RetryCount)
+			if tc.wantErr != nil {
+				assert.Nil(t, dagIns.Cmd)
+			}
+		})
+	}
+}
+
+func TestDagInstance_DeadLetter(t *testing.T) {
+	tests := []struct {
+		caseDesc       string
+		giveBudget     int
+		giveCount      int
+		wantDeadLetter bool
+	}{
+		{
+			caseDesc: "unlimited",
+		},
+		{
+			caseDesc:   "budget remains",
+			giveBudget: 2,
+			giveCount:  1,
+		},
+		{
+			caseDesc:       "budget exhausted",
+			giveBudget:     2,
+			giveCount:      2,
+			wantDeadLetter: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			dagIns := &DagInstance{Status: DagInstanceStatusRunning, RetryBudget: tc.giveBudget, RetryCount: tc.giveCount}
+			dagIns.Fail("task failed")
+			assert.Equal(t, DagInstanceStatusFailed, dagIns.Status)
+			if !tc.wantDeadLetter {
+				assert.Nil(t, dagIns.DeadLetter)
+				assert.EqualError(t, dagIns.Requeue(), "dag instance is not in dead letter: data conflicted")
+				return
+			}
+			if assert.NotNil(t, dagIns.DeadLetter) {
+				assert.Equal(t, "task failed", dagIns.DeadLetter.Reason)
+			}
+			assert.NoError(t, dagIns.Requeue())
+			assert.Nil(t, dagIns.DeadLetter)
+			assert.Equal(t, 0, dagIns.RetryCount)
+		})
+	}
+}
+
 func TestDagInstance_Block(t *testing.T) {
 	dagIns := &DagInstance{}
 	testHook(t, dagIns, string(DagInstanceStatusBlocked), DagInstanceStatusBlocked, func() {
@@ -217,6 +426,39 @@ func TestDagInstanceVars_Render(t *testing.T) {
 	}
 }
 
+func TestDagInstanceVars_RenderEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		giveVar DagInstanceVars
+		giveEnv []EnvVar
+		wantEnv []EnvVar
+	}{
+		{
+			name:    "nil",
+			giveVar: DagInstanceVars{"k": {Value: "v"}},
+		},
+		{
+			name:    "render value",
+			giveVar: DagInstanceVars{"region": {Value: "gz"}},
+			giveEnv: []EnvVar{
+				{Name: "REGION", Value: "ap-{{region}}"},
+				{Name: "TOKEN", SecretRef: "{{region}}"},
+			},
+			wantEnv: []EnvVar{
+				{Name: "REGION", Value: "ap-gz"},
+				{Name: "TOKEN", SecretRef: "{{region}}"},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ret := tc.giveVar.RenderEnv(tc.giveEnv)
+			assert.Equal(t, tc.wantEnv, ret)
+		})
+	}
+}
+
 func TestShareData_Get(t *testing.T) {
 	tests := []struct {
 		giveData *ShareData
@@ -279,3 +521,665 @@ func TestShareData_Set(t *testing.T) {
 		assert.Equal(t, tc.wantRet, tc.giveData.Dict)
 	}
 }
+
+func TestDagInstance_AddNote(t *testing.T) {
+	dagIns := &DagInstance{}
+	assert.Error(t, dagIns.AddNote("  ", "ops"))
+	assert.NoError(t, dagIns.AddNote("retried", "ops"))
+	assert.NoError(t, dagIns.AddNote("fixed", ""))
+	if assert.Len(t, dagIns.Notes, 2) {
+		assert.Equal(t, "retried", dagIns.Notes[0].Content)
+		assert.Equal(t, "ops", dagIns.Notes[0].Author)
+		assert.NotZero(t, dagIns.Notes[0].CreatedAt)
+		assert.Equal(t, "fixed", dagIns.Notes[1].Content)
+	}
+}
+
+func TestDagInstance_Annotate(t *testing.T) {
+	dagIns := &DagInstance{}
+	dagIns.Annotate(map[string]string{"ticket": "OPS-123", "owner": "ops"})
+	assert.Equal(t, map[string]string{"ticket": "OPS-123", "owner": "ops"}, dagIns.Annotations)
+	dagIns.Annotate(map[string]string{"ticket": "OPS-456", "owner": ""})
+	assert.Equal(t, map[string]string{"ticket": "OPS-456"}, dagIns.Annotations)
+}
+
+func TestDagInstance_SetParent(t *testing.T) {
+	root := &DagInstance{BaseInfo: BaseInfo{ID: "root"}}
+	child := &DagInstance{BaseInfo: BaseInfo{ID: "child"}}
+	child.SetParent(root)
+	assert.Equal(t, "root", child.ParentDagInsID)
+	assert.Equal(t, "root", child.RootDagInsID)
+
+	grandChild := &DagInstance{}
+	grandChild.SetParent(child)
+	assert.Equal(t, "child", grandChild.ParentDagInsID)
+	assert.Equal(t, "root", grandChild.RootDagInsID)
+}
+
+func TestDagInstance_SetLogicalDate(t *testing.T) {
+	tests := []struct {
+		name              string
+		giveLogicalDate   time.Time
+		giveIntervalStart time.Time
+		giveIntervalEnd   time.Time
+		wantLogicalDate   int64
+		wantIntervalStart int64
+		wantIntervalEnd   int64
+		wantErr           bool
+	}{
+		{
+			name:              "logical date",
+			giveLogicalDate:   time.Unix(100, 0),
+			wantLogicalDate:   100,
+			wantIntervalStart: 100,
+			wantIntervalEnd:   100,
+		},
+		{
+			name:              "data interval",
+			giveIntervalStart: time.Unix(100, 0),
+			giveIntervalEnd:   time.Unix(200, 0),
+			wantLogicalDate:   100,
+			wantIntervalStart: 100,
+			wantIntervalEnd:   200,
+		},
+		{
+			name:              "both",
+			giveLogicalDate:   time.Unix(300, 0),
+			giveIntervalStart: time.Unix(100, 0),
+			giveIntervalEnd:   time.Unix(200, 0),
+			wantLogicalDate:   300,
+			wantIntervalStart: 100,
+			wantIntervalEnd:   200,
+		},
+		{
+			name:              "invalid interval",
+			giveIntervalStart: time.Unix(200, 0),
+			giveIntervalEnd:   time.Unix(100, 0),
+			wantErr:           true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			dagIns := &DagInstance{}
+			err := dagIns.SetLogicalDate(tc.giveLogicalDate, tc.giveIntervalStart, tc.giveIntervalEnd)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantLogicalDate, dagIns.LogicalDate)
+			assert.Equal(t, tc.wantIntervalStart, dagIns.DataIntervalStart)
+			assert.Equal(t, tc.wantIntervalEnd, dagIns.DataIntervalEnd)
+			assert.Equal(t, time.Unix(tc.wantLogicalDate, 0), dagIns.LogicalTime())
+		})
+	}
+}
+
+func TestShareData_Snapshot(t *testing.T) {
+	var nilData *ShareData
+	assert.Equal(t, map[string]string{}, nilData.Snapshot())
+
+	d := &ShareData{Dict: map[string]string{"a": "1"}}
+	snapshot := d.Snapshot()
+	d.Set("a", "2")
+	assert.Equal(t, map[string]string{"a": "1"}, snapshot)
+	assert.Equal(t, map[string]string{"a": "2"}, d.Snapshot())
+}
+
+func TestNewDagInstanceSummary(t *testing.T) {
+	dagIns := &DagInstance{BaseInfo: BaseInfo{ID: "dag-ins", CreatedAt: 100}}
+	tasks := []*TaskInstance{
+		{BaseInfo: BaseInfo{ID: "ins1"}, TaskID: "t1", Status: TaskInstanceStatusSuccess, TimeUsed: "2.000s"},
+		{BaseInfo: BaseInfo{ID: "ins2"}, TaskID: "t2", DependOn: []string{"t1"}, Status: TaskInstanceStatusSuccess, TimeUsed: "1.500s"},
+		{
+			BaseInfo: BaseInfo{ID: "ins3"}, TaskID: "t3", DependOn: []string{"t1"}, Status: TaskInstanceStatusFailed, Reason: "timeout",
+			Attempts: []TaskAttempt{
+				{Attempt: 1, StartedAt: 10, EndedAt: 11},
+				{Attempt: 2, StartedAt: 20, EndedAt: 25},
+			},
+		},
+		{BaseInfo: BaseInfo{ID: "ins4"}, TaskID: "t4", DependOn: []string{"t2", "t3"}, Status: TaskInstanceStatusCanceled},
+	}
+
+	summary := NewDagInstanceSummary(dagIns, tasks, time.Unix(110, 0))
+	assert.Equal(t, map[TaskInstanceStatus]int{
+		TaskInstanceStatusSuccess:  2,
+		TaskInstanceStatusFailed:   1,
+		TaskInstanceStatusCanceled: 1,
+	}, summary.StatusCounts)
+	assert.Equal(t, int64(10000), summary.TotalDurationMs)
+	assert.Equal(t, int64(7000), summary.CriticalPathDurationMs)
+	assert.Equal(t, 1, summary.RetryCount)
+	assert.Equal(t, []FailedTaskBrief{
+		{TaskID: "t3", TaskInsID: "ins3", Status: TaskInstanceStatusFailed, Reason: "timeout"},
+		{TaskID: "t4", TaskInsID: "ins4", Status: TaskInstanceStatusCanceled},
+	}, summary.FailedTasks)
+}
+
+func TestDag_ApplyTaskDefaults(t *testing.T) {
+	limit := &RateLimit{Key: "vendor", Rate: "10/s"}
+	dag := &Dag{
+		TaskDefaults: &TaskDefaults{
+			TimeoutSecs: 60,
+			Env:         []EnvVar{{Name: "REGION", Value: "us"}, {Name: "LEVEL", Value: "info"}},
+			RateLimit:   limit,
+		},
+		Tasks: []Task{
+			{ID: "t1", ActionName: "act"},
+			{ID: "t2", ActionName: "act", TimeoutSecs: 10, Env: []EnvVar{{Name: "LEVEL", Value: "debug"}}},
+		},
+	}
+	want := []Task{
+		{ID: "t1", ActionName: "act", TimeoutSecs: 60,
+			Env: []EnvVar{{Name: "REGION", Value: "us"}, {Name: "LEVEL", Value: "info"}}, RateLimit: limit},
+		{ID: "t2", ActionName: "act", TimeoutSecs: 10,
+			Env: []EnvVar{{Name: "REGION", Value: "us"}, {Name: "LEVEL", Value: "debug"}}, RateLimit: limit},
+	}
+
+	dag.ApplyTaskDefaults()
+	assert.Equal(t, want, dag.Tasks)
+	dag.ApplyTaskDefaults()
+	assert.Equal(t, want, dag.Tasks, "it should be idempotent")
+}
+
+func TestDag_Inherit(t *testing.T) {
+	base := &Dag{
+		Name:     "base",
+		Desc:     "desc",
+		Cron:     "0 * * * *",
+		Template: true,
+		Vars:     DagVars{"region": {DefaultValue: "cn"}, "customer": {DefaultValue: "none"}},
+		Tasks: []Task{
+			{ID: "t1", ActionName: "fetch", Params: map[string]interface{}{"a": 1, "b": 2}},
+			{ID: "t2", ActionName: "transform", DependOn: []string{"t1"}},
+			{ID: "t3", ActionName: "load", DependOn: []string{"t2"}, Env: []EnvVar{{Name: "E1", Value: "1"}, {Name: "E2", Value: "2"}}},
+		},
+	}
+	tests := []struct {
+		caseDesc string
+		giveDag  *Dag
+		wantDag  *Dag
+		wantErr  string
+	}{
+		{
+			caseDesc: "override and append",
+			giveDag: &Dag{
+				Name: "child",
+				Vars: DagVars{"customer": {DefaultValue: "acme"}},
+				Tasks: []Task{
+					{ID: "t4", ActionName: "notify", DependOn: []string{"t3"}},
+					{ID: "t1", Params: map[string]interface{}{"b": 3}},
+					{ID: "t3", Env: []EnvVar{{Name: "E1", Value: "3"}}},
+				},
+			},
+			wantDag: &Dag{
+				Name: "child",
+				Desc: "desc",
+				Cron: "0 * * * *",
+				Vars: DagVars{"region": {DefaultValue: "cn"}, "customer": {DefaultValue: "acme"}},
+				Tasks: []Task{
+					{ID: "t1", ActionName: "fetch", Params: map[string]interface{}{"a": 1, "b": 3}},
+					{ID: "t2", ActionName: "transform", DependOn: []string{"t1"}},
+					{ID: "t3", ActionName: "load", DependOn: []string{"t2"}, Env: []EnvVar{{Name: "E2", Value: "2"}, {Name: "E1", Value: "3"}}},
+					{ID: "t4", ActionName: "notify", DependOn: []string{"t3"}},
+				},
+			},
+		},
+		{
+			caseDesc: "remove",
+			giveDag: &Dag{
+				Remove: &DagRemoval{Tasks: []string{"t3"}, Vars: []string{"region"}},
+			},
+			wantDag: &Dag{
+				Name:   "base",
+				Desc:   "desc",
+				Cron:   "0 * * * *",
+				Vars:   DagVars{"customer": {DefaultValue: "none"}},
+				Remove: &DagRemoval{Tasks: []string{"t3"}, Vars: []string{"region"}},
+				Tasks: []Task{
+					{ID: "t1", ActionName: "fetch", Params: map[string]interface{}{"a": 1, "b": 2}},
+					{ID: "t2", ActionName: "transform", DependOn: []string{"t1"}},
+				},
+			},
+		},
+		{
+			caseDesc: "depend on removed task",
+			giveDag: &Dag{
+				Remove: &DagRemoval{Tasks: []string{"t2"}},
+			},
+			wantErr: "task[t3] depends on removed task[t2]",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			err := tc.giveDag.Inherit(base)
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantDag, tc.giveDag)
+
+			// inheriting again changes nothing
+			assert.NoError(t, tc.giveDag.Inherit(base))
+			assert.Equal(t, tc.wantDag, tc.giveDag)
+		})
+	}
+}
+
+func TestDag_ExpandMatrix(t *testing.T) {
+	tests := []struct {
+		caseDesc  string
+		giveTasks []Task
+		wantTasks []Task
+		wantErr   string
+	}{
+		{
+			caseDesc: "expand with join",
+			giveTasks: []Task{
+				{ID: "prepare", ActionName: "act"},
+				{
+					ID:         "sync-{{region}}-{{shard}}",
+					ActionName: "sync",
+					DependOn:   []string{"prepare"},
+					Params:     map[string]interface{}{"target": "{{region}}/{{shard}}", "keep": 1},
+					Matrix:     TaskMatrix{"region": {"us", "eu"}, "shard": {"0..1"}},
+					Join:       &Task{ID: "sync-done", ActionName: "merge"},
+				},
+				{ID: "report", ActionName: "act", DependOn: []string{"sync-{{region}}-{{shard}}"}},
+			},
+			wantTasks: []Task{
+				{ID: "prepare", ActionName: "act"},
+				{ID: "sync-us-0", ActionName: "sync", DependOn: []string{"prepare"}, Params: map[string]interface{}{"target": "us/0", "keep": 1}},
+				{ID: "sync-us-1", ActionName: "sync", DependOn: []string{"prepare"}, Params: map[string]interface{}{"target": "us/1", "keep": 1}},
+				{ID: "sync-eu-0", ActionName: "sync", DependOn: []string{"prepare"}, Params: map[string]interface{}{"target": "eu/0", "keep": 1}},
+				{ID: "sync-eu-1", ActionName: "sync", DependOn: []string{"prepare"}, Params: map[string]interface{}{"target": "eu/1", "keep": 1}},
+				{ID: "sync-done", ActionName: "merge", DependOn: []string{"sync-us-0", "sync-us-1", "sync-eu-0", "sync-eu-1"}},
+				{ID: "report", ActionName: "act", DependOn: []string{"sync-done"}},
+			},
+		},
+		{
+			caseDesc: "expand without join",
+			giveTasks: []Task{
+				{ID: "fetch", ActionName: "act", Matrix: TaskMatrix{"region": {"us", "eu"}}},
+				{ID: "load-{{region}}", ActionName: "act", DependOn: []string{"fetch-{{region}}"}, Matrix: TaskMatrix{"region": {"us", "eu"}}},
+				{ID: "report", ActionName: "act", DependOn: []string{"fetch"}},
+			},
+			wantTasks: []Task{
+				{ID: "fetch-us", ActionName: "act"},
+				{ID: "fetch-eu", ActionName: "act"},
+				{ID: "load-us", ActionName: "act", DependOn: []string{"fetch-us"}},
+				{ID: "load-eu", ActionName: "act", DependOn: []string{"fetch-eu"}},
+				{ID: "report", ActionName: "act", DependOn: []string{"fetch-us", "fetch-eu"}},
+			},
+		},
+		{
+			caseDesc: "default join id",
+			giveTasks: []Task{
+				{ID: "sync", ActionName: "act", Matrix: TaskMatrix{"shard": {0, 1}}, Join: &Task{ActionName: "merge"}},
+			},
+			wantTasks: []Task{
+				{ID: "sync-0", ActionName: "act"},
+				{ID: "sync-1", ActionName: "act"},
+				{ID: "sync-join", ActionName: "merge", DependOn: []string{"sync-0", "sync-1"}},
+			},
+		},
+		{
+			caseDesc:  "invalid range",
+			giveTasks: []Task{{ID: "t1", Matrix: TaskMatrix{"shard": {"9..0"}}}},
+			wantErr:   "expand matrix of task[t1] failed: matrix key[shard] is invalid: range 9..0 is invalid",
+		},
+		{
+			caseDesc: "duplicated",
+			giveTasks: []Task{
+				{ID: "t1-a"},
+				{ID: "t1", Matrix: TaskMatrix{"k": {"a"}}},
+			},
+			wantErr: "task[t1-a] is duplicated after matrix expanded",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			dag := &Dag{Tasks: tc.giveTasks}
+			err := dag.ExpandMatrix()
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantTasks, dag.Tasks)
+		})
+	}
+}
+
+func TestDagHooks_Validate(t *testing.T) {
+	tests := []struct {
+		caseDesc  string
+		giveHooks *DagHooks
+		wantErr   string
+	}{
+		{
+			caseDesc: "normal",
+			giveHooks: &DagHooks{
+				OnSuccess: []Task{{ID: "notify-success", ActionName: "notify"}},
+				OnFailure: []Task{{ID: "notify-failure", ActionName: "notify"}, {ID: "cleanup", ActionName: "cleanup"}},
+			},
+		},
+		{
+			caseDesc:  "duplicated with task",
+			giveHooks: &DagHooks{OnCancel: []Task{{ID: "t1", ActionName: "cleanup"}}},
+			wantErr:   "cancel hook task id[t1] is duplicated",
+		},
+		{
+			caseDesc: "duplicated between hooks",
+			giveHooks: &DagHooks{
+				OnSuccess: []Task{{ID: "notify", ActionName: "notify"}},
+				OnFailure: []Task{{ID: "notify", ActionName: "notify"}},
+			},
+			wantErr: "failure hook task id[notify] is duplicated",
+		},
+		{
+			caseDesc:  "depend on",
+			giveHooks: &DagHooks{OnFailure: []Task{{ID: "cleanup", ActionName: "cleanup", DependOn: []string{"t1"}}}},
+			wantErr:   "failure hook task[cleanup] cannot depend on other tasks",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			err := tc.giveHooks.Validate([]Task{{ID: "t1", ActionName: "act"}})
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestDag_Selector(t *testing.T) {
+	tests := []struct {
+		caseDesc     string
+		giveDag      *Dag
+		wantSelector map[string]string
+		wantErr      bool
+	}{
+		{
+			caseDesc: "no selector",
+			giveDag:  &Dag{Tasks: []Task{{ID: "t1"}}},
+		},
+		{
+			caseDesc: "merged",
+			giveDag: &Dag{
+				Tasks: []Task{
+					{ID: "t1", Selector: map[string]string{"gpu": ""}},
+					{ID: "t2", Selector: map[string]string{"gpu": "a100", "region": "eu"}},
+				},
+				Hooks: &DagHooks{OnFailure: []Task{{ID: "h1", Selector: map[string]string{"region": ""}}}},
+			},
+			wantSelector: map[string]string{"gpu": "a100", "region": "eu"},
+		},
+		{
+			caseDesc: "conflicted",
+			giveDag: &Dag{
+				Tasks: []Task{
+					{ID: "t1", Selector: map[string]string{"region": "us"}},
+					{ID: "t2", Selector: map[string]string{"region": "eu"}},
+				},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			ret, err := tc.giveDag.Selector()
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantSelector, ret)
+			assert.True(t, MatchSelector(ret, map[string]string{"gpu": "a100", "region": "eu", "zone": "1"}))
+		})
+	}
+}
+
+func TestDag_Marshal(t *testing.T) {
+	dag := &Dag{
+		BaseInfo: BaseInfo{ID: "dag1", CreatedAt: 1, UpdatedAt: 2},
+		Name:     "dag",
+		Cron:     "0 * * * *",
+		Vars:     DagVars{"env": {Desc: "environment", DefaultValue: "test"}},
+		Status:   DagStatusNormal,
+		Tasks: []Task{
+			{
+				ID:         "task1",
+				ActionName: "act1",
+				Params:     map[string]interface{}{"key": "value", "nested": map[string]interface{}{"k": "v"}},
+				PreChecks: PreChecks{"check": {
+					Conditions: []TaskCondition{{Source: TaskConditionSourceVars, Key: "env", Values: []string{"prod"}, Op: OperatorIn}},
+					Act:        ActiveActionSkip,
+				}},
+				Env:         []EnvVar{{Name: "TOKEN", SecretRef: "token"}},
+				Matrix:      TaskMatrix{"region": {"a", "b"}},
+				RateLimit:   &RateLimit{Key: "api", Rate: "10/s"},
+				Pool:        &TaskPool{Name: "gpu", Slots: 2},
+				RetryPolicy: &RetryPolicy{MaxAttempts: 3, Backoff: RetryBackoffExponential, Jitter: 0.2},
+				Selector:    map[string]string{"zone": "a"},
+			},
+			{
+				ID:          "task2",
+				DependOn:    []string{"task1"},
+				SubDag:      &SubDag{DagID: "dag2", Vars: map[string]string{"k": "v"}},
+				TriggerRule: TriggerRuleAllDone,
+			},
+		},
+		RetryBudget:  5,
+		TimeoutSecs:  60,
+		RerunPolicy:  &RerunPolicy{Limit: 1, Within: "24h"},
+		TaskDefaults: &TaskDefaults{TimeoutSecs: 10},
+		Hooks:        &DagHooks{OnFailure: []Task{{ID: "notify", ActionName: "notify"}}},
+	}
+
+	tests := []struct {
+		caseDesc  string
+		marshal   func(interface{}) ([]byte, error)
+		unmarshal func([]byte, interface{}) error
+	}{
+		{caseDesc: "yaml", marshal: yaml.Marshal, unmarshal: yaml.Unmarshal},
+		{caseDesc: "json", marshal: json.Marshal, unmarshal: json.Unmarshal},
+	}
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			bs, err := tc.marshal(dag)
+			assert.NoError(t, err)
+			got := &Dag{}
+			assert.NoError(t, tc.unmarshal(bs, got))
+			assert.Equal(t, dag, got)
+		})
+	}
+}
+
+func TestDagVars_Validate(t *testing.T) {
+	tests := []struct {
+		caseDesc string
+		giveVars DagVars
+		wantErr  string
+	}{
+		{
+			caseDesc: "valid",
+			giveVars: DagVars{
+				"name":   {DefaultValue: "v"},
+				"count":  {Type: DagVarTypeInt, DefaultValue: "-1"},
+				"dryRun": {Type: DagVarTypeBool, Required: true},
+				"env":    {Type: DagVarTypeEnum, Enum: []string{"test", "prod"}, DefaultValue: "test"},
+				"token":  {Type: DagVarTypeSecret, DefaultValue: "secret://api#token"},
+			},
+		},
+		{
+			caseDesc: "unknown type",
+			giveVars: DagVars{"count": {Type: "number"}},
+			wantErr:  `type "number" of var[count] is invalid, it should be one of string, int, bool, enum or secret`,
+		},
+		{
+			caseDesc: "enum without values",
+			giveVars: DagVars{"env": {Type: DagVarTypeEnum}},
+			wantErr:  "enum var[env] has no enum values",
+		},
+		{
+			caseDesc: "enum values of string",
+			giveVars: DagVars{"env": {Enum: []string{"test"}}},
+			wantErr:  "var[env] is not enum but has enum values",
+		},
+		{
+			caseDesc: "invalid default value",
+			giveVars: DagVars{"count": {Type: DagVarTypeInt, DefaultValue: "1.5"}},
+			wantErr:  `default value of var[count] is invalid, "1.5" is not an int`,
+		},
+		{
+			caseDesc: "plaintext secret",
+			giveVars: DagVars{"token": {Type: DagVarTypeSecret, DefaultValue: "plaintext"}},
+			wantErr:  `default value of var[token] is invalid, secret var should be a reference like "secret://path#key"`,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			err := tc.giveVars.Validate()
+			if tc.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tc.wantErr)
+		})
+	}
+}
+
+func TestDag_Run(t *testing.T) {
+	dag := &Dag{
+		BaseInfo: BaseInfo{ID: "dag1"},
+		Status:   DagStatusNormal,
+		Vars: DagVars{
+			"name":   {DefaultValue: "def"},
+			"count":  {Type: DagVarTypeInt, Required: true},
+			"dryRun": {Type: DagVarTypeBool, DefaultValue: "false"},
+			"env":    {Type: DagVarTypeEnum, Enum: []string{"test", "prod"}, DefaultValue: "test"},
+		},
+	}
+	tests := []struct {
+		caseDesc     string
+		giveSpecVars map[string]string
+		wantVars     DagInstanceVars
+		wantErr      string
+	}{
+		{
+			caseDesc:     "defaults",
+			giveSpecVars: map[string]string{"count": "3", "undeclared": "v"},
+			wantVars: DagInstanceVars{
+				"name":   {Value: "def"},
+				"count":  {Value: "3"},
+				"dryRun": {Value: "false"},
+				"env":    {Value: "test"},
+			},
+		},
+		{
+			caseDesc:     "specified",
+			giveSpecVars: map[string]string{"name": "n", "count": "3", "dryRun": "true", "env": "prod"},
+			wantVars: DagInstanceVars{
+				"name":   {Value: "n"},
+				"count":  {Value: "3"},
+				"dryRun": {Value: "true"},
+				"env":    {Value: "prod"},
+			},
+		},
+		{
+			caseDesc:     "missing required",
+			giveSpecVars: map[string]string{"name": "n"},
+			wantErr:      "var[count] is required: data invalid",
+		},
+		{
+			caseDesc:     "wrong type",
+			giveSpecVars: map[string]string{"count": "3", "dryRun": "maybe"},
+			wantErr:      `var[dryRun] is invalid, "maybe" is not a bool: data invalid`,
+		},
+		{
+			caseDesc:     "not in enum",
+			giveSpecVars: map[string]string{"count": "3", "env": "dev"},
+			wantErr:      `var[env] is invalid, "dev" is not one of test, prod: data invalid`,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			dagIns, err := dag.Run(TriggerManually, tc.giveSpecVars)
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+				assert.True(t, errors.Is(err, data.ErrDataInvalid))
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantVars, dagIns.Vars)
+		})
+	}
+}
+
+func TestDag_SLAs(t *testing.T) {
+	dag := &Dag{
+		SLASecs: 60,
+		Tasks: []Task{
+			{ID: "task1", SLASecs: 120},
+			{ID: "task2"},
+			{ID: "task3", SLASecs: 30},
+		},
+	}
+	slas := dag.SLAs(time.Unix(100, 0))
+	assert.Equal(t, []SLA{{TaskID: "task3", Deadline: 130}, {Deadline: 160}, {TaskID: "task1", Deadline: 220}}, slas)
+	assert.Equal(t, int64(130), NextSLADeadline(slas, 0))
+	assert.Equal(t, int64(160), NextSLADeadline(slas, 130))
+	assert.Equal(t, int64(0), NextSLADeadline(slas, 220))
+}
+
+func TestNotification_Validate(t *testing.T) {
+	tests := []struct {
+		caseDesc         string
+		giveNotification *Notification
+		wantErr          string
+	}{
+		{
+			caseDesc:         "normal",
+			giveNotification: &Notification{Notifier: "ops", Events: []NotifyEvent{NotifyEventRunFailed, NotifyEventSLAMissed}, Template: "{{.Event}}"},
+		},
+		{
+			caseDesc:         "empty notifier",
+			giveNotification: &Notification{Events: []NotifyEvent{NotifyEventRunFailed}},
+			wantErr:          "notifier of notification cannot be empty",
+		},
+		{
+			caseDesc:         "empty events",
+			giveNotification: &Notification{Notifier: "ops"},
+			wantErr:          "events of notifier[ops] cannot be empty",
+		},
+		{
+			caseDesc:         "invalid event",
+			giveNotification: &Notification{Notifier: "ops", Events: []NotifyEvent{"runStarted"}},
+			wantErr:          "event[runStarted] of notifier[ops] is invalid",
+		},
+		{
+			caseDesc:         "invalid template",
+			giveNotification: &Notification{Notifier: "ops", Events: []NotifyEvent{NotifyEventRunFailed}, Template: "{{.Event"},
+			wantErr:          "template of notifier[ops] is invalid: template: ops:1: unclosed action",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			err := tc.giveNotification.Validate()
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.True(t, tc.giveNotification.Subscribed(NotifyEventSLAMissed))
+			assert.False(t, tc.giveNotification.Subscribed(NotifyEventTaskBlocked))
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package entity
+
+import (
+	"testing"
+)
+
+func FuzzTaskCondition_IsMeet(f *testing.F) {
+	f.Add("vars", "key", "in", "value", "value")
+	f.Add("share-data", "key", "not-in", "value", "other")
+	f.Add("unknown", "key", "in", "value", "value")
+	f.Add("vars", "", "", "", "")
+
+	f.Fuzz(func(t *testing.T, source, key, op, value, giveVal string) {
+		cond := TaskCondition{
+			Source: TaskConditionSource(source),
+			Key:    key,
+			Op:     Operator(op),
+			Values: []string{value},
+		}
+		dagIns := &DagInstance{
+			Vars: DagInstanceVars{key: {Value: giveVal}},
+		}
+		// share data may be empty when dag instance is created without it
+		cond.IsMeet(dagIns)
+		dagIns.ShareData = &ShareData{Dict: map[string]string{key: giveVal}}
+		meet := cond.IsMeet(dagIns)
+		if meet && cond.Source != TaskConditionSourceVars && cond.Source != TaskConditionSourceShareData {
+			t.Fatalf("condition with invalid source %s should not be meet", source)
+		}
+	})
+}
+
+func FuzzDagInstanceVars_Render(f *testing.F) {
+	f.Add("key", "value", "{{key}}")
+	f.Add("key", "{{key}}", "{{key}}{{key}}")
+	f.Add("", "", "{{}}")
+	f.Add("{{", "}}", "{{{{}}}}")
+
+	f.Fuzz(func(t *testing.T, key, val, tpl string) {
+		vars := DagInstanceVars{key: {Value: val}}
+		_, err := vars.Render(map[string]interface{}{
+			"str":   tpl,
+			"slice": []interface{}{tpl, 1},
+			"map":   map[string]interface{}{"nested": tpl},
+		})
+		if err != nil {
+			t.Fatalf("render failed: %v", err)
+		}
+	})
+}
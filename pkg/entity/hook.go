@@ -0,0 +1,77 @@
+package entity
+
+import (
+	"fmt"
+)
+
+// DagHook is the terminal state of dag instance which triggers the hook tasks
+type DagHook string
+
+const (
+	// DagHookSuccess is triggered when the dag instance succeeds
+	DagHookSuccess DagHook = "success"
+	// DagHookFailure is triggered when the dag instance fails because a task failed
+	DagHookFailure DagHook = "failure"
+	// DagHookCancel is triggered when the dag instance fails because a task was canceled
+	DagHookCancel DagHook = "cancel"
+)
+
+// DagHooks is the cleanup or notification tasks which run once when the dag instance is terminated,
+// no matter which task failed. They are not part of the task tree, so they neither depend on other tasks
+// nor change the status of dag instance.
+type DagHooks struct {
+	OnSuccess []Task `yaml:"onSuccess,omitempty" json:"onSuccess,omitempty"  bson:"onSuccess,omitempty"`
+	OnFailure []Task `yaml:"onFailure,omitempty" json:"onFailure,omitempty"  bson:"onFailure,omitempty"`
+	OnCancel  []Task `yaml:"onCancel,omitempty" json:"onCancel,omitempty"  bson:"onCancel,omitempty"`
+}
+
+// Tasks return the hook tasks triggered by hook
+func (h *DagHooks) Tasks(hook DagHook) []Task {
+	if h == nil {
+		return nil
+	}
+	switch hook {
+	case DagHookSuccess:
+		return h.OnSuccess
+	case DagHookFailure:
+		return h.OnFailure
+	case DagHookCancel:
+		return h.OnCancel
+	}
+	return nil
+}
+
+// Validate check the hook tasks, their ids must be different from each other and the tasks of dag
+func (h *DagHooks) Validate(tasks []Task) error {
+	ids := map[string]bool{}
+	for _, t := range tasks {
+		ids[t.ID] = true
+	}
+	for _, hook := range []DagHook{DagHookSuccess, DagHookFailure, DagHookCancel} {
+		for _, t := range h.Tasks(hook) {
+			if t.ID == "" {
+				return fmt.Errorf("%s hook task id cannot be empty", hook)
+			}
+			if ids[t.ID] {
+				return fmt.Errorf("%s hook task id[%s] is duplicated", hook, t.ID)
+			}
+			ids[t.ID] = true
+			if len(t.DependOn) > 0 || len(t.DependOnCondition) > 0 {
+				return fmt.Errorf("%s hook task[%s] cannot depend on other tasks", hook, t.ID)
+			}
+			if t.MapOver != nil || len(t.Matrix) > 0 {
+				return fmt.Errorf("%s hook task[%s] cannot be expanded", hook, t.ID)
+			}
+		}
+	}
+	return nil
+}
+
+// applyTaskDefaults let each hook task inherit the base task, see "Task.Inherit"
+func (h *DagHooks) applyTaskDefaults(base Task) {
+	for _, tasks := range [][]Task{h.OnSuccess, h.OnFailure, h.OnCancel} {
+		for i := range tasks {
+			tasks[i] = tasks[i].Inherit(base)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package entity
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/etherealiy/fastflow/pkg/utils/value"
+)
+
+// MapOver expand the task at runtime into a task instance for each item of the list which is written
+// by its upstream tasks. The task instance of the task itself waits for all of them, so it joins them
+// before the downstream tasks run.
+type MapOver struct {
+	Source TaskConditionSource `yaml:"source,omitempty" json:"source,omitempty"  bson:"source,omitempty"`
+	// Key is the key of list, the value can be a json array or comma separated string
+	Key string `yaml:"key,omitempty" json:"key,omitempty"  bson:"key,omitempty"`
+	// As is the placeholder of item in name, params and env, it is "item" by default, such as "{{item}}"
+	As string `yaml:"as,omitempty" json:"as,omitempty"  bson:"as,omitempty"`
+}
+
+// Validate
+func (m *MapOver) Validate() error {
+	if m.Source != TaskConditionSourceVars && m.Source != TaskConditionSourceShareData {
+		return fmt.Errorf("map over source %q is invalid, it should be %s or %s",
+			m.Source, TaskConditionSourceVars, TaskConditionSourceShareData)
+	}
+	if m.Key == "" {
+		return fmt.Errorf("map over key cannot be empty")
+	}
+	return nil
+}
+
+// Items return the list to map over
+func (m *MapOver) Items(dagIns *DagInstance) ([]string, error) {
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	v, ok := m.Source.BuildKvGetter(dagIns)(m.Key)
+	if !ok {
+		return nil, fmt.Errorf("map over %s[%s] is not found", m.Source, m.Key)
+	}
+	v = strings.TrimSpace(v)
+	if strings.HasPrefix(v, "[") {
+		var list []interface{}
+		if err := json.Unmarshal([]byte(v), &list); err != nil {
+			return nil, fmt.Errorf("map over %s[%s] is not a valid json array: %w", m.Source, m.Key, err)
+		}
+		items := make([]string, 0, len(list))
+		for _, item := range list {
+			if s, ok := item.(string); ok {
+				items = append(items, s)
+				continue
+			}
+			bs, err := json.Marshal(item)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, string(bs))
+		}
+		return items, nil
+	}
+
+	var items []string
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			items = append(items, s)
+		}
+	}
+	return items, nil
+}
+
+// MappedTaskID is the task id of the index-th task instance mapped from the task
+func MappedTaskID(taskID string, index int) string {
+	return fmt.Sprintf("%s[%d]", taskID, index)
+}
+
+// NewMappedTaskInstance create the index-th task instance mapped from t, the id is derived from t
+// so that it will not be created twice
+func (t *TaskInstance) NewMappedTaskInstance(index int) (*TaskInstance, error) {
+	placeholder := "{{item}}"
+	if t.MapOver.As != "" {
+		placeholder = fmt.Sprintf("{{%s}}", t.MapOver.As)
+	}
+	item := t.MapItems[index]
+	render := func(s string) string {
+		return strings.ReplaceAll(s, placeholder, item)
+	}
+
+	ins := &TaskInstance{
+		BaseInfo:    BaseInfo{ID: fmt.Sprintf("%s-%d", t.ID, index)},
+		TaskID:      MappedTaskID(t.TaskID, index),
+		DagInsID:    t.DagInsID,
+		Name:        render(t.Name),
+		DependOn:    t.DependOn,
+		ActionName:  t.ActionName,
+		TimeoutSecs: t.TimeoutSecs,
+		Status:      TaskInstanceStatusInit,
+		PreChecks:   t.PreChecks,
+		RateLimit:   t.RateLimit,
+		SubDag:      t.SubDag,
+		Pool:        t.Pool,
+		RetryPolicy: t.RetryPolicy,
+		TriggerRule: t.TriggerRule,
+		MappedFrom:  t.TaskID,
+	}
+	for _, e := range t.Env {
+		e.Value = render(e.Value)
+		ins.Env = append(ins.Env, e)
+	}
+	if t.Params != nil {
+		ins.Params = copyValue(t.Params).(map[string]interface{})
+		if err := value.MapValue(ins.Params).WalkString(func(walkContext *value.WalkContext, s string) error {
+			walkContext.Setter(render(s))
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return ins, nil
+}
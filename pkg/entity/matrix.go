@@ -0,0 +1,203 @@
+package entity
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/etherealiy/fastflow/pkg/utils/value"
+)
+
+// TaskMatrix is the values of each matrix key, a value like "0..9" is expanded to the integers in the range
+type TaskMatrix map[string][]interface{}
+
+// Combinations return the cartesian product of matrix values, it is ordered by the sorted keys
+func (m TaskMatrix) Combinations() ([]map[string]string, error) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	combinations := []map[string]string{{}}
+	for _, k := range keys {
+		values, err := expandMatrixValues(m[k])
+		if err != nil {
+			return nil, fmt.Errorf("matrix key[%s] is invalid: %w", k, err)
+		}
+		if len(values) == 0 {
+			return nil, fmt.Errorf("matrix key[%s] has no value", k)
+		}
+		var next []map[string]string
+		for _, c := range combinations {
+			for _, v := range values {
+				nc := map[string]string{k: v}
+				for ck, cv := range c {
+					nc[ck] = cv
+				}
+				next = append(next, nc)
+			}
+		}
+		combinations = next
+	}
+	return combinations, nil
+}
+
+func expandMatrixValues(values []interface{}) ([]string, error) {
+	var ret []string
+	for _, v := range values {
+		s := fmt.Sprint(v)
+		bounds := strings.Split(s, "..")
+		if len(bounds) != 2 {
+			ret = append(ret, s)
+			continue
+		}
+		from, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			return nil, fmt.Errorf("range %s is invalid", s)
+		}
+		to, err := strconv.Atoi(bounds[1])
+		if err != nil || to < from {
+			return nil, fmt.Errorf("range %s is invalid", s)
+		}
+		for i := from; i <= to; i++ {
+			ret = append(ret, strconv.Itoa(i))
+		}
+	}
+	return ret, nil
+}
+
+// ExpandMatrix replace each task which has matrix by the tasks of matrix combinations,
+// "{{key}}" in id, name, dependOn, params and env values is replaced by the value of combination,
+// if the id has no placeholder, the values are appended to it, such as "sync-eu-0".
+// When the task has a join task, the join task depends on all expanded tasks, otherwise the tasks
+// which depend on the matrix task depend on all expanded tasks.
+func (d *Dag) ExpandMatrix() error {
+	groups := map[string][]string{}
+	var tasks []Task
+	for _, t := range d.Tasks {
+		if len(t.Matrix) == 0 {
+			tasks = append(tasks, t)
+			continue
+		}
+		expanded, err := t.expand()
+		if err != nil {
+			return fmt.Errorf("expand matrix of task[%s] failed: %w", t.ID, err)
+		}
+		for _, et := range expanded {
+			groups[t.ID] = append(groups[t.ID], et.ID)
+		}
+		tasks = append(tasks, expanded...)
+		if t.Join != nil {
+			join := *t.Join
+			if join.ID == "" && strings.Contains(t.ID, "{{") {
+				return fmt.Errorf("join task of task[%s] must have id because the task id is templated", t.ID)
+			}
+			if join.ID == "" {
+				join.ID = t.ID + "-join"
+			}
+			join.DependOn = append(append([]string{}, join.DependOn...), groups[t.ID]...)
+			tasks = append(tasks, join)
+			groups[t.ID] = []string{join.ID}
+		}
+	}
+	if len(groups) == 0 {
+		return nil
+	}
+
+	existed := map[string]bool{}
+	for i := range tasks {
+		if existed[tasks[i].ID] {
+			return fmt.Errorf("task[%s] is duplicated after matrix expanded", tasks[i].ID)
+		}
+		existed[tasks[i].ID] = true
+
+		var depends []string
+		for _, dep := range tasks[i].DependOn {
+			if ids, ok := groups[dep]; ok {
+				depends = append(depends, ids...)
+				continue
+			}
+			depends = append(depends, dep)
+		}
+		tasks[i].DependOn = depends
+	}
+	d.Tasks = tasks
+	return nil
+}
+
+func (t *Task) expand() ([]Task, error) {
+	combinations, err := t.Matrix.Combinations()
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(t.Matrix))
+	for k := range t.Matrix {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var ret []Task
+	for _, c := range combinations {
+		render := func(s string) string {
+			for k, v := range c {
+				s = strings.ReplaceAll(s, fmt.Sprintf("{{%s}}", k), v)
+			}
+			return s
+		}
+
+		et := *t
+		et.Matrix = nil
+		et.Join = nil
+		if strings.Contains(t.ID, "{{") {
+			et.ID = render(t.ID)
+		} else {
+			suffix := make([]string, 0, len(keys))
+			for _, k := range keys {
+				suffix = append(suffix, c[k])
+			}
+			et.ID = t.ID + "-" + strings.Join(suffix, "-")
+		}
+		et.Name = render(t.Name)
+		et.DependOn = nil
+		for _, dep := range t.DependOn {
+			et.DependOn = append(et.DependOn, render(dep))
+		}
+		et.Env = nil
+		for _, e := range t.Env {
+			e.Value = render(e.Value)
+			et.Env = append(et.Env, e)
+		}
+		if t.Params != nil {
+			et.Params = copyValue(t.Params).(map[string]interface{})
+			if err := value.MapValue(et.Params).WalkString(func(walkContext *value.WalkContext, s string) error {
+				walkContext.Setter(render(s))
+				return nil
+			}); err != nil {
+				return nil, err
+			}
+		}
+		ret = append(ret, et)
+	}
+	return ret, nil
+}
+
+func copyValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			m[k] = copyValue(item)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(val))
+		for i, item := range val {
+			s[i] = copyValue(item)
+		}
+		return s
+	default:
+		return v
+	}
+}
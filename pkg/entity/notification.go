@@ -0,0 +1,62 @@
+package entity
+
+import (
+	"fmt"
+	"text/template"
+)
+
+// NotifyEvent is the state transition of dag instance which sends notifications
+type NotifyEvent string
+
+const (
+	// NotifyEventRunFailed is sent when the dag instance failed
+	NotifyEventRunFailed NotifyEvent = "runFailed"
+	// NotifyEventRunSucceeded is sent when the dag instance succeeded
+	NotifyEventRunSucceeded NotifyEvent = "runSucceeded"
+	// NotifyEventTaskBlocked is sent when the dag instance is blocked by a task
+	NotifyEventTaskBlocked NotifyEvent = "taskBlocked"
+	// NotifyEventSLAMissed is sent when the dag instance missed a SLA of dag or task
+	NotifyEventSLAMissed NotifyEvent = "slaMissed"
+)
+
+// Notification send messages by the named notifier when the events happen, the notifiers are registered
+// to notify.Sender, so the secrets such as webhook urls are not stored in dags.
+type Notification struct {
+	Notifier string        `yaml:"notifier" json:"notifier" bson:"notifier"`
+	Events   []NotifyEvent `yaml:"events" json:"events" bson:"events"`
+	// Template is the go template of message text, the data is notify.Message, empty means the default template
+	Template string `yaml:"template,omitempty" json:"template,omitempty" bson:"template,omitempty"`
+}
+
+// Subscribed return whether the event is one of the events of notification
+func (n *Notification) Subscribed(ev NotifyEvent) bool {
+	for _, e := range n.Events {
+		if e == ev {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate
+func (n *Notification) Validate() error {
+	if n.Notifier == "" {
+		return fmt.Errorf("notifier of notification cannot be empty")
+	}
+	if len(n.Events) == 0 {
+		return fmt.Errorf("events of notifier[%s] cannot be empty", n.Notifier)
+	}
+	for _, e := range n.Events {
+		switch e {
+		case NotifyEventRunFailed, NotifyEventRunSucceeded, NotifyEventTaskBlocked, NotifyEventSLAMissed:
+		default:
+			return fmt.Errorf("event[%s] of notifier[%s] is invalid", e, n.Notifier)
+		}
+	}
+	if n.Template != "" {
+		if _, err := template.New(n.Notifier).Parse(n.Template); err != nil {
+			return fmt.Errorf("template of notifier[%s] is invalid: %s", n.Notifier, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package entity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity/run"
+	"github.com/etherealiy/fastflow/pkg/utils/data"
+)
+
+// RetryBackoff is the strategy of computing the interval between retries
+type RetryBackoff string
+
+const (
+	// RetryBackoffFixed wait the same interval before each retry
+	RetryBackoffFixed RetryBackoff = "fixed"
+	// RetryBackoffExponential double the interval after each retry, it is limited by MaxIntervalSecs
+	RetryBackoffExponential RetryBackoff = "exponential"
+)
+
+// RetryOn is a class of errors which can be retried
+type RetryOn string
+
+const (
+	// RetryOnAll retry all errors
+	RetryOnAll RetryOn = "all"
+	// RetryOnTimeout retry the errors caused by the timeout of task
+	RetryOnTimeout RetryOn = "timeout"
+	// RetryOnTransient retry the errors marked by data.Transient, so action decides which errors are temporary
+	RetryOnTransient RetryOn = "transient"
+)
+
+// RetryPolicy retry the failed task instance automatically, the canceled ones are not retried.
+// The retries are recorded in attempts of task instance, and the task instance fails after all attempts fail.
+type RetryPolicy struct {
+	// MaxAttempts is the max count of executions including the first one, <= 1 means no retry
+	MaxAttempts int `yaml:"maxAttempts,omitempty" json:"maxAttempts,omitempty"  bson:"maxAttempts,omitempty"`
+	// Backoff default is "fixed"
+	Backoff RetryBackoff `yaml:"backoff,omitempty" json:"backoff,omitempty"  bson:"backoff,omitempty"`
+	// IntervalSecs is the interval before the first retry, default is 1
+	IntervalSecs int `yaml:"intervalSecs,omitempty" json:"intervalSecs,omitempty"  bson:"intervalSecs,omitempty"`
+	// MaxIntervalSecs limit the interval of exponential backoff, 0 means no limit
+	MaxIntervalSecs int `yaml:"maxIntervalSecs,omitempty" json:"maxIntervalSecs,omitempty"  bson:"maxIntervalSecs,omitempty"`
+	// Jitter randomize the interval by the ratio in [0, 1], such as 0.2 means the interval is in [80%, 120%],
+	// so the tasks failed at the same time do not retry at the same time
+	Jitter float64 `yaml:"jitter,omitempty" json:"jitter,omitempty"  bson:"jitter,omitempty"`
+	// RetryOn is the classes of errors which are retried, empty means all errors
+	RetryOn []RetryOn `yaml:"retryOn,omitempty" json:"retryOn,omitempty"  bson:"retryOn,omitempty"`
+}
+
+// Validate
+func (p *RetryPolicy) Validate() error {
+	switch p.Backoff {
+	case "", RetryBackoffFixed, RetryBackoffExponential:
+	default:
+		return fmt.Errorf("retry backoff %q is invalid, it should be %s or %s",
+			p.Backoff, RetryBackoffFixed, RetryBackoffExponential)
+	}
+	if p.IntervalSecs < 0 || p.MaxIntervalSecs < 0 {
+		return fmt.Errorf("retry interval cannot be negative")
+	}
+	if p.Jitter < 0 || p.Jitter > 1 {
+		return fmt.Errorf("retry jitter must be in [0, 1]")
+	}
+	for _, on := range p.RetryOn {
+		switch on {
+		case RetryOnAll, RetryOnTimeout, RetryOnTransient:
+		default:
+			return fmt.Errorf("retry on %q is invalid, it should be %s, %s or %s",
+				on, RetryOnAll, RetryOnTimeout, RetryOnTransient)
+		}
+	}
+	return nil
+}
+
+// ShouldRetry return true when the task instance which has been retried automatically for retries times
+// can be retried for the error, timedOut means the task instance exceeded its timeout
+func (p *RetryPolicy) ShouldRetry(retries int, err error, timedOut bool) bool {
+	if err == nil || retries+1 >= p.MaxAttempts || errors.Is(err, run.ErrInvalidParams) {
+		return false
+	}
+	if len(p.RetryOn) == 0 {
+		return true
+	}
+	for _, on := range p.RetryOn {
+		switch on {
+		case RetryOnAll:
+			return true
+		case RetryOnTimeout:
+			if timedOut || errors.Is(err, context.DeadlineExceeded) {
+				return true
+			}
+		case RetryOnTransient:
+			if errors.Is(err, data.ErrDataTransient) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Interval return the interval before the retry, retry starts from 1.
+// random returns a number in [0, 1), it is used to apply jitter.
+func (p *RetryPolicy) Interval(retry int, random func() float64) time.Duration {
+	base := float64(p.IntervalSecs)
+	if base == 0 {
+		base = 1
+	}
+	interval := base
+	if p.Backoff == RetryBackoffExponential && retry > 1 {
+		interval = base * math.Pow(2, float64(retry-1))
+	}
+	if p.MaxIntervalSecs > 0 && interval > float64(p.MaxIntervalSecs) {
+		interval = float64(p.MaxIntervalSecs)
+	}
+	if p.Jitter > 0 {
+		interval *= 1 + p.Jitter*(2*random()-1)
+	}
+	return time.Duration(interval * float64(time.Second))
+}
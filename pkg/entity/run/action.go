@@ -3,6 +3,7 @@ package run
 import (
 	"context"
 	"errors"
+	"fmt"
 	"time"
 )
 
@@ -37,8 +38,27 @@ type RetryBeforeAction interface {
 
 var (
 	EndLoop = errors.New("end loop")
+	// ErrBlocked is returned by action to block the task instance instead of failing it,
+	// the action runs again when the task instance is continued
+	ErrBlocked = errors.New("task is blocked")
 )
 
+// RescheduleError is returned by action to run the task instance again after a while,
+// the worker is not occupied while waiting, such as sensors polling for a condition
+type RescheduleError struct {
+	After time.Duration
+}
+
+// Reschedule return the error to run the task instance again after the duration
+func Reschedule(after time.Duration) error {
+	return &RescheduleError{After: after}
+}
+
+// Error
+func (e *RescheduleError) Error() string {
+	return fmt.Sprintf("rescheduled after %s", e.After)
+}
+
 type LoopDoOptionOp func(loop *LoopDoOption)
 
 // LoopInterval indicate the interval of loop
@@ -0,0 +1,17 @@
+package run
+
+// Artifact is a named file or URI produced by task, such as report, log or generated file,
+// only the reference is persisted, the content should be stored by action itself
+type Artifact struct {
+	Name string `json:"name" bson:"name"`
+	// URI can be a local path, "file://", "http(s)://" or any object-store url
+	URI         string            `json:"uri" bson:"uri"`
+	ContentType string            `json:"contentType,omitempty" bson:"contentType,omitempty"`
+	Size        int64             `json:"size,omitempty" bson:"size,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty" bson:"metadata,omitempty"`
+	CreatedAt   int64             `json:"createdAt" bson:"createdAt"`
+	// ExpiredAt is unix timestamp in seconds, 0 means using the default retention
+	ExpiredAt int64 `json:"expiredAt,omitempty" bson:"expiredAt,omitempty"`
+	// Deleted means the artifact is collected because it is out of retention
+	Deleted bool `json:"deleted,omitempty" bson:"deleted,omitempty"`
+}
@@ -0,0 +1,39 @@
+package run
+
+// Dataset is the data read or written by task, it is identified by namespace and name,
+// e.g. namespace "postgres://db:5432" and name "public.orders", which is the same as OpenLineage
+type Dataset struct {
+	Namespace string `json:"namespace" bson:"namespace"`
+	Name      string `json:"name" bson:"name"`
+	// Facets are the extra metadata of dataset, such as schema
+	Facets map[string]interface{} `json:"facets,omitempty" bson:"facets,omitempty"`
+}
+
+// Lineage is the datasets declared by task
+type Lineage struct {
+	Inputs  []Dataset `json:"inputs,omitempty" bson:"inputs,omitempty"`
+	Outputs []Dataset `json:"outputs,omitempty" bson:"outputs,omitempty"`
+}
+
+// Merge add datasets, the dataset with the same namespace and name will be replaced
+func (l *Lineage) Merge(inputs, outputs []Dataset) {
+	l.Inputs = mergeDatasets(l.Inputs, inputs)
+	l.Outputs = mergeDatasets(l.Outputs, outputs)
+}
+
+func mergeDatasets(dst, src []Dataset) []Dataset {
+	for _, ds := range src {
+		replaced := false
+		for i := range dst {
+			if dst[i].Namespace == ds.Namespace && dst[i].Name == ds.Name {
+				dst[i] = ds
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			dst = append(dst, ds)
+		}
+	}
+	return dst
+}
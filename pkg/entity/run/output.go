@@ -0,0 +1,12 @@
+package run
+
+// Output is a small value published by task, the downstream tasks use it in params by
+// "{{ .outputs.<task id>.<key> }}". The value which exceeds the size limit is offloaded to blob store,
+// then only the reference is persisted.
+type Output struct {
+	Value interface{} `json:"value,omitempty" bson:"value,omitempty"`
+	// Ref is the reference returned by blob store when the value is offloaded
+	Ref string `json:"ref,omitempty" bson:"ref,omitempty"`
+	// Size is the size of json encoded value
+	Size int `json:"size" bson:"size"`
+}
@@ -3,7 +3,10 @@ package run
 import (
 	"context"
 	"fmt"
+	"io"
+	"sort"
 
+	"github.com/etherealiy/fastflow/pkg/log"
 	"github.com/etherealiy/fastflow/pkg/utils"
 )
 
@@ -44,6 +47,26 @@ type ExecuteContext interface {
 	Tracef(msg string, a ...interface{})
 	GetVar(varName string) (string, bool)
 	IterateVars(iterateFunc utils.KeyValueIterateFunc)
+	// GetEnv get the environment variable declared by task's "env",
+	// the secret references have been resolved
+	GetEnv(name string) (string, bool)
+	// IterateEnv iterate the environment variables declared by task's "env"
+	IterateEnv(iterateFunc utils.KeyValueIterateFunc)
+	// Workspace is the scratch workspace shared by tasks of the same dag instance on the same worker,
+	// it is empty when workspace is not enabled
+	Workspace() string
+	// RegisterArtifact attach a named artifact to the running task instance and persist its reference,
+	// the artifact with same name will be replaced
+	RegisterArtifact(artifact Artifact) error
+	// DeclareDatasets declare the datasets which the running task reads and writes, they are persisted
+	// and reported to lineage tools, the dataset with the same namespace and name will be replaced
+	DeclareDatasets(inputs, outputs []Dataset) error
+	// SetOutput publish a small value of the running task, the downstream tasks use it in params by
+	// "{{ .outputs.<task id>.<key> }}", the output with the same key will be replaced
+	SetOutput(key string, value interface{}) error
+	// Logger is the logger of running task instance, the logs are persisted with the task instance when store
+	// supports it, so they can be read by ui, see LogWriter for the output of processes
+	Logger() log.Logger
 }
 
 // ShareDataOperator used to operate share data
@@ -61,6 +84,12 @@ type DefExecuteContext struct {
 	trace        func(msg string, opt ...TraceOp)
 	varsGetter   func(string) (string, bool)
 	varsIterator utils.KeyValueIterator
+	env          map[string]string
+	workspace    string
+	artifactFunc func(artifact Artifact) error
+	datasetFunc  func(inputs, outputs []Dataset) error
+	outputFunc   func(key string, value interface{}) error
+	logger       log.Logger
 }
 
 // Context
@@ -125,6 +154,116 @@ func (e *DefExecuteContext) IterateVars(iterateFunc utils.KeyValueIterateFunc) {
 	e.varsIterator(iterateFunc)
 }
 
+// SetEnv set the resolved environment variables of task
+func (e *DefExecuteContext) SetEnv(env map[string]string) {
+	e.env = env
+}
+
+// GetEnv
+func (e *DefExecuteContext) GetEnv(name string) (string, bool) {
+	val, ok := e.env[name]
+	return val, ok
+}
+
+// IterateEnv
+func (e *DefExecuteContext) IterateEnv(iterateFunc utils.KeyValueIterateFunc) {
+	for k, v := range e.env {
+		if iterateFunc(k, v) {
+			break
+		}
+	}
+}
+
+// SetWorkspace
+func (e *DefExecuteContext) SetWorkspace(path string) {
+	e.workspace = path
+}
+
+// Workspace
+func (e *DefExecuteContext) Workspace() string {
+	return e.workspace
+}
+
+// SetArtifactFunc set the function which persist artifacts
+func (e *DefExecuteContext) SetArtifactFunc(f func(artifact Artifact) error) {
+	e.artifactFunc = f
+}
+
+// RegisterArtifact
+func (e *DefExecuteContext) RegisterArtifact(artifact Artifact) error {
+	if e.artifactFunc == nil {
+		return fmt.Errorf("registering artifact is not supported")
+	}
+	return e.artifactFunc(artifact)
+}
+
+// SetDatasetFunc set the function which persist datasets
+func (e *DefExecuteContext) SetDatasetFunc(f func(inputs, outputs []Dataset) error) {
+	e.datasetFunc = f
+}
+
+// DeclareDatasets
+func (e *DefExecuteContext) DeclareDatasets(inputs, outputs []Dataset) error {
+	if e.datasetFunc == nil {
+		return fmt.Errorf("declaring datasets is not supported")
+	}
+	return e.datasetFunc(inputs, outputs)
+}
+
+// SetOutputFunc set the function which persist outputs
+func (e *DefExecuteContext) SetOutputFunc(f func(key string, value interface{}) error) {
+	e.outputFunc = f
+}
+
+// SetOutput
+func (e *DefExecuteContext) SetOutput(key string, value interface{}) error {
+	if e.outputFunc == nil {
+		return fmt.Errorf("setting output is not supported")
+	}
+	return e.outputFunc(key, value)
+}
+
+// SetLogger set the logger of task instance
+func (e *DefExecuteContext) SetLogger(l log.Logger) {
+	e.logger = l
+}
+
+// Logger return the default logger when it is not set
+func (e *DefExecuteContext) Logger() log.Logger {
+	if e.logger == nil {
+		return log.GetLogger()
+	}
+	return e.logger
+}
+
+// LogWriter return the writer of task logs, each line written is a log, actions which start process
+// should use it as stdout and stderr, e.g.
+//
+//	cmd.Stdout, cmd.Stderr = run.LogWriter(ctx), run.LogWriter(ctx)
+//
+// it discards the output when the logger of ctx is not a writer
+func LogWriter(ctx ExecuteContext) io.Writer {
+	if w, ok := ctx.Logger().(io.Writer); ok {
+		return w
+	}
+	return io.Discard
+}
+
+// EnvList return the environment variables in "key=value" form and sorted by key,
+// actions which start process(shell, container, ssh and so on) should inject it, e.g.
+//
+//	cmd := exec.CommandContext(ctx.Context(), "sh", "-c", p.Command)
+//	cmd.Env = append([]string{"PATH=" + os.Getenv("PATH")}, run.EnvList(ctx)...)
+func EnvList(ctx ExecuteContext) []string {
+	var ret []string
+	ctx.IterateEnv(func(key, val string) (stop bool) {
+		ret = append(ret, key+"="+val)
+		return false
+	})
+	sort.Strings(ret)
+	return ret
+}
+
 // TraceOption
 type TraceOption struct {
 	Priority PersistPriority
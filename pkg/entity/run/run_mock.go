@@ -5,6 +5,7 @@ package run
 import (
 	context "context"
 
+	"github.com/etherealiy/fastflow/pkg/log"
 	"github.com/etherealiy/fastflow/pkg/utils"
 
 	mock "github.com/stretchr/testify/mock"
@@ -31,6 +32,41 @@ func (_m *MockExecuteContext) Context() context.Context {
 	return r0
 }
 
+// DeclareDatasets provides a mock function with given fields: inputs, outputs
+func (_m *MockExecuteContext) DeclareDatasets(inputs []Dataset, outputs []Dataset) error {
+	ret := _m.Called(inputs, outputs)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func([]Dataset, []Dataset) error); ok {
+		r0 = rf(inputs, outputs)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// GetEnv provides a mock function with given fields: name
+func (_m *MockExecuteContext) GetEnv(name string) (string, bool) {
+	ret := _m.Called(name)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(string) string); ok {
+		r0 = rf(name)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 bool
+	if rf, ok := ret.Get(1).(func(string) bool); ok {
+		r1 = rf(name)
+	} else {
+		r1 = ret.Get(1).(bool)
+	}
+
+	return r0, r1
+}
+
 // GetVar provides a mock function with given fields: varName
 func (_m *MockExecuteContext) GetVar(varName string) (string, bool) {
 	ret := _m.Called(varName)
@@ -52,11 +88,60 @@ func (_m *MockExecuteContext) GetVar(varName string) (string, bool) {
 	return r0, r1
 }
 
+// IterateEnv provides a mock function with given fields: iterateFunc
+func (_m *MockExecuteContext) IterateEnv(iterateFunc utils.KeyValueIterateFunc) {
+	_m.Called(iterateFunc)
+}
+
 // IterateVars provides a mock function with given fields: iterateFunc
 func (_m *MockExecuteContext) IterateVars(iterateFunc utils.KeyValueIterateFunc) {
 	_m.Called(iterateFunc)
 }
 
+// Logger provides a mock function with given fields:
+func (_m *MockExecuteContext) Logger() log.Logger {
+	ret := _m.Called()
+
+	var r0 log.Logger
+	if rf, ok := ret.Get(0).(func() log.Logger); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(log.Logger)
+		}
+	}
+
+	return r0
+}
+
+// RegisterArtifact provides a mock function with given fields: artifact
+func (_m *MockExecuteContext) RegisterArtifact(artifact Artifact) error {
+	ret := _m.Called(artifact)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(Artifact) error); ok {
+		r0 = rf(artifact)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SetOutput provides a mock function with given fields: key, value
+func (_m *MockExecuteContext) SetOutput(key string, value interface{}) error {
+	ret := _m.Called(key, value)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, interface{}) error); ok {
+		r0 = rf(key, value)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // ShareData provides a mock function with given fields:
 func (_m *MockExecuteContext) ShareData() ShareDataOperator {
 	ret := _m.Called()
@@ -93,6 +178,20 @@ func (_m *MockExecuteContext) Tracef(msg string, a ...interface{}) {
 	_m.Called(_ca...)
 }
 
+// Workspace provides a mock function with given fields:
+func (_m *MockExecuteContext) Workspace() string {
+	ret := _m.Called()
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func() string); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	return r0
+}
+
 // WithValue provides a mock function with given fields: key, value
 func (_m *MockExecuteContext) WithValue(key interface{}, value interface{}) {
 	_m.Called(key, value)
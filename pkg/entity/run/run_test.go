@@ -83,3 +83,23 @@ func TestDefExecuteContext_Tracef(t *testing.T) {
 		})
 	}
 }
+
+func TestDefExecuteContext_Env(t *testing.T) {
+	e := &DefExecuteContext{}
+	_, ok := e.GetEnv("A")
+	assert.False(t, ok)
+	assert.Nil(t, EnvList(e))
+
+	e.SetEnv(map[string]string{"B": "2", "A": "1"})
+	v, ok := e.GetEnv("A")
+	assert.True(t, ok)
+	assert.Equal(t, "1", v)
+	assert.Equal(t, []string{"A=1", "B=2"}, EnvList(e))
+}
+
+func TestDefExecuteContext_Workspace(t *testing.T) {
+	e := &DefExecuteContext{}
+	assert.Equal(t, "", e.Workspace())
+	e.SetWorkspace("/tmp/fastflow-workspace/1")
+	assert.Equal(t, "/tmp/fastflow-workspace/1", e.Workspace())
+}
@@ -0,0 +1,82 @@
+package run
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidParams means the params of task cannot be decoded or validated, so the action is not run,
+// retrying it does not help
+var ErrInvalidParams = errors.New("invalid params")
+
+// InvalidParams mark the error as invalid params, so errors.Is(err, ErrInvalidParams) is true
+func InvalidParams(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &invalidParamsError{err: err}
+}
+
+type invalidParamsError struct {
+	err error
+}
+
+// Error
+func (e *invalidParamsError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrInvalidParams, e.err)
+}
+
+// Unwrap
+func (e *invalidParamsError) Unwrap() error {
+	return e.err
+}
+
+// Is
+func (e *invalidParamsError) Is(target error) bool {
+	return target == ErrInvalidParams
+}
+
+// ParamsValidator is implemented by the params of TypedAction which check themselves after decoded
+type ParamsValidator interface {
+	Validate() error
+}
+
+// TypedAction is an action whose params are decoded to T before running, T is validated when it
+// implements ParamsValidator
+type TypedAction[T any] struct {
+	name string
+	run  func(ctx ExecuteContext, params *T) error
+}
+
+// NewTypedAction
+func NewTypedAction[T any](name string, run func(ctx ExecuteContext, params *T) error) *TypedAction[T] {
+	return &TypedAction[T]{name: name, run: run}
+}
+
+// Name
+func (a *TypedAction[T]) Name() string {
+	return a.name
+}
+
+// ParameterNew
+func (a *TypedAction[T]) ParameterNew() interface{} {
+	return new(T)
+}
+
+// Run
+func (a *TypedAction[T]) Run(ctx ExecuteContext, params interface{}) error {
+	p, ok := params.(*T)
+	switch {
+	case params == nil:
+		// the task has no params
+		p = new(T)
+	case !ok:
+		return InvalidParams(fmt.Errorf("params is %T instead of %T", params, p))
+	}
+	if v, ok := interface{}(p).(ParamsValidator); ok {
+		if err := v.Validate(); err != nil {
+			return InvalidParams(err)
+		}
+	}
+	return a.run(ctx, p)
+}
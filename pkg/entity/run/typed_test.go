@@ -0,0 +1,103 @@
+package run
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type typedTestParams struct {
+	URL string `json:"url"`
+}
+
+func (p *typedTestParams) Validate() error {
+	if p.URL == "" {
+		return errors.New("url cannot be empty")
+	}
+	return nil
+}
+
+type typedNoValidateParams struct {
+	Count int `json:"count"`
+}
+
+func TestTypedAction_Run(t *testing.T) {
+	var got *typedTestParams
+	act := NewTypedAction("typed", func(ctx ExecuteContext, params *typedTestParams) error {
+		got = params
+		if params.URL == "fail" {
+			return errors.New("request failed")
+		}
+		return nil
+	})
+	assert.Equal(t, "typed", act.Name())
+	assert.Equal(t, &typedTestParams{}, act.ParameterNew())
+
+	tests := []struct {
+		caseDesc    string
+		giveParams  interface{}
+		wantParams  *typedTestParams
+		wantErr     string
+		wantInvalid bool
+	}{
+		{
+			caseDesc:   "normal",
+			giveParams: &typedTestParams{URL: "http://127.0.0.1"},
+			wantParams: &typedTestParams{URL: "http://127.0.0.1"},
+		},
+		{
+			caseDesc:   "run failed",
+			giveParams: &typedTestParams{URL: "fail"},
+			wantParams: &typedTestParams{URL: "fail"},
+			wantErr:    "request failed",
+		},
+		{
+			caseDesc:    "validate failed",
+			giveParams:  &typedTestParams{},
+			wantErr:     "invalid params: url cannot be empty",
+			wantInvalid: true,
+		},
+		{
+			caseDesc:    "no params",
+			wantErr:     "invalid params: url cannot be empty",
+			wantInvalid: true,
+		},
+		{
+			caseDesc:    "wrong type",
+			giveParams:  map[string]interface{}{"url": "http://127.0.0.1"},
+			wantErr:     "invalid params: params is map[string]interface {} instead of *run.typedTestParams",
+			wantInvalid: true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			got = nil
+			err := act.Run(nil, tc.giveParams)
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.wantInvalid, errors.Is(err, ErrInvalidParams))
+			assert.Equal(t, tc.wantParams, got)
+		})
+	}
+
+	noValidate := NewTypedAction("noValidate", func(ctx ExecuteContext, params *typedNoValidateParams) error {
+		return nil
+	})
+	assert.NoError(t, noValidate.Run(nil, nil))
+}
+
+func TestInvalidParams(t *testing.T) {
+	assert.NoError(t, InvalidParams(nil))
+
+	cause := errors.New("cannot parse 'count' as int")
+	err := fmt.Errorf("get params failed: %w", InvalidParams(cause))
+	assert.EqualError(t, err, "get params failed: invalid params: cannot parse 'count' as int")
+	assert.True(t, errors.Is(err, ErrInvalidParams))
+	assert.True(t, errors.Is(err, cause))
+	assert.False(t, errors.Is(cause, ErrInvalidParams))
+}
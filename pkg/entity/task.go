@@ -3,6 +3,9 @@ package entity
 import (
 	"fmt"
 	"runtime"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/etherealiy/fastflow/pkg/entity/run"
@@ -19,6 +22,219 @@ type Task struct {
 	TimeoutSecs int                    `yaml:"timeoutSecs,omitempty" json:"timeoutSecs,omitempty"  bson:"timeoutSecs,omitempty"`
 	Params      map[string]interface{} `yaml:"params,omitempty" json:"params,omitempty"  bson:"params,omitempty"`
 	PreChecks   PreChecks              `yaml:"preCheck,omitempty" json:"preCheck,omitempty"  bson:"preCheck,omitempty"`
+	// DependOnCondition is checked when the tasks depended on are completed, the task is skipped when any of
+	// them is not met, and the downstream tasks whose upstream tasks are all skipped by it are skipped too.
+	// So the tasks depending on the same task make if/else branches by the vars or share data written by it
+	DependOnCondition []TaskCondition `yaml:"dependOnCondition,omitempty" json:"dependOnCondition,omitempty"  bson:"dependOnCondition,omitempty"`
+	// Env is the environment variables of task, action can read them by ExecuteContext.GetEnv,
+	// it is used to separate configuration from action params
+	Env []EnvVar `yaml:"env,omitempty" json:"env,omitempty"  bson:"env,omitempty"`
+	// Matrix expand the task into the cartesian product of its values when dag is applied, see "Dag.ExpandMatrix"
+	Matrix TaskMatrix `yaml:"matrix,omitempty" json:"matrix,omitempty"  bson:"matrix,omitempty"`
+	// RateLimit limit how often the action of task runs across all workers, the tasks with the same key share it
+	RateLimit *RateLimit `yaml:"rateLimit,omitempty" json:"rateLimit,omitempty"  bson:"rateLimit,omitempty"`
+	// Join is the task which runs after all tasks expanded from matrix, its id is "<id>-join" by default
+	// unless the id of task is templated
+	Join *Task `yaml:"join,omitempty" json:"join,omitempty"  bson:"join,omitempty"`
+	// MapOver expand the task into parallel task instances when it is ready to run, see "MapOver"
+	MapOver *MapOver `yaml:"mapOver,omitempty" json:"mapOver,omitempty"  bson:"mapOver,omitempty"`
+	// SubDag run another dag instead of action, the task succeeds after the dag instance succeeds
+	SubDag *SubDag `yaml:"subDag,omitempty" json:"subDag,omitempty"  bson:"subDag,omitempty"`
+	// Pool limit how many tasks of the same pool run concurrently on a worker
+	Pool *TaskPool `yaml:"pool,omitempty" json:"pool,omitempty"  bson:"pool,omitempty"`
+	// RetryPolicy retry the task automatically when it fails
+	RetryPolicy *RetryPolicy `yaml:"retryPolicy,omitempty" json:"retryPolicy,omitempty"  bson:"retryPolicy,omitempty"`
+	// TriggerRule decide when the task runs by the status of the tasks depended on, default is "all_success"
+	TriggerRule TriggerRule `yaml:"triggerRule,omitempty" json:"triggerRule,omitempty"  bson:"triggerRule,omitempty"`
+	// Selector is the labels which the worker running the task must have, an empty value only requires the label
+	// exists, such as {"gpu": "", "region": "eu"}. The dag instance is dispatched to the worker matching all its tasks
+	Selector map[string]string `yaml:"selector,omitempty" json:"selector,omitempty"  bson:"selector,omitempty"`
+	// SLASecs is the expected duration from the dag instance is created to the task succeeds, the task keeps
+	// running when it is missed, see "Dag.SLASecs"
+	SLASecs int `yaml:"slaSecs,omitempty" json:"slaSecs,omitempty"  bson:"slaSecs,omitempty"`
+}
+
+// MatchSelector check if the labels match the selector, see "Task.Selector"
+func MatchSelector(selector, labels map[string]string) bool {
+	for k, v := range selector {
+		val, ok := labels[k]
+		if !ok || (v != "" && val != v) {
+			return false
+		}
+	}
+	return true
+}
+
+// EnvVar is a environment variable of task, the value comes from Value or SecretRef
+type EnvVar struct {
+	Name string `yaml:"name,omitempty" json:"name,omitempty"  bson:"name,omitempty"`
+	// Value can use dag instance vars, such as "{{key}}"
+	Value string `yaml:"value,omitempty" json:"value,omitempty"  bson:"value,omitempty"`
+	// SecretRef is resolved by SecretResolver when task running, so plaintext will not be persisted
+	SecretRef string `yaml:"secretRef,omitempty" json:"secretRef,omitempty"  bson:"secretRef,omitempty"`
+}
+
+// SubDag is the dag run by task, the created dag instance is linked as child of current one
+type SubDag struct {
+	DagID string            `yaml:"dagId,omitempty" json:"dagId,omitempty"  bson:"dagId,omitempty"`
+	Vars  map[string]string `yaml:"vars,omitempty" json:"vars,omitempty"  bson:"vars,omitempty"`
+}
+
+// TaskPool is a named resource pool, such as gpu, the tasks wait in "queued" status when all slots are used
+type TaskPool struct {
+	Name string `yaml:"name,omitempty" json:"name,omitempty"  bson:"name,omitempty"`
+	// Slots is the count of tasks which can run concurrently in the pool on a worker
+	Slots int `yaml:"slots,omitempty" json:"slots,omitempty"  bson:"slots,omitempty"`
+}
+
+// Validate
+func (p *TaskPool) Validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("pool name cannot be empty")
+	}
+	if p.Slots <= 0 {
+		return fmt.Errorf("slots of pool[%s] must be positive", p.Name)
+	}
+	return nil
+}
+
+// TriggerRule decide whether the task runs by the status of the tasks depended on
+type TriggerRule string
+
+const (
+	// TriggerRuleAllSuccess run the task after all tasks depended on succeed or are skipped, it is default
+	TriggerRuleAllSuccess TriggerRule = "all_success"
+	// TriggerRuleOneSuccess run the task as soon as any task depended on succeeds or is skipped
+	TriggerRuleOneSuccess TriggerRule = "one_success"
+	// TriggerRuleAllDone run the task after all tasks depended on are completed, no matter they succeed or not
+	TriggerRuleAllDone TriggerRule = "all_done"
+	// TriggerRuleNoneFailed run the task after all tasks depended on are completed and none of them failed,
+	// the canceled ones are tolerated
+	TriggerRuleNoneFailed TriggerRule = "none_failed"
+)
+
+// Validate
+func (r TriggerRule) Validate() error {
+	switch r {
+	case "", TriggerRuleAllSuccess, TriggerRuleOneSuccess, TriggerRuleAllDone, TriggerRuleNoneFailed:
+		return nil
+	}
+	return fmt.Errorf("trigger rule %q is invalid, it should be %s, %s, %s or %s",
+		r, TriggerRuleAllSuccess, TriggerRuleOneSuccess, TriggerRuleAllDone, TriggerRuleNoneFailed)
+}
+
+// RateLimit is shared by the tasks with the same key, such as the tasks calling the same third-party api
+type RateLimit struct {
+	Key string `yaml:"key,omitempty" json:"key,omitempty"  bson:"key,omitempty"`
+	// Rate is the count per unit, the unit is "s", "m", "h" or a duration, such as "10/s" or "100/10m"
+	Rate string `yaml:"rate,omitempty" json:"rate,omitempty"  bson:"rate,omitempty"`
+}
+
+// Parse return the limit count in each window
+func (r *RateLimit) Parse() (limit int, window time.Duration, err error) {
+	if r.Key == "" {
+		return 0, 0, fmt.Errorf("rate limit key cannot be empty")
+	}
+	parts := strings.Split(r.Rate, "/")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("rate %q is invalid, it should be like \"10/s\"", r.Rate)
+	}
+	limit, err = strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil || limit <= 0 {
+		return 0, 0, fmt.Errorf("rate %q is invalid, the count must be a positive integer", r.Rate)
+	}
+	switch unit := strings.TrimSpace(parts[1]); unit {
+	case "s":
+		window = time.Second
+	case "m":
+		window = time.Minute
+	case "h":
+		window = time.Hour
+	default:
+		window, err = time.ParseDuration(unit)
+		if err != nil || window <= 0 {
+			return 0, 0, fmt.Errorf("rate %q is invalid, the unit must be s, m, h or a positive duration", r.Rate)
+		}
+	}
+	return limit, window, nil
+}
+
+// Inherit return the task which overrides the base task with the non-empty fields of current task,
+// params are merged by key and env are merged by name
+func (t *Task) Inherit(base Task) Task {
+	ret := base
+	ret.ID = t.ID
+	if t.Name != "" {
+		ret.Name = t.Name
+	}
+	if t.DependOn != nil {
+		ret.DependOn = t.DependOn
+	}
+	if t.ActionName != "" {
+		ret.ActionName = t.ActionName
+	}
+	if t.TimeoutSecs != 0 {
+		ret.TimeoutSecs = t.TimeoutSecs
+	}
+	if t.PreChecks != nil {
+		ret.PreChecks = t.PreChecks
+	}
+	if t.DependOnCondition != nil {
+		ret.DependOnCondition = t.DependOnCondition
+	}
+	if t.RateLimit != nil {
+		ret.RateLimit = t.RateLimit
+	}
+	if t.Matrix != nil {
+		ret.Matrix = t.Matrix
+	}
+	if t.Join != nil {
+		ret.Join = t.Join
+	}
+	if t.MapOver != nil {
+		ret.MapOver = t.MapOver
+	}
+	if t.SubDag != nil {
+		ret.SubDag = t.SubDag
+	}
+	if t.Pool != nil {
+		ret.Pool = t.Pool
+	}
+	if t.RetryPolicy != nil {
+		ret.RetryPolicy = t.RetryPolicy
+	}
+	if t.TriggerRule != "" {
+		ret.TriggerRule = t.TriggerRule
+	}
+	if t.Selector != nil {
+		ret.Selector = t.Selector
+	}
+	if t.SLASecs != 0 {
+		ret.SLASecs = t.SLASecs
+	}
+	if len(t.Params) > 0 {
+		ret.Params = map[string]interface{}{}
+		for k, v := range base.Params {
+			ret.Params[k] = v
+		}
+		for k, v := range t.Params {
+			ret.Params[k] = v
+		}
+	}
+	if len(t.Env) > 0 {
+		ret.Env = nil
+		overrides := map[string]bool{}
+		for _, e := range t.Env {
+			overrides[e.Name] = true
+		}
+		for _, e := range base.Env {
+			if !overrides[e.Name] {
+				ret.Env = append(ret.Env, e)
+			}
+		}
+		ret.Env = append(ret.Env, t.Env...)
+	}
+	return ret
 }
 
 // GetGraphID
@@ -102,8 +318,24 @@ type TaskCondition struct {
 	Op     Operator            `yaml:"op,omitempty" json:"op,omitempty"  bson:"op,omitempty"`
 }
 
+// Validate
+func (c *TaskCondition) Validate() error {
+	if c.Source != TaskConditionSourceVars && c.Source != TaskConditionSourceShareData {
+		return fmt.Errorf("condition source %q is invalid, it should be %s or %s",
+			c.Source, TaskConditionSourceVars, TaskConditionSourceShareData)
+	}
+	if c.Op != OperatorIn && c.Op != OperatorNotIn {
+		return fmt.Errorf("condition op %q is invalid, it should be %s or %s", c.Op, OperatorIn, OperatorNotIn)
+	}
+	return nil
+}
+
 // IsMeet return if check is meet
 func (c *TaskCondition) IsMeet(dagIns *DagInstance) bool {
+	// condition comes from user's input, invalid source should not panic
+	if c.Source != TaskConditionSourceVars && c.Source != TaskConditionSourceShareData {
+		return false
+	}
 	kvGetter := c.Source.BuildKvGetter(dagIns)
 
 	v, ok := kvGetter(c.Key)
@@ -145,6 +377,47 @@ type TaskInstance struct {
 	Status      TaskInstanceStatus     `json:"status,omitempty" bson:"status,omitempty"`
 	Reason      string                 `json:"reason,omitempty" bson:"reason,omitempty"`
 	PreChecks   PreChecks              `json:"preChecks,omitempty"  bson:"preChecks,omitempty"`
+	// DependOnCondition see Task.DependOnCondition
+	DependOnCondition []TaskCondition `json:"dependOnCondition,omitempty" bson:"dependOnCondition,omitempty"`
+	// BranchSkipped means the task is skipped because its branch is not taken, see Task.DependOnCondition
+	BranchSkipped bool       `json:"branchSkipped,omitempty" bson:"branchSkipped,omitempty"`
+	Env           []EnvVar   `json:"env,omitempty" bson:"env,omitempty"`
+	RateLimit     *RateLimit `json:"rateLimit,omitempty" bson:"rateLimit,omitempty"`
+	// MapOver see Task.MapOver
+	MapOver *MapOver `json:"mapOver,omitempty" bson:"mapOver,omitempty"`
+	// MapItems is the list resolved when the task is expanded, it is saved before the mapped task instances
+	// are created, so they are created from the same list after the worker restarts
+	MapItems []string `json:"mapItems,omitempty" bson:"mapItems,omitempty"`
+	// MappedFrom is the task id which the task instance is mapped from
+	MappedFrom string `json:"mappedFrom,omitempty" bson:"mappedFrom,omitempty"`
+	// SubDag see Task.SubDag, SubDagInsID is the dag instance created by the latest attempt
+	SubDag      *SubDag `json:"subDag,omitempty" bson:"subDag,omitempty"`
+	SubDagInsID string  `json:"subDagInsId,omitempty" bson:"subDagInsId,omitempty"`
+	// Pool see Task.Pool
+	Pool *TaskPool `json:"pool,omitempty" bson:"pool,omitempty"`
+	// ManualSkip records who skipped the task by command, see SkipManually
+	ManualSkip *ManualSkip `json:"manualSkip,omitempty" bson:"manualSkip,omitempty"`
+	// RetryPolicy see Task.RetryPolicy, AutoRetries is the count of automatic retries by it,
+	// and NextRetryAt is the unix time of the pending retry
+	RetryPolicy *RetryPolicy `json:"retryPolicy,omitempty" bson:"retryPolicy,omitempty"`
+	AutoRetries int          `json:"autoRetries,omitempty" bson:"autoRetries,omitempty"`
+	NextRetryAt int64        `json:"nextRetryAt,omitempty" bson:"nextRetryAt,omitempty"`
+	// Hook is the terminal state of dag instance which triggered the task instance, it is empty for
+	// the tasks in task tree, see DagHooks
+	Hook DagHook `json:"hook,omitempty" bson:"hook,omitempty"`
+	// TriggerRule see Task.TriggerRule
+	TriggerRule TriggerRule `json:"triggerRule,omitempty" bson:"triggerRule,omitempty"`
+	// Outputs is the values published by action for downstream tasks, see run.Output
+	Outputs map[string]run.Output `json:"outputs,omitempty" bson:"outputs,omitempty"`
+	// Worker is the worker which executes the task instance, it is used to find the running tasks
+	// orphaned by a dead worker
+	Worker string `json:"worker,omitempty" bson:"worker,omitempty"`
+	// ClaimExpiresAt is the unix time when the claim of Worker expires, see mod.TaskInsClaimStore
+	ClaimExpiresAt int64 `json:"claimExpiresAt,omitempty" bson:"claimExpiresAt,omitempty"`
+	// Callback is set by the action which waits for an external system or approver, see ExternalCallback
+	Callback *ExternalCallback `json:"callback,omitempty" bson:"callback,omitempty"`
+	// Sensor is set by the sensor actions which poll for a condition, see SensorState
+	Sensor *SensorState `json:"sensor,omitempty" bson:"sensor,omitempty"`
 
 	// used to save changes
 	Patch              func(*TaskInstance) error `json:"-" bson:"-"`
@@ -155,6 +428,69 @@ type TaskInstance struct {
 	bufTraces []TraceInfo
 
 	TimeUsed string `json:"timeUsed,omitempty" bson:"timeUsed,omitempty"`
+
+	// Attempts is the history of each execution, the latest one is at the end
+	Attempts []TaskAttempt `json:"attempts,omitempty" bson:"attempts,omitempty"`
+
+	// Artifacts registered by action, only references are persisted
+	Artifacts []run.Artifact `json:"artifacts,omitempty" bson:"artifacts,omitempty"`
+	// Lineage is the datasets declared by action
+	Lineage *run.Lineage `json:"lineage,omitempty" bson:"lineage,omitempty"`
+
+	// ShareDataSnapshot is only recorded when it is enabled, it is used to debug
+	ShareDataSnapshot *ShareDataSnapshot `json:"shareDataSnapshot,omitempty" bson:"shareDataSnapshot,omitempty"`
+}
+
+// ShareDataSnapshot is the share data immediately before and after the task instance executed
+type ShareDataSnapshot struct {
+	Before map[string]string `json:"before" bson:"before"`
+	After  map[string]string `json:"after" bson:"after"`
+}
+
+// ChangedKeys return the keys which are added, modified or removed by the task instance
+func (s *ShareDataSnapshot) ChangedKeys() []string {
+	var keys []string
+	for k, v := range s.After {
+		if old, ok := s.Before[k]; !ok || old != v {
+			keys = append(keys, k)
+		}
+	}
+	for k := range s.Before {
+		if _, ok := s.After[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ManualSkip is the audit record of skipping a task instance by operator
+type ManualSkip struct {
+	Operator  string             `json:"operator,omitempty" bson:"operator,omitempty"`
+	Reason    string             `json:"reason,omitempty" bson:"reason,omitempty"`
+	From      TaskInstanceStatus `json:"from" bson:"from"`
+	SkippedAt int64              `json:"skippedAt" bson:"skippedAt"`
+}
+
+// TaskAttempt record a execution of task instance, so we can know what each retry did
+type TaskAttempt struct {
+	Attempt   int                `json:"attempt" bson:"attempt"`
+	Worker    string             `json:"worker,omitempty" bson:"worker,omitempty"`
+	StartedAt int64              `json:"startedAt" bson:"startedAt"`
+	EndedAt   int64              `json:"endedAt" bson:"endedAt"`
+	Status    TaskInstanceStatus `json:"status" bson:"status"`
+	Reason    string             `json:"reason,omitempty" bson:"reason,omitempty"`
+	TimeUsed  string             `json:"timeUsed,omitempty" bson:"timeUsed,omitempty"`
+	Traces    []TraceInfo        `json:"traces,omitempty" bson:"traces,omitempty"`
+}
+
+// SensorState is the progress of sensor across the runs rescheduled by it
+type SensorState struct {
+	// Attempt is the count of attempts when the sensor started, the state belongs to the next attempt only
+	Attempt     int   `json:"attempt" bson:"attempt"`
+	StartedAt   int64 `json:"startedAt" bson:"startedAt"`
+	Pokes       int   `json:"pokes" bson:"pokes"`
+	LastPokedAt int64 `json:"lastPokedAt,omitempty" bson:"lastPokedAt,omitempty"`
 }
 
 // TraceInfo
@@ -163,6 +499,30 @@ type TraceInfo struct {
 	Message string `json:"message,omitempty" bson:"message,omitempty"`
 }
 
+// TaskLog is a line of log written by action when running task instance, it is persisted separately from
+// task instance, so the large logs do not slow down the task instance
+type TaskLog struct {
+	// Seq increase in the logs of a task instance, it is used as the cursor of reading logs
+	Seq int64 `json:"seq" bson:"seq"`
+	// Time is unix timestamp in milliseconds
+	Time    int64             `json:"time" bson:"time"`
+	Level   TaskLogLevel      `json:"level" bson:"level"`
+	Message string            `json:"message" bson:"message"`
+	Fields  map[string]string `json:"fields,omitempty" bson:"fields,omitempty"`
+}
+
+// TaskLogLevel
+type TaskLogLevel string
+
+const (
+	TaskLogLevelDebug TaskLogLevel = "debug"
+	TaskLogLevelInfo  TaskLogLevel = "info"
+	TaskLogLevelWarn  TaskLogLevel = "warn"
+	TaskLogLevelError TaskLogLevel = "error"
+	// TaskLogLevelStdout is the output of processes started by action, see run.LogWriter
+	TaskLogLevelStdout TaskLogLevel = "stdout"
+)
+
 // NewTaskInstance
 func NewTaskInstance(dagInsId string, t Task) *TaskInstance {
 	return &TaskInstance{
@@ -175,6 +535,15 @@ func NewTaskInstance(dagInsId string, t Task) *TaskInstance {
 		Params:      t.Params,
 		Status:      TaskInstanceStatusInit,
 		PreChecks:   t.PreChecks,
+		Env:         t.Env,
+		RateLimit:   t.RateLimit,
+
+		DependOnCondition: t.DependOnCondition,
+		MapOver:           t.MapOver,
+		SubDag:            t.SubDag,
+		Pool:              t.Pool,
+		RetryPolicy:       t.RetryPolicy,
+		TriggerRule:       t.TriggerRule,
 	}
 }
 
@@ -208,10 +577,14 @@ func (t *TaskInstance) InitialDep(ctx run.ExecuteContext, patch func(*TaskInstan
 // SetStatus will persist task instance
 func (t *TaskInstance) SetStatus(s TaskInstanceStatus) error {
 	t.Status = s
+	t.Reason = log.Redact(t.Reason)
 	patch := &TaskInstance{BaseInfo: BaseInfo{ID: t.ID}, Status: t.Status, Reason: t.Reason}
 	if s == TaskInstanceStatusSuccess {
 		patch.TimeUsed = t.TimeUsed
 	}
+	if s == TaskInstanceStatusRunning || s == TaskInstanceStatusQueued {
+		patch.Worker = t.Worker
+	}
 	if len(t.bufTraces) != 0 {
 		patch.Traces = append(t.Traces, t.bufTraces...)
 	}
@@ -220,6 +593,7 @@ func (t *TaskInstance) SetStatus(s TaskInstanceStatus) error {
 
 // Trace info
 func (t *TaskInstance) Trace(msg string, ops ...run.TraceOp) {
+	msg = log.Redact(msg)
 	opt := run.NewTraceOption(ops...)
 	if opt.Priority == run.PersistPriorityAfterAction {
 		t.bufTraces = append(t.bufTraces, TraceInfo{
@@ -236,6 +610,8 @@ func (t *TaskInstance) Trace(msg string, ops ...run.TraceOp) {
 
 	if err := t.Patch(&TaskInstance{BaseInfo: BaseInfo{ID: t.ID}, Traces: t.Traces}); err != nil {
 		log.Error("save trace failed",
+			utils.LogKeyDagInsID, t.DagInsID,
+			utils.LogKeyTaskInsID, t.ID,
 			"err", err,
 			"trace", t.Traces)
 	}
@@ -307,6 +683,136 @@ func (t *TaskInstance) Run(params interface{}, act run.Action) (err error) {
 	return nil
 }
 
+// RecordAttempt append current execution to attempts if task instance is finished,
+// it returns false when task instance is still in progress
+func (t *TaskInstance) RecordAttempt(worker string, startedAt time.Time) bool {
+	switch t.Status {
+	case TaskInstanceStatusSuccess, TaskInstanceStatusFailed, TaskInstanceStatusInvalidParams,
+		TaskInstanceStatusCanceled:
+	default:
+		return false
+	}
+
+	var traces []TraceInfo
+	traces = append(traces, t.Traces...)
+	traces = append(traces, t.bufTraces...)
+	t.Attempts = append(t.Attempts, TaskAttempt{
+		Attempt:   len(t.Attempts) + 1,
+		Worker:    worker,
+		StartedAt: startedAt.Unix(),
+		EndedAt:   time.Now().Unix(),
+		Status:    t.Status,
+		Reason:    t.Reason,
+		TimeUsed:  t.TimeUsed,
+		Traces:    traces,
+	})
+	return true
+}
+
+// Duration return the execution duration, it uses TimeUsed when succeed, otherwise the latest attempt
+func (t *TaskInstance) Duration() time.Duration {
+	if t.TimeUsed != "" {
+		if d, err := time.ParseDuration(t.TimeUsed); err == nil {
+			return d
+		}
+	}
+	if len(t.Attempts) > 0 {
+		latest := t.Attempts[len(t.Attempts)-1]
+		return time.Duration(latest.EndedAt-latest.StartedAt) * time.Second
+	}
+	return 0
+}
+
+// RegisterArtifact add artifact and persist the references, the artifact with same name will be replaced
+func (t *TaskInstance) RegisterArtifact(artifact run.Artifact) error {
+	if artifact.Name == "" {
+		return fmt.Errorf("artifact name cannot be empty")
+	}
+	if artifact.URI == "" {
+		return fmt.Errorf("artifact uri cannot be empty")
+	}
+	if artifact.CreatedAt == 0 {
+		artifact.CreatedAt = time.Now().Unix()
+	}
+
+	replaced := false
+	for i := range t.Artifacts {
+		if t.Artifacts[i].Name == artifact.Name {
+			t.Artifacts[i] = artifact
+			replaced = true
+		}
+	}
+	if !replaced {
+		t.Artifacts = append(t.Artifacts, artifact)
+	}
+	if t.Patch == nil {
+		return nil
+	}
+	return t.Patch(&TaskInstance{BaseInfo: t.BaseInfo, Artifacts: t.Artifacts})
+}
+
+// SetOutput attach the output to task instance and persist it, the output with the same key will be replaced
+func (t *TaskInstance) SetOutput(key string, output run.Output) error {
+	if key == "" {
+		return fmt.Errorf("output key cannot be empty")
+	}
+	outputs := map[string]run.Output{}
+	for k, v := range t.Outputs {
+		outputs[k] = v
+	}
+	outputs[key] = output
+	t.Outputs = outputs
+	if t.Patch == nil {
+		return nil
+	}
+	return t.Patch(&TaskInstance{BaseInfo: t.BaseInfo, Outputs: t.Outputs})
+}
+
+// SetCallback attach the external callback to task instance and persist it
+func (t *TaskInstance) SetCallback(cb *ExternalCallback) error {
+	t.Callback = cb
+	if t.Patch == nil {
+		return nil
+	}
+	return t.Patch(&TaskInstance{BaseInfo: t.BaseInfo, Callback: cb})
+}
+
+// SetSensor record the state of sensor and persist it
+func (t *TaskInstance) SetSensor(s *SensorState) error {
+	t.Sensor = s
+	if t.Patch == nil {
+		return nil
+	}
+	return t.Patch(&TaskInstance{BaseInfo: t.BaseInfo, Sensor: s})
+}
+
+// DeclareDatasets merge datasets to lineage and persist it
+func (t *TaskInstance) DeclareDatasets(inputs, outputs []run.Dataset) error {
+	for _, ds := range append(append([]run.Dataset{}, inputs...), outputs...) {
+		if ds.Namespace == "" || ds.Name == "" {
+			return fmt.Errorf("namespace and name of dataset cannot be empty")
+		}
+	}
+	if t.Lineage == nil {
+		t.Lineage = &run.Lineage{}
+	}
+	t.Lineage.Merge(inputs, outputs)
+	if t.Patch == nil {
+		return nil
+	}
+	return t.Patch(&TaskInstance{BaseInfo: t.BaseInfo, Lineage: t.Lineage})
+}
+
+// GetArtifact
+func (t *TaskInstance) GetArtifact(name string) (*run.Artifact, bool) {
+	for i := range t.Artifacts {
+		if t.Artifacts[i].Name == name {
+			return &t.Artifacts[i], true
+		}
+	}
+	return nil, false
+}
+
 // DoPreCheck
 func (t *TaskInstance) DoPreCheck(dagIns *DagInstance) (isActive bool, err error) {
 	if t.PreChecks == nil {
@@ -331,6 +837,49 @@ func (t *TaskInstance) DoPreCheck(dagIns *DagInstance) (isActive bool, err error
 	return
 }
 
+// SkipManually mark the blocked or failed task as skipped by operator, so its downstream tasks can proceed.
+// It returns false when the task is in other status.
+func (t *TaskInstance) SkipManually(operator, reason string) bool {
+	if t.Status != TaskInstanceStatusBlocked && t.Status != TaskInstanceStatusFailed &&
+		t.Status != TaskInstanceStatusInvalidParams {
+		return false
+	}
+	t.ManualSkip = &ManualSkip{
+		Operator:  operator,
+		Reason:    reason,
+		From:      t.Status,
+		SkippedAt: time.Now().Unix(),
+	}
+	t.Status = TaskInstanceStatusSkipped
+	t.Reason = fmt.Sprintf("skipped manually by %s", operator)
+	if reason != "" {
+		t.Reason += ": " + reason
+	}
+	t.BranchSkipped = false
+	return true
+}
+
+// DoDependOnCheck skip the task when its branch is not taken, which means its depend on condition is not met,
+// or all of its upstream tasks are skipped by branch. It returns true if the task is skipped.
+func (t *TaskInstance) DoDependOnCheck(dagIns *DagInstance, upstreamSkipped bool) bool {
+	reason := ""
+	if upstreamSkipped {
+		reason = "all upstream tasks are skipped by branch"
+	}
+	for i := 0; reason == "" && i < len(t.DependOnCondition); i++ {
+		if c := t.DependOnCondition[i]; !c.IsMeet(dagIns) {
+			reason = fmt.Sprintf("depend on condition of %s[%s] is not met", c.Source, c.Key)
+		}
+	}
+	if reason == "" {
+		return false
+	}
+	t.Status = TaskInstanceStatusSkipped
+	t.Reason = reason
+	t.BranchSkipped = true
+	return true
+}
+
 // TaskInstanceStatus
 type TaskInstanceStatus string
 
@@ -345,4 +894,9 @@ const (
 	TaskInstanceStatusBlocked  TaskInstanceStatus = "blocked"
 	TaskInstanceStatusContinue TaskInstanceStatus = "continue"
 	TaskInstanceStatusSkipped  TaskInstanceStatus = "skipped"
+	// TaskInstanceStatusQueued means the task is waiting for a slot of its pool
+	TaskInstanceStatusQueued TaskInstanceStatus = "queued"
+	// TaskInstanceStatusInvalidParams means the params cannot be decoded or validated, so the action did not run,
+	// it is a failure like TaskInstanceStatusFailed but never retried automatically
+	TaskInstanceStatusInvalidParams TaskInstanceStatus = "invalidParams"
 )
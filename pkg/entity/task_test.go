@@ -1,12 +1,15 @@
 package entity
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/etherealiy/fastflow/pkg/entity/run"
+	"github.com/etherealiy/fastflow/pkg/utils/data"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -313,6 +316,11 @@ func TestTaskInstance_Run(t *testing.T) {
 			tc.giveTask.Patch = func(instance *TaskInstance) error {
 				st := *instance
 				st.Patch = nil
+				// time used depends on the machine, just check it is recorded when succeeded
+				if st.Status == TaskInstanceStatusSuccess {
+					assert.NotEmpty(t, st.TimeUsed)
+					st.TimeUsed = ""
+				}
 				saveTasks = append(saveTasks, st)
 				return nil
 			}
@@ -698,3 +706,627 @@ func TestTaskInstance_DoPreCheck(t *testing.T) {
 		})
 	}
 }
+
+func TestTaskInstance_DoDependOnCheck(t *testing.T) {
+	cond := TaskCondition{
+		Source: TaskConditionSourceShareData,
+		Key:    "route",
+		Values: []string{"left"},
+		Op:     OperatorIn,
+	}
+	tests := []struct {
+		caseDesc            string
+		giveTaskIns         *TaskInstance
+		giveUpstreamSkipped bool
+		wantRet             bool
+		wantTaskIns         *TaskInstance
+	}{
+		{
+			caseDesc:    "condition met",
+			giveTaskIns: &TaskInstance{Status: TaskInstanceStatusInit, DependOnCondition: []TaskCondition{cond}},
+			wantRet:     false,
+			wantTaskIns: &TaskInstance{Status: TaskInstanceStatusInit, DependOnCondition: []TaskCondition{cond}},
+		},
+		{
+			caseDesc: "condition not met",
+			giveTaskIns: &TaskInstance{Status: TaskInstanceStatusInit, DependOnCondition: []TaskCondition{
+				{Source: TaskConditionSourceShareData, Key: "route", Values: []string{"right"}, Op: OperatorIn},
+			}},
+			wantRet: true,
+			wantTaskIns: &TaskInstance{
+				Status: TaskInstanceStatusSkipped,
+				Reason: "depend on condition of share-data[route] is not met",
+				DependOnCondition: []TaskCondition{
+					{Source: TaskConditionSourceShareData, Key: "route", Values: []string{"right"}, Op: OperatorIn},
+				},
+				BranchSkipped: true,
+			},
+		},
+		{
+			caseDesc:            "upstream skipped by branch",
+			giveTaskIns:         &TaskInstance{Status: TaskInstanceStatusInit},
+			giveUpstreamSkipped: true,
+			wantRet:             true,
+			wantTaskIns: &TaskInstance{
+				Status:        TaskInstanceStatusSkipped,
+				Reason:        "all upstream tasks are skipped by branch",
+				BranchSkipped: true,
+			},
+		},
+		{
+			caseDesc:    "no condition",
+			giveTaskIns: &TaskInstance{Status: TaskInstanceStatusInit},
+			wantRet:     false,
+			wantTaskIns: &TaskInstance{Status: TaskInstanceStatusInit},
+		},
+	}
+
+	dagIns := &DagInstance{ShareData: &ShareData{Dict: map[string]string{"route": "left"}}}
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			assert.Equal(t, tc.wantRet, tc.giveTaskIns.DoDependOnCheck(dagIns, tc.giveUpstreamSkipped))
+			assert.Equal(t, tc.wantTaskIns, tc.giveTaskIns)
+		})
+	}
+}
+
+func TestTaskInstance_SkipManually(t *testing.T) {
+	tests := []struct {
+		caseDesc    string
+		giveTaskIns *TaskInstance
+		giveReason  string
+		wantRet     bool
+		wantTaskIns *TaskInstance
+	}{
+		{
+			caseDesc:    "failed",
+			giveTaskIns: &TaskInstance{Status: TaskInstanceStatusFailed, Reason: "timeout"},
+			giveReason:  "flaky",
+			wantRet:     true,
+			wantTaskIns: &TaskInstance{
+				Status:     TaskInstanceStatusSkipped,
+				Reason:     "skipped manually by alice: flaky",
+				ManualSkip: &ManualSkip{Operator: "alice", Reason: "flaky", From: TaskInstanceStatusFailed},
+			},
+		},
+		{
+			caseDesc:    "blocked without reason",
+			giveTaskIns: &TaskInstance{Status: TaskInstanceStatusBlocked},
+			wantRet:     true,
+			wantTaskIns: &TaskInstance{
+				Status:     TaskInstanceStatusSkipped,
+				Reason:     "skipped manually by alice",
+				ManualSkip: &ManualSkip{Operator: "alice", From: TaskInstanceStatusBlocked},
+			},
+		},
+		{
+			caseDesc:    "invalid params",
+			giveTaskIns: &TaskInstance{Status: TaskInstanceStatusInvalidParams},
+			wantRet:     true,
+			wantTaskIns: &TaskInstance{
+				Status:     TaskInstanceStatusSkipped,
+				Reason:     "skipped manually by alice",
+				ManualSkip: &ManualSkip{Operator: "alice", From: TaskInstanceStatusInvalidParams},
+			},
+		},
+		{
+			caseDesc:    "running",
+			giveTaskIns: &TaskInstance{Status: TaskInstanceStatusRunning},
+			wantRet:     false,
+			wantTaskIns: &TaskInstance{Status: TaskInstanceStatusRunning},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			assert.Equal(t, tc.wantRet, tc.giveTaskIns.SkipManually("alice", tc.giveReason))
+			if tc.giveTaskIns.ManualSkip != nil {
+				assert.NotZero(t, tc.giveTaskIns.ManualSkip.SkippedAt)
+				tc.giveTaskIns.ManualSkip.SkippedAt = 0
+			}
+			assert.Equal(t, tc.wantTaskIns, tc.giveTaskIns)
+		})
+	}
+}
+
+func TestTaskInstance_RecordAttempt(t *testing.T) {
+	taskIns := &TaskInstance{
+		Status: TaskInstanceStatusRunning,
+		Traces: []TraceInfo{{Message: "trace"}},
+	}
+	begin := time.Now()
+	assert.False(t, taskIns.RecordAttempt("worker-1", begin))
+	assert.Empty(t, taskIns.Attempts)
+
+	taskIns.Status = TaskInstanceStatusFailed
+	taskIns.Reason = "failed"
+	taskIns.bufTraces = []TraceInfo{{Message: "buf-trace"}}
+	assert.True(t, taskIns.RecordAttempt("worker-1", begin))
+
+	taskIns.Status = TaskInstanceStatusSuccess
+	taskIns.Reason = ""
+	taskIns.Traces = nil
+	taskIns.bufTraces = nil
+	taskIns.TimeUsed = "1.000s"
+	assert.True(t, taskIns.RecordAttempt("worker-2", begin))
+
+	for i := range taskIns.Attempts {
+		assert.Equal(t, begin.Unix(), taskIns.Attempts[i].StartedAt)
+		assert.GreaterOrEqual(t, taskIns.Attempts[i].EndedAt, begin.Unix())
+		taskIns.Attempts[i].StartedAt, taskIns.Attempts[i].EndedAt = 0, 0
+	}
+	assert.Equal(t, []TaskAttempt{
+		{
+			Attempt: 1,
+			Worker:  "worker-1",
+			Status:  TaskInstanceStatusFailed,
+			Reason:  "failed",
+			Traces:  []TraceInfo{{Message: "trace"}, {Message: "buf-trace"}},
+		},
+		{
+			Attempt:  2,
+			Worker:   "worker-2",
+			Status:   TaskInstanceStatusSuccess,
+			TimeUsed: "1.000s",
+		},
+	}, taskIns.Attempts)
+}
+
+func TestTaskInstance_RegisterArtifact(t *testing.T) {
+	var patched []run.Artifact
+	taskIns := &TaskInstance{
+		BaseInfo: BaseInfo{ID: "task-ins"},
+		Patch: func(instance *TaskInstance) error {
+			assert.Equal(t, "task-ins", instance.ID)
+			patched = instance.Artifacts
+			return nil
+		},
+	}
+
+	tests := []struct {
+		caseDesc      string
+		giveArtifact  run.Artifact
+		wantErr       bool
+		wantArtifacts []run.Artifact
+	}{
+		{
+			caseDesc:     "empty name",
+			giveArtifact: run.Artifact{URI: "file:///tmp/report.html"},
+			wantErr:      true,
+		},
+		{
+			caseDesc:     "empty uri",
+			giveArtifact: run.Artifact{Name: "report"},
+			wantErr:      true,
+		},
+		{
+			caseDesc:     "normal",
+			giveArtifact: run.Artifact{Name: "report", URI: "file:///tmp/report.html", CreatedAt: 1},
+			wantArtifacts: []run.Artifact{
+				{Name: "report", URI: "file:///tmp/report.html", CreatedAt: 1},
+			},
+		},
+		{
+			caseDesc:     "another",
+			giveArtifact: run.Artifact{Name: "log", URI: "s3://bucket/log.txt", CreatedAt: 1},
+			wantArtifacts: []run.Artifact{
+				{Name: "report", URI: "file:///tmp/report.html", CreatedAt: 1},
+				{Name: "log", URI: "s3://bucket/log.txt", CreatedAt: 1},
+			},
+		},
+		{
+			caseDesc:     "replace",
+			giveArtifact: run.Artifact{Name: "report", URI: "file:///tmp/report-v2.html", CreatedAt: 2},
+			wantArtifacts: []run.Artifact{
+				{Name: "report", URI: "file:///tmp/report-v2.html", CreatedAt: 2},
+				{Name: "log", URI: "s3://bucket/log.txt", CreatedAt: 1},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			err := taskIns.RegisterArtifact(tc.giveArtifact)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantArtifacts, taskIns.Artifacts)
+			assert.Equal(t, tc.wantArtifacts, patched)
+		})
+	}
+
+	ret, ok := taskIns.GetArtifact("log")
+	assert.True(t, ok)
+	assert.Equal(t, "s3://bucket/log.txt", ret.URI)
+	_, ok = taskIns.GetArtifact("not-existed")
+	assert.False(t, ok)
+}
+
+func TestShareDataSnapshot_ChangedKeys(t *testing.T) {
+	tests := []struct {
+		caseDesc     string
+		giveSnapshot *ShareDataSnapshot
+		wantKeys     []string
+	}{
+		{
+			caseDesc:     "no change",
+			giveSnapshot: &ShareDataSnapshot{Before: map[string]string{"a": "1"}, After: map[string]string{"a": "1"}},
+		},
+		{
+			caseDesc: "added, modified and removed",
+			giveSnapshot: &ShareDataSnapshot{
+				Before: map[string]string{"a": "1", "b": "2", "c": "3"},
+				After:  map[string]string{"a": "1", "b": "bad", "d": "4"},
+			},
+			wantKeys: []string{"b", "c", "d"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			assert.Equal(t, tc.wantKeys, tc.giveSnapshot.ChangedKeys())
+		})
+	}
+}
+
+func TestTaskInstance_DeclareDatasets(t *testing.T) {
+	var patched *run.Lineage
+	taskIns := &TaskInstance{
+		BaseInfo: BaseInfo{ID: "task-ins"},
+		Patch: func(instance *TaskInstance) error {
+			patched = instance.Lineage
+			return nil
+		},
+	}
+
+	tests := []struct {
+		caseDesc    string
+		giveInputs  []run.Dataset
+		giveOutputs []run.Dataset
+		wantErr     bool
+		wantLineage *run.Lineage
+	}{
+		{
+			caseDesc:   "empty name",
+			giveInputs: []run.Dataset{{Namespace: "postgres://db:5432"}},
+			wantErr:    true,
+		},
+		{
+			caseDesc:    "normal",
+			giveInputs:  []run.Dataset{{Namespace: "postgres://db:5432", Name: "public.orders"}},
+			giveOutputs: []run.Dataset{{Namespace: "s3://bucket", Name: "orders.parquet"}},
+			wantLineage: &run.Lineage{
+				Inputs:  []run.Dataset{{Namespace: "postgres://db:5432", Name: "public.orders"}},
+				Outputs: []run.Dataset{{Namespace: "s3://bucket", Name: "orders.parquet"}},
+			},
+		},
+		{
+			caseDesc: "merge",
+			giveOutputs: []run.Dataset{
+				{Namespace: "s3://bucket", Name: "orders.parquet", Facets: map[string]interface{}{"rows": 1}},
+				{Namespace: "s3://bucket", Name: "users.parquet"},
+			},
+			wantLineage: &run.Lineage{
+				Inputs: []run.Dataset{{Namespace: "postgres://db:5432", Name: "public.orders"}},
+				Outputs: []run.Dataset{
+					{Namespace: "s3://bucket", Name: "orders.parquet", Facets: map[string]interface{}{"rows": 1}},
+					{Namespace: "s3://bucket", Name: "users.parquet"},
+				},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			err := taskIns.DeclareDatasets(tc.giveInputs, tc.giveOutputs)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantLineage, taskIns.Lineage)
+			assert.Equal(t, tc.wantLineage, patched)
+		})
+	}
+}
+
+func TestRateLimit_Parse(t *testing.T) {
+	tests := []struct {
+		caseDesc   string
+		giveLimit  *RateLimit
+		wantLimit  int
+		wantWindow time.Duration
+		wantErr    string
+	}{
+		{
+			caseDesc:   "per second",
+			giveLimit:  &RateLimit{Key: "vendor-api", Rate: "10/s"},
+			wantLimit:  10,
+			wantWindow: time.Second,
+		},
+		{
+			caseDesc:   "per duration",
+			giveLimit:  &RateLimit{Key: "vendor-api", Rate: "100 / 10m"},
+			wantLimit:  100,
+			wantWindow: 10 * time.Minute,
+		},
+		{
+			caseDesc:  "no key",
+			giveLimit: &RateLimit{Rate: "10/s"},
+			wantErr:   "rate limit key cannot be empty",
+		},
+		{
+			caseDesc:  "invalid count",
+			giveLimit: &RateLimit{Key: "vendor-api", Rate: "0/s"},
+			wantErr:   `rate "0/s" is invalid, the count must be a positive integer`,
+		},
+		{
+			caseDesc:  "invalid unit",
+			giveLimit: &RateLimit{Key: "vendor-api", Rate: "10/d"},
+			wantErr:   `rate "10/d" is invalid, the unit must be s, m, h or a positive duration`,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			limit, window, err := tc.giveLimit.Parse()
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantLimit, limit)
+			assert.Equal(t, tc.wantWindow, window)
+		})
+	}
+}
+
+func TestMapOver_Items(t *testing.T) {
+	tests := []struct {
+		caseDesc  string
+		giveValue string
+		wantItems []string
+		wantErr   string
+	}{
+		{
+			caseDesc:  "json array",
+			giveValue: `["a.txt", 1, {"k":"v"}]`,
+			wantItems: []string{"a.txt", "1", `{"k":"v"}`},
+		},
+		{
+			caseDesc:  "comma separated",
+			giveValue: " shard-1, shard-2 ,,",
+			wantItems: []string{"shard-1", "shard-2"},
+		},
+		{
+			caseDesc:  "empty",
+			giveValue: "[]",
+			wantItems: []string{},
+		},
+		{
+			caseDesc:  "invalid json",
+			giveValue: "[1,",
+			wantErr:   "map over share-data[files] is not a valid json array: unexpected end of JSON input",
+		},
+	}
+
+	m := &MapOver{Source: TaskConditionSourceShareData, Key: "files"}
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			items, err := m.Items(&DagInstance{ShareData: &ShareData{Dict: map[string]string{"files": tc.giveValue}}})
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantItems, items)
+		})
+	}
+
+	_, err := m.Items(&DagInstance{ShareData: &ShareData{}})
+	assert.EqualError(t, err, "map over share-data[files] is not found")
+}
+
+func TestTaskInstance_NewMappedTaskInstance(t *testing.T) {
+	taskIns := &TaskInstance{
+		BaseInfo:   BaseInfo{ID: "ins"},
+		TaskID:     "process",
+		DagInsID:   "dag-ins",
+		Name:       "process {{file}}",
+		DependOn:   []string{"list"},
+		ActionName: "act",
+		Params:     map[string]interface{}{"path": "/data/{{file}}", "nested": []interface{}{"{{file}}"}},
+		Env:        []EnvVar{{Name: "FILE", Value: "{{file}}"}},
+		Status:     TaskInstanceStatusInit,
+		MapOver:    &MapOver{Source: TaskConditionSourceShareData, Key: "files", As: "file"},
+		MapItems:   []string{"a.txt", "b.txt"},
+	}
+	ins, err := taskIns.NewMappedTaskInstance(1)
+	assert.NoError(t, err)
+	assert.Equal(t, &TaskInstance{
+		BaseInfo:   BaseInfo{ID: "ins-1"},
+		TaskID:     "process[1]",
+		DagInsID:   "dag-ins",
+		Name:       "process b.txt",
+		DependOn:   []string{"list"},
+		ActionName: "act",
+		Params:     map[string]interface{}{"path": "/data/b.txt", "nested": []interface{}{"b.txt"}},
+		Env:        []EnvVar{{Name: "FILE", Value: "b.txt"}},
+		Status:     TaskInstanceStatusInit,
+		MappedFrom: "process",
+	}, ins)
+	assert.Equal(t, "/data/{{file}}", taskIns.Params["path"], "template should not be modified")
+}
+
+func TestRetryPolicy_Validate(t *testing.T) {
+	tests := []struct {
+		caseDesc   string
+		givePolicy *RetryPolicy
+		wantErr    string
+	}{
+		{
+			caseDesc:   "normal",
+			givePolicy: &RetryPolicy{MaxAttempts: 3, Backoff: RetryBackoffExponential, Jitter: 0.2, RetryOn: []RetryOn{RetryOnTimeout}},
+		},
+		{
+			caseDesc:   "invalid backoff",
+			givePolicy: &RetryPolicy{MaxAttempts: 3, Backoff: "linear"},
+			wantErr:    `retry backoff "linear" is invalid, it should be fixed or exponential`,
+		},
+		{
+			caseDesc:   "invalid jitter",
+			givePolicy: &RetryPolicy{MaxAttempts: 3, Jitter: 1.5},
+			wantErr:    "retry jitter must be in [0, 1]",
+		},
+		{
+			caseDesc:   "invalid retry on",
+			givePolicy: &RetryPolicy{MaxAttempts: 3, RetryOn: []RetryOn{"panic"}},
+			wantErr:    `retry on "panic" is invalid, it should be all, timeout or transient`,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			err := tc.givePolicy.Validate()
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestRetryPolicy_ShouldRetry(t *testing.T) {
+	tests := []struct {
+		caseDesc     string
+		givePolicy   *RetryPolicy
+		giveRetries  int
+		giveErr      error
+		giveTimedOut bool
+		wantRetry    bool
+	}{
+		{
+			caseDesc:    "retry all errors",
+			givePolicy:  &RetryPolicy{MaxAttempts: 3},
+			giveRetries: 1,
+			giveErr:     errors.New("failed"),
+			wantRetry:   true,
+		},
+		{
+			caseDesc:    "attempts exhausted",
+			givePolicy:  &RetryPolicy{MaxAttempts: 3},
+			giveRetries: 2,
+			giveErr:     errors.New("failed"),
+		},
+		{
+			caseDesc:     "timeout",
+			givePolicy:   &RetryPolicy{MaxAttempts: 3, RetryOn: []RetryOn{RetryOnTimeout}},
+			giveErr:      fmt.Errorf("run failed: %w", context.Canceled),
+			giveTimedOut: true,
+			wantRetry:    true,
+		},
+		{
+			caseDesc:   "transient",
+			givePolicy: &RetryPolicy{MaxAttempts: 3, RetryOn: []RetryOn{RetryOnTimeout, RetryOnTransient}},
+			giveErr:    fmt.Errorf("run failed: %w", data.Transient(errors.New("connection reset"))),
+			wantRetry:  true,
+		},
+		{
+			caseDesc:   "not retryable error",
+			givePolicy: &RetryPolicy{MaxAttempts: 3, RetryOn: []RetryOn{RetryOnTimeout, RetryOnTransient}},
+			giveErr:    errors.New("invalid params"),
+		},
+		{
+			caseDesc:    "params are invalid",
+			givePolicy:  &RetryPolicy{MaxAttempts: 3},
+			giveRetries: 1,
+			giveErr:     fmt.Errorf("run failed: %w", run.InvalidParams(errors.New("url cannot be empty"))),
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			assert.Equal(t, tc.wantRetry, tc.givePolicy.ShouldRetry(tc.giveRetries, tc.giveErr, tc.giveTimedOut))
+		})
+	}
+}
+
+func TestRetryPolicy_Interval(t *testing.T) {
+	tests := []struct {
+		caseDesc     string
+		givePolicy   *RetryPolicy
+		giveRetry    int
+		giveRandom   float64
+		wantInterval time.Duration
+	}{
+		{
+			caseDesc:     "default interval",
+			givePolicy:   &RetryPolicy{MaxAttempts: 3},
+			giveRetry:    2,
+			wantInterval: time.Second,
+		},
+		{
+			caseDesc:     "exponential",
+			givePolicy:   &RetryPolicy{MaxAttempts: 5, Backoff: RetryBackoffExponential, IntervalSecs: 2},
+			giveRetry:    3,
+			wantInterval: 8 * time.Second,
+		},
+		{
+			caseDesc:     "limited by max interval",
+			givePolicy:   &RetryPolicy{MaxAttempts: 5, Backoff: RetryBackoffExponential, IntervalSecs: 2, MaxIntervalSecs: 5},
+			giveRetry:    3,
+			wantInterval: 5 * time.Second,
+		},
+		{
+			caseDesc:     "jitter",
+			givePolicy:   &RetryPolicy{MaxAttempts: 3, IntervalSecs: 10, Jitter: 0.2},
+			giveRetry:    1,
+			giveRandom:   0.75,
+			wantInterval: 11 * time.Second,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			interval := tc.givePolicy.Interval(tc.giveRetry, func() float64 { return tc.giveRandom })
+			assert.Equal(t, tc.wantInterval, interval)
+		})
+	}
+}
+
+func TestExternalCallback(t *testing.T) {
+	taskIns := &TaskInstance{
+		BaseInfo: BaseInfo{ID: "task.ins1"},
+		Attempts: []TaskAttempt{{Attempt: 1}},
+	}
+	cb, token, err := NewExternalCallback(taskIns, time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, cb.Attempt)
+	assert.False(t, cb.Expired(time.Now()))
+	assert.True(t, cb.Expired(time.Now().Add(2*time.Hour)))
+	assert.NotContains(t, cb.TokenHash, strings.TrimPrefix(token, "task.ins1."))
+
+	tests := []struct {
+		caseDesc   string
+		giveToken  string
+		wantID     string
+		wantParsed bool
+		wantValid  bool
+	}{
+		{caseDesc: "valid", giveToken: token, wantID: "task.ins1", wantParsed: true, wantValid: true},
+		{caseDesc: "wrong secret", giveToken: "task.ins1.secret", wantID: "task.ins1", wantParsed: true},
+		{caseDesc: "no secret", giveToken: "task.ins1."},
+		{caseDesc: "no id", giveToken: "secret"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			id, ok := ParseCallbackToken(tc.giveToken)
+			assert.Equal(t, tc.wantParsed, ok)
+			assert.Equal(t, tc.wantID, id)
+			assert.Equal(t, tc.wantValid, cb.Verify(tc.giveToken))
+		})
+	}
+
+	assert.NoError(t, cb.Complete(false, "ops", "not now"))
+	assert.Equal(t, TaskInstanceStatusFailed, cb.Result)
+	assert.EqualError(t, cb.Complete(true, "admin", ""), "callback is already completed by ops")
+}
@@ -5,6 +5,7 @@ import "github.com/etherealiy/fastflow/pkg/entity"
 const (
 	KeyDagInstanceUpdated = "DagInstanceUpdated"
 	KeyDagInstancePatched = "DagInstancePatched"
+	KeyDagInstanceChanged = "DagInstanceChanged"
 
 	KeyTaskCompleted = "TaskCompleted"
 	KeyTaskBegin     = "TaskBegin"
@@ -12,6 +13,12 @@ const (
 	KeyLeaderChanged                = "LeaderChanged"
 	KeyDispatchInitDagInsCompleted  = "DispatchInitDagInsCompleted"
 	KeyParseScheduleDagInsCompleted = "ParseScheduleDagInsCompleted"
+	KeyRebalanceDagInsCompleted     = "RebalanceDagInsCompleted"
+	KeyDagInstanceReassigned        = "DagInstanceReassigned"
+	KeyClusterConfigChanged         = "ClusterConfigChanged"
+	KeyStandbyChanged               = "StandbyChanged"
+	KeyWorkerDrained                = "WorkerDrained"
+	KeySLAMissed                    = "SLAMissed"
 )
 
 // DagInstanceUpdated will raise when dag instance he updated
@@ -35,6 +42,20 @@ func (e *DagInstancePatched) Topic() []string {
 	return []string{KeyDagInstancePatched}
 }
 
+// DagInstanceChanged will raise when the store is notified that a dag instance is changed by any worker,
+// it is only raised by the stores which propagate changes, such as postgres store with listen
+type DagInstanceChanged struct {
+	DagInsID string                   `json:"id"`
+	Status   entity.DagInstanceStatus `json:"status"`
+	Worker   string                   `json:"worker"`
+	Revision int64                    `json:"revision"`
+}
+
+// Topic
+func (e *DagInstanceChanged) Topic() []string {
+	return []string{KeyDagInstanceChanged}
+}
+
 // TaskCompleted will raise when executor completed a task instance,
 type TaskCompleted struct {
 	TaskIns *entity.TaskInstance
@@ -87,3 +108,72 @@ type ParseScheduleDagInsCompleted struct {
 func (e *ParseScheduleDagInsCompleted) Topic() []string {
 	return []string{KeyParseScheduleDagInsCompleted}
 }
+
+// RebalanceDagInsCompleted will raise when leader completed a round of rebalancing dag instances between workers
+type RebalanceDagInsCompleted struct {
+	// Moved is the count of dag instances which are moved to other workers
+	Moved     int
+	ElapsedMs int64
+	Error     error
+}
+
+// Topic
+func (e *RebalanceDagInsCompleted) Topic() []string {
+	return []string{KeyRebalanceDagInsCompleted}
+}
+
+// DagInstanceReassigned will raise when a dag instance is moved to another worker
+type DagInstanceReassigned struct {
+	DagInsID   string
+	FromWorker string
+	ToWorker   string
+	Reason     string
+}
+
+// Topic
+func (e *DagInstanceReassigned) Topic() []string {
+	return []string{KeyDagInstanceReassigned}
+}
+
+// ClusterConfigChanged will raise when the runtime cluster config observed by current worker changed
+type ClusterConfigChanged struct {
+	Config *entity.ClusterConfig
+}
+
+// Topic
+func (e *ClusterConfigChanged) Topic() []string {
+	return []string{KeyClusterConfigChanged}
+}
+
+// StandbyChanged will raise when current worker enter standby mode or is promoted to active
+type StandbyChanged struct {
+	Standby bool
+}
+
+// Topic
+func (e *StandbyChanged) Topic() []string {
+	return []string{KeyStandbyChanged}
+}
+
+// WorkerDrained will raise when current worker finished its running task instances after draining
+type WorkerDrained struct {
+	WorkerKey string
+	ElapsedMs int64
+}
+
+// Topic
+func (e *WorkerDrained) Topic() []string {
+	return []string{KeyWorkerDrained}
+}
+
+// SLAMissed will raise by leader once for each SLA which is missed by an unfinished dag instance or its task,
+// the dag instance keeps running
+type SLAMissed struct {
+	DagIns *entity.DagInstance
+	SLA    entity.SLA
+}
+
+// Topic
+func (e *SLAMissed) Topic() []string {
+	return []string{KeySLAMissed}
+}
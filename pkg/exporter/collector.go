@@ -3,6 +3,7 @@ package exporter
 import (
 	"context"
 	"net/http"
+	"sync"
 	"sync/atomic"
 
 	"github.com/etherealiy/fastflow/pkg/entity"
@@ -24,6 +25,11 @@ var (
 		"The count of already failed task.",
 		[]string{"worker_key"}, nil,
 	)
+	invalidParamsTaskCountDesc = prometheus.NewDesc(
+		"fastflow_executor_task_invalid_params_total",
+		"The count of task failed by invalid params.",
+		[]string{"worker_key"}, nil,
+	)
 	successTaskCountDesc = prometheus.NewDesc(
 		"fastflow_executor_task_success_total",
 		"The count of already failed task.",
@@ -55,14 +61,20 @@ var (
 		"The count of parse scheduled dag instance failed.",
 		[]string{"worker_key"}, nil,
 	)
+	slaMissedCountDesc = prometheus.NewDesc(
+		"fastflow_sla_missed_total",
+		"The count of missed sla.",
+		[]string{"worker_key", "dag_id"}, nil,
+	)
 )
 
 // ExecutorCollector
 type ExecutorCollector struct {
-	RunningTaskCount   int64
-	SuccessTaskCount   uint64
-	FailedTaskCount    uint64
-	CompletedTaskCount uint64
+	RunningTaskCount       int64
+	SuccessTaskCount       uint64
+	FailedTaskCount        uint64
+	InvalidParamsTaskCount uint64
+	CompletedTaskCount     uint64
 
 	ParseElapsedMs   int64
 	ParseFailedCount int64
@@ -87,6 +99,8 @@ func (c *ExecutorCollector) Handle(cxt context.Context, e goevent.Event) {
 		switch completeEvent.TaskIns.Status {
 		case entity.TaskInstanceStatusFailed:
 			atomic.AddUint64(&c.FailedTaskCount, 1)
+		case entity.TaskInstanceStatusInvalidParams:
+			atomic.AddUint64(&c.InvalidParamsTaskCount, 1)
 		case entity.TaskInstanceStatusSuccess:
 			atomic.AddUint64(&c.SuccessTaskCount, 1)
 		}
@@ -125,6 +139,12 @@ func (c *ExecutorCollector) Collect(ch chan<- prometheus.Metric) {
 		float64(c.FailedTaskCount),
 		mod.GetKeeper().WorkerKey(),
 	)
+	ch <- prometheus.MustNewConstMetric(
+		invalidParamsTaskCountDesc,
+		prometheus.CounterValue,
+		float64(c.InvalidParamsTaskCount),
+		mod.GetKeeper().WorkerKey(),
+	)
 	ch <- prometheus.MustNewConstMetric(
 		successTaskCountDesc,
 		prometheus.CounterValue,
@@ -150,11 +170,15 @@ func (c *ExecutorCollector) Collect(ch chan<- prometheus.Metric) {
 type LeaderCollector struct {
 	DispatchElapsedMs   int64
 	DispatchFailedCount int64
+	// SLAMissedCount is the count of missed sla of each dag
+	SLAMissedCount map[string]int64
+
+	slaMutex sync.Mutex
 }
 
 // Topic is goevent's topic
 func (c *LeaderCollector) Topic() []string {
-	return []string{event.KeyDispatchInitDagInsCompleted}
+	return []string{event.KeyDispatchInitDagInsCompleted, event.KeySLAMissed}
 }
 
 // Handle is goevent's handler
@@ -165,6 +189,14 @@ func (c *LeaderCollector) Handle(cxt context.Context, e goevent.Event) {
 			atomic.AddInt64(&c.DispatchFailedCount, 1)
 		}
 	}
+	if slaEvent, ok := e.(*event.SLAMissed); ok {
+		c.slaMutex.Lock()
+		if c.SLAMissedCount == nil {
+			c.SLAMissedCount = map[string]int64{}
+		}
+		c.SLAMissedCount[slaEvent.DagIns.DagID]++
+		c.slaMutex.Unlock()
+	}
 }
 
 // Describe
@@ -186,6 +218,18 @@ func (c *LeaderCollector) Collect(ch chan<- prometheus.Metric) {
 		float64(c.DispatchFailedCount),
 		mod.GetKeeper().WorkerKey(),
 	)
+
+	c.slaMutex.Lock()
+	defer c.slaMutex.Unlock()
+	for dagID, cnt := range c.SLAMissedCount {
+		ch <- prometheus.MustNewConstMetric(
+			slaMissedCountDesc,
+			prometheus.CounterValue,
+			float64(cnt),
+			mod.GetKeeper().WorkerKey(),
+			dagID,
+		)
+	}
 }
 
 // HttpHandler used to handle metrics request
@@ -0,0 +1,346 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.4.0
+// - protoc             (unknown)
+// source: fastflow.proto
+
+package grpcapi
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.62.0 or later.
+const _ = grpc.SupportPackageIsVersion8
+
+const (
+	ControlPlane_SubmitDag_FullMethodName    = "/fastflow.v1.ControlPlane/SubmitDag"
+	ControlPlane_TriggerRun_FullMethodName   = "/fastflow.v1.ControlPlane/TriggerRun"
+	ControlPlane_WatchRun_FullMethodName     = "/fastflow.v1.ControlPlane/WatchRun"
+	ControlPlane_CancelRun_FullMethodName    = "/fastflow.v1.ControlPlane/CancelRun"
+	ControlPlane_RetryTask_FullMethodName    = "/fastflow.v1.ControlPlane/RetryTask"
+	ControlPlane_CompleteTask_FullMethodName = "/fastflow.v1.ControlPlane/CompleteTask"
+)
+
+// ControlPlaneClient is the client API for ControlPlane service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// ControlPlane control fastflow programmatically, a run is a dag instance
+type ControlPlaneClient interface {
+	// SubmitDag create or update the dag, the unchanged dag will not be written
+	SubmitDag(ctx context.Context, in *SubmitDagRequest, opts ...grpc.CallOption) (*SubmitDagResponse, error)
+	// TriggerRun run the dag with variables
+	TriggerRun(ctx context.Context, in *TriggerRunRequest, opts ...grpc.CallOption) (*Run, error)
+	// WatchRun stream the current status of run and its tasks, then the status transitions until the run
+	// is finished
+	WatchRun(ctx context.Context, in *WatchRunRequest, opts ...grpc.CallOption) (ControlPlane_WatchRunClient, error)
+	// CancelRun fail the unfinished run and cancel its unfinished tasks
+	CancelRun(ctx context.Context, in *CancelRunRequest, opts ...grpc.CallOption) (*Run, error)
+	// RetryTask retry the failed or canceled task
+	RetryTask(ctx context.Context, in *RetryTaskRequest, opts ...grpc.CallOption) (*Run, error)
+	// CompleteTask complete the task waiting for external callback by its callback token
+	CompleteTask(ctx context.Context, in *CompleteTaskRequest, opts ...grpc.CallOption) (*Run, error)
+}
+
+type controlPlaneClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewControlPlaneClient(cc grpc.ClientConnInterface) ControlPlaneClient {
+	return &controlPlaneClient{cc}
+}
+
+func (c *controlPlaneClient) SubmitDag(ctx context.Context, in *SubmitDagRequest, opts ...grpc.CallOption) (*SubmitDagResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SubmitDagResponse)
+	err := c.cc.Invoke(ctx, ControlPlane_SubmitDag_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *controlPlaneClient) TriggerRun(ctx context.Context, in *TriggerRunRequest, opts ...grpc.CallOption) (*Run, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Run)
+	err := c.cc.Invoke(ctx, ControlPlane_TriggerRun_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *controlPlaneClient) WatchRun(ctx context.Context, in *WatchRunRequest, opts ...grpc.CallOption) (ControlPlane_WatchRunClient, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &ControlPlane_ServiceDesc.Streams[0], ControlPlane_WatchRun_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &controlPlaneWatchRunClient{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type ControlPlane_WatchRunClient interface {
+	Recv() (*RunEvent, error)
+	grpc.ClientStream
+}
+
+type controlPlaneWatchRunClient struct {
+	grpc.ClientStream
+}
+
+func (x *controlPlaneWatchRunClient) Recv() (*RunEvent, error) {
+	m := new(RunEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *controlPlaneClient) CancelRun(ctx context.Context, in *CancelRunRequest, opts ...grpc.CallOption) (*Run, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Run)
+	err := c.cc.Invoke(ctx, ControlPlane_CancelRun_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *controlPlaneClient) RetryTask(ctx context.Context, in *RetryTaskRequest, opts ...grpc.CallOption) (*Run, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Run)
+	err := c.cc.Invoke(ctx, ControlPlane_RetryTask_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *controlPlaneClient) CompleteTask(ctx context.Context, in *CompleteTaskRequest, opts ...grpc.CallOption) (*Run, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Run)
+	err := c.cc.Invoke(ctx, ControlPlane_CompleteTask_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ControlPlaneServer is the server API for ControlPlane service.
+// All implementations must embed UnimplementedControlPlaneServer
+// for forward compatibility
+//
+// ControlPlane control fastflow programmatically, a run is a dag instance
+type ControlPlaneServer interface {
+	// SubmitDag create or update the dag, the unchanged dag will not be written
+	SubmitDag(context.Context, *SubmitDagRequest) (*SubmitDagResponse, error)
+	// TriggerRun run the dag with variables
+	TriggerRun(context.Context, *TriggerRunRequest) (*Run, error)
+	// WatchRun stream the current status of run and its tasks, then the status transitions until the run
+	// is finished
+	WatchRun(*WatchRunRequest, ControlPlane_WatchRunServer) error
+	// CancelRun fail the unfinished run and cancel its unfinished tasks
+	CancelRun(context.Context, *CancelRunRequest) (*Run, error)
+	// RetryTask retry the failed or canceled task
+	RetryTask(context.Context, *RetryTaskRequest) (*Run, error)
+	// CompleteTask complete the task waiting for external callback by its callback token
+	CompleteTask(context.Context, *CompleteTaskRequest) (*Run, error)
+	mustEmbedUnimplementedControlPlaneServer()
+}
+
+// UnimplementedControlPlaneServer must be embedded to have forward compatible implementations.
+type UnimplementedControlPlaneServer struct {
+}
+
+func (UnimplementedControlPlaneServer) SubmitDag(context.Context, *SubmitDagRequest) (*SubmitDagResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SubmitDag not implemented")
+}
+func (UnimplementedControlPlaneServer) TriggerRun(context.Context, *TriggerRunRequest) (*Run, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method TriggerRun not implemented")
+}
+func (UnimplementedControlPlaneServer) WatchRun(*WatchRunRequest, ControlPlane_WatchRunServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchRun not implemented")
+}
+func (UnimplementedControlPlaneServer) CancelRun(context.Context, *CancelRunRequest) (*Run, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CancelRun not implemented")
+}
+func (UnimplementedControlPlaneServer) RetryTask(context.Context, *RetryTaskRequest) (*Run, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RetryTask not implemented")
+}
+func (UnimplementedControlPlaneServer) CompleteTask(context.Context, *CompleteTaskRequest) (*Run, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CompleteTask not implemented")
+}
+func (UnimplementedControlPlaneServer) mustEmbedUnimplementedControlPlaneServer() {}
+
+// UnsafeControlPlaneServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ControlPlaneServer will
+// result in compilation errors.
+type UnsafeControlPlaneServer interface {
+	mustEmbedUnimplementedControlPlaneServer()
+}
+
+func RegisterControlPlaneServer(s grpc.ServiceRegistrar, srv ControlPlaneServer) {
+	s.RegisterService(&ControlPlane_ServiceDesc, srv)
+}
+
+func _ControlPlane_SubmitDag_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SubmitDagRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlPlaneServer).SubmitDag(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ControlPlane_SubmitDag_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlPlaneServer).SubmitDag(ctx, req.(*SubmitDagRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ControlPlane_TriggerRun_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TriggerRunRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlPlaneServer).TriggerRun(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ControlPlane_TriggerRun_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlPlaneServer).TriggerRun(ctx, req.(*TriggerRunRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ControlPlane_WatchRun_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRunRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ControlPlaneServer).WatchRun(m, &controlPlaneWatchRunServer{ServerStream: stream})
+}
+
+type ControlPlane_WatchRunServer interface {
+	Send(*RunEvent) error
+	grpc.ServerStream
+}
+
+type controlPlaneWatchRunServer struct {
+	grpc.ServerStream
+}
+
+func (x *controlPlaneWatchRunServer) Send(m *RunEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _ControlPlane_CancelRun_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CancelRunRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlPlaneServer).CancelRun(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ControlPlane_CancelRun_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlPlaneServer).CancelRun(ctx, req.(*CancelRunRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ControlPlane_RetryTask_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RetryTaskRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlPlaneServer).RetryTask(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ControlPlane_RetryTask_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlPlaneServer).RetryTask(ctx, req.(*RetryTaskRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ControlPlane_CompleteTask_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CompleteTaskRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlPlaneServer).CompleteTask(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ControlPlane_CompleteTask_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlPlaneServer).CompleteTask(ctx, req.(*CompleteTaskRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// ControlPlane_ServiceDesc is the grpc.ServiceDesc for ControlPlane service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var ControlPlane_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "fastflow.v1.ControlPlane",
+	HandlerType: (*ControlPlaneServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "SubmitDag",
+			Handler:    _ControlPlane_SubmitDag_Handler,
+		},
+		{
+			MethodName: "TriggerRun",
+			Handler:    _ControlPlane_TriggerRun_Handler,
+		},
+		{
+			MethodName: "CancelRun",
+			Handler:    _ControlPlane_CancelRun_Handler,
+		},
+		{
+			MethodName: "RetryTask",
+			Handler:    _ControlPlane_RetryTask_Handler,
+		},
+		{
+			MethodName: "CompleteTask",
+			Handler:    _ControlPlane_CompleteTask_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchRun",
+			Handler:       _ControlPlane_WatchRun_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "fastflow.proto",
+}
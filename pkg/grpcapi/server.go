@@ -0,0 +1,325 @@
+package grpcapi
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative fastflow.proto
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/api"
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/log"
+	"github.com/etherealiy/fastflow/pkg/mod"
+	"github.com/etherealiy/fastflow/pkg/utils/data"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	// register gzip, so the clients can compress the messages
+	_ "google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// DefaultWatchInterval is the default interval of polling the store when watching a run
+	DefaultWatchInterval = time.Second
+)
+
+// Server implement the control plane defined in fastflow.proto, it depends on the components of mod,
+// so you should serve it after fastflow init
+type Server struct {
+	UnimplementedControlPlaneServer
+
+	auth          api.Authenticator
+	watchInterval time.Duration
+}
+
+// NewServer
+func NewServer() *Server {
+	return &Server{watchInterval: DefaultWatchInterval}
+}
+
+// SetAuthenticator authenticate all calls by auth, the same as management api, nil means no authentication
+func (s *Server) SetAuthenticator(auth api.Authenticator) {
+	s.auth = auth
+}
+
+// SetWatchInterval set the interval of polling the store when watching a run, zero means default
+func (s *Server) SetWatchInterval(interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+	s.watchInterval = interval
+}
+
+// NewGRPCServer create a gRPC server serving s and the reflection service, the interceptors of authentication
+// and error conversion run before the ones in opts
+func (s *Server) NewGRPCServer(opts ...grpc.ServerOption) *grpc.Server {
+	opts = append([]grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(s.unaryInterceptor),
+		grpc.ChainStreamInterceptor(s.streamInterceptor),
+	}, opts...)
+	gs := grpc.NewServer(opts...)
+	RegisterControlPlaneServer(gs, s)
+	reflection.Register(gs)
+	return gs
+}
+
+func (s *Server) unaryInterceptor(
+	ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, toStatus(info.FullMethod, err)
+	}
+	resp, err := handler(ctx, req)
+	if err != nil {
+		return nil, toStatus(info.FullMethod, err)
+	}
+	return resp, nil
+}
+
+func (s *Server) streamInterceptor(
+	srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := s.authenticate(ss.Context())
+	if err != nil {
+		return toStatus(info.FullMethod, err)
+	}
+	return toStatus(info.FullMethod, handler(srv, &serverStream{ServerStream: ss, ctx: ctx}))
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+type userKey struct{}
+
+// authenticate call the authenticator with a request whose headers are the metadata, and put the user into ctx
+func (s *Server) authenticate(ctx context.Context) (context.Context, error) {
+	if s.auth == nil {
+		return ctx, nil
+	}
+	r := (&http.Request{Header: http.Header{}}).WithContext(ctx)
+	md, _ := metadata.FromIncomingContext(ctx)
+	for k, vs := range md {
+		for _, v := range vs {
+			r.Header.Add(k, v)
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		r.RemoteAddr = p.Addr.String()
+	}
+	user, err := s.auth.Authenticate(r)
+	if err != nil {
+		return nil, err
+	}
+	return context.WithValue(ctx, userKey{}, user), nil
+}
+
+func userFrom(ctx context.Context) string {
+	user, _ := ctx.Value(userKey{}).(string)
+	return user
+}
+
+// toStatus convert the error to status by its kind, the secret values may be contained in reason of dag instance
+// so the message is redacted
+func toStatus(method string, err error) error {
+	if err == nil {
+		return nil
+	}
+	st, ok := status.FromError(err)
+	if !ok {
+		st = status.New(codeOf(err), err.Error())
+	}
+	if st.Code() == codes.Unknown {
+		log.Errorf("grpc call %s failed: %s", method, err)
+	}
+	return status.Error(st.Code(), log.Redact(st.Message()))
+}
+
+func codeOf(err error) codes.Code {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return codes.DeadlineExceeded
+	case errors.Is(err, context.Canceled):
+		return codes.Canceled
+	case errors.Is(err, api.ErrUnauthorized):
+		return codes.Unauthenticated
+	case errors.Is(err, api.ErrForbidden):
+		return codes.PermissionDenied
+	case errors.Is(err, data.ErrDataInvalid):
+		return codes.InvalidArgument
+	case errors.Is(err, data.ErrDataNotFound):
+		return codes.NotFound
+	case errors.Is(err, data.ErrDataConflicted):
+		return codes.FailedPrecondition
+	case errors.Is(err, data.ErrStandby):
+		return codes.Unavailable
+	}
+	return codes.Unknown
+}
+
+// SubmitDag
+func (s *Server) SubmitDag(ctx context.Context, req *SubmitDagRequest) (*SubmitDagResponse, error) {
+	dag := &entity.Dag{}
+	if err := yaml.Unmarshal([]byte(req.Dag), dag); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "decode dag failed: %s", err)
+	}
+	if dag.ID == "" {
+		return nil, status.Error(codes.InvalidArgument, "dag id cannot be empty")
+	}
+	ret, err := mod.ApplyDags([]*entity.Dag{dag}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &SubmitDagResponse{DagId: dag.ID, Action: string(ret.Dags[0].Action)}, nil
+}
+
+// TriggerRun
+func (s *Server) TriggerRun(ctx context.Context, req *TriggerRunRequest) (*Run, error) {
+	var meta *entity.TriggerMeta
+	if user := userFrom(ctx); user != "" {
+		meta = &entity.TriggerMeta{User: user}
+	}
+	dagIns, err := mod.GetCommander().RunDag(req.DagId, req.Vars,
+		mod.RunDagTrigger(entity.TriggerManually, meta),
+		mod.RunDagLabels(req.Labels),
+		mod.RunDagIdempotencyKey(req.IdempotencyKey, 0))
+	if err != nil {
+		return nil, err
+	}
+	return newRun(dagIns, nil), nil
+}
+
+// CancelRun
+func (s *Server) CancelRun(ctx context.Context, req *CancelRunRequest) (*Run, error) {
+	reason := req.Reason
+	if user := userFrom(ctx); reason == "" && user != "" {
+		reason = "canceled by " + user
+	}
+	if err := mod.GetCommander().CancelDagIns(req.RunId, reason); err != nil {
+		return nil, err
+	}
+	return getRun(req.RunId)
+}
+
+// RetryTask
+func (s *Server) RetryTask(ctx context.Context, req *RetryTaskRequest) (*Run, error) {
+	taskIns, err := mod.GetStore().GetTaskIns(req.TaskInsId)
+	if err != nil {
+		return nil, err
+	}
+	if err := mod.GetCommander().RetryTask([]string{taskIns.ID}); err != nil {
+		return nil, err
+	}
+	return getRun(taskIns.DagInsID)
+}
+
+// CompleteTask
+func (s *Server) CompleteTask(ctx context.Context, req *CompleteTaskRequest) (*Run, error) {
+	outputs := map[string]interface{}{}
+	for k, v := range req.Outputs {
+		outputs[k] = v
+	}
+	taskIns, err := mod.CompleteCallback(req.Token, &mod.CallbackInput{
+		Status:   entity.TaskInstanceStatus(req.Status),
+		Reason:   req.Reason,
+		Operator: userFrom(ctx),
+		Outputs:  outputs,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return getRun(taskIns.DagInsID)
+}
+
+func getRun(dagInsID string) (*Run, error) {
+	dagIns, err := mod.GetStore().GetDagInstance(dagInsID)
+	if err != nil {
+		return nil, err
+	}
+	tasks, err := mod.GetStore().ListTaskInstance(&mod.ListTaskInstanceInput{DagInsID: dagInsID})
+	if err != nil {
+		return nil, err
+	}
+	return newRun(dagIns, tasks), nil
+}
+
+// WatchRun poll the store and send the changed status of run and tasks, the statuses of tasks are sent
+// before the run, so the last event is the finished run
+func (s *Server) WatchRun(req *WatchRunRequest, stream ControlPlane_WatchRunServer) error {
+	ticker := time.NewTicker(s.watchInterval)
+	defer ticker.Stop()
+	// sent is the last sent status and reason by task instance id, the run is keyed by empty id
+	sent := map[string]string{}
+	for {
+		dagIns, err := mod.GetStore().GetDagInstance(req.RunId)
+		if err != nil {
+			return err
+		}
+		tasks, err := mod.GetStore().ListTaskInstance(&mod.ListTaskInstanceInput{DagInsID: dagIns.ID})
+		if err != nil {
+			return err
+		}
+
+		now := time.Now().UnixMilli()
+		events := make([]*RunEvent, 0, len(tasks)+1)
+		for _, t := range tasks {
+			events = append(events, &RunEvent{RunId: dagIns.ID, TaskInsId: t.ID, TaskId: t.TaskID,
+				Status: string(t.Status), Reason: log.Redact(t.Reason), Time: now})
+		}
+		events = append(events, &RunEvent{RunId: dagIns.ID, Status: string(dagIns.Status),
+			Reason: log.Redact(dagIns.Reason), Time: now})
+		for _, e := range events {
+			state := e.Status + "\n" + e.Reason
+			if sent[e.TaskInsId] == state {
+				continue
+			}
+			if err := stream.Send(e); err != nil {
+				return err
+			}
+			sent[e.TaskInsId] = state
+		}
+
+		if dagIns.Status == entity.DagInstanceStatusSuccess || dagIns.Status == entity.DagInstanceStatusFailed {
+			return nil
+		}
+		select {
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// newRun convert dag instance and its tasks, the reasons are redacted since they may contain secret values
+func newRun(dagIns *entity.DagInstance, tasks []*entity.TaskInstance) *Run {
+	run := &Run{
+		Id:        dagIns.ID,
+		DagId:     dagIns.DagID,
+		Status:    string(dagIns.Status),
+		Reason:    log.Redact(dagIns.Reason),
+		Worker:    dagIns.Worker,
+		CreatedAt: dagIns.CreatedAt,
+		UpdatedAt: dagIns.UpdatedAt,
+	}
+	for _, t := range tasks {
+		run.Tasks = append(run.Tasks, &Task{
+			Id:     t.ID,
+			TaskId: t.TaskID,
+			Name:   t.Name,
+			Status: string(t.Status),
+			Reason: log.Redact(t.Reason),
+		})
+	}
+	return run
+}
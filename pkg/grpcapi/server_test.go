@@ -0,0 +1,327 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/api"
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/log"
+	"github.com/etherealiy/fastflow/pkg/mod"
+	"github.com/etherealiy/fastflow/pkg/utils/data"
+	"github.com/etherealiy/fastflow/store/memory"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+)
+
+// newTestClient serve s in memory and return the client connected to it
+func newTestClient(t *testing.T, s *Server) (ControlPlaneClient, func()) {
+	ln := bufconn.Listen(1 << 20)
+	gs := s.NewGRPCServer()
+	go func() {
+		_ = gs.Serve(ln)
+	}()
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return ln.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NoError(t, err)
+	return NewControlPlaneClient(conn), func() {
+		conn.Close()
+		gs.Stop()
+	}
+}
+
+func TestServer(t *testing.T) {
+	st := memory.NewStore()
+	mod.SetStore(st)
+	mod.SetCommander(&mod.DefCommander{})
+	mKeeper := &mod.MockKeeper{}
+	mKeeper.On("IsAlive", "worker-1").Return(true, nil)
+	mod.SetKeeper(mKeeper)
+
+	assert.NoError(t, st.CreateDagIns(&entity.DagInstance{
+		BaseInfo: entity.BaseInfo{ID: "running1"},
+		DagID:    "dag1",
+		Worker:   "worker-1",
+		Status:   entity.DagInstanceStatusRunning,
+	}))
+	assert.NoError(t, st.BatchCreatTaskIns([]*entity.TaskInstance{
+		{
+			BaseInfo: entity.BaseInfo{ID: "running-task-ins1"},
+			DagInsID: "running1",
+			TaskID:   "task1",
+			Status:   entity.TaskInstanceStatusRunning,
+		},
+	}))
+	assert.NoError(t, st.CreateDagIns(&entity.DagInstance{
+		BaseInfo: entity.BaseInfo{ID: "failed1"},
+		DagID:    "dag1",
+		Worker:   "worker-1",
+		Status:   entity.DagInstanceStatusFailed,
+	}))
+	assert.NoError(t, st.BatchCreatTaskIns([]*entity.TaskInstance{
+		{
+			BaseInfo: entity.BaseInfo{ID: "failed-task-ins1"},
+			DagInsID: "failed1",
+			TaskID:   "task1",
+			Status:   entity.TaskInstanceStatusFailed,
+		},
+	}))
+	assert.NoError(t, st.CreateDagIns(&entity.DagInstance{
+		BaseInfo: entity.BaseInfo{ID: "blocked1"},
+		DagID:    "dag1",
+		Worker:   "worker-1",
+		Status:   entity.DagInstanceStatusBlocked,
+	}))
+	blocked := &entity.TaskInstance{
+		BaseInfo: entity.BaseInfo{ID: "blocked-task-ins1"},
+		DagInsID: "blocked1",
+		TaskID:   "task1",
+		Status:   entity.TaskInstanceStatusBlocked,
+	}
+	cb, cbToken, err := entity.NewExternalCallback(blocked, time.Hour)
+	assert.NoError(t, err)
+	blocked.Callback = cb
+	assert.NoError(t, st.BatchCreatTaskIns([]*entity.TaskInstance{blocked}))
+
+	s := NewServer()
+	s.SetAuthenticator(api.AuthenticatorFunc(func(r *http.Request) (string, error) {
+		if r.Header.Get("Authorization") == "" {
+			return "", api.ErrUnauthorized
+		}
+		return "admin", nil
+	}))
+	client, closeFn := newTestClient(t, s)
+	defer closeFn()
+
+	tests := []struct {
+		caseDesc      string
+		giveCall      func(ctx context.Context) (proto.Message, error)
+		giveAnonymous bool
+		wantCode      codes.Code
+		wantMessage   string
+		wantResp      proto.Message
+	}{
+		{
+			caseDesc: "submit dag",
+			giveCall: func(ctx context.Context) (proto.Message, error) {
+				return client.SubmitDag(ctx, &SubmitDagRequest{Dag: "id: dag1\nname: dag1\ntasks:\n- id: task1\n  actionName: act\n"})
+			},
+			wantCode: codes.OK,
+			wantResp: &SubmitDagResponse{DagId: "dag1", Action: "created"},
+		},
+		{
+			caseDesc: "submit dag without id",
+			giveCall: func(ctx context.Context) (proto.Message, error) {
+				return client.SubmitDag(ctx, &SubmitDagRequest{Dag: `{"name": "dag1"}`})
+			},
+			wantCode:    codes.InvalidArgument,
+			wantMessage: "dag id cannot be empty",
+		},
+		{
+			caseDesc: "trigger run of not existed dag",
+			giveCall: func(ctx context.Context) (proto.Message, error) {
+				return client.TriggerRun(ctx, &TriggerRunRequest{DagId: "dag2"})
+			},
+			wantCode:    codes.NotFound,
+			wantMessage: "not found",
+		},
+		{
+			caseDesc: "retry task",
+			giveCall: func(ctx context.Context) (proto.Message, error) {
+				return client.RetryTask(ctx, &RetryTaskRequest{TaskInsId: "failed-task-ins1"})
+			},
+			wantCode: codes.OK,
+			wantResp: &Run{Id: "failed1", DagId: "dag1", Status: "failed", Worker: "worker-1"},
+		},
+		{
+			caseDesc: "cancel run",
+			giveCall: func(ctx context.Context) (proto.Message, error) {
+				return client.CancelRun(ctx, &CancelRunRequest{RunId: "running1"})
+			},
+			wantCode: codes.OK,
+			// the alive owner worker ends the run asynchronously
+			wantResp: &Run{Id: "running1", DagId: "dag1", Status: "running", Worker: "worker-1"},
+		},
+		{
+			caseDesc: "cancel run again",
+			giveCall: func(ctx context.Context) (proto.Message, error) {
+				return client.CancelRun(ctx, &CancelRunRequest{RunId: "running1"})
+			},
+			wantCode: codes.OK,
+			wantResp: &Run{Id: "running1", DagId: "dag1", Status: "running", Worker: "worker-1"},
+		},
+		{
+			caseDesc: "cancel finished run",
+			giveCall: func(ctx context.Context) (proto.Message, error) {
+				return client.CancelRun(ctx, &CancelRunRequest{RunId: "failed1"})
+			},
+			wantCode:    codes.FailedPrecondition,
+			wantMessage: "dag instance is failed, only the unfinished one can be canceled: data conflicted",
+		},
+		{
+			caseDesc: "complete task",
+			giveCall: func(ctx context.Context) (proto.Message, error) {
+				return client.CompleteTask(ctx, &CompleteTaskRequest{Token: cbToken, Status: "success", Outputs: map[string]string{"ticket": "OPS-1"}})
+			},
+			wantCode: codes.OK,
+			wantResp: &Run{Id: "blocked1", DagId: "dag1", Status: "blocked", Worker: "worker-1"},
+		},
+		{
+			caseDesc: "complete task again",
+			giveCall: func(ctx context.Context) (proto.Message, error) {
+				return client.CompleteTask(ctx, &CompleteTaskRequest{Token: cbToken, Status: "failed"})
+			},
+			wantCode:    codes.FailedPrecondition,
+			wantMessage: "callback is already completed by admin: data conflicted",
+		},
+		{
+			caseDesc: "complete task with invalid token",
+			giveCall: func(ctx context.Context) (proto.Message, error) {
+				return client.CompleteTask(ctx, &CompleteTaskRequest{Token: "blocked-task-ins1.secret", Status: "success"})
+			},
+			wantCode:    codes.NotFound,
+			wantMessage: "callback token is invalid",
+		},
+		{
+			caseDesc: "unauthenticated",
+			giveCall: func(ctx context.Context) (proto.Message, error) {
+				return client.RetryTask(ctx, &RetryTaskRequest{TaskInsId: "failed-task-ins1"})
+			},
+			giveAnonymous: true,
+			wantCode:      codes.Unauthenticated,
+			wantMessage:   "unauthorized",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			ctx := context.Background()
+			if !tc.giveAnonymous {
+				ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer admin")
+			}
+			resp, err := tc.giveCall(ctx)
+			st := status.Convert(err)
+			assert.Equal(t, tc.wantCode, st.Code())
+			assert.Contains(t, st.Message(), tc.wantMessage)
+			if tc.wantResp == nil {
+				return
+			}
+			// the timestamps and tasks are not compared
+			if run, ok := resp.(*Run); ok {
+				run.CreatedAt, run.UpdatedAt, run.Tasks = 0, 0, nil
+			}
+			assert.True(t, proto.Equal(tc.wantResp, resp), "got %v", resp)
+		})
+	}
+}
+
+func TestServer_WatchRun(t *testing.T) {
+	st := memory.NewStore()
+	mod.SetStore(st)
+	assert.NoError(t, st.CreateDagIns(&entity.DagInstance{
+		BaseInfo: entity.BaseInfo{ID: "ins1"},
+		DagID:    "dag1",
+		Status:   entity.DagInstanceStatusRunning,
+	}))
+	assert.NoError(t, st.BatchCreatTaskIns([]*entity.TaskInstance{
+		{
+			BaseInfo: entity.BaseInfo{ID: "task-ins1"},
+			DagInsID: "ins1",
+			TaskID:   "task1",
+			Status:   entity.TaskInstanceStatusRunning,
+		},
+	}))
+
+	s := NewServer()
+	s.SetWatchInterval(10 * time.Millisecond)
+	client, closeFn := newTestClient(t, s)
+	defer closeFn()
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		assert.NoError(t, st.PatchTaskIns(&entity.TaskInstance{
+			BaseInfo: entity.BaseInfo{ID: "task-ins1"},
+			Status:   entity.TaskInstanceStatusSuccess,
+		}))
+		time.Sleep(50 * time.Millisecond)
+		assert.NoError(t, st.PatchDagIns(&entity.DagInstance{
+			BaseInfo: entity.BaseInfo{ID: "ins1"},
+			Status:   entity.DagInstanceStatusSuccess,
+		}))
+	}()
+
+	stream, err := client.WatchRun(context.Background(), &WatchRunRequest{RunId: "ins1"})
+	assert.NoError(t, err)
+	var events []string
+	for {
+		e, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if !assert.NoError(t, err) {
+			break
+		}
+		assert.Equal(t, "ins1", e.RunId)
+		events = append(events, e.TaskInsId+":"+e.Status)
+	}
+	assert.Equal(t, []string{"task-ins1:running", ":running", "task-ins1:success", ":success"}, events)
+
+	stream, err = client.WatchRun(context.Background(), &WatchRunRequest{RunId: "none"})
+	assert.NoError(t, err)
+	_, err = stream.Recv()
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func Test_toStatus(t *testing.T) {
+	log.RegisterSecret("test", "p@ssw0rd")
+	defer log.ForgetSecrets("test")
+
+	tests := []struct {
+		caseDesc    string
+		giveErr     error
+		wantCode    codes.Code
+		wantMessage string
+	}{
+		{
+			caseDesc:    "data error",
+			giveErr:     fmt.Errorf("dag %s: %w", "dag1", data.ErrDataNotFound),
+			wantCode:    codes.NotFound,
+			wantMessage: "dag dag1: " + data.ErrDataNotFound.Error(),
+		},
+		{
+			caseDesc:    "status error",
+			giveErr:     status.Error(codes.InvalidArgument, "bad"),
+			wantCode:    codes.InvalidArgument,
+			wantMessage: "bad",
+		},
+		{
+			caseDesc:    "redacted",
+			giveErr:     errors.New("login with p@ssw0rd failed"),
+			wantCode:    codes.Unknown,
+			wantMessage: "login with ****** failed",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			st := status.Convert(toStatus("/test", tc.giveErr))
+			assert.Equal(t, tc.wantCode, st.Code())
+			assert.Equal(t, tc.wantMessage, st.Message())
+		})
+	}
+	assert.NoError(t, toStatus("/test", nil))
+}
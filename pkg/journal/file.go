@@ -0,0 +1,140 @@
+package journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+var _ Journal = (*FileJournal)(nil)
+
+// FileOption
+type FileOption struct {
+	// Path of the journal file, it is created if not existed
+	Path string
+	// Sync flush each append to disk, it is slower but no entry is lost when machine crashed
+	Sync bool
+}
+
+// FileJournal store entries as json lines in a local file
+type FileJournal struct {
+	opt  *FileOption
+	file *os.File
+	seq  uint64
+
+	mutex sync.Mutex
+}
+
+// NewFileJournal open the journal file and recover the last seq from it
+func NewFileJournal(opt *FileOption) (*FileJournal, error) {
+	if opt.Path == "" {
+		return nil, fmt.Errorf("journal path cannot be empty")
+	}
+	f, err := os.OpenFile(opt.Path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("open journal failed: %w", err)
+	}
+	j := &FileJournal{opt: opt, file: f}
+	if err := j.recover(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("recover journal failed: %w", err)
+	}
+	return j, nil
+}
+
+// recover the last seq, and truncate the incomplete line which is written when process crashed
+func (j *FileJournal) recover() error {
+	var size int64
+	r := bufio.NewReader(j.file)
+	for {
+		bs, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		e := &Entry{}
+		if err := json.Unmarshal(bs, e); err != nil {
+			return fmt.Errorf("unmarshal journal entry at offset %d failed: %w", size, err)
+		}
+		j.seq = e.Seq
+		size += int64(len(bs))
+	}
+	if err := j.file.Truncate(size); err != nil {
+		return err
+	}
+	_, err := j.file.Seek(size, io.SeekStart)
+	return err
+}
+
+// Append
+func (j *FileJournal) Append(entries ...*Entry) error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	var buf []byte
+	seq := j.seq
+	for _, e := range entries {
+		seq++
+		e.Seq = seq
+		bs, err := json.Marshal(e)
+		if err != nil {
+			return fmt.Errorf("marshal journal entry failed: %w", err)
+		}
+		buf = append(append(buf, bs...), '\n')
+	}
+	// write all entries at once, so a batch is not interleaved with others
+	if _, err := j.file.Write(buf); err != nil {
+		return fmt.Errorf("write journal failed: %w", err)
+	}
+	if j.opt.Sync {
+		if err := j.file.Sync(); err != nil {
+			return fmt.Errorf("sync journal failed: %w", err)
+		}
+	}
+	j.seq = seq
+	return nil
+}
+
+// Read
+func (j *FileJournal) Read(afterSeq uint64, fn func(entry *Entry) error) error {
+	f, err := os.Open(j.opt.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	for line := 1; ; line++ {
+		bs, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// the last line is incomplete when process crashed during writing, ignore it
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read journal failed: %w", err)
+		}
+		e := &Entry{}
+		if err := json.Unmarshal(bs, e); err != nil {
+			return fmt.Errorf("unmarshal journal line %d failed: %w", line, err)
+		}
+		if e.Seq <= afterSeq {
+			continue
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+}
+
+// Close
+func (j *FileJournal) Close() error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	return j.file.Close()
+}
@@ -0,0 +1,75 @@
+package journal
+
+import (
+	"sync"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/log"
+	"github.com/etherealiy/fastflow/pkg/mod"
+)
+
+// Follower replay the journal of primary cluster to the local store periodically while current worker
+// is standby, it stops following after the cluster is promoted
+type Follower struct {
+	journal  Journal
+	store    mod.Store
+	interval time.Duration
+	lastSeq  uint64
+
+	closeCh chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewFollower
+func NewFollower(j Journal, st mod.Store, interval time.Duration) *Follower {
+	return &Follower{
+		journal:  j,
+		store:    st,
+		interval: interval,
+		closeCh:  make(chan struct{}),
+	}
+}
+
+// Init
+func (f *Follower) Init() {
+	f.wg.Add(1)
+	go f.goFollow()
+}
+
+// Close
+func (f *Follower) Close() {
+	close(f.closeCh)
+	f.wg.Wait()
+}
+
+// LastSeq return the seq of last applied entry
+func (f *Follower) LastSeq() uint64 {
+	return f.lastSeq
+}
+
+func (f *Follower) goFollow() {
+	defer f.wg.Done()
+	timerCh := time.Tick(f.interval)
+	for {
+		if !mod.IsStandby() {
+			log.Info("cluster is promoted, stop following journal")
+			return
+		}
+		if err := f.Follow(); err != nil {
+			log.Errorf("follow journal failed: %s", err)
+		}
+
+		select {
+		case <-f.closeCh:
+			return
+		case <-timerCh:
+		}
+	}
+}
+
+// Follow apply the entries appended after last follow
+func (f *Follower) Follow() error {
+	last, err := Replay(f.journal, f.store, &ReplayOption{AfterSeq: f.lastSeq, Upsert: true})
+	f.lastSeq = last
+	return err
+}
@@ -0,0 +1,47 @@
+package journal
+
+import (
+	"encoding/json"
+)
+
+// Op is the store operation which is journaled, it is same as the method name of mod.Store
+type Op string
+
+const (
+	OpCreateDag          Op = "CreateDag"
+	OpUpdateDag          Op = "UpdateDag"
+	OpBatchDeleteDag     Op = "BatchDeleteDag"
+	OpCreateDagIns       Op = "CreateDagIns"
+	OpPatchDagIns        Op = "PatchDagIns"
+	OpUpdateDagIns       Op = "UpdateDagIns"
+	OpBatchUpdateDagIns  Op = "BatchUpdateDagIns"
+	OpBatchCreatTaskIns  Op = "BatchCreatTaskIns"
+	OpPatchTaskIns       Op = "PatchTaskIns"
+	OpUpdateTaskIns      Op = "UpdateTaskIns"
+	OpBatchUpdateTaskIns Op = "BatchUpdateTaskIns"
+)
+
+// Entry is an immutable record of a state transition, it is never updated after appended
+type Entry struct {
+	// Seq is assigned by journal when appending, it is increasing
+	Seq uint64 `json:"seq"`
+	Op  Op     `json:"op"`
+	// Object is the json of the argument of the operation, such as a dag instance or a list of task instances
+	Object json.RawMessage `json:"object"`
+	// MustsPatchFields is the fields of PatchDagIns which are patched even if they are zero
+	MustsPatchFields []string `json:"mustsPatchFields,omitempty"`
+	// Worker is the key of the worker which made the decision
+	Worker string `json:"worker,omitempty"`
+	// CreatedAt is unix timestamp in milliseconds
+	CreatedAt int64 `json:"createdAt"`
+}
+
+// Journal is an append-only log of entries, it should be kept apart from the store
+// so that it survives the corruption of store
+type Journal interface {
+	// Append entries in order, it assigns the seq of each entry
+	Append(entries ...*Entry) error
+	// Read the entries which seq is greater than afterSeq in order, it stops when fn returns error
+	Read(afterSeq uint64, fn func(entry *Entry) error) error
+	Close() error
+}
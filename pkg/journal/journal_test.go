@@ -0,0 +1,227 @@
+package journal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/store/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplay(t *testing.T) {
+	j, err := NewFileJournal(&FileOption{Path: filepath.Join(t.TempDir(), "journal")})
+	assert.NoError(t, err)
+	defer j.Close()
+
+	st := WrapStore(memory.NewStore(), j)
+	assert.NoError(t, st.CreateDag(&entity.Dag{
+		BaseInfo: entity.BaseInfo{ID: "dag1"},
+		Status:   entity.DagStatusNormal,
+		Tasks:    []entity.Task{{ID: "task1", ActionName: "act"}},
+	}))
+	assert.NoError(t, st.CreateDagIns(&entity.DagInstance{BaseInfo: entity.BaseInfo{ID: "dag-ins1"}, DagID: "dag1", Status: entity.DagInstanceStatusInit}))
+	assert.NoError(t, st.BatchCreatTaskIns([]*entity.TaskInstance{
+		{BaseInfo: entity.BaseInfo{ID: "task-ins1"}, DagInsID: "dag-ins1", TaskID: "task1", Status: entity.TaskInstanceStatusInit},
+	}))
+	assert.NoError(t, st.PatchDagIns(&entity.DagInstance{BaseInfo: entity.BaseInfo{ID: "dag-ins1"}, Worker: "w1", Status: entity.DagInstanceStatusScheduled}))
+	assert.NoError(t, st.PatchTaskIns(&entity.TaskInstance{BaseInfo: entity.BaseInfo{ID: "task-ins1"}, Status: entity.TaskInstanceStatusSuccess}))
+	assert.NoError(t, st.PatchDagIns(&entity.DagInstance{BaseInfo: entity.BaseInfo{ID: "dag-ins1"}, Status: entity.DagInstanceStatusSuccess}))
+	// failed operation is not journaled
+	assert.Error(t, st.PatchTaskIns(&entity.TaskInstance{BaseInfo: entity.BaseInfo{ID: "not-existed"}}))
+
+	tests := []struct {
+		caseDesc         string
+		giveOpt          *ReplayOption
+		wantLast         uint64
+		wantDagInsStatus entity.DagInstanceStatus
+		wantTaskStatus   entity.TaskInstanceStatus
+	}{
+		{
+			caseDesc:         "replay all",
+			wantLast:         6,
+			wantDagInsStatus: entity.DagInstanceStatusSuccess,
+			wantTaskStatus:   entity.TaskInstanceStatusSuccess,
+		},
+		{
+			caseDesc:         "replay until",
+			giveOpt:          &ReplayOption{UntilSeq: 4},
+			wantLast:         4,
+			wantDagInsStatus: entity.DagInstanceStatusScheduled,
+			wantTaskStatus:   entity.TaskInstanceStatusInit,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			target := memory.NewStore()
+			last, err := Replay(j, target, tc.giveOpt)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantLast, last)
+
+			_, err = target.GetDag("dag1")
+			assert.NoError(t, err)
+			dagIns, err := target.GetDagInstance("dag-ins1")
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantDagInsStatus, dagIns.Status)
+			assert.Equal(t, "w1", dagIns.Worker)
+			taskIns, err := target.GetTaskIns("task-ins1")
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantTaskStatus, taskIns.Status)
+		})
+	}
+
+	// resume a replay from the last applied seq
+	target := memory.NewStore()
+	_, err = Replay(j, target, &ReplayOption{UntilSeq: 3})
+	assert.NoError(t, err)
+	last, err := Replay(j, target, &ReplayOption{AfterSeq: 3})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(6), last)
+}
+
+func TestFileJournal_recover(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal")
+	j, err := NewFileJournal(&FileOption{Path: path, Sync: true})
+	assert.NoError(t, err)
+	assert.NoError(t, j.Append(&Entry{Op: OpPatchDagIns, Object: []byte(`{"id":"1"}`)}, &Entry{Op: OpPatchDagIns, Object: []byte(`{"id":"2"}`)}))
+	assert.NoError(t, j.Close())
+
+	// simulate a crash during writing
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	assert.NoError(t, err)
+	_, err = f.WriteString(`{"seq":3,"op":"Patch`)
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+
+	j, err = NewFileJournal(&FileOption{Path: path})
+	assert.NoError(t, err)
+	defer j.Close()
+	e := &Entry{Op: OpPatchDagIns, Object: []byte(`{"id":"3"}`)}
+	assert.NoError(t, j.Append(e))
+	assert.Equal(t, uint64(3), e.Seq)
+
+	var seqs []uint64
+	assert.NoError(t, j.Read(1, func(entry *Entry) error {
+		seqs = append(seqs, entry.Seq)
+		return nil
+	}))
+	assert.Equal(t, []uint64{2, 3}, seqs)
+}
+
+func TestFollower_Follow(t *testing.T) {
+	j, err := NewFileJournal(&FileOption{Path: filepath.Join(t.TempDir(), "journal")})
+	assert.NoError(t, err)
+	defer j.Close()
+
+	primary := WrapStore(memory.NewStore(), j)
+	assert.NoError(t, primary.CreateDagIns(&entity.DagInstance{BaseInfo: entity.BaseInfo{ID: "dag-ins1"}, DagID: "dag1", Status: entity.DagInstanceStatusInit}))
+	assert.NoError(t, primary.BatchCreatTaskIns([]*entity.TaskInstance{
+		{BaseInfo: entity.BaseInfo{ID: "task-ins1"}, DagInsID: "dag-ins1", TaskID: "task1", Status: entity.TaskInstanceStatusInit},
+	}))
+
+	standby := memory.NewStore()
+	f := NewFollower(j, standby, time.Second)
+	assert.NoError(t, f.Follow())
+	assert.Equal(t, uint64(2), f.LastSeq())
+
+	assert.NoError(t, primary.PatchDagIns(&entity.DagInstance{BaseInfo: entity.BaseInfo{ID: "dag-ins1"}, Status: entity.DagInstanceStatusRunning}))
+	assert.NoError(t, f.Follow())
+	assert.Equal(t, uint64(3), f.LastSeq())
+	dagIns, err := standby.GetDagInstance("dag-ins1")
+	assert.NoError(t, err)
+	assert.Equal(t, entity.DagInstanceStatusRunning, dagIns.Status)
+
+	// replaying the applied entries again with upsert does not fail on the existed objects
+	last, err := Replay(j, standby, &ReplayOption{Upsert: true})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3), last)
+	taskIns, err := standby.GetTaskIns("task-ins1")
+	assert.NoError(t, err)
+	assert.Equal(t, entity.TaskInstanceStatusInit, taskIns.Status)
+}
+
+func TestReconstruct(t *testing.T) {
+	j, err := NewFileJournal(&FileOption{Path: filepath.Join(t.TempDir(), "journal")})
+	assert.NoError(t, err)
+	defer j.Close()
+
+	appendAt := func(ms int64, op Op, obj string, musts ...string) {
+		assert.NoError(t, j.Append(&Entry{Op: op, Object: []byte(obj), MustsPatchFields: musts, CreatedAt: ms}))
+	}
+	appendAt(1000, OpCreateDagIns, `{"id":"dag-ins1","dagId":"dag1","status":"init"}`)
+	appendAt(1000, OpCreateDagIns, `{"id":"dag-ins2","dagId":"dag1","status":"init"}`)
+	appendAt(1001, OpBatchCreatTaskIns, `[{"id":"t1","dagInsId":"dag-ins1","taskId":"task1","status":"init"},`+
+		`{"id":"t2","dagInsId":"dag-ins1","taskId":"task2","dependOn":["task1"],"status":"init"},`+
+		`{"id":"t3","dagInsId":"dag-ins1","taskId":"task3","status":"init"}]`)
+	appendAt(2000, OpPatchDagIns, `{"id":"dag-ins1","status":"running","worker":"w1","cmd":{"name":"retry"}}`)
+	appendAt(2000, OpPatchTaskIns, `{"id":"t1","status":"running"}`)
+	appendAt(2500, OpPatchTaskIns, `{"id":"t3","status":"blocked"}`)
+	appendAt(3000, OpPatchTaskIns, `{"id":"t1","status":"success"}`)
+	appendAt(3000, OpPatchDagIns, `{"id":"dag-ins1"}`, "Cmd")
+	appendAt(4000, OpPatchDagIns, `{"id":"dag-ins2","status":"failed"}`)
+
+	tests := []struct {
+		caseDesc    string
+		giveAt      int64
+		wantErr     bool
+		wantSeq     uint64
+		wantStatus  entity.DagInstanceStatus
+		wantHasCmd  bool
+		wantRunning []string
+		wantQueued  []string
+		wantBlocked []string
+	}{
+		{
+			caseDesc: "before created",
+			giveAt:   999,
+			wantErr:  true,
+		},
+		{
+			caseDesc:    "created",
+			giveAt:      1500,
+			wantSeq:     3,
+			wantStatus:  entity.DagInstanceStatusInit,
+			wantRunning: []string{},
+			wantQueued:  []string{"t1", "t3"},
+			wantBlocked: []string{},
+		},
+		{
+			caseDesc:    "running",
+			giveAt:      2999,
+			wantSeq:     6,
+			wantStatus:  entity.DagInstanceStatusRunning,
+			wantHasCmd:  true,
+			wantRunning: []string{"t1"},
+			wantQueued:  []string{},
+			wantBlocked: []string{"t3"},
+		},
+		{
+			caseDesc:    "latest",
+			giveAt:      5000,
+			wantSeq:     8,
+			wantStatus:  entity.DagInstanceStatusRunning,
+			wantRunning: []string{},
+			wantQueued:  []string{"t2"},
+			wantBlocked: []string{"t3"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			s, err := Reconstruct(j, "dag-ins1", time.UnixMilli(tc.giveAt))
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantSeq, s.Seq)
+			assert.Equal(t, tc.wantStatus, s.DagInstance.Status)
+			assert.Equal(t, tc.wantHasCmd, s.DagInstance.Cmd != nil)
+			assert.Len(t, s.TaskInstances, 3)
+			assert.Equal(t, tc.wantRunning, s.Running)
+			assert.Equal(t, tc.wantQueued, s.Queued)
+			assert.Equal(t, tc.wantBlocked, s.Blocked)
+		})
+	}
+}
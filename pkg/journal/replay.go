@@ -0,0 +1,128 @@
+package journal
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/mod"
+)
+
+// ReplayOption
+type ReplayOption struct {
+	// AfterSeq skip the entries which seq is not greater than it, it is used to resume a replay
+	AfterSeq uint64
+	// UntilSeq stop after the entry of this seq is applied, 0 means replay all
+	UntilSeq uint64
+	// Upsert update the existed objects instead of creating them, so the entries can be replayed again
+	Upsert bool
+}
+
+// Replay apply the entries of journal to the store in order, it is used to reconstruct the runtime state
+// after store corrupted, or migrate to another store backend.
+// It returns the seq of last applied entry, so a failed replay can be resumed from it.
+func Replay(j Journal, st mod.Store, opt *ReplayOption) (uint64, error) {
+	if opt == nil {
+		opt = &ReplayOption{}
+	}
+	last := opt.AfterSeq
+	errStop := fmt.Errorf("stop replay")
+	err := j.Read(opt.AfterSeq, func(e *Entry) error {
+		if opt.UntilSeq > 0 && e.Seq > opt.UntilSeq {
+			return errStop
+		}
+		if err := apply(st, e, opt.Upsert); err != nil {
+			return fmt.Errorf("apply journal entry[%d] %s failed: %w", e.Seq, e.Op, err)
+		}
+		last = e.Seq
+		return nil
+	})
+	if err != nil && err != errStop {
+		return last, err
+	}
+	return last, nil
+}
+
+func apply(st mod.Store, e *Entry, upsert bool) error {
+	switch e.Op {
+	case OpCreateDag, OpUpdateDag:
+		dag := &entity.Dag{}
+		if err := json.Unmarshal(e.Object, dag); err != nil {
+			return err
+		}
+		if e.Op == OpCreateDag && !(upsert && existed(st.GetDag(dag.ID))) {
+			return st.CreateDag(dag)
+		}
+		return st.UpdateDag(dag)
+	case OpBatchDeleteDag:
+		var ids []string
+		if err := json.Unmarshal(e.Object, &ids); err != nil {
+			return err
+		}
+		ps, ok := mod.StoreAs[mod.DagPruneStore](st)
+		if !ok {
+			return fmt.Errorf("store does not support pruning dags")
+		}
+		return ps.BatchDeleteDag(ids)
+	case OpCreateDagIns, OpPatchDagIns, OpUpdateDagIns:
+		dagIns := &entity.DagInstance{}
+		if err := json.Unmarshal(e.Object, dagIns); err != nil {
+			return err
+		}
+		switch e.Op {
+		case OpCreateDagIns:
+			if !(upsert && existed(st.GetDagInstance(dagIns.ID))) {
+				return st.CreateDagIns(dagIns)
+			}
+		case OpPatchDagIns:
+			return st.PatchDagIns(dagIns, e.MustsPatchFields...)
+		}
+		return st.UpdateDagIns(dagIns)
+	case OpBatchUpdateDagIns:
+		var dagIns []*entity.DagInstance
+		if err := json.Unmarshal(e.Object, &dagIns); err != nil {
+			return err
+		}
+		return st.BatchUpdateDagIns(dagIns)
+	case OpPatchTaskIns, OpUpdateTaskIns:
+		taskIns := &entity.TaskInstance{}
+		if err := json.Unmarshal(e.Object, taskIns); err != nil {
+			return err
+		}
+		if e.Op == OpPatchTaskIns {
+			return st.PatchTaskIns(taskIns)
+		}
+		return st.UpdateTaskIns(taskIns)
+	case OpBatchCreatTaskIns, OpBatchUpdateTaskIns:
+		var taskIns []*entity.TaskInstance
+		if err := json.Unmarshal(e.Object, &taskIns); err != nil {
+			return err
+		}
+		if e.Op == OpBatchUpdateTaskIns {
+			return st.BatchUpdateTaskIns(taskIns)
+		}
+		var creating, updating []*entity.TaskInstance
+		for _, t := range taskIns {
+			if upsert && existed(st.GetTaskIns(t.ID)) {
+				updating = append(updating, t)
+			} else {
+				creating = append(creating, t)
+			}
+		}
+		if len(updating) > 0 {
+			if err := st.BatchUpdateTaskIns(updating); err != nil {
+				return err
+			}
+		}
+		if len(creating) > 0 {
+			return st.BatchCreatTaskIns(creating)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown op %s", e.Op)
+	}
+}
+
+func existed(_ interface{}, err error) bool {
+	return err == nil
+}
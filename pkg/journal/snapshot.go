@@ -0,0 +1,176 @@
+package journal
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/mod"
+	"github.com/etherealiy/fastflow/pkg/utils/data"
+)
+
+// Snapshot is the state of a dag instance at a point in time, it is reconstructed from journal
+type Snapshot struct {
+	// At is unix timestamp in milliseconds
+	At int64 `json:"at"`
+	// Seq is the seq of last applied entry
+	Seq           uint64                 `json:"seq"`
+	DagInstance   *entity.DagInstance    `json:"dagInstance"`
+	TaskInstances []*entity.TaskInstance `json:"taskInstances"`
+	// Running is the task instances which are running or ending
+	Running []string `json:"running"`
+	// Queued is the task instances whose upstream tasks are completed, they are waiting for executor
+	Queued  []string `json:"queued"`
+	Blocked []string `json:"blocked"`
+}
+
+// Reconstruct fold the journal entries of the dag instance which are created before "at" into a snapshot,
+// the entries are applied as the store does, so it answers what exactly was happening at that time.
+// The journal is read in seq order and stops at the first entry after "at".
+func Reconstruct(j Journal, dagInsID string, at time.Time) (*Snapshot, error) {
+	atMs := at.UnixMilli()
+	s := &Snapshot{At: atMs}
+	tasks := map[string]*entity.TaskInstance{}
+	var taskIDs []string
+
+	errStop := fmt.Errorf("stop reconstruct")
+	err := j.Read(0, func(e *Entry) error {
+		if e.CreatedAt > atMs {
+			return errStop
+		}
+		applied, err := s.fold(e, dagInsID, tasks, &taskIDs)
+		if err != nil {
+			return fmt.Errorf("fold journal entry[%d] %s failed: %w", e.Seq, e.Op, err)
+		}
+		if applied {
+			s.Seq = e.Seq
+		}
+		return nil
+	})
+	if err != nil && err != errStop {
+		return nil, err
+	}
+	if s.DagInstance == nil {
+		return nil, fmt.Errorf("dag instance[%s] is not created at %s: %w", dagInsID, at, data.ErrDataNotFound)
+	}
+
+	s.TaskInstances = []*entity.TaskInstance{}
+	for _, id := range taskIDs {
+		s.TaskInstances = append(s.TaskInstances, tasks[id])
+	}
+	s.classify()
+	return s, nil
+}
+
+func (s *Snapshot) fold(e *Entry, dagInsID string, tasks map[string]*entity.TaskInstance, taskIDs *[]string) (bool, error) {
+	switch e.Op {
+	case OpCreateDagIns, OpPatchDagIns, OpUpdateDagIns:
+		dagIns := &entity.DagInstance{}
+		if err := json.Unmarshal(e.Object, dagIns); err != nil {
+			return false, err
+		}
+		if dagIns.ID != dagInsID {
+			return false, nil
+		}
+		if e.Op == OpPatchDagIns && s.DagInstance != nil {
+			return true, patch(s.DagInstance, e.Object, e.MustsPatchFields)
+		}
+		s.DagInstance = dagIns
+		return true, nil
+	case OpBatchUpdateDagIns:
+		var dagIns []*entity.DagInstance
+		if err := json.Unmarshal(e.Object, &dagIns); err != nil {
+			return false, err
+		}
+		for _, d := range dagIns {
+			if d.ID == dagInsID {
+				s.DagInstance = d
+				return true, nil
+			}
+		}
+	case OpPatchTaskIns, OpUpdateTaskIns:
+		taskIns := &entity.TaskInstance{}
+		if err := json.Unmarshal(e.Object, taskIns); err != nil {
+			return false, err
+		}
+		old, ok := tasks[taskIns.ID]
+		if !ok {
+			return false, nil
+		}
+		if e.Op == OpPatchTaskIns {
+			return true, patch(old, e.Object, nil)
+		}
+		tasks[taskIns.ID] = taskIns
+		return true, nil
+	case OpBatchCreatTaskIns, OpBatchUpdateTaskIns:
+		var taskIns []*entity.TaskInstance
+		if err := json.Unmarshal(e.Object, &taskIns); err != nil {
+			return false, err
+		}
+		applied := false
+		for _, t := range taskIns {
+			_, ok := tasks[t.ID]
+			if !ok && (e.Op == OpBatchUpdateTaskIns || t.DagInsID != dagInsID) {
+				continue
+			}
+			if !ok {
+				*taskIDs = append(*taskIDs, t.ID)
+			}
+			tasks[t.ID] = t
+			applied = true
+		}
+		return applied, nil
+	}
+	return false, nil
+}
+
+// patch merge the non-zero fields of object into obj as the store does, the musts fields are set even if they are zero
+func patch(obj interface{}, object json.RawMessage, mustsPatchFields []string) error {
+	if err := json.Unmarshal(object, obj); err != nil {
+		return err
+	}
+	if len(mustsPatchFields) == 0 {
+		return nil
+	}
+	p := reflect.New(reflect.TypeOf(obj).Elem())
+	if err := json.Unmarshal(object, p.Interface()); err != nil {
+		return err
+	}
+	for _, f := range mustsPatchFields {
+		if field := reflect.ValueOf(obj).Elem().FieldByName(f); field.IsValid() {
+			field.Set(p.Elem().FieldByName(f))
+		}
+	}
+	return nil
+}
+
+func (s *Snapshot) classify() {
+	s.Running, s.Queued, s.Blocked = []string{}, []string{}, []string{}
+	status := map[string]entity.TaskInstanceStatus{}
+	for _, t := range s.TaskInstances {
+		status[t.ID] = t.Status
+		switch t.Status {
+		case entity.TaskInstanceStatusRunning, entity.TaskInstanceStatusEnding:
+			s.Running = append(s.Running, t.ID)
+		case entity.TaskInstanceStatusBlocked:
+			s.Blocked = append(s.Blocked, t.ID)
+		case entity.TaskInstanceStatusQueued:
+			s.Queued = append(s.Queued, t.ID)
+		}
+	}
+	if len(s.TaskInstances) == 0 {
+		return
+	}
+	root, err := mod.BuildRootNode(mod.MapTaskInsToGetter(s.TaskInstances))
+	if err != nil {
+		return
+	}
+	for _, id := range root.GetExecutableTaskIds() {
+		// the ending tasks are executable because their after hooks are not completed, but they are running
+		if status[id] != entity.TaskInstanceStatusEnding {
+			s.Queued = append(s.Queued, id)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package journal
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/log"
+	"github.com/etherealiy/fastflow/pkg/mod"
+)
+
+var (
+	_ mod.Store         = (*Store)(nil)
+	_ mod.DagPruneStore = (*Store)(nil)
+)
+
+// Store wrap a store and append each succeeded mutation to journal, so the scheduling decisions and
+// state transitions can be replayed by "Replay".
+// Only mod.Store and mod.DagPruneStore are exposed, other capabilities of the wrapped store are hidden.
+//
+//	j, _ := journal.NewFileJournal(&journal.FileOption{Path: "/data/fastflow.journal"})
+//	fastflow.Init(&fastflow.InitialOption{Store: journal.WrapStore(st, j), ...})
+type Store struct {
+	mod.Store
+	journal Journal
+}
+
+// WrapStore
+func WrapStore(st mod.Store, j Journal) *Store {
+	return &Store{
+		Store:   st,
+		journal: j,
+	}
+}
+
+// Journal return the journal which the mutations are appended to
+func (s *Store) Journal() Journal {
+	return s.journal
+}
+
+// record append the mutation which is already persisted, the failure is logged only,
+// because returning it will make the caller retry a succeeded operation
+func (s *Store) record(op Op, obj interface{}, mustsPatchFields ...string) {
+	bs, err := json.Marshal(obj)
+	if err != nil {
+		log.Errorf("marshal journal object of %s failed: %s", op, err)
+		return
+	}
+	e := &Entry{
+		Op:               op,
+		Object:           bs,
+		MustsPatchFields: mustsPatchFields,
+		CreatedAt:        time.Now().UnixMilli(),
+	}
+	if k := mod.GetKeeper(); k != nil {
+		e.Worker = k.WorkerKey()
+	}
+	if err := s.journal.Append(e); err != nil {
+		log.Errorf("append journal of %s failed: %s", op, err)
+	}
+}
+
+// CreateDag
+func (s *Store) CreateDag(dag *entity.Dag) error {
+	if err := s.Store.CreateDag(dag); err != nil {
+		return err
+	}
+	s.record(OpCreateDag, dag)
+	return nil
+}
+
+// UpdateDag
+func (s *Store) UpdateDag(dag *entity.Dag) error {
+	if err := s.Store.UpdateDag(dag); err != nil {
+		return err
+	}
+	s.record(OpUpdateDag, dag)
+	return nil
+}
+
+// CreateDagIns
+func (s *Store) CreateDagIns(dagIns *entity.DagInstance) error {
+	if err := s.Store.CreateDagIns(dagIns); err != nil {
+		return err
+	}
+	s.record(OpCreateDagIns, dagIns)
+	return nil
+}
+
+// PatchDagIns
+func (s *Store) PatchDagIns(dagIns *entity.DagInstance, mustsPatchFields ...string) error {
+	if err := s.Store.PatchDagIns(dagIns, mustsPatchFields...); err != nil {
+		return err
+	}
+	s.record(OpPatchDagIns, dagIns, mustsPatchFields...)
+	return nil
+}
+
+// UpdateDagIns
+func (s *Store) UpdateDagIns(dagIns *entity.DagInstance) error {
+	if err := s.Store.UpdateDagIns(dagIns); err != nil {
+		return err
+	}
+	s.record(OpUpdateDagIns, dagIns)
+	return nil
+}
+
+// BatchUpdateDagIns
+func (s *Store) BatchUpdateDagIns(dagIns []*entity.DagInstance) error {
+	if err := s.Store.BatchUpdateDagIns(dagIns); err != nil {
+		return err
+	}
+	s.record(OpBatchUpdateDagIns, dagIns)
+	return nil
+}
+
+// BatchCreatTaskIns
+func (s *Store) BatchCreatTaskIns(taskIns []*entity.TaskInstance) error {
+	if err := s.Store.BatchCreatTaskIns(taskIns); err != nil {
+		return err
+	}
+	s.record(OpBatchCreatTaskIns, taskIns)
+	return nil
+}
+
+// PatchTaskIns
+func (s *Store) PatchTaskIns(taskIns *entity.TaskInstance) error {
+	if err := s.Store.PatchTaskIns(taskIns); err != nil {
+		return err
+	}
+	s.record(OpPatchTaskIns, taskIns)
+	return nil
+}
+
+// UpdateTaskIns
+func (s *Store) UpdateTaskIns(taskIns *entity.TaskInstance) error {
+	if err := s.Store.UpdateTaskIns(taskIns); err != nil {
+		return err
+	}
+	s.record(OpUpdateTaskIns, taskIns)
+	return nil
+}
+
+// BatchUpdateTaskIns
+func (s *Store) BatchUpdateTaskIns(taskIns []*entity.TaskInstance) error {
+	if err := s.Store.BatchUpdateTaskIns(taskIns); err != nil {
+		return err
+	}
+	s.record(OpBatchUpdateTaskIns, taskIns)
+	return nil
+}
+
+// ListDag
+func (s *Store) ListDag(input *mod.ListDagInput) ([]*entity.Dag, error) {
+	ps, ok := s.Store.(mod.DagPruneStore)
+	if !ok {
+		return nil, fmt.Errorf("store does not support pruning dags")
+	}
+	return ps.ListDag(input)
+}
+
+// BatchDeleteDag
+func (s *Store) BatchDeleteDag(ids []string) error {
+	ps, ok := s.Store.(mod.DagPruneStore)
+	if !ok {
+		return fmt.Errorf("store does not support pruning dags")
+	}
+	if err := ps.BatchDeleteDag(ids); err != nil {
+		return err
+	}
+	s.record(OpBatchDeleteDag, ids)
+	return nil
+}
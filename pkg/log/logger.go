@@ -6,14 +6,19 @@ import (
 	"os"
 )
 
-var defLog Logger = &StdoutLogger{}
+var defLog Logger = NewSlogLogger(nil)
 
-// SetLogger for testing
+// SetLogger replace the default slog logger, you can back it with zap, zerolog and so on
 func SetLogger(log Logger) {
 	defLog = log
 }
 
-// default logger
+// GetLogger
+func GetLogger() Logger {
+	return defLog
+}
+
+// StdoutLogger print logs by the standard log package
 type StdoutLogger struct {
 }
 
@@ -69,7 +74,7 @@ func (s *StdoutLogger) Fatalf(msg string, args ...interface{}) {
 	os.Exit(1)
 }
 
-// Logger
+// Logger the fields are key-value pairs, such as log.Info("task is done", "taskInsId", id)
 type Logger interface {
 	Debug(msg string, fields ...interface{})
 	Debugf(msg string, args ...interface{})
@@ -85,50 +90,123 @@ type Logger interface {
 
 // Debug
 func Debug(msg string, fields ...interface{}) {
-	defLog.Debug(msg, fields...)
+	defLog.Debug(Redact(msg), redactFields(fields)...)
 }
 
 // Debugf
 func Debugf(msg string, args ...interface{}) {
+	msg, args = redactf(msg, args)
 	defLog.Debugf(msg, args...)
 }
 
 // Info
 func Info(msg string, fields ...interface{}) {
-	defLog.Info(msg, fields...)
+	defLog.Info(Redact(msg), redactFields(fields)...)
 }
 
 // Infof
 func Infof(msg string, args ...interface{}) {
+	msg, args = redactf(msg, args)
 	defLog.Infof(msg, args...)
 }
 
 // Warn
 func Warn(msg string, fields ...interface{}) {
-	defLog.Warn(msg, fields...)
+	defLog.Warn(Redact(msg), redactFields(fields)...)
 }
 
 // Warnf
 func Warnf(msg string, args ...interface{}) {
+	msg, args = redactf(msg, args)
 	defLog.Warnf(msg, args...)
 }
 
 // Error
 func Error(msg string, fields ...interface{}) {
-	defLog.Error(msg, fields...)
+	defLog.Error(Redact(msg), redactFields(fields)...)
 }
 
 // Errorf
 func Errorf(msg string, args ...interface{}) {
+	msg, args = redactf(msg, args)
 	defLog.Errorf(msg, args...)
 }
 
 // Fatal
 func Fatal(msg string, fields ...interface{}) {
-	defLog.Fatal(msg, fields...)
+	defLog.Fatal(Redact(msg), redactFields(fields)...)
 }
 
 // Fatalf
 func Fatalf(msg string, args ...interface{}) {
+	msg, args = redactf(msg, args)
 	defLog.Fatalf(msg, args...)
 }
+
+// With return a logger which adds the fields to each log, the formatted logs are
+// turned into structured ones, so the fields are kept.
+//
+//	log.With(utils.LogKeyDagInsID, dagIns.ID).Errorf("patch dag instance failed: %s", err)
+func With(fields ...interface{}) Logger {
+	return &fieldLogger{fields: fields}
+}
+
+type fieldLogger struct {
+	fields []interface{}
+}
+
+func (l *fieldLogger) with(fields []interface{}) []interface{} {
+	ret := make([]interface{}, 0, len(l.fields)+len(fields))
+	ret = append(ret, l.fields...)
+	return append(ret, fields...)
+}
+
+// Debug
+func (l *fieldLogger) Debug(msg string, fields ...interface{}) {
+	Debug(msg, l.with(fields)...)
+}
+
+// Debugf
+func (l *fieldLogger) Debugf(msg string, args ...interface{}) {
+	Debug(fmt.Sprintf(msg, args...), l.fields...)
+}
+
+// Info
+func (l *fieldLogger) Info(msg string, fields ...interface{}) {
+	Info(msg, l.with(fields)...)
+}
+
+// Infof
+func (l *fieldLogger) Infof(msg string, args ...interface{}) {
+	Info(fmt.Sprintf(msg, args...), l.fields...)
+}
+
+// Warn
+func (l *fieldLogger) Warn(msg string, fields ...interface{}) {
+	Warn(msg, l.with(fields)...)
+}
+
+// Warnf
+func (l *fieldLogger) Warnf(msg string, args ...interface{}) {
+	Warn(fmt.Sprintf(msg, args...), l.fields...)
+}
+
+// Error
+func (l *fieldLogger) Error(msg string, fields ...interface{}) {
+	Error(msg, l.with(fields)...)
+}
+
+// Errorf
+func (l *fieldLogger) Errorf(msg string, args ...interface{}) {
+	Error(fmt.Sprintf(msg, args...), l.fields...)
+}
+
+// Fatal
+func (l *fieldLogger) Fatal(msg string, fields ...interface{}) {
+	Fatal(msg, l.with(fields)...)
+}
+
+// Fatalf
+func (l *fieldLogger) Fatalf(msg string, args ...interface{}) {
+	Fatal(fmt.Sprintf(msg, args...), l.fields...)
+}
@@ -0,0 +1,132 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWith(t *testing.T) {
+	tests := []struct {
+		caseDesc   string
+		giveFields []interface{}
+		giveLog    func(l Logger)
+		wantRecord map[string]interface{}
+	}{
+		{
+			caseDesc:   "structured",
+			giveFields: []interface{}{"dagInsId", "dag-ins"},
+			giveLog: func(l Logger) {
+				l.Warn("task is slow", "taskInsId", "task-ins")
+			},
+			wantRecord: map[string]interface{}{
+				"level": "WARN", "msg": "task is slow", "dagInsId": "dag-ins", "taskInsId": "task-ins",
+			},
+		},
+		{
+			caseDesc:   "formatted",
+			giveFields: []interface{}{"dagInsId", "dag-ins"},
+			giveLog: func(l Logger) {
+				l.Errorf("patch failed: %s", "timeout")
+			},
+			wantRecord: map[string]interface{}{
+				"level": "ERROR", "msg": "patch failed: timeout", "dagInsId": "dag-ins",
+			},
+		},
+		{
+			caseDesc:   "redacted",
+			giveFields: []interface{}{"dsn", "user:secret-pwd@db"},
+			giveLog: func(l Logger) {
+				l.Infof("connect with %s", "secret-pwd")
+			},
+			wantRecord: map[string]interface{}{
+				"level": "INFO", "msg": "connect with " + Redacted, "dsn": "user:" + Redacted + "@db",
+			},
+		},
+		{
+			caseDesc:   "debug is disabled",
+			giveFields: []interface{}{"dagInsId", "dag-ins"},
+			giveLog: func(l Logger) {
+				l.Debugf("tick %d", 1)
+			},
+		},
+	}
+
+	RegisterSecret("test", "secret-pwd")
+	defer ForgetSecrets("test")
+	defer SetLogger(GetLogger())
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			SetLogger(NewSlogLogger(slog.New(slog.NewJSONHandler(buf, nil))))
+			tc.giveLog(With(tc.giveFields...))
+
+			if tc.wantRecord == nil {
+				assert.Empty(t, buf.String())
+				return
+			}
+			record := map[string]interface{}{}
+			assert.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+			delete(record, "time")
+			assert.Equal(t, tc.wantRecord, record)
+		})
+	}
+}
+
+func TestSlogLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := NewSlogLogger(slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	l.Debug("start", "worker", "w1")
+	l.Infof("%d tasks", 2)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if assert.Len(t, lines, 2) {
+		assert.Contains(t, lines[0], `level=DEBUG msg=start worker=w1`)
+		assert.Contains(t, lines[1], `level=INFO msg="2 tasks"`)
+	}
+}
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		caseDesc   string
+		giveSecret map[string]string
+		giveForget []string
+		giveStr    string
+		wantStr    string
+	}{
+		{
+			caseDesc:   "redacted",
+			giveSecret: map[string]string{"dag-ins1": "secret-pwd"},
+			giveStr:    "password is secret-pwd",
+			wantStr:    "password is " + Redacted,
+		},
+		{
+			caseDesc:   "too short",
+			giveSecret: map[string]string{"dag-ins1": "1"},
+			giveStr:    `{"id":"1","count":1}`,
+			wantStr:    `{"id":"1","count":1}`,
+		},
+		{
+			caseDesc:   "forgotten",
+			giveSecret: map[string]string{"dag-ins1": "secret-pwd", "dag-ins2": "secret-key"},
+			giveForget: []string{"dag-ins1"},
+			giveStr:    "secret-pwd and secret-key",
+			wantStr:    "secret-pwd and " + Redacted,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			for scope, v := range tc.giveSecret {
+				RegisterSecret(scope, v)
+				defer ForgetSecrets(scope)
+			}
+			for _, scope := range tc.giveForget {
+				ForgetSecrets(scope)
+			}
+			assert.Equal(t, tc.wantStr, Redact(tc.giveStr))
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package log
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Redacted replaces the secret values in logs
+const Redacted = "******"
+
+// MinSecretLength is the minimum length of secret values to be redacted,
+// the shorter values are too common to be replaced without corrupting other texts
+const MinSecretLength = 6
+
+var (
+	secretsLock sync.RWMutex
+	// secrets are grouped by scope such as the dag instance which resolved them
+	secrets = map[string]map[string]struct{}{}
+)
+
+// RegisterSecret let the value be redacted in logs, traces and api responses until ForgetSecrets of scope is called
+func RegisterSecret(scope, v string) {
+	if len(v) < MinSecretLength {
+		return
+	}
+	secretsLock.Lock()
+	defer secretsLock.Unlock()
+	if secrets[scope] == nil {
+		secrets[scope] = map[string]struct{}{}
+	}
+	secrets[scope][v] = struct{}{}
+}
+
+// ForgetSecrets stop redacting the secret values registered with scope
+func ForgetSecrets(scope string) {
+	secretsLock.Lock()
+	defer secretsLock.Unlock()
+	delete(secrets, scope)
+}
+
+// Redact replace the registered secret values in string
+func Redact(s string) string {
+	secretsLock.RLock()
+	defer secretsLock.RUnlock()
+	for _, vals := range secrets {
+		for v := range vals {
+			s = strings.ReplaceAll(s, v, Redacted)
+		}
+	}
+	return s
+}
+
+func hasSecrets() bool {
+	secretsLock.RLock()
+	defer secretsLock.RUnlock()
+	return len(secrets) > 0
+}
+
+func redactFields(fields []interface{}) []interface{} {
+	if !hasSecrets() {
+		return fields
+	}
+	ret := make([]interface{}, len(fields))
+	for i, f := range fields {
+		switch v := f.(type) {
+		case string:
+			ret[i] = Redact(v)
+		case error, fmt.Stringer:
+			ret[i] = Redact(fmt.Sprint(v))
+		default:
+			ret[i] = f
+		}
+	}
+	return ret
+}
+
+func redactf(msg string, args []interface{}) (string, []interface{}) {
+	if !hasSecrets() {
+		return msg, args
+	}
+	return "%s", []interface{}{Redact(fmt.Sprintf(msg, args...))}
+}
@@ -0,0 +1,81 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+// SlogLogger adapt slog.Logger to Logger, it is the default logger.
+// The fields are key-value pairs, so they are passed to slog as attributes.
+type SlogLogger struct {
+	l *slog.Logger
+}
+
+// NewSlogLogger use slog.Default() when l is nil
+func NewSlogLogger(l *slog.Logger) *SlogLogger {
+	if l == nil {
+		l = slog.Default()
+	}
+	return &SlogLogger{l: l}
+}
+
+// Debug
+func (s *SlogLogger) Debug(msg string, fields ...interface{}) {
+	s.l.Debug(msg, fields...)
+}
+
+// Debugf
+func (s *SlogLogger) Debugf(msg string, args ...interface{}) {
+	s.logf(slog.LevelDebug, msg, args)
+}
+
+// Info
+func (s *SlogLogger) Info(msg string, fields ...interface{}) {
+	s.l.Info(msg, fields...)
+}
+
+// Infof
+func (s *SlogLogger) Infof(msg string, args ...interface{}) {
+	s.logf(slog.LevelInfo, msg, args)
+}
+
+// Warn
+func (s *SlogLogger) Warn(msg string, fields ...interface{}) {
+	s.l.Warn(msg, fields...)
+}
+
+// Warnf
+func (s *SlogLogger) Warnf(msg string, args ...interface{}) {
+	s.logf(slog.LevelWarn, msg, args)
+}
+
+// Error
+func (s *SlogLogger) Error(msg string, fields ...interface{}) {
+	s.l.Error(msg, fields...)
+}
+
+// Errorf
+func (s *SlogLogger) Errorf(msg string, args ...interface{}) {
+	s.logf(slog.LevelError, msg, args)
+}
+
+// Fatal log at error level and exit
+func (s *SlogLogger) Fatal(msg string, fields ...interface{}) {
+	s.l.Error(msg, fields...)
+	os.Exit(1)
+}
+
+// Fatalf log at error level and exit
+func (s *SlogLogger) Fatalf(msg string, args ...interface{}) {
+	s.logf(slog.LevelError, msg, args)
+	os.Exit(1)
+}
+
+func (s *SlogLogger) logf(level slog.Level, msg string, args []interface{}) {
+	if !s.l.Enabled(context.Background(), level) {
+		return
+	}
+	s.l.Log(context.Background(), level, fmt.Sprintf(msg, args...))
+}
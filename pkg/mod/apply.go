@@ -0,0 +1,371 @@
+package mod
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/log"
+	"github.com/etherealiy/fastflow/pkg/utils/cron"
+	"github.com/etherealiy/fastflow/pkg/utils/data"
+)
+
+// ApplyOption
+type ApplyOption struct {
+	// Prune delete the dags which id has PrunePrefix but are not applied,
+	// the prefix cannot be empty to avoid deleting all dags by mistake
+	Prune       bool
+	PrunePrefix string
+	// DryRun only compute the diff and will not change anything
+	DryRun bool
+	// Validate check the dags by ValidateDag after their bases are merged, the violations of all dags
+	// are returned together, so the actions of tasks must be registered
+	Validate bool
+}
+
+// ApplyAction
+type ApplyAction string
+
+const (
+	ApplyActionCreated   ApplyAction = "created"
+	ApplyActionUpdated   ApplyAction = "updated"
+	ApplyActionUnchanged ApplyAction = "unchanged"
+	ApplyActionPruned    ApplyAction = "pruned"
+)
+
+// DagApplyResult
+type DagApplyResult struct {
+	DagID  string      `json:"dagId"`
+	Action ApplyAction `json:"action"`
+	// ChangedFields is the fields different from the stored dag when updated
+	ChangedFields []string `json:"changedFields,omitempty"`
+	// Reruns is the dag instances which rerun the failed runs by rerun policy after updated
+	Reruns []string `json:"reruns,omitempty"`
+}
+
+// ApplyResult
+type ApplyResult struct {
+	DryRun bool             `json:"dryRun"`
+	Dags   []DagApplyResult `json:"dags"`
+}
+
+// ApplyDags create or update dags by id, the unchanged dags will not be written,
+// so it is idempotent and can be used by declarative tools such as GitOps controllers
+func ApplyDags(dags []*entity.Dag, opt *ApplyOption) (*ApplyResult, error) {
+	if opt == nil {
+		opt = &ApplyOption{}
+	}
+	if !opt.DryRun {
+		if err := checkActive(); err != nil {
+			return nil, err
+		}
+	}
+	if opt.Prune && opt.PrunePrefix == "" {
+		return nil, fmt.Errorf("prune prefix cannot be empty when prune is enabled: %w", data.ErrDataInvalid)
+	}
+
+	applied := map[string]bool{}
+	for _, dag := range dags {
+		if dag.ID == "" {
+			return nil, fmt.Errorf("dag id cannot be empty: %w", data.ErrDataInvalid)
+		}
+		if applied[dag.ID] {
+			return nil, fmt.Errorf("dag[%s] is duplicated: %w", dag.ID, data.ErrDataInvalid)
+		}
+		applied[dag.ID] = true
+	}
+	if err := resolveExtends(dags); err != nil {
+		return nil, err
+	}
+	if opt.Validate {
+		var violations []string
+		for _, dag := range dags {
+			for _, v := range ValidateDag(dag) {
+				violations = append(violations, fmt.Sprintf("dag[%s] %s", dag.ID, v))
+			}
+		}
+		if len(violations) > 0 {
+			return nil, fmt.Errorf("dags are invalid, %s: %w", strings.Join(violations, "; "), data.ErrDataInvalid)
+		}
+	}
+	for _, dag := range dags {
+		if err := dag.ExpandMatrix(); err != nil {
+			return nil, fmt.Errorf("dag[%s] is invalid, %s: %w", dag.ID, err, data.ErrDataInvalid)
+		}
+		dag.ApplyTaskDefaults()
+		if dag.Status == "" {
+			dag.Status = entity.DagStatusNormal
+		}
+		if _, err := BuildRootNode(MapTasksToGetter(dag.Tasks)); err != nil {
+			return nil, fmt.Errorf("dag[%s] is invalid, %s: %w", dag.ID, err, data.ErrDataInvalid)
+		}
+		for _, t := range dag.Tasks {
+			for i := range t.DependOnCondition {
+				if err := t.DependOnCondition[i].Validate(); err != nil {
+					return nil, fmt.Errorf("task[%s] of dag[%s] is invalid, %s: %w", t.ID, dag.ID, err, data.ErrDataInvalid)
+				}
+			}
+			if t.SubDag != nil && (t.SubDag.DagID == "" || t.SubDag.DagID == dag.ID) {
+				return nil, fmt.Errorf("task[%s] of dag[%s] is invalid, sub dag id cannot be empty or itself: %w",
+					t.ID, dag.ID, data.ErrDataInvalid)
+			}
+			if t.Pool != nil {
+				if err := t.Pool.Validate(); err != nil {
+					return nil, fmt.Errorf("task[%s] of dag[%s] is invalid, %s: %w", t.ID, dag.ID, err, data.ErrDataInvalid)
+				}
+			}
+			if t.MapOver != nil {
+				if err := t.MapOver.Validate(); err != nil {
+					return nil, fmt.Errorf("task[%s] of dag[%s] is invalid, %s: %w", t.ID, dag.ID, err, data.ErrDataInvalid)
+				}
+			}
+			if t.RetryPolicy != nil {
+				if err := t.RetryPolicy.Validate(); err != nil {
+					return nil, fmt.Errorf("task[%s] of dag[%s] is invalid, %s: %w", t.ID, dag.ID, err, data.ErrDataInvalid)
+				}
+			}
+			if err := t.TriggerRule.Validate(); err != nil {
+				return nil, fmt.Errorf("task[%s] of dag[%s] is invalid, %s: %w", t.ID, dag.ID, err, data.ErrDataInvalid)
+			}
+			if t.RateLimit == nil {
+				continue
+			}
+			if _, _, err := t.RateLimit.Parse(); err != nil {
+				return nil, fmt.Errorf("task[%s] of dag[%s] is invalid, %s: %w", t.ID, dag.ID, err, data.ErrDataInvalid)
+			}
+		}
+		if err := dag.Vars.Validate(); err != nil {
+			return nil, fmt.Errorf("dag[%s] is invalid, %s: %w", dag.ID, err, data.ErrDataInvalid)
+		}
+		if dag.Cron != "" {
+			if _, err := cron.Parse(dag.Cron); err != nil {
+				return nil, fmt.Errorf("dag[%s] is invalid, %s: %w", dag.ID, err, data.ErrDataInvalid)
+			}
+			// the runs fired by cron have no vars
+			if _, err := dag.Vars.Resolve(nil); err != nil {
+				return nil, fmt.Errorf("dag[%s] with cron is invalid, %w", dag.ID, err)
+			}
+		}
+		if dag.RerunPolicy != nil {
+			if err := dag.RerunPolicy.Validate(); err != nil {
+				return nil, fmt.Errorf("dag[%s] is invalid, %s: %w", dag.ID, err, data.ErrDataInvalid)
+			}
+		}
+		if dag.Hooks != nil {
+			if err := dag.Hooks.Validate(dag.Tasks); err != nil {
+				return nil, fmt.Errorf("dag[%s] is invalid, %s: %w", dag.ID, err, data.ErrDataInvalid)
+			}
+		}
+		for i := range dag.Notifications {
+			if err := dag.Notifications[i].Validate(); err != nil {
+				return nil, fmt.Errorf("dag[%s] is invalid, %s: %w", dag.ID, err, data.ErrDataInvalid)
+			}
+		}
+		if _, err := dag.Selector(); err != nil {
+			return nil, fmt.Errorf("dag[%s] is invalid, %s: %w", dag.ID, err, data.ErrDataInvalid)
+		}
+	}
+
+	ret := &ApplyResult{DryRun: opt.DryRun}
+	for _, dag := range dags {
+		r, err := applyDag(dag, opt.DryRun)
+		if err != nil {
+			return nil, err
+		}
+		ret.Dags = append(ret.Dags, *r)
+	}
+
+	if opt.Prune {
+		pruned, err := pruneDags(opt.PrunePrefix, applied, opt.DryRun)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range pruned {
+			ret.Dags = append(ret.Dags, DagApplyResult{DagID: id, Action: ApplyActionPruned})
+		}
+	}
+	return ret, nil
+}
+
+// resolveExtends merge the base dags into the dags which extend them, the base dag is looked up
+// in the applied dags first, then in store, so a family of dags and their template can be applied together
+func resolveExtends(dags []*entity.Dag) error {
+	batch := map[string]*entity.Dag{}
+	for _, dag := range dags {
+		batch[dag.ID] = dag
+	}
+	resolved := map[string]bool{}
+	var resolve func(dag *entity.Dag, visiting []string) error
+	resolve = func(dag *entity.Dag, visiting []string) error {
+		if dag.Extends == "" || resolved[dag.ID] {
+			return nil
+		}
+		visiting = append(visiting, dag.ID)
+		for _, id := range visiting[:len(visiting)-1] {
+			if id == dag.ID {
+				return fmt.Errorf("dag[%s] extends circularly: %s: %w",
+					dag.ID, strings.Join(visiting, " -> "), data.ErrDataInvalid)
+			}
+		}
+
+		base, ok := batch[dag.Extends]
+		if ok {
+			if err := resolve(base, visiting); err != nil {
+				return err
+			}
+		} else {
+			var err error
+			base, err = GetStore().GetDag(dag.Extends)
+			if errors.Is(err, data.ErrDataNotFound) {
+				return fmt.Errorf("base dag[%s] of dag[%s] does not exist: %w", dag.Extends, dag.ID, data.ErrDataInvalid)
+			}
+			if err != nil {
+				return fmt.Errorf("get base dag[%s] of dag[%s] failed: %w", dag.Extends, dag.ID, err)
+			}
+		}
+		if err := dag.Inherit(base); err != nil {
+			return fmt.Errorf("dag[%s] cannot extend dag[%s], %s: %w", dag.ID, dag.Extends, err, data.ErrDataInvalid)
+		}
+		resolved[dag.ID] = true
+		return nil
+	}
+	for _, dag := range dags {
+		if err := resolve(dag, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func applyDag(dag *entity.Dag, dryRun bool) (*DagApplyResult, error) {
+	old, err := GetStore().GetDag(dag.ID)
+	if err != nil && !errors.Is(err, data.ErrDataNotFound) {
+		return nil, fmt.Errorf("get dag[%s] failed: %w", dag.ID, err)
+	}
+	if old == nil {
+		if !dryRun {
+			if err := GetStore().CreateDag(dag); err != nil {
+				return nil, fmt.Errorf("create dag[%s] failed: %w", dag.ID, err)
+			}
+		}
+		return &DagApplyResult{DagID: dag.ID, Action: ApplyActionCreated}, nil
+	}
+
+	changed, err := DiffDag(old, dag)
+	if err != nil {
+		return nil, err
+	}
+	if len(changed) == 0 {
+		return &DagApplyResult{DagID: dag.ID, Action: ApplyActionUnchanged}, nil
+	}
+	ret := &DagApplyResult{DagID: dag.ID, Action: ApplyActionUpdated, ChangedFields: changed}
+	if dryRun {
+		return ret, nil
+	}
+	dag.CreatedAt = old.CreatedAt
+	if err := GetStore().UpdateDag(dag); err != nil {
+		return nil, fmt.Errorf("update dag[%s] failed: %w", dag.ID, err)
+	}
+	// the dag is updated already, failing to rerun should not fail applying
+	if ret.Reruns, err = RerunFailedDagIns(dag); err != nil {
+		log.Errorf("rerun failed dag instances of dag[%s] failed: %s", dag.ID, err)
+	}
+	return ret, nil
+}
+
+func pruneDags(prefix string, applied map[string]bool, dryRun bool) ([]string, error) {
+	st, ok := StoreAs[DagPruneStore](GetStore())
+	if !ok {
+		return nil, fmt.Errorf("store does not support pruning dags")
+	}
+	existed, err := st.ListDag(&ListDagInput{IDPrefix: prefix})
+	if err != nil {
+		return nil, fmt.Errorf("list dags failed: %w", err)
+	}
+	var ids []string
+	for _, dag := range existed {
+		// double check, because the store may ignore the prefix
+		if strings.HasPrefix(dag.ID, prefix) && !applied[dag.ID] {
+			ids = append(ids, dag.ID)
+		}
+	}
+	if len(ids) == 0 || dryRun {
+		return ids, nil
+	}
+	if err := st.BatchDeleteDag(ids); err != nil {
+		return nil, fmt.Errorf("delete dags failed: %w", err)
+	}
+	return ids, nil
+}
+
+// DiffDag return the user-defined fields which are different, the fields maintained by engine are ignored
+func DiffDag(oldDag, newDag *entity.Dag) ([]string, error) {
+	fields := []struct {
+		name     string
+		old, new interface{}
+	}{
+		{"name", oldDag.Name, newDag.Name},
+		{"desc", oldDag.Desc, newDag.Desc},
+		{"cron", oldDag.Cron, newDag.Cron},
+		{"vars", oldDag.Vars, newDag.Vars},
+		{"status", oldDag.Status, newDag.Status},
+		{"tasks", oldDag.Tasks, newDag.Tasks},
+		{"retryBudget", oldDag.RetryBudget, newDag.RetryBudget},
+		{"timeoutSecs", oldDag.TimeoutSecs, newDag.TimeoutSecs},
+		{"slaSecs", oldDag.SLASecs, newDag.SLASecs},
+		{"priority", oldDag.Priority, newDag.Priority},
+		{"rerunPolicy", oldDag.RerunPolicy, newDag.RerunPolicy},
+		{"taskDefaults", oldDag.TaskDefaults, newDag.TaskDefaults},
+		{"template", oldDag.Template, newDag.Template},
+		{"extends", oldDag.Extends, newDag.Extends},
+		{"remove", oldDag.Remove, newDag.Remove},
+		{"notifications", oldDag.Notifications, newDag.Notifications},
+	}
+
+	var changed []string
+	for _, f := range fields {
+		equal, err := jsonEqual(f.old, f.new)
+		if err != nil {
+			return nil, fmt.Errorf("compare %s of dag[%s] failed: %w", f.name, newDag.ID, err)
+		}
+		if !equal {
+			changed = append(changed, f.name)
+		}
+	}
+	return changed, nil
+}
+
+// jsonEqual compare values by their json form, so the same params decoded by different decoders are equal
+func jsonEqual(a, b interface{}) (bool, error) {
+	var va, vb interface{}
+	for _, pair := range []struct {
+		src interface{}
+		dst *interface{}
+	}{{a, &va}, {b, &vb}} {
+		bs, err := json.Marshal(pair.src)
+		if err != nil {
+			return false, err
+		}
+		if err := json.Unmarshal(bs, pair.dst); err != nil {
+			return false, err
+		}
+	}
+	return reflect.DeepEqual(emptyToNil(va), emptyToNil(vb)), nil
+}
+
+func emptyToNil(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		if len(val) == 0 {
+			return nil
+		}
+	case []interface{}:
+		if len(val) == 0 {
+			return nil
+		}
+	}
+	return v
+}
@@ -0,0 +1,239 @@
+package mod
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/utils/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestApplyDags(t *testing.T) {
+	stored := &entity.Dag{
+		BaseInfo: entity.BaseInfo{ID: "existed", CreatedAt: 100},
+		Name:     "name",
+		Status:   entity.DagStatusNormal,
+		Tasks:    []entity.Task{{ID: "t1", ActionName: "act", Params: map[string]interface{}{"n": float64(1)}}},
+	}
+	tests := []struct {
+		caseDesc       string
+		giveDags       []*entity.Dag
+		giveOpt        *ApplyOption
+		wantResult     *ApplyResult
+		wantCreated    []string
+		wantUpdated    []string
+		wantErrInvalid bool
+	}{
+		{
+			caseDesc: "create, update and unchanged",
+			giveDags: []*entity.Dag{
+				{BaseInfo: entity.BaseInfo{ID: "new"}, Tasks: []entity.Task{{ID: "t1", ActionName: "act"}}},
+				{BaseInfo: entity.BaseInfo{ID: "existed"}, Name: "name", Desc: "desc",
+					Tasks: []entity.Task{{ID: "t1", ActionName: "act", Params: map[string]interface{}{"n": 1}}}},
+			},
+			wantResult: &ApplyResult{Dags: []DagApplyResult{
+				{DagID: "new", Action: ApplyActionCreated},
+				{DagID: "existed", Action: ApplyActionUpdated, ChangedFields: []string{"desc"}},
+			}},
+			wantCreated: []string{"new"},
+			wantUpdated: []string{"existed"},
+		},
+		{
+			caseDesc: "unchanged",
+			giveDags: []*entity.Dag{
+				{BaseInfo: entity.BaseInfo{ID: "existed"}, Name: "name",
+					Tasks: []entity.Task{{ID: "t1", ActionName: "act", Params: map[string]interface{}{"n": 1}}}},
+			},
+			wantResult: &ApplyResult{Dags: []DagApplyResult{{DagID: "existed", Action: ApplyActionUnchanged}}},
+		},
+		{
+			caseDesc: "dry run",
+			giveDags: []*entity.Dag{
+				{BaseInfo: entity.BaseInfo{ID: "new"}, Tasks: []entity.Task{{ID: "t1", ActionName: "act"}}},
+				{BaseInfo: entity.BaseInfo{ID: "existed"}, Status: entity.DagStatusStopped,
+					Tasks: []entity.Task{{ID: "t1", ActionName: "act", Params: map[string]interface{}{"n": 1}}}},
+			},
+			giveOpt: &ApplyOption{DryRun: true},
+			wantResult: &ApplyResult{DryRun: true, Dags: []DagApplyResult{
+				{DagID: "new", Action: ApplyActionCreated},
+				{DagID: "existed", Action: ApplyActionUpdated, ChangedFields: []string{"name", "status"}},
+			}},
+		},
+		{
+			caseDesc:       "invalid dag",
+			giveDags:       []*entity.Dag{{BaseInfo: entity.BaseInfo{ID: "new"}}},
+			wantErrInvalid: true,
+		},
+		{
+			caseDesc: "duplicated dag",
+			giveDags: []*entity.Dag{
+				{BaseInfo: entity.BaseInfo{ID: "new"}, Tasks: []entity.Task{{ID: "t1", ActionName: "act"}}},
+				{BaseInfo: entity.BaseInfo{ID: "new"}, Tasks: []entity.Task{{ID: "t1", ActionName: "act"}}},
+			},
+			wantErrInvalid: true,
+		},
+		{
+			caseDesc: "extend dags",
+			giveDags: []*entity.Dag{
+				{BaseInfo: entity.BaseInfo{ID: "child"}, Extends: "base"},
+				{BaseInfo: entity.BaseInfo{ID: "base"}, Extends: "existed", Template: true,
+					Tasks: []entity.Task{{ID: "t2", ActionName: "act", DependOn: []string{"t1"}}}},
+			},
+			wantResult: &ApplyResult{Dags: []DagApplyResult{
+				{DagID: "child", Action: ApplyActionCreated},
+				{DagID: "base", Action: ApplyActionCreated},
+			}},
+			wantCreated: []string{"child", "base"},
+		},
+		{
+			caseDesc: "extend not existed dag",
+			giveDags: []*entity.Dag{
+				{BaseInfo: entity.BaseInfo{ID: "child"}, Extends: "not-existed"},
+			},
+			wantErrInvalid: true,
+		},
+		{
+			caseDesc: "extend circularly",
+			giveDags: []*entity.Dag{
+				{BaseInfo: entity.BaseInfo{ID: "a"}, Extends: "b"},
+				{BaseInfo: entity.BaseInfo{ID: "b"}, Extends: "a"},
+			},
+			wantErrInvalid: true,
+		},
+		{
+			caseDesc: "invalid rerun policy",
+			giveDags: []*entity.Dag{
+				{BaseInfo: entity.BaseInfo{ID: "new"}, RerunPolicy: &entity.RerunPolicy{Within: "1d"},
+					Tasks: []entity.Task{{ID: "t1", ActionName: "act"}}},
+			},
+			wantErrInvalid: true,
+		},
+		{
+			caseDesc: "invalid depend on condition",
+			giveDags: []*entity.Dag{
+				{BaseInfo: entity.BaseInfo{ID: "new"}, Tasks: []entity.Task{{ID: "t1", ActionName: "act",
+					DependOnCondition: []entity.TaskCondition{{Source: "output", Key: "k", Op: entity.OperatorIn}}}}},
+			},
+			wantErrInvalid: true,
+		},
+		{
+			caseDesc: "invalid map over",
+			giveDags: []*entity.Dag{
+				{BaseInfo: entity.BaseInfo{ID: "new"}, Tasks: []entity.Task{{ID: "t1", ActionName: "act",
+					MapOver: &entity.MapOver{Source: entity.TaskConditionSourceShareData}}}},
+			},
+			wantErrInvalid: true,
+		},
+		{
+			caseDesc: "sub dag is itself",
+			giveDags: []*entity.Dag{
+				{BaseInfo: entity.BaseInfo{ID: "new"}, Tasks: []entity.Task{{ID: "t1", SubDag: &entity.SubDag{DagID: "new"}}}},
+			},
+			wantErrInvalid: true,
+		},
+		{
+			caseDesc: "invalid pool",
+			giveDags: []*entity.Dag{
+				{BaseInfo: entity.BaseInfo{ID: "new"}, Tasks: []entity.Task{{ID: "t1", ActionName: "act",
+					Pool: &entity.TaskPool{Name: "gpu"}}}},
+			},
+			wantErrInvalid: true,
+		},
+		{
+			caseDesc: "invalid cron",
+			giveDags: []*entity.Dag{
+				{BaseInfo: entity.BaseInfo{ID: "new"}, Cron: "* * *", Tasks: []entity.Task{{ID: "t1", ActionName: "act"}}},
+			},
+			wantErrInvalid: true,
+		},
+		{
+			caseDesc: "invalid var type",
+			giveDags: []*entity.Dag{
+				{BaseInfo: entity.BaseInfo{ID: "new"}, Vars: entity.DagVars{"v": {Type: "number"}},
+					Tasks: []entity.Task{{ID: "t1", ActionName: "act"}}},
+			},
+			wantErrInvalid: true,
+		},
+		{
+			caseDesc: "invalid notification",
+			giveDags: []*entity.Dag{
+				{BaseInfo: entity.BaseInfo{ID: "new"}, Notifications: []entity.Notification{{Notifier: "ops"}},
+					Tasks: []entity.Task{{ID: "t1", ActionName: "act"}}},
+			},
+			wantErrInvalid: true,
+		},
+		{
+			caseDesc: "required var without default of cron dag",
+			giveDags: []*entity.Dag{
+				{BaseInfo: entity.BaseInfo{ID: "new"}, Cron: "* * * * *", Vars: entity.DagVars{"v": {Required: true}},
+					Tasks: []entity.Task{{ID: "t1", ActionName: "act"}}},
+			},
+			wantErrInvalid: true,
+		},
+		{
+			caseDesc: "validate",
+			giveDags: []*entity.Dag{
+				{BaseInfo: entity.BaseInfo{ID: "new"}, Tasks: []entity.Task{{ID: "t1", SubDag: &entity.SubDag{DagID: "other"}}}},
+			},
+			giveOpt:     &ApplyOption{Validate: true},
+			wantResult:  &ApplyResult{Dags: []DagApplyResult{{DagID: "new", Action: ApplyActionCreated}}},
+			wantCreated: []string{"new"},
+		},
+		{
+			caseDesc: "validate undefined action",
+			giveDags: []*entity.Dag{
+				{BaseInfo: entity.BaseInfo{ID: "new"}, Tasks: []entity.Task{{ID: "t1", ActionName: "undefined"}}},
+			},
+			giveOpt:        &ApplyOption{Validate: true},
+			wantErrInvalid: true,
+		},
+		{
+			caseDesc:       "prune without prefix",
+			giveOpt:        &ApplyOption{Prune: true},
+			wantErrInvalid: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			var created, updated []string
+			mStore := &MockStore{}
+			mStore.On("GetDag", mock.Anything).Return(func(id string) *entity.Dag {
+				if id == stored.ID {
+					return stored
+				}
+				return nil
+			}, func(id string) error {
+				if id == stored.ID {
+					return nil
+				}
+				return data.ErrDataNotFound
+			})
+			mStore.On("CreateDag", mock.Anything).Run(func(args mock.Arguments) {
+				dag := args.Get(0).(*entity.Dag)
+				if dag.Extends != "" {
+					assert.Equal(t, []string{"t1", "t2"}, []string{dag.Tasks[0].ID, dag.Tasks[1].ID})
+				}
+				created = append(created, dag.ID)
+			}).Return(nil)
+			mStore.On("UpdateDag", mock.Anything).Run(func(args mock.Arguments) {
+				dag := args.Get(0).(*entity.Dag)
+				assert.Equal(t, stored.CreatedAt, dag.CreatedAt)
+				updated = append(updated, dag.ID)
+			}).Return(nil)
+			SetStore(mStore)
+
+			ret, err := ApplyDags(tc.giveDags, tc.giveOpt)
+			if tc.wantErrInvalid {
+				assert.True(t, errors.Is(err, data.ErrDataInvalid))
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantResult, ret)
+			assert.Equal(t, tc.wantCreated, created)
+			assert.Equal(t, tc.wantUpdated, updated)
+		})
+	}
+}
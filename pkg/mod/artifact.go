@@ -0,0 +1,124 @@
+package mod
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/entity/run"
+	"github.com/etherealiy/fastflow/pkg/log"
+)
+
+// DefArtifactCollector mark the artifacts which are out of retention as deleted and remove their local files,
+// the artifacts stored in remote should be cleaned by lifecycle policy of the storage
+type DefArtifactCollector struct {
+	// retention is the default retention of artifacts which have no "ExpiredAt", 0 means keep forever
+	retention time.Duration
+	interval  time.Duration
+
+	wg      sync.WaitGroup
+	closeCh chan struct{}
+}
+
+// NewDefArtifactCollector
+func NewDefArtifactCollector(retention, interval time.Duration) *DefArtifactCollector {
+	return &DefArtifactCollector{
+		retention: retention,
+		interval:  interval,
+		closeCh:   make(chan struct{}),
+	}
+}
+
+// Init
+func (c *DefArtifactCollector) Init() {
+	c.wg.Add(1)
+	go c.watch()
+}
+
+// Close
+func (c *DefArtifactCollector) Close() {
+	close(c.closeCh)
+	c.wg.Wait()
+}
+
+func (c *DefArtifactCollector) watch() {
+	defer c.wg.Done()
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.closeCh:
+			return
+		case <-ticker.C:
+			if err := c.Collect(); err != nil {
+				log.Errorf("collect artifacts failed: %s", err)
+			}
+		}
+	}
+}
+
+// Collect the expired artifacts
+func (c *DefArtifactCollector) Collect() error {
+	taskIns, err := GetStore().ListTaskInstance(&ListTaskInstanceInput{HasArtifact: true})
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, t := range taskIns {
+		changed := false
+		for i := range t.Artifacts {
+			if t.Artifacts[i].Deleted || !c.isExpired(&t.Artifacts[i], now) {
+				continue
+			}
+			if err := removeLocalArtifact(&t.Artifacts[i]); err != nil {
+				taskInsLog(t).Errorf("remove artifact[%s] failed: %s", t.Artifacts[i].Name, err)
+				continue
+			}
+			t.Artifacts[i].Deleted = true
+			changed = true
+		}
+		if !changed {
+			continue
+		}
+		if err := GetStore().PatchTaskIns(&entity.TaskInstance{
+			BaseInfo:  t.BaseInfo,
+			Artifacts: t.Artifacts,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *DefArtifactCollector) isExpired(artifact *run.Artifact, now time.Time) bool {
+	if artifact.ExpiredAt > 0 {
+		return now.Unix() > artifact.ExpiredAt
+	}
+	return c.retention > 0 && now.Sub(time.Unix(artifact.CreatedAt, 0)) > c.retention
+}
+
+// LocalArtifactPath return the local path of artifact, it returns false when artifact is not stored in local
+func LocalArtifactPath(artifact *run.Artifact) (string, bool) {
+	if strings.HasPrefix(artifact.URI, "file://") {
+		return strings.TrimPrefix(artifact.URI, "file://"), true
+	}
+	if filepath.IsAbs(artifact.URI) {
+		return artifact.URI, true
+	}
+	return "", false
+}
+
+func removeLocalArtifact(artifact *run.Artifact) error {
+	path, ok := LocalArtifactPath(artifact)
+	if !ok {
+		return nil
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove %s failed: %w", path, err)
+	}
+	return nil
+}
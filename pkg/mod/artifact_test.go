@@ -0,0 +1,75 @@
+package mod
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/entity/run"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestDefArtifactCollector_Collect(t *testing.T) {
+	dir := t.TempDir()
+	expiredFile := filepath.Join(dir, "expired.txt")
+	assert.NoError(t, os.WriteFile(expiredFile, []byte("data"), 0644))
+	now := time.Now().Unix()
+
+	tests := []struct {
+		caseDesc      string
+		giveRetention time.Duration
+		giveTaskIns   []*entity.TaskInstance
+		wantPatch     []run.Artifact
+	}{
+		{
+			caseDesc: "nothing expired",
+			giveTaskIns: []*entity.TaskInstance{
+				{
+					BaseInfo:  entity.BaseInfo{ID: "task-ins1"},
+					Artifacts: []run.Artifact{{Name: "a", URI: "s3://bucket/a", CreatedAt: now - 3600}},
+				},
+			},
+		},
+		{
+			caseDesc:      "expired by retention and expired at",
+			giveRetention: time.Minute,
+			giveTaskIns: []*entity.TaskInstance{
+				{
+					BaseInfo: entity.BaseInfo{ID: "task-ins1"},
+					Artifacts: []run.Artifact{
+						{Name: "a", URI: "file://" + expiredFile, CreatedAt: now - 3600},
+						{Name: "b", URI: "s3://bucket/b", CreatedAt: now},
+						{Name: "c", URI: "s3://bucket/c", CreatedAt: now, ExpiredAt: now - 1},
+						{Name: "d", URI: "s3://bucket/d", CreatedAt: now - 3600, Deleted: true},
+					},
+				},
+			},
+			wantPatch: []run.Artifact{
+				{Name: "a", URI: "file://" + expiredFile, CreatedAt: now - 3600, Deleted: true},
+				{Name: "b", URI: "s3://bucket/b", CreatedAt: now},
+				{Name: "c", URI: "s3://bucket/c", CreatedAt: now, ExpiredAt: now - 1, Deleted: true},
+				{Name: "d", URI: "s3://bucket/d", CreatedAt: now - 3600, Deleted: true},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			mStore := &MockStore{}
+			mStore.On("ListTaskInstance", &ListTaskInstanceInput{HasArtifact: true}).Return(tc.giveTaskIns, nil)
+			var patched []run.Artifact
+			mStore.On("PatchTaskIns", mock.Anything).Run(func(args mock.Arguments) {
+				patched = args.Get(0).(*entity.TaskInstance).Artifacts
+			}).Return(nil)
+			SetStore(mStore)
+
+			c := NewDefArtifactCollector(tc.giveRetention, time.Minute)
+			assert.NoError(t, c.Collect())
+			assert.Equal(t, tc.wantPatch, patched)
+		})
+	}
+	assert.NoFileExists(t, expiredFile)
+}
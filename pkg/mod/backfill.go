@@ -0,0 +1,381 @@
+package mod
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/log"
+	"github.com/etherealiy/fastflow/pkg/utils/cron"
+	"github.com/etherealiy/fastflow/pkg/utils/data"
+)
+
+const (
+	// LabelBackfill is labeled to the dag instances created by backfill, the value is the id of backfill
+	LabelBackfill = "fastflow/backfill"
+	// DefaultBackfillDateFormat is the default layout of the date var
+	DefaultBackfillDateFormat = "2006-01-02"
+	// defaultBackfillSchedule is used when neither backfill nor dag has a schedule
+	defaultBackfillSchedule = "0 0 * * *"
+	// maxBackfillRuns limits the runs of a backfill, a larger range should be split
+	maxBackfillRuns = 1000
+)
+
+// backfillPollInterval is how often a backfill checks its runs and creates the next ones
+var backfillPollInterval = 5 * time.Second
+
+var (
+	backfills     = map[string]*backfill{}
+	backfillsLock sync.Mutex
+)
+
+// BackfillOrder is the order of creating the runs of backfill
+type BackfillOrder string
+
+const (
+	BackfillOrderOldestFirst BackfillOrder = "oldestFirst"
+	BackfillOrderNewestFirst BackfillOrder = "newestFirst"
+)
+
+// BackfillState
+type BackfillState string
+
+const (
+	BackfillStateRunning  BackfillState = "running"
+	BackfillStateSuccess  BackfillState = "success"
+	BackfillStateFailed   BackfillState = "failed"
+	BackfillStateCanceled BackfillState = "canceled"
+)
+
+// BackfillInput
+type BackfillInput struct {
+	// ID identify the backfill, a backfill is resumed without duplicated runs when it is started again with
+	// the same id, such as after the process restarted. Default is derived from dag id and the date range.
+	ID    string `json:"id,omitempty"`
+	DagID string `json:"dagId"`
+	// DateVar is the var of dag which is set to the logical date of each run, it must be declared by dag
+	DateVar string `json:"dateVar"`
+	// DateFormat is the layout of DateVar, default is DefaultBackfillDateFormat
+	DateFormat string `json:"dateFormat,omitempty"`
+	// Start and End is the date range, a run is created for each logical date in [Start, End)
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	// Schedule is the cron expression splitting the range into data intervals, default is the cron of dag
+	// or daily at midnight
+	Schedule string            `json:"schedule,omitempty"`
+	Vars     map[string]string `json:"vars,omitempty"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	// Parallelism is the max count of unfinished runs, default is 1, so the runs are executed one by one
+	Parallelism int `json:"parallelism,omitempty"`
+	// Order default is BackfillOrderOldestFirst
+	Order BackfillOrder `json:"order,omitempty"`
+	// StopOnFailure stop creating runs once a run failed, the created runs are not canceled
+	StopOnFailure bool `json:"stopOnFailure,omitempty"`
+}
+
+// BackfillRun is a data interval of backfill, LogicalDate is its start
+type BackfillRun struct {
+	LogicalDate     time.Time `json:"logicalDate"`
+	DataIntervalEnd time.Time `json:"dataIntervalEnd"`
+	// DagInsID is empty until the run is created
+	DagInsID string                   `json:"dagInsId,omitempty"`
+	Status   entity.DagInstanceStatus `json:"status,omitempty"`
+}
+
+// BackfillStatus
+type BackfillStatus struct {
+	Input  BackfillInput  `json:"input"`
+	State  BackfillState  `json:"state"`
+	Reason string         `json:"reason,omitempty"`
+	Runs   []*BackfillRun `json:"runs"`
+}
+
+// BackfillDagInsID is the id of dag instance created by backfill for the logical date
+func BackfillDagInsID(backfillID string, logicalDate time.Time) string {
+	return fmt.Sprintf("backfill-%s-%d", backfillID, logicalDate.Unix())
+}
+
+// PlanBackfill complete the default values of input and return its runs in the order of creating,
+// the runs have not been created
+func PlanBackfill(input *BackfillInput) ([]*BackfillRun, error) {
+	if input.DagID == "" {
+		return nil, fmt.Errorf("dag id cannot be empty: %w", data.ErrDataInvalid)
+	}
+	dag, err := GetStore().GetDag(input.DagID)
+	if err != nil {
+		return nil, err
+	}
+	if input.DateVar == "" {
+		return nil, fmt.Errorf("date var cannot be empty: %w", data.ErrDataInvalid)
+	}
+	if _, ok := dag.Vars[input.DateVar]; !ok {
+		return nil, fmt.Errorf("var[%s] is not declared by dag[%s]: %w", input.DateVar, dag.ID, data.ErrDataInvalid)
+	}
+	if input.Start.IsZero() || !input.Start.Before(input.End) {
+		return nil, fmt.Errorf("start[%s] should be before end[%s]: %w", input.Start, input.End, data.ErrDataInvalid)
+	}
+	if input.Parallelism < 0 {
+		return nil, fmt.Errorf("parallelism cannot be negative: %w", data.ErrDataInvalid)
+	}
+	if input.Parallelism == 0 {
+		input.Parallelism = 1
+	}
+	switch input.Order {
+	case "":
+		input.Order = BackfillOrderOldestFirst
+	case BackfillOrderOldestFirst, BackfillOrderNewestFirst:
+	default:
+		return nil, fmt.Errorf("order[%s] is invalid, it should be %s or %s: %w",
+			input.Order, BackfillOrderOldestFirst, BackfillOrderNewestFirst, data.ErrDataInvalid)
+	}
+	if input.DateFormat == "" {
+		input.DateFormat = DefaultBackfillDateFormat
+	}
+	if input.Schedule == "" {
+		input.Schedule = dag.Cron
+	}
+	if input.Schedule == "" {
+		input.Schedule = defaultBackfillSchedule
+	}
+	if input.ID == "" {
+		input.ID = fmt.Sprintf("%s-%d-%d", dag.ID, input.Start.Unix(), input.End.Unix())
+	}
+
+	sched, err := cron.Parse(input.Schedule)
+	if err != nil {
+		return nil, fmt.Errorf("schedule[%s] is invalid, %s: %w", input.Schedule, err, data.ErrDataInvalid)
+	}
+	var runs []*BackfillRun
+	// the start itself is included when it matches the schedule
+	for t := sched.Next(input.Start.Add(-time.Second)); !t.IsZero() && t.Before(input.End); t = sched.Next(t) {
+		if len(runs) == maxBackfillRuns {
+			return nil, fmt.Errorf("backfill has more than %d runs, the range should be split: %w",
+				maxBackfillRuns, data.ErrDataInvalid)
+		}
+		runs = append(runs, &BackfillRun{LogicalDate: t, DataIntervalEnd: sched.Next(t)})
+	}
+	if len(runs) == 0 {
+		return nil, fmt.Errorf("no time in [%s, %s) matches schedule[%s]: %w",
+			input.Start, input.End, input.Schedule, data.ErrDataInvalid)
+	}
+	if input.Order == BackfillOrderNewestFirst {
+		for i, j := 0, len(runs)-1; i < j; i, j = i+1, j-1 {
+			runs[i], runs[j] = runs[j], runs[i]
+		}
+	}
+	return runs, nil
+}
+
+// StartBackfill create the runs of backfill in background until all of them are finished, a run failed with
+// StopOnFailure, or it is canceled. The first runs are created before it returns, so an invalid var is reported
+// immediately. The backfill is driven by current process, start it again with the same id to resume it
+// after the process restarted.
+func StartBackfill(input *BackfillInput) (*BackfillStatus, error) {
+	runs, err := PlanBackfill(input)
+	if err != nil {
+		return nil, err
+	}
+	b := &backfill{
+		status:   BackfillStatus{Input: *input, State: BackfillStateRunning, Runs: runs},
+		cancelCh: make(chan struct{}),
+		doneCh:   make(chan struct{}),
+	}
+
+	backfillsLock.Lock()
+	defer backfillsLock.Unlock()
+	if old, ok := backfills[input.ID]; ok && old.getStatus().State == BackfillStateRunning {
+		return nil, fmt.Errorf("backfill[%s] is running: %w", input.ID, data.ErrDataConflicted)
+	}
+	done, err := b.step()
+	if err != nil {
+		return nil, err
+	}
+	backfills[input.ID] = b
+	if done {
+		close(b.doneCh)
+	} else {
+		go b.run()
+	}
+	return b.getStatus(), nil
+}
+
+// GetBackfill return the status of backfill started by current process
+func GetBackfill(id string) (*BackfillStatus, error) {
+	backfillsLock.Lock()
+	b, ok := backfills[id]
+	backfillsLock.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("backfill[%s]: %w", id, data.ErrDataNotFound)
+	}
+	return b.getStatus(), nil
+}
+
+// CancelBackfill stop creating the runs of backfill, the created runs are not canceled
+func CancelBackfill(id string) (*BackfillStatus, error) {
+	backfillsLock.Lock()
+	b, ok := backfills[id]
+	backfillsLock.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("backfill[%s]: %w", id, data.ErrDataNotFound)
+	}
+	b.mutex.Lock()
+	if b.status.State != BackfillStateRunning {
+		b.mutex.Unlock()
+		return nil, fmt.Errorf("backfill[%s] is %s, only the running one can be canceled: %w",
+			id, b.status.State, data.ErrDataConflicted)
+	}
+	b.status.State = BackfillStateCanceled
+	b.mutex.Unlock()
+
+	close(b.cancelCh)
+	<-b.doneCh
+	return b.getStatus(), nil
+}
+
+type backfill struct {
+	status BackfillStatus
+	mutex  sync.Mutex
+
+	cancelCh chan struct{}
+	doneCh   chan struct{}
+}
+
+func (b *backfill) getStatus() *BackfillStatus {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	ret := b.status
+	ret.Runs = make([]*BackfillRun, len(b.status.Runs))
+	for i, r := range b.status.Runs {
+		cp := *r
+		ret.Runs[i] = &cp
+	}
+	return &ret
+}
+
+func (b *backfill) run() {
+	defer close(b.doneCh)
+	ticker := time.NewTicker(backfillPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.cancelCh:
+			return
+		case <-ticker.C:
+		}
+		done, err := b.step()
+		// the dag is deleted or changed so that it cannot be run any more
+		if errors.Is(err, data.ErrDataNotFound) || errors.Is(err, data.ErrDataInvalid) {
+			b.mutex.Lock()
+			b.status.State, b.status.Reason = BackfillStateFailed, err.Error()
+			b.mutex.Unlock()
+			return
+		}
+		if err != nil {
+			// check it again in next interval
+			log.Errorf("step backfill[%s] failed: %s", b.status.Input.ID, err)
+			continue
+		}
+		if done {
+			return
+		}
+	}
+}
+
+// step refresh the statuses of created runs and create the next ones in order until the parallelism is reached,
+// it returns true when the backfill is finished
+func (b *backfill) step() (bool, error) {
+	input := b.status.Input
+	existed, err := GetStore().ListDagInstance(&ListDagInstanceInput{
+		DagID:  input.DagID,
+		Labels: map[string]string{LabelBackfill: input.ID},
+	})
+	if err != nil {
+		return false, fmt.Errorf("list dag instances of backfill failed: %w", err)
+	}
+	statuses := map[string]entity.DagInstanceStatus{}
+	for _, dagIns := range existed {
+		statuses[dagIns.ID] = dagIns.Status
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.status.State != BackfillStateRunning {
+		return true, nil
+	}
+	unfinished, failed, pending := 0, 0, 0
+	for _, r := range b.status.Runs {
+		id := BackfillDagInsID(input.ID, r.LogicalDate)
+		if status, ok := statuses[id]; ok {
+			r.DagInsID, r.Status = id, status
+		}
+		switch {
+		case r.DagInsID == "":
+			pending++
+		case r.Status == entity.DagInstanceStatusFailed:
+			failed++
+		case r.Status != entity.DagInstanceStatusSuccess:
+			unfinished++
+		}
+	}
+	if failed > 0 && input.StopOnFailure {
+		b.status.State, b.status.Reason = BackfillStateFailed, fmt.Sprintf("%d runs failed", failed)
+		return true, nil
+	}
+
+	for _, r := range b.status.Runs {
+		if unfinished >= input.Parallelism {
+			break
+		}
+		if r.DagInsID != "" {
+			continue
+		}
+		dagIns, err := runBackfill(&input, r)
+		if err != nil {
+			return false, err
+		}
+		r.DagInsID, r.Status = dagIns.ID, dagIns.Status
+		unfinished++
+		pending--
+	}
+	if pending > 0 || unfinished > 0 {
+		return false, nil
+	}
+	b.status.State = BackfillStateSuccess
+	if failed > 0 {
+		b.status.State, b.status.Reason = BackfillStateFailed, fmt.Sprintf("%d runs failed", failed)
+	}
+	return true, nil
+}
+
+func runBackfill(input *BackfillInput, r *BackfillRun) (*entity.DagInstance, error) {
+	vars := map[string]string{}
+	for k, v := range input.Vars {
+		vars[k] = v
+	}
+	vars[input.DateVar] = r.LogicalDate.Format(input.DateFormat)
+	labels := map[string]string{}
+	for k, v := range input.Labels {
+		labels[k] = v
+	}
+	labels[LabelBackfill] = input.ID
+
+	id := BackfillDagInsID(input.ID, r.LogicalDate)
+	dagIns, err := runDag(input.DagID, vars, newRunDagOption([]RunDagOptSetter{
+		RunDagID(id),
+		RunDagTrigger(entity.TriggerBackfill, &entity.TriggerMeta{BackfillID: input.ID}),
+		RunDagLabels(labels),
+		RunDagLogicalDate(r.LogicalDate),
+		RunDagDataInterval(r.LogicalDate, r.DataIntervalEnd),
+	}))
+	// it is created by the backfill with the same id in another process
+	if errors.Is(err, data.ErrDataConflicted) {
+		return GetStore().GetDagInstance(id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("run dag[%s] of backfill[%s] at %s failed: %w", input.DagID, input.ID, r.LogicalDate, err)
+	}
+	dagInsLog(dagIns.ID).Infof("dag[%s] is backfilled at %s", input.DagID, r.LogicalDate)
+	return dagIns, nil
+}
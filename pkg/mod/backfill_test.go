@@ -0,0 +1,231 @@
+package mod
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/utils/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestPlanBackfill(t *testing.T) {
+	mStore := &MockStore{}
+	mStore.On("GetDag", "dag1").Return(&entity.Dag{
+		BaseInfo: entity.BaseInfo{ID: "dag1"},
+		Vars:     entity.DagVars{"ds": {}},
+	}, nil)
+	mStore.On("GetDag", "cron-dag").Return(&entity.Dag{
+		BaseInfo: entity.BaseInfo{ID: "cron-dag"},
+		Cron:     "0 */12 * * *",
+		Vars:     entity.DagVars{"ds": {}},
+	}, nil)
+	SetStore(mStore)
+
+	day := func(d int) time.Time {
+		return time.Date(2023, 1, d, 0, 0, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		caseDesc     string
+		giveInput    *BackfillInput
+		wantDates    []time.Time
+		wantInput    *BackfillInput
+		wantErrValid bool
+	}{
+		{
+			caseDesc:  "daily by default",
+			giveInput: &BackfillInput{DagID: "dag1", DateVar: "ds", Start: day(1), End: day(4)},
+			wantDates: []time.Time{day(1), day(2), day(3)},
+			wantInput: &BackfillInput{
+				ID: "dag1-1672531200-1672790400", DagID: "dag1", DateVar: "ds", DateFormat: DefaultBackfillDateFormat,
+				Start: day(1), End: day(4), Schedule: "0 0 * * *", Parallelism: 1, Order: BackfillOrderOldestFirst,
+			},
+		},
+		{
+			caseDesc:  "schedule of dag",
+			giveInput: &BackfillInput{DagID: "cron-dag", DateVar: "ds", Start: day(1).Add(time.Hour), End: day(2).Add(time.Hour)},
+			wantDates: []time.Time{day(1).Add(12 * time.Hour), day(2)},
+		},
+		{
+			caseDesc: "newest first",
+			giveInput: &BackfillInput{DagID: "dag1", DateVar: "ds", Start: day(1), End: day(2), Schedule: "0 8,16 * * *",
+				Order: BackfillOrderNewestFirst},
+			wantDates: []time.Time{day(1).Add(16 * time.Hour), day(1).Add(8 * time.Hour)},
+		},
+		{
+			caseDesc:     "undeclared var",
+			giveInput:    &BackfillInput{DagID: "dag1", DateVar: "date", Start: day(1), End: day(2)},
+			wantErrValid: true,
+		},
+		{
+			caseDesc:     "end before start",
+			giveInput:    &BackfillInput{DagID: "dag1", DateVar: "ds", Start: day(2), End: day(1)},
+			wantErrValid: true,
+		},
+		{
+			caseDesc:     "invalid order",
+			giveInput:    &BackfillInput{DagID: "dag1", DateVar: "ds", Start: day(1), End: day(2), Order: "random"},
+			wantErrValid: true,
+		},
+		{
+			caseDesc:     "no matched time",
+			giveInput:    &BackfillInput{DagID: "dag1", DateVar: "ds", Start: day(1).Add(time.Hour), End: day(2)},
+			wantErrValid: true,
+		},
+		{
+			caseDesc:     "too many runs",
+			giveInput:    &BackfillInput{DagID: "dag1", DateVar: "ds", Start: day(1), End: day(2), Schedule: "* * * * *"},
+			wantErrValid: true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			runs, err := PlanBackfill(tc.giveInput)
+			if tc.wantErrValid {
+				assert.True(t, errors.Is(err, data.ErrDataInvalid), err)
+				return
+			}
+			assert.NoError(t, err)
+			var dates []time.Time
+			for i, r := range runs {
+				dates = append(dates, r.LogicalDate)
+				assert.True(t, r.DataIntervalEnd.After(r.LogicalDate), "run %d", i)
+			}
+			assert.Equal(t, tc.wantDates, dates)
+			if tc.wantInput != nil {
+				assert.Equal(t, tc.wantInput, tc.giveInput)
+			}
+		})
+	}
+}
+
+// backfillStore keep the dag instances created by backfill in memory
+type backfillStore struct {
+	MockStore
+	dagIns []*entity.DagInstance
+	mutex  sync.Mutex
+}
+
+func newBackfillStore() *backfillStore {
+	st := &backfillStore{}
+	st.On("GetDag", "dag1").Return(&entity.Dag{
+		BaseInfo: entity.BaseInfo{ID: "dag1"},
+		Status:   entity.DagStatusNormal,
+		Vars:     entity.DagVars{"ds": {Required: true}, "region": {DefaultValue: "us"}},
+	}, nil)
+	st.On("CreateDagIns", mock.Anything).Run(func(args mock.Arguments) {
+		st.mutex.Lock()
+		defer st.mutex.Unlock()
+		cp := *args.Get(0).(*entity.DagInstance)
+		st.dagIns = append(st.dagIns, &cp)
+	}).Return(nil)
+	st.On("ListDagInstance", mock.Anything).Return(func(input *ListDagInstanceInput) []*entity.DagInstance {
+		st.mutex.Lock()
+		defer st.mutex.Unlock()
+		var ret []*entity.DagInstance
+		for _, dagIns := range st.dagIns {
+			if input.Match(dagIns) {
+				cp := *dagIns
+				ret = append(ret, &cp)
+			}
+		}
+		return ret
+	}, nil)
+	return st
+}
+
+// finish set the status of created dag instances in order, it returns their ids
+func (st *backfillStore) finish(status ...entity.DagInstanceStatus) []string {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	var ids []string
+	for i, dagIns := range st.dagIns {
+		if i < len(status) {
+			dagIns.Status = status[i]
+		}
+		ids = append(ids, dagIns.ID)
+	}
+	return ids
+}
+
+func waitBackfill(t *testing.T, id string, state BackfillState) *BackfillStatus {
+	var ret *BackfillStatus
+	assert.Eventually(t, func() bool {
+		var err error
+		ret, err = GetBackfill(id)
+		return err == nil && ret.State == state
+	}, time.Second, 5*time.Millisecond)
+	return ret
+}
+
+func TestStartBackfill(t *testing.T) {
+	backfillPollInterval = 5 * time.Millisecond
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("bounded parallelism", func(t *testing.T) {
+		st := newBackfillStore()
+		SetStore(st)
+		ret, err := StartBackfill(&BackfillInput{
+			ID: "parallel", DagID: "dag1", DateVar: "ds", Start: start, End: start.AddDate(0, 0, 3), Parallelism: 2,
+			Order: BackfillOrderNewestFirst, Vars: map[string]string{"region": "eu"}, Labels: map[string]string{"team": "data"},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, BackfillStateRunning, ret.State)
+		assert.Equal(t, []string{"backfill-parallel-1672704000", "backfill-parallel-1672617600"}, st.finish())
+
+		dagIns := st.dagIns[0]
+		assert.Equal(t, entity.TriggerBackfill, dagIns.Trigger)
+		assert.Equal(t, &entity.TriggerMeta{BackfillID: "parallel"}, dagIns.TriggerMeta)
+		assert.Equal(t, map[string]string{"team": "data", LabelBackfill: "parallel"}, dagIns.Labels)
+		assert.Equal(t, entity.DagInstanceVars{"ds": {Value: "2023-01-03"}, "region": {Value: "eu"}}, dagIns.Vars)
+		assert.Equal(t, start.AddDate(0, 0, 2).Unix(), dagIns.LogicalDate)
+		assert.Equal(t, start.AddDate(0, 0, 3).Unix(), dagIns.DataIntervalEnd)
+
+		_, err = StartBackfill(&BackfillInput{ID: "parallel", DagID: "dag1", DateVar: "ds", Start: start, End: start.AddDate(0, 0, 3)})
+		assert.True(t, errors.Is(err, data.ErrDataConflicted))
+
+		st.finish(entity.DagInstanceStatusSuccess)
+		assert.Eventually(t, func() bool {
+			return len(st.finish()) == 3
+		}, time.Second, 5*time.Millisecond)
+		st.finish(entity.DagInstanceStatusSuccess, entity.DagInstanceStatusSuccess, entity.DagInstanceStatusFailed)
+		ret = waitBackfill(t, "parallel", BackfillStateFailed)
+		assert.Equal(t, "1 runs failed", ret.Reason)
+		assert.Equal(t, entity.DagInstanceStatusFailed, ret.Runs[2].Status)
+	})
+
+	t.Run("stop on failure", func(t *testing.T) {
+		st := newBackfillStore()
+		SetStore(st)
+		_, err := StartBackfill(&BackfillInput{
+			ID: "stop", DagID: "dag1", DateVar: "ds", Start: start, End: start.AddDate(0, 0, 3), StopOnFailure: true,
+		})
+		assert.NoError(t, err)
+		st.finish(entity.DagInstanceStatusFailed)
+		waitBackfill(t, "stop", BackfillStateFailed)
+		assert.Equal(t, []string{"backfill-stop-1672531200"}, st.finish())
+	})
+
+	t.Run("resume and cancel", func(t *testing.T) {
+		st := newBackfillStore()
+		SetStore(st)
+		input := &BackfillInput{ID: "resume", DagID: "dag1", DateVar: "ds", Start: start, End: start.AddDate(0, 0, 3)}
+		_, err := StartBackfill(input)
+		assert.NoError(t, err)
+		_, err = CancelBackfill("resume")
+		assert.NoError(t, err)
+		_, err = CancelBackfill("resume")
+		assert.True(t, errors.Is(err, data.ErrDataConflicted))
+
+		st.finish(entity.DagInstanceStatusSuccess)
+		ret, err := StartBackfill(input)
+		assert.NoError(t, err)
+		assert.Equal(t, entity.DagInstanceStatusSuccess, ret.Runs[0].Status)
+		assert.Equal(t, []string{"backfill-resume-1672531200", "backfill-resume-1672617600"}, st.finish())
+		_, err = CancelBackfill("resume")
+		assert.NoError(t, err)
+	})
+}
@@ -0,0 +1,66 @@
+package mod
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/utils/data"
+)
+
+// CallbackInput is the result of external callback
+type CallbackInput struct {
+	// Status is success or failed
+	Status   entity.TaskInstanceStatus
+	Reason   string
+	Operator string
+	// Outputs are published to the task instance, so downstream tasks can use them
+	Outputs map[string]interface{}
+}
+
+// CompleteCallback complete the blocked task instance waiting for external callback by its token,
+// the task instance is continued and its action decides the final status by the result
+func CompleteCallback(token string, input *CallbackInput) (*entity.TaskInstance, error) {
+	if input.Status != entity.TaskInstanceStatusSuccess && input.Status != entity.TaskInstanceStatusFailed {
+		return nil, fmt.Errorf("callback status must be success or failed: %w", data.ErrDataInvalid)
+	}
+	taskInsID, ok := entity.ParseCallbackToken(token)
+	if !ok {
+		return nil, fmt.Errorf("callback token is invalid: %w", data.ErrDataNotFound)
+	}
+	taskIns, err := GetStore().GetTaskIns(taskInsID)
+	if err != nil {
+		return nil, err
+	}
+	cb := taskIns.Callback
+	if cb == nil || !cb.Verify(token) {
+		return nil, fmt.Errorf("callback token is invalid: %w", data.ErrDataNotFound)
+	}
+	if cb.Expired(time.Now()) {
+		return nil, fmt.Errorf("callback is expired: %w", data.ErrDataConflicted)
+	}
+	if taskIns.Status != entity.TaskInstanceStatusBlocked || cb.Attempt != len(taskIns.Attempts) {
+		return nil, fmt.Errorf("task instance[%s] is not waiting for callback: %w", taskIns.ID, data.ErrDataConflicted)
+	}
+	if err := cb.Complete(input.Status == entity.TaskInstanceStatusSuccess, input.Operator, input.Reason); err != nil {
+		return nil, fmt.Errorf("%s: %w", err, data.ErrDataConflicted)
+	}
+
+	// the task instance from store has no patch function, so outputs are patched with callback together
+	for key, value := range input.Outputs {
+		if err := PublishOutput(taskIns, key, value); err != nil {
+			return nil, err
+		}
+	}
+	if err := GetStore().PatchTaskIns(&entity.TaskInstance{
+		BaseInfo: taskIns.BaseInfo,
+		Outputs:  taskIns.Outputs,
+		Callback: cb,
+	}); err != nil {
+		return nil, fmt.Errorf("save callback failed: %w", err)
+	}
+	if err := GetCommander().ContinueTask([]string{taskIns.ID}); err != nil {
+		return nil, err
+	}
+	return taskIns, nil
+}
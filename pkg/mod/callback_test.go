@@ -0,0 +1,133 @@
+package mod
+
+import (
+	"testing"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/entity/run"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type continueCommander struct {
+	Commander
+	continued []string
+}
+
+func (c *continueCommander) ContinueTask(taskInsIds []string, ops ...CommandOptSetter) error {
+	c.continued = append(c.continued, taskInsIds...)
+	return nil
+}
+
+func TestCompleteCallback(t *testing.T) {
+	newTaskIns := func(ttl time.Duration) (*entity.TaskInstance, string) {
+		taskIns := &entity.TaskInstance{
+			BaseInfo: entity.BaseInfo{ID: "task-ins1"},
+			Status:   entity.TaskInstanceStatusBlocked,
+		}
+		cb, token, err := entity.NewExternalCallback(taskIns, ttl)
+		assert.NoError(t, err)
+		taskIns.Callback = cb
+		return taskIns, token
+	}
+
+	tests := []struct {
+		caseDesc      string
+		giveTaskIns   func() (*entity.TaskInstance, string)
+		giveToken     string
+		giveInput     *CallbackInput
+		wantCallback  *entity.ExternalCallback
+		wantOutputs   map[string]run.Output
+		wantContinued []string
+		wantErr       string
+	}{
+		{
+			caseDesc:    "approved",
+			giveTaskIns: func() (*entity.TaskInstance, string) { return newTaskIns(time.Hour) },
+			giveInput: &CallbackInput{
+				Status:   entity.TaskInstanceStatusSuccess,
+				Operator: "ops",
+				Outputs:  map[string]interface{}{"ticket": "OPS-1"},
+			},
+			wantCallback:  &entity.ExternalCallback{Result: entity.TaskInstanceStatusSuccess, Operator: "ops"},
+			wantOutputs:   map[string]run.Output{"ticket": {Value: "OPS-1", Size: 7}},
+			wantContinued: []string{"task-ins1"},
+		},
+		{
+			caseDesc:      "rejected",
+			giveTaskIns:   func() (*entity.TaskInstance, string) { return newTaskIns(0) },
+			giveInput:     &CallbackInput{Status: entity.TaskInstanceStatusFailed, Operator: "ops", Reason: "not now"},
+			wantCallback:  &entity.ExternalCallback{Result: entity.TaskInstanceStatusFailed, Operator: "ops", Reason: "not now"},
+			wantContinued: []string{"task-ins1"},
+		},
+		{
+			caseDesc:    "invalid status",
+			giveTaskIns: func() (*entity.TaskInstance, string) { return newTaskIns(0) },
+			giveInput:   &CallbackInput{Status: entity.TaskInstanceStatusSkipped},
+			wantErr:     "callback status must be success or failed: data invalid",
+		},
+		{
+			caseDesc:    "wrong secret",
+			giveTaskIns: func() (*entity.TaskInstance, string) { return newTaskIns(0) },
+			giveToken:   "task-ins1.secret",
+			giveInput:   &CallbackInput{Status: entity.TaskInstanceStatusSuccess},
+			wantErr:     "callback token is invalid: data not found",
+		},
+		{
+			caseDesc: "expired",
+			giveTaskIns: func() (*entity.TaskInstance, string) {
+				taskIns, token := newTaskIns(time.Hour)
+				taskIns.Callback.ExpiresAt = time.Now().Add(-time.Minute).Unix()
+				return taskIns, token
+			},
+			giveInput: &CallbackInput{Status: entity.TaskInstanceStatusSuccess},
+			wantErr:   "callback is expired: data conflicted",
+		},
+		{
+			caseDesc: "not blocked",
+			giveTaskIns: func() (*entity.TaskInstance, string) {
+				taskIns, token := newTaskIns(0)
+				taskIns.Status = entity.TaskInstanceStatusFailed
+				return taskIns, token
+			},
+			giveInput: &CallbackInput{Status: entity.TaskInstanceStatusSuccess},
+			wantErr:   "task instance[task-ins1] is not waiting for callback: data conflicted",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			taskIns, token := tc.giveTaskIns()
+			if tc.giveToken != "" {
+				token = tc.giveToken
+			}
+			var patched *entity.TaskInstance
+			mStore := &MockStore{}
+			mStore.On("GetTaskIns", "task-ins1").Return(taskIns, nil)
+			mStore.On("PatchTaskIns", mock.Anything).Run(func(args mock.Arguments) {
+				patched = args.Get(0).(*entity.TaskInstance)
+			}).Return(nil)
+			SetStore(mStore)
+			commander := &continueCommander{}
+			SetCommander(commander)
+
+			_, err := CompleteCallback(token, tc.giveInput)
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+				assert.Nil(t, patched)
+				assert.Empty(t, commander.continued)
+				return
+			}
+			assert.NoError(t, err)
+			if assert.NotNil(t, patched) {
+				assert.Equal(t, tc.wantOutputs, patched.Outputs)
+				assert.Equal(t, tc.wantCallback.Result, patched.Callback.Result)
+				assert.Equal(t, tc.wantCallback.Operator, patched.Callback.Operator)
+				assert.Equal(t, tc.wantCallback.Reason, patched.Callback.Reason)
+				assert.NotZero(t, patched.Callback.CompletedAt)
+			}
+			assert.Equal(t, tc.wantContinued, commander.continued)
+		})
+	}
+}
@@ -0,0 +1,220 @@
+package mod
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/utils/data"
+)
+
+// ClientOption
+type ClientOption struct {
+	// MaxRetries is the max retry times of transient errors, default is 3, negative means no retry
+	MaxRetries int
+	// RetryBackoff is the backoff of first retry and it doubles after each retry, default is 100ms
+	RetryBackoff time.Duration
+	// Retryable decide whether an error should be retried, default is IsTransientError
+	Retryable func(err error) bool
+}
+
+// Client is the context-aware api of commands, it returns typed results and retries transient store errors.
+// Different from Commander, it always executes commands by the built-in implementation.
+//
+//	ret, err := mod.NewClient(nil).RunDag(ctx, &mod.RunDagRequest{DagID: "dag", IdempotencyKey: requestID})
+type Client struct {
+	opt ClientOption
+}
+
+// NewClient
+func NewClient(opt *ClientOption) *Client {
+	c := &Client{}
+	if opt != nil {
+		c.opt = *opt
+	}
+	if c.opt.MaxRetries == 0 {
+		c.opt.MaxRetries = 3
+	}
+	if c.opt.RetryBackoff <= 0 {
+		c.opt.RetryBackoff = 100 * time.Millisecond
+	}
+	if c.opt.Retryable == nil {
+		c.opt.Retryable = IsTransientError
+	}
+	return c
+}
+
+// IsTransientError check if the error is marked as data.ErrDataTransient by store
+func IsTransientError(err error) bool {
+	return errors.Is(err, data.ErrDataTransient)
+}
+
+// RunDagRequest
+type RunDagRequest struct {
+	DagID string
+	Vars  map[string]string
+	// IdempotencyKey make the request safe to be retried, the dag instance created by the same key
+	// in IdempotencyWindow is returned instead of creating a new one, see RunDagIdempotencyKey
+	IdempotencyKey string
+	// IdempotencyWindow zero means forever
+	IdempotencyWindow time.Duration
+	Options           []RunDagOptSetter
+}
+
+// RunDagResult
+type RunDagResult struct {
+	DagInsID string
+	// Created is false when the dag instance was created by a previous request with the same idempotency key
+	Created bool
+	DagIns  *entity.DagInstance
+}
+
+// CommandResult
+type CommandResult struct {
+	DagInsID string
+	// TaskInsIDs are the task instances affected by command
+	TaskInsIDs []string
+	Affected   int
+}
+
+// RunDag create a dag instance, it is retried only when IdempotencyKey is set, because a failed
+// creating may have been persisted
+func (c *Client) RunDag(ctx context.Context, req *RunDagRequest) (*RunDagResult, error) {
+	opt := newRunDagOption(req.Options)
+	if req.IdempotencyKey != "" {
+		opt.idempotencyKey = req.IdempotencyKey
+		opt.idempotencyWindow = req.IdempotencyWindow
+	}
+
+	ret := &RunDagResult{}
+	do := func() error {
+		dagIns, created, err := runDagIdempotent(req.DagID, req.Vars, opt)
+		if err != nil {
+			return err
+		}
+		ret.DagIns, ret.Created = dagIns, created
+		return nil
+	}
+
+	var err error
+	if req.IdempotencyKey != "" {
+		err = c.retry(ctx, do)
+	} else if err = ctx.Err(); err == nil {
+		err = do()
+	}
+	if err != nil {
+		return nil, err
+	}
+	ret.DagInsID = ret.DagIns.ID
+	return ret, nil
+}
+
+// RetryDagIns retry the failed and canceled task instances of dag instance
+func (c *Client) RetryDagIns(ctx context.Context, dagInsId string, ops ...CommandOptSetter) (*CommandResult, error) {
+	return c.commandDagIns(ctx, dagInsId, retryableTaskStatus, retryTask, ops)
+}
+
+// RetryFromFailed retry the failed and canceled task instances of a failed dag instance and rerun their downstream
+func (c *Client) RetryFromFailed(ctx context.Context, dagInsId string, ops ...CommandOptSetter) (*CommandResult, error) {
+	return c.commandDagIns(ctx, dagInsId, retryableTaskStatus, retryFromFailed, ops)
+}
+
+// RetryTask
+func (c *Client) RetryTask(ctx context.Context, taskInsIds []string, ops ...CommandOptSetter) (*CommandResult, error) {
+	return c.commandTasks(ctx, taskInsIds, retryTask, ops)
+}
+
+// CancelTask
+func (c *Client) CancelTask(ctx context.Context, taskInsIds []string, ops ...CommandOptSetter) (*CommandResult, error) {
+	return c.commandTasks(ctx, taskInsIds, cancelTask, ops)
+}
+
+// ContinueDagIns continue the blocked task instances of dag instance
+func (c *Client) ContinueDagIns(ctx context.Context, dagInsId string, ops ...CommandOptSetter) (*CommandResult, error) {
+	return c.commandDagIns(ctx, dagInsId, continuableTaskStatus, continueTask, ops)
+}
+
+// ContinueTask
+func (c *Client) ContinueTask(ctx context.Context, taskInsIds []string, ops ...CommandOptSetter) (*CommandResult, error) {
+	return c.commandTasks(ctx, taskInsIds, continueTask, ops)
+}
+
+// SkipTask mark the blocked or failed task instances as skipped by operator
+func (c *Client) SkipTask(ctx context.Context, taskInsIds []string, operator, reason string, ops ...CommandOptSetter) (*CommandResult, error) {
+	return c.commandTasks(ctx, taskInsIds, skipTask(operator, reason), ops)
+}
+
+// AddNote is not retried, because retrying may add duplicated notes
+func (c *Client) AddNote(ctx context.Context, dagInsId, content, author string) (*entity.DagInstance, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return (&DefCommander{}).AddNote(dagInsId, content, author)
+}
+
+// Annotate
+func (c *Client) Annotate(ctx context.Context, dagInsId string, annotations map[string]string) (*entity.DagInstance, error) {
+	var ret *entity.DagInstance
+	err := c.retry(ctx, func() (err error) {
+		ret, err = (&DefCommander{}).Annotate(dagInsId, annotations)
+		return err
+	})
+	return ret, err
+}
+
+type taskCommand func(ctx context.Context, taskInsIds []string, opt CommandOption) (string, error)
+
+func (c *Client) commandDagIns(
+	ctx context.Context,
+	dagInsId string,
+	status []entity.TaskInstanceStatus,
+	cmd taskCommand,
+	ops []CommandOptSetter) (*CommandResult, error) {
+	var taskInsIds []string
+	if err := c.retry(ctx, func() (err error) {
+		taskInsIds, err = listDagTaskIDs(dagInsId, status)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	return c.commandTasks(ctx, taskInsIds, cmd, ops)
+}
+
+func (c *Client) commandTasks(ctx context.Context, taskInsIds []string, cmd taskCommand, ops []CommandOptSetter) (*CommandResult, error) {
+	opt := initOption(ops)
+	var dagInsId string
+	if err := c.retry(ctx, func() (err error) {
+		dagInsId, err = cmd(ctx, taskInsIds, opt)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	return &CommandResult{DagInsID: dagInsId, TaskInsIDs: taskInsIds, Affected: len(taskInsIds)}, nil
+}
+
+func (c *Client) retry(ctx context.Context, do func() error) error {
+	backoff := c.opt.RetryBackoff
+	for i := 0; ; i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		err := do()
+		if err == nil || i >= c.opt.MaxRetries || !c.opt.Retryable(err) {
+			if err != nil && i > 0 {
+				return fmt.Errorf("failed after %d retries: %w", i, err)
+			}
+			return err
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
@@ -0,0 +1,149 @@
+package mod
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/utils/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestClient_RunDag(t *testing.T) {
+	transientErr := data.Transient(errors.New("timeout"))
+	conflictErr := fmt.Errorf("create failed: %w", data.ErrIdempotencyKeyConflicted)
+	now := time.Now().Unix()
+	tests := []struct {
+		caseDesc       string
+		giveReq        *RunDagRequest
+		giveCreateErrs []error
+		giveListRet    []*entity.DagInstance
+		wantErr        bool
+		wantCreated    bool
+		wantDagInsID   string
+		wantCreateCnt  int
+		wantPatchCnt   int
+	}{
+		{
+			caseDesc:       "without idempotency key",
+			giveReq:        &RunDagRequest{DagID: "dag"},
+			giveCreateErrs: []error{nil},
+			wantCreated:    true,
+			wantDagInsID:   "new",
+			wantCreateCnt:  1,
+		},
+		{
+			caseDesc:       "transient error is not retried without idempotency key",
+			giveReq:        &RunDagRequest{DagID: "dag"},
+			giveCreateErrs: []error{transientErr},
+			wantErr:        true,
+			wantCreateCnt:  1,
+		},
+		{
+			caseDesc:       "retry with idempotency key",
+			giveReq:        &RunDagRequest{DagID: "dag", IdempotencyKey: "req-1"},
+			giveCreateErrs: []error{transientErr, nil},
+			wantCreated:    true,
+			wantDagInsID:   "new",
+			wantCreateCnt:  2,
+		},
+		{
+			caseDesc:       "existed idempotency key",
+			giveReq:        &RunDagRequest{DagID: "dag", IdempotencyKey: "req-1"},
+			giveCreateErrs: []error{conflictErr},
+			giveListRet:    []*entity.DagInstance{{BaseInfo: entity.BaseInfo{ID: "existed", CreatedAt: now}}},
+			wantDagInsID:   "existed",
+			wantCreateCnt:  1,
+		},
+		{
+			caseDesc:       "existed idempotency key out of window",
+			giveReq:        &RunDagRequest{DagID: "dag", IdempotencyKey: "req-1", IdempotencyWindow: time.Minute},
+			giveCreateErrs: []error{conflictErr, nil},
+			giveListRet:    []*entity.DagInstance{{BaseInfo: entity.BaseInfo{ID: "existed", CreatedAt: now - 120}}},
+			wantCreated:    true,
+			wantDagInsID:   "new",
+			wantCreateCnt:  2,
+			wantPatchCnt:   1,
+		},
+		{
+			caseDesc:       "non transient error",
+			giveReq:        &RunDagRequest{DagID: "dag", IdempotencyKey: "req-1"},
+			giveCreateErrs: []error{errors.New("invalid")},
+			wantErr:        true,
+			wantCreateCnt:  1,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			createCnt, patchCnt := 0, 0
+			mStore := &MockStore{}
+			mStore.On("ListDagInstance", mock.Anything).Return(func(input *ListDagInstanceInput) []*entity.DagInstance {
+				assert.Equal(t, tc.giveReq.IdempotencyKey, input.IdempotencyKey)
+				return tc.giveListRet
+			}, nil)
+			mStore.On("PatchDagIns", mock.Anything, "IdempotencyKey").Return(func(*entity.DagInstance, ...string) error {
+				patchCnt++
+				return nil
+			})
+			mStore.On("GetDag", "dag").Return(&entity.Dag{BaseInfo: entity.BaseInfo{ID: "dag"}, Status: entity.DagStatusNormal}, nil)
+			mStore.On("CreateDagIns", mock.Anything).Return(func(dagIns *entity.DagInstance) error {
+				createCnt++
+				assert.Equal(t, tc.giveReq.IdempotencyKey, dagIns.IdempotencyKey)
+				dagIns.ID = "new"
+				return tc.giveCreateErrs[createCnt-1]
+			})
+			SetStore(mStore)
+
+			ret, err := NewClient(&ClientOption{RetryBackoff: time.Millisecond}).RunDag(context.Background(), tc.giveReq)
+			assert.Equal(t, tc.wantCreateCnt, createCnt)
+			assert.Equal(t, tc.wantPatchCnt, patchCnt)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantDagInsID, ret.DagInsID)
+			assert.Equal(t, tc.wantCreated, ret.Created)
+		})
+	}
+}
+
+func TestClient_RetryDagIns(t *testing.T) {
+	patchCnt := 0
+	mStore := &MockStore{}
+	mStore.On("ListTaskInstance", mock.Anything).Return([]*entity.TaskInstance{
+		{BaseInfo: entity.BaseInfo{ID: "t1"}, DagInsID: "dag-ins"},
+		{BaseInfo: entity.BaseInfo{ID: "t2"}, DagInsID: "dag-ins"},
+	}, nil)
+	mStore.On("GetDagInstance", "dag-ins").Return(func(string) *entity.DagInstance {
+		return &entity.DagInstance{BaseInfo: entity.BaseInfo{ID: "dag-ins"}, Status: entity.DagInstanceStatusFailed}
+	}, nil)
+	mStore.On("PatchDagIns", mock.Anything).Return(func(*entity.DagInstance, ...string) error {
+		patchCnt++
+		if patchCnt == 1 {
+			return data.Transient(errors.New("network error"))
+		}
+		return nil
+	})
+	SetStore(mStore)
+	mKeep := &MockKeeper{}
+	mKeep.On("IsAlive", mock.Anything).Return(true, nil)
+	SetKeeper(mKeep)
+
+	c := NewClient(&ClientOption{RetryBackoff: time.Millisecond})
+	ret, err := c.RetryDagIns(context.Background(), "dag-ins")
+	assert.NoError(t, err)
+	assert.Equal(t, &CommandResult{DagInsID: "dag-ins", TaskInsIDs: []string{"t1", "t2"}, Affected: 2}, ret)
+	assert.Equal(t, 2, patchCnt)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = c.CancelTask(ctx, []string{"t1"})
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 2, patchCnt, "canceled context should not execute command")
+}
@@ -0,0 +1,153 @@
+package mod
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/event"
+	"github.com/etherealiy/fastflow/pkg/log"
+	"github.com/etherealiy/fastflow/pkg/utils/data"
+	"github.com/shiningrush/goevent"
+)
+
+var clusterConfig atomic.Value
+
+// GetClusterConfig return the runtime config observed by current worker, it never returns nil
+func GetClusterConfig() *entity.ClusterConfig {
+	if cfg, ok := clusterConfig.Load().(*entity.ClusterConfig); ok {
+		return cfg
+	}
+	return &entity.ClusterConfig{}
+}
+
+// SetClusterConfig set the runtime config observed by current worker, it is called by DefClusterConfigWatcher,
+// use UpdateClusterConfig to change config of all workers
+func SetClusterConfig(cfg *entity.ClusterConfig) {
+	clusterConfig.Store(cfg)
+}
+
+// UpdateClusterConfig persist the runtime config, it is observed by all workers in next sync interval
+func UpdateClusterConfig(cfg *entity.ClusterConfig) (*entity.ClusterConfig, error) {
+	st, ok := StoreAs[ClusterConfigStore](GetStore())
+	if !ok {
+		return nil, fmt.Errorf("store does not support cluster config")
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", err, data.ErrDataInvalid)
+	}
+	cfg.UpdatedAt = time.Now().Unix()
+	if err := st.SaveClusterConfig(cfg); err != nil {
+		return nil, err
+	}
+	applyClusterConfig(cfg)
+	return cfg, nil
+}
+
+// LoadClusterConfig read the persisted runtime config, it returns empty config when it is not saved
+func LoadClusterConfig() (*entity.ClusterConfig, error) {
+	st, ok := StoreAs[ClusterConfigStore](GetStore())
+	if !ok {
+		return nil, fmt.Errorf("store does not support cluster config")
+	}
+	cfg, err := st.GetClusterConfig()
+	if errors.Is(err, data.ErrDataNotFound) {
+		return &entity.ClusterConfig{}, nil
+	}
+	return cfg, err
+}
+
+// applyClusterConfig update the observed config, resize executor when its concurrency changed,
+// and leave standby mode when the cluster is promoted
+func applyClusterConfig(cfg *entity.ClusterConfig) bool {
+	old := GetClusterConfig()
+	if reflect.DeepEqual(old, cfg) {
+		return false
+	}
+	SetClusterConfig(cfg)
+	observePromotion(cfg)
+	if old.ExecutorWorkerCnt != cfg.ExecutorWorkerCnt {
+		if e, ok := GetExecutor().(interface{ SetWorkerNumber(workers int) }); ok {
+			e.SetWorkerNumber(cfg.ExecutorWorkerCnt)
+		}
+	}
+	goevent.Publish(&event.ClusterConfigChanged{Config: cfg})
+	return true
+}
+
+// DefClusterConfigWatcher sync the runtime config from store periodically, it runs on every worker
+type DefClusterConfigWatcher struct {
+	interval time.Duration
+
+	wg      sync.WaitGroup
+	closeCh chan struct{}
+}
+
+// NewDefClusterConfigWatcher
+func NewDefClusterConfigWatcher(interval time.Duration) *DefClusterConfigWatcher {
+	return &DefClusterConfigWatcher{
+		interval: interval,
+		closeCh:  make(chan struct{}),
+	}
+}
+
+// Init load the config synchronously, so components observe it as soon as they start
+func (w *DefClusterConfigWatcher) Init() {
+	if err := w.Sync(); err != nil {
+		log.Errorf("sync cluster config failed: %s", err)
+	}
+	w.wg.Add(1)
+	go w.watch()
+}
+
+// Close
+func (w *DefClusterConfigWatcher) Close() {
+	close(w.closeCh)
+	w.wg.Wait()
+}
+
+func (w *DefClusterConfigWatcher) watch() {
+	defer w.wg.Done()
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.closeCh:
+			return
+		case <-ticker.C:
+			if err := w.Sync(); err != nil {
+				log.Errorf("sync cluster config failed: %s", err)
+			}
+		}
+	}
+}
+
+// Sync load the persisted config and apply it
+func (w *DefClusterConfigWatcher) Sync() error {
+	cfg, err := LoadClusterConfig()
+	if err != nil {
+		return err
+	}
+	if applyClusterConfig(cfg) {
+		log.Infof("cluster config changed, updated at %d", cfg.UpdatedAt)
+	}
+	return nil
+}
+
+func secsOr(secs int, def time.Duration) time.Duration {
+	if secs == 0 {
+		return def
+	}
+	return time.Duration(secs) * time.Second
+}
+
+func intOr(v, def int) int {
+	if v == 0 {
+		return def
+	}
+	return v
+}
@@ -0,0 +1,110 @@
+package mod
+
+import (
+	"testing"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/utils/data"
+	"github.com/stretchr/testify/assert"
+)
+
+type clusterConfigMockStore struct {
+	*MockStore
+	cfg *entity.ClusterConfig
+}
+
+func (s *clusterConfigMockStore) GetClusterConfig() (*entity.ClusterConfig, error) {
+	if s.cfg == nil {
+		return nil, data.ErrDataNotFound
+	}
+	return s.cfg, nil
+}
+
+func (s *clusterConfigMockStore) SaveClusterConfig(cfg *entity.ClusterConfig) error {
+	s.cfg = cfg
+	return nil
+}
+
+func TestUpdateClusterConfig(t *testing.T) {
+	defer SetClusterConfig(&entity.ClusterConfig{})
+	tests := []struct {
+		caseDesc   string
+		giveStore  Store
+		giveCfg    *entity.ClusterConfig
+		wantErr    string
+		wantSaved  *entity.ClusterConfig
+		wantLoaded *entity.ClusterConfig
+	}{
+		{
+			caseDesc:   "normal",
+			giveStore:  &clusterConfigMockStore{MockStore: &MockStore{}},
+			giveCfg:    &entity.ClusterConfig{DispatchBatchSize: 10},
+			wantSaved:  &entity.ClusterConfig{DispatchBatchSize: 10},
+			wantLoaded: &entity.ClusterConfig{DispatchBatchSize: 10},
+		},
+		{
+			caseDesc:   "invalid",
+			giveStore:  &clusterConfigMockStore{MockStore: &MockStore{}},
+			giveCfg:    &entity.ClusterConfig{ExecutorWorkerCnt: -1},
+			wantErr:    "executorWorkerCnt cannot be negative: data invalid",
+			wantLoaded: &entity.ClusterConfig{},
+		},
+		{
+			caseDesc:  "not supported",
+			giveStore: &MockStore{},
+			giveCfg:   &entity.ClusterConfig{},
+			wantErr:   "store does not support cluster config",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			SetStore(tc.giveStore)
+			SetClusterConfig(&entity.ClusterConfig{})
+			ret, err := UpdateClusterConfig(tc.giveCfg)
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+			} else {
+				assert.NoError(t, err)
+				assert.NotZero(t, ret.UpdatedAt)
+				tc.wantSaved.UpdatedAt = ret.UpdatedAt
+				tc.wantLoaded.UpdatedAt = ret.UpdatedAt
+				assert.Equal(t, tc.wantSaved, GetClusterConfig())
+			}
+			loaded, err := LoadClusterConfig()
+			if tc.wantLoaded == nil {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantLoaded, loaded)
+		})
+	}
+}
+
+func TestDefClusterConfigWatcher_Sync(t *testing.T) {
+	defer SetClusterConfig(&entity.ClusterConfig{})
+	SetClusterConfig(&entity.ClusterConfig{})
+
+	exe := NewDefExecutor(time.Second, 2)
+	exe.Init()
+	defer exe.Close()
+	SetExecutor(exe)
+
+	st := &clusterConfigMockStore{MockStore: &MockStore{}, cfg: &entity.ClusterConfig{ExecutorWorkerCnt: 5}}
+	SetStore(st)
+	w := NewDefClusterConfigWatcher(time.Second)
+	assert.NoError(t, w.Sync())
+	assert.Equal(t, 5, GetClusterConfig().ExecutorWorkerCnt)
+	assert.Equal(t, 5, exe.workerNumber)
+
+	st.cfg = &entity.ClusterConfig{ExecutorWorkerCnt: 1}
+	assert.NoError(t, w.Sync())
+	assert.Equal(t, 1, exe.workerNumber)
+
+	st.cfg = nil
+	assert.NoError(t, w.Sync())
+	assert.Equal(t, &entity.ClusterConfig{}, GetClusterConfig())
+	assert.Equal(t, 2, exe.workerNumber)
+}
@@ -1,6 +1,7 @@
 package mod
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"math/rand"
@@ -8,6 +9,8 @@ import (
 	"time"
 
 	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/log"
+	"github.com/etherealiy/fastflow/pkg/utils/data"
 )
 
 var _ Commander = (*DefCommander)(nil)
@@ -17,51 +20,186 @@ type DefCommander struct {
 }
 
 // RunDag
-func (c *DefCommander) RunDag(dagId string, specVars map[string]string) (*entity.DagInstance, error) {
+func (c *DefCommander) RunDag(dagId string, specVars map[string]string, ops ...RunDagOptSetter) (*entity.DagInstance, error) {
+	return runDag(dagId, specVars, newRunDagOption(ops))
+}
+
+func newRunDagOption(ops []RunDagOptSetter) *RunDagOption {
+	opt := &RunDagOption{trigger: entity.TriggerManually}
+	for _, op := range ops {
+		op(opt)
+	}
+	return opt
+}
+
+func runDag(dagId string, specVars map[string]string, opt *RunDagOption) (*entity.DagInstance, error) {
+	dagIns, _, err := runDagIdempotent(dagId, specVars, opt)
+	return dagIns, err
+}
+
+// runDagIdempotent return the existing dag instance and false when it has the idempotency key in window
+func runDagIdempotent(dagId string, specVars map[string]string, opt *RunDagOption) (*entity.DagInstance, bool, error) {
+	if err := checkActive(); err != nil {
+		return nil, false, err
+	}
 	dag, err := GetStore().GetDag(dagId)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
-	dagIns, err := dag.Run(entity.TriggerManually, specVars)
+	dagIns, err := dag.Run(opt.trigger, specVars)
 	if err != nil {
-		return nil, err
+		return nil, false, err
+	}
+	dagIns.ID = opt.id
+	dagIns.TriggerMeta = opt.triggerMeta
+	dagIns.Labels = opt.labels
+	dagIns.IdempotencyKey = opt.idempotencyKey
+	if opt.parent != nil {
+		dagIns.SetParent(opt.parent)
+	}
+	if err := dagIns.SetLogicalDate(opt.logicalDate, opt.intervalStart, opt.intervalEnd); err != nil {
+		return nil, false, err
 	}
 
-	if err := GetStore().CreateDagIns(dagIns); err != nil {
-		return nil, err
+	if dagIns.IdempotencyKey == "" {
+		if err := GetStore().CreateDagIns(dagIns); err != nil {
+			return nil, false, err
+		}
+		return dagIns, true, nil
 	}
-	return dagIns, nil
+	return createIdempotentDagIns(dagIns, opt.idempotencyWindow)
+}
+
+// maxIdempotentCreateRetry is the times to retry when the key is released or taken by others in the meantime
+const maxIdempotentCreateRetry = 3
+
+// createIdempotentDagIns create the dag instance unless a dag instance of the same dag has the idempotency key,
+// the existing one created in window is returned, otherwise its key is removed and creating is retried
+func createIdempotentDagIns(dagIns *entity.DagInstance, window time.Duration) (*entity.DagInstance, bool, error) {
+	for i := 0; i < maxIdempotentCreateRetry; i++ {
+		err := GetStore().CreateDagIns(dagIns)
+		if err == nil {
+			return dagIns, true, nil
+		}
+		if !errors.Is(err, data.ErrIdempotencyKeyConflicted) {
+			return nil, false, err
+		}
+
+		existed, err := GetStore().ListDagInstance(&ListDagInstanceInput{
+			DagID:          dagIns.DagID,
+			IdempotencyKey: dagIns.IdempotencyKey,
+			Limit:          1,
+		})
+		if err != nil {
+			return nil, false, err
+		}
+		if len(existed) == 0 {
+			continue
+		}
+		if window <= 0 || time.Since(time.Unix(existed[0].CreatedAt, 0)) < window {
+			return existed[0], false, nil
+		}
+		if err := GetStore().PatchDagIns(&entity.DagInstance{BaseInfo: entity.BaseInfo{ID: existed[0].ID}},
+			"IdempotencyKey"); err != nil && !errors.Is(err, data.ErrDataNotFound) {
+			return nil, false, fmt.Errorf("release idempotency key of dag instance[%s] failed: %w", existed[0].ID, err)
+		}
+	}
+	return nil, false, fmt.Errorf("idempotency key[%s] of dag[%s] is changed by others too frequently: %w",
+		dagIns.IdempotencyKey, dagIns.DagID, data.ErrIdempotencyKeyConflicted)
 }
 
+var (
+	retryableTaskStatus = []entity.TaskInstanceStatus{
+		entity.TaskInstanceStatusFailed, entity.TaskInstanceStatusInvalidParams, entity.TaskInstanceStatusCanceled}
+	continuableTaskStatus = []entity.TaskInstanceStatus{entity.TaskInstanceStatusBlocked}
+	skippableTaskStatus   = []entity.TaskInstanceStatus{
+		entity.TaskInstanceStatusBlocked, entity.TaskInstanceStatusFailed, entity.TaskInstanceStatusInvalidParams}
+)
+
 // RetryDagIns
 func (c *DefCommander) RetryDagIns(dagInsId string, ops ...CommandOptSetter) error {
-	return c.autoLoopDagTasks(
-		dagInsId,
-		[]entity.TaskInstanceStatus{entity.TaskInstanceStatusFailed, entity.TaskInstanceStatusCanceled},
-		c.RetryTask,
-		ops...)
+	return c.autoLoopDagTasks(dagInsId, retryableTaskStatus, c.RetryTask, ops...)
 }
 
 // RetryTask
 func (c *DefCommander) RetryTask(taskInsIds []string, ops ...CommandOptSetter) error {
-	opt := initOption(ops)
-	return executeCommand(taskInsIds, func(dagIns *entity.DagInstance, isWorkerAlive bool) error {
-		if !isWorkerAlive {
-			aliveNodes, err := GetKeeper().AliveNodes()
-			if err != nil {
-				return err
-			}
-			dagIns.Worker = aliveNodes[rand.Intn(len(aliveNodes))]
+	_, err := retryTask(context.Background(), taskInsIds, initOption(ops))
+	return err
+}
+
+func retryTask(ctx context.Context, taskInsIds []string, opt CommandOption) (string, error) {
+	return executeCommand(ctx, taskInsIds, func(dagIns *entity.DagInstance, isWorkerAlive bool) error {
+		return performRetry(dagIns, isWorkerAlive, taskInsIds)
+	}, opt)
+}
+
+func performRetry(dagIns *entity.DagInstance, isWorkerAlive bool, taskInsIds []string) error {
+	if err := reassignWorker(dagIns, isWorkerAlive); err != nil {
+		return err
+	}
+	return dagIns.Retry(taskInsIds)
+}
+
+// reassignWorker hand the dag instance over to an alive worker when its worker is dead
+func reassignWorker(dagIns *entity.DagInstance, isWorkerAlive bool) error {
+	if isWorkerAlive {
+		return nil
+	}
+	aliveNodes, err := GetKeeper().AliveNodes()
+	if err != nil {
+		return err
+	}
+	dagIns.Worker = aliveNodes[rand.Intn(len(aliveNodes))]
+	return nil
+}
+
+// RetryFromFailed retry the failed and canceled task instances of a failed dag instance, and reset their
+// downstream task instances to init, so the dag instance continues from there without rerunning the succeeded ones
+func (c *DefCommander) RetryFromFailed(dagInsId string, ops ...CommandOptSetter) error {
+	taskIds, err := listDagTaskIDs(dagInsId, retryableTaskStatus)
+	if err != nil {
+		return err
+	}
+	_, err = retryFromFailed(context.Background(), taskIds, initOption(ops))
+	return err
+}
+
+func retryFromFailed(ctx context.Context, taskInsIds []string, opt CommandOption) (string, error) {
+	return executeCommand(ctx, taskInsIds, func(dagIns *entity.DagInstance, isWorkerAlive bool) error {
+		if err := reassignWorker(dagIns, isWorkerAlive); err != nil {
+			return err
 		}
-		return dagIns.Retry(taskInsIds)
+		return dagIns.RetryFromFailed(taskInsIds)
 	}, opt)
 }
 
+// Requeue take the dag instance out of dead letter and retry its failed tasks with a new retry budget
+func (c *DefCommander) Requeue(dagInsId string, ops ...CommandOptSetter) error {
+	taskIds, err := listDagTaskIDs(dagInsId, retryableTaskStatus)
+	if err != nil {
+		return err
+	}
+	_, err = executeCommand(context.Background(), taskIds, func(dagIns *entity.DagInstance, isWorkerAlive bool) error {
+		if dagIns.ID != dagInsId {
+			return fmt.Errorf("task instances are not from dag instance[%s]", dagInsId)
+		}
+		if err := dagIns.Requeue(); err != nil {
+			return err
+		}
+		return performRetry(dagIns, isWorkerAlive, taskIds)
+	}, initOption(ops))
+	return err
+}
+
 // CancelTask
 func (c *DefCommander) CancelTask(taskInsIds []string, ops ...CommandOptSetter) error {
-	opt := initOption(ops)
-	return executeCommand(taskInsIds, func(dagIns *entity.DagInstance, isWorkerAlive bool) error {
+	_, err := cancelTask(context.Background(), taskInsIds, initOption(ops))
+	return err
+}
+
+func cancelTask(ctx context.Context, taskInsIds []string, opt CommandOption) (string, error) {
+	return executeCommand(ctx, taskInsIds, func(dagIns *entity.DagInstance, isWorkerAlive bool) error {
 		if !isWorkerAlive {
 			return fmt.Errorf("worker is not healthy, you can not cancel it")
 		}
@@ -69,19 +207,39 @@ func (c *DefCommander) CancelTask(taskInsIds []string, ops ...CommandOptSetter)
 	}, opt)
 }
 
+// CancelDagIns fail the unfinished dag instance and cancel its unfinished tasks, so no more tasks are executed.
+// When the owner worker is alive, it is handed over to the worker and finished asynchronously.
+func (c *DefCommander) CancelDagIns(dagInsId, reason string) error {
+	if err := checkActive(); err != nil {
+		return err
+	}
+	dagIns, err := GetStore().GetDagInstance(dagInsId)
+	if err != nil {
+		return err
+	}
+	if dagIns.Status == entity.DagInstanceStatusSuccess || dagIns.Status == entity.DagInstanceStatusFailed {
+		return fmt.Errorf("dag instance is %s, only the unfinished one can be canceled: %w",
+			dagIns.Status, data.ErrDataConflicted)
+	}
+	if reason == "" {
+		reason = "canceled manually"
+	}
+	return cancelDagIns(dagIns, reason)
+}
+
 // ContinueDagIns using to continue a blocked dag instance
 func (c *DefCommander) ContinueDagIns(dagInsId string, ops ...CommandOptSetter) error {
-	return c.autoLoopDagTasks(
-		dagInsId,
-		[]entity.TaskInstanceStatus{entity.TaskInstanceStatusBlocked},
-		c.ContinueTask,
-		ops...)
+	return c.autoLoopDagTasks(dagInsId, continuableTaskStatus, c.ContinueTask, ops...)
 }
 
 // ContinueTask using to continue many blocked task instances
 func (c *DefCommander) ContinueTask(taskInsIds []string, ops ...CommandOptSetter) error {
-	opt := initOption(ops)
-	return executeCommand(taskInsIds, func(dagIns *entity.DagInstance, isWorkerAlive bool) error {
+	_, err := continueTask(context.Background(), taskInsIds, initOption(ops))
+	return err
+}
+
+func continueTask(ctx context.Context, taskInsIds []string, opt CommandOption) (string, error) {
+	return executeCommand(ctx, taskInsIds, func(dagIns *entity.DagInstance, isWorkerAlive bool) error {
 		if !isWorkerAlive {
 			aliveNodes, err := GetKeeper().AliveNodes()
 			if err != nil {
@@ -93,29 +251,94 @@ func (c *DefCommander) ContinueTask(taskInsIds []string, ops ...CommandOptSetter
 	}, opt)
 }
 
+// SkipTask mark the blocked or failed task instances as skipped manually, so their downstream tasks can proceed,
+// the operator and reason are recorded in the task instances for audit
+func (c *DefCommander) SkipTask(taskInsIds []string, operator, reason string, ops ...CommandOptSetter) error {
+	_, err := skipTask(operator, reason)(context.Background(), taskInsIds, initOption(ops))
+	return err
+}
+
+func skipTask(operator, reason string) taskCommand {
+	return func(ctx context.Context, taskInsIds []string, opt CommandOption) (string, error) {
+		return executeCommand(ctx, taskInsIds, func(dagIns *entity.DagInstance, isWorkerAlive bool) error {
+			if err := reassignWorker(dagIns, isWorkerAlive); err != nil {
+				return err
+			}
+			return dagIns.Skip(taskInsIds, operator, reason)
+		}, opt)
+	}
+}
+
+// AddNote attach a free-text note to dag instance
+func (c *DefCommander) AddNote(dagInsId, content, author string) (*entity.DagInstance, error) {
+	if err := checkActive(); err != nil {
+		return nil, err
+	}
+	dagIns, err := GetStore().GetDagInstance(dagInsId)
+	if err != nil {
+		return nil, err
+	}
+	if err := dagIns.AddNote(content, author); err != nil {
+		return nil, err
+	}
+	if err := GetStore().PatchDagIns(&entity.DagInstance{
+		BaseInfo: dagIns.BaseInfo,
+		Notes:    dagIns.Notes,
+	}); err != nil {
+		return nil, err
+	}
+	return dagIns, nil
+}
+
+// Annotate merge key/value annotations to dag instance, the key with empty value will be removed
+func (c *DefCommander) Annotate(dagInsId string, annotations map[string]string) (*entity.DagInstance, error) {
+	if err := checkActive(); err != nil {
+		return nil, err
+	}
+	dagIns, err := GetStore().GetDagInstance(dagInsId)
+	if err != nil {
+		return nil, err
+	}
+	dagIns.Annotate(annotations)
+	if err := GetStore().PatchDagIns(&entity.DagInstance{
+		BaseInfo:    dagIns.BaseInfo,
+		Annotations: dagIns.Annotations,
+	}); err != nil {
+		return nil, err
+	}
+	return dagIns, nil
+}
+
 func (c *DefCommander) autoLoopDagTasks(
 	dagInsId string,
 	status []entity.TaskInstanceStatus,
 	cmdOp func(taskInsIds []string, ops ...CommandOptSetter) error,
 	ops ...CommandOptSetter) error {
+	taskIds, err := listDagTaskIDs(dagInsId, status)
+	if err != nil {
+		return err
+	}
+	return cmdOp(taskIds, ops...)
+}
+
+func listDagTaskIDs(dagInsId string, status []entity.TaskInstanceStatus) ([]string, error) {
 	taskIns, err := GetStore().ListTaskInstance(&ListTaskInstanceInput{
 		DagInsID: dagInsId,
 		Status:   status,
 	})
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if len(taskIns) == 0 {
-		return fmt.Errorf("no %+v task instance", status)
+		return nil, fmt.Errorf("no %+v task instance", status)
 	}
 
 	var taskIds []string
 	for _, t := range taskIns {
 		taskIds = append(taskIds, t.ID)
 	}
-
-	return cmdOp(taskIds, ops...)
+	return taskIds, nil
 }
 
 func initOption(opSetter []CommandOptSetter) (opt CommandOption) {
@@ -127,19 +350,24 @@ func initOption(opSetter []CommandOptSetter) (opt CommandOption) {
 	return
 }
 
+// executeCommand return the dag instance id which the task instances belong to
 func executeCommand(
+	ctx context.Context,
 	taskInsIds []string,
 	perform func(dagIns *entity.DagInstance, isWorkerAlive bool) error,
-	opt CommandOption) error {
+	opt CommandOption) (string, error) {
+	if err := checkActive(); err != nil {
+		return "", err
+	}
 	if len(taskInsIds) == 0 {
-		return errors.New("here is no any task by give task's ids")
+		return "", errors.New("here is no any task by give task's ids")
 	}
 
 	taskIns, err := GetStore().ListTaskInstance(&ListTaskInstanceInput{
 		IDs: taskInsIds,
 	})
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	if len(taskInsIds) != len(taskIns) {
@@ -156,47 +384,91 @@ func executeCommand(
 				notFoundIds = append(notFoundIds, id)
 			}
 		}
-		return fmt.Errorf("id[%s] does not found task instance", strings.Join(notFoundIds, ", "))
+		return "", fmt.Errorf("id[%s] does not found task instance", strings.Join(notFoundIds, ", "))
 	}
 
 	dagInsId := taskIns[0].DagInsID
 	for _, t := range taskIns {
 		if t.DagInsID != dagInsId {
-			return fmt.Errorf("task instance[%s] is from different dag instance", t.ID)
+			return "", fmt.Errorf("task instance[%s] is from different dag instance", t.ID)
 		}
 	}
 
 	dagIns, err := GetStore().GetDagInstance(dagInsId)
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	isWorkerAlive, err := GetKeeper().IsAlive(dagIns.Worker)
 	if err != nil {
-		return err
+		return "", err
 	}
 
+	inDeadLetter := dagIns.DeadLetter != nil
+	retryCount := dagIns.RetryCount
 	if err := perform(dagIns, isWorkerAlive); err != nil {
-		return err
+		return "", err
 	}
-	if err := GetStore().PatchDagIns(&entity.DagInstance{
+	var mustsPatchFields []string
+	if inDeadLetter && dagIns.DeadLetter == nil {
+		mustsPatchFields = append(mustsPatchFields, "DeadLetter")
+	}
+	patch := &entity.DagInstance{
 		BaseInfo: dagIns.BaseInfo,
 		Worker:   dagIns.Worker,
 		Cmd:      dagIns.Cmd,
-	}); err != nil {
-		return err
+	}
+	if err := patchRetriedDagIns(patch, retryCount, dagIns.RetryCount, mustsPatchFields...); err != nil {
+		return "", err
 	}
 
 	if opt.isSync {
-		return ensureCmdExecuted(dagInsId, opt)
+		return dagInsId, ensureCmdExecuted(ctx, dagInsId, opt)
 	}
 
-	return nil
+	return dagInsId, nil
+}
+
+// patchRetriedDagIns patch the command of dag instance with the retry count changed from oldCount to newCount,
+// the count is swapped in the same transaction as patch, or given back when patch failed without transactions
+func patchRetriedDagIns(patch *entity.DagInstance, oldCount, newCount int, mustsPatchFields ...string) error {
+	_, isTx := StoreAs[TxStore](GetStore())
+	return WithTx(func(st Store) error {
+		var rs RetryCountStore
+		if newCount != oldCount {
+			var ok bool
+			if rs, ok = StoreAs[RetryCountStore](st); ok {
+				// the retry budget is checked against the count read before, so it must not be changed by others
+				swapped, err := rs.SwapRetryCount(patch.ID, oldCount, newCount)
+				if err != nil {
+					return err
+				}
+				if !swapped {
+					return fmt.Errorf("retry count of dag instance[%s] is changed by others, please try again: %w",
+						patch.ID, data.ErrDataConflicted)
+				}
+			} else {
+				// the retry budget is best-effort when the store cannot swap the count atomically
+				patch.RetryCount = newCount
+			}
+		}
+		if err := st.PatchDagIns(patch, mustsPatchFields...); err != nil {
+			if rs != nil && !isTx {
+				if _, serr := rs.SwapRetryCount(patch.ID, newCount, oldCount); serr != nil {
+					log.Warnf("give back retry count of dag instance[%s] failed: %s", patch.ID, serr)
+				}
+			}
+			return err
+		}
+		return nil
+	})
 }
 
-func ensureCmdExecuted(dagInsId string, opt CommandOption) error {
+func ensureCmdExecuted(ctx context.Context, dagInsId string, opt CommandOption) error {
 	timer := time.NewTimer(opt.syncTimeout)
+	defer timer.Stop()
 	ticker := time.NewTicker(opt.syncInterval)
+	defer ticker.Stop()
 	for {
 		select {
 		case <-ticker.C:
@@ -209,6 +481,8 @@ func ensureCmdExecuted(dagInsId string, opt CommandOption) error {
 			}
 		case <-timer.C:
 			return fmt.Errorf("watch command executing timeout")
+		case <-ctx.Done():
+			return ctx.Err()
 		}
 	}
 }
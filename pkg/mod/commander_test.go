@@ -1,6 +1,7 @@
 package mod
 
 import (
+	"context"
 	"fmt"
 	"testing"
 	"time"
@@ -15,6 +16,7 @@ func TestDefCommander_RunDag(t *testing.T) {
 		caseDesc      string
 		giveDagId     string
 		giveVars      map[string]string
+		giveOps       []RunDagOptSetter
 		giveDag       *entity.Dag
 		giveGetErr    error
 		giveCreateErr error
@@ -38,6 +40,66 @@ func TestDefCommander_RunDag(t *testing.T) {
 				ShareData: &entity.ShareData{},
 			},
 		},
+		{
+			caseDesc:  "with trigger and labels",
+			giveDagId: "test-dag",
+			giveOps: []RunDagOptSetter{
+				RunDagTrigger(entity.TriggerWebhook, &entity.TriggerMeta{Source: "github"}),
+				RunDagLabels(map[string]string{"team": "infra"}),
+			},
+			giveDag: &entity.Dag{
+				BaseInfo: entity.BaseInfo{
+					ID: "test-dag",
+				},
+				Status: entity.DagStatusNormal,
+			},
+			wantDagIns: &entity.DagInstance{
+				DagID:       "test-dag",
+				Vars:        entity.DagInstanceVars{},
+				Trigger:     entity.TriggerWebhook,
+				TriggerMeta: &entity.TriggerMeta{Source: "github"},
+				Labels:      map[string]string{"team": "infra"},
+				Status:      entity.DagInstanceStatusInit,
+				ShareData:   &entity.ShareData{},
+			},
+		},
+		{
+			caseDesc:  "with data interval",
+			giveDagId: "test-dag",
+			giveOps: []RunDagOptSetter{
+				RunDagDataInterval(time.Unix(100, 0), time.Unix(200, 0)),
+			},
+			giveDag: &entity.Dag{
+				BaseInfo: entity.BaseInfo{
+					ID: "test-dag",
+				},
+				Status: entity.DagStatusNormal,
+			},
+			wantDagIns: &entity.DagInstance{
+				DagID:             "test-dag",
+				Vars:              entity.DagInstanceVars{},
+				Trigger:           entity.TriggerManually,
+				Status:            entity.DagInstanceStatusInit,
+				ShareData:         &entity.ShareData{},
+				LogicalDate:       100,
+				DataIntervalStart: 100,
+				DataIntervalEnd:   200,
+			},
+		},
+		{
+			caseDesc:  "invalid data interval",
+			giveDagId: "test-dag",
+			giveOps: []RunDagOptSetter{
+				RunDagDataInterval(time.Unix(200, 0), time.Unix(100, 0)),
+			},
+			giveDag: &entity.Dag{
+				BaseInfo: entity.BaseInfo{
+					ID: "test-dag",
+				},
+				Status: entity.DagStatusNormal,
+			},
+			wantErr: fmt.Errorf("data interval end[%s] cannot be before start[%s]", time.Unix(100, 0), time.Unix(200, 0)),
+		},
 		{
 			caseDesc:   "get failed",
 			giveDagId:  "test-dag",
@@ -84,12 +146,20 @@ func TestDefCommander_RunDag(t *testing.T) {
 				assert.Equal(t, tc.giveDagId, args.Get(0))
 			}).Return(tc.giveDag, tc.giveGetErr)
 			mStore.On("CreateDagIns", mock.Anything).Run(func(args mock.Arguments) {
-				assert.Equal(t, tc.wantDagIns, args.Get(0))
+				dagIns := args.Get(0).(*entity.DagInstance)
+				if tc.wantDagIns.LogicalDate == 0 {
+					// default logical date is now
+					assert.InDelta(t, time.Now().Unix(), dagIns.LogicalDate, 1)
+					tc.wantDagIns.LogicalDate = dagIns.LogicalDate
+					tc.wantDagIns.DataIntervalStart = dagIns.LogicalDate
+					tc.wantDagIns.DataIntervalEnd = dagIns.LogicalDate
+				}
+				assert.Equal(t, tc.wantDagIns, dagIns)
 			}).Return(tc.giveCreateErr)
 			SetStore(mStore)
 
 			c := &DefCommander{}
-			dagIns, err := c.RunDag(tc.giveDagId, tc.giveVars)
+			dagIns, err := c.RunDag(tc.giveDagId, tc.giveVars, tc.giveOps...)
 			assert.Equal(t, tc.wantErr, err)
 			if err == nil {
 				assert.Equal(t, tc.wantDagIns, dagIns)
@@ -116,7 +186,7 @@ func TestDefCommander_OpDagIns(t *testing.T) {
 			wantListInput: []*ListTaskInstanceInput{
 				{
 					DagInsID: "dagInsId",
-					Status:   []entity.TaskInstanceStatus{entity.TaskInstanceStatusFailed, entity.TaskInstanceStatusCanceled},
+					Status:   []entity.TaskInstanceStatus{entity.TaskInstanceStatusFailed, entity.TaskInstanceStatusInvalidParams, entity.TaskInstanceStatusCanceled},
 				},
 				{
 					IDs: []string{"testTaskId", "testTaskId2"},
@@ -173,7 +243,7 @@ func TestDefCommander_OpDagIns(t *testing.T) {
 			wantListInput: []*ListTaskInstanceInput{
 				{
 					DagInsID: "dagInsId",
-					Status:   []entity.TaskInstanceStatus{entity.TaskInstanceStatusFailed, entity.TaskInstanceStatusCanceled},
+					Status:   []entity.TaskInstanceStatus{entity.TaskInstanceStatusFailed, entity.TaskInstanceStatusInvalidParams, entity.TaskInstanceStatusCanceled},
 				},
 			},
 			giveListErr: fmt.Errorf("list failed"),
@@ -185,11 +255,11 @@ func TestDefCommander_OpDagIns(t *testing.T) {
 			wantListInput: []*ListTaskInstanceInput{
 				{
 					DagInsID: "dagInsId",
-					Status:   []entity.TaskInstanceStatus{entity.TaskInstanceStatusFailed, entity.TaskInstanceStatusCanceled},
+					Status:   []entity.TaskInstanceStatus{entity.TaskInstanceStatusFailed, entity.TaskInstanceStatusInvalidParams, entity.TaskInstanceStatusCanceled},
 				},
 			},
 			giveListRet: []*entity.TaskInstance{},
-			wantErr:     fmt.Errorf("no [failed canceled] task instance"),
+			wantErr:     fmt.Errorf("no [failed invalidParams canceled] task instance"),
 		},
 	}
 
@@ -251,6 +321,7 @@ func TestDefCommander_OpTask(t *testing.T) {
 					Name:             entity.CommandNameRetry,
 					TargetTaskInsIDs: []string{"test task"},
 				},
+				RetryCount: 1,
 			},
 		},
 		{
@@ -266,16 +337,18 @@ func TestDefCommander_OpTask(t *testing.T) {
 			},
 		},
 		{
-			caseDesc:       "unhealthy worker",
-			giveTaskInsID:  []string{"test task"},
-			giveIsAlive:    false,
-			giveAliveNodes: []string{"1", "2"},
+			caseDesc:      "unhealthy worker",
+			giveTaskInsID: []string{"test task"},
+			giveIsAlive:   false,
+			// the worker is picked from alive nodes randomly
+			giveAliveNodes: []string{"2"},
 			wantUpdateDagIns: &entity.DagInstance{
 				Worker: "2",
 				Cmd: &entity.Command{
 					Name:             entity.CommandNameRetry,
 					TargetTaskInsIDs: []string{"test task"},
 				},
+				RetryCount: 1,
 			},
 			wantAliveNodesCalled: true,
 		},
@@ -507,7 +580,7 @@ func TestDefCommander_executeCommand(t *testing.T) {
 				return tc.givePerformErr
 			}
 			opt := CommandOption{isSync: tc.giveSync, syncTimeout: time.Minute, syncInterval: time.Millisecond}
-			err := executeCommand(tc.giveTaskID, perform, opt)
+			_, err := executeCommand(context.Background(), tc.giveTaskID, perform, opt)
 			assert.Equal(t, tc.wantErr, err)
 			assert.Equal(t, tc.wantEnsureCalled, dagGetCnt > 1)
 		})
@@ -592,9 +665,141 @@ func TestDefCommander_ensureCmdExecuted(t *testing.T) {
 			}, tc.giveGetErr)
 			SetStore(mStore)
 
-			err := ensureCmdExecuted(tc.giveDagInsId, tc.giveOpt)
+			err := ensureCmdExecuted(context.Background(), tc.giveDagInsId, tc.giveOpt)
 			assert.Equal(t, tc.wantErr, err)
 			assert.Equal(t, tc.wantCalledCnt, calledCnt)
 		})
 	}
 }
+
+type retryCountMockStore struct {
+	*MockStore
+	retryCount int
+	swapCnt    int
+}
+
+func (s *retryCountMockStore) SwapRetryCount(dagInsID string, oldCount, newCount int) (bool, error) {
+	s.swapCnt++
+	if s.retryCount != oldCount {
+		return false, nil
+	}
+	s.retryCount = newCount
+	return true, nil
+}
+
+type txRetryCountMockStore struct {
+	*retryCountMockStore
+}
+
+func (s *txRetryCountMockStore) WithTx(fn func(st Store) error) error {
+	retryCount := s.retryCount
+	if err := fn(s); err != nil {
+		s.retryCount = retryCount
+		return err
+	}
+	return nil
+}
+
+func TestDefCommander_RetryTaskWithRetryCountStore(t *testing.T) {
+	tests := []struct {
+		caseDesc        string
+		giveRetryCount  int
+		givePatchErr    error
+		giveTx          bool
+		wantRetryCount  int
+		wantSwapCnt     int
+		wantPatchDagIns *entity.DagInstance
+		wantErr         string
+	}{
+		{
+			caseDesc:       "swapped",
+			giveRetryCount: 1,
+			wantRetryCount: 2,
+			wantSwapCnt:    1,
+			wantPatchDagIns: &entity.DagInstance{
+				BaseInfo: entity.BaseInfo{ID: "dag-ins"},
+				Cmd: &entity.Command{
+					Name:             entity.CommandNameRetry,
+					TargetTaskInsIDs: []string{"task-ins"},
+				},
+			},
+		},
+		{
+			caseDesc:       "changed by others",
+			giveRetryCount: 2,
+			wantRetryCount: 2,
+			wantSwapCnt:    1,
+			wantErr:        "retry count of dag instance[dag-ins] is changed by others, please try again: data conflicted",
+		},
+		{
+			caseDesc:       "patch failed",
+			giveRetryCount: 1,
+			givePatchErr:   fmt.Errorf("patch failed"),
+			wantRetryCount: 1,
+			wantSwapCnt:    2,
+			wantPatchDagIns: &entity.DagInstance{
+				BaseInfo: entity.BaseInfo{ID: "dag-ins"},
+				Cmd: &entity.Command{
+					Name:             entity.CommandNameRetry,
+					TargetTaskInsIDs: []string{"task-ins"},
+				},
+			},
+			wantErr: "patch failed",
+		},
+		{
+			caseDesc:       "patch failed in transaction",
+			giveRetryCount: 1,
+			givePatchErr:   fmt.Errorf("patch failed"),
+			giveTx:         true,
+			wantRetryCount: 1,
+			wantSwapCnt:    1,
+			wantPatchDagIns: &entity.DagInstance{
+				BaseInfo: entity.BaseInfo{ID: "dag-ins"},
+				Cmd: &entity.Command{
+					Name:             entity.CommandNameRetry,
+					TargetTaskInsIDs: []string{"task-ins"},
+				},
+			},
+			wantErr: "patch failed",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			var patched *entity.DagInstance
+			mStore := &MockStore{}
+			mStore.On("ListTaskInstance", mock.Anything).Return([]*entity.TaskInstance{
+				{BaseInfo: entity.BaseInfo{ID: "task-ins"}, DagInsID: "dag-ins"},
+			}, nil)
+			// the dag instance is read before another retry consumed the budget
+			mStore.On("GetDagInstance", "dag-ins").Return(&entity.DagInstance{
+				BaseInfo:    entity.BaseInfo{ID: "dag-ins"},
+				Status:      entity.DagInstanceStatusFailed,
+				RetryBudget: 2,
+				RetryCount:  1,
+			}, nil)
+			mStore.On("PatchDagIns", mock.Anything).Run(func(args mock.Arguments) {
+				patched = args.Get(0).(*entity.DagInstance)
+			}).Return(tc.givePatchErr)
+			st := &retryCountMockStore{MockStore: mStore, retryCount: tc.giveRetryCount}
+			if tc.giveTx {
+				SetStore(&txRetryCountMockStore{retryCountMockStore: st})
+			} else {
+				SetStore(st)
+			}
+			mKeep := &MockKeeper{}
+			mKeep.On("IsAlive", mock.Anything).Return(true, nil)
+			SetKeeper(mKeep)
+
+			err := (&DefCommander{}).RetryTask([]string{"task-ins"})
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.wantRetryCount, st.retryCount)
+			assert.Equal(t, tc.wantSwapCnt, st.swapCnt)
+			assert.Equal(t, tc.wantPatchDagIns, patched)
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package mod
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/log"
+	"github.com/etherealiy/fastflow/pkg/utils/cron"
+	"github.com/etherealiy/fastflow/pkg/utils/data"
+)
+
+// DefCronScheduler run the dags which have cron expression. It runs on every worker and the dags are sharded
+// across alive workers by the hash of dag id, see CronOwner, so a worker only evaluates the dags it owns and
+// only a few dags change owner when workers join or leave.
+//
+// Each fire creates the dag instance with an id derived from dag id and fire time, see CronDagInsID, so a fire
+// happens exactly once even if two workers own the same dag during the handoff. When a worker takes over a dag,
+// it catches up the fires in the last "catchUp" duration which may be missed by the previous owner.
+type DefCronScheduler struct {
+	interval time.Duration
+	catchUp  time.Duration
+	// evaluated is the time until which the owned dags are evaluated
+	evaluated map[string]time.Time
+	mutex     sync.Mutex
+
+	wg      sync.WaitGroup
+	closeCh chan struct{}
+}
+
+// NewDefCronScheduler catchUp should be longer than the interval and the time of detecting a dead worker
+func NewDefCronScheduler(interval, catchUp time.Duration) *DefCronScheduler {
+	return &DefCronScheduler{
+		interval:  interval,
+		catchUp:   catchUp,
+		evaluated: map[string]time.Time{},
+		closeCh:   make(chan struct{}),
+	}
+}
+
+// Init
+func (s *DefCronScheduler) Init() {
+	s.wg.Add(1)
+	go s.watch()
+}
+
+// Close
+func (s *DefCronScheduler) Close() {
+	close(s.closeCh)
+	s.wg.Wait()
+}
+
+func (s *DefCronScheduler) watch() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.closeCh:
+			return
+		case <-ticker.C:
+			if _, err := s.Do(time.Now()); err != nil {
+				log.Errorf("schedule cron dags failed: %s", err)
+			}
+		}
+	}
+}
+
+// Do fire the owned dags whose cron times are up to now and return the created dag instances
+func (s *DefCronScheduler) Do(now time.Time) ([]*entity.DagInstance, error) {
+	// the schedules are taken over after the standby cluster is promoted
+	if IsStandby() {
+		return nil, nil
+	}
+	st, ok := StoreAs[DagPruneStore](GetStore())
+	if !ok {
+		return nil, fmt.Errorf("store does not support listing dags")
+	}
+	nodes, err := GetKeeper().AliveNodes()
+	if err != nil {
+		return nil, err
+	}
+	if len(nodes) == 0 {
+		return nil, data.ErrNoAliveNodes
+	}
+	dags, err := st.ListDag(&ListDagInput{})
+	if err != nil {
+		return nil, fmt.Errorf("list dags failed: %w", err)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	self := GetKeeper().WorkerKey()
+	owned := map[string]bool{}
+	var fired []*entity.DagInstance
+	for _, dag := range dags {
+		if dag.Cron == "" || dag.Status != entity.DagStatusNormal || dag.Template || CronOwner(dag.ID, nodes) != self {
+			continue
+		}
+		owned[dag.ID] = true
+		sched, err := cron.Parse(dag.Cron)
+		if err != nil {
+			log.Warnf("dag[%s] is not scheduled: %s", dag.ID, err)
+			continue
+		}
+
+		from, ok := s.evaluated[dag.ID]
+		if !ok {
+			from = now.Add(-s.catchUp)
+			// a new dag does not fire for the times before it is created
+			if created := time.Unix(dag.CreatedAt, 0); from.Before(created) {
+				from = created
+			}
+		}
+		until := now
+		for t := sched.Next(from); !t.IsZero() && !t.After(now); t = sched.Next(t) {
+			dagIns, err := fireCron(dag, t)
+			if errors.Is(err, data.ErrDataConflicted) {
+				continue
+			}
+			if err != nil {
+				// evaluate it again in next interval
+				log.Errorf("fire cron of dag[%s] at %s failed: %s", dag.ID, t, err)
+				until = t.Add(-time.Minute)
+				break
+			}
+			fired = append(fired, dagIns)
+		}
+		s.evaluated[dag.ID] = until
+	}
+	// the handed off dags should be caught up when they are owned again
+	for id := range s.evaluated {
+		if !owned[id] {
+			delete(s.evaluated, id)
+		}
+	}
+	return fired, nil
+}
+
+func fireCron(dag *entity.Dag, t time.Time) (*entity.DagInstance, error) {
+	dagIns, err := runDag(dag.ID, nil, newRunDagOption([]RunDagOptSetter{
+		RunDagID(CronDagInsID(dag.ID, t)),
+		RunDagTrigger(entity.TriggerCron, &entity.TriggerMeta{Cron: dag.Cron}),
+		RunDagLogicalDate(t),
+	}))
+	if err != nil {
+		return nil, err
+	}
+	dagInsLog(dagIns.ID).Infof("dag[%s] is fired by cron at %s", dag.ID, t)
+	return dagIns, nil
+}
+
+// CronDagInsID is the id of dag instance created by the cron fire at t
+func CronDagInsID(dagID string, t time.Time) string {
+	return fmt.Sprintf("cron-%s-%d", dagID, t.Unix())
+}
+
+// CronOwner return the worker which evaluates the cron of dag, it is chosen by rendezvous hashing
+// so that only the dags of the joined or left worker change owner
+func CronOwner(dagID string, nodes []string) string {
+	var owner string
+	var max uint64
+	for _, n := range nodes {
+		h := fnv.New64a()
+		h.Write([]byte(n))
+		h.Write([]byte{0})
+		h.Write([]byte(dagID))
+		if score := mix64(h.Sum64()); owner == "" || score > max || (score == max && n < owner) {
+			owner, max = n, score
+		}
+	}
+	return owner
+}
+
+// mix64 is the finalizer of splitmix64, the high bits of fnv are not well distributed for similar keys
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
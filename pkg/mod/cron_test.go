@@ -0,0 +1,144 @@
+package mod
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/utils/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type cronTestStore struct {
+	*MockStore
+	dags []*entity.Dag
+}
+
+func (s *cronTestStore) ListDag(input *ListDagInput) ([]*entity.Dag, error) {
+	return s.dags, nil
+}
+
+func (s *cronTestStore) BatchDeleteDag(ids []string) error {
+	return nil
+}
+
+func TestCronOwner(t *testing.T) {
+	nodes := []string{"w1", "w2", "w3"}
+	owners := map[string]string{}
+	cnt := map[string]int{}
+	for i := 0; i < 300; i++ {
+		id := fmt.Sprintf("dag-%d", i)
+		owners[id] = CronOwner(id, nodes)
+		cnt[owners[id]]++
+	}
+	for _, n := range nodes {
+		assert.Greater(t, cnt[n], 50, "dags should be spread across workers")
+	}
+
+	// only the dags of the left worker change owner
+	for id, owner := range owners {
+		newOwner := CronOwner(id, []string{"w3", "w1"})
+		if owner != "w2" {
+			assert.Equal(t, owner, newOwner)
+		} else {
+			assert.NotEqual(t, "w2", newOwner)
+		}
+	}
+	assert.Equal(t, "", CronOwner("dag-1", nil))
+}
+
+func TestDefCronScheduler_Do(t *testing.T) {
+	base := time.Date(2022, 1, 1, 10, 0, 0, 0, time.UTC)
+	// find the dags owned by w1
+	var owned, other string
+	for i := 0; owned == "" || other == ""; i++ {
+		id := fmt.Sprintf("dag-%d", i)
+		if CronOwner(id, []string{"w1", "w2"}) == "w1" {
+			owned = id
+		} else {
+			other = id
+		}
+	}
+	newDag := func(id, cron string, status entity.DagStatus, createdAt time.Time) *entity.Dag {
+		return &entity.Dag{
+			BaseInfo: entity.BaseInfo{ID: id, CreatedAt: createdAt.Unix()},
+			Cron:     cron,
+			Status:   status,
+			Tasks:    []entity.Task{{ID: "t1", ActionName: "act"}},
+		}
+	}
+	dags := []*entity.Dag{
+		newDag(owned, "*/5 * * * *", entity.DagStatusNormal, base.Add(-time.Hour)),
+		newDag(other, "*/5 * * * *", entity.DagStatusNormal, base.Add(-time.Hour)),
+		newDag("no-cron", "", entity.DagStatusNormal, base.Add(-time.Hour)),
+		newDag("stopped", "* * * * *", entity.DagStatusStopped, base.Add(-time.Hour)),
+	}
+
+	created := map[string]*entity.DagInstance{}
+	mStore := &MockStore{}
+	mStore.On("GetDag", mock.Anything).Return(func(id string) *entity.Dag {
+		for _, d := range dags {
+			if d.ID == id {
+				return d
+			}
+		}
+		return nil
+	}, nil)
+	mStore.On("CreateDagIns", mock.Anything).Return(func(dagIns *entity.DagInstance) error {
+		if _, ok := created[dagIns.ID]; ok {
+			return fmt.Errorf("existed: %w", data.ErrDataConflicted)
+		}
+		created[dagIns.ID] = dagIns
+		return nil
+	})
+	SetStore(&cronTestStore{MockStore: mStore, dags: dags})
+	mKeeper := &MockKeeper{}
+	mKeeper.On("AliveNodes").Return([]string{"w1", "w2"}, nil)
+	mKeeper.On("WorkerKey").Return("w1")
+	SetKeeper(mKeeper)
+
+	// the fire at 10:00 was created by the previous owner
+	created[CronDagInsID(owned, base)] = &entity.DagInstance{}
+	s := NewDefCronScheduler(time.Minute, 10*time.Minute)
+
+	tests := []struct {
+		caseDesc  string
+		giveNow   time.Time
+		wantFired []time.Time
+	}{
+		{
+			caseDesc:  "catch up after taking over",
+			giveNow:   base.Add(7 * time.Minute),
+			wantFired: []time.Time{base.Add(5 * time.Minute)},
+		},
+		{
+			caseDesc: "nothing to fire",
+			giveNow:  base.Add(9 * time.Minute),
+		},
+		{
+			caseDesc:  "continue from last evaluation",
+			giveNow:   base.Add(20 * time.Minute),
+			wantFired: []time.Time{base.Add(10 * time.Minute), base.Add(15 * time.Minute), base.Add(20 * time.Minute)},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			fired, err := s.Do(tc.giveNow)
+			assert.NoError(t, err)
+			var ids []string
+			for _, dagIns := range fired {
+				ids = append(ids, dagIns.ID)
+				assert.Equal(t, entity.TriggerCron, dagIns.Trigger)
+				assert.Equal(t, "*/5 * * * *", dagIns.TriggerMeta.Cron)
+			}
+			var wantIDs []string
+			for _, ft := range tc.wantFired {
+				wantIDs = append(wantIDs, CronDagInsID(owned, ft))
+			}
+			assert.Equal(t, wantIDs, ids)
+		})
+	}
+}
@@ -1,6 +1,9 @@
 package mod
 
 import (
+	"fmt"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -11,6 +14,9 @@ import (
 	"github.com/shiningrush/goevent"
 )
 
+// ReasonNoEligibleWorker is the reason prefix of the dag instance which no alive worker matches its selector
+const ReasonNoEligibleWorker = "no eligible worker"
+
 // DefDispatcher
 type DefDispatcher struct {
 	closeCh chan struct{}
@@ -34,12 +40,14 @@ func (d *DefDispatcher) Init() {
 // WatchInitDags
 func (d *DefDispatcher) WatchInitDags() {
 	closed := false
-	timerCh := time.Tick(time.Second)
+	// the interval can be changed by cluster config, so reset timer in each round
+	timer := time.NewTimer(secsOr(GetClusterConfig().DispatchIntervalSecs, time.Second))
+	defer timer.Stop()
 	for !closed {
 		select {
 		case <-d.closeCh:
 			closed = true
-		case <-timerCh:
+		case <-timer.C:
 			start := time.Now()
 			e := &event.DispatchInitDagInsCompleted{}
 			if err := d.Do(); err != nil {
@@ -48,18 +56,20 @@ func (d *DefDispatcher) WatchInitDags() {
 			}
 			e.ElapsedMs = time.Now().Sub(start).Milliseconds()
 			goevent.Publish(e)
+			timer.Reset(secsOr(GetClusterConfig().DispatchIntervalSecs, time.Second))
 		}
 	}
 	d.wg.Done()
 }
 
-// Do dispatch
+// Do dispatch, the dag instances with higher priority are dispatched first
 func (d *DefDispatcher) Do() error {
 	dagIns, err := GetStore().ListDagInstance(&ListDagInstanceInput{
 		Status: []entity.DagInstanceStatus{
 			entity.DagInstanceStatusInit,
 		},
-		Limit: 1000,
+		SortByPriority: true,
+		Limit:          int64(intOr(GetClusterConfig().DispatchBatchSize, 1000)),
 	})
 	if err != nil {
 		return err
@@ -67,26 +77,122 @@ func (d *DefDispatcher) Do() error {
 	if len(dagIns) == 0 {
 		return nil
 	}
+	sortDagInsByPriority(dagIns, time.Now())
 
 	nodes, err := GetKeeper().AliveNodes()
 	if err != nil {
 		return err
 	}
+	draining, err := drainingNodes()
+	if err != nil {
+		return err
+	}
+	nodes = excludeNodes(nodes, draining)
 	if len(nodes) == 0 {
 		return data.ErrNoAliveNodes
 	}
 
+	var labels map[string]map[string]string
+	for i := range dagIns {
+		if len(dagIns[i].Selector) > 0 {
+			if labels, err = aliveNodeLabels(); err != nil {
+				return err
+			}
+			break
+		}
+	}
+
+	var dispatched []*entity.DagInstance
 	for i := range dagIns {
+		if f := GetFaultInjector(); f != nil && f.DropDispatch(dagIns[i]) {
+			dagInsLog(dagIns[i].ID).Warn("dispatch is dropped by fault injector")
+			continue
+		}
+		eligible := eligibleNodes(nodes, labels, dagIns[i].Selector)
+		if len(eligible) == 0 {
+			// keep it waiting until a matched worker joins, the reason is only saved when it changed
+			reason := fmt.Sprintf("%s matches selector %s", ReasonNoEligibleWorker, formatSelector(dagIns[i].Selector))
+			if dagIns[i].Reason != reason {
+				dagIns[i].Reason = reason
+				dispatched = append(dispatched, dagIns[i])
+			}
+			continue
+		}
+		if strings.HasPrefix(dagIns[i].Reason, ReasonNoEligibleWorker) {
+			dagIns[i].Reason = ""
+		}
 		dagIns[i].Status = entity.DagInstanceStatusScheduled
-		dagIns[i].Worker = nodes[i%len(nodes)]
+		dagIns[i].Worker = eligible[i%len(eligible)]
+		dispatched = append(dispatched, dagIns[i])
+	}
+	if len(dispatched) == 0 {
+		return nil
 	}
 
-	if err := GetStore().BatchUpdateDagIns(dagIns); err != nil {
+	if err := GetStore().BatchUpdateDagIns(dispatched); err != nil {
 		return err
 	}
 	return nil
 }
 
+// aliveNodeLabels return the labels of alive nodes, they come from the keeper or the info reported by workers
+func aliveNodeLabels() (map[string]map[string]string, error) {
+	if k, ok := GetKeeper().(LabeledKeeper); ok {
+		return k.AliveNodeLabels()
+	}
+	if _, ok := StoreAs[WorkerInfoStore](GetStore()); !ok {
+		return nil, nil
+	}
+	infos, err := ListWorkerInfo()
+	if err != nil {
+		return nil, err
+	}
+	ret := map[string]map[string]string{}
+	for _, info := range infos {
+		ret[info.Key] = info.Labels
+	}
+	return ret, nil
+}
+
+func excludeNodes(nodes []string, excluded map[string]bool) []string {
+	if len(excluded) == 0 {
+		return nodes
+	}
+	ret := []string{}
+	for _, n := range nodes {
+		if !excluded[n] {
+			ret = append(ret, n)
+		}
+	}
+	return ret
+}
+
+func eligibleNodes(nodes []string, labels map[string]map[string]string, selector map[string]string) []string {
+	if len(selector) == 0 {
+		return nodes
+	}
+	var ret []string
+	for _, n := range nodes {
+		if entity.MatchSelector(selector, labels[n]) {
+			ret = append(ret, n)
+		}
+	}
+	return ret
+}
+
+func formatSelector(selector map[string]string) string {
+	var items []string
+	for k, v := range selector {
+		if v == "" {
+			items = append(items, k)
+			continue
+		}
+		items = append(items, k+"="+v)
+	}
+	sort.Strings(items)
+	return "[" + strings.Join(items, ",") + "]"
+}
+
 func (d *DefDispatcher) handlerErr(err error) {
 	log.Errorf("dispatch failed",
 		"module", "dispatch",
@@ -55,6 +55,27 @@ func TestDefDispatcher_Do(t *testing.T) {
 			},
 			wantBatchUpdateCalled: true,
 		},
+		{
+			caseDesc: "no eligible worker",
+			giveListRet: []*entity.DagInstance{
+				{Selector: map[string]string{"gpu": "", "region": "eu"}},
+				{Selector: map[string]string{"gpu": ""}, Reason: "no eligible worker matches selector [gpu]"},
+				{},
+			},
+			giveAliveNodes:      []string{"worker-1"},
+			wantAliveNodeCalled: true,
+			wantBatchUpdateInput: []*entity.DagInstance{
+				{
+					Selector: map[string]string{"gpu": "", "region": "eu"},
+					Reason:   "no eligible worker matches selector [gpu,region=eu]",
+				},
+				{
+					Status: entity.DagInstanceStatusScheduled,
+					Worker: "worker-1",
+				},
+			},
+			wantBatchUpdateCalled: true,
+		},
 		{
 			caseDesc:    "list failed",
 			giveListErr: fmt.Errorf("list failed"),
@@ -95,8 +116,9 @@ func TestDefDispatcher_Do(t *testing.T) {
 	for _, tc := range tests {
 		calledList, calledAlive, calledBatch := false, false, false
 		litInput := &ListDagInstanceInput{
-			Status: []entity.DagInstanceStatus{entity.DagInstanceStatusInit},
-			Limit:  1000,
+			Status:         []entity.DagInstanceStatus{entity.DagInstanceStatusInit},
+			SortByPriority: true,
+			Limit:          1000,
 		}
 		d := NewDefDispatcher()
 		mStore := &MockStore{}
@@ -163,8 +185,9 @@ func TestDefDispatcher_InitAndClose(t *testing.T) {
 		t.Run(tc.caseDesc, func(t *testing.T) {
 			calledList, calledAlive, calledBatch, calledLog := false, false, false, false
 			litInput := &ListDagInstanceInput{
-				Status: []entity.DagInstanceStatus{entity.DagInstanceStatusInit},
-				Limit:  1000,
+				Status:         []entity.DagInstanceStatus{entity.DagInstanceStatusInit},
+				SortByPriority: true,
+				Limit:          1000,
 			}
 			d := NewDefDispatcher()
 			mStore := &MockStore{}
@@ -200,3 +223,40 @@ func TestDefDispatcher_InitAndClose(t *testing.T) {
 	}
 	log.SetLogger(&log.StdoutLogger{})
 }
+
+func TestEligibleNodes(t *testing.T) {
+	nodes := []string{"worker-1", "worker-2", "worker-3"}
+	labels := map[string]map[string]string{
+		"worker-1": {"gpu": "a100", "region": "eu"},
+		"worker-2": {"region": "us"},
+	}
+	tests := []struct {
+		caseDesc     string
+		giveSelector map[string]string
+		wantNodes    []string
+	}{
+		{
+			caseDesc:  "no selector",
+			wantNodes: nodes,
+		},
+		{
+			caseDesc:     "label exists",
+			giveSelector: map[string]string{"gpu": ""},
+			wantNodes:    []string{"worker-1"},
+		},
+		{
+			caseDesc:     "label value",
+			giveSelector: map[string]string{"region": "us"},
+			wantNodes:    []string{"worker-2"},
+		},
+		{
+			caseDesc:     "not matched",
+			giveSelector: map[string]string{"gpu": "", "region": "us"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			assert.Equal(t, tc.wantNodes, eligibleNodes(nodes, labels, tc.giveSelector))
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package mod
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/event"
+	"github.com/etherealiy/fastflow/pkg/log"
+	"github.com/shiningrush/goevent"
+)
+
+// drainCheckInterval is the interval of checking whether the running task instances are finished
+var drainCheckInterval = 200 * time.Millisecond
+
+var (
+	draining  bool
+	drainLock sync.RWMutex
+	drainedCh = make(chan struct{})
+	drainOnce sync.Once
+)
+
+// DrainableKeeper is implemented by the keeper which shares the draining state of workers,
+// so the leader stops dispatching to draining workers and moves their queued dag instances
+type DrainableKeeper interface {
+	// Drain mark current worker as draining and release the leadership, it never campaigns again
+	Drain() error
+	// DrainingNodes return the alive nodes which are draining
+	DrainingNodes() ([]string, error)
+}
+
+// IsDraining return true when current worker is draining, it does not parse scheduled dag instances
+// or execute new task instances, only the running ones are finished
+func IsDraining() bool {
+	drainLock.RLock()
+	defer drainLock.RUnlock()
+	return draining
+}
+
+// Drained is closed when current worker is drained, the application can exit cleanly after it
+func Drained() <-chan struct{} {
+	return drainedCh
+}
+
+// Drain current worker before it exits, such as during deployment. It blocks until the running and queued
+// task instances of executor are finished or ctx is done. The dag instances held by current worker are
+// taken over by others after it exits, the task instances which were not started are executed by the new owner.
+func Drain(ctx context.Context) error {
+	start := time.Now()
+	drainLock.Lock()
+	first := !draining
+	draining = true
+	drainLock.Unlock()
+
+	if first {
+		log.Info("worker enter draining mode")
+		if k, ok := GetKeeper().(DrainableKeeper); ok {
+			if err := k.Drain(); err != nil {
+				return fmt.Errorf("mark worker draining failed: %w", err)
+			}
+		}
+	}
+
+	ticker := time.NewTicker(drainCheckInterval)
+	defer ticker.Stop()
+	for !executorIdle() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+
+	drainOnce.Do(func() {
+		close(drainedCh)
+		log.Info("worker is drained")
+		goevent.Publish(&event.WorkerDrained{
+			WorkerKey: GetKeeper().WorkerKey(),
+			ElapsedMs: time.Since(start).Milliseconds(),
+		})
+	})
+	return nil
+}
+
+func executorIdle() bool {
+	e, ok := GetExecutor().(interface {
+		RunningTasks() []entity.RunningTask
+		QueueLen() int
+	})
+	if !ok {
+		return true
+	}
+	return len(e.RunningTasks()) == 0 && e.QueueLen() == 0
+}
+
+// drainingNodes return the draining nodes of cluster, it is empty when keeper does not support draining
+func drainingNodes() (map[string]bool, error) {
+	k, ok := GetKeeper().(DrainableKeeper)
+	if !ok {
+		return nil, nil
+	}
+	nodes, err := k.DrainingNodes()
+	if err != nil {
+		return nil, fmt.Errorf("list draining nodes failed: %w", err)
+	}
+	ret := map[string]bool{}
+	for _, n := range nodes {
+		ret[n] = true
+	}
+	return ret, nil
+}
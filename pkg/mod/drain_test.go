@@ -0,0 +1,82 @@
+package mod
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+type drainingKeeper struct {
+	*MockKeeper
+	draining []string
+	drained  bool
+}
+
+func (k *drainingKeeper) Drain() error {
+	k.drained = true
+	return nil
+}
+
+func (k *drainingKeeper) DrainingNodes() ([]string, error) {
+	return k.draining, nil
+}
+
+type drainingExecutor struct {
+	*MockExecutor
+	lock    sync.Mutex
+	running []entity.RunningTask
+}
+
+func (e *drainingExecutor) RunningTasks() []entity.RunningTask {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return e.running
+}
+
+func (e *drainingExecutor) QueueLen() int {
+	return 0
+}
+
+func TestDrain(t *testing.T) {
+	oldInterval := drainCheckInterval
+	drainCheckInterval = 10 * time.Millisecond
+	defer func() {
+		drainCheckInterval = oldInterval
+		draining, drainedCh, drainOnce = false, make(chan struct{}), sync.Once{}
+	}()
+
+	mKeeper := &MockKeeper{}
+	mKeeper.On("WorkerKey").Return("worker-1")
+	k := &drainingKeeper{MockKeeper: mKeeper}
+	SetKeeper(k)
+	e := &drainingExecutor{MockExecutor: &MockExecutor{}, running: []entity.RunningTask{{TaskInsID: "t1"}}}
+	SetExecutor(e)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, Drain(ctx), "running task is not finished")
+	assert.True(t, IsDraining())
+	assert.True(t, k.drained)
+	select {
+	case <-Drained():
+		t.Fatal("worker should not be drained")
+	default:
+	}
+
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		e.lock.Lock()
+		e.running = nil
+		e.lock.Unlock()
+	}()
+	assert.NoError(t, Drain(context.Background()))
+	select {
+	case <-Drained():
+	default:
+		t.Fatal("worker should be drained")
+	}
+}
@@ -2,7 +2,10 @@ package mod
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math/rand"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -21,19 +24,37 @@ import (
 const (
 	ReasonSuccessAfterCanceled = "success after canceled"
 	ReasonParentCancel         = "parent success but already be canceled"
+	ReasonMappedTasksCompleted = "all mapped task instances are completed"
+	ReasonNoItemToMap          = "there is no item to map"
 )
 
 // DefExecutor
 type DefExecutor struct {
-	cancelMap    sync.Map
-	workerNumber int
-	workerQueue  chan *entity.TaskInstance
-	workerWg     sync.WaitGroup
-	initWg       sync.WaitGroup
-	timeout      time.Duration
-	initQueue    chan *initPayload
+	cancelMap sync.Map
+	// runningMap record the begin time of the task instances which are executing
+	runningMap sync.Map
+	// secretScopes count the executing task instances by dag instance, the secrets resolved for
+	// a dag instance are forgotten when none of its task instances is executing
+	secretScopes     map[string]int
+	secretScopesLock sync.Mutex
+	workerNumber     int
+	// initWorkerNumber is the worker number of startup, SetWorkerNumber(0) restores it
+	initWorkerNumber int
+	workerQueue      *taskQueue
+	// shrinkCh notify the exceeded workers to exit
+	shrinkCh  chan struct{}
+	workerWg  sync.WaitGroup
+	initWg    sync.WaitGroup
+	timeout   time.Duration
+	initQueue chan *initPayload
 
 	paramRender *render.TplRender
+	pools       *resourcePools
+	// snapshotShareData record share data before and after each task executed
+	snapshotShareData bool
+	// taskLogMaxLines and taskLogMaxLineBytes limit the logs persisted for each task instance
+	taskLogMaxLines     int
+	taskLogMaxLineBytes int
 
 	closeCh chan struct{}
 	lock    sync.RWMutex
@@ -48,12 +69,39 @@ type initPayload struct {
 // NewDefExecutor
 func NewDefExecutor(timeout time.Duration, workers int) *DefExecutor {
 	return &DefExecutor{
-		workerNumber: workers,
-		workerQueue:  make(chan *entity.TaskInstance),
-		timeout:      timeout,
-		initQueue:    make(chan *initPayload),
-		closeCh:      make(chan struct{}, 1),
-		paramRender:  render.NewTplRender(),
+		workerNumber:        workers,
+		initWorkerNumber:    workers,
+		workerQueue:         newTaskQueue(),
+		shrinkCh:            make(chan struct{}),
+		timeout:             timeout,
+		initQueue:           make(chan *initPayload),
+		closeCh:             make(chan struct{}, 1),
+		paramRender:         render.NewTplRender(),
+		pools:               newResourcePools(),
+		taskLogMaxLines:     DefaultTaskLogMaxLines,
+		taskLogMaxLineBytes: DefaultTaskLogMaxLineBytes,
+	}
+}
+
+// EnableShareDataSnapshot make executor record share data before and after each task executed,
+// it helps to find which task wrote the bad value, but increase the burden of storage
+func (e *DefExecutor) EnableShareDataSnapshot() {
+	e.snapshotShareData = true
+}
+
+// SetParamRenderMode set how to render the variables which are not found in task params, default is strict
+func (e *DefExecutor) SetParamRenderMode(mode render.MissingKeyMode) {
+	e.paramRender = render.NewTplRender(render.WithMissingKeyMode(mode))
+}
+
+// SetTaskLogLimits set how many latest logs are kept for each task instance and the max size of each log,
+// zero means the default, negative maxLines disables persisting logs and negative maxLineBytes disables truncating
+func (e *DefExecutor) SetTaskLogLimits(maxLines, maxLineBytes int) {
+	if maxLines != 0 {
+		e.taskLogMaxLines = maxLines
+	}
+	if maxLineBytes != 0 {
+		e.taskLogMaxLineBytes = maxLineBytes
 	}
 }
 
@@ -71,10 +119,105 @@ func (e *DefExecutor) Init() {
 }
 
 func (e *DefExecutor) subWorkerQueue() {
-	for taskIns := range e.workerQueue {
-		e.workerDo(taskIns)
+	defer e.workerWg.Done()
+	for {
+		select {
+		case <-e.shrinkCh:
+			return
+		default:
+		}
+		taskIns, wait, ok := e.workerQueue.pop()
+		if !ok {
+			return
+		}
+		if taskIns != nil {
+			e.workerDo(taskIns)
+			continue
+		}
+		select {
+		case <-wait:
+		case <-e.shrinkCh:
+			return
+		}
+	}
+}
+
+// SetWorkerNumber change the concurrency at runtime, 0 means the worker number of startup.
+// When shrinking, the busy workers exit after their running tasks completed.
+func (e *DefExecutor) SetWorkerNumber(workers int) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	// closeCh is closed after executor closed
+	select {
+	case <-e.closeCh:
+		return
+	default:
+	}
+	if workers <= 0 {
+		workers = e.initWorkerNumber
+	}
+	for ; e.workerNumber < workers; e.workerNumber++ {
+		e.workerWg.Add(1)
+		go e.subWorkerQueue()
+	}
+	if shrink := e.workerNumber - workers; shrink > 0 {
+		e.workerNumber = workers
+		go func() {
+			for i := 0; i < shrink; i++ {
+				select {
+				case e.shrinkCh <- struct{}{}:
+				case <-e.closeCh:
+					return
+				}
+			}
+		}()
+	}
+}
+
+// WorkerNumber return the current concurrency
+func (e *DefExecutor) WorkerNumber() int {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+	return e.workerNumber
+}
+
+// RunningTasks return the executing task instances sorted by begin time
+func (e *DefExecutor) RunningTasks() []entity.RunningTask {
+	now := time.Now().UnixMilli()
+	var ret []entity.RunningTask
+	e.runningMap.Range(func(key, value interface{}) bool {
+		t := *value.(*entity.RunningTask)
+		t.ElapsedMs = now - t.StartedAt
+		ret = append(ret, t)
+		return true
+	})
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].StartedAt < ret[j].StartedAt
+	})
+	return ret
+}
+
+// PoolUsage return the count of running tasks in each resource pool
+func (e *DefExecutor) PoolUsage() map[string]int {
+	return e.pools.usage()
+}
+
+// QueueLen return the count of task instances which are initialized but waiting for an idle worker
+func (e *DefExecutor) QueueLen() int {
+	initialized, running := 0, 0
+	e.cancelMap.Range(func(key, value interface{}) bool {
+		initialized++
+		return true
+	})
+	e.runningMap.Range(func(key, value interface{}) bool {
+		running++
+		return true
+	})
+	if initialized < running {
+		return 0
 	}
-	e.workerWg.Done()
+	return initialized - running
 }
 
 // CancelTaskIns
@@ -98,33 +241,46 @@ func (e *DefExecutor) watchInitQueue() {
 
 func (e *DefExecutor) initWorkerTask(dagIns *entity.DagInstance, taskIns *entity.TaskInstance) {
 	if _, ok := e.cancelMap.Load(taskIns.ID); ok {
-		log.Warnf("task instance[%s][%s] is already running", taskIns.ID, taskIns.Status)
+		taskInsLog(taskIns).Warnf("task instance is already running, status[%s]", taskIns.Status)
 		return
 	}
 
-	defTimeout := e.timeout
-	if taskIns.TimeoutSecs != 0 {
-		defTimeout = time.Duration(taskIns.TimeoutSecs) * time.Second
-	}
-	c, cancel := context.WithTimeout(context.TODO(), defTimeout)
+	c, cancel := context.WithTimeout(context.TODO(), e.taskTimeout(taskIns))
 	dagIns.ShareData.Save = func(data *entity.ShareData) error {
 		return GetStore().PatchDagIns(&entity.DagInstance{BaseInfo: entity.BaseInfo{ID: taskIns.DagInsID}, ShareData: data})
 	}
 	c = entity.CtxWithRunningTaskIns(c, taskIns)
+	ctx := run.NewDefExecuteContext(c, dagIns.ShareData, taskIns.Trace, dagIns.VarsGetter(), dagIns.VarsIterator())
+	ctx.SetArtifactFunc(taskIns.RegisterArtifact)
+	ctx.SetDatasetFunc(taskIns.DeclareDatasets)
+	ctx.SetOutputFunc(func(key string, value interface{}) error {
+		return PublishOutput(taskIns, key, value)
+	})
 	taskIns.InitialDep(
-		run.NewDefExecuteContext(c, dagIns.ShareData, taskIns.Trace, dagIns.VarsGetter(), dagIns.VarsIterator()),
+		ctx,
 		func(instance *entity.TaskInstance) error {
 			return GetStore().PatchTaskIns(instance)
 		}, dagIns)
 	e.cancelMap.Store(taskIns.ID, cancel)
-	e.workerQueue <- taskIns
+	if f := GetFaultInjector(); f != nil {
+		if after, kill := f.KillTask(taskIns); kill {
+			time.AfterFunc(after, cancel)
+		}
+	}
+	e.workerQueue.push(dagIns, taskIns)
 }
 
 // Push task to execute 由parser调用该接口，将解析好的任务交给executor模块等待执行（分成init和execute两部分）
 func (e *DefExecutor) Push(dagIns *entity.DagInstance, taskIns *entity.TaskInstance) {
+	// the task instance is executed by the worker taking over the dag instance after current worker exits
+	if IsDraining() {
+		taskInsLog(taskIns).Info("worker is draining, so will not execute task instance")
+		return
+	}
+
 	isActive, err := taskIns.DoPreCheck(dagIns)
 	if err != nil {
-		log.Errorf("do task pre-check failed:%s", err)
+		taskInsLog(taskIns).Errorf("do task pre-check failed: %s", err)
 		return
 	}
 
@@ -133,7 +289,7 @@ func (e *DefExecutor) Push(dagIns *entity.DagInstance, taskIns *entity.TaskInsta
 			BaseInfo: taskIns.BaseInfo,
 			Status:   taskIns.Status,
 		}); err != nil {
-			log.Errorf("patch task[%s] failed: %s", taskIns.ID, err)
+			taskInsLog(taskIns).Errorf("patch task instance failed: %s", err)
 			return
 		}
 
@@ -168,16 +324,65 @@ func (e *DefExecutor) workerDo(taskIns *entity.TaskInstance) {
 	case entity.TaskInstanceStatusInit, entity.TaskInstanceStatusEnding,
 		entity.TaskInstanceStatusRetrying, entity.TaskInstanceStatusContinue:
 	default:
-		log.Warnf("this task instance[%s] is not executable, status[%s]", taskIns.ID, taskIns.Status)
+		taskInsLog(taskIns).Warnf("task instance is not executable, status[%s]", taskIns.Status)
+		return
+	}
+
+	if keeper := GetKeeper(); keeper != nil {
+		taskIns.Worker = keeper.WorkerKey()
+	}
+	claimed, err := e.claimTaskIns(taskIns)
+	if err == nil && !claimed {
+		taskInsLog(taskIns).Warn("task instance is claimed by other worker, so will not execute it")
+		if cancel, ok := e.cancelMap.LoadAndDelete(taskIns.ID); ok {
+			if cancel, ok := cancel.(context.CancelFunc); ok {
+				cancel()
+			}
+		}
 		return
 	}
 
 	goevent.Publish(&event.TaskBegin{
 		TaskIns: taskIns,
 	})
-	err := e.runAction(taskIns)
+	callBeforeTaskRunHooks(taskIns)
+	endSpan := func() {}
+	if tracer := GetTaskTracer(); tracer != nil {
+		endSpan = tracer.StartTask(taskIns)
+	}
+	begin := time.Now()
+	e.runningMap.Store(taskIns.ID, &entity.RunningTask{
+		TaskInsID: taskIns.ID,
+		DagInsID:  taskIns.DagInsID,
+		TaskID:    taskIns.TaskID,
+		StartedAt: begin.UnixMilli(),
+	})
+	e.holdSecrets(taskIns.DagInsID)
+	var before map[string]string
+	if e.snapshotShareData {
+		before = e.shareDataOf(taskIns).Snapshot()
+	}
+	// the task instance fails when it cannot be claimed, so it can be retried
+	if err == nil {
+		err = e.runAction(taskIns)
+	}
 	e.handleTaskError(taskIns, err)
+	endSpan()
+	e.recordAttempt(taskIns, begin)
+	callAfterTaskRunHooks(taskIns, err)
+	if claimed {
+		e.releaseTaskIns(taskIns)
+	}
+	if e.snapshotShareData {
+		e.recordShareDataSnapshot(taskIns, before)
+	}
+	retry := e.retryAutomatically(taskIns, err) || e.reschedule(taskIns, err)
 	e.cancelMap.Delete(taskIns.ID)
+	e.runningMap.Delete(taskIns.ID)
+	e.releaseSecrets(taskIns.DagInsID)
+	if retry {
+		return
+	}
 	// 处理完该任务后，交给parser解析获得下一批可执行的任务
 	GetParser().EntryTaskIns(taskIns)
 	goevent.Publish(&event.TaskCompleted{
@@ -185,11 +390,53 @@ func (e *DefExecutor) workerDo(taskIns *entity.TaskInstance) {
 	})
 }
 
+// holdSecrets keep the secrets of dag instance to be redacted while its task instance is executing
+func (e *DefExecutor) holdSecrets(dagInsID string) {
+	e.secretScopesLock.Lock()
+	defer e.secretScopesLock.Unlock()
+	if e.secretScopes == nil {
+		e.secretScopes = map[string]int{}
+	}
+	e.secretScopes[dagInsID]++
+}
+
+// releaseSecrets forget the secrets of dag instance when none of its task instances is executing,
+// so the registered secrets do not grow with the dag instances
+func (e *DefExecutor) releaseSecrets(dagInsID string) {
+	e.secretScopesLock.Lock()
+	defer e.secretScopesLock.Unlock()
+	e.secretScopes[dagInsID]--
+	if e.secretScopes[dagInsID] > 0 {
+		return
+	}
+	delete(e.secretScopes, dagInsID)
+	log.ForgetSecrets(dagInsID)
+}
+
 func (e *DefExecutor) runAction(taskIns *entity.TaskInstance) error {
+	if taskIns.Pool != nil {
+		if err := e.acquirePool(taskIns); err != nil {
+			return err
+		}
+		defer e.pools.release(taskIns.Pool.Name)
+	}
+	if taskIns.SubDag != nil {
+		return taskIns.Run(taskIns.SubDag, &subDagAction{})
+	}
 	act := ActionMap[taskIns.ActionName]
 	if act == nil {
 		return fmt.Errorf("action not found: %s", taskIns.ActionName)
 	}
+	if err := e.waitRateLimit(taskIns); err != nil {
+		return err
+	}
+	if err := e.injectEnv(taskIns); err != nil {
+		return err
+	}
+	if err := e.injectWorkspace(taskIns); err != nil {
+		return err
+	}
+	defer e.injectLogger(taskIns)()
 
 	if taskIns.Params == nil {
 		return taskIns.Run(nil, act)
@@ -208,13 +455,109 @@ func (e *DefExecutor) runAction(taskIns *entity.TaskInstance) error {
 	return taskIns.Run(p, act)
 }
 
+// acquirePool block until a slot of the pool of task is available, the task is "queued" while waiting
+// and the waiting time is counted in the timeout of task
+func (e *DefExecutor) acquirePool(taskIns *entity.TaskInstance) error {
+	ctx := context.Background()
+	if taskIns.Context != nil {
+		ctx = taskIns.Context.Context()
+	}
+	status := taskIns.Status
+	err := e.pools.acquire(ctx, taskIns.Pool, func() {
+		taskIns.Trace(fmt.Sprintf("waiting for a slot of pool[%s]", taskIns.Pool.Name))
+		if err := taskIns.SetStatus(entity.TaskInstanceStatusQueued); err != nil {
+			taskInsLog(taskIns).Errorf("set task instance queued failed: %s", err)
+		}
+	})
+	// the action runs from the status before queued
+	taskIns.Status = status
+	if err != nil {
+		return fmt.Errorf("wait for pool[%s] failed: %w", taskIns.Pool.Name, err)
+	}
+	return nil
+}
+
+// waitRateLimit block until the rate limit of task allows it to run, only the runs of action are limited,
+// the waiting time is counted in the timeout of task
+func (e *DefExecutor) waitRateLimit(taskIns *entity.TaskInstance) error {
+	l := GetRateLimiter()
+	if l == nil || taskIns.RateLimit == nil {
+		return nil
+	}
+	if taskIns.Status != entity.TaskInstanceStatusInit && taskIns.Status != entity.TaskInstanceStatusContinue {
+		return nil
+	}
+	limit, window, err := taskIns.RateLimit.Parse()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	if taskIns.Context != nil {
+		ctx = taskIns.Context.Context()
+	}
+	if err := l.Wait(ctx, taskIns.RateLimit.Key, limit, window); err != nil {
+		return fmt.Errorf("wait rate limit[%s] failed: %w", taskIns.RateLimit.Key, err)
+	}
+	return nil
+}
+
+// injectEnv resolve env vars of task instance and set them to execute context
+func (e *DefExecutor) injectEnv(taskIns *entity.TaskInstance) error {
+	if len(taskIns.Env) == 0 {
+		return nil
+	}
+	env, err := ResolveTaskEnv(taskIns)
+	if err != nil {
+		return err
+	}
+	if ctx, ok := taskIns.Context.(interface{ SetEnv(map[string]string) }); ok {
+		ctx.SetEnv(env)
+	}
+	return nil
+}
+
+// injectWorkspace allocate workspace of dag instance and set it to execute context
+func (e *DefExecutor) injectWorkspace(taskIns *entity.TaskInstance) error {
+	w := GetWorkspace()
+	if w == nil || taskIns.RelatedDagInstance == nil {
+		return nil
+	}
+	path, err := w.Allocate(taskIns.RelatedDagInstance)
+	if err != nil {
+		return fmt.Errorf("allocate workspace failed: %w", err)
+	}
+	if ctx, ok := taskIns.Context.(interface{ SetWorkspace(string) }); ok {
+		ctx.SetWorkspace(path)
+	}
+	return nil
+}
+
+// injectLogger set the logger of task instance to context, it returns the function flushing the logs
+func (e *DefExecutor) injectLogger(taskIns *entity.TaskInstance) func() {
+	ctx, ok := taskIns.Context.(interface{ SetLogger(log.Logger) })
+	if !ok {
+		return func() {}
+	}
+	st, _ := StoreAs[TaskLogStore](GetStore())
+	if e.taskLogMaxLines < 0 {
+		st = nil
+	}
+	l := newTaskLogger(taskIns, st, e.taskLogMaxLines, e.taskLogMaxLineBytes)
+	ctx.SetLogger(l)
+	return l.close
+}
+
 func (e *DefExecutor) getFromTaskInstance(taskIns *entity.TaskInstance, params interface{}) error {
 	err := e.renderParams(taskIns)
 	if err != nil {
 		return fmt.Errorf("renderParams failed: %w", err)
 	}
 
-	return weakDecode(taskIns.Params, params)
+	resolved, err := ResolveSecretParams(taskIns.DagInsID, taskIns.Params)
+	if err != nil {
+		return err
+	}
+	return run.InvalidParams(weakDecode(resolved, params))
 }
 
 func weakDecode(input interface{}, output interface{}) error {
@@ -239,6 +582,8 @@ func (e *DefExecutor) renderParams(taskIns *entity.TaskInstance) error {
 	dagInstance := taskIns.RelatedDagInstance
 	if dagInstance != nil {
 		data["vars"] = dagInstance.Vars
+		data["logicalDate"] = dagInstance.LogicalTime()
+		data["dataIntervalStart"], data["dataIntervalEnd"] = dagInstance.DataInterval()
 		if dagInstance.ShareData != nil {
 			data["shareData"] = dagInstance.ShareData.Dict
 		}
@@ -246,6 +591,14 @@ func (e *DefExecutor) renderParams(taskIns *entity.TaskInstance) error {
 
 	err := value.MapValue(taskIns.Params).WalkString(func(walkContext *value.WalkContext, v string) error {
 		if strings.Contains(v, "{{") && strings.Contains(v, "}}") {
+			// outputs are loaded only when they are used, because they are read from store
+			if _, ok := data["outputs"]; !ok && strings.Contains(v, ".outputs") {
+				outputs, err := listOutputs(taskIns.DagInsID)
+				if err != nil {
+					return err
+				}
+				data["outputs"] = outputs
+			}
 			result, err := e.paramRender.Render(v, data)
 			if err != nil {
 				return err
@@ -271,10 +624,145 @@ func (e *DefExecutor) Close() {
 
 	close(e.initQueue)
 	e.initWg.Wait()
-	close(e.workerQueue)
+	e.workerQueue.close()
 	e.workerWg.Wait()
 }
 
+func (e *DefExecutor) taskTimeout(taskIns *entity.TaskInstance) time.Duration {
+	if taskIns.TimeoutSecs != 0 {
+		return time.Duration(taskIns.TimeoutSecs) * time.Second
+	}
+	return e.timeout
+}
+
+// claimTaskIns claim the task instance before running it when the store supports it, the claim expires
+// with the timeout of task, so it can be claimed by others after the task is expired
+func (e *DefExecutor) claimTaskIns(taskIns *entity.TaskInstance) (bool, error) {
+	s, ok := StoreAs[TaskInsClaimStore](GetStore())
+	if !ok {
+		return true, nil
+	}
+	claimed, err := s.ClaimTaskIns(taskIns.ID, taskIns.Worker, e.taskTimeout(taskIns))
+	if err != nil {
+		return false, fmt.Errorf("claim task instance failed: %w", err)
+	}
+	return claimed, nil
+}
+
+// releaseTaskIns expire the claim after the task instance is executed, so it can be claimed by other worker
+// when it is retried
+func (e *DefExecutor) releaseTaskIns(taskIns *entity.TaskInstance) {
+	if _, ok := StoreAs[TaskInsClaimStore](GetStore()); !ok {
+		return
+	}
+	taskIns.ClaimExpiresAt = time.Now().Unix()
+	if err := GetStore().PatchTaskIns(&entity.TaskInstance{
+		BaseInfo:       taskIns.BaseInfo,
+		ClaimExpiresAt: taskIns.ClaimExpiresAt}); err != nil {
+		taskInsLog(taskIns).Errorf("release task instance failed: %s", err)
+	}
+}
+
+func (e *DefExecutor) recordAttempt(taskIns *entity.TaskInstance, begin time.Time) {
+	worker := ""
+	if keeper := GetKeeper(); keeper != nil {
+		worker = keeper.WorkerKey()
+	}
+	if !taskIns.RecordAttempt(worker, begin) {
+		return
+	}
+	if err := taskIns.Patch(&entity.TaskInstance{
+		BaseInfo: taskIns.BaseInfo,
+		Attempts: taskIns.Attempts}); err != nil {
+		taskInsLog(taskIns).Errorf("record attempt failed: %s", err)
+	}
+}
+
+func (e *DefExecutor) shareDataOf(taskIns *entity.TaskInstance) *entity.ShareData {
+	if taskIns.RelatedDagInstance == nil {
+		return nil
+	}
+	return taskIns.RelatedDagInstance.ShareData
+}
+
+func (e *DefExecutor) recordShareDataSnapshot(taskIns *entity.TaskInstance, before map[string]string) {
+	taskIns.ShareDataSnapshot = &entity.ShareDataSnapshot{
+		Before: before,
+		After:  e.shareDataOf(taskIns).Snapshot(),
+	}
+	if err := taskIns.Patch(&entity.TaskInstance{
+		BaseInfo:          taskIns.BaseInfo,
+		ShareDataSnapshot: taskIns.ShareDataSnapshot}); err != nil {
+		taskInsLog(taskIns).Errorf("record share data snapshot failed: %s", err)
+	}
+}
+
+// retryAutomatically set the failed task instance to retrying and push it again after the interval of
+// its retry policy, it returns false when the task instance should not be retried
+func (e *DefExecutor) retryAutomatically(taskIns *entity.TaskInstance, err error) bool {
+	if taskIns.RetryPolicy == nil || taskIns.Status != entity.TaskInstanceStatusFailed {
+		return false
+	}
+	timedOut := taskIns.Context != nil && taskIns.Context.Context().Err() == context.DeadlineExceeded
+	if !taskIns.RetryPolicy.ShouldRetry(taskIns.AutoRetries, err, timedOut) {
+		return false
+	}
+
+	taskIns.AutoRetries++
+	interval := taskIns.RetryPolicy.Interval(taskIns.AutoRetries, rand.Float64)
+	taskIns.NextRetryAt = time.Now().Add(interval).Unix()
+	taskIns.Trace(fmt.Sprintf("retry automatically in %s, retries: %d", interval.Round(time.Millisecond), taskIns.AutoRetries))
+	if err := taskIns.SetStatus(entity.TaskInstanceStatusRetrying); err != nil {
+		taskInsLog(taskIns).Errorf("set task instance retrying failed: %s", err)
+		return false
+	}
+	if err := taskIns.Patch(&entity.TaskInstance{
+		BaseInfo:    taskIns.BaseInfo,
+		AutoRetries: taskIns.AutoRetries,
+		NextRetryAt: taskIns.NextRetryAt}); err != nil {
+		taskInsLog(taskIns).Errorf("record retries failed: %s", err)
+	}
+
+	dagIns := taskIns.RelatedDagInstance
+	time.AfterFunc(interval, func() {
+		// the task instance may be canceled or retried manually while waiting
+		fresh, err := GetStore().GetTaskIns(taskIns.ID)
+		if err != nil {
+			taskInsLog(taskIns).Errorf("get task instance to retry failed: %s", err)
+			return
+		}
+		if fresh.Status != entity.TaskInstanceStatusRetrying || fresh.AutoRetries != taskIns.AutoRetries {
+			return
+		}
+		e.Push(dagIns, fresh)
+	})
+	return true
+}
+
+// reschedule push the task instance rescheduled by its action again after the duration, it returns false
+// when the action did not reschedule it
+func (e *DefExecutor) reschedule(taskIns *entity.TaskInstance, err error) bool {
+	var re *run.RescheduleError
+	if taskIns.Status != entity.TaskInstanceStatusContinue || !errors.As(err, &re) {
+		return false
+	}
+
+	dagIns := taskIns.RelatedDagInstance
+	time.AfterFunc(re.After, func() {
+		// the task instance may be canceled or retried manually while waiting
+		fresh, err := GetStore().GetTaskIns(taskIns.ID)
+		if err != nil {
+			taskInsLog(taskIns).Errorf("get task instance to reschedule failed: %s", err)
+			return
+		}
+		if fresh.Status != entity.TaskInstanceStatusContinue {
+			return
+		}
+		e.Push(dagIns, fresh)
+	})
+	return true
+}
+
 func (e *DefExecutor) handleTaskError(taskIns *entity.TaskInstance, err error) {
 	_, ok := e.cancelMap.Load(taskIns.ID)
 	if err != nil {
@@ -282,13 +770,17 @@ func (e *DefExecutor) handleTaskError(taskIns *entity.TaskInstance, err error) {
 		setStatus := entity.TaskInstanceStatusFailed
 		if !ok {
 			setStatus = entity.TaskInstanceStatusCanceled
+		} else if errors.Is(err, run.ErrBlocked) {
+			setStatus = entity.TaskInstanceStatusBlocked
+		} else if errors.As(err, new(*run.RescheduleError)) {
+			setStatus = entity.TaskInstanceStatusContinue
+		} else if errors.Is(err, run.ErrInvalidParams) {
+			setStatus = entity.TaskInstanceStatusInvalidParams
 		}
 
 		taskIns.Reason = err.Error()
 		if err := taskIns.SetStatus(setStatus); err != nil {
-			log.Error("set status failed",
-				"task_id", taskIns.ID,
-				"err", err)
+			taskInsLog(taskIns).Error("set status failed", "err", err)
 		}
 		return
 	}
@@ -301,6 +793,6 @@ func (e *DefExecutor) handleTaskError(taskIns *entity.TaskInstance, err error) {
 	if pErr := taskIns.Patch(&entity.TaskInstance{
 		BaseInfo: taskIns.BaseInfo,
 		Reason:   ReasonSuccessAfterCanceled}); pErr != nil {
-		log.Errorf("tag canceled task instance[%s] failed: %s", taskIns.ID, pErr)
+		taskInsLog(taskIns).Errorf("tag canceled task instance failed: %s", pErr)
 	}
 }
@@ -8,6 +8,7 @@ import (
 
 	"github.com/etherealiy/fastflow/pkg/entity"
 	"github.com/etherealiy/fastflow/pkg/entity/run"
+	"github.com/etherealiy/fastflow/pkg/log"
 	"github.com/etherealiy/fastflow/pkg/render"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -115,7 +116,7 @@ func TestDefExecutor_initWorkerTask(t *testing.T) {
 		{
 			name: "sync trace",
 			giveExecutor: &DefExecutor{
-				workerQueue: make(chan *entity.TaskInstance, 1),
+				workerQueue: newTaskQueue(),
 				timeout:     time.Second,
 				initQueue:   make(chan *initPayload, 1),
 			},
@@ -150,7 +151,7 @@ func TestDefExecutor_initWorkerTask(t *testing.T) {
 			name:         "after action trace",
 			giveTraceOpt: run.TraceOpPersistAfterAction,
 			giveExecutor: &DefExecutor{
-				workerQueue: make(chan *entity.TaskInstance, 1),
+				workerQueue: newTaskQueue(),
 				timeout:     time.Second,
 				initQueue:   make(chan *initPayload, 1),
 			},
@@ -258,6 +259,12 @@ func TestDefExecutor_WorkerDo(t *testing.T) {
 					"field1": "test_field",
 				},
 				Status: entity.TaskInstanceStatusSuccess,
+				Worker: "worker-1",
+				Attempts: []entity.TaskAttempt{{
+					Attempt: 1,
+					Worker:  "worker-1",
+					Status:  entity.TaskInstanceStatusSuccess,
+				}},
 			},
 		},
 		{
@@ -319,6 +326,12 @@ func TestDefExecutor_WorkerDo(t *testing.T) {
 				},
 				Status:             entity.TaskInstanceStatusSuccess,
 				RelatedDagInstance: relatedDagInstance,
+				Worker:             "worker-1",
+				Attempts: []entity.TaskAttempt{{
+					Attempt: 1,
+					Worker:  "worker-1",
+					Status:  entity.TaskInstanceStatusSuccess,
+				}},
 			},
 		},
 		{
@@ -353,6 +366,13 @@ func TestDefExecutor_WorkerDo(t *testing.T) {
 				Status:             entity.TaskInstanceStatusFailed,
 				Reason:             "get task params from task instance failed: renderParams failed: execute tpl failed: template: {{.a.b.c}}:1:4: executing \"{{.a.b.c}}\" at <.a.b.c>: map has no entry for key \"a\"",
 				RelatedDagInstance: relatedDagInstance,
+				Worker:             "worker-1",
+				Attempts: []entity.TaskAttempt{{
+					Attempt: 1,
+					Worker:  "worker-1",
+					Status:  entity.TaskInstanceStatusFailed,
+					Reason:  "get task params from task instance failed: renderParams failed: execute tpl failed: template: {{.a.b.c}}:1:4: executing \"{{.a.b.c}}\" at <.a.b.c>: map has no entry for key \"a\"",
+				}},
 			},
 		},
 		{
@@ -368,6 +388,12 @@ func TestDefExecutor_WorkerDo(t *testing.T) {
 			wantEntryTask: &entity.TaskInstance{
 				ActionName: "noParams",
 				Status:     entity.TaskInstanceStatusSuccess,
+				Worker:     "worker-1",
+				Attempts: []entity.TaskAttempt{{
+					Attempt: 1,
+					Worker:  "worker-1",
+					Status:  entity.TaskInstanceStatusSuccess,
+				}},
 			},
 		},
 		{
@@ -383,6 +409,12 @@ func TestDefExecutor_WorkerDo(t *testing.T) {
 			wantEntryTask: &entity.TaskInstance{
 				ActionName: "test",
 				Status:     entity.TaskInstanceStatusSuccess,
+				Worker:     "worker-1",
+				Attempts: []entity.TaskAttempt{{
+					Attempt: 1,
+					Worker:  "worker-1",
+					Status:  entity.TaskInstanceStatusSuccess,
+				}},
 			},
 		},
 		{
@@ -400,6 +432,13 @@ func TestDefExecutor_WorkerDo(t *testing.T) {
 				ActionName: "test",
 				Status:     entity.TaskInstanceStatusSuccess,
 				Reason:     ReasonSuccessAfterCanceled,
+				Worker:     "worker-1",
+				Attempts: []entity.TaskAttempt{{
+					Attempt: 1,
+					Worker:  "worker-1",
+					Status:  entity.TaskInstanceStatusSuccess,
+					Reason:  ReasonSuccessAfterCanceled,
+				}},
 			},
 		},
 		{
@@ -415,6 +454,13 @@ func TestDefExecutor_WorkerDo(t *testing.T) {
 				ActionName: "no_such_action",
 				Status:     entity.TaskInstanceStatusFailed,
 				Reason:     "action not found: no_such_action",
+				Worker:     "worker-1",
+				Attempts: []entity.TaskAttempt{{
+					Attempt: 1,
+					Worker:  "worker-1",
+					Status:  entity.TaskInstanceStatusFailed,
+					Reason:  "action not found: no_such_action",
+				}},
 			},
 		},
 		{
@@ -431,6 +477,13 @@ func TestDefExecutor_WorkerDo(t *testing.T) {
 				ActionName: "no_such_action",
 				Status:     entity.TaskInstanceStatusCanceled,
 				Reason:     "action not found: no_such_action",
+				Worker:     "worker-1",
+				Attempts: []entity.TaskAttempt{{
+					Attempt: 1,
+					Worker:  "worker-1",
+					Status:  entity.TaskInstanceStatusCanceled,
+					Reason:  "action not found: no_such_action",
+				}},
 			},
 		},
 		{
@@ -450,9 +503,17 @@ func TestDefExecutor_WorkerDo(t *testing.T) {
 				Params: map[string]interface{}{
 					"field1": "qqq",
 				},
-				Status: entity.TaskInstanceStatusFailed,
-				Reason: "get task params from task instance failed: 1 error(s) decoding:\n\n" +
+				Status: entity.TaskInstanceStatusInvalidParams,
+				Reason: "get task params from task instance failed: invalid params: 1 error(s) decoding:\n\n" +
 					"* cannot parse 'field1' as int: strconv.ParseInt: parsing \"qqq\": invalid syntax",
+				Worker: "worker-1",
+				Attempts: []entity.TaskAttempt{{
+					Attempt: 1,
+					Worker:  "worker-1",
+					Status:  entity.TaskInstanceStatusInvalidParams,
+					Reason: "get task params from task instance failed: invalid params: 1 error(s) decoding:\n\n" +
+						"* cannot parse 'field1' as int: strconv.ParseInt: parsing \"qqq\": invalid syntax",
+				}},
 			},
 		},
 		{
@@ -494,11 +555,26 @@ func TestDefExecutor_WorkerDo(t *testing.T) {
 			mParser := &MockParser{}
 			mParser.On("EntryTaskIns", mock.Anything).Run(func(args mock.Arguments) {
 				calledEntry = true
-				args.Get(0).(*entity.TaskInstance).Patch = nil
-				assert.Equal(t, tc.wantEntryTask, args.Get(0))
+				taskIns := args.Get(0).(*entity.TaskInstance)
+				taskIns.Patch = nil
+				// time used is not stable
+				if taskIns.Status == entity.TaskInstanceStatusSuccess {
+					assert.NotEmpty(t, taskIns.TimeUsed)
+				}
+				taskIns.TimeUsed = ""
+				for i := range taskIns.Attempts {
+					taskIns.Attempts[i].StartedAt = 0
+					taskIns.Attempts[i].EndedAt = 0
+					taskIns.Attempts[i].TimeUsed = ""
+				}
+				assert.Equal(t, tc.wantEntryTask, taskIns)
 			})
 			SetParser(mParser)
 
+			mKeeper := &MockKeeper{}
+			mKeeper.On("WorkerKey").Return("worker-1")
+			SetKeeper(mKeeper)
+
 			ActionMap = map[string]run.Action{
 				"test":     testAct,
 				"noParams": noParamAct,
@@ -712,6 +788,9 @@ func TestDefExecutor_renderParams(t *testing.T) {
 				"skint": "1",
 			},
 		},
+		LogicalDate:       1640995200,
+		DataIntervalStart: 1640995200,
+		DataIntervalEnd:   1641081600,
 	}
 	tests := []struct {
 		name    string
@@ -734,12 +813,16 @@ func TestDefExecutor_renderParams(t *testing.T) {
 						"c": map[string]interface{}{
 							"d": map[string]interface{}{},
 						},
+						"e": `{{.logicalDate.UTC.Format "2006-01-02"}}`,
+						"f": `{{.dataIntervalEnd.UTC.Format "2006-01-02"}}`,
 					},
 				},
 			},
 			want: map[string]interface{}{
 				"a": "skb",
 				"b": "va",
+				"e": "2022-01-01",
+				"f": "2022-01-02",
 				"c": map[string]interface{}{
 					"d": map[string]interface{}{},
 				},
@@ -771,6 +854,27 @@ func TestDefExecutor_renderParams(t *testing.T) {
 					},
 				}},
 		},
+		{
+			name: "outputs",
+			fields: fields{
+				paramRender: paramRender,
+			},
+			args: args{
+				taskIns: &entity.TaskInstance{
+					DagInsID:           "dag-ins",
+					RelatedDagInstance: dagIns,
+					Params: map[string]interface{}{
+						"rows":  "{{.outputs.extract.rows}}",
+						"table": "{{.outputs.extract.table}}",
+					},
+				},
+			},
+			want: map[string]interface{}{
+				"rows":  "10",
+				"table": "orders",
+			},
+			wantErr: assert.NoError,
+		},
 		{
 			name: "function \"hhh\" not defined",
 			fields: fields{
@@ -797,6 +901,14 @@ func TestDefExecutor_renderParams(t *testing.T) {
 				}},
 		},
 	}
+	mStore := &MockStore{}
+	mStore.On("ListTaskInstance", mock.Anything).Return([]*entity.TaskInstance{
+		{TaskID: "extract", Outputs: map[string]run.Output{
+			"rows":  {Value: float64(10), Size: 2},
+			"table": {Value: "orders", Size: 8},
+		}},
+	}, nil)
+	SetStore(mStore)
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			e := &DefExecutor{
@@ -808,3 +920,261 @@ func TestDefExecutor_renderParams(t *testing.T) {
 		})
 	}
 }
+
+func TestDefExecutor_recordShareDataSnapshot(t *testing.T) {
+	var patched *entity.TaskInstance
+	taskIns := &entity.TaskInstance{
+		BaseInfo: entity.BaseInfo{ID: "task-ins"},
+		RelatedDagInstance: &entity.DagInstance{
+			ShareData: &entity.ShareData{Dict: map[string]string{"a": "1", "b": "2"}},
+		},
+		Patch: func(instance *entity.TaskInstance) error {
+			patched = instance
+			return nil
+		},
+	}
+
+	e := NewDefExecutor(time.Minute, 1)
+	e.EnableShareDataSnapshot()
+	before := e.shareDataOf(taskIns).Snapshot()
+	taskIns.RelatedDagInstance.ShareData.Set("b", "bad")
+	e.recordShareDataSnapshot(taskIns, before)
+
+	want := &entity.ShareDataSnapshot{
+		Before: map[string]string{"a": "1", "b": "2"},
+		After:  map[string]string{"a": "1", "b": "bad"},
+	}
+	assert.Equal(t, want, taskIns.ShareDataSnapshot)
+	if assert.NotNil(t, patched) {
+		assert.Equal(t, "task-ins", patched.ID)
+		assert.Equal(t, want, patched.ShareDataSnapshot)
+	}
+	assert.Equal(t, []string{"b"}, taskIns.ShareDataSnapshot.ChangedKeys())
+}
+
+type claimStore struct {
+	*MockStore
+	claimed  bool
+	err      error
+	claimBy  string
+	released bool
+}
+
+func (s *claimStore) ClaimTaskIns(taskInsID, worker string, ttl time.Duration) (bool, error) {
+	s.claimBy = worker
+	return s.claimed, s.err
+}
+
+func TestDefExecutor_WorkerDoClaim(t *testing.T) {
+	tests := []struct {
+		caseDesc        string
+		giveClaimed     bool
+		giveClaimErr    error
+		wantCalledRun   bool
+		wantEntryCalled bool
+		wantReleased    bool
+		wantStatus      entity.TaskInstanceStatus
+	}{
+		{
+			caseDesc:        "claimed",
+			giveClaimed:     true,
+			wantCalledRun:   true,
+			wantEntryCalled: true,
+			wantReleased:    true,
+			wantStatus:      entity.TaskInstanceStatusSuccess,
+		},
+		{
+			caseDesc:   "claimed by other worker",
+			wantStatus: entity.TaskInstanceStatusInit,
+		},
+		{
+			caseDesc:        "claim failed",
+			giveClaimErr:    fmt.Errorf("store is down"),
+			wantEntryCalled: true,
+			wantStatus:      entity.TaskInstanceStatusFailed,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			mStore := &MockStore{}
+			st := &claimStore{MockStore: mStore, claimed: tc.giveClaimed, err: tc.giveClaimErr}
+			mStore.On("PatchTaskIns", mock.Anything).Run(func(args mock.Arguments) {
+				if args.Get(0).(*entity.TaskInstance).ClaimExpiresAt != 0 {
+					st.released = true
+				}
+			}).Return(nil)
+			SetStore(st)
+
+			calledRun := false
+			act := &run.MockAction{}
+			act.On("Run", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+				calledRun = true
+			}).Return(nil)
+			act.On("Name").Return("claim")
+			act.On("ParameterNew").Return(nil)
+			act.On("RunBefore", mock.Anything, mock.Anything).Return(nil)
+			act.On("RunAfter", mock.Anything, mock.Anything).Return(nil)
+			ActionMap = map[string]run.Action{"claim": act}
+
+			calledEntry := false
+			mParser := &MockParser{}
+			mParser.On("EntryTaskIns", mock.Anything).Run(func(args mock.Arguments) {
+				calledEntry = true
+			})
+			SetParser(mParser)
+			mKeeper := &MockKeeper{}
+			mKeeper.On("WorkerKey").Return("worker-1")
+			SetKeeper(mKeeper)
+
+			taskIns := &entity.TaskInstance{
+				BaseInfo:   entity.BaseInfo{ID: "task-ins"},
+				ActionName: "claim",
+				Status:     entity.TaskInstanceStatusInit,
+			}
+			taskIns.InitialDep(nil, func(instance *entity.TaskInstance) error {
+				return nil
+			}, nil)
+			e := &DefExecutor{}
+			e.cancelMap.Store(taskIns.ID, nil)
+			e.workerDo(taskIns)
+			assert.Equal(t, "worker-1", st.claimBy)
+			assert.Equal(t, tc.wantCalledRun, calledRun)
+			assert.Equal(t, tc.wantEntryCalled, calledEntry)
+			assert.Equal(t, tc.wantReleased, st.released)
+			assert.Equal(t, tc.wantStatus, taskIns.Status)
+			_, ok := e.cancelMap.Load(taskIns.ID)
+			assert.False(t, ok)
+		})
+	}
+}
+
+func TestDefExecutor_WorkerDoBlockedOrRescheduled(t *testing.T) {
+	tests := []struct {
+		caseDesc        string
+		giveErr         error
+		giveFreshStatus entity.TaskInstanceStatus
+		wantStatus      entity.TaskInstanceStatus
+		wantEntryCalled bool
+		wantPushed      bool
+	}{
+		{
+			caseDesc:        "blocked",
+			giveErr:         fmt.Errorf("waiting for callback: %w", run.ErrBlocked),
+			wantStatus:      entity.TaskInstanceStatusBlocked,
+			wantEntryCalled: true,
+		},
+		{
+			caseDesc:        "rescheduled",
+			giveErr:         run.Reschedule(10 * time.Millisecond),
+			giveFreshStatus: entity.TaskInstanceStatusContinue,
+			wantStatus:      entity.TaskInstanceStatusContinue,
+			wantPushed:      true,
+		},
+		{
+			caseDesc:        "canceled while rescheduled",
+			giveErr:         run.Reschedule(10 * time.Millisecond),
+			giveFreshStatus: entity.TaskInstanceStatusCanceled,
+			wantStatus:      entity.TaskInstanceStatusContinue,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			mStore := &MockStore{}
+			mStore.On("PatchTaskIns", mock.Anything).Return(nil)
+			mStore.On("GetTaskIns", "task-ins").Return(&entity.TaskInstance{
+				BaseInfo: entity.BaseInfo{ID: "task-ins"},
+				Status:   tc.giveFreshStatus,
+			}, nil)
+			SetStore(mStore)
+
+			act := &run.MockAction{}
+			act.On("Run", mock.Anything, mock.Anything).Return(tc.giveErr)
+			act.On("Name").Return("sensor")
+			act.On("ParameterNew").Return(nil)
+			act.On("RunBefore", mock.Anything, mock.Anything).Return(nil)
+			ActionMap = map[string]run.Action{"sensor": act}
+
+			calledEntry := false
+			mParser := &MockParser{}
+			mParser.On("EntryTaskIns", mock.Anything).Run(func(args mock.Arguments) {
+				calledEntry = true
+			})
+			SetParser(mParser)
+
+			taskIns := &entity.TaskInstance{
+				BaseInfo:   entity.BaseInfo{ID: "task-ins"},
+				ActionName: "sensor",
+				Status:     entity.TaskInstanceStatusInit,
+			}
+			taskIns.InitialDep(nil, func(instance *entity.TaskInstance) error {
+				return nil
+			}, nil)
+			e := &DefExecutor{initQueue: make(chan *initPayload, 1), closeCh: make(chan struct{})}
+			e.cancelMap.Store(taskIns.ID, nil)
+			e.workerDo(taskIns)
+			assert.Equal(t, tc.wantStatus, taskIns.Status)
+			assert.Equal(t, tc.wantEntryCalled, calledEntry)
+			assert.Empty(t, taskIns.Attempts)
+
+			select {
+			case p := <-e.initQueue:
+				assert.True(t, tc.wantPushed)
+				assert.Equal(t, entity.TaskInstanceStatusContinue, p.taskIns.Status)
+			case <-time.After(100 * time.Millisecond):
+				assert.False(t, tc.wantPushed)
+			}
+		})
+	}
+}
+
+type fakeTaskTracer struct {
+	started, ended entity.TaskInstanceStatus
+}
+
+func (f *fakeTaskTracer) StartTask(taskIns *entity.TaskInstance) func() {
+	f.started = taskIns.Status
+	return func() {
+		f.ended = taskIns.Status
+	}
+}
+
+func TestDefExecutor_WorkerDoTrace(t *testing.T) {
+	mStore := &MockStore{}
+	mStore.On("PatchTaskIns", mock.Anything).Return(nil)
+	SetStore(mStore)
+	mParser := &MockParser{}
+	mParser.On("EntryTaskIns", mock.Anything)
+	SetParser(mParser)
+	tracer := &fakeTaskTracer{}
+	SetTaskTracer(tracer)
+	defer SetTaskTracer(nil)
+
+	taskIns := &entity.TaskInstance{
+		BaseInfo:   entity.BaseInfo{ID: "task-ins"},
+		ActionName: "no_such_action",
+		Status:     entity.TaskInstanceStatusInit,
+	}
+	taskIns.InitialDep(nil, func(instance *entity.TaskInstance) error {
+		return nil
+	}, nil)
+	e := &DefExecutor{}
+	e.cancelMap.Store(taskIns.ID, nil)
+	e.workerDo(taskIns)
+	assert.Equal(t, entity.TaskInstanceStatusInit, tracer.started)
+	assert.Equal(t, entity.TaskInstanceStatusFailed, tracer.ended)
+}
+
+func TestDefExecutor_releaseSecrets(t *testing.T) {
+	e := &DefExecutor{}
+	e.holdSecrets("dag-ins1")
+	e.holdSecrets("dag-ins1")
+	log.RegisterSecret("dag-ins1", "secret-pwd")
+
+	e.releaseSecrets("dag-ins1")
+	assert.Equal(t, log.Redacted, log.Redact("secret-pwd"))
+	e.releaseSecrets("dag-ins1")
+	assert.Equal(t, "secret-pwd", log.Redact("secret-pwd"))
+	assert.Empty(t, e.secretScopes)
+}
@@ -0,0 +1,36 @@
+package mod
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+)
+
+// faultInjector is read by workers concurrently, so it is stored in atomic.Value
+var faultInjector atomic.Value
+
+// faultInjectorHolder wrap the injector, atomic.Value cannot store nil or different concrete types
+type faultInjectorHolder struct {
+	injector FaultInjector
+}
+
+// FaultInjector is used by chaos testing to inject faults into engine,
+// it is nil by default, DO NOT set it in production
+type FaultInjector interface {
+	// DropDispatch indicate dispatcher should drop the dispatching of dag instance in this round
+	DropDispatch(dagIns *entity.DagInstance) bool
+	// KillTask indicate executor should kill the running task instance after the duration
+	KillTask(taskIns *entity.TaskInstance) (after time.Duration, kill bool)
+}
+
+// SetFaultInjector
+func SetFaultInjector(f FaultInjector) {
+	faultInjector.Store(faultInjectorHolder{injector: f})
+}
+
+// GetFaultInjector
+func GetFaultInjector() FaultInjector {
+	h, _ := faultInjector.Load().(faultInjectorHolder)
+	return h.injector
+}
@@ -0,0 +1,163 @@
+package mod
+
+import (
+	"context"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/log"
+)
+
+// DefaultLifecycleHookTimeout is the default max duration of each hook call
+const DefaultLifecycleHookTimeout = 5 * time.Second
+
+var (
+	lifecycleHooks       []*namedLifecycleHooks
+	lifecycleHookTimeout = DefaultLifecycleHookTimeout
+	lifecycleHooksLock   sync.RWMutex
+)
+
+// LifecycleHooks attach custom logic to the engine, such as audit logging, billing or cache invalidation.
+// All of them are optional and only observe the engine, they cannot change the result of tasks or dags.
+// Each call is recovered from panic and the engine only waits for it until the timeout, then the context
+// is canceled, see SetLifecycleHookTimeout. The instances are shared with the engine, so hooks should not
+// modify them.
+type LifecycleHooks struct {
+	// BeforeTaskRun is called on the worker before the action of task instance runs
+	BeforeTaskRun func(ctx context.Context, taskIns *entity.TaskInstance)
+	// AfterTaskRun is called on the worker after the action of task instance runs, the result is in the
+	// status and reason of task instance, err is returned by the action
+	AfterTaskRun func(ctx context.Context, taskIns *entity.TaskInstance, err error)
+	// OnDagComplete is called when all tasks of dag instance succeeded or it failed because of a task
+	OnDagComplete func(ctx context.Context, dagIns *entity.DagInstance)
+	// OnLeaderChange is called when the worker becomes leader or loses leadership
+	OnLeaderChange func(ctx context.Context, isLeader bool)
+	// OnTaskBlocked is called when the dag instance is blocked by the task instance
+	OnTaskBlocked func(ctx context.Context, dagIns *entity.DagInstance, taskIns *entity.TaskInstance)
+}
+
+type namedLifecycleHooks struct {
+	name  string
+	hooks *LifecycleHooks
+}
+
+// RegisterLifecycleHooks add the hooks by name, the hooks of the same name are replaced,
+// they are called in the order of registration. You should register them before fastflow start.
+func RegisterLifecycleHooks(name string, hooks *LifecycleHooks) {
+	lifecycleHooksLock.Lock()
+	defer lifecycleHooksLock.Unlock()
+	for _, h := range lifecycleHooks {
+		if h.name == name {
+			h.hooks = hooks
+			return
+		}
+	}
+	lifecycleHooks = append(lifecycleHooks, &namedLifecycleHooks{name: name, hooks: hooks})
+}
+
+// UnregisterLifecycleHooks remove the hooks by name
+func UnregisterLifecycleHooks(name string) {
+	lifecycleHooksLock.Lock()
+	defer lifecycleHooksLock.Unlock()
+	for i, h := range lifecycleHooks {
+		if h.name == name {
+			lifecycleHooks = append(lifecycleHooks[:i:i], lifecycleHooks[i+1:]...)
+			return
+		}
+	}
+}
+
+// SetLifecycleHookTimeout set the max duration of each hook call, non-positive means DefaultLifecycleHookTimeout
+func SetLifecycleHookTimeout(timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = DefaultLifecycleHookTimeout
+	}
+	lifecycleHooksLock.Lock()
+	defer lifecycleHooksLock.Unlock()
+	lifecycleHookTimeout = timeout
+}
+
+// CallLeaderChangeHooks call OnLeaderChange hooks, it is called by the handler of leader changed event
+func CallLeaderChangeHooks(isLeader bool) {
+	callLifecycleHooks("OnLeaderChange", func(h *LifecycleHooks) func(ctx context.Context) {
+		if h.OnLeaderChange == nil {
+			return nil
+		}
+		return func(ctx context.Context) { h.OnLeaderChange(ctx, isLeader) }
+	})
+}
+
+func callBeforeTaskRunHooks(taskIns *entity.TaskInstance) {
+	callLifecycleHooks("BeforeTaskRun", func(h *LifecycleHooks) func(ctx context.Context) {
+		if h.BeforeTaskRun == nil {
+			return nil
+		}
+		return func(ctx context.Context) { h.BeforeTaskRun(ctx, taskIns) }
+	})
+}
+
+func callAfterTaskRunHooks(taskIns *entity.TaskInstance, err error) {
+	callLifecycleHooks("AfterTaskRun", func(h *LifecycleHooks) func(ctx context.Context) {
+		if h.AfterTaskRun == nil {
+			return nil
+		}
+		return func(ctx context.Context) { h.AfterTaskRun(ctx, taskIns, err) }
+	})
+}
+
+func callDagCompleteHooks(dagIns *entity.DagInstance) {
+	callLifecycleHooks("OnDagComplete", func(h *LifecycleHooks) func(ctx context.Context) {
+		if h.OnDagComplete == nil {
+			return nil
+		}
+		return func(ctx context.Context) { h.OnDagComplete(ctx, dagIns) }
+	})
+}
+
+func callTaskBlockedHooks(dagIns *entity.DagInstance, taskIns *entity.TaskInstance) {
+	callLifecycleHooks("OnTaskBlocked", func(h *LifecycleHooks) func(ctx context.Context) {
+		if h.OnTaskBlocked == nil {
+			return nil
+		}
+		return func(ctx context.Context) { h.OnTaskBlocked(ctx, dagIns, taskIns) }
+	})
+}
+
+// callLifecycleHooks call the hook picked from each registered hooks one by one, pick returns nil when it is not set
+func callLifecycleHooks(point string, pick func(h *LifecycleHooks) func(ctx context.Context)) {
+	lifecycleHooksLock.RLock()
+	hooks := make([]namedLifecycleHooks, 0, len(lifecycleHooks))
+	for _, h := range lifecycleHooks {
+		hooks = append(hooks, *h)
+	}
+	timeout := lifecycleHookTimeout
+	lifecycleHooksLock.RUnlock()
+
+	for _, h := range hooks {
+		if fn := pick(h.hooks); fn != nil {
+			callLifecycleHook(h.name, point, timeout, fn)
+		}
+	}
+}
+
+func callLifecycleHook(name, point string, timeout time.Duration, fn func(ctx context.Context)) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer func() {
+			if r := recover(); r != nil {
+				log.Errorf("%s hook of %s panic: %v\n%s", point, name, r, debug.Stack())
+			}
+		}()
+		fn(ctx)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Warnf("%s hook of %s does not return in %s", point, name, timeout)
+	}
+}
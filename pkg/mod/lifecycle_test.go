@@ -0,0 +1,85 @@
+package mod
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLifecycleHooks(t *testing.T) {
+	defer func() {
+		UnregisterLifecycleHooks("audit")
+		UnregisterLifecycleHooks("billing")
+		SetLifecycleHookTimeout(0)
+	}()
+	SetLifecycleHookTimeout(20 * time.Millisecond)
+
+	var calls []string
+	var mutex sync.Mutex
+	record := func(call string) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		calls = append(calls, call)
+	}
+	recorded := func() []string {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return append([]string{}, calls...)
+	}
+	RegisterLifecycleHooks("audit", &LifecycleHooks{
+		BeforeTaskRun: func(ctx context.Context, taskIns *entity.TaskInstance) {
+			record("audit before " + taskIns.ID)
+		},
+		AfterTaskRun: func(ctx context.Context, taskIns *entity.TaskInstance, err error) {
+			record("audit after " + taskIns.ID + " " + err.Error())
+		},
+		OnLeaderChange: func(ctx context.Context, isLeader bool) {
+			panic("oops")
+		},
+	})
+	RegisterLifecycleHooks("billing", &LifecycleHooks{
+		BeforeTaskRun: func(ctx context.Context, taskIns *entity.TaskInstance) {
+			record("billing before " + taskIns.ID)
+		},
+		OnDagComplete: func(ctx context.Context, dagIns *entity.DagInstance) {
+			<-ctx.Done()
+			record("billing complete " + dagIns.ID + " " + ctx.Err().Error())
+		},
+		OnTaskBlocked: func(ctx context.Context, dagIns *entity.DagInstance, taskIns *entity.TaskInstance) {
+			time.Sleep(time.Second)
+		},
+	})
+
+	taskIns := &entity.TaskInstance{BaseInfo: entity.BaseInfo{ID: "task-ins1"}}
+	dagIns := &entity.DagInstance{BaseInfo: entity.BaseInfo{ID: "dag-ins1"}}
+	callBeforeTaskRunHooks(taskIns)
+	callAfterTaskRunHooks(taskIns, errors.New("failed"))
+	CallLeaderChangeHooks(true)
+	callDagCompleteHooks(dagIns)
+	assert.Eventually(t, func() bool {
+		return len(recorded()) == 4
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, []string{
+		"audit before task-ins1",
+		"billing before task-ins1",
+		"audit after task-ins1 failed",
+		"billing complete dag-ins1 context deadline exceeded",
+	}, recorded())
+
+	begin := time.Now()
+	callTaskBlockedHooks(dagIns, taskIns)
+	assert.Less(t, int64(time.Since(begin)), int64(500*time.Millisecond))
+
+	mutex.Lock()
+	calls = nil
+	mutex.Unlock()
+	RegisterLifecycleHooks("audit", &LifecycleHooks{})
+	UnregisterLifecycleHooks("billing")
+	callBeforeTaskRunHooks(taskIns)
+	assert.Empty(t, recorded())
+}
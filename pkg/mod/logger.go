@@ -0,0 +1,17 @@
+package mod
+
+import (
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/log"
+	"github.com/etherealiy/fastflow/pkg/utils"
+)
+
+// dagInsLog add the id of dag instance to logs, so they can be filtered by dag instance
+func dagInsLog(dagInsID string) log.Logger {
+	return log.With(utils.LogKeyDagInsID, dagInsID)
+}
+
+// taskInsLog add the ids of dag instance and task instance to logs
+func taskInsLog(taskIns *entity.TaskInstance) log.Logger {
+	return log.With(utils.LogKeyDagInsID, taskIns.DagInsID, utils.LogKeyTaskInsID, taskIns.ID)
+}
@@ -1,10 +1,12 @@
 package mod
 
 import (
+	"sort"
 	"time"
 
 	"github.com/etherealiy/fastflow/pkg/entity"
 	"github.com/etherealiy/fastflow/pkg/entity/run"
+	"github.com/etherealiy/fastflow/pkg/utils"
 )
 
 var (
@@ -19,12 +21,18 @@ var (
 
 // Commander used to execute command
 type Commander interface {
-	RunDag(dagId string, specVar map[string]string) (*entity.DagInstance, error)
+	RunDag(dagId string, specVar map[string]string, ops ...RunDagOptSetter) (*entity.DagInstance, error)
 	RetryDagIns(dagInsId string, ops ...CommandOptSetter) error
 	RetryTask(taskInsIds []string, ops ...CommandOptSetter) error
+	RetryFromFailed(dagInsId string, ops ...CommandOptSetter) error
 	CancelTask(taskInsIds []string, ops ...CommandOptSetter) error
+	CancelDagIns(dagInsId, reason string) error
 	ContinueDagIns(dagInsId string, ops ...CommandOptSetter) error
 	ContinueTask(taskInsIds []string, ops ...CommandOptSetter) error
+	SkipTask(taskInsIds []string, operator, reason string, ops ...CommandOptSetter) error
+	AddNote(dagInsId, content, author string) (*entity.DagInstance, error)
+	Annotate(dagInsId string, annotations map[string]string) (*entity.DagInstance, error)
+	Requeue(dagInsId string, ops ...CommandOptSetter) error
 }
 
 // CommandOption
@@ -72,6 +80,75 @@ var (
 	}
 )
 
+// RunDagOption
+type RunDagOption struct {
+	id          string
+	trigger     entity.Trigger
+	triggerMeta *entity.TriggerMeta
+	labels      map[string]string
+	parent      *entity.DagInstance
+
+	idempotencyKey    string
+	idempotencyWindow time.Duration
+
+	logicalDate   time.Time
+	intervalStart time.Time
+	intervalEnd   time.Time
+}
+type RunDagOptSetter func(opt *RunDagOption)
+
+var (
+	// RunDagTrigger set how the dag instance is created, default is "manually"
+	RunDagTrigger = func(trigger entity.Trigger, meta *entity.TriggerMeta) RunDagOptSetter {
+		return func(opt *RunDagOption) {
+			opt.trigger = trigger
+			opt.triggerMeta = meta
+		}
+	}
+	// RunDagLabels attach labels to the dag instance, they can be used to filter dag instances
+	RunDagLabels = func(labels map[string]string) RunDagOptSetter {
+		return func(opt *RunDagOption) {
+			opt.labels = labels
+		}
+	}
+	// RunDagParent link the dag instance to its parent, it is used by sub-dag and "ff-trigger-dag-run" action
+	RunDagParent = func(parent *entity.DagInstance) RunDagOptSetter {
+		return func(opt *RunDagOption) {
+			opt.parent = parent
+		}
+	}
+	// RunDagLogicalDate set the logical date, it is used by backfills, default is the start of data interval or now
+	RunDagLogicalDate = func(logicalDate time.Time) RunDagOptSetter {
+		return func(opt *RunDagOption) {
+			opt.logicalDate = logicalDate
+		}
+	}
+	// RunDagDataInterval set the range of data which the run should process, it is usually derived from schedule
+	RunDagDataInterval = func(start, end time.Time) RunDagOptSetter {
+		return func(opt *RunDagOption) {
+			opt.intervalStart = start
+			opt.intervalEnd = end
+		}
+	}
+	// RunDagID set the id of dag instance, running fails with data.ErrDataConflicted when the id is used,
+	// so the same id makes the run happen exactly once
+	RunDagID = func(id string) RunDagOptSetter {
+		return func(opt *RunDagOption) {
+			opt.id = id
+		}
+	}
+	// RunDagIdempotencyKey make the runs of dag with the same key in window create one dag instance, the later
+	// runs return the existing one instead of creating a duplicate, zero window means forever. When the existing
+	// one is older than window, its key is removed and taken over by the new one.
+	// It is enforced by the unique index of store, so it is safe for concurrent runs
+	RunDagIdempotencyKey = func(key string, window time.Duration) RunDagOptSetter {
+		return func(opt *RunDagOption) {
+			opt.idempotencyKey = key
+			opt.idempotencyWindow = window
+		}
+	}
+)
+
 // SetCommander
 func SetCommander(c Commander) {
 	defCommander = c
@@ -103,7 +180,7 @@ type Closer interface {
 	Close()
 }
 
-// Store used to persist obj
+// Store used to persist obj, it has no watch method, the watchers of engine poll it to observe the changes
 type Store interface {
 	Closer
 	CreateDag(dag *entity.Dag) error
@@ -125,8 +202,129 @@ type Store interface {
 	Unmarshal(bytes []byte, ptr interface{}) error
 }
 
+// DagPruneStore is implemented by the store which supports pruning dags when applying
+type DagPruneStore interface {
+	ListDag(input *ListDagInput) ([]*entity.Dag, error)
+	BatchDeleteDag(ids []string) error
+}
+
+// BatchPatchTaskInsStore is implemented by the store which can patch many task instances in one round trip,
+// the patches must be applied in order
+type BatchPatchTaskInsStore interface {
+	BatchPatchTaskIns(taskIns []*entity.TaskInstance) error
+}
+
+// TaskInsClaimStore is implemented by the store which can claim task instances atomically, the executor must win
+// the claim before running the action, so a task instance is not executed by two workers at the same time
+type TaskInsClaimStore interface {
+	// ClaimTaskIns set the worker of task instance and expire the claim after ttl, it returns false when
+	// the task instance is not claimable or it is claimed by another worker and the claim is not expired,
+	// see ApplyTaskInsClaim
+	ClaimTaskIns(taskInsID, worker string, ttl time.Duration) (bool, error)
+}
+
+// RetryCountStore is implemented by the store which can update the retry count of dag instance atomically,
+// otherwise the retry budget is best-effort, concurrent retries may both pass the check and exceed it
+type RetryCountStore interface {
+	// SwapRetryCount set the retry count of dag instance to newCount only when it is oldCount now, it returns false
+	// when the retry count is changed by others, see ApplyRetryCountSwap
+	SwapRetryCount(dagInsID string, oldCount, newCount int) (bool, error)
+}
+
+// TxStore is implemented by the store which supports transactions, the writes of fn are committed together
+// or none of them is when fn returns error, fn must access the store by the given one and may be retried
+type TxStore interface {
+	WithTx(fn func(st Store) error) error
+}
+
+// StoreWrapper is implemented by the store which wraps another one and forwards the capabilities to it,
+// such as the write-behind and chaos stores, so a capability is only used when the wrapped store has it too
+type StoreWrapper interface {
+	Unwrap() Store
+}
+
+// StoreAs return the store as the capability T, such as TaskInsClaimStore, it is false when the store
+// or any store wrapped by it does not implement T
+func StoreAs[T any](st Store) (T, bool) {
+	var zero T
+	ret, ok := st.(T)
+	if !ok {
+		return zero, false
+	}
+	for w, isWrapper := st.(StoreWrapper); isWrapper; w, isWrapper = st.(StoreWrapper) {
+		if st = w.Unwrap(); st == nil {
+			return zero, false
+		}
+		if _, ok := st.(T); !ok {
+			return zero, false
+		}
+	}
+	return ret, true
+}
+
+// WithTx run fn in a transaction when the store supports it, otherwise fn runs with the store directly
+// and the writes before the failed one are kept
+func WithTx(fn func(st Store) error) error {
+	if ts, ok := StoreAs[TxStore](GetStore()); ok {
+		return ts.WithTx(fn)
+	}
+	return fn(GetStore())
+}
+
 // ListDagInput
 type ListDagInput struct {
+	// IDPrefix filter dags which id has the prefix
+	IDPrefix string
+}
+
+// LeaseStore is implemented by the store which supports leases, so it can back the keeper without
+// other backends, see "keeper/lease"
+type LeaseStore interface {
+	// AcquireLease create or renew the lease atomically, it returns false when the lease is held by others and not expired
+	AcquireLease(key, holder string, ttl time.Duration) (bool, error)
+	// ReleaseLease delete the lease, it returns false when the lease is not held by holder
+	ReleaseLease(key, holder string) (bool, error)
+	// ListLease list the unexpired leases which key has the prefix
+	ListLease(prefix string) ([]*Lease, error)
+}
+
+// Lease
+type Lease struct {
+	Key       string    `json:"key" bson:"_id"`
+	Holder    string    `json:"holder" bson:"holder"`
+	ExpiredAt time.Time `json:"expiredAt" bson:"expiredAt"`
+}
+
+// ClusterConfigStore is implemented by the store which supports persisting runtime cluster config
+type ClusterConfigStore interface {
+	// GetClusterConfig return data.ErrDataNotFound when config is not saved
+	GetClusterConfig() (*entity.ClusterConfig, error)
+	SaveClusterConfig(cfg *entity.ClusterConfig) error
+}
+
+// WorkerInfoStore is implemented by the store which supports persisting runtime info of workers
+type WorkerInfoStore interface {
+	// SaveWorkerInfo create or replace the info of the worker
+	SaveWorkerInfo(info *entity.WorkerInfo) error
+	// ListWorkerInfo list the info of all workers which have reported recently
+	ListWorkerInfo() ([]*entity.WorkerInfo, error)
+}
+
+// RateLimitStore is implemented by the store which supports sharing rate limit counters between workers
+type RateLimitStore interface {
+	// IncrRateLimitCounter increase the counter of key in the window which begins at "windowStart"
+	// and return the count after increased, the counter can be cleaned up after the window ended
+	IncrRateLimitCounter(key string, windowStart time.Time, window time.Duration) (int, error)
+}
+
+// TaskLogStore is implemented by the store which supports persisting the logs written by actions
+type TaskLogStore interface {
+	// AppendTaskLogs append the logs of task instance in order of seq, only the latest maxLines logs are kept
+	// when it is positive, the older ones are rotated out
+	AppendTaskLogs(taskInsID string, logs []*entity.TaskLog, maxLines int) error
+	// GetTaskLogs return the logs which seq is greater than cursor in order of seq, at most limit logs are
+	// returned when it is positive
+	GetTaskLogs(taskInsID string, cursor int64, limit int) ([]*entity.TaskLog, error)
 }
 
 // ListDagInstanceInput
@@ -134,10 +332,91 @@ type ListDagInstanceInput struct {
 	Worker     string
 	DagID      string
 	UpdatedEnd int64
-	Status     []entity.DagInstanceStatus
-	HasCmd     bool
-	Limit      int64
-	Offset     int64
+	// DeadlineEnd filter dag instances which have a deadline before or at it, in unix seconds
+	DeadlineEnd int64
+	// SLADeadlineEnd filter dag instances which have an unchecked SLA deadline before or at it, in unix seconds
+	SLADeadlineEnd int64
+	// SLAMissed filter dag instances which missed any SLA
+	SLAMissed bool
+	// CreatedBegin and CreatedEnd filter by created time in unix seconds, both are inclusive
+	CreatedBegin int64
+	CreatedEnd   int64
+	Status       []entity.DagInstanceStatus
+	HasCmd       bool
+	// DeadLetter filter dag instances which are in dead letter
+	DeadLetter bool
+	Trigger    entity.Trigger
+	// TriggerSource filter by TriggerMeta.Source
+	TriggerSource string
+	// Labels filter dag instances which have all of them
+	Labels       map[string]string
+	RootDagInsID string
+	// IdempotencyKey filter by the idempotency key of dag instance
+	IdempotencyKey string
+	// SortByPriority order dag instances by priority in descending order then created time
+	SortByPriority bool
+	Limit          int64
+	Offset         int64
+}
+
+// Match report whether the dag instance matches the filters, paging and sorting are not considered,
+// it is used by the stores which cannot query by conditions
+func (i *ListDagInstanceInput) Match(dagIns *entity.DagInstance) bool {
+	if len(i.Status) > 0 && !containDagInsStatus(i.Status, dagIns.Status) {
+		return false
+	}
+	if i.Worker != "" && dagIns.Worker != i.Worker {
+		return false
+	}
+	if i.DagID != "" && dagIns.DagID != i.DagID {
+		return false
+	}
+	if i.UpdatedEnd > 0 && dagIns.UpdatedAt > i.UpdatedEnd {
+		return false
+	}
+	if i.DeadlineEnd > 0 && (dagIns.Deadline == 0 || dagIns.Deadline > i.DeadlineEnd) {
+		return false
+	}
+	if i.SLADeadlineEnd > 0 && (dagIns.SLADeadline == 0 || dagIns.SLADeadline > i.SLADeadlineEnd) {
+		return false
+	}
+	if i.SLAMissed && dagIns.SLAMissedAt == 0 {
+		return false
+	}
+	if i.CreatedBegin > 0 && dagIns.CreatedAt < i.CreatedBegin {
+		return false
+	}
+	if i.CreatedEnd > 0 && dagIns.CreatedAt > i.CreatedEnd {
+		return false
+	}
+	if i.HasCmd && dagIns.Cmd == nil {
+		return false
+	}
+	if i.DeadLetter && dagIns.DeadLetter == nil {
+		return false
+	}
+	if i.Trigger != "" && dagIns.Trigger != i.Trigger {
+		return false
+	}
+	if i.TriggerSource != "" && (dagIns.TriggerMeta == nil || dagIns.TriggerMeta.Source != i.TriggerSource) {
+		return false
+	}
+	if i.RootDagInsID != "" && dagIns.RootDagInsID != i.RootDagInsID {
+		return false
+	}
+	if i.IdempotencyKey != "" && dagIns.IdempotencyKey != i.IdempotencyKey {
+		return false
+	}
+	return dagIns.MatchLabels(i.Labels)
+}
+
+func containDagInsStatus(status []entity.DagInstanceStatus, s entity.DagInstanceStatus) bool {
+	for i := range status {
+		if status[i] == s {
+			return true
+		}
+	}
+	return false
 }
 
 // ListTaskInstanceInput
@@ -148,7 +427,252 @@ type ListTaskInstanceInput struct {
 	Status   []entity.TaskInstanceStatus
 	// query expired tasks(it will calculate task's timeout)
 	Expired     bool
+	HasArtifact bool
 	SelectField []string
+
+	// AfterID list the task instances which id is greater than it, it is usually the id of the last
+	// instance of previous page, so the pages are not shifted by the instances created or deleted meanwhile
+	AfterID string
+	Limit   int64
+	Offset  int64
+}
+
+// Paged report whether the result is paginated, the paginated task instances are sorted by id,
+// otherwise they are in the store's natural order
+func (i *ListTaskInstanceInput) Paged() bool {
+	return i.AfterID != "" || i.Limit > 0 || i.Offset > 0
+}
+
+// Page sort the matched task instances by id and return the page of input,
+// it is how the stores which filter task instances in memory paginate
+func (i *ListTaskInstanceInput) Page(taskIns []*entity.TaskInstance) []*entity.TaskInstance {
+	if !i.Paged() {
+		return taskIns
+	}
+	sort.SliceStable(taskIns, func(x, y int) bool {
+		return taskIns[x].ID < taskIns[y].ID
+	})
+	if i.AfterID != "" {
+		idx := sort.Search(len(taskIns), func(x int) bool {
+			return taskIns[x].ID > i.AfterID
+		})
+		taskIns = taskIns[idx:]
+	}
+	if i.Offset >= int64(len(taskIns)) {
+		return nil
+	}
+	taskIns = taskIns[i.Offset:]
+	if i.Limit > 0 && int64(len(taskIns)) > i.Limit {
+		taskIns = taskIns[:i.Limit]
+	}
+	return taskIns
+}
+
+// WalkTaskInstance list the task instances page by page and call fn with each page, so the instances
+// of a huge dag instance are not loaded at once. Limit of input is the page size, AfterID and Offset are ignored.
+func WalkTaskInstance(input *ListTaskInstanceInput, fn func(taskIns []*entity.TaskInstance) error) error {
+	ipt := *input
+	ipt.AfterID, ipt.Offset = "", 0
+	if ipt.Limit <= 0 {
+		ipt.Limit = defaultWalkPageSize
+	}
+	for {
+		page, err := GetStore().ListTaskInstance(&ipt)
+		if err != nil {
+			return err
+		}
+		if len(page) > 0 {
+			if err := fn(page); err != nil {
+				return err
+			}
+		}
+		if int64(len(page)) < ipt.Limit {
+			return nil
+		}
+		ipt.AfterID = page[len(page)-1].ID
+	}
+}
+
+// defaultWalkPageSize is the page size of WalkTaskInstance when the limit is not set
+const defaultWalkPageSize = 500
+
+// Match report whether the task instance matches the filters except IDs, the stores which cannot query
+// by conditions usually get task instances by IDs directly
+func (i *ListTaskInstanceInput) Match(taskIns *entity.TaskInstance) bool {
+	if len(i.Status) > 0 && !containTaskInsStatus(i.Status, taskIns.Status) {
+		return false
+	}
+	// delay is prevent watch dog conflicted with task's context timeout
+	if i.Expired && taskIns.UpdatedAt > time.Now().Unix()-5-int64(taskIns.TimeoutSecs) {
+		return false
+	}
+	if i.DagInsID != "" && taskIns.DagInsID != i.DagInsID {
+		return false
+	}
+	if i.TaskID != "" && taskIns.TaskID != i.TaskID {
+		return false
+	}
+	if i.HasArtifact && len(taskIns.Artifacts) == 0 {
+		return false
+	}
+	return true
+}
+
+func containTaskInsStatus(status []entity.TaskInstanceStatus, s entity.TaskInstanceStatus) bool {
+	for i := range status {
+		if status[i] == s {
+			return true
+		}
+	}
+	return false
+}
+
+// ApplyTaskInsPatch apply the non-zero fields of patch to old, it is how PatchTaskIns works,
+// the stores which cannot update fields atomically patch the document read by it
+func ApplyTaskInsPatch(old, patch *entity.TaskInstance) {
+	old.UpdatedAt = time.Now().Unix()
+	if patch.Status != "" {
+		old.Status = patch.Status
+	}
+	if patch.Reason != "" {
+		old.Reason = patch.Reason
+	}
+	if len(patch.Traces) > 0 {
+		old.Traces = patch.Traces
+	}
+	if patch.TimeUsed != "" {
+		old.TimeUsed = patch.TimeUsed
+	}
+	if len(patch.Attempts) > 0 {
+		old.Attempts = patch.Attempts
+	}
+	if len(patch.Artifacts) > 0 {
+		old.Artifacts = patch.Artifacts
+	}
+	if patch.Lineage != nil {
+		old.Lineage = patch.Lineage
+	}
+	if patch.ShareDataSnapshot != nil {
+		old.ShareDataSnapshot = patch.ShareDataSnapshot
+	}
+	if patch.BranchSkipped {
+		old.BranchSkipped = true
+	}
+	if len(patch.MapItems) > 0 {
+		old.MapItems = patch.MapItems
+	}
+	if patch.SubDagInsID != "" {
+		old.SubDagInsID = patch.SubDagInsID
+	}
+	if patch.AutoRetries != 0 {
+		old.AutoRetries = patch.AutoRetries
+	}
+	if patch.NextRetryAt != 0 {
+		old.NextRetryAt = patch.NextRetryAt
+	}
+	if len(patch.Outputs) > 0 {
+		old.Outputs = patch.Outputs
+	}
+	if patch.Worker != "" {
+		old.Worker = patch.Worker
+	}
+	if patch.ClaimExpiresAt != 0 {
+		old.ClaimExpiresAt = patch.ClaimExpiresAt
+	}
+	if patch.Callback != nil {
+		old.Callback = patch.Callback
+	}
+	if patch.Sensor != nil {
+		old.Sensor = patch.Sensor
+	}
+}
+
+// ClaimableTaskInsStatus is the status of task instances which can be claimed, they are the executable ones
+var ClaimableTaskInsStatus = []entity.TaskInstanceStatus{
+	entity.TaskInstanceStatusInit,
+	entity.TaskInstanceStatusEnding,
+	entity.TaskInstanceStatusRetrying,
+	entity.TaskInstanceStatusContinue,
+}
+
+// ApplyTaskInsClaim claim old for worker if it is claimable, it is how ClaimTaskIns works,
+// the stores which cannot update fields atomically claim the document read by it
+func ApplyTaskInsClaim(old *entity.TaskInstance, worker string, ttl time.Duration) bool {
+	now := time.Now()
+	claimable := false
+	for _, s := range ClaimableTaskInsStatus {
+		if old.Status == s {
+			claimable = true
+		}
+	}
+	if !claimable || (old.Worker != worker && old.ClaimExpiresAt > now.Unix()) {
+		return false
+	}
+	old.UpdatedAt = now.Unix()
+	old.Worker = worker
+	old.ClaimExpiresAt = now.Add(ttl).Unix()
+	return true
+}
+
+// ApplyRetryCountSwap set the retry count of dagIns to newCount when it is oldCount, it is how SwapRetryCount works,
+// the stores which cannot update fields atomically swap the document read by it
+func ApplyRetryCountSwap(dagIns *entity.DagInstance, oldCount, newCount int) bool {
+	if dagIns.RetryCount != oldCount {
+		return false
+	}
+	dagIns.UpdatedAt = time.Now().Unix()
+	dagIns.RetryCount = newCount
+	return true
+}
+
+// ApplyDagInsPatch apply the non-zero fields and musts patch fields of patch to old, it is how PatchDagIns works
+func ApplyDagInsPatch(old, patch *entity.DagInstance, mustsPatchFields ...string) {
+	old.UpdatedAt = time.Now().Unix()
+	if patch.ShareData != nil {
+		old.ShareData = patch.ShareData
+	}
+	if patch.Status != "" {
+		old.Status = patch.Status
+	}
+	if utils.StringsContain(mustsPatchFields, "Cmd") || patch.Cmd != nil {
+		old.Cmd = patch.Cmd
+	}
+	if patch.Worker != "" {
+		old.Worker = patch.Worker
+	}
+	if utils.StringsContain(mustsPatchFields, "Reason") || patch.Reason != "" {
+		old.Reason = patch.Reason
+	}
+	if patch.Notes != nil {
+		old.Notes = patch.Notes
+	}
+	if patch.Annotations != nil {
+		old.Annotations = patch.Annotations
+	}
+	if patch.Summary != nil {
+		old.Summary = patch.Summary
+	}
+	if patch.RetryCount != 0 {
+		old.RetryCount = patch.RetryCount
+	}
+	if patch.Deadline != 0 {
+		old.Deadline = patch.Deadline
+	}
+	if patch.SLAs != nil {
+		old.SLAs = patch.SLAs
+	}
+	if utils.StringsContain(mustsPatchFields, "SLADeadline") || patch.SLADeadline != 0 {
+		old.SLADeadline = patch.SLADeadline
+	}
+	if patch.SLAMissedAt != 0 {
+		old.SLAMissedAt = patch.SLAMissedAt
+	}
+	if utils.StringsContain(mustsPatchFields, "DeadLetter") || patch.DeadLetter != nil {
+		old.DeadLetter = patch.DeadLetter
+	}
+	if utils.StringsContain(mustsPatchFields, "IdempotencyKey") || patch.IdempotencyKey != "" {
+		old.IdempotencyKey = patch.IdempotencyKey
+	}
 }
 
 // SetStore
@@ -172,6 +696,13 @@ type Keeper interface {
 	NewMutex(key string) DistributedMutex
 }
 
+// LabeledKeeper is implemented by the keeper which registers the labels of workers with heartbeats,
+// dispatcher uses them to route the dag instances with selector, see "entity.Task.Selector"
+type LabeledKeeper interface {
+	// AliveNodeLabels return the labels of alive nodes by worker key
+	AliveNodeLabels() (map[string]map[string]string, error)
+}
+
 // SetKeeper
 func SetKeeper(e Keeper) {
 	defKeeper = e
@@ -1,10 +1,13 @@
 package mod
 
 import (
+	"fmt"
 	"testing"
 	"time"
 
+	"github.com/etherealiy/fastflow/pkg/entity"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 )
 
 func TestCommAsync(t *testing.T) {
@@ -28,3 +31,253 @@ func TestCommInterval(t *testing.T) {
 	CommSyncInterval(0)(&opt)
 	assert.Equal(t, time.Second, opt.syncInterval)
 }
+
+func TestApplyDagInsPatch(t *testing.T) {
+	old := &entity.DagInstance{
+		Status: entity.DagInstanceStatusRunning,
+		Worker: "worker-1",
+		Reason: "reason",
+		Cmd:    &entity.Command{Name: entity.CommandNameCancel},
+	}
+	ApplyDagInsPatch(old, &entity.DagInstance{Status: entity.DagInstanceStatusFailed}, "Cmd")
+	assert.Equal(t, entity.DagInstanceStatusFailed, old.Status)
+	assert.Equal(t, "worker-1", old.Worker)
+	assert.Equal(t, "reason", old.Reason)
+	assert.Nil(t, old.Cmd)
+	assert.Greater(t, old.UpdatedAt, int64(0))
+}
+
+func TestApplyTaskInsClaim(t *testing.T) {
+	future := time.Now().Add(time.Minute).Unix()
+	tests := []struct {
+		caseDesc  string
+		giveOld   *entity.TaskInstance
+		wantClaim bool
+	}{
+		{
+			caseDesc:  "unclaimed",
+			giveOld:   &entity.TaskInstance{Status: entity.TaskInstanceStatusInit},
+			wantClaim: true,
+		},
+		{
+			caseDesc:  "claimed by self",
+			giveOld:   &entity.TaskInstance{Status: entity.TaskInstanceStatusRetrying, Worker: "worker-1", ClaimExpiresAt: future},
+			wantClaim: true,
+		},
+		{
+			caseDesc: "claimed by others",
+			giveOld:  &entity.TaskInstance{Status: entity.TaskInstanceStatusInit, Worker: "worker-2", ClaimExpiresAt: future},
+		},
+		{
+			caseDesc:  "claim of others is expired",
+			giveOld:   &entity.TaskInstance{Status: entity.TaskInstanceStatusInit, Worker: "worker-2", ClaimExpiresAt: time.Now().Unix()},
+			wantClaim: true,
+		},
+		{
+			caseDesc: "not executable",
+			giveOld:  &entity.TaskInstance{Status: entity.TaskInstanceStatusRunning},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			worker, expiresAt := tc.giveOld.Worker, tc.giveOld.ClaimExpiresAt
+			assert.Equal(t, tc.wantClaim, ApplyTaskInsClaim(tc.giveOld, "worker-1", time.Minute))
+			if tc.wantClaim {
+				assert.Equal(t, "worker-1", tc.giveOld.Worker)
+				assert.GreaterOrEqual(t, tc.giveOld.ClaimExpiresAt, future)
+			} else {
+				assert.Equal(t, worker, tc.giveOld.Worker)
+				assert.Equal(t, expiresAt, tc.giveOld.ClaimExpiresAt)
+			}
+		})
+	}
+}
+
+func TestListTaskInstanceInput_Page(t *testing.T) {
+	give := []*entity.TaskInstance{
+		{BaseInfo: entity.BaseInfo{ID: "3"}},
+		{BaseInfo: entity.BaseInfo{ID: "1"}},
+		{BaseInfo: entity.BaseInfo{ID: "2"}},
+	}
+	tests := []struct {
+		caseDesc  string
+		giveInput *ListTaskInstanceInput
+		wantIDs   []string
+	}{
+		{
+			caseDesc:  "not paged",
+			giveInput: &ListTaskInstanceInput{},
+			wantIDs:   []string{"3", "1", "2"},
+		},
+		{
+			caseDesc:  "limit",
+			giveInput: &ListTaskInstanceInput{Limit: 2},
+			wantIDs:   []string{"1", "2"},
+		},
+		{
+			caseDesc:  "offset",
+			giveInput: &ListTaskInstanceInput{Offset: 1},
+			wantIDs:   []string{"2", "3"},
+		},
+		{
+			caseDesc:  "after id",
+			giveInput: &ListTaskInstanceInput{AfterID: "1", Limit: 1},
+			wantIDs:   []string{"2"},
+		},
+		{
+			caseDesc:  "out of range",
+			giveInput: &ListTaskInstanceInput{AfterID: "1", Offset: 2},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			taskIns := append([]*entity.TaskInstance{}, give...)
+			var ids []string
+			for _, ti := range tc.giveInput.Page(taskIns) {
+				ids = append(ids, ti.ID)
+			}
+			assert.Equal(t, tc.wantIDs, ids)
+		})
+	}
+}
+
+func TestWalkTaskInstance(t *testing.T) {
+	var all []*entity.TaskInstance
+	for i := 0; i < 5; i++ {
+		all = append(all, &entity.TaskInstance{BaseInfo: entity.BaseInfo{ID: fmt.Sprint(i)}, DagInsID: "dagins"})
+	}
+	mStore := &MockStore{}
+	var inputs []ListTaskInstanceInput
+	mStore.On("ListTaskInstance", mock.Anything).Return(func(input *ListTaskInstanceInput) []*entity.TaskInstance {
+		inputs = append(inputs, *input)
+		return input.Page(append([]*entity.TaskInstance{}, all...))
+	}, nil)
+	SetStore(mStore)
+
+	var pages [][]string
+	err := WalkTaskInstance(&ListTaskInstanceInput{DagInsID: "dagins", Limit: 2}, func(taskIns []*entity.TaskInstance) error {
+		var ids []string
+		for _, ti := range taskIns {
+			ids = append(ids, ti.ID)
+		}
+		pages = append(pages, ids)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{"0", "1"}, {"2", "3"}, {"4"}}, pages)
+	assert.Equal(t, []ListTaskInstanceInput{
+		{DagInsID: "dagins", Limit: 2},
+		{DagInsID: "dagins", Limit: 2, AfterID: "1"},
+		{DagInsID: "dagins", Limit: 2, AfterID: "3"},
+	}, inputs)
+
+	// the error of callback stops walking
+	inputs = nil
+	err = WalkTaskInstance(&ListTaskInstanceInput{Limit: 2}, func(taskIns []*entity.TaskInstance) error {
+		return fmt.Errorf("stop")
+	})
+	assert.Error(t, err)
+	assert.Len(t, inputs, 1)
+}
+
+type txMockStore struct {
+	*MockStore
+	calledTx bool
+}
+
+func (s *txMockStore) WithTx(fn func(st Store) error) error {
+	s.calledTx = true
+	return fn(s)
+}
+
+func TestWithTx(t *testing.T) {
+	tests := []struct {
+		caseDesc     string
+		giveStore    Store
+		giveErr      error
+		wantCalledTx bool
+	}{
+		{
+			caseDesc:  "not support",
+			giveStore: &MockStore{},
+		},
+		{
+			caseDesc:     "support",
+			giveStore:    &txMockStore{MockStore: &MockStore{}},
+			wantCalledTx: true,
+		},
+		{
+			caseDesc:     "failed",
+			giveStore:    &txMockStore{MockStore: &MockStore{}},
+			giveErr:      fmt.Errorf("failed"),
+			wantCalledTx: true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			SetStore(tc.giveStore)
+			var got Store
+			err := WithTx(func(st Store) error {
+				got = st
+				return tc.giveErr
+			})
+			assert.Equal(t, tc.giveErr, err)
+			assert.Equal(t, tc.giveStore, got)
+			if ts, ok := tc.giveStore.(*txMockStore); ok {
+				assert.Equal(t, tc.wantCalledTx, ts.calledTx)
+			}
+		})
+	}
+}
+
+// wrapperMockStore wrap a store and has all capabilities, like the write-behind store
+type wrapperMockStore struct {
+	txMockStore
+	wrapped Store
+}
+
+func (s *wrapperMockStore) Unwrap() Store {
+	return s.wrapped
+}
+
+func TestStoreAs(t *testing.T) {
+	tests := []struct {
+		caseDesc  string
+		giveStore Store
+		wantOk    bool
+	}{
+		{
+			caseDesc:  "not support",
+			giveStore: &MockStore{},
+		},
+		{
+			caseDesc:  "support",
+			giveStore: &txMockStore{MockStore: &MockStore{}},
+			wantOk:    true,
+		},
+		{
+			caseDesc:  "wrapped store supports",
+			giveStore: &wrapperMockStore{wrapped: &txMockStore{MockStore: &MockStore{}}},
+			wantOk:    true,
+		},
+		{
+			caseDesc:  "wrapped store does not support",
+			giveStore: &wrapperMockStore{wrapped: &MockStore{}},
+		},
+		{
+			caseDesc: "store wrapped twice does not support",
+			giveStore: &wrapperMockStore{wrapped: &wrapperMockStore{
+				wrapped: &MockStore{},
+			}},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			ts, ok := StoreAs[TxStore](tc.giveStore)
+			assert.Equal(t, tc.wantOk, ok)
+			assert.Equal(t, tc.wantOk, ts != nil)
+		})
+	}
+}
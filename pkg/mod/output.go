@@ -0,0 +1,117 @@
+package mod
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/entity/run"
+)
+
+// DefOutputSizeLimit is the default max size of json encoded output persisted in task instance
+const DefOutputSizeLimit = 4 * 1024
+
+var (
+	outputSizeLimit = DefOutputSizeLimit
+	outputBlobStore OutputBlobStore
+)
+
+// OutputBlobStore save the outputs which exceed the size limit, such as an object store,
+// only the returned reference is persisted in task instance
+type OutputBlobStore interface {
+	Put(taskIns *entity.TaskInstance, key string, data []byte) (ref string, err error)
+	Get(ref string) ([]byte, error)
+}
+
+// SetOutputBlobStore
+func SetOutputBlobStore(s OutputBlobStore) {
+	outputBlobStore = s
+}
+
+// GetOutputBlobStore
+func GetOutputBlobStore() OutputBlobStore {
+	return outputBlobStore
+}
+
+// SetOutputSizeLimit set the max size of json encoded output persisted in task instance, <= 0 means default
+func SetOutputSizeLimit(limit int) {
+	if limit <= 0 {
+		limit = DefOutputSizeLimit
+	}
+	outputSizeLimit = limit
+}
+
+// GetOutputSizeLimit
+func GetOutputSizeLimit() int {
+	return outputSizeLimit
+}
+
+// PublishOutput encode the value by json and attach it to task instance, the value which exceeds
+// the size limit is offloaded to blob store, it fails when no blob store is set
+func PublishOutput(taskIns *entity.TaskInstance, key string, value interface{}) error {
+	bs, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("encode output[%s] failed: %w", key, err)
+	}
+	if len(bs) <= GetOutputSizeLimit() {
+		// keep the decoded value, so it is the same as the one read from store
+		var v interface{}
+		if err := json.Unmarshal(bs, &v); err != nil {
+			return fmt.Errorf("decode output[%s] failed: %w", key, err)
+		}
+		return taskIns.SetOutput(key, run.Output{Value: v, Size: len(bs)})
+	}
+
+	if GetOutputBlobStore() == nil {
+		return fmt.Errorf("output[%s] is %d bytes and exceeds the limit %d bytes, but no blob store is set",
+			key, len(bs), GetOutputSizeLimit())
+	}
+	ref, err := GetOutputBlobStore().Put(taskIns, key, bs)
+	if err != nil {
+		return fmt.Errorf("offload output[%s] failed: %w", key, err)
+	}
+	return taskIns.SetOutput(key, run.Output{Ref: ref, Size: len(bs)})
+}
+
+// ResolveOutput return the value of output, the offloaded value is read from blob store
+func ResolveOutput(output run.Output) (interface{}, error) {
+	if output.Ref == "" {
+		return output.Value, nil
+	}
+	if GetOutputBlobStore() == nil {
+		return nil, fmt.Errorf("output %s is offloaded, but no blob store is set", output.Ref)
+	}
+	bs, err := GetOutputBlobStore().Get(output.Ref)
+	if err != nil {
+		return nil, fmt.Errorf("read output %s failed: %w", output.Ref, err)
+	}
+	var v interface{}
+	if err := json.Unmarshal(bs, &v); err != nil {
+		return nil, fmt.Errorf("decode output %s failed: %w", output.Ref, err)
+	}
+	return v, nil
+}
+
+// listOutputs return the outputs of the tasks in dag instance by task id and key,
+// hook tasks are excluded because they run after all tasks
+func listOutputs(dagInsID string) (map[string]map[string]interface{}, error) {
+	ret := map[string]map[string]interface{}{}
+	err := WalkTaskInstance(&ListTaskInstanceInput{DagInsID: dagInsID}, func(page []*entity.TaskInstance) error {
+		for _, t := range page {
+			if t.Hook != "" || len(t.Outputs) == 0 {
+				continue
+			}
+			outputs := map[string]interface{}{}
+			for key, o := range t.Outputs {
+				v, err := ResolveOutput(o)
+				if err != nil {
+					return fmt.Errorf("resolve output[%s] of task[%s] failed: %w", key, t.TaskID, err)
+				}
+				outputs[key] = v
+			}
+			ret[t.TaskID] = outputs
+		}
+		return nil
+	})
+	return ret, err
+}
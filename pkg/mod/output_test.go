@@ -0,0 +1,79 @@
+package mod
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/entity/run"
+	"github.com/stretchr/testify/assert"
+)
+
+type memOutputBlobStore map[string][]byte
+
+func (s memOutputBlobStore) Put(taskIns *entity.TaskInstance, key string, data []byte) (string, error) {
+	ref := fmt.Sprintf("mem://%s/%s", taskIns.ID, key)
+	s[ref] = data
+	return ref, nil
+}
+
+func (s memOutputBlobStore) Get(ref string) ([]byte, error) {
+	data, ok := s[ref]
+	if !ok {
+		return nil, fmt.Errorf("%s not found", ref)
+	}
+	return data, nil
+}
+
+func TestPublishOutput(t *testing.T) {
+	large := strings.Repeat("a", 32)
+	tests := []struct {
+		caseDesc      string
+		giveBlobStore OutputBlobStore
+		giveValue     interface{}
+		wantOutput    run.Output
+		wantValue     interface{}
+		wantErr       string
+	}{
+		{
+			caseDesc:   "inline",
+			giveValue:  map[string]int{"rows": 10},
+			wantOutput: run.Output{Value: map[string]interface{}{"rows": float64(10)}, Size: 11},
+			wantValue:  map[string]interface{}{"rows": float64(10)},
+		},
+		{
+			caseDesc:      "offloaded",
+			giveBlobStore: memOutputBlobStore{},
+			giveValue:     large,
+			wantOutput:    run.Output{Ref: "mem://task1/result", Size: 34},
+			wantValue:     large,
+		},
+		{
+			caseDesc:  "no blob store",
+			giveValue: large,
+			wantErr:   "output[result] is 34 bytes and exceeds the limit 16 bytes, but no blob store is set",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			SetOutputSizeLimit(16)
+			SetOutputBlobStore(tc.giveBlobStore)
+			defer SetOutputSizeLimit(0)
+			defer SetOutputBlobStore(nil)
+
+			taskIns := &entity.TaskInstance{BaseInfo: entity.BaseInfo{ID: "task1"}}
+			err := PublishOutput(taskIns, "result", tc.giveValue)
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantOutput, taskIns.Outputs["result"])
+
+			v, err := ResolveOutput(taskIns.Outputs["result"])
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantValue, v)
+		})
+	}
+}
@@ -2,6 +2,7 @@ package mod
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -22,6 +23,11 @@ type DefParser struct {
 	taskTrees    sync.Map
 	taskTimeout  time.Duration
 
+	// runningLoaded is true after the running dag instances of current worker are loaded,
+	// it is delayed until promoted in standby mode
+	runningLoaded   bool
+	runningLoadLock sync.Mutex
+
 	closeCh chan struct{}
 	lock    sync.RWMutex
 }
@@ -53,11 +59,38 @@ func (p *DefParser) Init() {
 		p.workerQueue = append(p.workerQueue, ch)
 		go p.goWorker(ch)
 	}
-	if err := p.initialRunningDagIns(); err != nil {
+	if IsStandby() {
+		p.workerWg.Add(1)
+		go p.loadRunningDagInsAfterPromoted()
+		return
+	}
+	if err := p.loadRunningDagIns(); err != nil {
 		log.Fatalf("parser init dags failed: %s", err)
 	}
 }
 
+// loadRunningDagInsAfterPromoted wait until current worker leaves standby mode, then load its running dag instances once
+func (p *DefParser) loadRunningDagInsAfterPromoted() {
+	defer p.workerWg.Done()
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.closeCh:
+			return
+		case <-ticker.C:
+		}
+		if IsStandby() {
+			continue
+		}
+		if err := p.loadRunningDagIns(); err != nil {
+			p.handleErr(fmt.Errorf("load running dag ins after promoted failed: %w", err))
+			continue
+		}
+		return
+	}
+}
+
 func (p *DefParser) startWatcher(do func() error) {
 	timerCh := time.Tick(time.Second)
 	closed := false
@@ -75,6 +108,10 @@ func (p *DefParser) startWatcher(do func() error) {
 }
 
 func (p *DefParser) watchScheduledDagIns() (err error) {
+	// the scheduled dag instances of draining worker are moved to others by rebalancer
+	if IsStandby() || IsDraining() {
+		return nil
+	}
 	start := time.Now()
 	e := &event.ParseScheduleDagInsCompleted{}
 	defer func() {
@@ -91,10 +128,13 @@ func (p *DefParser) watchScheduledDagIns() (err error) {
 		Status: []entity.DagInstanceStatus{
 			entity.DagInstanceStatusScheduled,
 		},
+		SortByPriority: true,
 	})
 	if err != nil {
 		return
 	}
+	// the tasks of dag instance which is parsed earlier are pushed to executor earlier
+	sortDagInsByPriority(dagIns, time.Now())
 	for i := range dagIns {
 		if err = p.parseScheduleDagIns(dagIns[i]); err != nil {
 			return
@@ -105,6 +145,9 @@ func (p *DefParser) watchScheduledDagIns() (err error) {
 }
 
 func (p *DefParser) watchDagInsCmd() (err error) {
+	if IsStandby() {
+		return nil
+	}
 	defer func() {
 		if err != nil {
 			err = fmt.Errorf("watch dag command failed: %w", err)
@@ -135,6 +178,20 @@ func (p *DefParser) goWorker(queue <-chan *entity.TaskInstance) {
 	p.workerWg.Done()
 }
 
+func (p *DefParser) loadRunningDagIns() error {
+	p.runningLoadLock.Lock()
+	defer p.runningLoadLock.Unlock()
+
+	if p.runningLoaded {
+		return nil
+	}
+	if err := p.initialRunningDagIns(); err != nil {
+		return err
+	}
+	p.runningLoaded = true
+	return nil
+}
+
 func (p *DefParser) initialRunningDagIns() error {
 	dagIns, err := GetStore().ListDagInstance(&ListDagInstanceInput{
 		Worker: GetKeeper().WorkerKey(),
@@ -154,11 +211,9 @@ func (p *DefParser) initialRunningDagIns() error {
 
 // InitialDagIns
 func (p *DefParser) InitialDagIns(dagIns *entity.DagInstance) {
-	tasks, err := GetStore().ListTaskInstance(&ListTaskInstanceInput{
-		DagInsID: dagIns.ID,
-	})
+	tasks, err := listTreeTasks(dagIns.ID)
 	if err != nil {
-		log.Errorf("dag instance[%s] list task instance failed: %s", dagIns.ID, err)
+		dagInsLog(dagIns.ID).Errorf("list task instance failed: %s", err)
 		return
 	}
 
@@ -169,14 +224,13 @@ func (p *DefParser) InitialDagIns(dagIns *entity.DagInstance) {
 	// 返回虚拟根节点，因为每个节点都包含child节点列表，根节点已经可以反应整个图的层级关系
 	root, err := BuildRootNode(MapTaskInsToGetter(tasks))
 	if err != nil {
-		log.Errorf("dag instance[%s] build task tree failed: %s", dagIns.ID, err)
+		dagInsLog(dagIns.ID).Errorf("build task tree failed: %s", err)
 		return
 	}
 
-	tree := &TaskTree{
-		DagIns: dagIns,
-		Root:   root,
-	}
+	linkMappedTasks(root, tasks)
+
+	tree := NewTaskTree(dagIns, root)
 	// parser初始化dagIns时，返回的executableTaskIds是入度为0的节点
 	executableTaskIds := tree.Root.GetExecutableTaskIds()
 	// 什么情况会走到这里？
@@ -190,38 +244,87 @@ func (p *DefParser) InitialDagIns(dagIns *entity.DagInstance) {
 		case TreeStatusFailed:
 			tree.DagIns.Fail(fmt.Sprintf("initial failed because task ins[%s]", taskInsId))
 		default:
-			log.Warn("initial a dag which has no executable tasks",
-				utils.LogKeyDagInsID, dagIns.ID)
+			dagInsLog(dagIns.ID).Warn("initial a dag which has no executable tasks")
 			return
 		}
 
 		if err := GetStore().PatchDagIns(&entity.DagInstance{
-			BaseInfo: entity.BaseInfo{ID: dagIns.ID},
-			Status:   dagIns.Status}); err != nil {
-			log.Errorf("patch dag instance[%s] failed: %s", dagIns.ID, err)
+			BaseInfo:   entity.BaseInfo{ID: dagIns.ID},
+			Status:     dagIns.Status,
+			DeadLetter: dagIns.DeadLetter}); err != nil {
+			dagInsLog(dagIns.ID).Errorf("patch dag instance failed: %s", err)
 			return
 		}
+		p.runHooks(tree.DagIns, terminalHook(tree.DagIns, nil))
 		return
 	}
 
 	// 在内存中存储该taskTree
 	p.taskTrees.Store(dagIns.ID, tree)
-	taskMap := getTasksMap(tasks)
 	// 将入度为0的节点对应的task推到Executor中
-	for _, tid := range executableTaskIds {
-		GetExecutor().Push(dagIns, taskMap[tid])
+	if err := walkTaskInsByIDs(executableTaskIds, func(t *entity.TaskInstance) {
+		p.pushTask(tree, t)
+	}); err != nil {
+		dagInsLog(dagIns.ID).Errorf("list executable task instance failed: %s", err)
 	}
 }
 
-func getTasksMap(tasks []*entity.TaskInstance) map[string]*entity.TaskInstance {
-	tmpMap := map[string]*entity.TaskInstance{}
-	for i := range tasks {
-		tmpMap[tasks[i].ID] = tasks[i]
+// listTreeTasks list the task instances of dag instance page by page and keep only the fields used to build
+// the task tree, so a dag instance which has a huge number of tasks does not hold all params and traces in memory
+func listTreeTasks(dagInsID string) ([]*entity.TaskInstance, error) {
+	var tasks []*entity.TaskInstance
+	err := WalkTaskInstance(&ListTaskInstanceInput{DagInsID: dagInsID}, func(page []*entity.TaskInstance) error {
+		for _, t := range page {
+			if t.Hook != "" {
+				continue
+			}
+			tasks = append(tasks, &entity.TaskInstance{
+				BaseInfo:      entity.BaseInfo{ID: t.ID},
+				TaskID:        t.TaskID,
+				DependOn:      t.DependOn,
+				Status:        t.Status,
+				BranchSkipped: t.BranchSkipped,
+				MapOver:       t.MapOver,
+				MapItems:      t.MapItems,
+				MappedFrom:    t.MappedFrom,
+				TriggerRule:   t.TriggerRule,
+			})
+		}
+		return nil
+	})
+	return tasks, err
+}
+
+// walkTaskInsByIDs get the full task instances of ids page by page and call fn in the order of ids
+func walkTaskInsByIDs(ids []string, fn func(t *entity.TaskInstance)) error {
+	for len(ids) > 0 {
+		n := len(ids)
+		if n > defaultWalkPageSize {
+			n = defaultWalkPageSize
+		}
+		page, err := GetStore().ListTaskInstance(&ListTaskInstanceInput{IDs: ids[:n]})
+		if err != nil {
+			return err
+		}
+		found := make(map[string]*entity.TaskInstance, len(page))
+		for _, t := range page {
+			found[t.ID] = t
+		}
+		for _, id := range ids[:n] {
+			if t, ok := found[id]; ok {
+				fn(t)
+			}
+		}
+		ids = ids[n:]
 	}
-	return tmpMap
+	return nil
 }
 
 func (p *DefParser) executeNext(taskIns *entity.TaskInstance) error {
+	// hook tasks are not in task tree and have no next tasks
+	if taskIns.Hook != "" {
+		return nil
+	}
 	tree, ok := p.getTaskTree(taskIns.DagInsID)
 	// tree被删除时，有可能是因为其他并发执行的任务失败了，删除了taskTree并修改dagInstance状态为failed
 	if !ok {
@@ -242,7 +345,10 @@ func (p *DefParser) executeNext(taskIns *entity.TaskInstance) error {
 		finishTreeFlag = true
 	}
 	switch taskIns.Status {
-	case entity.TaskInstanceStatusFailed, entity.TaskInstanceStatusCanceled:
+	case entity.TaskInstanceStatusFailed, entity.TaskInstanceStatusInvalidParams, entity.TaskInstanceStatusCanceled:
+		if p.failureTolerated(tree, taskIns) {
+			break
+		}
 		tree.DagIns.Fail(fmt.Sprintf("task[%s] failed or canceled, reason: %s", taskIns.TaskID, taskIns.Reason))
 		finishTreeFlag = true
 	case entity.TaskInstanceStatusBlocked:
@@ -254,17 +360,10 @@ func (p *DefParser) executeNext(taskIns *entity.TaskInstance) error {
 	if finishTreeFlag {
 		// tree has already completed, delete from map
 		p.taskTrees.Delete(taskIns.DagInsID)
-		if err := GetStore().PatchDagIns(&entity.DagInstance{
-			BaseInfo: entity.BaseInfo{ID: tree.DagIns.ID},
-			Status:   tree.DagIns.Status,
-			Reason:   tree.DagIns.Reason,
-		}); err != nil {
-			return err
-		}
-		return nil
+		return p.finishDagIns(tree.DagIns, terminalHook(tree.DagIns, taskIns), taskIns)
 	}
 
-	ids, find := tree.Root.GetNextTaskIds(taskIns)
+	ids, find := tree.ApplyTaskChange(taskIns)
 	if !find {
 		return fmt.Errorf("task instance[%s] does not found normal node", taskIns.ID)
 	}
@@ -276,10 +375,107 @@ func (p *DefParser) executeNext(taskIns *entity.TaskInstance) error {
 		return p.cancelChildTasks(tree, ids)
 	}
 
-	return p.pushTasks(tree.DagIns, ids)
+	return p.pushTasks(tree, ids)
+}
+
+// failureTolerated return true when the children of failed or canceled task may still run by their trigger rules,
+// so the dag instance goes on
+func (p *DefParser) failureTolerated(tree *TaskTree, taskIns *entity.TaskInstance) bool {
+	node, ok := tree.GetNode(taskIns.ID)
+	if !ok {
+		return false
+	}
+	node.Status = taskIns.Status
+	return node.FailureTolerated()
+}
+
+// terminalHook return the hook triggered by the task which terminated the dag instance,
+// it is empty when the dag instance is not terminated
+func terminalHook(dagIns *entity.DagInstance, taskIns *entity.TaskInstance) entity.DagHook {
+	switch dagIns.Status {
+	case entity.DagInstanceStatusSuccess:
+		return entity.DagHookSuccess
+	case entity.DagInstanceStatusFailed:
+		if taskIns != nil && taskIns.Status == entity.TaskInstanceStatusCanceled {
+			return entity.DagHookCancel
+		}
+		return entity.DagHookFailure
+	}
+	return ""
+}
+
+// runHooks create the task instances of hook tasks and push them to executor, failing to run hooks
+// should not change the terminated dag instance
+func (p *DefParser) runHooks(dagIns *entity.DagInstance, hook entity.DagHook) {
+	if hook == "" {
+		return
+	}
+	dag, err := GetStore().GetDag(dagIns.DagID)
+	if err != nil {
+		dagInsLog(dagIns.ID).Errorf("get dag[%s] to run %s hooks failed: %s", dagIns.DagID, hook, err)
+		return
+	}
+	tasks := dag.Hooks.Tasks(hook)
+	if len(tasks) == 0 {
+		return
+	}
+
+	var hookIns []*entity.TaskInstance
+	for _, t := range tasks {
+		ins, err := p.newTaskIns(dagIns, t)
+		if err != nil {
+			dagInsLog(dagIns.ID).Errorf("new %s hook task[%s] failed: %s", hook, t.ID, err)
+			return
+		}
+		ins.Hook = hook
+		hookIns = append(hookIns, ins)
+	}
+	if err := GetStore().BatchCreatTaskIns(hookIns); err != nil {
+		dagInsLog(dagIns.ID).Errorf("create %s hook tasks failed: %s", hook, err)
+		return
+	}
+	for _, ins := range hookIns {
+		GetExecutor().Push(dagIns, ins)
+	}
 }
 
-func (p *DefParser) pushTasks(dagIns *entity.DagInstance, ids []string) error {
+// finishDagIns save the terminal status of dag instance with its summary, then run the dag hook and the
+// lifecycle hooks, taskIns is the task instance which blocked the dag instance
+func (p *DefParser) finishDagIns(dagIns *entity.DagInstance, hook entity.DagHook, taskIns *entity.TaskInstance) error {
+	if err := GetStore().PatchDagIns(&entity.DagInstance{
+		BaseInfo:   entity.BaseInfo{ID: dagIns.ID},
+		Status:     dagIns.Status,
+		Reason:     dagIns.Reason,
+		Summary:    summarizeDagIns(dagIns),
+		DeadLetter: dagIns.DeadLetter,
+	}); err != nil {
+		return err
+	}
+	p.runHooks(dagIns, hook)
+	if dagIns.Status == entity.DagInstanceStatusBlocked {
+		callTaskBlockedHooks(dagIns, taskIns)
+	} else {
+		callDagCompleteHooks(dagIns)
+	}
+	return nil
+}
+
+// summarizeDagIns compute summary when dag instance is terminated, failing to summarize should not block the dag instance
+func summarizeDagIns(dagIns *entity.DagInstance) *entity.DagInstanceSummary {
+	switch dagIns.Status {
+	case entity.DagInstanceStatusSuccess, entity.DagInstanceStatusFailed:
+	default:
+		return nil
+	}
+	tasks, err := GetStore().ListTaskInstance(&ListTaskInstanceInput{DagInsID: dagIns.ID})
+	if err != nil {
+		dagInsLog(dagIns.ID).Errorf("list task instances for summary failed: %s", err)
+		return nil
+	}
+	return entity.NewDagInstanceSummary(dagIns, tasks, time.Now())
+}
+
+func (p *DefParser) pushTasks(tree *TaskTree, ids []string) error {
 	tasks, err := GetStore().ListTaskInstance(&ListTaskInstanceInput{
 		IDs: ids,
 	})
@@ -287,19 +483,146 @@ func (p *DefParser) pushTasks(dagIns *entity.DagInstance, ids []string) error {
 		return err
 	}
 	for _, t := range tasks {
-		GetExecutor().Push(dagIns, t)
+		p.pushTask(tree, t)
 	}
 
 	return nil
 }
 
+// pushTask push the task to executor unless its branch is not taken or it is mapped, the task completed
+// by parser is parsed again so that its downstream tasks are pushed or skipped in turn
+func (p *DefParser) pushTask(tree *TaskTree, taskIns *entity.TaskInstance) {
+	if taskIns.Status == entity.TaskInstanceStatusInit {
+		node, ok := tree.GetNode(taskIns.ID)
+		if ok && taskIns.DoDependOnCheck(tree.DagIns, node.UpstreamBranchSkipped()) {
+			p.completeTask(taskIns)
+			return
+		}
+		if ok && taskIns.MapOver != nil {
+			p.mapTask(tree, node, taskIns)
+			return
+		}
+	}
+	GetExecutor().Push(tree.DagIns, taskIns)
+}
+
+// mapTask expand the task into the mapped task instances, and complete it after all of them completed
+func (p *DefParser) mapTask(tree *TaskTree, node *TaskNode, taskIns *entity.TaskInstance) {
+	if node.Expanded {
+		taskIns.Status = entity.TaskInstanceStatusSuccess
+		taskIns.Reason = ReasonMappedTasksCompleted
+		p.completeTask(taskIns)
+		return
+	}
+
+	mapped, err := p.expandTask(tree, node, taskIns)
+	if err != nil {
+		taskIns.Status = entity.TaskInstanceStatusFailed
+		taskIns.Reason = fmt.Sprintf("expand task failed: %s", err)
+		p.completeTask(taskIns)
+		return
+	}
+	if len(taskIns.MapItems) == 0 {
+		taskIns.Status = entity.TaskInstanceStatusSuccess
+		taskIns.Reason = ReasonNoItemToMap
+		p.completeTask(taskIns)
+		return
+	}
+	for _, ins := range mapped {
+		p.pushTask(tree, ins)
+	}
+}
+
+// expandTask create the task instances mapped from the task and insert them into the tree,
+// it returns the created task instances
+func (p *DefParser) expandTask(tree *TaskTree, node *TaskNode, taskIns *entity.TaskInstance) ([]*entity.TaskInstance, error) {
+	if taskIns.MapItems == nil {
+		items, err := taskIns.MapOver.Items(tree.DagIns)
+		if err != nil {
+			return nil, err
+		}
+		if len(items) == 0 {
+			return nil, nil
+		}
+		if err := GetStore().PatchTaskIns(&entity.TaskInstance{
+			BaseInfo: taskIns.BaseInfo,
+			MapItems: items,
+		}); err != nil {
+			return nil, err
+		}
+		taskIns.MapItems = items
+	}
+
+	// the mapped task instances created before the worker restarted are already linked to the node
+	existed := map[string]bool{}
+	for _, parent := range node.parents {
+		existed[parent.TaskInsID] = true
+	}
+	var created []*entity.TaskInstance
+	var nodes []*TaskNode
+	for i := range taskIns.MapItems {
+		ins, err := taskIns.NewMappedTaskInstance(i)
+		if err != nil {
+			return nil, err
+		}
+		if existed[ins.ID] {
+			continue
+		}
+		created = append(created, ins)
+		nodes = append(nodes, NewTaskNodeFromGetter(ins))
+	}
+	if len(created) > 0 {
+		if err := GetStore().BatchCreatTaskIns(created); err != nil {
+			return nil, err
+		}
+	}
+	tree.Expand(node, nodes)
+	node.Expanded = true
+	return created, nil
+}
+
+// completeTask save the status of task which is completed by parser and parse it
+func (p *DefParser) completeTask(taskIns *entity.TaskInstance) {
+	if err := GetStore().PatchTaskIns(&entity.TaskInstance{
+		BaseInfo:      taskIns.BaseInfo,
+		Status:        taskIns.Status,
+		Reason:        taskIns.Reason,
+		BranchSkipped: taskIns.BranchSkipped,
+	}); err != nil {
+		taskInsLog(taskIns).Errorf("patch task instance failed: %s", err)
+		return
+	}
+	p.EntryTaskIns(taskIns)
+}
+
+// linkMappedTasks link the task instances mapped before the worker restarted to the tasks mapped from
+func linkMappedTasks(root *TaskNode, tasks []*entity.TaskInstance) {
+	nodes := map[string]*TaskNode{}
+	for _, n := range root.TopoOrder() {
+		nodes[n.TaskInsID] = n
+	}
+	mapped := map[string][]*TaskNode{}
+	for _, t := range tasks {
+		if t.MappedFrom != "" {
+			mapped[t.MappedFrom] = append(mapped[t.MappedFrom], nodes[t.ID])
+		}
+	}
+	for _, t := range tasks {
+		if t.MapOver == nil || len(mapped[t.TaskID]) == 0 {
+			continue
+		}
+		n := nodes[t.ID]
+		n.Expand(mapped[t.TaskID])
+		n.Expanded = len(mapped[t.TaskID]) == len(t.MapItems)
+	}
+}
+
 func (p *DefParser) cancelChildTasks(tree *TaskTree, ids []string) error {
-	walkNode(tree.Root, func(node *TaskNode) bool {
-		if utils.StringsContain(ids, node.TaskInsID) {
+	for _, id := range ids {
+		if node, ok := tree.GetNode(id); ok {
 			node.Status = entity.TaskInstanceStatusCanceled
 		}
-		return true
-	}, false)
+	}
 
 	for _, id := range ids {
 		if err := GetStore().PatchTaskIns(&entity.TaskInstance{
@@ -320,7 +643,24 @@ func (p *DefParser) cancelChildTasks(tree *TaskTree, ids []string) error {
 		return nil
 	}
 	tree.DagIns.Fail(fmt.Sprintf("task instance[%s] canceled", strings.Join(ids, ",")))
-	return GetStore().PatchDagIns(tree.DagIns)
+	return p.finishDagIns(tree.DagIns, entity.DagHookCancel, nil)
+}
+
+// cancelDagIns fail the dag instance for reason and cancel its unfinished tasks, the running actions are stopped
+func (p *DefParser) cancelDagIns(dagIns *entity.DagInstance, reason string) error {
+	if !dagIns.CanModifyStatus() {
+		return nil
+	}
+	running, err := cancelUnfinishedTasks(dagIns.ID, reason)
+	if err != nil {
+		return err
+	}
+	if err := GetExecutor().CancelTaskIns(running); err != nil {
+		return err
+	}
+	p.taskTrees.Delete(dagIns.ID)
+	dagIns.Fail(reason)
+	return p.finishDagIns(dagIns, entity.DagHookCancel, nil)
 }
 
 func (p *DefParser) getTaskTree(dagInsId string) (*TaskTree, bool) {
@@ -332,6 +672,26 @@ func (p *DefParser) getTaskTree(dagInsId string) (*TaskTree, bool) {
 	return tasks.(*TaskTree), true
 }
 
+// DagInsIDs return the ids of dag instances which task trees are held in memory
+func (p *DefParser) DagInsIDs() []string {
+	var ids []string
+	p.taskTrees.Range(func(key, value interface{}) bool {
+		ids = append(ids, key.(string))
+		return true
+	})
+	sort.Strings(ids)
+	return ids
+}
+
+// QueueLen return the count of task instances waiting for parsing
+func (p *DefParser) QueueLen() int {
+	n := 0
+	for _, q := range p.workerQueue {
+		n += len(q)
+	}
+	return n
+}
+
 // EntryTaskIns 将taskIns送到parser的某个worker中进行解析
 func (p *DefParser) EntryTaskIns(taskIns *entity.TaskInstance) {
 	murmurHash := murmur3.New32()
@@ -387,8 +747,8 @@ func (p *DefParser) parseScheduleDagIns(dagIns *entity.DagInstance) error {
 		}
 
 		// the init of tasks is not complete, should continue/start it.
+		var needInitTaskIns []*entity.TaskInstance
 		if len(dag.Tasks) != len(tasks) {
-			var needInitTaskIns []*entity.TaskInstance
 			for i := range dag.Tasks {
 				notFound := true
 				for j := range tasks {
@@ -398,58 +758,96 @@ func (p *DefParser) parseScheduleDagIns(dagIns *entity.DagInstance) error {
 				}
 
 				if notFound {
-					renderParams, err := dagIns.Vars.Render(dag.Tasks[i].Params)
+					ins, err := p.newTaskIns(dagIns, dag.Tasks[i])
 					if err != nil {
 						return err
 					}
-					dag.Tasks[i].Params = renderParams
-					if dag.Tasks[i].TimeoutSecs == 0 {
-						dag.Tasks[i].TimeoutSecs = int(p.taskTimeout.Seconds())
-					}
-					needInitTaskIns = append(needInitTaskIns, entity.NewTaskInstance(dagIns.ID, dag.Tasks[i]))
+					needInitTaskIns = append(needInitTaskIns, ins)
 				}
 			}
-			if err := GetStore().BatchCreatTaskIns(needInitTaskIns); err != nil {
-				return err
-			}
 		}
 
 		dagIns.Run()
-		if err := GetStore().PatchDagIns(&entity.DagInstance{
-			BaseInfo: dagIns.BaseInfo,
-			Status:   dagIns.Status,
-			Reason:   dagIns.Reason,
-		}, "Reason"); err != nil {
-			return err
-		}
+		// the task instances and running status are persisted together when the store supports transactions
+		return WithTx(func(st Store) error {
+			if len(needInitTaskIns) > 0 {
+				if err := st.BatchCreatTaskIns(needInitTaskIns); err != nil {
+					return err
+				}
+			}
+			return st.PatchDagIns(&entity.DagInstance{
+				BaseInfo: dagIns.BaseInfo,
+				Status:   dagIns.Status,
+				Reason:   dagIns.Reason,
+				Deadline: dagIns.Deadline,
+			}, "Reason")
+		})
 	}
 	return nil
 }
 
+// newTaskIns render the params and env of task by the vars of dag instance and new its task instance
+func (p *DefParser) newTaskIns(dagIns *entity.DagInstance, t entity.Task) (*entity.TaskInstance, error) {
+	renderParams, err := dagIns.Vars.Render(t.Params)
+	if err != nil {
+		return nil, err
+	}
+	t.Params = renderParams
+	t.Env = dagIns.Vars.RenderEnv(t.Env)
+	if t.TimeoutSecs == 0 {
+		t.TimeoutSecs = int(p.taskTimeout.Seconds())
+	}
+	return entity.NewTaskInstance(dagIns.ID, t), nil
+}
+
 func (p *DefParser) parseCmd(dagIns *entity.DagInstance) (err error) {
 	if dagIns.Cmd != nil {
 		switch dagIns.Cmd.Name {
 		case entity.CommandNameRetry:
 			err = p.loopTaskThenInitialDagIns(
 				dagIns,
-				[]entity.TaskInstanceStatus{entity.TaskInstanceStatusFailed, entity.TaskInstanceStatusCanceled},
+				retryableTaskStatus,
 				func(t *entity.TaskInstance) bool {
 					if t.Status != entity.TaskInstanceStatusFailed &&
+						t.Status != entity.TaskInstanceStatusInvalidParams &&
 						t.Status != entity.TaskInstanceStatusCanceled {
 						return false
 					}
 
 					t.Status = entity.TaskInstanceStatusRetrying
 					t.Reason = ""
+					// previous execution has been recorded in attempts
+					t.Traces = nil
+					t.TimeUsed = ""
+					t.AutoRetries = 0
 					return true
 				})
 			if err != nil {
 				return
 			}
+		case entity.CommandNameRetryFromFailed:
+			if err = p.retryFromFailed(dagIns); err != nil {
+				return
+			}
+		case entity.CommandNameSkip:
+			operator, reason := dagIns.Cmd.Operator, dagIns.Cmd.Reason
+			err = p.loopTaskThenInitialDagIns(
+				dagIns,
+				skippableTaskStatus,
+				func(t *entity.TaskInstance) bool {
+					return t.SkipManually(operator, reason)
+				})
+			if err != nil {
+				return
+			}
 		case entity.CommandNameCancel:
 			if err := GetExecutor().CancelTaskIns(dagIns.Cmd.TargetTaskInsIDs); err != nil {
 				return err
 			}
+		case entity.CommandNameCancelDagIns:
+			if err = p.cancelDagIns(dagIns, dagIns.Cmd.Reason); err != nil {
+				return
+			}
 		case entity.CommandNameContinue:
 			err = p.loopTaskThenInitialDagIns(
 				dagIns,
@@ -467,7 +865,7 @@ func (p *DefParser) parseCmd(dagIns *entity.DagInstance) (err error) {
 				return
 			}
 		default:
-			log.Errorf("command[%s] is invalid, ignore it", dagIns.Cmd.Name)
+			dagInsLog(dagIns.ID).Errorf("command[%s] is invalid, ignore it", dagIns.Cmd.Name)
 		}
 
 		dagIns.Cmd = nil
@@ -476,6 +874,7 @@ func (p *DefParser) parseCmd(dagIns *entity.DagInstance) (err error) {
 			Status:   dagIns.Status,
 			Cmd:      dagIns.Cmd,
 			Reason:   dagIns.Reason,
+			Deadline: dagIns.Deadline,
 		}, "Cmd", "Reason"); err != nil {
 			return err
 		}
@@ -518,6 +917,84 @@ func (p *DefParser) loopTaskThenInitialDagIns(
 	return
 }
 
+// retryFromFailed retry the target tasks and reset their downstream tasks, then initial the dag instance again
+func (p *DefParser) retryFromFailed(dagIns *entity.DagInstance) error {
+	taskIns, err := GetStore().ListTaskInstance(&ListTaskInstanceInput{DagInsID: dagIns.ID})
+	if err != nil {
+		return err
+	}
+
+	changed := resetFromFailed(taskIns, dagIns.Cmd.TargetTaskInsIDs)
+	for _, t := range changed {
+		if err := GetStore().UpdateTaskIns(t); err != nil {
+			return err
+		}
+	}
+	dagIns.Run()
+	if len(changed) > 0 {
+		p.InitialDagIns(dagIns)
+	}
+	return nil
+}
+
+// resetFromFailed set the failed and canceled target tasks to retrying, and reset all tasks downstream of them
+// to init, so they are executed again after the targets. It returns the changed task instances.
+func resetFromFailed(taskIns []*entity.TaskInstance, targetIds []string) []*entity.TaskInstance {
+	children := map[string][]*entity.TaskInstance{}
+	for _, t := range taskIns {
+		for _, dep := range t.DependOn {
+			children[dep] = append(children[dep], t)
+		}
+	}
+
+	var changed, queue []*entity.TaskInstance
+	visited := map[string]bool{}
+	for _, t := range taskIns {
+		if !utils.StringsContain(targetIds, t.ID) ||
+			(t.Status != entity.TaskInstanceStatusFailed && t.Status != entity.TaskInstanceStatusInvalidParams &&
+				t.Status != entity.TaskInstanceStatusCanceled) {
+			continue
+		}
+		t.Status = entity.TaskInstanceStatusRetrying
+		t.Reason = ""
+		// previous execution has been recorded in attempts
+		t.Traces = nil
+		t.TimeUsed = ""
+		t.AutoRetries = 0
+		visited[t.ID] = true
+		changed = append(changed, t)
+		queue = append(queue, t)
+	}
+
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		// the downstream tasks depend on the task which the mapped ones are mapped from
+		downstream := children[cur.TaskID]
+		if cur.MappedFrom != "" {
+			downstream = append(downstream, children[cur.MappedFrom]...)
+		}
+		for _, t := range downstream {
+			if visited[t.ID] {
+				continue
+			}
+			visited[t.ID] = true
+			queue = append(queue, t)
+			if t.Status == entity.TaskInstanceStatusInit {
+				continue
+			}
+			t.Status = entity.TaskInstanceStatusInit
+			t.Reason = ""
+			t.Traces = nil
+			t.TimeUsed = ""
+			t.BranchSkipped = false
+			t.ManualSkip = nil
+			changed = append(changed, t)
+		}
+	}
+	return changed
+}
+
 // Close
 func (p *DefParser) Close() {
 	p.lock.Lock()
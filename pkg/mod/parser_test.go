@@ -1,6 +1,7 @@
 package mod
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"sync"
@@ -9,6 +10,7 @@ import (
 
 	"github.com/etherealiy/fastflow/pkg/entity"
 	"github.com/etherealiy/fastflow/pkg/log"
+	"github.com/etherealiy/fastflow/pkg/utils"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -55,18 +57,21 @@ func TestDefParser_cancelChildTask(t *testing.T) {
 				children: []*TaskNode{
 					{
 						TaskInsID: "task1",
+						GraphID:   "task1",
 						Status:    entity.TaskInstanceStatusSuccess,
 						children: []*TaskNode{
 							{
 								TaskInsID: "task2",
+								GraphID:   "task2",
 								Status:    entity.TaskInstanceStatusSuccess,
 								children: []*TaskNode{
-									{TaskInsID: "task4", Status: entity.TaskInstanceStatusCanceled},
-									{TaskInsID: "task5", Status: entity.TaskInstanceStatusCanceled},
+									{TaskInsID: "task4", GraphID: "task4", Status: entity.TaskInstanceStatusCanceled},
+									{TaskInsID: "task5", GraphID: "task5", Status: entity.TaskInstanceStatusCanceled},
 								},
 							},
 							{
 								TaskInsID: "task3",
+								GraphID:   "task3",
 								Status:    entity.TaskInstanceStatusRunning,
 							},
 						},
@@ -95,10 +100,12 @@ func TestDefParser_cancelChildTask(t *testing.T) {
 				children: []*TaskNode{
 					{
 						TaskInsID: "task1",
+						GraphID:   "task1",
 						Status:    entity.TaskInstanceStatusSuccess,
 						children: []*TaskNode{
 							{
 								TaskInsID: "task2",
+								GraphID:   "task2",
 								Status:    entity.TaskInstanceStatusCanceled,
 							},
 						},
@@ -128,10 +135,12 @@ func TestDefParser_cancelChildTask(t *testing.T) {
 				children: []*TaskNode{
 					{
 						TaskInsID: "task1",
+						GraphID:   "task1",
 						Status:    entity.TaskInstanceStatusSuccess,
 						children: []*TaskNode{
 							{
 								TaskInsID: "task2",
+								GraphID:   "task2",
 								Status:    entity.TaskInstanceStatusCanceled,
 							},
 						},
@@ -159,10 +168,12 @@ func TestDefParser_cancelChildTask(t *testing.T) {
 				children: []*TaskNode{
 					{
 						TaskInsID: "task1",
+						GraphID:   "task1",
 						Status:    entity.TaskInstanceStatusSuccess,
 						children: []*TaskNode{
 							{
 								TaskInsID: "task2",
+								GraphID:   "task2",
 								Status:    entity.TaskInstanceStatusCanceled,
 							},
 						},
@@ -192,8 +203,16 @@ func TestDefParser_cancelChildTask(t *testing.T) {
 			}).Return(tc.givePatchTaskErr)
 			mStore.On("PatchDagIns", mock.Anything).Run(func(args mock.Arguments) {
 				calledPatchDag = true
-				assert.Equal(t, tc.wantPatchDagIns, args.Get(0))
+				patch := *args.Get(0).(*entity.DagInstance)
+				assert.NotNil(t, patch.Summary, "the summary should be saved")
+				patch.Summary = nil
+				assert.Equal(t, tc.wantPatchDagIns, &patch)
 			}).Return(tc.givePatchDagErr)
+			mStore.On("ListTaskInstance", mock.Anything).Return(tc.giveTasks, nil)
+			// the status is computed by walking the tree since the end task is not found
+			mStore.On("GetTaskIns", mock.Anything).Return(nil, fmt.Errorf("not found"))
+			// the dag has no cancel hooks
+			mStore.On("GetDag", mock.Anything).Return(&entity.Dag{}, nil)
 			SetStore(mStore)
 
 			tc.giveParser.taskTrees.Store(tc.giveDagIns.ID, tree)
@@ -216,6 +235,7 @@ func TestDefParser_executeNext(t *testing.T) {
 		giveParser         *DefParser
 		giveTaskIns        *entity.TaskInstance
 		giveTaskTreeMap    map[string]*TaskTree
+		giveDagIns         *entity.DagInstance
 		giveListErr        error
 		givePatchErr       error
 		wantError          error
@@ -260,7 +280,7 @@ func TestDefParser_executeNext(t *testing.T) {
 			wantListTaskCalled: true,
 		},
 		{
-			caseDesc:   "all success",
+			caseDesc:   "end task succeed",
 			giveParser: &DefParser{},
 			giveTaskTreeMap: map[string]*TaskTree{
 				"dag1": {
@@ -272,7 +292,7 @@ func TestDefParser_executeNext(t *testing.T) {
 						TaskInsID: "task-ins-id",
 						Status:    entity.TaskInstanceStatusSuccess,
 						children: []*TaskNode{
-							{TaskInsID: "child-task-id-1", Status: entity.TaskInstanceStatusInit},
+							{TaskInsID: "child-task-id-1", Status: entity.TaskInstanceStatusSuccess},
 							{TaskInsID: "child-task-id-2", Status: entity.TaskInstanceStatusSuccess},
 						},
 					},
@@ -280,14 +300,16 @@ func TestDefParser_executeNext(t *testing.T) {
 			},
 			giveTaskIns: &entity.TaskInstance{
 				BaseInfo: entity.BaseInfo{
-					ID: "child-task-id-1",
+					ID: "end-task-id",
 				},
+				TaskID:   TaskEndID,
 				DagInsID: "dag1",
 				Status:   entity.TaskInstanceStatusSuccess,
 			},
-			wantPatchCalled: true,
-			wantPatchStatus: entity.DagInstanceStatusSuccess,
-			wantDelete:      true,
+			wantPatchCalled:    true,
+			wantListTaskCalled: true,
+			wantPatchStatus:    entity.DagInstanceStatusSuccess,
+			wantDelete:         true,
 		},
 		{
 			caseDesc:   "branch failed",
@@ -302,7 +324,7 @@ func TestDefParser_executeNext(t *testing.T) {
 						TaskInsID: "task-ins-id",
 						Status:    entity.TaskInstanceStatusSuccess,
 						children: []*TaskNode{
-							{TaskInsID: "child-task-id-1", Status: entity.TaskInstanceStatusFailed},
+							{TaskInsID: "child-task-id-1", Status: entity.TaskInstanceStatusRunning},
 							{TaskInsID: "child-task-id-2", Status: entity.TaskInstanceStatusRunning},
 						},
 					},
@@ -310,14 +332,15 @@ func TestDefParser_executeNext(t *testing.T) {
 			},
 			giveTaskIns: &entity.TaskInstance{
 				BaseInfo: entity.BaseInfo{
-					ID: "child-task-id-2",
+					ID: "child-task-id-1",
 				},
 				DagInsID: "dag1",
-				Status:   entity.TaskInstanceStatusSuccess,
+				Status:   entity.TaskInstanceStatusFailed,
 			},
-			wantPatchCalled: true,
-			wantPatchStatus: entity.DagInstanceStatusFailed,
-			wantDelete:      true,
+			wantPatchCalled:    true,
+			wantListTaskCalled: true,
+			wantPatchStatus:    entity.DagInstanceStatusFailed,
+			wantDelete:         true,
 		},
 		{
 			caseDesc:   "parent failed",
@@ -345,13 +368,47 @@ func TestDefParser_executeNext(t *testing.T) {
 				DagInsID: "dag1",
 				Status:   entity.TaskInstanceStatusFailed,
 			},
-			wantPatchStatus: entity.DagInstanceStatusFailed,
-			wantPatchCalled: true,
-			wantDelete:      true,
+			wantPatchStatus:    entity.DagInstanceStatusFailed,
+			wantPatchCalled:    true,
+			wantListTaskCalled: true,
+			wantDelete:         true,
 		},
 		{
 			caseDesc:   "branch succeed but dag failed",
 			giveParser: &DefParser{},
+			giveDagIns: &entity.DagInstance{
+				BaseInfo: entity.BaseInfo{ID: "dag1"},
+				Status:   entity.DagInstanceStatusFailed,
+			},
+			giveTaskIns: &entity.TaskInstance{
+				BaseInfo: entity.BaseInfo{
+					ID: "child-task-id-2",
+				},
+				DagInsID: "dag1",
+				Status:   entity.TaskInstanceStatusSuccess,
+			},
+			wantDelete: true,
+		},
+		{
+			caseDesc:   "branch succeed but tree not found",
+			giveParser: &DefParser{},
+			giveDagIns: &entity.DagInstance{
+				BaseInfo: entity.BaseInfo{ID: "dag1"},
+				Status:   entity.DagInstanceStatusRunning,
+			},
+			giveTaskIns: &entity.TaskInstance{
+				BaseInfo: entity.BaseInfo{
+					ID: "child-task-id-2",
+				},
+				DagInsID: "dag1",
+				Status:   entity.TaskInstanceStatusSuccess,
+			},
+			wantError:  errors.New("dag instance[dag1] does not found task tree"),
+			wantDelete: true,
+		},
+		{
+			caseDesc:   "child blocked",
+			giveParser: &DefParser{},
 			giveTaskTreeMap: map[string]*TaskTree{
 				"dag1": {
 					DagIns: &entity.DagInstance{
@@ -362,25 +419,25 @@ func TestDefParser_executeNext(t *testing.T) {
 						TaskInsID: "task-ins-id",
 						Status:    entity.TaskInstanceStatusSuccess,
 						children: []*TaskNode{
-							{TaskInsID: "child-task-id-1", Status: entity.TaskInstanceStatusFailed},
-							{TaskInsID: "child-task-id-2", Status: entity.TaskInstanceStatusRunning},
+							{TaskInsID: "child-task-id-1", Status: entity.TaskInstanceStatusRunning},
+							{TaskInsID: "child-task-id-2", Status: entity.TaskInstanceStatusInit},
 						},
 					},
 				},
 			},
 			giveTaskIns: &entity.TaskInstance{
 				BaseInfo: entity.BaseInfo{
-					ID: "child-task-id-2",
+					ID: "child-task-id-1",
 				},
 				DagInsID: "dag1",
-				Status:   entity.TaskInstanceStatusSuccess,
+				Status:   entity.TaskInstanceStatusBlocked,
 			},
-			wantDelete:      true,
-			wantPatchStatus: entity.DagInstanceStatusFailed,
+			wantPatchStatus: entity.DagInstanceStatusBlocked,
 			wantPatchCalled: true,
+			wantDelete:      true,
 		},
 		{
-			caseDesc:   "child block but parent not success",
+			caseDesc:   "task not in tree",
 			giveParser: &DefParser{},
 			giveTaskTreeMap: map[string]*TaskTree{
 				"dag1": {
@@ -393,19 +450,18 @@ func TestDefParser_executeNext(t *testing.T) {
 						Status:    entity.TaskInstanceStatusRunning,
 						children: []*TaskNode{
 							{TaskInsID: "child-task-id-1", Status: entity.TaskInstanceStatusInit},
-							{TaskInsID: "child-task-id-2", Status: entity.TaskInstanceStatusInit},
 						},
 					},
 				},
 			},
 			giveTaskIns: &entity.TaskInstance{
 				BaseInfo: entity.BaseInfo{
-					ID: "child-task-id-1",
+					ID: "unknown-task-id",
 				},
 				DagInsID: "dag1",
-				Status:   entity.TaskInstanceStatusBlocked,
+				Status:   entity.TaskInstanceStatusSuccess,
 			},
-			wantError: errors.New("task instance[child-task-id-1] does not found normal node"),
+			wantError: errors.New("task instance[unknown-task-id] does not found normal node"),
 		},
 	}
 
@@ -420,11 +476,16 @@ func TestDefParser_executeNext(t *testing.T) {
 			mStore := &MockStore{}
 			mStore.On("PatchDagIns", mock.Anything).Run(func(args mock.Arguments) {
 				calledPatch = true
-				assert.Equal(t, tc.wantPatchStatus, args.Get(0).(*entity.DagInstance).Status)
+				dagIns := args.Get(0).(*entity.DagInstance)
+				assert.Equal(t, tc.wantPatchStatus, dagIns.Status)
+				// the summary is only computed for the terminated dag instance
+				assert.Equal(t, tc.wantPatchStatus != entity.DagInstanceStatusBlocked, dagIns.Summary != nil)
 			}).Return(tc.givePatchErr)
 			mStore.On("ListTaskInstance", mock.Anything).Run(func(args mock.Arguments) {
 				calledList = true
 			}).Return([]*entity.TaskInstance{preTask}, tc.giveListErr)
+			mStore.On("GetDag", mock.Anything).Return(&entity.Dag{}, nil)
+			mStore.On("GetDagInstance", mock.Anything).Return(tc.giveDagIns, nil)
 			SetStore(mStore)
 
 			mExecutor := &MockExecutor{}
@@ -646,6 +707,41 @@ func TestDefParser_InitialDagIns(t *testing.T) {
 			},
 			wantPatchCalled: true,
 		},
+		{
+			caseDesc:   "map task",
+			giveParser: &DefParser{},
+			giveDagIns: &entity.DagInstance{
+				BaseInfo:  entity.BaseInfo{ID: "test-dag"},
+				ShareData: &entity.ShareData{Dict: map[string]string{"files": `["a","b"]`}},
+			},
+			giveTaskIns: []*entity.TaskInstance{
+				{BaseInfo: entity.BaseInfo{ID: "map-ins"}, TaskID: "map", Status: entity.TaskInstanceStatusInit,
+					Params:  map[string]interface{}{"file": "{{item}}"},
+					MapOver: &entity.MapOver{Source: entity.TaskConditionSourceShareData, Key: "files"}},
+				{BaseInfo: entity.BaseInfo{ID: "next-ins"}, TaskID: "next", Status: entity.TaskInstanceStatusInit, DependOn: []string{"map"}},
+			},
+			wantPushTasks: []*entity.TaskInstance{
+				{BaseInfo: entity.BaseInfo{ID: "map-ins-0"}, TaskID: "map[0]", Status: entity.TaskInstanceStatusInit,
+					Params: map[string]interface{}{"file": "a"}, MappedFrom: "map"},
+				{BaseInfo: entity.BaseInfo{ID: "map-ins-1"}, TaskID: "map[1]", Status: entity.TaskInstanceStatusInit,
+					Params: map[string]interface{}{"file": "b"}, MappedFrom: "map"},
+			},
+		},
+		{
+			caseDesc:   "resume map task",
+			giveParser: &DefParser{},
+			giveDagIns: &entity.DagInstance{BaseInfo: entity.BaseInfo{ID: "test-dag"}},
+			giveTaskIns: []*entity.TaskInstance{
+				{BaseInfo: entity.BaseInfo{ID: "map-ins"}, TaskID: "map", Status: entity.TaskInstanceStatusInit,
+					MapOver:  &entity.MapOver{Source: entity.TaskConditionSourceShareData, Key: "files"},
+					MapItems: []string{"a", "b"}},
+				{BaseInfo: entity.BaseInfo{ID: "map-ins-0"}, TaskID: "map[0]", Status: entity.TaskInstanceStatusInit, MappedFrom: "map"},
+				{BaseInfo: entity.BaseInfo{ID: "next-ins"}, TaskID: "next", Status: entity.TaskInstanceStatusInit, DependOn: []string{"map"}},
+			},
+			wantPushTasks: []*entity.TaskInstance{
+				{BaseInfo: entity.BaseInfo{ID: "map-ins-0"}, TaskID: "map[0]", Status: entity.TaskInstanceStatusInit, MappedFrom: "map"},
+			},
+		},
 		{
 			caseDesc:   "list failed",
 			giveParser: &DefParser{},
@@ -682,10 +778,16 @@ func TestDefParser_InitialDagIns(t *testing.T) {
 				patchCalled = true
 				assert.Equal(t, tc.wantPatchDagIns, args.Get(0))
 			}).Return(nil)
+			mStore.On("PatchTaskIns", mock.Anything).Return(nil)
+			mStore.On("BatchCreatTaskIns", mock.Anything).Return(nil)
+			// the status is computed by walking the tree since the end task is not found
+			mStore.On("GetTaskIns", mock.Anything).Return(nil, fmt.Errorf("not found"))
+			// the dag has no hooks
+			mStore.On("GetDag", mock.Anything).Return(&entity.Dag{}, nil)
 			SetStore(mStore)
 
 			mLog := &log.MockLogger{}
-			mLog.On("Errorf", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			mLog.On("Error", mock.Anything, utils.LogKeyDagInsID, tc.giveDagIns.ID).Run(func(args mock.Arguments) {
 				errorCalled = true
 			})
 			log.SetLogger(mLog)
@@ -705,6 +807,7 @@ func TestDefParser_InitialDagIns(t *testing.T) {
 			assert.Equal(t, tc.wantPatchCalled, patchCalled)
 		})
 	}
+	log.SetLogger(&log.StdoutLogger{})
 }
 
 func TestDefParser_WatchScheduledDagIns(t *testing.T) {
@@ -728,8 +831,9 @@ func TestDefParser_WatchScheduledDagIns(t *testing.T) {
 				},
 			},
 			wantListInput: &ListDagInstanceInput{
-				Worker: "test",
-				Status: []entity.DagInstanceStatus{entity.DagInstanceStatusScheduled},
+				Worker:         "test",
+				Status:         []entity.DagInstanceStatus{entity.DagInstanceStatusScheduled},
+				SortByPriority: true,
 			},
 			wantGetDagInsCalled: true,
 		},
@@ -744,8 +848,9 @@ func TestDefParser_WatchScheduledDagIns(t *testing.T) {
 			giveListErr: fmt.Errorf("list failed"),
 			wantErr:     fmt.Errorf("watch scheduled dag ins failed: %w", fmt.Errorf("list failed")),
 			wantListInput: &ListDagInstanceInput{
-				Worker: "test",
-				Status: []entity.DagInstanceStatus{entity.DagInstanceStatusScheduled},
+				Worker:         "test",
+				Status:         []entity.DagInstanceStatus{entity.DagInstanceStatusScheduled},
+				SortByPriority: true,
 			},
 		},
 		{
@@ -759,8 +864,9 @@ func TestDefParser_WatchScheduledDagIns(t *testing.T) {
 			giveGetErr: fmt.Errorf("get failed"),
 			wantErr:    fmt.Errorf("watch scheduled dag ins failed: %w", fmt.Errorf("get failed")),
 			wantListInput: &ListDagInstanceInput{
-				Worker: "test",
-				Status: []entity.DagInstanceStatus{entity.DagInstanceStatusScheduled},
+				Worker:         "test",
+				Status:         []entity.DagInstanceStatus{entity.DagInstanceStatusScheduled},
+				SortByPriority: true,
 			},
 			wantGetCalled: true,
 		},
@@ -1151,7 +1257,7 @@ func TestDefParser_ParseCmd(t *testing.T) {
 			giveTask: []*entity.TaskInstance{
 				{Status: entity.TaskInstanceStatusFailed, Reason: "failed reason"},
 			},
-			wantListCallCnt:      2,
+			wantListCallCnt:      3,
 			wantUpdateTask:       &entity.TaskInstance{Status: entity.TaskInstanceStatusRetrying},
 			wantUpdateTaskCalled: true,
 			wantUpdateDagIns:     &entity.DagInstance{Status: entity.DagInstanceStatusRunning},
@@ -1166,7 +1272,7 @@ func TestDefParser_ParseCmd(t *testing.T) {
 			giveTask: []*entity.TaskInstance{
 				{Status: entity.TaskInstanceStatusCanceled, Reason: "canceled reason"},
 			},
-			wantListCallCnt:      2,
+			wantListCallCnt:      3,
 			wantUpdateTask:       &entity.TaskInstance{Status: entity.TaskInstanceStatusRetrying},
 			wantUpdateTaskCalled: true,
 			wantUpdateDagIns:     &entity.DagInstance{Status: entity.DagInstanceStatusRunning},
@@ -1216,7 +1322,7 @@ func TestDefParser_ParseCmd(t *testing.T) {
 			giveTask: []*entity.TaskInstance{
 				{Status: entity.TaskInstanceStatusBlocked},
 			},
-			wantListCallCnt:      2,
+			wantListCallCnt:      3,
 			wantUpdateTask:       &entity.TaskInstance{Status: entity.TaskInstanceStatusContinue},
 			wantUpdateTaskCalled: true,
 			wantUpdateDagIns:     &entity.DagInstance{Status: entity.DagInstanceStatusRunning},
@@ -1244,7 +1350,7 @@ func TestDefParser_ParseCmd(t *testing.T) {
 			mStore.On("ListTaskInstance", mock.Anything).Run(func(args mock.Arguments) {
 				listTaskCallCnt++
 				if listTaskCallCnt == 1 {
-					status := []entity.TaskInstanceStatus{entity.TaskInstanceStatusFailed, entity.TaskInstanceStatusCanceled}
+					status := []entity.TaskInstanceStatus{entity.TaskInstanceStatusFailed, entity.TaskInstanceStatusInvalidParams, entity.TaskInstanceStatusCanceled}
 					if tc.giveDagIns.Cmd.Name == entity.CommandNameContinue {
 						status = []entity.TaskInstanceStatus{entity.TaskInstanceStatusBlocked}
 					}
@@ -1289,6 +1395,155 @@ func TestDefParser_ParseCmd(t *testing.T) {
 	}
 }
 
+func TestDefParser_ParseCancelDagInsCmd(t *testing.T) {
+	dagIns := &entity.DagInstance{
+		BaseInfo: entity.BaseInfo{ID: "dag-ins"},
+		DagID:    "dag",
+		Status:   entity.DagInstanceStatusRunning,
+		Cmd:      &entity.Command{Name: entity.CommandNameCancelDagIns, Reason: DagTimeoutReason},
+	}
+	tasks := []*entity.TaskInstance{
+		{BaseInfo: entity.BaseInfo{ID: "task1"}, TaskID: "task1", Status: entity.TaskInstanceStatusRunning},
+		{BaseInfo: entity.BaseInfo{ID: "task2"}, TaskID: "task2", Status: entity.TaskInstanceStatusInit, DependOn: []string{"task1"}},
+	}
+
+	var patchedTasks []string
+	var patchedDags []*entity.DagInstance
+	mStore := &MockStore{}
+	mStore.On("ListTaskInstance", mock.Anything).Return(tasks, nil)
+	mStore.On("PatchTaskIns", mock.Anything).Run(func(args mock.Arguments) {
+		taskIns := args.Get(0).(*entity.TaskInstance)
+		assert.Equal(t, entity.TaskInstanceStatusCanceled, taskIns.Status)
+		assert.Equal(t, DagTimeoutReason, taskIns.Reason)
+		patchedTasks = append(patchedTasks, taskIns.ID)
+	}).Return(nil)
+	mStore.On("PatchDagIns", mock.Anything, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		patchedDags = append(patchedDags, args.Get(0).(*entity.DagInstance))
+	}).Return(nil)
+	mStore.On("GetDag", "dag").Return(&entity.Dag{Hooks: &entity.DagHooks{
+		OnCancel: []entity.Task{{ID: "cleanup", ActionName: "act"}},
+	}}, nil)
+	mStore.On("BatchCreatTaskIns", mock.Anything).Return(nil)
+	SetStore(mStore)
+
+	var canceled []string
+	var pushed []string
+	mExecutor := &MockExecutor{}
+	mExecutor.On("CancelTaskIns", mock.Anything).Run(func(args mock.Arguments) {
+		canceled = args.Get(0).([]string)
+	}).Return(nil)
+	mExecutor.On("Push", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		taskIns := args.Get(1).(*entity.TaskInstance)
+		assert.Equal(t, entity.DagHookCancel, taskIns.Hook)
+		pushed = append(pushed, taskIns.TaskID)
+	})
+	SetExecutor(mExecutor)
+
+	var completed []string
+	RegisterLifecycleHooks("test", &LifecycleHooks{
+		OnDagComplete: func(ctx context.Context, dagIns *entity.DagInstance) {
+			completed = append(completed, dagIns.ID)
+		},
+	})
+	defer UnregisterLifecycleHooks("test")
+
+	p := &DefParser{}
+	p.taskTrees.Store(dagIns.ID, &TaskTree{DagIns: dagIns})
+	assert.NoError(t, p.parseCmd(dagIns))
+
+	assert.Equal(t, []string{"task1"}, canceled)
+	assert.Equal(t, []string{"task1", "task2"}, patchedTasks)
+	assert.Equal(t, []string{"cleanup"}, pushed)
+	assert.Equal(t, []string{"dag-ins"}, completed)
+	_, ok := p.getTaskTree(dagIns.ID)
+	assert.False(t, ok)
+	if assert.Len(t, patchedDags, 2) {
+		assert.Equal(t, entity.DagInstanceStatusFailed, patchedDags[0].Status)
+		assert.Equal(t, DagTimeoutReason, patchedDags[0].Reason)
+		assert.NotNil(t, patchedDags[0].Summary)
+		// the command is cleared
+		assert.Nil(t, patchedDags[1].Cmd)
+		assert.Equal(t, entity.DagInstanceStatusFailed, patchedDags[1].Status)
+	}
+}
+
+func TestResetFromFailed(t *testing.T) {
+	tests := []struct {
+		caseDesc    string
+		giveTasks   []*entity.TaskInstance
+		giveTargets []string
+		wantChanged []string
+		wantStatus  map[string]entity.TaskInstanceStatus
+	}{
+		{
+			caseDesc: "downstream of failed",
+			giveTasks: []*entity.TaskInstance{
+				{BaseInfo: entity.BaseInfo{ID: "a"}, TaskID: "a", Status: entity.TaskInstanceStatusSuccess},
+				{BaseInfo: entity.BaseInfo{ID: "b"}, TaskID: "b", DependOn: []string{"a"}, Status: entity.TaskInstanceStatusFailed, Reason: "failed"},
+				{BaseInfo: entity.BaseInfo{ID: "c"}, TaskID: "c", DependOn: []string{"b"}, Status: entity.TaskInstanceStatusSkipped, BranchSkipped: true},
+				{BaseInfo: entity.BaseInfo{ID: "d"}, TaskID: "d", DependOn: []string{"c"}, Status: entity.TaskInstanceStatusInit},
+				{BaseInfo: entity.BaseInfo{ID: "e"}, TaskID: "e", DependOn: []string{"d", "a"}, Status: entity.TaskInstanceStatusCanceled},
+				{BaseInfo: entity.BaseInfo{ID: "f"}, TaskID: "f", DependOn: []string{"a"}, Status: entity.TaskInstanceStatusSuccess},
+			},
+			giveTargets: []string{"b", "e"},
+			wantChanged: []string{"b", "e", "c"},
+			wantStatus: map[string]entity.TaskInstanceStatus{
+				"a": entity.TaskInstanceStatusSuccess,
+				"b": entity.TaskInstanceStatusRetrying,
+				"c": entity.TaskInstanceStatusInit,
+				"d": entity.TaskInstanceStatusInit,
+				"e": entity.TaskInstanceStatusRetrying,
+				"f": entity.TaskInstanceStatusSuccess,
+			},
+		},
+		{
+			caseDesc: "downstream of mapped",
+			giveTasks: []*entity.TaskInstance{
+				{BaseInfo: entity.BaseInfo{ID: "m-0"}, TaskID: "m-0", MappedFrom: "m", Status: entity.TaskInstanceStatusSuccess},
+				{BaseInfo: entity.BaseInfo{ID: "m-1"}, TaskID: "m-1", MappedFrom: "m", Status: entity.TaskInstanceStatusFailed},
+				{BaseInfo: entity.BaseInfo{ID: "b"}, TaskID: "b", DependOn: []string{"m"}, Status: entity.TaskInstanceStatusCanceled},
+			},
+			giveTargets: []string{"m-1"},
+			wantChanged: []string{"m-1", "b"},
+			wantStatus: map[string]entity.TaskInstanceStatus{
+				"m-0": entity.TaskInstanceStatusSuccess,
+				"m-1": entity.TaskInstanceStatusRetrying,
+				"b":   entity.TaskInstanceStatusInit,
+			},
+		},
+		{
+			caseDesc: "target not failed",
+			giveTasks: []*entity.TaskInstance{
+				{BaseInfo: entity.BaseInfo{ID: "a"}, TaskID: "a", Status: entity.TaskInstanceStatusRunning},
+				{BaseInfo: entity.BaseInfo{ID: "b"}, TaskID: "b", DependOn: []string{"a"}, Status: entity.TaskInstanceStatusCanceled},
+			},
+			giveTargets: []string{"a"},
+			wantStatus: map[string]entity.TaskInstanceStatus{
+				"a": entity.TaskInstanceStatusRunning,
+				"b": entity.TaskInstanceStatusCanceled,
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			changed := resetFromFailed(tc.giveTasks, tc.giveTargets)
+			var changedIds []string
+			for _, c := range changed {
+				changedIds = append(changedIds, c.ID)
+				assert.Empty(t, c.Reason)
+				assert.False(t, c.BranchSkipped)
+			}
+			assert.Equal(t, tc.wantChanged, changedIds)
+			status := map[string]entity.TaskInstanceStatus{}
+			for _, task := range tc.giveTasks {
+				status[task.ID] = task.Status
+			}
+			assert.Equal(t, tc.wantStatus, status)
+		})
+	}
+}
+
 func TestDefParser(t *testing.T) {
 	pubDagIns := []*entity.DagInstance{
 		{},
@@ -1297,7 +1552,8 @@ func TestDefParser(t *testing.T) {
 		{Status: entity.TaskInstanceStatusInit},
 	}
 	wg := sync.WaitGroup{}
-	wg.Add(4)
+	// the task instances are listed for building tree and for pushing the executable ones
+	wg.Add(5)
 	mStore := &MockStore{}
 	mStore.On("ListDagInstance", mock.Anything).Run(func(args mock.Arguments) {
 		wg.Done()
@@ -1324,3 +1580,75 @@ func TestDefParser(t *testing.T) {
 	wg.Wait()
 	def.Close()
 }
+
+func TestWalkTaskInsByIDs(t *testing.T) {
+	var ids []string
+	for i := 0; i < defaultWalkPageSize+1; i++ {
+		ids = append(ids, fmt.Sprint(i))
+	}
+	mStore := &MockStore{}
+	var pageSizes []int
+	mStore.On("ListTaskInstance", mock.Anything).Return(func(input *ListTaskInstanceInput) []*entity.TaskInstance {
+		pageSizes = append(pageSizes, len(input.IDs))
+		var ret []*entity.TaskInstance
+		// the store returns in its own order and the missing ids are skipped
+		for i := len(input.IDs) - 1; i >= 0; i-- {
+			if input.IDs[i] != "1" {
+				ret = append(ret, &entity.TaskInstance{BaseInfo: entity.BaseInfo{ID: input.IDs[i]}})
+			}
+		}
+		return ret
+	}, nil)
+	SetStore(mStore)
+
+	var walked []string
+	assert.NoError(t, walkTaskInsByIDs(ids, func(t *entity.TaskInstance) {
+		walked = append(walked, t.ID)
+	}))
+	assert.Equal(t, []int{defaultWalkPageSize, 1}, pageSizes)
+	assert.Equal(t, append([]string{"0"}, ids[2:]...), walked)
+}
+
+func TestTerminalHook(t *testing.T) {
+	tests := []struct {
+		caseDesc    string
+		giveStatus  entity.DagInstanceStatus
+		giveTaskIns *entity.TaskInstance
+		wantHook    entity.DagHook
+	}{
+		{
+			caseDesc:    "success",
+			giveStatus:  entity.DagInstanceStatusSuccess,
+			giveTaskIns: &entity.TaskInstance{TaskID: TaskEndID, Status: entity.TaskInstanceStatusSuccess},
+			wantHook:    entity.DagHookSuccess,
+		},
+		{
+			caseDesc:    "failed",
+			giveStatus:  entity.DagInstanceStatusFailed,
+			giveTaskIns: &entity.TaskInstance{Status: entity.TaskInstanceStatusFailed},
+			wantHook:    entity.DagHookFailure,
+		},
+		{
+			caseDesc:    "canceled",
+			giveStatus:  entity.DagInstanceStatusFailed,
+			giveTaskIns: &entity.TaskInstance{Status: entity.TaskInstanceStatusCanceled},
+			wantHook:    entity.DagHookCancel,
+		},
+		{
+			caseDesc:   "failed when initial",
+			giveStatus: entity.DagInstanceStatusFailed,
+			wantHook:   entity.DagHookFailure,
+		},
+		{
+			caseDesc:    "blocked",
+			giveStatus:  entity.DagInstanceStatusBlocked,
+			giveTaskIns: &entity.TaskInstance{Status: entity.TaskInstanceStatusBlocked},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			hook := terminalHook(&entity.DagInstance{Status: tc.giveStatus}, tc.giveTaskIns)
+			assert.Equal(t, tc.wantHook, hook)
+		})
+	}
+}
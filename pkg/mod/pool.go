@@ -0,0 +1,70 @@
+package mod
+
+import (
+	"context"
+	"sync"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+)
+
+// resourcePools limit the count of running tasks in each pool on a worker
+type resourcePools struct {
+	mutex   sync.Mutex
+	running map[string]int
+	// released is closed and replaced when a slot is released, so the waiting tasks check again
+	released chan struct{}
+}
+
+func newResourcePools() *resourcePools {
+	return &resourcePools{
+		running:  map[string]int{},
+		released: make(chan struct{}),
+	}
+}
+
+// acquire block until a slot of pool is available, onQueued is called once before waiting
+func (p *resourcePools) acquire(ctx context.Context, pool *entity.TaskPool, onQueued func()) error {
+	queued := false
+	for {
+		p.mutex.Lock()
+		if p.running[pool.Name] < pool.Slots {
+			p.running[pool.Name]++
+			p.mutex.Unlock()
+			return nil
+		}
+		released := p.released
+		p.mutex.Unlock()
+
+		if !queued {
+			queued = true
+			onQueued()
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-released:
+		}
+	}
+}
+
+func (p *resourcePools) release(name string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.running[name]--
+	if p.running[name] <= 0 {
+		delete(p.running, name)
+	}
+	close(p.released)
+	p.released = make(chan struct{})
+}
+
+// usage return the count of running tasks in each pool
+func (p *resourcePools) usage() map[string]int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	ret := make(map[string]int, len(p.running))
+	for k, v := range p.running {
+		ret[k] = v
+	}
+	return ret
+}
@@ -0,0 +1,47 @@
+package mod
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResourcePools(t *testing.T) {
+	p := newResourcePools()
+	gpu := &entity.TaskPool{Name: "gpu", Slots: 2}
+	notQueued := func() { assert.Fail(t, "should not be queued") }
+	assert.NoError(t, p.acquire(context.Background(), gpu, notQueued))
+	assert.NoError(t, p.acquire(context.Background(), gpu, notQueued))
+	assert.NoError(t, p.acquire(context.Background(), &entity.TaskPool{Name: "cpu", Slots: 1}, notQueued))
+	assert.Equal(t, map[string]int{"gpu": 2, "cpu": 1}, p.usage())
+
+	// the full pool blocks until a slot is released
+	queued := 0
+	acquired := make(chan error)
+	go func() {
+		acquired <- p.acquire(context.Background(), gpu, func() { queued++ })
+	}()
+	select {
+	case <-acquired:
+		assert.Fail(t, "pool should be full")
+	case <-time.After(20 * time.Millisecond):
+	}
+	p.release("cpu")
+	select {
+	case <-acquired:
+		assert.Fail(t, "releasing other pool should not wake it up")
+	case <-time.After(20 * time.Millisecond):
+	}
+	p.release("gpu")
+	assert.NoError(t, <-acquired)
+	assert.Equal(t, 1, queued)
+	assert.Equal(t, map[string]int{"gpu": 2}, p.usage())
+
+	// waiting is stopped by context
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, p.acquire(ctx, gpu, func() {}))
+}
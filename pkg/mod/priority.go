@@ -0,0 +1,127 @@
+package mod
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+)
+
+// defPriorityAging is the waiting time which raises the effective priority of dag instance by 1,
+// so the low priority dag instances are not starved
+const defPriorityAging = 5 * time.Minute
+
+func priorityAging() time.Duration {
+	return secsOr(GetClusterConfig().PriorityAgingSecs, defPriorityAging)
+}
+
+// sortDagInsByPriority sort dag instances by effective priority in descending order, the earlier created one
+// goes first when they are the same
+func sortDagInsByPriority(dagIns []*entity.DagInstance, now time.Time) {
+	aging := priorityAging()
+	sort.SliceStable(dagIns, func(i, j int) bool {
+		pi, pj := dagIns[i].EffectivePriority(now, aging), dagIns[j].EffectivePriority(now, aging)
+		if pi != pj {
+			return pi > pj
+		}
+		return dagIns[i].CreatedAt < dagIns[j].CreatedAt
+	})
+}
+
+// QueuePosition is the position of dag instance in the queue of waiting dag instances
+type QueuePosition struct {
+	DagInsID string `json:"dagInsId"`
+	// Position starts from 1, it is 0 when the dag instance is not waiting
+	Position          int `json:"position"`
+	Total             int `json:"total"`
+	EffectivePriority int `json:"effectivePriority"`
+}
+
+// GetQueuePosition return the position of dag instance among the init and scheduled dag instances,
+// which are ordered by effective priority
+func GetQueuePosition(dagInsID string) (*QueuePosition, error) {
+	dagIns, err := GetStore().ListDagInstance(&ListDagInstanceInput{
+		Status:         []entity.DagInstanceStatus{entity.DagInstanceStatusInit, entity.DagInstanceStatusScheduled},
+		SortByPriority: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list waiting dag instances failed: %w", err)
+	}
+	now := time.Now()
+	sortDagInsByPriority(dagIns, now)
+
+	ret := &QueuePosition{DagInsID: dagInsID, Total: len(dagIns)}
+	for i := range dagIns {
+		if dagIns[i].ID == dagInsID {
+			ret.Position = i + 1
+			ret.EffectivePriority = dagIns[i].EffectivePriority(now, priorityAging())
+			break
+		}
+	}
+	return ret, nil
+}
+
+// taskQueue is the queue of task instances waiting for an idle executor worker,
+// the task instance of dag instance with higher effective priority is popped first
+type taskQueue struct {
+	mutex  sync.Mutex
+	items  []*queuedTask
+	closed bool
+	// pushed is closed and replaced when a task instance is pushed, so the idle workers check again
+	pushed chan struct{}
+}
+
+type queuedTask struct {
+	taskIns *entity.TaskInstance
+	dagIns  *entity.DagInstance
+}
+
+func newTaskQueue() *taskQueue {
+	return &taskQueue{pushed: make(chan struct{})}
+}
+
+func (q *taskQueue) push(dagIns *entity.DagInstance, taskIns *entity.TaskInstance) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.closed {
+		return
+	}
+	q.items = append(q.items, &queuedTask{taskIns: taskIns, dagIns: dagIns})
+	close(q.pushed)
+	q.pushed = make(chan struct{})
+}
+
+// pop return the task instance with highest effective priority, or the channel to wait for the next push
+// when the queue is empty, ok is false when the queue is closed and drained
+func (q *taskQueue) pop() (taskIns *entity.TaskInstance, wait <-chan struct{}, ok bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if len(q.items) == 0 {
+		return nil, q.pushed, !q.closed
+	}
+
+	// the order changes with aging, so it is found in each pop rather than kept in a heap
+	now, aging := time.Now(), priorityAging()
+	best := 0
+	for i := 1; i < len(q.items); i++ {
+		if q.items[i].dagIns.EffectivePriority(now, aging) > q.items[best].dagIns.EffectivePriority(now, aging) {
+			best = i
+		}
+	}
+	taskIns = q.items[best].taskIns
+	q.items = append(q.items[:best], q.items[best+1:]...)
+	return taskIns, nil, true
+}
+
+// close let the workers exit after the queue is drained
+func (q *taskQueue) close() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.closed {
+		return
+	}
+	q.closed = true
+	close(q.pushed)
+}
@@ -0,0 +1,85 @@
+package mod
+
+import (
+	"testing"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTaskQueue(t *testing.T) {
+	now := time.Now().Unix()
+	low := &entity.DagInstance{Priority: 0, BaseInfo: entity.BaseInfo{CreatedAt: now}}
+	high := &entity.DagInstance{Priority: 2, BaseInfo: entity.BaseInfo{CreatedAt: now}}
+	// it waited long enough to catch up the high priority
+	aged := &entity.DagInstance{Priority: 0, BaseInfo: entity.BaseInfo{CreatedAt: now - int64(3*defPriorityAging/time.Second)}}
+
+	q := newTaskQueue()
+	_, wait, ok := q.pop()
+	assert.True(t, ok)
+	q.push(low, &entity.TaskInstance{BaseInfo: entity.BaseInfo{ID: "low-1"}})
+	select {
+	case <-wait:
+	default:
+		assert.Fail(t, "push should wake up the waiting workers")
+	}
+	q.push(high, &entity.TaskInstance{BaseInfo: entity.BaseInfo{ID: "high"}})
+	q.push(low, &entity.TaskInstance{BaseInfo: entity.BaseInfo{ID: "low-2"}})
+	q.push(aged, &entity.TaskInstance{BaseInfo: entity.BaseInfo{ID: "aged"}})
+
+	var popped []string
+	for i := 0; i < 4; i++ {
+		taskIns, _, ok := q.pop()
+		assert.True(t, ok)
+		popped = append(popped, taskIns.ID)
+	}
+	assert.Equal(t, []string{"aged", "high", "low-1", "low-2"}, popped)
+
+	q.close()
+	_, _, ok = q.pop()
+	assert.False(t, ok)
+}
+
+func TestGetQueuePosition(t *testing.T) {
+	now := time.Now().Unix()
+	mStore := &MockStore{}
+	mStore.On("ListDagInstance", &ListDagInstanceInput{
+		Status:         []entity.DagInstanceStatus{entity.DagInstanceStatusInit, entity.DagInstanceStatusScheduled},
+		SortByPriority: true,
+	}).Return([]*entity.DagInstance{
+		{BaseInfo: entity.BaseInfo{ID: "high", CreatedAt: now}, Priority: 1},
+		{BaseInfo: entity.BaseInfo{ID: "old", CreatedAt: now - int64(2*defPriorityAging/time.Second)}},
+		{BaseInfo: entity.BaseInfo{ID: "new", CreatedAt: now}},
+	}, nil)
+	SetStore(mStore)
+
+	tests := []struct {
+		caseDesc string
+		giveID   string
+		want     *QueuePosition
+	}{
+		{
+			caseDesc: "aged",
+			giveID:   "old",
+			want:     &QueuePosition{DagInsID: "old", Position: 1, Total: 3, EffectivePriority: 2},
+		},
+		{
+			caseDesc: "lowest",
+			giveID:   "new",
+			want:     &QueuePosition{DagInsID: "new", Position: 3, Total: 3},
+		},
+		{
+			caseDesc: "not waiting",
+			giveID:   "running",
+			want:     &QueuePosition{DagInsID: "running", Total: 3},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			ret, err := GetQueuePosition(tc.giveID)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, ret)
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package mod
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var defRateLimiter RateLimiter
+
+// RateLimiter block until the task is allowed to run by its rate limit
+type RateLimiter interface {
+	// Wait return nil when there is a quota of key in current window, or the error of ctx when it is done
+	Wait(ctx context.Context, key string, limit int, window time.Duration) error
+}
+
+// SetRateLimiter
+func SetRateLimiter(l RateLimiter) {
+	defRateLimiter = l
+}
+
+// GetRateLimiter
+func GetRateLimiter() RateLimiter {
+	return defRateLimiter
+}
+
+// DefRateLimiter is a fixed window limiter, the counters are kept by RateLimitStore so that all workers
+// respect the limit together. The waiting tasks retry when next window begins.
+type DefRateLimiter struct {
+	store RateLimitStore
+}
+
+// NewDefRateLimiter nil store means the counters are kept in process, so the limit only applies to current worker
+func NewDefRateLimiter(st RateLimitStore) *DefRateLimiter {
+	if st == nil {
+		st = &localRateLimitCounters{counters: map[string]*localRateLimitCounter{}}
+	}
+	return &DefRateLimiter{store: st}
+}
+
+// Wait
+func (l *DefRateLimiter) Wait(ctx context.Context, key string, limit int, window time.Duration) error {
+	for {
+		now := time.Now()
+		start := now.Truncate(window)
+		cnt, err := l.store.IncrRateLimitCounter(key, start, window)
+		if err != nil {
+			return fmt.Errorf("increase rate limit counter failed: %w", err)
+		}
+		if cnt <= limit {
+			return nil
+		}
+
+		timer := time.NewTimer(start.Add(window).Sub(now))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+type localRateLimitCounter struct {
+	count     int
+	expiredAt time.Time
+}
+
+type localRateLimitCounters struct {
+	counters map[string]*localRateLimitCounter
+	mutex    sync.Mutex
+}
+
+// IncrRateLimitCounter
+func (c *localRateLimitCounters) IncrRateLimitCounter(key string, windowStart time.Time, window time.Duration) (int, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := time.Now()
+	for k, counter := range c.counters {
+		if now.After(counter.expiredAt) {
+			delete(c.counters, k)
+		}
+	}
+	id := fmt.Sprintf("%s@%d", key, windowStart.UnixNano())
+	counter, ok := c.counters[id]
+	if !ok {
+		counter = &localRateLimitCounter{expiredAt: windowStart.Add(window)}
+		c.counters[id] = counter
+	}
+	counter.count++
+	return counter.count, nil
+}
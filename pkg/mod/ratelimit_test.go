@@ -0,0 +1,34 @@
+package mod
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefRateLimiter_Wait(t *testing.T) {
+	l := NewDefRateLimiter(nil)
+	window := 200 * time.Millisecond
+	// begin at the start of a window, so the allowed calls are not split into two windows
+	time.Sleep(time.Until(time.Now().Truncate(window).Add(window)))
+
+	begin := time.Now()
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, l.Wait(context.Background(), "key", 2, window))
+	}
+	assert.Less(t, int64(time.Since(begin)), int64(window/2))
+	// other keys are not limited
+	assert.NoError(t, l.Wait(context.Background(), "other", 2, window))
+	assert.Less(t, int64(time.Since(begin)), int64(window/2))
+
+	// exceeded calls wait for next window
+	assert.NoError(t, l.Wait(context.Background(), "key", 2, window))
+	assert.GreaterOrEqual(t, int64(time.Since(begin)), int64(window/2))
+
+	ctx, cancel := context.WithTimeout(context.Background(), window/4)
+	defer cancel()
+	assert.NoError(t, l.Wait(ctx, "key", 2, window))
+	assert.Equal(t, context.DeadlineExceeded, l.Wait(ctx, "key", 2, window))
+}
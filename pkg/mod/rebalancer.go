@@ -0,0 +1,295 @@
+package mod
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/event"
+	"github.com/etherealiy/fastflow/pkg/log"
+	"github.com/etherealiy/fastflow/pkg/utils/data"
+	"github.com/shiningrush/goevent"
+)
+
+const (
+	// RebalancerNoteAuthor is the author of notes which explain why the dag instance is reassigned
+	RebalancerNoteAuthor = "rebalancer"
+)
+
+// DefRebalancer move the dag instances between workers when workers join or leave, at most "maxMoves"
+// dag instances are moved in each interval so the cluster is balanced gradually.
+//
+// The dag instances owned by the workers which left are always movable, the running ones are rescheduled
+// so that the new owner resumes them. The dag instances of alive workers are moved only when they are
+// not held by the parser, which means they are scheduled but not parsed yet, or blocked without command.
+//
+// The draining workers are never the targets, their queued dag instances, which are scheduled or blocked
+// without command, are moved to others, and the running ones are left to finish.
+//
+// A worker is unresponsive when it still heartbeats but its running dag instances have executable tasks
+// and no progress for "stallTimeout", these stalled dag instances are reassigned to other workers
+// with a note explaining why.
+type DefRebalancer struct {
+	interval     time.Duration
+	maxMoves     int
+	stallTimeout time.Duration
+
+	wg      sync.WaitGroup
+	closeCh chan struct{}
+}
+
+// NewDefRebalancer maxMoves <= 0 means disable rebalancing, and stallTimeout <= 0 means disable reassigning
+// the dag instances of unresponsive workers, they can be overridden by cluster config
+func NewDefRebalancer(interval time.Duration, maxMoves int, stallTimeout time.Duration) *DefRebalancer {
+	return &DefRebalancer{
+		interval:     interval,
+		maxMoves:     maxMoves,
+		stallTimeout: stallTimeout,
+		closeCh:      make(chan struct{}),
+	}
+}
+
+// Init
+func (r *DefRebalancer) Init() {
+	r.wg.Add(1)
+	go r.watch()
+}
+
+// Close
+func (r *DefRebalancer) Close() {
+	close(r.closeCh)
+	r.wg.Wait()
+}
+
+func (r *DefRebalancer) watch() {
+	defer r.wg.Done()
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.closeCh:
+			return
+		case <-ticker.C:
+			start := time.Now()
+			e := &event.RebalanceDagInsCompleted{}
+			moved, err := r.Do()
+			if err != nil {
+				log.Errorf("rebalance dag instances failed: %s", err)
+				e.Error = err
+			}
+			e.Moved = len(moved)
+			e.ElapsedMs = time.Now().Sub(start).Milliseconds()
+			goevent.Publish(e)
+		}
+	}
+}
+
+type rebalanceMove struct {
+	dagIns *entity.DagInstance
+	from   string
+	reason string
+	// note the reason to dag instance
+	note bool
+}
+
+// Do a round of rebalancing and return the moved dag instances
+func (r *DefRebalancer) Do() ([]*entity.DagInstance, error) {
+	cfg := GetClusterConfig()
+	maxMoves := intOr(cfg.RebalanceMaxMoves, r.maxMoves)
+	stallTimeout := secsOr(cfg.StallTimeoutSecs, r.stallTimeout)
+	if maxMoves <= 0 {
+		return nil, nil
+	}
+
+	nodes, err := GetKeeper().AliveNodes()
+	if err != nil {
+		return nil, err
+	}
+	if len(nodes) == 0 {
+		return nil, data.ErrNoAliveNodes
+	}
+	draining, err := drainingNodes()
+	if err != nil {
+		return nil, err
+	}
+	dagIns, err := GetStore().ListDagInstance(&ListDagInstanceInput{
+		Status: []entity.DagInstanceStatus{
+			entity.DagInstanceStatusScheduled,
+			entity.DagInstanceStatusRunning,
+			entity.DagInstanceStatusBlocked,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	load := map[string]int{}
+	for _, n := range nodes {
+		load[n] = 0
+	}
+	var orphans, running []*entity.DagInstance
+	candidates := map[string][]*entity.DagInstance{}
+	for _, d := range dagIns {
+		if _, ok := load[d.Worker]; !ok {
+			orphans = append(orphans, d)
+			continue
+		}
+		load[d.Worker]++
+		switch {
+		case d.Status == entity.DagInstanceStatusRunning:
+			running = append(running, d)
+		case d.Status == entity.DagInstanceStatusScheduled,
+			d.Status == entity.DagInstanceStatusBlocked && d.Cmd == nil:
+			candidates[d.Worker] = append(candidates[d.Worker], d)
+		}
+	}
+
+	unresponsive := map[string]bool{}
+	leastLoaded := func() string {
+		min := ""
+		for _, n := range nodes {
+			if !unresponsive[n] && !draining[n] && (min == "" || load[n] < load[min]) {
+				min = n
+			}
+		}
+		return min
+	}
+
+	var moves []rebalanceMove
+	moveTo := func(d *entity.DagInstance, target, reason string, note bool) {
+		from := d.Worker
+		if _, ok := load[from]; ok {
+			load[from]--
+		}
+		load[target]++
+		d.Worker = target
+		if d.Status == entity.DagInstanceStatusRunning {
+			d.Status = entity.DagInstanceStatusScheduled
+		}
+		moves = append(moves, rebalanceMove{dagIns: d, from: from, reason: reason, note: note})
+	}
+
+	for _, d := range orphans {
+		target := leastLoaded()
+		if len(moves) >= maxMoves || target == "" {
+			break
+		}
+		moveTo(d, target, fmt.Sprintf("worker[%s] is not alive", d.Worker), false)
+	}
+
+	for _, n := range nodes {
+		if !draining[n] {
+			continue
+		}
+		for len(candidates[n]) > 0 {
+			target := leastLoaded()
+			if len(moves) >= maxMoves || target == "" {
+				break
+			}
+			d := candidates[n][0]
+			candidates[n] = candidates[n][1:]
+			moveTo(d, target, fmt.Sprintf("worker[%s] is draining", n), false)
+		}
+	}
+
+	if stallTimeout > 0 {
+		stalled, err := r.stalledDagIns(running, stallTimeout)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range stalled {
+			unresponsive[d.Worker] = true
+		}
+		for _, d := range stalled {
+			target := leastLoaded()
+			if len(moves) >= maxMoves || target == "" {
+				break
+			}
+			moveTo(d, target, fmt.Sprintf("worker[%s] is unresponsive, dag instance has executable tasks but no progress for %s",
+				d.Worker, stallTimeout), true)
+		}
+	}
+
+	for len(moves) < maxMoves {
+		from := ""
+		for _, n := range nodes {
+			if len(candidates[n]) > 0 && (from == "" || load[n] > load[from]) {
+				from = n
+			}
+		}
+		if from == "" {
+			break
+		}
+		target := leastLoaded()
+		if target == "" || load[from]-load[target] <= 1 {
+			break
+		}
+		d := candidates[from][0]
+		candidates[from] = candidates[from][1:]
+		moveTo(d, target, fmt.Sprintf("worker[%s] is overloaded", from), false)
+	}
+
+	var moved []*entity.DagInstance
+	for _, m := range moves {
+		patch := &entity.DagInstance{
+			BaseInfo: entity.BaseInfo{ID: m.dagIns.ID},
+			Worker:   m.dagIns.Worker,
+			Status:   m.dagIns.Status,
+		}
+		if m.note {
+			if err := m.dagIns.AddNote(m.reason, RebalancerNoteAuthor); err != nil {
+				return moved, err
+			}
+			patch.Notes = m.dagIns.Notes
+		}
+		if err := GetStore().PatchDagIns(patch); err != nil {
+			return moved, fmt.Errorf("move dag instance[%s] to worker[%s] failed: %w", m.dagIns.ID, m.dagIns.Worker, err)
+		}
+		moved = append(moved, m.dagIns)
+		dagInsLog(m.dagIns.ID).Info("dag instance is moved by rebalancer",
+			"worker", m.dagIns.Worker,
+			"reason", m.reason)
+		goevent.Publish(&event.DagInstanceReassigned{
+			DagInsID:   m.dagIns.ID,
+			FromWorker: m.from,
+			ToWorker:   m.dagIns.Worker,
+			Reason:     m.reason,
+		})
+	}
+	return moved, nil
+}
+
+// stalledDagIns return the running dag instances which have executable tasks but no progress for stallTimeout
+func (r *DefRebalancer) stalledDagIns(running []*entity.DagInstance, stallTimeout time.Duration) ([]*entity.DagInstance, error) {
+	deadline := time.Now().Add(-stallTimeout).Unix()
+	var stalled []*entity.DagInstance
+	for _, d := range running {
+		if d.UpdatedAt > deadline {
+			continue
+		}
+		tasks, err := GetStore().ListTaskInstance(&ListTaskInstanceInput{DagInsID: d.ID})
+		if err != nil {
+			return nil, err
+		}
+		progressed := false
+		for _, t := range tasks {
+			if t.UpdatedAt > deadline {
+				progressed = true
+				break
+			}
+		}
+		if progressed || len(tasks) == 0 {
+			continue
+		}
+		root, err := BuildRootNode(MapTaskInsToGetter(tasks))
+		if err != nil {
+			dagInsLog(d.ID).Errorf("build task tree failed: %s", err)
+			continue
+		}
+		if len(root.GetExecutableTaskIds()) > 0 {
+			stalled = append(stalled, d)
+		}
+	}
+	return stalled, nil
+}
@@ -0,0 +1,221 @@
+package mod
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/utils/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestDefRebalancer_Do(t *testing.T) {
+	dagIns := func(id, worker string, status entity.DagInstanceStatus) *entity.DagInstance {
+		return &entity.DagInstance{BaseInfo: entity.BaseInfo{ID: id}, Worker: worker, Status: status}
+	}
+	tests := []struct {
+		caseDesc       string
+		giveMaxMoves   int
+		giveAliveNodes []string
+		giveAliveErr   error
+		giveDraining   []string
+		giveListRet    []*entity.DagInstance
+		giveListErr    error
+		givePatchErr   error
+		wantErr        error
+		wantPatched    []*entity.DagInstance
+	}{
+		{
+			caseDesc:       "move instances of left worker",
+			giveMaxMoves:   10,
+			giveAliveNodes: []string{"w1", "w2"},
+			giveListRet: []*entity.DagInstance{
+				dagIns("1", "w1", entity.DagInstanceStatusRunning),
+				dagIns("2", "w3", entity.DagInstanceStatusRunning),
+				dagIns("3", "w3", entity.DagInstanceStatusBlocked),
+			},
+			wantPatched: []*entity.DagInstance{
+				dagIns("2", "w2", entity.DagInstanceStatusScheduled),
+				dagIns("3", "w1", entity.DagInstanceStatusBlocked),
+			},
+		},
+		{
+			caseDesc:       "move movable instances to joined worker",
+			giveMaxMoves:   10,
+			giveAliveNodes: []string{"w1", "w2"},
+			giveListRet: []*entity.DagInstance{
+				dagIns("1", "w1", entity.DagInstanceStatusRunning),
+				dagIns("2", "w1", entity.DagInstanceStatusRunning),
+				dagIns("3", "w1", entity.DagInstanceStatusScheduled),
+				dagIns("4", "w1", entity.DagInstanceStatusBlocked),
+				dagIns("5", "w1", entity.DagInstanceStatusBlocked),
+			},
+			wantPatched: []*entity.DagInstance{
+				dagIns("3", "w2", entity.DagInstanceStatusScheduled),
+				dagIns("4", "w2", entity.DagInstanceStatusBlocked),
+			},
+		},
+		{
+			caseDesc:       "bounded moves",
+			giveMaxMoves:   1,
+			giveAliveNodes: []string{"w1", "w2"},
+			giveListRet: []*entity.DagInstance{
+				dagIns("1", "w3", entity.DagInstanceStatusScheduled),
+				dagIns("2", "w3", entity.DagInstanceStatusScheduled),
+			},
+			wantPatched: []*entity.DagInstance{
+				dagIns("1", "w1", entity.DagInstanceStatusScheduled),
+			},
+		},
+		{
+			caseDesc:       "skip running and commanded instances",
+			giveMaxMoves:   10,
+			giveAliveNodes: []string{"w1", "w2"},
+			giveListRet: []*entity.DagInstance{
+				dagIns("1", "w1", entity.DagInstanceStatusRunning),
+				dagIns("2", "w1", entity.DagInstanceStatusRunning),
+				{
+					BaseInfo: entity.BaseInfo{ID: "3"},
+					Worker:   "w1",
+					Status:   entity.DagInstanceStatusBlocked,
+					Cmd:      &entity.Command{Name: entity.CommandNameContinue},
+				},
+			},
+		},
+		{
+			caseDesc:       "move queued instances of draining worker",
+			giveMaxMoves:   10,
+			giveAliveNodes: []string{"w1", "w2"},
+			giveDraining:   []string{"w1"},
+			giveListRet: []*entity.DagInstance{
+				dagIns("1", "w1", entity.DagInstanceStatusRunning),
+				dagIns("2", "w1", entity.DagInstanceStatusScheduled),
+				dagIns("3", "w1", entity.DagInstanceStatusBlocked),
+				dagIns("4", "w2", entity.DagInstanceStatusScheduled),
+				dagIns("5", "w3", entity.DagInstanceStatusRunning),
+			},
+			wantPatched: []*entity.DagInstance{
+				dagIns("5", "w2", entity.DagInstanceStatusScheduled),
+				dagIns("2", "w2", entity.DagInstanceStatusScheduled),
+				dagIns("3", "w2", entity.DagInstanceStatusBlocked),
+			},
+		},
+		{
+			caseDesc:       "balanced",
+			giveMaxMoves:   10,
+			giveAliveNodes: []string{"w1", "w2"},
+			giveListRet: []*entity.DagInstance{
+				dagIns("1", "w1", entity.DagInstanceStatusScheduled),
+				dagIns("2", "w1", entity.DagInstanceStatusScheduled),
+				dagIns("3", "w2", entity.DagInstanceStatusScheduled),
+			},
+		},
+		{
+			caseDesc:     "get alive nodes failed",
+			giveMaxMoves: 10,
+			giveAliveErr: fmt.Errorf("get alive nodes failed"),
+			wantErr:      fmt.Errorf("get alive nodes failed"),
+		},
+		{
+			caseDesc:       "no alive node",
+			giveMaxMoves:   10,
+			giveAliveNodes: []string{},
+			wantErr:        data.ErrNoAliveNodes,
+		},
+		{
+			caseDesc:       "list failed",
+			giveMaxMoves:   10,
+			giveAliveNodes: []string{"w1"},
+			giveListErr:    fmt.Errorf("list failed"),
+			wantErr:        fmt.Errorf("list failed"),
+		},
+		{
+			caseDesc:       "patch failed",
+			giveMaxMoves:   10,
+			giveAliveNodes: []string{"w1"},
+			giveListRet: []*entity.DagInstance{
+				dagIns("1", "w2", entity.DagInstanceStatusRunning),
+			},
+			givePatchErr: fmt.Errorf("patch failed"),
+			wantErr:      fmt.Errorf("move dag instance[1] to worker[w1] failed: %w", fmt.Errorf("patch failed")),
+			wantPatched: []*entity.DagInstance{
+				dagIns("1", "w1", entity.DagInstanceStatusScheduled),
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			var patched []*entity.DagInstance
+			mStore := &MockStore{}
+			mStore.On("ListDagInstance", mock.Anything).Return(tc.giveListRet, tc.giveListErr)
+			mStore.On("PatchDagIns", mock.Anything).Run(func(args mock.Arguments) {
+				patched = append(patched, args.Get(0).(*entity.DagInstance))
+			}).Return(tc.givePatchErr)
+			SetStore(mStore)
+
+			mKeeper := &MockKeeper{}
+			mKeeper.On("AliveNodes").Return(tc.giveAliveNodes, tc.giveAliveErr)
+			SetKeeper(mKeeper)
+			if tc.giveDraining != nil {
+				SetKeeper(&drainingKeeper{MockKeeper: mKeeper, draining: tc.giveDraining})
+			}
+
+			_, err := NewDefRebalancer(time.Second, tc.giveMaxMoves, 0).Do()
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantPatched, patched)
+		})
+	}
+}
+
+func TestDefRebalancer_DoStalled(t *testing.T) {
+	old := time.Now().Add(-time.Hour).Unix()
+	giveDagIns := []*entity.DagInstance{
+		{BaseInfo: entity.BaseInfo{ID: "stalled", UpdatedAt: old}, Worker: "w1", Status: entity.DagInstanceStatusRunning},
+		{BaseInfo: entity.BaseInfo{ID: "progressed", UpdatedAt: old}, Worker: "w1", Status: entity.DagInstanceStatusRunning},
+		{BaseInfo: entity.BaseInfo{ID: "executing", UpdatedAt: old}, Worker: "w1", Status: entity.DagInstanceStatusRunning},
+		{BaseInfo: entity.BaseInfo{ID: "recent", UpdatedAt: time.Now().Unix()}, Worker: "w1", Status: entity.DagInstanceStatusRunning},
+	}
+	giveTasks := map[string][]*entity.TaskInstance{
+		"stalled": {
+			{BaseInfo: entity.BaseInfo{ID: "t1", UpdatedAt: old}, TaskID: "t1", Status: entity.TaskInstanceStatusSuccess},
+			{BaseInfo: entity.BaseInfo{ID: "t2", UpdatedAt: old}, TaskID: "t2", DependOn: []string{"t1"}, Status: entity.TaskInstanceStatusInit},
+		},
+		"progressed": {
+			{BaseInfo: entity.BaseInfo{ID: "t3", UpdatedAt: time.Now().Unix()}, TaskID: "t3", Status: entity.TaskInstanceStatusInit},
+		},
+		"executing": {
+			{BaseInfo: entity.BaseInfo{ID: "t4", UpdatedAt: old}, TaskID: "t4", Status: entity.TaskInstanceStatusRunning},
+		},
+	}
+
+	var patched []*entity.DagInstance
+	mStore := &MockStore{}
+	mStore.On("ListDagInstance", mock.Anything).Return(giveDagIns, nil)
+	mStore.On("ListTaskInstance", mock.Anything).Return(func(input *ListTaskInstanceInput) []*entity.TaskInstance {
+		return giveTasks[input.DagInsID]
+	}, nil)
+	mStore.On("PatchDagIns", mock.Anything).Run(func(args mock.Arguments) {
+		patched = append(patched, args.Get(0).(*entity.DagInstance))
+	}).Return(nil)
+	SetStore(mStore)
+
+	mKeeper := &MockKeeper{}
+	mKeeper.On("AliveNodes").Return([]string{"w1", "w2"}, nil)
+	SetKeeper(mKeeper)
+
+	moved, err := NewDefRebalancer(time.Second, 10, time.Minute).Do()
+	assert.NoError(t, err)
+	if assert.Len(t, patched, 1) {
+		assert.Equal(t, "stalled", patched[0].ID)
+		assert.Equal(t, "w2", patched[0].Worker)
+		assert.Equal(t, entity.DagInstanceStatusScheduled, patched[0].Status)
+		if assert.Len(t, patched[0].Notes, 1) {
+			assert.Equal(t, RebalancerNoteAuthor, patched[0].Notes[0].Author)
+			assert.Contains(t, patched[0].Notes[0].Content, "worker[w1] is unresponsive")
+		}
+	}
+	assert.Len(t, moved, 1)
+}
@@ -0,0 +1,86 @@
+package mod
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/etherealiy/fastflow/pkg/log"
+)
+
+var (
+	reloaders    []namedReloader
+	reloaderLock sync.Mutex
+)
+
+// Reloader is implemented by the components which can reload their config without restarting,
+// such as the store and keeper which reconnect with rotated credentials
+type Reloader interface {
+	Reload() error
+}
+
+// ReloaderFunc adapt a function to Reloader
+type ReloaderFunc func() error
+
+// Reload
+func (f ReloaderFunc) Reload() error {
+	return f()
+}
+
+type namedReloader struct {
+	name string
+	Reloader
+}
+
+// RegisterReloader register a component which is reloaded by "Reload", such as exporters and event emitters.
+// The store, keeper and secret resolver are reloaded without registering if they implement Reloader.
+func RegisterReloader(name string, r Reloader) {
+	reloaderLock.Lock()
+	defer reloaderLock.Unlock()
+	for i := range reloaders {
+		if reloaders[i].name == name {
+			reloaders[i].Reloader = r
+			return
+		}
+	}
+	reloaders = append(reloaders, namedReloader{name: name, Reloader: r})
+}
+
+// Reload the config of components, it is triggered by SIGHUP or management api.
+// A failed component does not stop others, it returns the names of reloaded components.
+func Reload() ([]string, error) {
+	reloaderLock.Lock()
+	defer reloaderLock.Unlock()
+
+	// store is reloaded before keeper because the keeper may be backed by store
+	var candidates []namedReloader
+	builtins := []struct {
+		name      string
+		component interface{}
+	}{
+		{"store", GetStore()},
+		{"keeper", GetKeeper()},
+		{"secret-resolver", GetSecretResolver()},
+	}
+	for _, b := range builtins {
+		if r, ok := b.component.(Reloader); ok {
+			candidates = append(candidates, namedReloader{name: b.name, Reloader: r})
+		}
+	}
+	candidates = append(candidates, reloaders...)
+
+	var reloaded, errs []string
+	for _, r := range candidates {
+		if err := r.Reload(); err != nil {
+			log.Errorf("reload %s failed: %s", r.name, err)
+			errs = append(errs, fmt.Sprintf("%s: %s", r.name, err))
+			continue
+		}
+		log.Infof("%s reloaded", r.name)
+		reloaded = append(reloaded, r.name)
+	}
+	if len(errs) > 0 {
+		return reloaded, fmt.Errorf("reload failed: %s", strings.Join(errs, "; "))
+	}
+	return reloaded, nil
+}
@@ -0,0 +1,88 @@
+package mod
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type reloadableMockStore struct {
+	*MockStore
+	err error
+}
+
+func (s *reloadableMockStore) Reload() error {
+	return s.err
+}
+
+func TestReload(t *testing.T) {
+	defer func() {
+		reloaders = nil
+	}()
+
+	tests := []struct {
+		caseDesc      string
+		giveStore     Store
+		giveReloaders map[string]error
+		wantReloaded  []string
+		wantErr       error
+	}{
+		{
+			caseDesc:      "normal",
+			giveStore:     &reloadableMockStore{MockStore: &MockStore{}},
+			giveReloaders: map[string]error{"exporter": nil},
+			wantReloaded:  []string{"store", "exporter"},
+		},
+		{
+			caseDesc:     "not reloadable",
+			giveStore:    &MockStore{},
+			wantReloaded: nil,
+		},
+		{
+			caseDesc:      "failed",
+			giveStore:     &reloadableMockStore{MockStore: &MockStore{}, err: fmt.Errorf("connect failed")},
+			giveReloaders: map[string]error{"exporter": nil},
+			wantReloaded:  []string{"exporter"},
+			wantErr:       fmt.Errorf("reload failed: store: connect failed"),
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			reloaders = nil
+			for name, err := range tc.giveReloaders {
+				err := err
+				RegisterReloader(name, ReloaderFunc(func() error {
+					return err
+				}))
+			}
+			SetStore(tc.giveStore)
+			SetKeeper(&MockKeeper{})
+
+			reloaded, err := Reload()
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantReloaded, reloaded)
+		})
+	}
+}
+
+func TestRegisterReloader(t *testing.T) {
+	defer func() {
+		reloaders = nil
+	}()
+	reloaders = nil
+
+	called := ""
+	RegisterReloader("exporter", ReloaderFunc(func() error {
+		called = "old"
+		return nil
+	}))
+	RegisterReloader("exporter", ReloaderFunc(func() error {
+		called = "new"
+		return nil
+	}))
+	assert.Len(t, reloaders, 1)
+	assert.NoError(t, reloaders[0].Reload())
+	assert.Equal(t, "new", called)
+}
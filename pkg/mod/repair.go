@@ -0,0 +1,161 @@
+package mod
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+)
+
+// the rules of repairing, each of them is applied to the dag instances which are not terminated
+const (
+	// RepairRuleDeadWorkerTask reset the running tasks owned by dead workers to init, so that they are executed
+	// again by the new owner. A worker which is restarting treats its previous process as dead.
+	RepairRuleDeadWorkerTask = "dead-worker-task"
+	// RepairRuleEndingTask fail the tasks which stay in ending longer than RepairOption.EndingTimeout,
+	// their actions are finished but the after hooks are never completed, so they cannot be executed again safely
+	RepairRuleEndingTask = "ending-task"
+	// RepairRuleTerminalDagIns end the running dag instances whose tasks are all terminal, they fail when
+	// any task failed or canceled, otherwise succeed
+	RepairRuleTerminalDagIns = "terminal-dag-instance"
+)
+
+// RepairOption
+type RepairOption struct {
+	// Worker only repair the dag instances owned by it, and treat it as dead because it is restarting,
+	// empty means repairing the whole cluster
+	Worker string
+	// EndingTimeout <= 0 means do not repair the ending tasks
+	EndingTimeout time.Duration
+}
+
+// RepairRecord describe a repair which is applied
+type RepairRecord struct {
+	Rule      string `json:"rule"`
+	DagInsID  string `json:"dagInsId"`
+	TaskInsID string `json:"taskInsId,omitempty"`
+	From      string `json:"from"`
+	To        string `json:"to"`
+}
+
+// Repair find the inconsistent states left by crashed workers and fix them by the repair rules,
+// it runs when worker starts and leader is elected, every repair is logged and returned
+func Repair(opt *RepairOption) ([]*RepairRecord, error) {
+	input := &ListDagInstanceInput{
+		Worker: opt.Worker,
+		Status: []entity.DagInstanceStatus{entity.DagInstanceStatusScheduled, entity.DagInstanceStatusRunning},
+	}
+	dagIns, err := GetStore().ListDagInstance(input)
+	if err != nil {
+		return nil, fmt.Errorf("list dag instances failed: %w", err)
+	}
+
+	aliveWorkers := map[string]bool{}
+	isAlive := func(worker string) (bool, error) {
+		if worker == opt.Worker {
+			return false, nil
+		}
+		if alive, ok := aliveWorkers[worker]; ok {
+			return alive, nil
+		}
+		alive, err := GetKeeper().IsAlive(worker)
+		if err != nil {
+			return false, fmt.Errorf("check worker[%s] alive failed: %w", worker, err)
+		}
+		aliveWorkers[worker] = alive
+		return alive, nil
+	}
+
+	var records []*RepairRecord
+	for _, d := range dagIns {
+		alive, err := isAlive(d.Worker)
+		if err != nil {
+			return records, err
+		}
+		ret, err := repairDagIns(d, alive, opt.EndingTimeout)
+		records = append(records, ret...)
+		if err != nil {
+			return records, err
+		}
+	}
+	return records, nil
+}
+
+func repairDagIns(dagIns *entity.DagInstance, workerAlive bool, endingTimeout time.Duration) ([]*RepairRecord, error) {
+	tasks, err := GetStore().ListTaskInstance(&ListTaskInstanceInput{DagInsID: dagIns.ID})
+	if err != nil {
+		return nil, fmt.Errorf("list task instances of dag instance[%s] failed: %w", dagIns.ID, err)
+	}
+
+	var records []*RepairRecord
+	repairTask := func(t *entity.TaskInstance, rule string, to entity.TaskInstanceStatus, reason string) error {
+		if err := GetStore().PatchTaskIns(&entity.TaskInstance{
+			BaseInfo: entity.BaseInfo{ID: t.ID},
+			Status:   to,
+			Reason:   reason,
+		}); err != nil {
+			return fmt.Errorf("patch task instance[%s] failed: %w", t.ID, err)
+		}
+		r := &RepairRecord{Rule: rule, DagInsID: dagIns.ID, TaskInsID: t.ID, From: string(t.Status), To: string(to)}
+		taskInsLog(t).Infof("repair task instance by rule %s: %s -> %s, reason: %s", rule, r.From, r.To, reason)
+		records = append(records, r)
+		t.Status = to
+		t.Reason = reason
+		return nil
+	}
+
+	for _, t := range tasks {
+		switch {
+		case (t.Status == entity.TaskInstanceStatusRunning || t.Status == entity.TaskInstanceStatusQueued) && !workerAlive:
+			reason := fmt.Sprintf("reset by repair because its worker[%s] is dead", dagIns.Worker)
+			if err := repairTask(t, RepairRuleDeadWorkerTask, entity.TaskInstanceStatusInit, reason); err != nil {
+				return records, err
+			}
+		case t.Status == entity.TaskInstanceStatusEnding && endingTimeout > 0 &&
+			time.Since(time.Unix(t.UpdatedAt, 0)) > endingTimeout:
+			reason := fmt.Sprintf("failed by repair because it is ending for more than %s", endingTimeout)
+			if err := repairTask(t, RepairRuleEndingTask, entity.TaskInstanceStatusFailed, reason); err != nil {
+				return records, err
+			}
+		}
+	}
+
+	if dagIns.Status != entity.DagInstanceStatusRunning || len(tasks) == 0 {
+		return records, nil
+	}
+	failedTask := ""
+	for _, t := range tasks {
+		// hook tasks of the previous runs do not decide the status of dag instance
+		if t.Hook != "" {
+			continue
+		}
+		switch t.Status {
+		case entity.TaskInstanceStatusSuccess, entity.TaskInstanceStatusSkipped:
+		case entity.TaskInstanceStatusFailed, entity.TaskInstanceStatusInvalidParams, entity.TaskInstanceStatusCanceled:
+			if failedTask == "" {
+				failedTask = t.TaskID
+			}
+		default:
+			return records, nil
+		}
+	}
+
+	from := dagIns.Status
+	if failedTask != "" {
+		dagIns.Fail(fmt.Sprintf("failed by repair because its tasks are terminal and task[%s] failed or canceled", failedTask))
+	} else {
+		dagIns.Success()
+	}
+	if err := GetStore().PatchDagIns(&entity.DagInstance{
+		BaseInfo:   entity.BaseInfo{ID: dagIns.ID},
+		Status:     dagIns.Status,
+		Reason:     dagIns.Reason,
+		Summary:    entity.NewDagInstanceSummary(dagIns, tasks, time.Now()),
+		DeadLetter: dagIns.DeadLetter,
+	}); err != nil {
+		return records, fmt.Errorf("patch dag instance[%s] failed: %w", dagIns.ID, err)
+	}
+	r := &RepairRecord{Rule: RepairRuleTerminalDagIns, DagInsID: dagIns.ID, From: string(from), To: string(dagIns.Status)}
+	dagInsLog(dagIns.ID).Infof("repair dag instance by rule %s: %s -> %s", RepairRuleTerminalDagIns, r.From, r.To)
+	return append(records, r), nil
+}
@@ -0,0 +1,101 @@
+package mod
+
+import (
+	"testing"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestRepair(t *testing.T) {
+	old := time.Now().Add(-time.Hour).Unix()
+	giveDagIns := []*entity.DagInstance{
+		{BaseInfo: entity.BaseInfo{ID: "dead"}, Worker: "w2", Status: entity.DagInstanceStatusRunning},
+		{BaseInfo: entity.BaseInfo{ID: "ending"}, Worker: "w1", Status: entity.DagInstanceStatusRunning},
+		{BaseInfo: entity.BaseInfo{ID: "success"}, Worker: "w1", Status: entity.DagInstanceStatusRunning},
+		{BaseInfo: entity.BaseInfo{ID: "healthy"}, Worker: "w1", Status: entity.DagInstanceStatusRunning},
+	}
+	giveTasks := map[string][]*entity.TaskInstance{
+		"dead": {
+			{BaseInfo: entity.BaseInfo{ID: "t1"}, TaskID: "t1", Status: entity.TaskInstanceStatusRunning},
+			{BaseInfo: entity.BaseInfo{ID: "t9"}, TaskID: "t9", Status: entity.TaskInstanceStatusQueued},
+		},
+		"ending": {
+			{BaseInfo: entity.BaseInfo{ID: "t2"}, TaskID: "t2", Status: entity.TaskInstanceStatusSuccess},
+			{BaseInfo: entity.BaseInfo{ID: "t3", UpdatedAt: old}, TaskID: "t3", Status: entity.TaskInstanceStatusEnding},
+		},
+		"success": {
+			{BaseInfo: entity.BaseInfo{ID: "t4"}, TaskID: "t4", Status: entity.TaskInstanceStatusSuccess},
+			{BaseInfo: entity.BaseInfo{ID: "t5"}, TaskID: "t5", Status: entity.TaskInstanceStatusSkipped},
+		},
+		"healthy": {
+			{BaseInfo: entity.BaseInfo{ID: "t6"}, TaskID: "t6", Status: entity.TaskInstanceStatusSuccess},
+			{BaseInfo: entity.BaseInfo{ID: "t7"}, TaskID: "t7", Status: entity.TaskInstanceStatusRunning},
+			{BaseInfo: entity.BaseInfo{ID: "t8", UpdatedAt: time.Now().Unix()}, TaskID: "t8", Status: entity.TaskInstanceStatusEnding},
+		},
+	}
+
+	tests := []struct {
+		caseDesc    string
+		giveOpt     *RepairOption
+		wantRecords []*RepairRecord
+	}{
+		{
+			caseDesc: "repair cluster",
+			giveOpt:  &RepairOption{EndingTimeout: time.Minute},
+			wantRecords: []*RepairRecord{
+				{Rule: RepairRuleDeadWorkerTask, DagInsID: "dead", TaskInsID: "t1", From: "running", To: "init"},
+				{Rule: RepairRuleDeadWorkerTask, DagInsID: "dead", TaskInsID: "t9", From: "queued", To: "init"},
+				{Rule: RepairRuleEndingTask, DagInsID: "ending", TaskInsID: "t3", From: "ending", To: "failed"},
+				{Rule: RepairRuleTerminalDagIns, DagInsID: "ending", From: "running", To: "failed"},
+				{Rule: RepairRuleTerminalDagIns, DagInsID: "success", From: "running", To: "success"},
+			},
+		},
+		{
+			caseDesc: "restarting worker",
+			giveOpt:  &RepairOption{Worker: "w1"},
+			wantRecords: []*RepairRecord{
+				{Rule: RepairRuleTerminalDagIns, DagInsID: "success", From: "running", To: "success"},
+				{Rule: RepairRuleDeadWorkerTask, DagInsID: "healthy", TaskInsID: "t7", From: "running", To: "init"},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			mStore := &MockStore{}
+			mStore.On("ListDagInstance", mock.Anything).Return(func(input *ListDagInstanceInput) []*entity.DagInstance {
+				var ret []*entity.DagInstance
+				for _, d := range giveDagIns {
+					if input.Worker == "" || input.Worker == d.Worker {
+						copied := *d
+						ret = append(ret, &copied)
+					}
+				}
+				return ret
+			}, nil)
+			mStore.On("ListTaskInstance", mock.Anything).Return(func(input *ListTaskInstanceInput) []*entity.TaskInstance {
+				var ret []*entity.TaskInstance
+				for _, t := range giveTasks[input.DagInsID] {
+					copied := *t
+					ret = append(ret, &copied)
+				}
+				return ret
+			}, nil)
+			mStore.On("PatchTaskIns", mock.Anything).Return(nil)
+			mStore.On("PatchDagIns", mock.Anything).Return(nil)
+			SetStore(mStore)
+
+			mKeeper := &MockKeeper{}
+			mKeeper.On("IsAlive", "w1").Return(true, nil)
+			mKeeper.On("IsAlive", "w2").Return(false, nil)
+			SetKeeper(mKeeper)
+
+			records, err := Repair(tc.giveOpt)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantRecords, records)
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package mod
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+)
+
+// AnnotationRerunBy is annotated to the failed dag instance after it is rerun, the value is the id of new dag instance,
+// so a failed run is rerun only once even though the dag is updated again
+const AnnotationRerunBy = "fastflow/rerun-by"
+
+// RerunFailedDagIns run the recent failed runs of dag again by its rerun policy, the new runs use the same vars,
+// labels and data interval as the failed ones. It returns the ids of new dag instances.
+func RerunFailedDagIns(dag *entity.Dag) ([]string, error) {
+	policy := dag.RerunPolicy
+	if policy == nil {
+		return nil, nil
+	}
+	input := &ListDagInstanceInput{
+		DagID:  dag.ID,
+		Status: []entity.DagInstanceStatus{entity.DagInstanceStatusFailed},
+	}
+	if policy.Within != "" {
+		within, err := time.ParseDuration(policy.Within)
+		if err != nil {
+			return nil, fmt.Errorf("rerun within %s is invalid: %w", policy.Within, err)
+		}
+		input.CreatedBegin = time.Now().Add(-within).Unix()
+	}
+	failed, err := GetStore().ListDagInstance(input)
+	if err != nil {
+		return nil, fmt.Errorf("list failed dag instances failed: %w", err)
+	}
+	sort.SliceStable(failed, func(i, j int) bool {
+		return failed[i].CreatedAt > failed[j].CreatedAt
+	})
+
+	limit := policy.Limit
+	if limit == 0 {
+		limit = 1
+	}
+	var ids []string
+	for _, dagIns := range failed {
+		if len(ids) == limit {
+			break
+		}
+		if dagIns.Annotations[AnnotationRerunBy] != "" {
+			continue
+		}
+		newIns, err := rerunDagIns(dagIns)
+		if err != nil {
+			return ids, err
+		}
+		dagInsLog(dagIns.ID).Infof("rerun failed dag instance of dag[%s] by dag instance[%s]", dag.ID, newIns.ID)
+		ids = append(ids, newIns.ID)
+	}
+	return ids, nil
+}
+
+func rerunDagIns(dagIns *entity.DagInstance) (*entity.DagInstance, error) {
+	vars := map[string]string{}
+	for k, v := range dagIns.Vars {
+		vars[k] = v.Value
+	}
+	ops := []RunDagOptSetter{
+		RunDagTrigger(entity.TriggerRerun, &entity.TriggerMeta{RerunDagInsID: dagIns.ID}),
+		RunDagLabels(dagIns.Labels),
+	}
+	// the runs created before logical date is introduced have no data interval
+	if dagIns.LogicalDate != 0 {
+		ops = append(ops,
+			RunDagLogicalDate(time.Unix(dagIns.LogicalDate, 0)),
+			RunDagDataInterval(time.Unix(dagIns.DataIntervalStart, 0), time.Unix(dagIns.DataIntervalEnd, 0)))
+	}
+	newIns, err := runDag(dagIns.DagID, vars, newRunDagOption(ops))
+	if err != nil {
+		return nil, fmt.Errorf("rerun dag instance[%s] failed: %w", dagIns.ID, err)
+	}
+
+	dagIns.Annotate(map[string]string{AnnotationRerunBy: newIns.ID})
+	if err := GetStore().PatchDagIns(&entity.DagInstance{
+		BaseInfo:    dagIns.BaseInfo,
+		Annotations: dagIns.Annotations,
+	}); err != nil {
+		return nil, fmt.Errorf("annotate rerun dag instance[%s] failed: %w", dagIns.ID, err)
+	}
+	return newIns, nil
+}
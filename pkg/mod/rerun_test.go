@@ -0,0 +1,102 @@
+package mod
+
+import (
+	"testing"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestRerunFailedDagIns(t *testing.T) {
+	dag := &entity.Dag{
+		BaseInfo: entity.BaseInfo{ID: "dag1"},
+		Status:   entity.DagStatusNormal,
+		Vars:     entity.DagVars{"region": {DefaultValue: "us"}},
+		Tasks:    []entity.Task{{ID: "t1", ActionName: "act"}},
+	}
+	failed := func() []*entity.DagInstance {
+		return []*entity.DagInstance{
+			{BaseInfo: entity.BaseInfo{ID: "ins1", CreatedAt: 1}, DagID: "dag1",
+				Vars: entity.DagInstanceVars{"region": {Value: "eu"}}},
+			{BaseInfo: entity.BaseInfo{ID: "ins3", CreatedAt: 3}, DagID: "dag1",
+				Annotations: map[string]string{AnnotationRerunBy: "ins4"}},
+			{BaseInfo: entity.BaseInfo{ID: "ins2", CreatedAt: 2}, DagID: "dag1",
+				Vars: entity.DagInstanceVars{"region": {Value: "ap"}}, Labels: map[string]string{"team": "infra"},
+				LogicalDate: 100, DataIntervalStart: 100, DataIntervalEnd: 200},
+		}
+	}
+
+	tests := []struct {
+		caseDesc      string
+		givePolicy    *entity.RerunPolicy
+		wantRerunOf   []string
+		wantVars      []string
+		wantNotListed bool
+	}{
+		{
+			caseDesc:      "disabled",
+			wantNotListed: true,
+		},
+		{
+			caseDesc:    "most recent failed run",
+			givePolicy:  &entity.RerunPolicy{},
+			wantRerunOf: []string{"ins2"},
+			wantVars:    []string{"ap"},
+		},
+		{
+			caseDesc:    "window of failed runs",
+			givePolicy:  &entity.RerunPolicy{Limit: 5, Within: "24h"},
+			wantRerunOf: []string{"ins2", "ins1"},
+			wantVars:    []string{"ap", "eu"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			var listed *ListDagInstanceInput
+			var created []*entity.DagInstance
+			var annotated []string
+			mStore := &MockStore{}
+			mStore.On("ListDagInstance", mock.Anything).Run(func(args mock.Arguments) {
+				listed = args.Get(0).(*ListDagInstanceInput)
+			}).Return(failed(), nil)
+			mStore.On("GetDag", "dag1").Return(dag, nil)
+			mStore.On("CreateDagIns", mock.Anything).Run(func(args mock.Arguments) {
+				dagIns := args.Get(0).(*entity.DagInstance)
+				dagIns.ID = "new-" + dagIns.TriggerMeta.RerunDagInsID
+				created = append(created, dagIns)
+			}).Return(nil)
+			mStore.On("PatchDagIns", mock.Anything).Run(func(args mock.Arguments) {
+				dagIns := args.Get(0).(*entity.DagInstance)
+				assert.Equal(t, "new-"+dagIns.ID, dagIns.Annotations[AnnotationRerunBy])
+				annotated = append(annotated, dagIns.ID)
+			}).Return(nil)
+			SetStore(mStore)
+
+			ids, err := RerunFailedDagIns(&entity.Dag{BaseInfo: dag.BaseInfo, RerunPolicy: tc.givePolicy})
+			assert.NoError(t, err)
+			if tc.wantNotListed {
+				assert.Nil(t, listed)
+				assert.Empty(t, ids)
+				return
+			}
+			assert.Equal(t, []entity.DagInstanceStatus{entity.DagInstanceStatusFailed}, listed.Status)
+			assert.Equal(t, tc.givePolicy.Within != "", listed.CreatedBegin > 0)
+			assert.Equal(t, tc.wantRerunOf, annotated)
+			var wantIds, vars []string
+			for i, id := range tc.wantRerunOf {
+				wantIds = append(wantIds, "new-"+id)
+				vars = append(vars, created[i].Vars["region"].Value)
+				assert.Equal(t, entity.TriggerRerun, created[i].Trigger)
+			}
+			assert.Equal(t, wantIds, ids)
+			assert.Equal(t, tc.wantVars, vars)
+			if created[0].TriggerMeta.RerunDagInsID == "ins2" {
+				assert.Equal(t, map[string]string{"team": "infra"}, created[0].Labels)
+				assert.Equal(t, []int64{100, 100, 200},
+					[]int64{created[0].LogicalDate, created[0].DataIntervalStart, created[0].DataIntervalEnd})
+			}
+		})
+	}
+}
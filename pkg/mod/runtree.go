@@ -0,0 +1,49 @@
+package mod
+
+import (
+	"github.com/etherealiy/fastflow/pkg/entity"
+)
+
+// RunTreeNode is a node of run tree, it contains the dag instance and its children
+type RunTreeNode struct {
+	DagIns   *entity.DagInstance `json:"dagIns"`
+	Children []*RunTreeNode      `json:"children,omitempty"`
+}
+
+// GetRunTree get the whole run tree which the dag instance belongs to, the returned node is the root
+func GetRunTree(dagInsId string) (*RunTreeNode, error) {
+	dagIns, err := GetStore().GetDagInstance(dagInsId)
+	if err != nil {
+		return nil, err
+	}
+	root := dagIns
+	if dagIns.RootDagInsID != "" {
+		root, err = GetStore().GetDagInstance(dagIns.RootDagInsID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	descendants, err := GetStore().ListDagInstance(&ListDagInstanceInput{RootDagInsID: root.ID})
+	if err != nil {
+		return nil, err
+	}
+	return BuildRunTree(root, descendants), nil
+}
+
+// BuildRunTree build run tree by parent id, the descendants whose parent is not found will be ignored
+func BuildRunTree(root *entity.DagInstance, descendants []*entity.DagInstance) *RunTreeNode {
+	rootNode := &RunTreeNode{DagIns: root}
+	nodes := map[string]*RunTreeNode{root.ID: rootNode}
+	for i := range descendants {
+		nodes[descendants[i].ID] = &RunTreeNode{DagIns: descendants[i]}
+	}
+	for i := range descendants {
+		parent, ok := nodes[descendants[i].ParentDagInsID]
+		if !ok || descendants[i].ID == root.ID {
+			continue
+		}
+		parent.Children = append(parent.Children, nodes[descendants[i].ID])
+	}
+	return rootNode
+}
@@ -0,0 +1,47 @@
+package mod
+
+import (
+	"testing"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildRunTree(t *testing.T) {
+	root := &entity.DagInstance{BaseInfo: entity.BaseInfo{ID: "root"}}
+	child1 := &entity.DagInstance{BaseInfo: entity.BaseInfo{ID: "child1"}, ParentDagInsID: "root", RootDagInsID: "root"}
+	child2 := &entity.DagInstance{BaseInfo: entity.BaseInfo{ID: "child2"}, ParentDagInsID: "root", RootDagInsID: "root"}
+	grandChild := &entity.DagInstance{BaseInfo: entity.BaseInfo{ID: "grand-child"}, ParentDagInsID: "child1", RootDagInsID: "root"}
+	orphan := &entity.DagInstance{BaseInfo: entity.BaseInfo{ID: "orphan"}, ParentDagInsID: "not-existed", RootDagInsID: "root"}
+
+	tests := []struct {
+		caseDesc        string
+		giveDescendants []*entity.DagInstance
+		wantTree        *RunTreeNode
+	}{
+		{
+			caseDesc: "only root",
+			wantTree: &RunTreeNode{DagIns: root},
+		},
+		{
+			caseDesc:        "nested",
+			giveDescendants: []*entity.DagInstance{grandChild, child1, child2, orphan},
+			wantTree: &RunTreeNode{
+				DagIns: root,
+				Children: []*RunTreeNode{
+					{
+						DagIns:   child1,
+						Children: []*RunTreeNode{{DagIns: grandChild}},
+					},
+					{DagIns: child2},
+				},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			assert.Equal(t, tc.wantTree, BuildRunTree(root, tc.giveDescendants))
+		})
+	}
+}
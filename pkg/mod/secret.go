@@ -0,0 +1,226 @@
+package mod
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/log"
+	"github.com/etherealiy/fastflow/pkg/utils/value"
+)
+
+const (
+	// SecretParamPrefix is the prefix of the task param which references a secret, such as "secret://db/prod#password"
+	SecretParamPrefix = entity.SecretRefPrefix
+	// DefaultEnvSecretPrefix is the prefix of the environment variables which can be resolved by EnvSecretResolver
+	DefaultEnvSecretPrefix = "FASTFLOW_SECRET_"
+)
+
+var defSecretResolver SecretResolver = &EnvSecretResolver{}
+
+// SecretResolver resolve the secret reference of task env when task running,
+// so the plaintext will not be persisted in store
+type SecretResolver interface {
+	Resolve(ref string) (string, error)
+}
+
+// SetSecretResolver
+func SetSecretResolver(r SecretResolver) {
+	defSecretResolver = r
+}
+
+// GetSecretResolver
+func GetSecretResolver() SecretResolver {
+	return defSecretResolver
+}
+
+// EnvSecretResolver resolve secret from the environment variables of worker, it is the default resolver.
+// Only the variables with the prefix can be resolved, so the users who submit dags cannot read
+// other variables of worker such as the credentials of store
+type EnvSecretResolver struct {
+	// Prefix is prepended to the name of variable, default is DefaultEnvSecretPrefix
+	Prefix string
+}
+
+// Resolve the ref as the name of environment variable after the prefix, the ref like "path#key" is converted to
+// upper case and non-alphanumeric characters are replaced by "_", such as "db/prod#password" to
+// "FASTFLOW_SECRET_DB_PROD_PASSWORD"
+func (r *EnvSecretResolver) Resolve(ref string) (string, error) {
+	if ref == "" {
+		return "", fmt.Errorf("secret ref cannot be empty")
+	}
+	name := ref
+	if strings.Contains(ref, "#") {
+		name = strings.Map(func(c rune) rune {
+			switch {
+			case c >= 'a' && c <= 'z':
+				return c - 'a' + 'A'
+			case c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+				return c
+			}
+			return '_'
+		}, ref)
+	}
+	prefix := r.Prefix
+	if prefix == "" {
+		prefix = DefaultEnvSecretPrefix
+	}
+	name = prefix + name
+	val, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s not found", name)
+	}
+	return val, nil
+}
+
+// VaultSecretResolver resolve the ref like "path#key" from the kv v2 secrets engine of HashiCorp Vault
+type VaultSecretResolver struct {
+	// Addr is the address of vault, such as "https://vault:8200"
+	Addr  string
+	Token string
+	// Mount is the mount path of kv engine, default is "secret"
+	Mount  string
+	Client *http.Client
+}
+
+// Resolve
+func (r *VaultSecretResolver) Resolve(ref string) (string, error) {
+	path, key, err := splitSecretRef(ref)
+	if err != nil {
+		return "", err
+	}
+	mount := r.Mount
+	if mount == "" {
+		mount = "secret"
+	}
+	client := r.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	u, err := url.Parse(strings.TrimRight(r.Addr, "/") + "/v1/" + strings.Trim(mount, "/") + "/data/" + path)
+	if err != nil {
+		return "", fmt.Errorf("vault address %q is invalid: %w", r.Addr, err)
+	}
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", r.Token)
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("read secret %s from vault failed: %w", path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("read secret %s from vault failed: status code %d", path, resp.StatusCode)
+	}
+
+	body := struct {
+		Data struct {
+			Data map[string]interface{} `json:"data"`
+		} `json:"data"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("decode secret %s from vault failed: %w", path, err)
+	}
+	val, ok := body.Data.Data[key]
+	if !ok {
+		return "", fmt.Errorf("key %s of secret %s not found", key, path)
+	}
+	if str, ok := val.(string); ok {
+		return str, nil
+	}
+	return fmt.Sprint(val), nil
+}
+
+func splitSecretRef(ref string) (path, key string, err error) {
+	idx := strings.LastIndex(ref, "#")
+	if idx <= 0 || idx == len(ref)-1 {
+		return "", "", fmt.Errorf("secret ref %q is invalid, it should be like \"path#key\"", ref)
+	}
+	return strings.Trim(ref[:idx], "/"), ref[idx+1:], nil
+}
+
+// resolveSecret resolve the ref by secret resolver and register the value to be redacted with the dag instance
+func resolveSecret(dagInsID, ref string) (string, error) {
+	if GetSecretResolver() == nil {
+		return "", fmt.Errorf("no secret resolver")
+	}
+	val, err := GetSecretResolver().Resolve(ref)
+	if err != nil {
+		return "", err
+	}
+	log.RegisterSecret(dagInsID, val)
+	return val, nil
+}
+
+// ResolveSecretParams return a copy of params whose "secret://path#key" values are replaced by the secrets,
+// the params themselves keep the references, so the plaintext will not be persisted
+func ResolveSecretParams(dagInsID string, params map[string]interface{}) (map[string]interface{}, error) {
+	ret, ok := copyParamValue(params).(map[string]interface{})
+	if !ok || ret == nil {
+		return params, nil
+	}
+	err := value.MapValue(ret).WalkString(func(walkContext *value.WalkContext, v string) error {
+		if !strings.HasPrefix(v, SecretParamPrefix) {
+			return nil
+		}
+		val, err := resolveSecret(dagInsID, strings.TrimPrefix(v, SecretParamPrefix))
+		if err != nil {
+			return fmt.Errorf("resolve secret of param %s failed: %w", walkContext.Path(), err)
+		}
+		walkContext.Setter(val)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func copyParamValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		if val == nil {
+			return val
+		}
+		ret := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			ret[k] = copyParamValue(item)
+		}
+		return ret
+	case []interface{}:
+		ret := make([]interface{}, len(val))
+		for i, item := range val {
+			ret[i] = copyParamValue(item)
+		}
+		return ret
+	}
+	return v
+}
+
+// ResolveTaskEnv resolve the env vars of task instance to key-value
+func ResolveTaskEnv(taskIns *entity.TaskInstance) (map[string]string, error) {
+	ret := map[string]string{}
+	for _, env := range taskIns.Env {
+		if env.Name == "" {
+			return nil, fmt.Errorf("env name cannot be empty")
+		}
+		if env.SecretRef == "" {
+			ret[env.Name] = env.Value
+			continue
+		}
+		val, err := resolveSecret(taskIns.DagInsID, env.SecretRef)
+		if err != nil {
+			return nil, fmt.Errorf("resolve secret of env %s failed: %w", env.Name, err)
+		}
+		ret[env.Name] = val
+	}
+	return ret, nil
+}
@@ -0,0 +1,194 @@
+package mod
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveTaskEnv(t *testing.T) {
+	os.Setenv("FASTFLOW_SECRET_TEST", "s3cret")
+	defer os.Unsetenv("FASTFLOW_SECRET_TEST")
+	os.Setenv("FASTFLOW_TEST_NOT_SECRET", "s3cret")
+	defer os.Unsetenv("FASTFLOW_TEST_NOT_SECRET")
+
+	tests := []struct {
+		caseDesc string
+		giveEnv  []entity.EnvVar
+		wantEnv  map[string]string
+		wantErr  bool
+	}{
+		{
+			caseDesc: "empty",
+			wantEnv:  map[string]string{},
+		},
+		{
+			caseDesc: "value and secret",
+			giveEnv: []entity.EnvVar{
+				{Name: "A", Value: "1"},
+				{Name: "TOKEN", SecretRef: "TEST"},
+			},
+			wantEnv: map[string]string{"A": "1", "TOKEN": "s3cret"},
+		},
+		{
+			caseDesc: "secret not found",
+			giveEnv: []entity.EnvVar{
+				{Name: "TOKEN", SecretRef: "NOT_EXISTED"},
+			},
+			wantErr: true,
+		},
+		{
+			caseDesc: "variable without prefix",
+			giveEnv: []entity.EnvVar{
+				{Name: "TOKEN", SecretRef: "FASTFLOW_TEST_NOT_SECRET"},
+			},
+			wantErr: true,
+		},
+		{
+			caseDesc: "empty name",
+			giveEnv:  []entity.EnvVar{{Value: "1"}},
+			wantErr:  true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			ret, err := ResolveTaskEnv(&entity.TaskInstance{Env: tc.giveEnv})
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantEnv, ret)
+		})
+	}
+}
+
+func TestResolveSecretParams(t *testing.T) {
+	os.Setenv("FASTFLOW_SECRET_DB_PROD_PASSWORD", "p@ssw0rd")
+	defer os.Unsetenv("FASTFLOW_SECRET_DB_PROD_PASSWORD")
+
+	tests := []struct {
+		caseDesc   string
+		giveParams map[string]interface{}
+		wantParams map[string]interface{}
+		wantErr    bool
+	}{
+		{
+			caseDesc: "empty",
+		},
+		{
+			caseDesc: "nested",
+			giveParams: map[string]interface{}{
+				"user": "admin",
+				"db": map[string]interface{}{
+					"password": "secret://db/prod#password",
+					"hosts":    []interface{}{"a", "secret://db/prod#password"},
+				},
+			},
+			wantParams: map[string]interface{}{
+				"user": "admin",
+				"db": map[string]interface{}{
+					"password": "p@ssw0rd",
+					"hosts":    []interface{}{"a", "p@ssw0rd"},
+				},
+			},
+		},
+		{
+			caseDesc:   "not found",
+			giveParams: map[string]interface{}{"password": "secret://db/test#password"},
+			wantErr:    true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			before := fmt.Sprint(tc.giveParams)
+			ret, err := ResolveSecretParams("dag-ins1", tc.giveParams)
+			// the references must be kept in origin params
+			assert.Equal(t, before, fmt.Sprint(tc.giveParams))
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantParams, ret)
+		})
+	}
+	assert.Equal(t, "password is "+log.Redacted, log.Redact("password is p@ssw0rd"))
+	log.ForgetSecrets("dag-ins1")
+	assert.Equal(t, "password is p@ssw0rd", log.Redact("password is p@ssw0rd"))
+}
+
+func TestVaultSecretResolver_Resolve(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "tk" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if r.URL.Path != "/v1/kv/data/db/prod" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"data":{"data":{"password":"p@ss","port":3306}}}`))
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		caseDesc  string
+		giveToken string
+		giveRef   string
+		wantVal   string
+		wantErr   bool
+	}{
+		{
+			caseDesc:  "normal",
+			giveToken: "tk",
+			giveRef:   "db/prod#password",
+			wantVal:   "p@ss",
+		},
+		{
+			caseDesc:  "not string",
+			giveToken: "tk",
+			giveRef:   "/db/prod/#port",
+			wantVal:   "3306",
+		},
+		{
+			caseDesc:  "key not found",
+			giveToken: "tk",
+			giveRef:   "db/prod#user",
+			wantErr:   true,
+		},
+		{
+			caseDesc:  "forbidden",
+			giveToken: "wrong",
+			giveRef:   "db/prod#password",
+			wantErr:   true,
+		},
+		{
+			caseDesc:  "no key",
+			giveToken: "tk",
+			giveRef:   "db/prod",
+			wantErr:   true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			r := &VaultSecretResolver{Addr: srv.URL, Token: tc.giveToken, Mount: "kv"}
+			val, err := r.Resolve(tc.giveRef)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantVal, val)
+		})
+	}
+}
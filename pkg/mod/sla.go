@@ -0,0 +1,126 @@
+package mod
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/event"
+	"github.com/shiningrush/goevent"
+)
+
+// unfinishedDagInsStatus is the status of dag instances which can miss SLAs, a finished dag instance has met
+// its SLAs or failed already
+var unfinishedDagInsStatus = []entity.DagInstanceStatus{
+	entity.DagInstanceStatusInit,
+	entity.DagInstanceStatusScheduled,
+	entity.DagInstanceStatusRunning,
+	entity.DagInstanceStatusBlocked,
+}
+
+// CheckSLAs check the SLAs whose deadlines are up to now of unfinished dag instances, the SLA of dag is missed
+// since the dag instance is unfinished, the SLA of task is missed unless all its task instances succeeded or
+// were skipped. The missed SLAs are recorded in dag instance and published as event.SLAMissed, each SLA is
+// checked only once. It works from the store, so it should only run on leader.
+func CheckSLAs(now time.Time) ([]*event.SLAMissed, error) {
+	dagIns, err := GetStore().ListDagInstance(&ListDagInstanceInput{
+		Status:         unfinishedDagInsStatus,
+		SLADeadlineEnd: now.Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []*event.SLAMissed
+	for _, d := range dagIns {
+		missed, err := checkDagInsSLAs(d, now)
+		if err != nil {
+			return ret, fmt.Errorf("check slas of dag instance[%s] failed: %w", d.ID, err)
+		}
+		ret = append(ret, missed...)
+	}
+	return ret, nil
+}
+
+func checkDagInsSLAs(dagIns *entity.DagInstance, now time.Time) ([]*event.SLAMissed, error) {
+	var succeeded map[string]bool
+	slas := make([]entity.SLA, len(dagIns.SLAs))
+	copy(slas, dagIns.SLAs)
+	var missed []*event.SLAMissed
+	for i := range slas {
+		sla := &slas[i]
+		// the SLAs before SLADeadline have been checked
+		if sla.MissedAt != 0 || sla.Deadline < dagIns.SLADeadline || sla.Deadline > now.Unix() {
+			continue
+		}
+		if sla.TaskID != "" {
+			if succeeded == nil {
+				var err error
+				if succeeded, err = succeededTasks(dagIns.ID); err != nil {
+					return nil, err
+				}
+			}
+			if succeeded[sla.TaskID] {
+				continue
+			}
+		}
+		sla.MissedAt = now.Unix()
+		missed = append(missed, &event.SLAMissed{SLA: *sla})
+	}
+
+	patch := &entity.DagInstance{
+		BaseInfo:    entity.BaseInfo{ID: dagIns.ID},
+		SLAs:        slas,
+		SLADeadline: entity.NextSLADeadline(slas, now.Unix()),
+	}
+	if len(missed) > 0 && dagIns.SLAMissedAt == 0 {
+		patch.SLAMissedAt = now.Unix()
+	}
+	if err := GetStore().PatchDagIns(patch, "SLADeadline"); err != nil {
+		return nil, fmt.Errorf("patch slas failed: %w", err)
+	}
+	dagIns.SLAs, dagIns.SLADeadline = patch.SLAs, patch.SLADeadline
+	if patch.SLAMissedAt != 0 {
+		dagIns.SLAMissedAt = patch.SLAMissedAt
+	}
+
+	for _, m := range missed {
+		m.DagIns = dagIns
+		if m.SLA.TaskID == "" {
+			dagInsLog(dagIns.ID).Warnf("dag[%s] missed sla at %s", dagIns.DagID, time.Unix(m.SLA.Deadline, 0))
+		} else {
+			dagInsLog(dagIns.ID).Warnf("task[%s] missed sla at %s", m.SLA.TaskID, time.Unix(m.SLA.Deadline, 0))
+		}
+		goevent.Publish(m)
+	}
+	return missed, nil
+}
+
+// succeededTasks return the tasks whose task instances all succeeded or were skipped
+func succeededTasks(dagInsID string) (map[string]bool, error) {
+	tasks, err := GetStore().ListTaskInstance(&ListTaskInstanceInput{DagInsID: dagInsID})
+	if err != nil {
+		return nil, fmt.Errorf("list task instances failed: %w", err)
+	}
+	ret := map[string]bool{}
+	for _, t := range tasks {
+		if t.Hook != "" {
+			continue
+		}
+		done := t.Status == entity.TaskInstanceStatusSuccess || t.Status == entity.TaskInstanceStatusSkipped
+		if old, ok := ret[t.TaskID]; ok {
+			done = done && old
+		}
+		ret[t.TaskID] = done
+	}
+	return ret, nil
+}
+
+// ListSLAMissedDagIns list the unfinished dag instances which missed any SLA, all dags are listed when dagID is empty
+func ListSLAMissedDagIns(dagID string) ([]*entity.DagInstance, error) {
+	return GetStore().ListDagInstance(&ListDagInstanceInput{
+		DagID:     dagID,
+		Status:    unfinishedDagInsStatus,
+		SLAMissed: true,
+	})
+}
@@ -0,0 +1,104 @@
+package mod
+
+import (
+	"testing"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestCheckSLAs(t *testing.T) {
+	now := time.Unix(100, 0)
+	tests := []struct {
+		caseDesc        string
+		giveDagIns      *entity.DagInstance
+		giveTaskIns     []*entity.TaskInstance
+		wantMissed      []entity.SLA
+		wantSLAs        []entity.SLA
+		wantSLADeadline int64
+		wantSLAMissedAt int64
+	}{
+		{
+			caseDesc: "dag missed",
+			giveDagIns: &entity.DagInstance{
+				SLAs:        []entity.SLA{{Deadline: 90}, {TaskID: "task1", Deadline: 120}},
+				SLADeadline: 90,
+			},
+			wantMissed:      []entity.SLA{{Deadline: 90, MissedAt: 100}},
+			wantSLAs:        []entity.SLA{{Deadline: 90, MissedAt: 100}, {TaskID: "task1", Deadline: 120}},
+			wantSLADeadline: 120,
+			wantSLAMissedAt: 100,
+		},
+		{
+			caseDesc: "task met",
+			giveDagIns: &entity.DagInstance{
+				SLAs:        []entity.SLA{{TaskID: "task1", Deadline: 90}, {TaskID: "task2", Deadline: 100}},
+				SLADeadline: 90,
+			},
+			giveTaskIns: []*entity.TaskInstance{
+				{TaskID: "task1", Status: entity.TaskInstanceStatusSuccess},
+				{TaskID: "task2", Status: entity.TaskInstanceStatusSkipped},
+				{TaskID: "task1", Hook: entity.DagHookFailure, Status: entity.TaskInstanceStatusInit},
+			},
+			wantSLAs: []entity.SLA{{TaskID: "task1", Deadline: 90}, {TaskID: "task2", Deadline: 100}},
+		},
+		{
+			caseDesc: "task missed",
+			giveDagIns: &entity.DagInstance{
+				SLAs:        []entity.SLA{{Deadline: 50, MissedAt: 50}, {TaskID: "task1", Deadline: 90}},
+				SLADeadline: 90,
+				SLAMissedAt: 50,
+			},
+			giveTaskIns: []*entity.TaskInstance{
+				{TaskID: "task1", Status: entity.TaskInstanceStatusSuccess},
+				{TaskID: "task1", Status: entity.TaskInstanceStatusRunning},
+			},
+			wantMissed:      []entity.SLA{{TaskID: "task1", Deadline: 90, MissedAt: 100}},
+			wantSLAs:        []entity.SLA{{Deadline: 50, MissedAt: 50}, {TaskID: "task1", Deadline: 90, MissedAt: 100}},
+			wantSLAMissedAt: 50,
+		},
+		{
+			caseDesc: "checked sla is skipped",
+			giveDagIns: &entity.DagInstance{
+				SLAs:        []entity.SLA{{TaskID: "task1", Deadline: 50}, {TaskID: "task2", Deadline: 90}},
+				SLADeadline: 90,
+			},
+			giveTaskIns: []*entity.TaskInstance{
+				{TaskID: "task1", Status: entity.TaskInstanceStatusRetrying},
+				{TaskID: "task2", Status: entity.TaskInstanceStatusSuccess},
+			},
+			wantSLAs: []entity.SLA{{TaskID: "task1", Deadline: 50}, {TaskID: "task2", Deadline: 90}},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			tc.giveDagIns.ID = "dag-ins1"
+			tc.giveDagIns.Status = entity.DagInstanceStatusRunning
+			mStore := &MockStore{}
+			mStore.On("ListDagInstance", &ListDagInstanceInput{
+				Status:         unfinishedDagInsStatus,
+				SLADeadlineEnd: now.Unix(),
+			}).Return([]*entity.DagInstance{tc.giveDagIns}, nil)
+			mStore.On("ListTaskInstance", &ListTaskInstanceInput{DagInsID: "dag-ins1"}).Return(tc.giveTaskIns, nil)
+			var patched *entity.DagInstance
+			mStore.On("PatchDagIns", mock.Anything, "SLADeadline").Run(func(args mock.Arguments) {
+				patched = args.Get(0).(*entity.DagInstance)
+			}).Return(nil)
+			SetStore(mStore)
+
+			ret, err := CheckSLAs(now)
+			assert.NoError(t, err)
+			var missed []entity.SLA
+			for _, e := range ret {
+				assert.Equal(t, tc.giveDagIns, e.DagIns)
+				missed = append(missed, e.SLA)
+			}
+			assert.Equal(t, tc.wantMissed, missed)
+			assert.Equal(t, tc.wantSLAs, patched.SLAs)
+			assert.Equal(t, tc.wantSLADeadline, patched.SLADeadline)
+			assert.Equal(t, tc.wantSLAMissedAt, tc.giveDagIns.SLAMissedAt)
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package mod
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/event"
+	"github.com/etherealiy/fastflow/pkg/log"
+	"github.com/etherealiy/fastflow/pkg/utils/data"
+	"github.com/shiningrush/goevent"
+)
+
+var (
+	standby      bool
+	standbySince time.Time
+	standbyLock  sync.RWMutex
+)
+
+// IsStandby return true when current worker belongs to a standby cluster, which follows the state of
+// primary cluster read-only, and it does not dispatch, parse or execute anything until promoted
+func IsStandby() bool {
+	standbyLock.RLock()
+	defer standbyLock.RUnlock()
+	return standby
+}
+
+// SetStandby enter or leave standby mode, it publishes event.StandbyChanged when changed
+func SetStandby(s bool) {
+	standbyLock.Lock()
+	if standby == s {
+		standbyLock.Unlock()
+		return
+	}
+	standby = s
+	if s {
+		standbySince = time.Now()
+	}
+	standbyLock.Unlock()
+
+	if s {
+		log.Info("worker enter standby mode")
+	} else {
+		log.Info("worker is promoted to active")
+	}
+	goevent.Publish(&event.StandbyChanged{Standby: s})
+}
+
+// Promote the standby cluster to active, it is persisted to cluster config so that all workers observe it
+// in next sync interval, and the leader takes over the dag instances of primary cluster by rebalancing
+func Promote() (*entity.ClusterConfig, error) {
+	if !IsStandby() {
+		return nil, fmt.Errorf("worker is not standby: %w", data.ErrDataConflicted)
+	}
+	cfg, err := LoadClusterConfig()
+	if err != nil {
+		return nil, err
+	}
+	cfg.PromotedAt = time.Now().Unix()
+	return UpdateClusterConfig(cfg)
+}
+
+// observePromotion leave standby mode when the cluster is promoted after current worker entered standby
+func observePromotion(cfg *entity.ClusterConfig) {
+	standbyLock.RLock()
+	promoted := standby && cfg.PromotedAt > 0 && cfg.PromotedAt >= standbySince.Unix()
+	standbyLock.RUnlock()
+	if promoted {
+		SetStandby(false)
+	}
+}
+
+// checkActive return data.ErrStandby when current worker is standby, it is called before writing
+func checkActive() error {
+	if IsStandby() {
+		return fmt.Errorf("promote it before writing: %w", data.ErrStandby)
+	}
+	return nil
+}
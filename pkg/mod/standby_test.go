@@ -0,0 +1,104 @@
+package mod
+
+import (
+	"testing"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestPromote(t *testing.T) {
+	defer SetClusterConfig(&entity.ClusterConfig{})
+	defer SetStandby(false)
+	tests := []struct {
+		caseDesc     string
+		giveStandby  bool
+		wantErr      string
+		wantStandby  bool
+		wantPromoted bool
+	}{
+		{
+			caseDesc:    "active",
+			wantErr:     "worker is not standby: data conflicted",
+			wantStandby: false,
+		},
+		{
+			caseDesc:     "standby",
+			giveStandby:  true,
+			wantStandby:  false,
+			wantPromoted: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			SetStore(&clusterConfigMockStore{MockStore: &MockStore{}})
+			SetClusterConfig(&entity.ClusterConfig{})
+			SetStandby(tc.giveStandby)
+			cfg, err := Promote()
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.wantPromoted, cfg.PromotedAt > 0)
+			}
+			assert.Equal(t, tc.wantStandby, IsStandby())
+		})
+	}
+}
+
+func TestCheckActive(t *testing.T) {
+	defer SetStandby(false)
+
+	SetStandby(true)
+	_, err := ApplyDags(nil, nil)
+	assert.EqualError(t, err, "promote it before writing: cluster is standby")
+	_, err = (&DefCommander{}).AddNote("dag-ins", "note", "")
+	assert.EqualError(t, err, "promote it before writing: cluster is standby")
+
+	// the promotion before entering standby is ignored
+	observePromotion(&entity.ClusterConfig{PromotedAt: 1})
+	assert.True(t, IsStandby())
+
+	SetStandby(false)
+	assert.NoError(t, checkActive())
+}
+
+func TestDefParser_loadRunningDagInsAfterPromoted(t *testing.T) {
+	defer SetStandby(false)
+	SetStandby(true)
+
+	loaded := make(chan struct{})
+	mStore := &MockStore{}
+	mStore.On("ListDagInstance", &ListDagInstanceInput{
+		Worker: "worker-1",
+		Status: []entity.DagInstanceStatus{entity.DagInstanceStatusRunning},
+	}).Run(func(args mock.Arguments) {
+		close(loaded)
+	}).Return([]*entity.DagInstance{}, nil).Once()
+	SetStore(mStore)
+	mKeeper := &MockKeeper{}
+	mKeeper.On("WorkerKey").Return("worker-1")
+	SetKeeper(mKeeper)
+
+	p := NewDefParser(0, time.Minute)
+	p.workerWg.Add(1)
+	go p.loadRunningDagInsAfterPromoted()
+
+	select {
+	case <-loaded:
+		t.Fatal("running dag instances are loaded in standby mode")
+	case <-time.After(1500 * time.Millisecond):
+	}
+
+	SetStandby(false)
+	select {
+	case <-loaded:
+	case <-time.After(3 * time.Second):
+		t.Fatal("running dag instances are not loaded after promoted")
+	}
+	p.Close()
+	assert.True(t, p.runningLoaded)
+}
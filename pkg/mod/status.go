@@ -0,0 +1,139 @@
+package mod
+
+import (
+	"fmt"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+)
+
+// DagInsStatus is the status of dag instance with the status computed from its task tree,
+// SrcTaskInsID is the task instance which makes the tree failed or blocked
+type DagInsStatus struct {
+	DagInsID     string                   `json:"dagInsId"`
+	Status       entity.DagInstanceStatus `json:"status"`
+	Reason       string                   `json:"reason,omitempty"`
+	TreeStatus   TreeStatus               `json:"treeStatus,omitempty"`
+	SrcTaskInsID string                   `json:"srcTaskInsId,omitempty"`
+	Tasks        []TaskInsStatus          `json:"tasks"`
+}
+
+// TaskInsStatus
+type TaskInsStatus struct {
+	ID     string                    `json:"id"`
+	TaskID string                    `json:"taskId"`
+	Name   string                    `json:"name,omitempty"`
+	Status entity.TaskInstanceStatus `json:"status"`
+	Reason string                    `json:"reason,omitempty"`
+}
+
+// TaskGraphNode is the task instance in graph, Level is the length of the longest path from the start tasks,
+// so ui can lay the graph out by levels
+type TaskGraphNode struct {
+	TaskInsStatus
+	Level int `json:"level"`
+}
+
+// TaskGraphEdge means To depends on From, they are the ids of task instances
+type TaskGraphEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// DagInsGraph is the task tree of dag instance as a graph, the nodes are in topological order
+type DagInsGraph struct {
+	DagInsID     string                   `json:"dagInsId"`
+	DagID        string                   `json:"dagId"`
+	Status       entity.DagInstanceStatus `json:"status"`
+	Reason       string                   `json:"reason,omitempty"`
+	TreeStatus   TreeStatus               `json:"treeStatus,omitempty"`
+	SrcTaskInsID string                   `json:"srcTaskInsId,omitempty"`
+	Nodes        []TaskGraphNode          `json:"nodes"`
+	Edges        []TaskGraphEdge          `json:"edges"`
+}
+
+// GetDagInsStatus build the task tree of dag instance and compute its status, the tree status is empty
+// when the task instances have not been created
+func GetDagInsStatus(dagInsID string) (*DagInsStatus, error) {
+	ret, _, _, err := getDagInsTree(dagInsID)
+	return ret, err
+}
+
+// GetDagInsGraph return the task tree of dag instance with its status, the edges are derived from
+// the children of task nodes
+func GetDagInsGraph(dagInsID string) (*DagInsGraph, error) {
+	sts, dagIns, root, err := getDagInsTree(dagInsID)
+	if err != nil {
+		return nil, err
+	}
+	ret := &DagInsGraph{
+		DagInsID:     sts.DagInsID,
+		DagID:        dagIns.DagID,
+		Status:       sts.Status,
+		Reason:       sts.Reason,
+		TreeStatus:   sts.TreeStatus,
+		SrcTaskInsID: sts.SrcTaskInsID,
+		Nodes:        []TaskGraphNode{},
+		Edges:        []TaskGraphEdge{},
+	}
+	if root == nil {
+		return ret, nil
+	}
+
+	tasks := map[string]TaskInsStatus{}
+	for _, t := range sts.Tasks {
+		tasks[t.ID] = t
+	}
+	levels := map[*TaskNode]int{}
+	for _, n := range root.TopoOrder() {
+		ret.Nodes = append(ret.Nodes, TaskGraphNode{
+			TaskInsStatus: tasks[n.TaskInsID],
+			Level:         levels[n],
+		})
+		for _, c := range n.children {
+			if levels[n]+1 > levels[c] {
+				levels[c] = levels[n] + 1
+			}
+			ret.Edges = append(ret.Edges, TaskGraphEdge{From: n.TaskInsID, To: c.TaskInsID})
+		}
+	}
+	return ret, nil
+}
+
+// getDagInsTree return nil root when the task instances have not been created
+func getDagInsTree(dagInsID string) (*DagInsStatus, *entity.DagInstance, *TaskNode, error) {
+	dagIns, err := GetStore().GetDagInstance(dagInsID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	tasks, err := GetStore().ListTaskInstance(&ListTaskInstanceInput{DagInsID: dagInsID})
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("list task instances failed: %w", err)
+	}
+
+	ret := &DagInsStatus{
+		DagInsID: dagIns.ID,
+		Status:   dagIns.Status,
+		Reason:   dagIns.Reason,
+		Tasks:    []TaskInsStatus{},
+	}
+	for _, t := range tasks {
+		ret.Tasks = append(ret.Tasks, TaskInsStatus{
+			ID:     t.ID,
+			TaskID: t.TaskID,
+			Name:   t.Name,
+			Status: t.Status,
+			Reason: t.Reason,
+		})
+	}
+	if len(tasks) == 0 {
+		return ret, dagIns, nil, nil
+	}
+
+	root, err := BuildRootNode(MapTaskInsToGetter(tasks))
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("build task tree failed: %w", err)
+	}
+	linkMappedTasks(root, tasks)
+	ret.TreeStatus, ret.SrcTaskInsID = root.ComputeStatus()
+	return ret, dagIns, root, nil
+}
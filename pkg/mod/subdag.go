@@ -0,0 +1,133 @@
+package mod
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/entity/run"
+	"github.com/etherealiy/fastflow/pkg/utils/data"
+)
+
+const (
+	ActionKeySubDag = "ff-sub-dag"
+)
+
+// subDagPollInterval is how often the sub-dag task checks the status of its dag instance
+var subDagPollInterval = time.Second
+
+// SubDagInsID is the id of dag instance created by the current attempt of task instance,
+// so the attempt waits for the same dag instance after the worker restarts
+func SubDagInsID(taskIns *entity.TaskInstance) string {
+	return fmt.Sprintf("%s-sub-%d", taskIns.ID, len(taskIns.Attempts)+1)
+}
+
+// subDagAction run the sub-dag of task instance and wait for it completed, the task instance fails when
+// the dag instance failed, and the dag instance is canceled when the task instance is canceled or timeout
+type subDagAction struct {
+}
+
+// Name
+func (a *subDagAction) Name() string {
+	return ActionKeySubDag
+}
+
+// Run
+func (a *subDagAction) Run(ctx run.ExecuteContext, params interface{}) error {
+	sub := params.(*entity.SubDag)
+	taskIns, ok := entity.CtxRunningTaskIns(ctx.Context())
+	if !ok {
+		return fmt.Errorf("running task instance is not found")
+	}
+	dagIns, err := runSubDag(taskIns, sub)
+	if err != nil {
+		return err
+	}
+	ctx.Tracef("run sub dag instance %s", dagIns.ID)
+
+	ticker := time.NewTicker(subDagPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Context().Done():
+			cancelSubDag(dagIns.ID)
+			return fmt.Errorf("context deadlined")
+		case <-ticker.C:
+			ret, err := GetStore().GetDagInstance(dagIns.ID)
+			if err != nil {
+				return fmt.Errorf("get sub dag instance %s failed: %w", dagIns.ID, err)
+			}
+			switch ret.Status {
+			case entity.DagInstanceStatusSuccess:
+				return nil
+			case entity.DagInstanceStatusFailed:
+				return fmt.Errorf("sub dag instance %s failed: %s", ret.ID, ret.Reason)
+			}
+		}
+	}
+}
+
+func runSubDag(taskIns *entity.TaskInstance, sub *entity.SubDag) (*entity.DagInstance, error) {
+	if sub.DagID == "" {
+		return nil, fmt.Errorf("sub dag id cannot be empty")
+	}
+	id := SubDagInsID(taskIns)
+	ops := []RunDagOptSetter{
+		RunDagID(id),
+		RunDagTrigger(entity.TriggerUpstream, &entity.TriggerMeta{UpstreamDagInsID: taskIns.DagInsID}),
+	}
+	if taskIns.RelatedDagInstance != nil {
+		ops = append(ops, RunDagParent(taskIns.RelatedDagInstance))
+	}
+	dagIns, err := runDag(sub.DagID, sub.Vars, newRunDagOption(ops))
+	if errors.Is(err, data.ErrDataConflicted) {
+		// it was created before the worker restarted
+		dagIns, err = GetStore().GetDagInstance(id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("run sub dag %s failed: %w", sub.DagID, err)
+	}
+
+	if taskIns.SubDagInsID != id {
+		taskIns.SubDagInsID = id
+		if err := GetStore().PatchTaskIns(&entity.TaskInstance{
+			BaseInfo:    taskIns.BaseInfo,
+			SubDagInsID: id,
+		}); err != nil {
+			return nil, fmt.Errorf("patch task instance failed: %w", err)
+		}
+	}
+	return dagIns, nil
+}
+
+// cancelSubDag fail the dag instance which is not started, or cancel its running task instances,
+// the sub-dags of them are canceled in turn
+func cancelSubDag(dagInsID string) {
+	dagIns, err := GetStore().GetDagInstance(dagInsID)
+	if err != nil {
+		dagInsLog(dagInsID).Errorf("get sub dag instance failed: %s", err)
+		return
+	}
+	switch dagIns.Status {
+	case entity.DagInstanceStatusInit, entity.DagInstanceStatusScheduled:
+		dagIns.Fail("parent task instance is canceled")
+		if err := GetStore().PatchDagIns(&entity.DagInstance{
+			BaseInfo: dagIns.BaseInfo,
+			Status:   dagIns.Status,
+			Reason:   dagIns.Reason,
+		}); err != nil {
+			dagInsLog(dagInsID).Errorf("fail sub dag instance failed: %s", err)
+		}
+	case entity.DagInstanceStatusRunning, entity.DagInstanceStatusBlocked:
+		ids, err := listDagTaskIDs(dagInsID, []entity.TaskInstanceStatus{entity.TaskInstanceStatusRunning})
+		if err != nil {
+			dagInsLog(dagInsID).Warnf("sub dag instance is not canceled: %s", err)
+			return
+		}
+		if _, err := cancelTask(context.Background(), ids, initOption(nil)); err != nil {
+			dagInsLog(dagInsID).Errorf("cancel sub dag instance failed: %s", err)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package mod
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/entity/run"
+	"github.com/etherealiy/fastflow/pkg/utils/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestSubDagAction_Run(t *testing.T) {
+	subDagPollInterval = time.Millisecond
+	defer func() { subDagPollInterval = time.Second }()
+	tests := []struct {
+		caseDesc        string
+		giveCreateErr   error
+		giveStatus      entity.DagInstanceStatus
+		giveCanceled    bool
+		wantErr         string
+		wantCreated     bool
+		wantPatchDagIns *entity.DagInstance
+	}{
+		{
+			caseDesc:    "sub dag succeed",
+			giveStatus:  entity.DagInstanceStatusSuccess,
+			wantCreated: true,
+		},
+		{
+			caseDesc:      "wait for the dag instance created before restarting",
+			giveCreateErr: fmt.Errorf("existed: %w", data.ErrDataConflicted),
+			giveStatus:    entity.DagInstanceStatusFailed,
+			wantErr:       "sub dag instance task-ins-sub-1 failed: task failed",
+		},
+		{
+			caseDesc:     "cancel the sub dag which is not started",
+			giveStatus:   entity.DagInstanceStatusScheduled,
+			giveCanceled: true,
+			wantErr:      "context deadlined",
+			wantCreated:  true,
+			wantPatchDagIns: &entity.DagInstance{
+				BaseInfo: entity.BaseInfo{ID: "task-ins-sub-1"},
+				Status:   entity.DagInstanceStatusFailed,
+				Reason:   "parent task instance is canceled",
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			var created *entity.DagInstance
+			var patchedDagIns *entity.DagInstance
+			mStore := &MockStore{}
+			mStore.On("GetDag", "sub").Return(&entity.Dag{
+				BaseInfo: entity.BaseInfo{ID: "sub"},
+				Status:   entity.DagStatusNormal,
+				Tasks:    []entity.Task{{ID: "t1", ActionName: "act"}},
+			}, nil)
+			mStore.On("CreateDagIns", mock.Anything).Run(func(args mock.Arguments) {
+				created = args.Get(0).(*entity.DagInstance)
+			}).Return(tc.giveCreateErr)
+			mStore.On("GetDagInstance", "task-ins-sub-1").Return(&entity.DagInstance{
+				BaseInfo: entity.BaseInfo{ID: "task-ins-sub-1"},
+				Status:   tc.giveStatus,
+				Reason:   "task failed",
+			}, nil)
+			mStore.On("PatchTaskIns", &entity.TaskInstance{
+				BaseInfo:    entity.BaseInfo{ID: "task-ins"},
+				SubDagInsID: "task-ins-sub-1",
+			}).Return(nil)
+			mStore.On("PatchDagIns", mock.Anything).Run(func(args mock.Arguments) {
+				patchedDagIns = args.Get(0).(*entity.DagInstance)
+			}).Return(nil)
+			SetStore(mStore)
+
+			parent := &entity.DagInstance{BaseInfo: entity.BaseInfo{ID: "parent"}}
+			taskIns := &entity.TaskInstance{BaseInfo: entity.BaseInfo{ID: "task-ins"}, DagInsID: "parent", RelatedDagInstance: parent}
+			c, cancel := context.WithCancel(entity.CtxWithRunningTaskIns(context.Background(), taskIns))
+			if tc.giveCanceled {
+				cancel()
+			} else {
+				defer cancel()
+			}
+			ctx := run.NewDefExecuteContext(c, &entity.ShareData{}, func(msg string, opt ...run.TraceOp) {}, nil, nil)
+
+			err := (&subDagAction{}).Run(ctx, &entity.SubDag{DagID: "sub"})
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, "task-ins-sub-1", taskIns.SubDagInsID)
+			if tc.wantCreated {
+				assert.Equal(t, "task-ins-sub-1", created.ID)
+				assert.Equal(t, "parent", created.ParentDagInsID)
+				assert.Equal(t, entity.TriggerUpstream, created.Trigger)
+			}
+			assert.Equal(t, tc.wantPatchDagIns, patchedDagIns)
+		})
+	}
+}
@@ -0,0 +1,235 @@
+package mod
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/log"
+)
+
+const (
+	// DefaultTaskLogMaxLines is the default count of the latest logs kept for each task instance
+	DefaultTaskLogMaxLines = 10000
+	// DefaultTaskLogMaxLineBytes is the default max size of each log, the longer message is truncated
+	DefaultTaskLogMaxLineBytes = 4096
+
+	taskLogTruncatedSuffix = "...(truncated)"
+	taskLogBatchSize       = 100
+	taskLogFlushInterval   = time.Second
+)
+
+// GetTaskLogs return the logs of task instance after cursor, the seq of the last log is the cursor of
+// next reading, so ui can poll it to stream the logs of running task instance
+func GetTaskLogs(taskInsID string, cursor int64, limit int) ([]*entity.TaskLog, error) {
+	st, ok := StoreAs[TaskLogStore](GetStore())
+	if !ok {
+		return nil, fmt.Errorf("store does not support task logs")
+	}
+	return st.GetTaskLogs(taskInsID, cursor, limit)
+}
+
+// taskLogger is the logger of running task instance, the logs are written to the engine logger with the ids
+// of instance, and buffered to be appended to store in batch. It is also a writer which turns each line
+// into a log, so it can capture the output of processes.
+type taskLogger struct {
+	taskIns      *entity.TaskInstance
+	store        TaskLogStore
+	maxLines     int
+	maxLineBytes int
+
+	lock    sync.Mutex
+	lastSeq int64
+	buf     []*entity.TaskLog
+	// partial is the last line written without newline
+	partial []byte
+	timer   *time.Timer
+	// flushLock keep the batches appended in order
+	flushLock sync.Mutex
+}
+
+// newTaskLogger the logs are not persisted when store is nil
+func newTaskLogger(taskIns *entity.TaskInstance, store TaskLogStore, maxLines, maxLineBytes int) *taskLogger {
+	return &taskLogger{
+		taskIns:      taskIns,
+		store:        store,
+		maxLines:     maxLines,
+		maxLineBytes: maxLineBytes,
+	}
+}
+
+// Debug
+func (l *taskLogger) Debug(msg string, fields ...interface{}) {
+	taskInsLog(l.taskIns).Debug(msg, fields...)
+	l.append(entity.TaskLogLevelDebug, msg, fields)
+}
+
+// Debugf
+func (l *taskLogger) Debugf(msg string, args ...interface{}) {
+	l.Debug(fmt.Sprintf(msg, args...))
+}
+
+// Info
+func (l *taskLogger) Info(msg string, fields ...interface{}) {
+	taskInsLog(l.taskIns).Info(msg, fields...)
+	l.append(entity.TaskLogLevelInfo, msg, fields)
+}
+
+// Infof
+func (l *taskLogger) Infof(msg string, args ...interface{}) {
+	l.Info(fmt.Sprintf(msg, args...))
+}
+
+// Warn
+func (l *taskLogger) Warn(msg string, fields ...interface{}) {
+	taskInsLog(l.taskIns).Warn(msg, fields...)
+	l.append(entity.TaskLogLevelWarn, msg, fields)
+}
+
+// Warnf
+func (l *taskLogger) Warnf(msg string, args ...interface{}) {
+	l.Warn(fmt.Sprintf(msg, args...))
+}
+
+// Error
+func (l *taskLogger) Error(msg string, fields ...interface{}) {
+	taskInsLog(l.taskIns).Error(msg, fields...)
+	l.append(entity.TaskLogLevelError, msg, fields)
+}
+
+// Errorf
+func (l *taskLogger) Errorf(msg string, args ...interface{}) {
+	l.Error(fmt.Sprintf(msg, args...))
+}
+
+// Fatal does not exit in action, it is the same as Error
+func (l *taskLogger) Fatal(msg string, fields ...interface{}) {
+	l.Error(msg, fields...)
+}
+
+// Fatalf does not exit in action, it is the same as Errorf
+func (l *taskLogger) Fatalf(msg string, args ...interface{}) {
+	l.Errorf(msg, args...)
+}
+
+// Write turn each line into a log of stdout level, the line without newline is kept until next writing
+// unless it exceeds the max size
+func (l *taskLogger) Write(p []byte) (int, error) {
+	l.lock.Lock()
+	data := append(l.partial, p...)
+	var lines []string
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		lines = append(lines, strings.TrimSuffix(string(data[:i]), "\r"))
+		data = data[i+1:]
+	}
+	if l.maxLineBytes > 0 && len(data) > l.maxLineBytes {
+		lines = append(lines, string(data))
+		data = nil
+	}
+	l.partial = append([]byte(nil), data...)
+	l.lock.Unlock()
+
+	for _, line := range lines {
+		taskInsLog(l.taskIns).Debug(line)
+		l.append(entity.TaskLogLevelStdout, line, nil)
+	}
+	return len(p), nil
+}
+
+func (l *taskLogger) append(level entity.TaskLogLevel, msg string, fields []interface{}) {
+	if l.store == nil {
+		return
+	}
+	now := time.Now()
+	taskLog := &entity.TaskLog{
+		Time:    now.UnixMilli(),
+		Level:   level,
+		Message: l.truncate(log.Redact(msg)),
+		Fields:  taskLogFields(fields),
+	}
+
+	l.lock.Lock()
+	// seq is the time in microseconds, so it keeps increasing when task instance is retried on other worker,
+	// and it is still exact in float64, such as the score of redis and the number of javascript
+	taskLog.Seq = now.UnixMicro()
+	if taskLog.Seq <= l.lastSeq {
+		taskLog.Seq = l.lastSeq + 1
+	}
+	l.lastSeq = taskLog.Seq
+	l.buf = append(l.buf, taskLog)
+	full := len(l.buf) >= taskLogBatchSize
+	if !full && l.timer == nil {
+		l.timer = time.AfterFunc(taskLogFlushInterval, l.flush)
+	}
+	l.lock.Unlock()
+
+	if full {
+		l.flush()
+	}
+}
+
+func (l *taskLogger) truncate(msg string) string {
+	if l.maxLineBytes <= 0 || len(msg) <= l.maxLineBytes {
+		return msg
+	}
+	return strings.ToValidUTF8(msg[:l.maxLineBytes], "") + taskLogTruncatedSuffix
+}
+
+func (l *taskLogger) flush() {
+	l.flushLock.Lock()
+	defer l.flushLock.Unlock()
+
+	l.lock.Lock()
+	logs := l.buf
+	l.buf = nil
+	if l.timer != nil {
+		l.timer.Stop()
+		l.timer = nil
+	}
+	l.lock.Unlock()
+
+	if len(logs) == 0 {
+		return
+	}
+	if err := l.store.AppendTaskLogs(l.taskIns.ID, logs, l.maxLines); err != nil {
+		taskInsLog(l.taskIns).Errorf("append %d task logs failed: %s", len(logs), err)
+	}
+}
+
+// close write the partial line and flush the buffered logs, the logs written after closing are
+// still flushed in background
+func (l *taskLogger) close() {
+	l.lock.Lock()
+	partial := l.partial
+	l.partial = nil
+	l.lock.Unlock()
+	if len(partial) > 0 {
+		l.append(entity.TaskLogLevelStdout, string(partial), nil)
+	}
+	if l.store != nil {
+		l.flush()
+	}
+}
+
+// taskLogFields turn the key-value pairs into string map, the value without key is put under "!BADKEY" like slog
+func taskLogFields(fields []interface{}) map[string]string {
+	if len(fields) == 0 {
+		return nil
+	}
+	ret := make(map[string]string, (len(fields)+1)/2)
+	for i := 0; i < len(fields); i += 2 {
+		if i+1 == len(fields) {
+			ret["!BADKEY"] = log.Redact(fmt.Sprint(fields[i]))
+			break
+		}
+		ret[fmt.Sprint(fields[i])] = log.Redact(fmt.Sprint(fields[i+1]))
+	}
+	return ret
+}
@@ -0,0 +1,93 @@
+package mod
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeTaskLogStore struct {
+	lock sync.Mutex
+	logs []*entity.TaskLog
+}
+
+func (s *fakeTaskLogStore) AppendTaskLogs(taskInsID string, logs []*entity.TaskLog, maxLines int) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.logs = append(s.logs, logs...)
+	return nil
+}
+
+func (s *fakeTaskLogStore) GetTaskLogs(taskInsID string, cursor int64, limit int) ([]*entity.TaskLog, error) {
+	return nil, nil
+}
+
+func TestTaskLogger(t *testing.T) {
+	tests := []struct {
+		caseDesc   string
+		giveWrite  func(l *taskLogger)
+		wantLevels []entity.TaskLogLevel
+		wantMsgs   []string
+		wantFields []map[string]string
+	}{
+		{
+			caseDesc: "structured",
+			giveWrite: func(l *taskLogger) {
+				l.Info("started", "key", "value")
+				l.Warnf("retry %d", 1)
+				l.Error("odd", "key")
+			},
+			wantLevels: []entity.TaskLogLevel{entity.TaskLogLevelInfo, entity.TaskLogLevelWarn, entity.TaskLogLevelError},
+			wantMsgs:   []string{"started", "retry 1", "odd"},
+			wantFields: []map[string]string{{"key": "value"}, nil, {"!BADKEY": "key"}},
+		},
+		{
+			caseDesc: "lines",
+			giveWrite: func(l *taskLogger) {
+				_, _ = fmt.Fprint(l, "line1\r\nli")
+				_, _ = fmt.Fprint(l, "ne2\nline3")
+			},
+			wantLevels: []entity.TaskLogLevel{entity.TaskLogLevelStdout, entity.TaskLogLevelStdout, entity.TaskLogLevelStdout},
+			wantMsgs:   []string{"line1", "line2", "line3"},
+			wantFields: []map[string]string{nil, nil, nil},
+		},
+		{
+			caseDesc: "truncate",
+			giveWrite: func(l *taskLogger) {
+				l.Info(strings.Repeat("a", 12))
+				_, _ = fmt.Fprint(l, strings.Repeat("b", 12))
+			},
+			wantLevels: []entity.TaskLogLevel{entity.TaskLogLevelInfo, entity.TaskLogLevelStdout},
+			wantMsgs:   []string{"aaaaaaaaaa" + taskLogTruncatedSuffix, "bbbbbbbbbb" + taskLogTruncatedSuffix},
+			wantFields: []map[string]string{nil, nil},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			st := &fakeTaskLogStore{}
+			l := newTaskLogger(&entity.TaskInstance{BaseInfo: entity.BaseInfo{ID: "task"}}, st, 100, 10)
+			tc.giveWrite(l)
+			l.close()
+
+			var levels []entity.TaskLogLevel
+			var msgs []string
+			var fields []map[string]string
+			var lastSeq int64
+			for _, taskLog := range st.logs {
+				assert.Greater(t, taskLog.Seq, lastSeq)
+				lastSeq = taskLog.Seq
+				levels = append(levels, taskLog.Level)
+				msgs = append(msgs, taskLog.Message)
+				fields = append(fields, taskLog.Fields)
+			}
+			assert.Equal(t, tc.wantLevels, levels)
+			assert.Equal(t, tc.wantMsgs, msgs)
+			assert.Equal(t, tc.wantFields, fields)
+		})
+	}
+}
@@ -1,8 +1,10 @@
 package mod
 
 import (
+	"container/heap"
 	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/etherealiy/fastflow/pkg/entity"
 )
@@ -88,11 +90,23 @@ func BuildRootNode(tasks []TaskInfoGetter) (*TaskNode, error) {
 	if len(root.children) == 0 {
 		return nil, errors.New("here is no start nodes")
 	}
+	root.index = make(map[string]*TaskNode, len(m))
+	for _, n := range m {
+		root.index[n.TaskInsID] = n
+	}
 
-	// FIXME： 当图规模较大时，检测环会一直卡住
-	//if cycleStart := root.HasCycle(); cycleStart != nil {
-	//	return nil, fmt.Errorf("dag has cycle at: %s", cycleStart.TaskInsID)
-	//}
+	// 从虚拟Root出发后再从未访问的节点出发，这样无法从Root到达的环也能被检测到
+	starts := []*TaskNode{root}
+	for i := range tasks {
+		starts = append(starts, m[tasks[i].GetGraphID()])
+	}
+	if cycle := findCycle(starts); cycle != nil {
+		var path []string
+		for _, n := range cycle {
+			path = append(path, n.GraphID)
+		}
+		return nil, fmt.Errorf("dag has cycle: %s", strings.Join(path, " -> "))
+	}
 
 	return root, nil
 }
@@ -113,23 +127,112 @@ func buildGraphNodeMap(tasks []TaskInfoGetter) (map[string]*TaskNode, error) {
 type TaskTree struct {
 	DagIns *entity.DagInstance
 	Root   *TaskNode
+
+	// nodes index the nodes by task instance id, the nodes inserted later are indexed by TaskTree.Expand
+	nodes map[string]*TaskNode
+}
+
+// NewTaskTree use the index built by BuildRootNode, so it does not walk the tree
+func NewTaskTree(dagIns *entity.DagInstance, root *TaskNode) *TaskTree {
+	return &TaskTree{DagIns: dagIns, Root: root, nodes: root.index}
+}
+
+func (t *TaskTree) reindex() {
+	t.nodes = map[string]*TaskNode{}
+	if t.Root.TaskInsID != virtualTaskRootID {
+		t.nodes[t.Root.TaskInsID] = t.Root
+	}
+	for _, n := range t.Root.TopoOrder() {
+		t.nodes[n.TaskInsID] = n
+	}
+}
+
+// GetNode return the node of task instance by index, the index is built at the first time when the tree
+// is not created by NewTaskTree
+func (t *TaskTree) GetNode(taskInsID string) (*TaskNode, bool) {
+	if t.nodes == nil {
+		t.reindex()
+	}
+	n, ok := t.nodes[taskInsID]
+	return n, ok
+}
+
+// Expand insert the mapped nodes by TaskNode.Expand and index them
+func (t *TaskTree) Expand(node *TaskNode, mapped []*TaskNode) {
+	node.Expand(mapped)
+	if t.nodes == nil {
+		t.reindex()
+		return
+	}
+	for _, m := range mapped {
+		t.nodes[m.TaskInsID] = m
+	}
+}
+
+// ApplyTaskChange sync the status of task instance to its node and return the task instances which become
+// executable, it works like TaskNode.GetNextTaskIds but only visits the node and its children
+func (t *TaskTree) ApplyTaskChange(ins *entity.TaskInstance) (executable []string, find bool) {
+	node, ok := t.GetNode(ins.ID)
+	if !ok {
+		return nil, false
+	}
+	node.Status = ins.Status
+	node.BranchSkipped = ins.BranchSkipped
+
+	if node.Status == entity.TaskInstanceStatusInit {
+		return []string{node.TaskInsID}, true
+	}
+	if !node.Done() {
+		return nil, true
+	}
+	for _, c := range node.children {
+		if c.Executable() {
+			executable = append(executable, c.TaskInsID)
+		}
+	}
+	return executable, true
 }
 
 // NewTaskNodeFromGetter
 func NewTaskNodeFromGetter(instance TaskInfoGetter) *TaskNode {
-	return &TaskNode{
+	n := &TaskNode{
 		TaskInsID: instance.GetID(),
+		GraphID:   instance.GetGraphID(),
 		Status:    instance.GetStatus(),
 	}
+	switch ins := instance.(type) {
+	case *entity.TaskInstance:
+		n.BranchSkipped = ins.BranchSkipped
+		n.TriggerRule = ins.TriggerRule
+	case *entity.Task:
+		n.TriggerRule = ins.TriggerRule
+	}
+	return n
+}
+
+// TopoOrder return all task nodes in topological order, the nodes which are ready at the same time
+// are ordered by GraphID, so the order is stable. The virtual root is not included.
+func (t *TaskTree) TopoOrder() []*TaskNode {
+	return t.Root.TopoOrder()
 }
 
 // TaskNode
 type TaskNode struct {
 	TaskInsID string
-	Status    entity.TaskInstanceStatus
+	// GraphID is the id of task in dag
+	GraphID string
+	Status  entity.TaskInstanceStatus
+	// BranchSkipped see entity.TaskInstance.BranchSkipped
+	BranchSkipped bool
+	// Expanded means all task instances mapped from the task are in the tree, see entity.MapOver
+	Expanded bool
+	// TriggerRule see entity.Task.TriggerRule
+	TriggerRule entity.TriggerRule
 
 	children []*TaskNode
 	parents  []*TaskNode
+	// index is the nodes by task instance id, it is only set to the virtual root by BuildRootNode
+	index map[string]*TaskNode
 }
 
 type TreeStatus string
@@ -141,49 +244,115 @@ const (
 	TreeStatusBlocked TreeStatus = "blocked"
 )
 
-// HasCycle
-func (t *TaskNode) HasCycle() (cycleStart *TaskNode) {
-	visited, incomplete := map[string]struct{}{}, map[string]*TaskNode{}
-	waitQueue := []*TaskNode{t}
-	bfsCheckCycle(waitQueue, visited, incomplete)
-	if len(incomplete) > 0 {
-		for k := range incomplete {
-			return incomplete[k]
+// TopoOrder return the descendants of node in topological order by Kahn's algorithm, the nodes which are
+// ready at the same time are ordered by GraphID
+func (t *TaskNode) TopoOrder() []*TaskNode {
+	// count in-degree of the nodes which are reachable from t
+	indegree := map[*TaskNode]int{}
+	stack := []*TaskNode{t}
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, c := range n.children {
+			if _, ok := indegree[c]; !ok {
+				stack = append(stack, c)
+			}
+			indegree[c]++
 		}
 	}
-	return
+
+	var order []*TaskNode
+	ready := &taskNodeHeap{t}
+	for ready.Len() > 0 {
+		n := heap.Pop(ready).(*TaskNode)
+		if n != t {
+			order = append(order, n)
+		}
+		for _, c := range n.children {
+			indegree[c]--
+			if indegree[c] == 0 {
+				heap.Push(ready, c)
+			}
+		}
+	}
+	return order
 }
 
-func bfsCheckCycle(waitQueue []*TaskNode, visited map[string]struct{}, incomplete map[string]*TaskNode) {
-	queueLen := len(waitQueue)
-	if queueLen == 0 {
-		return
+// taskNodeHeap is a min heap of task nodes by GraphID
+type taskNodeHeap []*TaskNode
+
+func (h taskNodeHeap) Len() int            { return len(h) }
+func (h taskNodeHeap) Less(i, j int) bool  { return h[i].GraphID < h[j].GraphID }
+func (h taskNodeHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *taskNodeHeap) Push(x interface{}) { *h = append(*h, x.(*TaskNode)) }
+func (h *taskNodeHeap) Pop() interface{} {
+	old := *h
+	n := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return n
+}
+
+// HasCycle return the node where the first found cycle starts
+func (t *TaskNode) HasCycle() (cycleStart *TaskNode) {
+	if cycle := findCycle([]*TaskNode{t}); cycle != nil {
+		return cycle[0]
 	}
+	return nil
+}
 
-	isParentCompleted := func(node *TaskNode) bool {
-		for _, p := range node.parents {
-			if _, ok := visited[p.TaskInsID]; !ok {
-				return false
-			}
-		}
-		return true
+// findCycle walk the graph from starts by iterative dfs with color marking, it is O(V+E) and does not
+// overflow the stack for large graphs. It returns the nodes of first found cycle in order,
+// and the first node is repeated at the end.
+func findCycle(starts []*TaskNode) []*TaskNode {
+	const (
+		// white is not visited
+		white = iota
+		// gray is on the current path
+		gray
+		// black means all descendants are visited
+		black
+	)
+	type frame struct {
+		node *TaskNode
+		next int
 	}
 
-	for i := 0; i < queueLen; i++ {
-		cur := waitQueue[i]
-		if !isParentCompleted(cur) {
-			incomplete[cur.TaskInsID] = cur
+	color := map[*TaskNode]int{}
+	for _, start := range starts {
+		if color[start] != white {
 			continue
 		}
-		visited[cur.TaskInsID] = struct{}{}
-		delete(incomplete, cur.TaskInsID)
-		for _, c := range cur.children {
-			waitQueue = append(waitQueue, c)
+		color[start] = gray
+		stack := []*frame{{node: start}}
+		for len(stack) > 0 {
+			top := stack[len(stack)-1]
+			if top.next == len(top.node.children) {
+				color[top.node] = black
+				stack = stack[:len(stack)-1]
+				continue
+			}
+			child := top.node.children[top.next]
+			top.next++
+
+			switch color[child] {
+			case white:
+				color[child] = gray
+				stack = append(stack, &frame{node: child})
+			case gray:
+				// the nodes on the path from child to top form the cycle
+				i := len(stack) - 1
+				for stack[i].node != child {
+					i--
+				}
+				var cycle []*TaskNode
+				for _, f := range stack[i:] {
+					cycle = append(cycle, f.node)
+				}
+				return append(cycle, child)
+			}
 		}
 	}
-	waitQueue = waitQueue[queueLen:]
-	bfsCheckCycle(waitQueue, visited, incomplete)
-	return
+	return nil
 }
 
 // ComputeStatus
@@ -203,9 +372,18 @@ func (t *TaskNode) ComputeStatus() (status TreeStatus, srcTaskInsId string) {
 			}
 		}
 	}
+	if workers := GetStatusWalkWorkers(); workers > 1 {
+		return t.parallelWalkStatus(workers)
+	}
+	return t.walkStatus()
+}
+
+// walkStatus compute the status by dfs, the last found failed or blocked node decides the status
+// unless there is a node not completed
+func (t *TaskNode) walkStatus() (status TreeStatus, srcTaskInsId string) {
 	walkNode(t, func(node *TaskNode) bool {
 		switch node.Status {
-		case entity.TaskInstanceStatusFailed, entity.TaskInstanceStatusCanceled:
+		case entity.TaskInstanceStatusFailed, entity.TaskInstanceStatusInvalidParams, entity.TaskInstanceStatusCanceled:
 			status = TreeStatusFailed
 			srcTaskInsId = node.TaskInsID
 			return true
@@ -247,15 +425,16 @@ func dfsWalk(
 		}
 	}
 
-	// we cannot execute children, but should execute brother nodes
+	// we cannot execute children unless their trigger rules allow, but should execute brother nodes
 	// parser初始化dagIns时，walkChildrenIgnoreStatus为false，且虚拟根节点的状态为success，可以执行children
-	if !walkChildrenIgnoreStatus && !root.CanExecuteChild() {
+	canExecuteChild := walkChildrenIgnoreStatus || root.CanExecuteChild()
+	if !canExecuteChild && !root.Done() {
 		return true
 	}
 	// parser初始化dagIns时，此时的children是图中入度为0的节点，对这些节点继续递归进行dfsWalk，由于虚拟根节点的状态为success，则把节点添加进可执行列表中，此时当前节点还未完成，则返回true，检查兄弟节点
 	for _, c := range root.children {
 		// if children's parent is not just root, we must check it
-		if len(c.parents) > 1 && !c.CanBeExecuted() {
+		if (!canExecuteChild || len(c.parents) > 1) && !c.CanBeExecuted() {
 			continue
 		}
 
@@ -281,14 +460,101 @@ func (t *TaskNode) CanExecuteChild() bool {
 	return t.Status == entity.TaskInstanceStatusSuccess || t.Status == entity.TaskInstanceStatusSkipped
 }
 
-// CanBeExecuted check whether task could be executed
+// Done return true when the task is completed, no matter it succeeded or not
+func (t *TaskNode) Done() bool {
+	switch t.Status {
+	case entity.TaskInstanceStatusSuccess, entity.TaskInstanceStatusSkipped, entity.TaskInstanceStatusFailed,
+		entity.TaskInstanceStatusInvalidParams, entity.TaskInstanceStatusCanceled:
+		return true
+	}
+	return false
+}
+
+// Failed return true when the task failed, including its params are invalid
+func (t *TaskNode) Failed() bool {
+	return t.Status == entity.TaskInstanceStatusFailed || t.Status == entity.TaskInstanceStatusInvalidParams
+}
+
+// CanBeExecuted check whether task could be executed by its trigger rule and the status of parents
 func (t *TaskNode) CanBeExecuted() bool {
 	if len(t.parents) == 0 {
 		return true
 	}
 
-	for _, p := range t.parents {
-		if !p.CanExecuteChild() {
+	switch t.TriggerRule {
+	case entity.TriggerRuleOneSuccess:
+		for _, p := range t.parents {
+			if p.CanExecuteChild() {
+				return true
+			}
+		}
+		return false
+	case entity.TriggerRuleAllDone:
+		for _, p := range t.parents {
+			if !p.Done() {
+				return false
+			}
+		}
+		return true
+	case entity.TriggerRuleNoneFailed:
+		for _, p := range t.parents {
+			if !p.Done() || p.Failed() {
+				return false
+			}
+		}
+		return true
+	default:
+		for _, p := range t.parents {
+			if !p.CanExecuteChild() {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// MayBeExecuted return false when the completed parents have decided that the task never runs
+// by its trigger rule
+func (t *TaskNode) MayBeExecuted() bool {
+	switch t.TriggerRule {
+	case entity.TriggerRuleOneSuccess:
+		if len(t.parents) == 0 {
+			return true
+		}
+		for _, p := range t.parents {
+			if !p.Done() || p.CanExecuteChild() {
+				return true
+			}
+		}
+		return false
+	case entity.TriggerRuleAllDone:
+		return true
+	case entity.TriggerRuleNoneFailed:
+		for _, p := range t.parents {
+			if p.Failed() {
+				return false
+			}
+		}
+		return true
+	default:
+		for _, p := range t.parents {
+			if p.Failed() || p.Status == entity.TaskInstanceStatusCanceled {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// FailureTolerated return true when the failed or canceled task does not stop any of its children
+// by their trigger rules, so the dag instance goes on
+func (t *TaskNode) FailureTolerated() bool {
+	if len(t.children) == 0 {
+		return false
+	}
+	for _, c := range t.children {
+		// all_success never tolerates a failed parent
+		if c.TriggerRule == "" || c.TriggerRule == entity.TriggerRuleAllSuccess || !c.MayBeExecuted() {
 			return false
 		}
 	}
@@ -319,13 +585,14 @@ func (t *TaskNode) GetNextTaskIds(completedOrRetryTask *entity.TaskInstance) (ex
 		if completedOrRetryTask.ID == node.TaskInsID {
 			find = true
 			node.Status = completedOrRetryTask.Status
+			node.BranchSkipped = completedOrRetryTask.BranchSkipped
 
 			if node.Status == entity.TaskInstanceStatusInit {
 				executable = append(executable, node.TaskInsID)
 				return false
 			}
 
-			if !node.CanExecuteChild() {
+			if !node.Done() {
 				return false
 			}
 			for i := range node.children {
@@ -341,22 +608,63 @@ func (t *TaskNode) GetNextTaskIds(completedOrRetryTask *entity.TaskInstance) (ex
 	return
 }
 
+// UpstreamBranchSkipped return true when all upstream tasks are skipped by branch, so the task is not
+// in any taken branch
+func (t *TaskNode) UpstreamBranchSkipped() bool {
+	if len(t.parents) == 0 {
+		return false
+	}
+	for _, p := range t.parents {
+		if !p.BranchSkipped {
+			return false
+		}
+	}
+	return true
+}
+
+// FindNode return the node of task instance in the descendants of t
+func (t *TaskNode) FindNode(taskInsID string) (*TaskNode, bool) {
+	visited := map[*TaskNode]bool{t: true}
+	stack := []*TaskNode{t}
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if n.TaskInsID == taskInsID {
+			return n, true
+		}
+		for _, c := range n.children {
+			if !visited[c] {
+				visited[c] = true
+				stack = append(stack, c)
+			}
+		}
+	}
+	return nil, false
+}
+
+// Expand insert the nodes mapped from t between t and its parents, so t is executable after all of
+// them completed. The mapped nodes which already have parents are only linked to t.
+func (t *TaskNode) Expand(mapped []*TaskNode) {
+	parents := append([]*TaskNode(nil), t.parents...)
+	for _, m := range mapped {
+		if len(m.parents) == 0 {
+			for _, p := range parents {
+				p.AppendChild(m)
+				m.AppendParent(p)
+			}
+		}
+		m.AppendChild(t)
+		t.AppendParent(m)
+	}
+}
+
 // Executable
 func (t *TaskNode) Executable() bool {
 	if t.Status == entity.TaskInstanceStatusInit ||
 		t.Status == entity.TaskInstanceStatusRetrying ||
 		t.Status == entity.TaskInstanceStatusContinue ||
 		t.Status == entity.TaskInstanceStatusEnding {
-		if len(t.parents) == 0 {
-			return true
-		}
-
-		for i := range t.parents {
-			if !t.parents[i].CanExecuteChild() {
-				return false
-			}
-		}
-		return true
+		return t.CanBeExecuted()
 	}
 	return false
 }
@@ -0,0 +1,40 @@
+package mod
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+)
+
+// FuzzBuildRootNode decode tasks from lines like "task2:task1,task3",
+// the part before ":" is task id and the rest is its depend on
+func FuzzBuildRootNode(f *testing.F) {
+	f.Add("task1\ntask2:task1\ntask3:task1,task2")
+	f.Add("task1:task1")
+	f.Add("task1\ntask1")
+	f.Add("task1:task2")
+	f.Add("task1\ntask2:task3\ntask3:task2")
+	f.Add(":\n:")
+	f.Add("task1:,,")
+
+	f.Fuzz(func(t *testing.T, s string) {
+		var tasks []entity.Task
+		for _, line := range strings.Split(s, "\n") {
+			kv := strings.SplitN(line, ":", 2)
+			task := entity.Task{ID: kv[0]}
+			if len(kv) == 2 {
+				task.DependOn = strings.Split(kv[1], ",")
+			}
+			tasks = append(tasks, task)
+		}
+
+		root, err := BuildRootNode(MapTasksToGetter(tasks))
+		if err != nil {
+			return
+		}
+		if len(root.children) == 0 {
+			t.Fatalf("root should have children")
+		}
+	})
+}
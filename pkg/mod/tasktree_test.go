@@ -2,10 +2,12 @@ package mod
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/etherealiy/fastflow/pkg/entity"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 )
 
 func TestTaskNode_ComputeStatus(t *testing.T) {
@@ -69,6 +71,24 @@ func TestTaskNode_ComputeStatus(t *testing.T) {
 			wantSrcId:  "task3",
 			wantStatus: TreeStatusFailed,
 		},
+		{
+			caseDesc: "invalid params",
+			giveTaskIns: []*entity.TaskInstance{
+				{
+					BaseInfo: entity.BaseInfo{ID: "task1"},
+					TaskID:   "task1",
+					Status:   entity.TaskInstanceStatusSuccess,
+				},
+				{
+					BaseInfo: entity.BaseInfo{ID: "task2"},
+					TaskID:   "task2",
+					DependOn: []string{"task1"},
+					Status:   entity.TaskInstanceStatusInvalidParams,
+				},
+			},
+			wantSrcId:  "task2",
+			wantStatus: TreeStatusFailed,
+		},
 		{
 			caseDesc: "blocked",
 			giveTaskIns: []*entity.TaskInstance{
@@ -97,6 +117,11 @@ func TestTaskNode_ComputeStatus(t *testing.T) {
 
 	for _, tc := range tests {
 		t.Run(tc.caseDesc, func(t *testing.T) {
+			// the status is computed by walking the tree since the end task is not found
+			mStore := &MockStore{}
+			mStore.On("GetTaskIns", mock.Anything).Return(nil, fmt.Errorf("not found"))
+			SetStore(mStore)
+
 			root := MustBuildRootNode(MapTaskInsToGetter(tc.giveTaskIns))
 			status, srcId := root.ComputeStatus()
 			assert.Equal(t, tc.wantStatus, status)
@@ -169,22 +194,26 @@ func TestBuildRootNode(t *testing.T) {
 				children: []*TaskNode{
 					{
 						TaskInsID: "root1-ins",
+						GraphID:   "root1",
 						children: []*TaskNode{
 							{
 								TaskInsID: "r1-child1-ins",
+								GraphID:   "r1-child1",
 							},
 							{
 								TaskInsID: "r1-child2-ins",
+								GraphID:   "r1-child2",
 								children: []*TaskNode{
-									{TaskInsID: "c1-child1-ins"},
+									{TaskInsID: "c1-child1-ins", GraphID: "c1-child1"},
 								},
 							},
 						},
 					},
 					{
 						TaskInsID: "root2-ins",
+						GraphID:   "root2",
 						children: []*TaskNode{
-							{TaskInsID: "r2-child1-ins", Status: entity.TaskInstanceStatusInit},
+							{TaskInsID: "r2-child1-ins", GraphID: "r2-child1", Status: entity.TaskInstanceStatusInit},
 						},
 					},
 				},
@@ -266,7 +295,30 @@ func TestBuildRootNode(t *testing.T) {
 				},
 			},
 			wantRoot: nil,
-			wantErr:  fmt.Errorf("dag has cycle at: child1"),
+			wantErr:  fmt.Errorf("dag has cycle: child1 -> child2 -> child3 -> child1"),
+		},
+		{
+			caseDesc: "cycle unreachable from start nodes",
+			giveDagIns: &entity.DagInstance{
+				BaseInfo: entity.BaseInfo{
+					ID: "id",
+				},
+			},
+			giveTasks: []*entity.TaskInstance{
+				{
+					TaskID: "root",
+				},
+				{
+					TaskID:   "child1",
+					DependOn: []string{"child2"},
+				},
+				{
+					TaskID:   "child2",
+					DependOn: []string{"child1"},
+				},
+			},
+			wantRoot: nil,
+			wantErr:  fmt.Errorf("dag has cycle: child1 -> child2 -> child1"),
 		},
 		{
 			caseDesc: "branch should not error",
@@ -317,20 +369,24 @@ func TestBuildRootNode(t *testing.T) {
 				children: []*TaskNode{
 					{
 						TaskInsID: "root",
+						GraphID:   "root",
 						children: []*TaskNode{
 							{
 								TaskInsID: "child1",
+								GraphID:   "child1",
 								children: []*TaskNode{
-									{TaskInsID: "child4"},
+									{TaskInsID: "child4", GraphID: "child4"},
 								},
 							},
 							{
 								TaskInsID: "child2",
+								GraphID:   "child2",
 								children: []*TaskNode{
 									{
 										TaskInsID: "child3",
+										GraphID:   "child3",
 										children: []*TaskNode{
-											{TaskInsID: "child4"},
+											{TaskInsID: "child4", GraphID: "child4"},
 										},
 									},
 								},
@@ -354,7 +410,131 @@ func TestBuildRootNode(t *testing.T) {
 	}
 }
 
+func TestBuildRootNode_LargeGraph(t *testing.T) {
+	// every task depends on its previous two tasks, and the last one makes a cycle back to the second
+	cnt := 100000
+	var tasks []entity.Task
+	for i := 0; i < cnt; i++ {
+		task := entity.Task{ID: fmt.Sprintf("t%d", i)}
+		if i > 0 {
+			task.DependOn = append(task.DependOn, fmt.Sprintf("t%d", i-1))
+		}
+		if i > 1 {
+			task.DependOn = append(task.DependOn, fmt.Sprintf("t%d", i-2))
+		}
+		tasks = append(tasks, task)
+	}
+	_, err := BuildRootNode(MapTasksToGetter(tasks))
+	assert.NoError(t, err)
+
+	tasks[1].DependOn = append(tasks[1].DependOn, fmt.Sprintf("t%d", cnt-1))
+	_, err = BuildRootNode(MapTasksToGetter(tasks))
+	if assert.Error(t, err) {
+		assert.True(t, strings.HasPrefix(err.Error(), "dag has cycle: t1 -> t2 -> t3"))
+		assert.True(t, strings.HasSuffix(err.Error(), fmt.Sprintf("t%d -> t1", cnt-1)))
+	}
+}
+
+func TestTaskTree_TopoOrder(t *testing.T) {
+	tests := []struct {
+		caseDesc  string
+		giveTasks []entity.Task
+		wantOrder []string
+	}{
+		{
+			caseDesc: "ties are ordered by graph id",
+			giveTasks: []entity.Task{
+				{ID: "c"},
+				{ID: "a"},
+				{ID: "d", DependOn: []string{"c", "a"}},
+				{ID: "b", DependOn: []string{"a"}},
+			},
+			wantOrder: []string{"a", "b", "c", "d"},
+		},
+		{
+			caseDesc: "downstream waits for all upstream",
+			giveTasks: []entity.Task{
+				{ID: "z"},
+				{ID: "y", DependOn: []string{"z"}},
+				{ID: "x", DependOn: []string{"y"}},
+				{ID: "a", DependOn: []string{"x", "z"}},
+			},
+			wantOrder: []string{"z", "y", "x", "a"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			tree := &TaskTree{Root: MustBuildRootNode(MapTasksToGetter(tc.giveTasks))}
+			var order []string
+			for _, n := range tree.TopoOrder() {
+				order = append(order, n.GraphID)
+			}
+			assert.Equal(t, tc.wantOrder, order)
+		})
+	}
+}
+
+func TestTaskNode_UpstreamBranchSkipped(t *testing.T) {
+	root := MustBuildRootNode(MapTasksToGetter([]entity.Task{
+		{ID: "route"},
+		{ID: "left", DependOn: []string{"route"}},
+		{ID: "right", DependOn: []string{"route"}},
+		{ID: "left-next", DependOn: []string{"left"}},
+		{ID: "join", DependOn: []string{"left", "right"}},
+	}))
+	left, ok := root.FindNode("left")
+	assert.True(t, ok)
+	left.BranchSkipped = true
+
+	tests := []struct {
+		caseDesc string
+		giveID   string
+		wantRet  bool
+	}{
+		{caseDesc: "no parent", giveID: "route", wantRet: false},
+		{caseDesc: "parent not skipped", giveID: "right", wantRet: false},
+		{caseDesc: "all parents skipped", giveID: "left-next", wantRet: true},
+		{caseDesc: "one of parents skipped", giveID: "join", wantRet: false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			node, ok := root.FindNode(tc.giveID)
+			assert.True(t, ok)
+			assert.Equal(t, tc.wantRet, node.UpstreamBranchSkipped())
+		})
+	}
+
+	_, ok = root.FindNode("not-existed")
+	assert.False(t, ok)
+}
+
+func TestTaskNode_Expand(t *testing.T) {
+	root := MustBuildRootNode(MapTaskInsToGetter([]*entity.TaskInstance{
+		{BaseInfo: entity.BaseInfo{ID: "list"}, TaskID: "list", Status: entity.TaskInstanceStatusInit},
+		{BaseInfo: entity.BaseInfo{ID: "map"}, TaskID: "map", Status: entity.TaskInstanceStatusInit, DependOn: []string{"list"}},
+		{BaseInfo: entity.BaseInfo{ID: "next"}, TaskID: "next", Status: entity.TaskInstanceStatusInit, DependOn: []string{"map"}},
+	}))
+	node, ok := root.FindNode("map")
+	assert.True(t, ok)
+	node.Expand([]*TaskNode{
+		{TaskInsID: "map-0", Status: entity.TaskInstanceStatusInit},
+		{TaskInsID: "map-1", Status: entity.TaskInstanceStatusInit},
+	})
+
+	ids, find := root.GetNextTaskIds(&entity.TaskInstance{BaseInfo: entity.BaseInfo{ID: "list"}, Status: entity.TaskInstanceStatusSuccess})
+	assert.True(t, find)
+	assert.Equal(t, []string{"map-0", "map-1"}, ids)
+	ids, _ = root.GetNextTaskIds(&entity.TaskInstance{BaseInfo: entity.BaseInfo{ID: "map-0"}, Status: entity.TaskInstanceStatusSuccess})
+	assert.Empty(t, ids, "map should wait for all mapped tasks")
+	ids, _ = root.GetNextTaskIds(&entity.TaskInstance{BaseInfo: entity.BaseInfo{ID: "map-1"}, Status: entity.TaskInstanceStatusSuccess})
+	assert.Equal(t, []string{"map"}, ids)
+}
+
 func checkParentAndRemoveIt(t *testing.T, node, pNode *TaskNode) {
+	// the index of root is checked by TaskTree.GetNode
+	node.index = nil
 	if pNode != nil {
 		find := false
 		var newParents []*TaskNode
@@ -412,10 +592,11 @@ func TestTaskNode_GetNextTaskIds(t *testing.T) {
 			},
 			wantTaskNode: &TaskNode{
 				TaskInsID: "root",
+				GraphID:   "root",
 				Status:    entity.TaskInstanceStatusSuccess,
 				children: []*TaskNode{
-					{TaskInsID: "child1", Status: entity.TaskInstanceStatusRunning},
-					{TaskInsID: "child2", Status: entity.TaskInstanceStatusInit},
+					{TaskInsID: "child1", GraphID: "child1", Status: entity.TaskInstanceStatusRunning},
+					{TaskInsID: "child2", GraphID: "child2", Status: entity.TaskInstanceStatusInit},
 				},
 			},
 			wantRet: []string{
@@ -449,10 +630,11 @@ func TestTaskNode_GetNextTaskIds(t *testing.T) {
 			},
 			wantTaskNode: &TaskNode{
 				TaskInsID: "root",
+				GraphID:   "root",
 				Status:    entity.TaskInstanceStatusSuccess,
 				children: []*TaskNode{
-					{TaskInsID: "child1", Status: entity.TaskInstanceStatusSkipped, children: []*TaskNode{
-						{TaskInsID: "child2", Status: entity.TaskInstanceStatusInit},
+					{TaskInsID: "child1", GraphID: "child1", Status: entity.TaskInstanceStatusSkipped, children: []*TaskNode{
+						{TaskInsID: "child2", GraphID: "child2", Status: entity.TaskInstanceStatusInit},
 					}},
 				},
 			},
@@ -487,10 +669,11 @@ func TestTaskNode_GetNextTaskIds(t *testing.T) {
 			},
 			wantTaskNode: &TaskNode{
 				TaskInsID: "root",
+				GraphID:   "root",
 				Status:    entity.TaskInstanceStatusFailed,
 				children: []*TaskNode{
-					{TaskInsID: "child1", Status: entity.TaskInstanceStatusInit},
-					{TaskInsID: "child2", Status: entity.TaskInstanceStatusInit},
+					{TaskInsID: "child1", GraphID: "child1", Status: entity.TaskInstanceStatusInit},
+					{TaskInsID: "child2", GraphID: "child2", Status: entity.TaskInstanceStatusInit},
 				},
 			},
 			wantFind: true,
@@ -521,10 +704,11 @@ func TestTaskNode_GetNextTaskIds(t *testing.T) {
 			},
 			wantTaskNode: &TaskNode{
 				TaskInsID: "root",
+				GraphID:   "root",
 				Status:    entity.TaskInstanceStatusBlocked,
 				children: []*TaskNode{
-					{TaskInsID: "child1", Status: entity.TaskInstanceStatusInit},
-					{TaskInsID: "child2", Status: entity.TaskInstanceStatusInit},
+					{TaskInsID: "child1", GraphID: "child1", Status: entity.TaskInstanceStatusInit},
+					{TaskInsID: "child2", GraphID: "child2", Status: entity.TaskInstanceStatusInit},
 				},
 			},
 			wantFind: true,
@@ -575,15 +759,16 @@ func TestTaskNode_GetNextTaskIds(t *testing.T) {
 			},
 			wantTaskNode: &TaskNode{
 				TaskInsID: "root",
+				GraphID:   "root",
 				Status:    entity.TaskInstanceStatusSuccess,
 				children: []*TaskNode{
-					{TaskInsID: "child1", Status: entity.TaskInstanceStatusSuccess, children: []*TaskNode{
-						{TaskInsID: "c1-child1", Status: entity.TaskInstanceStatusEnding},
-						{TaskInsID: "c1-child2", Status: entity.TaskInstanceStatusEnding},
+					{TaskInsID: "child1", GraphID: "child1", Status: entity.TaskInstanceStatusSuccess, children: []*TaskNode{
+						{TaskInsID: "c1-child1", GraphID: "c1-child1", Status: entity.TaskInstanceStatusEnding},
+						{TaskInsID: "c1-child2", GraphID: "c1-child2", Status: entity.TaskInstanceStatusEnding},
 					}},
-					{TaskInsID: "child2", Status: entity.TaskInstanceStatusInit, children: []*TaskNode{
-						{TaskInsID: "c2-child1", Status: entity.TaskInstanceStatusEnding},
-						{TaskInsID: "c2-child2", Status: entity.TaskInstanceStatusEnding},
+					{TaskInsID: "child2", GraphID: "child2", Status: entity.TaskInstanceStatusInit, children: []*TaskNode{
+						{TaskInsID: "c2-child1", GraphID: "c2-child1", Status: entity.TaskInstanceStatusEnding},
+						{TaskInsID: "c2-child2", GraphID: "c2-child2", Status: entity.TaskInstanceStatusEnding},
 					}},
 				},
 			},
@@ -639,15 +824,16 @@ func TestTaskNode_GetNextTaskIds(t *testing.T) {
 			},
 			wantTaskNode: &TaskNode{
 				TaskInsID: "root",
+				GraphID:   "root",
 				Status:    entity.TaskInstanceStatusRunning,
 				children: []*TaskNode{
-					{TaskInsID: "child1", Status: entity.TaskInstanceStatusInit, children: []*TaskNode{
-						{TaskInsID: "c1-child1", Status: entity.TaskInstanceStatusEnding},
-						{TaskInsID: "c1-child2", Status: entity.TaskInstanceStatusEnding},
+					{TaskInsID: "child1", GraphID: "child1", Status: entity.TaskInstanceStatusInit, children: []*TaskNode{
+						{TaskInsID: "c1-child1", GraphID: "c1-child1", Status: entity.TaskInstanceStatusEnding},
+						{TaskInsID: "c1-child2", GraphID: "c1-child2", Status: entity.TaskInstanceStatusEnding},
 					}},
-					{TaskInsID: "child2", Status: entity.TaskInstanceStatusInit, children: []*TaskNode{
-						{TaskInsID: "c2-child1", Status: entity.TaskInstanceStatusEnding},
-						{TaskInsID: "c2-child2", Status: entity.TaskInstanceStatusEnding},
+					{TaskInsID: "child2", GraphID: "child2", Status: entity.TaskInstanceStatusInit, children: []*TaskNode{
+						{TaskInsID: "c2-child1", GraphID: "c2-child1", Status: entity.TaskInstanceStatusEnding},
+						{TaskInsID: "c2-child2", GraphID: "c2-child2", Status: entity.TaskInstanceStatusEnding},
 					}},
 				},
 			},
@@ -699,15 +885,16 @@ func TestTaskNode_GetNextTaskIds(t *testing.T) {
 			},
 			wantTaskNode: &TaskNode{
 				TaskInsID: "root",
+				GraphID:   "root",
 				Status:    entity.TaskInstanceStatusSuccess,
 				children: []*TaskNode{
-					{TaskInsID: "child1", Status: entity.TaskInstanceStatusSuccess, children: []*TaskNode{
-						{TaskInsID: "c1-child1", Status: entity.TaskInstanceStatusSuccess},
-						{TaskInsID: "c1-child2", Status: entity.TaskInstanceStatusEnding},
+					{TaskInsID: "child1", GraphID: "child1", Status: entity.TaskInstanceStatusSuccess, children: []*TaskNode{
+						{TaskInsID: "c1-child1", GraphID: "c1-child1", Status: entity.TaskInstanceStatusSuccess},
+						{TaskInsID: "c1-child2", GraphID: "c1-child2", Status: entity.TaskInstanceStatusEnding},
 					}},
-					{TaskInsID: "child2", Status: entity.TaskInstanceStatusInit, children: []*TaskNode{
-						{TaskInsID: "c2-child1", Status: entity.TaskInstanceStatusEnding},
-						{TaskInsID: "c2-child2", Status: entity.TaskInstanceStatusEnding},
+					{TaskInsID: "child2", GraphID: "child2", Status: entity.TaskInstanceStatusInit, children: []*TaskNode{
+						{TaskInsID: "c2-child1", GraphID: "c2-child1", Status: entity.TaskInstanceStatusEnding},
+						{TaskInsID: "c2-child2", GraphID: "c2-child2", Status: entity.TaskInstanceStatusEnding},
 					}},
 				},
 			},
@@ -744,11 +931,12 @@ func TestTaskNode_GetNextTaskIds(t *testing.T) {
 			},
 			wantTaskNode: &TaskNode{
 				TaskInsID: "root",
+				GraphID:   "root",
 				Status:    entity.TaskInstanceStatusSuccess,
 				children: []*TaskNode{
-					{TaskInsID: "child1", Status: entity.TaskInstanceStatusInit, children: []*TaskNode{
-						{TaskInsID: "c1-child1", Status: entity.TaskInstanceStatusInit},
-						{TaskInsID: "c1-child2", Status: entity.TaskInstanceStatusInit},
+					{TaskInsID: "child1", GraphID: "child1", Status: entity.TaskInstanceStatusInit, children: []*TaskNode{
+						{TaskInsID: "c1-child1", GraphID: "c1-child1", Status: entity.TaskInstanceStatusInit},
+						{TaskInsID: "c1-child2", GraphID: "c1-child2", Status: entity.TaskInstanceStatusInit},
 					}},
 				},
 			},
@@ -773,6 +961,91 @@ func TestTaskNode_GetNextTaskIds(t *testing.T) {
 	}
 }
 
+func TestTaskTree_ApplyTaskChange(t *testing.T) {
+	tests := []struct {
+		caseDesc   string
+		giveTask   *entity.TaskInstance
+		wantRet    []string
+		wantFind   bool
+		wantStatus entity.TaskInstanceStatus
+	}{
+		{
+			caseDesc:   "children executable",
+			giveTask:   &entity.TaskInstance{BaseInfo: entity.BaseInfo{ID: "a"}, Status: entity.TaskInstanceStatusSuccess},
+			wantRet:    []string{"b"},
+			wantFind:   true,
+			wantStatus: entity.TaskInstanceStatusSuccess,
+		},
+		{
+			caseDesc:   "other parent not completed",
+			giveTask:   &entity.TaskInstance{BaseInfo: entity.BaseInfo{ID: "b"}, Status: entity.TaskInstanceStatusSuccess},
+			wantFind:   true,
+			wantStatus: entity.TaskInstanceStatusSuccess,
+		},
+		{
+			caseDesc:   "retry",
+			giveTask:   &entity.TaskInstance{BaseInfo: entity.BaseInfo{ID: "c"}, Status: entity.TaskInstanceStatusInit},
+			wantRet:    []string{"c"},
+			wantFind:   true,
+			wantStatus: entity.TaskInstanceStatusInit,
+		},
+		{
+			caseDesc: "not found",
+			giveTask: &entity.TaskInstance{BaseInfo: entity.BaseInfo{ID: "z"}, Status: entity.TaskInstanceStatusSuccess},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			root := MustBuildRootNode(MapMockTasksToGetter([]*MockTaskInfoGetter{
+				{ID: "a", Status: entity.TaskInstanceStatusRunning},
+				{ID: "b", Status: entity.TaskInstanceStatusInit, Depend: []string{"a"}},
+				{ID: "c", Status: entity.TaskInstanceStatusRunning},
+				{ID: "d", Status: entity.TaskInstanceStatusInit, Depend: []string{"b", "c"}},
+			}))
+			tree := NewTaskTree(&entity.DagInstance{}, root)
+			ret, find := tree.ApplyTaskChange(tc.giveTask)
+			assert.Equal(t, tc.wantRet, ret)
+			assert.Equal(t, tc.wantFind, find)
+			if find {
+				n, _ := tree.GetNode(tc.giveTask.ID)
+				assert.Equal(t, tc.wantStatus, n.Status)
+			}
+		})
+	}
+}
+
+func TestTaskTree_GetNode(t *testing.T) {
+	root := MustBuildRootNode(MapMockTasksToGetter([]*MockTaskInfoGetter{
+		{ID: "a", Status: entity.TaskInstanceStatusRunning},
+	}))
+	// the index built by BuildRootNode is used
+	assert.Len(t, root.index, 1)
+	tree := NewTaskTree(&entity.DagInstance{}, root)
+	n, ok := tree.GetNode("a")
+	assert.True(t, ok)
+	assert.Equal(t, "a", n.TaskInsID)
+
+	// the expanded nodes are indexed when expanding
+	tree.Expand(n, []*TaskNode{{TaskInsID: "a-0", GraphID: "a-0"}})
+	mapped, ok := tree.GetNode("a-0")
+	assert.True(t, ok)
+	assert.Equal(t, "a-0", mapped.TaskInsID)
+
+	// a miss does not walk the tree
+	n.Expand([]*TaskNode{{TaskInsID: "a-1", GraphID: "a-1"}})
+	_, ok = tree.GetNode("a-1")
+	assert.False(t, ok)
+
+	_, ok = tree.GetNode(virtualTaskRootID)
+	assert.False(t, ok)
+
+	// the index is built once for the tree which is not created by NewTaskTree
+	tree = &TaskTree{Root: root}
+	_, ok = tree.GetNode("a-1")
+	assert.True(t, ok)
+}
+
 func TestTaskNode_GetExecutableTaskIds(t *testing.T) {
 	tests := []struct {
 		caseDesc  string
@@ -1023,6 +1296,30 @@ func TestTaskNode_Executable(t *testing.T) {
 			},
 			wantRet: true,
 		},
+		{
+			caseDesc: "one success task has running parent",
+			giveTaskNode: &TaskNode{
+				Status:      entity.TaskInstanceStatusInit,
+				TriggerRule: entity.TriggerRuleOneSuccess,
+				parents: []*TaskNode{
+					{Status: entity.TaskInstanceStatusSuccess},
+					{Status: entity.TaskInstanceStatusRunning},
+				},
+			},
+			wantRet: true,
+		},
+		{
+			caseDesc: "all done task has failed parent",
+			giveTaskNode: &TaskNode{
+				Status:      entity.TaskInstanceStatusInit,
+				TriggerRule: entity.TriggerRuleAllDone,
+				parents: []*TaskNode{
+					{Status: entity.TaskInstanceStatusSuccess},
+					{Status: entity.TaskInstanceStatusFailed},
+				},
+			},
+			wantRet: true,
+		},
 	}
 
 	for _, tc := range tests {
@@ -1031,3 +1328,134 @@ func TestTaskNode_Executable(t *testing.T) {
 		})
 	}
 }
+
+func TestTaskNode_CanBeExecuted(t *testing.T) {
+	tests := []struct {
+		caseDesc     string
+		giveRule     entity.TriggerRule
+		giveParents  []entity.TaskInstanceStatus
+		wantExecuted bool
+		wantMayBe    bool
+	}{
+		{
+			caseDesc:     "all success",
+			giveParents:  []entity.TaskInstanceStatus{entity.TaskInstanceStatusSuccess, entity.TaskInstanceStatusSkipped},
+			wantExecuted: true,
+			wantMayBe:    true,
+		},
+		{
+			caseDesc:    "all success has running parent",
+			giveRule:    entity.TriggerRuleAllSuccess,
+			giveParents: []entity.TaskInstanceStatus{entity.TaskInstanceStatusSuccess, entity.TaskInstanceStatusRunning},
+			wantMayBe:   true,
+		},
+		{
+			caseDesc:    "all success has failed parent",
+			giveParents: []entity.TaskInstanceStatus{entity.TaskInstanceStatusSuccess, entity.TaskInstanceStatusFailed},
+		},
+		{
+			caseDesc:     "one success",
+			giveRule:     entity.TriggerRuleOneSuccess,
+			giveParents:  []entity.TaskInstanceStatus{entity.TaskInstanceStatusFailed, entity.TaskInstanceStatusSuccess},
+			wantExecuted: true,
+			wantMayBe:    true,
+		},
+		{
+			caseDesc:    "one success has running parent",
+			giveRule:    entity.TriggerRuleOneSuccess,
+			giveParents: []entity.TaskInstanceStatus{entity.TaskInstanceStatusFailed, entity.TaskInstanceStatusRunning},
+			wantMayBe:   true,
+		},
+		{
+			caseDesc:    "one success has all parents failed",
+			giveRule:    entity.TriggerRuleOneSuccess,
+			giveParents: []entity.TaskInstanceStatus{entity.TaskInstanceStatusFailed, entity.TaskInstanceStatusCanceled},
+		},
+		{
+			caseDesc:     "all done",
+			giveRule:     entity.TriggerRuleAllDone,
+			giveParents:  []entity.TaskInstanceStatus{entity.TaskInstanceStatusFailed, entity.TaskInstanceStatusCanceled, entity.TaskInstanceStatusSuccess},
+			wantExecuted: true,
+			wantMayBe:    true,
+		},
+		{
+			caseDesc:    "all done has blocked parent",
+			giveRule:    entity.TriggerRuleAllDone,
+			giveParents: []entity.TaskInstanceStatus{entity.TaskInstanceStatusFailed, entity.TaskInstanceStatusBlocked},
+			wantMayBe:   true,
+		},
+		{
+			caseDesc:     "none failed",
+			giveRule:     entity.TriggerRuleNoneFailed,
+			giveParents:  []entity.TaskInstanceStatus{entity.TaskInstanceStatusCanceled, entity.TaskInstanceStatusSkipped},
+			wantExecuted: true,
+			wantMayBe:    true,
+		},
+		{
+			caseDesc:    "none failed has failed parent",
+			giveRule:    entity.TriggerRuleNoneFailed,
+			giveParents: []entity.TaskInstanceStatus{entity.TaskInstanceStatusSuccess, entity.TaskInstanceStatusFailed},
+		},
+		{
+			caseDesc:    "none failed has invalid params parent",
+			giveRule:    entity.TriggerRuleNoneFailed,
+			giveParents: []entity.TaskInstanceStatus{entity.TaskInstanceStatusSuccess, entity.TaskInstanceStatusInvalidParams},
+		},
+		{
+			caseDesc:     "all done has invalid params parent",
+			giveRule:     entity.TriggerRuleAllDone,
+			giveParents:  []entity.TaskInstanceStatus{entity.TaskInstanceStatusInvalidParams, entity.TaskInstanceStatusSuccess},
+			wantExecuted: true,
+			wantMayBe:    true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			node := &TaskNode{Status: entity.TaskInstanceStatusInit, TriggerRule: tc.giveRule}
+			for _, sts := range tc.giveParents {
+				node.AppendParent(&TaskNode{Status: sts})
+			}
+			assert.Equal(t, tc.wantExecuted, node.CanBeExecuted())
+			assert.Equal(t, tc.wantMayBe, node.MayBeExecuted())
+		})
+	}
+}
+
+func TestTaskNode_FailureTolerated(t *testing.T) {
+	tests := []struct {
+		caseDesc      string
+		giveRules     []entity.TriggerRule
+		wantTolerated bool
+	}{
+		{
+			caseDesc: "no child",
+		},
+		{
+			caseDesc:      "all children tolerate",
+			giveRules:     []entity.TriggerRule{entity.TriggerRuleAllDone, entity.TriggerRuleOneSuccess},
+			wantTolerated: true,
+		},
+		{
+			caseDesc:  "default child",
+			giveRules: []entity.TriggerRule{entity.TriggerRuleAllDone, ""},
+		},
+		{
+			caseDesc:  "none failed child",
+			giveRules: []entity.TriggerRule{entity.TriggerRuleNoneFailed},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			failed := &TaskNode{Status: entity.TaskInstanceStatusFailed}
+			running := &TaskNode{Status: entity.TaskInstanceStatusRunning}
+			for _, rule := range tc.giveRules {
+				c := &TaskNode{Status: entity.TaskInstanceStatusInit, TriggerRule: rule}
+				for _, p := range []*TaskNode{failed, running} {
+					p.AppendChild(c)
+					c.AppendParent(p)
+				}
+			}
+			assert.Equal(t, tc.wantTolerated, failed.FailureTolerated())
+		})
+	}
+}
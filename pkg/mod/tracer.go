@@ -0,0 +1,25 @@
+package mod
+
+import (
+	"github.com/etherealiy/fastflow/pkg/entity"
+)
+
+var defTaskTracer TaskTracer
+
+// TaskTracer trace the execution of task instances, such as pkg/tracing, it is nil by default
+type TaskTracer interface {
+	// StartTask is called before running the action of task instance, the span can be attached to the execute
+	// context of task instance, so actions can add their own spans. The returned func is called after
+	// the task instance is executed, the result is in the status and reason of task instance.
+	StartTask(taskIns *entity.TaskInstance) (end func())
+}
+
+// SetTaskTracer
+func SetTaskTracer(t TaskTracer) {
+	defTaskTracer = t
+}
+
+// GetTaskTracer
+func GetTaskTracer() TaskTracer {
+	return defTaskTracer
+}
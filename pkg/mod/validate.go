@@ -0,0 +1,340 @@
+package mod
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/entity/run"
+	"github.com/etherealiy/fastflow/pkg/utils/value"
+)
+
+// DagViolationType
+type DagViolationType string
+
+const (
+	// DagViolationDuplicateID means more than one task has the same id
+	DagViolationDuplicateID DagViolationType = "duplicateId"
+	// DagViolationMissingDepend means the task depends on a task which is not defined
+	DagViolationMissingDepend DagViolationType = "missingDepend"
+	// DagViolationUndefinedAction means the action of task is not registered in current process
+	DagViolationUndefinedAction DagViolationType = "undefinedAction"
+	// DagViolationNoStart means there is no task which does not depend on others
+	DagViolationNoStart DagViolationType = "noStart"
+	// DagViolationCycle means the tasks depend on each other
+	DagViolationCycle DagViolationType = "cycle"
+	// DagViolationUnreachable means the task depends on a cycle, so it never runs
+	DagViolationUnreachable DagViolationType = "unreachable"
+	// DagViolationMissingEnd means the dag has the END task but the task is not followed by it,
+	// the dag instance succeeds when END task succeeds, so the task may be left unfinished
+	DagViolationMissingEnd DagViolationType = "missingEnd"
+	// DagViolationInvalidMatrix means the matrix of task cannot be expanded
+	DagViolationInvalidMatrix DagViolationType = "invalidMatrix"
+	// DagViolationInvalidHook means the hook tasks of dag are invalid
+	DagViolationInvalidHook DagViolationType = "invalidHook"
+	// DagViolationInvalidParams means the params of task cannot be decoded into the parameter of its action
+	DagViolationInvalidParams DagViolationType = "invalidParams"
+)
+
+// DagViolation
+type DagViolation struct {
+	Type DagViolationType `json:"type"`
+	// TaskIDs is the tasks which violate the rule, for a cycle it is the tasks on the cycle in order
+	TaskIDs []string `json:"taskIds,omitempty"`
+	Message string   `json:"message"`
+}
+
+// String
+func (v DagViolation) String() string {
+	return fmt.Sprintf("%s: %s", v.Type, v.Message)
+}
+
+// ValidateDag check the tasks of dag and return all violations found, nil means the dag is valid.
+// Unlike building the task tree, it does not stop at the first error, so it can be used to show all
+// problems of a dag submitted by users before persisting it.
+// The tasks are checked after the matrix expanded and the dag is not modified.
+// The actions are looked up in the actions registered by fastflow.RegisterAction, so it should be called
+// in the process which registers all actions.
+func ValidateDag(dag *entity.Dag) []DagViolation {
+	expanded := *dag
+	if err := expanded.ExpandMatrix(); err != nil {
+		return []DagViolation{{
+			Type:    DagViolationInvalidMatrix,
+			Message: err.Error(),
+		}}
+	}
+	tasks := expanded.Tasks
+
+	var ret []DagViolation
+	// index is the position of the first task of each id, the duplicated ones are not in graph
+	index := map[string]int{}
+	for i := range tasks {
+		if _, ok := index[tasks[i].ID]; ok {
+			ret = append(ret, DagViolation{
+				Type:    DagViolationDuplicateID,
+				TaskIDs: []string{tasks[i].ID},
+				Message: fmt.Sprintf("task id[%s] is duplicated", tasks[i].ID),
+			})
+			continue
+		}
+		index[tasks[i].ID] = i
+	}
+
+	// children and parents only contain the defined depends
+	children := make([][]int, len(tasks))
+	parents := make([][]int, len(tasks))
+	for i := range tasks {
+		if index[tasks[i].ID] != i {
+			continue
+		}
+		for _, dep := range tasks[i].DependOn {
+			p, ok := index[dep]
+			if !ok {
+				ret = append(ret, DagViolation{
+					Type:    DagViolationMissingDepend,
+					TaskIDs: []string{tasks[i].ID},
+					Message: fmt.Sprintf("task[%s] depends on undefined task[%s]", tasks[i].ID, dep),
+				})
+				continue
+			}
+			children[p] = append(children[p], i)
+			parents[i] = append(parents[i], p)
+		}
+	}
+
+	for i := range tasks {
+		if index[tasks[i].ID] != i || tasks[i].SubDag != nil {
+			continue
+		}
+		act, ok := ActionMap[tasks[i].ActionName]
+		if !ok {
+			ret = append(ret, DagViolation{
+				Type:    DagViolationUndefinedAction,
+				TaskIDs: []string{tasks[i].ID},
+				Message: fmt.Sprintf("action[%s] of task[%s] is not registered", tasks[i].ActionName, tasks[i].ID),
+			})
+			continue
+		}
+		if err := validateParams(tasks[i].Params, act); err != nil {
+			ret = append(ret, DagViolation{
+				Type:    DagViolationInvalidParams,
+				TaskIDs: []string{tasks[i].ID},
+				Message: fmt.Sprintf("params of task[%s] are invalid: %s", tasks[i].ID, err),
+			})
+		}
+	}
+
+	if expanded.Hooks != nil {
+		if err := expanded.Hooks.Validate(tasks); err != nil {
+			ret = append(ret, DagViolation{
+				Type:    DagViolationInvalidHook,
+				Message: err.Error(),
+			})
+		}
+		for _, hook := range []entity.DagHook{entity.DagHookSuccess, entity.DagHookFailure, entity.DagHookCancel} {
+			for _, t := range expanded.Hooks.Tasks(hook) {
+				if _, ok := ActionMap[t.ActionName]; !ok && t.SubDag == nil {
+					ret = append(ret, DagViolation{
+						Type:    DagViolationUndefinedAction,
+						TaskIDs: []string{t.ID},
+						Message: fmt.Sprintf("action[%s] of %s hook task[%s] is not registered", t.ActionName, hook, t.ID),
+					})
+				}
+			}
+		}
+	}
+
+	hasStart := false
+	for i := range tasks {
+		if index[tasks[i].ID] == i && len(tasks[i].DependOn) == 0 {
+			hasStart = true
+			break
+		}
+	}
+	if !hasStart {
+		ret = append(ret, DagViolation{
+			Type:    DagViolationNoStart,
+			Message: "there is no task which does not depend on others",
+		})
+	}
+
+	onCycle := make([]bool, len(tasks))
+	for _, cycle := range findCycles(children) {
+		var ids []string
+		for _, n := range cycle {
+			onCycle[n] = true
+			ids = append(ids, tasks[n].ID)
+		}
+		ret = append(ret, DagViolation{
+			Type:    DagViolationCycle,
+			TaskIDs: ids,
+			Message: fmt.Sprintf("tasks have cycle: %s -> %s", strings.Join(ids, " -> "), ids[0]),
+		})
+	}
+
+	// the tasks whose depends are all reachable are reachable
+	reachable := make([]bool, len(tasks))
+	pending := make([]int, len(tasks))
+	var queue []int
+	for i := range tasks {
+		if index[tasks[i].ID] != i {
+			continue
+		}
+		pending[i] = len(parents[i])
+		if pending[i] == 0 {
+			queue = append(queue, i)
+		}
+	}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		reachable[n] = true
+		for _, c := range children[n] {
+			pending[c]--
+			if pending[c] == 0 {
+				queue = append(queue, c)
+			}
+		}
+	}
+	for i := range tasks {
+		if index[tasks[i].ID] != i || reachable[i] || onCycle[i] {
+			continue
+		}
+		ret = append(ret, DagViolation{
+			Type:    DagViolationUnreachable,
+			TaskIDs: []string{tasks[i].ID},
+			Message: fmt.Sprintf("task[%s] depends on a cycle and never runs", tasks[i].ID),
+		})
+	}
+
+	if end, ok := index[TaskEndID]; ok {
+		// mark the ancestors of END task
+		ancestor := make([]bool, len(tasks))
+		ancestor[end] = true
+		queue = []int{end}
+		for len(queue) > 0 {
+			n := queue[0]
+			queue = queue[1:]
+			for _, p := range parents[n] {
+				if !ancestor[p] {
+					ancestor[p] = true
+					queue = append(queue, p)
+				}
+			}
+		}
+		for i := range tasks {
+			if index[tasks[i].ID] != i || ancestor[i] {
+				continue
+			}
+			ret = append(ret, DagViolation{
+				Type:    DagViolationMissingEnd,
+				TaskIDs: []string{tasks[i].ID},
+				Message: fmt.Sprintf("task[%s] is not followed by task[%s]", tasks[i].ID, TaskEndID),
+			})
+		}
+	}
+	return ret
+}
+
+// findCycles return the strongly connected components which have cycles by iterative tarjan algorithm,
+// the nodes of each component are in the order of a path on the cycle when it is a simple cycle
+func findCycles(children [][]int) [][]int {
+	type frame struct {
+		node int
+		next int
+	}
+
+	var (
+		counter int
+		order   = make([]int, len(children))
+		low     = make([]int, len(children))
+		onStack = make([]bool, len(children))
+		stack   []int
+		ret     [][]int
+	)
+	for start := range children {
+		if order[start] != 0 {
+			continue
+		}
+		counter++
+		order[start], low[start] = counter, counter
+		stack = append(stack, start)
+		onStack[start] = true
+		frames := []*frame{{node: start}}
+		for len(frames) > 0 {
+			top := frames[len(frames)-1]
+			if top.next < len(children[top.node]) {
+				child := children[top.node][top.next]
+				top.next++
+				if order[child] == 0 {
+					counter++
+					order[child], low[child] = counter, counter
+					stack = append(stack, child)
+					onStack[child] = true
+					frames = append(frames, &frame{node: child})
+				} else if onStack[child] && order[child] < low[top.node] {
+					low[top.node] = order[child]
+				}
+				continue
+			}
+
+			frames = frames[:len(frames)-1]
+			if len(frames) > 0 {
+				parent := frames[len(frames)-1].node
+				if low[top.node] < low[parent] {
+					low[parent] = low[top.node]
+				}
+			}
+			if low[top.node] != order[top.node] {
+				continue
+			}
+			// top is the root of a component
+			i := len(stack) - 1
+			for stack[i] != top.node {
+				i--
+			}
+			comp := append([]int{}, stack[i:]...)
+			for _, n := range comp {
+				onStack[n] = false
+			}
+			stack = stack[:i]
+			if len(comp) > 1 || hasSelfLoop(children, comp[0]) {
+				ret = append(ret, comp)
+			}
+		}
+	}
+	return ret
+}
+
+func hasSelfLoop(children [][]int, n int) bool {
+	for _, c := range children[n] {
+		if c == n {
+			return true
+		}
+	}
+	return false
+}
+
+// validateParams decode the params into the parameter of action like executor, the templates and secrets
+// are resolved at runtime, so they are not checked
+func validateParams(params map[string]interface{}, act run.Action) error {
+	paramAct, ok := act.(run.ParameterAction)
+	if !ok || params == nil {
+		return nil
+	}
+	p := paramAct.ParameterNew()
+	if p == nil {
+		return nil
+	}
+	static, _ := copyParamValue(params).(map[string]interface{})
+	err := value.MapValue(static).WalkString(func(walkContext *value.WalkContext, v string) error {
+		if (strings.Contains(v, "{{") && strings.Contains(v, "}}")) || strings.HasPrefix(v, SecretParamPrefix) {
+			walkContext.Setter(nil)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return weakDecode(static, p)
+}
@@ -0,0 +1,108 @@
+package mod
+
+import (
+	"testing"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/entity/run"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateDag(t *testing.T) {
+	task := func(id string, dependOn ...string) entity.Task {
+		return entity.Task{ID: id, ActionName: "act", DependOn: dependOn}
+	}
+	tests := []struct {
+		caseDesc  string
+		giveTasks []entity.Task
+		wantTypes []DagViolationType
+		wantIDs   [][]string
+	}{
+		{
+			caseDesc: "valid",
+			giveTasks: []entity.Task{
+				task("t1"),
+				task("t2", "t1"),
+				{ID: "sub", DependOn: []string{"t1"}, SubDag: &entity.SubDag{DagID: "other"}},
+				task(TaskEndID, "t2", "sub"),
+			},
+		},
+		{
+			caseDesc: "not followed by end",
+			giveTasks: []entity.Task{
+				task("t1"),
+				task("t2", "t1"),
+				task("t3", "t1"),
+				task(TaskEndID, "t2"),
+			},
+			wantTypes: []DagViolationType{DagViolationMissingEnd},
+			wantIDs:   [][]string{{"t3"}},
+		},
+		{
+			caseDesc: "all violations",
+			giveTasks: []entity.Task{
+				task("t1"),
+				task("t1"),
+				task("t2", "t1", "missing"),
+				{ID: "t3", ActionName: "undefined", DependOn: []string{"t2"}},
+				task("c1", "c2"),
+				task("c2", "c1"),
+				task("t4", "c2"),
+			},
+			wantTypes: []DagViolationType{
+				DagViolationDuplicateID,
+				DagViolationMissingDepend,
+				DagViolationUndefinedAction,
+				DagViolationCycle,
+				DagViolationUnreachable,
+			},
+			wantIDs: [][]string{{"t1"}, {"t2"}, {"t3"}, {"c1", "c2"}, {"t4"}},
+		},
+		{
+			caseDesc: "no start",
+			giveTasks: []entity.Task{
+				task("t1", "t1"),
+				task("t2", "t1"),
+			},
+			wantTypes: []DagViolationType{DagViolationNoStart, DagViolationCycle, DagViolationUnreachable},
+			wantIDs:   [][]string{nil, {"t1"}, {"t2"}},
+		},
+		{
+			caseDesc: "invalid params",
+			giveTasks: []entity.Task{
+				{ID: "t1", ActionName: "param", Params: map[string]interface{}{"field1": "1"}},
+				{ID: "t2", ActionName: "param", Params: map[string]interface{}{"field1": "{{.vars.count}}"}},
+				{ID: "t3", ActionName: "param", Params: map[string]interface{}{"field1": "one"}},
+			},
+			wantTypes: []DagViolationType{DagViolationInvalidParams},
+			wantIDs:   [][]string{{"t3"}},
+		},
+		{
+			caseDesc: "invalid matrix",
+			giveTasks: []entity.Task{
+				{ID: "t1", ActionName: "act", Matrix: entity.TaskMatrix{"a": {}}},
+			},
+			wantTypes: []DagViolationType{DagViolationInvalidMatrix},
+			wantIDs:   [][]string{nil},
+		},
+	}
+
+	oldActionMap := ActionMap
+	paramAct := &run.MockAction{}
+	paramAct.On("ParameterNew").Return(NewTestParamInt)
+	ActionMap = map[string]run.Action{"act": &run.MockAction{}, "param": paramAct}
+	defer func() { ActionMap = oldActionMap }()
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			ret := ValidateDag(&entity.Dag{BaseInfo: entity.BaseInfo{ID: "dag"}, Tasks: tc.giveTasks})
+			var types []DagViolationType
+			var ids [][]string
+			for _, v := range ret {
+				types = append(types, v.Type)
+				ids = append(ids, v.TaskIDs)
+			}
+			assert.Equal(t, tc.wantTypes, types)
+			assert.Equal(t, tc.wantIDs, ids)
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package mod
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+)
+
+var statusWalkWorkers int32
+
+// SetStatusWalkWorkers set the count of goroutines which walk the task tree in parallel when computing
+// the status of a dag instance, 0 or 1 means walking sequentially
+func SetStatusWalkWorkers(n int) {
+	atomic.StoreInt32(&statusWalkWorkers, int32(n))
+}
+
+// GetStatusWalkWorkers
+func GetStatusWalkWorkers() int {
+	return int(atomic.LoadInt32(&statusWalkWorkers))
+}
+
+// parallelWalkMinBatch is the min count of nodes handled by a worker, the smaller levels are walked
+// by the caller, because dispatching them costs more than walking
+var parallelWalkMinBatch = 512
+
+// levelResult is what found by walking a batch of a level
+type levelResult struct {
+	// running means a node not completed is found
+	running bool
+	// decided means a failed or blocked node is found
+	decided bool
+	next    []*TaskNode
+}
+
+func (r *levelResult) merge(o *levelResult) {
+	r.running = r.running || o.running
+	r.decided = r.decided || o.decided
+	r.next = append(r.next, o.next...)
+}
+
+// walkBatch classify the nodes and collect their children which can be executed, like walkStatus
+// it does not go through the nodes which are not completed
+func walkBatch(nodes []*TaskNode) *levelResult {
+	r := &levelResult{next: make([]*TaskNode, 0, len(nodes))}
+	for _, n := range nodes {
+		if n.TaskInsID != virtualTaskRootID {
+			switch n.Status {
+			case entity.TaskInstanceStatusFailed, entity.TaskInstanceStatusInvalidParams,
+				entity.TaskInstanceStatusCanceled:
+				// the children triggered by other rules may still run
+				r.decided = true
+			case entity.TaskInstanceStatusBlocked:
+				r.decided = true
+				continue
+			case entity.TaskInstanceStatusSuccess, entity.TaskInstanceStatusSkipped:
+			default:
+				r.running = true
+				continue
+			}
+		}
+		for _, c := range n.children {
+			if (!n.CanExecuteChild() || len(c.parents) > 1) && !c.CanBeExecuted() {
+				continue
+			}
+			r.next = append(r.next, c)
+		}
+	}
+	return r
+}
+
+// parallelWalkStatus compute the status level by level, each level is split into batches which are
+// walked by a pool of workers, each node is visited once. When a node decides the status, the node
+// reported is picked by dfsStatus, so the result is the same as walkStatus.
+func (t *TaskNode) parallelWalkStatus(workers int) (TreeStatus, string) {
+	type job struct {
+		nodes []*TaskNode
+		ret   *levelResult
+		wg    *sync.WaitGroup
+	}
+	jobs := make(chan job)
+	defer close(jobs)
+	for i := 0; i < workers; i++ {
+		go func() {
+			for j := range jobs {
+				*j.ret = *walkBatch(j.nodes)
+				j.wg.Done()
+			}
+		}()
+	}
+
+	decided := false
+	visited := map[*TaskNode]bool{}
+	level := []*TaskNode{t}
+	for len(level) > 0 {
+		var r *levelResult
+		batch := (len(level) + workers - 1) / workers
+		if batch < parallelWalkMinBatch {
+			r = walkBatch(level)
+		} else {
+			wg := &sync.WaitGroup{}
+			var rets []*levelResult
+			for start := 0; start < len(level); start += batch {
+				end := start + batch
+				if end > len(level) {
+					end = len(level)
+				}
+				ret := &levelResult{}
+				rets = append(rets, ret)
+				wg.Add(1)
+				jobs <- job{nodes: level[start:end], ret: ret, wg: wg}
+			}
+			wg.Wait()
+			r = &levelResult{next: make([]*TaskNode, 0, len(level))}
+			for _, ret := range rets {
+				r.merge(ret)
+			}
+		}
+
+		if r.running {
+			decided = true
+			break
+		}
+		decided = decided || r.decided
+
+		// only the joins can be reached from more than one node
+		level = make([]*TaskNode, 0, len(r.next))
+		for _, n := range r.next {
+			if len(n.parents) > 1 {
+				if visited[n] {
+					continue
+				}
+				visited[n] = true
+			}
+			level = append(level, n)
+		}
+	}
+
+	if !decided {
+		return TreeStatusSuccess, ""
+	}
+	ret := dfsStatus(t, map[*TaskNode]dfsResult{})
+	switch {
+	case ret.running != nil:
+		return TreeStatusRunning, ret.running.TaskInsID
+	case ret.last.Status == entity.TaskInstanceStatusBlocked:
+		return TreeStatusBlocked, ret.last.TaskInsID
+	default:
+		return TreeStatusFailed, ret.last.TaskInsID
+	}
+}
+
+// dfsResult is what walking a node by dfsWalk finds, a running node stops the walk, otherwise last is
+// the last failed or blocked node
+type dfsResult struct {
+	running *TaskNode
+	last    *TaskNode
+}
+
+// dfsStatus find the node which decides the status in the same order as walkStatus, the result of
+// each node is memorized, so the joins are walked once
+func dfsStatus(n *TaskNode, memo map[*TaskNode]dfsResult) dfsResult {
+	if r, ok := memo[n]; ok {
+		return r
+	}
+	r := dfsResult{}
+	if n.TaskInsID != virtualTaskRootID {
+		switch n.Status {
+		case entity.TaskInstanceStatusFailed, entity.TaskInstanceStatusInvalidParams,
+			entity.TaskInstanceStatusCanceled, entity.TaskInstanceStatusBlocked:
+			r.last = n
+		case entity.TaskInstanceStatusSuccess, entity.TaskInstanceStatusSkipped:
+		default:
+			r.running = n
+			memo[n] = r
+			return r
+		}
+	}
+	canExecuteChild := n.CanExecuteChild()
+	if canExecuteChild || n.Done() {
+		for _, c := range n.children {
+			if (!canExecuteChild || len(c.parents) > 1) && !c.CanBeExecuted() {
+				continue
+			}
+			cr := dfsStatus(c, memo)
+			if cr.running != nil {
+				r = cr
+				break
+			}
+			if cr.last != nil {
+				r.last = cr.last
+			}
+		}
+	}
+	memo[n] = r
+	return r
+}
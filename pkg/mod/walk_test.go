@@ -0,0 +1,205 @@
+package mod
+
+import (
+	"fmt"
+	"math/rand"
+	"runtime"
+	"testing"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTaskNode_parallelWalkStatus(t *testing.T) {
+	ins := func(id string, status entity.TaskInstanceStatus, dependOn ...string) *entity.TaskInstance {
+		return &entity.TaskInstance{BaseInfo: entity.BaseInfo{ID: id}, TaskID: id, DependOn: dependOn, Status: status}
+	}
+	tests := []struct {
+		caseDesc    string
+		giveTaskIns []*entity.TaskInstance
+		wantSrcId   string
+		wantStatus  TreeStatus
+	}{
+		{
+			caseDesc: "success",
+			giveTaskIns: []*entity.TaskInstance{
+				ins("task1", entity.TaskInstanceStatusSuccess),
+				ins("task2", entity.TaskInstanceStatusSkipped, "task1"),
+				ins("task3", entity.TaskInstanceStatusSuccess, "task1"),
+				ins("task4", entity.TaskInstanceStatusSuccess, "task2", "task3"),
+			},
+			wantStatus: TreeStatusSuccess,
+		},
+		{
+			caseDesc: "failed",
+			giveTaskIns: []*entity.TaskInstance{
+				ins("task1", entity.TaskInstanceStatusSuccess),
+				ins("task2", entity.TaskInstanceStatusSuccess, "task1"),
+				ins("task3", entity.TaskInstanceStatusFailed, "task1"),
+				ins("task4", entity.TaskInstanceStatusInit, "task2", "task3"),
+			},
+			wantSrcId:  "task3",
+			wantStatus: TreeStatusFailed,
+		},
+		{
+			caseDesc: "blocked",
+			giveTaskIns: []*entity.TaskInstance{
+				ins("task1", entity.TaskInstanceStatusSuccess),
+				ins("task2", entity.TaskInstanceStatusBlocked, "task1"),
+				ins("task3", entity.TaskInstanceStatusSuccess, "task1"),
+			},
+			wantSrcId:  "task2",
+			wantStatus: TreeStatusBlocked,
+		},
+		{
+			caseDesc: "running",
+			giveTaskIns: []*entity.TaskInstance{
+				ins("task1", entity.TaskInstanceStatusSuccess),
+				ins("task2", entity.TaskInstanceStatusFailed, "task1"),
+				ins("task3", entity.TaskInstanceStatusSuccess, "task1"),
+				ins("task4", entity.TaskInstanceStatusRunning, "task3"),
+			},
+			wantSrcId:  "task4",
+			wantStatus: TreeStatusRunning,
+		},
+		{
+			caseDesc: "join not executable",
+			giveTaskIns: []*entity.TaskInstance{
+				ins("task1", entity.TaskInstanceStatusSuccess),
+				ins("task2", entity.TaskInstanceStatusBlocked),
+				ins("task3", entity.TaskInstanceStatusInit, "task1", "task2"),
+			},
+			wantSrcId:  "task2",
+			wantStatus: TreeStatusBlocked,
+		},
+	}
+
+	oldMinBatch := parallelWalkMinBatch
+	parallelWalkMinBatch = 1
+	defer func() { parallelWalkMinBatch = oldMinBatch }()
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			root := MustBuildRootNode(MapTaskInsToGetter(tc.giveTaskIns))
+			status, srcId := root.parallelWalkStatus(4)
+			assert.Equal(t, tc.wantStatus, status)
+			assert.Equal(t, tc.wantSrcId, srcId)
+
+			// the result is the same as walking sequentially
+			seqStatus, seqSrcId := root.walkStatus()
+			assert.Equal(t, seqStatus, status)
+			assert.Equal(t, seqSrcId, srcId)
+		})
+	}
+}
+
+func TestTaskNode_parallelWalkStatusMatchesWalkStatus(t *testing.T) {
+	statuses := []entity.TaskInstanceStatus{
+		entity.TaskInstanceStatusSuccess, entity.TaskInstanceStatusSuccess, entity.TaskInstanceStatusSuccess,
+		entity.TaskInstanceStatusSkipped, entity.TaskInstanceStatusFailed, entity.TaskInstanceStatusCanceled,
+		entity.TaskInstanceStatusBlocked, entity.TaskInstanceStatusInit, entity.TaskInstanceStatusRunning,
+	}
+	rules := []entity.TriggerRule{"", entity.TriggerRuleOneSuccess, entity.TriggerRuleAllDone, entity.TriggerRuleNoneFailed}
+
+	oldMinBatch := parallelWalkMinBatch
+	parallelWalkMinBatch = 1
+	defer func() { parallelWalkMinBatch = oldMinBatch }()
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		var taskIns []*entity.TaskInstance
+		for j := 0; j < 1+r.Intn(30); j++ {
+			ti := &entity.TaskInstance{
+				BaseInfo:    entity.BaseInfo{ID: fmt.Sprintf("task%d", j)},
+				TaskID:      fmt.Sprintf("task%d", j),
+				Status:      statuses[r.Intn(len(statuses))],
+				TriggerRule: rules[r.Intn(len(rules))],
+			}
+			// depend on the tasks before, so there is no cycle
+			for k := 0; j > 0 && k < r.Intn(4); k++ {
+				dep := fmt.Sprintf("task%d", r.Intn(j))
+				if !utils.StringsContain(ti.DependOn, dep) {
+					ti.DependOn = append(ti.DependOn, dep)
+				}
+			}
+			taskIns = append(taskIns, ti)
+		}
+		root := MustBuildRootNode(MapTaskInsToGetter(taskIns))
+
+		wantStatus, wantSrcId := root.walkStatus()
+		status, srcId := root.parallelWalkStatus(4)
+		if !assert.Equal(t, wantStatus, status, "tree %d", i) || !assert.Equal(t, wantSrcId, srcId, "tree %d", i) {
+			return
+		}
+	}
+}
+
+// buildWideTree build a tree of parallel chains, all tasks succeeded
+func buildWideTree(chains, depth int) *TaskNode {
+	var taskIns []*entity.TaskInstance
+	for c := 0; c < chains; c++ {
+		for d := 0; d < depth; d++ {
+			ti := &entity.TaskInstance{
+				BaseInfo: entity.BaseInfo{ID: fmt.Sprintf("c%d-d%d", c, d)},
+				TaskID:   fmt.Sprintf("c%d-d%d", c, d),
+				Status:   entity.TaskInstanceStatusSuccess,
+			}
+			if d > 0 {
+				ti.DependOn = []string{fmt.Sprintf("c%d-d%d", c, d-1)}
+			}
+			taskIns = append(taskIns, ti)
+		}
+	}
+	return MustBuildRootNode(MapTaskInsToGetter(taskIns))
+}
+
+func BenchmarkTaskNode_walkStatus(b *testing.B) {
+	root := buildWideTree(5000, 20)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		root.walkStatus()
+	}
+}
+
+func BenchmarkTaskNode_parallelWalkStatus(b *testing.B) {
+	root := buildWideTree(5000, 20)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		root.parallelWalkStatus(runtime.NumCPU())
+	}
+}
+
+// buildLadderTree build a tree whose each level depends on all tasks of the previous level,
+// all tasks succeeded
+func buildLadderTree(width, depth int) *TaskNode {
+	var taskIns []*entity.TaskInstance
+	for d := 0; d < depth; d++ {
+		for w := 0; w < width; w++ {
+			ti := &entity.TaskInstance{
+				BaseInfo: entity.BaseInfo{ID: fmt.Sprintf("d%d-w%d", d, w)},
+				TaskID:   fmt.Sprintf("d%d-w%d", d, w),
+				Status:   entity.TaskInstanceStatusSuccess,
+			}
+			for p := 0; d > 0 && p < width; p++ {
+				ti.DependOn = append(ti.DependOn, fmt.Sprintf("d%d-w%d", d-1, p))
+			}
+			taskIns = append(taskIns, ti)
+		}
+	}
+	return MustBuildRootNode(MapTaskInsToGetter(taskIns))
+}
+
+func BenchmarkTaskNode_walkStatus_Joins(b *testing.B) {
+	root := buildLadderTree(2, 16)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		root.walkStatus()
+	}
+}
+
+func BenchmarkTaskNode_parallelWalkStatus_Joins(b *testing.B) {
+	root := buildLadderTree(2, 16)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		root.parallelWalkStatus(runtime.NumCPU())
+	}
+}
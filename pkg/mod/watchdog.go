@@ -9,20 +9,51 @@ import (
 	"github.com/etherealiy/fastflow/pkg/log"
 )
 
-const DefFailedReason = "force failed by watch dog because it execute too long"
+const (
+	DefFailedReason  = "force failed by watch dog because it execute too long"
+	DagTimeoutReason = "force failed by watch dog because the dag instance exceeds its timeout"
+	OrphanedReason   = "recovered by watch dog because worker[%s] is not alive"
+)
+
+// OrphanPolicy decide how to recover the task instances orphaned by a dead worker
+type OrphanPolicy string
+
+const (
+	// OrphanPolicyRetry retry the orphaned task instances
+	OrphanPolicyRetry OrphanPolicy = "retry"
+	// OrphanPolicyFail fail the orphaned task instances
+	OrphanPolicyFail OrphanPolicy = "fail"
+)
+
+// unfinishedTaskStatus is canceled when the dag instance times out
+var unfinishedTaskStatus = []entity.TaskInstanceStatus{
+	entity.TaskInstanceStatusInit,
+	entity.TaskInstanceStatusQueued,
+	entity.TaskInstanceStatusRunning,
+	entity.TaskInstanceStatusRetrying,
+	entity.TaskInstanceStatusBlocked,
+	entity.TaskInstanceStatusContinue,
+}
 
 // DefWatchDog
 type DefWatchDog struct {
 	dagScheduledTimeout time.Duration
+	orphanTimeout       time.Duration
+	orphanPolicy        OrphanPolicy
 
 	wg      sync.WaitGroup
 	closeCh chan struct{}
 }
 
-// NewDefWatchDog
-func NewDefWatchDog(dagScheduledTimeout time.Duration) *DefWatchDog {
+// NewDefWatchDog orphanTimeout <= 0 means do not recover orphaned task instances, empty orphanPolicy means retry
+func NewDefWatchDog(dagScheduledTimeout, orphanTimeout time.Duration, orphanPolicy OrphanPolicy) *DefWatchDog {
+	if orphanPolicy == "" {
+		orphanPolicy = OrphanPolicyRetry
+	}
 	return &DefWatchDog{
 		dagScheduledTimeout: dagScheduledTimeout,
+		orphanTimeout:       orphanTimeout,
+		orphanPolicy:        orphanPolicy,
 		closeCh:             make(chan struct{}),
 	}
 }
@@ -33,6 +64,12 @@ func (wd *DefWatchDog) Init() {
 	go wd.watchWrapper(wd.handleExpiredTaskIns)
 	wd.wg.Add(1)
 	go wd.watchWrapper(wd.handleLeftBehindDagIns)
+	wd.wg.Add(1)
+	go wd.watchWrapper(wd.handleExpiredDagIns)
+	wd.wg.Add(1)
+	go wd.watchWrapper(wd.handleOrphanedTaskIns)
+	wd.wg.Add(1)
+	go wd.watchWrapper(wd.handleSLAMissedDagIns)
 }
 
 // Close
@@ -42,16 +79,19 @@ func (wd *DefWatchDog) Close() {
 }
 
 func (wd *DefWatchDog) watchWrapper(do func() error) {
-	timerCh := time.Tick(time.Second)
+	// the interval can be changed by cluster config, so reset timer in each round
+	timer := time.NewTimer(secsOr(GetClusterConfig().WatchDogIntervalSecs, time.Second))
+	defer timer.Stop()
 	closed := false
 	for !closed {
 		select {
 		case <-wd.closeCh:
 			closed = true
-		case <-timerCh:
+		case <-timer.C:
 			if err := do(); err != nil {
 				wd.handleErr(err)
 			}
+			timer.Reset(secsOr(GetClusterConfig().WatchDogIntervalSecs, time.Second))
 		}
 	}
 	wd.wg.Done()
@@ -91,7 +131,7 @@ func (wd *DefWatchDog) handleExpiredTaskIns() error {
 func (wd *DefWatchDog) handleLeftBehindDagIns() error {
 	dagIns, err := GetStore().ListDagInstance(&ListDagInstanceInput{
 		Status:     []entity.DagInstanceStatus{entity.DagInstanceStatusScheduled},
-		UpdatedEnd: time.Now().Add(-1 * wd.dagScheduledTimeout).Unix()},
+		UpdatedEnd: time.Now().Add(-1 * secsOr(GetClusterConfig().DagScheduleTimeoutSecs, wd.dagScheduledTimeout)).Unix()},
 	)
 	if err != nil {
 		return err
@@ -109,6 +149,190 @@ func (wd *DefWatchDog) handleLeftBehindDagIns() error {
 	return nil
 }
 
+// handleExpiredDagIns fail the running dag instances which exceed their deadline, it works from the store
+// so the dag instances of crashed workers are handled too
+func (wd *DefWatchDog) handleExpiredDagIns() error {
+	dagIns, err := GetStore().ListDagInstance(&ListDagInstanceInput{
+		Status:      []entity.DagInstanceStatus{entity.DagInstanceStatusRunning},
+		DeadlineEnd: time.Now().Unix(),
+	})
+	if err != nil {
+		return err
+	}
+
+	for i := range dagIns {
+		if err := cancelDagIns(dagIns[i], DagTimeoutReason); err != nil {
+			return fmt.Errorf("fail timeout dag instance[%s] failed: %w", dagIns[i].ID, err)
+		}
+	}
+	return nil
+}
+
+// handleSLAMissedDagIns report the SLAs missed by unfinished dag instances, see CheckSLAs
+func (wd *DefWatchDog) handleSLAMissedDagIns() error {
+	_, err := CheckSLAs(time.Now())
+	return err
+}
+
+// handleOrphanedTaskIns recover the running task instances whose worker is not alive and which are not updated
+// for the orphan timeout, then reschedule their dag instances, so the task tree is rebuilt by the owner worker
+func (wd *DefWatchDog) handleOrphanedTaskIns() error {
+	timeout := secsOr(GetClusterConfig().OrphanTimeoutSecs, wd.orphanTimeout)
+	if timeout <= 0 {
+		return nil
+	}
+	taskIns, err := GetStore().ListTaskInstance(&ListTaskInstanceInput{
+		Status: []entity.TaskInstanceStatus{entity.TaskInstanceStatusRunning, entity.TaskInstanceStatusQueued},
+	})
+	if err != nil {
+		return err
+	}
+
+	alive := map[string]bool{}
+	isAlive := func(worker string) (bool, error) {
+		if ret, ok := alive[worker]; ok {
+			return ret, nil
+		}
+		ret, err := GetKeeper().IsAlive(worker)
+		if err != nil {
+			return false, err
+		}
+		alive[worker] = ret
+		return ret, nil
+	}
+	dagIns := map[string]*entity.DagInstance{}
+	recovered := map[string]bool{}
+	for _, t := range taskIns {
+		if time.Since(time.Unix(t.UpdatedAt, 0)) < timeout {
+			continue
+		}
+		d, ok := dagIns[t.DagInsID]
+		if !ok {
+			if d, err = GetStore().GetDagInstance(t.DagInsID); err != nil {
+				return fmt.Errorf("get dag instance[%s] failed: %w", t.DagInsID, err)
+			}
+			dagIns[t.DagInsID] = d
+		}
+		// the task instances which run before upgrading have no worker, they run on the owner of dag instance
+		worker := t.Worker
+		if worker == "" {
+			worker = d.Worker
+		}
+		workerAlive, err := isAlive(worker)
+		if err != nil {
+			return err
+		}
+		if workerAlive {
+			continue
+		}
+		if err := wd.recoverOrphanedTaskIns(t, worker); err != nil {
+			return fmt.Errorf("recover orphaned task instance[%s] failed: %w", t.ID, err)
+		}
+		recovered[t.DagInsID] = true
+	}
+
+	for id := range recovered {
+		d := dagIns[id]
+		if d.Status != entity.DagInstanceStatusRunning {
+			continue
+		}
+		if err := GetStore().PatchDagIns(&entity.DagInstance{
+			BaseInfo: entity.BaseInfo{ID: d.ID},
+			Status:   entity.DagInstanceStatusScheduled,
+		}); err != nil {
+			return fmt.Errorf("reschedule dag instance[%s] failed: %w", d.ID, err)
+		}
+	}
+	return nil
+}
+
+// recoverOrphanedTaskIns record the lost execution as a failed attempt, then retry or fail the task instance
+// by the orphan policy
+func (wd *DefWatchDog) recoverOrphanedTaskIns(t *entity.TaskInstance, worker string) error {
+	t.Status = entity.TaskInstanceStatusFailed
+	t.Reason = fmt.Sprintf(OrphanedReason, worker)
+	t.RecordAttempt(worker, time.Unix(t.UpdatedAt, 0))
+	if wd.orphanPolicy == OrphanPolicyRetry {
+		t.Status = entity.TaskInstanceStatusRetrying
+	}
+	taskInsLog(t).Warn("recover orphaned task instance",
+		"module", "watchdog",
+		"worker", worker,
+		"status", t.Status)
+	// the claim of dead worker is expired, so the task instance can be claimed by others
+	return GetStore().PatchTaskIns(&entity.TaskInstance{
+		BaseInfo:       entity.BaseInfo{ID: t.ID},
+		Status:         t.Status,
+		Reason:         t.Reason,
+		Attempts:       t.Attempts,
+		ClaimExpiresAt: time.Now().Unix(),
+	})
+}
+
+// cancelDagIns fail the dag instance and cancel its unfinished tasks. The running or blocked dag instance is
+// handed to its owner worker by a command when the worker is alive, so the hooks and summary are handled by it.
+func cancelDagIns(dagIns *entity.DagInstance, reason string) error {
+	if dagIns.Cmd != nil && dagIns.Cmd.Name == entity.CommandNameCancelDagIns {
+		return nil
+	}
+	if dagIns.Worker != "" && (dagIns.Status == entity.DagInstanceStatusRunning ||
+		dagIns.Status == entity.DagInstanceStatusBlocked) {
+		alive, err := GetKeeper().IsAlive(dagIns.Worker)
+		if err != nil {
+			return err
+		}
+		if alive {
+			// the pending command is replaced, the dag instance is going to end
+			return GetStore().PatchDagIns(&entity.DagInstance{
+				BaseInfo: dagIns.BaseInfo,
+				Cmd:      &entity.Command{Name: entity.CommandNameCancelDagIns, Reason: reason},
+			})
+		}
+	}
+
+	if _, err := cancelUnfinishedTasks(dagIns.ID, reason); err != nil {
+		return err
+	}
+	dagIns.Fail(reason)
+	if err := GetStore().PatchDagIns(&entity.DagInstance{
+		BaseInfo:   dagIns.BaseInfo,
+		Status:     dagIns.Status,
+		Reason:     dagIns.Reason,
+		Summary:    summarizeDagIns(dagIns),
+		DeadLetter: dagIns.DeadLetter,
+	}); err != nil {
+		return err
+	}
+	callDagCompleteHooks(dagIns)
+	return nil
+}
+
+// cancelUnfinishedTasks mark the unfinished tasks of dag instance canceled, it returns the ones running or queued
+func cancelUnfinishedTasks(dagInsID, reason string) ([]string, error) {
+	taskIns, err := GetStore().ListTaskInstance(&ListTaskInstanceInput{
+		DagInsID: dagInsID,
+		Status:   unfinishedTaskStatus,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var running []string
+	for _, t := range taskIns {
+		if t.Status == entity.TaskInstanceStatusRunning || t.Status == entity.TaskInstanceStatusQueued {
+			running = append(running, t.ID)
+		}
+		if err := GetStore().PatchTaskIns(&entity.TaskInstance{
+			BaseInfo: t.BaseInfo,
+			Status:   entity.TaskInstanceStatusCanceled,
+			Reason:   reason,
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return running, nil
+}
+
 func (wd *DefWatchDog) handleErr(err error) {
 	log.Error("here are some errors",
 		"module", "watchdog",
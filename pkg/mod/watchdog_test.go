@@ -285,9 +285,192 @@ func TestDefWatchDog(t *testing.T) {
 	}).Return(nil, nil)
 	SetStore(mStore)
 
-	wDog := NewDefWatchDog(time.Minute)
+	wDog := NewDefWatchDog(time.Minute, time.Minute, OrphanPolicyRetry)
 	wDog.Init()
 	time.Sleep(3 * time.Second)
 	wDog.Close()
 	assert.True(t, calledListDag, calledListTask)
 }
+
+func TestDefWatchDog_HandleExpiredDagIns(t *testing.T) {
+	tests := []struct {
+		caseDesc         string
+		giveDagIns       *entity.DagInstance
+		giveTasks        []*entity.TaskInstance
+		giveAlive        bool
+		wantPatchedTasks []string
+		wantPatchDag     *entity.DagInstance
+		wantSummary      bool
+	}{
+		{
+			caseDesc:   "hand over to the alive worker",
+			giveDagIns: &entity.DagInstance{BaseInfo: entity.BaseInfo{ID: "dag-1"}, Worker: "w1", Status: entity.DagInstanceStatusRunning},
+			giveTasks: []*entity.TaskInstance{
+				{BaseInfo: entity.BaseInfo{ID: "1"}, Status: entity.TaskInstanceStatusRunning},
+				{BaseInfo: entity.BaseInfo{ID: "2"}, Status: entity.TaskInstanceStatusInit},
+			},
+			giveAlive: true,
+			wantPatchDag: &entity.DagInstance{
+				BaseInfo: entity.BaseInfo{ID: "dag-1"},
+				Cmd:      &entity.Command{Name: entity.CommandNameCancelDagIns, Reason: DagTimeoutReason},
+			},
+		},
+		{
+			caseDesc: "already handed over",
+			giveDagIns: &entity.DagInstance{BaseInfo: entity.BaseInfo{ID: "dag-1"}, Worker: "w1", Status: entity.DagInstanceStatusRunning,
+				Cmd: &entity.Command{Name: entity.CommandNameCancelDagIns, Reason: DagTimeoutReason}},
+			giveAlive: true,
+		},
+		{
+			caseDesc:   "worker is dead",
+			giveDagIns: &entity.DagInstance{BaseInfo: entity.BaseInfo{ID: "dag-1"}, Worker: "w1", Status: entity.DagInstanceStatusRunning},
+			giveTasks: []*entity.TaskInstance{
+				{BaseInfo: entity.BaseInfo{ID: "1"}, Status: entity.TaskInstanceStatusRunning},
+			},
+			wantPatchedTasks: []string{"1"},
+			wantPatchDag: &entity.DagInstance{
+				BaseInfo: entity.BaseInfo{ID: "dag-1"},
+				Status:   entity.DagInstanceStatusFailed,
+				Reason:   DagTimeoutReason,
+			},
+			wantSummary: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			var patchedTasks []string
+			var patchedDag *entity.DagInstance
+			mStore := &MockStore{}
+			mStore.On("ListDagInstance", mock.Anything).Return([]*entity.DagInstance{tc.giveDagIns}, nil)
+			mStore.On("ListTaskInstance", &ListTaskInstanceInput{
+				DagInsID: tc.giveDagIns.ID,
+				Status:   unfinishedTaskStatus,
+			}).Return(tc.giveTasks, nil)
+			mStore.On("ListTaskInstance", &ListTaskInstanceInput{DagInsID: tc.giveDagIns.ID}).Return(tc.giveTasks, nil)
+			mStore.On("PatchTaskIns", mock.Anything).Run(func(args mock.Arguments) {
+				taskIns := args.Get(0).(*entity.TaskInstance)
+				assert.Equal(t, entity.TaskInstanceStatusCanceled, taskIns.Status)
+				patchedTasks = append(patchedTasks, taskIns.ID)
+			}).Return(nil)
+			mStore.On("PatchDagIns", mock.Anything).Run(func(args mock.Arguments) {
+				patchedDag = args.Get(0).(*entity.DagInstance)
+			}).Return(nil)
+			SetStore(mStore)
+			mKeeper := &MockKeeper{}
+			mKeeper.On("IsAlive", "w1").Return(tc.giveAlive, nil)
+			SetKeeper(mKeeper)
+
+			err := (&DefWatchDog{}).handleExpiredDagIns()
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantPatchedTasks, patchedTasks)
+			if patchedDag != nil {
+				assert.Equal(t, tc.wantSummary, patchedDag.Summary != nil)
+				patchedDag.Summary = nil
+			}
+			assert.Equal(t, tc.wantPatchDag, patchedDag)
+		})
+	}
+}
+
+func TestDefWatchDog_HandleOrphanedTaskIns(t *testing.T) {
+	expired := time.Now().Add(-2 * time.Minute).Unix()
+	tests := []struct {
+		caseDesc          string
+		givePolicy        OrphanPolicy
+		giveDagIns        *entity.DagInstance
+		giveTasks         []*entity.TaskInstance
+		giveAlive         map[string]bool
+		wantPatchedTasks  map[string]entity.TaskInstanceStatus
+		wantReason        string
+		wantRescheduleDag bool
+	}{
+		{
+			caseDesc:   "retry the tasks of dead worker",
+			givePolicy: OrphanPolicyRetry,
+			giveDagIns: &entity.DagInstance{BaseInfo: entity.BaseInfo{ID: "dag-1"}, Worker: "w2", Status: entity.DagInstanceStatusRunning},
+			giveTasks: []*entity.TaskInstance{
+				{BaseInfo: entity.BaseInfo{ID: "1", UpdatedAt: expired}, DagInsID: "dag-1", Worker: "w1", Status: entity.TaskInstanceStatusRunning},
+				{BaseInfo: entity.BaseInfo{ID: "2", UpdatedAt: expired}, DagInsID: "dag-1", Worker: "w2", Status: entity.TaskInstanceStatusRunning},
+			},
+			giveAlive:         map[string]bool{"w1": false, "w2": true},
+			wantPatchedTasks:  map[string]entity.TaskInstanceStatus{"1": entity.TaskInstanceStatusRetrying},
+			wantReason:        fmt.Sprintf(OrphanedReason, "w1"),
+			wantRescheduleDag: true,
+		},
+		{
+			caseDesc:   "fail the tasks of dead worker",
+			givePolicy: OrphanPolicyFail,
+			giveDagIns: &entity.DagInstance{BaseInfo: entity.BaseInfo{ID: "dag-1"}, Worker: "w1", Status: entity.DagInstanceStatusRunning},
+			giveTasks: []*entity.TaskInstance{
+				{BaseInfo: entity.BaseInfo{ID: "1", UpdatedAt: expired}, DagInsID: "dag-1", Status: entity.TaskInstanceStatusQueued},
+			},
+			giveAlive:         map[string]bool{"w1": false},
+			wantPatchedTasks:  map[string]entity.TaskInstanceStatus{"1": entity.TaskInstanceStatusFailed},
+			wantReason:        fmt.Sprintf(OrphanedReason, "w1"),
+			wantRescheduleDag: true,
+		},
+		{
+			caseDesc:   "task is updated recently",
+			givePolicy: OrphanPolicyRetry,
+			giveDagIns: &entity.DagInstance{BaseInfo: entity.BaseInfo{ID: "dag-1"}, Worker: "w1", Status: entity.DagInstanceStatusRunning},
+			giveTasks: []*entity.TaskInstance{
+				{BaseInfo: entity.BaseInfo{ID: "1", UpdatedAt: time.Now().Unix()}, DagInsID: "dag-1", Worker: "w1", Status: entity.TaskInstanceStatusRunning},
+			},
+			giveAlive: map[string]bool{"w1": false},
+		},
+		{
+			caseDesc:   "dag instance is not running",
+			givePolicy: OrphanPolicyRetry,
+			giveDagIns: &entity.DagInstance{BaseInfo: entity.BaseInfo{ID: "dag-1"}, Worker: "w1", Status: entity.DagInstanceStatusBlocked},
+			giveTasks: []*entity.TaskInstance{
+				{BaseInfo: entity.BaseInfo{ID: "1", UpdatedAt: expired}, DagInsID: "dag-1", Worker: "w1", Status: entity.TaskInstanceStatusRunning},
+			},
+			giveAlive:        map[string]bool{"w1": false},
+			wantPatchedTasks: map[string]entity.TaskInstanceStatus{"1": entity.TaskInstanceStatusRetrying},
+			wantReason:       fmt.Sprintf(OrphanedReason, "w1"),
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			patchedTasks := map[string]entity.TaskInstanceStatus{}
+			var patchedDag *entity.DagInstance
+			mStore := &MockStore{}
+			mStore.On("ListTaskInstance", &ListTaskInstanceInput{
+				Status: []entity.TaskInstanceStatus{entity.TaskInstanceStatusRunning, entity.TaskInstanceStatusQueued},
+			}).Return(tc.giveTasks, nil)
+			mStore.On("GetDagInstance", tc.giveDagIns.ID).Return(tc.giveDagIns, nil)
+			mStore.On("PatchTaskIns", mock.Anything).Run(func(args mock.Arguments) {
+				taskIns := args.Get(0).(*entity.TaskInstance)
+				assert.Equal(t, tc.wantReason, taskIns.Reason)
+				assert.Len(t, taskIns.Attempts, 1)
+				patchedTasks[taskIns.ID] = taskIns.Status
+			}).Return(nil)
+			mStore.On("PatchDagIns", mock.Anything).Run(func(args mock.Arguments) {
+				patchedDag = args.Get(0).(*entity.DagInstance)
+			}).Return(nil)
+			SetStore(mStore)
+			mKeeper := &MockKeeper{}
+			for w, alive := range tc.giveAlive {
+				mKeeper.On("IsAlive", w).Return(alive, nil)
+			}
+			SetKeeper(mKeeper)
+
+			err := NewDefWatchDog(time.Minute, time.Minute, tc.givePolicy).handleOrphanedTaskIns()
+			assert.NoError(t, err)
+			if tc.wantPatchedTasks == nil {
+				tc.wantPatchedTasks = map[string]entity.TaskInstanceStatus{}
+			}
+			assert.Equal(t, tc.wantPatchedTasks, patchedTasks)
+			if tc.wantRescheduleDag {
+				assert.Equal(t, &entity.DagInstance{
+					BaseInfo: entity.BaseInfo{ID: tc.giveDagIns.ID},
+					Status:   entity.DagInstanceStatusScheduled,
+				}, patchedDag)
+			} else {
+				assert.Nil(t, patchedDag)
+			}
+		})
+	}
+}
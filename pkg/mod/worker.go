@@ -0,0 +1,163 @@
+package mod
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/log"
+)
+
+const modulePath = "github.com/etherealiy/fastflow"
+
+// DefWorkerReporter report the runtime info of current worker periodically, so that
+// the health of cluster can be viewed from any worker
+type DefWorkerReporter struct {
+	interval  time.Duration
+	version   string
+	labels    map[string]string
+	startedAt time.Time
+
+	wg      sync.WaitGroup
+	closeCh chan struct{}
+}
+
+// NewDefWorkerReporter empty version means the version of fastflow module
+func NewDefWorkerReporter(interval time.Duration, version string, labels map[string]string) *DefWorkerReporter {
+	if version == "" {
+		version = moduleVersion()
+	}
+	return &DefWorkerReporter{
+		interval:  interval,
+		version:   version,
+		labels:    labels,
+		startedAt: time.Now(),
+		closeCh:   make(chan struct{}),
+	}
+}
+
+// Init
+func (r *DefWorkerReporter) Init() {
+	if err := r.Report(); err != nil {
+		log.Errorf("report worker info failed: %s", err)
+	}
+	r.wg.Add(1)
+	go r.watch()
+}
+
+// Close
+func (r *DefWorkerReporter) Close() {
+	close(r.closeCh)
+	r.wg.Wait()
+}
+
+func (r *DefWorkerReporter) watch() {
+	defer r.wg.Done()
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.closeCh:
+			return
+		case <-ticker.C:
+			if err := r.Report(); err != nil {
+				log.Errorf("report worker info failed: %s", err)
+			}
+		}
+	}
+}
+
+// Report save the runtime info of current worker
+func (r *DefWorkerReporter) Report() error {
+	st, ok := StoreAs[WorkerInfoStore](GetStore())
+	if !ok {
+		return fmt.Errorf("store does not support worker info")
+	}
+	return st.SaveWorkerInfo(r.Collect())
+}
+
+// Collect the runtime info of current worker
+func (r *DefWorkerReporter) Collect() *entity.WorkerInfo {
+	info := &entity.WorkerInfo{
+		Key:        GetKeeper().WorkerKey(),
+		Version:    r.version,
+		StartedAt:  r.startedAt.Unix(),
+		Labels:     r.labels,
+		ReportedAt: time.Now().Unix(),
+	}
+	if e, ok := GetExecutor().(interface {
+		WorkerNumber() int
+		RunningTasks() []entity.RunningTask
+		QueueLen() int
+	}); ok {
+		info.Capacity = e.WorkerNumber()
+		info.RunningTasks = e.RunningTasks()
+		info.ExecutorQueueLen = e.QueueLen()
+	}
+	if e, ok := GetExecutor().(interface{ PoolUsage() map[string]int }); ok {
+		info.PoolUsage = e.PoolUsage()
+	}
+	if p, ok := GetParser().(interface {
+		DagInsIDs() []string
+		QueueLen() int
+	}); ok {
+		info.OwnedDagInsIDs = p.DagInsIDs()
+		info.ParserQueueLen = p.QueueLen()
+	}
+	return info
+}
+
+// ListWorkerInfo list the reported info of workers sorted by key, the alive workers which never
+// reported are also listed with key only
+func ListWorkerInfo() ([]*entity.WorkerInfo, error) {
+	st, ok := StoreAs[WorkerInfoStore](GetStore())
+	if !ok {
+		return nil, fmt.Errorf("store does not support worker info")
+	}
+	infos, err := st.ListWorkerInfo()
+	if err != nil {
+		return nil, err
+	}
+	nodes, err := GetKeeper().AliveNodes()
+	if err != nil {
+		return nil, err
+	}
+
+	alive := map[string]bool{}
+	for _, n := range nodes {
+		alive[n] = true
+	}
+	reported := map[string]bool{}
+	for _, info := range infos {
+		info.Alive = alive[info.Key]
+		reported[info.Key] = true
+	}
+	for _, n := range nodes {
+		if !reported[n] {
+			infos = append(infos, &entity.WorkerInfo{Key: n, Alive: true})
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Key < infos[j].Key
+	})
+	return infos, nil
+}
+
+func moduleVersion() string {
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	if bi.Main.Path == modulePath {
+		return bi.Main.Version
+	}
+	for _, dep := range bi.Deps {
+		if dep.Path == modulePath {
+			return dep.Version
+		}
+	}
+	return ""
+}
@@ -0,0 +1,114 @@
+package mod
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+type workerInfoMockStore struct {
+	*MockStore
+	infos   []*entity.WorkerInfo
+	listErr error
+}
+
+func (s *workerInfoMockStore) SaveWorkerInfo(info *entity.WorkerInfo) error {
+	s.infos = append(s.infos, info)
+	return nil
+}
+
+func (s *workerInfoMockStore) ListWorkerInfo() ([]*entity.WorkerInfo, error) {
+	return s.infos, s.listErr
+}
+
+func TestDefWorkerReporter_Report(t *testing.T) {
+	mKeeper := &MockKeeper{}
+	mKeeper.On("WorkerKey").Return("w1")
+	SetKeeper(mKeeper)
+
+	exe := NewDefExecutor(time.Second, 3)
+	begin := time.Now().Add(-time.Second).UnixMilli()
+	exe.cancelMap.Store("task-ins-1", func() {})
+	exe.cancelMap.Store("task-ins-2", func() {})
+	exe.runningMap.Store("task-ins-1", &entity.RunningTask{TaskInsID: "task-ins-1", DagInsID: "dag-ins-1", StartedAt: begin})
+	SetExecutor(exe)
+
+	p := NewDefParser(1, time.Second)
+	p.taskTrees.Store("dag-ins-2", &TaskTree{})
+	p.taskTrees.Store("dag-ins-1", &TaskTree{})
+	p.workerQueue = []chan *entity.TaskInstance{make(chan *entity.TaskInstance, 2)}
+	p.workerQueue[0] <- &entity.TaskInstance{}
+	SetParser(p)
+
+	st := &workerInfoMockStore{MockStore: &MockStore{}}
+	SetStore(st)
+
+	r := NewDefWorkerReporter(time.Second, "v1.0.0", map[string]string{"zone": "a"})
+	assert.NoError(t, r.Report())
+	if assert.Len(t, st.infos, 1) {
+		info := st.infos[0]
+		assert.Equal(t, "w1", info.Key)
+		assert.Equal(t, "v1.0.0", info.Version)
+		assert.Equal(t, map[string]string{"zone": "a"}, info.Labels)
+		assert.Equal(t, 3, info.Capacity)
+		assert.Equal(t, []string{"dag-ins-1", "dag-ins-2"}, info.OwnedDagInsIDs)
+		assert.Equal(t, 1, info.ParserQueueLen)
+		assert.Equal(t, 1, info.ExecutorQueueLen)
+		if assert.Len(t, info.RunningTasks, 1) {
+			assert.Equal(t, "task-ins-1", info.RunningTasks[0].TaskInsID)
+			assert.GreaterOrEqual(t, info.RunningTasks[0].ElapsedMs, int64(1000))
+		}
+	}
+
+	SetStore(&MockStore{})
+	assert.Error(t, r.Report())
+}
+
+func TestListWorkerInfo(t *testing.T) {
+	tests := []struct {
+		caseDesc       string
+		giveInfos      []*entity.WorkerInfo
+		giveListErr    error
+		giveAliveNodes []string
+		giveAliveErr   error
+		wantRet        []*entity.WorkerInfo
+		wantErr        error
+	}{
+		{
+			caseDesc:       "normal",
+			giveInfos:      []*entity.WorkerInfo{{Key: "w3", Capacity: 1}, {Key: "w1", Capacity: 2}},
+			giveAliveNodes: []string{"w1", "w2"},
+			wantRet: []*entity.WorkerInfo{
+				{Key: "w1", Capacity: 2, Alive: true},
+				{Key: "w2", Alive: true},
+				{Key: "w3", Capacity: 1},
+			},
+		},
+		{
+			caseDesc:    "list failed",
+			giveListErr: fmt.Errorf("list failed"),
+			wantErr:     fmt.Errorf("list failed"),
+		},
+		{
+			caseDesc:     "get alive nodes failed",
+			giveAliveErr: fmt.Errorf("get alive nodes failed"),
+			wantErr:      fmt.Errorf("get alive nodes failed"),
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			SetStore(&workerInfoMockStore{MockStore: &MockStore{}, infos: tc.giveInfos, listErr: tc.giveListErr})
+			mKeeper := &MockKeeper{}
+			mKeeper.On("AliveNodes").Return(tc.giveAliveNodes, tc.giveAliveErr)
+			SetKeeper(mKeeper)
+
+			ret, err := ListWorkerInfo()
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantRet, ret)
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package mod
+
+import (
+	"sync"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/log"
+)
+
+var defWorkspace Workspace
+
+// Workspace allocate a scratch workspace for each dag instance, so actions need not to manage temp directories
+type Workspace interface {
+	// Allocate return the workspace of dag instance, tasks of the same run on the same worker share it,
+	// it can be a local directory or an object-store prefix
+	Allocate(dagIns *entity.DagInstance) (string, error)
+	// Cleanup remove the workspaces which are out of retention
+	Cleanup() error
+}
+
+// SetWorkspace
+func SetWorkspace(w Workspace) {
+	defWorkspace = w
+}
+
+// GetWorkspace
+func GetWorkspace() Workspace {
+	return defWorkspace
+}
+
+// DefWorkspaceCleaner cleanup workspaces periodically
+type DefWorkspaceCleaner struct {
+	interval time.Duration
+
+	wg      sync.WaitGroup
+	closeCh chan struct{}
+}
+
+// NewDefWorkspaceCleaner
+func NewDefWorkspaceCleaner(interval time.Duration) *DefWorkspaceCleaner {
+	return &DefWorkspaceCleaner{
+		interval: interval,
+		closeCh:  make(chan struct{}),
+	}
+}
+
+// Init
+func (c *DefWorkspaceCleaner) Init() {
+	c.wg.Add(1)
+	go c.watch()
+}
+
+// Close
+func (c *DefWorkspaceCleaner) Close() {
+	close(c.closeCh)
+	c.wg.Wait()
+}
+
+func (c *DefWorkspaceCleaner) watch() {
+	defer c.wg.Done()
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.closeCh:
+			return
+		case <-ticker.C:
+			if w := GetWorkspace(); w != nil {
+				if err := w.Cleanup(); err != nil {
+					log.Errorf("cleanup workspace failed: %s", err)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+var defHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// SlackNotifier post the text of message to a slack incoming webhook
+type SlackNotifier struct {
+	WebhookURL string
+	// Channel override the default channel of webhook, empty means the default one
+	Channel string
+	// Client default is a client with 10s timeout
+	Client *http.Client
+}
+
+// Notify
+func (n *SlackNotifier) Notify(ctx context.Context, msg *Message) error {
+	body := map[string]string{"text": msg.Text}
+	if n.Channel != "" {
+		body["channel"] = n.Channel
+	}
+	return postJSON(ctx, n.Client, n.WebhookURL, nil, body)
+}
+
+// WebhookNotifier post the whole message as json to an endpoint
+type WebhookNotifier struct {
+	URL    string
+	Header http.Header
+	// Client default is a client with 10s timeout
+	Client *http.Client
+}
+
+// Notify
+func (n *WebhookNotifier) Notify(ctx context.Context, msg *Message) error {
+	return postJSON(ctx, n.Client, n.URL, n.Header, msg)
+}
+
+func postJSON(ctx context.Context, client *http.Client, url string, header http.Header, body interface{}) error {
+	bs, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("marshal message failed: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(bs))
+	if err != nil {
+		return err
+	}
+	for k, vs := range header {
+		for _, v := range vs {
+			req.Header.Add(k, v)
+		}
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	if client == nil {
+		client = defHTTPClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("post message failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("post message failed, status code: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// sendMail is replaced in tests
+var sendMail = smtp.SendMail
+
+// EmailNotifier send the message as a plain text email by smtp,
+// the context is not respected because net/smtp does not support it
+type EmailNotifier struct {
+	// Addr is the address of smtp server, such as "smtp.example.com:587"
+	Addr string
+	// Auth is nil when the server does not require authentication, such as smtp.PlainAuth
+	Auth smtp.Auth
+	From string
+	To   []string
+}
+
+// Notify
+func (n *EmailNotifier) Notify(ctx context.Context, msg *Message) error {
+	if len(n.To) == 0 {
+		return fmt.Errorf("recipients of email cannot be empty")
+	}
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "From: %s\r\n", n.From)
+	fmt.Fprintf(buf, "To: %s\r\n", strings.Join(n.To, ", "))
+	fmt.Fprintf(buf, "Subject: %s\r\n", msg.Subject)
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	buf.WriteString(strings.ReplaceAll(msg.Text, "\n", "\r\n"))
+	if err := sendMail(n.Addr, n.Auth, n.From, n.To, buf.Bytes()); err != nil {
+		return fmt.Errorf("send email failed: %w", err)
+	}
+	return nil
+}
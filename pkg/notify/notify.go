@@ -0,0 +1,299 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/event"
+	"github.com/etherealiy/fastflow/pkg/log"
+	"github.com/etherealiy/fastflow/pkg/mod"
+	"github.com/etherealiy/fastflow/pkg/utils"
+	"github.com/shiningrush/goevent"
+)
+
+// Notifier deliver messages to somewhere such as slack or email
+type Notifier interface {
+	Notify(ctx context.Context, msg *Message) error
+}
+
+// Message is the notification of a state transition, it is also the data of templates
+type Message struct {
+	Event   entity.NotifyEvent `json:"event"`
+	Subject string             `json:"subject"`
+	// Text is rendered by the template of notification
+	Text        string              `json:"text"`
+	DagInstance *entity.DagInstance `json:"dagInstance"`
+	// TaskInstances is the failed or canceled tasks when run failed, the blocked tasks when task blocked
+	// and the instances of task when its SLA missed
+	TaskInstances []*entity.TaskInstance `json:"taskInstances,omitempty"`
+	// SLA is the missed SLA when SLA missed
+	SLA *entity.SLA `json:"sla,omitempty"`
+}
+
+// DefaultTemplate is used when the template of notification is empty
+const DefaultTemplate = `dag[{{.DagInstance.DagID}}] instance[{{.DagInstance.ID}}] {{.Event}}
+{{- if .SLA}}, sla{{if .SLA.TaskID}} of task[{{.SLA.TaskID}}]{{end}} is missed{{end}}
+{{- if .DagInstance.Reason}}, reason: {{.DagInstance.Reason}}{{end}}
+{{- range .TaskInstances}}
+task[{{.TaskID}}] is {{.Status}}{{if .Reason}}: {{.Reason}}{{end}}
+{{- end}}`
+
+var eventSubjects = map[entity.NotifyEvent]string{
+	entity.NotifyEventRunFailed:    "run failed",
+	entity.NotifyEventRunSucceeded: "run succeeded",
+	entity.NotifyEventTaskBlocked:  "task blocked",
+	entity.NotifyEventSLAMissed:    "sla missed",
+}
+
+// Option
+type Option struct {
+	// Notifiers is the notifiers referenced by the notifications of dags
+	Notifiers map[string]Notifier
+	// BufferSize is the size of queue, notifications will be dropped when it is full, default is 1000
+	BufferSize int
+	// SendTimeout is the timeout of each notifying, default is 10s
+	SendTimeout time.Duration
+}
+
+// Sender send the notifications of dags when their instances fail, succeed, are blocked or miss SLAs.
+// The dag instances are changed on different workers and SLAs are checked on leader, so it should be
+// started on all workers, each transition is notified by the worker where it happens.
+//
+//	sender := notify.NewSender(&notify.Option{Notifiers: map[string]notify.Notifier{
+//		"ops": &notify.SlackNotifier{WebhookURL: url},
+//	}})
+//	if err := sender.Start(); err != nil { ... }
+//	defer sender.Close()
+type Sender struct {
+	opt *Option
+
+	queue     chan *job
+	closeCh   chan struct{}
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+
+	// dagStatus record the last status of dag instances, so the same transition is not notified repeatedly
+	dagStatus     map[string]entity.DagInstanceStatus
+	dagStatusLock sync.Mutex
+}
+
+// job is the transition to notify, the details are loaded from store when it is sent
+type job struct {
+	event    entity.NotifyEvent
+	dagInsID string
+	dagIns   *entity.DagInstance
+	sla      *entity.SLA
+}
+
+// NewSender
+func NewSender(opt *Option) *Sender {
+	if opt.BufferSize == 0 {
+		opt.BufferSize = 1000
+	}
+	if opt.SendTimeout == 0 {
+		opt.SendTimeout = 10 * time.Second
+	}
+	return &Sender{
+		opt:       opt,
+		queue:     make(chan *job, opt.BufferSize),
+		closeCh:   make(chan struct{}),
+		dagStatus: map[string]entity.DagInstanceStatus{},
+	}
+}
+
+// Start subscribe the events of engine, you should call it before fastflow start
+func (s *Sender) Start() error {
+	if err := goevent.Subscribe(s); err != nil {
+		return err
+	}
+	s.wg.Add(1)
+	go s.goSend()
+	return nil
+}
+
+// Close stop notifying and wait for the queued notifications sent
+func (s *Sender) Close() {
+	s.closeOnce.Do(func() {
+		close(s.closeCh)
+		s.wg.Wait()
+	})
+}
+
+// Topic is goevent's topic
+func (s *Sender) Topic() []string {
+	return []string{event.KeyDagInstancePatched, event.KeyDagInstanceUpdated, event.KeySLAMissed}
+}
+
+// Handle is goevent's handler
+func (s *Sender) Handle(ctx context.Context, ev goevent.Event) {
+	switch v := ev.(type) {
+	case *event.DagInstancePatched:
+		s.handleDagIns(v.Payload)
+	case *event.DagInstanceUpdated:
+		s.handleDagIns(v.Payload)
+	case *event.SLAMissed:
+		sla := v.SLA
+		s.enqueue(&job{event: entity.NotifyEventSLAMissed, dagInsID: v.DagIns.ID, dagIns: v.DagIns, sla: &sla})
+	}
+}
+
+func (s *Sender) handleDagIns(dagIns *entity.DagInstance) {
+	if dagIns == nil || dagIns.Status == "" {
+		return
+	}
+	s.dagStatusLock.Lock()
+	if s.dagStatus[dagIns.ID] == dagIns.Status {
+		s.dagStatusLock.Unlock()
+		return
+	}
+	switch dagIns.Status {
+	case entity.DagInstanceStatusSuccess, entity.DagInstanceStatusFailed:
+		delete(s.dagStatus, dagIns.ID)
+	default:
+		s.dagStatus[dagIns.ID] = dagIns.Status
+	}
+	s.dagStatusLock.Unlock()
+
+	switch dagIns.Status {
+	case entity.DagInstanceStatusFailed:
+		s.enqueue(&job{event: entity.NotifyEventRunFailed, dagInsID: dagIns.ID})
+	case entity.DagInstanceStatusSuccess:
+		s.enqueue(&job{event: entity.NotifyEventRunSucceeded, dagInsID: dagIns.ID})
+	case entity.DagInstanceStatusBlocked:
+		s.enqueue(&job{event: entity.NotifyEventTaskBlocked, dagInsID: dagIns.ID})
+	}
+}
+
+func (s *Sender) enqueue(j *job) {
+	select {
+	case <-s.closeCh:
+		return
+	default:
+	}
+	select {
+	case s.queue <- j:
+	default:
+		log.With(utils.LogKeyDagInsID, j.dagInsID).Warnf("notification queue is full, drop %s notification", j.event)
+	}
+}
+
+func (s *Sender) goSend() {
+	defer s.wg.Done()
+	for {
+		select {
+		case j := <-s.queue:
+			s.send(j)
+		case <-s.closeCh:
+			// drain the queued notifications
+			for {
+				select {
+				case j := <-s.queue:
+					s.send(j)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (s *Sender) send(j *job) {
+	logger := log.With(utils.LogKeyDagInsID, j.dagInsID)
+	msg, notifications, err := s.prepare(j)
+	if err != nil {
+		logger.Errorf("prepare %s notification failed: %s", j.event, err)
+		return
+	}
+	for _, n := range notifications {
+		notifier, ok := s.opt.Notifiers[n.Notifier]
+		if !ok {
+			logger.Warnf("notifier[%s] of dag[%s] is not registered", n.Notifier, msg.DagInstance.DagID)
+			continue
+		}
+		m := *msg
+		if m.Text, err = Render(n.Template, &m); err != nil {
+			logger.Errorf("render notification of notifier[%s] failed: %s", n.Notifier, err)
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), s.opt.SendTimeout)
+		if err := notifier.Notify(ctx, &m); err != nil {
+			logger.Errorf("send %s notification by notifier[%s] failed: %s", j.event, n.Notifier, err)
+		}
+		cancel()
+	}
+}
+
+// prepare load the dag instance and the related task instances of job, it returns the notifications
+// of dag which subscribe the event
+func (s *Sender) prepare(j *job) (*Message, []entity.Notification, error) {
+	dagIns := j.dagIns
+	if dagIns == nil {
+		var err error
+		if dagIns, err = mod.GetStore().GetDagInstance(j.dagInsID); err != nil {
+			return nil, nil, fmt.Errorf("get dag instance failed: %w", err)
+		}
+	}
+	dag, err := mod.GetStore().GetDag(dagIns.DagID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("get dag failed: %w", err)
+	}
+	var notifications []entity.Notification
+	for _, n := range dag.Notifications {
+		if n.Subscribed(j.event) {
+			notifications = append(notifications, n)
+		}
+	}
+	if len(notifications) == 0 {
+		return nil, nil, nil
+	}
+
+	input := &mod.ListTaskInstanceInput{DagInsID: dagIns.ID}
+	switch j.event {
+	case entity.NotifyEventRunFailed:
+		input.Status = []entity.TaskInstanceStatus{
+			entity.TaskInstanceStatusFailed, entity.TaskInstanceStatusInvalidParams, entity.TaskInstanceStatusCanceled}
+	case entity.NotifyEventTaskBlocked:
+		input.Status = []entity.TaskInstanceStatus{entity.TaskInstanceStatusBlocked}
+	case entity.NotifyEventSLAMissed:
+		if j.sla.TaskID == "" {
+			input = nil
+		} else {
+			input.TaskID = j.sla.TaskID
+		}
+	default:
+		input = nil
+	}
+	msg := &Message{
+		Event:       j.event,
+		Subject:     fmt.Sprintf("[fastflow] dag[%s] %s", dagIns.DagID, eventSubjects[j.event]),
+		DagInstance: dagIns,
+		SLA:         j.sla,
+	}
+	if input != nil {
+		if msg.TaskInstances, err = mod.GetStore().ListTaskInstance(input); err != nil {
+			return nil, nil, fmt.Errorf("list task instances failed: %w", err)
+		}
+	}
+	return msg, notifications, nil
+}
+
+// Render the text of message by the go template, DefaultTemplate is used when it is empty
+func Render(tpl string, msg *Message) (string, error) {
+	if tpl == "" {
+		tpl = DefaultTemplate
+	}
+	t, err := template.New("notification").Parse(tpl)
+	if err != nil {
+		return "", err
+	}
+	buf := &bytes.Buffer{}
+	if err := t.Execute(buf, msg); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
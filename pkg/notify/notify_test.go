@@ -0,0 +1,130 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"sync"
+	"testing"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/event"
+	"github.com/etherealiy/fastflow/pkg/mod"
+	"github.com/etherealiy/fastflow/store/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeNotifier struct {
+	msgs  []*Message
+	mutex sync.Mutex
+}
+
+func (n *fakeNotifier) Notify(ctx context.Context, msg *Message) error {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.msgs = append(n.msgs, msg)
+	return nil
+}
+
+func TestSender_Handle(t *testing.T) {
+	st := memory.NewStore()
+	mod.SetStore(st)
+	assert.NoError(t, st.CreateDag(&entity.Dag{
+		BaseInfo: entity.BaseInfo{ID: "etl"},
+		Tasks:    []entity.Task{{ID: "extract", ActionName: "extract"}},
+		Notifications: []entity.Notification{
+			{Notifier: "ops", Events: []entity.NotifyEvent{entity.NotifyEventRunFailed, entity.NotifyEventSLAMissed}},
+			{Notifier: "team", Events: []entity.NotifyEvent{entity.NotifyEventRunFailed}, Template: `{{.DagInstance.ID}} {{len .TaskInstances}}`},
+			{Notifier: "unknown", Events: []entity.NotifyEvent{entity.NotifyEventRunSucceeded}},
+		},
+	}))
+	assert.NoError(t, st.CreateDagIns(&entity.DagInstance{
+		BaseInfo: entity.BaseInfo{ID: "dag-ins"},
+		DagID:    "etl",
+		Status:   entity.DagInstanceStatusFailed,
+		Reason:   "task[load] failed or canceled",
+	}))
+	assert.NoError(t, st.BatchCreatTaskIns([]*entity.TaskInstance{
+		{BaseInfo: entity.BaseInfo{ID: "task-ins1"}, DagInsID: "dag-ins", TaskID: "extract", Status: entity.TaskInstanceStatusSuccess},
+		{BaseInfo: entity.BaseInfo{ID: "task-ins2"}, DagInsID: "dag-ins", TaskID: "load", Status: entity.TaskInstanceStatusFailed, Reason: "timeout"},
+	}))
+
+	ops, team := &fakeNotifier{}, &fakeNotifier{}
+	s := NewSender(&Option{Notifiers: map[string]Notifier{"ops": ops, "team": team}})
+	s.wg.Add(1)
+	go s.goSend()
+
+	ctx := context.Background()
+	running := &entity.DagInstance{BaseInfo: entity.BaseInfo{ID: "dag-ins"}, Status: entity.DagInstanceStatusRunning}
+	failed := &entity.DagInstance{BaseInfo: entity.BaseInfo{ID: "dag-ins"}, Status: entity.DagInstanceStatusFailed}
+	s.Handle(ctx, &event.DagInstancePatched{Payload: running})
+	s.Handle(ctx, &event.SLAMissed{
+		DagIns: &entity.DagInstance{BaseInfo: entity.BaseInfo{ID: "dag-ins"}, DagID: "etl"},
+		SLA:    entity.SLA{Deadline: 1, MissedAt: 2},
+	})
+	s.Handle(ctx, &event.DagInstancePatched{Payload: failed})
+	s.Handle(ctx, &event.DagInstanceUpdated{Payload: &entity.DagInstance{BaseInfo: entity.BaseInfo{ID: "dag-ins"}, Status: entity.DagInstanceStatusSuccess}})
+	s.Close()
+
+	if assert.Len(t, ops.msgs, 2) {
+		assert.Equal(t, entity.NotifyEventSLAMissed, ops.msgs[0].Event)
+		assert.Equal(t, "[fastflow] dag[etl] sla missed", ops.msgs[0].Subject)
+		assert.Equal(t, "dag[etl] instance[dag-ins] slaMissed, sla is missed", ops.msgs[0].Text)
+		assert.Equal(t, "[fastflow] dag[etl] run failed", ops.msgs[1].Subject)
+		assert.Equal(t, "dag[etl] instance[dag-ins] runFailed, reason: task[load] failed or canceled\n"+
+			"task[load] is failed: timeout", ops.msgs[1].Text)
+	}
+	if assert.Len(t, team.msgs, 1) {
+		assert.Equal(t, "dag-ins 1", team.msgs[0].Text)
+	}
+}
+
+func TestNotifiers(t *testing.T) {
+	var gotBody map[string]interface{}
+	var gotHeader http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bs, _ := ioutil.ReadAll(r.Body)
+		gotBody = nil
+		assert.NoError(t, json.Unmarshal(bs, &gotBody))
+		gotHeader = r.Header
+	}))
+	defer srv.Close()
+
+	msg := &Message{
+		Event:       entity.NotifyEventRunFailed,
+		Subject:     "[fastflow] dag[etl] run failed",
+		Text:        "line1\nline2",
+		DagInstance: &entity.DagInstance{BaseInfo: entity.BaseInfo{ID: "dag-ins"}, DagID: "etl"},
+	}
+	ctx := context.Background()
+
+	assert.NoError(t, (&SlackNotifier{WebhookURL: srv.URL, Channel: "#alerts"}).Notify(ctx, msg))
+	assert.Equal(t, map[string]interface{}{"text": "line1\nline2", "channel": "#alerts"}, gotBody)
+
+	assert.NoError(t, (&WebhookNotifier{URL: srv.URL, Header: http.Header{"X-Token": {"t"}}}).Notify(ctx, msg))
+	assert.Equal(t, "runFailed", gotBody["event"])
+	assert.Equal(t, "dag-ins", gotBody["dagInstance"].(map[string]interface{})["id"])
+	assert.Equal(t, "t", gotHeader.Get("X-Token"))
+
+	assert.Error(t, (&WebhookNotifier{URL: srv.URL + "/%zz"}).Notify(ctx, msg))
+
+	var gotAddr string
+	var gotTo []string
+	var gotMail []byte
+	sendMail = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		gotAddr, gotTo, gotMail = addr, to, msg
+		return nil
+	}
+	defer func() { sendMail = smtp.SendMail }()
+	email := &EmailNotifier{Addr: "smtp.example.com:587", From: "fastflow@example.com", To: []string{"a@example.com", "b@example.com"}}
+	assert.NoError(t, email.Notify(ctx, msg))
+	assert.Equal(t, "smtp.example.com:587", gotAddr)
+	assert.Equal(t, []string{"a@example.com", "b@example.com"}, gotTo)
+	assert.Equal(t, "From: fastflow@example.com\r\nTo: a@example.com, b@example.com\r\n"+
+		"Subject: [fastflow] dag[etl] run failed\r\nMIME-Version: 1.0\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n"+
+		"line1\r\nline2", string(gotMail))
+	assert.Error(t, (&EmailNotifier{}).Notify(ctx, msg))
+}
@@ -0,0 +1,219 @@
+package openlineage
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/event"
+	"github.com/etherealiy/fastflow/pkg/log"
+	"github.com/etherealiy/fastflow/pkg/mod"
+	"github.com/etherealiy/fastflow/pkg/utils"
+	"github.com/shiningrush/goevent"
+)
+
+// Option
+type Option struct {
+	// Namespace is the namespace of jobs, default is DefaultNamespace
+	Namespace  string
+	Transports []Transport
+	// BufferSize is the size of queue, events will be dropped when it is full, default is 1000
+	BufferSize int
+	// EmitTimeout is the timeout of each emitting, default is 10s
+	EmitTimeout time.Duration
+}
+
+// Emitter report dag instances and task instances to lineage tools such as Marquez,
+// a dag is a job named "{dagId}" and each task is a job named "{dagId}.{taskId}" whose parent is the dag run,
+// the datasets are declared by actions with run.ExecuteContext.DeclareDatasets.
+//
+//	emitter := openlineage.NewEmitter(&openlineage.Option{
+//		Transports: []openlineage.Transport{&openlineage.HTTPTransport{URL: "http://marquez:5000/api/v1/lineage"}},
+//	})
+//	if err := emitter.Start(); err != nil { ... }
+//	defer emitter.Close()
+type Emitter struct {
+	opt *Option
+
+	queue     chan *RunEvent
+	closeCh   chan struct{}
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+
+	// dagRuns record the dag id and the last emitted event type of running dag instances
+	dagRuns     map[string]*dagRun
+	dagRunsLock sync.Mutex
+}
+
+type dagRun struct {
+	dagID     string
+	eventType EventType
+}
+
+// NewEmitter
+func NewEmitter(opt *Option) *Emitter {
+	if opt.Namespace == "" {
+		opt.Namespace = DefaultNamespace
+	}
+	if opt.BufferSize == 0 {
+		opt.BufferSize = 1000
+	}
+	if opt.EmitTimeout == 0 {
+		opt.EmitTimeout = 10 * time.Second
+	}
+	return &Emitter{
+		opt:     opt,
+		queue:   make(chan *RunEvent, opt.BufferSize),
+		closeCh: make(chan struct{}),
+		dagRuns: map[string]*dagRun{},
+	}
+}
+
+// Start subscribe the events of engine, you should call it before fastflow start
+func (e *Emitter) Start() error {
+	if err := goevent.Subscribe(e); err != nil {
+		return err
+	}
+	e.wg.Add(1)
+	go e.goEmit()
+	return nil
+}
+
+// Close stop emitting and wait for the queued events sent
+func (e *Emitter) Close() {
+	e.closeOnce.Do(func() {
+		close(e.closeCh)
+		e.wg.Wait()
+	})
+}
+
+// Topic is goevent's topic
+func (e *Emitter) Topic() []string {
+	return []string{event.KeyDagInstancePatched, event.KeyDagInstanceUpdated, event.KeyTaskBegin, event.KeyTaskCompleted}
+}
+
+// Handle is goevent's handler
+func (e *Emitter) Handle(ctx context.Context, ev goevent.Event) {
+	switch v := ev.(type) {
+	case *event.DagInstancePatched:
+		e.emitDagIns(v.Payload)
+	case *event.DagInstanceUpdated:
+		e.emitDagIns(v.Payload)
+	case *event.TaskBegin:
+		taskIns := *v.TaskIns
+		taskIns.Status = entity.TaskInstanceStatusRunning
+		e.emitTaskIns(&taskIns)
+	case *event.TaskCompleted:
+		e.emitTaskIns(v.TaskIns)
+	}
+}
+
+func (e *Emitter) emitDagIns(dagIns *entity.DagInstance) {
+	if dagIns == nil {
+		return
+	}
+	typ := DagInstanceEventType(dagIns.Status)
+	if typ == "" {
+		return
+	}
+
+	e.dagRunsLock.Lock()
+	r, ok := e.dagRuns[dagIns.ID]
+	if ok && r.eventType == typ {
+		e.dagRunsLock.Unlock()
+		return
+	}
+	if !ok {
+		r = &dagRun{}
+		e.dagRuns[dagIns.ID] = r
+	}
+	if dagIns.DagID != "" {
+		r.dagID = dagIns.DagID
+	}
+	r.eventType = typ
+	if typ != EventTypeStart {
+		delete(e.dagRuns, dagIns.ID)
+	}
+	e.dagRunsLock.Unlock()
+
+	// patched dag instance may only contain the changed fields
+	ins := *dagIns
+	ins.DagID = r.dagID
+	if ins.DagID == "" {
+		ins.DagID = e.lookupDagID(dagIns.ID)
+	}
+	e.enqueue(NewDagInstanceEvent(e.opt.Namespace, &ins))
+}
+
+func (e *Emitter) emitTaskIns(taskIns *entity.TaskInstance) {
+	if TaskInstanceEventType(taskIns.Status) == "" {
+		return
+	}
+	e.dagRunsLock.Lock()
+	var dagID string
+	if r, ok := e.dagRuns[taskIns.DagInsID]; ok {
+		dagID = r.dagID
+	}
+	e.dagRunsLock.Unlock()
+	if dagID == "" {
+		dagID = e.lookupDagID(taskIns.DagInsID)
+	}
+	e.enqueue(NewTaskInstanceEvent(e.opt.Namespace, dagID, taskIns))
+}
+
+// lookupDagID is used when the dag instance started before emitter, such as worker restarted
+func (e *Emitter) lookupDagID(dagInsID string) string {
+	if mod.GetStore() == nil {
+		return ""
+	}
+	dagIns, err := mod.GetStore().GetDagInstance(dagInsID)
+	if err != nil {
+		log.With(utils.LogKeyDagInsID, dagInsID).Warnf("get dag instance for lineage failed: %s", err)
+		return ""
+	}
+	return dagIns.DagID
+}
+
+func (e *Emitter) enqueue(ev *RunEvent) {
+	select {
+	case <-e.closeCh:
+		return
+	default:
+	}
+	select {
+	case e.queue <- ev:
+	default:
+		log.Warnf("lineage event queue is full, drop %s event of job %s", ev.EventType, ev.Job.Name)
+	}
+}
+
+func (e *Emitter) goEmit() {
+	defer e.wg.Done()
+	for {
+		select {
+		case ev := <-e.queue:
+			e.emit(ev)
+		case <-e.closeCh:
+			// drain the queued events
+			for {
+				select {
+				case ev := <-e.queue:
+					e.emit(ev)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (e *Emitter) emit(ev *RunEvent) {
+	for _, t := range e.opt.Transports {
+		ctx, cancel := context.WithTimeout(context.Background(), e.opt.EmitTimeout)
+		if err := t.Emit(ctx, ev); err != nil {
+			log.Errorf("emit lineage %s event of job %s failed: %s", ev.EventType, ev.Job.Name, err)
+		}
+		cancel()
+	}
+}
@@ -0,0 +1,167 @@
+package openlineage
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/entity/run"
+)
+
+const (
+	// DefaultNamespace is the job namespace when Option.Namespace is empty
+	DefaultNamespace = "fastflow"
+	// Producer is the "producer" of events and facets
+	Producer = "https://github.com/etherealiy/fastflow"
+
+	runEventSchemaURL    = "https://openlineage.io/spec/2-0-2/OpenLineage.json#/$defs/RunEvent"
+	parentFacetSchemaURL = "https://openlineage.io/spec/facets/1-0-0/ParentRunFacet.json#/$defs/ParentRunFacet"
+	errorFacetSchemaURL  = "https://openlineage.io/spec/facets/1-0-0/ErrorMessageRunFacet.json#/$defs/ErrorMessageRunFacet"
+)
+
+// EventType
+type EventType string
+
+const (
+	EventTypeStart    EventType = "START"
+	EventTypeComplete EventType = "COMPLETE"
+	EventTypeAbort    EventType = "ABORT"
+	EventTypeFail     EventType = "FAIL"
+)
+
+// RunEvent is the OpenLineage run event
+type RunEvent struct {
+	EventType EventType     `json:"eventType"`
+	EventTime time.Time     `json:"eventTime"`
+	Run       Run           `json:"run"`
+	Job       Job           `json:"job"`
+	Inputs    []run.Dataset `json:"inputs"`
+	Outputs   []run.Dataset `json:"outputs"`
+	Producer  string        `json:"producer"`
+	SchemaURL string        `json:"schemaURL"`
+}
+
+// Run
+type Run struct {
+	RunID  string                 `json:"runId"`
+	Facets map[string]interface{} `json:"facets,omitempty"`
+}
+
+// Job
+type Job struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+}
+
+// ParentRunFacet link the run of task to the run of dag
+type ParentRunFacet struct {
+	Producer  string `json:"_producer"`
+	SchemaURL string `json:"_schemaURL"`
+	Run       struct {
+		RunID string `json:"runId"`
+	} `json:"run"`
+	Job Job `json:"job"`
+}
+
+// ErrorMessageRunFacet
+type ErrorMessageRunFacet struct {
+	Producer            string `json:"_producer"`
+	SchemaURL           string `json:"_schemaURL"`
+	Message             string `json:"message"`
+	ProgrammingLanguage string `json:"programmingLanguage"`
+}
+
+// RunID convert the id of instance to uuid, so the events of the same instance have the same run id
+func RunID(insID string) string {
+	sum := sha1.Sum([]byte("fastflow:" + insID))
+	// set version 5 and variant bits as a name-based uuid
+	sum[6] = (sum[6] & 0x0f) | 0x50
+	sum[8] = (sum[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
+
+// TaskJobName is like "{dagId}.{taskId}"
+func TaskJobName(dagID, taskID string) string {
+	return dagID + "." + taskID
+}
+
+// DagInstanceEventType return empty when the status need not be reported
+func DagInstanceEventType(status entity.DagInstanceStatus) EventType {
+	switch status {
+	case entity.DagInstanceStatusRunning:
+		return EventTypeStart
+	case entity.DagInstanceStatusSuccess:
+		return EventTypeComplete
+	case entity.DagInstanceStatusFailed:
+		return EventTypeFail
+	}
+	return ""
+}
+
+// TaskInstanceEventType return empty when the status need not be reported
+func TaskInstanceEventType(status entity.TaskInstanceStatus) EventType {
+	switch status {
+	case entity.TaskInstanceStatusRunning:
+		return EventTypeStart
+	case entity.TaskInstanceStatusSuccess, entity.TaskInstanceStatusSkipped:
+		return EventTypeComplete
+	case entity.TaskInstanceStatusFailed, entity.TaskInstanceStatusInvalidParams:
+		return EventTypeFail
+	case entity.TaskInstanceStatusCanceled:
+		return EventTypeAbort
+	}
+	return ""
+}
+
+// NewDagInstanceEvent
+func NewDagInstanceEvent(namespace string, dagIns *entity.DagInstance) *RunEvent {
+	ev := newRunEvent(DagInstanceEventType(dagIns.Status), dagIns.ID, Job{Namespace: namespace, Name: dagIns.DagID})
+	if dagIns.Status == entity.DagInstanceStatusFailed {
+		ev.Run.Facets = map[string]interface{}{"errorMessage": newErrorFacet(dagIns.Reason)}
+	}
+	return ev
+}
+
+// NewTaskInstanceEvent
+func NewTaskInstanceEvent(namespace, dagID string, taskIns *entity.TaskInstance) *RunEvent {
+	ev := newRunEvent(TaskInstanceEventType(taskIns.Status), taskIns.ID,
+		Job{Namespace: namespace, Name: TaskJobName(dagID, taskIns.TaskID)})
+	parent := &ParentRunFacet{
+		Producer:  Producer,
+		SchemaURL: parentFacetSchemaURL,
+		Job:       Job{Namespace: namespace, Name: dagID},
+	}
+	parent.Run.RunID = RunID(taskIns.DagInsID)
+	ev.Run.Facets = map[string]interface{}{"parent": parent}
+	if taskIns.Status == entity.TaskInstanceStatusFailed || taskIns.Status == entity.TaskInstanceStatusInvalidParams {
+		ev.Run.Facets["errorMessage"] = newErrorFacet(taskIns.Reason)
+	}
+	if taskIns.Lineage != nil {
+		ev.Inputs = append(ev.Inputs, taskIns.Lineage.Inputs...)
+		ev.Outputs = append(ev.Outputs, taskIns.Lineage.Outputs...)
+	}
+	return ev
+}
+
+func newRunEvent(typ EventType, insID string, job Job) *RunEvent {
+	return &RunEvent{
+		EventType: typ,
+		EventTime: time.Now().UTC(),
+		Run:       Run{RunID: RunID(insID)},
+		Job:       job,
+		Inputs:    []run.Dataset{},
+		Outputs:   []run.Dataset{},
+		Producer:  Producer,
+		SchemaURL: runEventSchemaURL,
+	}
+}
+
+func newErrorFacet(msg string) *ErrorMessageRunFacet {
+	return &ErrorMessageRunFacet{
+		Producer:            Producer,
+		SchemaURL:           errorFacetSchemaURL,
+		Message:             msg,
+		ProgrammingLanguage: "go",
+	}
+}
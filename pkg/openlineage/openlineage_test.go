@@ -0,0 +1,114 @@
+package openlineage
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync"
+	"testing"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/entity/run"
+	"github.com/etherealiy/fastflow/pkg/event"
+	"github.com/etherealiy/fastflow/pkg/mod"
+	"github.com/etherealiy/fastflow/store/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeTransport struct {
+	events []*RunEvent
+	mutex  sync.Mutex
+}
+
+func (t *fakeTransport) Emit(ctx context.Context, ev *RunEvent) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.events = append(t.events, ev)
+	return nil
+}
+
+func TestEmitter_Handle(t *testing.T) {
+	st := memory.NewStore()
+	mod.SetStore(st)
+	assert.NoError(t, st.CreateDagIns(&entity.DagInstance{DagID: "stored-dag"}))
+
+	transport := &fakeTransport{}
+	e := NewEmitter(&Option{Transports: []Transport{transport}})
+	e.wg.Add(1)
+	go e.goEmit()
+
+	ctx := context.Background()
+	taskIns := &entity.TaskInstance{BaseInfo: entity.BaseInfo{ID: "task-ins"}, TaskID: "extract", DagInsID: "dag-ins"}
+	e.Handle(ctx, &event.DagInstanceUpdated{Payload: &entity.DagInstance{BaseInfo: entity.BaseInfo{ID: "dag-ins"}, DagID: "etl", Status: entity.DagInstanceStatusScheduled}})
+	e.Handle(ctx, &event.DagInstanceUpdated{Payload: &entity.DagInstance{BaseInfo: entity.BaseInfo{ID: "dag-ins"}, DagID: "etl", Status: entity.DagInstanceStatusRunning}})
+	e.Handle(ctx, &event.DagInstancePatched{Payload: &entity.DagInstance{BaseInfo: entity.BaseInfo{ID: "dag-ins"}, Status: entity.DagInstanceStatusRunning}})
+	e.Handle(ctx, &event.TaskBegin{TaskIns: taskIns})
+	taskIns.Status = entity.TaskInstanceStatusSuccess
+	taskIns.Lineage = &run.Lineage{
+		Inputs:  []run.Dataset{{Namespace: "postgres://db:5432", Name: "public.orders"}},
+		Outputs: []run.Dataset{{Namespace: "s3://bucket", Name: "orders.parquet"}},
+	}
+	e.Handle(ctx, &event.TaskCompleted{TaskIns: taskIns})
+	e.Handle(ctx, &event.DagInstancePatched{Payload: &entity.DagInstance{BaseInfo: entity.BaseInfo{ID: "dag-ins"}, Status: entity.DagInstanceStatusFailed, Reason: "oops"}})
+	// the dag instance started before emitter
+	e.Handle(ctx, &event.TaskCompleted{TaskIns: &entity.TaskInstance{TaskID: "load", DagInsID: "1", Status: entity.TaskInstanceStatusCanceled}})
+	e.Close()
+
+	var got []string
+	for _, ev := range transport.events {
+		got = append(got, string(ev.EventType)+" "+ev.Job.Name)
+		assert.Equal(t, DefaultNamespace, ev.Job.Namespace)
+	}
+	assert.Equal(t, []string{
+		"START etl",
+		"START etl.extract",
+		"COMPLETE etl.extract",
+		"FAIL etl",
+		"ABORT stored-dag.load",
+	}, got)
+
+	dagRunID := RunID("dag-ins")
+	assert.Equal(t, dagRunID, transport.events[0].Run.RunID)
+	assert.Equal(t, transport.events[1].Run.RunID, transport.events[2].Run.RunID)
+	parent := transport.events[2].Run.Facets["parent"].(*ParentRunFacet)
+	assert.Equal(t, dagRunID, parent.Run.RunID)
+	assert.Equal(t, "etl", parent.Job.Name)
+	assert.Equal(t, taskIns.Lineage.Inputs, transport.events[2].Inputs)
+	assert.Equal(t, taskIns.Lineage.Outputs, transport.events[2].Outputs)
+	assert.Equal(t, "oops", transport.events[3].Run.Facets["errorMessage"].(*ErrorMessageRunFacet).Message)
+}
+
+func TestRunID(t *testing.T) {
+	assert.Equal(t, RunID("a"), RunID("a"))
+	assert.NotEqual(t, RunID("a"), RunID("b"))
+	assert.Regexp(t, regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-5[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`), RunID("a"))
+}
+
+func TestHTTPTransport_Emit(t *testing.T) {
+	var gotAuth string
+	var got map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		bs, _ := ioutil.ReadAll(r.Body)
+		assert.NoError(t, json.Unmarshal(bs, &got))
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+
+	ev := NewDagInstanceEvent("ns", &entity.DagInstance{BaseInfo: entity.BaseInfo{ID: "d1"}, DagID: "etl", Status: entity.DagInstanceStatusSuccess})
+	assert.NoError(t, (&HTTPTransport{URL: srv.URL, APIKey: "key"}).Emit(context.Background(), ev))
+	assert.Equal(t, "Bearer key", gotAuth)
+	assert.Equal(t, "COMPLETE", got["eventType"])
+	assert.Equal(t, map[string]interface{}{"namespace": "ns", "name": "etl"}, got["job"])
+	assert.Equal(t, []interface{}{}, got["inputs"])
+	assert.Equal(t, Producer, got["producer"])
+
+	failed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer failed.Close()
+	assert.Error(t, (&HTTPTransport{URL: failed.URL}).Emit(context.Background(), ev))
+}
@@ -0,0 +1,65 @@
+package openlineage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// Transport deliver events to lineage backend
+type Transport interface {
+	Emit(ctx context.Context, ev *RunEvent) error
+}
+
+// HTTPTransport post events to the OpenLineage HTTP endpoint, such as "http://marquez:5000/api/v1/lineage"
+type HTTPTransport struct {
+	URL string
+	// APIKey is sent as bearer token, empty means no authorization
+	APIKey string
+	Header http.Header
+	// Client default is a client with 10s timeout
+	Client *http.Client
+}
+
+var defHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// Emit
+func (t *HTTPTransport) Emit(ctx context.Context, ev *RunEvent) error {
+	bs, err := json.Marshal(ev)
+	if err != nil {
+		return fmt.Errorf("marshal event failed: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.URL, bytes.NewReader(bs))
+	if err != nil {
+		return err
+	}
+	for k, vs := range t.Header {
+		for _, v := range vs {
+			req.Header.Add(k, v)
+		}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if t.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+t.APIKey)
+	}
+
+	client := t.Client
+	if client == nil {
+		client = defHTTPClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, msg)
+	}
+	return nil
+}
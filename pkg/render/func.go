@@ -0,0 +1,28 @@
+package render
+
+import (
+	"crypto/rand"
+	"fmt"
+	"os"
+	"text/template"
+	"time"
+)
+
+// builtinFuncs can be used in all templates, such as "{{now.UTC.Format "2006-01-02"}}",
+// "{{uuid}}" and "{{env "HOME"}}"
+var builtinFuncs = template.FuncMap{
+	"now":  time.Now,
+	"uuid": NewUUID,
+	"env":  os.Getenv,
+}
+
+// NewUUID return a random uuid of version 4
+func NewUUID() (string, error) {
+	bs := make([]byte, 16)
+	if _, err := rand.Read(bs); err != nil {
+		return "", err
+	}
+	bs[6] = bs[6]&0x0f | 0x40
+	bs[8] = bs[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", bs[0:4], bs[4:6], bs[6:8], bs[8:10], bs[10:]), nil
+}
@@ -10,14 +10,41 @@ var (
 	CacheSize = 1000
 )
 
+// MissingKeyMode decide how to render the variables which are not found
+type MissingKeyMode string
+
+const (
+	// MissingKeyStrict fail the rendering when a variable is not found, it is default
+	MissingKeyStrict MissingKeyMode = "strict"
+	// MissingKeyLenient render the variables which are not found as empty string
+	MissingKeyLenient MissingKeyMode = "lenient"
+)
+
+// noValue is printed by text/template for the missing variables in lenient mode
+const noValue = "<no value>"
+
 type TplRender struct {
 	tplProvider *TplProvider
 }
 
-func NewTplRender() *TplRender {
-	return &TplRender{
+// TplRenderOp
+type TplRenderOp func(r *TplRender)
+
+// WithMissingKeyMode set how to render the variables which are not found
+func WithMissingKeyMode(mode MissingKeyMode) TplRenderOp {
+	return func(r *TplRender) {
+		r.tplProvider.mode = mode
+	}
+}
+
+func NewTplRender(ops ...TplRenderOp) *TplRender {
+	r := &TplRender{
 		tplProvider: NewCachedTplProvider(CacheSize),
 	}
+	for _, op := range ops {
+		op(r)
+	}
+	return r
 }
 
 func (t *TplRender) Render(tplText string, data interface{}) (string, error) {
@@ -31,6 +58,9 @@ func (t *TplRender) Render(tplText string, data interface{}) (string, error) {
 	if err != nil {
 		return "", fmt.Errorf("execute tpl failed: %w", err)
 	}
+	if t.tplProvider.mode == MissingKeyLenient {
+		return strings.ReplaceAll(buf.String(), noValue, ""), nil
+	}
 	return buf.String(), nil
 
 }
@@ -0,0 +1,21 @@
+package render
+
+import (
+	"testing"
+)
+
+func FuzzTplRender_Render(f *testing.F) {
+	f.Add("plain text", "value")
+	f.Add("{{.key}}", "value")
+	f.Add("{{index .key 0}}", "value")
+	f.Add("{{range .}}{{.}}{{end}}", "value")
+	f.Add("{{template \"x\"}}", "value")
+	f.Add("{{.key.sub}}", "value")
+	f.Add("{{hhh}}", "value")
+	f.Add("{{", "value")
+
+	r := NewTplRender()
+	f.Fuzz(func(t *testing.T, tpl, val string) {
+		_, _ = r.Render(tpl, map[string]interface{}{"key": val})
+	})
+}
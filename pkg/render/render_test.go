@@ -0,0 +1,74 @@
+package render
+
+import (
+	"os"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTplRender_Render(t *testing.T) {
+	os.Setenv("FASTFLOW_TEST_RENDER", "from-env")
+	defer os.Unsetenv("FASTFLOW_TEST_RENDER")
+
+	data := map[string]interface{}{
+		"vars": map[string]string{"region": "eu"},
+	}
+	tests := []struct {
+		caseDesc  string
+		giveMode  MissingKeyMode
+		giveTpl   string
+		wantRet   string
+		wantMatch string
+		wantErr   bool
+	}{
+		{
+			caseDesc: "normal",
+			giveTpl:  "region-{{.vars.region}}",
+			wantRet:  "region-eu",
+		},
+		{
+			caseDesc: "env",
+			giveTpl:  `{{env "FASTFLOW_TEST_RENDER"}}`,
+			wantRet:  "from-env",
+		},
+		{
+			caseDesc:  "uuid",
+			giveTpl:   "{{uuid}}",
+			wantMatch: "^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$",
+		},
+		{
+			caseDesc:  "now",
+			giveTpl:   `{{now.UTC.Format "2006"}}`,
+			wantMatch: "^[0-9]{4}$",
+		},
+		{
+			caseDesc: "strict missing",
+			giveTpl:  "{{.vars.zone}}",
+			wantErr:  true,
+		},
+		{
+			caseDesc: "lenient missing",
+			giveMode: MissingKeyLenient,
+			giveTpl:  "zone-{{.vars.zone}}-{{.outputs.extract.rows}}",
+			wantRet:  "zone--",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			r := NewTplRender(WithMissingKeyMode(tc.giveMode))
+			ret, err := r.Render(tc.giveTpl, data)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			if tc.wantMatch != "" {
+				assert.Regexp(t, regexp.MustCompile(tc.wantMatch), ret)
+				return
+			}
+			assert.Equal(t, tc.wantRet, ret)
+		})
+	}
+}
@@ -10,6 +10,7 @@ import (
 type TplProvider struct {
 	cache   *lru.Cache
 	rwMutex sync.RWMutex
+	mode    MissingKeyMode
 }
 
 func NewCachedTplProvider(maxSize int) *TplProvider {
@@ -50,10 +51,14 @@ func (c *TplProvider) GetTpl(tplText string) (*template.Template, error) {
 }
 
 func (c *TplProvider) parseTpl(tplText string) (*template.Template, error) {
-	tpl, err := template.New(tplText).Parse(tplText)
+	tpl, err := template.New(tplText).Funcs(builtinFuncs).Parse(tplText)
 	if err != nil {
 		return nil, err
 	}
-	tpl.Option("missingkey=error")
+	if c.mode == MissingKeyLenient {
+		tpl.Option("missingkey=default")
+	} else {
+		tpl.Option("missingkey=error")
+	}
 	return tpl, err
 }
@@ -0,0 +1,215 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultServiceName is the service name of spans when it is not set
+const DefaultServiceName = "fastflow"
+
+const scopeName = "github.com/etherealiy/fastflow"
+
+var defHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// Exporter send the finished spans to tracing backend
+type Exporter interface {
+	Export(ctx context.Context, spans []*SpanData) error
+}
+
+// OTLPExporter send spans to the OpenTelemetry collector or any backend which supports OTLP/HTTP with json encoding,
+// such as Jaeger and Tempo
+type OTLPExporter struct {
+	// Endpoint is the url of traces, such as "http://otel-collector:4318/v1/traces"
+	Endpoint string
+	Header   http.Header
+	// ServiceName is the "service.name" of resource, default is DefaultServiceName
+	ServiceName string
+	// Client default is a client with 10s timeout
+	Client *http.Client
+}
+
+// Export
+func (e *OTLPExporter) Export(ctx context.Context, spans []*SpanData) error {
+	bs, err := json.Marshal(newOTLPRequest(e.ServiceName, spans))
+	if err != nil {
+		return fmt.Errorf("marshal spans failed: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.Endpoint, bytes.NewReader(bs))
+	if err != nil {
+		return err
+	}
+	for k, vs := range e.Header {
+		for _, v := range vs {
+			req.Header.Add(k, v)
+		}
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := e.Client
+	if client == nil {
+		client = defHTTPClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, msg)
+	}
+	return nil
+}
+
+// WriterExporter write each span as a line of OTLP json, it is used to debug or collect spans from logs
+type WriterExporter struct {
+	Writer io.Writer
+	// ServiceName is the "service.name" of resource, default is DefaultServiceName
+	ServiceName string
+
+	lock sync.Mutex
+}
+
+// Export
+func (e *WriterExporter) Export(ctx context.Context, spans []*SpanData) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	for _, s := range spans {
+		bs, err := json.Marshal(newOTLPRequest(e.ServiceName, []*SpanData{s}))
+		if err != nil {
+			return fmt.Errorf("marshal span failed: %w", err)
+		}
+		if _, err := e.Writer.Write(append(bs, '\n')); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// the json encoding of OTLP, see https://opentelemetry.io/docs/specs/otlp/#json-protobuf-encoding
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    StatusCode `json:"code,omitempty"`
+	Message string     `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+// spanKindInternal is the kind of all spans, because they are operations of engine
+const spanKindInternal = 1
+
+func newOTLPRequest(serviceName string, spans []*SpanData) *otlpRequest {
+	if serviceName == "" {
+		serviceName = DefaultServiceName
+	}
+	ss := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		span := otlpSpan{
+			TraceID:           s.TraceID.String(),
+			SpanID:            s.SpanID.String(),
+			Name:              s.Name,
+			Kind:              spanKindInternal,
+			StartTimeUnixNano: strconv.FormatInt(s.StartTime.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.EndTime.UnixNano(), 10),
+			Attributes:        otlpAttributes(s.Attributes),
+			Status:            otlpStatus{Code: s.StatusCode, Message: s.StatusMessage},
+		}
+		if s.ParentSpanID.IsValid() {
+			span.ParentSpanID = s.ParentSpanID.String()
+		}
+		ss = append(ss, span)
+	}
+	return &otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: otlpAttributes(map[string]interface{}{"service.name": serviceName})},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: scopeName}, Spans: ss}},
+	}}}
+}
+
+// otlpAttributes sort attributes by key, so the output is stable
+func otlpAttributes(attrs map[string]interface{}) []otlpKeyValue {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	ret := make([]otlpKeyValue, 0, len(keys))
+	for _, k := range keys {
+		ret = append(ret, otlpKeyValue{Key: k, Value: newOTLPValue(attrs[k])})
+	}
+	return ret
+}
+
+func newOTLPValue(v interface{}) otlpValue {
+	var ret otlpValue
+	switch val := v.(type) {
+	case string:
+		ret.StringValue = &val
+	case bool:
+		ret.BoolValue = &val
+	case int:
+		s := strconv.Itoa(val)
+		ret.IntValue = &s
+	case int64:
+		s := strconv.FormatInt(val, 10)
+		ret.IntValue = &s
+	case float64:
+		ret.DoubleValue = &val
+	default:
+		s := fmt.Sprint(val)
+		ret.StringValue = &s
+	}
+	return ret
+}
@@ -0,0 +1,231 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceID is the W3C trace id
+type TraceID [16]byte
+
+// String
+func (t TraceID) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+// IsValid
+func (t TraceID) IsValid() bool {
+	return t != TraceID{}
+}
+
+// SpanID is the W3C span id
+type SpanID [8]byte
+
+// String
+func (s SpanID) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+// IsValid
+func (s SpanID) IsValid() bool {
+	return s != SpanID{}
+}
+
+// StatusCode is the same as the status code of OpenTelemetry
+type StatusCode int
+
+const (
+	StatusUnset StatusCode = 0
+	StatusOK    StatusCode = 1
+	StatusError StatusCode = 2
+)
+
+// SpanData is the finished span which is exported
+type SpanData struct {
+	TraceID       TraceID
+	SpanID        SpanID
+	ParentSpanID  SpanID
+	Name          string
+	StartTime     time.Time
+	EndTime       time.Time
+	Attributes    map[string]interface{}
+	StatusCode    StatusCode
+	StatusMessage string
+}
+
+// Span is an operation in trace, it is exported when it is ended. The methods of nil span do nothing,
+// so Start can be used when tracing is disabled.
+type Span struct {
+	tracer *Tracer
+	data   SpanData
+	ended  bool
+	lock   sync.Mutex
+}
+
+func newSpan(tracer *Tracer, traceID TraceID, spanID, parentID SpanID, name string, start time.Time) *Span {
+	return &Span{
+		tracer: tracer,
+		data: SpanData{
+			TraceID:      traceID,
+			SpanID:       spanID,
+			ParentSpanID: parentID,
+			Name:         name,
+			StartTime:    start,
+			Attributes:   map[string]interface{}{},
+		},
+	}
+}
+
+// TraceID
+func (s *Span) TraceID() TraceID {
+	if s == nil {
+		return TraceID{}
+	}
+	return s.data.TraceID
+}
+
+// SpanID
+func (s *Span) SpanID() SpanID {
+	if s == nil {
+		return SpanID{}
+	}
+	return s.data.SpanID
+}
+
+// SetAttribute the value should be a string, bool, integer or float
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.data.Attributes[key] = value
+}
+
+// SetStatus
+func (s *Span) SetStatus(code StatusCode, msg string) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.data.StatusCode, s.data.StatusMessage = code, msg
+}
+
+// RecordError set the status to error when err is not nil
+func (s *Span) RecordError(err error) {
+	if err != nil {
+		s.SetStatus(StatusError, err.Error())
+	}
+}
+
+// End the span and export it, only the first call works
+func (s *Span) End() {
+	s.end(time.Now())
+}
+
+func (s *Span) end(at time.Time) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	if s.ended {
+		s.lock.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.EndTime = at
+	data := s.data
+	s.lock.Unlock()
+	s.tracer.enqueue(&data)
+}
+
+type spanKey struct{}
+
+// ContextWithSpan
+func ContextWithSpan(ctx context.Context, s *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, s)
+}
+
+// SpanFromContext return nil when there is no span in context
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// Start a child span of the span in context, such as the span of task instance in the context of action,
+// it returns nil span when there is no span in context.
+//
+//	ctx, span := tracing.Start(ctx.Context(), "query orders")
+//	defer span.End()
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	parent := SpanFromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+	s := newSpan(parent.tracer, parent.data.TraceID, randomSpanID(), parent.data.SpanID, name, time.Now())
+	return ContextWithSpan(ctx, s), s
+}
+
+// TraceParent return the W3C traceparent header of the span in context, it is used to propagate the trace
+// to other services or the OpenTelemetry SDK, it returns empty when there is no span in context
+func TraceParent(ctx context.Context) string {
+	s := SpanFromContext(ctx)
+	if s == nil {
+		return ""
+	}
+	return fmt.Sprintf("00-%s-%s-01", s.data.TraceID, s.data.SpanID)
+}
+
+// ParseTraceParent parse the W3C traceparent header
+func ParseTraceParent(header string) (TraceID, SpanID, error) {
+	var (
+		traceID TraceID
+		spanID  SpanID
+	)
+	parts := strings.Split(header, "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return traceID, spanID, fmt.Errorf("traceparent[%s] is invalid", header)
+	}
+	if _, err := hex.Decode(traceID[:], []byte(parts[1])); err != nil {
+		return traceID, spanID, fmt.Errorf("trace id of traceparent[%s] is invalid: %w", header, err)
+	}
+	if _, err := hex.Decode(spanID[:], []byte(parts[2])); err != nil {
+		return traceID, spanID, fmt.Errorf("span id of traceparent[%s] is invalid: %w", header, err)
+	}
+	if !traceID.IsValid() || !spanID.IsValid() {
+		return traceID, spanID, fmt.Errorf("traceparent[%s] has zero id", header)
+	}
+	return traceID, spanID, nil
+}
+
+// dagInsTraceID is derived from dag instance, so all workers put its spans into the same trace
+func dagInsTraceID(dagInsID string) TraceID {
+	var id TraceID
+	sum := sha256.Sum256([]byte("dagins/" + dagInsID))
+	copy(id[:], sum[:])
+	return id
+}
+
+// derivedSpanID is derived from parts, so the span of dag instance is known by the workers running its tasks
+func derivedSpanID(parts ...string) SpanID {
+	var id SpanID
+	sum := sha256.Sum256([]byte(strings.Join(parts, "/")))
+	copy(id[:], sum[:])
+	return id
+}
+
+func randomSpanID() SpanID {
+	var id SpanID
+	if _, err := rand.Read(id[:]); err != nil {
+		// it should never happen, fallback to the time which is still unique enough
+		return derivedSpanID(time.Now().String())
+	}
+	return id
+}
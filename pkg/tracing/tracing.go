@@ -0,0 +1,300 @@
+package tracing
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/event"
+	"github.com/etherealiy/fastflow/pkg/log"
+	"github.com/etherealiy/fastflow/pkg/mod"
+	"github.com/etherealiy/fastflow/pkg/utils"
+	"github.com/golang/groupcache/lru"
+	"github.com/shiningrush/goevent"
+)
+
+// the attributes of spans
+const (
+	AttrDagID         = "fastflow.dag.id"
+	AttrDagInsID      = "fastflow.dag_instance.id"
+	AttrDagInsStatus  = "fastflow.dag_instance.status"
+	AttrTaskID        = "fastflow.task.id"
+	AttrTaskInsID     = "fastflow.task_instance.id"
+	AttrTaskInsStatus = "fastflow.task_instance.status"
+	AttrAction        = "fastflow.action"
+	AttrWorker        = "fastflow.worker"
+	AttrAttempt       = "fastflow.attempt"
+)
+
+// Option
+type Option struct {
+	Exporters []Exporter
+	// BufferSize is the size of queue, spans will be dropped when it is full, default is 2048
+	BufferSize int
+	// BatchSize is the max count of spans in each exporting, default is 512
+	BatchSize int
+	// FlushInterval is the interval of exporting the queued spans, default is 5s
+	FlushInterval time.Duration
+	// ExportTimeout is the timeout of each exporting, default is 10s
+	ExportTimeout time.Duration
+}
+
+// Tracer trace the execution of engine, there is a span for each run of dag instance and a child span for each
+// attempt of task instance, the span of task instance is in the context of action, so actions can add
+// their own spans by Start. The trace id is derived from dag instance, so the spans of a dag instance which
+// runs on many workers are in the same trace.
+//
+//	tracer := tracing.NewTracer(&tracing.Option{
+//		Exporters: []tracing.Exporter{&tracing.OTLPExporter{Endpoint: "http://otel-collector:4318/v1/traces"}},
+//	})
+//	if err := tracer.Start(); err != nil { ... }
+//	defer tracer.Close()
+type Tracer struct {
+	opt *Option
+
+	queue     chan *SpanData
+	closeCh   chan struct{}
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+
+	// dagRuns record the start time of running dag instances, and ended record the ended runs,
+	// so a run is not exported twice when the terminal status is patched again
+	dagRuns  map[string]time.Time
+	ended    *lru.Cache
+	dagsLock sync.Mutex
+}
+
+// NewTracer
+func NewTracer(opt *Option) *Tracer {
+	if opt.BufferSize == 0 {
+		opt.BufferSize = 2048
+	}
+	if opt.BatchSize == 0 {
+		opt.BatchSize = 512
+	}
+	if opt.FlushInterval == 0 {
+		opt.FlushInterval = 5 * time.Second
+	}
+	if opt.ExportTimeout == 0 {
+		opt.ExportTimeout = 10 * time.Second
+	}
+	return &Tracer{
+		opt:     opt,
+		queue:   make(chan *SpanData, opt.BufferSize),
+		closeCh: make(chan struct{}),
+		dagRuns: map[string]time.Time{},
+		ended:   lru.New(1024),
+	}
+}
+
+// Start subscribe the events of engine and trace the task instances, you should call it before fastflow start
+func (t *Tracer) Start() error {
+	if err := goevent.Subscribe(t); err != nil {
+		return err
+	}
+	mod.SetTaskTracer(t)
+	t.wg.Add(1)
+	go t.goExport()
+	return nil
+}
+
+// Close stop tracing and wait for the queued spans exported
+func (t *Tracer) Close() {
+	t.closeOnce.Do(func() {
+		if mod.GetTaskTracer() == t {
+			mod.SetTaskTracer(nil)
+		}
+		close(t.closeCh)
+		t.wg.Wait()
+	})
+}
+
+// Topic is goevent's topic
+func (t *Tracer) Topic() []string {
+	return []string{event.KeyDagInstancePatched, event.KeyDagInstanceUpdated}
+}
+
+// Handle is goevent's handler
+func (t *Tracer) Handle(ctx context.Context, ev goevent.Event) {
+	switch v := ev.(type) {
+	case *event.DagInstancePatched:
+		t.traceDagIns(v.Payload)
+	case *event.DagInstanceUpdated:
+		t.traceDagIns(v.Payload)
+	}
+}
+
+// StartTask implement mod.TaskTracer
+func (t *Tracer) StartTask(taskIns *entity.TaskInstance) func() {
+	var (
+		dagID string
+		retry int
+	)
+	if taskIns.RelatedDagInstance != nil {
+		dagID = taskIns.RelatedDagInstance.DagID
+		retry = taskIns.RelatedDagInstance.RetryCount
+	}
+	attempt := len(taskIns.Attempts) + 1
+	s := newSpan(t,
+		dagInsTraceID(taskIns.DagInsID),
+		derivedSpanID("taskins", taskIns.ID, strconv.Itoa(attempt)),
+		dagInsSpanID(taskIns.DagInsID, retry),
+		taskIns.TaskID,
+		time.Now())
+	s.SetAttribute(AttrDagID, dagID)
+	s.SetAttribute(AttrDagInsID, taskIns.DagInsID)
+	s.SetAttribute(AttrTaskID, taskIns.TaskID)
+	s.SetAttribute(AttrTaskInsID, taskIns.ID)
+	s.SetAttribute(AttrAction, taskIns.ActionName)
+	s.SetAttribute(AttrWorker, workerKey())
+	s.SetAttribute(AttrAttempt, attempt)
+	if taskIns.Context != nil {
+		taskIns.Context.WithValue(spanKey{}, s)
+	}
+
+	return func() {
+		switch taskIns.Status {
+		case entity.TaskInstanceStatusSuccess:
+			s.SetStatus(StatusOK, "")
+		case entity.TaskInstanceStatusFailed, entity.TaskInstanceStatusInvalidParams, entity.TaskInstanceStatusCanceled:
+			s.SetStatus(StatusError, taskIns.Reason)
+		}
+		s.SetAttribute(AttrTaskInsStatus, string(taskIns.Status))
+		s.End()
+	}
+}
+
+func (t *Tracer) traceDagIns(dagIns *entity.DagInstance) {
+	if dagIns == nil {
+		return
+	}
+	switch dagIns.Status {
+	case entity.DagInstanceStatusRunning:
+		t.dagsLock.Lock()
+		if _, ok := t.dagRuns[dagIns.ID]; !ok {
+			t.dagRuns[dagIns.ID] = time.Now()
+		}
+		t.dagsLock.Unlock()
+	case entity.DagInstanceStatusSuccess, entity.DagInstanceStatusFailed:
+		t.endDagIns(dagIns)
+	}
+}
+
+func (t *Tracer) endDagIns(dagIns *entity.DagInstance) {
+	// patched dag instance may only contain the changed fields
+	ins := dagIns
+	if ins.DagID == "" && mod.GetStore() != nil {
+		stored, err := mod.GetStore().GetDagInstance(dagIns.ID)
+		if err != nil {
+			log.With(utils.LogKeyDagInsID, dagIns.ID).Warnf("get dag instance for tracing failed: %s", err)
+		} else {
+			ins = stored
+		}
+	}
+	spanID := dagInsSpanID(dagIns.ID, ins.RetryCount)
+
+	t.dagsLock.Lock()
+	if _, ok := t.ended.Get(spanID); ok {
+		t.dagsLock.Unlock()
+		return
+	}
+	t.ended.Add(spanID, struct{}{})
+	start, ok := t.dagRuns[dagIns.ID]
+	delete(t.dagRuns, dagIns.ID)
+	t.dagsLock.Unlock()
+	// the dag instance started before tracer, such as worker restarted
+	if !ok {
+		start = time.Now()
+		if ins.CreatedAt > 0 {
+			start = time.Unix(ins.CreatedAt, 0)
+		}
+	}
+
+	s := newSpan(t, dagInsTraceID(dagIns.ID), spanID, SpanID{}, ins.DagID, start)
+	s.SetAttribute(AttrDagID, ins.DagID)
+	s.SetAttribute(AttrDagInsID, dagIns.ID)
+	s.SetAttribute(AttrDagInsStatus, string(dagIns.Status))
+	s.SetAttribute(AttrWorker, workerKey())
+	if dagIns.Status == entity.DagInstanceStatusFailed {
+		s.SetStatus(StatusError, dagIns.Reason)
+	} else {
+		s.SetStatus(StatusOK, "")
+	}
+	s.End()
+}
+
+func (t *Tracer) enqueue(span *SpanData) {
+	select {
+	case <-t.closeCh:
+		return
+	default:
+	}
+	select {
+	case t.queue <- span:
+	default:
+		log.Warnf("tracing span queue is full, drop span %s of trace %s", span.Name, span.TraceID)
+	}
+}
+
+func (t *Tracer) goExport() {
+	defer t.wg.Done()
+	ticker := time.NewTicker(t.opt.FlushInterval)
+	defer ticker.Stop()
+
+	var batch []*SpanData
+	for {
+		select {
+		case span := <-t.queue:
+			batch = append(batch, span)
+			if len(batch) >= t.opt.BatchSize {
+				t.export(batch)
+				batch = nil
+			}
+		case <-ticker.C:
+			t.export(batch)
+			batch = nil
+		case <-t.closeCh:
+			// drain the queued spans
+			for {
+				select {
+				case span := <-t.queue:
+					batch = append(batch, span)
+					if len(batch) >= t.opt.BatchSize {
+						t.export(batch)
+						batch = nil
+					}
+				default:
+					t.export(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+func (t *Tracer) export(spans []*SpanData) {
+	if len(spans) == 0 {
+		return
+	}
+	for _, e := range t.opt.Exporters {
+		ctx, cancel := context.WithTimeout(context.Background(), t.opt.ExportTimeout)
+		if err := e.Export(ctx, spans); err != nil {
+			log.Errorf("export %d spans failed: %s", len(spans), err)
+		}
+		cancel()
+	}
+}
+
+// dagInsSpanID is the span of a run of dag instance, each retry of dag instance is a new run
+func dagInsSpanID(dagInsID string, retryCount int) SpanID {
+	return derivedSpanID("dagins", dagInsID, strconv.Itoa(retryCount))
+}
+
+func workerKey() string {
+	if mod.GetKeeper() == nil {
+		return ""
+	}
+	return mod.GetKeeper().WorkerKey()
+}
@@ -0,0 +1,219 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/entity/run"
+	"github.com/etherealiy/fastflow/pkg/event"
+	"github.com/etherealiy/fastflow/pkg/mod"
+	"github.com/etherealiy/fastflow/store/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeExporter struct {
+	spans map[string]*SpanData
+	mutex sync.Mutex
+}
+
+func (e *fakeExporter) Export(ctx context.Context, spans []*SpanData) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	for _, s := range spans {
+		e.spans[s.Name] = s
+	}
+	return nil
+}
+
+func TestTracer(t *testing.T) {
+	st := memory.NewStore()
+	mod.SetStore(st)
+	dagIns := &entity.DagInstance{DagID: "etl"}
+	assert.NoError(t, st.CreateDagIns(dagIns))
+
+	exporter := &fakeExporter{spans: map[string]*SpanData{}}
+	tracer := NewTracer(&Option{Exporters: []Exporter{exporter}})
+	tracer.wg.Add(1)
+	go tracer.goExport()
+
+	ctx := context.Background()
+	tracer.Handle(ctx, &event.DagInstancePatched{Payload: &entity.DagInstance{BaseInfo: entity.BaseInfo{ID: dagIns.ID}, Status: entity.DagInstanceStatusRunning}})
+	taskIns := &entity.TaskInstance{
+		BaseInfo:           entity.BaseInfo{ID: "task-ins"},
+		TaskID:             "extract",
+		DagInsID:           dagIns.ID,
+		ActionName:         "query",
+		Status:             entity.TaskInstanceStatusInit,
+		Context:            run.NewDefExecuteContext(ctx, nil, nil, nil, nil),
+		RelatedDagInstance: dagIns,
+	}
+	end := tracer.StartTask(taskIns)
+	// the action adds its own span
+	_, span := Start(taskIns.Context.Context(), "select orders")
+	span.SetAttribute("rows", 10)
+	span.End()
+	taskIns.Status, taskIns.Reason = entity.TaskInstanceStatusFailed, "timeout"
+	end()
+	failed := &entity.DagInstance{BaseInfo: entity.BaseInfo{ID: dagIns.ID}, Status: entity.DagInstanceStatusFailed, Reason: "oops"}
+	tracer.Handle(ctx, &event.DagInstancePatched{Payload: failed})
+	// the terminal status is patched again
+	tracer.Handle(ctx, &event.DagInstancePatched{Payload: failed})
+	tracer.Close()
+
+	if !assert.Len(t, exporter.spans, 3) {
+		return
+	}
+	dagSpan, taskSpan, actSpan := exporter.spans["etl"], exporter.spans["extract"], exporter.spans["select orders"]
+	assert.Equal(t, dagInsTraceID(dagIns.ID), dagSpan.TraceID)
+	assert.Equal(t, dagSpan.TraceID, taskSpan.TraceID)
+	assert.Equal(t, dagSpan.TraceID, actSpan.TraceID)
+	assert.False(t, dagSpan.ParentSpanID.IsValid())
+	assert.Equal(t, dagSpan.SpanID, taskSpan.ParentSpanID)
+	assert.Equal(t, taskSpan.SpanID, actSpan.ParentSpanID)
+
+	assert.Equal(t, StatusError, dagSpan.StatusCode)
+	assert.Equal(t, "oops", dagSpan.StatusMessage)
+	assert.Equal(t, "etl", dagSpan.Attributes[AttrDagID])
+	assert.Equal(t, StatusError, taskSpan.StatusCode)
+	assert.Equal(t, "timeout", taskSpan.StatusMessage)
+	assert.Equal(t, map[string]interface{}{
+		AttrDagID:         "etl",
+		AttrDagInsID:      dagIns.ID,
+		AttrTaskID:        "extract",
+		AttrTaskInsID:     "task-ins",
+		AttrTaskInsStatus: "failed",
+		AttrAction:        "query",
+		AttrWorker:        "",
+		AttrAttempt:       1,
+	}, taskSpan.Attributes)
+	assert.Equal(t, 10, actSpan.Attributes["rows"])
+	assert.False(t, dagSpan.StartTime.After(taskSpan.StartTime))
+}
+
+func TestStart(t *testing.T) {
+	ctx, span := Start(context.Background(), "no parent")
+	assert.Nil(t, span)
+	assert.Empty(t, TraceParent(ctx))
+	// nil span is a no-op
+	span.SetAttribute("key", "value")
+	span.RecordError(assert.AnError)
+	span.End()
+}
+
+func TestParseTraceParent(t *testing.T) {
+	tests := []struct {
+		caseDesc    string
+		giveHeader  string
+		wantTraceID string
+		wantSpanID  string
+		wantErr     bool
+	}{
+		{
+			caseDesc:    "normal",
+			giveHeader:  "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			wantTraceID: "4bf92f3577b34da6a3ce929d0e0e4736",
+			wantSpanID:  "00f067aa0ba902b7",
+		},
+		{
+			caseDesc:   "invalid format",
+			giveHeader: "00-4bf92f3577b34da6a3ce929d0e0e4736",
+			wantErr:    true,
+		},
+		{
+			caseDesc:   "invalid hex",
+			giveHeader: "00-4bf92f3577b34da6a3ce929d0e0e473z-00f067aa0ba902b7-01",
+			wantErr:    true,
+		},
+		{
+			caseDesc:   "zero id",
+			giveHeader: "00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+			wantErr:    true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			traceID, spanID, err := ParseTraceParent(tc.giveHeader)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantTraceID, traceID.String())
+			assert.Equal(t, tc.wantSpanID, spanID.String())
+			assert.Equal(t, tc.giveHeader, TraceParent(ContextWithSpan(context.Background(),
+				newSpan(nil, traceID, spanID, SpanID{}, "span", time.Now()))))
+		})
+	}
+}
+
+func TestOTLPExporter_Export(t *testing.T) {
+	var (
+		gotBody   map[string]interface{}
+		gotHeader http.Header
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeader = r.Header
+		bs, _ := ioutil.ReadAll(r.Body)
+		assert.NoError(t, json.Unmarshal(bs, &gotBody))
+	}))
+	defer ts.Close()
+
+	start := time.Unix(1700000000, 0)
+	span := &SpanData{
+		TraceID:       dagInsTraceID("dag-ins"),
+		SpanID:        derivedSpanID("task"),
+		ParentSpanID:  derivedSpanID("dag"),
+		Name:          "extract",
+		StartTime:     start,
+		EndTime:       start.Add(time.Second),
+		Attributes:    map[string]interface{}{AttrTaskID: "extract", AttrAttempt: 2},
+		StatusCode:    StatusError,
+		StatusMessage: "timeout",
+	}
+	e := &OTLPExporter{Endpoint: ts.URL, Header: http.Header{"Authorization": []string{"Bearer token"}}}
+	assert.NoError(t, e.Export(context.Background(), []*SpanData{span}))
+	assert.Equal(t, "Bearer token", gotHeader.Get("Authorization"))
+	assert.Equal(t, "application/json", gotHeader.Get("Content-Type"))
+
+	bs, _ := json.Marshal(newOTLPRequest("", []*SpanData{span}))
+	var want map[string]interface{}
+	assert.NoError(t, json.Unmarshal(bs, &want))
+	assert.Equal(t, want, gotBody)
+	rs := gotBody["resourceSpans"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, []interface{}{map[string]interface{}{
+		"key": "service.name", "value": map[string]interface{}{"stringValue": DefaultServiceName},
+	}}, rs["resource"].(map[string]interface{})["attributes"])
+	got := rs["scopeSpans"].([]interface{})[0].(map[string]interface{})["spans"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, span.TraceID.String(), got["traceId"])
+	assert.Equal(t, span.ParentSpanID.String(), got["parentSpanId"])
+	assert.Equal(t, "1700000001000000000", got["endTimeUnixNano"])
+	assert.Equal(t, map[string]interface{}{"code": float64(2), "message": "timeout"}, got["status"])
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"key": AttrAttempt, "value": map[string]interface{}{"intValue": "2"}},
+		map[string]interface{}{"key": AttrTaskID, "value": map[string]interface{}{"stringValue": "extract"}},
+	}, got["attributes"])
+
+	ts.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	})
+	assert.Error(t, e.Export(context.Background(), []*SpanData{span}))
+}
+
+func TestWriterExporter_Export(t *testing.T) {
+	buf := &bytes.Buffer{}
+	e := &WriterExporter{Writer: buf, ServiceName: "etl"}
+	spans := []*SpanData{{Name: "a"}, {Name: "b"}}
+	assert.NoError(t, e.Export(context.Background(), spans))
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	assert.Len(t, lines, 2)
+	assert.Contains(t, string(lines[0]), `"stringValue":"etl"`)
+}
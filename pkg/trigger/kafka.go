@@ -0,0 +1,74 @@
+package trigger
+
+import (
+	"context"
+	"fmt"
+)
+
+var _ EventSource = (*KafkaSource)(nil)
+
+// KafkaMessage is the message fetched from a kafka topic
+type KafkaMessage struct {
+	Topic     string
+	Partition int
+	Offset    int64
+	Key       []byte
+	Value     []byte
+}
+
+// KafkaReader is a consumer of kafka consumer group. fastflow does not depend on any kafka client,
+// so it is an adapter of the client used by application, such as the Reader of kafka-go:
+//
+//	func (r *reader) FetchMessage(ctx context.Context) (*trigger.KafkaMessage, error) {
+//		m, err := r.Reader.FetchMessage(ctx)
+//		if err != nil {
+//			return nil, err
+//		}
+//		return &trigger.KafkaMessage{Topic: m.Topic, Partition: m.Partition, Offset: m.Offset, Key: m.Key, Value: m.Value}, nil
+//	}
+type KafkaReader interface {
+	// FetchMessage block until a message arrives, it must not commit the message
+	FetchMessage(ctx context.Context) (*KafkaMessage, error)
+	// CommitMessage commit the offset of message
+	CommitMessage(ctx context.Context, msg *KafkaMessage) error
+	Close() error
+}
+
+// KafkaSource receive the messages of kafka topic as events, the value of message is the payload,
+// and the offset is committed after the dags of message are run.
+// The id of event is made of topic, partition and offset, so the redelivered messages do not run dags again.
+type KafkaSource struct {
+	reader KafkaReader
+}
+
+// NewKafkaSource
+func NewKafkaSource(reader KafkaReader) *KafkaSource {
+	return &KafkaSource{reader: reader}
+}
+
+// Receive
+func (s *KafkaSource) Receive(ctx context.Context) (*Event, error) {
+	msg, err := s.reader.FetchMessage(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &Event{
+		ID:      fmt.Sprintf("%s-%d-%d", msg.Topic, msg.Partition, msg.Offset),
+		Payload: msg.Value,
+		Raw:     msg,
+	}, nil
+}
+
+// Ack commit the offset of message
+func (s *KafkaSource) Ack(ctx context.Context, event *Event) error {
+	msg, ok := event.Raw.(*KafkaMessage)
+	if !ok {
+		return fmt.Errorf("event[%s] is not a kafka message", event.ID)
+	}
+	return s.reader.CommitMessage(ctx, msg)
+}
+
+// Close
+func (s *KafkaSource) Close() error {
+	return s.reader.Close()
+}
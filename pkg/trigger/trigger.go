@@ -0,0 +1,245 @@
+package trigger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/log"
+	"github.com/etherealiy/fastflow/pkg/mod"
+	"github.com/etherealiy/fastflow/pkg/webhook"
+)
+
+// Event is a message received from EventSource
+type Event struct {
+	// ID identify the event in source, such as the partition and offset of kafka message.
+	// It is a part of the idempotency key of dag runs, so a redelivered event does not run dags again,
+	// empty means the event cannot be deduped
+	ID string
+	// Payload is the json body of event
+	Payload []byte
+	// Raw is the original message, it is used by source to ack the event
+	Raw interface{}
+}
+
+// EventSource is an external system which delivers events, such as a message queue.
+// The events are delivered at least once, an event is acked after the dags of it are run,
+// otherwise it should be redelivered by source.
+type EventSource interface {
+	// Receive block until an event arrives or ctx is done
+	Receive(ctx context.Context) (*Event, error)
+	// Ack mark the event as handled
+	Ack(ctx context.Context, event *Event) error
+	Close() error
+}
+
+// Rule map the events to dag runs
+type Rule struct {
+	DagID string `yaml:"dagId" json:"dagId"`
+	// Match require the fields of payload to match the glob patterns, key is the field path such as
+	// "type" or "order.items.0.sku", see webhook.Lookup
+	Match map[string]string `yaml:"match" json:"match"`
+	// Vars map the fields of payload to run vars, key is var name and value is field path,
+	// the var whose field does not exist uses the default value of dag
+	Vars   map[string]string `yaml:"vars" json:"vars"`
+	Labels map[string]string `yaml:"labels" json:"labels"`
+}
+
+func (r *Rule) accept(payload interface{}) bool {
+	for field, pattern := range r.Match {
+		v, ok := webhook.Lookup(payload, field)
+		if !ok {
+			return false
+		}
+		if matched, _ := path.Match(pattern, stringify(v)); !matched {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *Rule) vars(payload interface{}) map[string]string {
+	vars := map[string]string{}
+	for name, field := range r.Vars {
+		if v, ok := webhook.Lookup(payload, field); ok {
+			vars[name] = stringify(v)
+		}
+	}
+	return vars
+}
+
+// Option
+type Option struct {
+	// SourceID is the identity of source, it is recorded as the source of trigger meta
+	SourceID string
+	Source   EventSource
+	Rules    []Rule
+	// RetryInterval is the interval of retrying after receiving events or running dags failed, default 1s
+	RetryInterval time.Duration
+}
+
+// Trigger run dags by the events of source, it should be started after fastflow init.
+// The events are handled one by one, a dag run failed by transient errors is retried until it succeeds,
+// so the order of events is kept. The events which are not valid json are dropped.
+// Each worker can run a trigger of the same source when the source balances events between consumers.
+//
+//	trig, err := trigger.NewTrigger(&trigger.Option{SourceID: "orders", Source: src, Rules: rules})
+//	trig.Init()
+//	defer trig.Close()
+type Trigger struct {
+	opt    *Option
+	client *mod.Client
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewTrigger
+func NewTrigger(opt *Option) (*Trigger, error) {
+	if opt.SourceID == "" {
+		return nil, fmt.Errorf("source id cannot be empty")
+	}
+	if opt.Source == nil {
+		return nil, fmt.Errorf("source of trigger[%s] cannot be nil", opt.SourceID)
+	}
+	for _, rule := range opt.Rules {
+		if rule.DagID == "" {
+			return nil, fmt.Errorf("dag id of rule cannot be empty")
+		}
+	}
+	if opt.RetryInterval <= 0 {
+		opt.RetryInterval = time.Second
+	}
+	t := &Trigger{
+		opt:    opt,
+		client: mod.NewClient(nil),
+	}
+	t.ctx, t.cancel = context.WithCancel(context.Background())
+	return t, nil
+}
+
+// Init start receiving events
+func (t *Trigger) Init() {
+	t.wg.Add(1)
+	go t.goReceive()
+}
+
+// Close stop receiving events and close the source, the event being handled is not acked
+func (t *Trigger) Close() {
+	t.cancel()
+	t.wg.Wait()
+	if err := t.opt.Source.Close(); err != nil {
+		log.Errorf("close event source[%s] failed: %s", t.opt.SourceID, err)
+	}
+}
+
+func (t *Trigger) goReceive() {
+	defer t.wg.Done()
+	for {
+		ev, err := t.opt.Source.Receive(t.ctx)
+		if t.ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Errorf("receive event of source[%s] failed: %s", t.opt.SourceID, err)
+			if !t.wait() {
+				return
+			}
+			continue
+		}
+		if !t.handle(ev) {
+			return
+		}
+		if err := t.opt.Source.Ack(t.ctx, ev); err != nil {
+			log.Errorf("ack event[%s] of source[%s] failed: %s", ev.ID, t.opt.SourceID, err)
+		}
+	}
+}
+
+// handle run the dags of matched rules, it returns false when the trigger is closed before all of them run
+func (t *Trigger) handle(ev *Event) bool {
+	var payload interface{}
+	if err := json.Unmarshal(ev.Payload, &payload); err != nil {
+		log.Warnf("event[%s] of source[%s] is not a valid json, drop it: %s", ev.ID, t.opt.SourceID, err)
+		return true
+	}
+
+	var pending []int
+	for i := range t.opt.Rules {
+		if t.opt.Rules[i].accept(payload) {
+			pending = append(pending, i)
+		}
+	}
+	for len(pending) > 0 {
+		var failed []int
+		for _, i := range pending {
+			err := t.run(ev, i, payload)
+			if err == nil {
+				continue
+			}
+			if !mod.IsTransientError(err) {
+				log.Errorf("run dag[%s] by event[%s] of source[%s] failed, drop it: %s",
+					t.opt.Rules[i].DagID, ev.ID, t.opt.SourceID, err)
+				continue
+			}
+			log.Warnf("run dag[%s] by event[%s] of source[%s] failed, retry it: %s",
+				t.opt.Rules[i].DagID, ev.ID, t.opt.SourceID, err)
+			failed = append(failed, i)
+		}
+		pending = failed
+		if len(pending) > 0 && !t.wait() {
+			return false
+		}
+	}
+	return true
+}
+
+func (t *Trigger) run(ev *Event, ruleIdx int, payload interface{}) error {
+	rule := t.opt.Rules[ruleIdx]
+	req := &mod.RunDagRequest{
+		DagID: rule.DagID,
+		Vars:  rule.vars(payload),
+		Options: []mod.RunDagOptSetter{
+			mod.RunDagTrigger(entity.TriggerEvent, &entity.TriggerMeta{Source: t.opt.SourceID}),
+			mod.RunDagLabels(rule.Labels),
+		},
+	}
+	if ev.ID != "" {
+		// the rules may run the same dag, so the index of rule is a part of key
+		req.IdempotencyKey = fmt.Sprintf("%s/%s/%d", t.opt.SourceID, ev.ID, ruleIdx)
+	}
+	_, err := t.client.RunDag(t.ctx, req)
+	return err
+}
+
+// wait return false when the trigger is closed
+func (t *Trigger) wait() bool {
+	timer := time.NewTimer(t.opt.RetryInterval)
+	defer timer.Stop()
+	select {
+	case <-t.ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func stringify(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	default:
+		bs, err := json.Marshal(val)
+		if err != nil {
+			return fmt.Sprint(val)
+		}
+		return string(bs)
+	}
+}
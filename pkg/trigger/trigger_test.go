@@ -0,0 +1,141 @@
+package trigger
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/mod"
+	"github.com/etherealiy/fastflow/store/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+// chanReader deliver the messages of channel and record the committed offsets
+type chanReader struct {
+	msgs      chan *KafkaMessage
+	mu        sync.Mutex
+	committed []int64
+}
+
+func (r *chanReader) FetchMessage(ctx context.Context) (*KafkaMessage, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case msg := <-r.msgs:
+		return msg, nil
+	}
+}
+
+func (r *chanReader) CommitMessage(ctx context.Context, msg *KafkaMessage) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.committed = append(r.committed, msg.Offset)
+	return nil
+}
+
+func (r *chanReader) Close() error {
+	return nil
+}
+
+func (r *chanReader) getCommitted() []int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]int64{}, r.committed...)
+}
+
+func TestTrigger(t *testing.T) {
+	st := memory.NewStore()
+	mod.SetStore(st)
+	assert.NoError(t, st.CreateDag(&entity.Dag{
+		BaseInfo: entity.BaseInfo{ID: "ship"},
+		Status:   entity.DagStatusNormal,
+		Vars:     entity.DagVars{"order": {DefaultValue: "def"}, "region": {DefaultValue: "def"}},
+		Tasks:    []entity.Task{{ID: "task1", ActionName: "act"}},
+	}))
+
+	reader := &chanReader{msgs: make(chan *KafkaMessage, 10)}
+	trig, err := NewTrigger(&Option{
+		SourceID: "orders",
+		Source:   NewKafkaSource(reader),
+		Rules: []Rule{
+			{
+				DagID:  "ship",
+				Match:  map[string]string{"type": "order.*"},
+				Vars:   map[string]string{"order": "id", "region": "address.region"},
+				Labels: map[string]string{"env": "prod"},
+			},
+			{DagID: "not-exist", Match: map[string]string{"type": "order.paid"}},
+		},
+		RetryInterval: 10 * time.Millisecond,
+	})
+	assert.NoError(t, err)
+	trig.Init()
+
+	msgs := []string{
+		`{"type":"order.paid","id":"o1","address":{"region":"eu"}}`,
+		`{"type":"refund","id":"o2"}`,
+		`not json`,
+		`{"type":"order.created","id":"o3"}`,
+		// redelivered
+		`{"type":"order.paid","id":"o1","address":{"region":"eu"}}`,
+	}
+	for i, m := range msgs {
+		offset := int64(i)
+		if i == len(msgs)-1 {
+			offset = 0
+		}
+		reader.msgs <- &KafkaMessage{Topic: "orders", Partition: 1, Offset: offset, Value: []byte(m)}
+	}
+	assert.Eventually(t, func() bool {
+		return len(reader.getCommitted()) == len(msgs)
+	}, time.Second, 10*time.Millisecond)
+	trig.Close()
+	assert.Equal(t, []int64{0, 1, 2, 3, 0}, reader.getCommitted())
+
+	dagIns, err := st.ListDagInstance(&mod.ListDagInstanceInput{DagID: "ship"})
+	assert.NoError(t, err)
+	// the redelivered message does not run dag again
+	assert.Len(t, dagIns, 2)
+	vars := map[string]string{}
+	for _, ins := range dagIns {
+		assert.Equal(t, entity.TriggerEvent, ins.Trigger)
+		assert.Equal(t, &entity.TriggerMeta{Source: "orders"}, ins.TriggerMeta)
+		assert.Equal(t, "prod", ins.Labels["env"])
+		vars[ins.Vars["order"].Value] = ins.Vars["region"].Value
+	}
+	assert.Equal(t, map[string]string{"o1": "eu", "o3": "def"}, vars)
+}
+
+func TestNewTrigger(t *testing.T) {
+	tests := []struct {
+		caseDesc string
+		giveOpt  *Option
+		wantErr  error
+	}{
+		{
+			caseDesc: "empty source id",
+			giveOpt:  &Option{Source: NewKafkaSource(&chanReader{})},
+			wantErr:  fmt.Errorf("source id cannot be empty"),
+		},
+		{
+			caseDesc: "nil source",
+			giveOpt:  &Option{SourceID: "src"},
+			wantErr:  fmt.Errorf("source of trigger[src] cannot be nil"),
+		},
+		{
+			caseDesc: "empty dag id",
+			giveOpt:  &Option{SourceID: "src", Source: NewKafkaSource(&chanReader{}), Rules: []Rule{{}}},
+			wantErr:  fmt.Errorf("dag id of rule cannot be empty"),
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			_, err := NewTrigger(tc.giveOpt)
+			assert.Equal(t, tc.wantErr, err)
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package cron
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchedule_Next(t *testing.T) {
+	from := time.Date(2022, 1, 31, 10, 30, 15, 0, time.UTC)
+	tests := []struct {
+		caseDesc string
+		giveExpr string
+		giveFrom time.Time
+		wantNext time.Time
+	}{
+		{
+			caseDesc: "every minute",
+			giveExpr: "* * * * *",
+			giveFrom: from,
+			wantNext: time.Date(2022, 1, 31, 10, 31, 0, 0, time.UTC),
+		},
+		{
+			caseDesc: "step",
+			giveExpr: "*/20 * * * *",
+			giveFrom: from,
+			wantNext: time.Date(2022, 1, 31, 10, 40, 0, 0, time.UTC),
+		},
+		{
+			caseDesc: "descriptor",
+			giveExpr: "@daily",
+			giveFrom: from,
+			wantNext: time.Date(2022, 2, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			caseDesc: "range and names",
+			giveExpr: "0 9-17/4 * feb MON-fri",
+			giveFrom: from,
+			wantNext: time.Date(2022, 2, 1, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			caseDesc: "day of month or day of week",
+			giveExpr: "0 0 15 * 7",
+			giveFrom: from,
+			wantNext: time.Date(2022, 2, 6, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			caseDesc: "exact time is excluded",
+			giveExpr: "30 10 * * *",
+			giveFrom: time.Date(2022, 1, 31, 10, 30, 0, 0, time.UTC),
+			wantNext: time.Date(2022, 2, 1, 10, 30, 0, 0, time.UTC),
+		},
+		{
+			caseDesc: "never",
+			giveExpr: "0 0 30 2 *",
+			giveFrom: from,
+			wantNext: time.Time{},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			s, err := Parse(tc.giveExpr)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantNext, s.Next(tc.giveFrom))
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		caseDesc string
+		giveExpr string
+		wantErr  string
+	}{
+		{
+			caseDesc: "too few fields",
+			giveExpr: "* * * *",
+			wantErr:  `cron expression "* * * *" must have 5 fields`,
+		},
+		{
+			caseDesc: "out of range",
+			giveExpr: "60 * * * *",
+			wantErr:  `parse minute of "60 * * * *" failed: "60" is out of range [0, 59]`,
+		},
+		{
+			caseDesc: "invalid step",
+			giveExpr: "* */0 * * *",
+			wantErr:  `parse hour of "* */0 * * *" failed: step of "*/0" is invalid`,
+		},
+		{
+			caseDesc: "invalid value",
+			giveExpr: "* * * foo *",
+			wantErr:  `parse month of "* * * foo *" failed: "foo" is not a valid value`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			_, err := Parse(tc.giveExpr)
+			assert.EqualError(t, err, tc.wantErr)
+		})
+	}
+}
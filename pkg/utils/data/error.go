@@ -9,11 +9,46 @@ import (
 var (
 	ErrDataNotFound   = errors.New("data not found")
 	ErrDataConflicted = errors.New("data conflicted")
+	ErrDataInvalid    = errors.New("data invalid")
 	ErrNoAliveNodes   = errors.New("no alive nodes, stop dispatch")
+	// ErrDataTransient means the operation failed temporarily, such as network error or timeout, it can be retried
+	ErrDataTransient = errors.New("data operation failed transiently")
+	// ErrStandby means the cluster is standby and rejects writing until it is promoted
+	ErrStandby = errors.New("cluster is standby")
+	// ErrIdempotencyKeyConflicted means a dag instance of the same dag has the idempotency key,
+	// errors.Is(err, ErrDataConflicted) is also true
+	ErrIdempotencyKeyConflicted = fmt.Errorf("idempotency key conflicted: %w", ErrDataConflicted)
 
 	ErrMutexAlreadyUnlock = errors.New("mutex is already unlocked")
 )
 
+// Transient mark the error as transient, so errors.Is(err, ErrDataTransient) is true
+func Transient(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &transientError{err: err}
+}
+
+type transientError struct {
+	err error
+}
+
+// Error
+func (e *transientError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap
+func (e *transientError) Unwrap() error {
+	return e.err
+}
+
+// Is
+func (e *transientError) Is(target error) bool {
+	return target == ErrDataTransient
+}
+
 // Errors
 type Errors struct {
 	errs []error
@@ -28,7 +28,7 @@ func (r FileDagReader) ReadPathsFromDir(dir string) (dagFiles []string, err erro
 		}
 
 		ext := filepath.Ext(path)
-		if ext != ".yaml" && ext != ".yml" {
+		if ext != ".yaml" && ext != ".yml" && ext != ".json" {
 			return nil
 		}
 
@@ -12,6 +12,8 @@ func TestFileDagReader_ReadPathsFromDir(t *testing.T) {
 	paths, err := file.ReadPathsFromDir("./tests")
 	assert.NoError(t, err)
 	wantPaths := []string{
+		filepath.Join("tests", "json2.json"),
+		filepath.Join("tests", "sub-tests", "json.json"),
 		filepath.Join("tests", "sub-tests", "subtest.yaml"),
 		filepath.Join("tests", "testdag.yaml"),
 		filepath.Join("tests", "testdag2.yml"),
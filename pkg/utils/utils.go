@@ -15,5 +15,6 @@ type KeyValueIterator func(KeyValueIterateFunc)
 type KeyValueIterateFunc func(key, val string) (stop bool)
 
 const (
-	LogKeyDagInsID = "dagInsId"
+	LogKeyDagInsID  = "dagInsId"
+	LogKeyTaskInsID = "taskInsId"
 )
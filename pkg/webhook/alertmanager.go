@@ -0,0 +1,226 @@
+package webhook
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/log"
+	"github.com/etherealiy/fastflow/pkg/mod"
+	"github.com/etherealiy/fastflow/pkg/utils"
+)
+
+const (
+	// LabelAlertFingerprint is the label of dag instance triggered by alert, it is used to avoid
+	// running the remediation repeatedly when alertmanager resends the alert
+	LabelAlertFingerprint = "alert-fingerprint"
+
+	defaultAlertmanagerSource = "alertmanager"
+)
+
+// AlertmanagerMessage is the payload of alertmanager webhook receiver
+type AlertmanagerMessage struct {
+	Version           string            `json:"version"`
+	GroupKey          string            `json:"groupKey"`
+	Status            string            `json:"status"`
+	Receiver          string            `json:"receiver"`
+	GroupLabels       map[string]string `json:"groupLabels"`
+	CommonLabels      map[string]string `json:"commonLabels"`
+	CommonAnnotations map[string]string `json:"commonAnnotations"`
+	ExternalURL       string            `json:"externalURL"`
+	Alerts            []Alert           `json:"alerts"`
+}
+
+// Alert
+type Alert struct {
+	Status       string            `json:"status"`
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL"`
+	Fingerprint  string            `json:"fingerprint"`
+}
+
+// Vars return the vars of remediation dag, they are the labels of alert
+// and "annotations.{name}", "alertStatus", "fingerprint", "startsAt", "generatorURL"
+func (a *Alert) Vars() map[string]string {
+	vars := map[string]string{}
+	for k, v := range a.Labels {
+		vars[k] = v
+	}
+	for k, v := range a.Annotations {
+		vars["annotations."+k] = v
+	}
+	vars["alertStatus"] = a.Status
+	vars["fingerprint"] = a.Fingerprint
+	vars["generatorURL"] = a.GeneratorURL
+	if !a.StartsAt.IsZero() {
+		vars["startsAt"] = a.StartsAt.Format(time.RFC3339)
+	}
+	return vars
+}
+
+// AlertRoute map alerts to a remediation dag
+type AlertRoute struct {
+	DagID string `yaml:"dagId" json:"dagId"`
+	// Match require the labels of alert to match the glob patterns, such as {"alertname": "DiskFull*"}
+	Match map[string]string `yaml:"match" json:"match"`
+	// Status is the status of alert which the route accepts, default is "firing"
+	Status string `yaml:"status" json:"status"`
+	// Continue matching the following routes after matched, by default only the first matched route is used
+	Continue bool              `yaml:"continue" json:"continue"`
+	Labels   map[string]string `yaml:"labels" json:"labels"`
+}
+
+func (r *AlertRoute) accept(alert *Alert) bool {
+	status := r.Status
+	if status == "" {
+		status = "firing"
+	}
+	if alert.Status != status {
+		return false
+	}
+	for label, pattern := range r.Match {
+		v, ok := alert.Labels[label]
+		if !ok {
+			return false
+		}
+		if matched, _ := path.Match(pattern, v); !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// AlertmanagerOption
+type AlertmanagerOption struct {
+	// Source is the TriggerMeta.Source of dag instances, default is "alertmanager"
+	Source string       `yaml:"source" json:"source"`
+	Routes []AlertRoute `yaml:"routes" json:"routes"`
+	// BearerToken is compared with the "Authorization" header which is set by "http_config" of alertmanager,
+	// empty means no authorization
+	BearerToken string `yaml:"bearerToken" json:"bearerToken"`
+	// MaxBodyBytes default is 1MB
+	MaxBodyBytes int64 `yaml:"maxBodyBytes" json:"maxBodyBytes"`
+}
+
+// AlertmanagerHandler trigger remediation dags by alerts, each alert runs the matched dag once,
+// the alert is skipped when its remediation is still unfinished
+//
+//	h, err := webhook.NewAlertmanagerHandler(opt)
+//	http.Handle("/webhooks/alertmanager", h)
+type AlertmanagerHandler struct {
+	opt *AlertmanagerOption
+}
+
+// NewAlertmanagerHandler
+func NewAlertmanagerHandler(opt *AlertmanagerOption) (*AlertmanagerHandler, error) {
+	if len(opt.Routes) == 0 {
+		return nil, fmt.Errorf("routes cannot be empty")
+	}
+	for i, r := range opt.Routes {
+		if r.DagID == "" {
+			return nil, fmt.Errorf("dag id of route[%d] cannot be empty", i)
+		}
+	}
+	if opt.Source == "" {
+		opt.Source = defaultAlertmanagerSource
+	}
+	if opt.MaxBodyBytes <= 0 {
+		opt.MaxBodyBytes = defaultMaxBodyBytes
+	}
+	return &AlertmanagerHandler{opt: opt}, nil
+}
+
+// ServeHTTP
+func (h *AlertmanagerHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse("method not allowed"))
+		return
+	}
+	if h.opt.BearerToken != "" &&
+		subtle.ConstantTimeCompare([]byte(req.Header.Get("Authorization")), []byte("Bearer "+h.opt.BearerToken)) != 1 {
+		writeJSON(w, http.StatusUnauthorized, errorResponse("authorization is invalid"))
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, req.Body, h.opt.MaxBodyBytes))
+	if err != nil {
+		writeJSON(w, http.StatusRequestEntityTooLarge, errorResponse(fmt.Sprintf("read body failed: %s", err)))
+		return
+	}
+	msg := &AlertmanagerMessage{}
+	if err := json.Unmarshal(body, msg); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse(fmt.Sprintf("payload is not a valid alertmanager message: %s", err)))
+		return
+	}
+
+	resp := &Response{Event: msg.Status, DagInsIDs: []string{}}
+	for i := range msg.Alerts {
+		alert := &msg.Alerts[i]
+		for _, route := range h.opt.Routes {
+			if !route.accept(alert) {
+				continue
+			}
+			dagInsID, err := h.remediate(route, alert)
+			if err != nil {
+				log.Errorf("run remediation dag[%s] of alert[%s] failed: %s", route.DagID, alert.Fingerprint, err)
+				resp.Errors = append(resp.Errors, fmt.Sprintf("run dag[%s] for alert[%s] failed: %s", route.DagID, alert.Fingerprint, err))
+			} else if dagInsID != "" {
+				resp.DagInsIDs = append(resp.DagInsIDs, dagInsID)
+			}
+			if !route.Continue {
+				break
+			}
+		}
+	}
+
+	code := http.StatusAccepted
+	if len(resp.Errors) > 0 {
+		// alertmanager retries the notification on 5xx
+		code = http.StatusInternalServerError
+	}
+	writeJSON(w, code, resp)
+}
+
+// remediate return empty id when the alert is being remediated
+func (h *AlertmanagerHandler) remediate(route AlertRoute, alert *Alert) (string, error) {
+	labels := map[string]string{}
+	for k, v := range route.Labels {
+		labels[k] = v
+	}
+	if alert.Fingerprint != "" {
+		labels[LabelAlertFingerprint] = alert.Fingerprint
+		unfinished, err := mod.GetStore().ListDagInstance(&mod.ListDagInstanceInput{
+			DagID: route.DagID,
+			Status: []entity.DagInstanceStatus{
+				entity.DagInstanceStatusInit,
+				entity.DagInstanceStatusScheduled,
+				entity.DagInstanceStatusRunning,
+				entity.DagInstanceStatusBlocked,
+			},
+			Labels: map[string]string{LabelAlertFingerprint: alert.Fingerprint},
+			Limit:  1,
+		})
+		if err != nil {
+			return "", fmt.Errorf("list unfinished dag instances failed: %w", err)
+		}
+		if len(unfinished) > 0 {
+			log.With(utils.LogKeyDagInsID, unfinished[0].ID).Infof("alert[%s] is being remediated, skip it", alert.Fingerprint)
+			return "", nil
+		}
+	}
+
+	dagIns, err := mod.GetCommander().RunDag(route.DagID, alert.Vars(),
+		mod.RunDagTrigger(entity.TriggerWebhook, &entity.TriggerMeta{Source: h.opt.Source}),
+		mod.RunDagLabels(labels))
+	if err != nil {
+		return "", err
+	}
+	return dagIns.ID, nil
+}
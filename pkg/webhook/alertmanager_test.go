@@ -0,0 +1,97 @@
+package webhook
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/mod"
+	"github.com/etherealiy/fastflow/store/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAlertmanagerHandler_ServeHTTP(t *testing.T) {
+	st := memory.NewStore()
+	mod.SetStore(st)
+	mod.SetCommander(&mod.DefCommander{})
+	for _, id := range []string{"clean-disk", "restart-pod"} {
+		assert.NoError(t, st.CreateDag(&entity.Dag{
+			BaseInfo: entity.BaseInfo{ID: id},
+			Status:   entity.DagStatusNormal,
+			Vars:     entity.DagVars{"instance": {}, "annotations.summary": {}, "alertStatus": {}},
+			Tasks:    []entity.Task{{ID: "task1", ActionName: "act"}},
+		}))
+	}
+
+	h, err := NewAlertmanagerHandler(&AlertmanagerOption{
+		BearerToken: "token",
+		Routes: []AlertRoute{
+			{DagID: "clean-disk", Match: map[string]string{"alertname": "DiskFull*"}, Labels: map[string]string{"team": "sre"}},
+			{DagID: "restart-pod", Match: map[string]string{"alertname": "PodCrash"}},
+		},
+	})
+	assert.NoError(t, err)
+
+	newReq := func(token, body string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/webhooks/alertmanager", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		return req
+	}
+	diskFull := `{"version":"4","status":"firing","alerts":[
+		{"status":"firing","labels":{"alertname":"DiskFullSoon","instance":"node-1"},"annotations":{"summary":"disk is full"},"fingerprint":"fp1"},
+		{"status":"firing","labels":{"alertname":"HighCPU"},"fingerprint":"fp2"},
+		{"status":"resolved","labels":{"alertname":"PodCrash"},"fingerprint":"fp3"}
+	]}`
+
+	tests := []struct {
+		caseDesc string
+		giveReq  *http.Request
+		wantCode int
+		wantBody string
+	}{
+		{
+			caseDesc: "trigger remediation",
+			giveReq:  newReq("token", diskFull),
+			wantCode: http.StatusAccepted,
+			wantBody: `"event":"firing","dagInsIds":["1"]`,
+		},
+		{
+			caseDesc: "skip unfinished remediation",
+			giveReq:  newReq("token", diskFull),
+			wantCode: http.StatusAccepted,
+			wantBody: `"dagInsIds":[]`,
+		},
+		{
+			caseDesc: "invalid token",
+			giveReq:  newReq("wrong", diskFull),
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			caseDesc: "invalid payload",
+			giveReq:  newReq("token", `[]`),
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, tc.giveReq)
+			assert.Equal(t, tc.wantCode, w.Code)
+			assert.Contains(t, w.Body.String(), tc.wantBody)
+		})
+	}
+
+	dagIns, err := st.GetDagInstance("1")
+	assert.NoError(t, err)
+	assert.Equal(t, "clean-disk", dagIns.DagID)
+	assert.Equal(t, entity.DagInstanceVars{
+		"instance":            {Value: "node-1"},
+		"annotations.summary": {Value: "disk is full"},
+		"alertStatus":         {Value: "firing"},
+	}, dagIns.Vars)
+	assert.Equal(t, map[string]string{"team": "sre", LabelAlertFingerprint: "fp1"}, dagIns.Labels)
+	assert.Equal(t, &entity.TriggerMeta{Source: "alertmanager"}, dagIns.TriggerMeta)
+}
@@ -0,0 +1,295 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/log"
+	"github.com/etherealiy/fastflow/pkg/mod"
+)
+
+const (
+	// PathPrefix is the default prefix of receiver, the full path is "/webhooks/{sourceId}"
+	PathPrefix = "/webhooks/"
+
+	defaultMaxBodyBytes = 1 << 20
+)
+
+// Source is an external system which sends webhook
+type Source struct {
+	ID       string   `yaml:"id" json:"id"`
+	Provider Provider `yaml:"provider" json:"provider"`
+	// Secret is used to verify the signature, it is the token of gitlab
+	Secret string `yaml:"secret" json:"secret"`
+	// SecretRef is resolved by mod.GetSecretResolver() when receiving request, it takes precedence over Secret
+	SecretRef string `yaml:"secretRef" json:"secretRef"`
+	// SignatureHeader is only used by generic provider, default is "X-Signature"
+	SignatureHeader string `yaml:"signatureHeader" json:"signatureHeader"`
+	// EventHeader is only used by generic provider, default is "X-Event-Type"
+	EventHeader string `yaml:"eventHeader" json:"eventHeader"`
+	// Tolerance is the max age of stripe signature, default is 5 minutes
+	Tolerance time.Duration `yaml:"tolerance" json:"tolerance"`
+}
+
+func (s *Source) secret() (string, error) {
+	if s.SecretRef == "" {
+		return s.Secret, nil
+	}
+	if mod.GetSecretResolver() == nil {
+		return "", fmt.Errorf("no secret resolver")
+	}
+	return mod.GetSecretResolver().Resolve(s.SecretRef)
+}
+
+// Rule map the events of source to dag runs
+type Rule struct {
+	Source string `yaml:"source" json:"source"`
+	DagID  string `yaml:"dagId" json:"dagId"`
+	// Events is the event types which the rule accepts, empty means all
+	Events []string `yaml:"events" json:"events"`
+	// Match require the fields of payload to match the glob patterns, key is the field path such as "ref",
+	// "repository.full_name" or "commits.0.id", value is the pattern such as "refs/heads/*"
+	Match map[string]string `yaml:"match" json:"match"`
+	// Vars map the fields of payload to run vars, key is var name and value is field path,
+	// the var whose field does not exist uses the default value of dag
+	Vars   map[string]string `yaml:"vars" json:"vars"`
+	Labels map[string]string `yaml:"labels" json:"labels"`
+}
+
+func (r *Rule) accept(event string, payload interface{}) bool {
+	if len(r.Events) > 0 {
+		found := false
+		for _, e := range r.Events {
+			if e == event {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	for field, pattern := range r.Match {
+		v, ok := Lookup(payload, field)
+		if !ok {
+			return false
+		}
+		if matched, _ := path.Match(pattern, stringify(v)); !matched {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *Rule) vars(payload interface{}) map[string]string {
+	vars := map[string]string{}
+	for name, field := range r.Vars {
+		if v, ok := Lookup(payload, field); ok {
+			vars[name] = stringify(v)
+		}
+	}
+	return vars
+}
+
+// Option
+type Option struct {
+	Sources []Source `yaml:"sources" json:"sources"`
+	Rules   []Rule   `yaml:"rules" json:"rules"`
+	// MaxBodyBytes default is 1MB
+	MaxBodyBytes int64 `yaml:"maxBodyBytes" json:"maxBodyBytes"`
+}
+
+// Receiver turn the webhooks of external systems into dag runs, it should be mounted after fastflow init
+//
+//	rcv, err := webhook.NewReceiver(opt)
+//	http.Handle(webhook.PathPrefix, rcv)
+type Receiver struct {
+	sources      map[string]*Source
+	rules        map[string][]Rule
+	maxBodyBytes int64
+}
+
+// NewReceiver
+func NewReceiver(opt *Option) (*Receiver, error) {
+	r := &Receiver{
+		sources:      map[string]*Source{},
+		rules:        map[string][]Rule{},
+		maxBodyBytes: opt.MaxBodyBytes,
+	}
+	if r.maxBodyBytes <= 0 {
+		r.maxBodyBytes = defaultMaxBodyBytes
+	}
+	for i := range opt.Sources {
+		src := opt.Sources[i]
+		if src.ID == "" {
+			return nil, fmt.Errorf("source id cannot be empty")
+		}
+		if _, ok := r.sources[src.ID]; ok {
+			return nil, fmt.Errorf("source[%s] is duplicated", src.ID)
+		}
+		if _, ok := verifiers[src.Provider]; !ok {
+			return nil, fmt.Errorf("provider %q of source[%s] is not supported", src.Provider, src.ID)
+		}
+		if src.Secret == "" && src.SecretRef == "" {
+			return nil, fmt.Errorf("secret of source[%s] cannot be empty", src.ID)
+		}
+		r.sources[src.ID] = &src
+	}
+	for _, rule := range opt.Rules {
+		if _, ok := r.sources[rule.Source]; !ok {
+			return nil, fmt.Errorf("source[%s] of rule does not exist", rule.Source)
+		}
+		if rule.DagID == "" {
+			return nil, fmt.Errorf("dag id of rule cannot be empty")
+		}
+		r.rules[rule.Source] = append(r.rules[rule.Source], rule)
+	}
+	return r, nil
+}
+
+// Response
+type Response struct {
+	Event     string   `json:"event"`
+	DagInsIDs []string `json:"dagInsIds"`
+	Errors    []string `json:"errors,omitempty"`
+}
+
+// ServeHTTP
+func (r *Receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse("method not allowed"))
+		return
+	}
+	segments := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	src, ok := r.sources[segments[len(segments)-1]]
+	if !ok {
+		writeJSON(w, http.StatusNotFound, errorResponse("source not found"))
+		return
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, req.Body, r.maxBodyBytes))
+	if err != nil {
+		writeJSON(w, http.StatusRequestEntityTooLarge, errorResponse(fmt.Sprintf("read body failed: %s", err)))
+		return
+	}
+	secret, err := src.secret()
+	if err != nil {
+		log.Errorf("resolve secret of webhook source[%s] failed: %s", src.ID, err)
+		writeJSON(w, http.StatusInternalServerError, errorResponse("resolve secret failed"))
+		return
+	}
+	if err := verifiers[src.Provider](src, secret, req.Header, body); err != nil {
+		log.Warnf("verify webhook of source[%s] failed: %s", src.ID, err)
+		writeJSON(w, http.StatusUnauthorized, errorResponse(err.Error()))
+		return
+	}
+
+	var payload interface{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse(fmt.Sprintf("payload is not a valid json: %s", err)))
+		return
+	}
+
+	resp := &Response{Event: eventOf(src, req.Header, payload), DagInsIDs: []string{}}
+	for _, rule := range r.rules[src.ID] {
+		if !rule.accept(resp.Event, payload) {
+			continue
+		}
+		dagIns, err := mod.GetCommander().RunDag(rule.DagID, rule.vars(payload),
+			mod.RunDagTrigger(entity.TriggerWebhook, &entity.TriggerMeta{Source: src.ID}),
+			mod.RunDagLabels(rule.Labels))
+		if err != nil {
+			log.Errorf("run dag[%s] by webhook of source[%s] failed: %s", rule.DagID, src.ID, err)
+			resp.Errors = append(resp.Errors, fmt.Sprintf("run dag[%s] failed: %s", rule.DagID, err))
+			continue
+		}
+		resp.DagInsIDs = append(resp.DagInsIDs, dagIns.ID)
+	}
+
+	code := http.StatusAccepted
+	if len(resp.Errors) > 0 {
+		// let the source redeliver it
+		code = http.StatusInternalServerError
+	}
+	writeJSON(w, code, resp)
+}
+
+func eventOf(src *Source, header http.Header, payload interface{}) string {
+	switch src.Provider {
+	case ProviderGitHub:
+		return header.Get("X-GitHub-Event")
+	case ProviderGitLab:
+		return header.Get("X-Gitlab-Event")
+	case ProviderStripe:
+		v, _ := Lookup(payload, "type")
+		return stringify(v)
+	default:
+		h := src.EventHeader
+		if h == "" {
+			h = "X-Event-Type"
+		}
+		return header.Get(h)
+	}
+}
+
+// Lookup get the field of json payload by path separated by ".", the element of array is accessed by index
+func Lookup(payload interface{}, fieldPath string) (interface{}, bool) {
+	cur := payload
+	for _, key := range strings.Split(fieldPath, ".") {
+		switch v := cur.(type) {
+		case map[string]interface{}:
+			next, ok := v[key]
+			if !ok {
+				return nil, false
+			}
+			cur = next
+		case []interface{}:
+			idx, err := strconv.Atoi(key)
+			if err != nil || idx < 0 || idx >= len(v) {
+				return nil, false
+			}
+			cur = v[idx]
+		default:
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+func stringify(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	default:
+		bs, err := json.Marshal(val)
+		if err != nil {
+			return fmt.Sprint(val)
+		}
+		return string(bs)
+	}
+}
+
+type errResp struct {
+	Message string `json:"message"`
+}
+
+func errorResponse(msg string) *errResp {
+	return &errResp{Message: msg}
+}
+
+func writeJSON(w http.ResponseWriter, code int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Errorf("write response failed: %s", err)
+	}
+}
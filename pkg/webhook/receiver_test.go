@@ -0,0 +1,231 @@
+package webhook
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/mod"
+	"github.com/etherealiy/fastflow/store/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReceiver_ServeHTTP(t *testing.T) {
+	st := memory.NewStore()
+	mod.SetStore(st)
+	mod.SetCommander(&mod.DefCommander{})
+	assert.NoError(t, st.CreateDag(&entity.Dag{
+		BaseInfo: entity.BaseInfo{ID: "deploy"},
+		Status:   entity.DagStatusNormal,
+		Vars:     entity.DagVars{"branch": {DefaultValue: "def"}, "commit": {DefaultValue: "def"}},
+		Tasks:    []entity.Task{{ID: "task1", ActionName: "act"}},
+	}))
+
+	rcv, err := NewReceiver(&Option{
+		Sources: []Source{
+			{ID: "gh", Provider: ProviderGitHub, Secret: "gh-secret"},
+			{ID: "gl", Provider: ProviderGitLab, Secret: "gl-token"},
+			{ID: "stripe", Provider: ProviderStripe, Secret: "whsec"},
+			{ID: "custom", Provider: ProviderGeneric, Secret: "custom-secret", SignatureHeader: "X-Sig"},
+		},
+		Rules: []Rule{
+			{
+				Source: "gh",
+				DagID:  "deploy",
+				Events: []string{"push"},
+				Match:  map[string]string{"ref": "refs/heads/*"},
+				Vars:   map[string]string{"branch": "ref", "commit": "commits.0.id"},
+				Labels: map[string]string{"env": "prod"},
+			},
+			{Source: "gl", DagID: "deploy", Events: []string{"Push Hook"}},
+			{Source: "stripe", DagID: "deploy", Events: []string{"invoice.paid"}},
+			{Source: "custom", DagID: "deploy"},
+			{Source: "custom", DagID: "not-exist", Events: []string{"both"}},
+		},
+	})
+	assert.NoError(t, err)
+
+	githubReq := func(event, body, secret string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/webhooks/gh", strings.NewReader(body))
+		req.Header.Set("X-GitHub-Event", event)
+		req.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(Sign(secret, []byte(body))))
+		return req
+	}
+	stripeReq := func(ts int64, body string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/webhooks/stripe", strings.NewReader(body))
+		sig := hex.EncodeToString(Sign("whsec", []byte(fmt.Sprintf("%d.%s", ts, body))))
+		req.Header.Set("Stripe-Signature", fmt.Sprintf("t=%d,v1=%s", ts, sig))
+		return req
+	}
+	gitlabReq := httptest.NewRequest(http.MethodPost, "/webhooks/gl", strings.NewReader(`{}`))
+	gitlabReq.Header.Set("X-Gitlab-Event", "Push Hook")
+	gitlabReq.Header.Set("X-Gitlab-Token", "gl-token")
+	wrongTokenReq := httptest.NewRequest(http.MethodPost, "/webhooks/gl", strings.NewReader(`{}`))
+	wrongTokenReq.Header.Set("X-Gitlab-Token", "wrong")
+	genericReq := httptest.NewRequest(http.MethodPost, "/webhooks/custom", strings.NewReader(`{}`))
+	genericReq.Header.Set("X-Event-Type", "both")
+	genericReq.Header.Set("X-Sig", hex.EncodeToString(Sign("custom-secret", []byte(`{}`))))
+
+	tests := []struct {
+		caseDesc   string
+		giveReq    *http.Request
+		wantCode   int
+		wantBody   string
+		wantDagIns *entity.DagInstance
+	}{
+		{
+			caseDesc: "github push",
+			giveReq:  githubReq("push", `{"ref":"refs/heads/main","commits":[{"id":"abc"}]}`, "gh-secret"),
+			wantCode: http.StatusAccepted,
+			wantBody: `"dagInsIds":["1"]`,
+			wantDagIns: &entity.DagInstance{
+				Vars:        entity.DagInstanceVars{"branch": {Value: "refs/heads/main"}, "commit": {Value: "abc"}},
+				Trigger:     entity.TriggerWebhook,
+				TriggerMeta: &entity.TriggerMeta{Source: "gh"},
+				Labels:      map[string]string{"env": "prod"},
+			},
+		},
+		{
+			caseDesc: "github tag not matched",
+			giveReq:  githubReq("push", `{"ref":"refs/tags/v1"}`, "gh-secret"),
+			wantCode: http.StatusAccepted,
+			wantBody: `"dagInsIds":[]`,
+		},
+		{
+			caseDesc: "github event not matched",
+			giveReq:  githubReq("issues", `{"ref":"refs/heads/main"}`, "gh-secret"),
+			wantCode: http.StatusAccepted,
+			wantBody: `"dagInsIds":[]`,
+		},
+		{
+			caseDesc: "github invalid signature",
+			giveReq:  githubReq("push", `{"ref":"refs/heads/main"}`, "wrong"),
+			wantCode: http.StatusUnauthorized,
+			wantBody: "signature is invalid",
+		},
+		{
+			caseDesc: "gitlab",
+			giveReq:  gitlabReq,
+			wantCode: http.StatusAccepted,
+			wantBody: `"event":"Push Hook","dagInsIds":["2"]`,
+		},
+		{
+			caseDesc: "gitlab invalid token",
+			giveReq:  wrongTokenReq,
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			caseDesc: "stripe",
+			giveReq:  stripeReq(time.Now().Unix(), `{"type":"invoice.paid"}`),
+			wantCode: http.StatusAccepted,
+			wantBody: `"dagInsIds":["3"]`,
+		},
+		{
+			caseDesc: "stripe expired",
+			giveReq:  stripeReq(time.Now().Add(-time.Hour).Unix(), `{"type":"invoice.paid"}`),
+			wantCode: http.StatusUnauthorized,
+			wantBody: "out of tolerance",
+		},
+		{
+			caseDesc: "generic with failed rule",
+			giveReq:  genericReq,
+			wantCode: http.StatusInternalServerError,
+			wantBody: `"dagInsIds":["4"],"errors":["run dag[not-exist] failed`,
+		},
+		{
+			caseDesc: "source not found",
+			giveReq:  httptest.NewRequest(http.MethodPost, "/webhooks/unknown", nil),
+			wantCode: http.StatusNotFound,
+		},
+		{
+			caseDesc: "method not allowed",
+			giveReq:  httptest.NewRequest(http.MethodGet, "/webhooks/gh", nil),
+			wantCode: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			rcv.ServeHTTP(w, tc.giveReq)
+			assert.Equal(t, tc.wantCode, w.Code)
+			assert.Contains(t, w.Body.String(), tc.wantBody)
+			if tc.wantDagIns != nil {
+				dagIns, err := st.GetDagInstance("1")
+				assert.NoError(t, err)
+				assert.Equal(t, tc.wantDagIns.Vars, dagIns.Vars)
+				assert.Equal(t, tc.wantDagIns.Trigger, dagIns.Trigger)
+				assert.Equal(t, tc.wantDagIns.TriggerMeta, dagIns.TriggerMeta)
+				assert.Equal(t, tc.wantDagIns.Labels, dagIns.Labels)
+			}
+		})
+	}
+}
+
+func TestNewReceiver(t *testing.T) {
+	tests := []struct {
+		caseDesc string
+		giveOpt  *Option
+		wantErr  string
+	}{
+		{
+			caseDesc: "unknown provider",
+			giveOpt:  &Option{Sources: []Source{{ID: "s", Provider: "bitbucket", Secret: "x"}}},
+			wantErr:  `provider "bitbucket" of source[s] is not supported`,
+		},
+		{
+			caseDesc: "empty secret",
+			giveOpt:  &Option{Sources: []Source{{ID: "s", Provider: ProviderGitHub}}},
+			wantErr:  "secret of source[s] cannot be empty",
+		},
+		{
+			caseDesc: "duplicated source",
+			giveOpt: &Option{Sources: []Source{
+				{ID: "s", Provider: ProviderGitHub, Secret: "x"},
+				{ID: "s", Provider: ProviderGitHub, Secret: "x"},
+			}},
+			wantErr: "source[s] is duplicated",
+		},
+		{
+			caseDesc: "rule of unknown source",
+			giveOpt:  &Option{Rules: []Rule{{Source: "s", DagID: "d"}}},
+			wantErr:  "source[s] of rule does not exist",
+		},
+		{
+			caseDesc: "normal",
+			giveOpt: &Option{
+				Sources: []Source{{ID: "s", Provider: ProviderGeneric, SecretRef: "WEBHOOK_SECRET"}},
+				Rules:   []Rule{{Source: "s", DagID: "d"}},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			_, err := NewReceiver(tc.giveOpt)
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestLookup(t *testing.T) {
+	payload := map[string]interface{}{
+		"a": map[string]interface{}{"b": []interface{}{"x", map[string]interface{}{"c": float64(1)}}},
+	}
+	v, ok := Lookup(payload, "a.b.1.c")
+	assert.True(t, ok)
+	assert.Equal(t, "1", stringify(v))
+	_, ok = Lookup(payload, "a.b.2")
+	assert.False(t, ok)
+	_, ok = Lookup(payload, "a.x")
+	assert.False(t, ok)
+}
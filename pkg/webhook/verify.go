@@ -0,0 +1,122 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Provider decide how to verify the signature and get the event type
+type Provider string
+
+const (
+	// ProviderGitHub verify header "X-Hub-Signature-256", event type is header "X-GitHub-Event"
+	ProviderGitHub Provider = "github"
+	// ProviderGitLab compare header "X-Gitlab-Token" with secret, event type is header "X-Gitlab-Event"
+	ProviderGitLab Provider = "gitlab"
+	// ProviderStripe verify header "Stripe-Signature" with timestamp, event type is field "type" of payload
+	ProviderStripe Provider = "stripe"
+	// ProviderGeneric verify the hex HMAC-SHA256 of body in Source.SignatureHeader, "sha256=" prefix is optional
+	ProviderGeneric Provider = "generic"
+
+	defaultStripeTolerance = 5 * time.Minute
+)
+
+var errInvalidSignature = errors.New("signature is invalid")
+
+type verifier func(src *Source, secret string, header http.Header, body []byte) error
+
+var verifiers = map[Provider]verifier{
+	ProviderGitHub: func(src *Source, secret string, header http.Header, body []byte) error {
+		sig := header.Get("X-Hub-Signature-256")
+		if !strings.HasPrefix(sig, "sha256=") {
+			return fmt.Errorf("header X-Hub-Signature-256 is missing")
+		}
+		return checkHMAC(secret, body, strings.TrimPrefix(sig, "sha256="))
+	},
+	ProviderGitLab: func(src *Source, secret string, header http.Header, body []byte) error {
+		if subtle.ConstantTimeCompare([]byte(header.Get("X-Gitlab-Token")), []byte(secret)) != 1 {
+			return fmt.Errorf("header X-Gitlab-Token is invalid")
+		}
+		return nil
+	},
+	ProviderStripe:  verifyStripe,
+	ProviderGeneric: verifyGeneric,
+}
+
+// verifyStripe check header like "t=1492774577,v1=5257a869...,v1=..."
+func verifyStripe(src *Source, secret string, header http.Header, body []byte) error {
+	var ts string
+	var sigs []string
+	for _, item := range strings.Split(header.Get("Stripe-Signature"), ",") {
+		kv := strings.SplitN(strings.TrimSpace(item), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "t":
+			ts = kv[1]
+		case "v1":
+			sigs = append(sigs, kv[1])
+		}
+	}
+	if ts == "" || len(sigs) == 0 {
+		return fmt.Errorf("header Stripe-Signature is missing or malformed")
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return fmt.Errorf("timestamp of signature is invalid: %s", ts)
+	}
+	tolerance := src.Tolerance
+	if tolerance <= 0 {
+		tolerance = defaultStripeTolerance
+	}
+	if age := time.Since(time.Unix(unix, 0)); age > tolerance || age < -tolerance {
+		return fmt.Errorf("timestamp of signature is out of tolerance")
+	}
+
+	signed := append([]byte(ts+"."), body...)
+	for _, sig := range sigs {
+		if checkHMAC(secret, signed, sig) == nil {
+			return nil
+		}
+	}
+	return errInvalidSignature
+}
+
+func verifyGeneric(src *Source, secret string, header http.Header, body []byte) error {
+	h := src.SignatureHeader
+	if h == "" {
+		h = "X-Signature"
+	}
+	sig := header.Get(h)
+	if sig == "" {
+		return fmt.Errorf("header %s is missing", h)
+	}
+	return checkHMAC(secret, body, strings.TrimPrefix(sig, "sha256="))
+}
+
+func checkHMAC(secret string, body []byte, hexSig string) error {
+	sig, err := hex.DecodeString(hexSig)
+	if err != nil {
+		return errInvalidSignature
+	}
+	if !hmac.Equal(sig, Sign(secret, body)) {
+		return errInvalidSignature
+	}
+	return nil
+}
+
+// Sign return the HMAC-SHA256 of body, it can be used to send webhook to a generic source
+func Sign(secret string, body []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,94 @@
+package workspace
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/mod"
+	"github.com/etherealiy/fastflow/pkg/utils/data"
+)
+
+var _ mod.Workspace = (*Local)(nil)
+
+// LocalOption
+type LocalOption struct {
+	// BaseDir is the parent directory of all workspaces, default is "{os.TempDir}/fastflow-workspace"
+	BaseDir string
+	// Retention is how long a workspace is kept after its dag instance completed, default is 24h
+	Retention time.Duration
+}
+
+// Local allocate a directory named by dag instance id under BaseDir
+type Local struct {
+	opt *LocalOption
+}
+
+// NewLocal
+func NewLocal(opt *LocalOption) *Local {
+	if opt.BaseDir == "" {
+		opt.BaseDir = filepath.Join(os.TempDir(), "fastflow-workspace")
+	}
+	if opt.Retention == 0 {
+		opt.Retention = 24 * time.Hour
+	}
+	return &Local{opt: opt}
+}
+
+// Allocate
+func (l *Local) Allocate(dagIns *entity.DagInstance) (string, error) {
+	if dagIns.ID == "" || filepath.Base(dagIns.ID) != dagIns.ID {
+		return "", fmt.Errorf("invalid dag instance id: %q", dagIns.ID)
+	}
+	dir := filepath.Join(l.opt.BaseDir, dagIns.ID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("create workspace failed: %w", err)
+	}
+	return dir, nil
+}
+
+// Cleanup remove the workspaces whose dag instance are not found or completed longer than retention
+func (l *Local) Cleanup() error {
+	infos, err := ioutil.ReadDir(l.opt.BaseDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("read workspace dir failed: %w", err)
+	}
+	for _, info := range infos {
+		if !info.IsDir() {
+			continue
+		}
+		expired, err := l.isExpired(info.Name())
+		if err != nil {
+			return err
+		}
+		if !expired {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(l.opt.BaseDir, info.Name())); err != nil {
+			return fmt.Errorf("remove workspace failed: %w", err)
+		}
+	}
+	return nil
+}
+
+func (l *Local) isExpired(dagInsId string) (bool, error) {
+	dagIns, err := mod.GetStore().GetDagInstance(dagInsId)
+	if errors.Is(err, data.ErrDataNotFound) {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("get dag instance failed: %w", err)
+	}
+	switch dagIns.Status {
+	case entity.DagInstanceStatusSuccess, entity.DagInstanceStatusFailed:
+		return time.Since(time.Unix(dagIns.UpdatedAt, 0)) > l.opt.Retention, nil
+	}
+	return false, nil
+}
@@ -0,0 +1,93 @@
+package workspace
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/mod"
+	"github.com/etherealiy/fastflow/store/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocal_Allocate(t *testing.T) {
+	tests := []struct {
+		caseDesc   string
+		giveDagIns *entity.DagInstance
+		wantErr    bool
+	}{
+		{
+			caseDesc:   "normal",
+			giveDagIns: &entity.DagInstance{BaseInfo: entity.BaseInfo{ID: "dag-ins1"}},
+		},
+		{
+			caseDesc:   "empty id",
+			giveDagIns: &entity.DagInstance{},
+			wantErr:    true,
+		},
+		{
+			caseDesc:   "id with path",
+			giveDagIns: &entity.DagInstance{BaseInfo: entity.BaseInfo{ID: "../dag-ins1"}},
+			wantErr:    true,
+		},
+	}
+
+	l := NewLocal(&LocalOption{BaseDir: t.TempDir()})
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			path, err := l.Allocate(tc.giveDagIns)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, filepath.Join(l.opt.BaseDir, tc.giveDagIns.ID), path)
+			assert.DirExists(t, path)
+
+			// allocate again should return the same workspace
+			again, err := l.Allocate(tc.giveDagIns)
+			assert.NoError(t, err)
+			assert.Equal(t, path, again)
+		})
+	}
+}
+
+func TestLocal_Cleanup(t *testing.T) {
+	st := memory.NewStore()
+	mod.SetStore(st)
+	give := []*entity.DagInstance{
+		{BaseInfo: entity.BaseInfo{ID: "running"}, Status: entity.DagInstanceStatusRunning},
+		{BaseInfo: entity.BaseInfo{ID: "success"}, Status: entity.DagInstanceStatusSuccess},
+		{BaseInfo: entity.BaseInfo{ID: "failed"}, Status: entity.DagInstanceStatusFailed},
+	}
+	for i := range give {
+		assert.NoError(t, st.CreateDagIns(give[i]))
+	}
+
+	l := NewLocal(&LocalOption{BaseDir: t.TempDir(), Retention: time.Hour})
+	for _, id := range []string{"running", "success", "failed", "not-existed"} {
+		_, err := l.Allocate(&entity.DagInstance{BaseInfo: entity.BaseInfo{ID: id}})
+		assert.NoError(t, err)
+	}
+
+	// nothing expired except the not existed
+	assert.NoError(t, l.Cleanup())
+	assert.Equal(t, []string{"failed", "running", "success"}, readDirNames(t, l.opt.BaseDir))
+
+	l.opt.Retention = time.Nanosecond
+	time.Sleep(time.Millisecond)
+	assert.NoError(t, l.Cleanup())
+	assert.Equal(t, []string{"running"}, readDirNames(t, l.opt.BaseDir))
+}
+
+func readDirNames(t *testing.T, dir string) []string {
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names
+}
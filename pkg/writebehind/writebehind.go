@@ -0,0 +1,429 @@
+package writebehind
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/log"
+	"github.com/etherealiy/fastflow/pkg/mod"
+	"github.com/etherealiy/fastflow/pkg/utils"
+	"github.com/etherealiy/fastflow/pkg/utils/data"
+)
+
+var (
+	_ mod.Store              = (*Store)(nil)
+	_ mod.StoreWrapper       = (*Store)(nil)
+	_ mod.DagPruneStore      = (*Store)(nil)
+	_ mod.TaskInsClaimStore  = (*Store)(nil)
+	_ mod.RetryCountStore    = (*Store)(nil)
+	_ mod.TxStore            = (*Store)(nil)
+	_ mod.LeaseStore         = (*Store)(nil)
+	_ mod.ClusterConfigStore = (*Store)(nil)
+	_ mod.WorkerInfoStore    = (*Store)(nil)
+	_ mod.RateLimitStore     = (*Store)(nil)
+	_ mod.TaskLogStore       = (*Store)(nil)
+)
+
+// Option
+type Option struct {
+	// FlushInterval is the interval to write the pending patches, default 200ms
+	FlushInterval time.Duration
+	// MaxBatchSize flush the pending patches when they reach it, it is also the max size of a batch
+	// written to the store, default 100
+	MaxBatchSize int
+}
+
+// Store wrap a store and buffer PatchTaskIns, the patches of the same task instance are coalesced and
+// written in batches periodically, so a large dag does not issue a write for each state transition.
+// If the wrapped store implements mod.BatchPatchTaskInsStore, a batch is written in one round trip.
+//
+// The patches are flushed before the other task instance and dag instance operations, so the order
+// of writes to an instance is preserved and this worker always reads its own writes, other workers
+// can see them at most FlushInterval later. Close flushes the pending patches before closing the
+// wrapped store.
+// The capabilities of the wrapped store are forwarded, and they are only used when the wrapped store
+// has them, see mod.StoreAs.
+//
+//	fastflow.Init(&fastflow.InitialOption{Store: writebehind.WrapStore(st, &writebehind.Option{}), ...})
+type Store struct {
+	mod.Store
+	opt *Option
+
+	mu      sync.Mutex
+	pending map[string]*entity.TaskInstance
+	// order is the ids of pending task instances in the order of their first patch
+	order  []string
+	closed bool
+
+	// flushMu make the batches written one by one
+	flushMu sync.Mutex
+	flushCh chan struct{}
+	closeCh chan struct{}
+	wg      sync.WaitGroup
+}
+
+// WrapStore start flushing periodically, the wrapper must be closed instead of the wrapped store
+func WrapStore(st mod.Store, opt *Option) *Store {
+	if opt.FlushInterval == 0 {
+		opt.FlushInterval = 200 * time.Millisecond
+	}
+	if opt.MaxBatchSize == 0 {
+		opt.MaxBatchSize = 100
+	}
+	s := &Store{
+		Store:   st,
+		opt:     opt,
+		pending: map[string]*entity.TaskInstance{},
+		flushCh: make(chan struct{}, 1),
+		closeCh: make(chan struct{}),
+	}
+	s.wg.Add(1)
+	go s.goFlush()
+	return s
+}
+
+func (s *Store) goFlush() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.opt.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.closeCh:
+			return
+		case <-ticker.C:
+		case <-s.flushCh:
+		}
+		if err := s.Flush(); err != nil {
+			log.Errorf("flush task instance patches failed: %s", err)
+		}
+	}
+}
+
+// Close flush the pending patches and close the wrapped store
+func (s *Store) Close() {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	close(s.closeCh)
+	s.wg.Wait()
+
+	if err := s.Flush(); err != nil {
+		log.Errorf("flush task instance patches before closing failed: %s", err)
+	}
+	s.Store.Close()
+}
+
+// PatchTaskIns buffer the patch, it is written directly after the store closed
+func (s *Store) PatchTaskIns(taskIns *entity.TaskInstance) error {
+	if taskIns.ID == "" {
+		return fmt.Errorf("id cannot be empty")
+	}
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return s.Store.PatchTaskIns(taskIns)
+	}
+	// copy the patched fields, because the caller may modify the instance after returned
+	s.merge(taskIns)
+	full := len(s.order) >= s.opt.MaxBatchSize
+	s.mu.Unlock()
+
+	if full {
+		select {
+		case s.flushCh <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// merge apply the patch over the pending one of the same task instance, it must be called with mu held
+func (s *Store) merge(patch *entity.TaskInstance) {
+	p, ok := s.pending[patch.ID]
+	if !ok {
+		p = &entity.TaskInstance{BaseInfo: entity.BaseInfo{ID: patch.ID}}
+		s.pending[patch.ID] = p
+		s.order = append(s.order, patch.ID)
+	}
+	mod.ApplyTaskInsPatch(p, patch)
+}
+
+// Flush write the pending patches, when the error is transient the unwritten patches are kept to be retried
+func (s *Store) Flush() error {
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+
+	s.mu.Lock()
+	batch := make([]*entity.TaskInstance, 0, len(s.order))
+	for _, id := range s.order {
+		batch = append(batch, s.pending[id])
+	}
+	s.pending = map[string]*entity.TaskInstance{}
+	s.order = nil
+	s.mu.Unlock()
+
+	for start := 0; start < len(batch); start += s.opt.MaxBatchSize {
+		end := start + s.opt.MaxBatchSize
+		if end > len(batch) {
+			end = len(batch)
+		}
+		n, err := s.write(batch[start:end])
+		if err != nil {
+			s.requeue(batch[start+n:])
+			return err
+		}
+	}
+	return nil
+}
+
+// write patch the task instances and return the count of handled patches when failed transiently.
+// When a batch failed permanently, the patches are written one by one to drop the invalid ones only,
+// such as the patch of a deleted task instance
+func (s *Store) write(batch []*entity.TaskInstance) (int, error) {
+	if bs, ok := s.Store.(mod.BatchPatchTaskInsStore); ok {
+		err := bs.BatchPatchTaskIns(batch)
+		if err == nil {
+			return len(batch), nil
+		}
+		if errors.Is(err, data.ErrDataTransient) {
+			return 0, err
+		}
+		log.Warnf("batch patch task instances failed, patch them one by one: %s", err)
+	}
+
+	for i := range batch {
+		err := s.Store.PatchTaskIns(batch[i])
+		if errors.Is(err, data.ErrDataTransient) {
+			return i, err
+		}
+		if err != nil {
+			log.With(utils.LogKeyTaskInsID, batch[i].ID).Errorf("patch task instance failed, drop it: %s", err)
+		}
+	}
+	return len(batch), nil
+}
+
+// requeue put the failed patches before the pending ones, so they are still written first
+func (s *Store) requeue(failed []*entity.TaskInstance) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pending, order := s.pending, s.order
+	s.pending = map[string]*entity.TaskInstance{}
+	s.order = nil
+	for i := range failed {
+		s.merge(failed[i])
+	}
+	for _, id := range order {
+		s.merge(pending[id])
+	}
+}
+
+// UpdateTaskIns
+func (s *Store) UpdateTaskIns(taskIns *entity.TaskInstance) error {
+	if err := s.Flush(); err != nil {
+		return err
+	}
+	return s.Store.UpdateTaskIns(taskIns)
+}
+
+// BatchUpdateTaskIns
+func (s *Store) BatchUpdateTaskIns(taskIns []*entity.TaskInstance) error {
+	if err := s.Flush(); err != nil {
+		return err
+	}
+	return s.Store.BatchUpdateTaskIns(taskIns)
+}
+
+// GetTaskIns
+func (s *Store) GetTaskIns(taskInsId string) (*entity.TaskInstance, error) {
+	if err := s.Flush(); err != nil {
+		return nil, err
+	}
+	return s.Store.GetTaskIns(taskInsId)
+}
+
+// ListTaskInstance
+func (s *Store) ListTaskInstance(input *mod.ListTaskInstanceInput) ([]*entity.TaskInstance, error) {
+	if err := s.Flush(); err != nil {
+		return nil, err
+	}
+	return s.Store.ListTaskInstance(input)
+}
+
+// PatchDagIns
+func (s *Store) PatchDagIns(dagIns *entity.DagInstance, mustsPatchFields ...string) error {
+	if err := s.Flush(); err != nil {
+		return err
+	}
+	return s.Store.PatchDagIns(dagIns, mustsPatchFields...)
+}
+
+// UpdateDagIns
+func (s *Store) UpdateDagIns(dagIns *entity.DagInstance) error {
+	if err := s.Flush(); err != nil {
+		return err
+	}
+	return s.Store.UpdateDagIns(dagIns)
+}
+
+// BatchUpdateDagIns
+func (s *Store) BatchUpdateDagIns(dagIns []*entity.DagInstance) error {
+	if err := s.Flush(); err != nil {
+		return err
+	}
+	return s.Store.BatchUpdateDagIns(dagIns)
+}
+
+// Unwrap
+func (s *Store) Unwrap() mod.Store {
+	return s.Store
+}
+
+// ListDag
+func (s *Store) ListDag(input *mod.ListDagInput) ([]*entity.Dag, error) {
+	ps, ok := s.Store.(mod.DagPruneStore)
+	if !ok {
+		return nil, fmt.Errorf("store does not support pruning dags")
+	}
+	return ps.ListDag(input)
+}
+
+// BatchDeleteDag
+func (s *Store) BatchDeleteDag(ids []string) error {
+	ps, ok := s.Store.(mod.DagPruneStore)
+	if !ok {
+		return fmt.Errorf("store does not support pruning dags")
+	}
+	return ps.BatchDeleteDag(ids)
+}
+
+// ClaimTaskIns flush the patches first, so the claim sees the latest status of task instance
+func (s *Store) ClaimTaskIns(taskInsID, worker string, ttl time.Duration) (bool, error) {
+	cs, ok := s.Store.(mod.TaskInsClaimStore)
+	if !ok {
+		return false, fmt.Errorf("store does not support claiming task instances")
+	}
+	if err := s.Flush(); err != nil {
+		return false, err
+	}
+	return cs.ClaimTaskIns(taskInsID, worker, ttl)
+}
+
+// SwapRetryCount
+func (s *Store) SwapRetryCount(dagInsID string, oldCount, newCount int) (bool, error) {
+	rs, ok := s.Store.(mod.RetryCountStore)
+	if !ok {
+		return false, fmt.Errorf("store does not support swapping retry count")
+	}
+	if err := s.Flush(); err != nil {
+		return false, err
+	}
+	return rs.SwapRetryCount(dagInsID, oldCount, newCount)
+}
+
+// WithTx flush the patches before the transaction, the writes of fn are not buffered
+func (s *Store) WithTx(fn func(st mod.Store) error) error {
+	ts, ok := s.Store.(mod.TxStore)
+	if !ok {
+		return fmt.Errorf("store does not support transactions")
+	}
+	if err := s.Flush(); err != nil {
+		return err
+	}
+	return ts.WithTx(fn)
+}
+
+// AcquireLease
+func (s *Store) AcquireLease(key, holder string, ttl time.Duration) (bool, error) {
+	ls, ok := s.Store.(mod.LeaseStore)
+	if !ok {
+		return false, fmt.Errorf("store does not support leases")
+	}
+	return ls.AcquireLease(key, holder, ttl)
+}
+
+// ReleaseLease
+func (s *Store) ReleaseLease(key, holder string) (bool, error) {
+	ls, ok := s.Store.(mod.LeaseStore)
+	if !ok {
+		return false, fmt.Errorf("store does not support leases")
+	}
+	return ls.ReleaseLease(key, holder)
+}
+
+// ListLease
+func (s *Store) ListLease(prefix string) ([]*mod.Lease, error) {
+	ls, ok := s.Store.(mod.LeaseStore)
+	if !ok {
+		return nil, fmt.Errorf("store does not support leases")
+	}
+	return ls.ListLease(prefix)
+}
+
+// GetClusterConfig
+func (s *Store) GetClusterConfig() (*entity.ClusterConfig, error) {
+	cs, ok := s.Store.(mod.ClusterConfigStore)
+	if !ok {
+		return nil, fmt.Errorf("store does not support cluster config")
+	}
+	return cs.GetClusterConfig()
+}
+
+// SaveClusterConfig
+func (s *Store) SaveClusterConfig(cfg *entity.ClusterConfig) error {
+	cs, ok := s.Store.(mod.ClusterConfigStore)
+	if !ok {
+		return fmt.Errorf("store does not support cluster config")
+	}
+	return cs.SaveClusterConfig(cfg)
+}
+
+// SaveWorkerInfo
+func (s *Store) SaveWorkerInfo(info *entity.WorkerInfo) error {
+	ws, ok := s.Store.(mod.WorkerInfoStore)
+	if !ok {
+		return fmt.Errorf("store does not support worker info")
+	}
+	return ws.SaveWorkerInfo(info)
+}
+
+// ListWorkerInfo
+func (s *Store) ListWorkerInfo() ([]*entity.WorkerInfo, error) {
+	ws, ok := s.Store.(mod.WorkerInfoStore)
+	if !ok {
+		return nil, fmt.Errorf("store does not support worker info")
+	}
+	return ws.ListWorkerInfo()
+}
+
+// IncrRateLimitCounter
+func (s *Store) IncrRateLimitCounter(key string, windowStart time.Time, window time.Duration) (int, error) {
+	rs, ok := s.Store.(mod.RateLimitStore)
+	if !ok {
+		return 0, fmt.Errorf("store does not support rate limit counters")
+	}
+	return rs.IncrRateLimitCounter(key, windowStart, window)
+}
+
+// AppendTaskLogs
+func (s *Store) AppendTaskLogs(taskInsID string, logs []*entity.TaskLog, maxLines int) error {
+	ls, ok := s.Store.(mod.TaskLogStore)
+	if !ok {
+		return fmt.Errorf("store does not support task logs")
+	}
+	return ls.AppendTaskLogs(taskInsID, logs, maxLines)
+}
+
+// GetTaskLogs
+func (s *Store) GetTaskLogs(taskInsID string, cursor int64, limit int) ([]*entity.TaskLog, error) {
+	ls, ok := s.Store.(mod.TaskLogStore)
+	if !ok {
+		return nil, fmt.Errorf("store does not support task logs")
+	}
+	return ls.GetTaskLogs(taskInsID, cursor, limit)
+}
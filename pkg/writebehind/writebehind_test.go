@@ -0,0 +1,222 @@
+package writebehind
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/mod"
+	"github.com/etherealiy/fastflow/pkg/utils/data"
+	"github.com/etherealiy/fastflow/store/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordStore record the patches written to the memory store, and fail them by the given errors in turn
+type recordStore struct {
+	*memory.Store
+	mu      sync.Mutex
+	patches []*entity.TaskInstance
+	errs    []error
+}
+
+func (s *recordStore) PatchTaskIns(taskIns *entity.TaskInstance) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.errs) > 0 {
+		err := s.errs[0]
+		s.errs = s.errs[1:]
+		if err != nil {
+			return err
+		}
+	}
+	cp := *taskIns
+	s.patches = append(s.patches, &cp)
+	return s.Store.PatchTaskIns(taskIns)
+}
+
+func (s *recordStore) written() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ret []string
+	for _, p := range s.patches {
+		ret = append(ret, fmt.Sprintf("%s:%s", p.ID, p.Status))
+	}
+	return ret
+}
+
+func newTestStore(t *testing.T, opt *Option, ids ...string) (*Store, *recordStore) {
+	rs := &recordStore{Store: memory.NewStore()}
+	var taskIns []*entity.TaskInstance
+	for _, id := range ids {
+		taskIns = append(taskIns, &entity.TaskInstance{
+			BaseInfo: entity.BaseInfo{ID: id},
+			DagInsID: "dag-ins",
+			Status:   entity.TaskInstanceStatusInit,
+		})
+	}
+	assert.NoError(t, rs.BatchCreatTaskIns(taskIns))
+	return WrapStore(rs, opt), rs
+}
+
+func TestStore_PatchTaskIns(t *testing.T) {
+	tests := []struct {
+		caseDesc    string
+		giveErrs    []error
+		givePatches []*entity.TaskInstance
+		wantFlushed []string
+		wantErr     bool
+		wantPending []string
+	}{
+		{
+			caseDesc: "coalesced in order",
+			givePatches: []*entity.TaskInstance{
+				{BaseInfo: entity.BaseInfo{ID: "t2"}, Status: entity.TaskInstanceStatusRunning},
+				{BaseInfo: entity.BaseInfo{ID: "t1"}, Status: entity.TaskInstanceStatusRunning},
+				{BaseInfo: entity.BaseInfo{ID: "t2"}, Status: entity.TaskInstanceStatusSuccess},
+			},
+			wantFlushed: []string{"t2:success", "t1:running"},
+		},
+		{
+			caseDesc: "transient error kept",
+			giveErrs: []error{nil, data.Transient(fmt.Errorf("timeout"))},
+			givePatches: []*entity.TaskInstance{
+				{BaseInfo: entity.BaseInfo{ID: "t1"}, Status: entity.TaskInstanceStatusRunning},
+				{BaseInfo: entity.BaseInfo{ID: "t2"}, Status: entity.TaskInstanceStatusRunning},
+			},
+			wantFlushed: []string{"t1:running"},
+			wantErr:     true,
+			wantPending: []string{"t2"},
+		},
+		{
+			caseDesc: "permanent error dropped",
+			giveErrs: []error{fmt.Errorf("invalid")},
+			givePatches: []*entity.TaskInstance{
+				{BaseInfo: entity.BaseInfo{ID: "t1"}, Status: entity.TaskInstanceStatusRunning},
+				{BaseInfo: entity.BaseInfo{ID: "t2"}, Status: entity.TaskInstanceStatusRunning},
+			},
+			wantFlushed: []string{"t2:running"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			s, rs := newTestStore(t, &Option{FlushInterval: time.Hour}, "t1", "t2")
+			rs.errs = tc.giveErrs
+			for _, p := range tc.givePatches {
+				assert.NoError(t, s.PatchTaskIns(p))
+			}
+			assert.Empty(t, rs.written())
+
+			err := s.Flush()
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.wantFlushed, rs.written())
+			assert.Equal(t, tc.wantPending, s.order)
+		})
+	}
+}
+
+func TestStore_Requeue(t *testing.T) {
+	s, rs := newTestStore(t, &Option{FlushInterval: time.Hour}, "t1")
+	rs.errs = []error{data.Transient(fmt.Errorf("timeout"))}
+
+	assert.NoError(t, s.PatchTaskIns(&entity.TaskInstance{BaseInfo: entity.BaseInfo{ID: "t1"}, Status: entity.TaskInstanceStatusRunning, Reason: "first"}))
+	assert.Error(t, s.Flush())
+	// the newer patch is applied over the failed one
+	assert.NoError(t, s.PatchTaskIns(&entity.TaskInstance{BaseInfo: entity.BaseInfo{ID: "t1"}, Status: entity.TaskInstanceStatusSuccess}))
+
+	ret, err := s.GetTaskIns("t1")
+	assert.NoError(t, err)
+	assert.Equal(t, entity.TaskInstanceStatusSuccess, ret.Status)
+	assert.Equal(t, "first", ret.Reason)
+}
+
+func TestStore_FlushBeforeOtherOps(t *testing.T) {
+	s, rs := newTestStore(t, &Option{FlushInterval: time.Hour}, "t1")
+
+	assert.NoError(t, s.PatchTaskIns(&entity.TaskInstance{BaseInfo: entity.BaseInfo{ID: "t1"}, Status: entity.TaskInstanceStatusRunning}))
+	ret, err := s.GetTaskIns("t1")
+	assert.NoError(t, err)
+	assert.Equal(t, entity.TaskInstanceStatusRunning, ret.Status)
+
+	// the update must not be overwritten by the earlier patch
+	assert.NoError(t, s.PatchTaskIns(&entity.TaskInstance{BaseInfo: entity.BaseInfo{ID: "t1"}, Reason: "patched"}))
+	ret.Status = entity.TaskInstanceStatusFailed
+	ret.Reason = "updated"
+	assert.NoError(t, s.UpdateTaskIns(ret))
+	assert.NoError(t, s.Flush())
+
+	ret, err = rs.Store.GetTaskIns("t1")
+	assert.NoError(t, err)
+	assert.Equal(t, entity.TaskInstanceStatusFailed, ret.Status)
+	assert.Equal(t, "updated", ret.Reason)
+}
+
+func TestStore_MaxBatchSize(t *testing.T) {
+	s, rs := newTestStore(t, &Option{FlushInterval: time.Hour, MaxBatchSize: 2}, "t1", "t2")
+
+	assert.NoError(t, s.PatchTaskIns(&entity.TaskInstance{BaseInfo: entity.BaseInfo{ID: "t1"}, Status: entity.TaskInstanceStatusRunning}))
+	assert.NoError(t, s.PatchTaskIns(&entity.TaskInstance{BaseInfo: entity.BaseInfo{ID: "t2"}, Status: entity.TaskInstanceStatusRunning}))
+	assert.Eventually(t, func() bool {
+		return len(rs.written()) == 2
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"t1:running", "t2:running"}, rs.written())
+}
+
+func TestStore_Close(t *testing.T) {
+	s, rs := newTestStore(t, &Option{FlushInterval: time.Hour}, "t1")
+
+	assert.NoError(t, s.PatchTaskIns(&entity.TaskInstance{BaseInfo: entity.BaseInfo{ID: "t1"}, Status: entity.TaskInstanceStatusRunning}))
+	s.Close()
+	assert.Equal(t, []string{"t1:running"}, rs.written())
+
+	// written directly after closed
+	assert.NoError(t, s.PatchTaskIns(&entity.TaskInstance{BaseInfo: entity.BaseInfo{ID: "t1"}, Status: entity.TaskInstanceStatusSuccess}))
+	assert.Equal(t, []string{"t1:running", "t1:success"}, rs.written())
+}
+
+func TestStore_Capabilities(t *testing.T) {
+	tests := []struct {
+		caseDesc  string
+		giveStore mod.Store
+		wantOk    bool
+	}{
+		{
+			caseDesc:  "forwarded",
+			giveStore: memory.NewStore(),
+			wantOk:    true,
+		},
+		{
+			caseDesc:  "hidden when the wrapped store does not have it",
+			giveStore: struct{ mod.Store }{memory.NewStore()},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			s := WrapStore(tc.giveStore, &Option{})
+			defer s.Close()
+			_, ok := mod.StoreAs[mod.TaskInsClaimStore](s)
+			assert.Equal(t, tc.wantOk, ok)
+			_, ok = mod.StoreAs[mod.RateLimitStore](s)
+			assert.Equal(t, tc.wantOk, ok)
+			_, ok = mod.StoreAs[mod.WorkerInfoStore](s)
+			assert.Equal(t, tc.wantOk, ok)
+		})
+	}
+}
+
+func TestStore_ClaimTaskIns(t *testing.T) {
+	s, rs := newTestStore(t, &Option{FlushInterval: time.Hour}, "t1")
+
+	// the claim must see the pending patch, a running task instance is not claimable
+	assert.NoError(t, s.PatchTaskIns(&entity.TaskInstance{BaseInfo: entity.BaseInfo{ID: "t1"}, Status: entity.TaskInstanceStatusRunning}))
+	ok, err := s.ClaimTaskIns("t1", "worker-1", time.Minute)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, []string{"t1:running"}, rs.written())
+}
@@ -0,0 +1,80 @@
+package fastflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/api"
+	"github.com/etherealiy/fastflow/pkg/dashboard"
+	"github.com/etherealiy/fastflow/pkg/grpcapi"
+	"github.com/etherealiy/fastflow/pkg/log"
+	"github.com/etherealiy/fastflow/pkg/mod"
+	"google.golang.org/grpc"
+)
+
+func serveApi(opt *InitialOption) error {
+	h := api.NewHandler()
+	h.SetAuthenticator(opt.APIAuthenticator)
+	mux := http.NewServeMux()
+	mux.Handle(api.PathPrefix, h)
+	mux.Handle(dashboard.PathPrefix, dashboard.NewHandler())
+	return serveHttp("api", opt.APIAddr, &http.Server{Handler: mux})
+}
+
+// serveGrpc serve the gRPC control plane, the options of opt are applied after the built-in interceptors
+func serveGrpc(opt *InitialOption) error {
+	s := grpcapi.NewServer()
+	s.SetAuthenticator(opt.APIAuthenticator)
+	gs := s.NewGRPCServer(opt.GRPCServerOptions...)
+	ln, err := net.Listen("tcp", opt.GRPCAddr)
+	if err != nil {
+		return fmt.Errorf("listen grpc server failed: %w", err)
+	}
+	go func() {
+		if err := gs.Serve(ln); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+			log.Errorf("grpc server stopped: %s", err)
+		}
+	}()
+	// the watching streams may not finish in time, so stop them after a while
+	closers = append([]mod.Closer{closerFunc(func() {
+		timer := time.AfterFunc(5*time.Second, gs.Stop)
+		defer timer.Stop()
+		gs.GracefulStop()
+	})}, closers...)
+	log.Infof("grpc server listen at %s", ln.Addr())
+	return nil
+}
+
+// serveHttp listen before returning, so the error of address is returned to caller
+func serveHttp(name, addr string, srv *http.Server) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("listen %s http server failed: %w", name, err)
+	}
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Errorf("%s http server stopped: %s", name, err)
+		}
+	}()
+	// http server should close before other components
+	closers = append([]mod.Closer{closerFunc(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Errorf("shutdown %s http server failed: %s", name, err)
+		}
+	})}, closers...)
+	log.Infof("%s http server listen at %s", name, ln.Addr())
+	return nil
+}
+
+type closerFunc func()
+
+// Close
+func (f closerFunc) Close() {
+	f()
+}
@@ -0,0 +1,26 @@
+package fastflow
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_serveHttp(t *testing.T) {
+	old := closers
+	closers = nil
+	defer func() {
+		closers = old
+	}()
+	assert.NoError(t, serveHttp("test", "127.0.0.1:0", &http.Server{}))
+	assert.Len(t, closers, 1)
+
+	// listening error is returned to caller
+	err := serveHttp("test", "127.0.0.1:-1", &http.Server{})
+	assert.Error(t, err)
+	assert.Len(t, closers, 1)
+
+	// shutdown the server
+	closers[0].Close()
+}
@@ -0,0 +1,129 @@
+package fixture
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/mod"
+	"gopkg.in/yaml.v3"
+)
+
+// Fixture is a declarative data set which can be loaded into any mod.Store,
+// it is useful to reproduce a bug report or prepare data for integration tests.
+// fields use the same names as the json form of entities, e.g.
+//
+//	dags:
+//	- id: "dag1"
+//	  tasks:
+//	  - id: "task1"
+//	    actionName: "PrintAction"
+//	dagInstances:
+//	- id: "dag-ins1"
+//	  dagId: "dag1"
+//	  status: "failed"
+//	  taskInstances:
+//	  - id: "task-ins1"
+//	    taskId: "task1"
+//	    status: "failed"
+//	    reason: "connection refused"
+type Fixture struct {
+	Dags          []*entity.Dag          `json:"dags,omitempty"`
+	DagInstances  []*DagInstance         `json:"dagInstances,omitempty"`
+	TaskInstances []*entity.TaskInstance `json:"taskInstances,omitempty"`
+}
+
+// DagInstance is a dag instance with its task instances,
+// the "dagInsId" of nested task instances will be filled automatically
+type DagInstance struct {
+	entity.DagInstance
+	TaskInstances []*entity.TaskInstance `json:"taskInstances,omitempty"`
+}
+
+// LoadFile read a yaml or json fixture file and load it into store
+func LoadFile(st mod.Store, path string) (*Fixture, error) {
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read fixture %s failed: %w", path, err)
+	}
+
+	f, err := Parse(bs)
+	if err != nil {
+		return nil, fmt.Errorf("parse fixture %s failed: %w", path, err)
+	}
+	if err := Load(st, f); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Parse a yaml or json fixture
+func Parse(bs []byte) (*Fixture, error) {
+	// entities only have json tags, so we convert yaml to json first
+	// json is a subset of yaml, so it works for both of them
+	var raw interface{}
+	if err := yaml.Unmarshal(bs, &raw); err != nil {
+		return nil, err
+	}
+	jsonBytes, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &Fixture{}
+	if err := json.Unmarshal(jsonBytes, f); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Load the fixture into store.
+// IMPORTANT: "createdAt" and "updatedAt" will be reset by store
+func Load(st mod.Store, f *Fixture) error {
+	for _, dag := range f.Dags {
+		if dag.Status == "" {
+			dag.Status = entity.DagStatusNormal
+		}
+		if err := st.CreateDag(dag); err != nil {
+			return fmt.Errorf("create dag[%s] failed: %w", dag.ID, err)
+		}
+	}
+
+	for _, d := range f.DagInstances {
+		dagIns := &d.DagInstance
+		if dagIns.ShareData == nil {
+			dagIns.ShareData = &entity.ShareData{}
+		}
+		if dagIns.Status == "" {
+			dagIns.Status = entity.DagInstanceStatusInit
+		}
+		if err := st.CreateDagIns(dagIns); err != nil {
+			return fmt.Errorf("create dag instance[%s] failed: %w", dagIns.ID, err)
+		}
+
+		for _, t := range d.TaskInstances {
+			t.DagInsID = dagIns.ID
+		}
+		if err := createTaskIns(st, d.TaskInstances); err != nil {
+			return err
+		}
+	}
+
+	return createTaskIns(st, f.TaskInstances)
+}
+
+func createTaskIns(st mod.Store, taskIns []*entity.TaskInstance) error {
+	if len(taskIns) == 0 {
+		return nil
+	}
+	for _, t := range taskIns {
+		if t.Status == "" {
+			t.Status = entity.TaskInstanceStatusInit
+		}
+	}
+	if err := st.BatchCreatTaskIns(taskIns); err != nil {
+		return fmt.Errorf("create task instances failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package fixture
+
+import (
+	"testing"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/mod"
+	"github.com/etherealiy/fastflow/store/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoad(t *testing.T) {
+	f, err := Parse([]byte(`
+dags:
+- id: "dag1"
+  tasks:
+  - id: "task1"
+    actionName: "act"
+  - id: "task2"
+    actionName: "act"
+    dependOn: ["task1"]
+dagInstances:
+- id: "dag-ins1"
+  dagId: "dag1"
+  status: "failed"
+  reason: "task[task2] failed"
+  vars:
+    key:
+      value: "val"
+  shareData:
+    shareKey: "shareVal"
+  taskInstances:
+  - id: "task-ins1"
+    taskId: "task1"
+    status: "success"
+  - id: "task-ins2"
+    taskId: "task2"
+    dependOn: ["task1"]
+    status: "failed"
+    reason: "connection refused"
+taskInstances:
+- id: "task-ins3"
+  taskId: "task1"
+  dagInsId: "dag-ins2"
+`))
+	assert.NoError(t, err)
+
+	st := memory.NewStore()
+	assert.NoError(t, Load(st, f))
+
+	dag, err := st.GetDag("dag1")
+	assert.NoError(t, err)
+	assert.Equal(t, entity.DagStatusNormal, dag.Status)
+	assert.Len(t, dag.Tasks, 2)
+
+	dagIns, err := st.GetDagInstance("dag-ins1")
+	assert.NoError(t, err)
+	assert.Equal(t, entity.DagInstanceStatusFailed, dagIns.Status)
+	assert.Equal(t, "val", dagIns.Vars["key"].Value)
+	v, _ := dagIns.ShareData.Get("shareKey")
+	assert.Equal(t, "shareVal", v)
+
+	taskIns, err := st.ListTaskInstance(&mod.ListTaskInstanceInput{DagInsID: "dag-ins1"})
+	assert.NoError(t, err)
+	assert.Len(t, taskIns, 2)
+	assert.Equal(t, entity.TaskInstanceStatusFailed, taskIns[1].Status)
+	assert.Equal(t, "connection refused", taskIns[1].Reason)
+
+	orphan, err := st.GetTaskIns("task-ins3")
+	assert.NoError(t, err)
+	assert.Equal(t, entity.TaskInstanceStatusInit, orphan.Status)
+}
+
+func TestParse_Invalid(t *testing.T) {
+	_, err := Parse([]byte(`dags: 123`))
+	assert.Error(t, err)
+}
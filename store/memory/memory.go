@@ -0,0 +1,769 @@
+package memory
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/event"
+	"github.com/etherealiy/fastflow/pkg/mod"
+	"github.com/etherealiy/fastflow/pkg/utils/data"
+	"github.com/shiningrush/goevent"
+)
+
+var (
+	_ mod.Store         = (*Store)(nil)
+	_ mod.DagPruneStore = (*Store)(nil)
+	_ mod.LeaseStore    = (*Store)(nil)
+
+	_ mod.ClusterConfigStore = (*Store)(nil)
+	_ mod.WorkerInfoStore    = (*Store)(nil)
+	_ mod.RateLimitStore     = (*Store)(nil)
+	_ mod.TaskLogStore       = (*Store)(nil)
+	_ mod.RetryCountStore    = (*Store)(nil)
+	_ mod.TxStore            = (*Store)(nil)
+)
+
+// Store is a memory implement of mod.Store
+// it is used by standalone mode and tests, all data will be lost after process exited
+type Store struct {
+	dags    *collection
+	dagIns  *collection
+	taskIns *collection
+	leases  map[string]mod.Lease
+	// clusterConfig is nil until it is saved
+	clusterConfig []byte
+	workerInfos   map[string][]byte
+	// rateLimits is the counters of rate limit windows, the ended windows are removed when increasing
+	rateLimits map[string]*rateLimitCounter
+	// taskLogs keep the logs of each task instance in order of seq
+	taskLogs map[string][]*entity.TaskLog
+
+	seq   uint64
+	mutex sync.RWMutex
+}
+
+// collection keep documents in insert order, so list result is stable like mongo's natural order
+type collection struct {
+	name  string
+	docs  map[string][]byte
+	order []string
+
+	// undo record the prior state of changed documents when tracking, so a transaction can be rolled back
+	tracking bool
+	undo     []change
+}
+
+// change is the prior state of a document, index is its position in order when it is deleted, otherwise -1
+type change struct {
+	id      string
+	doc     []byte
+	existed bool
+	index   int
+}
+
+func newCollection(name string) *collection {
+	return &collection{
+		name: name,
+		docs: map[string][]byte{},
+	}
+}
+
+func (c *collection) put(id string, doc []byte) {
+	old, ok := c.docs[id]
+	if c.tracking {
+		c.undo = append(c.undo, change{id: id, doc: old, existed: ok, index: -1})
+	}
+	if !ok {
+		c.order = append(c.order, id)
+	}
+	c.docs[id] = doc
+}
+
+func (c *collection) delete(id string) {
+	old, ok := c.docs[id]
+	if !ok {
+		return
+	}
+	delete(c.docs, id)
+	for i := range c.order {
+		if c.order[i] == id {
+			if c.tracking {
+				c.undo = append(c.undo, change{id: id, doc: old, existed: true, index: i})
+			}
+			c.order = append(c.order[:i], c.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// track start recording changes
+func (c *collection) track() {
+	c.tracking, c.undo = true, nil
+}
+
+// commit stop recording and drop the changes
+func (c *collection) commit() {
+	c.tracking, c.undo = false, nil
+}
+
+// rollback undo the recorded changes in reverse order, so each one sees the state right after it was made
+func (c *collection) rollback() {
+	for i := len(c.undo) - 1; i >= 0; i-- {
+		ch := c.undo[i]
+		switch {
+		case !ch.existed:
+			// a created document is the last one in order
+			delete(c.docs, ch.id)
+			c.order = c.order[:len(c.order)-1]
+		case ch.index >= 0:
+			c.docs[ch.id] = ch.doc
+			c.order = append(c.order, "")
+			copy(c.order[ch.index+1:], c.order[ch.index:])
+			c.order[ch.index] = ch.id
+		default:
+			c.docs[ch.id] = ch.doc
+		}
+	}
+	c.commit()
+}
+
+// NewStore
+func NewStore() *Store {
+	return &Store{
+		dags:        newCollection("dag"),
+		dagIns:      newCollection("dag_instance"),
+		taskIns:     newCollection("task_instance"),
+		leases:      map[string]mod.Lease{},
+		workerInfos: map[string][]byte{},
+		rateLimits:  map[string]*rateLimitCounter{},
+		taskLogs:    map[string][]*entity.TaskLog{},
+	}
+}
+
+// Init store, memory store has nothing to initial, it just keep same usage with other stores
+func (s *Store) Init() error {
+	return nil
+}
+
+// Close component when we not use it anymore
+func (s *Store) Close() {
+}
+
+// CreateDag
+func (s *Store) CreateDag(dag *entity.Dag) error {
+	// check task's connection
+	_, err := mod.BuildRootNode(mod.MapTasksToGetter(dag.Tasks))
+	if err != nil {
+		return err
+	}
+	return s.genericCreate(dag, s.dags)
+}
+
+// CreateDagIns
+func (s *Store) CreateDagIns(dagIns *entity.DagInstance) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if dagIns.IdempotencyKey != "" {
+		for _, doc := range s.dagIns.docs {
+			fields := struct {
+				DagID          string `json:"dagId"`
+				IdempotencyKey string `json:"idempotencyKey"`
+			}{}
+			if err := json.Unmarshal(doc, &fields); err != nil {
+				return fmt.Errorf("unmarshal dag instance failed: %w", err)
+			}
+			if fields.DagID == dagIns.DagID && fields.IdempotencyKey == dagIns.IdempotencyKey {
+				return fmt.Errorf("dag instance of dag[ %s ] with idempotency key[ %s ] already existed: %w",
+					dagIns.DagID, dagIns.IdempotencyKey, data.ErrIdempotencyKeyConflicted)
+			}
+		}
+	}
+	return s.create(dagIns, s.dagIns)
+}
+
+// BatchCreatTaskIns
+func (s *Store) BatchCreatTaskIns(taskIns []*entity.TaskInstance) error {
+	for i := range taskIns {
+		if err := s.genericCreate(taskIns[i], s.taskIns); err != nil {
+			return fmt.Errorf("insert task instance failed: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *Store) genericCreate(input entity.BaseInfoGetter, cls *collection) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.create(input, cls)
+}
+
+// create must be called with mutex held
+func (s *Store) create(input entity.BaseInfoGetter, cls *collection) error {
+	baseInfo := input.GetBaseInfo()
+	if baseInfo.ID == "" {
+		s.seq++
+		baseInfo.ID = strconv.FormatUint(s.seq, 10)
+	}
+	if _, ok := cls.docs[baseInfo.ID]; ok {
+		return fmt.Errorf("%s key[ %s ] already existed: %w", cls.name, baseInfo.ID, data.ErrDataConflicted)
+	}
+	baseInfo.Initial()
+
+	bs, err := json.Marshal(input)
+	if err != nil {
+		return fmt.Errorf("marshal %s failed: %w", cls.name, err)
+	}
+	cls.put(baseInfo.ID, bs)
+	return nil
+}
+
+// PatchTaskIns
+func (s *Store) PatchTaskIns(taskIns *entity.TaskInstance) error {
+	if taskIns.ID == "" {
+		return fmt.Errorf("id cannot be empty")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	old := new(entity.TaskInstance)
+	if err := s.get(s.taskIns, taskIns.ID, old); err != nil {
+		return fmt.Errorf("patch task instance failed: %w", err)
+	}
+	mod.ApplyTaskInsPatch(old, taskIns)
+	return s.put(s.taskIns, old.ID, old)
+}
+
+// PatchDagIns
+func (s *Store) PatchDagIns(dagIns *entity.DagInstance, mustsPatchFields ...string) error {
+	s.mutex.Lock()
+	old := new(entity.DagInstance)
+	if err := s.get(s.dagIns, dagIns.ID, old); err != nil {
+		s.mutex.Unlock()
+		return fmt.Errorf("patch dag instance failed: %w", err)
+	}
+
+	mod.ApplyDagInsPatch(old, dagIns, mustsPatchFields...)
+	err := s.put(s.dagIns, old.ID, old)
+	s.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	goevent.Publish(&event.DagInstancePatched{
+		Payload:         dagIns,
+		MustPatchFields: mustsPatchFields,
+	})
+	return nil
+}
+
+// UpdateDag
+func (s *Store) UpdateDag(dag *entity.Dag) error {
+	// check task's connection
+	_, err := mod.BuildRootNode(mod.MapTasksToGetter(dag.Tasks))
+	if err != nil {
+		return err
+	}
+	return s.genericUpdate(dag, s.dags)
+}
+
+// UpdateDagIns
+func (s *Store) UpdateDagIns(dagIns *entity.DagInstance) error {
+	if err := s.genericUpdate(dagIns, s.dagIns); err != nil {
+		return err
+	}
+
+	goevent.Publish(&event.DagInstanceUpdated{Payload: dagIns})
+	return nil
+}
+
+// UpdateTaskIns
+func (s *Store) UpdateTaskIns(taskIns *entity.TaskInstance) error {
+	return s.genericUpdate(taskIns, s.taskIns)
+}
+
+func (s *Store) genericUpdate(input entity.BaseInfoGetter, cls *collection) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	baseInfo := input.GetBaseInfo()
+	if _, ok := cls.docs[baseInfo.ID]; !ok {
+		return fmt.Errorf("%s has no key[ %s ] to update: %w", cls.name, baseInfo.ID, data.ErrDataNotFound)
+	}
+	baseInfo.Update()
+	return s.put(cls, baseInfo.ID, input)
+}
+
+// BatchUpdateDagIns
+func (s *Store) BatchUpdateDagIns(dagIns []*entity.DagInstance) error {
+	for i := range dagIns {
+		if err := s.genericUpdate(dagIns[i], s.dagIns); err != nil {
+			return fmt.Errorf("batch update dag instance failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// BatchUpdateTaskIns
+func (s *Store) BatchUpdateTaskIns(taskIns []*entity.TaskInstance) error {
+	for i := range taskIns {
+		if err := s.genericUpdate(taskIns[i], s.taskIns); err != nil {
+			return fmt.Errorf("batch update task instance failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// GetTaskIns
+func (s *Store) GetTaskIns(taskInsId string) (*entity.TaskInstance, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	ret := new(entity.TaskInstance)
+	if err := s.get(s.taskIns, taskInsId, ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// GetDag
+func (s *Store) GetDag(dagId string) (*entity.Dag, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	ret := new(entity.Dag)
+	if err := s.get(s.dags, dagId, ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// GetDagInstance
+func (s *Store) GetDagInstance(dagInsId string) (*entity.DagInstance, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	ret := new(entity.DagInstance)
+	if err := s.get(s.dagIns, dagInsId, ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// ListDag
+func (s *Store) ListDag(input *mod.ListDagInput) ([]*entity.Dag, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var ret []*entity.Dag
+	for _, id := range s.dags.order {
+		if input != nil && !strings.HasPrefix(id, input.IDPrefix) {
+			continue
+		}
+		dag := new(entity.Dag)
+		if err := s.get(s.dags, id, dag); err != nil {
+			return nil, err
+		}
+		ret = append(ret, dag)
+	}
+	return ret, nil
+}
+
+// ListDagInstance
+func (s *Store) ListDagInstance(input *mod.ListDagInstanceInput) ([]*entity.DagInstance, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if input.SortByPriority {
+		return s.listDagInsByPriority(input)
+	}
+	var (
+		ret     []*entity.DagInstance
+		skipped int64
+	)
+	for _, id := range s.dagIns.order {
+		dagIns := new(entity.DagInstance)
+		if err := s.get(s.dagIns, id, dagIns); err != nil {
+			return nil, err
+		}
+		if !input.Match(dagIns) {
+			continue
+		}
+		if skipped < input.Offset {
+			skipped++
+			continue
+		}
+		ret = append(ret, dagIns)
+		if input.Limit > 0 && int64(len(ret)) >= input.Limit {
+			break
+		}
+	}
+	return ret, nil
+}
+
+// listDagInsByPriority need all matched dag instances to sort before paging
+func (s *Store) listDagInsByPriority(input *mod.ListDagInstanceInput) ([]*entity.DagInstance, error) {
+	var matched []*entity.DagInstance
+	for _, id := range s.dagIns.order {
+		dagIns := new(entity.DagInstance)
+		if err := s.get(s.dagIns, id, dagIns); err != nil {
+			return nil, err
+		}
+		if input.Match(dagIns) {
+			matched = append(matched, dagIns)
+		}
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		if matched[i].Priority != matched[j].Priority {
+			return matched[i].Priority > matched[j].Priority
+		}
+		return matched[i].CreatedAt < matched[j].CreatedAt
+	})
+
+	if input.Offset >= int64(len(matched)) {
+		return nil, nil
+	}
+	matched = matched[input.Offset:]
+	if input.Limit > 0 && int64(len(matched)) > input.Limit {
+		matched = matched[:input.Limit]
+	}
+	return matched, nil
+}
+
+// ListTaskInstance
+func (s *Store) ListTaskInstance(input *mod.ListTaskInstanceInput) ([]*entity.TaskInstance, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	ids := s.taskIns.order
+	if len(input.IDs) > 0 {
+		ids = input.IDs
+	}
+
+	var ret []*entity.TaskInstance
+	for _, id := range ids {
+		if _, ok := s.taskIns.docs[id]; !ok {
+			continue
+		}
+		taskIns := new(entity.TaskInstance)
+		if err := s.get(s.taskIns, id, taskIns); err != nil {
+			return nil, err
+		}
+		if !input.Match(taskIns) {
+			continue
+		}
+		ret = append(ret, taskIns)
+	}
+	return input.Page(ret), nil
+}
+
+// BatchDeleteDag
+func (s *Store) BatchDeleteDag(ids []string) error {
+	return s.genericBatchDelete(ids, s.dags)
+}
+
+// BatchDeleteDagIns
+func (s *Store) BatchDeleteDagIns(ids []string) error {
+	return s.genericBatchDelete(ids, s.dagIns)
+}
+
+// BatchDeleteTaskIns
+func (s *Store) BatchDeleteTaskIns(ids []string) error {
+	return s.genericBatchDelete(ids, s.taskIns)
+}
+
+// WithTx run fn with a view of the store while holding the lock of store, so other operations wait until
+// fn returns, the changes of dags, dag instances and task instances made by fn are undone when it returns error
+func (s *Store) WithTx(fn func(st mod.Store) error) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	clss := []*collection{s.dags, s.dagIns, s.taskIns}
+	for _, cls := range clss {
+		cls.track()
+	}
+
+	tx := &Store{
+		dags:          s.dags,
+		dagIns:        s.dagIns,
+		taskIns:       s.taskIns,
+		leases:        s.leases,
+		clusterConfig: s.clusterConfig,
+		workerInfos:   s.workerInfos,
+		rateLimits:    s.rateLimits,
+		taskLogs:      s.taskLogs,
+		seq:           s.seq,
+	}
+	err := fn(tx)
+	// the sequence is not rolled back, so the ids are not reused
+	s.seq = tx.seq
+	if err != nil {
+		for _, cls := range clss {
+			cls.rollback()
+		}
+		return err
+	}
+	for _, cls := range clss {
+		cls.commit()
+	}
+	s.clusterConfig = tx.clusterConfig
+	return nil
+}
+
+// ClaimTaskIns
+func (s *Store) ClaimTaskIns(taskInsID, worker string, ttl time.Duration) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	old := new(entity.TaskInstance)
+	if err := s.get(s.taskIns, taskInsID, old); err != nil {
+		return false, fmt.Errorf("claim task instance failed: %w", err)
+	}
+	if !mod.ApplyTaskInsClaim(old, worker, ttl) {
+		return false, nil
+	}
+	return true, s.put(s.taskIns, old.ID, old)
+}
+
+// SwapRetryCount
+func (s *Store) SwapRetryCount(dagInsID string, oldCount, newCount int) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	dagIns := new(entity.DagInstance)
+	if err := s.get(s.dagIns, dagInsID, dagIns); err != nil {
+		return false, fmt.Errorf("swap retry count failed: %w", err)
+	}
+	if !mod.ApplyRetryCountSwap(dagIns, oldCount, newCount) {
+		return false, nil
+	}
+	return true, s.put(s.dagIns, dagIns.ID, dagIns)
+}
+
+// AcquireLease
+func (s *Store) AcquireLease(key, holder string, ttl time.Duration) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	if l, ok := s.leases[key]; ok && l.Holder != holder && l.ExpiredAt.After(now) {
+		return false, nil
+	}
+	s.leases[key] = mod.Lease{Key: key, Holder: holder, ExpiredAt: now.Add(ttl)}
+	return true, nil
+}
+
+// ReleaseLease
+func (s *Store) ReleaseLease(key, holder string) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	l, ok := s.leases[key]
+	if !ok || l.Holder != holder {
+		return false, nil
+	}
+	delete(s.leases, key)
+	return l.ExpiredAt.After(time.Now()), nil
+}
+
+// ListLease
+func (s *Store) ListLease(prefix string) ([]*mod.Lease, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var ret []*mod.Lease
+	now := time.Now()
+	for k, l := range s.leases {
+		if strings.HasPrefix(k, prefix) && l.ExpiredAt.After(now) {
+			l := l
+			ret = append(ret, &l)
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Key < ret[j].Key
+	})
+	return ret, nil
+}
+
+// GetClusterConfig
+func (s *Store) GetClusterConfig() (*entity.ClusterConfig, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if s.clusterConfig == nil {
+		return nil, fmt.Errorf("cluster config not found: %w", data.ErrDataNotFound)
+	}
+	cfg := &entity.ClusterConfig{}
+	if err := json.Unmarshal(s.clusterConfig, cfg); err != nil {
+		return nil, fmt.Errorf("unmarshal cluster config failed: %w", err)
+	}
+	return cfg, nil
+}
+
+// SaveClusterConfig
+func (s *Store) SaveClusterConfig(cfg *entity.ClusterConfig) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	bs, err := json.Marshal(cfg)
+	if err != nil {
+		return fmt.Errorf("marshal cluster config failed: %w", err)
+	}
+	s.clusterConfig = bs
+	return nil
+}
+
+// SaveWorkerInfo
+func (s *Store) SaveWorkerInfo(info *entity.WorkerInfo) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	bs, err := json.Marshal(info)
+	if err != nil {
+		return fmt.Errorf("marshal worker info failed: %w", err)
+	}
+	s.workerInfos[info.Key] = bs
+	return nil
+}
+
+// ListWorkerInfo
+func (s *Store) ListWorkerInfo() ([]*entity.WorkerInfo, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var ret []*entity.WorkerInfo
+	for _, bs := range s.workerInfos {
+		info := &entity.WorkerInfo{}
+		if err := json.Unmarshal(bs, info); err != nil {
+			return nil, fmt.Errorf("unmarshal worker info failed: %w", err)
+		}
+		// alive is not persisted
+		info.Alive = false
+		ret = append(ret, info)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Key < ret[j].Key
+	})
+	return ret, nil
+}
+
+type rateLimitCounter struct {
+	count     int
+	expiredAt time.Time
+}
+
+// IncrRateLimitCounter
+func (s *Store) IncrRateLimitCounter(key string, windowStart time.Time, window time.Duration) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	for id, c := range s.rateLimits {
+		if now.After(c.expiredAt) {
+			delete(s.rateLimits, id)
+		}
+	}
+	id := fmt.Sprintf("%s@%d", key, windowStart.UnixNano())
+	c, ok := s.rateLimits[id]
+	if !ok {
+		c = &rateLimitCounter{expiredAt: windowStart.Add(window)}
+		s.rateLimits[id] = c
+	}
+	c.count++
+	return c.count, nil
+}
+
+// AppendTaskLogs
+func (s *Store) AppendTaskLogs(taskInsID string, logs []*entity.TaskLog, maxLines int) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	stored := s.taskLogs[taskInsID]
+	for _, l := range logs {
+		stored = append(stored, copyTaskLog(l))
+	}
+	sort.SliceStable(stored, func(i, j int) bool {
+		return stored[i].Seq < stored[j].Seq
+	})
+	if maxLines > 0 && len(stored) > maxLines {
+		stored = append([]*entity.TaskLog(nil), stored[len(stored)-maxLines:]...)
+	}
+	s.taskLogs[taskInsID] = stored
+	return nil
+}
+
+// GetTaskLogs
+func (s *Store) GetTaskLogs(taskInsID string, cursor int64, limit int) ([]*entity.TaskLog, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	ret := []*entity.TaskLog{}
+	for _, l := range s.taskLogs[taskInsID] {
+		if l.Seq <= cursor {
+			continue
+		}
+		if limit > 0 && len(ret) >= limit {
+			break
+		}
+		ret = append(ret, copyTaskLog(l))
+	}
+	return ret, nil
+}
+
+func copyTaskLog(l *entity.TaskLog) *entity.TaskLog {
+	cp := *l
+	if l.Fields != nil {
+		cp.Fields = make(map[string]string, len(l.Fields))
+		for k, v := range l.Fields {
+			cp.Fields[k] = v
+		}
+	}
+	return &cp
+}
+
+func (s *Store) genericBatchDelete(ids []string, cls *collection) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, id := range ids {
+		cls.delete(id)
+	}
+	return nil
+}
+
+// get decode a copy of document, so caller's modification will not affect the store
+func (s *Store) get(cls *collection, id string, ret interface{}) error {
+	bs, ok := cls.docs[id]
+	if !ok {
+		return fmt.Errorf("%s key[ %s ] not found: %w", cls.name, id, data.ErrDataNotFound)
+	}
+	if err := json.Unmarshal(bs, ret); err != nil {
+		return fmt.Errorf("decode %s failed: %w", cls.name, err)
+	}
+	return nil
+}
+
+func (s *Store) put(cls *collection, id string, doc interface{}) error {
+	bs, err := json.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("marshal %s failed: %w", cls.name, err)
+	}
+	cls.put(id, bs)
+	return nil
+}
+
+// Marshal
+func (s *Store) Marshal(obj interface{}) ([]byte, error) {
+	return json.Marshal(obj)
+}
+
+// Unmarshal
+func (s *Store) Unmarshal(bytes []byte, ptr interface{}) error {
+	return json.Unmarshal(bytes, ptr)
+}
@@ -0,0 +1,166 @@
+package memory
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/mod"
+	"github.com/etherealiy/fastflow/pkg/utils/data"
+	"github.com/etherealiy/fastflow/store/storetest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStore_DagIns(t *testing.T) {
+	s := NewStore()
+	giveDagIns := []*entity.DagInstance{
+		{DagID: "dag1", Status: entity.DagInstanceStatusInit, ShareData: &entity.ShareData{}},
+		{DagID: "dag1", Status: entity.DagInstanceStatusRunning, Worker: "worker-1"},
+		{DagID: "dag2", Status: entity.DagInstanceStatusRunning, Worker: "worker-2"},
+	}
+	for i := range giveDagIns {
+		assert.NoError(t, s.CreateDagIns(giveDagIns[i]))
+		assert.NotEmpty(t, giveDagIns[i].ID)
+	}
+	err := s.CreateDagIns(&entity.DagInstance{BaseInfo: entity.BaseInfo{ID: giveDagIns[0].ID}})
+	assert.True(t, errors.Is(err, data.ErrDataConflicted))
+
+	tests := []struct {
+		caseDesc string
+		giveIpt  *mod.ListDagInstanceInput
+		wantIDs  []string
+	}{
+		{
+			caseDesc: "all",
+			giveIpt:  &mod.ListDagInstanceInput{},
+			wantIDs:  []string{giveDagIns[0].ID, giveDagIns[1].ID, giveDagIns[2].ID},
+		},
+		{
+			caseDesc: "status and dag",
+			giveIpt: &mod.ListDagInstanceInput{
+				DagID:  "dag1",
+				Status: []entity.DagInstanceStatus{entity.DagInstanceStatusRunning},
+			},
+			wantIDs: []string{giveDagIns[1].ID},
+		},
+		{
+			caseDesc: "worker",
+			giveIpt:  &mod.ListDagInstanceInput{Worker: "worker-2"},
+			wantIDs:  []string{giveDagIns[2].ID},
+		},
+		{
+			caseDesc: "limit and offset",
+			giveIpt:  &mod.ListDagInstanceInput{Limit: 1, Offset: 1},
+			wantIDs:  []string{giveDagIns[1].ID},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			ret, err := s.ListDagInstance(tc.giveIpt)
+			assert.NoError(t, err)
+			var ids []string
+			for i := range ret {
+				ids = append(ids, ret[i].ID)
+			}
+			assert.Equal(t, tc.wantIDs, ids)
+		})
+	}
+
+	err = s.PatchDagIns(&entity.DagInstance{
+		BaseInfo: entity.BaseInfo{ID: giveDagIns[0].ID},
+		Cmd:      &entity.Command{Name: entity.CommandNameRetry},
+	})
+	assert.NoError(t, err)
+	ret, err := s.ListDagInstance(&mod.ListDagInstanceInput{HasCmd: true})
+	assert.NoError(t, err)
+	assert.Len(t, ret, 1)
+	assert.Equal(t, entity.DagInstanceStatusInit, ret[0].Status)
+	assert.NotNil(t, ret[0].ShareData)
+
+	// modify returned instance should not affect store
+	ret[0].Status = entity.DagInstanceStatusFailed
+	got, err := s.GetDagInstance(giveDagIns[0].ID)
+	assert.NoError(t, err)
+	assert.Equal(t, entity.DagInstanceStatusInit, got.Status)
+
+	_, err = s.GetDagInstance("not-exist")
+	assert.True(t, errors.Is(err, data.ErrDataNotFound))
+}
+
+func TestStore_TaskIns(t *testing.T) {
+	s := NewStore()
+	giveTaskIns := []*entity.TaskInstance{
+		{TaskID: "task1", DagInsID: "dagIns1", Status: entity.TaskInstanceStatusInit},
+		{TaskID: "task2", DagInsID: "dagIns1", Status: entity.TaskInstanceStatusInit},
+		{TaskID: "task1", DagInsID: "dagIns2", Status: entity.TaskInstanceStatusInit},
+	}
+	assert.NoError(t, s.BatchCreatTaskIns(giveTaskIns))
+
+	err := s.PatchTaskIns(&entity.TaskInstance{
+		BaseInfo: entity.BaseInfo{ID: giveTaskIns[1].ID},
+		Status:   entity.TaskInstanceStatusSuccess,
+		TimeUsed: "1s",
+	})
+	assert.NoError(t, err)
+	got, err := s.GetTaskIns(giveTaskIns[1].ID)
+	assert.NoError(t, err)
+	assert.Equal(t, entity.TaskInstanceStatusSuccess, got.Status)
+	assert.Equal(t, "1s", got.TimeUsed)
+	assert.Equal(t, "task2", got.TaskID)
+
+	ret, err := s.ListTaskInstance(&mod.ListTaskInstanceInput{
+		DagInsID: "dagIns1",
+		Status:   []entity.TaskInstanceStatus{entity.TaskInstanceStatusInit},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, ret, 1)
+	assert.Equal(t, giveTaskIns[0].ID, ret[0].ID)
+
+	ret, err = s.ListTaskInstance(&mod.ListTaskInstanceInput{
+		IDs: []string{giveTaskIns[2].ID, "not-exist"},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, ret, 1)
+
+	assert.NoError(t, s.BatchDeleteTaskIns([]string{giveTaskIns[0].ID}))
+	ret, err = s.ListTaskInstance(&mod.ListTaskInstanceInput{})
+	assert.NoError(t, err)
+	assert.Len(t, ret, 2)
+}
+
+func TestStore_WithTxRollback(t *testing.T) {
+	s := NewStore()
+	giveTaskIns := []*entity.TaskInstance{
+		{TaskID: "task1", DagInsID: "dagIns1", Status: entity.TaskInstanceStatusInit},
+		{TaskID: "task2", DagInsID: "dagIns1", Status: entity.TaskInstanceStatusInit},
+		{TaskID: "task3", DagInsID: "dagIns1", Status: entity.TaskInstanceStatusInit},
+	}
+	assert.NoError(t, s.BatchCreatTaskIns(giveTaskIns))
+	before, err := s.ListTaskInstance(&mod.ListTaskInstanceInput{})
+	assert.NoError(t, err)
+
+	err = s.WithTx(func(tx mod.Store) error {
+		if err := tx.PatchTaskIns(&entity.TaskInstance{
+			BaseInfo: entity.BaseInfo{ID: giveTaskIns[0].ID},
+			Status:   entity.TaskInstanceStatusSuccess,
+		}); err != nil {
+			return err
+		}
+		if err := tx.BatchCreatTaskIns([]*entity.TaskInstance{{TaskID: "task4", DagInsID: "dagIns1"}}); err != nil {
+			return err
+		}
+		if err := tx.(*Store).BatchDeleteTaskIns([]string{giveTaskIns[1].ID, giveTaskIns[0].ID}); err != nil {
+			return err
+		}
+		return errors.New("rollback")
+	})
+	assert.EqualError(t, err, "rollback")
+
+	after, err := s.ListTaskInstance(&mod.ListTaskInstanceInput{})
+	assert.NoError(t, err)
+	assert.Equal(t, before, after)
+}
+
+func TestStore_Conformance(t *testing.T) {
+	storetest.RunConformance(t, NewStore())
+}
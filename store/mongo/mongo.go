@@ -9,6 +9,8 @@ import (
 	"github.com/etherealiy/fastflow/pkg/utils"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"regexp"
+	"strings"
 	"sync"
 	"time"
 
@@ -24,6 +26,21 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
+var (
+	_ mod.Store         = (*Store)(nil)
+	_ mod.DagPruneStore = (*Store)(nil)
+	_ mod.LeaseStore    = (*Store)(nil)
+
+	_ mod.ClusterConfigStore = (*Store)(nil)
+	_ mod.WorkerInfoStore    = (*Store)(nil)
+	_ mod.RateLimitStore     = (*Store)(nil)
+	_ mod.TaskLogStore       = (*Store)(nil)
+	_ mod.RetryCountStore    = (*Store)(nil)
+	_ mod.TxStore            = (*Store)(nil)
+
+	_ mod.BatchPatchTaskInsStore = (*Store)(nil)
+)
+
 // StoreOption
 type StoreOption struct {
 	// mongo connection string
@@ -35,19 +52,32 @@ type StoreOption struct {
 	Prefix string
 	// If it uses GridFS Buckets to store dag
 	WithGridFS bool
+	// LoadConnStr is called in Init and Reload to get the latest connection string, it takes precedence over ConnStr,
+	// so the rotated credentials can be used without restarting, e.g. read them from a file mounted by secret manager
+	LoadConnStr func() (string, error)
 }
 
 // Store
 type Store struct {
-	opt            *StoreOption
-	dagClsName     string
-	dagInsClsName  string
-	taskInsClsName string
-
+	opt              *StoreOption
+	dagClsName       string
+	dagInsClsName    string
+	taskInsClsName   string
+	leaseClsName     string
+	configClsName    string
+	workerClsName    string
+	rateLimitClsName string
+	taskLogClsName   string
+
+	// connLock protect the client which is replaced when reloading
+	connLock    sync.RWMutex
 	mongoClient *mongo.Client
 	mongoDb     *mongo.Database
 
 	dagBucket *gridfs.Bucket
+
+	// txCtx is the session context of the store used in a transaction
+	txCtx context.Context
 }
 
 // NewStore
@@ -65,29 +95,163 @@ func (s *Store) Init() error {
 
 	ctx, cancel := context.WithTimeout(context.Background(), s.opt.Timeout)
 	defer cancel()
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(s.opt.ConnStr))
+	if err := s.connect(ctx); err != nil {
+		return err
+	}
+
+	// expired leases are ignored by queries, the index just clean them up
+	if _, err := s.db().Collection(s.leaseClsName).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.M{"expiredAt": 1},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	}); err != nil {
+		return fmt.Errorf("create lease index failed: %w", err)
+	}
+	// clean up the info of workers which have not reported for a long time
+	if _, err := s.db().Collection(s.workerClsName).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.M{"expiredAt": 1},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	}); err != nil {
+		return fmt.Errorf("create worker index failed: %w", err)
+	}
+	// clean up the counters of ended rate limit windows
+	if _, err := s.db().Collection(s.rateLimitClsName).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.M{"expiredAt": 1},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	}); err != nil {
+		return fmt.Errorf("create rate limit index failed: %w", err)
+	}
+	// the logs are read and rotated by task instance in order of seq
+	if _, err := s.db().Collection(s.taskLogClsName).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "taskInsId", Value: 1}, {Key: "seq", Value: 1}},
+	}); err != nil {
+		return fmt.Errorf("create task log index failed: %w", err)
+	}
+	// the idempotency key is unique among the dag instances of the same dag
+	if _, err := s.db().Collection(s.dagInsClsName).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "dagId", Value: 1}, {Key: "idempotencyKey", Value: 1}},
+		Options: options.Index().SetName(idempotencyKeyIndex).SetUnique(true).
+			SetPartialFilterExpression(bson.M{"idempotencyKey": bson.M{"$exists": true}}),
+	}); err != nil {
+		return fmt.Errorf("create idempotency key index failed: %w", err)
+	}
+
+	return nil
+}
+
+// connect to mongo and replace the current client
+func (s *Store) connect(ctx context.Context) error {
+	connStr := s.opt.ConnStr
+	if s.opt.LoadConnStr != nil {
+		var err error
+		if connStr, err = s.opt.LoadConnStr(); err != nil {
+			return fmt.Errorf("load connect string failed: %w", err)
+		}
+	}
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(connStr))
 	if err != nil {
 		return fmt.Errorf("connect client failed: %w", err)
 	}
 	err = client.Ping(ctx, readpref.Primary())
 	if err != nil {
+		_ = client.Disconnect(ctx)
 		return fmt.Errorf("ping client failed: %w", err)
 	}
-	s.mongoClient = client
-	s.mongoDb = s.mongoClient.Database(s.opt.Database)
-
+	db := client.Database(s.opt.Database)
+	var bucket *gridfs.Bucket
 	if s.opt.WithGridFS {
-		s.dagBucket, err = gridfs.NewBucket(s.mongoDb, options.GridFSBucket().SetName(s.dagClsName))
+		bucket, err = gridfs.NewBucket(db, options.GridFSBucket().SetName(s.dagClsName))
 		if err != nil {
+			_ = client.Disconnect(ctx)
 			return fmt.Errorf("create dag bucket failed: %w", err)
 		}
 	}
 
+	s.connLock.Lock()
+	s.mongoClient, s.mongoDb, s.dagBucket = client, db, bucket
+	s.connLock.Unlock()
 	return nil
 }
 
+// Reload reconnect to mongo with the connection string returned by LoadConnStr, the old client is
+// disconnected after its in-use connections are returned
+func (s *Store) Reload() error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.opt.Timeout)
+	defer cancel()
+
+	old := s.client()
+	if err := s.connect(ctx); err != nil {
+		return err
+	}
+	if err := old.Disconnect(ctx); err != nil {
+		log.Errorf("close old store client failed: %s", err)
+	}
+	return nil
+}
+
+func (s *Store) client() *mongo.Client {
+	s.connLock.RLock()
+	defer s.connLock.RUnlock()
+	return s.mongoClient
+}
+
+func (s *Store) db() *mongo.Database {
+	s.connLock.RLock()
+	defer s.connLock.RUnlock()
+	return s.mongoDb
+}
+
+func (s *Store) bucket() *gridfs.Bucket {
+	s.connLock.RLock()
+	defer s.connLock.RUnlock()
+	return s.dagBucket
+}
+
+// baseCtx return the context which operations derive from, it carries the session in a transaction
+func (s *Store) baseCtx() context.Context {
+	if s.txCtx != nil {
+		return s.txCtx
+	}
+	return context.TODO()
+}
+
+// WithTx run fn in a mongo transaction, it requires mongo to be deployed as a replica set or sharded cluster,
+// fn is retried when the transaction meets transient errors
+func (s *Store) WithTx(fn func(st mod.Store) error) error {
+	sess, err := s.client().StartSession()
+	if err != nil {
+		return fmt.Errorf("start session failed: %w", err)
+	}
+	defer sess.EndSession(context.TODO())
+
+	_, err = sess.WithTransaction(context.TODO(), func(sessCtx mongo.SessionContext) (interface{}, error) {
+		return nil, fn(s.txStore(sessCtx))
+	})
+	return err
+}
+
+// txStore return a store sharing the connection of s, its operations run in the session of ctx
+func (s *Store) txStore(ctx context.Context) *Store {
+	s.connLock.RLock()
+	defer s.connLock.RUnlock()
+	return &Store{
+		opt:              s.opt,
+		dagClsName:       s.dagClsName,
+		dagInsClsName:    s.dagInsClsName,
+		taskInsClsName:   s.taskInsClsName,
+		leaseClsName:     s.leaseClsName,
+		configClsName:    s.configClsName,
+		workerClsName:    s.workerClsName,
+		rateLimitClsName: s.rateLimitClsName,
+		taskLogClsName:   s.taskLogClsName,
+		mongoClient:      s.mongoClient,
+		mongoDb:          s.mongoDb,
+		dagBucket:        s.dagBucket,
+		txCtx:            ctx,
+	}
+}
+
 func (s *Store) readOpt() error {
-	if s.opt.ConnStr == "" {
+	if s.opt.ConnStr == "" && s.opt.LoadConnStr == nil {
 		return fmt.Errorf("connect string cannot be empty")
 	}
 	if s.opt.Database == "" {
@@ -99,10 +263,20 @@ func (s *Store) readOpt() error {
 	s.dagClsName = "dag"
 	s.dagInsClsName = "dag_instance"
 	s.taskInsClsName = "task_instance"
+	s.leaseClsName = "lease"
+	s.configClsName = "cluster_config"
+	s.workerClsName = "worker"
+	s.rateLimitClsName = "rate_limit"
+	s.taskLogClsName = "task_log"
 	if s.opt.Prefix != "" {
 		s.dagClsName = fmt.Sprintf("%s_%s", s.opt.Prefix, s.dagClsName)
 		s.dagInsClsName = fmt.Sprintf("%s_%s", s.opt.Prefix, s.dagInsClsName)
 		s.taskInsClsName = fmt.Sprintf("%s_%s", s.opt.Prefix, s.taskInsClsName)
+		s.leaseClsName = fmt.Sprintf("%s_%s", s.opt.Prefix, s.leaseClsName)
+		s.configClsName = fmt.Sprintf("%s_%s", s.opt.Prefix, s.configClsName)
+		s.workerClsName = fmt.Sprintf("%s_%s", s.opt.Prefix, s.workerClsName)
+		s.rateLimitClsName = fmt.Sprintf("%s_%s", s.opt.Prefix, s.rateLimitClsName)
+		s.taskLogClsName = fmt.Sprintf("%s_%s", s.opt.Prefix, s.taskLogClsName)
 	}
 
 	return nil
@@ -113,7 +287,7 @@ func (s *Store) Close() {
 	ctx, cancel := context.WithTimeout(context.TODO(), s.opt.Timeout)
 	defer cancel()
 
-	if err := s.mongoClient.Disconnect(ctx); err != nil {
+	if err := s.client().Disconnect(ctx); err != nil {
 		log.Errorf("close store client failed: %s", err)
 	}
 }
@@ -133,13 +307,21 @@ func (s *Store) CreateDag(dag *entity.Dag) error {
 		}
 		dag.BaseInfo.CreatedAt = time.Now().Unix()
 		dag.BaseInfo.UpdatedAt = dag.BaseInfo.CreatedAt
-		return s.uploadToBucket(dag, s.dagBucket, nil)
+		return s.uploadToBucket(dag, s.bucket(), nil)
 	}
 }
 
+// idempotencyKeyIndex is the name of unique index of dag id and idempotency key
+const idempotencyKeyIndex = "idempotency_key"
+
 // CreateDagIns
 func (s *Store) CreateDagIns(dagIns *entity.DagInstance) error {
-	return s.genericCreate(dagIns, s.dagInsClsName)
+	err := s.genericCreate(dagIns, s.dagInsClsName)
+	if errors.Is(err, data.ErrDataConflicted) && strings.Contains(err.Error(), "index: "+idempotencyKeyIndex+" ") {
+		return fmt.Errorf("dag instance of dag[ %s ] with idempotency key[ %s ] already existed: %w",
+			dagIns.DagID, dagIns.IdempotencyKey, data.ErrIdempotencyKeyConflicted)
+	}
+	return err
 	//if !s.opt.WithGridFS {
 	//	return s.genericCreate(dagIns, s.dagInsClsName)
 	//} else {
@@ -167,15 +349,16 @@ func (s *Store) genericCreate(input entity.BaseInfoGetter, clsName string) error
 	baseInfo := input.GetBaseInfo()
 	baseInfo.Initial()
 
-	ctx, cancel := context.WithTimeout(context.TODO(), s.opt.Timeout)
+	ctx, cancel := context.WithTimeout(s.baseCtx(), s.opt.Timeout)
 	defer cancel()
 
-	if _, err := s.mongoDb.Collection(clsName).InsertOne(ctx, input); err != nil {
+	if _, err := s.db().Collection(clsName).InsertOne(ctx, input); err != nil {
 		if mongo.IsDuplicateKeyError(err) {
-			return fmt.Errorf("%s key[ %s ] already existed: %w", clsName, baseInfo.ID, data.ErrDataConflicted)
+			// the error of unique index tells which index is violated
+			return fmt.Errorf("%s key[ %s ] already existed, %s: %w", clsName, baseInfo.ID, err, data.ErrDataConflicted)
 		}
 
-		return fmt.Errorf("insert instance failed: %w", err)
+		return fmt.Errorf("insert instance failed: %w", markTransient(err))
 	}
 	return nil
 }
@@ -201,12 +384,12 @@ func (s *Store) uploadToBucket(input entity.BaseInfoGetter, bucket *gridfs.Bucke
 
 // BatchCreatTaskIns
 func (s *Store) BatchCreatTaskIns(taskIns []*entity.TaskInstance) error {
-	ctx, cancel := context.WithTimeout(context.TODO(), s.opt.Timeout)
+	ctx, cancel := context.WithTimeout(s.baseCtx(), s.opt.Timeout)
 	defer cancel()
 
 	for i := range taskIns {
 		taskIns[i].Initial()
-		if _, err := s.mongoDb.Collection(s.taskInsClsName).InsertOne(ctx, taskIns[i]); err != nil {
+		if _, err := s.db().Collection(s.taskInsClsName).InsertOne(ctx, taskIns[i]); err != nil {
 			return fmt.Errorf("insert task instance failed: %w", err)
 		}
 	}
@@ -218,6 +401,40 @@ func (s *Store) PatchTaskIns(taskIns *entity.TaskInstance) error {
 	if taskIns.ID == "" {
 		return fmt.Errorf("id cannot be empty")
 	}
+
+	ctx, cancel := context.WithTimeout(s.baseCtx(), s.opt.Timeout)
+	defer cancel()
+	if _, err := s.db().Collection(s.taskInsClsName).UpdateOne(ctx, bson.M{"_id": taskIns.ID}, taskInsPatchUpdate(taskIns)); err != nil {
+		return fmt.Errorf("patch task instance failed: %w", markTransient(err))
+	}
+	return nil
+}
+
+// BatchPatchTaskIns patch the task instances by an ordered bulk write
+func (s *Store) BatchPatchTaskIns(taskIns []*entity.TaskInstance) error {
+	if len(taskIns) == 0 {
+		return nil
+	}
+	models := make([]mongo.WriteModel, 0, len(taskIns))
+	for i := range taskIns {
+		if taskIns[i].ID == "" {
+			return fmt.Errorf("id cannot be empty")
+		}
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": taskIns[i].ID}).
+			SetUpdate(taskInsPatchUpdate(taskIns[i])))
+	}
+
+	ctx, cancel := context.WithTimeout(s.baseCtx(), s.opt.Timeout)
+	defer cancel()
+	if _, err := s.db().Collection(s.taskInsClsName).BulkWrite(ctx, models); err != nil {
+		return fmt.Errorf("batch patch task instance failed: %w", markTransient(err))
+	}
+	return nil
+}
+
+// taskInsPatchUpdate build the update which set the non-zero fields of task instance
+func taskInsPatchUpdate(taskIns *entity.TaskInstance) bson.M {
 	update := bson.M{
 		"updatedAt": time.Now().Unix(),
 	}
@@ -233,16 +450,51 @@ func (s *Store) PatchTaskIns(taskIns *entity.TaskInstance) error {
 	if taskIns.TimeUsed != "" {
 		update["timeUsed"] = taskIns.TimeUsed
 	}
-	update = bson.M{
-		"$set": update,
+	if len(taskIns.Attempts) > 0 {
+		update["attempts"] = taskIns.Attempts
 	}
-
-	ctx, cancel := context.WithTimeout(context.TODO(), s.opt.Timeout)
-	defer cancel()
-	if _, err := s.mongoDb.Collection(s.taskInsClsName).UpdateOne(ctx, bson.M{"_id": taskIns.ID}, update); err != nil {
-		return fmt.Errorf("patch task instance failed: %w", err)
+	if len(taskIns.Artifacts) > 0 {
+		update["artifacts"] = taskIns.Artifacts
+	}
+	if taskIns.Lineage != nil {
+		update["lineage"] = taskIns.Lineage
+	}
+	if taskIns.ShareDataSnapshot != nil {
+		update["shareDataSnapshot"] = taskIns.ShareDataSnapshot
+	}
+	if taskIns.BranchSkipped {
+		update["branchSkipped"] = true
+	}
+	if len(taskIns.MapItems) > 0 {
+		update["mapItems"] = taskIns.MapItems
+	}
+	if taskIns.SubDagInsID != "" {
+		update["subDagInsId"] = taskIns.SubDagInsID
+	}
+	if taskIns.AutoRetries != 0 {
+		update["autoRetries"] = taskIns.AutoRetries
+	}
+	if taskIns.NextRetryAt != 0 {
+		update["nextRetryAt"] = taskIns.NextRetryAt
+	}
+	if len(taskIns.Outputs) > 0 {
+		update["outputs"] = taskIns.Outputs
+	}
+	if taskIns.Worker != "" {
+		update["worker"] = taskIns.Worker
+	}
+	if taskIns.ClaimExpiresAt != 0 {
+		update["claimExpiresAt"] = taskIns.ClaimExpiresAt
+	}
+	if taskIns.Callback != nil {
+		update["callback"] = taskIns.Callback
+	}
+	if taskIns.Sensor != nil {
+		update["sensor"] = taskIns.Sensor
+	}
+	return bson.M{
+		"$set": update,
 	}
-	return nil
 }
 
 // PatchDagIns
@@ -267,15 +519,48 @@ func (s *Store) PatchDagIns(dagIns *entity.DagInstance, mustsPatchFields ...stri
 	if utils.StringsContain(mustsPatchFields, "Reason") || dagIns.Reason != "" {
 		update["reason"] = dagIns.Reason
 	}
+	if dagIns.Notes != nil {
+		update["notes"] = dagIns.Notes
+	}
+	if dagIns.Annotations != nil {
+		update["annotations"] = dagIns.Annotations
+	}
+	if dagIns.Summary != nil {
+		update["summary"] = dagIns.Summary
+	}
+	if dagIns.RetryCount != 0 {
+		update["retryCount"] = dagIns.RetryCount
+	}
+	if dagIns.Deadline != 0 {
+		update["deadline"] = dagIns.Deadline
+	}
+	if dagIns.SLAs != nil {
+		update["slas"] = dagIns.SLAs
+	}
+	if utils.StringsContain(mustsPatchFields, "SLADeadline") || dagIns.SLADeadline != 0 {
+		update["slaDeadline"] = dagIns.SLADeadline
+	}
+	if dagIns.SLAMissedAt != 0 {
+		update["slaMissedAt"] = dagIns.SLAMissedAt
+	}
+	if utils.StringsContain(mustsPatchFields, "DeadLetter") || dagIns.DeadLetter != nil {
+		update["deadLetter"] = dagIns.DeadLetter
+	}
 
 	update = bson.M{
 		"$set": update,
 	}
+	// the removed key must not exist, otherwise it is still checked by the unique index
+	if dagIns.IdempotencyKey != "" {
+		update["$set"].(bson.M)["idempotencyKey"] = dagIns.IdempotencyKey
+	} else if utils.StringsContain(mustsPatchFields, "IdempotencyKey") {
+		update["$unset"] = bson.M{"idempotencyKey": ""}
+	}
 
-	ctx, cancel := context.WithTimeout(context.TODO(), s.opt.Timeout)
+	ctx, cancel := context.WithTimeout(s.baseCtx(), s.opt.Timeout)
 	defer cancel()
-	if _, err := s.mongoDb.Collection(s.dagInsClsName).UpdateOne(ctx, bson.M{"_id": dagIns.ID}, update); err != nil {
-		return fmt.Errorf("patch dag instance failed: %w", err)
+	if _, err := s.db().Collection(s.dagInsClsName).UpdateOne(ctx, bson.M{"_id": dagIns.ID}, update); err != nil {
+		return fmt.Errorf("patch dag instance failed: %w", markTransient(err))
 	}
 
 	goevent.Publish(&event.DagInstancePatched{
@@ -296,7 +581,7 @@ func (s *Store) UpdateDag(dag *entity.Dag) error {
 		return s.genericUpdate(dag, s.dagClsName)
 	} else {
 		dag.UpdatedAt = time.Now().Unix()
-		return s.uploadToBucket(dag, s.dagBucket, nil)
+		return s.uploadToBucket(dag, s.bucket(), nil)
 	}
 }
 
@@ -320,11 +605,11 @@ func (s *Store) genericUpdate(input entity.BaseInfoGetter, clsName string) error
 	baseInfo := input.GetBaseInfo()
 	baseInfo.Update()
 
-	ctx, cancel := context.WithTimeout(context.TODO(), s.opt.Timeout)
+	ctx, cancel := context.WithTimeout(s.baseCtx(), s.opt.Timeout)
 	defer cancel()
-	ret, err := s.mongoDb.Collection(clsName).ReplaceOne(ctx, bson.M{"_id": baseInfo.ID}, input)
+	ret, err := s.db().Collection(clsName).ReplaceOne(ctx, bson.M{"_id": baseInfo.ID}, input)
 	if err != nil {
-		return fmt.Errorf("update dag instance failed: %w", err)
+		return fmt.Errorf("update dag instance failed: %w", markTransient(err))
 	}
 	if ret.MatchedCount == 0 {
 		return fmt.Errorf("%s has no key[ %s ] to update: %w", clsName, baseInfo.ID, data.ErrDataNotFound)
@@ -334,7 +619,7 @@ func (s *Store) genericUpdate(input entity.BaseInfoGetter, clsName string) error
 
 // BatchUpdateDagIns
 func (s *Store) BatchUpdateDagIns(dagIns []*entity.DagInstance) error {
-	ctx, cancel := context.WithTimeout(context.TODO(), s.opt.Timeout)
+	ctx, cancel := context.WithTimeout(s.baseCtx(), s.opt.Timeout)
 	defer cancel()
 
 	errChan := make(chan error)
@@ -352,7 +637,7 @@ func (s *Store) BatchUpdateDagIns(dagIns []*entity.DagInstance) error {
 		wg.Add(1)
 		go func(dagIns *entity.DagInstance, ch chan error) {
 			dagIns.Update()
-			if _, err := s.mongoDb.Collection(s.dagInsClsName).ReplaceOne(
+			if _, err := s.db().Collection(s.dagInsClsName).ReplaceOne(
 				ctx,
 				bson.M{"_id": dagIns.ID}, dagIns); err != nil {
 				errChan <- fmt.Errorf("batch update dag instance failed: %w", err)
@@ -367,14 +652,14 @@ func (s *Store) BatchUpdateDagIns(dagIns []*entity.DagInstance) error {
 
 // BatchUpdateTaskIns
 func (s *Store) BatchUpdateTaskIns(taskIns []*entity.TaskInstance) error {
-	ctx, cancel := context.WithTimeout(context.TODO(), s.opt.Timeout)
+	ctx, cancel := context.WithTimeout(s.baseCtx(), s.opt.Timeout)
 	defer cancel()
 	for i := range taskIns {
 		taskIns[i].Update()
-		if _, err := s.mongoDb.Collection(s.taskInsClsName).ReplaceOne(
+		if _, err := s.db().Collection(s.taskInsClsName).ReplaceOne(
 			ctx,
 			bson.M{"_id": taskIns[i].ID}, taskIns[i]); err != nil {
-			return fmt.Errorf("batch update task instance failed: %w", err)
+			return fmt.Errorf("batch update task instance failed: %w", markTransient(err))
 		}
 	}
 	return nil
@@ -403,7 +688,7 @@ func (s *Store) GetDag(dagId string) (*entity.Dag, error) {
 			return nil, err
 		}
 		fileBuffer := bytes.NewBuffer(nil)
-		_, err = s.dagBucket.DownloadToStream(id, fileBuffer)
+		_, err = s.bucket().DownloadToStream(id, fileBuffer)
 		if err != nil {
 			return nil, err
 		}
@@ -427,23 +712,26 @@ func (s *Store) GetDagInstance(dagInsId string) (*entity.DagInstance, error) {
 }
 
 func (s *Store) genericGet(clsName, id string, ret interface{}) error {
-	ctx, cancel := context.WithTimeout(context.TODO(), s.opt.Timeout)
+	ctx, cancel := context.WithTimeout(s.baseCtx(), s.opt.Timeout)
 	defer cancel()
 
-	if err := s.mongoDb.Collection(clsName).FindOne(ctx, bson.M{"_id": id}).Decode(ret); err != nil {
+	if err := s.db().Collection(clsName).FindOne(ctx, bson.M{"_id": id}).Decode(ret); err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
 			return fmt.Errorf("%s key[ %s ] not found: %w", clsName, id, data.ErrDataNotFound)
 		}
-		return fmt.Errorf("get dag instance failed: %w", err)
+		return fmt.Errorf("get dag instance failed: %w", markTransient(err))
 	}
 
 	return nil
 }
 
 // ListDag
-// only for test, not need for grid fs
+// grid fs is not supported
 func (s *Store) ListDag(input *mod.ListDagInput) ([]*entity.Dag, error) {
 	query := bson.M{}
+	if input != nil && input.IDPrefix != "" {
+		query["_id"] = bson.M{"$regex": "^" + regexp.QuoteMeta(input.IDPrefix)}
+	}
 
 	var ret []*entity.Dag
 	err := s.genericList(&ret, s.dagClsName, query)
@@ -466,20 +754,76 @@ func (s *Store) ListDagInstance(input *mod.ListDagInstanceInput) ([]*entity.DagI
 	if input.Worker != "" {
 		query["worker"] = input.Worker
 	}
+	if input.DagID != "" {
+		query["dagId"] = input.DagID
+	}
 	if input.UpdatedEnd > 0 {
 		query["updatedAt"] = bson.M{
 			"$lte": input.UpdatedEnd,
 		}
 	}
+	if input.DeadlineEnd > 0 {
+		query["deadline"] = bson.M{
+			"$gt":  0,
+			"$lte": input.DeadlineEnd,
+		}
+	}
+	if input.SLADeadlineEnd > 0 {
+		query["slaDeadline"] = bson.M{
+			"$gt":  0,
+			"$lte": input.SLADeadlineEnd,
+		}
+	}
+	if input.SLAMissed {
+		query["slaMissedAt"] = bson.M{
+			"$gt": 0,
+		}
+	}
+	if input.CreatedBegin > 0 || input.CreatedEnd > 0 {
+		created := bson.M{}
+		if input.CreatedBegin > 0 {
+			created["$gte"] = input.CreatedBegin
+		}
+		if input.CreatedEnd > 0 {
+			created["$lte"] = input.CreatedEnd
+		}
+		query["createdAt"] = created
+	}
 	if input.HasCmd {
 		query["cmd"] = bson.M{
 			"$ne": nil,
 		}
 	}
+	if input.DeadLetter {
+		query["deadLetter"] = bson.M{
+			"$ne": nil,
+		}
+	}
+	if input.Trigger != "" {
+		query["trigger"] = input.Trigger
+	}
+	if input.TriggerSource != "" {
+		query["triggerMeta.source"] = input.TriggerSource
+	}
+	if input.RootDagInsID != "" {
+		query["rootDagInsId"] = input.RootDagInsID
+	}
+	if input.IdempotencyKey != "" {
+		query["idempotencyKey"] = input.IdempotencyKey
+	}
+	for k, v := range input.Labels {
+		query["labels."+k] = v
+	}
 	opt := &options.FindOptions{}
 	if input.Limit > 0 {
 		opt.Limit = &input.Limit
 	}
+	if input.Offset > 0 {
+		opt.Skip = &input.Offset
+	}
+	if input.SortByPriority {
+		opt.SetSort(bson.D{{Key: "priority", Value: -1}, {Key: "createdAt", Value: 1}})
+	}
 
 	err := s.genericList(&ret, s.dagInsClsName, query, opt)
 	if err != nil {
@@ -522,6 +866,11 @@ func (s *Store) ListTaskInstance(input *mod.ListTaskInstanceInput) ([]*entity.Ta
 	if input.TaskID != "" {
 		query["taskId"] = input.TaskID
 	}
+	if input.HasArtifact {
+		query["artifacts.0"] = bson.M{
+			"$exists": true,
+		}
+	}
 	opt := &options.FindOptions{}
 	if len(input.SelectField) > 0 {
 		fields := bson.M{}
@@ -530,6 +879,23 @@ func (s *Store) ListTaskInstance(input *mod.ListTaskInstanceInput) ([]*entity.Ta
 		}
 		opt.Projection = fields
 	}
+	if input.Paged() {
+		if input.AfterID != "" {
+			idQuery, ok := query["_id"].(bson.M)
+			if !ok {
+				idQuery = bson.M{}
+			}
+			idQuery["$gt"] = input.AfterID
+			query["_id"] = idQuery
+		}
+		opt.Sort = bson.D{{Key: "_id", Value: 1}}
+		if input.Limit > 0 {
+			opt.Limit = &input.Limit
+		}
+		if input.Offset > 0 {
+			opt.Skip = &input.Offset
+		}
+	}
 
 	var ret []*entity.TaskInstance
 	err := s.genericList(&ret, s.taskInsClsName, query, opt)
@@ -540,21 +906,20 @@ func (s *Store) ListTaskInstance(input *mod.ListTaskInstanceInput) ([]*entity.Ta
 }
 
 func (s *Store) genericList(ret interface{}, clsName string, query bson.M, opts ...*options.FindOptions) error {
-	ctx, cancel := context.WithTimeout(context.TODO(), s.opt.Timeout)
+	ctx, cancel := context.WithTimeout(s.baseCtx(), s.opt.Timeout)
 	defer cancel()
 
-	cur, err := s.mongoDb.Collection(clsName).Find(ctx, query, opts...)
+	cur, err := s.db().Collection(clsName).Find(ctx, query, opts...)
 	if err != nil {
-		return fmt.Errorf("find %s failed: %w", clsName, err)
+		return fmt.Errorf("find %s failed: %w", clsName, markTransient(err))
 	}
 	if err := cur.All(ctx, ret); err != nil {
-		return fmt.Errorf("decode failed: %w", err)
+		return fmt.Errorf("decode failed: %w", markTransient(err))
 	}
 	return nil
 }
 
 // BatchDeleteDag
-// only for test
 func (s *Store) BatchDeleteDag(ids []string) error {
 	return s.genericBatchDelete(ids, s.dagClsName)
 }
@@ -572,21 +937,294 @@ func (s *Store) BatchDeleteTaskIns(ids []string) error {
 }
 
 func (s *Store) genericBatchDelete(ids []string, clsName string) error {
-	ctx, cancel := context.WithTimeout(context.TODO(), s.opt.Timeout)
+	ctx, cancel := context.WithTimeout(s.baseCtx(), s.opt.Timeout)
 	defer cancel()
 
-	_, err := s.mongoDb.Collection(clsName).DeleteMany(ctx, bson.M{
+	_, err := s.db().Collection(clsName).DeleteMany(ctx, bson.M{
 		"_id": bson.M{
 			"$in": ids,
 		},
 	})
 	if err != nil {
-		return fmt.Errorf("delete failed: %w", err)
+		return fmt.Errorf("delete failed: %w", markTransient(err))
+	}
+
+	return nil
+}
+
+// ClaimTaskIns
+func (s *Store) ClaimTaskIns(taskInsID, worker string, ttl time.Duration) (bool, error) {
+	ctx, cancel := context.WithTimeout(s.baseCtx(), s.opt.Timeout)
+	defer cancel()
+
+	now := time.Now()
+	ret, err := s.db().Collection(s.taskInsClsName).UpdateOne(ctx,
+		bson.M{
+			"_id":    taskInsID,
+			"status": bson.M{"$in": mod.ClaimableTaskInsStatus},
+			"$or": bson.A{
+				bson.M{"worker": worker},
+				// it also matches the task instances which are never claimed
+				bson.M{"claimExpiresAt": bson.M{"$not": bson.M{"$gt": now.Unix()}}},
+			},
+		},
+		bson.M{
+			"$set": bson.M{
+				"worker":         worker,
+				"claimExpiresAt": now.Add(ttl).Unix(),
+				"updatedAt":      now.Unix(),
+			},
+		})
+	if err != nil {
+		return false, fmt.Errorf("claim task instance failed: %w", markTransient(err))
+	}
+	return ret.MatchedCount > 0, nil
+}
+
+// SwapRetryCount
+func (s *Store) SwapRetryCount(dagInsID string, oldCount, newCount int) (bool, error) {
+	ctx, cancel := context.WithTimeout(s.baseCtx(), s.opt.Timeout)
+	defer cancel()
+
+	filter := bson.M{"_id": dagInsID, "retryCount": oldCount}
+	if oldCount == 0 {
+		// retryCount is omitted when it is zero
+		filter["retryCount"] = bson.M{"$in": bson.A{0, nil}}
+	}
+	ret, err := s.db().Collection(s.dagInsClsName).UpdateOne(ctx, filter,
+		bson.M{
+			"$set": bson.M{
+				"retryCount": newCount,
+				"updatedAt":  time.Now().Unix(),
+			},
+		})
+	if err != nil {
+		return false, fmt.Errorf("swap retry count failed: %w", markTransient(err))
+	}
+	return ret.MatchedCount > 0, nil
+}
+
+// AcquireLease
+func (s *Store) AcquireLease(key, holder string, ttl time.Duration) (bool, error) {
+	ctx, cancel := context.WithTimeout(s.baseCtx(), s.opt.Timeout)
+	defer cancel()
+
+	now := time.Now()
+	_, err := s.db().Collection(s.leaseClsName).UpdateOne(ctx,
+		bson.M{
+			"_id": key,
+			"$or": bson.A{
+				bson.M{"holder": holder},
+				bson.M{"expiredAt": bson.M{"$lte": now}},
+			},
+		},
+		bson.M{
+			"$set": bson.M{
+				"holder":    holder,
+				"expiredAt": now.Add(ttl),
+			},
+		},
+		options.Update().SetUpsert(true))
+	if err != nil {
+		// the lease is held by others, so the filter does not match and upsert conflicts with it
+		if mongo.IsDuplicateKeyError(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("acquire lease failed: %w", markTransient(err))
+	}
+	return true, nil
+}
+
+// ReleaseLease
+func (s *Store) ReleaseLease(key, holder string) (bool, error) {
+	ctx, cancel := context.WithTimeout(s.baseCtx(), s.opt.Timeout)
+	defer cancel()
+
+	ret, err := s.db().Collection(s.leaseClsName).DeleteOne(ctx, bson.M{
+		"_id":       key,
+		"holder":    holder,
+		"expiredAt": bson.M{"$gt": time.Now()},
+	})
+	if err != nil {
+		return false, fmt.Errorf("release lease failed: %w", markTransient(err))
+	}
+	return ret.DeletedCount > 0, nil
+}
+
+// ListLease
+func (s *Store) ListLease(prefix string) ([]*mod.Lease, error) {
+	query := bson.M{
+		"expiredAt": bson.M{"$gt": time.Now()},
+	}
+	if prefix != "" {
+		query["_id"] = bson.M{"$regex": "^" + regexp.QuoteMeta(prefix)}
+	}
+
+	var ret []*mod.Lease
+	if err := s.genericList(&ret, s.leaseClsName, query, options.Find().SetSort(bson.M{"_id": 1})); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// clusterConfigID is the id of the only document of cluster config collection
+const clusterConfigID = "cluster"
+
+// GetClusterConfig
+func (s *Store) GetClusterConfig() (*entity.ClusterConfig, error) {
+	ctx, cancel := context.WithTimeout(s.baseCtx(), s.opt.Timeout)
+	defer cancel()
+
+	cfg := &entity.ClusterConfig{}
+	err := s.db().Collection(s.configClsName).FindOne(ctx, bson.M{"_id": clusterConfigID}).Decode(cfg)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, fmt.Errorf("cluster config not found: %w", data.ErrDataNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get cluster config failed: %w", markTransient(err))
 	}
+	return cfg, nil
+}
+
+// SaveClusterConfig
+func (s *Store) SaveClusterConfig(cfg *entity.ClusterConfig) error {
+	ctx, cancel := context.WithTimeout(s.baseCtx(), s.opt.Timeout)
+	defer cancel()
 
+	// replace the whole document, so the omitted fields are reset to zero
+	_, err := s.db().Collection(s.configClsName).ReplaceOne(ctx, bson.M{"_id": clusterConfigID}, cfg,
+		options.Replace().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("save cluster config failed: %w", markTransient(err))
+	}
 	return nil
 }
 
+// workerInfoRetention is how long the info of a worker is kept after its last report
+const workerInfoRetention = 24 * time.Hour
+
+type workerInfoDoc struct {
+	entity.WorkerInfo `bson:",inline"`
+	ExpiredAt         time.Time `bson:"expiredAt"`
+}
+
+// SaveWorkerInfo
+func (s *Store) SaveWorkerInfo(info *entity.WorkerInfo) error {
+	ctx, cancel := context.WithTimeout(s.baseCtx(), s.opt.Timeout)
+	defer cancel()
+
+	doc := &workerInfoDoc{WorkerInfo: *info, ExpiredAt: time.Now().Add(workerInfoRetention)}
+	_, err := s.db().Collection(s.workerClsName).ReplaceOne(ctx, bson.M{"_id": info.Key}, doc,
+		options.Replace().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("save worker info failed: %w", markTransient(err))
+	}
+	return nil
+}
+
+// ListWorkerInfo
+func (s *Store) ListWorkerInfo() ([]*entity.WorkerInfo, error) {
+	var ret []*entity.WorkerInfo
+	if err := s.genericList(&ret, s.workerClsName, bson.M{}, options.Find().SetSort(bson.M{"_id": 1})); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+type rateLimitDoc struct {
+	ID        string    `bson:"_id"`
+	Count     int       `bson:"count"`
+	ExpiredAt time.Time `bson:"expiredAt"`
+}
+
+// IncrRateLimitCounter
+func (s *Store) IncrRateLimitCounter(key string, windowStart time.Time, window time.Duration) (int, error) {
+	ctx, cancel := context.WithTimeout(s.baseCtx(), s.opt.Timeout)
+	defer cancel()
+
+	doc := &rateLimitDoc{}
+	err := s.db().Collection(s.rateLimitClsName).FindOneAndUpdate(ctx,
+		bson.M{"_id": fmt.Sprintf("%s@%d", key, windowStart.UnixNano())},
+		bson.M{
+			"$inc":         bson.M{"count": 1},
+			"$setOnInsert": bson.M{"expiredAt": windowStart.Add(window)},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(doc)
+	if err != nil {
+		return 0, fmt.Errorf("increase rate limit counter failed: %w", markTransient(err))
+	}
+	return doc.Count, nil
+}
+
+type taskLogDoc struct {
+	TaskInsID      string `bson:"taskInsId"`
+	entity.TaskLog `bson:",inline"`
+}
+
+// AppendTaskLogs
+func (s *Store) AppendTaskLogs(taskInsID string, logs []*entity.TaskLog, maxLines int) error {
+	if len(logs) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(s.baseCtx(), s.opt.Timeout)
+	defer cancel()
+
+	docs := make([]interface{}, 0, len(logs))
+	for _, l := range logs {
+		docs = append(docs, &taskLogDoc{TaskInsID: taskInsID, TaskLog: *l})
+	}
+	cls := s.db().Collection(s.taskLogClsName)
+	if _, err := cls.InsertMany(ctx, docs); err != nil {
+		return fmt.Errorf("insert task logs failed: %w", markTransient(err))
+	}
+	if maxLines <= 0 {
+		return nil
+	}
+
+	// rotate out the logs older than the latest maxLines ones
+	oldest := &taskLogDoc{}
+	err := cls.FindOne(ctx, bson.M{"taskInsId": taskInsID},
+		options.FindOne().SetSort(bson.M{"seq": -1}).SetSkip(int64(maxLines))).Decode(oldest)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("find rotated task logs failed: %w", markTransient(err))
+	}
+	if _, err := cls.DeleteMany(ctx, bson.M{"taskInsId": taskInsID, "seq": bson.M{"$lte": oldest.Seq}}); err != nil {
+		return fmt.Errorf("delete rotated task logs failed: %w", markTransient(err))
+	}
+	return nil
+}
+
+// GetTaskLogs
+func (s *Store) GetTaskLogs(taskInsID string, cursor int64, limit int) ([]*entity.TaskLog, error) {
+	opt := options.Find().SetSort(bson.M{"seq": 1})
+	if limit > 0 {
+		opt.SetLimit(int64(limit))
+	}
+	var docs []*taskLogDoc
+	if err := s.genericList(&docs, s.taskLogClsName,
+		bson.M{"taskInsId": taskInsID, "seq": bson.M{"$gt": cursor}}, opt); err != nil {
+		return nil, err
+	}
+	ret := make([]*entity.TaskLog, 0, len(docs))
+	for _, d := range docs {
+		l := d.TaskLog
+		ret = append(ret, &l)
+	}
+	return ret, nil
+}
+
+// markTransient mark network errors and timeout as transient, so callers can retry them
+func markTransient(err error) error {
+	if mongo.IsNetworkError(err) || mongo.IsTimeout(err) {
+		return data.Transient(err)
+	}
+	return err
+}
+
 // Marshal
 func (s *Store) Marshal(obj interface{}) ([]byte, error) {
 	return bson.Marshal(obj)
@@ -10,6 +10,7 @@ import (
 
 	"github.com/etherealiy/fastflow/pkg/entity"
 	"github.com/etherealiy/fastflow/pkg/mod"
+	"github.com/etherealiy/fastflow/store/storetest"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -204,3 +205,11 @@ func TestStore_TaskIns(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, 0, len(ret))
 }
+
+func TestStore_Conformance(t *testing.T) {
+	s := NewStore(&StoreOption{
+		ConnStr: mongoConn,
+	})
+	assert.NoError(t, s.Init())
+	storetest.RunConformance(t, s)
+}
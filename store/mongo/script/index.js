@@ -23,6 +23,16 @@ db.dag_instance.createIndex(
         name: "updated_at_index",
     }
 );
+db.dag_instance.createIndex(
+    {
+        "status": 1,
+        "priority": -1,
+        "createdAt": 1
+    },
+    {
+        name: "status_priority_index",
+    }
+);
 
 // "task_instance" should replace with your collection name
 db.task_instance.createIndex(
@@ -0,0 +1,897 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/event"
+	"github.com/etherealiy/fastflow/pkg/log"
+	"github.com/etherealiy/fastflow/pkg/mod"
+	"github.com/etherealiy/fastflow/pkg/utils/data"
+	"github.com/etherealiy/fastflow/store"
+	"github.com/shiningrush/goevent"
+)
+
+var (
+	_ mod.Store         = (*Store)(nil)
+	_ mod.DagPruneStore = (*Store)(nil)
+	_ mod.LeaseStore    = (*Store)(nil)
+
+	_ mod.ClusterConfigStore = (*Store)(nil)
+	_ mod.WorkerInfoStore    = (*Store)(nil)
+	_ mod.RateLimitStore     = (*Store)(nil)
+	_ mod.TaskLogStore       = (*Store)(nil)
+)
+
+var prefixRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// maxPatchRetry is the times to retry when the document is changed by others during patching
+const maxPatchRetry = 10
+
+// StoreOption
+type StoreOption struct {
+	// DSN the data source name passed to the driver, such as "user:pwd@tcp(127.0.0.1:3306)/fastflow"
+	DSN string
+	// DriverName default "mysql", the driver should be registered by importing it, such as "github.com/go-sql-driver/mysql",
+	// the store checks affected rows to detect conflicts, so the driver should not return found rows as affected rows
+	DriverName string
+	// Timeout access mysql timeout.default 5s
+	Timeout time.Duration
+	// the prefix will append to the tables, it can only contain letters, digits and underscores
+	Prefix string
+}
+
+// Store is a mysql implement of mod.Store, documents are kept as JSON and each row has a version,
+// writes are compared with the version which is read, so they will not overwrite the changes of others
+type Store struct {
+	opt    *StoreOption
+	tables *tables
+	db     *sql.DB
+}
+
+// NewStore
+func NewStore(option *StoreOption) *Store {
+	return &Store{
+		opt: option,
+	}
+}
+
+// Init store, it applies the migrations which have not been applied
+func (s *Store) Init() error {
+	if err := s.readOpt(); err != nil {
+		return err
+	}
+	store.InitFlakeGenerator()
+
+	db, err := sql.Open(s.opt.DriverName, s.opt.DSN)
+	if err != nil {
+		return fmt.Errorf("open db failed: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.opt.Timeout)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		_ = db.Close()
+		return fmt.Errorf("ping db failed: %w", err)
+	}
+	if err := migrate(ctx, db, s.tables); err != nil {
+		_ = db.Close()
+		return err
+	}
+	s.db = db
+	return nil
+}
+
+func (s *Store) readOpt() error {
+	if s.opt.DSN == "" {
+		return fmt.Errorf("dsn cannot be empty")
+	}
+	if s.opt.Prefix != "" && !prefixRegexp.MatchString(s.opt.Prefix) {
+		return fmt.Errorf("prefix[ %s ] is invalid, it can only contain letters, digits and underscores", s.opt.Prefix)
+	}
+	if s.opt.DriverName == "" {
+		s.opt.DriverName = "mysql"
+	}
+	if s.opt.Timeout == 0 {
+		s.opt.Timeout = 5 * time.Second
+	}
+	s.tables = newTables(s.opt.Prefix)
+	return nil
+}
+
+// Close component when we not use it anymore
+func (s *Store) Close() {
+	if err := s.db.Close(); err != nil {
+		log.Errorf("close store db failed: %s", err)
+	}
+}
+
+// CreateDag
+func (s *Store) CreateDag(dag *entity.Dag) error {
+	// check task's connection
+	_, err := mod.BuildRootNode(mod.MapTasksToGetter(dag.Tasks))
+	if err != nil {
+		return err
+	}
+	return s.genericCreate(dag, s.tables.dag)
+}
+
+// CreateDagIns
+func (s *Store) CreateDagIns(dagIns *entity.DagInstance) error {
+	// revision is the version of row, it starts from zero
+	dagIns.Revision = 0
+	err := s.genericCreate(dagIns, s.tables.dagIns)
+	if !errors.Is(err, data.ErrDataConflicted) || dagIns.IdempotencyKey == "" {
+		return err
+	}
+
+	// the insert ignores the violation of any unique index, so find out which one it is
+	ctx, cancel := context.WithTimeout(context.TODO(), s.opt.Timeout)
+	defer cancel()
+	var id string
+	err = s.db.QueryRowContext(ctx,
+		fmt.Sprintf(`SELECT id FROM %s WHERE dag_id = ? AND idempotency_key = ?`, s.tables.dagIns),
+		dagIns.DagID, dagIns.IdempotencyKey).Scan(&id)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("query idempotency key failed: %w", markTransient(err))
+	}
+	if err == nil && id != dagIns.ID {
+		return fmt.Errorf("dag instance of dag[ %s ] with idempotency key[ %s ] already existed: %w",
+			dagIns.DagID, dagIns.IdempotencyKey, data.ErrIdempotencyKeyConflicted)
+	}
+	return fmt.Errorf("%s key[ %s ] already existed: %w", s.tables.dagIns, dagIns.ID, data.ErrDataConflicted)
+}
+
+// BatchCreatTaskIns
+func (s *Store) BatchCreatTaskIns(taskIns []*entity.TaskInstance) error {
+	for i := range taskIns {
+		if err := s.genericCreate(taskIns[i], s.tables.taskIns); err != nil {
+			return fmt.Errorf("insert task instance failed: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *Store) genericCreate(input entity.BaseInfoGetter, table string) error {
+	baseInfo := input.GetBaseInfo()
+	baseInfo.Initial()
+	bs, err := json.Marshal(input)
+	if err != nil {
+		return fmt.Errorf("marshal %s failed: %w", table, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.TODO(), s.opt.Timeout)
+	defer cancel()
+	// the existed row is not changed, so no row is affected
+	ret, err := s.db.ExecContext(ctx,
+		fmt.Sprintf(`INSERT INTO %s (id, doc) VALUES (?, ?) ON DUPLICATE KEY UPDATE id = id`, table),
+		baseInfo.ID, string(bs))
+	if err != nil {
+		return fmt.Errorf("insert %s failed: %w", table, markTransient(err))
+	}
+	if n, err := ret.RowsAffected(); err != nil {
+		return fmt.Errorf("insert %s failed: %w", table, err)
+	} else if n == 0 {
+		return fmt.Errorf("%s key[ %s ] already existed: %w", table, baseInfo.ID, data.ErrDataConflicted)
+	}
+	return nil
+}
+
+// PatchTaskIns
+func (s *Store) PatchTaskIns(taskIns *entity.TaskInstance) error {
+	if taskIns.ID == "" {
+		return fmt.Errorf("id cannot be empty")
+	}
+	err := s.patch(s.tables.taskIns, taskIns.ID, func(bs []byte, _ int64) (interface{}, error) {
+		old := new(entity.TaskInstance)
+		if err := json.Unmarshal(bs, old); err != nil {
+			return nil, err
+		}
+		mod.ApplyTaskInsPatch(old, taskIns)
+		return old, nil
+	})
+	if err != nil {
+		return fmt.Errorf("patch task instance failed: %w", err)
+	}
+	return nil
+}
+
+// PatchDagIns
+func (s *Store) PatchDagIns(dagIns *entity.DagInstance, mustsPatchFields ...string) error {
+	err := s.patch(s.tables.dagIns, dagIns.ID, func(bs []byte, version int64) (interface{}, error) {
+		old := new(entity.DagInstance)
+		if err := json.Unmarshal(bs, old); err != nil {
+			return nil, err
+		}
+		mod.ApplyDagInsPatch(old, dagIns, mustsPatchFields...)
+		old.Revision = version
+		return old, nil
+	})
+	if err != nil {
+		return fmt.Errorf("patch dag instance failed: %w", err)
+	}
+
+	goevent.Publish(&event.DagInstancePatched{
+		Payload:         dagIns,
+		MustPatchFields: mustsPatchFields,
+	})
+	return nil
+}
+
+// patch read the document and its version, then write the modified document back if the version is unchanged,
+// it retries when the document is changed by others in the meantime
+func (s *Store) patch(table, id string, modify func(bs []byte, version int64) (interface{}, error)) error {
+	ctx, cancel := context.WithTimeout(context.TODO(), s.opt.Timeout)
+	defer cancel()
+
+	for i := 0; i < maxPatchRetry; i++ {
+		var (
+			bs      []byte
+			version int64
+		)
+		err := s.db.QueryRowContext(ctx, fmt.Sprintf(`SELECT doc, version FROM %s WHERE id = ?`, table), id).
+			Scan(&bs, &version)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%s key[ %s ] not found: %w", table, id, data.ErrDataNotFound)
+		}
+		if err != nil {
+			return markTransient(err)
+		}
+		doc, err := modify(bs, version+1)
+		if err != nil {
+			return fmt.Errorf("decode %s failed: %w", table, err)
+		}
+		nbs, err := json.Marshal(doc)
+		if err != nil {
+			return fmt.Errorf("marshal %s failed: %w", table, err)
+		}
+
+		ret, err := s.db.ExecContext(ctx,
+			fmt.Sprintf(`UPDATE %s SET doc = ?, version = ? WHERE id = ? AND version = ?`, table),
+			string(nbs), version+1, id, version)
+		if err != nil {
+			return markTransient(err)
+		}
+		if n, err := ret.RowsAffected(); err != nil {
+			return err
+		} else if n > 0 {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s key[ %s ] is changed by others too frequently: %w", table, id, data.ErrDataConflicted)
+}
+
+// UpdateDag
+func (s *Store) UpdateDag(dag *entity.Dag) error {
+	// check task's connection
+	_, err := mod.BuildRootNode(mod.MapTasksToGetter(dag.Tasks))
+	if err != nil {
+		return err
+	}
+	return s.genericUpdate(dag, s.tables.dag)
+}
+
+// UpdateDagIns replace the dag instance if its revision is not stale
+func (s *Store) UpdateDagIns(dagIns *entity.DagInstance) error {
+	ctx, cancel := context.WithTimeout(context.TODO(), s.opt.Timeout)
+	defer cancel()
+	if err := s.updateDagIns(ctx, s.db, dagIns); err != nil {
+		return err
+	}
+
+	goevent.Publish(&event.DagInstanceUpdated{Payload: dagIns})
+	return nil
+}
+
+// UpdateTaskIns
+func (s *Store) UpdateTaskIns(taskIns *entity.TaskInstance) error {
+	return s.genericUpdate(taskIns, s.tables.taskIns)
+}
+
+func (s *Store) genericUpdate(input entity.BaseInfoGetter, table string) error {
+	ctx, cancel := context.WithTimeout(context.TODO(), s.opt.Timeout)
+	defer cancel()
+	return s.replace(ctx, s.db, input, table)
+}
+
+// execer is implemented by both sql.DB and sql.Tx
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// replace the document without comparing version, the version is still increased,
+// so the patches which read it before will retry
+func (s *Store) replace(ctx context.Context, e execer, input entity.BaseInfoGetter, table string) error {
+	baseInfo := input.GetBaseInfo()
+	baseInfo.Update()
+	bs, err := json.Marshal(input)
+	if err != nil {
+		return fmt.Errorf("marshal %s failed: %w", table, err)
+	}
+
+	ret, err := e.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET doc = ?, version = version + 1 WHERE id = ?`, table),
+		string(bs), baseInfo.ID)
+	if err != nil {
+		return fmt.Errorf("update %s failed: %w", table, markTransient(err))
+	}
+	if n, err := ret.RowsAffected(); err != nil {
+		return fmt.Errorf("update %s failed: %w", table, err)
+	} else if n == 0 {
+		return fmt.Errorf("%s has no key[ %s ] to update: %w", table, baseInfo.ID, data.ErrDataNotFound)
+	}
+	return nil
+}
+
+// updateDagIns replace the dag instance when the revision matches the version, and increase the revision
+func (s *Store) updateDagIns(ctx context.Context, e execer, dagIns *entity.DagInstance) error {
+	dagIns.Update()
+	old := dagIns.Revision
+	dagIns.Revision++
+	bs, err := json.Marshal(dagIns)
+	if err != nil {
+		dagIns.Revision = old
+		return fmt.Errorf("marshal dag instance failed: %w", err)
+	}
+
+	ret, err := e.ExecContext(ctx,
+		fmt.Sprintf(`UPDATE %s SET doc = ?, version = ? WHERE id = ? AND version = ?`, s.tables.dagIns),
+		string(bs), dagIns.Revision, dagIns.ID, old)
+	if err != nil {
+		dagIns.Revision = old
+		return fmt.Errorf("update dag instance failed: %w", markTransient(err))
+	}
+	n, err := ret.RowsAffected()
+	if err != nil {
+		dagIns.Revision = old
+		return fmt.Errorf("update dag instance failed: %w", err)
+	}
+	if n > 0 {
+		return nil
+	}
+
+	dagIns.Revision = old
+	var current int64
+	err = e.QueryRowContext(ctx, fmt.Sprintf(`SELECT version FROM %s WHERE id = ?`, s.tables.dagIns), dagIns.ID).
+		Scan(&current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%s has no key[ %s ] to update: %w", s.tables.dagIns, dagIns.ID, data.ErrDataNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("get dag instance version failed: %w", markTransient(err))
+	}
+	return fmt.Errorf("dag instance[ %s ] revision %d is stale, current is %d: %w",
+		dagIns.ID, old, current, data.ErrDataConflicted)
+}
+
+// BatchUpdateDagIns update all dag instances in a transaction, nothing is updated if any of them is stale
+func (s *Store) BatchUpdateDagIns(dagIns []*entity.DagInstance) error {
+	ctx, cancel := context.WithTimeout(context.TODO(), s.opt.Timeout)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction failed: %w", markTransient(err))
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	olds := make([]int64, len(dagIns))
+	for i := range dagIns {
+		olds[i] = dagIns[i].Revision
+		if err := s.updateDagIns(ctx, tx, dagIns[i]); err != nil {
+			resetRevisions(dagIns[:i], olds)
+			return fmt.Errorf("batch update dag instance failed: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		resetRevisions(dagIns, olds)
+		return fmt.Errorf("batch update dag instance failed: %w", markTransient(err))
+	}
+	return nil
+}
+
+// resetRevisions restore the revisions when the transaction is rolled back
+func resetRevisions(dagIns []*entity.DagInstance, olds []int64) {
+	for i := range dagIns {
+		dagIns[i].Revision = olds[i]
+	}
+}
+
+// BatchUpdateTaskIns
+func (s *Store) BatchUpdateTaskIns(taskIns []*entity.TaskInstance) error {
+	ctx, cancel := context.WithTimeout(context.TODO(), s.opt.Timeout)
+	defer cancel()
+	for i := range taskIns {
+		if err := s.replace(ctx, s.db, taskIns[i], s.tables.taskIns); err != nil {
+			return fmt.Errorf("batch update task instance failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// GetTaskIns
+func (s *Store) GetTaskIns(taskInsId string) (*entity.TaskInstance, error) {
+	ret := new(entity.TaskInstance)
+	if err := s.genericGet(s.tables.taskIns, taskInsId, ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// GetDag
+func (s *Store) GetDag(dagId string) (*entity.Dag, error) {
+	ret := new(entity.Dag)
+	if err := s.genericGet(s.tables.dag, dagId, ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// GetDagInstance
+func (s *Store) GetDagInstance(dagInsId string) (*entity.DagInstance, error) {
+	ret := new(entity.DagInstance)
+	if err := s.genericGet(s.tables.dagIns, dagInsId, ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (s *Store) genericGet(table, id string, ret interface{}) error {
+	ctx, cancel := context.WithTimeout(context.TODO(), s.opt.Timeout)
+	defer cancel()
+
+	var bs []byte
+	err := s.db.QueryRowContext(ctx, fmt.Sprintf(`SELECT doc FROM %s WHERE id = ?`, table), id).Scan(&bs)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%s key[ %s ] not found: %w", table, id, data.ErrDataNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("get %s failed: %w", table, markTransient(err))
+	}
+	if err := json.Unmarshal(bs, ret); err != nil {
+		return fmt.Errorf("decode %s failed: %w", table, err)
+	}
+	return nil
+}
+
+// ListDag
+func (s *Store) ListDag(input *mod.ListDagInput) ([]*entity.Dag, error) {
+	query, args := buildListDagQuery(s.tables.dag, input)
+	var ret []*entity.Dag
+	err := s.genericList(query, args, func() interface{} {
+		ret = append(ret, new(entity.Dag))
+		return ret[len(ret)-1]
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// ListDagInstance
+func (s *Store) ListDagInstance(input *mod.ListDagInstanceInput) ([]*entity.DagInstance, error) {
+	query, args, err := buildListDagInsQuery(s.tables.dagIns, input)
+	if err != nil {
+		return nil, err
+	}
+	var ret []*entity.DagInstance
+	err = s.genericList(query, args, func() interface{} {
+		ret = append(ret, new(entity.DagInstance))
+		return ret[len(ret)-1]
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// ListTaskInstance
+func (s *Store) ListTaskInstance(input *mod.ListTaskInstanceInput) ([]*entity.TaskInstance, error) {
+	query, args := buildListTaskInsQuery(s.tables.taskIns, input)
+	var ret []*entity.TaskInstance
+	err := s.genericList(query, args, func() interface{} {
+		ret = append(ret, new(entity.TaskInstance))
+		return ret[len(ret)-1]
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// genericList decode each document into the value returned by next
+func (s *Store) genericList(query string, args []interface{}, next func() interface{}) error {
+	ctx, cancel := context.WithTimeout(context.TODO(), s.opt.Timeout)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("query failed: %w", markTransient(err))
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var bs []byte
+		if err := rows.Scan(&bs); err != nil {
+			return fmt.Errorf("scan failed: %w", markTransient(err))
+		}
+		if err := json.Unmarshal(bs, next()); err != nil {
+			return fmt.Errorf("decode failed: %w", err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("query failed: %w", markTransient(err))
+	}
+	return nil
+}
+
+// BatchDeleteDag
+func (s *Store) BatchDeleteDag(ids []string) error {
+	return s.genericBatchDelete(ids, s.tables.dag)
+}
+
+// BatchDeleteDagIns
+// only for test
+func (s *Store) BatchDeleteDagIns(ids []string) error {
+	return s.genericBatchDelete(ids, s.tables.dagIns)
+}
+
+// BatchDeleteTaskIns
+// only for test
+func (s *Store) BatchDeleteTaskIns(ids []string) error {
+	return s.genericBatchDelete(ids, s.tables.taskIns)
+}
+
+func (s *Store) genericBatchDelete(ids []string, table string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.TODO(), s.opt.Timeout)
+	defer cancel()
+
+	w := &where{}
+	w.in("id", ids)
+	if _, err := s.db.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s%s", table, w), w.args...); err != nil {
+		return fmt.Errorf("delete failed: %w", markTransient(err))
+	}
+	return nil
+}
+
+// errClaimLost is returned by the patch of claiming when the task instance is not claimable
+var errClaimLost = errors.New("task instance is not claimable")
+
+// ClaimTaskIns
+func (s *Store) ClaimTaskIns(taskInsID, worker string, ttl time.Duration) (bool, error) {
+	err := s.patch(s.tables.taskIns, taskInsID, func(bs []byte, _ int64) (interface{}, error) {
+		old := new(entity.TaskInstance)
+		if err := json.Unmarshal(bs, old); err != nil {
+			return nil, err
+		}
+		if !mod.ApplyTaskInsClaim(old, worker, ttl) {
+			return nil, errClaimLost
+		}
+		return old, nil
+	})
+	if errors.Is(err, errClaimLost) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("claim task instance failed: %w", err)
+	}
+	return true, nil
+}
+
+// errRetryCountChanged is returned by the patch of swapping when the retry count is changed by others
+var errRetryCountChanged = errors.New("retry count is changed")
+
+// SwapRetryCount
+func (s *Store) SwapRetryCount(dagInsID string, oldCount, newCount int) (bool, error) {
+	err := s.patch(s.tables.dagIns, dagInsID, func(bs []byte, version int64) (interface{}, error) {
+		old := new(entity.DagInstance)
+		if err := json.Unmarshal(bs, old); err != nil {
+			return nil, err
+		}
+		if !mod.ApplyRetryCountSwap(old, oldCount, newCount) {
+			return nil, errRetryCountChanged
+		}
+		old.Revision = version
+		return old, nil
+	})
+	if errors.Is(err, errRetryCountChanged) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("swap retry count failed: %w", err)
+	}
+	return true, nil
+}
+
+// AcquireLease
+func (s *Store) AcquireLease(key, holder string, ttl time.Duration) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.TODO(), s.opt.Timeout)
+	defer cancel()
+
+	now := time.Now()
+	// renew the lease of holder or take over the expired one
+	ret, err := s.db.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET holder = ?, expired_at = ?
+WHERE lease_key = ? AND (holder = ? OR expired_at <= ?)`, s.tables.lease),
+		holder, now.Add(ttl).UnixNano(), key, holder, now.UnixNano())
+	if err != nil {
+		return false, fmt.Errorf("acquire lease failed: %w", markTransient(err))
+	}
+	if n, err := ret.RowsAffected(); err != nil {
+		return false, fmt.Errorf("acquire lease failed: %w", err)
+	} else if n > 0 {
+		return true, nil
+	}
+
+	// the lease is free, or it is held by others so the existed row is not changed
+	ret, err = s.db.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (lease_key, holder, expired_at) VALUES (?, ?, ?)
+ON DUPLICATE KEY UPDATE lease_key = lease_key`, s.tables.lease),
+		key, holder, now.Add(ttl).UnixNano())
+	if err != nil {
+		return false, fmt.Errorf("acquire lease failed: %w", markTransient(err))
+	}
+	n, err := ret.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("acquire lease failed: %w", err)
+	}
+	return n > 0, nil
+}
+
+// ReleaseLease
+func (s *Store) ReleaseLease(key, holder string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.TODO(), s.opt.Timeout)
+	defer cancel()
+
+	ret, err := s.db.ExecContext(ctx,
+		fmt.Sprintf(`DELETE FROM %s WHERE lease_key = ? AND holder = ? AND expired_at > ?`, s.tables.lease),
+		key, holder, time.Now().UnixNano())
+	if err != nil {
+		return false, fmt.Errorf("release lease failed: %w", markTransient(err))
+	}
+	n, err := ret.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("release lease failed: %w", err)
+	}
+	return n > 0, nil
+}
+
+// ListLease
+func (s *Store) ListLease(prefix string) ([]*mod.Lease, error) {
+	ctx, cancel := context.WithTimeout(context.TODO(), s.opt.Timeout)
+	defer cancel()
+
+	w := &where{}
+	w.add("expired_at > ?", time.Now().UnixNano())
+	if prefix != "" {
+		w.add("lease_key LIKE ?", likePrefix(prefix))
+	}
+	rows, err := s.db.QueryContext(ctx,
+		fmt.Sprintf("SELECT lease_key, holder, expired_at FROM %s%s ORDER BY lease_key", s.tables.lease, w), w.args...)
+	if err != nil {
+		return nil, fmt.Errorf("list lease failed: %w", markTransient(err))
+	}
+	defer rows.Close()
+
+	var ret []*mod.Lease
+	for rows.Next() {
+		var (
+			l         = &mod.Lease{}
+			expiredAt int64
+		)
+		if err := rows.Scan(&l.Key, &l.Holder, &expiredAt); err != nil {
+			return nil, fmt.Errorf("scan lease failed: %w", markTransient(err))
+		}
+		l.ExpiredAt = time.Unix(0, expiredAt)
+		ret = append(ret, l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list lease failed: %w", markTransient(err))
+	}
+	return ret, nil
+}
+
+// clusterConfigID is the id of the only row of cluster config table
+const clusterConfigID = "cluster"
+
+// GetClusterConfig
+func (s *Store) GetClusterConfig() (*entity.ClusterConfig, error) {
+	cfg := &entity.ClusterConfig{}
+	err := s.genericGet(s.tables.config, clusterConfigID, cfg)
+	if errors.Is(err, data.ErrDataNotFound) {
+		return nil, fmt.Errorf("cluster config not found: %w", data.ErrDataNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// SaveClusterConfig
+func (s *Store) SaveClusterConfig(cfg *entity.ClusterConfig) error {
+	bs, err := json.Marshal(cfg)
+	if err != nil {
+		return fmt.Errorf("marshal cluster config failed: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.TODO(), s.opt.Timeout)
+	defer cancel()
+	// replace the whole document, so the omitted fields are reset to zero
+	if _, err := s.db.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (id, doc) VALUES (?, ?)
+ON DUPLICATE KEY UPDATE doc = VALUES(doc)`, s.tables.config), clusterConfigID, string(bs)); err != nil {
+		return fmt.Errorf("save cluster config failed: %w", markTransient(err))
+	}
+	return nil
+}
+
+// workerInfoRetention is how long the info of a worker is kept after its last report
+const workerInfoRetention = 24 * time.Hour
+
+// SaveWorkerInfo
+func (s *Store) SaveWorkerInfo(info *entity.WorkerInfo) error {
+	bs, err := json.Marshal(info)
+	if err != nil {
+		return fmt.Errorf("marshal worker info failed: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.TODO(), s.opt.Timeout)
+	defer cancel()
+	now := time.Now()
+	if _, err := s.db.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (worker_key, doc, expired_at) VALUES (?, ?, ?)
+ON DUPLICATE KEY UPDATE doc = VALUES(doc), expired_at = VALUES(expired_at)`, s.tables.worker),
+		info.Key, string(bs), now.Add(workerInfoRetention).UnixNano()); err != nil {
+		return fmt.Errorf("save worker info failed: %w", markTransient(err))
+	}
+	// clean up the info of workers which have not reported for a long time
+	if _, err := s.db.ExecContext(ctx,
+		fmt.Sprintf(`DELETE FROM %s WHERE expired_at <= ?`, s.tables.worker), now.UnixNano()); err != nil {
+		return fmt.Errorf("delete expired worker info failed: %w", markTransient(err))
+	}
+	return nil
+}
+
+// ListWorkerInfo
+func (s *Store) ListWorkerInfo() ([]*entity.WorkerInfo, error) {
+	var ret []*entity.WorkerInfo
+	err := s.genericList(fmt.Sprintf(`SELECT doc FROM %s ORDER BY worker_key`, s.tables.worker), nil, func() interface{} {
+		ret = append(ret, new(entity.WorkerInfo))
+		return ret[len(ret)-1]
+	})
+	if err != nil {
+		return nil, err
+	}
+	// alive is not persisted
+	for i := range ret {
+		ret[i].Alive = false
+	}
+	return ret, nil
+}
+
+// IncrRateLimitCounter
+func (s *Store) IncrRateLimitCounter(key string, windowStart time.Time, window time.Duration) (int, error) {
+	ctx, cancel := context.WithTimeout(context.TODO(), s.opt.Timeout)
+	defer cancel()
+
+	// clean up the counters of ended rate limit windows
+	if _, err := s.db.ExecContext(ctx,
+		fmt.Sprintf(`DELETE FROM %s WHERE expired_at < ?`, s.tables.rateLimit), time.Now().UnixNano()); err != nil {
+		return 0, fmt.Errorf("delete ended rate limit counters failed: %w", markTransient(err))
+	}
+
+	// the row is locked by upsert until commit, so the counter read in the transaction is what it increased
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("begin transaction failed: %w", markTransient(err))
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	id := fmt.Sprintf("%s@%d", key, windowStart.UnixNano())
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (id, counter, expired_at) VALUES (?, 1, ?)
+ON DUPLICATE KEY UPDATE counter = counter + 1`, s.tables.rateLimit),
+		id, windowStart.Add(window).UnixNano()); err != nil {
+		return 0, fmt.Errorf("increase rate limit counter failed: %w", markTransient(err))
+	}
+	var count int
+	if err := tx.QueryRowContext(ctx,
+		fmt.Sprintf(`SELECT counter FROM %s WHERE id = ?`, s.tables.rateLimit), id).Scan(&count); err != nil {
+		return 0, fmt.Errorf("get rate limit counter failed: %w", markTransient(err))
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("increase rate limit counter failed: %w", markTransient(err))
+	}
+	return count, nil
+}
+
+// AppendTaskLogs
+func (s *Store) AppendTaskLogs(taskInsID string, logs []*entity.TaskLog, maxLines int) error {
+	if len(logs) == 0 {
+		return nil
+	}
+	var (
+		values []string
+		args   []interface{}
+	)
+	for _, l := range logs {
+		bs, err := json.Marshal(l)
+		if err != nil {
+			return fmt.Errorf("marshal task log failed: %w", err)
+		}
+		values = append(values, "(?, ?, ?)")
+		args = append(args, taskInsID, l.Seq, string(bs))
+	}
+
+	ctx, cancel := context.WithTimeout(context.TODO(), s.opt.Timeout)
+	defer cancel()
+	// the logs may be appended again when the previous appending timed out
+	if _, err := s.db.ExecContext(ctx, fmt.Sprintf(`INSERT IGNORE INTO %s (task_ins_id, seq, doc) VALUES %s`,
+		s.tables.taskLog, strings.Join(values, ", ")), args...); err != nil {
+		return fmt.Errorf("insert task logs failed: %w", markTransient(err))
+	}
+	if maxLines <= 0 {
+		return nil
+	}
+
+	// rotate out the logs older than the latest maxLines ones, mysql cannot delete by the subquery of same table
+	var oldest int64
+	err := s.db.QueryRowContext(ctx, fmt.Sprintf(`SELECT seq FROM %s WHERE task_ins_id = ? ORDER BY seq DESC LIMIT 1 OFFSET ?`,
+		s.tables.taskLog), taskInsID, maxLines).Scan(&oldest)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("find rotated task logs failed: %w", markTransient(err))
+	}
+	if _, err := s.db.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE task_ins_id = ? AND seq <= ?`, s.tables.taskLog),
+		taskInsID, oldest); err != nil {
+		return fmt.Errorf("delete rotated task logs failed: %w", markTransient(err))
+	}
+	return nil
+}
+
+// GetTaskLogs
+func (s *Store) GetTaskLogs(taskInsID string, cursor int64, limit int) ([]*entity.TaskLog, error) {
+	query := fmt.Sprintf(`SELECT doc FROM %s WHERE task_ins_id = ? AND seq > ? ORDER BY seq`, s.tables.taskLog)
+	args := []interface{}{taskInsID, cursor}
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit)
+	}
+	ret := []*entity.TaskLog{}
+	err := s.genericList(query, args, func() interface{} {
+		ret = append(ret, new(entity.TaskLog))
+		return ret[len(ret)-1]
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// markTransient mark broken connections and timeout as transient, so callers can retry them
+func markTransient(err error) error {
+	var netErr net.Error
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) {
+		return data.Transient(err)
+	}
+	return err
+}
+
+// Marshal
+func (s *Store) Marshal(obj interface{}) ([]byte, error) {
+	return json.Marshal(obj)
+}
+
+// Unmarshal
+func (s *Store) Unmarshal(bytes []byte, ptr interface{}) error {
+	return json.Unmarshal(bytes, ptr)
+}
@@ -0,0 +1,89 @@
+//go:build integration
+// +build integration
+
+package mysql
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/utils/data"
+	"github.com/etherealiy/fastflow/store/storetest"
+	"github.com/stretchr/testify/assert"
+)
+
+var mysqlDSN = "root:pwd@tcp(127.0.0.1:3306)/fastflow"
+
+// newTestStore skip the test when no driver is registered, the driver can be registered
+// by a file which imports it with the integration tag
+func newTestStore(t *testing.T) *Store {
+	registered := false
+	for _, d := range sql.Drivers() {
+		if d == "mysql" {
+			registered = true
+		}
+	}
+	if !registered {
+		t.Skip("mysql driver is not registered")
+	}
+
+	s := NewStore(&StoreOption{
+		DSN:    mysqlDSN,
+		Prefix: "integ",
+	})
+	if err := s.Init(); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestConformance(t *testing.T) {
+	s := newTestStore(t)
+	defer s.Close()
+	storetest.RunConformance(t, s)
+}
+
+func TestStore_OptimisticLocking(t *testing.T) {
+	s := newTestStore(t)
+	defer s.Close()
+
+	id := fmt.Sprintf("lock-%d", time.Now().UnixNano())
+	assert.NoError(t, s.CreateDagIns(&entity.DagInstance{BaseInfo: entity.BaseInfo{ID: id}, Status: entity.DagInstanceStatusInit}))
+	defer s.BatchDeleteDagIns([]string{id})
+
+	first, err := s.GetDagInstance(id)
+	assert.NoError(t, err)
+	second, err := s.GetDagInstance(id)
+	assert.NoError(t, err)
+
+	first.Status = entity.DagInstanceStatusScheduled
+	assert.NoError(t, s.UpdateDagIns(first))
+	assert.Equal(t, int64(1), first.Revision)
+
+	second.Status = entity.DagInstanceStatusFailed
+	err = s.UpdateDagIns(second)
+	assert.True(t, errors.Is(err, data.ErrDataConflicted), "update stale dag instance should return ErrDataConflicted, got: %v", err)
+
+	// concurrent patches of different fields are all kept
+	wg := sync.WaitGroup{}
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			assert.NoError(t, s.PatchDagIns(&entity.DagInstance{
+				BaseInfo:    entity.BaseInfo{ID: id},
+				Annotations: map[string]string{"key": fmt.Sprint(i)},
+			}))
+		}(i)
+	}
+	wg.Wait()
+	ret, err := s.GetDagInstance(id)
+	assert.NoError(t, err)
+	assert.Equal(t, entity.DagInstanceStatusScheduled, ret.Status)
+	assert.Equal(t, int64(6), ret.Revision)
+}
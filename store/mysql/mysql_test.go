@@ -0,0 +1,137 @@
+package mysql
+
+import (
+	"math"
+	"testing"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/mod"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildListDagInsQuery(t *testing.T) {
+	tests := []struct {
+		caseDesc  string
+		giveInput *mod.ListDagInstanceInput
+		wantQuery string
+		wantArgs  []interface{}
+	}{
+		{
+			caseDesc:  "empty",
+			giveInput: &mod.ListDagInstanceInput{},
+			wantQuery: "SELECT doc FROM dag_instance ORDER BY seq",
+		},
+		{
+			caseDesc: "status and worker",
+			giveInput: &mod.ListDagInstanceInput{
+				Status: []entity.DagInstanceStatus{entity.DagInstanceStatusInit, entity.DagInstanceStatusScheduled},
+				Worker: "worker-1",
+			},
+			wantQuery: "SELECT doc FROM dag_instance WHERE status IN (?, ?) AND worker = ? ORDER BY seq",
+			wantArgs:  []interface{}{"init", "scheduled", "worker-1"},
+		},
+		{
+			caseDesc: "idempotency key",
+			giveInput: &mod.ListDagInstanceInput{
+				DagID:          "dag1",
+				IdempotencyKey: "key1",
+			},
+			wantQuery: "SELECT doc FROM dag_instance WHERE dag_id = ? AND idempotency_key = ? ORDER BY seq",
+			wantArgs:  []interface{}{"dag1", "key1"},
+		},
+		{
+			caseDesc: "labels",
+			giveInput: &mod.ListDagInstanceInput{
+				Labels: map[string]string{"team": "infra", "env": "prod"},
+			},
+			wantQuery: "SELECT doc FROM dag_instance WHERE JSON_CONTAINS(doc, ?, '$.labels') ORDER BY seq",
+			wantArgs:  []interface{}{`{"env":"prod","team":"infra"}`},
+		},
+		{
+			caseDesc: "sort by priority with paging",
+			giveInput: &mod.ListDagInstanceInput{
+				DagID:          "dag",
+				SortByPriority: true,
+				Limit:          10,
+				Offset:         20,
+			},
+			wantQuery: "SELECT doc FROM dag_instance WHERE dag_id = ? ORDER BY priority DESC, created_at, seq LIMIT ? OFFSET ?",
+			wantArgs:  []interface{}{"dag", int64(10), int64(20)},
+		},
+		{
+			caseDesc: "offset without limit",
+			giveInput: &mod.ListDagInstanceInput{
+				Offset: 20,
+			},
+			wantQuery: "SELECT doc FROM dag_instance ORDER BY seq LIMIT ? OFFSET ?",
+			wantArgs:  []interface{}{int64(math.MaxInt64), int64(20)},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			query, args, err := buildListDagInsQuery("dag_instance", tc.giveInput)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantQuery, query)
+			assert.Equal(t, tc.wantArgs, args)
+		})
+	}
+}
+
+func TestBuildListTaskInsQuery(t *testing.T) {
+	tests := []struct {
+		caseDesc  string
+		giveInput *mod.ListTaskInstanceInput
+		wantQuery string
+		wantArgs  []interface{}
+	}{
+		{
+			caseDesc: "dag instance and task",
+			giveInput: &mod.ListTaskInstanceInput{
+				DagInsID: "dagins",
+				TaskID:   "task",
+			},
+			wantQuery: "SELECT doc FROM task_instance WHERE dag_ins_id = ? AND task_id = ? ORDER BY seq",
+			wantArgs:  []interface{}{"dagins", "task"},
+		},
+		{
+			caseDesc: "ids, status and artifact",
+			giveInput: &mod.ListTaskInstanceInput{
+				IDs:         []string{"1", "2"},
+				Status:      []entity.TaskInstanceStatus{entity.TaskInstanceStatusRunning},
+				HasArtifact: true,
+			},
+			wantQuery: "SELECT doc FROM task_instance WHERE id IN (?, ?) AND status IN (?) " +
+				"AND JSON_EXTRACT(doc, '$.artifacts[0]') IS NOT NULL ORDER BY seq",
+			wantArgs: []interface{}{"1", "2", "running"},
+		},
+		{
+			caseDesc: "paged",
+			giveInput: &mod.ListTaskInstanceInput{
+				DagInsID: "dagins",
+				AfterID:  "100",
+				Offset:   5,
+			},
+			wantQuery: "SELECT doc FROM task_instance WHERE dag_ins_id = ? AND id > ? ORDER BY id LIMIT ? OFFSET ?",
+			wantArgs:  []interface{}{"dagins", "100", int64(math.MaxInt64), int64(5)},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			query, args := buildListTaskInsQuery("task_instance", tc.giveInput)
+			assert.Equal(t, tc.wantQuery, query)
+			assert.Equal(t, tc.wantArgs, args)
+		})
+	}
+}
+
+func TestMigrations(t *testing.T) {
+	tb := newTables("ff")
+	assert.Equal(t, "ff_task_instance", tb.taskIns)
+
+	for i, m := range migrations {
+		assert.Equal(t, i+1, m.version, "versions should be continuous")
+		assert.NotEmpty(t, m.stmts(tb))
+	}
+	assert.Len(t, pendingMigrations(0), len(migrations))
+	assert.Empty(t, pendingMigrations(len(migrations)))
+}
@@ -0,0 +1,174 @@
+package mysql
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/mod"
+)
+
+// where build the conditions with "?" placeholders
+type where struct {
+	conds []string
+	args  []interface{}
+}
+
+func (w *where) add(cond string, args ...interface{}) {
+	w.conds = append(w.conds, cond)
+	w.args = append(w.args, args...)
+}
+
+// in add the condition that expression is one of values
+func (w *where) in(expr string, values []string) {
+	marks := make([]string, len(values))
+	for i := range values {
+		marks[i] = "?"
+		w.args = append(w.args, values[i])
+	}
+	w.conds = append(w.conds, fmt.Sprintf("%s IN (%s)", expr, strings.Join(marks, ", ")))
+}
+
+// limit return the LIMIT clause and add its arguments, mysql does not support offset without limit,
+// so the max value is used as limit
+func (w *where) limit(limit, offset int64) string {
+	if limit <= 0 && offset <= 0 {
+		return ""
+	}
+	if limit <= 0 {
+		limit = math.MaxInt64
+	}
+	w.args = append(w.args, limit, offset)
+	return " LIMIT ? OFFSET ?"
+}
+
+func (w *where) String() string {
+	if len(w.conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(w.conds, " AND ")
+}
+
+// likePrefix escape the wildcards of LIKE, so the prefix is matched literally
+func likePrefix(prefix string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return r.Replace(prefix) + "%"
+}
+
+func buildListDagQuery(table string, input *mod.ListDagInput) (string, []interface{}) {
+	w := &where{}
+	if input != nil && input.IDPrefix != "" {
+		w.add(`id LIKE ?`, likePrefix(input.IDPrefix))
+	}
+	return fmt.Sprintf("SELECT doc FROM %s%s ORDER BY seq", table, w), w.args
+}
+
+func buildListDagInsQuery(table string, input *mod.ListDagInstanceInput) (string, []interface{}, error) {
+	w := &where{}
+	if len(input.Status) > 0 {
+		status := make([]string, len(input.Status))
+		for i := range input.Status {
+			status[i] = string(input.Status[i])
+		}
+		w.in(`status`, status)
+	}
+	if input.Worker != "" {
+		w.add(`worker = ?`, input.Worker)
+	}
+	if input.DagID != "" {
+		w.add(`dag_id = ?`, input.DagID)
+	}
+	if input.UpdatedEnd > 0 {
+		w.add(`updated_at <= ?`, input.UpdatedEnd)
+	}
+	if input.DeadlineEnd > 0 {
+		w.add(`CAST(doc->>'$.deadline' AS SIGNED) BETWEEN 1 AND ?`, input.DeadlineEnd)
+	}
+	if input.SLADeadlineEnd > 0 {
+		w.add(`CAST(doc->>'$.slaDeadline' AS SIGNED) BETWEEN 1 AND ?`, input.SLADeadlineEnd)
+	}
+	if input.SLAMissed {
+		w.add(`CAST(doc->>'$.slaMissedAt' AS SIGNED) > 0`)
+	}
+	if input.CreatedBegin > 0 {
+		w.add(`created_at >= ?`, input.CreatedBegin)
+	}
+	if input.CreatedEnd > 0 {
+		w.add(`created_at <= ?`, input.CreatedEnd)
+	}
+	// the patched nil fields are kept as json null
+	if input.HasCmd {
+		w.add(`JSON_TYPE(JSON_EXTRACT(doc, '$.cmd')) = 'OBJECT'`)
+	}
+	if input.DeadLetter {
+		w.add(`JSON_TYPE(JSON_EXTRACT(doc, '$.deadLetter')) = 'OBJECT'`)
+	}
+	if input.Trigger != "" {
+		w.add(`doc->>'$.trigger' = ?`, string(input.Trigger))
+	}
+	if input.TriggerSource != "" {
+		w.add(`doc->>'$.triggerMeta.source' = ?`, input.TriggerSource)
+	}
+	if input.RootDagInsID != "" {
+		w.add(`doc->>'$.rootDagInsId' = ?`, input.RootDagInsID)
+	}
+	if input.IdempotencyKey != "" {
+		w.add(`idempotency_key = ?`, input.IdempotencyKey)
+	}
+	if len(input.Labels) > 0 {
+		bs, err := json.Marshal(input.Labels)
+		if err != nil {
+			return "", nil, fmt.Errorf("marshal labels failed: %w", err)
+		}
+		w.add(`JSON_CONTAINS(doc, ?, '$.labels')`, string(bs))
+	}
+
+	query := fmt.Sprintf("SELECT doc FROM %s%s", table, w)
+	if input.SortByPriority {
+		query += " ORDER BY priority DESC, created_at, seq"
+	} else {
+		query += " ORDER BY seq"
+	}
+	query += w.limit(input.Limit, input.Offset)
+	return query, w.args, nil
+}
+
+func buildListTaskInsQuery(table string, input *mod.ListTaskInstanceInput) (string, []interface{}) {
+	w := &where{}
+	if len(input.IDs) > 0 {
+		w.in(`id`, input.IDs)
+	}
+	if input.DagInsID != "" {
+		w.add(`dag_ins_id = ?`, input.DagInsID)
+	}
+	if input.TaskID != "" {
+		w.add(`task_id = ?`, input.TaskID)
+	}
+	if len(input.Status) > 0 {
+		status := make([]string, len(input.Status))
+		for i := range input.Status {
+			status[i] = string(input.Status[i])
+		}
+		w.in(`status`, status)
+	}
+	if input.Expired {
+		// delay is prevent watch dog conflicted with task's context timeout
+		w.add(`updated_at <= ? - IFNULL(CAST(doc->>'$.timeoutSecs' AS SIGNED), 0)`, time.Now().Unix()-5)
+	}
+	if input.HasArtifact {
+		w.add(`JSON_EXTRACT(doc, '$.artifacts[0]') IS NOT NULL`)
+	}
+	if input.AfterID != "" {
+		w.add(`id > ?`, input.AfterID)
+	}
+	if !input.Paged() {
+		return fmt.Sprintf("SELECT doc FROM %s%s ORDER BY seq", table, w), w.args
+	}
+
+	// the paginated instances are sorted by id, so AfterID works even if the instance is deleted
+	query := fmt.Sprintf("SELECT doc FROM %s%s ORDER BY id", table, w)
+	query += w.limit(input.Limit, input.Offset)
+	return query, w.args
+}
@@ -0,0 +1,206 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// tables is the names of tables, they are prefixed by StoreOption.Prefix
+type tables struct {
+	dag       string
+	dagIns    string
+	taskIns   string
+	lease     string
+	config    string
+	worker    string
+	rateLimit string
+	taskLog   string
+	migration string
+}
+
+func newTables(prefix string) *tables {
+	name := func(n string) string {
+		if prefix == "" {
+			return n
+		}
+		return fmt.Sprintf("%s_%s", prefix, n)
+	}
+	return &tables{
+		dag:       name("dag"),
+		dagIns:    name("dag_instance"),
+		taskIns:   name("task_instance"),
+		lease:     name("lease"),
+		config:    name("cluster_config"),
+		worker:    name("worker"),
+		rateLimit: name("rate_limit"),
+		taskLog:   name("task_log"),
+		migration: name("schema_migration"),
+	}
+}
+
+// migration is a version of schema, the applied versions are recorded in migration table,
+// so a released migration must not be modified, append a new one instead
+type migration struct {
+	version int
+	desc    string
+	stmts   func(t *tables) []string
+}
+
+// the filtered fields of documents are extracted to stored generated columns, so they can be indexed.
+// seq keep the insert order, so list result is stable like mongo's natural order,
+// version is increased by each write and used by optimistic locking
+var migrations = []migration{
+	{
+		version: 1,
+		desc:    "create tables",
+		stmts: func(t *tables) []string {
+			return []string{
+				fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	id VARCHAR(191) NOT NULL PRIMARY KEY,
+	seq BIGINT NOT NULL AUTO_INCREMENT UNIQUE,
+	version BIGINT NOT NULL DEFAULT 0,
+	doc JSON NOT NULL
+)`, t.dag),
+				fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	id VARCHAR(191) NOT NULL PRIMARY KEY,
+	seq BIGINT NOT NULL AUTO_INCREMENT UNIQUE,
+	version BIGINT NOT NULL DEFAULT 0,
+	doc JSON NOT NULL,
+	status VARCHAR(32) AS (doc->>'$.status') STORED,
+	worker VARCHAR(191) AS (doc->>'$.worker') STORED,
+	dag_id VARCHAR(191) AS (doc->>'$.dagId') STORED,
+	created_at BIGINT AS (CAST(doc->>'$.createdAt' AS SIGNED)) STORED,
+	updated_at BIGINT AS (CAST(doc->>'$.updatedAt' AS SIGNED)) STORED,
+	priority BIGINT AS (IFNULL(CAST(doc->>'$.priority' AS SIGNED), 0)) STORED,
+	INDEX idx_status_worker (status, worker),
+	INDEX idx_dag_id (dag_id, created_at),
+	INDEX idx_priority (priority DESC, created_at)
+)`, t.dagIns),
+				// ListTaskInstance is mostly filtered by dag instance, sometimes with task id,
+				// and watch dog queries the expired tasks by status and update time
+				fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	id VARCHAR(191) NOT NULL PRIMARY KEY,
+	seq BIGINT NOT NULL AUTO_INCREMENT UNIQUE,
+	version BIGINT NOT NULL DEFAULT 0,
+	doc JSON NOT NULL,
+	dag_ins_id VARCHAR(191) AS (doc->>'$.dagInsId') STORED,
+	task_id VARCHAR(191) AS (doc->>'$.taskId') STORED,
+	status VARCHAR(32) AS (doc->>'$.status') STORED,
+	updated_at BIGINT AS (CAST(doc->>'$.updatedAt' AS SIGNED)) STORED,
+	INDEX idx_dag_ins_task (dag_ins_id, task_id),
+	INDEX idx_status_updated (status, updated_at)
+)`, t.taskIns),
+				fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	lease_key VARCHAR(191) NOT NULL PRIMARY KEY,
+	holder VARCHAR(191) NOT NULL,
+	expired_at BIGINT NOT NULL,
+	INDEX idx_expired_at (expired_at)
+)`, t.lease),
+				fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	id VARCHAR(191) NOT NULL PRIMARY KEY,
+	doc JSON NOT NULL
+)`, t.config),
+				fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	worker_key VARCHAR(191) NOT NULL PRIMARY KEY,
+	doc JSON NOT NULL,
+	expired_at BIGINT NOT NULL
+)`, t.worker),
+				fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	id VARCHAR(191) NOT NULL PRIMARY KEY,
+	counter INT NOT NULL,
+	expired_at BIGINT NOT NULL
+)`, t.rateLimit),
+			}
+		},
+	},
+	{
+		version: 2,
+		desc:    "unique idempotency key",
+		stmts: func(t *tables) []string {
+			// the documents without key have null column, they are not checked by unique index
+			return []string{
+				fmt.Sprintf(`ALTER TABLE %s
+	ADD COLUMN idempotency_key VARCHAR(191) AS (doc->>'$.idempotencyKey') STORED,
+	ADD UNIQUE INDEX uk_dag_idempotency_key (dag_id, idempotency_key)`, t.dagIns),
+			}
+		},
+	},
+	{
+		version: 3,
+		desc:    "create task log table",
+		stmts: func(t *tables) []string {
+			return []string{
+				fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	task_ins_id VARCHAR(191) NOT NULL,
+	seq BIGINT NOT NULL,
+	doc JSON NOT NULL,
+	PRIMARY KEY (task_ins_id, seq)
+)`, t.taskLog),
+			}
+		},
+	},
+}
+
+// migrationLockTimeout is the seconds to wait for other workers which are applying migrations
+const migrationLockTimeout = 60
+
+// migrate apply the migrations which have not been applied, DDL is committed implicitly in mysql,
+// so a named lock is used to prevent workers which start at the same time from applying them concurrently
+func migrate(ctx context.Context, db *sql.DB, t *tables) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("get connection failed: %w", err)
+	}
+	defer conn.Close()
+
+	var locked sql.NullInt64
+	if err := conn.QueryRowContext(ctx, `SELECT GET_LOCK(?, ?)`, t.migration, migrationLockTimeout).
+		Scan(&locked); err != nil {
+		return fmt.Errorf("lock migration failed: %w", err)
+	}
+	if locked.Int64 != 1 {
+		return fmt.Errorf("lock migration timeout")
+	}
+	defer func() {
+		_, _ = conn.ExecContext(context.Background(), `SELECT RELEASE_LOCK(?)`, t.migration)
+	}()
+
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	version INT NOT NULL PRIMARY KEY,
+	description VARCHAR(255) NOT NULL,
+	applied_at BIGINT NOT NULL
+)`, t.migration)); err != nil {
+		return fmt.Errorf("create migration table failed: %w", err)
+	}
+
+	var current int
+	if err := conn.QueryRowContext(ctx,
+		fmt.Sprintf(`SELECT IFNULL(MAX(version), 0) FROM %s`, t.migration)).Scan(&current); err != nil {
+		return fmt.Errorf("get schema version failed: %w", err)
+	}
+	for _, m := range pendingMigrations(current) {
+		for _, stmt := range m.stmts(t) {
+			if _, err := conn.ExecContext(ctx, stmt); err != nil {
+				return fmt.Errorf("apply migration[%d] %s failed: %w", m.version, m.desc, err)
+			}
+		}
+		if _, err := conn.ExecContext(ctx,
+			fmt.Sprintf(`INSERT INTO %s (version, description, applied_at) VALUES (?, ?, UNIX_TIMESTAMP())`, t.migration),
+			m.version, m.desc); err != nil {
+			return fmt.Errorf("record migration[%d] failed: %w", m.version, err)
+		}
+	}
+	return nil
+}
+
+// pendingMigrations return the migrations newer than current version
+func pendingMigrations(current int) []migration {
+	var ret []migration
+	for _, m := range migrations {
+		if m.version > current {
+			ret = append(ret, m)
+		}
+	}
+	return ret
+}
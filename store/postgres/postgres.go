@@ -0,0 +1,977 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/event"
+	"github.com/etherealiy/fastflow/pkg/log"
+	"github.com/etherealiy/fastflow/pkg/mod"
+	"github.com/etherealiy/fastflow/pkg/utils"
+	"github.com/etherealiy/fastflow/pkg/utils/data"
+	"github.com/etherealiy/fastflow/store"
+	"github.com/shiningrush/goevent"
+)
+
+var (
+	_ mod.Store         = (*Store)(nil)
+	_ mod.DagPruneStore = (*Store)(nil)
+	_ mod.LeaseStore    = (*Store)(nil)
+
+	_ mod.ClusterConfigStore = (*Store)(nil)
+	_ mod.WorkerInfoStore    = (*Store)(nil)
+	_ mod.RateLimitStore     = (*Store)(nil)
+	_ mod.TaskLogStore       = (*Store)(nil)
+)
+
+var prefixRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// StoreOption
+type StoreOption struct {
+	// DSN the data source name passed to the driver
+	DSN string
+	// DriverName default "postgres", the driver should be registered by importing it, such as "github.com/lib/pq"
+	DriverName string
+	// Timeout access postgres timeout.default 5s
+	Timeout time.Duration
+	// the prefix will append to the tables, it can only contain letters, digits and underscores
+	Prefix string
+	// Listen is optional, it listens the channel until ctx is done and calls onNotify with the payload of
+	// each notification, it is used to raise event.DagInstanceChanged when dag instances are changed by any worker.
+	// database/sql does not support LISTEN, so it is provided by the driver, such as pq.NewListener
+	Listen func(ctx context.Context, channel string, onNotify func(payload string)) error
+}
+
+// Store is a postgres implement of mod.Store, documents are kept as JSONB,
+// it also implements mod.LeaseStore, so keeper/lease can use it as keeper
+type Store struct {
+	opt    *StoreOption
+	tables *tables
+	db     *sql.DB
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewStore
+func NewStore(option *StoreOption) *Store {
+	return &Store{
+		opt: option,
+	}
+}
+
+// Init store, it applies the migrations which have not been applied
+func (s *Store) Init() error {
+	if err := s.readOpt(); err != nil {
+		return err
+	}
+	store.InitFlakeGenerator()
+
+	db, err := sql.Open(s.opt.DriverName, s.opt.DSN)
+	if err != nil {
+		return fmt.Errorf("open db failed: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.opt.Timeout)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		_ = db.Close()
+		return fmt.Errorf("ping db failed: %w", err)
+	}
+	if err := migrate(ctx, db, s.tables); err != nil {
+		_ = db.Close()
+		return err
+	}
+	s.db = db
+
+	listenCtx, listenCancel := context.WithCancel(context.Background())
+	s.cancel = listenCancel
+	if s.opt.Listen != nil {
+		s.wg.Add(1)
+		go s.goListen(listenCtx)
+	}
+	return nil
+}
+
+func (s *Store) readOpt() error {
+	if s.opt.DSN == "" {
+		return fmt.Errorf("dsn cannot be empty")
+	}
+	if s.opt.Prefix != "" && !prefixRegexp.MatchString(s.opt.Prefix) {
+		return fmt.Errorf("prefix[ %s ] is invalid, it can only contain letters, digits and underscores", s.opt.Prefix)
+	}
+	if s.opt.DriverName == "" {
+		s.opt.DriverName = "postgres"
+	}
+	if s.opt.Timeout == 0 {
+		s.opt.Timeout = 5 * time.Second
+	}
+	s.tables = newTables(s.opt.Prefix)
+	return nil
+}
+
+// goListen keep listening until store closed, it relistens after a while when listen failed
+func (s *Store) goListen(ctx context.Context) {
+	defer s.wg.Done()
+	for {
+		err := s.opt.Listen(ctx, s.tables.channel, s.onNotify)
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+		log.Errorf("listen dag instance changes failed: %s", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func (s *Store) onNotify(payload string) {
+	e := &event.DagInstanceChanged{}
+	if err := json.Unmarshal([]byte(payload), e); err != nil {
+		log.Errorf("unmarshal dag instance changed notification failed: %s", err)
+		return
+	}
+	goevent.Publish(e)
+}
+
+// Close component when we not use it anymore
+func (s *Store) Close() {
+	s.cancel()
+	s.wg.Wait()
+	if err := s.db.Close(); err != nil {
+		log.Errorf("close store db failed: %s", err)
+	}
+}
+
+// CreateDag
+func (s *Store) CreateDag(dag *entity.Dag) error {
+	// check task's connection
+	_, err := mod.BuildRootNode(mod.MapTasksToGetter(dag.Tasks))
+	if err != nil {
+		return err
+	}
+	return s.genericCreate(dag, s.tables.dag)
+}
+
+// CreateDagIns
+func (s *Store) CreateDagIns(dagIns *entity.DagInstance) error {
+	// revision column starts from zero
+	dagIns.Revision = 0
+	err := s.genericCreate(dagIns, s.tables.dagIns)
+	// the violation of unique index is reported by the name of index, it does not depend on driver
+	if err != nil && strings.Contains(err.Error(), `"`+s.tables.dagIns+`_idempotency_key_idx"`) {
+		return fmt.Errorf("dag instance of dag[ %s ] with idempotency key[ %s ] already existed: %w",
+			dagIns.DagID, dagIns.IdempotencyKey, data.ErrIdempotencyKeyConflicted)
+	}
+	return err
+}
+
+// BatchCreatTaskIns
+func (s *Store) BatchCreatTaskIns(taskIns []*entity.TaskInstance) error {
+	for i := range taskIns {
+		if err := s.genericCreate(taskIns[i], s.tables.taskIns); err != nil {
+			return fmt.Errorf("insert task instance failed: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *Store) genericCreate(input entity.BaseInfoGetter, table string) error {
+	baseInfo := input.GetBaseInfo()
+	baseInfo.Initial()
+	bs, err := json.Marshal(input)
+	if err != nil {
+		return fmt.Errorf("marshal %s failed: %w", table, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.TODO(), s.opt.Timeout)
+	defer cancel()
+	ret, err := s.db.ExecContext(ctx,
+		fmt.Sprintf(`INSERT INTO %s (id, doc) VALUES ($1, $2::JSONB) ON CONFLICT (id) DO NOTHING`, table),
+		baseInfo.ID, string(bs))
+	if err != nil {
+		return fmt.Errorf("insert %s failed: %w", table, markTransient(err))
+	}
+	if n, err := ret.RowsAffected(); err != nil {
+		return fmt.Errorf("insert %s failed: %w", table, err)
+	} else if n == 0 {
+		return fmt.Errorf("%s key[ %s ] already existed: %w", table, baseInfo.ID, data.ErrDataConflicted)
+	}
+	return nil
+}
+
+// PatchTaskIns
+func (s *Store) PatchTaskIns(taskIns *entity.TaskInstance) error {
+	if taskIns.ID == "" {
+		return fmt.Errorf("id cannot be empty")
+	}
+	update := map[string]interface{}{
+		"updatedAt": time.Now().Unix(),
+	}
+	if taskIns.Status != "" {
+		update["status"] = taskIns.Status
+	}
+	if taskIns.Reason != "" {
+		update["reason"] = taskIns.Reason
+	}
+	if len(taskIns.Traces) > 0 {
+		update["traces"] = taskIns.Traces
+	}
+	if taskIns.TimeUsed != "" {
+		update["timeUsed"] = taskIns.TimeUsed
+	}
+	if len(taskIns.Attempts) > 0 {
+		update["attempts"] = taskIns.Attempts
+	}
+	if len(taskIns.Artifacts) > 0 {
+		update["artifacts"] = taskIns.Artifacts
+	}
+	if taskIns.Lineage != nil {
+		update["lineage"] = taskIns.Lineage
+	}
+	if taskIns.ShareDataSnapshot != nil {
+		update["shareDataSnapshot"] = taskIns.ShareDataSnapshot
+	}
+	if taskIns.BranchSkipped {
+		update["branchSkipped"] = true
+	}
+	if len(taskIns.MapItems) > 0 {
+		update["mapItems"] = taskIns.MapItems
+	}
+	if taskIns.SubDagInsID != "" {
+		update["subDagInsId"] = taskIns.SubDagInsID
+	}
+	if taskIns.AutoRetries != 0 {
+		update["autoRetries"] = taskIns.AutoRetries
+	}
+	if taskIns.NextRetryAt != 0 {
+		update["nextRetryAt"] = taskIns.NextRetryAt
+	}
+	if len(taskIns.Outputs) > 0 {
+		update["outputs"] = taskIns.Outputs
+	}
+	if taskIns.Worker != "" {
+		update["worker"] = taskIns.Worker
+	}
+	if taskIns.ClaimExpiresAt != 0 {
+		update["claimExpiresAt"] = taskIns.ClaimExpiresAt
+	}
+	if taskIns.Callback != nil {
+		update["callback"] = taskIns.Callback
+	}
+	if taskIns.Sensor != nil {
+		update["sensor"] = taskIns.Sensor
+	}
+
+	if err := s.genericPatch(s.tables.taskIns, taskIns.ID, update, ""); err != nil {
+		return fmt.Errorf("patch task instance failed: %w", err)
+	}
+	return nil
+}
+
+// PatchDagIns
+func (s *Store) PatchDagIns(dagIns *entity.DagInstance, mustsPatchFields ...string) error {
+	update := map[string]interface{}{
+		"updatedAt": time.Now().Unix(),
+	}
+	if dagIns.ShareData != nil {
+		update["shareData"] = dagIns.ShareData
+	}
+	if dagIns.Status != "" {
+		update["status"] = dagIns.Status
+	}
+	if utils.StringsContain(mustsPatchFields, "Cmd") || dagIns.Cmd != nil {
+		update["cmd"] = dagIns.Cmd
+	}
+	if dagIns.Worker != "" {
+		update["worker"] = dagIns.Worker
+	}
+	if utils.StringsContain(mustsPatchFields, "Reason") || dagIns.Reason != "" {
+		update["reason"] = dagIns.Reason
+	}
+	if dagIns.Notes != nil {
+		update["notes"] = dagIns.Notes
+	}
+	if dagIns.Annotations != nil {
+		update["annotations"] = dagIns.Annotations
+	}
+	if dagIns.Summary != nil {
+		update["summary"] = dagIns.Summary
+	}
+	if dagIns.RetryCount != 0 {
+		update["retryCount"] = dagIns.RetryCount
+	}
+	if dagIns.Deadline != 0 {
+		update["deadline"] = dagIns.Deadline
+	}
+	if dagIns.SLAs != nil {
+		update["slas"] = dagIns.SLAs
+	}
+	if utils.StringsContain(mustsPatchFields, "SLADeadline") || dagIns.SLADeadline != 0 {
+		update["slaDeadline"] = dagIns.SLADeadline
+	}
+	if dagIns.SLAMissedAt != 0 {
+		update["slaMissedAt"] = dagIns.SLAMissedAt
+	}
+	if utils.StringsContain(mustsPatchFields, "DeadLetter") || dagIns.DeadLetter != nil {
+		update["deadLetter"] = dagIns.DeadLetter
+	}
+	// null key is not indexed, so the key can be used again
+	if utils.StringsContain(mustsPatchFields, "IdempotencyKey") || dagIns.IdempotencyKey != "" {
+		if dagIns.IdempotencyKey == "" {
+			update["idempotencyKey"] = nil
+		} else {
+			update["idempotencyKey"] = dagIns.IdempotencyKey
+		}
+	}
+
+	// patch is a change too, so the dag instances read before it are stale
+	if err := s.genericPatch(s.tables.dagIns, dagIns.ID, update,
+		`|| jsonb_build_object('revision', revision + 1), revision = revision + 1`); err != nil {
+		return fmt.Errorf("patch dag instance failed: %w", err)
+	}
+
+	goevent.Publish(&event.DagInstancePatched{
+		Payload:         dagIns,
+		MustPatchFields: mustsPatchFields,
+	})
+	return nil
+}
+
+// genericPatch merge the fields into document in one statement, so concurrent patches will not overwrite
+// the fields of each other
+func (s *Store) genericPatch(table, id string, update map[string]interface{}, extraSet string) error {
+	bs, err := json.Marshal(update)
+	if err != nil {
+		return fmt.Errorf("marshal patch failed: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.TODO(), s.opt.Timeout)
+	defer cancel()
+	ret, err := s.db.ExecContext(ctx,
+		fmt.Sprintf(`UPDATE %s SET doc = doc || $1::JSONB %s WHERE id = $2`, table, extraSet),
+		string(bs), id)
+	if err != nil {
+		return markTransient(err)
+	}
+	if n, err := ret.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return fmt.Errorf("%s key[ %s ] not found: %w", table, id, data.ErrDataNotFound)
+	}
+	return nil
+}
+
+// UpdateDag
+func (s *Store) UpdateDag(dag *entity.Dag) error {
+	// check task's connection
+	_, err := mod.BuildRootNode(mod.MapTasksToGetter(dag.Tasks))
+	if err != nil {
+		return err
+	}
+	return s.genericUpdate(dag, s.tables.dag)
+}
+
+// UpdateDagIns replace the dag instance if its revision is not stale
+func (s *Store) UpdateDagIns(dagIns *entity.DagInstance) error {
+	ctx, cancel := context.WithTimeout(context.TODO(), s.opt.Timeout)
+	defer cancel()
+	if err := s.updateDagIns(ctx, s.db, dagIns); err != nil {
+		return err
+	}
+
+	goevent.Publish(&event.DagInstanceUpdated{Payload: dagIns})
+	return nil
+}
+
+// UpdateTaskIns
+func (s *Store) UpdateTaskIns(taskIns *entity.TaskInstance) error {
+	return s.genericUpdate(taskIns, s.tables.taskIns)
+}
+
+func (s *Store) genericUpdate(input entity.BaseInfoGetter, table string) error {
+	ctx, cancel := context.WithTimeout(context.TODO(), s.opt.Timeout)
+	defer cancel()
+	return s.replace(ctx, s.db, input, table)
+}
+
+// execer is implemented by both sql.DB and sql.Tx
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func (s *Store) replace(ctx context.Context, e execer, input entity.BaseInfoGetter, table string) error {
+	baseInfo := input.GetBaseInfo()
+	baseInfo.Update()
+	bs, err := json.Marshal(input)
+	if err != nil {
+		return fmt.Errorf("marshal %s failed: %w", table, err)
+	}
+
+	ret, err := e.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET doc = $1::JSONB WHERE id = $2`, table),
+		string(bs), baseInfo.ID)
+	if err != nil {
+		return fmt.Errorf("update %s failed: %w", table, markTransient(err))
+	}
+	if n, err := ret.RowsAffected(); err != nil {
+		return fmt.Errorf("update %s failed: %w", table, err)
+	} else if n == 0 {
+		return fmt.Errorf("%s has no key[ %s ] to update: %w", table, baseInfo.ID, data.ErrDataNotFound)
+	}
+	return nil
+}
+
+// updateDagIns replace the dag instance when the revision matches, and increase the revision
+func (s *Store) updateDagIns(ctx context.Context, e execer, dagIns *entity.DagInstance) error {
+	dagIns.Update()
+	old := dagIns.Revision
+	dagIns.Revision++
+	bs, err := json.Marshal(dagIns)
+	if err != nil {
+		dagIns.Revision = old
+		return fmt.Errorf("marshal dag instance failed: %w", err)
+	}
+
+	ret, err := e.ExecContext(ctx,
+		fmt.Sprintf(`UPDATE %s SET doc = $1::JSONB, revision = $2 WHERE id = $3 AND revision = $4`, s.tables.dagIns),
+		string(bs), dagIns.Revision, dagIns.ID, old)
+	if err != nil {
+		dagIns.Revision = old
+		return fmt.Errorf("update dag instance failed: %w", markTransient(err))
+	}
+	n, err := ret.RowsAffected()
+	if err != nil {
+		dagIns.Revision = old
+		return fmt.Errorf("update dag instance failed: %w", err)
+	}
+	if n > 0 {
+		return nil
+	}
+
+	dagIns.Revision = old
+	var current int64
+	err = e.QueryRowContext(ctx, fmt.Sprintf(`SELECT revision FROM %s WHERE id = $1`, s.tables.dagIns), dagIns.ID).
+		Scan(&current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%s has no key[ %s ] to update: %w", s.tables.dagIns, dagIns.ID, data.ErrDataNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("get dag instance revision failed: %w", markTransient(err))
+	}
+	return fmt.Errorf("dag instance[ %s ] revision %d is stale, current is %d: %w",
+		dagIns.ID, old, current, data.ErrDataConflicted)
+}
+
+// BatchUpdateDagIns update all dag instances in a transaction, nothing is updated if any of them is stale
+func (s *Store) BatchUpdateDagIns(dagIns []*entity.DagInstance) error {
+	ctx, cancel := context.WithTimeout(context.TODO(), s.opt.Timeout)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction failed: %w", markTransient(err))
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	olds := make([]int64, len(dagIns))
+	for i := range dagIns {
+		olds[i] = dagIns[i].Revision
+		if err := s.updateDagIns(ctx, tx, dagIns[i]); err != nil {
+			resetRevisions(dagIns[:i], olds)
+			return fmt.Errorf("batch update dag instance failed: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		resetRevisions(dagIns, olds)
+		return fmt.Errorf("batch update dag instance failed: %w", markTransient(err))
+	}
+	return nil
+}
+
+// resetRevisions restore the revisions when the transaction is rolled back
+func resetRevisions(dagIns []*entity.DagInstance, olds []int64) {
+	for i := range dagIns {
+		dagIns[i].Revision = olds[i]
+	}
+}
+
+// BatchUpdateTaskIns
+func (s *Store) BatchUpdateTaskIns(taskIns []*entity.TaskInstance) error {
+	ctx, cancel := context.WithTimeout(context.TODO(), s.opt.Timeout)
+	defer cancel()
+	for i := range taskIns {
+		if err := s.replace(ctx, s.db, taskIns[i], s.tables.taskIns); err != nil {
+			return fmt.Errorf("batch update task instance failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// GetTaskIns
+func (s *Store) GetTaskIns(taskInsId string) (*entity.TaskInstance, error) {
+	ret := new(entity.TaskInstance)
+	if err := s.genericGet(s.tables.taskIns, taskInsId, ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// GetDag
+func (s *Store) GetDag(dagId string) (*entity.Dag, error) {
+	ret := new(entity.Dag)
+	if err := s.genericGet(s.tables.dag, dagId, ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// GetDagInstance
+func (s *Store) GetDagInstance(dagInsId string) (*entity.DagInstance, error) {
+	ret := new(entity.DagInstance)
+	if err := s.genericGet(s.tables.dagIns, dagInsId, ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (s *Store) genericGet(table, id string, ret interface{}) error {
+	ctx, cancel := context.WithTimeout(context.TODO(), s.opt.Timeout)
+	defer cancel()
+
+	var bs []byte
+	err := s.db.QueryRowContext(ctx, fmt.Sprintf(`SELECT doc FROM %s WHERE id = $1`, table), id).Scan(&bs)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%s key[ %s ] not found: %w", table, id, data.ErrDataNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("get %s failed: %w", table, markTransient(err))
+	}
+	if err := json.Unmarshal(bs, ret); err != nil {
+		return fmt.Errorf("decode %s failed: %w", table, err)
+	}
+	return nil
+}
+
+// ListDag
+func (s *Store) ListDag(input *mod.ListDagInput) ([]*entity.Dag, error) {
+	query, args := buildListDagQuery(s.tables.dag, input)
+	var ret []*entity.Dag
+	err := s.genericList(query, args, func() interface{} {
+		ret = append(ret, new(entity.Dag))
+		return ret[len(ret)-1]
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// ListDagInstance
+func (s *Store) ListDagInstance(input *mod.ListDagInstanceInput) ([]*entity.DagInstance, error) {
+	query, args, err := buildListDagInsQuery(s.tables.dagIns, input)
+	if err != nil {
+		return nil, err
+	}
+	var ret []*entity.DagInstance
+	err = s.genericList(query, args, func() interface{} {
+		ret = append(ret, new(entity.DagInstance))
+		return ret[len(ret)-1]
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// ListTaskInstance
+func (s *Store) ListTaskInstance(input *mod.ListTaskInstanceInput) ([]*entity.TaskInstance, error) {
+	query, args := buildListTaskInsQuery(s.tables.taskIns, input)
+	var ret []*entity.TaskInstance
+	err := s.genericList(query, args, func() interface{} {
+		ret = append(ret, new(entity.TaskInstance))
+		return ret[len(ret)-1]
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// genericList decode each document into the value returned by next
+func (s *Store) genericList(query string, args []interface{}, next func() interface{}) error {
+	ctx, cancel := context.WithTimeout(context.TODO(), s.opt.Timeout)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("query failed: %w", markTransient(err))
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var bs []byte
+		if err := rows.Scan(&bs); err != nil {
+			return fmt.Errorf("scan failed: %w", markTransient(err))
+		}
+		if err := json.Unmarshal(bs, next()); err != nil {
+			return fmt.Errorf("decode failed: %w", err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("query failed: %w", markTransient(err))
+	}
+	return nil
+}
+
+// BatchDeleteDag
+func (s *Store) BatchDeleteDag(ids []string) error {
+	return s.genericBatchDelete(ids, s.tables.dag)
+}
+
+// BatchDeleteDagIns
+// only for test
+func (s *Store) BatchDeleteDagIns(ids []string) error {
+	return s.genericBatchDelete(ids, s.tables.dagIns)
+}
+
+// BatchDeleteTaskIns
+// only for test
+func (s *Store) BatchDeleteTaskIns(ids []string) error {
+	return s.genericBatchDelete(ids, s.tables.taskIns)
+}
+
+func (s *Store) genericBatchDelete(ids []string, table string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.TODO(), s.opt.Timeout)
+	defer cancel()
+
+	w := &where{}
+	w.in("id", ids)
+	if _, err := s.db.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s%s", table, w), w.args...); err != nil {
+		return fmt.Errorf("delete failed: %w", markTransient(err))
+	}
+	return nil
+}
+
+// ClaimTaskIns
+func (s *Store) ClaimTaskIns(taskInsID, worker string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	bs, err := json.Marshal(map[string]interface{}{
+		"worker":         worker,
+		"claimExpiresAt": now.Add(ttl).Unix(),
+		"updatedAt":      now.Unix(),
+	})
+	if err != nil {
+		return false, fmt.Errorf("marshal claim failed: %w", err)
+	}
+	status := make([]string, len(mod.ClaimableTaskInsStatus))
+	for i := range mod.ClaimableTaskInsStatus {
+		status[i] = string(mod.ClaimableTaskInsStatus[i])
+	}
+	w := &where{}
+	doc := w.arg(string(bs))
+	w.add(`id = ?`, taskInsID)
+	w.in(`doc->>'status'`, status)
+	w.add(`(doc->>'worker' = ? OR COALESCE((doc->>'claimExpiresAt')::BIGINT, 0) <= ?)`, worker, now.Unix())
+
+	ctx, cancel := context.WithTimeout(context.TODO(), s.opt.Timeout)
+	defer cancel()
+	ret, err := s.db.ExecContext(ctx,
+		fmt.Sprintf(`UPDATE %s SET doc = doc || %s::JSONB%s`, s.tables.taskIns, doc, w), w.args...)
+	if err != nil {
+		return false, fmt.Errorf("claim task instance failed: %w", markTransient(err))
+	}
+	n, err := ret.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("claim task instance failed: %w", err)
+	}
+	return n > 0, nil
+}
+
+// SwapRetryCount
+func (s *Store) SwapRetryCount(dagInsID string, oldCount, newCount int) (bool, error) {
+	bs, err := json.Marshal(map[string]interface{}{
+		"retryCount": newCount,
+		"updatedAt":  time.Now().Unix(),
+	})
+	if err != nil {
+		return false, fmt.Errorf("marshal retry count failed: %w", err)
+	}
+	w := &where{}
+	doc := w.arg(string(bs))
+	w.add(`id = ?`, dagInsID)
+	w.add(`COALESCE((doc->>'retryCount')::INT, 0) = ?`, oldCount)
+
+	ctx, cancel := context.WithTimeout(context.TODO(), s.opt.Timeout)
+	defer cancel()
+	// swap is a change too, so the revision is increased like patching
+	ret, err := s.db.ExecContext(ctx,
+		fmt.Sprintf(`UPDATE %s SET doc = doc || %s::JSONB || jsonb_build_object('revision', revision + 1),
+revision = revision + 1%s`, s.tables.dagIns, doc, w), w.args...)
+	if err != nil {
+		return false, fmt.Errorf("swap retry count failed: %w", markTransient(err))
+	}
+	n, err := ret.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("swap retry count failed: %w", err)
+	}
+	return n > 0, nil
+}
+
+// AcquireLease
+func (s *Store) AcquireLease(key, holder string, ttl time.Duration) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.TODO(), s.opt.Timeout)
+	defer cancel()
+
+	now := time.Now()
+	// the lease held by others is not updated when conflicted, so no row is affected
+	ret, err := s.db.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s AS l (key, holder, expired_at) VALUES ($1, $2, $3)
+ON CONFLICT (key) DO UPDATE SET holder = EXCLUDED.holder, expired_at = EXCLUDED.expired_at
+WHERE l.holder = EXCLUDED.holder OR l.expired_at <= $4`, s.tables.lease),
+		key, holder, now.Add(ttl), now)
+	if err != nil {
+		return false, fmt.Errorf("acquire lease failed: %w", markTransient(err))
+	}
+	n, err := ret.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("acquire lease failed: %w", err)
+	}
+	return n > 0, nil
+}
+
+// ReleaseLease
+func (s *Store) ReleaseLease(key, holder string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.TODO(), s.opt.Timeout)
+	defer cancel()
+
+	ret, err := s.db.ExecContext(ctx,
+		fmt.Sprintf(`DELETE FROM %s WHERE key = $1 AND holder = $2 AND expired_at > $3`, s.tables.lease),
+		key, holder, time.Now())
+	if err != nil {
+		return false, fmt.Errorf("release lease failed: %w", markTransient(err))
+	}
+	n, err := ret.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("release lease failed: %w", err)
+	}
+	return n > 0, nil
+}
+
+// ListLease
+func (s *Store) ListLease(prefix string) ([]*mod.Lease, error) {
+	ctx, cancel := context.WithTimeout(context.TODO(), s.opt.Timeout)
+	defer cancel()
+
+	w := &where{}
+	w.add("expired_at > ?", time.Now())
+	if prefix != "" {
+		w.add("key LIKE ?", likePrefix(prefix))
+	}
+	rows, err := s.db.QueryContext(ctx,
+		fmt.Sprintf("SELECT key, holder, expired_at FROM %s%s ORDER BY key", s.tables.lease, w), w.args...)
+	if err != nil {
+		return nil, fmt.Errorf("list lease failed: %w", markTransient(err))
+	}
+	defer rows.Close()
+
+	var ret []*mod.Lease
+	for rows.Next() {
+		l := &mod.Lease{}
+		if err := rows.Scan(&l.Key, &l.Holder, &l.ExpiredAt); err != nil {
+			return nil, fmt.Errorf("scan lease failed: %w", markTransient(err))
+		}
+		ret = append(ret, l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list lease failed: %w", markTransient(err))
+	}
+	return ret, nil
+}
+
+// clusterConfigID is the id of the only row of cluster config table
+const clusterConfigID = "cluster"
+
+// GetClusterConfig
+func (s *Store) GetClusterConfig() (*entity.ClusterConfig, error) {
+	cfg := &entity.ClusterConfig{}
+	err := s.genericGet(s.tables.config, clusterConfigID, cfg)
+	if errors.Is(err, data.ErrDataNotFound) {
+		return nil, fmt.Errorf("cluster config not found: %w", data.ErrDataNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// SaveClusterConfig
+func (s *Store) SaveClusterConfig(cfg *entity.ClusterConfig) error {
+	bs, err := json.Marshal(cfg)
+	if err != nil {
+		return fmt.Errorf("marshal cluster config failed: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.TODO(), s.opt.Timeout)
+	defer cancel()
+	// replace the whole document, so the omitted fields are reset to zero
+	if _, err := s.db.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (id, doc) VALUES ($1, $2::JSONB)
+ON CONFLICT (id) DO UPDATE SET doc = EXCLUDED.doc`, s.tables.config), clusterConfigID, string(bs)); err != nil {
+		return fmt.Errorf("save cluster config failed: %w", markTransient(err))
+	}
+	return nil
+}
+
+// workerInfoRetention is how long the info of a worker is kept after its last report
+const workerInfoRetention = 24 * time.Hour
+
+// SaveWorkerInfo
+func (s *Store) SaveWorkerInfo(info *entity.WorkerInfo) error {
+	bs, err := json.Marshal(info)
+	if err != nil {
+		return fmt.Errorf("marshal worker info failed: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.TODO(), s.opt.Timeout)
+	defer cancel()
+	now := time.Now()
+	if _, err := s.db.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (key, doc, expired_at) VALUES ($1, $2::JSONB, $3)
+ON CONFLICT (key) DO UPDATE SET doc = EXCLUDED.doc, expired_at = EXCLUDED.expired_at`, s.tables.worker),
+		info.Key, string(bs), now.Add(workerInfoRetention)); err != nil {
+		return fmt.Errorf("save worker info failed: %w", markTransient(err))
+	}
+	// clean up the info of workers which have not reported for a long time
+	if _, err := s.db.ExecContext(ctx,
+		fmt.Sprintf(`DELETE FROM %s WHERE expired_at <= $1`, s.tables.worker), now); err != nil {
+		return fmt.Errorf("delete expired worker info failed: %w", markTransient(err))
+	}
+	return nil
+}
+
+// ListWorkerInfo
+func (s *Store) ListWorkerInfo() ([]*entity.WorkerInfo, error) {
+	var ret []*entity.WorkerInfo
+	err := s.genericList(fmt.Sprintf(`SELECT doc FROM %s ORDER BY key`, s.tables.worker), nil, func() interface{} {
+		ret = append(ret, new(entity.WorkerInfo))
+		return ret[len(ret)-1]
+	})
+	if err != nil {
+		return nil, err
+	}
+	// alive is not persisted
+	for i := range ret {
+		ret[i].Alive = false
+	}
+	return ret, nil
+}
+
+// IncrRateLimitCounter
+func (s *Store) IncrRateLimitCounter(key string, windowStart time.Time, window time.Duration) (int, error) {
+	ctx, cancel := context.WithTimeout(context.TODO(), s.opt.Timeout)
+	defer cancel()
+
+	// clean up the counters of ended rate limit windows
+	if _, err := s.db.ExecContext(ctx,
+		fmt.Sprintf(`DELETE FROM %s WHERE expired_at < $1`, s.tables.rateLimit), time.Now()); err != nil {
+		return 0, fmt.Errorf("delete ended rate limit counters failed: %w", markTransient(err))
+	}
+	var count int
+	err := s.db.QueryRowContext(ctx, fmt.Sprintf(`INSERT INTO %[1]s (id, count, expired_at) VALUES ($1, 1, $2)
+ON CONFLICT (id) DO UPDATE SET count = %[1]s.count + 1 RETURNING count`, s.tables.rateLimit),
+		fmt.Sprintf("%s@%d", key, windowStart.UnixNano()), windowStart.Add(window)).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("increase rate limit counter failed: %w", markTransient(err))
+	}
+	return count, nil
+}
+
+// AppendTaskLogs
+func (s *Store) AppendTaskLogs(taskInsID string, logs []*entity.TaskLog, maxLines int) error {
+	if len(logs) == 0 {
+		return nil
+	}
+	var (
+		values []string
+		args   []interface{}
+	)
+	for _, l := range logs {
+		bs, err := json.Marshal(l)
+		if err != nil {
+			return fmt.Errorf("marshal task log failed: %w", err)
+		}
+		n := len(args)
+		values = append(values, fmt.Sprintf("($%d, $%d, $%d::JSONB)", n+1, n+2, n+3))
+		args = append(args, taskInsID, l.Seq, string(bs))
+	}
+
+	ctx, cancel := context.WithTimeout(context.TODO(), s.opt.Timeout)
+	defer cancel()
+	// the logs may be appended again when the previous appending timed out
+	if _, err := s.db.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (task_ins_id, seq, doc) VALUES %s
+ON CONFLICT (task_ins_id, seq) DO NOTHING`, s.tables.taskLog, strings.Join(values, ", ")), args...); err != nil {
+		return fmt.Errorf("insert task logs failed: %w", markTransient(err))
+	}
+	if maxLines <= 0 {
+		return nil
+	}
+	// rotate out the logs older than the latest maxLines ones
+	if _, err := s.db.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %[1]s WHERE task_ins_id = $1 AND seq <= (
+	SELECT seq FROM %[1]s WHERE task_ins_id = $1 ORDER BY seq DESC OFFSET $2 LIMIT 1)`, s.tables.taskLog),
+		taskInsID, maxLines); err != nil {
+		return fmt.Errorf("delete rotated task logs failed: %w", markTransient(err))
+	}
+	return nil
+}
+
+// GetTaskLogs
+func (s *Store) GetTaskLogs(taskInsID string, cursor int64, limit int) ([]*entity.TaskLog, error) {
+	query := fmt.Sprintf(`SELECT doc FROM %s WHERE task_ins_id = $1 AND seq > $2 ORDER BY seq`, s.tables.taskLog)
+	args := []interface{}{taskInsID, cursor}
+	if limit > 0 {
+		query += " LIMIT $3"
+		args = append(args, limit)
+	}
+	ret := []*entity.TaskLog{}
+	err := s.genericList(query, args, func() interface{} {
+		ret = append(ret, new(entity.TaskLog))
+		return ret[len(ret)-1]
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// markTransient mark broken connections and timeout as transient, so callers can retry them
+func markTransient(err error) error {
+	var netErr net.Error
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) {
+		return data.Transient(err)
+	}
+	return err
+}
+
+// Marshal
+func (s *Store) Marshal(obj interface{}) ([]byte, error) {
+	return json.Marshal(obj)
+}
+
+// Unmarshal
+func (s *Store) Unmarshal(bytes []byte, ptr interface{}) error {
+	return json.Unmarshal(bytes, ptr)
+}
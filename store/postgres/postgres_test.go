@@ -0,0 +1,145 @@
+package postgres
+
+import (
+	"testing"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/mod"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildListDagInsQuery(t *testing.T) {
+	tests := []struct {
+		caseDesc  string
+		giveInput *mod.ListDagInstanceInput
+		wantQuery string
+		wantArgs  []interface{}
+	}{
+		{
+			caseDesc:  "empty",
+			giveInput: &mod.ListDagInstanceInput{},
+			wantQuery: "SELECT doc FROM dag_instance ORDER BY seq",
+		},
+		{
+			caseDesc: "status and worker",
+			giveInput: &mod.ListDagInstanceInput{
+				Status: []entity.DagInstanceStatus{entity.DagInstanceStatusInit, entity.DagInstanceStatusScheduled},
+				Worker: "worker-1",
+			},
+			wantQuery: "SELECT doc FROM dag_instance WHERE doc->>'status' IN ($1, $2) AND doc->>'worker' = $3 ORDER BY seq",
+			wantArgs:  []interface{}{"init", "scheduled", "worker-1"},
+		},
+		{
+			caseDesc: "deadline and cmd",
+			giveInput: &mod.ListDagInstanceInput{
+				DeadlineEnd: 100,
+				HasCmd:      true,
+			},
+			wantQuery: "SELECT doc FROM dag_instance WHERE (doc->>'deadline')::BIGINT > 0 AND (doc->>'deadline')::BIGINT <= $1 " +
+				"AND jsonb_typeof(doc->'cmd') = 'object' ORDER BY seq",
+			wantArgs: []interface{}{int64(100)},
+		},
+		{
+			caseDesc: "idempotency key",
+			giveInput: &mod.ListDagInstanceInput{
+				DagID:          "dag1",
+				IdempotencyKey: "key1",
+			},
+			wantQuery: "SELECT doc FROM dag_instance WHERE doc->>'dagId' = $1 AND doc->>'idempotencyKey' = $2 ORDER BY seq",
+			wantArgs:  []interface{}{"dag1", "key1"},
+		},
+		{
+			caseDesc: "labels",
+			giveInput: &mod.ListDagInstanceInput{
+				Labels: map[string]string{"team": "infra", "env": "prod"},
+			},
+			wantQuery: "SELECT doc FROM dag_instance WHERE doc @> $1::JSONB ORDER BY seq",
+			wantArgs:  []interface{}{`{"labels":{"env":"prod","team":"infra"}}`},
+		},
+		{
+			caseDesc: "sort by priority with paging",
+			giveInput: &mod.ListDagInstanceInput{
+				DagID:          "dag",
+				SortByPriority: true,
+				Limit:          10,
+				Offset:         20,
+			},
+			wantQuery: "SELECT doc FROM dag_instance WHERE doc->>'dagId' = $1 " +
+				"ORDER BY COALESCE((doc->>'priority')::BIGINT, 0) DESC, (doc->>'createdAt')::BIGINT, seq LIMIT $2 OFFSET $3",
+			wantArgs: []interface{}{"dag", int64(10), int64(20)},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			query, args, err := buildListDagInsQuery("dag_instance", tc.giveInput)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantQuery, query)
+			assert.Equal(t, tc.wantArgs, args)
+		})
+	}
+}
+
+func TestBuildListTaskInsQuery(t *testing.T) {
+	tests := []struct {
+		caseDesc  string
+		giveInput *mod.ListTaskInstanceInput
+		wantQuery string
+		wantArgs  []interface{}
+	}{
+		{
+			caseDesc: "ids and status",
+			giveInput: &mod.ListTaskInstanceInput{
+				IDs:    []string{"1", "2"},
+				Status: []entity.TaskInstanceStatus{entity.TaskInstanceStatusRunning},
+			},
+			wantQuery: "SELECT doc FROM task_instance WHERE id IN ($1, $2) AND doc->>'status' IN ($3) ORDER BY seq",
+			wantArgs:  []interface{}{"1", "2", "running"},
+		},
+		{
+			caseDesc: "dag instance with artifact",
+			giveInput: &mod.ListTaskInstanceInput{
+				DagInsID:    "dagins",
+				HasArtifact: true,
+			},
+			wantQuery: "SELECT doc FROM task_instance WHERE doc->>'dagInsId' = $1 AND doc->'artifacts'->0 IS NOT NULL ORDER BY seq",
+			wantArgs:  []interface{}{"dagins"},
+		},
+		{
+			caseDesc: "paged",
+			giveInput: &mod.ListTaskInstanceInput{
+				DagInsID: "dagins",
+				AfterID:  "100",
+				Limit:    10,
+			},
+			wantQuery: "SELECT doc FROM task_instance WHERE doc->>'dagInsId' = $1 AND id > $2 ORDER BY id LIMIT $3",
+			wantArgs:  []interface{}{"dagins", "100", int64(10)},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			query, args := buildListTaskInsQuery("task_instance", tc.giveInput)
+			assert.Equal(t, tc.wantQuery, query)
+			assert.Equal(t, tc.wantArgs, args)
+		})
+	}
+}
+
+func TestBuildListDagQuery(t *testing.T) {
+	query, args := buildListDagQuery("ff_dag", &mod.ListDagInput{IDPrefix: "a_b%"})
+	assert.Equal(t, "SELECT doc FROM ff_dag WHERE id LIKE $1 ORDER BY seq", query)
+	assert.Equal(t, []interface{}{`a\_b\%%`}, args)
+}
+
+func TestMigrations(t *testing.T) {
+	tb := newTables("ff")
+	assert.Equal(t, "ff_dag_instance", tb.dagIns)
+	assert.Equal(t, "ff_dag_instance_changed", tb.channel)
+
+	for i, m := range migrations {
+		assert.Equal(t, i+1, m.version, "versions should be continuous")
+		assert.NotEmpty(t, m.stmts(tb))
+	}
+	assert.Len(t, pendingMigrations(0), len(migrations))
+	assert.Len(t, pendingMigrations(1), len(migrations)-1)
+	assert.Empty(t, pendingMigrations(len(migrations)))
+}
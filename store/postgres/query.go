@@ -0,0 +1,180 @@
+package postgres
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/mod"
+)
+
+// where build the conditions with positional parameters, "?" in condition is replaced by "$n"
+type where struct {
+	conds []string
+	args  []interface{}
+}
+
+func (w *where) add(cond string, args ...interface{}) {
+	for _, arg := range args {
+		w.args = append(w.args, arg)
+		cond = strings.Replace(cond, "?", "$"+strconv.Itoa(len(w.args)), 1)
+	}
+	w.conds = append(w.conds, cond)
+}
+
+// in add the condition that expression is one of values
+func (w *where) in(expr string, values []string) {
+	args := make([]interface{}, len(values))
+	marks := make([]string, len(values))
+	for i := range values {
+		args[i], marks[i] = values[i], "?"
+	}
+	w.add(fmt.Sprintf("%s IN (%s)", expr, strings.Join(marks, ", ")), args...)
+}
+
+// arg append a parameter which is not used by conditions, such as limit, and return its placeholder
+func (w *where) arg(v interface{}) string {
+	w.args = append(w.args, v)
+	return "$" + strconv.Itoa(len(w.args))
+}
+
+func (w *where) String() string {
+	if len(w.conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(w.conds, " AND ")
+}
+
+// likePrefix escape the wildcards of LIKE, so the prefix is matched literally
+func likePrefix(prefix string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return r.Replace(prefix) + "%"
+}
+
+func buildListDagQuery(table string, input *mod.ListDagInput) (string, []interface{}) {
+	w := &where{}
+	if input != nil && input.IDPrefix != "" {
+		w.add(`id LIKE ?`, likePrefix(input.IDPrefix))
+	}
+	return fmt.Sprintf("SELECT doc FROM %s%s ORDER BY seq", table, w), w.args
+}
+
+func buildListDagInsQuery(table string, input *mod.ListDagInstanceInput) (string, []interface{}, error) {
+	w := &where{}
+	if len(input.Status) > 0 {
+		status := make([]string, len(input.Status))
+		for i := range input.Status {
+			status[i] = string(input.Status[i])
+		}
+		w.in(`doc->>'status'`, status)
+	}
+	if input.Worker != "" {
+		w.add(`doc->>'worker' = ?`, input.Worker)
+	}
+	if input.DagID != "" {
+		w.add(`doc->>'dagId' = ?`, input.DagID)
+	}
+	if input.UpdatedEnd > 0 {
+		w.add(`(doc->>'updatedAt')::BIGINT <= ?`, input.UpdatedEnd)
+	}
+	if input.DeadlineEnd > 0 {
+		w.add(`(doc->>'deadline')::BIGINT > 0 AND (doc->>'deadline')::BIGINT <= ?`, input.DeadlineEnd)
+	}
+	if input.SLADeadlineEnd > 0 {
+		w.add(`(doc->>'slaDeadline')::BIGINT > 0 AND (doc->>'slaDeadline')::BIGINT <= ?`, input.SLADeadlineEnd)
+	}
+	if input.SLAMissed {
+		w.add(`(doc->>'slaMissedAt')::BIGINT > 0`)
+	}
+	if input.CreatedBegin > 0 {
+		w.add(`(doc->>'createdAt')::BIGINT >= ?`, input.CreatedBegin)
+	}
+	if input.CreatedEnd > 0 {
+		w.add(`(doc->>'createdAt')::BIGINT <= ?`, input.CreatedEnd)
+	}
+	// the patched nil fields are kept as json null
+	if input.HasCmd {
+		w.add(`jsonb_typeof(doc->'cmd') = 'object'`)
+	}
+	if input.DeadLetter {
+		w.add(`jsonb_typeof(doc->'deadLetter') = 'object'`)
+	}
+	if input.Trigger != "" {
+		w.add(`doc->>'trigger' = ?`, string(input.Trigger))
+	}
+	if input.TriggerSource != "" {
+		w.add(`doc->'triggerMeta'->>'source' = ?`, input.TriggerSource)
+	}
+	if input.RootDagInsID != "" {
+		w.add(`doc->>'rootDagInsId' = ?`, input.RootDagInsID)
+	}
+	if input.IdempotencyKey != "" {
+		w.add(`doc->>'idempotencyKey' = ?`, input.IdempotencyKey)
+	}
+	if len(input.Labels) > 0 {
+		bs, err := json.Marshal(map[string]interface{}{"labels": input.Labels})
+		if err != nil {
+			return "", nil, fmt.Errorf("marshal labels failed: %w", err)
+		}
+		w.add(`doc @> ?::JSONB`, string(bs))
+	}
+
+	query := fmt.Sprintf("SELECT doc FROM %s%s", table, w)
+	if input.SortByPriority {
+		query += ` ORDER BY COALESCE((doc->>'priority')::BIGINT, 0) DESC, (doc->>'createdAt')::BIGINT, seq`
+	} else {
+		query += " ORDER BY seq"
+	}
+	if input.Limit > 0 {
+		query += " LIMIT " + w.arg(input.Limit)
+	}
+	if input.Offset > 0 {
+		query += " OFFSET " + w.arg(input.Offset)
+	}
+	return query, w.args, nil
+}
+
+func buildListTaskInsQuery(table string, input *mod.ListTaskInstanceInput) (string, []interface{}) {
+	w := &where{}
+	if len(input.IDs) > 0 {
+		w.in(`id`, input.IDs)
+	}
+	if len(input.Status) > 0 {
+		status := make([]string, len(input.Status))
+		for i := range input.Status {
+			status[i] = string(input.Status[i])
+		}
+		w.in(`doc->>'status'`, status)
+	}
+	if input.Expired {
+		// delay is prevent watch dog conflicted with task's context timeout
+		w.add(`(doc->>'updatedAt')::BIGINT <= ? - COALESCE((doc->>'timeoutSecs')::BIGINT, 0)`, time.Now().Unix()-5)
+	}
+	if input.DagInsID != "" {
+		w.add(`doc->>'dagInsId' = ?`, input.DagInsID)
+	}
+	if input.TaskID != "" {
+		w.add(`doc->>'taskId' = ?`, input.TaskID)
+	}
+	if input.HasArtifact {
+		w.add(`doc->'artifacts'->0 IS NOT NULL`)
+	}
+	if input.AfterID != "" {
+		w.add(`id > ?`, input.AfterID)
+	}
+	if !input.Paged() {
+		return fmt.Sprintf("SELECT doc FROM %s%s ORDER BY seq", table, w), w.args
+	}
+
+	// the paginated instances are sorted by id, so AfterID works even if the instance is deleted
+	query := fmt.Sprintf("SELECT doc FROM %s%s ORDER BY id", table, w)
+	if input.Limit > 0 {
+		query += " LIMIT " + w.arg(input.Limit)
+	}
+	if input.Offset > 0 {
+		query += " OFFSET " + w.arg(input.Offset)
+	}
+	return query, w.args
+}
@@ -0,0 +1,214 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// tables is the names of tables and notify channel, they are prefixed by StoreOption.Prefix
+type tables struct {
+	dag       string
+	dagIns    string
+	taskIns   string
+	lease     string
+	config    string
+	worker    string
+	rateLimit string
+	taskLog   string
+	migration string
+	// channel is notified when a dag instance is inserted or updated
+	channel string
+}
+
+func newTables(prefix string) *tables {
+	name := func(n string) string {
+		if prefix == "" {
+			return n
+		}
+		return fmt.Sprintf("%s_%s", prefix, n)
+	}
+	return &tables{
+		dag:       name("dag"),
+		dagIns:    name("dag_instance"),
+		taskIns:   name("task_instance"),
+		lease:     name("lease"),
+		config:    name("cluster_config"),
+		worker:    name("worker"),
+		rateLimit: name("rate_limit"),
+		taskLog:   name("task_log"),
+		migration: name("schema_migration"),
+		channel:   name("dag_instance_changed"),
+	}
+}
+
+// migration is a version of schema, the applied versions are recorded in migration table,
+// so a released migration must not be modified, append a new one instead
+type migration struct {
+	version int
+	desc    string
+	stmts   func(t *tables) []string
+}
+
+var migrations = []migration{
+	{
+		version: 1,
+		desc:    "create tables",
+		stmts: func(t *tables) []string {
+			return []string{
+				// seq keep the insert order, so list result is stable like mongo's natural order
+				fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	id TEXT PRIMARY KEY,
+	seq BIGSERIAL,
+	doc JSONB NOT NULL
+)`, t.dag),
+				fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	id TEXT PRIMARY KEY,
+	seq BIGSERIAL,
+	revision BIGINT NOT NULL DEFAULT 0,
+	doc JSONB NOT NULL
+)`, t.dagIns),
+				fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	id TEXT PRIMARY KEY,
+	seq BIGSERIAL,
+	doc JSONB NOT NULL
+)`, t.taskIns),
+				fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	key TEXT PRIMARY KEY,
+	holder TEXT NOT NULL,
+	expired_at TIMESTAMPTZ NOT NULL
+)`, t.lease),
+				fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	id TEXT PRIMARY KEY,
+	doc JSONB NOT NULL
+)`, t.config),
+				fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	key TEXT PRIMARY KEY,
+	doc JSONB NOT NULL,
+	expired_at TIMESTAMPTZ NOT NULL
+)`, t.worker),
+				fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	id TEXT PRIMARY KEY,
+	count INT NOT NULL,
+	expired_at TIMESTAMPTZ NOT NULL
+)`, t.rateLimit),
+			}
+		},
+	},
+	{
+		version: 2,
+		desc:    "create indexes",
+		stmts: func(t *tables) []string {
+			return []string{
+				fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %[1]s_status_idx ON %[1]s ((doc->>'status'), (doc->>'worker'))`, t.dagIns),
+				fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %[1]s_dag_id_idx ON %[1]s ((doc->>'dagId'))`, t.dagIns),
+				fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %[1]s_priority_idx ON %[1]s ((COALESCE((doc->>'priority')::BIGINT, 0)) DESC, ((doc->>'createdAt')::BIGINT))`, t.dagIns),
+				fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %[1]s_dag_ins_id_idx ON %[1]s ((doc->>'dagInsId'))`, t.taskIns),
+				fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %[1]s_status_idx ON %[1]s ((doc->>'status'))`, t.taskIns),
+				fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %[1]s_expired_at_idx ON %[1]s (expired_at)`, t.lease),
+			}
+		},
+	},
+	{
+		version: 3,
+		desc:    "notify dag instance changes",
+		stmts: func(t *tables) []string {
+			return []string{
+				fmt.Sprintf(`CREATE OR REPLACE FUNCTION %[1]s_notify() RETURNS TRIGGER AS $$
+BEGIN
+	PERFORM pg_notify('%[2]s', json_build_object(
+		'id', NEW.id,
+		'status', NEW.doc->>'status',
+		'worker', NEW.doc->>'worker',
+		'revision', NEW.revision)::TEXT);
+	RETURN NEW;
+END;
+$$ LANGUAGE plpgsql`, t.dagIns, t.channel),
+				fmt.Sprintf(`DROP TRIGGER IF EXISTS %[1]s_notify ON %[1]s`, t.dagIns),
+				fmt.Sprintf(`CREATE TRIGGER %[1]s_notify AFTER INSERT OR UPDATE ON %[1]s
+	FOR EACH ROW EXECUTE PROCEDURE %[1]s_notify()`, t.dagIns),
+			}
+		},
+	},
+	{
+		version: 4,
+		desc:    "unique idempotency key",
+		stmts: func(t *tables) []string {
+			return []string{
+				fmt.Sprintf(`CREATE UNIQUE INDEX IF NOT EXISTS %[1]s_idempotency_key_idx ON %[1]s ((doc->>'dagId'), (doc->>'idempotencyKey'))
+	WHERE doc->>'idempotencyKey' IS NOT NULL`, t.dagIns),
+			}
+		},
+	},
+	{
+		version: 5,
+		desc:    "create task log table",
+		stmts: func(t *tables) []string {
+			return []string{
+				fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	task_ins_id TEXT NOT NULL,
+	seq BIGINT NOT NULL,
+	doc JSONB NOT NULL,
+	PRIMARY KEY (task_ins_id, seq)
+)`, t.taskLog),
+			}
+		},
+	},
+}
+
+// migrate apply the migrations which have not been applied, the advisory lock prevents workers
+// which start at the same time from applying them concurrently
+func migrate(ctx context.Context, db *sql.DB, t *tables) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin migration failed: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, t.migration); err != nil {
+		return fmt.Errorf("lock migration failed: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	version INT PRIMARY KEY,
+	description TEXT NOT NULL,
+	applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+)`, t.migration)); err != nil {
+		return fmt.Errorf("create migration table failed: %w", err)
+	}
+
+	var current int
+	if err := tx.QueryRowContext(ctx,
+		fmt.Sprintf(`SELECT COALESCE(MAX(version), 0) FROM %s`, t.migration)).Scan(&current); err != nil {
+		return fmt.Errorf("get schema version failed: %w", err)
+	}
+	for _, m := range pendingMigrations(current) {
+		for _, stmt := range m.stmts(t) {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return fmt.Errorf("apply migration[%d] %s failed: %w", m.version, m.desc, err)
+			}
+		}
+		if _, err := tx.ExecContext(ctx,
+			fmt.Sprintf(`INSERT INTO %s (version, description) VALUES ($1, $2)`, t.migration),
+			m.version, m.desc); err != nil {
+			return fmt.Errorf("record migration[%d] failed: %w", m.version, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit migration failed: %w", err)
+	}
+	return nil
+}
+
+// pendingMigrations return the migrations newer than current version
+func pendingMigrations(current int) []migration {
+	var ret []migration
+	for _, m := range migrations {
+		if m.version > current {
+			ret = append(ret, m)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,226 @@
+package redis
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/utils/data"
+)
+
+// replyError is the error replied by redis, the connection is still usable after it
+type replyError string
+
+func (e replyError) Error() string {
+	return string(e)
+}
+
+// client is a minimal redis client speaking RESP2, it only supports the commands used by store
+type client struct {
+	opt  *StoreOption
+	pool chan *conn
+}
+
+type conn struct {
+	net.Conn
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+func newClient(opt *StoreOption) *client {
+	return &client{
+		opt:  opt,
+		pool: make(chan *conn, opt.PoolSize),
+	}
+}
+
+// do send the command and read its reply, the reply is string, int64, nil or []interface{}
+func (c *client) do(ctx context.Context, args ...interface{}) (interface{}, error) {
+	cn, err := c.get(ctx)
+	if err != nil {
+		return nil, data.Transient(err)
+	}
+	ret, err := cn.do(ctx, c.opt.Timeout, args...)
+	var re replyError
+	if err != nil && !errors.As(err, &re) {
+		_ = cn.Close()
+		return nil, markTransient(err)
+	}
+	c.put(cn)
+	return ret, err
+}
+
+func (c *client) get(ctx context.Context) (*conn, error) {
+	select {
+	case cn := <-c.pool:
+		return cn, nil
+	default:
+	}
+
+	d := net.Dialer{Timeout: c.opt.Timeout}
+	nc, err := d.DialContext(ctx, "tcp", c.opt.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("dial redis failed: %w", err)
+	}
+	cn := &conn{Conn: nc, r: bufio.NewReader(nc), w: bufio.NewWriter(nc)}
+	if c.opt.Password != "" {
+		if _, err := cn.do(ctx, c.opt.Timeout, "AUTH", c.opt.Password); err != nil {
+			_ = nc.Close()
+			return nil, fmt.Errorf("auth failed: %w", err)
+		}
+	}
+	if c.opt.DB != 0 {
+		if _, err := cn.do(ctx, c.opt.Timeout, "SELECT", c.opt.DB); err != nil {
+			_ = nc.Close()
+			return nil, fmt.Errorf("select db failed: %w", err)
+		}
+	}
+	return cn, nil
+}
+
+func (c *client) put(cn *conn) {
+	select {
+	case c.pool <- cn:
+	default:
+		_ = cn.Close()
+	}
+}
+
+func (c *client) close() {
+	for {
+		select {
+		case cn := <-c.pool:
+			_ = cn.Close()
+		default:
+			return
+		}
+	}
+}
+
+func (cn *conn) do(ctx context.Context, timeout time.Duration, args ...interface{}) (interface{}, error) {
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := cn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+	if err := writeCommand(cn.w, args...); err != nil {
+		return nil, err
+	}
+	if err := cn.w.Flush(); err != nil {
+		return nil, err
+	}
+	return readReply(cn.r)
+}
+
+// writeCommand encode the command as an array of bulk strings
+func writeCommand(w *bufio.Writer, args ...interface{}) error {
+	if _, err := fmt.Fprintf(w, "*%d\r\n", len(args)); err != nil {
+		return err
+	}
+	for _, arg := range args {
+		var s string
+		switch v := arg.(type) {
+		case string:
+			s = v
+		case []byte:
+			s = string(v)
+		case int:
+			s = strconv.Itoa(v)
+		case int64:
+			s = strconv.FormatInt(v, 10)
+		default:
+			return fmt.Errorf("unsupported argument type %T", arg)
+		}
+		if _, err := fmt.Fprintf(w, "$%d\r\n%s\r\n", len(s), s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("invalid reply line: %q", line)
+	}
+	typ, body := line[0], line[1:len(line)-2]
+	switch typ {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, replyError(body)
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bulk length: %w", err)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, fmt.Errorf("invalid array length: %w", err)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		ret := make([]interface{}, n)
+		for i := range ret {
+			// the error element is kept, so the other elements can still be used
+			v, err := readReply(r)
+			var re replyError
+			if err != nil && !errors.As(err, &re) {
+				return nil, err
+			}
+			if err != nil {
+				v = err
+			}
+			ret[i] = v
+		}
+		return ret, nil
+	}
+	return nil, fmt.Errorf("unknown reply type: %q", typ)
+}
+
+// markTransient mark network errors and timeout as transient, so callers can retry them
+func markTransient(err error) error {
+	var netErr net.Error
+	if errors.Is(err, io.EOF) || errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) {
+		return data.Transient(err)
+	}
+	return err
+}
+
+// replyInt convert integer reply
+func replyInt(v interface{}) int64 {
+	n, _ := v.(int64)
+	return n
+}
+
+// replyStrings convert array reply, the nil elements are kept as empty strings
+func replyStrings(v interface{}) []string {
+	arr, _ := v.([]interface{})
+	ret := make([]string, len(arr))
+	for i := range arr {
+		ret[i], _ = arr[i].(string)
+	}
+	return ret
+}
@@ -0,0 +1,103 @@
+package redis
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteCommand(t *testing.T) {
+	tests := []struct {
+		caseDesc string
+		giveArgs []interface{}
+		wantOut  string
+		wantErr  bool
+	}{
+		{
+			caseDesc: "normal",
+			giveArgs: []interface{}{"SET", "key", []byte("val"), 1, int64(-2)},
+			wantOut:  "*5\r\n$3\r\nSET\r\n$3\r\nkey\r\n$3\r\nval\r\n$1\r\n1\r\n$2\r\n-2\r\n",
+		},
+		{
+			caseDesc: "empty string",
+			giveArgs: []interface{}{"GET", ""},
+			wantOut:  "*2\r\n$3\r\nGET\r\n$0\r\n\r\n",
+		},
+		{
+			caseDesc: "unsupported type",
+			giveArgs: []interface{}{"GET", 1.5},
+			wantErr:  true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			w := bufio.NewWriter(buf)
+			err := writeCommand(w, tc.giveArgs...)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.NoError(t, w.Flush())
+			assert.Equal(t, tc.wantOut, buf.String())
+		})
+	}
+}
+
+func TestReadReply(t *testing.T) {
+	tests := []struct {
+		caseDesc  string
+		giveReply string
+		wantRet   interface{}
+		wantErr   error
+	}{
+		{
+			caseDesc:  "simple string",
+			giveReply: "+OK\r\n",
+			wantRet:   "OK",
+		},
+		{
+			caseDesc:  "error",
+			giveReply: "-ERR wrong type\r\n",
+			wantErr:   replyError("ERR wrong type"),
+		},
+		{
+			caseDesc:  "integer",
+			giveReply: ":-3\r\n",
+			wantRet:   int64(-3),
+		},
+		{
+			caseDesc:  "bulk string",
+			giveReply: "$5\r\na\r\nbc\r\n",
+			wantRet:   "a\r\nbc",
+		},
+		{
+			caseDesc:  "nil bulk string",
+			giveReply: "$-1\r\n",
+			wantRet:   nil,
+		},
+		{
+			caseDesc:  "array",
+			giveReply: "*3\r\n$1\r\na\r\n$-1\r\n*1\r\n:1\r\n",
+			wantRet:   []interface{}{"a", nil, []interface{}{int64(1)}},
+		},
+		{
+			caseDesc:  "array with error",
+			giveReply: "*2\r\n-ERR\r\n:1\r\n",
+			wantRet:   []interface{}{replyError("ERR"), int64(1)},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			ret, err := readReply(bufio.NewReader(strings.NewReader(tc.giveReply)))
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantRet, ret)
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/trigger"
+)
+
+var _ trigger.EventSource = (*ListSource)(nil)
+
+// listBlockSecs is the seconds of blocking to pop a list, ctx is checked between the pops
+const listBlockSecs = 1
+
+// ListSourceOption
+type ListSourceOption struct {
+	Addr     string
+	Password string
+	DB       int
+	// Timeout default 5s
+	Timeout time.Duration
+	// Key is the list which producers push events into by LPUSH
+	Key string
+	// Consumer is the name of consumer, default is hostname. The events being handled are kept in the list
+	// "<Key>:processing:<Consumer>" until they are acked, and are redelivered after the consumer restarts,
+	// so it should be stable and unique for each consumer
+	Consumer string
+}
+
+// ListSource receive the elements of redis list as events, the element is the payload.
+// It pops the list reliably by BRPOPLPUSH, so the events are consumed in order and each one is received
+// by one of the consumers. The events do not have id, so a redelivered event runs the dags again.
+type ListSource struct {
+	opt        *ListSourceOption
+	c          *client
+	processing string
+	// unacked is the events left in processing list by previous process
+	unacked   []string
+	recovered bool
+}
+
+// NewListSource
+func NewListSource(opt *ListSourceOption) (*ListSource, error) {
+	if opt.Key == "" {
+		return nil, fmt.Errorf("key of list cannot be empty")
+	}
+	if opt.Addr == "" {
+		opt.Addr = "127.0.0.1:6379"
+	}
+	if opt.Timeout == 0 {
+		opt.Timeout = 5 * time.Second
+	}
+	if opt.Consumer == "" {
+		host, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("get hostname failed: %w", err)
+		}
+		opt.Consumer = host
+	}
+	return &ListSource{
+		opt: opt,
+		c: newClient(&StoreOption{
+			Addr:     opt.Addr,
+			Password: opt.Password,
+			DB:       opt.DB,
+			// the connection must not time out when blocking
+			Timeout:  opt.Timeout + listBlockSecs*time.Second,
+			PoolSize: 1,
+		}),
+		processing: fmt.Sprintf("%s:processing:%s", opt.Key, opt.Consumer),
+	}, nil
+}
+
+// Receive
+func (s *ListSource) Receive(ctx context.Context) (*trigger.Event, error) {
+	if !s.recovered {
+		ret, err := s.c.do(ctx, "LRANGE", s.processing, 0, -1)
+		if err != nil {
+			return nil, fmt.Errorf("read unacked events failed: %w", err)
+		}
+		s.unacked = replyStrings(ret)
+		s.recovered = true
+	}
+	// the oldest one is at the tail
+	if n := len(s.unacked); n > 0 {
+		payload := s.unacked[n-1]
+		s.unacked = s.unacked[:n-1]
+		return &trigger.Event{Payload: []byte(payload)}, nil
+	}
+
+	for {
+		ret, err := s.c.do(ctx, "BRPOPLPUSH", s.opt.Key, s.processing, listBlockSecs)
+		if err != nil {
+			return nil, err
+		}
+		if payload, ok := ret.(string); ok {
+			return &trigger.Event{Payload: []byte(payload)}, nil
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Ack remove the event from processing list
+func (s *ListSource) Ack(ctx context.Context, event *trigger.Event) error {
+	_, err := s.c.do(ctx, "LREM", s.processing, -1, string(event.Payload))
+	return err
+}
+
+// Close
+func (s *ListSource) Close() error {
+	s.c.close()
+	return nil
+}
@@ -0,0 +1,1166 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/event"
+	"github.com/etherealiy/fastflow/pkg/log"
+	"github.com/etherealiy/fastflow/pkg/mod"
+	"github.com/etherealiy/fastflow/pkg/utils/data"
+	"github.com/etherealiy/fastflow/store"
+	"github.com/shiningrush/goevent"
+)
+
+var (
+	_ mod.Store         = (*Store)(nil)
+	_ mod.DagPruneStore = (*Store)(nil)
+	_ mod.LeaseStore    = (*Store)(nil)
+
+	_ mod.ClusterConfigStore = (*Store)(nil)
+	_ mod.WorkerInfoStore    = (*Store)(nil)
+	_ mod.RateLimitStore     = (*Store)(nil)
+	_ mod.TaskLogStore       = (*Store)(nil)
+)
+
+const (
+	kindDag     = "dag"
+	kindDagIns  = "dagins"
+	kindTaskIns = "taskins"
+
+	// maxWriteRetry is the times to retry when the document is changed by others during writing
+	maxWriteRetry = 10
+	// mgetBatch is the count of documents got in a round trip
+	mgetBatch = 100
+	// compactBatch is the count of finished dag instances removed in a round
+	compactBatch = 100
+)
+
+// StoreOption
+type StoreOption struct {
+	// Addr the address of redis, default "127.0.0.1:6379"
+	Addr     string
+	Password string
+	DB       int
+	// Timeout access redis timeout.default 5s
+	Timeout time.Duration
+	// PoolSize the max idle connections, default 10
+	PoolSize int
+	// the prefix of keys, default "fastflow"
+	Prefix string
+	// FinishedDagInsTTL is how long the finished dag instances and their task instances are kept,
+	// zero means they are kept forever
+	FinishedDagInsTTL time.Duration
+	// CompactInterval is the interval to remove the finished dag instances which exceed FinishedDagInsTTL, default 1m
+	CompactInterval time.Duration
+}
+
+// Store is a redis implement of mod.Store for lightweight deployments, documents are kept as json strings
+// and indexed by sorted sets whose score is the insert sequence. Redis cannot query by conditions,
+// so list filters the documents in the index, it suits the deployments which have not many instances.
+// It also implements mod.LeaseStore by keys with expiry, so keeper/lease can use it as keeper.
+type Store struct {
+	opt  *StoreOption
+	keys *keys
+	c    *client
+
+	closeCh chan struct{}
+	wg      sync.WaitGroup
+}
+
+// keys is the layout of redis keys
+type keys struct {
+	prefix string
+}
+
+func (k *keys) seq() string {
+	return k.prefix + ":seq"
+}
+
+func (k *keys) doc(kind, id string) string {
+	return fmt.Sprintf("%s:doc:%s:%s", k.prefix, kind, id)
+}
+
+// all is the index of all documents of the kind
+func (k *keys) all(kind string) string {
+	return fmt.Sprintf("%s:idx:%s", k.prefix, kind)
+}
+
+func (k *keys) dagInsStatus(status string) string {
+	return fmt.Sprintf("%s:idx:%s:status:%s", k.prefix, kindDagIns, status)
+}
+
+// finished is the index of finished dag instances, the score is the time when it finished
+func (k *keys) finished() string {
+	return fmt.Sprintf("%s:idx:%s:finished", k.prefix, kindDagIns)
+}
+
+func (k *keys) taskInsOfDagIns(dagInsID string) string {
+	return fmt.Sprintf("%s:idx:%s:dagins:%s", k.prefix, kindTaskIns, dagInsID)
+}
+
+func (k *keys) lease(key string) string {
+	return k.prefix + ":lease:" + key
+}
+
+func (k *keys) leases() string {
+	return k.prefix + ":idx:lease"
+}
+
+func (k *keys) config() string {
+	return k.prefix + ":config"
+}
+
+func (k *keys) worker(key string) string {
+	return k.prefix + ":worker:" + key
+}
+
+func (k *keys) workers() string {
+	return k.prefix + ":idx:worker"
+}
+
+func (k *keys) rateLimit(id string) string {
+	return k.prefix + ":ratelimit:" + id
+}
+
+// idempotencyKey is the key whose value is the dag instance holding the idempotency key of dag
+func (k *keys) taskLog(taskInsID string) string {
+	return k.prefix + ":tasklog:" + taskInsID
+}
+
+func (k *keys) idempotencyKey(dagID, key string) string {
+	return fmt.Sprintf("%s:idempotency:%s:%s", k.prefix, dagID, key)
+}
+
+// unique return the key which makes the document unique by its fields, empty means no such key.
+// Only the idempotency key of dag instance is unique now
+func (k *keys) unique(kind string, doc string) string {
+	if doc == "" || kind != kindDagIns {
+		return ""
+	}
+	fields := struct {
+		DagID          string `json:"dagId"`
+		IdempotencyKey string `json:"idempotencyKey"`
+	}{}
+	if err := json.Unmarshal([]byte(doc), &fields); err != nil || fields.IdempotencyKey == "" {
+		return ""
+	}
+	return k.idempotencyKey(fields.DagID, fields.IdempotencyKey)
+}
+
+// indexes return the index sets of document except the one of all documents
+func (k *keys) indexes(kind string, doc string) ([]string, error) {
+	if doc == "" || kind == kindDag {
+		return nil, nil
+	}
+	fields := struct {
+		Status   string `json:"status"`
+		DagInsID string `json:"dagInsId"`
+	}{}
+	if err := json.Unmarshal([]byte(doc), &fields); err != nil {
+		return nil, fmt.Errorf("decode %s failed: %w", kind, err)
+	}
+	if kind == kindDagIns {
+		return []string{k.dagInsStatus(fields.Status)}, nil
+	}
+	return []string{k.taskInsOfDagIns(fields.DagInsID)}, nil
+}
+
+// finishedArg return the finished time of dag instance, "0" means it is unfinished,
+// empty means the kind is not tracked
+func finishedArg(kind string, doc string) string {
+	if kind != kindDagIns {
+		return ""
+	}
+	fields := struct {
+		Status entity.DagInstanceStatus `json:"status"`
+	}{}
+	_ = json.Unmarshal([]byte(doc), &fields)
+	switch fields.Status {
+	case entity.DagInstanceStatusSuccess, entity.DagInstanceStatusFailed:
+		return strconv.FormatInt(time.Now().Unix(), 10)
+	}
+	return "0"
+}
+
+// writeScript set the document when it is not changed since read, and move it between indexes.
+// The unique keys are optional, so they are passed by ARGV and empty means the document has no such key.
+// KEYS: document, sequence, index of all, finished index, old indexes..., new indexes...
+// ARGV: expected document(empty means creating), new document, member, count of old indexes, finished time,
+// old unique key, new unique key
+const writeScript = `
+local cur = redis.call('GET', KEYS[1])
+if ARGV[1] == '' then
+	if cur then return 0 end
+elseif not cur then
+	return -1
+elseif cur ~= ARGV[1] then
+	return -2
+end
+if ARGV[7] ~= '' and ARGV[7] ~= ARGV[6] then
+	local owner = redis.call('GET', ARGV[7])
+	if owner and owner ~= ARGV[3] then return -3 end
+end
+redis.call('SET', KEYS[1], ARGV[2])
+if ARGV[6] ~= '' and ARGV[6] ~= ARGV[7] then
+	redis.call('DEL', ARGV[6])
+end
+if ARGV[7] ~= '' then
+	redis.call('SET', ARGV[7], ARGV[3])
+end
+local seq = redis.call('ZSCORE', KEYS[3], ARGV[3])
+if not seq then
+	seq = redis.call('INCR', KEYS[2])
+	redis.call('ZADD', KEYS[3], seq, ARGV[3])
+end
+local nOld = tonumber(ARGV[4])
+for i = 5, 4 + nOld do
+	redis.call('ZREM', KEYS[i], ARGV[3])
+end
+for i = 5 + nOld, #KEYS do
+	redis.call('ZADD', KEYS[i], seq, ARGV[3])
+end
+if ARGV[5] == '0' then
+	redis.call('ZREM', KEYS[4], ARGV[3])
+elseif ARGV[5] ~= '' then
+	redis.call('ZADD', KEYS[4], 'NX', ARGV[5], ARGV[3])
+end
+return 1
+`
+
+// deleteScript delete the document when it is not changed since read, and remove it from indexes.
+// KEYS: document, indexes...
+// ARGV: expected document, member, unique key(empty means none)
+const deleteScript = `
+local cur = redis.call('GET', KEYS[1])
+if cur and cur ~= ARGV[1] then return -2 end
+redis.call('DEL', KEYS[1])
+if ARGV[3] ~= '' then
+	redis.call('DEL', ARGV[3])
+end
+for i = 2, #KEYS do
+	redis.call('ZREM', KEYS[i], ARGV[2])
+end
+return 1
+`
+
+// acquireLeaseScript KEYS: lease, index of leases. ARGV: holder, ttl in milliseconds, lease key
+const acquireLeaseScript = `
+local cur = redis.call('GET', KEYS[1])
+if cur and cur ~= ARGV[1] then return 0 end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+redis.call('ZADD', KEYS[2], 0, ARGV[3])
+return 1
+`
+
+// releaseLeaseScript KEYS: lease, index of leases. ARGV: holder, lease key
+const releaseLeaseScript = `
+if redis.call('GET', KEYS[1]) ~= ARGV[1] then return 0 end
+redis.call('DEL', KEYS[1])
+redis.call('ZREM', KEYS[2], ARGV[2])
+return 1
+`
+
+// incrScript KEYS: counter. ARGV: expire time in milliseconds
+const incrScript = `
+local n = redis.call('INCR', KEYS[1])
+if n == 1 then redis.call('PEXPIREAT', KEYS[1], ARGV[1]) end
+return n
+`
+
+// NewStore
+func NewStore(option *StoreOption) *Store {
+	return &Store{
+		opt:     option,
+		closeCh: make(chan struct{}),
+	}
+}
+
+// Init store
+func (s *Store) Init() error {
+	s.readOpt()
+	store.InitFlakeGenerator()
+	s.c = newClient(s.opt)
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.opt.Timeout)
+	defer cancel()
+	if _, err := s.c.do(ctx, "PING"); err != nil {
+		return fmt.Errorf("ping redis failed: %w", err)
+	}
+
+	if s.opt.FinishedDagInsTTL > 0 {
+		s.wg.Add(1)
+		go s.goCompact()
+	}
+	return nil
+}
+
+func (s *Store) readOpt() {
+	if s.opt.Addr == "" {
+		s.opt.Addr = "127.0.0.1:6379"
+	}
+	if s.opt.Timeout == 0 {
+		s.opt.Timeout = 5 * time.Second
+	}
+	if s.opt.PoolSize == 0 {
+		s.opt.PoolSize = 10
+	}
+	if s.opt.Prefix == "" {
+		s.opt.Prefix = "fastflow"
+	}
+	if s.opt.CompactInterval == 0 {
+		s.opt.CompactInterval = time.Minute
+	}
+	s.keys = &keys{prefix: s.opt.Prefix}
+}
+
+// Close component when we not use it anymore
+func (s *Store) Close() {
+	close(s.closeCh)
+	s.wg.Wait()
+	s.c.close()
+}
+
+func (s *Store) goCompact() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.opt.CompactInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.closeCh:
+			return
+		case <-ticker.C:
+			if err := s.Compact(); err != nil {
+				log.Errorf("compact finished dag instances failed: %s", err)
+			}
+		}
+	}
+}
+
+// Compact remove the dag instances which finished before FinishedDagInsTTL and their task instances,
+// it runs periodically when FinishedDagInsTTL is set
+func (s *Store) Compact() error {
+	end := time.Now().Add(-s.opt.FinishedDagInsTTL).Unix()
+	for {
+		ctx, cancel := context.WithTimeout(context.TODO(), s.opt.Timeout)
+		ret, err := s.c.do(ctx, "ZRANGEBYSCORE", s.keys.finished(), "-inf", end, "LIMIT", 0, compactBatch)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("list finished dag instances failed: %w", err)
+		}
+		ids := replyStrings(ret)
+		for _, id := range ids {
+			if err := s.compactDagIns(id); err != nil {
+				return err
+			}
+		}
+		if len(ids) < compactBatch {
+			return nil
+		}
+	}
+}
+
+func (s *Store) compactDagIns(id string) error {
+	ctx, cancel := context.WithTimeout(context.TODO(), s.opt.Timeout)
+	defer cancel()
+
+	ret, err := s.c.do(ctx, "ZRANGE", s.keys.taskInsOfDagIns(id), 0, -1)
+	if err != nil {
+		return fmt.Errorf("list task instances of dag instance[ %s ] failed: %w", id, err)
+	}
+	taskInsIDs := replyStrings(ret)
+	for _, taskInsID := range taskInsIDs {
+		if _, err := s.c.do(ctx, "DEL", s.keys.taskLog(taskInsID)); err != nil {
+			return fmt.Errorf("delete logs of task instance[ %s ] failed: %w", taskInsID, err)
+		}
+	}
+	if err := s.genericBatchDelete(taskInsIDs, kindTaskIns); err != nil {
+		return err
+	}
+	return s.genericBatchDelete([]string{id}, kindDagIns)
+}
+
+// CreateDag
+func (s *Store) CreateDag(dag *entity.Dag) error {
+	// check task's connection
+	_, err := mod.BuildRootNode(mod.MapTasksToGetter(dag.Tasks))
+	if err != nil {
+		return err
+	}
+	return s.genericCreate(dag, kindDag)
+}
+
+// CreateDagIns
+func (s *Store) CreateDagIns(dagIns *entity.DagInstance) error {
+	return s.genericCreate(dagIns, kindDagIns)
+}
+
+// BatchCreatTaskIns
+func (s *Store) BatchCreatTaskIns(taskIns []*entity.TaskInstance) error {
+	for i := range taskIns {
+		if err := s.genericCreate(taskIns[i], kindTaskIns); err != nil {
+			return fmt.Errorf("insert task instance failed: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *Store) genericCreate(input entity.BaseInfoGetter, kind string) error {
+	baseInfo := input.GetBaseInfo()
+	baseInfo.Initial()
+	bs, err := json.Marshal(input)
+	if err != nil {
+		return fmt.Errorf("marshal %s failed: %w", kind, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.TODO(), s.opt.Timeout)
+	defer cancel()
+	ret, err := s.write(ctx, kind, baseInfo.ID, "", string(bs))
+	if err != nil {
+		return fmt.Errorf("insert %s failed: %w", kind, err)
+	}
+	switch ret {
+	case 0:
+		return fmt.Errorf("%s key[ %s ] already existed: %w", kind, baseInfo.ID, data.ErrDataConflicted)
+	case -3:
+		return fmt.Errorf("%s key[ %s ] has the idempotency key of others: %w",
+			kind, baseInfo.ID, data.ErrIdempotencyKeyConflicted)
+	}
+	return nil
+}
+
+// write run writeScript, it returns 1 when succeed, 0 when the creating document existed,
+// -1 when the updating document not found, -2 when the document is changed
+// and -3 when the unique key is held by another document
+func (s *Store) write(ctx context.Context, kind, id, expected, doc string) (int64, error) {
+	olds, err := s.keys.indexes(kind, expected)
+	if err != nil {
+		return 0, err
+	}
+	news, err := s.keys.indexes(kind, doc)
+	if err != nil {
+		return 0, err
+	}
+
+	ks := []string{s.keys.doc(kind, id), s.keys.seq(), s.keys.all(kind), s.keys.finished()}
+	ks = append(append(ks, olds...), news...)
+	args := []interface{}{"EVAL", writeScript, len(ks)}
+	for _, k := range ks {
+		args = append(args, k)
+	}
+	args = append(args, expected, doc, id, len(olds), finishedArg(kind, doc),
+		s.keys.unique(kind, expected), s.keys.unique(kind, doc))
+	ret, err := s.c.do(ctx, args...)
+	if err != nil {
+		return 0, err
+	}
+	return replyInt(ret), nil
+}
+
+// modify read the document and write the modified one back, it retries when the document is changed
+// by others in the meantime
+func (s *Store) modify(kind, id string, fn func(cur string) (interface{}, error)) error {
+	ctx, cancel := context.WithTimeout(context.TODO(), s.opt.Timeout)
+	defer cancel()
+
+	for i := 0; i < maxWriteRetry; i++ {
+		ret, err := s.c.do(ctx, "GET", s.keys.doc(kind, id))
+		if err != nil {
+			return err
+		}
+		cur, ok := ret.(string)
+		if !ok {
+			return fmt.Errorf("%s key[ %s ] not found: %w", kind, id, data.ErrDataNotFound)
+		}
+		doc, err := fn(cur)
+		if err != nil {
+			return err
+		}
+		bs, err := json.Marshal(doc)
+		if err != nil {
+			return fmt.Errorf("marshal %s failed: %w", kind, err)
+		}
+
+		n, err := s.write(ctx, kind, id, cur, string(bs))
+		if err != nil {
+			return err
+		}
+		switch n {
+		case 1:
+			return nil
+		case -1:
+			return fmt.Errorf("%s key[ %s ] not found: %w", kind, id, data.ErrDataNotFound)
+		case -3:
+			return fmt.Errorf("%s key[ %s ] has the idempotency key of others: %w",
+				kind, id, data.ErrIdempotencyKeyConflicted)
+		}
+	}
+	return fmt.Errorf("%s key[ %s ] is changed by others too frequently: %w", kind, id, data.ErrDataConflicted)
+}
+
+// PatchTaskIns
+func (s *Store) PatchTaskIns(taskIns *entity.TaskInstance) error {
+	if taskIns.ID == "" {
+		return fmt.Errorf("id cannot be empty")
+	}
+	err := s.modify(kindTaskIns, taskIns.ID, func(cur string) (interface{}, error) {
+		old := new(entity.TaskInstance)
+		if err := json.Unmarshal([]byte(cur), old); err != nil {
+			return nil, fmt.Errorf("decode task instance failed: %w", err)
+		}
+		mod.ApplyTaskInsPatch(old, taskIns)
+		return old, nil
+	})
+	if err != nil {
+		return fmt.Errorf("patch task instance failed: %w", err)
+	}
+	return nil
+}
+
+// PatchDagIns
+func (s *Store) PatchDagIns(dagIns *entity.DagInstance, mustsPatchFields ...string) error {
+	err := s.modify(kindDagIns, dagIns.ID, func(cur string) (interface{}, error) {
+		old := new(entity.DagInstance)
+		if err := json.Unmarshal([]byte(cur), old); err != nil {
+			return nil, fmt.Errorf("decode dag instance failed: %w", err)
+		}
+		mod.ApplyDagInsPatch(old, dagIns, mustsPatchFields...)
+		return old, nil
+	})
+	if err != nil {
+		return fmt.Errorf("patch dag instance failed: %w", err)
+	}
+
+	goevent.Publish(&event.DagInstancePatched{
+		Payload:         dagIns,
+		MustPatchFields: mustsPatchFields,
+	})
+	return nil
+}
+
+// UpdateDag
+func (s *Store) UpdateDag(dag *entity.Dag) error {
+	// check task's connection
+	_, err := mod.BuildRootNode(mod.MapTasksToGetter(dag.Tasks))
+	if err != nil {
+		return err
+	}
+	return s.genericUpdate(dag, kindDag)
+}
+
+// UpdateDagIns
+func (s *Store) UpdateDagIns(dagIns *entity.DagInstance) error {
+	if err := s.genericUpdate(dagIns, kindDagIns); err != nil {
+		return err
+	}
+
+	goevent.Publish(&event.DagInstanceUpdated{Payload: dagIns})
+	return nil
+}
+
+// UpdateTaskIns
+func (s *Store) UpdateTaskIns(taskIns *entity.TaskInstance) error {
+	return s.genericUpdate(taskIns, kindTaskIns)
+}
+
+// genericUpdate replace the whole document, it still compares with the read one to move it between indexes
+func (s *Store) genericUpdate(input entity.BaseInfoGetter, kind string) error {
+	baseInfo := input.GetBaseInfo()
+	baseInfo.Update()
+	if err := s.modify(kind, baseInfo.ID, func(string) (interface{}, error) {
+		return input, nil
+	}); err != nil {
+		if errors.Is(err, data.ErrDataNotFound) {
+			return fmt.Errorf("%s has no key[ %s ] to update: %w", kind, baseInfo.ID, data.ErrDataNotFound)
+		}
+		return fmt.Errorf("update %s failed: %w", kind, err)
+	}
+	return nil
+}
+
+// BatchUpdateDagIns
+func (s *Store) BatchUpdateDagIns(dagIns []*entity.DagInstance) error {
+	for i := range dagIns {
+		if err := s.genericUpdate(dagIns[i], kindDagIns); err != nil {
+			return fmt.Errorf("batch update dag instance failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// BatchUpdateTaskIns
+func (s *Store) BatchUpdateTaskIns(taskIns []*entity.TaskInstance) error {
+	for i := range taskIns {
+		if err := s.genericUpdate(taskIns[i], kindTaskIns); err != nil {
+			return fmt.Errorf("batch update task instance failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// GetTaskIns
+func (s *Store) GetTaskIns(taskInsId string) (*entity.TaskInstance, error) {
+	ret := new(entity.TaskInstance)
+	if err := s.genericGet(kindTaskIns, taskInsId, ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// GetDag
+func (s *Store) GetDag(dagId string) (*entity.Dag, error) {
+	ret := new(entity.Dag)
+	if err := s.genericGet(kindDag, dagId, ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// GetDagInstance
+func (s *Store) GetDagInstance(dagInsId string) (*entity.DagInstance, error) {
+	ret := new(entity.DagInstance)
+	if err := s.genericGet(kindDagIns, dagInsId, ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (s *Store) genericGet(kind, id string, ret interface{}) error {
+	ctx, cancel := context.WithTimeout(context.TODO(), s.opt.Timeout)
+	defer cancel()
+
+	v, err := s.c.do(ctx, "GET", s.keys.doc(kind, id))
+	if err != nil {
+		return fmt.Errorf("get %s failed: %w", kind, err)
+	}
+	doc, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("%s key[ %s ] not found: %w", kind, id, data.ErrDataNotFound)
+	}
+	if err := json.Unmarshal([]byte(doc), ret); err != nil {
+		return fmt.Errorf("decode %s failed: %w", kind, err)
+	}
+	return nil
+}
+
+// members return the members of index sets in the order of sequence
+func (s *Store) members(ctx context.Context, sets ...string) ([]string, error) {
+	type member struct {
+		id  string
+		seq float64
+	}
+	var ms []member
+	for _, set := range sets {
+		ret, err := s.c.do(ctx, "ZRANGE", set, 0, -1, "WITHSCORES")
+		if err != nil {
+			return nil, fmt.Errorf("list index failed: %w", err)
+		}
+		strs := replyStrings(ret)
+		for i := 0; i+1 < len(strs); i += 2 {
+			seq, _ := strconv.ParseFloat(strs[i+1], 64)
+			ms = append(ms, member{id: strs[i], seq: seq})
+		}
+	}
+	sort.SliceStable(ms, func(i, j int) bool {
+		return ms[i].seq < ms[j].seq
+	})
+	ids := make([]string, len(ms))
+	for i := range ms {
+		ids[i] = ms[i].id
+	}
+	return ids, nil
+}
+
+// docs get the documents of ids in order, the missing documents are skipped
+func (s *Store) docs(ctx context.Context, kind string, ids []string) ([]string, error) {
+	var ret []string
+	for start := 0; start < len(ids); start += mgetBatch {
+		end := start + mgetBatch
+		if end > len(ids) {
+			end = len(ids)
+		}
+		args := []interface{}{"MGET"}
+		for _, id := range ids[start:end] {
+			args = append(args, s.keys.doc(kind, id))
+		}
+		v, err := s.c.do(ctx, args...)
+		if err != nil {
+			return nil, fmt.Errorf("get %s failed: %w", kind, err)
+		}
+		for _, doc := range replyStrings(v) {
+			if doc != "" {
+				ret = append(ret, doc)
+			}
+		}
+	}
+	return ret, nil
+}
+
+// ListDag
+func (s *Store) ListDag(input *mod.ListDagInput) ([]*entity.Dag, error) {
+	ctx, cancel := context.WithTimeout(context.TODO(), s.opt.Timeout)
+	defer cancel()
+
+	ids, err := s.members(ctx, s.keys.all(kindDag))
+	if err != nil {
+		return nil, err
+	}
+	if input != nil && input.IDPrefix != "" {
+		var matched []string
+		for _, id := range ids {
+			if strings.HasPrefix(id, input.IDPrefix) {
+				matched = append(matched, id)
+			}
+		}
+		ids = matched
+	}
+	docs, err := s.docs(ctx, kindDag, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []*entity.Dag
+	for _, doc := range docs {
+		dag := new(entity.Dag)
+		if err := json.Unmarshal([]byte(doc), dag); err != nil {
+			return nil, fmt.Errorf("decode dag failed: %w", err)
+		}
+		ret = append(ret, dag)
+	}
+	return ret, nil
+}
+
+// ListDagInstance
+func (s *Store) ListDagInstance(input *mod.ListDagInstanceInput) ([]*entity.DagInstance, error) {
+	ctx, cancel := context.WithTimeout(context.TODO(), s.opt.Timeout)
+	defer cancel()
+
+	sets := []string{s.keys.all(kindDagIns)}
+	if len(input.Status) > 0 {
+		sets = nil
+		for _, status := range input.Status {
+			sets = append(sets, s.keys.dagInsStatus(string(status)))
+		}
+	}
+	ids, err := s.members(ctx, sets...)
+	if err != nil {
+		return nil, err
+	}
+	docs, err := s.docs(ctx, kindDagIns, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	var matched []*entity.DagInstance
+	for _, doc := range docs {
+		dagIns := new(entity.DagInstance)
+		if err := json.Unmarshal([]byte(doc), dagIns); err != nil {
+			return nil, fmt.Errorf("decode dag instance failed: %w", err)
+		}
+		if input.Match(dagIns) {
+			matched = append(matched, dagIns)
+		}
+	}
+	if input.SortByPriority {
+		sort.SliceStable(matched, func(i, j int) bool {
+			if matched[i].Priority != matched[j].Priority {
+				return matched[i].Priority > matched[j].Priority
+			}
+			return matched[i].CreatedAt < matched[j].CreatedAt
+		})
+	}
+
+	if input.Offset >= int64(len(matched)) {
+		return nil, nil
+	}
+	matched = matched[input.Offset:]
+	if input.Limit > 0 && int64(len(matched)) > input.Limit {
+		matched = matched[:input.Limit]
+	}
+	return matched, nil
+}
+
+// ListTaskInstance
+func (s *Store) ListTaskInstance(input *mod.ListTaskInstanceInput) ([]*entity.TaskInstance, error) {
+	ctx, cancel := context.WithTimeout(context.TODO(), s.opt.Timeout)
+	defer cancel()
+
+	ids := input.IDs
+	if len(ids) == 0 {
+		set := s.keys.all(kindTaskIns)
+		if input.DagInsID != "" {
+			set = s.keys.taskInsOfDagIns(input.DagInsID)
+		}
+		var err error
+		if ids, err = s.members(ctx, set); err != nil {
+			return nil, err
+		}
+	}
+	docs, err := s.docs(ctx, kindTaskIns, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []*entity.TaskInstance
+	for _, doc := range docs {
+		taskIns := new(entity.TaskInstance)
+		if err := json.Unmarshal([]byte(doc), taskIns); err != nil {
+			return nil, fmt.Errorf("decode task instance failed: %w", err)
+		}
+		if input.Match(taskIns) {
+			ret = append(ret, taskIns)
+		}
+	}
+	return input.Page(ret), nil
+}
+
+// BatchDeleteDag
+func (s *Store) BatchDeleteDag(ids []string) error {
+	return s.genericBatchDelete(ids, kindDag)
+}
+
+// BatchDeleteDagIns
+func (s *Store) BatchDeleteDagIns(ids []string) error {
+	return s.genericBatchDelete(ids, kindDagIns)
+}
+
+// BatchDeleteTaskIns
+func (s *Store) BatchDeleteTaskIns(ids []string) error {
+	return s.genericBatchDelete(ids, kindTaskIns)
+}
+
+func (s *Store) genericBatchDelete(ids []string, kind string) error {
+	for _, id := range ids {
+		if err := s.delete(kind, id); err != nil {
+			return fmt.Errorf("delete failed: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *Store) delete(kind, id string) error {
+	ctx, cancel := context.WithTimeout(context.TODO(), s.opt.Timeout)
+	defer cancel()
+
+	for i := 0; i < maxWriteRetry; i++ {
+		ret, err := s.c.do(ctx, "GET", s.keys.doc(kind, id))
+		if err != nil {
+			return err
+		}
+		cur, _ := ret.(string)
+		idx, err := s.keys.indexes(kind, cur)
+		if err != nil {
+			return err
+		}
+
+		ks := append([]string{s.keys.doc(kind, id), s.keys.all(kind)}, idx...)
+		if kind == kindDagIns {
+			ks = append(ks, s.keys.finished())
+		}
+		args := []interface{}{"EVAL", deleteScript, len(ks)}
+		for _, k := range ks {
+			args = append(args, k)
+		}
+		args = append(args, cur, id, s.keys.unique(kind, cur))
+		ret, err = s.c.do(ctx, args...)
+		if err != nil {
+			return err
+		}
+		if replyInt(ret) == 1 {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s key[ %s ] is changed by others too frequently: %w", kind, id, data.ErrDataConflicted)
+}
+
+// errClaimLost is returned by the modification of claiming when the task instance is not claimable
+var errClaimLost = errors.New("task instance is not claimable")
+
+// ClaimTaskIns
+func (s *Store) ClaimTaskIns(taskInsID, worker string, ttl time.Duration) (bool, error) {
+	err := s.modify(kindTaskIns, taskInsID, func(cur string) (interface{}, error) {
+		old := new(entity.TaskInstance)
+		if err := json.Unmarshal([]byte(cur), old); err != nil {
+			return nil, fmt.Errorf("decode task instance failed: %w", err)
+		}
+		if !mod.ApplyTaskInsClaim(old, worker, ttl) {
+			return nil, errClaimLost
+		}
+		return old, nil
+	})
+	if errors.Is(err, errClaimLost) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("claim task instance failed: %w", err)
+	}
+	return true, nil
+}
+
+// errRetryCountChanged is returned by the modification of swapping when the retry count is changed by others
+var errRetryCountChanged = errors.New("retry count is changed")
+
+// SwapRetryCount
+func (s *Store) SwapRetryCount(dagInsID string, oldCount, newCount int) (bool, error) {
+	err := s.modify(kindDagIns, dagInsID, func(cur string) (interface{}, error) {
+		old := new(entity.DagInstance)
+		if err := json.Unmarshal([]byte(cur), old); err != nil {
+			return nil, fmt.Errorf("decode dag instance failed: %w", err)
+		}
+		if !mod.ApplyRetryCountSwap(old, oldCount, newCount) {
+			return nil, errRetryCountChanged
+		}
+		return old, nil
+	})
+	if errors.Is(err, errRetryCountChanged) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("swap retry count failed: %w", err)
+	}
+	return true, nil
+}
+
+// AcquireLease
+func (s *Store) AcquireLease(key, holder string, ttl time.Duration) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.TODO(), s.opt.Timeout)
+	defer cancel()
+
+	ms := ttl.Milliseconds()
+	if ms < 1 {
+		ms = 1
+	}
+	ret, err := s.c.do(ctx, "EVAL", acquireLeaseScript, 2, s.keys.lease(key), s.keys.leases(), holder, ms, key)
+	if err != nil {
+		return false, fmt.Errorf("acquire lease failed: %w", err)
+	}
+	return replyInt(ret) == 1, nil
+}
+
+// ReleaseLease
+func (s *Store) ReleaseLease(key, holder string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.TODO(), s.opt.Timeout)
+	defer cancel()
+
+	ret, err := s.c.do(ctx, "EVAL", releaseLeaseScript, 2, s.keys.lease(key), s.keys.leases(), holder, key)
+	if err != nil {
+		return false, fmt.Errorf("release lease failed: %w", err)
+	}
+	return replyInt(ret) == 1, nil
+}
+
+// ListLease, the expired leases are removed from index when listing
+func (s *Store) ListLease(prefix string) ([]*mod.Lease, error) {
+	ctx, cancel := context.WithTimeout(context.TODO(), s.opt.Timeout)
+	defer cancel()
+
+	min, max := "-", "+"
+	if prefix != "" {
+		// 0xff never appears in utf-8, so it is greater than any key which has the prefix
+		min, max = "["+prefix, "["+prefix+"\xff"
+	}
+	ret, err := s.c.do(ctx, "ZRANGEBYLEX", s.keys.leases(), min, max)
+	if err != nil {
+		return nil, fmt.Errorf("list lease failed: %w", err)
+	}
+
+	var leases []*mod.Lease
+	for _, key := range replyStrings(ret) {
+		holder, err := s.c.do(ctx, "GET", s.keys.lease(key))
+		if err != nil {
+			return nil, fmt.Errorf("get lease failed: %w", err)
+		}
+		pttl, err := s.c.do(ctx, "PTTL", s.keys.lease(key))
+		if err != nil {
+			return nil, fmt.Errorf("get lease ttl failed: %w", err)
+		}
+		h, ok := holder.(string)
+		if !ok || replyInt(pttl) <= 0 {
+			if _, err := s.c.do(ctx, "ZREM", s.keys.leases(), key); err != nil {
+				return nil, fmt.Errorf("remove expired lease failed: %w", err)
+			}
+			continue
+		}
+		leases = append(leases, &mod.Lease{
+			Key:       key,
+			Holder:    h,
+			ExpiredAt: time.Now().Add(time.Duration(replyInt(pttl)) * time.Millisecond),
+		})
+	}
+	return leases, nil
+}
+
+// GetClusterConfig
+func (s *Store) GetClusterConfig() (*entity.ClusterConfig, error) {
+	ctx, cancel := context.WithTimeout(context.TODO(), s.opt.Timeout)
+	defer cancel()
+
+	v, err := s.c.do(ctx, "GET", s.keys.config())
+	if err != nil {
+		return nil, fmt.Errorf("get cluster config failed: %w", err)
+	}
+	doc, ok := v.(string)
+	if !ok {
+		return nil, fmt.Errorf("cluster config not found: %w", data.ErrDataNotFound)
+	}
+	cfg := &entity.ClusterConfig{}
+	if err := json.Unmarshal([]byte(doc), cfg); err != nil {
+		return nil, fmt.Errorf("unmarshal cluster config failed: %w", err)
+	}
+	return cfg, nil
+}
+
+// SaveClusterConfig
+func (s *Store) SaveClusterConfig(cfg *entity.ClusterConfig) error {
+	bs, err := json.Marshal(cfg)
+	if err != nil {
+		return fmt.Errorf("marshal cluster config failed: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.TODO(), s.opt.Timeout)
+	defer cancel()
+	if _, err := s.c.do(ctx, "SET", s.keys.config(), bs); err != nil {
+		return fmt.Errorf("save cluster config failed: %w", err)
+	}
+	return nil
+}
+
+// workerInfoRetention is how long the info of a worker is kept after its last report
+const workerInfoRetention = 24 * time.Hour
+
+// SaveWorkerInfo
+func (s *Store) SaveWorkerInfo(info *entity.WorkerInfo) error {
+	bs, err := json.Marshal(info)
+	if err != nil {
+		return fmt.Errorf("marshal worker info failed: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.TODO(), s.opt.Timeout)
+	defer cancel()
+	if _, err := s.c.do(ctx, "SET", s.keys.worker(info.Key), bs,
+		"EX", int64(workerInfoRetention/time.Second)); err != nil {
+		return fmt.Errorf("save worker info failed: %w", err)
+	}
+	if _, err := s.c.do(ctx, "ZADD", s.keys.workers(), 0, info.Key); err != nil {
+		return fmt.Errorf("index worker info failed: %w", err)
+	}
+	return nil
+}
+
+// ListWorkerInfo, the expired infos are removed from index when listing
+func (s *Store) ListWorkerInfo() ([]*entity.WorkerInfo, error) {
+	ctx, cancel := context.WithTimeout(context.TODO(), s.opt.Timeout)
+	defer cancel()
+
+	// members have the same score, so they are sorted by key
+	ret, err := s.c.do(ctx, "ZRANGE", s.keys.workers(), 0, -1)
+	if err != nil {
+		return nil, fmt.Errorf("list worker info failed: %w", err)
+	}
+	var infos []*entity.WorkerInfo
+	for _, key := range replyStrings(ret) {
+		v, err := s.c.do(ctx, "GET", s.keys.worker(key))
+		if err != nil {
+			return nil, fmt.Errorf("get worker info failed: %w", err)
+		}
+		doc, ok := v.(string)
+		if !ok {
+			if _, err := s.c.do(ctx, "ZREM", s.keys.workers(), key); err != nil {
+				return nil, fmt.Errorf("remove expired worker info failed: %w", err)
+			}
+			continue
+		}
+		info := &entity.WorkerInfo{}
+		if err := json.Unmarshal([]byte(doc), info); err != nil {
+			return nil, fmt.Errorf("unmarshal worker info failed: %w", err)
+		}
+		// alive is not persisted
+		info.Alive = false
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// IncrRateLimitCounter
+func (s *Store) IncrRateLimitCounter(key string, windowStart time.Time, window time.Duration) (int, error) {
+	ctx, cancel := context.WithTimeout(context.TODO(), s.opt.Timeout)
+	defer cancel()
+
+	id := fmt.Sprintf("%s@%d", key, windowStart.UnixNano())
+	ret, err := s.c.do(ctx, "EVAL", incrScript, 1, s.keys.rateLimit(id), windowStart.Add(window).UnixMilli())
+	if err != nil {
+		return 0, fmt.Errorf("increase rate limit counter failed: %w", err)
+	}
+	return int(replyInt(ret)), nil
+}
+
+// AppendTaskLogs, the logs are kept in a sorted set scored by seq
+func (s *Store) AppendTaskLogs(taskInsID string, logs []*entity.TaskLog, maxLines int) error {
+	if len(logs) == 0 {
+		return nil
+	}
+	args := []interface{}{"ZADD", s.keys.taskLog(taskInsID)}
+	for _, l := range logs {
+		bs, err := json.Marshal(l)
+		if err != nil {
+			return fmt.Errorf("marshal task log failed: %w", err)
+		}
+		args = append(args, l.Seq, bs)
+	}
+
+	ctx, cancel := context.WithTimeout(context.TODO(), s.opt.Timeout)
+	defer cancel()
+	if _, err := s.c.do(ctx, args...); err != nil {
+		return fmt.Errorf("append task logs failed: %w", err)
+	}
+	if maxLines <= 0 {
+		return nil
+	}
+	// rotate out the logs older than the latest maxLines ones
+	if _, err := s.c.do(ctx, "ZREMRANGEBYRANK", s.keys.taskLog(taskInsID), 0, -maxLines-1); err != nil {
+		return fmt.Errorf("delete rotated task logs failed: %w", err)
+	}
+	return nil
+}
+
+// GetTaskLogs
+func (s *Store) GetTaskLogs(taskInsID string, cursor int64, limit int) ([]*entity.TaskLog, error) {
+	ctx, cancel := context.WithTimeout(context.TODO(), s.opt.Timeout)
+	defer cancel()
+
+	args := []interface{}{"ZRANGEBYSCORE", s.keys.taskLog(taskInsID), fmt.Sprintf("(%d", cursor), "+inf"}
+	if limit > 0 {
+		args = append(args, "LIMIT", 0, limit)
+	}
+	ret, err := s.c.do(ctx, args...)
+	if err != nil {
+		return nil, fmt.Errorf("get task logs failed: %w", err)
+	}
+	logs := []*entity.TaskLog{}
+	for _, doc := range replyStrings(ret) {
+		l := &entity.TaskLog{}
+		if err := json.Unmarshal([]byte(doc), l); err != nil {
+			return nil, fmt.Errorf("unmarshal task log failed: %w", err)
+		}
+		logs = append(logs, l)
+	}
+	return logs, nil
+}
+
+// Marshal
+func (s *Store) Marshal(obj interface{}) ([]byte, error) {
+	return json.Marshal(obj)
+}
+
+// Unmarshal
+func (s *Store) Unmarshal(bytes []byte, ptr interface{}) error {
+	return json.Unmarshal(bytes, ptr)
+}
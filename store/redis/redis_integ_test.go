@@ -0,0 +1,101 @@
+//go:build integration
+// +build integration
+
+package redis
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/mod"
+	"github.com/etherealiy/fastflow/store/storetest"
+	"github.com/stretchr/testify/assert"
+)
+
+var redisAddr = "127.0.0.1:6379"
+
+func newTestStore(t *testing.T, opt *StoreOption) *Store {
+	opt.Addr = redisAddr
+	opt.Prefix = fmt.Sprintf("integ-%d", time.Now().UnixNano())
+	s := NewStore(opt)
+	if err := s.Init(); err != nil {
+		t.Skipf("redis is not available: %s", err)
+	}
+	return s
+}
+
+func TestConformance(t *testing.T) {
+	s := newTestStore(t, &StoreOption{})
+	defer s.Close()
+	storetest.RunConformance(t, s)
+}
+
+func TestStore_Compact(t *testing.T) {
+	s := newTestStore(t, &StoreOption{FinishedDagInsTTL: time.Second, CompactInterval: time.Hour})
+	defer s.Close()
+
+	finished := &entity.DagInstance{Status: entity.DagInstanceStatusRunning}
+	running := &entity.DagInstance{Status: entity.DagInstanceStatusRunning}
+	assert.NoError(t, s.CreateDagIns(finished))
+	assert.NoError(t, s.CreateDagIns(running))
+	assert.NoError(t, s.BatchCreatTaskIns([]*entity.TaskInstance{
+		{DagInsID: finished.ID, TaskID: "t1"},
+		{DagInsID: running.ID, TaskID: "t1"},
+	}))
+	assert.NoError(t, s.PatchDagIns(&entity.DagInstance{BaseInfo: entity.BaseInfo{ID: finished.ID}, Status: entity.DagInstanceStatusSuccess}))
+
+	time.Sleep(2 * time.Second)
+	assert.NoError(t, s.Compact())
+
+	dagIns, err := s.ListDagInstance(&mod.ListDagInstanceInput{})
+	assert.NoError(t, err)
+	if assert.Len(t, dagIns, 1) {
+		assert.Equal(t, running.ID, dagIns[0].ID)
+	}
+	taskIns, err := s.ListTaskInstance(&mod.ListTaskInstanceInput{})
+	assert.NoError(t, err)
+	if assert.Len(t, taskIns, 1) {
+		assert.Equal(t, running.ID, taskIns[0].DagInsID)
+	}
+}
+
+func TestListSource(t *testing.T) {
+	s := newTestStore(t, &StoreOption{})
+	defer s.Close()
+
+	key := s.opt.Prefix + ":events"
+	newSource := func() *ListSource {
+		src, err := NewListSource(&ListSourceOption{Addr: redisAddr, Key: key, Consumer: "c1"})
+		assert.NoError(t, err)
+		return src
+	}
+	ctx := context.Background()
+	_, err := s.c.do(ctx, "LPUSH", key, "e1", "e2")
+	assert.NoError(t, err)
+
+	src := newSource()
+	ev, err := src.Receive(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "e1", string(ev.Payload))
+	assert.NoError(t, src.Ack(ctx, ev))
+	ev, err = src.Receive(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "e2", string(ev.Payload))
+	assert.NoError(t, src.Close())
+
+	// the unacked event is redelivered after restarted
+	src = newSource()
+	defer src.Close()
+	ev, err = src.Receive(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "e2", string(ev.Payload))
+	assert.NoError(t, src.Ack(ctx, ev))
+
+	cancelCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	_, err = src.Receive(cancelCtx)
+	assert.Error(t, err)
+}
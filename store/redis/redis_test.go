@@ -0,0 +1,73 @@
+package redis
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeys_Indexes(t *testing.T) {
+	k := &keys{prefix: "ff"}
+	tests := []struct {
+		caseDesc string
+		giveKind string
+		giveDoc  string
+		wantIdx  []string
+		wantErr  bool
+	}{
+		{
+			caseDesc: "dag",
+			giveKind: kindDag,
+			giveDoc:  `{"id":"dag"}`,
+		},
+		{
+			caseDesc: "no doc",
+			giveKind: kindDagIns,
+		},
+		{
+			caseDesc: "dag instance",
+			giveKind: kindDagIns,
+			giveDoc:  `{"id":"ins","status":"running"}`,
+			wantIdx:  []string{"ff:idx:dagins:status:running"},
+		},
+		{
+			caseDesc: "task instance",
+			giveKind: kindTaskIns,
+			giveDoc:  `{"id":"task","dagInsId":"ins"}`,
+			wantIdx:  []string{"ff:idx:taskins:dagins:ins"},
+		},
+		{
+			caseDesc: "invalid doc",
+			giveKind: kindTaskIns,
+			giveDoc:  `{`,
+			wantErr:  true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			idx, err := k.indexes(tc.giveKind, tc.giveDoc)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantIdx, idx)
+		})
+	}
+}
+
+func TestFinishedArg(t *testing.T) {
+	assert.Equal(t, "", finishedArg(kindTaskIns, `{"status":"success"}`))
+	assert.Equal(t, "0", finishedArg(kindDagIns, `{"status":"running"}`))
+	assert.NotEqual(t, "0", finishedArg(kindDagIns, `{"status":"success"}`))
+	assert.NotEqual(t, "0", finishedArg(kindDagIns, `{"status":"failed"}`))
+}
+
+func TestKeys_Unique(t *testing.T) {
+	k := &keys{prefix: "ff"}
+	assert.Equal(t, "", k.unique(kindDagIns, ""))
+	assert.Equal(t, "", k.unique(kindDagIns, `{"id":"ins","dagId":"dag"}`))
+	assert.Equal(t, "", k.unique(kindTaskIns, `{"id":"task","idempotencyKey":"key"}`))
+	assert.Equal(t, "ff:idempotency:dag:key", k.unique(kindDagIns, `{"id":"ins","dagId":"dag","idempotencyKey":"key"}`))
+}
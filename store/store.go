@@ -24,20 +24,21 @@ func InitFlakeGenerator() {
 	generator = sonyflake.NewSonyflake(sonyflake.Settings{})
 }
 
-//func InitFlakeGenerator(machineId uint16) {
-//	mutex.Lock()
-//	defer mutex.Unlock()
-//
-//	if generator != nil {
-//		return
-//	}
-//
-//	generator = sonyflake.NewSonyflake(sonyflake.Settings{
-//		MachineID: func() (uint16, error) {
-//			return machineId, nil
-//		},
-//	})
-//}
+// InitFlakeGeneratorWithMachineID 单实例，使用指定的 machine id，用于无法从私有 IP 推断 machine id 的环境
+func InitFlakeGeneratorWithMachineID(machineID uint16) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if generator != nil {
+		return
+	}
+
+	generator = sonyflake.NewSonyflake(sonyflake.Settings{
+		MachineID: func() (uint16, error) {
+			return machineID, nil
+		},
+	})
+}
 
 // NextID
 func NextID() uint64 {
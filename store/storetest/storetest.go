@@ -0,0 +1,1127 @@
+// Package storetest provides a conformance test suite for mod.Store implementations.
+// Third-party stores can verify their compatibility with fastflow by:
+//
+//	func TestConformance(t *testing.T) {
+//		st := NewStore(...)
+//		if err := st.Init(); err != nil {
+//			t.Fatal(err)
+//		}
+//		storetest.RunConformance(t, st)
+//	}
+//
+// All data created by the suite use random ids, so it can run against a store which already has data.
+package storetest
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/etherealiy/fastflow/pkg/entity"
+	"github.com/etherealiy/fastflow/pkg/entity/run"
+	"github.com/etherealiy/fastflow/pkg/mod"
+	"github.com/etherealiy/fastflow/pkg/utils/data"
+	"github.com/stretchr/testify/assert"
+)
+
+// Concurrency is the number of goroutines used by concurrency cases
+var Concurrency = 20
+
+// RunConformance run all conformance cases against the store, the store should be initialized
+func RunConformance(t *testing.T, st mod.Store) {
+	prefix := "conformance-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	t.Run("Dag", func(t *testing.T) {
+		testDag(t, st, prefix+"-dag")
+	})
+	t.Run("DagInstance", func(t *testing.T) {
+		testDagInstance(t, st, prefix+"-dagins")
+	})
+	t.Run("IdempotencyKey", func(t *testing.T) {
+		testIdempotencyKey(t, st, prefix+"-idempotency")
+	})
+	t.Run("TaskInstance", func(t *testing.T) {
+		testTaskInstance(t, st, prefix+"-taskins")
+	})
+	t.Run("Concurrency", func(t *testing.T) {
+		testConcurrency(t, st, prefix+"-concurrency")
+	})
+	t.Run("Marshal", func(t *testing.T) {
+		testMarshal(t, st)
+	})
+	if cs, ok := mod.StoreAs[mod.ClusterConfigStore](st); ok {
+		t.Run("ClusterConfig", func(t *testing.T) {
+			testClusterConfig(t, cs)
+		})
+	}
+	if ws, ok := mod.StoreAs[mod.WorkerInfoStore](st); ok {
+		t.Run("WorkerInfo", func(t *testing.T) {
+			testWorkerInfo(t, ws, prefix+"-worker")
+		})
+	}
+	if rs, ok := mod.StoreAs[mod.RateLimitStore](st); ok {
+		t.Run("RateLimit", func(t *testing.T) {
+			testRateLimit(t, rs, prefix+"-ratelimit")
+		})
+	}
+	if cs, ok := mod.StoreAs[mod.TaskInsClaimStore](st); ok {
+		t.Run("TaskInsClaim", func(t *testing.T) {
+			testTaskInsClaim(t, st, cs, prefix+"-claim")
+		})
+	}
+	if rs, ok := mod.StoreAs[mod.RetryCountStore](st); ok {
+		t.Run("RetryCount", func(t *testing.T) {
+			testRetryCount(t, st, rs, prefix+"-retrycount")
+		})
+	}
+	if ts, ok := mod.StoreAs[mod.TxStore](st); ok {
+		t.Run("Tx", func(t *testing.T) {
+			testTx(t, st, ts, prefix+"-tx")
+		})
+	}
+	if ls, ok := mod.StoreAs[mod.LeaseStore](st); ok {
+		t.Run("Lease", func(t *testing.T) {
+			testLease(t, ls, prefix+"-lease")
+		})
+	}
+	if ls, ok := mod.StoreAs[mod.TaskLogStore](st); ok {
+		t.Run("TaskLog", func(t *testing.T) {
+			testTaskLog(t, ls, prefix+"-tasklog")
+		})
+	}
+}
+
+func testDag(t *testing.T, st mod.Store, prefix string) {
+	dag := &entity.Dag{
+		BaseInfo: entity.BaseInfo{ID: prefix},
+		Name:     "conformance",
+		Status:   entity.DagStatusNormal,
+		Vars:     entity.DagVars{"key": {DefaultValue: "val"}},
+		Tasks: []entity.Task{
+			{ID: "task1", ActionName: "act"},
+			{ID: "task2", ActionName: "act", DependOn: []string{"task1"}},
+		},
+	}
+	if !assert.NoError(t, st.CreateDag(dag), "create dag") {
+		return
+	}
+	assert.Greater(t, dag.CreatedAt, int64(0), "created at should be initialed")
+	assert.Greater(t, dag.UpdatedAt, int64(0), "updated at should be initialed")
+
+	err := st.CreateDag(&entity.Dag{BaseInfo: entity.BaseInfo{ID: prefix}, Tasks: []entity.Task{{ID: "task1"}}})
+	assert.True(t, errors.Is(err, data.ErrDataConflicted), "create existed dag should return ErrDataConflicted, got: %v", err)
+
+	err = st.CreateDag(&entity.Dag{
+		BaseInfo: entity.BaseInfo{ID: prefix + "-cycle"},
+		Tasks: []entity.Task{
+			{ID: "task1", DependOn: []string{"task2"}},
+			{ID: "task2", DependOn: []string{"task1"}},
+		},
+	})
+	assert.Error(t, err, "create dag with cycle should be rejected")
+
+	ret, err := st.GetDag(prefix)
+	if !assert.NoError(t, err, "get dag") {
+		return
+	}
+	assert.Equal(t, dag.Name, ret.Name)
+	assert.Equal(t, entity.DagStatusNormal, ret.Status)
+	assert.Equal(t, "val", ret.Vars["key"].DefaultValue)
+	assert.Len(t, ret.Tasks, 2)
+	assert.Equal(t, []string{"task1"}, ret.Tasks[1].DependOn)
+
+	ret.Status = entity.DagStatusStopped
+	ret.Tasks = append(ret.Tasks, entity.Task{ID: "task3", ActionName: "act", DependOn: []string{"task2"}})
+	assert.NoError(t, st.UpdateDag(ret), "update dag")
+	ret, err = st.GetDag(prefix)
+	if assert.NoError(t, err) {
+		assert.Equal(t, entity.DagStatusStopped, ret.Status)
+		assert.Len(t, ret.Tasks, 3)
+	}
+
+	_, err = st.GetDag(prefix + "-not-existed")
+	assert.True(t, errors.Is(err, data.ErrDataNotFound), "get not existed dag should return ErrDataNotFound, got: %v", err)
+	err = st.UpdateDag(&entity.Dag{BaseInfo: entity.BaseInfo{ID: prefix + "-not-existed"}, Tasks: []entity.Task{{ID: "task1"}}})
+	assert.True(t, errors.Is(err, data.ErrDataNotFound), "update not existed dag should return ErrDataNotFound, got: %v", err)
+
+	// pruning is optional
+	pruneSt, ok := mod.StoreAs[mod.DagPruneStore](st)
+	if !ok {
+		return
+	}
+	assert.NoError(t, st.CreateDag(&entity.Dag{BaseInfo: entity.BaseInfo{ID: prefix + "-prune"}, Tasks: []entity.Task{{ID: "task1"}}}))
+	dags, err := pruneSt.ListDag(&mod.ListDagInput{IDPrefix: prefix + "-"})
+	if assert.NoError(t, err, "list dag by prefix") && assert.Len(t, dags, 1) {
+		assert.Equal(t, prefix+"-prune", dags[0].ID)
+	}
+	assert.NoError(t, pruneSt.BatchDeleteDag([]string{prefix + "-prune"}), "delete dag")
+	_, err = st.GetDag(prefix + "-prune")
+	assert.True(t, errors.Is(err, data.ErrDataNotFound), "get deleted dag should return ErrDataNotFound, got: %v", err)
+}
+
+func testDagInstance(t *testing.T, st mod.Store, prefix string) {
+	dagID := prefix + "-dag"
+	give := []*entity.DagInstance{
+		{
+			BaseInfo:  entity.BaseInfo{ID: prefix + "-1"},
+			DagID:     dagID,
+			Status:    entity.DagInstanceStatusInit,
+			Trigger:   entity.TriggerManually,
+			Vars:      entity.DagInstanceVars{"key": {Value: "val"}},
+			ShareData: &entity.ShareData{Dict: map[string]string{"share": "data"}},
+		},
+		{
+			BaseInfo: entity.BaseInfo{ID: prefix + "-2"},
+			DagID:    dagID,
+			Status:   entity.DagInstanceStatusRunning,
+			Worker:   prefix + "-worker1",
+			Trigger:  entity.TriggerWebhook,
+			TriggerMeta: &entity.TriggerMeta{
+				Source: prefix + "-source",
+			},
+			Labels:   map[string]string{"team": "infra", "env": "prod"},
+			Priority: 2,
+		},
+		{
+			BaseInfo: entity.BaseInfo{ID: prefix + "-3"},
+			DagID:    dagID,
+			Status:   entity.DagInstanceStatusScheduled,
+			Worker:   prefix + "-worker2",
+			Labels:   map[string]string{"team": "infra"},
+			Priority: 1,
+			// child of the first one
+			ParentDagInsID: prefix + "-1",
+			RootDagInsID:   prefix + "-1",
+		},
+	}
+	for i := range give {
+		if !assert.NoError(t, st.CreateDagIns(give[i]), "create dag instance") {
+			return
+		}
+		assert.Greater(t, give[i].CreatedAt, int64(0))
+	}
+	err := st.CreateDagIns(&entity.DagInstance{BaseInfo: entity.BaseInfo{ID: give[0].ID}})
+	assert.True(t, errors.Is(err, data.ErrDataConflicted), "create existed dag instance should return ErrDataConflicted, got: %v", err)
+
+	ret, err := st.GetDagInstance(give[0].ID)
+	if !assert.NoError(t, err, "get dag instance") {
+		return
+	}
+	assert.Equal(t, dagID, ret.DagID)
+	assert.Equal(t, entity.TriggerManually, ret.Trigger)
+	assert.Equal(t, "val", ret.Vars["key"].Value)
+	if assert.NotNil(t, ret.ShareData) {
+		v, _ := ret.ShareData.Get("share")
+		assert.Equal(t, "data", v)
+	}
+	_, err = st.GetDagInstance(prefix + "-not-existed")
+	assert.True(t, errors.Is(err, data.ErrDataNotFound), "get not existed dag instance should return ErrDataNotFound, got: %v", err)
+
+	tests := []struct {
+		caseDesc string
+		giveIpt  *mod.ListDagInstanceInput
+		wantIDs  []string
+	}{
+		{
+			caseDesc: "dag id",
+			giveIpt:  &mod.ListDagInstanceInput{DagID: dagID},
+			wantIDs:  []string{give[0].ID, give[1].ID, give[2].ID},
+		},
+		{
+			caseDesc: "status",
+			giveIpt: &mod.ListDagInstanceInput{
+				DagID:  dagID,
+				Status: []entity.DagInstanceStatus{entity.DagInstanceStatusRunning, entity.DagInstanceStatusScheduled},
+			},
+			wantIDs: []string{give[1].ID, give[2].ID},
+		},
+		{
+			caseDesc: "worker",
+			giveIpt:  &mod.ListDagInstanceInput{Worker: prefix + "-worker2"},
+			wantIDs:  []string{give[2].ID},
+		},
+		{
+			caseDesc: "trigger",
+			giveIpt:  &mod.ListDagInstanceInput{DagID: dagID, Trigger: entity.TriggerWebhook},
+			wantIDs:  []string{give[1].ID},
+		},
+		{
+			caseDesc: "trigger source",
+			giveIpt:  &mod.ListDagInstanceInput{TriggerSource: prefix + "-source"},
+			wantIDs:  []string{give[1].ID},
+		},
+		{
+			caseDesc: "labels",
+			giveIpt:  &mod.ListDagInstanceInput{DagID: dagID, Labels: map[string]string{"team": "infra"}},
+			wantIDs:  []string{give[1].ID, give[2].ID},
+		},
+		{
+			caseDesc: "multiple labels",
+			giveIpt:  &mod.ListDagInstanceInput{DagID: dagID, Labels: map[string]string{"team": "infra", "env": "prod"}},
+			wantIDs:  []string{give[1].ID},
+		},
+		{
+			caseDesc: "root dag instance",
+			giveIpt:  &mod.ListDagInstanceInput{RootDagInsID: prefix + "-1"},
+			wantIDs:  []string{give[2].ID},
+		},
+		{
+			caseDesc: "limit",
+			giveIpt:  &mod.ListDagInstanceInput{DagID: dagID, Limit: 2},
+			wantIDs:  []string{give[0].ID, give[1].ID},
+		},
+		{
+			caseDesc: "limit and offset",
+			giveIpt:  &mod.ListDagInstanceInput{DagID: dagID, Limit: 1, Offset: 1},
+			wantIDs:  []string{give[1].ID},
+		},
+		{
+			caseDesc: "sort by priority",
+			giveIpt:  &mod.ListDagInstanceInput{DagID: dagID, SortByPriority: true},
+			wantIDs:  []string{give[1].ID, give[2].ID, give[0].ID},
+		},
+		{
+			caseDesc: "sort by priority with paging",
+			giveIpt:  &mod.ListDagInstanceInput{DagID: dagID, SortByPriority: true, Limit: 1, Offset: 1},
+			wantIDs:  []string{give[2].ID},
+		},
+		{
+			caseDesc: "updated end",
+			giveIpt:  &mod.ListDagInstanceInput{DagID: dagID, UpdatedEnd: give[0].CreatedAt - 1},
+		},
+		{
+			caseDesc: "created range",
+			giveIpt:  &mod.ListDagInstanceInput{DagID: dagID, CreatedBegin: give[0].CreatedAt, CreatedEnd: give[2].CreatedAt},
+			wantIDs:  []string{give[0].ID, give[1].ID, give[2].ID},
+		},
+		{
+			caseDesc: "created after",
+			giveIpt:  &mod.ListDagInstanceInput{DagID: dagID, CreatedBegin: give[2].CreatedAt + 1},
+		},
+		{
+			caseDesc: "no matched",
+			giveIpt:  &mod.ListDagInstanceInput{DagID: prefix + "-not-existed"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			ret, err := st.ListDagInstance(tc.giveIpt)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantIDs, dagInsIDs(ret))
+		})
+	}
+
+	// patch only set non-empty fields, except musts patch fields
+	err = st.PatchDagIns(&entity.DagInstance{
+		BaseInfo: entity.BaseInfo{ID: give[0].ID},
+		Status:   entity.DagInstanceStatusFailed,
+		Reason:   "failed",
+		Cmd:      &entity.Command{Name: entity.CommandNameRetry, TargetTaskInsIDs: []string{"task1"}},
+	})
+	assert.NoError(t, err, "patch dag instance")
+	ret, err = st.GetDagInstance(give[0].ID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, entity.DagInstanceStatusFailed, ret.Status)
+		assert.Equal(t, "failed", ret.Reason)
+		assert.Equal(t, "val", ret.Vars["key"].Value, "patch should not modify other fields")
+		if assert.NotNil(t, ret.Cmd) {
+			assert.Equal(t, []string{"task1"}, ret.Cmd.TargetTaskInsIDs)
+		}
+	}
+	err = st.PatchDagIns(&entity.DagInstance{
+		BaseInfo:    entity.BaseInfo{ID: give[0].ID},
+		Notes:       []entity.Note{{Content: "note", Author: "ops", CreatedAt: 1}},
+		Annotations: map[string]string{"ticket": "OPS-123"},
+	})
+	assert.NoError(t, err, "patch dag instance notes and annotations")
+	ret, err = st.GetDagInstance(give[0].ID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []entity.Note{{Content: "note", Author: "ops", CreatedAt: 1}}, ret.Notes)
+		assert.Equal(t, map[string]string{"ticket": "OPS-123"}, ret.Annotations)
+		assert.Equal(t, entity.DagInstanceStatusFailed, ret.Status, "patch should not modify other fields")
+	}
+	summary := &entity.DagInstanceSummary{
+		StatusCounts: map[entity.TaskInstanceStatus]int{entity.TaskInstanceStatusFailed: 1},
+		FailedTasks:  []entity.FailedTaskBrief{{TaskID: "task1", TaskInsID: "ins1", Status: entity.TaskInstanceStatusFailed, Reason: "failed"}},
+		RetryCount:   2,
+	}
+	err = st.PatchDagIns(&entity.DagInstance{BaseInfo: entity.BaseInfo{ID: give[0].ID}, Summary: summary})
+	assert.NoError(t, err, "patch dag instance summary")
+	ret, err = st.GetDagInstance(give[0].ID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, summary, ret.Summary)
+	}
+	err = st.PatchDagIns(&entity.DagInstance{BaseInfo: entity.BaseInfo{ID: give[0].ID}, RetryCount: 3})
+	assert.NoError(t, err, "patch dag instance retry count")
+	ret, err = st.GetDagInstance(give[0].ID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 3, ret.RetryCount)
+	}
+	err = st.PatchDagIns(&entity.DagInstance{BaseInfo: entity.BaseInfo{ID: give[0].ID}, Deadline: 100})
+	assert.NoError(t, err, "patch dag instance deadline")
+	expired, err := st.ListDagInstance(&mod.ListDagInstanceInput{DagID: dagID, DeadlineEnd: 100})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{give[0].ID}, dagInsIDs(expired))
+	expired, err = st.ListDagInstance(&mod.ListDagInstanceInput{DagID: dagID, DeadlineEnd: 99})
+	assert.NoError(t, err)
+	assert.Empty(t, expired)
+	slas := []entity.SLA{{Deadline: 100, MissedAt: 101}, {TaskID: "task1", Deadline: 200}}
+	err = st.PatchDagIns(&entity.DagInstance{BaseInfo: entity.BaseInfo{ID: give[0].ID}, SLAs: slas,
+		SLADeadline: 200, SLAMissedAt: 101})
+	assert.NoError(t, err, "patch dag instance slas")
+	missed, err := st.ListDagInstance(&mod.ListDagInstanceInput{DagID: dagID, SLAMissed: true, SLADeadlineEnd: 200})
+	if assert.NoError(t, err) && assert.Equal(t, []string{give[0].ID}, dagInsIDs(missed)) {
+		assert.Equal(t, slas, missed[0].SLAs)
+	}
+	missed, err = st.ListDagInstance(&mod.ListDagInstanceInput{DagID: dagID, SLADeadlineEnd: 199})
+	assert.NoError(t, err)
+	assert.Empty(t, missed)
+	err = st.PatchDagIns(&entity.DagInstance{BaseInfo: entity.BaseInfo{ID: give[0].ID}}, "SLADeadline")
+	assert.NoError(t, err, "clear dag instance sla deadline")
+	missed, err = st.ListDagInstance(&mod.ListDagInstanceInput{DagID: dagID, SLADeadlineEnd: 200})
+	assert.NoError(t, err)
+	assert.Empty(t, missed)
+	deadLetter := &entity.DeadLetter{Reason: "failed", CreatedAt: 1}
+	err = st.PatchDagIns(&entity.DagInstance{BaseInfo: entity.BaseInfo{ID: give[0].ID}, DeadLetter: deadLetter})
+	assert.NoError(t, err, "patch dag instance dead letter")
+	deadLetters, err := st.ListDagInstance(&mod.ListDagInstanceInput{DagID: dagID, DeadLetter: true})
+	if assert.NoError(t, err) && assert.Equal(t, []string{give[0].ID}, dagInsIDs(deadLetters)) {
+		assert.Equal(t, deadLetter, deadLetters[0].DeadLetter)
+	}
+	err = st.PatchDagIns(&entity.DagInstance{BaseInfo: entity.BaseInfo{ID: give[0].ID}}, "DeadLetter")
+	assert.NoError(t, err, "clear dag instance dead letter")
+	deadLetters, err = st.ListDagInstance(&mod.ListDagInstanceInput{DagID: dagID, DeadLetter: true})
+	assert.NoError(t, err)
+	assert.Empty(t, deadLetters)
+	hasCmd, err := st.ListDagInstance(&mod.ListDagInstanceInput{DagID: dagID, HasCmd: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{give[0].ID}, dagInsIDs(hasCmd))
+
+	err = st.PatchDagIns(&entity.DagInstance{
+		BaseInfo: entity.BaseInfo{ID: give[0].ID},
+		Status:   entity.DagInstanceStatusRunning,
+	}, "Cmd", "Reason")
+	assert.NoError(t, err, "patch dag instance with musts patch fields")
+	ret, err = st.GetDagInstance(give[0].ID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, entity.DagInstanceStatusRunning, ret.Status)
+		assert.Empty(t, ret.Reason)
+		assert.Nil(t, ret.Cmd)
+	}
+
+	// update replace whole document
+	ret.Worker = prefix + "-worker3"
+	ret.Status = entity.DagInstanceStatusSuccess
+	assert.NoError(t, st.UpdateDagIns(ret), "update dag instance")
+	ret, err = st.GetDagInstance(give[0].ID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, prefix+"-worker3", ret.Worker)
+		assert.Equal(t, entity.DagInstanceStatusSuccess, ret.Status)
+	}
+	err = st.UpdateDagIns(&entity.DagInstance{BaseInfo: entity.BaseInfo{ID: prefix + "-not-existed"}})
+	assert.True(t, errors.Is(err, data.ErrDataNotFound), "update not existed dag instance should return ErrDataNotFound, got: %v", err)
+
+	give[1].Status = entity.DagInstanceStatusBlocked
+	give[2].Status = entity.DagInstanceStatusBlocked
+	assert.NoError(t, st.BatchUpdateDagIns([]*entity.DagInstance{give[1], give[2]}), "batch update dag instance")
+	blocked, err := st.ListDagInstance(&mod.ListDagInstanceInput{
+		DagID:  dagID,
+		Status: []entity.DagInstanceStatus{entity.DagInstanceStatusBlocked},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{give[1].ID, give[2].ID}, dagInsIDs(blocked))
+}
+
+func testIdempotencyKey(t *testing.T, st mod.Store, prefix string) {
+	dagID := prefix + "-dag"
+	give := &entity.DagInstance{
+		BaseInfo:       entity.BaseInfo{ID: prefix + "-1"},
+		DagID:          dagID,
+		Status:         entity.DagInstanceStatusInit,
+		IdempotencyKey: "key",
+	}
+	assert.NoError(t, st.CreateDagIns(give), "create dag instance with idempotency key")
+	// the key is unique in the same dag only
+	assert.NoError(t, st.CreateDagIns(&entity.DagInstance{
+		BaseInfo:       entity.BaseInfo{ID: prefix + "-other"},
+		DagID:          prefix + "-other-dag",
+		IdempotencyKey: "key",
+	}), "create dag instance of other dag with same key")
+	assert.NoError(t, st.CreateDagIns(&entity.DagInstance{
+		BaseInfo: entity.BaseInfo{ID: prefix + "-no-key"},
+		DagID:    dagID,
+	}), "create dag instance without key")
+
+	// concurrent create with the same key, all of them should fail
+	wg := sync.WaitGroup{}
+	for i := 0; i < Concurrency; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := st.CreateDagIns(&entity.DagInstance{
+				BaseInfo:       entity.BaseInfo{ID: fmt.Sprintf("%s-dup-%d", prefix, i)},
+				DagID:          dagID,
+				IdempotencyKey: "key",
+			})
+			assert.True(t, errors.Is(err, data.ErrIdempotencyKeyConflicted), "create dag instance with existed key should return ErrIdempotencyKeyConflicted, got: %v", err)
+			assert.True(t, errors.Is(err, data.ErrDataConflicted), "ErrIdempotencyKeyConflicted should be ErrDataConflicted, got: %v", err)
+		}(i)
+	}
+	wg.Wait()
+	_, err := st.GetDagInstance(prefix + "-dup-0")
+	assert.True(t, errors.Is(err, data.ErrDataNotFound), "conflicted dag instance should not be created, got: %v", err)
+
+	ret, err := st.ListDagInstance(&mod.ListDagInstanceInput{DagID: dagID, IdempotencyKey: "key"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{give.ID}, dagInsIDs(ret))
+
+	// the released key can be used again
+	assert.NoError(t, st.PatchDagIns(&entity.DagInstance{BaseInfo: entity.BaseInfo{ID: give.ID}}, "IdempotencyKey"),
+		"release idempotency key")
+	got, err := st.GetDagInstance(give.ID)
+	if assert.NoError(t, err) {
+		assert.Empty(t, got.IdempotencyKey)
+		assert.Equal(t, entity.DagInstanceStatusInit, got.Status)
+	}
+	assert.NoError(t, st.CreateDagIns(&entity.DagInstance{
+		BaseInfo:       entity.BaseInfo{ID: prefix + "-2"},
+		DagID:          dagID,
+		IdempotencyKey: "key",
+	}), "create dag instance with released key")
+	ret, err = st.ListDagInstance(&mod.ListDagInstanceInput{DagID: dagID, IdempotencyKey: "key"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{prefix + "-2"}, dagInsIDs(ret))
+}
+
+func testTaskInstance(t *testing.T, st mod.Store, prefix string) {
+	dagInsID := prefix + "-dagins"
+	give := []*entity.TaskInstance{
+		{
+			BaseInfo:    entity.BaseInfo{ID: prefix + "-1"},
+			TaskID:      "task1",
+			DagInsID:    dagInsID,
+			ActionName:  "act",
+			TimeoutSecs: 3600,
+			Params:      map[string]interface{}{"key": "val"},
+			Status:      entity.TaskInstanceStatusInit,
+		},
+		{
+			BaseInfo:    entity.BaseInfo{ID: prefix + "-2"},
+			TaskID:      "task2",
+			DagInsID:    dagInsID,
+			DependOn:    []string{"task1"},
+			ActionName:  "act",
+			TimeoutSecs: 3600,
+			Status:      entity.TaskInstanceStatusRunning,
+		},
+		{
+			BaseInfo:   entity.BaseInfo{ID: prefix + "-3"},
+			TaskID:     "task3",
+			DagInsID:   dagInsID,
+			DependOn:   []string{"task2"},
+			ActionName: "act",
+			// negative timeout make it expired immediately
+			TimeoutSecs: -60,
+			Status:      entity.TaskInstanceStatusRunning,
+		},
+	}
+	if !assert.NoError(t, st.BatchCreatTaskIns(give), "batch create task instance") {
+		return
+	}
+	for i := range give {
+		assert.Greater(t, give[i].CreatedAt, int64(0))
+	}
+
+	ret, err := st.GetTaskIns(give[0].ID)
+	if !assert.NoError(t, err, "get task instance") {
+		return
+	}
+	assert.Equal(t, "task1", ret.TaskID)
+	assert.Equal(t, dagInsID, ret.DagInsID)
+	assert.Equal(t, "val", ret.Params["key"])
+	assert.Equal(t, 3600, ret.TimeoutSecs)
+	_, err = st.GetTaskIns(prefix + "-not-existed")
+	assert.True(t, errors.Is(err, data.ErrDataNotFound), "get not existed task instance should return ErrDataNotFound, got: %v", err)
+
+	tests := []struct {
+		caseDesc string
+		giveIpt  *mod.ListTaskInstanceInput
+		wantIDs  []string
+	}{
+		{
+			caseDesc: "dag instance id",
+			giveIpt:  &mod.ListTaskInstanceInput{DagInsID: dagInsID},
+			wantIDs:  []string{give[0].ID, give[1].ID, give[2].ID},
+		},
+		{
+			caseDesc: "ids",
+			giveIpt:  &mod.ListTaskInstanceInput{IDs: []string{give[0].ID, give[2].ID, prefix + "-not-existed"}},
+			wantIDs:  []string{give[0].ID, give[2].ID},
+		},
+		{
+			caseDesc: "task id",
+			giveIpt:  &mod.ListTaskInstanceInput{DagInsID: dagInsID, TaskID: "task2"},
+			wantIDs:  []string{give[1].ID},
+		},
+		{
+			caseDesc: "status",
+			giveIpt: &mod.ListTaskInstanceInput{
+				DagInsID: dagInsID,
+				Status:   []entity.TaskInstanceStatus{entity.TaskInstanceStatusRunning},
+			},
+			wantIDs: []string{give[1].ID, give[2].ID},
+		},
+		{
+			caseDesc: "expired",
+			giveIpt:  &mod.ListTaskInstanceInput{DagInsID: dagInsID, Expired: true},
+			wantIDs:  []string{give[2].ID},
+		},
+		{
+			caseDesc: "no matched",
+			giveIpt:  &mod.ListTaskInstanceInput{DagInsID: prefix + "-not-existed"},
+		},
+		{
+			caseDesc: "limit",
+			giveIpt:  &mod.ListTaskInstanceInput{DagInsID: dagInsID, Limit: 2},
+			wantIDs:  []string{give[0].ID, give[1].ID},
+		},
+		{
+			caseDesc: "offset",
+			giveIpt:  &mod.ListTaskInstanceInput{DagInsID: dagInsID, Limit: 2, Offset: 2},
+			wantIDs:  []string{give[2].ID},
+		},
+		{
+			caseDesc: "after id",
+			giveIpt:  &mod.ListTaskInstanceInput{DagInsID: dagInsID, AfterID: give[0].ID, Limit: 1},
+			wantIDs:  []string{give[1].ID},
+		},
+		{
+			caseDesc: "after deleted id",
+			giveIpt:  &mod.ListTaskInstanceInput{DagInsID: dagInsID, AfterID: give[1].ID + "-deleted"},
+			wantIDs:  []string{give[2].ID},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.caseDesc, func(t *testing.T) {
+			ret, err := st.ListTaskInstance(tc.giveIpt)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantIDs, taskInsIDs(ret))
+		})
+	}
+
+	// patch only set non-empty fields
+	err = st.PatchTaskIns(&entity.TaskInstance{
+		BaseInfo:  entity.BaseInfo{ID: give[0].ID},
+		Status:    entity.TaskInstanceStatusFailed,
+		Reason:    "failed",
+		Traces:    []entity.TraceInfo{{Time: 1, Message: "trace"}},
+		TimeUsed:  "1s",
+		Attempts:  []entity.TaskAttempt{{Attempt: 1, Worker: "worker", StartedAt: 1, EndedAt: 2, Status: entity.TaskInstanceStatusFailed}},
+		Artifacts: []run.Artifact{{Name: "report", URI: "s3://bucket/report", CreatedAt: 1}},
+		Lineage:   &run.Lineage{Outputs: []run.Dataset{{Namespace: "s3://bucket", Name: "report"}}},
+		ShareDataSnapshot: &entity.ShareDataSnapshot{
+			Before: map[string]string{"k": "v1"},
+			After:  map[string]string{"k": "v2"},
+		},
+		BranchSkipped: true,
+		MapItems:      []string{"a", "b"},
+		SubDagInsID:   "sub-ins",
+	})
+	assert.NoError(t, err, "patch task instance")
+	ret, err = st.GetTaskIns(give[0].ID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, entity.TaskInstanceStatusFailed, ret.Status)
+		assert.Equal(t, "failed", ret.Reason)
+		assert.Equal(t, "1s", ret.TimeUsed)
+		assert.Equal(t, []entity.TraceInfo{{Time: 1, Message: "trace"}}, ret.Traces)
+		assert.Equal(t, []entity.TaskAttempt{{Attempt: 1, Worker: "worker", StartedAt: 1, EndedAt: 2, Status: entity.TaskInstanceStatusFailed}}, ret.Attempts)
+		assert.Equal(t, []run.Artifact{{Name: "report", URI: "s3://bucket/report", CreatedAt: 1}}, ret.Artifacts)
+		assert.Equal(t, &run.Lineage{Outputs: []run.Dataset{{Namespace: "s3://bucket", Name: "report"}}}, ret.Lineage)
+		assert.Equal(t, &entity.ShareDataSnapshot{
+			Before: map[string]string{"k": "v1"},
+			After:  map[string]string{"k": "v2"},
+		}, ret.ShareDataSnapshot)
+		assert.True(t, ret.BranchSkipped)
+		assert.Equal(t, []string{"a", "b"}, ret.MapItems)
+		assert.Equal(t, "sub-ins", ret.SubDagInsID)
+		assert.Equal(t, "act", ret.ActionName, "patch should not modify other fields")
+	}
+	artifactIns, err := st.ListTaskInstance(&mod.ListTaskInstanceInput{DagInsID: dagInsID, HasArtifact: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{give[0].ID}, taskInsIDs(artifactIns))
+	assert.Error(t, st.PatchTaskIns(&entity.TaskInstance{}), "patch task instance without id should be rejected")
+
+	// update replace whole document
+	ret.Status = entity.TaskInstanceStatusSuccess
+	ret.Reason = ""
+	assert.NoError(t, st.UpdateTaskIns(ret), "update task instance")
+	ret, err = st.GetTaskIns(give[0].ID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, entity.TaskInstanceStatusSuccess, ret.Status)
+		assert.Empty(t, ret.Reason)
+	}
+	err = st.UpdateTaskIns(&entity.TaskInstance{BaseInfo: entity.BaseInfo{ID: prefix + "-not-existed"}})
+	assert.True(t, errors.Is(err, data.ErrDataNotFound), "update not existed task instance should return ErrDataNotFound, got: %v", err)
+
+	give[1].Status = entity.TaskInstanceStatusCanceled
+	give[2].Status = entity.TaskInstanceStatusCanceled
+	assert.NoError(t, st.BatchUpdateTaskIns([]*entity.TaskInstance{give[1], give[2]}), "batch update task instance")
+	canceled, err := st.ListTaskInstance(&mod.ListTaskInstanceInput{
+		DagInsID: dagInsID,
+		Status:   []entity.TaskInstanceStatus{entity.TaskInstanceStatusCanceled},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{give[1].ID, give[2].ID}, taskInsIDs(canceled))
+}
+
+func testConcurrency(t *testing.T, st mod.Store, prefix string) {
+	dagID := prefix + "-dag"
+	dagInsID := prefix + "-dagins"
+
+	// concurrent create with different ids
+	wg := sync.WaitGroup{}
+	for i := 0; i < Concurrency; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			assert.NoError(t, st.CreateDagIns(&entity.DagInstance{
+				BaseInfo: entity.BaseInfo{ID: fmt.Sprintf("%s-%d", prefix, i)},
+				DagID:    dagID,
+				Status:   entity.DagInstanceStatusInit,
+			}))
+			assert.NoError(t, st.BatchCreatTaskIns([]*entity.TaskInstance{{
+				BaseInfo: entity.BaseInfo{ID: fmt.Sprintf("%s-task-%d", prefix, i)},
+				TaskID:   fmt.Sprintf("task%d", i),
+				DagInsID: dagInsID,
+				Status:   entity.TaskInstanceStatusInit,
+			}}))
+		}(i)
+	}
+	wg.Wait()
+
+	dagIns, err := st.ListDagInstance(&mod.ListDagInstanceInput{DagID: dagID})
+	assert.NoError(t, err)
+	assert.Len(t, dagIns, Concurrency)
+	taskIns, err := st.ListTaskInstance(&mod.ListTaskInstanceInput{DagInsID: dagInsID})
+	assert.NoError(t, err)
+	assert.Len(t, taskIns, Concurrency)
+
+	// concurrent create with same id, only one should succeed
+	var (
+		succeed int
+		mutex   sync.Mutex
+	)
+	for i := 0; i < Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := st.CreateDagIns(&entity.DagInstance{BaseInfo: entity.BaseInfo{ID: prefix + "-same"}, DagID: dagID})
+			if err == nil {
+				mutex.Lock()
+				succeed++
+				mutex.Unlock()
+				return
+			}
+			assert.True(t, errors.Is(err, data.ErrDataConflicted), "create existed dag instance should return ErrDataConflicted, got: %v", err)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1, succeed, "only one creation should succeed")
+
+	// concurrent patch different task instances
+	for i := range taskIns {
+		wg.Add(1)
+		go func(taskIns *entity.TaskInstance) {
+			defer wg.Done()
+			assert.NoError(t, st.PatchTaskIns(&entity.TaskInstance{
+				BaseInfo: entity.BaseInfo{ID: taskIns.ID},
+				Status:   entity.TaskInstanceStatusSuccess,
+			}))
+		}(taskIns[i])
+	}
+	wg.Wait()
+	succeedTasks, err := st.ListTaskInstance(&mod.ListTaskInstanceInput{
+		DagInsID: dagInsID,
+		Status:   []entity.TaskInstanceStatus{entity.TaskInstanceStatusSuccess},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, succeedTasks, Concurrency)
+}
+
+func testClusterConfig(t *testing.T, st mod.ClusterConfigStore) {
+	// restore the config after testing, the empty config is same as not saved
+	origin, err := st.GetClusterConfig()
+	if err != nil {
+		if !assert.True(t, errors.Is(err, data.ErrDataNotFound), "get not saved config should return ErrDataNotFound, got: %v", err) {
+			return
+		}
+		origin = &entity.ClusterConfig{}
+	}
+	defer func() {
+		assert.NoError(t, st.SaveClusterConfig(origin))
+	}()
+
+	give := &entity.ClusterConfig{DispatchBatchSize: 10, ExecutorWorkerCnt: 5, UpdatedAt: time.Now().Unix()}
+	assert.NoError(t, st.SaveClusterConfig(give))
+	ret, err := st.GetClusterConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, give, ret)
+
+	give = &entity.ClusterConfig{StallTimeoutSecs: -1}
+	assert.NoError(t, st.SaveClusterConfig(give))
+	ret, err = st.GetClusterConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, give, ret, "saving should replace the whole config")
+}
+
+func testWorkerInfo(t *testing.T, st mod.WorkerInfoStore, prefix string) {
+	give := &entity.WorkerInfo{
+		Key:            prefix + "-1",
+		Version:        "v1.0.0",
+		StartedAt:      time.Now().Unix(),
+		Labels:         map[string]string{"zone": "a"},
+		Capacity:       10,
+		OwnedDagInsIDs: []string{"dag-ins-1"},
+		RunningTasks: []entity.RunningTask{
+			{TaskInsID: "task-ins-1", DagInsID: "dag-ins-1", TaskID: "task-1", StartedAt: 1, ElapsedMs: 100},
+		},
+		ParserQueueLen:   1,
+		ExecutorQueueLen: 2,
+		ReportedAt:       time.Now().Unix(),
+		Alive:            true,
+	}
+	assert.NoError(t, st.SaveWorkerInfo(give))
+	assert.NoError(t, st.SaveWorkerInfo(&entity.WorkerInfo{Key: prefix + "-2"}))
+
+	// replace the info of worker
+	give.Capacity = 20
+	give.RunningTasks = nil
+	assert.NoError(t, st.SaveWorkerInfo(give))
+
+	ret, err := st.ListWorkerInfo()
+	assert.NoError(t, err)
+	var got []*entity.WorkerInfo
+	for _, info := range ret {
+		if strings.HasPrefix(info.Key, prefix) {
+			got = append(got, info)
+		}
+	}
+	want := *give
+	want.Alive = false
+	assert.Equal(t, []*entity.WorkerInfo{&want, {Key: prefix + "-2"}}, got, "alive should not be persisted")
+}
+
+func testRateLimit(t *testing.T, st mod.RateLimitStore, prefix string) {
+	start := time.Now().Truncate(time.Minute)
+	for i := 1; i <= 3; i++ {
+		cnt, err := st.IncrRateLimitCounter(prefix+"-a", start, time.Minute)
+		assert.NoError(t, err)
+		assert.Equal(t, i, cnt)
+	}
+
+	// counters are separated by key and window
+	cnt, err := st.IncrRateLimitCounter(prefix+"-b", start, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, cnt)
+	cnt, err = st.IncrRateLimitCounter(prefix+"-a", start.Add(time.Minute), time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, cnt)
+}
+
+func testTaskLog(t *testing.T, st mod.TaskLogStore, prefix string) {
+	newLogs := func(from, to int64) []*entity.TaskLog {
+		var logs []*entity.TaskLog
+		for seq := from; seq <= to; seq++ {
+			logs = append(logs, &entity.TaskLog{
+				Seq:     seq,
+				Time:    seq,
+				Level:   entity.TaskLogLevelInfo,
+				Message: "log " + strconv.FormatInt(seq, 10),
+				Fields:  map[string]string{"seq": strconv.FormatInt(seq, 10)},
+			})
+		}
+		return logs
+	}
+
+	logs, err := st.GetTaskLogs(prefix+"-none", 0, 10)
+	assert.NoError(t, err)
+	assert.Empty(t, logs)
+
+	assert.NoError(t, st.AppendTaskLogs(prefix, newLogs(1, 3), 5))
+	assert.NoError(t, st.AppendTaskLogs(prefix, newLogs(4, 6), 5))
+	assert.NoError(t, st.AppendTaskLogs(prefix+"-other", newLogs(1, 1), 5))
+
+	// the oldest logs are rotated
+	logs, err = st.GetTaskLogs(prefix, 0, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, newLogs(2, 6), logs)
+
+	// read from cursor with limit
+	logs, err = st.GetTaskLogs(prefix, 3, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, newLogs(4, 5), logs)
+	logs, err = st.GetTaskLogs(prefix, 6, 2)
+	assert.NoError(t, err)
+	assert.Empty(t, logs)
+}
+
+func testTaskInsClaim(t *testing.T, st mod.Store, cs mod.TaskInsClaimStore, prefix string) {
+	id := prefix + "-task"
+	assert.NoError(t, st.BatchCreatTaskIns([]*entity.TaskInstance{{
+		BaseInfo: entity.BaseInfo{ID: id},
+		TaskID:   "task",
+		DagInsID: prefix + "-dagins",
+		Status:   entity.TaskInstanceStatusInit,
+	}}))
+
+	ok, err := cs.ClaimTaskIns(id, "worker-1", time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, ok, "claim unclaimed task instance")
+	ok, err = cs.ClaimTaskIns(id, "worker-2", time.Minute)
+	assert.NoError(t, err)
+	assert.False(t, ok, "task instance claimed by others cannot be claimed")
+	ok, err = cs.ClaimTaskIns(id, "worker-1", time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, ok, "worker can renew its claim")
+	taskIns, err := st.GetTaskIns(id)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "worker-1", taskIns.Worker)
+		assert.Greater(t, taskIns.ClaimExpiresAt, time.Now().Unix())
+	}
+
+	assert.NoError(t, st.PatchTaskIns(&entity.TaskInstance{
+		BaseInfo: entity.BaseInfo{ID: id},
+		Status:   entity.TaskInstanceStatusRunning,
+	}))
+	ok, err = cs.ClaimTaskIns(id, "worker-1", time.Minute)
+	assert.NoError(t, err)
+	assert.False(t, ok, "running task instance cannot be claimed")
+
+	// the claim is released by expiring it
+	assert.NoError(t, st.PatchTaskIns(&entity.TaskInstance{
+		BaseInfo:       entity.BaseInfo{ID: id},
+		Status:         entity.TaskInstanceStatusRetrying,
+		ClaimExpiresAt: time.Now().Unix(),
+	}))
+	ok, err = cs.ClaimTaskIns(id, "worker-2", -time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, ok, "released task instance can be claimed by others")
+	ok, err = cs.ClaimTaskIns(id, "worker-1", time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, ok, "expired claim can be taken over by others")
+
+	// concurrent claim, only one should succeed
+	id = prefix + "-same"
+	assert.NoError(t, st.BatchCreatTaskIns([]*entity.TaskInstance{{
+		BaseInfo: entity.BaseInfo{ID: id},
+		TaskID:   "same",
+		DagInsID: prefix + "-dagins",
+		Status:   entity.TaskInstanceStatusInit,
+	}}))
+	var (
+		succeed int
+		mutex   sync.Mutex
+		wg      sync.WaitGroup
+	)
+	for i := 0; i < Concurrency; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ok, err := cs.ClaimTaskIns(id, fmt.Sprintf("worker-%d", i), time.Minute)
+			assert.NoError(t, err)
+			if ok {
+				mutex.Lock()
+				succeed++
+				mutex.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, 1, succeed, "only one worker should claim the task instance")
+}
+
+func testTx(t *testing.T, st mod.Store, ts mod.TxStore, prefix string) {
+	create := func(id string) func(tx mod.Store) error {
+		return func(tx mod.Store) error {
+			if err := tx.CreateDagIns(&entity.DagInstance{
+				BaseInfo: entity.BaseInfo{ID: id},
+				DagID:    prefix + "-dag",
+				Status:   entity.DagInstanceStatusScheduled,
+			}); err != nil {
+				return err
+			}
+			return tx.BatchCreatTaskIns([]*entity.TaskInstance{{
+				BaseInfo: entity.BaseInfo{ID: id + "-task"},
+				DagInsID: id,
+				TaskID:   "task1",
+				Status:   entity.TaskInstanceStatusInit,
+			}})
+		}
+	}
+
+	committed := prefix + "-committed"
+	if err := ts.WithTx(create(committed)); err != nil {
+		// e.g. mongo which is not deployed as a replica set
+		t.Skipf("transaction is not available: %s", err)
+	}
+	_, err := st.GetDagInstance(committed)
+	assert.NoError(t, err)
+	_, err = st.GetTaskIns(committed + "-task")
+	assert.NoError(t, err)
+
+	rolledBack := prefix + "-rolled-back"
+	wantErr := errors.New("abort")
+	err = ts.WithTx(func(tx mod.Store) error {
+		if err := create(rolledBack)(tx); err != nil {
+			return err
+		}
+		if err := tx.PatchDagIns(&entity.DagInstance{
+			BaseInfo: entity.BaseInfo{ID: committed},
+			Status:   entity.DagInstanceStatusRunning,
+		}); err != nil {
+			return err
+		}
+		return wantErr
+	})
+	assert.True(t, errors.Is(err, wantErr), "error of fn should be returned")
+	_, err = st.GetDagInstance(rolledBack)
+	assert.True(t, errors.Is(err, data.ErrDataNotFound), "created dag instance should be rolled back")
+	_, err = st.GetTaskIns(rolledBack + "-task")
+	assert.True(t, errors.Is(err, data.ErrDataNotFound), "created task instance should be rolled back")
+	dagIns, err := st.GetDagInstance(committed)
+	if assert.NoError(t, err) {
+		assert.Equal(t, entity.DagInstanceStatusScheduled, dagIns.Status, "patch should be rolled back")
+	}
+}
+
+func testRetryCount(t *testing.T, st mod.Store, rs mod.RetryCountStore, prefix string) {
+	id := prefix + "-dagins"
+	assert.NoError(t, st.CreateDagIns(&entity.DagInstance{
+		BaseInfo: entity.BaseInfo{ID: id},
+		DagID:    prefix + "-dag",
+		Status:   entity.DagInstanceStatusFailed,
+	}))
+
+	ok, err := rs.SwapRetryCount(id, 0, 2)
+	assert.NoError(t, err)
+	assert.True(t, ok, "swap retry count which is never set")
+	ok, err = rs.SwapRetryCount(id, 0, 1)
+	assert.NoError(t, err)
+	assert.False(t, ok, "retry count is changed")
+	dagIns, err := st.GetDagInstance(id)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 2, dagIns.RetryCount)
+		assert.Equal(t, entity.DagInstanceStatusFailed, dagIns.Status, "swap should not modify other fields")
+	}
+
+	// concurrent swap from the same count, only one should succeed
+	var (
+		succeed int
+		mutex   sync.Mutex
+		wg      sync.WaitGroup
+	)
+	for i := 0; i < Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, err := rs.SwapRetryCount(id, 2, 3)
+			assert.NoError(t, err)
+			if ok {
+				mutex.Lock()
+				succeed++
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1, succeed, "only one retry should consume the budget")
+}
+
+func testLease(t *testing.T, st mod.LeaseStore, prefix string) {
+	key := prefix + "/a"
+	ok, err := st.AcquireLease(key, "holder-1", time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, ok, "acquire free lease")
+	ok, err = st.AcquireLease(key, "holder-2", time.Minute)
+	assert.NoError(t, err)
+	assert.False(t, ok, "lease held by others cannot be acquired")
+	ok, err = st.AcquireLease(key, "holder-1", time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, ok, "holder can renew its lease")
+
+	ok, err = st.AcquireLease(prefix+"/b", "holder-2", time.Millisecond)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	time.Sleep(10 * time.Millisecond)
+	leases, err := st.ListLease(prefix + "/")
+	assert.NoError(t, err)
+	if assert.Len(t, leases, 1, "expired lease should not be listed") {
+		assert.Equal(t, key, leases[0].Key)
+		assert.Equal(t, "holder-1", leases[0].Holder)
+	}
+	ok, err = st.AcquireLease(prefix+"/b", "holder-1", time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, ok, "expired lease can be acquired by others")
+
+	ok, err = st.ReleaseLease(key, "holder-2")
+	assert.NoError(t, err)
+	assert.False(t, ok, "lease held by others cannot be released")
+	ok, err = st.ReleaseLease(key, "holder-1")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = st.AcquireLease(key, "holder-2", time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, ok, "released lease can be acquired by others")
+
+	// concurrent acquire, only one should succeed
+	var (
+		succeed int
+		mutex   sync.Mutex
+		wg      sync.WaitGroup
+	)
+	for i := 0; i < Concurrency; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ok, err := st.AcquireLease(prefix+"/same", fmt.Sprintf("holder-%d", i), time.Minute)
+			assert.NoError(t, err)
+			if ok {
+				mutex.Lock()
+				succeed++
+				mutex.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, 1, succeed, "only one holder should acquire the lease")
+}
+
+func testMarshal(t *testing.T, st mod.Store) {
+	give := map[string]string{"key": "val"}
+	bs, err := st.Marshal(give)
+	if !assert.NoError(t, err) {
+		return
+	}
+	ret := map[string]string{}
+	assert.NoError(t, st.Unmarshal(bs, &ret))
+	assert.Equal(t, give, ret)
+}
+
+func dagInsIDs(dagIns []*entity.DagInstance) []string {
+	var ids []string
+	for i := range dagIns {
+		ids = append(ids, dagIns[i].ID)
+	}
+	return ids
+}
+
+func taskInsIDs(taskIns []*entity.TaskInstance) []string {
+	var ids []string
+	for i := range taskIns {
+		ids = append(ids, taskIns[i].ID)
+	}
+	return ids
+}